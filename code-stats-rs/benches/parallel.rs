@@ -0,0 +1,77 @@
+//! Compares sequential and parallel directory analysis.
+//!
+//! Run with `cargo bench --bench parallel`. The benchmark generates a
+//! synthetic project in a temporary directory and times the release binary
+//! with `--jobs 1` against `--jobs 0` (one worker per CPU). Every run passes
+//! `--no-cache`, so each one parses the whole project instead of reading the
+//! results of the previous run, and runs from the temporary directory so
+//! nothing is written into the crate.
+
+use std::fs;
+use std::path::Path;
+use std::process::Command;
+use std::time::{Duration, Instant};
+use tempfile::TempDir;
+
+const FILE_COUNT: usize = 400;
+const FUNCTIONS_PER_FILE: usize = 50;
+const ITERATIONS: usize = 3;
+
+/// Writes `FILE_COUNT` Rust and Python files into `root`.
+fn generate_project(root: &Path) {
+    for i in 0..FILE_COUNT {
+        let dir = root.join(format!("module{}", i % 20));
+        fs::create_dir_all(&dir).unwrap();
+
+        let mut rust = String::new();
+        let mut python = String::new();
+        for j in 0..FUNCTIONS_PER_FILE {
+            rust.push_str(&format!(
+                "struct S{j} {{ value: i32 }}\n\
+                 fn f{j}(x: i32) -> i32 {{\n    if x > {j} && x < 100 {{ x * 2 }} else {{ x }}\n}}\n"
+            ));
+            python.push_str(&format!(
+                "class C{j}:\n    def m{j}(self, x):\n        return x if x > {j} else -x\n\n"
+            ));
+        }
+        fs::write(dir.join(format!("file{i}.rs")), rust).unwrap();
+        fs::write(dir.join(format!("file{i}.py")), python).unwrap();
+    }
+}
+
+/// Runs the binary against `root` without the result cache and returns the
+/// best wall-clock time.
+fn time_run(root: &Path, jobs: &str) -> Duration {
+    (0..ITERATIONS)
+        .map(|_| {
+            let start = Instant::now();
+            let status = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+                .current_dir(root)
+                .arg(root)
+                .args(["--jobs", jobs, "--no-cache"])
+                .output()
+                .expect("failed to run code-stats-rs")
+                .status;
+            assert!(status.success());
+            start.elapsed()
+        })
+        .min()
+        .unwrap()
+}
+
+fn main() {
+    let temp_dir = TempDir::new().unwrap();
+    generate_project(temp_dir.path());
+
+    let sequential = time_run(temp_dir.path(), "1");
+    let parallel = time_run(temp_dir.path(), "0");
+    let cpus = std::thread::available_parallelism().map_or(1, |n| n.get());
+
+    println!("{} files, best of {ITERATIONS} runs", FILE_COUNT * 2);
+    println!("  --jobs 1: {sequential:?}");
+    println!("  --jobs 0: {parallel:?} ({cpus} workers)");
+    println!(
+        "  speedup:  {:.2}x",
+        sequential.as_secs_f64() / parallel.as_secs_f64()
+    );
+}
@@ -0,0 +1,58 @@
+//! Records the versions of the tree-sitter crates the binary is built with.
+//!
+//! The versions are taken from `Cargo.lock` and written to
+//! `$OUT_DIR/crate_versions.rs` as a `CRATE_VERSIONS` table of crate names
+//! and versions, which `codestats languages` lists and grammar pinning checks.
+//! Without a lock file, as when the crate is built as a dependency of another
+//! workspace, the table is empty and the versions are reported as unknown.
+
+use std::env;
+use std::fs;
+use std::path::Path;
+
+fn main() {
+    let manifest_dir = env::var("CARGO_MANIFEST_DIR").unwrap_or_default();
+    let lock_file = Path::new(&manifest_dir).join("Cargo.lock");
+    println!("cargo:rerun-if-changed={}", lock_file.display());
+    println!("cargo:rerun-if-changed=build.rs");
+
+    let lock = fs::read_to_string(&lock_file).unwrap_or_default();
+    let mut entries = String::new();
+    for (name, version) in packages(&lock) {
+        if name == "tree-sitter" || name.starts_with("tree-sitter-") {
+            entries.push_str(&format!("    ({name:?}, {version:?}),\n"));
+        }
+    }
+
+    let out_dir = env::var("OUT_DIR").expect("cargo sets OUT_DIR for build scripts");
+    let table = format!("pub(crate) const CRATE_VERSIONS: &[(&str, &str)] = &[\n{entries}];\n");
+    fs::write(Path::new(&out_dir).join("crate_versions.rs"), table)
+        .expect("failed to write crate_versions.rs");
+}
+
+/// Lists the name and version of every `[[package]]` of a lock file.
+fn packages(lock: &str) -> Vec<(&str, &str)> {
+    let mut packages = Vec::new();
+    let mut name = None;
+    for line in lock.lines() {
+        if line == "[[package]]" {
+            name = None;
+        } else if let Some(value) = quoted(line, "name") {
+            name = Some(value);
+        } else if let (Some(package), Some(version)) = (name, quoted(line, "version")) {
+            packages.push((package, version));
+            name = None;
+        }
+    }
+    packages
+}
+
+/// Returns the value of a `key = "value"` line.
+fn quoted<'a>(line: &'a str, key: &str) -> Option<&'a str> {
+    line.strip_prefix(key)?
+        .trim_start()
+        .strip_prefix('=')?
+        .trim()
+        .strip_prefix('"')?
+        .strip_suffix('"')
+}
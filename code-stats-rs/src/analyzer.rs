@@ -1,28 +1,365 @@
 //! Code analysis engine for processing source files and directories.
 
+use crate::cache::{AnalysisCache, CACHE_DIR};
+use crate::columns::{DEFAULT_TAB_WIDTH, TabWidths, line_column};
+use crate::comments::LineStats;
+use crate::component::add_sections;
+use crate::detect::LanguageMap;
+use crate::embedded::{is_nginx_config, lua_blocks};
+use crate::encoding::{SourceEncoding, decode, decode_lossy};
 use crate::error::{CodeStatsError, Result};
-use crate::language::SupportedLanguage;
-use crate::parser::{analyze_code, create_parser};
+use crate::extractor::{BuiltinExtractor, Extractor, ExtractorRegistry};
+use crate::fences::{CodeBlock, EmbeddedCode, code_blocks};
+use crate::language::{Dialect, SupportedLanguage};
+use crate::notebook::code_cells;
+use crate::origin::{CodeOrigin, is_generated, is_vendored};
+use crate::parser::{CodeStats, Symbol, count_queries, create_dialect_parser, extract_symbols};
+use crate::plugin::PluginSet;
+use crate::profile::{FileProfile, Profiler, Timing};
+use crate::query::{NamedQuery, QuerySet};
 use crate::stats::{DirectoryStats, FileStats};
-use std::collections::HashMap;
+use crate::templates::ruby_code;
+use crate::testcode::is_test_file;
+use crate::todos::{DEFAULT_MARKERS, todo_comments};
+use crate::tokens::TokenStats;
+use crate::web::inline_blocks;
+use globset::{GlobBuilder, GlobSet, GlobSetBuilder};
+use ignore::WalkBuilder;
+use memmap2::Mmap;
+use std::collections::hash_map::Entry;
+use std::collections::{BTreeMap, HashMap, HashSet};
 use std::fs;
-use std::path::Path;
-use tree_sitter::Parser;
-use walkdir::{DirEntry, WalkDir};
+use std::io::Read;
+use std::ops::ControlFlow;
+use std::ops::Deref;
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
+use std::sync::atomic::{AtomicBool, AtomicUsize, Ordering};
+use std::thread;
+use std::time::{Duration, Instant};
+use tree_sitter::{ParseOptions, ParseState, Parser, Tree};
+
+/// Options controlling which files a directory analysis visits and how
+/// the work is scheduled.
+#[derive(Debug, Clone)]
+pub struct DirectoryOptions {
+    /// Maximum depth for directory traversal (the root is depth 0)
+    pub max_depth: usize,
+    /// Whether to follow symbolic links to directories
+    pub follow_links: bool,
+    /// Whether to skip symbolic links altogether, including links to files
+    pub skip_links: bool,
+    /// Patterns to exclude files (substring matching)
+    pub ignore_patterns: Vec<String>,
+    /// Whether to honor `.gitignore`, `.ignore`, and git exclude files
+    pub respect_gitignore: bool,
+    /// Number of worker threads; 0 uses one per available CPU
+    pub jobs: usize,
+    /// Only analyze files matching these gitignore-style patterns (all files
+    /// if empty), see `glob_set`
+    pub include: Vec<String>,
+    /// Skip files matching these gitignore-style patterns
+    pub exclude: Vec<String>,
+    /// Directory `include` and `exclude` are relative to; the analyzed
+    /// directory if `None`
+    pub glob_root: Option<PathBuf>,
+    /// Count generated and vendored files in the code totals instead of
+    /// `DirectoryStats::generated`
+    pub include_generated: bool,
+}
+
+impl Default for DirectoryOptions {
+    fn default() -> Self {
+        Self {
+            max_depth: 100,
+            follow_links: false,
+            skip_links: false,
+            ignore_patterns: Vec::new(),
+            respect_gitignore: true,
+            jobs: 0,
+            include: Vec::new(),
+            exclude: Vec::new(),
+            glob_root: None,
+            include_generated: false,
+        }
+    }
+}
+
+/// Default size, in bytes, above which files are not parsed (64 MiB).
+pub const DEFAULT_MAX_PARSE_SIZE: u64 = 64 * 1024 * 1024;
+
+/// Default time after which the parse of a file is abandoned (30 seconds).
+pub const DEFAULT_PARSE_TIMEOUT: Duration = Duration::from_secs(30);
+
+/// Size, in bytes, from which files are memory-mapped instead of read into
+/// memory (1 MiB).
+const MMAP_THRESHOLD: u64 = 1024 * 1024;
+
+/// Number of leading bytes of an unparsed file searched for generated-code
+/// markers.
+const MARKER_BYTES: usize = 4096;
 
 /// Main analyzer that manages parsers and coordinates code analysis.
 ///
-/// Maintains a cache of tree-sitter parsers for each language to improve
-/// performance when analyzing multiple files.
-pub(crate) struct CodeAnalyzer {
-    parsers: HashMap<SupportedLanguage, Parser>,
+/// Maintains a cache of tree-sitter parsers for each language and dialect
+/// to improve performance when analyzing multiple files. An optional
+/// `AnalysisCache` lets unchanged files skip parsing entirely, an optional
+/// `QuerySet` adds user-defined counters to every analyzed file, an optional
+/// `PluginSet` adds the metrics of external programs, and a `LanguageMap` overrides language detection. Files outside the enabled
+/// languages, if any are set, are treated as unsupported. Parsed files are
+/// turned into statistics by the `Extractor` registered for their language.
+/// Files larger than the parse size limit only have their lines counted, see
+/// `with_max_parse_size`, and parses that exceed the parse timeout are
+/// abandoned, see `with_parse_timeout`.
+pub struct CodeAnalyzer {
+    parsers: HashMap<(SupportedLanguage, Dialect), Parser>,
+    cache: Option<Arc<AnalysisCache>>,
+    queries: Option<Arc<QuerySet>>,
+    plugins: Option<Arc<PluginSet>>,
+    languages: Arc<LanguageMap>,
+    enabled: Arc<[SupportedLanguage]>,
+    extractors: Arc<ExtractorRegistry>,
+    todo_markers: Arc<[String]>,
+    max_parse_size: u64,
+    parse_timeout: Option<Duration>,
+    /// Set to stop the analysis, see `with_cancellation`
+    cancelled: Option<Arc<AtomicBool>>,
+    tab_widths: Arc<TabWidths>,
+    /// Whether Lua embedded in configuration files is analyzed, see the
+    /// `embedded` module
+    embedded_lua: bool,
+    /// Whether the Ruby of ERB tags is analyzed, see `templates::ruby_code`
+    template_code: bool,
+    profiler: Option<Arc<Profiler>>,
+    /// Parse and query time of the file being analyzed, for the profiler
+    timing: Timing,
 }
 
 impl CodeAnalyzer {
     /// Creates a new analyzer instance with an empty parser cache.
-    pub(crate) fn new() -> Self {
+    pub fn new() -> Self {
         Self {
             parsers: HashMap::new(),
+            cache: None,
+            queries: None,
+            plugins: None,
+            languages: Arc::default(),
+            enabled: Arc::default(),
+            extractors: Arc::default(),
+            todo_markers: DEFAULT_MARKERS.map(str::to_string).into(),
+            max_parse_size: DEFAULT_MAX_PARSE_SIZE,
+            parse_timeout: Some(DEFAULT_PARSE_TIMEOUT),
+            cancelled: None,
+            tab_widths: Arc::default(),
+            embedded_lua: false,
+            template_code: false,
+            profiler: None,
+            timing: Timing::default(),
+        }
+    }
+
+    /// Makes the analyzer reuse and record results in `cache`.
+    pub(crate) fn with_cache(mut self, cache: Arc<AnalysisCache>) -> Self {
+        self.cache = Some(cache);
+        self
+    }
+
+    /// Makes the analyzer expand tabs to `width` columns in every file
+    /// instead of the width its `.editorconfig` sets.
+    pub(crate) fn with_tab_width(mut self, width: usize) -> Self {
+        self.tab_widths = Arc::new(TabWidths::new(Some(width)));
+        self
+    }
+
+    /// Returns the tab width that reported columns of the file at `path`
+    /// expand tabs to, see the `columns` module.
+    pub(crate) fn tab_width(&self, path: &Path) -> usize {
+        self.tab_widths.for_file(path)
+    }
+
+    /// Makes the analyzer extract the Lua embedded in nginx configurations
+    /// and in the long strings of YAML and TOML files and analyze it as Lua.
+    /// nginx configurations are analyzed as Lua files holding only that code.
+    pub fn with_embedded_lua(mut self) -> Self {
+        self.embedded_lua = true;
+        self
+    }
+
+    /// Makes the analyzer analyze the Ruby in the tags of ERB templates as
+    /// Ruby, reported as code embedded in the templates. The tags of Jinja
+    /// and Go templates hold the template language's own expressions and are
+    /// only counted.
+    pub fn with_template_code(mut self) -> Self {
+        self.template_code = true;
+        self
+    }
+
+    /// Makes the analyzer record the timing of every file it reads in
+    /// `profiler`.
+    pub(crate) fn with_profiler(mut self, profiler: Arc<Profiler>) -> Self {
+        self.profiler = Some(profiler);
+        self
+    }
+
+    /// Makes the analyzer run the custom queries in `queries` on every file.
+    pub(crate) fn with_queries(mut self, queries: Arc<QuerySet>) -> Self {
+        self.queries = Some(queries);
+        self
+    }
+
+    /// Makes the analyzer send every parsed file to the plugins in `plugins`
+    /// and record the metrics they return.
+    pub(crate) fn with_plugins(mut self, plugins: Arc<PluginSet>) -> Self {
+        self.plugins = Some(plugins);
+        self
+    }
+
+    /// Makes the analyzer look for `markers` instead of TODO, FIXME, HACK,
+    /// and XXX in comments. Empty markers are ignored.
+    pub(crate) fn with_todo_markers(mut self, markers: &[String]) -> Self {
+        self.todo_markers = markers
+            .iter()
+            .filter(|marker| !marker.is_empty())
+            .cloned()
+            .collect();
+        self
+    }
+
+    /// Makes the analyzer count only the lines of files and texts larger than
+    /// `bytes` instead of parsing them, so that huge generated sources don't
+    /// exhaust memory. Such sources are flagged with `CodeStats::oversized`.
+    pub fn with_max_parse_size(mut self, bytes: u64) -> Self {
+        self.max_parse_size = bytes;
+        self
+    }
+
+    /// Makes the analyzer give up parsing a file after `timeout`, failing
+    /// with `CodeStatsError::Timeout`, so that one pathological file can't
+    /// hang a whole run. A zero timeout disables the limit.
+    pub fn with_parse_timeout(mut self, timeout: Duration) -> Self {
+        self.parse_timeout = (!timeout.is_zero()).then_some(timeout);
+        self
+    }
+
+    /// Makes the analyzer stop once `cancelled` is set: the parse in progress
+    /// is abandoned and every further file fails with
+    /// `CodeStatsError::Cancelled`. Directory analysis then returns the files
+    /// analyzed so far, see `DirectoryStats::interrupted`.
+    pub fn with_cancellation(mut self, cancelled: Arc<AtomicBool>) -> Self {
+        self.cancelled = Some(cancelled);
+        self
+    }
+
+    /// Returns true if the flag given to `with_cancellation` is set.
+    fn is_cancelled(&self) -> bool {
+        is_set(self.cancelled.as_deref())
+    }
+
+    /// Makes the analyzer use the languages in `languages` for matching files
+    /// instead of detecting them.
+    pub fn with_language_map(mut self, languages: LanguageMap) -> Self {
+        self.languages = Arc::new(languages);
+        self
+    }
+
+    /// Makes the analyzer use the extractors in `extractors` for their
+    /// languages instead of the built-in analysis.
+    pub fn with_extractors(mut self, extractors: ExtractorRegistry) -> Self {
+        self.extractors = Arc::new(extractors);
+        self
+    }
+
+    /// Restricts analysis to files in `languages`; an empty list enables all
+    /// supported languages.
+    pub fn with_enabled_languages(mut self, languages: &[SupportedLanguage]) -> Self {
+        self.enabled = languages.into();
+        self
+    }
+
+    /// Detects the language of a file, honoring the language map and the
+    /// enabled languages.
+    pub(crate) fn detect_language(&self, path: &Path) -> Option<SupportedLanguage> {
+        let path_str = path.to_string_lossy();
+        self.languages
+            .language_for(&path_str)
+            .or_else(|| self.nginx_language(&path_str))
+            .or_else(|| SupportedLanguage::from_file_path(&path_str))
+            .filter(|language| self.is_enabled(*language))
+    }
+
+    /// Determines the language of a file from its name alone, honoring the
+    /// language map and the enabled languages, for files that are not on disk.
+    pub(crate) fn language_from_name(&self, path: &str) -> Option<SupportedLanguage> {
+        self.languages
+            .language_for(path)
+            .or_else(|| self.nginx_language(path))
+            .or_else(|| SupportedLanguage::from_file_extension(path))
+            .filter(|language| self.is_enabled(*language))
+    }
+
+    /// Returns Lua for nginx configurations when their Lua is analyzed.
+    fn nginx_language(&self, path: &str) -> Option<SupportedLanguage> {
+        (self.embedded_lua && is_nginx_config(path)).then_some(SupportedLanguage::Lua)
+    }
+
+    /// Returns true if files in `language` are analyzed.
+    fn is_enabled(&self, language: SupportedLanguage) -> bool {
+        self.enabled.is_empty() || self.enabled.contains(&language)
+    }
+
+    /// Creates an analyzer with the same configuration but its own parsers,
+    /// for use on another thread.
+    pub(crate) fn fork(&self) -> Self {
+        Self {
+            parsers: HashMap::new(),
+            cache: self.cache.clone(),
+            queries: self.queries.clone(),
+            plugins: self.plugins.clone(),
+            languages: Arc::clone(&self.languages),
+            enabled: Arc::clone(&self.enabled),
+            extractors: Arc::clone(&self.extractors),
+            todo_markers: Arc::clone(&self.todo_markers),
+            max_parse_size: self.max_parse_size,
+            parse_timeout: self.parse_timeout,
+            cancelled: self.cancelled.clone(),
+            tab_widths: Arc::clone(&self.tab_widths),
+            embedded_lua: self.embedded_lua,
+            template_code: self.template_code,
+            profiler: self.profiler.clone(),
+            timing: Timing::default(),
+        }
+    }
+
+    /// Analyzes a file or every supported file below a directory.
+    ///
+    /// This is the entry point for embedding the analyzer: a single file is
+    /// reported as a directory with one file, so callers handle both the same way.
+    ///
+    /// # Arguments
+    ///
+    /// * `path` - File or directory to analyze
+    /// * `options` - Traversal, exclusion, and parallelism settings for directories
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(DirectoryStats)` - Per-file results and aggregated totals
+    /// * `Err` if the path does not exist, or as for `analyze_file` and `analyze_directory`
+    pub fn analyze_path(
+        &mut self,
+        path: &Path,
+        options: &DirectoryOptions,
+    ) -> Result<DirectoryStats> {
+        if path.is_file() {
+            let mut stats = DirectoryStats::new();
+            stats.add_file(self.analyze_file(path)?);
+            Ok(stats)
+        } else if path.is_dir() {
+            self.analyze_directory(path, options)
+        } else {
+            Err(CodeStatsError::IoError(format!(
+                "{} is neither a file nor a directory",
+                path.display()
+            )))
         }
     }
 
@@ -36,7 +373,7 @@ impl CodeAnalyzer {
     ///
     /// * `Ok(FileStats)` - Statistics for the analyzed file
     /// * `Err` if the path is not a file, the file type is unsupported, or parsing fails
-    pub(crate) fn analyze_file(&mut self, path: &Path) -> Result<FileStats> {
+    pub fn analyze_file(&mut self, path: &Path) -> Result<FileStats> {
         if !path.is_file() {
             return Err(CodeStatsError::IoError(format!(
                 "{} is not a file",
@@ -44,31 +381,28 @@ impl CodeAnalyzer {
             )));
         }
 
-        let path_str = path.to_string_lossy();
-        let language = SupportedLanguage::from_file_path(&path_str)
-            .ok_or_else(|| CodeStatsError::UnsupportedFileType(path_str.to_string()))?;
-
-        let source_code = fs::read_to_string(path)
-            .map_err(|e| CodeStatsError::IoError(format!("Failed to read {path_str}: {e}")))?;
-
-        let parser = self.get_or_create_parser(&language)?;
-        let code_stats = analyze_code(parser, &source_code, &path_str, &language)?;
+        let language = self.detect_language(path).ok_or_else(|| {
+            CodeStatsError::UnsupportedFileType(path.to_string_lossy().to_string())
+        })?;
 
-        Ok(FileStats {
-            path: path.to_path_buf(),
-            language,
-            stats: code_stats,
-        })
+        self.analyze_source(path, language)
     }
 
     /// Recursively analyzes all supported files in a directory.
     ///
+    /// `.git` directories are always skipped. When `respect_gitignore` is set,
+    /// files excluded by `.gitignore` (including those in parent directories,
+    /// even outside a git repository), `.ignore`, `.git/info/exclude`, and the
+    /// global git excludes file are skipped as well.
+    ///
+    /// Files are parsed by `options.jobs` worker threads, each with its own
+    /// parser cache. Results are merged in path order, so the output does not
+    /// depend on the number of workers or on scheduling.
+    ///
     /// # Arguments
     ///
     /// * `path` - Root directory to analyze
-    /// * `max_depth` - Maximum depth for directory traversal
-    /// * `follow_links` - Whether to follow symbolic links
-    /// * `ignore_patterns` - Patterns to exclude files (substring matching)
+    /// * `options` - Traversal, exclusion, and parallelism settings
     ///
     /// # Returns
     ///
@@ -79,124 +413,1226 @@ impl CodeAnalyzer {
     ///
     /// Individual file errors are collected but don't fail the entire operation.
     /// The analysis only fails if no files could be successfully processed.
-    pub(crate) fn analyze_directory(
+    /// Files whose parse timed out are listed in `DirectoryStats::timed_out`;
+    /// once the analysis is cancelled, the remaining files are counted in
+    /// `DirectoryStats::interrupted` and the files analyzed so far returned.
+    pub fn analyze_directory(
         &mut self,
         path: &Path,
-        max_depth: usize,
-        follow_links: bool,
-        ignore_patterns: &[String],
+        options: &DirectoryOptions,
     ) -> Result<DirectoryStats> {
         let mut stats = DirectoryStats::new();
         let mut errors = Vec::new();
 
-        let walker = WalkDir::new(path)
-            .max_depth(max_depth)
-            .follow_links(follow_links);
+        let candidates = collect_candidates(path, options, &mut errors);
+        let jobs = effective_jobs(options.jobs).min(candidates.len());
+
+        let results = if jobs <= 1 {
+            // Sequential analysis reuses this analyzer's parser cache
+            candidates
+                .iter()
+                .map(|candidate| self.analyze_candidate(candidate))
+                .collect()
+        } else {
+            let workers = (0..jobs).map(|_| self.fork()).collect();
+            analyze_in_parallel(&candidates, workers)
+        };
+
+        for (candidate, result) in candidates.iter().zip(results) {
+            match result {
+                Ok(Some(mut file_stats)) => {
+                    classify_file(&mut file_stats, path, options);
+                    stats.add_file(file_stats);
+                }
+                Ok(None) => {} // Unsupported file, skipped silently
+                Err(CodeStatsError::EncodingError(_)) => stats.undecodable.push(candidate.clone()),
+                Err(CodeStatsError::Timeout(_)) => stats.timed_out.push(candidate.clone()),
+                Err(CodeStatsError::Cancelled) => stats.interrupted += 1,
+                Err(e) => errors.push(e),
+            }
+        }
+
+        if !errors.is_empty() && stats.total_files() == 0 {
+            // If no files were successfully processed, return the first error
+            return Err(errors.into_iter().next().unwrap());
+        }
+
+        Ok(stats)
+    }
+
+    /// Analyzes a file discovered during directory traversal.
+    ///
+    /// Unlike `analyze_file`, unsupported files are not an error: they are
+    /// skipped by returning `Ok(None)`.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Some(FileStats))` - The file was analyzed
+    /// * `Ok(None)` - The file is not in a supported language
+    /// * `Err(Cancelled)` - The analysis was cancelled before the file
+    /// * `Err` - File reading or parsing failed
+    pub(crate) fn analyze_candidate(&mut self, path: &Path) -> Result<Option<FileStats>> {
+        if self.is_cancelled() {
+            return Err(CodeStatsError::Cancelled);
+        }
+        // Check if it's a supported language using AI-powered content detection
+        let language = match self.detect_language(path) {
+            Some(lang) => lang,
+            None => return Ok(None),
+        };
+
+        self.analyze_source(path, language).map(Some)
+    }
+
+    /// Reads and analyzes a file whose language is already known, recording
+    /// its timing when a profiler is attached.
+    fn analyze_source(&mut self, path: &Path, language: SupportedLanguage) -> Result<FileStats> {
+        let Some(profiler) = self.profiler.clone() else {
+            return self.read_and_analyze(path, language);
+        };
+        self.timing = Timing::default();
+        let started = Instant::now();
+        let result = self.read_and_analyze(path, language);
+        if result.is_ok() {
+            profiler.record(FileProfile {
+                path: path.to_path_buf(),
+                language,
+                bytes: fs::metadata(path).map_or(0, |metadata| metadata.len()),
+                timing: self.timing,
+                total: started.elapsed(),
+            });
+        }
+        result
+    }
+
+    /// Reads and analyzes a file for `analyze_source`.
+    ///
+    /// A file above the parse size limit is neither decoded nor parsed, see
+    /// `oversized_stats`.
+    fn read_and_analyze(&mut self, path: &Path, language: SupportedLanguage) -> Result<FileStats> {
+        if self.is_oversized(path)
+            && let Some(file_stats) = self.oversized_stats(path, language, &read_bytes(path)?)
+        {
+            return Ok(file_stats);
+        }
+
+        let (source_code, encoding) = read_source(path)?;
+        let mut file_stats = self.analyze_text(path, language, &source_code)?;
+        // Set after the cache lookup, which only sees the decoded text
+        file_stats.stats.encoding = encoding;
+        if is_generated(path, &source_code) {
+            file_stats.stats.origin = Some(CodeOrigin::Generated);
+        }
+        let name = path.file_name().map_or(path, Path::new);
+        file_stats.stats.test_file = is_test_file(name, language);
+        Ok(file_stats)
+    }
+
+    /// Returns true if the file at `path` is larger than the parse size limit.
+    fn is_oversized(&self, path: &Path) -> bool {
+        fs::metadata(path).is_ok_and(|metadata| metadata.len() > self.max_parse_size)
+    }
+
+    /// Returns true if a source of `len` bytes is larger than the parse size
+    /// limit.
+    pub(crate) fn exceeds_parse_size(&self, len: u64) -> bool {
+        len > self.max_parse_size
+    }
+
+    /// Counts only the lines of a source above the parse size limit.
+    ///
+    /// Files on disk, git blobs, archive entries, and stdin all go through
+    /// this check, so no input above the limit reaches the parser. The lines
+    /// are counted from the raw bytes, see `count_raw_lines`, and only the
+    /// first bytes are decoded to look for generated-code markers.
+    ///
+    /// # Returns
+    ///
+    /// Statistics flagged with `CodeStats::oversized`, or `None` if `bytes`
+    /// is within the limit
+    pub(crate) fn oversized_stats(
+        &self,
+        path: &Path,
+        language: SupportedLanguage,
+        bytes: &[u8],
+    ) -> Option<FileStats> {
+        if !self.exceeds_parse_size(bytes.len() as u64) {
+            return None;
+        }
+        Some(oversized_file(
+            path,
+            language,
+            &bytes[..bytes.len().min(MARKER_BYTES)],
+            count_raw_lines(bytes),
+        ))
+    }
+
+    /// Reads a source that is not on disk, such as an archive entry, holding
+    /// no more than the parse size limit in memory.
+    ///
+    /// A source above the limit is read through only to count its lines, so
+    /// that a huge entry, or one that decompresses to far more than its
+    /// archive, can't exhaust memory. Its declared size, if above the limit,
+    /// skips buffering altogether.
+    ///
+    /// # Arguments
+    ///
+    /// * `path` - Path the source is reported under
+    /// * `language` - The programming language of the source
+    /// * `size` - Size the source declares, such as an archive entry's
+    ///   header; the content decides if it is wrong
+    /// * `reader` - The source
+    ///
+    /// # Returns
+    ///
+    /// The content, or the statistics of an oversized source, or an error if
+    /// reading fails.
+    pub(crate) fn read_limited(
+        &self,
+        path: &Path,
+        language: SupportedLanguage,
+        size: u64,
+        reader: &mut dyn Read,
+    ) -> std::io::Result<LimitedSource> {
+        let mut content = Vec::new();
+        if !self.exceeds_parse_size(size) {
+            reader
+                .take(self.max_parse_size.saturating_add(1))
+                .read_to_end(&mut content)?;
+            if !self.exceeds_parse_size(content.len() as u64) {
+                return Ok(LimitedSource::Content(content));
+            }
+        }
+
+        // Only the first bytes are kept, for the generated-code markers
+        let mut lines = RawLines::default();
+        lines.feed(&content);
+        content.truncate(MARKER_BYTES);
+        let mut chunk = vec![0; 64 * 1024];
+        loop {
+            let read = match reader.read(&mut chunk) {
+                Ok(0) => break,
+                Ok(read) => read,
+                Err(e) if e.kind() == std::io::ErrorKind::Interrupted => continue,
+                Err(e) => return Err(e),
+            };
+            lines.feed(&chunk[..read]);
+            let missing = MARKER_BYTES.saturating_sub(content.len());
+            content.extend_from_slice(&chunk[..read.min(missing)]);
+        }
+        Ok(LimitedSource::Oversized(Box::new(oversized_file(
+            path,
+            language,
+            &content,
+            lines.finish(),
+        ))))
+    }
+
+    /// Reads each supported file at or below `path` and hands it to `visit`,
+    /// for modes that work on syntax trees rather than on statistics.
+    ///
+    /// A single file must be in a supported language. In a directory, files
+    /// that can't be read or that `visit` fails on are skipped, like in
+    /// `analyze_directory`; the first error is only returned if no file could
+    /// be processed. Files above the parse size limit are skipped, and are an
+    /// error when given on their own. Files are visited sequentially, in path
+    /// order.
+    ///
+    /// # Arguments
+    ///
+    /// * `path` - File or directory to visit
+    /// * `options` - Traversal and exclusion settings for directories
+    /// * `visit` - Called with the analyzer, path, language, and content of each file
+    pub(crate) fn visit_sources<F>(
+        &mut self,
+        path: &Path,
+        options: &DirectoryOptions,
+        mut visit: F,
+    ) -> Result<()>
+    where
+        F: FnMut(&mut Self, &Path, SupportedLanguage, &str) -> Result<()>,
+    {
+        if path.is_file() {
+            let language = self.detect_language(path).ok_or_else(|| {
+                CodeStatsError::UnsupportedFileType(path.to_string_lossy().to_string())
+            })?;
+            if self.is_oversized(path) {
+                return Err(CodeStatsError::IoError(format!(
+                    "{} is larger than the parse size limit of {}",
+                    path.display(),
+                    format_size(self.max_parse_size)
+                )));
+            }
+            let (source_code, _) = read_source(path)?;
+            return visit(self, path, language, &source_code);
+        }
+        if !path.is_dir() {
+            return Err(CodeStatsError::IoError(format!(
+                "{} is neither a file nor a directory",
+                path.display()
+            )));
+        }
+
+        let mut errors = Vec::new();
+        let mut visited = 0;
+        for candidate in collect_candidates(path, options, &mut errors) {
+            if self.is_cancelled() {
+                return Err(CodeStatsError::Cancelled);
+            }
+            let Some(language) = self.detect_language(&candidate) else {
+                continue;
+            };
+            if self.is_oversized(&candidate) {
+                continue;
+            }
+            match read_source(&candidate)
+                .and_then(|(source_code, _)| visit(self, &candidate, language, &source_code))
+            {
+                Ok(()) => visited += 1,
+                Err(e) => errors.push(e),
+            }
+        }
+
+        match errors.into_iter().next() {
+            Some(error) if visited == 0 => Err(error),
+            _ => Ok(()),
+        }
+    }
+
+    /// Analyzes source code that is not necessarily on disk, such as the
+    /// content of a file at a git revision.
+    ///
+    /// `path` selects the grammar dialect and is recorded in the result.
+    /// Source above the parse size limit only has its lines counted, like a
+    /// file on disk, see `oversized_stats`. When a cache is attached, the content hash is looked up first and the
+    /// source is only parsed on a miss; fresh results are recorded in the cache.
+    /// Custom queries for the file's language run on the parsed tree. The
+    /// fenced code blocks of Markdown documents are analyzed as well, see
+    /// `analyze_code_blocks`, as are the inline scripts and styles of HTML
+    /// documents, the code cells of Jupyter notebooks, and, with
+    /// `with_embedded_lua`, the Lua blocks of configuration files, and, with
+    /// `with_template_code`, the Ruby of ERB templates. The script
+    /// and style sections of Vue and Svelte components are analyzed as part
+    /// of the component, see `component::add_sections`.
+    pub fn analyze_text(
+        &mut self,
+        path: &Path,
+        language: SupportedLanguage,
+        source_code: &str,
+    ) -> Result<FileStats> {
+        if let Some(file_stats) = self.oversized_stats(path, language, source_code.as_bytes()) {
+            return Ok(file_stats);
+        }
+        let path_str = path.to_string_lossy();
+        let dialect = Dialect::from_file_path(language, &path_str);
+        let query_set = self.queries.clone();
+        let queries = query_set
+            .as_deref()
+            .map_or(&[][..], |set| set.for_language(language, dialect));
+        let cache_key = self.cache.as_ref().map(|_| {
+            let mut fingerprint = query_set
+                .as_deref()
+                .map_or("", QuerySet::fingerprint)
+                .to_string();
+            if let Some(registered) = self.extractors.get(language) {
+                fingerprint = format!("{fingerprint}/{}", registered.extractor.name());
+            }
+            if let Some(plugins) = self
+                .plugins
+                .as_deref()
+                .filter(|set| set.applies_to(language))
+            {
+                fingerprint = format!("{fingerprint}/plugins:{}", plugins.fingerprint());
+            }
+            if *self.todo_markers != DEFAULT_MARKERS {
+                fingerprint = format!("{fingerprint}/todo:{}", self.todo_markers.join(","));
+            }
+            let tab_width = self.tab_width(path);
+            if tab_width != DEFAULT_TAB_WIDTH {
+                fingerprint = format!("{fingerprint}/tab:{tab_width}");
+            }
+            if self.embedded_lua && (language.is_configuration() || is_nginx_config(&path_str)) {
+                fingerprint = format!("{fingerprint}/lua");
+            }
+            if self.template_code && language == SupportedLanguage::Erb {
+                fingerprint = format!("{fingerprint}/ruby");
+            }
+            AnalysisCache::key(language, dialect, &fingerprint, source_code)
+        });
+
+        let cached = match (&self.cache, &cache_key) {
+            (Some(cache), Some(key)) => cache.get(key),
+            _ => None,
+        };
+
+        let code_stats = match cached {
+            Some(code_stats) => {
+                self.timing.cached = true;
+                code_stats
+            }
+            None => {
+                let nginx = self.embedded_lua && is_nginx_config(&path_str);
+                let mut code_stats = if nginx {
+                    // The directives around the Lua are not measured
+                    CodeStats::default()
+                } else {
+                    self.extract(&path_str, language, dialect, source_code, queries)?
+                };
+                if language == SupportedLanguage::Markdown {
+                    code_stats.embedded = self.analyze_code_blocks(path, source_code)?;
+                } else if language == SupportedLanguage::Html {
+                    code_stats.embedded = self.analyze_inline_code(path, language, source_code)?;
+                } else if language.is_component() {
+                    let sections = self.analyze_inline_code(path, language, source_code)?;
+                    add_sections(&mut code_stats, sections);
+                } else if language == SupportedLanguage::Jupyter {
+                    code_stats.embedded = self.analyze_code_cells(path, source_code)?;
+                } else if self.embedded_lua && (nginx || language.is_configuration()) {
+                    let blocks = lua_blocks(&path_str, language, source_code);
+                    code_stats.embedded = self.analyze_blocks(path, &blocks)?;
+                } else if self.template_code && language == SupportedLanguage::Erb {
+                    let ruby = ruby_code(source_code);
+                    let block = CodeBlock {
+                        language: SupportedLanguage::Ruby,
+                        code: &ruby,
+                        first_line: 0,
+                    };
+                    code_stats.embedded = self.analyze_blocks(path, &[block])?;
+                }
+                if let (Some(cache), Some(key)) = (&self.cache, cache_key) {
+                    cache.insert(key, code_stats.clone());
+                }
+                code_stats
+            }
+        };
+
+        Ok(FileStats {
+            path: path.to_path_buf(),
+            language,
+            stats: code_stats,
+        })
+    }
+
+    /// Analyzes the fenced code blocks of a Markdown document in the
+    /// languages named by their fences, see `analyze_blocks`.
+    ///
+    /// # Arguments
+    ///
+    /// * `path` - Path of the document, used for error reporting
+    /// * `source_code` - The Markdown document
+    ///
+    /// # Returns
+    ///
+    /// The combined statistics by language, or an error if parsing fails.
+    fn analyze_code_blocks(
+        &mut self,
+        path: &Path,
+        source_code: &str,
+    ) -> Result<BTreeMap<SupportedLanguage, EmbeddedCode>> {
+        // Parsed a second time, as the statistics don't keep the tree; the
+        // block grammar is cheap compared to the code in the blocks
+        let tree = self.parse(path, SupportedLanguage::Markdown, source_code)?;
+        self.analyze_blocks(path, &code_blocks(&tree.root_node(), source_code))
+    }
+
+    /// Analyzes the inline `<script>` and `<style>` elements of an HTML
+    /// document or component in their languages, see `analyze_blocks`.
+    ///
+    /// # Arguments
+    ///
+    /// * `path` - Path of the document, used for error reporting
+    /// * `language` - HTML, Vue, or Svelte
+    /// * `source_code` - The document
+    ///
+    /// # Returns
+    ///
+    /// The combined statistics by language, or an error if parsing fails.
+    fn analyze_inline_code(
+        &mut self,
+        path: &Path,
+        language: SupportedLanguage,
+        source_code: &str,
+    ) -> Result<BTreeMap<SupportedLanguage, EmbeddedCode>> {
+        let tree = self.parse(path, language, source_code)?;
+        self.analyze_blocks(path, &inline_blocks(&tree.root_node(), source_code))
+    }
+
+    /// Analyzes the code cells of a Jupyter notebook in the language of its
+    /// kernel, see `analyze_blocks`.
+    ///
+    /// # Arguments
+    ///
+    /// * `path` - Path of the notebook, used for error reporting
+    /// * `source_code` - The notebook file
+    ///
+    /// # Returns
+    ///
+    /// The combined statistics by language, or an error if parsing fails.
+    fn analyze_code_cells(
+        &mut self,
+        path: &Path,
+        source_code: &str,
+    ) -> Result<BTreeMap<SupportedLanguage, EmbeddedCode>> {
+        let tree = self.parse(path, SupportedLanguage::Jupyter, source_code)?;
+        let cells = code_cells(&tree.root_node(), source_code.as_bytes());
+        let blocks: Vec<CodeBlock> = cells.iter().map(|cell| cell.as_block()).collect();
+        self.analyze_blocks(path, &blocks)
+    }
+
+    /// Analyzes blocks of code embedded in a file.
+    ///
+    /// Each block is parsed on its own, with the custom queries of its
+    /// language, and the results are combined per language with line numbers
+    /// relative to the file.
+    ///
+    /// # Arguments
+    ///
+    /// * `path` - Path of the file, used for error reporting
+    /// * `blocks` - The blocks, in source order
+    ///
+    /// # Returns
+    ///
+    /// The combined statistics by language, or an error if parsing fails.
+    fn analyze_blocks(
+        &mut self,
+        path: &Path,
+        blocks: &[CodeBlock],
+    ) -> Result<BTreeMap<SupportedLanguage, EmbeddedCode>> {
+        let path_str = path.to_string_lossy();
+        let query_set = self.queries.clone();
+
+        let mut embedded: BTreeMap<SupportedLanguage, EmbeddedCode> = BTreeMap::new();
+        for block in blocks {
+            let queries = query_set.as_deref().map_or(&[][..], |set| {
+                set.for_language(block.language, Dialect::Standard)
+            });
+            let stats = self.extract(
+                &path_str,
+                block.language,
+                Dialect::Standard,
+                block.code,
+                queries,
+            )?;
+            embedded
+                .entry(block.language)
+                .or_default()
+                .add_block(stats, block.first_line);
+        }
+        Ok(embedded)
+    }
+
+    /// Parses source code and computes its statistics with the extractor
+    /// registered for `language`, then counts the custom queries and the
+    /// extractor's own queries and runs the plugins, which get the parse
+    /// timeout to answer each request. Parse issue columns are converted to
+    /// display columns.
+    ///
+    /// # Arguments
+    ///
+    /// * `path` - Path of the source, used for error reporting
+    /// * `language` - The programming language of the source code
+    /// * `dialect` - The grammar dialect to parse with
+    /// * `source_code` - The source code to analyze
+    /// * `queries` - Custom queries compiled for the language and dialect
+    ///
+    /// # Returns
+    ///
+    /// The statistics, or an error if parsing fails.
+    fn extract(
+        &mut self,
+        path: &str,
+        language: SupportedLanguage,
+        dialect: Dialect,
+        source_code: &str,
+        queries: &[NamedQuery],
+    ) -> Result<CodeStats> {
+        let started = Instant::now();
+        let tree = self.parse_tree(path, language, dialect, source_code)?;
+        self.timing.parse += started.elapsed();
+        let root_node = tree.root_node();
+
+        let (mut stats, extractor_queries) = match self.extractors.get(language) {
+            Some(registered) => (
+                registered.extractor.extract(&tree, source_code),
+                registered.queries(dialect),
+            ),
+            None => (
+                BuiltinExtractor::new(language).extract(&tree, source_code),
+                &[][..],
+            ),
+        };
+        let started = Instant::now();
+        count_queries(&mut stats, extractor_queries, &root_node, source_code);
+        count_queries(&mut stats, queries, &root_node, source_code);
+        if let Some(plugins) = &self.plugins {
+            (stats.plugins, stats.plugin_errors) = plugins.measure(
+                path,
+                language,
+                &root_node,
+                source_code,
+                self.parse_timeout,
+                self.cancelled.as_deref(),
+            );
+            if self.is_cancelled() {
+                return Err(CodeStatsError::Cancelled);
+            }
+        }
+        self.timing.queries += started.elapsed();
+        stats.todos = todo_comments(&root_node, source_code, &self.todo_markers);
+        stats.tokens = TokenStats::new(&root_node, source_code);
+        let tab_width = self.tab_width(Path::new(path));
+        for issue in &mut stats.parse_issues {
+            issue.column = line_column(source_code, issue.line, issue.column, tab_width);
+        }
+        Ok(stats)
+    }
+
+    /// Parses source code into a syntax tree with the analyzer's parsers.
+    ///
+    /// # Arguments
+    ///
+    /// * `path` - Path of the source, used to select the grammar dialect
+    /// * `language` - The programming language of the source code
+    /// * `source_code` - The source code to parse
+    ///
+    /// # Returns
+    ///
+    /// The syntax tree, or an error if parsing fails.
+    pub(crate) fn parse(
+        &mut self,
+        path: &Path,
+        language: SupportedLanguage,
+        source_code: &str,
+    ) -> Result<Tree> {
+        let path_str = path.to_string_lossy();
+        let dialect = Dialect::from_file_path(language, &path_str);
+        self.parse_tree(&path_str, language, dialect, source_code)
+    }
+
+    /// Parses source code with the parser of a language and dialect, giving
+    /// up when the parse timeout passes or the analysis is cancelled.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Tree)` - The syntax tree
+    /// * `Err(Timeout)` - Parsing took longer than the parse timeout
+    /// * `Err(Cancelled)` - The analysis was cancelled during the parse
+    /// * `Err(ParseError)` - The parser produced no tree
+    fn parse_tree(
+        &mut self,
+        path: &str,
+        language: SupportedLanguage,
+        dialect: Dialect,
+        source_code: &str,
+    ) -> Result<Tree> {
+        let deadline = self.parse_timeout.map(|timeout| Instant::now() + timeout);
+        let cancelled = self.cancelled.clone();
+        let mut timed_out = false;
+        let mut progress = |_: &ParseState| {
+            if is_set(cancelled.as_deref()) {
+                ControlFlow::Break(())
+            } else if deadline.is_some_and(|deadline| Instant::now() >= deadline) {
+                timed_out = true;
+                ControlFlow::Break(())
+            } else {
+                ControlFlow::Continue(())
+            }
+        };
+        let parser = self.get_or_create_parser(&language, dialect)?;
+        let bytes = source_code.as_bytes();
+        let tree = parser.parse_with_options(
+            &mut |offset, _| bytes.get(offset..).unwrap_or_default(),
+            None,
+            Some(ParseOptions::new().progress_callback(&mut progress)),
+        );
+        if let Some(tree) = tree {
+            return Ok(tree);
+        }
+        // An abandoned parse would otherwise be resumed by the next one
+        parser.reset();
+        if timed_out {
+            Err(CodeStatsError::Timeout(path.to_string()))
+        } else if self.is_cancelled() {
+            Err(CodeStatsError::Cancelled)
+        } else {
+            Err(CodeStatsError::ParseError(path.to_string()))
+        }
+    }
+
+    /// Lists the named declarations in source code, for tag generation and
+    /// outlines.
+    ///
+    /// Symbols are not cached: the cache stores statistics, and tags files
+    /// and outlines need names and positions that statistics don't keep.
+    ///
+    /// # Arguments
+    ///
+    /// * `path` - Path of the source, used to select the grammar dialect
+    /// * `language` - The programming language of the source code
+    /// * `source_code` - The source code to parse
+    ///
+    /// # Returns
+    ///
+    /// The declarations in source order, or an error if parsing fails.
+    pub(crate) fn symbols(
+        &mut self,
+        path: &Path,
+        language: SupportedLanguage,
+        source_code: &str,
+    ) -> Result<Vec<Symbol>> {
+        let path_str = path.to_string_lossy();
+        let dialect = Dialect::from_file_path(language, &path_str);
+        let tab_width = self.tab_width(path);
+        let parser = self.get_or_create_parser(&language, dialect)?;
+        extract_symbols(parser, source_code, &path_str, &language, tab_width)
+    }
+
+    /// Gets a parser for the specified language and dialect from cache or creates a new one.
+    ///
+    /// This method implements a simple caching strategy: if a parser for the
+    /// requested language/dialect pair already exists in the cache, it's returned.
+    /// Otherwise, a new parser is created, configured for the grammar, cached, and returned.
+    ///
+    /// # Arguments
+    ///
+    /// * `language` - The programming language requiring a parser
+    /// * `dialect` - The grammar dialect for the file being parsed
+    ///
+    /// # Returns
+    ///
+    /// A mutable reference to the cached parser for the language and dialect
+    fn get_or_create_parser(
+        &mut self,
+        language: &SupportedLanguage,
+        dialect: Dialect,
+    ) -> Result<&mut Parser> {
+        let parser = match self.parsers.entry((*language, dialect)) {
+            Entry::Occupied(entry) => entry.into_mut(),
+            Entry::Vacant(entry) => entry.insert(create_dialect_parser(language, dialect)?),
+        };
+        Ok(parser)
+    }
+}
+
+/// Reads a source file and transcodes it to UTF-8, reporting failures with
+/// the file's path.
+///
+/// # Returns
+///
+/// * `Ok((String, SourceEncoding))` - The text and the encoding it was in
+/// * `Err(IoError)` - The file can't be read
+/// * `Err(EncodingError)` - The content is not text in a supported encoding
+fn read_source(path: &Path) -> Result<(String, SourceEncoding)> {
+    let bytes = read_bytes(path)?;
+    decode(&bytes).map_err(|e| CodeStatsError::EncodingError(format!("{}: {e}", path.display())))
+}
+
+/// Content of a file, read into memory or, for large files, mapped.
+enum SourceBytes {
+    Read(Vec<u8>),
+    Mapped(Mmap),
+}
+
+impl Deref for SourceBytes {
+    type Target = [u8];
+
+    fn deref(&self) -> &[u8] {
+        match self {
+            SourceBytes::Read(bytes) => bytes,
+            SourceBytes::Mapped(map) => map,
+        }
+    }
+}
+
+/// Reads the content of a file. Files of `MMAP_THRESHOLD` bytes and more
+/// are memory-mapped, so that decoding them holds a single copy in memory.
+fn read_bytes(path: &Path) -> Result<SourceBytes> {
+    let failed = |e: std::io::Error| {
+        CodeStatsError::IoError(format!("Failed to read {}: {e}", path.display()))
+    };
+    let file = fs::File::open(path).map_err(failed)?;
+    let len = file.metadata().map_err(failed)?.len();
+    if len < MMAP_THRESHOLD {
+        let mut bytes = Vec::with_capacity(len as usize);
+        (&file).read_to_end(&mut bytes).map_err(failed)?;
+        return Ok(SourceBytes::Read(bytes));
+    }
+    // SAFETY: the map is only read while the file is analyzed. A file that
+    // is truncated meanwhile by another process is the same hazard as with
+    // every tool mapping its input, and is accepted for the memory saved.
+    let map = unsafe { Mmap::map(&file) }.map_err(failed)?;
+    Ok(SourceBytes::Mapped(map))
+}
+
+/// Counts the lines of a file that is too large to parse.
+///
+/// Without a syntax tree comments can't be told from code, so every line
+/// with anything but whitespace is counted as code.
+fn count_raw_lines(bytes: &[u8]) -> LineStats {
+    let mut lines = RawLines::default();
+    lines.feed(bytes);
+    lines.finish()
+}
+
+/// Line counts of `count_raw_lines` taken over a source read in chunks, so
+/// that a source too large to hold in memory can be counted as it streams.
+#[derive(Debug, Default)]
+struct RawLines {
+    lines: LineStats,
+    /// Whether the current line has anything but whitespace
+    has_code: bool,
+    /// Whether the current line has any byte yet
+    started: bool,
+}
+
+impl RawLines {
+    fn feed(&mut self, bytes: &[u8]) {
+        for &byte in bytes {
+            if byte == b'\n' {
+                if self.has_code {
+                    self.lines.code += 1;
+                } else {
+                    self.lines.blank += 1;
+                }
+                self.has_code = false;
+                self.started = false;
+            } else {
+                self.started = true;
+                self.has_code |= !byte.is_ascii_whitespace();
+            }
+        }
+    }
+
+    /// Returns the counts, with the last line if it has no final newline.
+    fn finish(mut self) -> LineStats {
+        if self.started {
+            self.feed(b"\n");
+        }
+        self.lines
+    }
+}
+
+/// Content of a source read by `CodeAnalyzer::read_limited`.
+#[derive(Debug)]
+pub(crate) enum LimitedSource {
+    /// The whole content, within the parse size limit
+    Content(Vec<u8>),
+    /// Statistics of a source above the limit, flagged with
+    /// `CodeStats::oversized`
+    Oversized(Box<FileStats>),
+}
+
+/// Builds the statistics of a source above the parse size limit from its
+/// first bytes and its raw line counts.
+fn oversized_file(
+    path: &Path,
+    language: SupportedLanguage,
+    head: &[u8],
+    lines: LineStats,
+) -> FileStats {
+    let stats = CodeStats {
+        lines,
+        origin: is_generated(path, &decode_lossy(head)).then_some(CodeOrigin::Generated),
+        test_file: is_test_file(path.file_name().map_or(path, Path::new), language),
+        oversized: true,
+        ..CodeStats::default()
+    };
+    FileStats {
+        path: path.to_path_buf(),
+        language,
+        stats,
+    }
+}
+
+/// Formats a byte size in whole MiB, or in bytes below 1 MiB.
+pub(crate) fn format_size(bytes: u64) -> String {
+    if bytes >= 1024 * 1024 && bytes.is_multiple_of(1024 * 1024) {
+        format!("{} MiB", bytes / (1024 * 1024))
+    } else {
+        format!("{bytes} bytes")
+    }
+}
+
+/// Classifies a file found below `root` by its path there: as a test if it
+/// is in a test directory, and as vendored if it is in a vendor directory.
+/// With `options.include_generated`, it is counted as hand-written code
+/// regardless of its origin.
+pub(crate) fn classify_file(file_stats: &mut FileStats, root: &Path, options: &DirectoryOptions) {
+    let relative = file_stats
+        .path
+        .strip_prefix(root)
+        .unwrap_or(&file_stats.path);
+    file_stats.stats.test_file = is_test_file(relative, file_stats.language);
+    if options.include_generated {
+        file_stats.stats.origin = None;
+    } else if is_vendored(relative) {
+        file_stats.stats.origin = Some(CodeOrigin::Vendored);
+    }
+}
+
+/// Analyzes a file or directory with a fresh analyzer.
+///
+/// Shorthand for `CodeAnalyzer::new().analyze_path(path, options)`; results
+/// are not cached and no custom queries are run.
+///
+/// # Arguments
+///
+/// * `path` - File or directory to analyze
+/// * `options` - Traversal, exclusion, and parallelism settings for directories
+///
+/// # Returns
+///
+/// Per-file results and aggregated totals, or the error that prevented analysis.
+pub fn analyze_path(path: &Path, options: &DirectoryOptions) -> Result<DirectoryStats> {
+    CodeAnalyzer::new().analyze_path(path, options)
+}
+
+/// Walks `root` and returns the sorted list of files that should be analyzed.
+///
+/// This implements the filtering logic for determining which files are candidates:
+/// 1. Skip `.git` and cache directories, and gitignored paths if enabled
+/// 2. Skip symbolic links if `skip_links` is set; links to directories are
+///    only descended into with `follow_links`, which stops at links back to
+///    a directory being walked
+/// 3. Skip non-file entries (directories, sockets, etc.)
+/// 4. Skip files rejected by the ignore patterns and include/exclude globs
+///    (see `PathFilter`)
+/// 5. Keep one path to each file reachable through several, see
+///    `dedup_linked_files`
+///
+/// Language detection happens later, during analysis. Walk errors are
+/// appended to `errors` without stopping the traversal; invalid globs are
+/// appended to `errors` and nothing is collected.
+pub(crate) fn collect_candidates(
+    root: &Path,
+    options: &DirectoryOptions,
+    errors: &mut Vec<CodeStatsError>,
+) -> Vec<PathBuf> {
+    let filter = match PathFilter::new(root, options) {
+        Ok(filter) => filter,
+        Err(e) => {
+            errors.push(e);
+            return Vec::new();
+        }
+    };
+    let skip_links = options.skip_links;
+    let walker = WalkBuilder::new(root)
+        .max_depth(Some(options.max_depth))
+        .follow_links(options.follow_links)
+        .standard_filters(options.respect_gitignore)
+        // Hidden files are analyzed like any other file; only `.git` is special
+        .hidden(false)
+        .require_git(false)
+        // Directory entries come in file system order otherwise, which makes
+        // the order of walk errors, and so the error reported, vary
+        .sort_by_file_name(|a, b| a.cmp(b))
+        .filter_entry(move |entry| {
+            entry.file_name() != ".git"
+                && entry.file_name() != CACHE_DIR
+                && !(skip_links && entry.depth() > 0 && entry.path_is_symlink())
+        })
+        .build();
 
-        for entry in walker {
-            match entry {
-                Ok(dir_entry) => {
-                    if let Err(e) = self.process_entry(&dir_entry, &mut stats, ignore_patterns) {
-                        errors.push(e);
-                    }
-                }
-                Err(e) => {
-                    errors.push(CodeStatsError::IoError(e.to_string()));
-                }
+    let mut candidates = Vec::new();
+    for entry in walker {
+        let path = match entry {
+            Ok(dir_entry) => dir_entry.into_path(),
+            Err(e) => {
+                errors.push(CodeStatsError::IoError(e.to_string()));
+                continue;
             }
+        };
+
+        // Skip if not a file
+        if !path.is_file() {
+            continue;
         }
 
-        if !errors.is_empty() && stats.total_files() == 0 {
-            // If no files were successfully processed, return the first error
-            return Err(errors.into_iter().next().unwrap());
+        if !filter.allows(&path) {
+            continue;
         }
 
-        Ok(stats)
+        candidates.push(path);
     }
 
-    /// Processes a single directory entry during directory traversal.
-    ///
-    /// This method implements the filtering logic for determining which files
-    /// should be analyzed:
-    /// 1. Skip non-file entries (directories, symlinks, etc.)
-    /// 2. Skip files matching any ignore pattern (substring matching)
-    /// 3. Skip files with unsupported extensions
-    /// 4. Analyze supported source files and add to statistics
-    ///
-    /// # Arguments
-    ///
-    /// * `entry` - Directory entry from walkdir traversal
-    /// * `stats` - Accumulator for directory statistics
-    /// * `ignore_patterns` - Patterns to exclude (matched as substrings)
+    // Sorting makes the merge order independent of the walk order
+    candidates.sort();
+    dedup_linked_files(root, &mut candidates);
+    candidates
+}
+
+/// Identity of a file independent of the path it is reached through.
+#[cfg(unix)]
+type FileId = (u64, u64);
+#[cfg(not(unix))]
+type FileId = PathBuf;
+
+/// Returns the device and inode of the file `path` leads to.
+#[cfg(unix)]
+fn file_id(path: &Path) -> Option<FileId> {
+    use std::os::unix::fs::MetadataExt;
+
+    fs::metadata(path)
+        .ok()
+        .map(|metadata| (metadata.dev(), metadata.ino()))
+}
+
+/// Returns the canonical path of the file `path` leads to.
+#[cfg(not(unix))]
+fn file_id(path: &Path) -> Option<FileId> {
+    path.canonicalize().ok()
+}
+
+/// Removes the candidates that lead to a file already listed, so that files
+/// are not counted twice when symbolic links or hard links make them
+/// reachable through several paths, as in workspaces that link shared
+/// packages into each project.
+///
+/// Of the paths to one file, the one not going through a symbolic link is
+/// kept, else the first in path order; `candidates` stays sorted. Copies of a
+/// file are separate files and are all kept.
+fn dedup_linked_files(root: &Path, candidates: &mut Vec<PathBuf>) {
+    let canonical_root = root.canonicalize().ok();
+    let through_link = |path: &Path| {
+        let lexical = canonical_root
+            .as_ref()
+            .zip(path.strip_prefix(root).ok())
+            .map(|(root, relative)| root.join(relative));
+        path.canonicalize().ok() != lexical
+    };
+
+    let mut by_file: HashMap<FileId, &PathBuf> = HashMap::new();
+    for path in candidates.iter() {
+        let Some(id) = file_id(path) else {
+            continue;
+        };
+        by_file
+            .entry(id)
+            .and_modify(|kept| {
+                if through_link(kept) && !through_link(path) {
+                    *kept = path;
+                }
+            })
+            .or_insert(path);
+    }
+    let kept: HashSet<PathBuf> = by_file.into_values().cloned().collect();
+    candidates.retain(|path| file_id(path).is_none() || kept.contains(path));
+}
+
+/// Decides which discovered files are analyzed, from the ignore patterns and
+/// the include/exclude globs of `DirectoryOptions`.
+pub(crate) struct PathFilter<'a> {
+    root: &'a Path,
+    /// Location of `root` relative to the glob root
+    prefix: PathBuf,
+    ignore_patterns: &'a [String],
+    include: Option<PatternSet>,
+    exclude: Option<PatternSet>,
+}
+
+impl<'a> PathFilter<'a> {
+    /// Compiles the filter for files found below `root`.
     ///
     /// # Returns
     ///
-    /// * `Ok(())` - File was processed or skipped successfully
-    /// * `Err` - File reading or parsing failed
-    fn process_entry(
-        &mut self,
-        entry: &DirEntry,
-        stats: &mut DirectoryStats,
-        ignore_patterns: &[String],
-    ) -> Result<()> {
-        let path = entry.path();
-
-        // Skip if not a file
-        if !path.is_file() {
-            return Ok(());
-        }
+    /// The filter, or `ConfigError` if a glob is invalid.
+    pub(crate) fn new(root: &'a Path, options: &'a DirectoryOptions) -> Result<Self> {
+        let prefix = options
+            .glob_root
+            .as_ref()
+            .and_then(|glob_root| {
+                let glob_root = glob_root.canonicalize().ok()?;
+                let root = root.canonicalize().ok()?;
+                root.strip_prefix(glob_root).ok().map(Path::to_path_buf)
+            })
+            .unwrap_or_default();
+        Ok(Self {
+            root,
+            prefix,
+            ignore_patterns: &options.ignore_patterns,
+            include: glob_set(&options.include)?,
+            exclude: glob_set(&options.exclude)?,
+        })
+    }
 
-        // Check if path matches any ignore pattern using substring matching
+    /// Returns true if `path`, as found below the root, should be analyzed.
+    ///
+    /// A path is rejected if it contains an ignore pattern as a substring, if
+    /// include patterns are set and they match neither it nor one of its
+    /// parent directories, or if the exclude patterns match it or one of its
+    /// parent directories (see `PatternSet::matches`).
+    pub(crate) fn allows(&self, path: &Path) -> bool {
         let path_str = path.to_string_lossy();
-        for pattern in ignore_patterns {
-            if path_str.contains(pattern) {
-                return Ok(());
-            }
+        if self
+            .ignore_patterns
+            .iter()
+            .any(|pattern| path_str.contains(pattern.as_str()))
+        {
+            return false;
         }
 
-        // Check if it's a supported language using AI-powered content detection
-        let language = match SupportedLanguage::from_file_path(&path_str) {
-            Some(lang) => lang,
-            None => return Ok(()), // Skip unsupported files silently
+        let relative = self
+            .prefix
+            .join(path.strip_prefix(self.root).unwrap_or(path));
+        let matches = |set: &PatternSet| set.matches(&relative);
+        self.include.as_ref().is_none_or(matches) && !self.exclude.as_ref().is_some_and(matches)
+    }
+}
+
+/// Compiled gitignore-style patterns, see `glob_set`.
+pub(crate) struct PatternSet {
+    globs: GlobSet,
+    /// Whether each pattern, by index, starts with `!`
+    negated: Vec<bool>,
+    /// Whether each pattern, by index, ends with `/` and so only matches
+    /// directories
+    directory_only: Vec<bool>,
+}
+
+impl PatternSet {
+    /// Returns true if the patterns match `relative`, a file path relative
+    /// to the glob root.
+    ///
+    /// As in `.gitignore`, the last pattern matching a path decides, so a
+    /// `!` pattern undoes earlier ones, and a matched directory matches
+    /// everything below it: its parent directories are checked first, from
+    /// the top, and a match there is final.
+    fn matches(&self, relative: &Path) -> bool {
+        let mut ancestors: Vec<&Path> = relative
+            .ancestors()
+            .filter(|ancestor| !ancestor.as_os_str().is_empty())
+            .collect();
+        ancestors.reverse();
+        let Some((file, directories)) = ancestors.split_last() else {
+            return false;
         };
+        directories
+            .iter()
+            .any(|directory| self.last_match(directory, true))
+            || self.last_match(file, false)
+    }
 
-        // Read and analyze the file
-        let source_code = fs::read_to_string(path)
-            .map_err(|e| CodeStatsError::IoError(format!("Failed to read {path_str}: {e}")))?;
+    /// Returns true if the last pattern matching `path` is not negated.
+    fn last_match(&self, path: &Path, is_directory: bool) -> bool {
+        self.globs
+            .matches(path)
+            .into_iter()
+            .rfind(|&index| is_directory || !self.directory_only[index])
+            .is_some_and(|index| !self.negated[index])
+    }
+}
 
-        let parser = self.get_or_create_parser(&language)?;
-        let code_stats = analyze_code(parser, &source_code, &path_str, &language)?;
+/// Compiles gitignore-style patterns into a set, or `None` if there are none.
+///
+/// `*` and `?` don't match `/`, while `**` matches any number of directories.
+/// A pattern without a `/` except at the end matches a file or directory name
+/// at any depth, and one with a leading `/` only at the glob root. A trailing
+/// `/` only matches directories, and a leading `!` re-includes what earlier
+/// patterns matched (see `PatternSet::matches`).
+///
+/// # Returns
+///
+/// The compiled set, or `ConfigError` naming the first invalid pattern.
+pub(crate) fn glob_set(patterns: &[String]) -> Result<Option<PatternSet>> {
+    if patterns.is_empty() {
+        return Ok(None);
+    }
 
-        let file_stats = FileStats {
-            path: path.to_path_buf(),
-            language,
-            stats: code_stats,
+    let mut builder = GlobSetBuilder::new();
+    let mut negated = Vec::new();
+    let mut directory_only = Vec::new();
+    for pattern in patterns {
+        let (is_negated, body) = match pattern.strip_prefix('!') {
+            Some(body) => (true, body),
+            None => (false, pattern.as_str()),
+        };
+        let trimmed = body.trim_end_matches('/').trim_start_matches("./");
+        let anchored = if let Some(anchored) = trimmed.strip_prefix('/') {
+            anchored.to_string()
+        } else if trimmed.contains('/') {
+            trimmed.to_string()
+        } else {
+            format!("**/{trimmed}")
         };
+        let glob = GlobBuilder::new(&anchored)
+            .literal_separator(true)
+            .build()
+            .map_err(|e| {
+                CodeStatsError::ConfigError(format!("invalid glob '{pattern}': {}", e.kind()))
+            })?;
+        builder.add(glob);
+        negated.push(is_negated);
+        directory_only.push(body.ends_with('/'));
+    }
+    let globs = builder
+        .build()
+        .map_err(|e| CodeStatsError::ConfigError(format!("invalid globs: {e}")))?;
+    Ok(Some(PatternSet {
+        globs,
+        negated,
+        directory_only,
+    }))
+}
 
-        stats.add_file(file_stats);
-        Ok(())
+/// Resolves the requested job count, where 0 means "one per available CPU".
+fn effective_jobs(requested: usize) -> usize {
+    if requested > 0 {
+        requested
+    } else {
+        thread::available_parallelism().map_or(1, |n| n.get())
     }
+}
 
-    /// Gets a parser for the specified language from cache or creates a new one.
-    ///
-    /// This method implements a simple caching strategy: if a parser for the
-    /// requested language already exists in the cache, it's returned. Otherwise,
-    /// a new parser is created, configured for the language, cached, and returned.
-    ///
-    /// # Arguments
-    ///
-    /// * `language` - The programming language requiring a parser
-    ///
-    /// # Returns
-    ///
-    /// A mutable reference to the cached parser for the language
-    fn get_or_create_parser(&mut self, language: &SupportedLanguage) -> Result<&mut Parser> {
-        if !self.parsers.contains_key(language) {
-            let parser = create_parser(language)?;
-            self.parsers.insert(*language, parser);
+/// Returns true if a cancellation flag is given and set.
+fn is_set(flag: Option<&AtomicBool>) -> bool {
+    flag.is_some_and(|flag| flag.load(Ordering::Relaxed))
+}
+
+/// Analyzes `paths` on one thread per analyzer in `workers`.
+///
+/// Workers pull the next unclaimed index from a shared counter, so large files
+/// don't hold up a fixed partition. Each worker owns a `CodeAnalyzer` because
+/// tree-sitter parsers are not shared between threads; the result cache and
+/// custom queries, if any, are shared. The returned results are in the same
+/// order as `paths`.
+fn analyze_in_parallel(
+    paths: &[PathBuf],
+    workers: Vec<CodeAnalyzer>,
+) -> Vec<Result<Option<FileStats>>> {
+    let next = AtomicUsize::new(0);
+    let mut results: Vec<Option<Result<Option<FileStats>>>> =
+        std::iter::repeat_with(|| None).take(paths.len()).collect();
+
+    thread::scope(|scope| {
+        let handles: Vec<_> = workers
+            .into_iter()
+            .map(|mut analyzer| {
+                let next = &next;
+                scope.spawn(move || {
+                    let mut completed = Vec::new();
+                    loop {
+                        let index = next.fetch_add(1, Ordering::Relaxed);
+                        let Some(path) = paths.get(index) else {
+                            break;
+                        };
+                        completed.push((index, analyzer.analyze_candidate(path)));
+                    }
+                    completed
+                })
+            })
+            .collect();
+
+        for handle in handles {
+            for (index, result) in handle.join().expect("analysis worker panicked") {
+                results[index] = Some(result);
+            }
         }
-        Ok(self.parsers.get_mut(language).unwrap())
-    }
+    });
+
+    results
+        .into_iter()
+        .map(|result| result.expect("every path is claimed by exactly one worker"))
+        .collect()
 }
 
 impl Default for CodeAnalyzer {
@@ -253,13 +1689,40 @@ mod tests {
 
         analyzer.analyze_file(&rs_file).unwrap();
         assert_eq!(analyzer.parsers.len(), 1);
-        assert!(analyzer.parsers.contains_key(&SupportedLanguage::Rust));
+        assert!(
+            analyzer
+                .parsers
+                .contains_key(&(SupportedLanguage::Rust, Dialect::Standard))
+        );
 
         // Second analysis succeeds and parser count remains the same
         analyzer.analyze_file(&rs_file).unwrap();
         assert_eq!(analyzer.parsers.len(), 1);
     }
 
+    #[test]
+    fn test_parser_cache_separates_typescript_dialects() {
+        let mut analyzer = CodeAnalyzer::new();
+        let temp_dir = TempDir::new().unwrap();
+
+        let ts_file = temp_dir.path().join("app.ts");
+        let tsx_file = temp_dir.path().join("App.tsx");
+        std::fs::write(&ts_file, "function app(): void {}").unwrap();
+        std::fs::write(&tsx_file, "const App = () => <div />;").unwrap();
+
+        analyzer.analyze_file(&ts_file).unwrap();
+        let tsx_stats = analyzer.analyze_file(&tsx_file).unwrap();
+
+        assert_eq!(tsx_stats.language, SupportedLanguage::TypeScript);
+        assert_eq!(tsx_stats.stats.function_count, 1);
+        assert_eq!(analyzer.parsers.len(), 2);
+        assert!(
+            analyzer
+                .parsers
+                .contains_key(&(SupportedLanguage::TypeScript, Dialect::Tsx))
+        );
+    }
+
     #[test]
     fn test_analyze_file_returns_io_error_for_nonexistent_file() {
         let mut analyzer = CodeAnalyzer::new();
@@ -279,15 +1742,336 @@ mod tests {
 
         // Create only unsupported files
         std::fs::write(temp_dir.path().join("file1.txt"), "text").unwrap();
-        std::fs::write(temp_dir.path().join("file2.md"), "markdown").unwrap();
+        std::fs::write(temp_dir.path().join("file2.csv"), "a,b").unwrap();
 
-        let result = analyzer.analyze_directory(temp_dir.path(), 100, false, &[]);
+        let result = analyzer.analyze_directory(temp_dir.path(), &DirectoryOptions::default());
         assert!(result.is_ok());
         let stats = result.unwrap();
         assert_eq!(stats.total_files(), 0);
         assert_eq!(stats.total_stats.function_count, 0);
     }
 
+    #[test]
+    fn test_path_filter_applies_include_and_exclude_globs() {
+        let options = DirectoryOptions {
+            include: vec!["src/**".to_string(), "build.rs".to_string()],
+            exclude: vec!["*_generated.rs".to_string(), "src/vendor".to_string()],
+            ..Default::default()
+        };
+        let root = Path::new("project");
+        let filter = PathFilter::new(root, &options).unwrap();
+        let allows = |path: &str| filter.allows(&root.join(path));
+
+        assert!(allows("src/main.rs"));
+        assert!(allows("src/deep/util.rs"));
+        // A pattern without `/` matches names at any depth
+        assert!(allows("build.rs"));
+        assert!(allows("tools/build.rs"));
+        assert!(!allows("tests/it.rs"));
+        assert!(!allows("src/ast_generated.rs"));
+        // Excluding a directory excludes everything below it
+        assert!(!allows("src/vendor/lib.rs"));
+        assert!(allows("src/vendored.rs"));
+    }
+
+    #[test]
+    fn test_path_filter_follows_gitignore_syntax() {
+        let options = DirectoryOptions {
+            exclude: vec![
+                "testdata/".to_string(),
+                "/fixtures".to_string(),
+                "*.pb.go".to_string(),
+                "!api/*.pb.go".to_string(),
+                "logs".to_string(),
+                "!logs/keep.rs".to_string(),
+            ],
+            ..Default::default()
+        };
+        let root = Path::new("project");
+        let filter = PathFilter::new(root, &options).unwrap();
+        let allows = |path: &str| filter.allows(&root.join(path));
+
+        // A trailing `/` matches directories only, at any depth
+        assert!(!allows("pkg/testdata/input.go"));
+        assert!(allows("pkg/testdata"));
+        // A leading `/` anchors the pattern at the root
+        assert!(!allows("fixtures/case.rs"));
+        assert!(allows("src/fixtures/case.rs"));
+        // The last matching pattern wins
+        assert!(!allows("internal/cart.pb.go"));
+        assert!(allows("api/cart.pb.go"));
+        // A file in an excluded directory can't be re-included
+        assert!(!allows("logs/keep.rs"));
+
+        let include = DirectoryOptions {
+            include: vec![
+                "src/".to_string(),
+                "*.go".to_string(),
+                "!*_test.go".to_string(),
+            ],
+            ..Default::default()
+        };
+        let filter = PathFilter::new(root, &include).unwrap();
+        assert!(filter.allows(&root.join("src/main.rs")));
+        assert!(filter.allows(&root.join("cmd/main.go")));
+        assert!(!filter.allows(&root.join("cmd/main_test.go")));
+        assert!(!filter.allows(&root.join("tools/gen.rs")));
+    }
+
+    #[test]
+    fn test_path_filter_globs_relative_to_glob_root() {
+        let temp_dir = TempDir::new().unwrap();
+        let src = temp_dir.path().join("src");
+        fs::create_dir_all(src.join("gen")).unwrap();
+        let options = DirectoryOptions {
+            exclude: vec!["src/gen/**".to_string()],
+            glob_root: Some(temp_dir.path().to_path_buf()),
+            ..Default::default()
+        };
+
+        // Analyzing `src` still honors globs written relative to the glob root
+        let filter = PathFilter::new(&src, &options).unwrap();
+        assert!(!filter.allows(&src.join("gen/parser.rs")));
+        assert!(filter.allows(&src.join("main.rs")));
+
+        let invalid = DirectoryOptions {
+            include: vec!["src/[".to_string()],
+            ..Default::default()
+        };
+        let mut errors = Vec::new();
+        assert!(collect_candidates(temp_dir.path(), &invalid, &mut errors).is_empty());
+        assert!(errors[0].to_string().contains("invalid glob 'src/['"));
+    }
+
+    #[test]
+    fn test_count_raw_lines() {
+        let lines = count_raw_lines(b"package main\n\n// comment\r\n  \t\nfunc f() {}");
+        assert_eq!((lines.code, lines.comment, lines.blank), (3, 0, 2));
+        assert_eq!(count_raw_lines(b"a\n\n").total(), 2);
+        assert_eq!(count_raw_lines(b"").total(), 0);
+
+        // Chunks split anywhere, even inside a line, count the same
+        let mut lines = RawLines::default();
+        for chunk in [
+            &b"package ma"[..],
+            b"in\n",
+            b"\n// comment\r",
+            b"\n  \t\nfunc f() {}",
+        ] {
+            lines.feed(chunk);
+        }
+        let lines = lines.finish();
+        assert_eq!((lines.code, lines.comment, lines.blank), (3, 0, 2));
+    }
+
+    #[test]
+    fn test_read_limited() {
+        let analyzer = CodeAnalyzer::new().with_max_parse_size(16);
+        let read = |size: u64, content: &[u8]| {
+            analyzer
+                .read_limited(
+                    Path::new("release.zip/gen/tables.go"),
+                    SupportedLanguage::Go,
+                    size,
+                    &mut &content[..],
+                )
+                .unwrap()
+        };
+        assert!(
+            matches!(read(4, b"a()\n"), LimitedSource::Content(content) if content == b"a()\n")
+        );
+
+        let generated = b"// Code generated by gen. DO NOT EDIT.\npackage tables\n\nvar T = 1\n";
+        for size in [0, generated.len() as u64] {
+            // Both a wrong declared size and the right one
+            let LimitedSource::Oversized(file_stats) = read(size, generated) else {
+                panic!("{size}: read in full");
+            };
+            assert!(file_stats.stats.oversized);
+            assert_eq!(
+                (file_stats.stats.lines.code, file_stats.stats.lines.blank),
+                (3, 1)
+            );
+            assert_eq!(file_stats.stats.origin, Some(CodeOrigin::Generated));
+            assert_eq!(file_stats.path, Path::new("release.zip/gen/tables.go"));
+        }
+    }
+
+    #[test]
+    fn test_files_above_parse_size_only_count_lines() {
+        let temp_dir = TempDir::new().unwrap();
+        let path = temp_dir.path().join("tables.go");
+        let source = "// Code generated by gen. DO NOT EDIT.\npackage tables\n\nfunc F() {}\n";
+        fs::write(&path, source).unwrap();
+
+        let mut analyzer = CodeAnalyzer::new().with_max_parse_size(16);
+        let file_stats = analyzer.analyze_file(&path).unwrap();
+        assert!(file_stats.stats.oversized);
+        assert_eq!(file_stats.stats.function_count, 0);
+        assert_eq!(
+            (file_stats.stats.lines.code, file_stats.stats.lines.blank),
+            (3, 1)
+        );
+        assert_eq!(file_stats.stats.origin, Some(CodeOrigin::Generated));
+
+        let mut visited = 0;
+        analyzer
+            .visit_sources(
+                temp_dir.path(),
+                &DirectoryOptions::default(),
+                |_, _, _, _| {
+                    visited += 1;
+                    Ok(())
+                },
+            )
+            .unwrap();
+        assert_eq!(visited, 0);
+        assert!(
+            analyzer
+                .visit_sources(&path, &DirectoryOptions::default(), |_, _, _, _| Ok(()))
+                .is_err()
+        );
+    }
+
+    #[test]
+    fn test_text_above_parse_size_only_counts_lines() {
+        let source = "package tables\n\nfunc F() {}\nfunc G() {}\n";
+        let mut analyzer = CodeAnalyzer::new().with_max_parse_size(16);
+        let file_stats = analyzer
+            .analyze_text(Path::new("<stdin>"), SupportedLanguage::Go, source)
+            .unwrap();
+        assert!(file_stats.stats.oversized);
+        assert_eq!(file_stats.stats.function_count, 0);
+        assert_eq!(
+            (file_stats.stats.lines.code, file_stats.stats.lines.blank),
+            (3, 1)
+        );
+
+        let mut analyzer = CodeAnalyzer::new().with_max_parse_size(source.len() as u64);
+        let file_stats = analyzer
+            .analyze_text(Path::new("<stdin>"), SupportedLanguage::Go, source)
+            .unwrap();
+        assert!(!file_stats.stats.oversized);
+    }
+
+    #[test]
+    fn test_large_files_are_mapped() {
+        let temp_dir = TempDir::new().unwrap();
+        let path = temp_dir.path().join("large.txt");
+        let content = "x\n".repeat(MMAP_THRESHOLD as usize);
+        fs::write(&path, &content).unwrap();
+        let small = temp_dir.path().join("small.txt");
+        fs::write(&small, "x\n").unwrap();
+
+        let bytes = read_bytes(&path).unwrap();
+        assert!(matches!(bytes, SourceBytes::Mapped(_)));
+        assert_eq!(&*bytes, content.as_bytes());
+        assert!(matches!(read_bytes(&small).unwrap(), SourceBytes::Read(_)));
+    }
+
+    #[test]
+    #[cfg(unix)]
+    fn test_linked_files_are_collected_once() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        let shared = root.join("shared");
+        fs::create_dir_all(&shared).unwrap();
+        fs::create_dir_all(root.join("app")).unwrap();
+        fs::write(shared.join("util.rs"), "fn util() {}\n").unwrap();
+        // A copy is a file of its own, unlike a hard link
+        fs::write(shared.join("copy.rs"), "fn util() {}\n").unwrap();
+        fs::write(shared.join("lib.rs"), "fn lib() {}\n").unwrap();
+        fs::hard_link(shared.join("lib.rs"), root.join("app/lib.rs")).unwrap();
+        std::os::unix::fs::symlink(&shared, root.join("app/shared")).unwrap();
+        std::os::unix::fs::symlink(shared.join("util.rs"), root.join("app/util.rs")).unwrap();
+        // A link back to an ancestor must not make the walk loop
+        std::os::unix::fs::symlink(root, shared.join("loop")).unwrap();
+
+        let collect = |options: &DirectoryOptions| {
+            let mut errors = Vec::new();
+            collect_candidates(root, options, &mut errors)
+                .into_iter()
+                .map(|path| path.strip_prefix(root).unwrap().to_path_buf())
+                .collect::<Vec<_>>()
+        };
+        // Paths without symbolic links win; of hard links, the first is kept
+        let expected = [
+            PathBuf::from("app/lib.rs"),
+            PathBuf::from("shared/copy.rs"),
+            PathBuf::from("shared/util.rs"),
+        ];
+        let follow = DirectoryOptions {
+            follow_links: true,
+            ..Default::default()
+        };
+        assert_eq!(collect(&follow), expected);
+        assert_eq!(collect(&DirectoryOptions::default()), expected);
+        let skip = DirectoryOptions {
+            skip_links: true,
+            ..Default::default()
+        };
+        assert_eq!(collect(&skip), expected);
+    }
+
+    #[test]
+    fn test_enabled_languages_filter_detection() {
+        let analyzer = CodeAnalyzer::new().with_enabled_languages(&[SupportedLanguage::Go]);
+        assert_eq!(
+            analyzer.language_from_name("main.go"),
+            Some(SupportedLanguage::Go)
+        );
+        assert_eq!(analyzer.language_from_name("lib.rs"), None);
+        assert_eq!(
+            CodeAnalyzer::new().language_from_name("lib.rs"),
+            Some(SupportedLanguage::Rust)
+        );
+    }
+
+    #[test]
+    fn test_registered_extractor_replaces_builtin_analysis() {
+        use crate::extractor::Extractor;
+
+        /// Counts every line as a function, whatever the language's syntax
+        struct LineCounter;
+
+        impl Extractor for LineCounter {
+            fn language(&self) -> &str {
+                "rust"
+            }
+
+            fn name(&self) -> &str {
+                "lines"
+            }
+
+            fn extract(&self, _tree: &Tree, source: &str) -> CodeStats {
+                CodeStats {
+                    function_count: source.lines().count(),
+                    ..CodeStats::default()
+                }
+            }
+        }
+
+        let mut extractors = ExtractorRegistry::new();
+        extractors.register(Arc::new(LineCounter)).unwrap();
+        let mut analyzer = CodeAnalyzer::new().with_extractors(extractors);
+
+        let rust = analyzer
+            .analyze_text(
+                Path::new("lib.rs"),
+                SupportedLanguage::Rust,
+                "struct A;\nstruct B;\nstruct C;\n",
+            )
+            .unwrap();
+        assert_eq!(rust.stats.function_count, 3);
+        assert_eq!(rust.stats.class_struct_count, 0);
+
+        // Other languages keep the built-in analysis
+        let json = analyzer
+            .analyze_text(Path::new("a.json"), SupportedLanguage::Json, "{}\n{}\n")
+            .unwrap();
+        assert_eq!(json.stats.function_count, 0);
+    }
+
     #[test]
     fn test_analyze_directory_excludes_files_matching_ignore_patterns() {
         let mut analyzer = CodeAnalyzer::new();
@@ -298,10 +2082,292 @@ mod tests {
         std::fs::write(temp_dir.path().join("test.rs"), "fn test() {}").unwrap();
 
         // Ignore files containing "test"
-        let result = analyzer.analyze_directory(temp_dir.path(), 100, false, &["test".to_string()]);
+        let options = DirectoryOptions {
+            ignore_patterns: vec!["test".to_string()],
+            ..Default::default()
+        };
+        let result = analyzer.analyze_directory(temp_dir.path(), &options);
         assert!(result.is_ok());
         let stats = result.unwrap();
         assert_eq!(stats.total_files(), 1);
         assert_eq!(stats.total_stats.function_count, 1);
     }
+
+    #[test]
+    fn test_analyze_directory_transcodes_and_reports_undecodable_files() {
+        let mut analyzer = CodeAnalyzer::new();
+        let temp_dir = TempDir::new().unwrap();
+
+        let mut utf16 = vec![0xFF, 0xFE];
+        utf16.extend(
+            "fn main() {}\r\nfn helper() {}\r\n"
+                .encode_utf16()
+                .flat_map(u16::to_le_bytes),
+        );
+        std::fs::write(temp_dir.path().join("legacy.rs"), utf16).unwrap();
+        std::fs::write(
+            temp_dir.path().join("broken.c"),
+            b"\xEF\xBB\xBFint main(void) { return \xFF; }\n",
+        )
+        .unwrap();
+
+        let stats = analyzer
+            .analyze_directory(temp_dir.path(), &DirectoryOptions::default())
+            .unwrap();
+        assert_eq!(stats.total_files(), 1);
+        assert_eq!(stats.files[0].stats.encoding, SourceEncoding::Utf16Le);
+        assert_eq!(stats.files[0].stats.function_count, 2);
+        assert_eq!(stats.files[0].stats.error_nodes, 0);
+        assert_eq!(stats.undecodable, vec![temp_dir.path().join("broken.c")]);
+
+        let result = analyzer.analyze_file(&temp_dir.path().join("broken.c"));
+        assert!(matches!(result, Err(CodeStatsError::EncodingError(_))));
+    }
+
+    #[test]
+    fn test_cancelled_analysis_returns_partial_statistics() {
+        let temp_dir = TempDir::new().unwrap();
+        for name in ["a.rs", "b.rs", "c.go"] {
+            fs::write(temp_dir.path().join(name), "// empty\n").unwrap();
+        }
+        let cancelled = Arc::new(AtomicBool::new(false));
+        let mut analyzer = CodeAnalyzer::new().with_cancellation(Arc::clone(&cancelled));
+        let options = DirectoryOptions {
+            jobs: 2,
+            ..DirectoryOptions::default()
+        };
+        assert_eq!(
+            analyzer
+                .analyze_directory(temp_dir.path(), &options)
+                .unwrap()
+                .interrupted,
+            0
+        );
+
+        cancelled.store(true, Ordering::Relaxed);
+        for jobs in [1, 2] {
+            let options = DirectoryOptions {
+                jobs,
+                ..DirectoryOptions::default()
+            };
+            let stats = analyzer
+                .analyze_directory(temp_dir.path(), &options)
+                .unwrap();
+            assert_eq!(stats.total_files(), 0);
+            assert_eq!(stats.interrupted, 3);
+        }
+        let result = analyzer.visit_sources(temp_dir.path(), &options, |_, _, _, _| Ok(()));
+        assert!(matches!(result, Err(CodeStatsError::Cancelled)));
+    }
+
+    #[test]
+    fn test_zero_parse_timeout_disables_the_limit() {
+        assert_eq!(
+            CodeAnalyzer::new().parse_timeout,
+            Some(DEFAULT_PARSE_TIMEOUT)
+        );
+        let analyzer = CodeAnalyzer::new().with_parse_timeout(Duration::from_millis(500));
+        assert_eq!(analyzer.parse_timeout, Some(Duration::from_millis(500)));
+        let analyzer = analyzer.with_parse_timeout(Duration::ZERO);
+        assert_eq!(analyzer.parse_timeout, None);
+        assert_eq!(analyzer.fork().parse_timeout, None);
+    }
+
+    #[test]
+    fn test_analyze_directory_classifies_generated_and_vendored_files() {
+        let mut analyzer = CodeAnalyzer::new();
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path().join("vendor").join("project");
+        std::fs::create_dir_all(root.join("vendor/lib")).unwrap();
+        std::fs::write(root.join("main.rs"), "fn main() {}\n").unwrap();
+        std::fs::write(
+            root.join("schema.rs"),
+            "// Code generated by schemagen. DO NOT EDIT.\nfn a() {}\nfn b() {}\n",
+        )
+        .unwrap();
+        std::fs::write(root.join("vendor/lib/lib.rs"), "fn c() {}\n").unwrap();
+
+        let stats = analyzer
+            .analyze_directory(&root, &DirectoryOptions::default())
+            .unwrap();
+        let origin = |name: &str| {
+            stats
+                .files
+                .iter()
+                .find(|file| file.path.ends_with(name))
+                .unwrap()
+                .stats
+                .origin
+        };
+        // The vendor directory above the analyzed root doesn't count
+        assert_eq!(origin("main.rs"), None);
+        assert_eq!(origin("schema.rs"), Some(CodeOrigin::Generated));
+        assert_eq!(origin("lib.rs"), Some(CodeOrigin::Vendored));
+        assert_eq!(stats.total_stats.function_count, 1);
+        assert_eq!(stats.generated.files, 2);
+
+        let options = DirectoryOptions {
+            include_generated: true,
+            ..Default::default()
+        };
+        let stats = analyzer.analyze_directory(&root, &options).unwrap();
+        assert_eq!(stats.total_stats.function_count, 4);
+        assert_eq!(stats.generated.files, 0);
+    }
+
+    #[test]
+    fn test_analyze_directory_marks_test_files() {
+        let mut analyzer = CodeAnalyzer::new();
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path().join("tests").join("project");
+        std::fs::create_dir_all(root.join("tests")).unwrap();
+        std::fs::write(root.join("cart.go"), "package cart\n").unwrap();
+        std::fs::write(root.join("cart_test.go"), "package cart\n").unwrap();
+        std::fs::write(root.join("tests/cli.rs"), "fn cli() {}\n").unwrap();
+
+        let stats = analyzer
+            .analyze_directory(&root, &DirectoryOptions::default())
+            .unwrap();
+        let test_file = |name: &str| {
+            stats
+                .files
+                .iter()
+                .find(|file| file.path.ends_with(name))
+                .unwrap()
+                .stats
+                .test_file
+        };
+        // The tests directory above the analyzed root doesn't count
+        assert!(!test_file("cart.go"));
+        assert!(test_file("cart_test.go"));
+        assert!(test_file("cli.rs"));
+        assert_eq!(stats.tests.files, 2);
+
+        let single = analyzer.analyze_file(&root.join("cart_test.go")).unwrap();
+        assert!(single.stats.test_file);
+    }
+
+    #[test]
+    fn test_analyze_directory_respects_gitignore() {
+        let mut analyzer = CodeAnalyzer::new();
+        let temp_dir = TempDir::new().unwrap();
+
+        std::fs::write(temp_dir.path().join(".gitignore"), "generated/\n*.gen.rs\n").unwrap();
+        std::fs::create_dir(temp_dir.path().join("generated")).unwrap();
+        std::fs::write(temp_dir.path().join("main.rs"), "fn main() {}").unwrap();
+        std::fs::write(temp_dir.path().join("schema.gen.rs"), "fn schema() {}").unwrap();
+        std::fs::write(temp_dir.path().join("generated/api.rs"), "fn api() {}").unwrap();
+
+        let stats = analyzer
+            .analyze_directory(temp_dir.path(), &DirectoryOptions::default())
+            .unwrap();
+        assert_eq!(stats.total_files(), 1);
+
+        let options = DirectoryOptions {
+            respect_gitignore: false,
+            ..Default::default()
+        };
+        let stats = analyzer
+            .analyze_directory(temp_dir.path(), &options)
+            .unwrap();
+        assert_eq!(stats.total_files(), 3);
+    }
+
+    #[test]
+    fn test_analyze_directory_always_skips_git_directory() {
+        let mut analyzer = CodeAnalyzer::new();
+        let temp_dir = TempDir::new().unwrap();
+
+        std::fs::create_dir(temp_dir.path().join(".git")).unwrap();
+        std::fs::write(temp_dir.path().join(".git/hook.rs"), "fn hook() {}").unwrap();
+        std::fs::write(temp_dir.path().join("main.rs"), "fn main() {}").unwrap();
+
+        let options = DirectoryOptions {
+            respect_gitignore: false,
+            ..Default::default()
+        };
+        let stats = analyzer
+            .analyze_directory(temp_dir.path(), &options)
+            .unwrap();
+        assert_eq!(stats.total_files(), 1);
+    }
+
+    #[test]
+    fn test_analyze_directory_parallel_matches_sequential() {
+        let temp_dir = TempDir::new().unwrap();
+        for i in 0..20 {
+            let source = format!("fn f{i}() {{}}\nfn g{i}() {{}}\nstruct S{i} {{}}\n");
+            std::fs::write(temp_dir.path().join(format!("file{i:02}.rs")), source).unwrap();
+        }
+
+        let sequential = CodeAnalyzer::new()
+            .analyze_directory(
+                temp_dir.path(),
+                &DirectoryOptions {
+                    jobs: 1,
+                    ..Default::default()
+                },
+            )
+            .unwrap();
+        let parallel = CodeAnalyzer::new()
+            .analyze_directory(
+                temp_dir.path(),
+                &DirectoryOptions {
+                    jobs: 4,
+                    ..Default::default()
+                },
+            )
+            .unwrap();
+
+        assert_eq!(parallel.total_files(), 20);
+        assert_eq!(parallel.total_stats.function_count, 40);
+        assert_eq!(
+            parallel.total_stats.function_count,
+            sequential.total_stats.function_count
+        );
+        assert_eq!(
+            parallel.total_stats.class_struct_count,
+            sequential.total_stats.class_struct_count
+        );
+
+        // Files are merged in path order regardless of scheduling
+        let sequential_paths: Vec<_> = sequential.files.iter().map(|f| &f.path).collect();
+        let parallel_paths: Vec<_> = parallel.files.iter().map(|f| &f.path).collect();
+        assert_eq!(parallel_paths, sequential_paths);
+        assert!(parallel_paths.is_sorted());
+    }
+
+    #[test]
+    fn test_effective_jobs() {
+        assert_eq!(effective_jobs(3), 3);
+        assert!(effective_jobs(0) >= 1);
+    }
+
+    #[test]
+    fn test_analyze_directory_reuses_cached_results() {
+        let temp_dir = TempDir::new().unwrap();
+        let source = "fn main() {}\n";
+        std::fs::write(temp_dir.path().join("main.rs"), source).unwrap();
+
+        let cache = Arc::new(AnalysisCache::load(&temp_dir.path().join(CACHE_DIR)));
+        let mut analyzer = CodeAnalyzer::new().with_cache(Arc::clone(&cache));
+        let stats = analyzer
+            .analyze_directory(temp_dir.path(), &DirectoryOptions::default())
+            .unwrap();
+        assert_eq!(stats.total_stats.function_count, 1);
+
+        // A planted entry for the same content proves the file isn't reparsed
+        let key = AnalysisCache::key(SupportedLanguage::Rust, Dialect::Standard, "", source);
+        let mut planted = cache.get(&key).unwrap();
+        planted.function_count = 42;
+        cache.insert(key, planted);
+
+        cache.save().unwrap();
+        let stats = analyzer
+            .analyze_directory(temp_dir.path(), &DirectoryOptions::default())
+            .unwrap();
+        assert_eq!(stats.total_stats.function_count, 42);
+        // The cache directory itself is never analyzed
+        assert_eq!(stats.total_files(), 1);
+    }
 }
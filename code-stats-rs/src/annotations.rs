@@ -0,0 +1,293 @@
+//! Annotations of CI systems for threshold violations and lint findings.
+//!
+//! `--format github-annotations` prints one GitHub Actions workflow command
+//! per violation (`::warning file=...,line=...::message`), which the runner
+//! turns into annotations on the pull request's changed lines.
+//! `--format gitlab-codequality` emits a GitLab Code Quality report, a JSON
+//! array of issues that merge requests show inline once the job uploads it
+//! as a `codequality` report artifact. Both name the same violations as the
+//! SARIF log, in the same order.
+
+use crate::lint::{Finding, Severity};
+use crate::sarif::{artifact_uri, violations};
+use crate::stats::{DirectoryStats, Thresholds};
+use serde::Serialize;
+use sha2::{Digest, Sha256};
+
+/// An issue of a GitLab Code Quality report.
+#[derive(Serialize)]
+struct CodeQualityIssue {
+    description: String,
+    check_name: String,
+    /// Identifies the issue across runs, so merge requests can tell new
+    /// issues from resolved ones
+    fingerprint: String,
+    /// `info`, `minor`, `major`, `critical`, or `blocker`
+    severity: &'static str,
+    location: CodeQualityLocation,
+}
+
+#[derive(Serialize)]
+struct CodeQualityLocation {
+    path: String,
+    lines: CodeQualityLines,
+}
+
+#[derive(Serialize)]
+struct CodeQualityLines {
+    begin: usize,
+    end: usize,
+}
+
+/// Formats threshold violations as GitHub Actions workflow commands, one
+/// `::warning` line per violation; a clean run prints nothing.
+///
+/// # Arguments
+///
+/// * `stats` - Directory statistics whose functions are checked
+/// * `thresholds` - Complexity and length limits
+pub(crate) fn format_github_annotations(stats: &DirectoryStats, thresholds: &Thresholds) -> String {
+    violations(stats, thresholds)
+        .iter()
+        .map(|violation| {
+            let function = violation.function.function;
+            github_command(
+                "warning",
+                &artifact_uri(violation.function.path),
+                (function.start_line, function.end_line),
+                violation.rule_name,
+                &violation.message,
+            )
+        })
+        .collect()
+}
+
+/// Formats threshold violations as a GitLab Code Quality report; a clean run
+/// emits an empty array.
+///
+/// # Arguments
+///
+/// * `stats` - Directory statistics whose functions are checked
+/// * `thresholds` - Complexity and length limits
+pub(crate) fn format_gitlab_codequality(stats: &DirectoryStats, thresholds: &Thresholds) -> String {
+    let issues: Vec<CodeQualityIssue> = violations(stats, thresholds)
+        .into_iter()
+        .map(|violation| {
+            let path = artifact_uri(violation.function.path);
+            let function = violation.function.function;
+            // Lines are left out so moving a function keeps its issue
+            let fingerprint = fingerprint(&[violation.rule_id, &path, &function.qualified_name]);
+            CodeQualityIssue {
+                description: violation.message,
+                check_name: violation.rule_name.to_string(),
+                fingerprint,
+                severity: "minor",
+                location: CodeQualityLocation {
+                    path,
+                    lines: CodeQualityLines {
+                        begin: function.start_line,
+                        end: function.end_line,
+                    },
+                },
+            }
+        })
+        .collect();
+    to_json(&issues)
+}
+
+/// Formats the findings of `--lint` as GitHub Actions workflow commands,
+/// with the finding's severity as the command (`note` as `notice`).
+pub(crate) fn format_findings_github(findings: &[Finding]) -> String {
+    findings
+        .iter()
+        .map(|finding| {
+            let command = match finding.severity {
+                Severity::Error => "error",
+                Severity::Warning => "warning",
+                Severity::Note => "notice",
+            };
+            github_command(
+                command,
+                &artifact_uri(&finding.path),
+                (finding.line, finding.end_line),
+                &finding.rule,
+                &finding.message,
+            )
+        })
+        .collect()
+}
+
+/// Formats the findings of `--lint` as a GitLab Code Quality report.
+pub(crate) fn format_findings_codequality(findings: &[Finding]) -> String {
+    let issues: Vec<CodeQualityIssue> = findings
+        .iter()
+        .map(|finding| {
+            let path = artifact_uri(&finding.path);
+            // A finding has no name to tell it apart from others of the rule
+            let fingerprint = fingerprint(&[
+                &finding.rule,
+                &path,
+                &finding.line.to_string(),
+                &finding.column.to_string(),
+            ]);
+            CodeQualityIssue {
+                description: finding.message.clone(),
+                check_name: finding.rule.clone(),
+                fingerprint,
+                severity: match finding.severity {
+                    Severity::Error => "major",
+                    Severity::Warning => "minor",
+                    Severity::Note => "info",
+                },
+                location: CodeQualityLocation {
+                    path,
+                    lines: CodeQualityLines {
+                        begin: finding.line,
+                        end: finding.end_line,
+                    },
+                },
+            }
+        })
+        .collect();
+    to_json(&issues)
+}
+
+/// Builds a workflow command line: `::warning file=src/lib.rs,line=10,
+/// endLine=40,title=FunctionTooComplex::message`.
+fn github_command(
+    command: &str,
+    path: &str,
+    (line, end_line): (usize, usize),
+    title: &str,
+    message: &str,
+) -> String {
+    format!(
+        "::{command} file={},line={line},endLine={end_line},title={}::{}\n",
+        escape_property(path),
+        escape_property(title),
+        escape_data(message)
+    )
+}
+
+/// Escapes the message of a workflow command, which ends at a newline.
+fn escape_data(text: &str) -> String {
+    text.replace('%', "%25")
+        .replace('\r', "%0D")
+        .replace('\n', "%0A")
+}
+
+/// Escapes a property of a workflow command, which also ends at `,` and
+/// `::`.
+fn escape_property(text: &str) -> String {
+    escape_data(text).replace(':', "%3A").replace(',', "%2C")
+}
+
+/// Hashes the parts identifying an issue into its fingerprint.
+fn fingerprint(parts: &[&str]) -> String {
+    let mut hasher = Sha256::new();
+    for part in parts {
+        hasher.update(part);
+        hasher.update("\0");
+    }
+    format!("{:x}", hasher.finalize())
+}
+
+fn to_json(issues: &[CodeQualityIssue]) -> String {
+    serde_json::to_string_pretty(issues)
+        .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::language::SupportedLanguage;
+    use crate::parser::{CodeStats, FunctionStats};
+    use crate::stats::FileStats;
+    use std::path::PathBuf;
+
+    fn stats_with(functions: Vec<FunctionStats>) -> DirectoryStats {
+        let mut stats = DirectoryStats::new();
+        stats.add_file(FileStats {
+            path: PathBuf::from("./src/lib.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                function_count: functions.len(),
+                functions,
+                ..CodeStats::default()
+            },
+        });
+        stats
+    }
+
+    fn function(
+        name: &str,
+        start_line: usize,
+        end_line: usize,
+        complexity: usize,
+    ) -> FunctionStats {
+        FunctionStats {
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            start_line,
+            end_line,
+            complexity,
+            ..FunctionStats::default()
+        }
+    }
+
+    #[test]
+    fn test_github_annotations() {
+        let stats = stats_with(vec![
+            function("parse", 10, 40, 14),
+            function("small", 50, 52, 1),
+            function("huge", 60, 200, 3),
+        ]);
+        assert_eq!(
+            format_github_annotations(&stats, &Thresholds::default()),
+            "::warning file=src/lib.rs,line=10,endLine=40,title=FunctionTooComplex::\
+             Function 'parse' has a cyclomatic complexity of 14 (threshold 10)\n\
+             ::warning file=src/lib.rs,line=60,endLine=200,title=FunctionTooLong::\
+             Function 'huge' spans 141 lines (threshold 100)\n"
+        );
+        assert_eq!(
+            format_github_annotations(&stats_with(Vec::new()), &Thresholds::default()),
+            ""
+        );
+    }
+
+    #[test]
+    fn test_escape_workflow_command() {
+        assert_eq!(
+            github_command("notice", "a,b:c.rs", (1, 2), "t", "100%\nsure"),
+            "::notice file=a%2Cb%3Ac.rs,line=1,endLine=2,title=t::100%25%0Asure\n"
+        );
+    }
+
+    #[test]
+    fn test_gitlab_codequality() {
+        let thresholds = Thresholds::default();
+        let report = format_gitlab_codequality(
+            &stats_with(vec![function("parse", 10, 40, 14)]),
+            &thresholds,
+        );
+        let issues: serde_json::Value = serde_json::from_str(&report).unwrap();
+        assert_eq!(issues[0]["check_name"], "FunctionTooComplex");
+        assert_eq!(issues[0]["severity"], "minor");
+        assert_eq!(issues[0]["location"]["path"], "src/lib.rs");
+        assert_eq!(issues[0]["location"]["lines"]["begin"], 10);
+
+        // Moving the function keeps its fingerprint
+        let moved = format_gitlab_codequality(
+            &stats_with(vec![function("parse", 90, 120, 14)]),
+            &thresholds,
+        );
+        let moved: serde_json::Value = serde_json::from_str(&moved).unwrap();
+        assert_eq!(moved[0]["fingerprint"], issues[0]["fingerprint"]);
+        assert_eq!(issues[0]["fingerprint"].as_str().unwrap().len(), 64);
+
+        assert_eq!(
+            format_gitlab_codequality(&stats_with(Vec::new()), &thresholds),
+            "[]"
+        );
+    }
+}
@@ -0,0 +1,218 @@
+//! shields.io-style SVG badges for the `badge` subcommand.
+//!
+//! The badges use the flat style of shields.io, a grey label on the left and
+//! a colored message on the right, so they sit well next to the badges of
+//! other services in a README. Text is measured with approximate Verdana
+//! widths, since the SVG is written without a font at hand; the result is
+//! within a pixel or two of what shields.io produces.
+
+use crate::cli::BadgeMetric;
+use crate::stats::DirectoryStats;
+
+/// Colors of the shields.io palette used by the badges.
+const BLUE: &str = "#007ec6";
+const BRIGHT_GREEN: &str = "#4c1";
+const GREEN: &str = "#97ca00";
+const YELLOW: &str = "#dfb317";
+const ORANGE: &str = "#fe7d37";
+const RED: &str = "#e05d44";
+const LIGHT_GREY: &str = "#9f9f9f";
+
+/// Horizontal padding around the text of each half, in pixels.
+const PADDING: usize = 10;
+
+/// Text and color of a badge.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct Badge {
+    /// Left-hand text, e.g. `lines of code`
+    pub label: String,
+    /// Right-hand text, e.g. `12.3k`
+    pub message: String,
+    /// Background of the message, e.g. `#4c1`
+    pub color: &'static str,
+}
+
+impl Badge {
+    /// Builds the badge of a metric from directory statistics.
+    ///
+    /// `loc` counts lines of code; `coverage-of-docs` is the share of public
+    /// declarations with a doc comment, green from 80% and red below 20%;
+    /// `complexity` is the mean cyclomatic complexity, green up to 5 and red
+    /// above 20.
+    pub(crate) fn new(stats: &DirectoryStats, metric: BadgeMetric) -> Self {
+        let (label, message, color) = match metric {
+            BadgeMetric::Loc => ("lines of code", compact(stats.total_stats.lines.code), BLUE),
+            BadgeMetric::CoverageOfDocs => match stats.total_stats.docs.ratio() {
+                Some(ratio) => {
+                    let percent = ratio * 100.0;
+                    let color = match percent {
+                        p if p >= 80.0 => BRIGHT_GREEN,
+                        p if p >= 60.0 => GREEN,
+                        p if p >= 40.0 => YELLOW,
+                        p if p >= 20.0 => ORANGE,
+                        _ => RED,
+                    };
+                    ("doc coverage", format!("{percent:.0}%"), color)
+                }
+                None => ("doc coverage", "n/a".to_string(), LIGHT_GREY),
+            },
+            BadgeMetric::Complexity => {
+                let mean = stats.mean_complexity();
+                let color = match mean {
+                    m if m <= 5.0 => BRIGHT_GREEN,
+                    m if m <= 10.0 => YELLOW,
+                    m if m <= 20.0 => ORANGE,
+                    _ => RED,
+                };
+                ("complexity", format!("avg {mean:.1}"), color)
+            }
+        };
+        Self {
+            label: label.to_string(),
+            message,
+            color,
+        }
+    }
+
+    /// Renders the badge as a standalone SVG document, ending in a line
+    /// break.
+    pub(crate) fn to_svg(&self) -> String {
+        let label_width = text_width(&self.label) + PADDING;
+        let message_width = text_width(&self.message) + PADDING;
+        let width = label_width + message_width;
+        // Text is positioned at 10x scale, as shields.io does, for sub-pixel centering
+        let label_x = label_width * 5;
+        let message_x = label_width * 10 + message_width * 5;
+        let label = escape(&self.label);
+        let message = escape(&self.message);
+        let color = self.color;
+        format!(
+            "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"{width}\" height=\"20\" role=\"img\" aria-label=\"{label}: {message}\">\
+             <title>{label}: {message}</title>\
+             <linearGradient id=\"s\" x2=\"0\" y2=\"100%\"><stop offset=\"0\" stop-color=\"#bbb\" stop-opacity=\".1\"/><stop offset=\"1\" stop-opacity=\".1\"/></linearGradient>\
+             <clipPath id=\"r\"><rect width=\"{width}\" height=\"20\" rx=\"3\" fill=\"#fff\"/></clipPath>\
+             <g clip-path=\"url(#r)\"><rect width=\"{label_width}\" height=\"20\" fill=\"#555\"/><rect x=\"{label_width}\" width=\"{message_width}\" height=\"20\" fill=\"{color}\"/><rect width=\"{width}\" height=\"20\" fill=\"url(#s)\"/></g>\
+             <g fill=\"#fff\" text-anchor=\"middle\" font-family=\"Verdana,Geneva,DejaVu Sans,sans-serif\" font-size=\"110\">\
+             <text x=\"{label_x}\" y=\"150\" fill=\"#010101\" fill-opacity=\".3\" transform=\"scale(.1)\">{label}</text>\
+             <text x=\"{label_x}\" y=\"140\" transform=\"scale(.1)\">{label}</text>\
+             <text x=\"{message_x}\" y=\"150\" fill=\"#010101\" fill-opacity=\".3\" transform=\"scale(.1)\">{message}</text>\
+             <text x=\"{message_x}\" y=\"140\" transform=\"scale(.1)\">{message}</text></g></svg>\n"
+        )
+    }
+}
+
+/// Formats a count with a `k` or `M` suffix and three significant digits,
+/// e.g. `950`, `12.3k`, `123k`, or `2.3M`.
+///
+/// The count is rounded to tenths before the precision is chosen, so
+/// `99_950` is `100k` rather than `100.0k`.
+fn compact(count: usize) -> String {
+    let scaled = |unit: usize, suffix: &str| {
+        let tenths = (count * 10 + unit / 2) / unit;
+        if tenths < 1_000 {
+            format!("{}.{}{suffix}", tenths / 10, tenths % 10)
+        } else {
+            format!("{}{suffix}", (count + unit / 2) / unit)
+        }
+    };
+    match count {
+        0..1_000 => count.to_string(),
+        1_000..999_500 => scaled(1_000, "k"),
+        _ => scaled(1_000_000, "M"),
+    }
+}
+
+/// Approximates the width in pixels of text in 11px Verdana.
+fn text_width(text: &str) -> usize {
+    let tenths: usize = text
+        .chars()
+        .map(|c| match c {
+            'i' | 'j' | 'l' | '.' | ',' | ':' | ';' | '\'' | '!' | '|' => 35,
+            ' ' | 'f' | 'r' | 't' | '(' | ')' | '[' | ']' | '/' => 45,
+            'm' | 'w' | 'M' | 'W' | '%' => 105,
+            c if c.is_ascii_uppercase() => 75,
+            _ => 70,
+        })
+        .sum();
+    tenths.div_ceil(10)
+}
+
+/// Escapes text for an SVG element or attribute.
+fn escape(text: &str) -> String {
+    text.replace('&', "&amp;")
+        .replace('<', "&lt;")
+        .replace('>', "&gt;")
+        .replace('"', "&quot;")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::comments::DocCoverage;
+    use crate::stats::test_support::{directory, file};
+
+    fn stats() -> DirectoryStats {
+        let mut lib = file("src/lib.rs", 12_345, &[3, 12]);
+        lib.stats.docs = DocCoverage {
+            documented: 13,
+            public: 20,
+        };
+        directory([lib])
+    }
+
+    #[test]
+    fn test_badge_metrics() {
+        let stats = stats();
+        let badge = |metric| {
+            let badge = Badge::new(&stats, metric);
+            (badge.label, badge.message, badge.color)
+        };
+        assert_eq!(
+            badge(BadgeMetric::Loc),
+            ("lines of code".to_string(), "12.3k".to_string(), BLUE)
+        );
+        assert_eq!(
+            badge(BadgeMetric::CoverageOfDocs),
+            ("doc coverage".to_string(), "65%".to_string(), GREEN)
+        );
+        assert_eq!(
+            badge(BadgeMetric::Complexity),
+            ("complexity".to_string(), "avg 7.5".to_string(), YELLOW)
+        );
+
+        let empty = Badge::new(&DirectoryStats::new(), BadgeMetric::CoverageOfDocs);
+        assert_eq!((empty.message.as_str(), empty.color), ("n/a", LIGHT_GREY));
+    }
+
+    #[test]
+    fn test_compact() {
+        assert_eq!(compact(950), "950");
+        assert_eq!(compact(1_234), "1.2k");
+        assert_eq!(compact(99_949), "99.9k");
+        assert_eq!(compact(99_950), "100k");
+        assert_eq!(compact(123_456), "123k");
+        assert_eq!(compact(999_499), "999k");
+        assert_eq!(compact(999_700), "1.0M");
+        assert_eq!(compact(2_345_678), "2.3M");
+        assert_eq!(compact(99_950_000), "100M");
+    }
+
+    #[test]
+    fn test_to_svg() {
+        let badge = Badge {
+            label: "lines of code".to_string(),
+            message: "<1k & more".to_string(),
+            color: BLUE,
+        };
+        let svg = badge.to_svg();
+        assert!(svg.starts_with("<svg xmlns=\"http://www.w3.org/2000/svg\""));
+        assert!(svg.contains("<title>lines of code: &lt;1k &amp; more</title>"));
+        assert!(svg.contains(&format!("fill=\"{BLUE}\"")));
+        assert!(svg.ends_with("</svg>\n"));
+
+        let label_width = text_width("lines of code") + PADDING;
+        let width = label_width + text_width("<1k & more") + PADDING;
+        assert!(svg.contains(&format!("width=\"{width}\" height=\"20\" role=\"img\"")));
+        assert!(svg.contains(&format!("<rect x=\"{label_width}\"")));
+    }
+}
@@ -0,0 +1,495 @@
+//! Metric baselines for CI quality gates.
+//!
+//! `baseline write` snapshots the current metrics into a JSON file meant to be
+//! committed with the code; `check` re-analyzes the tree and reports every
+//! metric that regressed beyond its tolerance, so a CI job can fail on it.
+//! `check` also enforces fixed limits on the parameters and return values of
+//! every function, whatever the baseline recorded.
+
+use crate::error::{CodeStatsError, Result};
+use crate::stats::DirectoryStats;
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::fmt;
+use std::fs;
+use std::path::Path;
+
+/// Default baseline file name, relative to the working directory.
+pub(crate) const BASELINE_FILE: &str = "codestats-baseline.json";
+
+/// Version of the baseline file format.
+///
+/// Bump this whenever a field is renamed, removed, or changes meaning.
+const BASELINE_SCHEMA_VERSION: u32 = 1;
+
+/// Snapshot of the metrics a check compares against.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub(crate) struct Baseline {
+    /// Version of this format, see `BASELINE_SCHEMA_VERSION`
+    pub schema_version: u32,
+    /// Number of analyzed files, not counting configuration files
+    pub total_files: usize,
+    /// Highest cyclomatic complexity of any function
+    pub max_complexity: usize,
+    /// Length in lines of the longest function
+    pub max_function_lines: usize,
+    /// Every function, ordered by path and then source position
+    pub functions: Vec<BaselineFunction>,
+}
+
+/// Recorded metrics of a single function.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub(crate) struct BaselineFunction {
+    /// Path relative to the analyzed root, with forward slashes
+    pub path: String,
+    /// Qualified function name
+    pub name: String,
+    /// Cyclomatic complexity
+    pub complexity: usize,
+    /// Number of lines spanned
+    pub lines: usize,
+    /// Number of declared parameters
+    #[serde(default)]
+    pub parameters: usize,
+    /// Number of values returned
+    #[serde(default)]
+    pub returns: usize,
+}
+
+/// How much each metric may grow before a check fails.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub(crate) struct Tolerances {
+    /// Allowed increase of a function's (and the maximum) cyclomatic complexity
+    pub complexity: usize,
+    /// Allowed increase of a function's (and the maximum) length in lines
+    pub function_lines: usize,
+    /// Allowed increase of the number of analyzed files
+    pub file_count: usize,
+}
+
+/// Fixed per-function limits; `None` leaves a metric unchecked.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub(crate) struct Limits {
+    /// Most parameters a function may declare
+    pub parameters: Option<usize>,
+    /// Most values a function may return
+    pub returns: Option<usize>,
+}
+
+/// A function over one of the `Limits`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct Violation {
+    /// The offending function, e.g. `src/lib.rs parse`
+    pub function: String,
+    /// What is over the limit, `parameters` or `returns`
+    pub metric: &'static str,
+    /// Value found by the current analysis
+    pub value: usize,
+    /// Limit that was exceeded
+    pub limit: usize,
+}
+
+impl fmt::Display for Violation {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "{}: {} {} (limit {})",
+            self.function, self.value, self.metric, self.limit
+        )
+    }
+}
+
+/// A metric that grew by more than its tolerance.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct Regression {
+    /// What regressed, e.g. `max complexity` or `src/lib.rs parse: lines`
+    pub metric: String,
+    /// Value recorded in the baseline
+    pub baseline: usize,
+    /// Value found by the current analysis
+    pub current: usize,
+    /// Allowed increase that was exceeded
+    pub tolerance: usize,
+}
+
+impl fmt::Display for Regression {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "{}: {} -> {} (tolerance {})",
+            self.metric, self.baseline, self.current, self.tolerance
+        )
+    }
+}
+
+impl Baseline {
+    /// Captures the metrics of an analysis of `root`.
+    ///
+    /// Function paths are stored relative to `root` so that a baseline written
+    /// from one working directory can be checked from another.
+    pub(crate) fn from_stats(stats: &DirectoryStats, root: &Path) -> Self {
+        let mut functions: Vec<_> = stats.functions().collect();
+        functions.sort_by(|a, b| {
+            a.path
+                .cmp(b.path)
+                .then_with(|| a.function.start_line.cmp(&b.function.start_line))
+        });
+
+        Self {
+            schema_version: BASELINE_SCHEMA_VERSION,
+            // Configuration files, the baseline itself among them, are not code
+            total_files: stats.code_files(),
+            max_complexity: stats.max_complexity(),
+            max_function_lines: functions
+                .iter()
+                .map(|f| f.function.line_count())
+                .max()
+                .unwrap_or(0),
+            functions: functions
+                .iter()
+                .map(|f| BaselineFunction {
+                    path: relative_path(f.path, root),
+                    name: f.function.qualified_name.clone(),
+                    complexity: f.function.complexity,
+                    lines: f.function.line_count(),
+                    parameters: f.function.parameters,
+                    returns: f.function.returns,
+                })
+                .collect(),
+        }
+    }
+
+    /// Lists the functions over `limits`.
+    ///
+    /// # Returns
+    ///
+    /// The violations by path and source position, parameters before returns
+    /// for the same function
+    pub(crate) fn violations(&self, limits: &Limits) -> Vec<Violation> {
+        let mut violations = Vec::new();
+        for function in &self.functions {
+            let checks = [
+                ("parameters", function.parameters, limits.parameters),
+                ("returns", function.returns, limits.returns),
+            ];
+            for (metric, value, limit) in checks {
+                if let Some(limit) = limit.filter(|&limit| value > limit) {
+                    violations.push(Violation {
+                        function: format!("{} {}", function.path, function.name),
+                        metric,
+                        value,
+                        limit,
+                    });
+                }
+            }
+        }
+        violations
+    }
+
+    /// Reads a baseline written by `save`.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Baseline)` - The baseline was read successfully
+    /// * `Err(IoError)` - The file could not be read
+    /// * `Err(ConfigError)` - The file is not a baseline of a supported version
+    pub(crate) fn load(path: &Path) -> Result<Self> {
+        let content = fs::read_to_string(path).map_err(|e| {
+            CodeStatsError::IoError(format!("Failed to read baseline {}: {e}", path.display()))
+        })?;
+        let baseline: Baseline = serde_json::from_str(&content)
+            .map_err(|e| CodeStatsError::ConfigError(format!("{}: {e}", path.display())))?;
+
+        if baseline.schema_version != BASELINE_SCHEMA_VERSION {
+            return Err(CodeStatsError::ConfigError(format!(
+                "{}: unsupported baseline schema version {} (expected {BASELINE_SCHEMA_VERSION})",
+                path.display(),
+                baseline.schema_version
+            )));
+        }
+        Ok(baseline)
+    }
+
+    /// Writes the baseline as pretty-printed JSON, replacing any existing file.
+    pub(crate) fn save(&self, path: &Path) -> Result<()> {
+        let content = serde_json::to_string_pretty(self)
+            .map_err(|e| CodeStatsError::IoError(format!("Failed to serialize baseline: {e}")))?;
+        fs::write(path, content + "\n").map_err(|e| {
+            CodeStatsError::IoError(format!("Failed to write baseline {}: {e}", path.display()))
+        })
+    }
+
+    /// Lists the metrics of `current` that regressed against this baseline.
+    ///
+    /// Functions are matched by path and qualified name (and, for repeated
+    /// names such as anonymous closures, by their order within the file).
+    /// New functions have nothing to regress from, but still count towards
+    /// the maximum complexity and length.
+    ///
+    /// # Arguments
+    ///
+    /// * `current` - Metrics of the analysis being checked
+    /// * `tolerances` - Allowed increase per metric
+    ///
+    /// # Returns
+    ///
+    /// The regressions in a stable order: totals first, then functions by path
+    pub(crate) fn regressions(
+        &self,
+        current: &Baseline,
+        tolerances: &Tolerances,
+    ) -> Vec<Regression> {
+        let mut regressions = Vec::new();
+        let mut check = |metric: String, before: usize, after: usize, tolerance: usize| {
+            if after > before + tolerance {
+                regressions.push(Regression {
+                    metric,
+                    baseline: before,
+                    current: after,
+                    tolerance,
+                });
+            }
+        };
+
+        check(
+            "file count".to_string(),
+            self.total_files,
+            current.total_files,
+            tolerances.file_count,
+        );
+        check(
+            "max complexity".to_string(),
+            self.max_complexity,
+            current.max_complexity,
+            tolerances.complexity,
+        );
+        check(
+            "max function lines".to_string(),
+            self.max_function_lines,
+            current.max_function_lines,
+            tolerances.function_lines,
+        );
+
+        let recorded: HashMap<_, _> = index_functions(&self.functions).into_iter().collect();
+        for (key, function) in index_functions(&current.functions) {
+            let Some(previous) = recorded.get(&key) else {
+                continue;
+            };
+            let subject = format!("{} {}", function.path, function.name);
+            check(
+                format!("{subject}: complexity"),
+                previous.complexity,
+                function.complexity,
+                tolerances.complexity,
+            );
+            check(
+                format!("{subject}: lines"),
+                previous.lines,
+                function.lines,
+                tolerances.function_lines,
+            );
+        }
+
+        regressions
+    }
+}
+
+/// Key identifying a function across analyses: path, name, and the number of
+/// earlier functions with the same path and name.
+type FunctionKey<'a> = (&'a str, &'a str, usize);
+
+/// Keys functions for matching, preserving their order.
+fn index_functions(functions: &[BaselineFunction]) -> Vec<(FunctionKey<'_>, &BaselineFunction)> {
+    let mut seen: HashMap<(&str, &str), usize> = HashMap::new();
+    functions
+        .iter()
+        .map(|function| {
+            let occurrence = seen
+                .entry((function.path.as_str(), function.name.as_str()))
+                .or_default();
+            let key = (function.path.as_str(), function.name.as_str(), *occurrence);
+            *occurrence += 1;
+            (key, function)
+        })
+        .collect()
+}
+
+/// Renders `path` relative to `root` with forward slashes.
+///
+/// When `root` is the analyzed file itself, its file name is used.
+fn relative_path(path: &Path, root: &Path) -> String {
+    let relative = match path.strip_prefix(root) {
+        Ok(relative) if relative.as_os_str().is_empty() => {
+            path.file_name().map(Path::new).unwrap_or(path)
+        }
+        Ok(relative) => relative,
+        Err(_) => path,
+    };
+    relative.to_string_lossy().replace('\\', "/")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::language::SupportedLanguage;
+    use crate::parser::{CodeStats, FunctionStats};
+    use crate::stats::FileStats;
+    use std::path::PathBuf;
+    use tempfile::TempDir;
+
+    /// `(name, lines, complexity)` of a test function.
+    type TestFunction<'a> = (&'a str, usize, usize);
+
+    fn stats_with(files: &[(&str, Vec<TestFunction>)]) -> DirectoryStats {
+        let mut stats = DirectoryStats::new();
+        for (path, functions) in files {
+            let functions: Vec<FunctionStats> = functions
+                .iter()
+                .enumerate()
+                .map(|(i, (name, lines, complexity))| FunctionStats {
+                    name: name.to_string(),
+                    qualified_name: name.to_string(),
+                    start_line: i * 100 + 1,
+                    end_line: i * 100 + lines,
+                    complexity: *complexity,
+                    ..Default::default()
+                })
+                .collect();
+            stats.add_file(FileStats {
+                path: PathBuf::from(path),
+                language: SupportedLanguage::Rust,
+                stats: CodeStats {
+                    function_count: functions.len(),
+                    functions,
+                    ..Default::default()
+                },
+            });
+        }
+        stats
+    }
+
+    #[test]
+    fn test_from_stats_relativizes_paths() {
+        let stats = stats_with(&[("project/src/lib.rs", vec![("parse", 20, 4)])]);
+        let baseline = Baseline::from_stats(&stats, Path::new("project"));
+
+        assert_eq!(baseline.total_files, 1);
+        assert_eq!(baseline.max_complexity, 4);
+        assert_eq!(baseline.max_function_lines, 20);
+        assert_eq!(baseline.functions[0].path, "src/lib.rs");
+
+        let single = Baseline::from_stats(&stats, Path::new("project/src/lib.rs"));
+        assert_eq!(single.functions[0].path, "lib.rs");
+    }
+
+    #[test]
+    fn test_unchanged_metrics_pass() {
+        let stats = stats_with(&[("src/lib.rs", vec![("parse", 20, 4)])]);
+        let baseline = Baseline::from_stats(&stats, Path::new("."));
+        assert!(
+            baseline
+                .regressions(&baseline, &Tolerances::default())
+                .is_empty()
+        );
+    }
+
+    #[test]
+    fn test_regressions_beyond_tolerance() {
+        let root = Path::new(".");
+        let before = Baseline::from_stats(
+            &stats_with(&[(
+                "src/lib.rs",
+                vec![("parse", 20, 4), ("closure", 3, 1), ("closure", 3, 1)],
+            )]),
+            root,
+        );
+        let after = Baseline::from_stats(
+            &stats_with(&[
+                (
+                    "src/lib.rs",
+                    vec![("parse", 30, 6), ("closure", 3, 1), ("closure", 5, 1)],
+                ),
+                ("src/new.rs", vec![("fresh", 2, 1)]),
+            ]),
+            root,
+        );
+
+        let tolerances = Tolerances {
+            complexity: 1,
+            function_lines: 5,
+            file_count: 0,
+        };
+        let regressions: Vec<String> = before
+            .regressions(&after, &tolerances)
+            .iter()
+            .map(ToString::to_string)
+            .collect();
+        assert_eq!(
+            regressions,
+            vec![
+                "file count: 1 -> 2 (tolerance 0)",
+                "max complexity: 4 -> 6 (tolerance 1)",
+                "max function lines: 20 -> 30 (tolerance 5)",
+                "src/lib.rs parse: complexity: 4 -> 6 (tolerance 1)",
+                "src/lib.rs parse: lines: 20 -> 30 (tolerance 5)",
+            ]
+        );
+
+        // Improvements are never regressions
+        assert!(after.regressions(&before, &tolerances).is_empty());
+    }
+
+    #[test]
+    fn test_violations_over_limits() {
+        let mut current = Baseline::from_stats(
+            &stats_with(&[("src/lib.rs", vec![("parse", 20, 4), ("split", 5, 1)])]),
+            Path::new("."),
+        );
+        current.functions[0].parameters = 7;
+        current.functions[0].returns = 3;
+        current.functions[1].parameters = 5;
+
+        let limits = Limits {
+            parameters: Some(5),
+            returns: Some(2),
+        };
+        let violations: Vec<String> = current
+            .violations(&limits)
+            .iter()
+            .map(ToString::to_string)
+            .collect();
+        assert_eq!(
+            violations,
+            vec![
+                "src/lib.rs parse: 7 parameters (limit 5)",
+                "src/lib.rs parse: 3 returns (limit 2)",
+            ]
+        );
+
+        // Unset limits check nothing
+        assert!(current.violations(&Limits::default()).is_empty());
+    }
+
+    #[test]
+    fn test_save_and_load_roundtrip() {
+        let temp_dir = TempDir::new().unwrap();
+        let path = temp_dir.path().join(BASELINE_FILE);
+        let baseline = Baseline::from_stats(
+            &stats_with(&[("src/lib.rs", vec![("parse", 20, 4)])]),
+            Path::new("."),
+        );
+
+        baseline.save(&path).unwrap();
+        assert_eq!(Baseline::load(&path).unwrap(), baseline);
+
+        let err = Baseline::load(&temp_dir.path().join("missing.json")).unwrap_err();
+        assert!(err.to_string().contains("Failed to read baseline"));
+
+        fs::write(&path, r#"{"schema_version": 99, "total_files": 0, "max_complexity": 0, "max_function_lines": 0, "functions": []}"#).unwrap();
+        let err = Baseline::load(&path).unwrap_err();
+        assert!(
+            err.to_string()
+                .contains("unsupported baseline schema version 99")
+        );
+    }
+}
@@ -0,0 +1,341 @@
+//! Definitions in the languages of the Erlang VM, Elixir and Erlang.
+//!
+//! Elixir's grammar has no declaration nodes: `defmodule`, `def`, and
+//! `defmacro` are calls like any other and are told apart by the name they
+//! call. Each `def` clause is a function of its own, as the clauses of a
+//! function are separate definitions in the source. An Erlang function is a
+//! `fun_decl` holding all of its clauses.
+//!
+//! Functions of both languages are named with their arity, as in `add/2`,
+//! since the same name with another arity is another function.
+
+use crate::language::SupportedLanguage;
+use tree_sitter::Node;
+
+/// Elixir macros that define functions, with the breakdown kind of each.
+const ELIXIR_DEFINITIONS: [(&str, &str); 6] = [
+    ("def", "function"),
+    ("defp", "private_function"),
+    ("defmacro", "macro"),
+    ("defmacrop", "macro"),
+    ("defguard", "guard"),
+    ("defguardp", "guard"),
+];
+
+/// Callbacks of the `GenServer` behaviour (`gen_server` in Erlang), by name
+/// and arity.
+const GENSERVER_CALLBACKS: [(&str, usize); 9] = [
+    ("init", 1),
+    ("handle_call", 3),
+    ("handle_cast", 2),
+    ("handle_info", 2),
+    ("handle_continue", 2),
+    ("terminate", 2),
+    ("code_change", 3),
+    ("format_status", 1),
+    ("format_status", 2),
+];
+
+/// Returns the name a local Elixir call calls, such as `def` in
+/// `def add(a, b)` or `if` in `if valid?, do: ...`. Remote calls such as
+/// `Enum.map(list, f)` have none.
+pub(crate) fn elixir_call_name<'a>(node: &Node, source: &'a [u8]) -> Option<&'a str> {
+    if node.kind() != "call" {
+        return None;
+    }
+    node.child_by_field_name("target")
+        .filter(|target| target.kind() == "identifier")
+        .and_then(|target| target.utf8_text(source).ok())
+}
+
+/// Returns the breakdown kind of an Elixir function definition: `function`
+/// for `def`, `private_function` for `defp`, `macro` for `defmacro` and
+/// `defmacrop`, and `guard` for `defguard` and `defguardp`.
+pub(crate) fn elixir_definition(node: &Node, source: &[u8]) -> Option<&'static str> {
+    let name = elixir_call_name(node, source)?;
+    ELIXIR_DEFINITIONS
+        .iter()
+        .find(|(macro_name, _)| *macro_name == name)
+        .map(|(_, kind)| *kind)
+}
+
+/// Returns the name of the module an Elixir `defmodule` or `defprotocol`
+/// defines, as written (`Shop.Cart`).
+pub(crate) fn elixir_module_name<'a>(node: &Node, source: &'a [u8]) -> Option<&'a str> {
+    if !matches!(elixir_call_name(node, source)?, "defmodule" | "defprotocol") {
+        return None;
+    }
+    first_argument(node)?.utf8_text(source).ok()
+}
+
+/// Returns the name and value of an Elixir module attribute such as
+/// `@doc "Adds an item."`; the value is `None` for a bare `@impl`.
+pub(crate) fn elixir_attribute<'a, 'tree>(
+    node: &Node<'tree>,
+    source: &'a [u8],
+) -> Option<(&'a str, Option<Node<'tree>>)> {
+    if node.kind() != "unary_operator"
+        || node
+            .child_by_field_name("operator")
+            .is_none_or(|operator| operator.kind() != "@")
+    {
+        return None;
+    }
+    let operand = node.child_by_field_name("operand")?;
+    match operand.kind() {
+        "identifier" => Some((operand.utf8_text(source).ok()?, None)),
+        "call" => Some((
+            elixir_call_name(&operand, source)?,
+            first_argument(&operand),
+        )),
+        _ => None,
+    }
+}
+
+/// Returns the head of an Elixir function definition: the node naming the
+/// function and its parameters, if it has parentheses.
+///
+/// Guards are looked through, so `def add(a, b) when a > 0` has the head
+/// `add(a, b)`.
+fn elixir_head<'tree>(node: &Node<'tree>) -> Option<(Node<'tree>, Option<Node<'tree>>)> {
+    let mut head = first_argument(node)?;
+    if head.kind() == "binary_operator"
+        && head
+            .child_by_field_name("operator")
+            .is_some_and(|operator| operator.kind() == "when")
+    {
+        head = head.child_by_field_name("left")?;
+    }
+    match head.kind() {
+        "call" => Some((head.child_by_field_name("target")?, arguments(&head))),
+        "identifier" => Some((head, None)),
+        _ => None,
+    }
+}
+
+/// Returns the `arguments` child of an Elixir call.
+fn arguments<'tree>(call: &Node<'tree>) -> Option<Node<'tree>> {
+    let mut cursor = call.walk();
+    call.named_children(&mut cursor)
+        .find(|child| child.kind() == "arguments")
+}
+
+/// Returns the first argument of an Elixir call, such as the module name of
+/// a `defmodule`.
+fn first_argument<'tree>(call: &Node<'tree>) -> Option<Node<'tree>> {
+    let arguments = arguments(call)?;
+    let mut cursor = arguments.walk();
+    arguments.named_children(&mut cursor).next()
+}
+
+/// Returns the display name of an Elixir or Erlang function with its arity,
+/// as in `add/2`, or `None` if `node` is not a named function of either.
+pub(crate) fn function_name(node: &Node, source: &[u8]) -> Option<String> {
+    let name = match node.kind() {
+        "call" => elixir_head(node)?.0,
+        "fun_decl" => node
+            .child_by_field_name("clause")?
+            .child_by_field_name("name")?,
+        _ => return None,
+    };
+    let name = name.utf8_text(source).ok()?;
+    Some(format!("{name}/{}", arity(node)))
+}
+
+/// Counts the parameters of an Elixir or Erlang function or anonymous
+/// function. The first clause is counted, as every clause has the same
+/// arity; default arguments (`\\`) count too.
+pub(crate) fn arity(node: &Node) -> usize {
+    let parameters = match node.kind() {
+        "call" => elixir_head(node).and_then(|(_, parameters)| parameters),
+        // `fn a, b -> ... end` lists its parameters in the clause
+        "anonymous_function" => {
+            let mut cursor = node.walk();
+            node.named_children(&mut cursor)
+                .find(|child| child.kind() == "stab_clause")
+                .and_then(|clause| clause.child_by_field_name("left"))
+        }
+        "fun_decl" => node
+            .child_by_field_name("clause")
+            .and_then(|clause| clause.child_by_field_name("args")),
+        "anonymous_fun" => {
+            let mut cursor = node.walk();
+            node.named_children(&mut cursor)
+                .find(|child| child.kind() == "fun_clause")
+                .and_then(|clause| clause.child_by_field_name("args"))
+        }
+        _ => None,
+    };
+    parameters.map_or(0, |parameters| {
+        let mut cursor = parameters.walk();
+        parameters
+            .named_children(&mut cursor)
+            .filter(|parameter| parameter.kind() != "comment")
+            .count()
+    })
+}
+
+/// Returns the name of the module an Erlang file declares with
+/// `-module(name).`
+pub(crate) fn erlang_module<'a>(node: &Node, source: &'a [u8]) -> Option<&'a str> {
+    let mut root = *node;
+    while let Some(parent) = root.parent() {
+        root = parent;
+    }
+    let mut cursor = root.walk();
+    root.named_children(&mut cursor)
+        .find(|form| form.kind() == "module_attribute")
+        .and_then(|attribute| attribute.child_by_field_name("name"))
+        .and_then(|name| name.utf8_text(source).ok())
+}
+
+/// Returns true if `node` is a `GenServer` callback: a function with the
+/// name and arity of one, defined in an Elixir module that uses `GenServer`
+/// (`use GenServer` or `@behaviour GenServer`) or in an Erlang module with
+/// `-behaviour(gen_server).`
+pub(crate) fn is_genserver_callback(
+    node: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> bool {
+    let Some(name) = function_name(node, source) else {
+        return false;
+    };
+    let is_callback = GENSERVER_CALLBACKS
+        .iter()
+        .any(|(callback, arity)| name == format!("{callback}/{arity}"));
+    if !is_callback {
+        return false;
+    }
+
+    match language {
+        SupportedLanguage::Elixir => {
+            // The body of the module: its `do_block`
+            let Some(module) = node.parent().filter(|body| body.kind() == "do_block") else {
+                return false;
+            };
+            let mut cursor = module.walk();
+            module.named_children(&mut cursor).any(|statement| {
+                let behaviour = match elixir_attribute(&statement, source) {
+                    Some(("behaviour", value)) => value,
+                    _ if elixir_call_name(&statement, source) == Some("use") => {
+                        first_argument(&statement)
+                    }
+                    _ => None,
+                };
+                behaviour
+                    .and_then(|behaviour| behaviour.utf8_text(source).ok())
+                    .is_some_and(|behaviour| behaviour == "GenServer")
+            })
+        }
+        SupportedLanguage::Erlang => {
+            let Some(root) = node.parent() else {
+                return false;
+            };
+            let mut cursor = root.walk();
+            root.named_children(&mut cursor).any(|form| {
+                form.kind() == "behaviour_attribute"
+                    && form
+                        .child_by_field_name("name")
+                        .and_then(|name| name.utf8_text(source).ok())
+                        .is_some_and(|name| name == "gen_server")
+            })
+        }
+        _ => false,
+    }
+}
+
+/// Returns the functions an Erlang file exports, as `name/arity`, from its
+/// `-export([...]).` attributes.
+pub(crate) fn erlang_exports(root: &Node, source: &[u8]) -> Vec<String> {
+    let mut cursor = root.walk();
+    root.named_children(&mut cursor)
+        .filter(|form| form.kind() == "export_attribute")
+        .filter_map(|form| form.utf8_text(source).ok())
+        .flat_map(|text| {
+            let list = text
+                .split_once('[')
+                .and_then(|(_, rest)| rest.rsplit_once(']'))
+                .map_or("", |(list, _)| list);
+            list.split(',')
+                .map(|entry| entry.split_whitespace().collect::<String>())
+                .filter(|entry| !entry.is_empty())
+                .collect::<Vec<_>>()
+        })
+        .collect()
+}
+
+/// Returns true if an Erlang file exports all of its functions with
+/// `-compile(export_all).`
+pub(crate) fn erlang_exports_all(root: &Node, source: &[u8]) -> bool {
+    let mut cursor = root.walk();
+    root.named_children(&mut cursor).any(|form| {
+        form.kind() == "compile_options_attribute"
+            && form
+                .utf8_text(source)
+                .is_ok_and(|text| text.contains("export_all"))
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::create_parser;
+
+    /// Returns the names of the Elixir function definitions in `source`.
+    fn elixir_functions(source: &str) -> Vec<(String, &'static str)> {
+        let mut parser = create_parser(&SupportedLanguage::Elixir).unwrap();
+        let tree = parser.parse(source, None).unwrap();
+        let mut found = Vec::new();
+        let mut stack = vec![tree.root_node()];
+        while let Some(node) = stack.pop() {
+            if let Some(kind) = elixir_definition(&node, source.as_bytes()) {
+                found.push((function_name(&node, source.as_bytes()).unwrap(), kind));
+            }
+            let mut cursor = node.walk();
+            let children: Vec<Node> = node.named_children(&mut cursor).collect();
+            stack.extend(children.into_iter().rev());
+        }
+        found
+    }
+
+    #[test]
+    fn test_elixir_definitions_with_arity() {
+        let source = r#"
+defmodule Shop.Cart do
+  def new, do: %{}
+  def add(cart, item, quantity \\ 1) when quantity > 0 do
+    Map.update(cart, item, quantity, &(&1 + quantity))
+  end
+  defp valid?(item), do: item != nil
+  defmacro debug(expression) do
+    quote do: IO.inspect(unquote(expression))
+  end
+end
+"#;
+        assert_eq!(
+            elixir_functions(source),
+            [
+                ("new/0".to_string(), "function"),
+                ("add/3".to_string(), "function"),
+                ("valid?/1".to_string(), "private_function"),
+                ("debug/1".to_string(), "macro"),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_erlang_exports() {
+        let source =
+            "-module(cart).\n-export([new/0, add/2]).\n-export([total/1]).\n\nnew() -> #{}.\n";
+        let mut parser = create_parser(&SupportedLanguage::Erlang).unwrap();
+        let tree = parser.parse(source, None).unwrap();
+        let root = tree.root_node();
+        assert_eq!(
+            erlang_exports(&root, source.as_bytes()),
+            ["new/0", "add/2", "total/1"]
+        );
+        assert!(!erlang_exports_all(&root, source.as_bytes()));
+        assert_eq!(erlang_module(&root, source.as_bytes()), Some("cart"));
+    }
+}
@@ -0,0 +1,268 @@
+//! On-disk cache of per-file analysis results.
+//!
+//! Results are keyed by a SHA-256 hash of the file content together with the
+//! language and grammar dialect it was parsed with, so renamed or moved files
+//! still hit the cache and edited files are always reparsed. The whole cache
+//! is discarded when it was written by a different analyzer build.
+
+use crate::error::{CodeStatsError, Result};
+use crate::language::{Dialect, SupportedLanguage};
+use crate::parser::CodeStats;
+use serde::{Deserialize, Serialize};
+use sha2::{Digest, Sha256};
+use std::collections::HashMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+use std::sync::atomic::{AtomicBool, Ordering};
+
+/// Default directory, relative to the working directory, holding the cache.
+pub(crate) const CACHE_DIR: &str = ".codestats-cache";
+
+/// Name of the cache file inside the cache directory.
+const CACHE_FILE: &str = "cache.json";
+
+/// Crate version plus the cache format revision.
+///
+/// Bump the `+cache.N` suffix when the layout of cached entries changes.
+const CACHE_VERSION: &str = concat!(env!("CARGO_PKG_VERSION"), "+cache.23");
+
+/// Identifies the analyzer build that produced cached results.
+///
+/// Extraction logic often changes without a crate version bump, so the
+/// modification time of the running executable is included as well; any
+/// rebuild invalidates the cache instead of serving stale statistics.
+fn analyzer_version() -> String {
+    let build = std::env::current_exe()
+        .and_then(fs::metadata)
+        .and_then(|metadata| metadata.modified())
+        .ok()
+        .and_then(|modified| modified.duration_since(std::time::UNIX_EPOCH).ok())
+        .map_or(0, |elapsed| elapsed.as_nanos());
+    format!("{CACHE_VERSION}+{build}")
+}
+
+/// Serialized form of the cache file.
+#[derive(Debug, Default, Serialize, Deserialize)]
+struct CacheFile {
+    analyzer_version: String,
+    entries: HashMap<String, CodeStats>,
+}
+
+/// Thread-safe cache of `CodeStats` keyed by content hash.
+///
+/// Lookups and inserts can be made concurrently from analysis workers; the
+/// cache is only written back to disk by an explicit call to `save`.
+#[derive(Debug)]
+pub(crate) struct AnalysisCache {
+    dir: PathBuf,
+    version: String,
+    entries: Mutex<HashMap<String, CodeStats>>,
+    dirty: AtomicBool,
+}
+
+impl AnalysisCache {
+    /// Loads the cache stored in `dir`.
+    ///
+    /// A missing, unreadable, or corrupt cache file, as well as one written by
+    /// another analyzer version, yields an empty cache rather than an error:
+    /// the cache only ever saves work, it never changes results.
+    pub(crate) fn load(dir: &Path) -> Self {
+        let version = analyzer_version();
+        let entries = fs::read_to_string(dir.join(CACHE_FILE))
+            .ok()
+            .and_then(|content| serde_json::from_str::<CacheFile>(&content).ok())
+            .filter(|file| file.analyzer_version == version)
+            .map(|file| file.entries)
+            .unwrap_or_default();
+
+        Self {
+            dir: dir.to_path_buf(),
+            version,
+            entries: Mutex::new(entries),
+            dirty: AtomicBool::new(false),
+        }
+    }
+
+    /// Removes the cache directory and everything in it, if it exists.
+    pub(crate) fn clear(dir: &Path) -> Result<()> {
+        match fs::remove_dir_all(dir) {
+            Ok(()) => Ok(()),
+            Err(e) if e.kind() == std::io::ErrorKind::NotFound => Ok(()),
+            Err(e) => Err(CodeStatsError::IoError(format!(
+                "Failed to clear cache {}: {e}",
+                dir.display()
+            ))),
+        }
+    }
+
+    /// Computes the cache key for a source file.
+    ///
+    /// The language and dialect are part of the key because the same content
+    /// yields different statistics under different grammars (e.g. `.ts` vs `.tsx`).
+    /// `queries` is the fingerprint of the custom query set (empty if none),
+    /// so that changing a query invalidates its cached counts.
+    pub(crate) fn key(
+        language: SupportedLanguage,
+        dialect: Dialect,
+        queries: &str,
+        source_code: &str,
+    ) -> String {
+        let mut hasher = Sha256::new();
+        hasher.update(format!("{language:?}/{dialect:?}/{queries}\0"));
+        hasher.update(source_code);
+        format!("{:x}", hasher.finalize())
+    }
+
+    /// Returns the cached statistics for `key`, if present.
+    pub(crate) fn get(&self, key: &str) -> Option<CodeStats> {
+        self.entries
+            .lock()
+            .unwrap_or_else(|e| e.into_inner())
+            .get(key)
+            .cloned()
+    }
+
+    /// Records the statistics for `key`.
+    pub(crate) fn insert(&self, key: String, stats: CodeStats) {
+        self.entries
+            .lock()
+            .unwrap_or_else(|e| e.into_inner())
+            .insert(key, stats);
+        self.dirty.store(true, Ordering::Relaxed);
+    }
+
+    /// Number of cached entries.
+    #[cfg(test)]
+    pub(crate) fn len(&self) -> usize {
+        self.entries.lock().unwrap_or_else(|e| e.into_inner()).len()
+    }
+
+    /// Writes the cache back to disk if anything was inserted since loading.
+    ///
+    /// The file is written to a temporary path and renamed into place, so a
+    /// concurrent run never observes a partially written cache.
+    pub(crate) fn save(&self) -> Result<()> {
+        if !self.dirty.load(Ordering::Relaxed) {
+            return Ok(());
+        }
+
+        let io_error = |e: std::io::Error| {
+            CodeStatsError::IoError(format!("Failed to write cache {}: {e}", self.dir.display()))
+        };
+
+        fs::create_dir_all(&self.dir).map_err(io_error)?;
+
+        let file = CacheFile {
+            analyzer_version: self.version.clone(),
+            entries: self
+                .entries
+                .lock()
+                .unwrap_or_else(|e| e.into_inner())
+                .clone(),
+        };
+        let content = serde_json::to_string(&file)
+            .map_err(|e| CodeStatsError::IoError(format!("Failed to serialize cache: {e}")))?;
+
+        let temp_path = self
+            .dir
+            .join(format!("{CACHE_FILE}.{}.tmp", std::process::id()));
+        fs::write(&temp_path, content).map_err(io_error)?;
+        fs::rename(&temp_path, self.dir.join(CACHE_FILE)).map_err(io_error)?;
+
+        self.dirty.store(false, Ordering::Relaxed);
+        Ok(())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    fn sample_stats() -> CodeStats {
+        let mut stats = CodeStats::new();
+        stats.function_count = 3;
+        stats.class_struct_count = 1;
+        stats.record_kind("function");
+        stats
+    }
+
+    #[test]
+    fn test_key_depends_on_content_dialect_and_queries() {
+        let rust = AnalysisCache::key(SupportedLanguage::Rust, Dialect::Standard, "", "fn a() {}");
+        let same = AnalysisCache::key(SupportedLanguage::Rust, Dialect::Standard, "", "fn a() {}");
+        let edited =
+            AnalysisCache::key(SupportedLanguage::Rust, Dialect::Standard, "", "fn b() {}");
+        let ts = AnalysisCache::key(SupportedLanguage::TypeScript, Dialect::Standard, "", "x");
+        let tsx = AnalysisCache::key(SupportedLanguage::TypeScript, Dialect::Tsx, "", "x");
+
+        assert_eq!(rust, same);
+        assert_ne!(rust, edited);
+        assert_ne!(ts, tsx);
+        assert_ne!(
+            rust,
+            AnalysisCache::key(SupportedLanguage::Rust, Dialect::Standard, "q", "fn a() {}")
+        );
+        assert_eq!(rust.len(), 64);
+    }
+
+    #[test]
+    fn test_save_and_load_roundtrip() {
+        let temp_dir = TempDir::new().unwrap();
+        let dir = temp_dir.path().join(CACHE_DIR);
+
+        let cache = AnalysisCache::load(&dir);
+        assert_eq!(cache.len(), 0);
+        cache.insert("abc".to_string(), sample_stats());
+        cache.save().unwrap();
+
+        let reloaded = AnalysisCache::load(&dir);
+        let stats = reloaded.get("abc").unwrap();
+        assert_eq!(stats.function_count, 3);
+        assert_eq!(stats.class_struct_count, 1);
+        assert_eq!(stats.kinds.get("function"), Some(&1));
+        assert!(reloaded.get("missing").is_none());
+    }
+
+    #[test]
+    fn test_save_without_changes_does_not_create_files() {
+        let temp_dir = TempDir::new().unwrap();
+        let dir = temp_dir.path().join(CACHE_DIR);
+
+        AnalysisCache::load(&dir).save().unwrap();
+        assert!(!dir.exists());
+    }
+
+    #[test]
+    fn test_version_mismatch_and_corruption_are_discarded() {
+        let temp_dir = TempDir::new().unwrap();
+        let dir = temp_dir.path();
+
+        let stale = CacheFile {
+            analyzer_version: "0.0.0".to_string(),
+            entries: HashMap::from([("abc".to_string(), sample_stats())]),
+        };
+        fs::write(dir.join(CACHE_FILE), serde_json::to_string(&stale).unwrap()).unwrap();
+        assert_eq!(AnalysisCache::load(dir).len(), 0);
+
+        fs::write(dir.join(CACHE_FILE), "not json").unwrap();
+        assert_eq!(AnalysisCache::load(dir).len(), 0);
+    }
+
+    #[test]
+    fn test_clear() {
+        let temp_dir = TempDir::new().unwrap();
+        let dir = temp_dir.path().join(CACHE_DIR);
+
+        let cache = AnalysisCache::load(&dir);
+        cache.insert("abc".to_string(), sample_stats());
+        cache.save().unwrap();
+        assert!(dir.exists());
+
+        AnalysisCache::clear(&dir).unwrap();
+        assert!(!dir.exists());
+        // Clearing a missing cache is not an error
+        AnalysisCache::clear(&dir).unwrap();
+    }
+}
@@ -0,0 +1,665 @@
+//! A best-effort call graph: which functions of a package call which.
+//!
+//! Each function records the names it calls, as they appear at the call
+//! site (`helper`, the `Greet` of `p.Greet()`). The graph matches them to
+//! the functions declared in the same package by name, without types, so a
+//! call to a method name links to every method of that name in the package.
+//! A package is a directory for Go and Java, whose packages span one, and
+//! the file otherwise.
+//!
+//! Functions that no other function or top-level statement calls are
+//! unreached, unless they are entry points: callable from outside the
+//! package by the language's visibility rules, or called by the runtime
+//! (`main`, constructors, tests, trait implementations, `__dunder__`
+//! methods). Functions that are only passed around as values look unreached
+//! too, so the list is a starting point for finding dead code, not a proof.
+
+use crate::comments::is_public;
+use crate::complexity::is_function;
+use crate::imports::slash_path;
+use crate::language::SupportedLanguage;
+use crate::signature::function_name;
+use crate::stats::DirectoryStats;
+use serde::Serialize;
+use std::collections::{BTreeSet, HashMap};
+use std::path::{Path, PathBuf};
+use tree_sitter::Node;
+
+/// Name given to functions without one, which can't be called by name.
+const ANONYMOUS: &str = "<anonymous>";
+
+/// Calls between the functions of the analyzed files.
+#[derive(Debug, Default, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct CallGraph {
+    /// Every function, ordered by package, then file and line
+    pub functions: Vec<CallNode>,
+    /// Calls between functions, as indices into `functions`, ordered by
+    /// caller, then callee
+    pub calls: Vec<Call>,
+}
+
+/// A function of the call graph.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct CallNode {
+    /// Package the function belongs to, relative to the analyzed root
+    pub package: String,
+    /// Qualified name of the function
+    pub name: String,
+    /// Path of the declaring file
+    pub path: PathBuf,
+    /// 1-based line where the function starts
+    pub line: usize,
+    /// True if code outside the package or the runtime can call it
+    pub entry_point: bool,
+    /// Number of other functions calling it, plus one if top-level code of
+    /// the package does
+    pub callers: usize,
+}
+
+/// An edge of the call graph: the function at `from` calls the one at `to`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize)]
+pub(crate) struct Call {
+    pub from: usize,
+    pub to: usize,
+}
+
+impl CallGraph {
+    /// Returns the unreached functions, in graph order.
+    pub(crate) fn unreached(&self) -> impl Iterator<Item = &CallNode> {
+        self.functions
+            .iter()
+            .filter(|function| function.is_unreached())
+    }
+}
+
+impl CallNode {
+    /// Returns true for a named function that no other code in its package
+    /// calls and that is not an entry point.
+    pub(crate) fn is_unreached(&self) -> bool {
+        self.callers == 0 && !self.entry_point && !is_anonymous(&self.name)
+    }
+}
+
+/// Lists the names a function calls, or the top-level code of a file when
+/// given the root node, in source order and without duplicates.
+///
+/// Calls inside nested functions and closures belong to those and are left
+/// out. Only the last segment of a callee is kept: `self.parse()`,
+/// `parser::parse()`, and `p.parse()` all call `parse`.
+///
+/// # Arguments
+///
+/// * `node` - A function node, or the root node of the tree
+/// * `source` - The source code the tree was parsed from
+/// * `language` - The programming language of the source code
+pub(crate) fn calls(node: &Node, source: &[u8], language: &SupportedLanguage) -> Vec<String> {
+    let mut names = Vec::new();
+    let mut cursor = node.walk();
+    for child in node.children(&mut cursor) {
+        collect_calls(&child, source, language, &mut names);
+    }
+    names
+}
+
+fn collect_calls(
+    node: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+    names: &mut Vec<String>,
+) {
+    if is_function(node, source, language) {
+        return;
+    }
+    if let Some(name) = callee(node)
+        .and_then(|callee| last_segment(&callee))
+        .and_then(|name| name.utf8_text(source).ok())
+        && !names.iter().any(|known| known == name)
+    {
+        names.push(name.to_string());
+    }
+    let mut cursor = node.walk();
+    for child in node.children(&mut cursor) {
+        collect_calls(&child, source, language, names);
+    }
+}
+
+/// Returns the expression naming the called function if `node` is a call.
+pub(crate) fn callee<'a>(node: &Node<'a>) -> Option<Node<'a>> {
+    match node.kind() {
+        // Rust, Go, JavaScript, C, and C++ name the callee `function`;
+        // Kotlin and Swift leave it as the first child
+        "call_expression" => node
+            .child_by_field_name("function")
+            .or_else(|| node.named_children(&mut node.walk()).next()),
+        // Python's call names the callee `function`, Ruby's the `method`
+        "call" => node
+            .child_by_field_name("function")
+            .or_else(|| node.child_by_field_name("method")),
+        "invocation_expression" | "function_call_expression" => {
+            node.child_by_field_name("function")
+        }
+        "method_invocation"
+        | "member_call_expression"
+        | "nullsafe_member_call_expression"
+        | "scoped_call_expression"
+        | "command" => node.child_by_field_name("name"),
+        _ => None,
+    }
+}
+
+/// Reduces a callee expression to the identifier of the called name:
+/// the field of a member access, the last segment of a path, the function
+/// of a generic instantiation.
+pub(crate) fn last_segment<'a>(node: &Node<'a>) -> Option<Node<'a>> {
+    let kind = node.kind();
+    if kind.ends_with("identifier") || matches!(kind, "name" | "command_name" | "constant") {
+        return Some(*node);
+    }
+    for field in [
+        "field",
+        "property",
+        "attribute",
+        "name",
+        "suffix",
+        "function",
+    ] {
+        if let Some(child) = node.child_by_field_name(field) {
+            return last_segment(&child);
+        }
+    }
+    // Kotlin's member access has no fields but ends in the name
+    if !kind.starts_with("navigation_") {
+        return None;
+    }
+    let mut cursor = node.walk();
+    let last = node.named_children(&mut cursor).last()?;
+    last_segment(&last)
+}
+
+/// Returns true if code outside the file (or the Go or Java package) or the
+/// runtime can call the function declared by `node`.
+///
+/// # Arguments
+///
+/// * `node` - A function node
+/// * `source` - The source code the tree was parsed from
+/// * `language` - The programming language of the source code
+pub(crate) fn is_entry_point(node: &Node, source: &[u8], language: &SupportedLanguage) -> bool {
+    let name = function_name(node, source);
+    // Python's `__dunder__` methods and PHP's `__construct` and other magic
+    // methods are called by the runtime
+    let runtime = name == "main"
+        || (name.len() > 4 && name.starts_with("__") && name.ends_with("__"))
+        || (*language == SupportedLanguage::Php && name.starts_with("__"))
+        || matches!(
+            node.kind(),
+            "constructor_declaration"
+                | "compact_constructor_declaration"
+                | "secondary_constructor"
+                | "init_declaration"
+                | "deinit_declaration"
+                | "destructor_declaration"
+        );
+    runtime || visible_outside(node, source, language, &name)
+}
+
+/// Applies each language's visibility rules to a function node.
+fn visible_outside(node: &Node, source: &[u8], language: &SupportedLanguage, name: &str) -> bool {
+    let words = modifier_words(node, source);
+    let has = |word: &str| words.iter().any(|modifier| modifier == word);
+    match language {
+        SupportedLanguage::Go => {
+            name == "init" || name.chars().next().is_some_and(char::is_uppercase)
+        }
+        // Any `pub`, including `pub(crate)`, makes the function callable
+        // from other files; trait methods are called through the trait, and
+        // tests by the harness
+        SupportedLanguage::Rust => {
+            let mut cursor = node.walk();
+            node.children(&mut cursor)
+                .any(|child| child.kind() == "visibility_modifier")
+                || node
+                    .parent()
+                    .and_then(|list| list.parent())
+                    .is_some_and(|owner| {
+                        owner.kind() == "trait_item"
+                            || (owner.kind() == "impl_item"
+                                && owner.child_by_field_name("trait").is_some())
+                    })
+                || has_test_attribute(node, source)
+        }
+        SupportedLanguage::Python => {
+            !name.starts_with('_') && !has_ancestor(node, |kind| kind == "function_definition")
+        }
+        // Exported declarations and class or object methods, which callers
+        // reach through an instance
+        SupportedLanguage::JavaScript | SupportedLanguage::TypeScript => {
+            (node.kind() == "method_definition" && !name.starts_with('#'))
+                || node.parent().is_some_and(|parent| parent.kind() == "pair")
+                || has_ancestor(node, |kind| kind == "export_statement")
+        }
+        SupportedLanguage::Java | SupportedLanguage::Php => !has("private"),
+        SupportedLanguage::Kotlin | SupportedLanguage::Swift => {
+            !has("private") && !has("fileprivate")
+        }
+        // Members without an access modifier are private
+        SupportedLanguage::CSharp => has("public") || has("internal") || has("protected"),
+        // Functions without internal linkage are visible to other files
+        SupportedLanguage::C | SupportedLanguage::Cpp => {
+            !has("static") && node.kind() != "lambda_expression"
+        }
+        SupportedLanguage::Ruby => is_public(node, source, language),
+        // Shell functions are visible to whoever sources the script, and
+        // the other languages have no calls to go by
+        _ => true,
+    }
+}
+
+/// Collects the words of a declaration's modifiers (`private`, `static`,
+/// `public`), whichever node kinds the grammar wraps them in.
+fn modifier_words(node: &Node, source: &[u8]) -> Vec<String> {
+    let mut cursor = node.walk();
+    node.children(&mut cursor)
+        .filter(|child| {
+            matches!(
+                child.kind(),
+                "modifiers" | "modifier" | "visibility_modifier" | "storage_class_specifier"
+            )
+        })
+        .filter_map(|child| child.utf8_text(source).ok())
+        .flat_map(|text| {
+            text.split_whitespace()
+                .map(str::to_string)
+                .collect::<Vec<_>>()
+        })
+        .collect()
+}
+
+/// Returns true if a Rust item carries a `#[test]`-like attribute, such as
+/// `#[test]` or `#[tokio::test]`.
+fn has_test_attribute(node: &Node, source: &[u8]) -> bool {
+    let mut sibling = node.prev_named_sibling();
+    while let Some(attribute) = sibling.filter(|s| s.kind() == "attribute_item") {
+        if attribute
+            .utf8_text(source)
+            .is_ok_and(|text| text.trim_end_matches(']').ends_with("test"))
+        {
+            return true;
+        }
+        sibling = attribute.prev_named_sibling();
+    }
+    false
+}
+
+fn has_ancestor(node: &Node, matches: impl Fn(&str) -> bool) -> bool {
+    let mut current = node.parent();
+    while let Some(parent) = current {
+        if matches(parent.kind()) {
+            return true;
+        }
+        current = parent.parent();
+    }
+    false
+}
+
+/// Returns true for the qualified name of a function without a name of its
+/// own, such as `sum.<anonymous>`.
+fn is_anonymous(name: &str) -> bool {
+    name.is_empty() || name.ends_with(ANONYMOUS)
+}
+
+/// Builds the call graph of the files counted in the code totals.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics of the files below `root`, with their functions
+/// * `root` - The analyzed directory, which package names are relative to
+pub(crate) fn call_graph(stats: &DirectoryStats, root: &Path) -> CallGraph {
+    // Each function with its declared name and the names it calls
+    let mut declared: Vec<(CallNode, &str, &[String])> = Vec::new();
+    let mut top_level: Vec<(String, &[String])> = Vec::new();
+    for file in stats.code_file_stats() {
+        let relative = slash_path(file.path.strip_prefix(root).unwrap_or(&file.path));
+        let package = package_of(&relative, file.language);
+        for function in &file.stats.functions {
+            let name = if function.qualified_name.is_empty() {
+                &function.name
+            } else {
+                &function.qualified_name
+            };
+            let node = CallNode {
+                package: package.clone(),
+                name: name.clone(),
+                path: file.path.clone(),
+                line: function.start_line,
+                entry_point: function.entry_point || file.stats.test_file,
+                callers: 0,
+            };
+            declared.push((node, &function.name, &function.calls));
+        }
+        if !file.stats.calls.is_empty() {
+            top_level.push((package, &file.stats.calls));
+        }
+    }
+    declared.sort_by(|(a, ..), (b, ..)| {
+        (&a.package, &a.path, a.line).cmp(&(&b.package, &b.path, b.line))
+    });
+
+    let mut by_name: HashMap<(&str, &str), Vec<usize>> = HashMap::new();
+    for (index, (node, name, _)) in declared.iter().enumerate() {
+        by_name
+            .entry((node.package.as_str(), name))
+            .or_default()
+            .push(index);
+    }
+    let callees = |package: &str, names: &[String]| -> BTreeSet<usize> {
+        names
+            .iter()
+            .filter_map(|name| by_name.get(&(package, name.as_str())))
+            .flatten()
+            .copied()
+            .collect()
+    };
+
+    let mut calls = BTreeSet::new();
+    for (from, (node, _, names)) in declared.iter().enumerate() {
+        for to in callees(&node.package, names) {
+            // Recursion doesn't make a function reachable
+            if to != from {
+                calls.insert(Call { from, to });
+            }
+        }
+    }
+    let mut callers = vec![0; declared.len()];
+    for call in &calls {
+        callers[call.to] += 1;
+    }
+    let reached_from_top: BTreeSet<usize> = top_level
+        .iter()
+        .flat_map(|(package, names)| callees(package, names))
+        .collect();
+    for index in reached_from_top {
+        callers[index] += 1;
+    }
+
+    CallGraph {
+        functions: declared
+            .into_iter()
+            .zip(callers)
+            .map(|((node, ..), callers)| CallNode { callers, ..node })
+            .collect(),
+        calls: calls.into_iter().collect(),
+    }
+}
+
+/// Name of the package a file belongs to: its directory for Go and Java,
+/// and its own path otherwise.
+fn package_of(relative: &str, language: SupportedLanguage) -> String {
+    if matches!(language, SupportedLanguage::Go | SupportedLanguage::Java) {
+        return match relative.rsplit_once('/') {
+            Some((directory, _)) => directory.to_string(),
+            None => ".".to_string(),
+        };
+    }
+    relative.to_string()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::{FunctionStats, create_parser};
+    use crate::stats::FileStats;
+    use crate::stats::test_support::file_with;
+
+    fn parsed_functions(language: SupportedLanguage, source: &str) -> Vec<(String, bool)> {
+        let tree = create_parser(&language)
+            .unwrap()
+            .parse(source, None)
+            .unwrap();
+        let mut found = Vec::new();
+        let mut stack = vec![tree.root_node()];
+        while let Some(node) = stack.pop() {
+            if is_function(&node, source.as_bytes(), &language) {
+                found.push((
+                    function_name(&node, source.as_bytes()),
+                    is_entry_point(&node, source.as_bytes(), &language),
+                ));
+            }
+            let mut cursor = node.walk();
+            let children: Vec<Node> = node.children(&mut cursor).collect();
+            stack.extend(children.into_iter().rev());
+        }
+        found
+    }
+
+    fn function(name: &str, line: usize, calls: &[&str], entry_point: bool) -> FunctionStats {
+        FunctionStats {
+            name: name.rsplit('.').next().unwrap().to_string(),
+            qualified_name: name.to_string(),
+            start_line: line,
+            end_line: line + 2,
+            calls: calls.iter().map(|name| name.to_string()).collect(),
+            entry_point,
+            ..Default::default()
+        }
+    }
+
+    fn file(path: &str, language: SupportedLanguage, functions: Vec<FunctionStats>) -> FileStats {
+        FileStats {
+            path: PathBuf::from("proj").join(path),
+            language,
+            ..file_with(path, 0, functions)
+        }
+    }
+
+    #[test]
+    fn test_calls_skip_nested_functions() {
+        let language = SupportedLanguage::Rust;
+        let source = "fn run(cli: &Cli) {\n\
+                      \x20   let parsed = parser::parse(cli);\n\
+                      \x20   cli.render(parsed);\n\
+                      \x20   Self::render(parsed);\n\
+                      \x20   fn inner() { hidden(); }\n\
+                      \x20   println!(\"{}\", format(parsed));\n\
+                      }\n\
+                      setup();\n";
+        let tree = create_parser(&language)
+            .unwrap()
+            .parse(source, None)
+            .unwrap();
+        let root = tree.root_node();
+        let run = root.named_children(&mut root.walk()).next().unwrap();
+        assert_eq!(
+            calls(&run, source.as_bytes(), &language),
+            ["parse", "render"]
+        );
+    }
+
+    #[test]
+    fn test_calls_member_access() {
+        let language = SupportedLanguage::Python;
+        let source = "def main():\n    config = load()\n    app.run(config)\n    print(len(config))\n\nmain()\n";
+        let tree = create_parser(&language)
+            .unwrap()
+            .parse(source, None)
+            .unwrap();
+        let root = tree.root_node();
+        let main = root.named_children(&mut root.walk()).next().unwrap();
+        assert_eq!(
+            calls(&main, source.as_bytes(), &language),
+            ["load", "run", "print", "len"]
+        );
+        // Top-level code calls `main`, but not what `main` calls
+        assert_eq!(calls(&root, source.as_bytes(), &language), ["main"]);
+    }
+
+    #[test]
+    fn test_entry_points() {
+        let rust = parsed_functions(
+            SupportedLanguage::Rust,
+            "pub fn api() {}\n\
+             pub(crate) fn shared() {}\n\
+             fn helper() {}\n\
+             fn main() {}\n\
+             impl std::fmt::Display for Cart { fn fmt(&self) {} }\n\
+             impl Cart { fn total(&self) {} }\n\
+             #[test]\n\
+             fn test_total() {}\n",
+        );
+        assert_eq!(
+            rust,
+            [
+                ("api".to_string(), true),
+                ("shared".to_string(), true),
+                ("helper".to_string(), false),
+                ("main".to_string(), true),
+                ("fmt".to_string(), true),
+                ("total".to_string(), false),
+                ("test_total".to_string(), true),
+            ]
+        );
+
+        let go = parsed_functions(
+            SupportedLanguage::Go,
+            "package cart\n\nfunc Total() {}\nfunc round() {}\nfunc init() {}\n",
+        );
+        assert_eq!(
+            go,
+            [
+                ("Total".to_string(), true),
+                ("round".to_string(), false),
+                ("init".to_string(), true),
+            ]
+        );
+
+        let python = parsed_functions(
+            SupportedLanguage::Python,
+            "class Cart:\n    def __init__(self): pass\n    def _round(self): pass\n\ndef total():\n    def step(): pass\n",
+        );
+        assert_eq!(
+            python,
+            [
+                ("__init__".to_string(), true),
+                ("_round".to_string(), false),
+                ("total".to_string(), true),
+                ("step".to_string(), false),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_call_graph_edges_and_unreached() {
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file(
+            "src/cart.rs",
+            SupportedLanguage::Rust,
+            vec![
+                function("Cart::total", 1, &["round", "total"], true),
+                function("round", 5, &[], false),
+                function("unused", 9, &["round"], false),
+                function("<anonymous>", 12, &[], false),
+            ],
+        ));
+        // Same name in another file is a different package
+        stats.add_file(file(
+            "src/tax.rs",
+            SupportedLanguage::Rust,
+            vec![function("round", 1, &[], false)],
+        ));
+        let mut script = file(
+            "bin/run.py",
+            SupportedLanguage::Python,
+            vec![function("_main", 1, &[], false)],
+        );
+        script.stats.calls = vec!["_main".to_string()];
+        stats.add_file(script);
+
+        let graph = call_graph(&stats, Path::new("proj"));
+        let names: Vec<(&str, &str)> = graph
+            .functions
+            .iter()
+            .map(|function| (function.package.as_str(), function.name.as_str()))
+            .collect();
+        assert_eq!(
+            names,
+            [
+                ("bin/run.py", "_main"),
+                ("src/cart.rs", "Cart::total"),
+                ("src/cart.rs", "round"),
+                ("src/cart.rs", "unused"),
+                ("src/cart.rs", "<anonymous>"),
+                ("src/tax.rs", "round"),
+            ]
+        );
+        // The recursive call is dropped
+        assert_eq!(
+            graph.calls,
+            [Call { from: 1, to: 2 }, Call { from: 3, to: 2 }]
+        );
+        assert_eq!(graph.functions[2].callers, 2);
+        assert_eq!(graph.functions[0].callers, 1);
+
+        let unreached: Vec<&str> = graph
+            .unreached()
+            .map(|function| function.name.as_str())
+            .collect();
+        assert_eq!(unreached, ["unused", "round"]);
+        assert_eq!(graph.unreached().last().unwrap().package, "src/tax.rs");
+    }
+
+    #[test]
+    fn test_call_graph_go_packages() {
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file(
+            "cart/cart.go",
+            SupportedLanguage::Go,
+            vec![function("Cart.Total", 3, &["round"], true)],
+        ));
+        stats.add_file(file(
+            "cart/round.go",
+            SupportedLanguage::Go,
+            vec![function("round", 3, &[], false)],
+        ));
+        let mut test = file(
+            "cart/cart_test.go",
+            SupportedLanguage::Go,
+            vec![function("helper", 3, &[], false)],
+        );
+        test.stats.test_file = true;
+        stats.add_file(test);
+        stats.add_file(file(
+            "main.go",
+            SupportedLanguage::Go,
+            vec![function("round", 3, &[], false)],
+        ));
+
+        let graph = call_graph(&stats, Path::new("proj"));
+        assert_eq!(graph.functions[0].package, ".");
+        assert!(
+            graph.functions[1..]
+                .iter()
+                .all(|function| function.package == "cart")
+        );
+        assert_eq!(graph.calls.len(), 1);
+        // Test files are entry points; the root package's `round` is not
+        // the one `Cart.Total` calls
+        let unreached: Vec<&Path> = graph
+            .unreached()
+            .map(|function| function.path.as_path())
+            .collect();
+        assert_eq!(unreached, [Path::new("proj/main.go")]);
+    }
+
+    #[test]
+    fn test_package_of() {
+        assert_eq!(
+            package_of("pkg/cart/cart.go", SupportedLanguage::Go),
+            "pkg/cart"
+        );
+        assert_eq!(package_of("Main.java", SupportedLanguage::Java), ".");
+        assert_eq!(
+            package_of("src/cart.ts", SupportedLanguage::TypeScript),
+            "src/cart.ts"
+        );
+    }
+}
@@ -1,188 +1,3032 @@
 //! Command-line interface definitions and argument handling.
 
-use clap::{Parser, ValueEnum};
-use std::path::PathBuf;
+use crate::analyzer::{CodeAnalyzer, DirectoryOptions};
+use crate::baseline::BASELINE_FILE;
+use crate::config::{Config, OnMismatch};
+use crate::duplicates::DEFAULT_MIN_TOKENS;
+use crate::history::Date;
+use crate::language::SupportedLanguage;
+use crate::profile::Profiler;
+use crate::remote::{analyze_remote, is_git_url, is_remote};
+use crate::stats::{DirectoryStats, FileStats, Thresholds};
+use clap::{ArgGroup, Args, Parser, Subcommand, ValueEnum};
+use serde::Deserialize;
+use std::path::{Path, PathBuf};
+use std::str::FromStr;
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+
+/// Flags selecting what `Cli::run` reports instead of the statistics
+/// summary.
+const MODES: [&str; 22] = [
+    "functions",
+    "proto_inventory",
+    "api_surface",
+    "implementations",
+    "graphql_schema",
+    "deps",
+    "call_graph",
+    "unreached",
+    "todos",
+    "tokens",
+    "distribution",
+    "group_by",
+    "diff",
+    "emit_tags",
+    "duplicates",
+    "strings",
+    "identifiers",
+    "licenses",
+    "require_header",
+    "lint",
+    "by_author",
+    "output",
+];
+
+/// Modes that analyze on their own rather than render the directory
+/// statistics, checked before `--watch` and stdin input.
+const REPORT_MODES: [&str; 10] = [
+    "diff",
+    "emit_tags",
+    "duplicates",
+    "strings",
+    "identifiers",
+    "licenses",
+    "require_header",
+    "lint",
+    "by_author",
+    "output",
+];
 
 /// Command-line arguments for the code statistics analyzer.
 ///
 /// This struct defines all available command-line options and their behavior.
+/// Traversal and cache options are global so they also apply to subcommands.
+/// Options that a `.codestats.toml` file can also set are optional here, so
+/// that a flag given on the command line overrides the file.
+///
+/// `Cli::run` runs the first mode it finds among the flags of `MODES`, so at
+/// most one of them may be given; a new mode only has to be added there.
+/// Those of `REPORT_MODES` replace the statistics report altogether and
+/// can't be combined with `--watch` or `--lang`.
 #[derive(Parser, Debug)]
 #[command(name = "code-stats-rs")]
 #[command(about = "Analyze code statistics for functions and classes", long_about = None)]
+#[command(subcommand_negates_reqs = true, args_conflicts_with_subcommands = true)]
+#[command(group(ArgGroup::new("mode").args(MODES)))]
+#[command(group(ArgGroup::new("report").multiple(true).args(REPORT_MODES)))]
 pub struct Cli {
-    /// Path to analyze (file or directory)
-    pub path: PathBuf,
+    /// Path to analyze (file, directory, .zip/.tar/.tar.gz archive, git URL,
+    /// or - to read source from stdin)
+    #[arg(required = true)]
+    pub path: Option<PathBuf>,
+
+    /// Baseline, CI gate, and ranking subcommands; without one, `path` is analyzed
+    #[command(subcommand)]
+    pub command: Option<Command>,
+
+    /// Output format [default: summary]
+    #[arg(short, long, value_enum)]
+    pub format: Option<OutputFormat>,
+
+    /// What a row of --format csv describes
+    #[arg(long, value_enum, value_name = "LEVEL", default_value_t = Level::File)]
+    pub level: Level,
+
+    /// Show detailed statistics for each file
+    #[arg(short, long)]
+    pub detail: bool,
+
+    /// File patterns to ignore (can be used multiple times)
+    #[arg(long, value_name = "PATTERN", global = true)]
+    pub ignore: Vec<String>,
+
+    /// Only analyze files matching a gitignore-style pattern (can be used
+    /// multiple times)
+    #[arg(long, value_name = "PATTERN", global = true)]
+    pub include: Vec<String>,
+
+    /// Skip files matching a gitignore-style pattern, `!PATTERN` to
+    /// re-include (can be used multiple times)
+    #[arg(long, value_name = "PATTERN", global = true)]
+    pub exclude: Vec<String>,
+
+    /// Use LANG for files with extension or name EXT instead of detecting it
+    /// (e.g. h=cpp; repeatable or comma-separated)
+    #[arg(long, value_name = "EXT=LANG", value_delimiter = ',', global = true)]
+    pub lang_map: Vec<String>,
+
+    /// Load every tree-sitter grammar (.so, .dylib, .dll) in DIR, analyzing
+    /// files with the grammar's name as extension
+    #[arg(long, value_name = "DIR", global = true)]
+    pub grammar_dir: Option<PathBuf>,
+
+    /// Follow symbolic links to directories (files reachable through
+    /// several paths are still counted once)
+    #[arg(long, global = true)]
+    pub follow_links: bool,
+
+    /// Skip symbolic links, including links to files
+    #[arg(long, global = true, conflicts_with = "follow_links")]
+    pub skip_links: bool,
+
+    /// Maximum depth for directory traversal
+    #[arg(long, default_value_t = 100, global = true)]
+    pub max_depth: usize,
+
+    /// Analyze files even if they are excluded by .gitignore or .ignore files
+    #[arg(long, global = true)]
+    pub no_gitignore: bool,
+
+    /// Count generated files and vendored directories (vendor/, node_modules/,
+    /// third_party/) in the totals instead of reporting them separately
+    #[arg(long, global = true)]
+    pub include_generated: bool,
+
+    /// Number of files to analyze in parallel (0 = one per CPU)
+    #[arg(short, long, value_name = "N", default_value_t = 0, global = true)]
+    pub jobs: usize,
+
+    /// Flag functions whose cyclomatic complexity exceeds this value [default: 10]
+    #[arg(long, value_name = "N")]
+    pub complexity_threshold: Option<usize>,
+
+    /// Flag functions spanning more lines than this value [default: 100]
+    #[arg(long, value_name = "N")]
+    pub max_function_lines: Option<usize>,
+
+    /// Reparse every file instead of reusing results from .codestats-cache/
+    #[arg(long, global = true)]
+    pub no_cache: bool,
+
+    /// Delete .codestats-cache/ before analyzing
+    #[arg(long, global = true)]
+    pub clear_cache: bool,
+
+    /// TOML file declaring custom tree-sitter queries to count per file
+    #[arg(long, value_name = "FILE", global = true)]
+    pub queries: Option<PathBuf>,
+
+    /// Project configuration file to use instead of the closest .codestats.toml
+    #[arg(long, value_name = "FILE", global = true)]
+    pub config: Option<PathBuf>,
+
+    /// Ignore .codestats.toml files
+    #[arg(long, global = true, conflicts_with = "config")]
+    pub no_config: bool,
+
+    /// List every function with its location, length, and parameter count
+    #[arg(long)]
+    pub functions: bool,
+
+    /// Column to sort the --functions listing by
+    #[arg(
+        long,
+        value_enum,
+        value_name = "COLUMN",
+        default_value_t = FunctionSort::Location,
+        requires = "functions"
+    )]
+    pub sort: FunctionSort,
+
+    /// List every Protobuf service with its RPC methods and message types
+    #[arg(long)]
+    pub proto_inventory: bool,
+
+    /// List the exported types, functions, methods, and constants of every Go package
+    #[arg(long)]
+    pub api_surface: bool,
+
+    /// List interfaces, traits, and protocols with the types implementing them
+    #[arg(long)]
+    pub implementations: bool,
+
+    /// List every GraphQL type with its fields, merging the files that define
+    /// and extend it
+    #[arg(long)]
+    pub graphql_schema: bool,
+
+    /// Print the module dependency graph built from imports (--format dot or json to export it)
+    #[arg(long)]
+    pub deps: bool,
+
+    /// Print which functions of each package call which (--format dot or json to export it)
+    #[arg(long)]
+    pub call_graph: bool,
+
+    /// List functions that nothing in their package calls and that are not
+    /// entry points, as candidates for dead code
+    #[arg(long)]
+    pub unreached: bool,
+
+    /// List TODO, FIXME, HACK, and XXX comments with their location
+    #[arg(long)]
+    pub todos: bool,
+
+    /// Add the author and age of each --todos comment from git blame
+    #[arg(long, requires = "todos")]
+    pub blame: bool,
+
+    /// Comment markers to look for instead of TODO, FIXME, HACK, and XXX
+    /// (comma-separated)
+    #[arg(long, value_name = "MARKERS", value_delimiter = ',', global = true)]
+    pub todo_markers: Vec<String>,
+
+    /// Only count the lines of files larger than this many MiB instead of
+    /// parsing them [default: 64]
+    #[arg(long, value_name = "MIB", global = true)]
+    pub max_parse_size: Option<u64>,
+
+    /// Give up parsing a file after this many seconds and list it as timed
+    /// out; 0 disables the limit [default: 30]
+    #[arg(long, value_name = "SECS", global = true)]
+    pub parse_timeout: Option<u64>,
+
+    /// Expand tabs to N columns in reported locations instead of the
+    /// tab_width from .editorconfig [default: 8]
+    #[arg(long, value_name = "N", global = true)]
+    pub tab_width: Option<usize>,
+
+    /// Also analyze the Lua embedded in nginx configurations and in the long
+    /// strings of YAML and TOML keys naming Lua
+    #[arg(long, global = true)]
+    pub embedded_lua: bool,
+
+    /// Also analyze the Ruby of ERB template tags as Ruby
+    #[arg(long, global = true)]
+    pub template_code: bool,
+
+    /// Run the [[plugin]] commands of the configuration file on every parsed
+    /// file and report the metrics they return
+    #[arg(long, global = true)]
+    pub plugins: bool,
+
+    /// Print parse and query times, bytes read, and peak memory per language
+    /// and the N slowest files to stderr after the run [default: 10]
+    #[arg(
+        long,
+        value_name = "N",
+        num_args = 0..=1,
+        default_missing_value = "10",
+        global = true
+    )]
+    pub profile: Option<usize>,
+
+    /// List syntax tree and estimated LLM token counts per file and directory
+    #[arg(long)]
+    pub tokens: bool,
+
+    /// With --tokens, list which files fit in a context budget of N
+    /// estimated LLM tokens, smallest first
+    #[arg(long, value_name = "N", requires = "tokens")]
+    pub fit_budget: Option<usize>,
+
+    /// Report percentiles and a histogram of file lines of code and
+    /// function lengths
+    #[arg(long)]
+    pub distribution: bool,
+
+    /// Aggregate statistics per directory (as a tree) or per type
+    #[arg(long, value_enum, value_name = "UNIT")]
+    pub group_by: Option<GroupBy>,
+
+    /// Show at most N directory levels below the root in the --group-by tree
+    #[arg(long, value_name = "N", requires = "group_by")]
+    pub depth: Option<usize>,
+
+    /// Merge the parts of C# partial types split across files in --group-by type
+    #[arg(long, requires = "group_by")]
+    pub merge_partial: bool,
+
+    /// Flag types with more fields and methods than N as god objects in
+    /// --group-by type [default: 30]
+    #[arg(long, value_name = "N", requires = "group_by")]
+    pub max_type_members: Option<usize>,
+
+    /// Keep running and re-analyze files as they change (directories only)
+    #[arg(short, long, conflicts_with = "report")]
+    pub watch: bool,
+
+    /// Only analyze files changed since this git ref and report touched functions
+    #[arg(long, value_name = "REF")]
+    pub diff: Option<String>,
+
+    /// Write a universal-ctags compatible tags file instead of statistics
+    /// (defaults to ./tags; "-" writes to stdout)
+    #[arg(long, value_name = "FILE", num_args = 0..=1, default_missing_value = "tags")]
+    pub emit_tags: Option<PathBuf>,
+
+    /// Report structurally identical functions and blocks instead of statistics
+    #[arg(long)]
+    pub duplicates: bool,
+
+    /// Smallest function or block, in tokens, reported by --duplicates
+    #[arg(
+        long,
+        value_name = "N",
+        default_value_t = DEFAULT_MIN_TOKENS,
+        requires = "duplicates"
+    )]
+    pub min_clone_tokens: usize,
+
+    /// List user-facing string literals, such as messages and labels, for
+    /// translation audits (tuned in the [strings] configuration table)
+    #[arg(long)]
+    pub strings: bool,
+
+    /// Report identifier lengths, the longest identifiers, and single-letter
+    /// variables outside loops
+    #[arg(long)]
+    pub identifiers: bool,
+
+    /// List the license of each file's header comment per license, and the
+    /// files without a header
+    #[arg(long)]
+    pub licenses: bool,
+
+    /// Like --licenses, but fail if a code file has no license header
+    #[arg(long)]
+    pub require_header: bool,
+
+    /// Check the [[rule]] queries of the configuration file and report their
+    /// findings; fails if a rule of severity "error" matches
+    #[arg(long)]
+    pub lint: bool,
+
+    /// Attribute lines, functions, and complexity to their authors with git
+    /// blame, ranking the authors by complexity
+    #[arg(long)]
+    pub by_author: bool,
+
+    /// With --by-author, group files by their owners in the repository's
+    /// CODEOWNERS file instead of by git blame
+    #[arg(long, requires = "by_author")]
+    pub codeowners: bool,
+
+    /// Append a snapshot of the per-file and per-function metrics to a
+    /// database instead of printing statistics (sqlite:FILE)
+    #[arg(long, value_name = "TARGET")]
+    pub output: Option<OutputTarget>,
+
+    /// Analyze source read from stdin as LANG; requires `-` as the path
+    #[arg(
+        long,
+        value_name = "LANG",
+        conflicts_with_all = ["watch", "group_by", "report"]
+    )]
+    pub lang: Option<String>,
+
+    /// Branch, tag, or commit to analyze when the path is a git URL
+    /// (defaults to the remote's default branch)
+    #[arg(
+        long = "ref",
+        value_name = "REF",
+        conflicts_with_all = ["watch", "diff", "by_author", "lang"]
+    )]
+    pub git_ref: Option<String>,
+
+    /// Settings loaded from the project configuration file, if any
+    #[arg(skip)]
+    project_config: Config,
+}
+
+/// Path recorded for source read from stdin.
+const STDIN_NAME: &str = "<stdin>";
+
+/// Path recorded for the source of the `snippet` subcommand.
+const SNIPPET_NAME: &str = "<snippet>";
+
+/// Analyzes source code that is not in a file, as the language named by
+/// `--lang`.
+///
+/// # Arguments
+///
+/// * `analyzer` - The analyzer to parse with
+/// * `name` - Path recorded in the statistics, e.g. `<stdin>`
+/// * `language` - Language name as accepted by `--lang-map`
+/// * `source` - The source code
+fn analyze_snippet(
+    analyzer: &mut CodeAnalyzer,
+    name: &str,
+    language: &str,
+    source: &str,
+) -> Result<FileStats, String> {
+    let language = SupportedLanguage::from_name(language)
+        .ok_or_else(|| format!("unknown language '{language}' for --lang"))?;
+    analyzer
+        .analyze_text(Path::new(name), language, source)
+        .map_err(|e| e.to_string())
+}
+
+/// Installs a Ctrl-C handler for directory analysis and returns the flag
+/// it sets.
+///
+/// The first Ctrl-C only sets the flag, so the analysis stops and prints a
+/// report of the files analyzed so far, marked incomplete; a second one
+/// exits at once. Without a handler, Ctrl-C keeps its default behavior.
+fn interrupt_flag() -> Arc<AtomicBool> {
+    let interrupted = Arc::new(AtomicBool::new(false));
+    let flag = Arc::clone(&interrupted);
+    let installed = ctrlc::set_handler(move || {
+        if flag.swap(true, Ordering::Relaxed) {
+            std::process::exit(130);
+        }
+        eprintln!("Interrupted: reporting the files analyzed so far (Ctrl-C again to quit)");
+    });
+    if let Err(e) = installed {
+        eprintln!("Warning: {e}");
+    }
+    interrupted
+}
+
+impl Cli {
+    /// Executes the code analysis based on CLI arguments.
+    ///
+    /// This method implements the main execution flow:
+    /// 1. Loads the project configuration (`--config`, or the closest
+    ///    `.codestats.toml` at or above the analyzed path) and fills in every
+    ///    option not given on the command line from it
+    /// 2. Creates a new analyzer instance, backed by the on-disk result cache
+    ///    in `.codestats-cache/` unless `--no-cache` is given
+    /// 3. Determines whether the path is a file, a directory, or `-` for
+    ///    source read from stdin
+    /// 4. Runs the appropriate analysis
+    /// 5. Formats and displays the results based on the selected output format
+    /// 6. Writes newly analyzed files back to the cache
+    ///
+    /// With `--watch`, steps 4-6 repeat for every batch of filesystem changes
+    /// until the process is interrupted; only changed files are reparsed.
+    /// Otherwise, directory analysis stops at the first Ctrl-C, prints the
+    /// report of the files analyzed so far marked incomplete, and fails.
+    /// The `baseline write` and `check` subcommands replace steps 3-5 with
+    /// writing or comparing against a baseline file, and `top` with printing
+    /// a ranking.
+    ///
+    /// # Output Format Logic
+    ///
+    /// The output format is determined by a combination of `--format` and `--detail` flags:
+    /// - If `--detail` is specified with the default Summary format, it automatically
+    ///   switches to Detail format for backward compatibility
+    /// - Otherwise, the explicitly specified format is used
+    /// - Single files use a compact text view unless JSON or SARIF is requested,
+    ///   in which case the same output as for directory analysis is emitted
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(())` if analysis completes successfully
+    /// * `Err(String)` with error message if analysis fails
+    pub fn run(self) -> Result<(), String> {
+        use crate::formatter::format_profile;
+        use std::time::Instant;
+
+        let Some(slowest) = self.profile else {
+            return self.execute(None);
+        };
+        let profiler = Arc::new(Profiler::new());
+        let started = Instant::now();
+        let result = self.execute(Some(Arc::clone(&profiler)));
+        eprint!(
+            "{}",
+            format_profile(&profiler.report(started.elapsed(), slowest))
+        );
+        result
+    }
+
+    /// Runs the analysis for `run`, recording the timing of every file in
+    /// `profiler` if there is one.
+    fn execute(mut self, profiler: Option<Arc<Profiler>>) -> Result<(), String> {
+        use crate::cache::{AnalysisCache, CACHE_DIR};
+        use crate::detect::LanguageMap;
+        use crate::formatter::{
+            format_api_surface, format_functions, format_output, format_proto_inventory,
+        };
+        use crate::plugin::PluginSet;
+        use crate::query::QuerySet;
+        use crate::watch::watch_directory;
+        use std::io::IsTerminal;
+
+        // Grammars are loaded first so that the configuration and
+        // --lang-map can name their languages
+        if let Some(dir) = &self.grammar_dir {
+            crate::grammar::load_grammar_dir(dir).map_err(|e| e.to_string())?;
+        }
+
+        if !self.no_config
+            && let Some(path) = self
+                .config
+                .clone()
+                .or_else(|| Config::discover(self.target_path()))
+        {
+            let config = Config::load(&path).map_err(|e| e.to_string())?;
+            self.apply_config(config);
+        }
+        self.check_grammar_pins()?;
+
+        let cache_dir = Path::new(CACHE_DIR);
+        if self.clear_cache {
+            AnalysisCache::clear(cache_dir).map_err(|e| e.to_string())?;
+        }
+
+        let cache = (!self.no_cache).then(|| Arc::new(AnalysisCache::load(cache_dir)));
+        let mut analyzer = CodeAnalyzer::new();
+        if let Some(cache) = &cache {
+            analyzer = analyzer.with_cache(Arc::clone(cache));
+        }
+        if !self.project_config.languages.is_empty() {
+            analyzer = analyzer.with_enabled_languages(&self.project_config.languages);
+        }
+        if !self.lang_map.is_empty() {
+            let languages = LanguageMap::parse(&self.lang_map).map_err(|e| e.to_string())?;
+            analyzer = analyzer.with_language_map(languages);
+        }
+        if let Some(path) = &self.queries {
+            let queries = QuerySet::load(path).map_err(|e| e.to_string())?;
+            analyzer = analyzer.with_queries(Arc::new(queries));
+        }
+        if !self.todo_markers.is_empty() {
+            analyzer = analyzer.with_todo_markers(&self.todo_markers);
+        }
+        if let Some(size) = self.max_parse_size {
+            analyzer = analyzer.with_max_parse_size(size.saturating_mul(1024 * 1024));
+        }
+        if let Some(seconds) = self.parse_timeout {
+            analyzer = analyzer.with_parse_timeout(Duration::from_secs(seconds));
+        }
+        if let Some(width) = self.tab_width {
+            analyzer = analyzer.with_tab_width(width);
+        }
+        if self.embedded_lua {
+            analyzer = analyzer.with_embedded_lua();
+        }
+        if self.template_code {
+            analyzer = analyzer.with_template_code();
+        }
+        if self.plugins {
+            let config = &self.project_config;
+            if config.plugins.is_empty() {
+                return Err(
+                    "--plugins requires [[plugin]] tables in the configuration file".to_string(),
+                );
+            }
+            let root = config.root.as_deref().unwrap_or(Path::new("."));
+            let plugins = PluginSet::start(&config.plugins, root).map_err(|e| e.to_string())?;
+            analyzer = analyzer.with_plugins(Arc::new(plugins));
+        }
+        if let Some(profiler) = profiler {
+            analyzer = analyzer.with_profiler(profiler);
+        }
+        let thresholds = self.thresholds();
+        let format = self.format.unwrap_or_default();
+        if format == OutputFormat::Dot && !self.deps && !self.call_graph {
+            return Err("--format dot requires --deps or --call-graph".to_string());
+        }
+        if self.level == Level::Function && format != OutputFormat::Csv {
+            return Err("--level function requires --format csv".to_string());
+        }
+        // A cache that can't be written only costs time on the next run
+        let save_cache = || {
+            if let Some(cache) = &cache
+                && let Err(e) = cache.save()
+            {
+                eprintln!("Warning: {e}");
+            }
+        };
+
+        if let Some(command) = &self.command {
+            let result = self.run_command(command, &mut analyzer, save_cache);
+            save_cache();
+            return result;
+        }
+        let path = self
+            .path
+            .as_deref()
+            .ok_or_else(|| "a path to analyze is required".to_string())?;
+
+        if let Some(base) = &self.diff {
+            use crate::diff::diff_report;
+            use crate::formatter::format_diff;
+
+            let result = diff_report(&mut analyzer, path, base, &self.directory_options())
+                .map(|report| println!("{}", format_diff(&report, format)))
+                .map_err(|e| e.to_string());
+            save_cache();
+            return result;
+        }
+
+        if let Some(output) = &self.emit_tags {
+            return self.emit_tags(&mut analyzer, path, output);
+        }
+
+        if self.duplicates {
+            use crate::duplicates::find_duplicates;
+            use crate::formatter::format_duplicates;
+
+            return find_duplicates(
+                &mut analyzer,
+                path,
+                &self.directory_options(),
+                self.min_clone_tokens,
+            )
+            .map(|report| println!("{}", format_duplicates(&report, format)))
+            .map_err(|e| e.to_string());
+        }
+
+        if self.strings {
+            use crate::formatter::format_strings;
+            use crate::strings::collect_strings;
+
+            return collect_strings(
+                &mut analyzer,
+                path,
+                &self.directory_options(),
+                &self.project_config.strings,
+            )
+            .map(|strings| println!("{}", format_strings(&strings, format)))
+            .map_err(|e| e.to_string());
+        }
+
+        if self.identifiers {
+            use crate::formatter::format_identifiers;
+            use crate::identifiers::collect_identifiers;
+
+            return collect_identifiers(&mut analyzer, path, &self.directory_options())
+                .map(|report| println!("{}", format_identifiers(&report, format)))
+                .map_err(|e| e.to_string());
+        }
+
+        if self.licenses || self.require_header {
+            use crate::formatter::format_licenses;
+            use crate::license::license_report;
+
+            let result = self.analyze_path(&mut analyzer, path).and_then(|stats| {
+                let report = license_report(&stats);
+                println!("{}", format_licenses(&report, format));
+                match report.missing.len() {
+                    missing if missing > 0 && self.require_header => {
+                        Err(format!("{missing} file(s) without a license header"))
+                    }
+                    _ => Ok(()),
+                }
+            });
+            save_cache();
+            return result;
+        }
+
+        if self.lint {
+            use crate::formatter::format_findings;
+            use crate::lint::{RuleSet, Severity, count, lint};
+
+            let base_dir = self
+                .project_config
+                .root
+                .as_deref()
+                .unwrap_or(Path::new("."));
+            let rules = RuleSet::compile(&self.project_config.rules, base_dir)
+                .map_err(|e| e.to_string())?;
+            if rules.is_empty() {
+                return Err("--lint requires [[rule]] tables in the configuration file".to_string());
+            }
+            let findings = lint(&mut analyzer, path, &self.directory_options(), &rules)
+                .map_err(|e| e.to_string())?;
+            println!("{}", format_findings(&findings, rules.rules(), format));
+            return match count(&findings, Severity::Error) {
+                0 => Ok(()),
+                errors => Err(format!("{errors} lint error(s)")),
+            };
+        }
+
+        if self.by_author {
+            use crate::formatter::format_ownership;
+            use crate::ownership::{by_author, by_codeowners};
+
+            let result = self.analyze_path(&mut analyzer, path).and_then(|stats| {
+                let ownership = if self.codeowners {
+                    by_codeowners(&stats, path).map_err(|e| e.to_string())?
+                } else {
+                    by_author(&stats)
+                };
+                if !ownership.skipped.is_empty() {
+                    eprintln!(
+                        "Warning: git could not blame {} files, they are left out",
+                        ownership.skipped.len()
+                    );
+                }
+                println!("{}", format_ownership(&ownership, format));
+                Ok(())
+            });
+            save_cache();
+            return result;
+        }
+
+        if let Some(OutputTarget::Sqlite(database)) = &self.output {
+            use crate::sqlite::append_snapshot;
+
+            let result = self.analyze_path(&mut analyzer, path).and_then(|stats| {
+                let snapshot =
+                    append_snapshot(database, &stats, path).map_err(|e| e.to_string())?;
+                println!(
+                    "Appended snapshot {} of {} files and {} functions to {}",
+                    snapshot.id,
+                    snapshot.files,
+                    snapshot.functions,
+                    database.display()
+                );
+                Ok(())
+            });
+            save_cache();
+            return result;
+        }
+
+        if self.watch && !path.is_dir() {
+            return Err(format!(
+                "--watch requires a directory, got {}",
+                path.display()
+            ));
+        }
+        if self.group_by.is_some() && !path.is_dir() && !is_remote(path) {
+            return Err(format!(
+                "--group-by requires a directory, got {}",
+                path.display()
+            ));
+        }
+
+        let result = if path == Path::new("-") {
+            let language = self
+                .lang
+                .as_deref()
+                .ok_or_else(|| "reading source from stdin (-) requires --lang".to_string())?;
+            let source = std::io::read_to_string(std::io::stdin())
+                .map_err(|e| format!("Failed to read stdin: {e}"))?;
+            analyze_snippet(&mut analyzer, STDIN_NAME, language, &source)
+                .and_then(|file_stats| self.print_file(file_stats, Path::new(""), format))
+        } else if self.lang.is_some() {
+            Err("--lang only applies to source read from stdin (-)".to_string())
+        } else if self.git_ref.is_some() && !is_git_url(path) {
+            Err("--ref only applies to git URLs".to_string())
+        } else if path.is_file() && !is_remote(path) {
+            // Single file analysis
+            analyzer
+                .analyze_file(path)
+                .map_err(|e| e.to_string())
+                .and_then(|file_stats| {
+                    self.print_file(file_stats, path.parent().unwrap_or(Path::new("")), format)
+                })
+        } else if path.is_dir() || is_remote(path) {
+            // Directory analysis; archives and git URLs are analyzed like directories
+            let options = self.directory_options();
+            // Determine output format based on --detail flag compatibility
+            let format = if self.detail && format == OutputFormat::Summary {
+                // When --detail is used with default Summary format,
+                // switch to Detail format for backward compatibility
+                OutputFormat::Detail
+            } else {
+                // Use the explicitly specified format
+                format
+            };
+            let render = |stats: &DirectoryStats| {
+                if self.functions {
+                    format_functions(stats, format, self.sort)
+                } else if self.proto_inventory {
+                    format_proto_inventory(stats, format)
+                } else if self.api_surface {
+                    format_api_surface(stats, format)
+                } else if self.implementations {
+                    use crate::formatter::format_implementations;
+                    use crate::interfaces::implementations;
+
+                    format_implementations(&implementations(stats), format)
+                } else if self.graphql_schema {
+                    use crate::formatter::format_graphql_schema;
+
+                    format_graphql_schema(stats, format)
+                } else if self.deps {
+                    use crate::formatter::format_dependency_graph;
+                    use crate::imports::dependency_graph;
+
+                    format_dependency_graph(&dependency_graph(stats, path), format)
+                } else if self.todos {
+                    self.render_todos(stats, format)
+                } else if self.tokens {
+                    use crate::formatter::format_tokens;
+                    use crate::tokens::token_report;
+
+                    format_tokens(&token_report(stats, path, self.fit_budget), format)
+                } else if self.distribution {
+                    use crate::distribution::distributions;
+                    use crate::formatter::format_distributions;
+
+                    format_distributions(&distributions(stats), format)
+                } else if self.call_graph || self.unreached {
+                    use crate::calls::call_graph;
+                    use crate::formatter::{format_call_graph, format_unreached};
+
+                    let graph = call_graph(stats, path);
+                    if self.unreached {
+                        format_unreached(&graph, format)
+                    } else {
+                        format_call_graph(&graph, format)
+                    }
+                } else if let Some(GroupBy::Dir) = self.group_by {
+                    use crate::formatter::format_rollup;
+                    use crate::rollup::rollup;
+
+                    let mut tree = rollup(stats, path);
+                    if let Some(depth) = self.depth {
+                        tree.truncate(depth);
+                    }
+                    format_rollup(&tree, format)
+                } else if let Some(GroupBy::Type) = self.group_by {
+                    use crate::formatter::format_type_rollup;
+
+                    use crate::rollup::{DEFAULT_MAX_TYPE_MEMBERS, type_rollup};
+
+                    let max_members = self.max_type_members.unwrap_or(DEFAULT_MAX_TYPE_MEMBERS);
+                    format_type_rollup(&type_rollup(stats, self.merge_partial, max_members), format)
+                } else if format == OutputFormat::Csv {
+                    use crate::csv::format_csv;
+
+                    format_csv(stats, self.level)
+                } else {
+                    format_output(stats, format, self.detail, &thresholds)
+                }
+            };
+
+            if self.watch {
+                watch_directory(&mut analyzer, path, &options, |stats, changed| {
+                    if changed > 0 {
+                        if std::io::stdout().is_terminal() {
+                            // Redraw in place so the output works as a live panel
+                            print!("\x1b[2J\x1b[H");
+                        }
+                        println!("Re-analyzed {changed} changed file(s)\n");
+                    }
+                    println!("{}", render(stats));
+                    save_cache();
+                })
+                .map_err(|e| e.to_string())
+            } else {
+                let mut analyzer = analyzer.with_cancellation(interrupt_flag());
+                self.analyze_path(&mut analyzer, path).and_then(|stats| {
+                    println!("{}", render(&stats));
+                    match stats.interrupted {
+                        0 => Ok(()),
+                        n => Err(format!("analysis interrupted, {n} file(s) not analyzed")),
+                    }
+                })
+            }
+        } else {
+            Err(format!(
+                "{} is neither a file nor a directory",
+                path.display()
+            ))
+        };
+
+        save_cache();
+        result
+    }
+
+    /// Traversal settings shared by directory analysis and the subcommands.
+    fn directory_options(&self) -> DirectoryOptions {
+        DirectoryOptions {
+            max_depth: self.max_depth,
+            follow_links: self.follow_links,
+            skip_links: self.skip_links,
+            ignore_patterns: self.ignore.clone(),
+            respect_gitignore: !self.no_gitignore,
+            jobs: self.jobs,
+            // Flags come last so that they override the configuration file
+            include: [&self.project_config.include[..], &self.include].concat(),
+            exclude: [&self.project_config.exclude[..], &self.exclude].concat(),
+            glob_root: self.project_config.root.clone(),
+            include_generated: self.include_generated,
+        }
+    }
+
+    /// Compares the grammars with the versions pinned in the configuration,
+    /// warning about every mismatch or, with `on_mismatch = "error"`, failing.
+    /// `languages` only warns, so the grammars can still be listed.
+    fn check_grammar_pins(&self) -> Result<(), String> {
+        let pins = &self.project_config.grammars;
+        let mismatches = crate::versions::pin_mismatches(&pins.versions);
+        if mismatches.is_empty() {
+            return Ok(());
+        }
+        if pins.on_mismatch == OnMismatch::Error
+            && !matches!(self.command, Some(Command::Languages(_)))
+        {
+            return Err(format!(
+                "grammars differ from the pinned versions: {}",
+                mismatches.join("; ")
+            ));
+        }
+        for mismatch in &mismatches {
+            eprintln!("Warning: {mismatch}");
+        }
+        Ok(())
+    }
+
+    /// Function thresholds from the flags, the configuration file, or the defaults.
+    fn thresholds(&self) -> Thresholds {
+        let defaults = Thresholds::default();
+        Thresholds {
+            complexity: self.complexity_threshold.unwrap_or(defaults.complexity),
+            function_lines: self.max_function_lines.unwrap_or(defaults.function_lines),
+        }
+    }
+
+    /// The file or directory the command operates on, used to find the
+    /// project configuration.
+    fn target_path(&self) -> &Path {
+        match &self.command {
+            Some(Command::Baseline {
+                action: BaselineCommand::Write { path, .. },
+            }) => path,
+            Some(Command::Check(args)) => &args.path,
+            Some(Command::Top(args)) => &args.path,
+            Some(Command::Serve(args)) => &args.path,
+            Some(Command::History(args)) => &args.path,
+            Some(Command::Hotspots(args)) => &args.path,
+            Some(Command::Compare(_)) => Path::new("."),
+            Some(Command::Badge(args)) => &args.path,
+            Some(Command::Tui(args)) => &args.path,
+            Some(Command::Treemap(args)) => &args.path,
+            Some(
+                Command::Snippet(_)
+                | Command::Hook(_)
+                | Command::Workspace(_)
+                | Command::Languages(_),
+            ) => Path::new("."),
+            // Source from stdin and git URLs use the configuration of the
+            // working directory
+            None => match self.path.as_deref() {
+                Some(path) if path != Path::new("-") && !is_git_url(path) => path,
+                _ => Path::new("."),
+            },
+        }
+    }
+
+    /// Fills in every option not given on the command line from `config`.
+    ///
+    /// Exclusion globs, enabled languages, and the glob root only exist in the
+    /// configuration file and are kept for `directory_options`.
+    fn apply_config(&mut self, config: Config) {
+        self.format = self.format.or(config.format);
+        self.complexity_threshold = self.complexity_threshold.or(config.thresholds.complexity);
+        self.max_function_lines = self.max_function_lines.or(config.thresholds.function_lines);
+        self.max_type_members = self.max_type_members.or(config.thresholds.type_members);
+        self.max_parse_size = self.max_parse_size.or(config.max_parse_size);
+        self.parse_timeout = self.parse_timeout.or(config.parse_timeout);
+        if self.queries.is_none() {
+            self.queries.clone_from(&config.queries);
+        }
+        if self.todo_markers.is_empty() {
+            self.todo_markers.clone_from(&config.todo_markers);
+        }
+        match &mut self.command {
+            Some(Command::Top(args)) => args.format = args.format.or(config.format),
+            Some(Command::History(args)) => args.format = args.format.or(config.format),
+            Some(Command::Hotspots(args)) => args.format = args.format.or(config.format),
+            Some(Command::Compare(args)) => args.format = args.format.or(config.format),
+            Some(Command::Snippet(args)) => args.format = args.format.or(config.format),
+            Some(Command::Workspace(args)) => args.format = args.format.or(config.format),
+            Some(Command::Languages(args)) => args.format = args.format.or(config.format),
+            Some(Command::Check(args)) => {
+                args.max_params = args.max_params.or(config.thresholds.parameters);
+                args.max_returns = args.max_returns.or(config.thresholds.returns);
+            }
+            _ => {}
+        }
+        self.project_config = config;
+    }
+
+    /// Formats the `--todos` inventory, with git blame details if `--blame`
+    /// is given. Files git can't blame are listed without them.
+    fn render_todos(&self, stats: &DirectoryStats, format: OutputFormat) -> String {
+        use crate::formatter::format_todos;
+        use crate::todos::{add_blame, todo_items};
+
+        let mut items = todo_items(stats);
+        if self.blame
+            && let Err(e) = add_blame(&mut items)
+        {
+            eprintln!("Warning: {e}");
+        }
+        format_todos(&items, format)
+    }
+
+    /// Writes a tags file for `path` to `output`, or to stdout for `-`.
+    fn emit_tags(
+        &self,
+        analyzer: &mut CodeAnalyzer,
+        path: &Path,
+        output: &Path,
+    ) -> Result<(), String> {
+        use crate::tags::{collect_tags, format_tags};
+
+        let tags =
+            collect_tags(analyzer, path, &self.directory_options()).map_err(|e| e.to_string())?;
+        let content = format_tags(&tags);
+        if output == Path::new("-") {
+            print!("{content}");
+            return Ok(());
+        }
+
+        std::fs::write(output, content)
+            .map_err(|e| format!("Failed to write {}: {e}", output.display()))?;
+        println!("Wrote {} tags to {}", tags.len(), output.display());
+        Ok(())
+    }
+
+    /// Analyzes a file, directory, archive, or git URL into directory
+    /// statistics.
+    fn analyze_path(
+        &self,
+        analyzer: &mut CodeAnalyzer,
+        path: &Path,
+    ) -> Result<DirectoryStats, String> {
+        let options = self.directory_options();
+        if is_remote(path) {
+            analyze_remote(analyzer, path, self.git_ref.as_deref(), &options)
+        } else {
+            analyzer.analyze_path(path, &options)
+        }
+        .map_err(|e| e.to_string())
+    }
+
+    /// Prints the statistics of a single file in the mode and format
+    /// selected by the flags.
+    ///
+    /// Listing modes such as `--functions` print their report for the file
+    /// alone; machine-readable formats emit the same output as directory
+    /// analysis, so consumers don't need to special-case single files; the
+    /// remaining formats print a compact text view.
+    ///
+    /// # Arguments
+    ///
+    /// * `file_stats` - Statistics of the file
+    /// * `root` - Directory that paths of the dependency, call, and token
+    ///   reports are relative to
+    /// * `format` - The output format
+    fn print_file(
+        &self,
+        file_stats: FileStats,
+        root: &Path,
+        format: OutputFormat,
+    ) -> Result<(), String> {
+        use crate::formatter::{
+            format_api_surface, format_functions, format_output, format_proto_inventory,
+            format_single_file,
+        };
+
+        let thresholds = self.thresholds();
+        let listing = self.functions
+            || self.proto_inventory
+            || self.api_surface
+            || self.implementations
+            || self.graphql_schema
+            || self.deps
+            || self.call_graph
+            || self.unreached
+            || self.todos
+            || self.tokens
+            || self.distribution;
+        let machine_readable = matches!(
+            format,
+            OutputFormat::Csv
+                | OutputFormat::Prometheus
+                | OutputFormat::GithubAnnotations
+                | OutputFormat::GitlabCodequality
+                | OutputFormat::Json
+                | OutputFormat::Sarif
+                | OutputFormat::Html
+                | OutputFormat::Markdown
+        );
+        if !listing && !machine_readable {
+            println!("{}", format_single_file(&file_stats, &thresholds));
+            return Ok(());
+        }
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file_stats);
+
+        if self.functions {
+            println!("{}", format_functions(&stats, format, self.sort));
+        } else if self.proto_inventory {
+            println!("{}", format_proto_inventory(&stats, format));
+        } else if self.api_surface {
+            println!("{}", format_api_surface(&stats, format));
+        } else if self.implementations {
+            use crate::formatter::format_implementations;
+            use crate::interfaces::implementations;
+
+            let interfaces = implementations(&stats);
+            println!("{}", format_implementations(&interfaces, format));
+        } else if self.graphql_schema {
+            use crate::formatter::format_graphql_schema;
+
+            println!("{}", format_graphql_schema(&stats, format));
+        } else if self.deps {
+            use crate::formatter::format_dependency_graph;
+            use crate::imports::dependency_graph;
+
+            let graph = dependency_graph(&stats, root);
+            println!("{}", format_dependency_graph(&graph, format));
+        } else if self.call_graph || self.unreached {
+            use crate::calls::call_graph;
+            use crate::formatter::{format_call_graph, format_unreached};
+
+            let graph = call_graph(&stats, root);
+            if self.unreached {
+                println!("{}", format_unreached(&graph, format));
+            } else {
+                println!("{}", format_call_graph(&graph, format));
+            }
+        } else if self.todos {
+            println!("{}", self.render_todos(&stats, format));
+        } else if self.tokens {
+            use crate::formatter::format_tokens;
+            use crate::tokens::token_report;
+
+            let report = token_report(&stats, root, self.fit_budget);
+            println!("{}", format_tokens(&report, format));
+        } else if self.distribution {
+            use crate::distribution::distributions;
+            use crate::formatter::format_distributions;
+
+            println!("{}", format_distributions(&distributions(&stats), format));
+        } else if format == OutputFormat::Csv {
+            use crate::csv::format_csv;
+
+            print!("{}", format_csv(&stats, self.level));
+        } else if matches!(
+            format,
+            OutputFormat::Prometheus | OutputFormat::GithubAnnotations
+        ) {
+            print!(
+                "{}",
+                format_output(&stats, format, self.detail, &thresholds)
+            );
+        } else {
+            println!(
+                "{}",
+                format_output(&stats, format, self.detail, &thresholds)
+            );
+        }
+        Ok(())
+    }
+
+    /// Executes the `baseline write`, `check`, `top`, `serve`, `history`,
+    /// `hotspots`, `compare`, `badge`, `tui`, `treemap`, `snippet`, `hook`,
+    /// `workspace`, and `languages` subcommands.
+    ///
+    /// `check`, `hook`, and `compare --fail-on-increase` print every
+    /// regression and then fail, so that the process exits with a non-zero status in CI.
+    /// `serve` runs until the process is stopped and saves the cache after
+    /// every request.
+    fn run_command(
+        &self,
+        command: &Command,
+        analyzer: &mut CodeAnalyzer,
+        save_cache: impl Fn() + Sync,
+    ) -> Result<(), String> {
+        use crate::badge::Badge;
+        use crate::baseline::{Baseline, Limits, Tolerances};
+        use crate::compare::{compare, increases, load_report};
+        use crate::formatter::{
+            format_diff, format_history, format_hotspots, format_languages, format_top,
+            format_workspace,
+        };
+        use crate::history::{history, series};
+        use crate::hook::staged_stats;
+        use crate::hotspots::{churn, hotspots};
+        use crate::server::{Request, Server, WORKERS, serve};
+        use crate::treemap::format_treemap;
+        use crate::workspace::{WorkspaceReport, read_manifest, repositories};
+
+        match command {
+            Command::Baseline {
+                action: BaselineCommand::Write { path, output },
+            } => {
+                let stats = self.analyze_path(analyzer, path)?;
+                let baseline = Baseline::from_stats(&stats, path);
+                baseline.save(output).map_err(|e| e.to_string())?;
+                println!(
+                    "Wrote baseline of {} files and {} functions to {}",
+                    baseline.total_files,
+                    baseline.functions.len(),
+                    output.display()
+                );
+                Ok(())
+            }
+            Command::Check(args) => {
+                let baseline = Baseline::load(&args.baseline).map_err(|e| e.to_string())?;
+                let stats = self.analyze_path(analyzer, &args.path)?;
+                let current = Baseline::from_stats(&stats, &args.path);
+                let tolerances = Tolerances {
+                    complexity: args.complexity_tolerance,
+                    function_lines: args.function_lines_tolerance,
+                    file_count: args.file_count_tolerance,
+                };
+
+                let limits = Limits {
+                    parameters: args.max_params,
+                    returns: args.max_returns,
+                };
+
+                let regressions = baseline.regressions(&current, &tolerances);
+                let violations = current.violations(&limits);
+                if regressions.is_empty() && violations.is_empty() {
+                    println!("No regressions against {}", args.baseline.display());
+                    return Ok(());
+                }
+
+                let mut failures = Vec::new();
+                if !regressions.is_empty() {
+                    println!("Regressions against {}:", args.baseline.display());
+                    for regression in &regressions {
+                        println!("  {regression}");
+                    }
+                    failures.push(format!(
+                        "{} metric(s) regressed against the baseline",
+                        regressions.len()
+                    ));
+                }
+                if !violations.is_empty() {
+                    println!("Functions over the limits:");
+                    for violation in &violations {
+                        println!("  {violation}");
+                    }
+                    failures.push(format!(
+                        "{} function metric(s) over the limits",
+                        violations.len()
+                    ));
+                }
+                Err(failures.join(", "))
+            }
+            Command::Top(args) => {
+                let stats = self.analyze_path(analyzer, &args.path)?;
+                let format = args.format.unwrap_or_default();
+                println!("{}", format_top(&stats, args.by, args.limit, format));
+                Ok(())
+            }
+            Command::Serve(args) => {
+                // Each worker gets its own parsers; the result cache is shared
+                let mut forks: Vec<CodeAnalyzer> = (1..WORKERS).map(|_| analyzer.fork()).collect();
+                // Saves of different workers would write the same file
+                let saving = Mutex::new(());
+                let handlers = std::iter::once(analyzer)
+                    .chain(&mut forks)
+                    .map(|analyzer| {
+                        let mut server = Server::new(
+                            analyzer,
+                            &args.path,
+                            self.directory_options(),
+                            self.thresholds(),
+                        );
+                        let (saving, save_cache) = (&saving, &save_cache);
+                        move |request: &Request| {
+                            let response = server.handle(request);
+                            let _saving = saving.lock().unwrap_or_else(|e| e.into_inner());
+                            save_cache();
+                            response
+                        }
+                    })
+                    .collect();
+                serve(&args.listen, handlers).map_err(|e| e.to_string())
+            }
+            Command::History(args) => {
+                let until = args.until.unwrap_or_else(Date::today);
+                if until < args.since {
+                    return Err(format!("--until {until} is before --since {}", args.since));
+                }
+                let dates = series(args.since, until, args.step);
+                let points = history(analyzer, &args.path, &self.directory_options(), &dates)
+                    .map_err(|e| e.to_string())?;
+                let format = args.format.unwrap_or_default();
+                println!("{}", format_history(&points, format));
+                Ok(())
+            }
+            Command::Hotspots(args) => {
+                let churn = churn(&args.path, args.since.as_deref()).map_err(|e| e.to_string())?;
+                let stats = self.analyze_path(analyzer, &args.path)?;
+                let format = args.format.unwrap_or_default();
+                println!(
+                    "{}",
+                    format_hotspots(&hotspots(&stats, &churn), args.limit, format)
+                );
+                Ok(())
+            }
+            Command::Compare(args) => {
+                let old = load_report(&args.old).map_err(|e| e.to_string())?;
+                let new = load_report(&args.new).map_err(|e| e.to_string())?;
+                let report = compare(&old, &new, &args.old.display().to_string());
+                let format = args.format.unwrap_or_default();
+                println!("{}", format_diff(&report, format));
+
+                let grown: Vec<_> = args
+                    .fail_on_increase
+                    .iter()
+                    .flat_map(|&metric| increases(&old, &new, &report, metric))
+                    .collect();
+                if grown.is_empty() {
+                    return Ok(());
+                }
+                // On stderr, so the report on stdout stays valid JSON
+                eprintln!("Increases since {}:", args.old.display());
+                for increase in &grown {
+                    eprintln!("  {increase}");
+                }
+                Err(format!(
+                    "{} metric(s) increased since {}",
+                    grown.len(),
+                    args.old.display()
+                ))
+            }
+            Command::Badge(args) => {
+                let stats = self.analyze_path(analyzer, &args.path)?;
+                let badge = Badge::new(&stats, args.metric);
+                let svg = badge.to_svg();
+                if args.output == Path::new("-") {
+                    print!("{svg}");
+                    return Ok(());
+                }
+
+                std::fs::write(&args.output, svg)
+                    .map_err(|e| format!("Failed to write {}: {e}", args.output.display()))?;
+                println!(
+                    "Wrote \"{}: {}\" badge to {}",
+                    badge.label,
+                    badge.message,
+                    args.output.display()
+                );
+                Ok(())
+            }
+            Command::Tui(args) => {
+                let stats = self.analyze_path(analyzer, &args.path)?;
+                // The dashboard may stay open a long time
+                save_cache();
+                let root = if args.path.is_file() {
+                    args.path.parent().unwrap_or(Path::new("."))
+                } else {
+                    &args.path
+                };
+                crate::tui::run(&stats, root).map_err(|e| e.to_string())
+            }
+            Command::Treemap(args) => {
+                let stats = self.analyze_path(analyzer, &args.path)?;
+                let root = if args.path.is_file() {
+                    args.path.parent().unwrap_or(Path::new("."))
+                } else {
+                    &args.path
+                };
+                let html = format_treemap(&stats, root, &self.thresholds());
+                if args.output == Path::new("-") {
+                    print!("{html}");
+                    return Ok(());
+                }
+
+                std::fs::write(&args.output, html)
+                    .map_err(|e| format!("Failed to write {}: {e}", args.output.display()))?;
+                println!(
+                    "Wrote treemap of {} files to {}",
+                    stats.code_files(),
+                    args.output.display()
+                );
+                Ok(())
+            }
+            Command::Snippet(args) => {
+                let file_stats = analyze_snippet(analyzer, SNIPPET_NAME, &args.lang, &args.code)?;
+                self.print_file(file_stats, Path::new(""), args.format.unwrap_or_default())
+            }
+            Command::Hook(args) => {
+                let stats = staged_stats(
+                    analyzer,
+                    Path::new("."),
+                    &args.paths,
+                    &self.directory_options(),
+                )
+                .map_err(|e| e.to_string())?;
+                let violations = crate::sarif::violations(&stats, &self.thresholds());
+                if violations.is_empty() {
+                    println!(
+                        "No threshold violations in {} staged file(s)",
+                        stats.code_files()
+                    );
+                    return Ok(());
+                }
+
+                println!("Staged functions over the thresholds:");
+                for violation in &violations {
+                    println!(
+                        "  {}:{}: {}",
+                        violation.function.path.display(),
+                        violation.function.function.start_line,
+                        violation.message
+                    );
+                }
+                Err(format!(
+                    "{} threshold violation(s) in staged files",
+                    violations.len()
+                ))
+            }
+            Command::Workspace(args) => {
+                let mut paths = args.paths.clone();
+                if let Some(manifest) = &args.manifest {
+                    paths.extend(read_manifest(manifest).map_err(|e| e.to_string())?);
+                }
+                let mut analyzed = Vec::new();
+                for repository in repositories(paths) {
+                    let stats = self
+                        .analyze_path(analyzer, &repository.path)
+                        .map_err(|e| format!("{}: {e}", repository.path.display()))?;
+                    analyzed.push((repository, stats));
+                }
+                let (report, merged) = WorkspaceReport::new(analyzed);
+                let format = args.format.unwrap_or_default();
+                println!(
+                    "{}",
+                    format_workspace(&report, &merged, format, &self.thresholds())
+                );
+                Ok(())
+            }
+            Command::Languages(args) => {
+                let grammars = crate::versions::grammars();
+                let format = args.format.unwrap_or_default();
+                println!("{}", format_languages(&grammars, format));
+                Ok(())
+            }
+        }
+    }
+}
+
+/// Subcommands for recording and enforcing metric baselines and for rankings.
+#[derive(Subcommand, Debug)]
+pub enum Command {
+    /// Record a snapshot of the current metrics
+    Baseline {
+        #[command(subcommand)]
+        action: BaselineCommand,
+    },
+    /// Exit with an error if metrics regressed against a baseline (CI gate)
+    Check(CheckArgs),
+    /// Print the largest files or most complex functions
+    Top(TopArgs),
+    /// Serve the metrics for Prometheus to scrape and the analysis over HTTP
+    /// and JSON-RPC
+    Serve(ServeArgs),
+    /// Print a time series of the metrics across git history
+    History(HistoryArgs),
+    /// Rank files by churn times complexity from git history
+    Hotspots(HotspotsArgs),
+    /// Print the files and functions that changed between two JSON reports
+    Compare(CompareArgs),
+    /// Write a shields.io-style SVG badge of a metric
+    Badge(BadgeArgs),
+    /// Browse languages, the file tree, and functions in an interactive
+    /// terminal dashboard
+    Tui(TuiArgs),
+    /// Write an HTML treemap of lines of code colored by complexity
+    Treemap(TreemapArgs),
+    /// Print the statistics of source code given on the command line
+    Snippet(SnippetArgs),
+    /// Exit with an error if staged files exceed the thresholds (pre-commit
+    /// hook)
+    Hook(HookArgs),
+    /// Compare several repositories and summarize them together
+    Workspace(WorkspaceArgs),
+    /// List the grammars with their versions and ABI versions
+    Languages(LanguagesArgs),
+}
+
+/// Actions of the `baseline` subcommand.
+#[derive(Subcommand, Debug)]
+pub enum BaselineCommand {
+    /// Analyze a path and write its metrics to a baseline file
+    Write {
+        /// Path to analyze (file or directory)
+        #[arg(default_value = ".")]
+        path: PathBuf,
+
+        /// Baseline file to write
+        #[arg(short, long, value_name = "FILE", default_value = BASELINE_FILE)]
+        output: PathBuf,
+    },
+}
+
+/// Arguments of the `check` subcommand.
+#[derive(Args, Debug)]
+pub struct CheckArgs {
+    /// Path to analyze (file or directory)
+    #[arg(default_value = ".")]
+    pub path: PathBuf,
+
+    /// Baseline file written by `baseline write`
+    #[arg(long, value_name = "FILE", default_value = BASELINE_FILE)]
+    pub baseline: PathBuf,
+
+    /// Allowed increase of cyclomatic complexity, per function and overall maximum
+    #[arg(long, value_name = "N", default_value_t = 0)]
+    pub complexity_tolerance: usize,
+
+    /// Allowed increase of function length in lines, per function and overall maximum
+    #[arg(long, value_name = "N", default_value_t = 0)]
+    pub function_lines_tolerance: usize,
+
+    /// Allowed increase of the number of analyzed files
+    #[arg(long, value_name = "N", default_value_t = 0)]
+    pub file_count_tolerance: usize,
+
+    /// Fail if any function declares more parameters than this value
+    #[arg(long, value_name = "N")]
+    pub max_params: Option<usize>,
+
+    /// Fail if any function returns more values than this value
+    #[arg(long, value_name = "N")]
+    pub max_returns: Option<usize>,
+}
+
+/// Arguments of the `top` subcommand.
+#[derive(Args, Debug)]
+pub struct TopArgs {
+    /// Path to analyze (file or directory)
+    #[arg(default_value = ".")]
+    pub path: PathBuf,
+
+    /// Metric to rank by
+    #[arg(long, value_enum, value_name = "METRIC", default_value_t = TopMetric::Loc)]
+    pub by: TopMetric,
+
+    /// Number of entries to print (0 prints all)
+    #[arg(long, value_name = "N", default_value_t = 20)]
+    pub limit: usize,
+
+    /// Output format (json, or text for anything else) [default: summary]
+    #[arg(short, long, value_enum)]
+    pub format: Option<OutputFormat>,
+}
+
+/// Arguments of the `serve` subcommand.
+#[derive(Args, Debug)]
+pub struct ServeArgs {
+    /// Path to analyze (file or directory)
+    #[arg(default_value = ".")]
+    pub path: PathBuf,
+
+    /// Address to listen on; `:PORT` listens on all interfaces
+    #[arg(long, value_name = "ADDR", default_value = "127.0.0.1:9100")]
+    pub listen: String,
+}
+
+/// Arguments of the `history` subcommand.
+#[derive(Args, Debug)]
+pub struct HistoryArgs {
+    /// Path to analyze (file or directory inside a git repository)
+    #[arg(default_value = ".")]
+    pub path: PathBuf,
+
+    /// First date of the series (YYYY-MM-DD)
+    #[arg(long, value_name = "DATE")]
+    pub since: Date,
+
+    /// Last date of the series (YYYY-MM-DD) [default: today]
+    #[arg(long, value_name = "DATE")]
+    pub until: Option<Date>,
+
+    /// Interval between the dates of the series
+    #[arg(long, value_enum, value_name = "STEP", default_value_t = HistoryStep::Monthly)]
+    pub step: HistoryStep,
+
+    /// Output format (json, csv, or text for anything else) [default: summary]
+    #[arg(short, long, value_enum)]
+    pub format: Option<OutputFormat>,
+}
+
+/// Arguments of the `hotspots` subcommand.
+#[derive(Args, Debug)]
+pub struct HotspotsArgs {
+    /// Path to analyze (file or directory inside a git repository)
+    #[arg(default_value = ".")]
+    pub path: PathBuf,
+
+    /// Only count commits after this date, in any form git accepts
+    /// (2023-01-01, "6 months ago") [default: all history]
+    #[arg(long, value_name = "DATE")]
+    pub since: Option<String>,
+
+    /// Number of files to print (0 prints all)
+    #[arg(long, value_name = "N", default_value_t = 20)]
+    pub limit: usize,
+
+    /// Output format (json, or text for anything else) [default: summary]
+    #[arg(short, long, value_enum)]
+    pub format: Option<OutputFormat>,
+}
+
+/// Arguments of the `compare` subcommand.
+#[derive(Args, Debug)]
+pub struct CompareArgs {
+    /// Earlier report, written with --format json
+    pub old: PathBuf,
+
+    /// Later report, written with --format json
+    pub new: PathBuf,
+
+    /// Exit with an error if the metric grew for any function or overall
+    /// (comma-separated)
+    #[arg(long, value_enum, value_name = "METRIC", value_delimiter = ',')]
+    pub fail_on_increase: Vec<CompareMetric>,
+
+    /// Output format (json, markdown, or text for anything else) [default: summary]
+    #[arg(short, long, value_enum)]
+    pub format: Option<OutputFormat>,
+}
+
+/// Metrics `compare --fail-on-increase` can check.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, PartialOrd, Ord, ValueEnum)]
+pub enum CompareMetric {
+    /// Cyclomatic complexity of each function and the maximum
+    Complexity,
+    /// Lines spanned by each function and the maximum
+    Lines,
+}
+
+/// Arguments of the `badge` subcommand.
+#[derive(Args, Debug)]
+pub struct BadgeArgs {
+    /// Path to analyze (file or directory)
+    #[arg(default_value = ".")]
+    pub path: PathBuf,
+
+    /// Metric shown on the badge
+    #[arg(long, value_enum)]
+    pub metric: BadgeMetric,
+
+    /// SVG file to write ("-" writes to stdout)
+    #[arg(short, long, value_name = "FILE", default_value = "badge.svg")]
+    pub output: PathBuf,
+}
+
+/// Arguments of the `tui` subcommand.
+#[derive(Args, Debug)]
+pub struct TuiArgs {
+    /// Path to analyze (file or directory)
+    #[arg(default_value = ".")]
+    pub path: PathBuf,
+}
+
+/// Arguments of the `treemap` subcommand.
+#[derive(Args, Debug)]
+pub struct TreemapArgs {
+    /// Path to analyze (file or directory)
+    #[arg(default_value = ".")]
+    pub path: PathBuf,
+
+    /// HTML file to write ("-" writes to stdout)
+    #[arg(short, long, value_name = "FILE", default_value = "treemap.html")]
+    pub output: PathBuf,
+}
+
+/// Arguments of the `snippet` subcommand.
+#[derive(Args, Debug)]
+pub struct SnippetArgs {
+    /// Source code to analyze
+    pub code: String,
+
+    /// Language of the source code
+    #[arg(long, value_name = "LANG")]
+    pub lang: String,
+
+    /// Output format [default: summary]
+    #[arg(short, long, value_enum)]
+    pub format: Option<OutputFormat>,
+}
+
+/// Arguments of the `hook` subcommand.
+#[derive(Args, Debug)]
+pub struct HookArgs {
+    /// Staged files or directories to check, as passed by pre-commit
+    /// frameworks [default: everything staged]
+    pub paths: Vec<PathBuf>,
+}
+
+/// Arguments of the `workspace` subcommand.
+#[derive(Args, Debug)]
+pub struct WorkspaceArgs {
+    /// Repositories to analyze (directories, archives, or git URLs)
+    #[arg(required_unless_present = "manifest")]
+    pub paths: Vec<PathBuf>,
+
+    /// File listing one repository per line, in addition to PATHS
+    #[arg(long, value_name = "FILE")]
+    pub manifest: Option<PathBuf>,
+
+    /// Output format [default: summary]
+    #[arg(short, long, value_enum)]
+    pub format: Option<OutputFormat>,
+}
+
+/// Arguments of the `languages` subcommand.
+#[derive(Args, Debug)]
+pub struct LanguagesArgs {
+    /// Output format [default: summary]
+    #[arg(short, long, value_enum)]
+    pub format: Option<OutputFormat>,
+}
+
+/// Metrics a badge can show.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, PartialOrd, Ord, ValueEnum)]
+pub enum BadgeMetric {
+    /// Lines of code
+    Loc,
+    /// Share of public declarations with a doc comment
+    CoverageOfDocs,
+    /// Mean cyclomatic complexity of all functions
+    Complexity,
+}
+
+/// Intervals between the dates of a `history` series.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, PartialOrd, Ord, ValueEnum)]
+pub enum HistoryStep {
+    /// Every day
+    Daily,
+    /// Every seven days
+    Weekly,
+    /// The same day of every month
+    Monthly,
+    /// The same day of every third month
+    Quarterly,
+    /// The same day of every year
+    Yearly,
+}
+
+/// Metrics the `top` subcommand can rank by.
+///
+/// `loc` and `functions` rank files; `complexity` and `lines` rank functions.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, PartialOrd, Ord, ValueEnum)]
+pub enum TopMetric {
+    /// Files by lines of code
+    Loc,
+    /// Files by number of functions
+    Functions,
+    /// Functions by cyclomatic complexity
+    Complexity,
+    /// Functions by number of lines spanned
+    Lines,
+}
+
+/// Units the `--group-by` report can aggregate statistics by.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, PartialOrd, Ord, ValueEnum)]
+pub enum GroupBy {
+    /// Directories, rendered as a tree with subtree totals
+    Dir,
+    /// Classes, structs, and other types, largest first
+    Type,
+}
+
+/// Columns the `--functions` listing can be sorted by.
+///
+/// Text columns sort ascending; numeric columns sort descending so the
+/// largest functions come first. Ties are broken by location.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, PartialOrd, Ord, ValueEnum)]
+pub enum FunctionSort {
+    /// File path, then start line
+    Location,
+    /// Qualified function name
+    Name,
+    /// Number of lines spanned
+    Lines,
+    /// Number of parameters
+    Params,
+    /// Cyclomatic complexity
+    Complexity,
+    /// Deepest control-flow nesting
+    Nesting,
+    /// Cognitive complexity
+    Cognitive,
+    /// Halstead volume
+    Volume,
+    /// Maintainability index, lowest first
+    Maintainability,
+}
+
+/// Available output formats for the analysis results.
+///
+/// Each format provides a different level of detail and structure
+/// for the code statistics output. In `.codestats.toml` the formats are
+/// written in lowercase, as on the command line.
+#[derive(Copy, Clone, Debug, Default, PartialEq, Eq, PartialOrd, Ord, ValueEnum, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum OutputFormat {
+    /// Summary statistics only
+    #[default]
+    Summary,
+    /// Detailed file-by-file breakdown
+    Detail,
+    /// JSON output
+    Json,
+    /// SARIF 2.1.0 log of threshold violations, for code scanning tools
+    Sarif,
+    /// Self-contained HTML report with sortable tables and charts
+    Html,
+    /// Compact Markdown summary for pull-request comments
+    Markdown,
+    /// Graphviz DOT graph of the --deps import graph or the --call-graph
+    Dot,
+    /// CSV with one row per file, or per function with --level function
+    Csv,
+    /// Prometheus text exposition format, for a textfile collector
+    Prometheus,
+    /// GitHub Actions workflow commands annotating threshold violations
+    #[serde(rename = "github-annotations")]
+    GithubAnnotations,
+    /// GitLab Code Quality report of threshold violations
+    #[serde(rename = "gitlab-codequality")]
+    GitlabCodequality,
+}
+
+/// What a row of the `--format csv` output describes.
+#[derive(Copy, Clone, Debug, Default, PartialEq, Eq, PartialOrd, Ord, ValueEnum)]
+pub enum Level {
+    /// One row per file
+    #[default]
+    File,
+    /// One row per function
+    Function,
+}
+
+/// Where `--output` writes the metrics.
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub enum OutputTarget {
+    /// An SQLite database, created if missing, that every run appends a
+    /// snapshot to
+    Sqlite(PathBuf),
+}
+
+impl FromStr for OutputTarget {
+    type Err = String;
+
+    fn from_str(target: &str) -> Result<Self, Self::Err> {
+        match target.split_once(':') {
+            Some(("sqlite", path)) if !path.is_empty() => Ok(Self::Sqlite(PathBuf::from(path))),
+            _ => Err(format!("expected sqlite:FILE, got '{target}'")),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use clap::CommandFactory;
+
+    #[test]
+    fn test_cli_parse_basic() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src/main.rs"]).unwrap();
+
+        assert_eq!(cli.path, Some(PathBuf::from("src/main.rs")));
+        assert!(cli.command.is_none());
+        // Unset until the configuration file is applied
+        assert_eq!(cli.format, None);
+        assert!(!cli.detail);
+        assert!(cli.ignore.is_empty());
+        assert!(!cli.follow_links);
+        assert_eq!(cli.max_depth, 100);
+        assert!(!cli.no_gitignore);
+        assert_eq!(cli.complexity_threshold, None);
+        assert_eq!(cli.thresholds(), Thresholds::default());
+        assert_eq!(cli.jobs, 0);
+        assert!(!cli.no_cache);
+        assert!(!cli.clear_cache);
+        assert!(!cli.watch);
+        assert!(!cli.functions);
+        assert!(cli.queries.is_none());
+        assert!(cli.config.is_none());
+        assert!(!cli.no_config);
+        assert_eq!(cli.sort, FunctionSort::Location);
+        assert!(cli.diff.is_none());
+        assert!(cli.emit_tags.is_none());
+        assert!(cli.lang_map.is_empty());
+        assert!(cli.grammar_dir.is_none());
+        assert!(!cli.include_generated);
+        assert!(!cli.duplicates);
+    }
+
+    #[test]
+    fn test_cli_parse_with_format() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--format", "json"]).unwrap();
+
+        assert_eq!(cli.path, Some(PathBuf::from("src")));
+        assert_eq!(cli.format, Some(OutputFormat::Json));
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--format", "html"]).unwrap();
+        assert_eq!(cli.format, Some(OutputFormat::Html));
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--format", "markdown"]).unwrap();
+        assert_eq!(cli.format, Some(OutputFormat::Markdown));
+    }
+
+    #[test]
+    fn test_cli_parse_with_detail() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--detail"]).unwrap();
+
+        assert!(cli.detail);
+    }
+
+    #[test]
+    fn test_cli_parse_with_short_options() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "-f", "detail", "-d"]).unwrap();
+
+        assert_eq!(cli.format, Some(OutputFormat::Detail));
+        assert!(cli.detail);
+    }
+
+    #[test]
+    fn test_cli_parse_with_ignore_patterns() {
+        let cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "src",
+            "--ignore",
+            "target",
+            "--ignore",
+            ".git",
+        ])
+        .unwrap();
+
+        assert_eq!(cli.ignore, vec!["target", ".git"]);
+    }
+
+    #[test]
+    fn test_cli_include_and_exclude_follow_the_config_file() {
+        let mut cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "src",
+            "--exclude",
+            "testdata/",
+            "--exclude",
+            "!testdata/keep.rs",
+            "--include",
+            "*.go",
+        ])
+        .unwrap();
+        cli.apply_config(Config {
+            include: vec!["src/**".to_string()],
+            exclude: vec!["vendor".to_string()],
+            ..Default::default()
+        });
+
+        let options = cli.directory_options();
+        assert_eq!(options.include, vec!["src/**", "*.go"]);
+        assert_eq!(
+            options.exclude,
+            vec!["vendor", "testdata/", "!testdata/keep.rs"]
+        );
+    }
+
+    #[test]
+    fn test_cli_parse_with_follow_links() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--follow-links"]).unwrap();
+
+        assert!(cli.follow_links);
+    }
+
+    #[test]
+    fn test_cli_parse_max_parse_size() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--max-parse-size", "8"]).unwrap();
+        assert_eq!(cli.max_parse_size, Some(8));
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "src"]).unwrap();
+        assert_eq!(cli.max_parse_size, None);
+    }
+
+    #[test]
+    fn test_cli_parse_parse_timeout() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--parse-timeout", "5"]).unwrap();
+        assert_eq!(cli.parse_timeout, Some(5));
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "src"]).unwrap();
+        assert_eq!(cli.parse_timeout, None);
+    }
+
+    #[test]
+    fn test_cli_parse_tab_width() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--tab-width", "4"]).unwrap();
+        assert_eq!(cli.tab_width, Some(4));
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "src"]).unwrap();
+        assert_eq!(cli.tab_width, None);
+    }
+
+    #[test]
+    fn test_cli_parse_embedded_lua() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "deploy", "--embedded-lua"]).unwrap();
+        assert!(cli.embedded_lua);
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "deploy"]).unwrap();
+        assert!(!cli.embedded_lua);
+    }
+
+    #[test]
+    fn test_cli_parse_template_code() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "app/views", "--template-code"]).unwrap();
+        assert!(cli.template_code);
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "app/views"]).unwrap();
+        assert!(!cli.template_code);
+    }
+
+    #[test]
+    fn test_cli_parse_plugins() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--plugins"]).unwrap();
+        assert!(cli.plugins);
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "src"]).unwrap();
+        assert!(!cli.plugins);
+    }
+
+    #[test]
+    fn test_cli_parse_profile() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--profile"]).unwrap();
+        assert_eq!(cli.profile, Some(10));
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--profile", "3"]).unwrap();
+        assert_eq!(cli.profile, Some(3));
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "src"]).unwrap();
+        assert_eq!(cli.profile, None);
+    }
+
+    #[test]
+    fn test_cli_parse_with_skip_links() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--skip-links"]).unwrap();
+
+        assert!(cli.skip_links);
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "src", "--skip-links", "--follow-links"])
+                .is_err()
+        );
+    }
+
+    #[test]
+    fn test_cli_parse_with_max_depth() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--max-depth", "5"]).unwrap();
+
+        assert_eq!(cli.max_depth, 5);
+    }
+
+    #[test]
+    fn test_cli_parse_with_no_gitignore() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--no-gitignore"]).unwrap();
+
+        assert!(cli.no_gitignore);
+    }
+
+    #[test]
+    fn test_cli_parse_with_complexity_threshold() {
+        let cli =
+            Cli::try_parse_from(["code-stats-rs", "src", "--complexity-threshold", "4"]).unwrap();
+
+        assert_eq!(cli.thresholds().complexity, 4);
+    }
+
+    #[test]
+    fn test_cli_parse_with_jobs() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--jobs", "8"]).unwrap();
+        assert_eq!(cli.jobs, 8);
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "-j", "2"]).unwrap();
+        assert_eq!(cli.jobs, 2);
+    }
+
+    #[test]
+    fn test_cli_parse_cache_flags() {
+        let cli =
+            Cli::try_parse_from(["code-stats-rs", "src", "--no-cache", "--clear-cache"]).unwrap();
+        assert!(cli.no_cache);
+        assert!(cli.clear_cache);
+    }
+
+    #[test]
+    fn test_cli_parse_watch() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--watch"]).unwrap();
+        assert!(cli.watch);
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "-w"]).unwrap();
+        assert!(cli.watch);
+    }
+
+    #[test]
+    fn test_cli_parse_functions_with_sort() {
+        let cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "src",
+            "--functions",
+            "--sort",
+            "complexity",
+        ])
+        .unwrap();
+        assert!(cli.functions);
+        assert_eq!(cli.sort, FunctionSort::Complexity);
+
+        // Sorting only applies to the function listing
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--sort", "lines"]).is_err());
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "src", "--functions", "--sort", "size"]).is_err()
+        );
+    }
+
+    #[test]
+    fn test_cli_parse_implementations() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--implementations"]).unwrap();
+        assert!(cli.implementations);
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "src", "--implementations", "--deps"]).is_err()
+        );
+        assert!(
+            Cli::try_parse_from([
+                "code-stats-rs",
+                "src",
+                "--implementations",
+                "--group-by",
+                "type"
+            ])
+            .is_err()
+        );
+        assert!(
+            Cli::try_parse_from([
+                "code-stats-rs",
+                "src",
+                "--implementations",
+                "--output",
+                "sqlite:stats.db"
+            ])
+            .is_err()
+        );
+    }
+
+    #[test]
+    fn test_cli_modes_are_exclusive() {
+        let flag = |mode: &str| -> Vec<String> {
+            let name = format!("--{}", mode.replace('_', "-"));
+            match mode {
+                "group_by" => vec![name, "dir".to_string()],
+                "diff" => vec![name, "main".to_string()],
+                "output" => vec![name, "sqlite:stats.db".to_string()],
+                _ => vec![name],
+            }
+        };
+        for mode in MODES {
+            let args = [
+                vec!["code-stats-rs".to_string(), "src".to_string()],
+                flag(mode),
+            ]
+            .concat();
+            assert!(Cli::try_parse_from(&args).is_ok(), "{mode}");
+            for other in MODES.iter().filter(|other| **other != mode) {
+                let both = [args.clone(), flag(other)].concat();
+                assert!(Cli::try_parse_from(&both).is_err(), "{mode} with {other}");
+            }
+        }
+        for mode in REPORT_MODES {
+            let args = [
+                vec!["code-stats-rs".to_string(), "src".to_string()],
+                flag(mode),
+            ]
+            .concat();
+            assert!(
+                Cli::try_parse_from([args.clone(), vec!["--watch".to_string()]].concat()).is_err()
+            );
+        }
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--watch", "--todos"]).is_ok());
+    }
+
+    #[test]
+    fn test_cli_parse_graphql_schema() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "schema", "--graphql-schema"]).unwrap();
+        assert!(cli.graphql_schema);
+        assert!(
+            Cli::try_parse_from([
+                "code-stats-rs",
+                "schema",
+                "--graphql-schema",
+                "--proto-inventory"
+            ])
+            .is_err()
+        );
+        assert!(
+            Cli::try_parse_from([
+                "code-stats-rs",
+                "schema",
+                "--graphql-schema",
+                "--identifiers"
+            ])
+            .is_err()
+        );
+    }
+
+    #[test]
+    fn test_cli_parse_proto_inventory() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "api", "--proto-inventory"]).unwrap();
+        assert!(cli.proto_inventory);
+
+        // The inventory replaces the other listings
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "api", "--proto-inventory", "--functions"])
+                .is_err()
+        );
+        assert!(
+            Cli::try_parse_from([
+                "code-stats-rs",
+                "api",
+                "--proto-inventory",
+                "--group-by",
+                "dir"
+            ])
+            .is_err()
+        );
+    }
+
+    #[test]
+    fn test_cli_parse_api_surface() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "pkg", "--api-surface"]).unwrap();
+        assert!(cli.api_surface);
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "pkg", "--api-surface", "--proto-inventory"])
+                .is_err()
+        );
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "pkg", "--api-surface", "--group-by", "dir"])
+                .is_err()
+        );
+    }
+
+    #[test]
+    fn test_cli_parse_deps() {
+        let cli =
+            Cli::try_parse_from(["code-stats-rs", "src", "--deps", "--format", "dot"]).unwrap();
+        assert!(cli.deps);
+        assert_eq!(cli.format, Some(OutputFormat::Dot));
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--deps", "--functions"]).is_err());
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "src", "--deps", "--group-by", "dir"]).is_err()
+        );
+    }
+
+    #[test]
+    fn test_cli_parse_todos() {
+        let cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "src",
+            "--todos",
+            "--blame",
+            "--todo-markers",
+            "TODO,SAFETY",
+        ])
+        .unwrap();
+        assert!(cli.todos && cli.blame);
+        assert_eq!(cli.todo_markers, ["TODO", "SAFETY"]);
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--blame"]).is_err());
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--todos", "--deps"]).is_err());
+    }
+
+    #[test]
+    fn test_cli_parse_csv_level() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--format", "csv"]).unwrap();
+        assert_eq!(cli.format, Some(OutputFormat::Csv));
+        assert_eq!(cli.level, Level::File);
+
+        let cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "src",
+            "--format",
+            "csv",
+            "--level",
+            "function",
+        ])
+        .unwrap();
+        assert_eq!(cli.level, Level::Function);
+    }
+
+    #[test]
+    fn test_cli_parse_tokens() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--tokens", "--fit-budget", "8000"])
+            .unwrap();
+        assert!(cli.tokens);
+        assert_eq!(cli.fit_budget, Some(8000));
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--fit-budget", "8000"]).is_err());
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--tokens", "--todos"]).is_err());
+    }
+
+    #[test]
+    fn test_cli_parse_lint() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--lint"]).unwrap();
+        assert!(cli.lint);
+        assert!(
+            Cli::try_parse_from([
+                "code-stats-rs",
+                "src",
+                "--lint",
+                "--output",
+                "sqlite:stats.db"
+            ])
+            .is_err()
+        );
+    }
+
+    #[test]
+    fn test_cli_parse_distribution() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--distribution"]).unwrap();
+        assert!(cli.distribution);
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "src", "--distribution", "--tokens"]).is_err()
+        );
+        assert!(
+            Cli::try_parse_from([
+                "code-stats-rs",
+                "src",
+                "--distribution",
+                "--output",
+                "sqlite:stats.db"
+            ])
+            .is_err()
+        );
+    }
+
+    #[test]
+    fn test_cli_parse_licenses() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--licenses"]).unwrap();
+        assert!(cli.licenses && !cli.require_header);
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--require-header"]).unwrap();
+        assert!(cli.require_header);
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--licenses", "--todos"]).is_err());
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "src", "--require-header", "--identifiers"])
+                .is_err()
+        );
+    }
+
+    #[test]
+    fn test_cli_parse_identifiers() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--identifiers"]).unwrap();
+        assert!(cli.identifiers);
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "src", "--identifiers", "--strings"]).is_err()
+        );
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "src", "--identifiers", "--group-by", "dir"])
+                .is_err()
+        );
+    }
+
+    #[test]
+    fn test_cli_parse_strings() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--strings"]).unwrap();
+        assert!(cli.strings);
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--strings", "--todos"]).is_err());
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "src", "--strings", "--group-by", "dir"])
+                .is_err()
+        );
+    }
+
+    #[test]
+    fn test_cli_parse_call_graph() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--call-graph", "--format", "dot"])
+            .unwrap();
+        assert!(cli.call_graph);
+        assert!(!cli.unreached);
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--unreached"]).unwrap();
+        assert!(cli.unreached);
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "src", "--call-graph", "--unreached"]).is_err()
+        );
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--unreached", "--deps"]).is_err());
+    }
+
+    #[test]
+    fn test_cli_parse_sarif_with_length_threshold() {
+        let cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "src",
+            "--format",
+            "sarif",
+            "--max-function-lines",
+            "40",
+        ])
+        .unwrap();
+        assert_eq!(cli.format, Some(OutputFormat::Sarif));
+        assert_eq!(cli.max_function_lines, Some(40));
+    }
+
+    #[test]
+    fn test_cli_parse_ci_annotation_formats() {
+        for (name, format) in [
+            ("github-annotations", OutputFormat::GithubAnnotations),
+            ("gitlab-codequality", OutputFormat::GitlabCodequality),
+        ] {
+            let cli = Cli::try_parse_from(["code-stats-rs", "src", "--format", name]).unwrap();
+            assert_eq!(cli.format, Some(format));
+        }
+    }
+
+    #[test]
+    fn test_cli_parse_queries() {
+        let cli =
+            Cli::try_parse_from(["code-stats-rs", "src", "--queries", "queries.toml"]).unwrap();
+        assert_eq!(cli.queries, Some(PathBuf::from("queries.toml")));
+    }
 
-    /// Output format
-    #[arg(short, long, value_enum, default_value_t = OutputFormat::Summary)]
-    pub format: OutputFormat,
+    #[test]
+    fn test_cli_parse_duplicates() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--duplicates"]).unwrap();
+        assert!(cli.duplicates);
+        assert_eq!(cli.min_clone_tokens, DEFAULT_MIN_TOKENS);
 
-    /// Show detailed statistics for each file
-    #[arg(short, long)]
-    pub detail: bool,
+        let cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "src",
+            "--duplicates",
+            "--min-clone-tokens",
+            "80",
+        ])
+        .unwrap();
+        assert_eq!(cli.min_clone_tokens, 80);
 
-    /// File patterns to ignore (can be used multiple times)
-    #[arg(long, value_name = "PATTERN")]
-    pub ignore: Vec<String>,
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--min-clone-tokens", "80"]).is_err());
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--duplicates", "--watch"]).is_err());
+    }
 
-    /// Follow symbolic links
-    #[arg(long)]
-    pub follow_links: bool,
+    #[test]
+    fn test_cli_parse_lang_map() {
+        let cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "src",
+            "--lang-map",
+            "h=cpp,inc=c",
+            "--lang-map",
+            "Jenkinsfile=java",
+        ])
+        .unwrap();
+        assert_eq!(cli.lang_map, vec!["h=cpp", "inc=c", "Jenkinsfile=java"]);
+    }
 
-    /// Maximum depth for directory traversal
-    #[arg(long, default_value_t = 100)]
-    pub max_depth: usize,
-}
+    #[test]
+    fn test_cli_parse_stdin_and_snippet() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "-", "--lang", "go"]).unwrap();
+        assert_eq!(cli.path, Some(PathBuf::from("-")));
+        assert_eq!(cli.lang.as_deref(), Some("go"));
+        assert_eq!(cli.target_path(), Path::new("."));
+        assert!(Cli::try_parse_from(["code-stats-rs", "-", "--lang", "go", "--watch"]).is_err());
 
-impl Cli {
-    /// Executes the code analysis based on CLI arguments.
-    ///
-    /// This method implements the main execution flow:
-    /// 1. Creates a new analyzer instance
-    /// 2. Determines whether the path is a file or directory
-    /// 3. Runs the appropriate analysis
-    /// 4. Formats and displays the results based on the selected output format
-    ///
-    /// # Output Format Logic
-    ///
-    /// The output format is determined by a combination of `--format` and `--detail` flags:
-    /// - If `--detail` is specified with the default Summary format, it automatically
-    ///   switches to Detail format for backward compatibility
-    /// - Otherwise, the explicitly specified format is used
-    ///
-    /// # Returns
-    ///
-    /// * `Ok(())` if analysis completes successfully
-    /// * `Err(String)` with error message if analysis fails
-    pub fn run(self) -> Result<(), String> {
-        use crate::analyzer::CodeAnalyzer;
-        use crate::formatter::{format_output, format_single_file};
+        let cli = Cli::try_parse_from(["code-stats-rs", "snippet", "func f(){}", "--lang", "go"])
+            .unwrap();
+        match cli.command {
+            Some(Command::Snippet(args)) => {
+                assert_eq!(args.code, "func f(){}");
+                assert_eq!(args.lang, "go");
+                assert_eq!(args.format, None);
+            }
+            other => panic!("unexpected command: {other:?}"),
+        }
+        assert!(Cli::try_parse_from(["code-stats-rs", "snippet", "func f(){}"]).is_err());
+    }
+
+    #[test]
+    fn test_cli_parse_git_ref() {
+        let cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "https://github.com/org/repo",
+            "--ref",
+            "v1.2.0",
+        ])
+        .unwrap();
+        assert_eq!(cli.git_ref.as_deref(), Some("v1.2.0"));
+        // The configuration of a remote repository is not on disk
+        assert_eq!(cli.target_path(), Path::new("."));
+        assert!(Cli::try_parse_from(["code-stats-rs", ".", "--ref", "main", "--watch"]).is_err());
+    }
 
+    #[test]
+    fn test_analyze_snippet() {
         let mut analyzer = CodeAnalyzer::new();
+        let file_stats = analyze_snippet(
+            &mut analyzer,
+            SNIPPET_NAME,
+            "rust",
+            "fn f() {}\nfn g() {}\n",
+        )
+        .unwrap();
+        assert_eq!(file_stats.path, PathBuf::from("<snippet>"));
+        assert_eq!(file_stats.stats.function_count, 2);
 
-        if self.path.is_file() {
-            // Single file analysis
-            match analyzer.analyze_file(&self.path) {
-                Ok(file_stats) => {
-                    println!("{}", format_single_file(&file_stats));
-                    Ok(())
-                }
-                Err(e) => Err(e.to_string()),
-            }
-        } else if self.path.is_dir() {
-            // Directory analysis
-            match analyzer.analyze_directory(
-                &self.path,
-                self.max_depth,
-                self.follow_links,
-                &self.ignore,
-            ) {
-                Ok(stats) => {
-                    // Determine output format based on --detail flag compatibility
-                    let format = if self.detail && self.format == OutputFormat::Summary {
-                        // When --detail is used with default Summary format,
-                        // switch to Detail format for backward compatibility
-                        OutputFormat::Detail
-                    } else {
-                        // Use the explicitly specified format
-                        self.format
-                    };
+        let err = analyze_snippet(&mut analyzer, STDIN_NAME, "cobol", "").unwrap_err();
+        assert_eq!(err, "unknown language 'cobol' for --lang");
+    }
 
-                    println!("{}", format_output(&stats, format, self.detail));
-                    Ok(())
-                }
-                Err(e) => Err(e.to_string()),
+    #[test]
+    fn test_cli_parse_include_generated() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--include-generated"]).unwrap();
+        assert!(cli.include_generated);
+        assert!(cli.directory_options().include_generated);
+    }
+
+    #[test]
+    fn test_cli_parse_grammar_dir() {
+        let cli =
+            Cli::try_parse_from(["code-stats-rs", "src", "--grammar-dir", "grammars"]).unwrap();
+        assert_eq!(cli.grammar_dir, Some(PathBuf::from("grammars")));
+    }
+
+    #[test]
+    fn test_cli_parse_diff() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--diff", "main"]).unwrap();
+        assert_eq!(cli.diff.as_deref(), Some("main"));
+
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "src", "--diff", "main", "--watch"]).is_err()
+        );
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--diff"]).is_err());
+    }
+
+    #[test]
+    fn test_cli_parse_emit_tags() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--emit-tags"]).unwrap();
+        assert_eq!(cli.emit_tags, Some(PathBuf::from("tags")));
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--emit-tags", "-"]).unwrap();
+        assert_eq!(cli.emit_tags, Some(PathBuf::from("-")));
+
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "src", "--emit-tags", "--functions"]).is_err()
+        );
+    }
+
+    #[test]
+    fn test_cli_parse_baseline_write() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "baseline", "write"]).unwrap();
+        assert!(cli.path.is_none());
+        match cli.command {
+            Some(Command::Baseline {
+                action: BaselineCommand::Write { path, output },
+            }) => {
+                assert_eq!(path, PathBuf::from("."));
+                assert_eq!(output, PathBuf::from(BASELINE_FILE));
             }
-        } else {
-            Err(format!(
-                "{} is neither a file nor a directory",
-                self.path.display()
-            ))
+            other => panic!("unexpected command: {other:?}"),
         }
     }
-}
 
-/// Available output formats for the analysis results.
-///
-/// Each format provides a different level of detail and structure
-/// for the code statistics output.
-#[derive(Copy, Clone, Debug, PartialEq, Eq, PartialOrd, Ord, ValueEnum)]
-pub enum OutputFormat {
-    /// Summary statistics only
-    Summary,
-    /// Detailed file-by-file breakdown
-    Detail,
-    /// JSON output
-    Json,
-}
+    #[test]
+    fn test_cli_parse_check() {
+        let cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "check",
+            "src",
+            "--baseline",
+            "baseline.json",
+            "--complexity-tolerance",
+            "2",
+            "--ignore",
+            "vendor",
+            "-j",
+            "1",
+        ])
+        .unwrap();
+        // Traversal options are global
+        assert_eq!(cli.ignore, vec!["vendor"]);
+        assert_eq!(cli.jobs, 1);
+        match cli.command {
+            Some(Command::Check(args)) => {
+                assert_eq!(args.path, PathBuf::from("src"));
+                assert_eq!(args.baseline, PathBuf::from("baseline.json"));
+                assert_eq!(args.complexity_tolerance, 2);
+                assert_eq!(args.function_lines_tolerance, 0);
+                assert_eq!(args.file_count_tolerance, 0);
+                assert_eq!(args.max_params, None);
+            }
+            other => panic!("unexpected command: {other:?}"),
+        }
 
-#[cfg(test)]
-mod tests {
-    use super::*;
-    use clap::CommandFactory;
+        // Analysis-only options don't combine with subcommands
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "check"]).is_err());
+    }
 
     #[test]
-    fn test_cli_parse_basic() {
-        let cli = Cli::try_parse_from(["code-stats-rs", "src/main.rs"]).unwrap();
+    fn test_apply_config_keeps_command_line_values() {
+        use crate::config::ThresholdConfig;
 
-        assert_eq!(cli.path, PathBuf::from("src/main.rs"));
-        assert_eq!(cli.format, OutputFormat::Summary);
-        assert!(!cli.detail);
-        assert!(cli.ignore.is_empty());
-        assert!(!cli.follow_links);
-        assert_eq!(cli.max_depth, 100);
+        let mut cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "src",
+            "--complexity-threshold",
+            "4",
+            "--queries",
+            "mine.toml",
+        ])
+        .unwrap();
+        cli.apply_config(Config {
+            root: Some(PathBuf::from("/repo")),
+            exclude: vec!["vendor".to_string()],
+            format: Some(OutputFormat::Json),
+            queries: Some(PathBuf::from("/repo/queries.toml")),
+            thresholds: ThresholdConfig {
+                complexity: Some(15),
+                function_lines: Some(80),
+                ..Default::default()
+            },
+            ..Default::default()
+        });
+
+        assert_eq!(cli.format, Some(OutputFormat::Json));
+        assert_eq!(
+            cli.thresholds(),
+            Thresholds {
+                complexity: 4,
+                function_lines: 80,
+            }
+        );
+        assert_eq!(cli.queries, Some(PathBuf::from("mine.toml")));
+        let options = cli.directory_options();
+        assert_eq!(options.exclude, vec!["vendor"]);
+        assert_eq!(options.glob_root, Some(PathBuf::from("/repo")));
     }
 
     #[test]
-    fn test_cli_parse_with_format() {
-        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--format", "json"]).unwrap();
+    fn test_apply_config_fills_check_limits() {
+        use crate::config::ThresholdConfig;
+
+        let mut cli = Cli::try_parse_from(["code-stats-rs", "check", "--max-params", "3"]).unwrap();
+        cli.apply_config(Config {
+            thresholds: ThresholdConfig {
+                parameters: Some(5),
+                returns: Some(2),
+                ..Default::default()
+            },
+            ..Default::default()
+        });
 
-        assert_eq!(cli.path, PathBuf::from("src"));
-        assert_eq!(cli.format, OutputFormat::Json);
+        match cli.command {
+            Some(Command::Check(args)) => {
+                assert_eq!(args.max_params, Some(3));
+                assert_eq!(args.max_returns, Some(2));
+            }
+            other => panic!("unexpected command: {other:?}"),
+        }
     }
 
     #[test]
-    fn test_cli_parse_with_detail() {
-        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--detail"]).unwrap();
+    fn test_cli_parse_group_by() {
+        let cli =
+            Cli::try_parse_from(["code-stats-rs", "src", "--group-by", "dir", "--depth", "2"])
+                .unwrap();
+        assert_eq!(cli.group_by, Some(GroupBy::Dir));
+        assert_eq!(cli.depth, Some(2));
 
-        assert!(cli.detail);
+        // --depth only applies to the tree
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--depth", "2"]).is_err());
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "src", "--group-by", "dir", "--functions"])
+                .is_err()
+        );
+
+        let cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "src",
+            "--group-by",
+            "type",
+            "--merge-partial",
+            "--max-type-members",
+            "20",
+        ])
+        .unwrap();
+        assert_eq!(cli.group_by, Some(GroupBy::Type));
+        assert!(cli.merge_partial);
+        assert_eq!(cli.max_type_members, Some(20));
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--merge-partial"]).is_err());
     }
 
     #[test]
-    fn test_cli_parse_with_short_options() {
-        let cli = Cli::try_parse_from(["code-stats-rs", "src", "-f", "detail", "-d"]).unwrap();
+    fn test_cli_parse_top() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "top"]).unwrap();
+        match cli.command {
+            Some(Command::Top(args)) => {
+                assert_eq!(args.path, PathBuf::from("."));
+                assert_eq!(args.by, TopMetric::Loc);
+                assert_eq!(args.limit, 20);
+                assert_eq!(args.format, None);
+            }
+            other => panic!("unexpected command: {other:?}"),
+        }
 
-        assert_eq!(cli.format, OutputFormat::Detail);
-        assert!(cli.detail);
+        let cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "top",
+            "src",
+            "--by",
+            "complexity",
+            "--limit",
+            "5",
+            "-f",
+            "json",
+        ])
+        .unwrap();
+        match cli.command {
+            Some(Command::Top(args)) => {
+                assert_eq!(args.path, PathBuf::from("src"));
+                assert_eq!(args.by, TopMetric::Complexity);
+                assert_eq!(args.limit, 5);
+                assert_eq!(args.format, Some(OutputFormat::Json));
+            }
+            other => panic!("unexpected command: {other:?}"),
+        }
+
+        assert!(Cli::try_parse_from(["code-stats-rs", "top", "--by", "size"]).is_err());
     }
 
     #[test]
-    fn test_cli_parse_with_ignore_patterns() {
+    fn test_cli_parse_output() {
+        let cli =
+            Cli::try_parse_from(["code-stats-rs", "src", "--output", "sqlite:stats.db"]).unwrap();
+        assert_eq!(
+            cli.output,
+            Some(OutputTarget::Sqlite(PathBuf::from("stats.db")))
+        );
+
+        for target in ["stats.db", "sqlite:", "postgres:stats"] {
+            assert!(
+                Cli::try_parse_from(["code-stats-rs", "src", "--output", target]).is_err(),
+                "{target}"
+            );
+        }
+        assert!(
+            Cli::try_parse_from([
+                "code-stats-rs",
+                "src",
+                "--output",
+                "sqlite:stats.db",
+                "--watch"
+            ])
+            .is_err()
+        );
+    }
+
+    #[test]
+    fn test_cli_parse_by_author() {
+        let cli =
+            Cli::try_parse_from(["code-stats-rs", "src", "--by-author", "--codeowners"]).unwrap();
+        assert!(cli.by_author && cli.codeowners);
+
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--codeowners"]).is_err());
+        assert!(Cli::try_parse_from(["code-stats-rs", "src", "--by-author", "--todos"]).is_err());
+    }
+
+    #[test]
+    fn test_cli_parse_history() {
+        let cli =
+            Cli::try_parse_from(["code-stats-rs", "history", "--since", "2023-01-01"]).unwrap();
+        match cli.command {
+            Some(Command::History(args)) => {
+                assert_eq!(args.path, PathBuf::from("."));
+                assert_eq!(args.since.to_string(), "2023-01-01");
+                assert_eq!(args.until, None);
+                assert_eq!(args.step, HistoryStep::Monthly);
+            }
+            other => panic!("unexpected command: {other:?}"),
+        }
+
         let cli = Cli::try_parse_from([
             "code-stats-rs",
+            "history",
             "src",
-            "--ignore",
-            "target",
-            "--ignore",
-            ".git",
+            "--since",
+            "2023-01-01",
+            "--until",
+            "2023-12-31",
+            "--step",
+            "quarterly",
+            "-f",
+            "csv",
         ])
         .unwrap();
+        match cli.command {
+            Some(Command::History(args)) => {
+                assert_eq!(
+                    args.until.map(|date| date.to_string()).as_deref(),
+                    Some("2023-12-31")
+                );
+                assert_eq!(args.step, HistoryStep::Quarterly);
+                assert_eq!(args.format, Some(OutputFormat::Csv));
+            }
+            other => panic!("unexpected command: {other:?}"),
+        }
 
-        assert_eq!(cli.ignore, vec!["target", ".git"]);
+        assert!(Cli::try_parse_from(["code-stats-rs", "history"]).is_err());
+        assert!(
+            Cli::try_parse_from(["code-stats-rs", "history", "--since", "2023-02-30"]).is_err()
+        );
     }
 
     #[test]
-    fn test_cli_parse_with_follow_links() {
-        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--follow-links"]).unwrap();
+    fn test_cli_parse_hotspots() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "hotspots"]).unwrap();
+        match cli.command {
+            Some(Command::Hotspots(args)) => {
+                assert_eq!(args.path, PathBuf::from("."));
+                assert_eq!(args.since, None);
+                assert_eq!(args.limit, 20);
+            }
+            other => panic!("unexpected command: {other:?}"),
+        }
 
-        assert!(cli.follow_links);
+        let cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "hotspots",
+            "src",
+            "--since",
+            "6 months ago",
+            "--limit",
+            "5",
+        ])
+        .unwrap();
+        assert_eq!(cli.target_path(), Path::new("src"));
+        match cli.command {
+            Some(Command::Hotspots(args)) => {
+                assert_eq!(args.since.as_deref(), Some("6 months ago"));
+                assert_eq!(args.limit, 5);
+            }
+            other => panic!("unexpected command: {other:?}"),
+        }
     }
 
     #[test]
-    fn test_cli_parse_with_max_depth() {
-        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--max-depth", "5"]).unwrap();
+    fn test_cli_parse_badge() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "badge", "--metric", "coverage-of-docs"])
+            .unwrap();
+        match cli.command {
+            Some(Command::Badge(args)) => {
+                assert_eq!(args.path, PathBuf::from("."));
+                assert_eq!(args.metric, BadgeMetric::CoverageOfDocs);
+                assert_eq!(args.output, PathBuf::from("badge.svg"));
+            }
+            other => panic!("unexpected command: {other:?}"),
+        }
 
-        assert_eq!(cli.max_depth, 5);
+        assert!(Cli::try_parse_from(["code-stats-rs", "badge"]).is_err());
+        assert!(Cli::try_parse_from(["code-stats-rs", "badge", "--metric", "stars"]).is_err());
+    }
+
+    #[test]
+    fn test_cli_parse_tui() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "tui"]).unwrap();
+        assert_eq!(cli.target_path(), Path::new("."));
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "tui", "src"]).unwrap();
+        match cli.command {
+            Some(Command::Tui(args)) => assert_eq!(args.path, PathBuf::from("src")),
+            other => panic!("unexpected command: {other:?}"),
+        }
+    }
+
+    #[test]
+    fn test_cli_parse_treemap() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "treemap"]).unwrap();
+        match cli.command {
+            Some(Command::Treemap(args)) => {
+                assert_eq!(args.path, PathBuf::from("."));
+                assert_eq!(args.output, PathBuf::from("treemap.html"));
+            }
+            other => panic!("unexpected command: {other:?}"),
+        }
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "treemap", "src", "-o", "-"]).unwrap();
+        assert_eq!(cli.target_path(), Path::new("src"));
+    }
+
+    #[test]
+    fn test_cli_parse_compare() {
+        let cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "compare",
+            "v1.json",
+            "v2.json",
+            "--fail-on-increase",
+            "complexity,lines",
+        ])
+        .unwrap();
+        match cli.command {
+            Some(Command::Compare(args)) => {
+                assert_eq!(args.old, PathBuf::from("v1.json"));
+                assert_eq!(args.new, PathBuf::from("v2.json"));
+                assert_eq!(
+                    args.fail_on_increase,
+                    [CompareMetric::Complexity, CompareMetric::Lines]
+                );
+            }
+            other => panic!("unexpected command: {other:?}"),
+        }
+
+        assert!(Cli::try_parse_from(["code-stats-rs", "compare", "v1.json"]).is_err());
+        assert!(
+            Cli::try_parse_from([
+                "code-stats-rs",
+                "compare",
+                "v1.json",
+                "v2.json",
+                "--fail-on-increase",
+                "files"
+            ])
+            .is_err()
+        );
+    }
+
+    #[test]
+    fn test_cli_parse_hook() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "hook"]).unwrap();
+        assert_eq!(cli.target_path(), Path::new("."));
+        match cli.command {
+            Some(Command::Hook(args)) => assert!(args.paths.is_empty()),
+            other => panic!("unexpected command: {other:?}"),
+        }
+
+        // pre-commit passes the staged files as arguments
+        let cli =
+            Cli::try_parse_from(["code-stats-rs", "hook", "src/lib.rs", "src/main.rs"]).unwrap();
+        match cli.command {
+            Some(Command::Hook(args)) => assert_eq!(
+                args.paths,
+                vec![PathBuf::from("src/lib.rs"), PathBuf::from("src/main.rs")]
+            ),
+            other => panic!("unexpected command: {other:?}"),
+        }
+    }
+
+    #[test]
+    fn test_cli_parse_workspace() {
+        let cli = Cli::try_parse_from([
+            "code-stats-rs",
+            "workspace",
+            "../billing",
+            "../search",
+            "--format",
+            "csv",
+        ])
+        .unwrap();
+        match cli.command {
+            Some(Command::Workspace(args)) => {
+                assert_eq!(
+                    args.paths,
+                    vec![PathBuf::from("../billing"), PathBuf::from("../search")]
+                );
+                assert_eq!(args.manifest, None);
+                assert_eq!(args.format, Some(OutputFormat::Csv));
+            }
+            other => panic!("unexpected command: {other:?}"),
+        }
+
+        let cli =
+            Cli::try_parse_from(["code-stats-rs", "workspace", "--manifest", "repos.txt"]).unwrap();
+        match cli.command {
+            Some(Command::Workspace(args)) => {
+                assert!(args.paths.is_empty());
+                assert_eq!(args.manifest, Some(PathBuf::from("repos.txt")));
+            }
+            other => panic!("unexpected command: {other:?}"),
+        }
+
+        // Something has to be analyzed
+        assert!(Cli::try_parse_from(["code-stats-rs", "workspace"]).is_err());
+    }
+
+    #[test]
+    fn test_cli_parse_languages() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "languages", "--format", "json"]).unwrap();
+        assert_eq!(cli.target_path(), Path::new("."));
+        match cli.command {
+            Some(Command::Languages(args)) => assert_eq!(args.format, Some(OutputFormat::Json)),
+            other => panic!("unexpected command: {other:?}"),
+        }
+    }
+
+    #[test]
+    fn test_cli_parse_serve() {
+        let cli = Cli::try_parse_from(["code-stats-rs", "serve"]).unwrap();
+        match cli.command {
+            Some(Command::Serve(args)) => {
+                assert_eq!(args.path, PathBuf::from("."));
+                assert_eq!(args.listen, "127.0.0.1:9100");
+            }
+            other => panic!("unexpected command: {other:?}"),
+        }
+
+        let cli =
+            Cli::try_parse_from(["code-stats-rs", "serve", "src", "--listen", ":9200"]).unwrap();
+        assert_eq!(cli.target_path(), Path::new("src"));
+        match cli.command {
+            Some(Command::Serve(args)) => assert_eq!(args.listen, ":9200"),
+            other => panic!("unexpected command: {other:?}"),
+        }
+
+        let cli = Cli::try_parse_from(["code-stats-rs", "src", "--format", "prometheus"]).unwrap();
+        assert_eq!(cli.format, Some(OutputFormat::Prometheus));
     }
 
     #[test]
@@ -203,8 +3047,8 @@ mod tests {
         ])
         .unwrap();
 
-        assert_eq!(cli.path, PathBuf::from("/path/to/analyze"));
-        assert_eq!(cli.format, OutputFormat::Json);
+        assert_eq!(cli.path, Some(PathBuf::from("/path/to/analyze")));
+        assert_eq!(cli.format, Some(OutputFormat::Json));
         assert!(cli.detail);
         assert_eq!(cli.ignore, vec!["node_modules", "vendor"]);
         assert!(cli.follow_links);
@@ -289,6 +3133,10 @@ mod tests {
                 .any(|arg| arg.get_id() == "follow_links")
         );
         assert!(cmd.get_arguments().any(|arg| arg.get_id() == "max_depth"));
+        assert!(
+            cmd.get_arguments()
+                .any(|arg| arg.get_id() == "no_gitignore")
+        );
     }
 
     #[test]
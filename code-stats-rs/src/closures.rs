@@ -0,0 +1,330 @@
+//! Anonymous functions, closures, and lambdas in Go, JavaScript, TypeScript,
+//! Python, and Rust.
+//!
+//! Callback-heavy code keeps much of its logic in functions without a name
+//! of their own: Go function literals, JavaScript and TypeScript arrow
+//! functions and unnamed function expressions, Python lambdas, and Rust
+//! closures. They are counted apart from named declarations, with their
+//! depth: a closure directly in a named function, or at the top level of a
+//! file, is at depth 1, one inside it at depth 2, and so on. A named function
+//! declared inside a closure starts over at depth 0, and its closures count
+//! for it rather than for the function around it.
+//!
+//! JavaScript and TypeScript arrow functions and function expressions are
+//! reported as functions of their own as well, so they also appear in the
+//! function counts; closures of the other languages only appear here.
+
+use crate::language::SupportedLanguage;
+use serde::{Deserialize, Serialize};
+use tree_sitter::Node;
+
+/// Anonymous functions of a file or a group of files.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct ClosureStats {
+    /// Number of anonymous functions, closures, and lambdas
+    pub count: usize,
+    /// Number of them inside another anonymous function
+    pub nested: usize,
+    /// Number of them outside any named function, such as callbacks
+    /// registered at the top level of a module
+    pub top_level: usize,
+    /// Deepest nesting of anonymous functions, 0 without any
+    pub max_depth: usize,
+}
+
+impl ClosureStats {
+    /// Adds the counts of `other` and keeps the deeper nesting.
+    pub(crate) fn merge(&mut self, other: &ClosureStats) {
+        self.count += other.count;
+        self.nested += other.nested;
+        self.top_level += other.top_level;
+        self.max_depth = self.max_depth.max(other.max_depth);
+    }
+
+    /// Returns true if no anonymous function was found.
+    pub(crate) fn is_empty(&self) -> bool {
+        self.count == 0
+    }
+}
+
+/// Counts the anonymous functions of a parsed file.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the parsed file
+/// * `language` - The programming language of the source code
+///
+/// # Returns
+///
+/// The counts, or `None` for languages other than Go, JavaScript,
+/// TypeScript, Python, and Rust
+pub(crate) fn closure_stats(root: &Node, language: &SupportedLanguage) -> Option<ClosureStats> {
+    if !has_closures(language) {
+        return None;
+    }
+
+    let mut stats = ClosureStats::default();
+    // Each node with the closure depth it is at and whether it is inside a
+    // named function
+    let mut stack = vec![(*root, 0, false)];
+    while let Some((node, depth, in_function)) = stack.pop() {
+        let mut cursor = node.walk();
+        for child in node.named_children(&mut cursor) {
+            if is_closure(&child, language) {
+                stats.count += 1;
+                if depth > 0 {
+                    stats.nested += 1;
+                }
+                if !in_function {
+                    stats.top_level += 1;
+                }
+                stats.max_depth = stats.max_depth.max(depth + 1);
+                stack.push((child, depth + 1, in_function));
+            } else if is_named_function(&child, language) {
+                stack.push((child, 0, true));
+            } else {
+                stack.push((child, depth, in_function));
+            }
+        }
+    }
+    Some(stats)
+}
+
+/// Counts the anonymous functions inside a function, leaving out those of
+/// named functions declared in it.
+///
+/// # Returns
+///
+/// The number of anonymous functions and the deepest nesting among them,
+/// both 0 for languages other than Go, JavaScript, TypeScript, Python, and
+/// Rust
+pub(crate) fn function_closures(function: &Node, language: &SupportedLanguage) -> (usize, usize) {
+    if !has_closures(language) {
+        return (0, 0);
+    }
+
+    let (mut count, mut max_depth) = (0, 0);
+    let mut stack = vec![(*function, 0)];
+    while let Some((node, depth)) = stack.pop() {
+        let mut cursor = node.walk();
+        for child in node.named_children(&mut cursor) {
+            if is_closure(&child, language) {
+                count += 1;
+                max_depth = max_depth.max(depth + 1);
+                stack.push((child, depth + 1));
+            } else if !is_named_function(&child, language) {
+                stack.push((child, depth));
+            }
+        }
+    }
+    (count, max_depth)
+}
+
+/// Returns true for the languages whose closures are counted.
+fn has_closures(language: &SupportedLanguage) -> bool {
+    matches!(
+        language,
+        SupportedLanguage::Go
+            | SupportedLanguage::JavaScript
+            | SupportedLanguage::TypeScript
+            | SupportedLanguage::Python
+            | SupportedLanguage::Rust
+    )
+}
+
+/// Returns true if `node` is a function without a name of its own.
+fn is_closure(node: &Node, language: &SupportedLanguage) -> bool {
+    match language {
+        SupportedLanguage::Rust => node.kind() == "closure_expression",
+        SupportedLanguage::Go => node.kind() == "func_literal",
+        SupportedLanguage::Python => node.kind() == "lambda",
+        SupportedLanguage::JavaScript | SupportedLanguage::TypeScript => match node.kind() {
+            "arrow_function" => true,
+            // `function named() {}` as an expression has a name to report
+            "function_expression" => node.child_by_field_name("name").is_none(),
+            _ => false,
+        },
+        _ => false,
+    }
+}
+
+/// Returns true if `node` declares a function with a name.
+fn is_named_function(node: &Node, language: &SupportedLanguage) -> bool {
+    match language {
+        SupportedLanguage::Rust => node.kind() == "function_item",
+        SupportedLanguage::Go => {
+            matches!(node.kind(), "function_declaration" | "method_declaration")
+        }
+        SupportedLanguage::Python => node.kind() == "function_definition",
+        SupportedLanguage::JavaScript | SupportedLanguage::TypeScript => match node.kind() {
+            "function_declaration" | "method_definition" => true,
+            "function_expression" => node.child_by_field_name("name").is_some(),
+            _ => false,
+        },
+        _ => false,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tree_sitter::Parser;
+
+    fn parse(source: &str, language: SupportedLanguage) -> tree_sitter::Tree {
+        let mut parser = Parser::new();
+        parser.set_language(&language.get_language()).unwrap();
+        parser.parse(source, None).unwrap()
+    }
+
+    fn closures(source: &str, language: SupportedLanguage) -> ClosureStats {
+        let tree = parse(source, language);
+        closure_stats(&tree.root_node(), &language).unwrap()
+    }
+
+    #[test]
+    fn test_rust_closures() {
+        let source = r#"
+fn apply(items: Vec<u32>) -> Vec<u32> {
+    items
+        .into_iter()
+        .map(|x| {
+            let double = |y: u32| y * 2;
+            double(x)
+        })
+        .filter(|x| *x > 2)
+        .collect()
+}
+"#;
+        assert_eq!(
+            closures(source, SupportedLanguage::Rust),
+            ClosureStats {
+                count: 3,
+                nested: 1,
+                top_level: 0,
+                max_depth: 2,
+            }
+        );
+    }
+
+    #[test]
+    fn test_go_function_literals() {
+        let source = r#"
+package main
+
+var handler = func(w Writer) {}
+
+func serve() {
+    go func() {
+        defer func() { recover() }()
+    }()
+}
+"#;
+        assert_eq!(
+            closures(source, SupportedLanguage::Go),
+            ClosureStats {
+                count: 3,
+                nested: 1,
+                top_level: 1,
+                max_depth: 2,
+            }
+        );
+    }
+
+    #[test]
+    fn test_javascript_callbacks_and_named_expressions() {
+        let source = r#"
+app.get("/", (req, res) => {
+    db.query(sql, function (err, rows) {
+        rows.forEach((row) => res.write(row));
+    });
+});
+
+const retry = function retry(task) {
+    return task.then(() => retry(task));
+};
+"#;
+        assert_eq!(
+            closures(source, SupportedLanguage::JavaScript),
+            ClosureStats {
+                count: 4,
+                nested: 2,
+                top_level: 3,
+                max_depth: 3,
+            }
+        );
+    }
+
+    #[test]
+    fn test_python_lambdas_and_nested_definitions() {
+        let source = r#"
+key = lambda item: item.name
+
+def sort_all(groups):
+    def by_size(group):
+        return sorted(group, key=lambda item: len(item))
+    return sorted(map(by_size, groups), key=lambda g: (lambda n: n)(len(g)))
+"#;
+        let stats = closures(source, SupportedLanguage::Python);
+        assert_eq!(
+            stats,
+            ClosureStats {
+                count: 4,
+                nested: 1,
+                top_level: 1,
+                max_depth: 2,
+            }
+        );
+
+        // The lambda of `by_size` is its own, not `sort_all`'s
+        let tree = parse(source, SupportedLanguage::Python);
+        let root = tree.root_node();
+        let mut cursor = root.walk();
+        let sort_all = root
+            .named_children(&mut cursor)
+            .find(|node| node.kind() == "function_definition")
+            .unwrap();
+        assert_eq!(
+            function_closures(&sort_all, &SupportedLanguage::Python),
+            (2, 2)
+        );
+    }
+
+    #[test]
+    fn test_languages_without_closure_counts() {
+        let tree = parse("int main(void) { return 0; }", SupportedLanguage::C);
+        assert_eq!(
+            closure_stats(&tree.root_node(), &SupportedLanguage::C),
+            None
+        );
+        assert_eq!(
+            function_closures(&tree.root_node(), &SupportedLanguage::C),
+            (0, 0)
+        );
+    }
+
+    #[test]
+    fn test_merge() {
+        let mut stats = ClosureStats {
+            count: 3,
+            nested: 1,
+            top_level: 0,
+            max_depth: 2,
+        };
+        stats.merge(&ClosureStats {
+            count: 2,
+            nested: 0,
+            top_level: 2,
+            max_depth: 1,
+        });
+        assert_eq!(
+            stats,
+            ClosureStats {
+                count: 5,
+                nested: 1,
+                top_level: 2,
+                max_depth: 2,
+            }
+        );
+        assert!(ClosureStats::default().is_empty());
+    }
+}
@@ -0,0 +1,297 @@
+//! Display columns of reported locations.
+//!
+//! Tree-sitter positions count bytes from the start of the line, which only
+//! match what an editor shows for ASCII text without tabs. Locations in lint
+//! findings, parse issues, outlines, and query matches are instead reported
+//! in display columns: every character is one column and a tab advances to
+//! the next tab stop.
+//!
+//! The tab width of a file is `--tab-width` if given, otherwise the
+//! `tab_width` (or numeric `indent_size`) that the `.editorconfig` files
+//! above it assign to it, otherwise `DEFAULT_TAB_WIDTH`. As in editors,
+//! nearer `.editorconfig` files override farther ones, later sections
+//! override earlier ones, and the search stops at a file with `root = true`.
+
+use globset::{GlobBuilder, GlobMatcher};
+use std::collections::HashMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::sync::{Arc, Mutex};
+use tree_sitter::Node;
+
+/// Tab width of files no `.editorconfig` section covers, as in terminals
+/// and git.
+pub(crate) const DEFAULT_TAB_WIDTH: usize = 8;
+
+/// Name of the files holding editor settings.
+const EDITORCONFIG_FILE: &str = ".editorconfig";
+
+/// Returns the 1-based display column of the byte offset `byte_column` in
+/// `line`, with tabs expanded to multiples of `tab_width`.
+///
+/// # Arguments
+///
+/// * `line` - Text of the line, from its first byte
+/// * `byte_column` - 0-based byte offset in the line, as in tree-sitter points
+/// * `tab_width` - Columns between tab stops
+pub(crate) fn display_column(line: &[u8], byte_column: usize, tab_width: usize) -> usize {
+    let prefix = String::from_utf8_lossy(&line[..byte_column.min(line.len())]);
+    let tab_width = tab_width.max(1);
+    let width = prefix.chars().fold(0, |width, c| {
+        if c == '\t' {
+            (width / tab_width + 1) * tab_width
+        } else {
+            width + 1
+        }
+    });
+    width + 1
+}
+
+/// Returns the 1-based display columns where `node` starts and just past
+/// where it ends, each on its own line.
+pub(crate) fn node_columns(node: &Node, source: &[u8], tab_width: usize) -> (usize, usize) {
+    let column = |byte: usize, byte_column: usize| {
+        let line_start = byte - byte_column;
+        display_column(&source[line_start..], byte_column, tab_width)
+    };
+    (
+        column(node.start_byte(), node.start_position().column),
+        column(node.end_byte(), node.end_position().column),
+    )
+}
+
+/// Returns the 1-based display column of a 1-based byte column on a
+/// 1-based line of `source`, for locations recorded without their node.
+pub(crate) fn line_column(source: &str, line: usize, column: usize, tab_width: usize) -> usize {
+    let text = source.split('\n').nth(line.saturating_sub(1)).unwrap_or("");
+    display_column(text.as_bytes(), column.saturating_sub(1), tab_width)
+}
+
+/// Tab widths of files, from `--tab-width` or their `.editorconfig` files.
+///
+/// Parsed `.editorconfig` files are kept per directory and shared by the
+/// workers of a parallel analysis.
+#[derive(Debug, Default)]
+pub(crate) struct TabWidths {
+    /// Width given on the command line, used for every file
+    fixed: Option<usize>,
+    /// `.editorconfig` of each directory looked at, `None` if it has none
+    configs: Mutex<HashMap<PathBuf, Option<Arc<EditorConfig>>>>,
+}
+
+impl TabWidths {
+    /// Creates tab widths read from `.editorconfig` files, or `fixed` for
+    /// every file if given.
+    pub(crate) fn new(fixed: Option<usize>) -> Self {
+        Self {
+            fixed,
+            configs: Mutex::default(),
+        }
+    }
+
+    /// Returns the tab width of the file at `path`, which need not exist.
+    pub(crate) fn for_file(&self, path: &Path) -> usize {
+        if let Some(width) = self.fixed {
+            return width;
+        }
+        let Ok(path) = std::path::absolute(path) else {
+            return DEFAULT_TAB_WIDTH;
+        };
+
+        // Nearest first, up to the first root file
+        let mut configs = Vec::new();
+        for dir in path.ancestors().skip(1) {
+            if let Some(config) = self.config(dir) {
+                let root = config.root;
+                configs.push((dir, config));
+                if root {
+                    break;
+                }
+            }
+        }
+
+        let mut properties = Properties::default();
+        for (dir, config) in configs.iter().rev() {
+            let Ok(relative) = path.strip_prefix(dir) else {
+                continue;
+            };
+            for section in config.sections.iter().filter(|s| s.glob.is_match(relative)) {
+                properties.apply(&section.properties);
+            }
+        }
+        properties
+            .tab_width
+            .or(properties.indent_size)
+            .unwrap_or(DEFAULT_TAB_WIDTH)
+    }
+
+    /// Returns the parsed `.editorconfig` of `dir`, reading it on first use.
+    fn config(&self, dir: &Path) -> Option<Arc<EditorConfig>> {
+        let mut configs = self.configs.lock().expect("tab width lock poisoned");
+        configs
+            .entry(dir.to_path_buf())
+            .or_insert_with(|| {
+                let text = fs::read_to_string(dir.join(EDITORCONFIG_FILE)).ok()?;
+                Some(Arc::new(EditorConfig::parse(&text)))
+            })
+            .clone()
+    }
+}
+
+/// The settings of a `.editorconfig` file that concern tab width.
+#[derive(Debug)]
+struct EditorConfig {
+    /// Whether `.editorconfig` files further up are ignored
+    root: bool,
+    sections: Vec<Section>,
+}
+
+/// A `[glob]` section of a `.editorconfig` file.
+#[derive(Debug)]
+struct Section {
+    /// The section's glob, relative to the file's directory
+    glob: GlobMatcher,
+    properties: Properties,
+}
+
+/// Tab width properties, `None` where not set. In a section, `Some(0)`
+/// unsets a property set by an earlier one.
+#[derive(Debug, Default, Clone, Copy)]
+struct Properties {
+    tab_width: Option<usize>,
+    indent_size: Option<usize>,
+}
+
+impl Properties {
+    /// Overrides the properties with those a later section sets.
+    fn apply(&mut self, section: &Properties) {
+        if section.tab_width.is_some() {
+            self.tab_width = section.tab_width.filter(|&width| width > 0);
+        }
+        if section.indent_size.is_some() {
+            self.indent_size = section.indent_size.filter(|&width| width > 0);
+        }
+    }
+}
+
+impl EditorConfig {
+    /// Parses a `.editorconfig` file; sections with globs `globset` can't
+    /// compile and properties other than `root`, `tab_width`, and
+    /// `indent_size` are ignored.
+    fn parse(text: &str) -> Self {
+        let mut root = false;
+        let mut sections = Vec::new();
+        // Properties of a section with an invalid glob are dropped with it
+        let mut current: Option<Section> = None;
+        let mut in_section = false;
+        for line in text.lines().map(str::trim) {
+            if line.is_empty() || line.starts_with(['#', ';']) {
+                continue;
+            }
+            if let Some(pattern) = line.strip_prefix('[').and_then(|l| l.strip_suffix(']')) {
+                sections.extend(current.take());
+                current = section_glob(pattern).map(|glob| Section {
+                    glob,
+                    properties: Properties::default(),
+                });
+                in_section = true;
+                continue;
+            }
+            let Some((key, value)) = line.split_once('=') else {
+                continue;
+            };
+            let key = key.trim().to_lowercase();
+            let value = value.trim().to_lowercase();
+            if !in_section {
+                root |= key == "root" && value == "true";
+                continue;
+            }
+            let Some(section) = &mut current else {
+                continue;
+            };
+            // `unset` and non-numeric values such as `indent_size = tab`
+            // clear the property
+            let width = Some(value.parse().unwrap_or(0));
+            match key.as_str() {
+                "tab_width" => section.properties.tab_width = width,
+                "indent_size" => section.properties.indent_size = width,
+                _ => {}
+            }
+        }
+        sections.extend(current);
+        Self { root, sections }
+    }
+}
+
+/// Compiles the glob of a section header. A glob without a `/` matches a
+/// file name at any depth, one with a `/` the path relative to the
+/// `.editorconfig` file.
+fn section_glob(pattern: &str) -> Option<GlobMatcher> {
+    let anchored = if let Some(anchored) = pattern.strip_prefix('/') {
+        anchored.to_string()
+    } else if pattern.contains('/') {
+        pattern.to_string()
+    } else {
+        format!("**/{pattern}")
+    };
+    GlobBuilder::new(&anchored)
+        .literal_separator(true)
+        .build()
+        .ok()
+        .map(|glob| glob.compile_matcher())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_display_column_expands_tabs() {
+        assert_eq!(display_column(b"fn main() {}", 3, 8), 4);
+        assert_eq!(display_column(b"\treturn nil", 1, 8), 9);
+        assert_eq!(display_column(b"\treturn nil", 1, 4), 5);
+        // A tab after text only advances to the next stop
+        assert_eq!(display_column(b"ab\tc", 3, 4), 5);
+        assert_eq!(display_column(b"\t\tx", 2, 2), 5);
+        // Multi-byte characters are one column
+        assert_eq!(display_column("let é = 1;".as_bytes(), 7, 8), 7);
+    }
+
+    #[test]
+    fn test_line_column() {
+        let source = "package main\n\nfunc main() {\n\tx := 1\n}\n";
+        assert_eq!(line_column(source, 4, 2, 8), 9);
+        assert_eq!(line_column(source, 4, 2, 4), 5);
+        assert_eq!(line_column(source, 1, 9, 4), 9);
+    }
+
+    #[test]
+    fn test_editorconfig_tab_widths() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let root = temp_dir.path();
+        fs::write(
+            root.join(EDITORCONFIG_FILE),
+            "root = true\n\n[*]\nindent_size = 2\n\n[*.go]\nindent_style = tab\ntab_width = 4\n\n\
+             [{Makefile,*.mk}]\ntab_width = 8\n\n[/docs/*.py]\nindent_size = unset\n",
+        )
+        .unwrap();
+        fs::create_dir_all(root.join("vendor/lib")).unwrap();
+        fs::create_dir_all(root.join("docs")).unwrap();
+        fs::write(root.join("vendor/.editorconfig"), "[*.go]\ntab_width = 3\n").unwrap();
+
+        let widths = TabWidths::new(None);
+        assert_eq!(widths.for_file(&root.join("main.go")), 4);
+        assert_eq!(widths.for_file(&root.join("cmd/app/main.py")), 2);
+        assert_eq!(widths.for_file(&root.join("build/rules.mk")), 8);
+        assert_eq!(
+            widths.for_file(&root.join("docs/conf.py")),
+            DEFAULT_TAB_WIDTH
+        );
+        // The nearer file wins
+        assert_eq!(widths.for_file(&root.join("vendor/lib/x.go")), 3);
+        assert_eq!(widths.for_file(&root.join("vendor/lib/x.py")), 2);
+
+        let fixed = TabWidths::new(Some(2));
+        assert_eq!(fixed.for_file(&root.join("main.go")), 2);
+    }
+}
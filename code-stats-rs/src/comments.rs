@@ -0,0 +1,1127 @@
+//! Line classification and doc-comment coverage over tree-sitter syntax trees.
+
+use crate::fences::count_markdown_lines;
+use crate::language::SupportedLanguage;
+use crate::notebook::count_notebook_lines;
+use crate::templates::{comment_ranges, text_ranges};
+use crate::web::inline_code;
+use serde::{Deserialize, Serialize};
+use std::ops::Range;
+use tree_sitter::Node;
+
+/// Number of source lines by kind.
+///
+/// Every line is exactly one of code, comment, blank, markup, or prose. A
+/// line holding both code and a trailing comment counts as code, as does a
+/// line mixing code with markup (`<li><?= $name ?></li>`).
+#[derive(Default, Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct LineStats {
+    /// Lines containing anything other than whitespace, comments, and markup
+    pub code: usize,
+    /// Lines containing only comments (and whitespace)
+    pub comment: usize,
+    /// Lines containing only whitespace
+    pub blank: usize,
+    /// Lines containing only embedded markup outside the language's own
+    /// code, such as the HTML around PHP tags
+    #[serde(default, skip_serializing_if = "is_zero")]
+    pub markup: usize,
+    /// Lines of text in a document, such as Markdown paragraphs and headings
+    #[serde(default, skip_serializing_if = "is_zero")]
+    pub prose: usize,
+    /// Logical lines: statements and declarations counted from the syntax
+    /// tree, independent of formatting (see `logical_lines`). Not a kind of
+    /// physical line, so not part of `total`.
+    #[serde(default)]
+    pub logical: usize,
+}
+
+impl LineStats {
+    /// Total number of lines.
+    pub fn total(&self) -> usize {
+        self.code + self.comment + self.blank + self.markup + self.prose
+    }
+
+    /// Fraction of non-blank lines that are markup, or 0.0 for empty input.
+    pub fn markup_share(&self) -> f64 {
+        let non_blank = self.code + self.comment + self.markup + self.prose;
+        if non_blank == 0 {
+            0.0
+        } else {
+            self.markup as f64 / non_blank as f64
+        }
+    }
+
+    /// Fraction of non-blank lines that are comments, or 0.0 for empty input.
+    ///
+    /// Markup and prose lines are left out, so the density describes the
+    /// code alone.
+    pub fn comment_density(&self) -> f64 {
+        let non_blank = self.code + self.comment;
+        if non_blank == 0 {
+            0.0
+        } else {
+            self.comment as f64 / non_blank as f64
+        }
+    }
+
+    /// Adds all counts from `other` into this instance.
+    pub(crate) fn merge(&mut self, other: &LineStats) {
+        self.code += other.code;
+        self.comment += other.comment;
+        self.blank += other.blank;
+        self.markup += other.markup;
+        self.prose += other.prose;
+        self.logical += other.logical;
+    }
+}
+
+/// Serde helper that leaves zero counts out of the output.
+pub(crate) fn is_zero(count: &usize) -> bool {
+    *count == 0
+}
+
+/// How many public declarations carry a doc comment.
+#[derive(Default, Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct DocCoverage {
+    /// Public declarations with a doc comment
+    pub documented: usize,
+    /// All public declarations
+    pub public: usize,
+}
+
+impl DocCoverage {
+    /// Fraction of public declarations that are documented, or `None` if there are none.
+    pub fn ratio(&self) -> Option<f64> {
+        (self.public > 0).then(|| self.documented as f64 / self.public as f64)
+    }
+
+    /// Adds all counts from `other` into this instance.
+    pub(crate) fn merge(&mut self, other: &DocCoverage) {
+        self.documented += other.documented;
+        self.public += other.public;
+    }
+}
+
+/// Returns true for the comment node kinds of all supported grammars
+/// (`comment`, `line_comment`, `block_comment`, SQL's `marginalia` for
+/// `/* ... */`, Groovy's `groovy_doc` for `/** ... */`, and Haskell's
+/// `haddock` for `-- |`).
+pub(crate) fn is_comment(node: &Node) -> bool {
+    node.kind().ends_with("comment")
+        || matches!(node.kind(), "marginalia" | "groovy_doc" | "haddock")
+}
+
+/// Classifies every line of `source` as code, comment, blank, or markup.
+///
+/// Comments are taken from the syntax tree rather than matched textually, so
+/// comment markers inside string literals are not mistaken for comments.
+/// Python docstrings are string expressions and count as code. In PHP, the
+/// HTML outside `<?php ... ?>` tags is markup, as is the text around the tags
+/// of templates, whose comment tags are found by `templates`. The inline
+/// scripts and styles of HTML documents and the sections of components are
+/// left out, blank lines included, as they are counted in their own
+/// languages. Markdown is classified by `count_markdown_lines` instead, and
+/// Jupyter notebooks by the cells in them, see `count_notebook_lines`.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the tree parsed from `source`
+/// * `source` - The source code the tree was parsed from
+/// * `language` - The programming language of the source code
+pub(crate) fn count_lines(root: &Node, source: &str, language: &SupportedLanguage) -> LineStats {
+    if *language == SupportedLanguage::Markdown {
+        return count_markdown_lines(root, source);
+    }
+    if *language == SupportedLanguage::Jupyter {
+        return count_notebook_lines(root, source.as_bytes());
+    }
+    let mut comments = Vec::new();
+    collect_comment_ranges(root, &mut comments);
+    let mut markup = Vec::new();
+    if *language == SupportedLanguage::Php {
+        collect_php_text_ranges(root, &mut markup);
+    }
+    if language.is_template() {
+        // ERB's `<%# %>` is a `comment_directive` of the tree, Jinja's and
+        // Go's comments are text to the grammar
+        comments = comment_ranges(source, language);
+        markup = text_ranges(source, language);
+    }
+    let mut extracted = Vec::new();
+    if matches!(
+        language,
+        SupportedLanguage::Html | SupportedLanguage::Vue | SupportedLanguage::Svelte
+    ) {
+        extracted = inline_code(root, source.as_bytes())
+            .iter()
+            .map(|(content, _)| content.byte_range())
+            .collect();
+    }
+    let mut comments = RangeCursor::new(comments);
+    let mut markup = RangeCursor::new(markup);
+    let mut extracted = RangeCursor::new(extracted);
+
+    let mut stats = LineStats::default();
+    let mut offset = 0;
+
+    for line in source.split_inclusive('\n') {
+        let line_start = offset;
+        offset += line.len();
+
+        if line.trim().is_empty() {
+            if !extracted.contains(line_start) {
+                stats.blank += 1;
+            }
+            continue;
+        }
+
+        let mut has_markup = false;
+        let mut has_comment = false;
+        let has_code = line
+            .char_indices()
+            .filter(|(_, c)| !c.is_whitespace())
+            .any(|(index, _)| {
+                let position = line_start + index;
+                if extracted.contains(position) {
+                    return false;
+                }
+                if comments.contains(position) {
+                    has_comment = true;
+                    return false;
+                }
+                if markup.contains(position) {
+                    has_markup = true;
+                    return false;
+                }
+                true
+            });
+
+        if has_code {
+            stats.code += 1;
+        } else if has_markup {
+            stats.markup += 1;
+        } else if has_comment {
+            stats.comment += 1;
+        }
+    }
+
+    stats
+}
+
+/// Byte ranges in source order, looked up with increasing positions so a
+/// single forward cursor suffices.
+struct RangeCursor {
+    ranges: Vec<Range<usize>>,
+    next: usize,
+}
+
+impl RangeCursor {
+    fn new(ranges: Vec<Range<usize>>) -> Self {
+        Self { ranges, next: 0 }
+    }
+
+    /// Returns true if `position` lies in one of the ranges. Positions must
+    /// not decrease between calls.
+    fn contains(&mut self, position: usize) -> bool {
+        while self
+            .ranges
+            .get(self.next)
+            .is_some_and(|range| range.end <= position)
+        {
+            self.next += 1;
+        }
+        self.ranges
+            .get(self.next)
+            .is_some_and(|range| range.start <= position)
+    }
+}
+
+/// Collects the byte ranges of all comment nodes in pre-order.
+fn collect_comment_ranges(node: &Node, ranges: &mut Vec<Range<usize>>) {
+    if is_comment(node) {
+        ranges.push(node.byte_range());
+        return;
+    }
+
+    let mut cursor = node.walk();
+    for child in node.children(&mut cursor) {
+        collect_comment_ranges(&child, ranges);
+    }
+}
+
+/// Collects the byte ranges of the HTML text between PHP tags, in source order.
+///
+/// The text sits at the top level of the program or, after a `?>`, in a
+/// `text_interpolation`, which can also appear inside a block of an
+/// alternative-syntax statement (`<?php if ($x): ?> ... <?php endif; ?>`).
+fn collect_php_text_ranges(node: &Node, ranges: &mut Vec<Range<usize>>) {
+    if node.kind() == "text"
+        && node
+            .parent()
+            .is_some_and(|parent| matches!(parent.kind(), "program" | "text_interpolation"))
+    {
+        ranges.push(node.byte_range());
+        return;
+    }
+
+    let mut cursor = node.walk();
+    for child in node.children(&mut cursor) {
+        collect_php_text_ranges(&child, ranges);
+    }
+}
+
+/// Counts public declarations and how many of them are documented.
+///
+/// What counts as public depends on the language:
+///
+/// - Go: functions, methods, and types with an exported (capitalized) name
+/// - Rust: items declared `pub`
+/// - Python: functions and classes at module level or directly in a class
+///   body whose name does not start with an underscore
+/// - JavaScript/TypeScript: exported declarations
+/// - Java: classes, interfaces, enums, records, methods, and constructors
+///   declared `public`
+/// - Ruby: classes, modules, and methods, except methods following a bare
+///   `private` or `protected` in their class body or wrapped in one
+/// - Kotlin: top-level and member classes, objects, and functions not
+///   declared `private`, `internal`, or `protected`
+/// - C#: types, methods, constructors, and properties declared `public`
+/// - Swift: types, protocols, functions, initializers, and properties
+///   declared `public` or `open`
+/// - PHP: classes, interfaces, traits, enums, top-level functions, and
+///   methods not declared `private` or `protected`
+/// - Scala: top-level and member classes, objects, traits, enums, and defs
+///   not declared `private` or `protected`
+/// - Groovy: classes, interfaces, enums, traits, and methods not declared
+///   `private` or `protected`
+///
+/// Go, JavaScript/TypeScript, Java, Kotlin, PHP, Scala, and Groovy declarations are
+/// documented by a comment directly above them (`/** ... */` for all but Go); Rust
+/// items by a `///`
+/// or `/** */` comment or a `#[doc]` attribute; C# declarations by a `///`
+/// XML documentation comment; Swift declarations by a `///` or `/** */`
+/// comment; Python declarations by a
+/// docstring; Ruby declarations by a `#` comment directly above them.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the tree parsed from `source`
+/// * `source` - The source code the tree was parsed from
+/// * `language` - The programming language of the source code
+pub(crate) fn doc_coverage(
+    root: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> DocCoverage {
+    let mut coverage = DocCoverage::default();
+    visit_declarations(root, source, language, &mut coverage);
+    coverage
+}
+
+fn visit_declarations(
+    node: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+    coverage: &mut DocCoverage,
+) {
+    if let Some(documented) = language.rules().public_declaration(node, source) {
+        coverage.public += 1;
+        if documented {
+            coverage.documented += 1;
+        }
+    }
+
+    let mut cursor = node.walk();
+    for child in node.children(&mut cursor) {
+        visit_declarations(&child, source, language, coverage);
+    }
+}
+
+/// Returns true if `node` is a declaration that counts as public API for
+/// documentation coverage.
+pub(crate) fn is_public(node: &Node, source: &[u8], language: &SupportedLanguage) -> bool {
+    language.rules().public_declaration(node, source).is_some()
+}
+
+pub(crate) fn first_named_child<'tree>(node: &Node<'tree>) -> Option<Node<'tree>> {
+    let mut cursor = node.walk();
+    node.named_children(&mut cursor).next()
+}
+
+pub(crate) fn js_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    if node.kind() != "export_statement" {
+        return None;
+    }
+    // Re-exports (`export { a, b }`) and `export default <expression>`
+    // don't declare anything here
+    node.child_by_field_name("declaration")?;
+
+    Some(is_jsdoc(preceding_comment(node, &[]), source))
+}
+
+/// Returns true if the value of an Elixir `@doc` or `@moduledoc` is
+/// `false`, which hides the definition from the documentation.
+pub(crate) fn is_elixir_false(value: Option<Node>, source: &[u8]) -> bool {
+    value
+        .and_then(|value| value.utf8_text(source).ok())
+        .is_some_and(|text| text == "false")
+}
+
+/// Returns true if `comment` is a `/** ... */` documentation comment.
+pub(crate) fn is_jsdoc(comment: Option<Node>, source: &[u8]) -> bool {
+    comment
+        .and_then(|comment| comment.utf8_text(source).ok())
+        .is_some_and(|text| text.starts_with("/**") && text != "/**/")
+}
+
+/// Returns the comment directly above `node`, skipping siblings of the given
+/// kinds (such as attributes) in between.
+///
+/// A comment separated from the declaration by a blank line is not attached
+/// to it.
+pub(crate) fn preceding_comment<'tree>(node: &Node<'tree>, skip: &[&str]) -> Option<Node<'tree>> {
+    let mut next_row = node.start_position().row;
+    let mut sibling = node.prev_sibling();
+    while let Some(skipped) = sibling.filter(|s| skip.contains(&s.kind())) {
+        next_row = skipped.start_position().row;
+        sibling = skipped.prev_sibling();
+    }
+
+    sibling.filter(|comment| is_comment(comment) && last_row(comment) + 1 == next_row)
+}
+
+/// Returns the last row containing text of `node`.
+///
+/// Some grammars include the trailing newline in line comments, which makes
+/// the node end at column 0 of the following row.
+pub(crate) fn last_row(node: &Node) -> usize {
+    let end = node.end_position();
+    if end.column == 0 && end.row > node.start_position().row {
+        end.row - 1
+    } else {
+        end.row
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::create_parser;
+
+    fn analyze(source: &str, language: SupportedLanguage) -> (LineStats, DocCoverage) {
+        let mut parser = create_parser(&language).unwrap();
+        let tree = parser.parse(source, None).unwrap();
+        let root = tree.root_node();
+        (
+            count_lines(&root, source, &language),
+            doc_coverage(&root, source.as_bytes(), &language),
+        )
+    }
+
+    #[test]
+    fn test_line_stats_helpers() {
+        let mut stats = LineStats {
+            code: 6,
+            comment: 2,
+            blank: 1,
+            markup: 0,
+            prose: 0,
+            logical: 5,
+        };
+        assert_eq!(stats.total(), 9);
+        assert_eq!(stats.comment_density(), 0.25);
+
+        stats.merge(&LineStats {
+            code: 1,
+            comment: 0,
+            blank: 3,
+            markup: 1,
+            prose: 0,
+            logical: 1,
+        });
+        // Logical lines are not physical lines of their own
+        assert_eq!(stats.total(), 14);
+        assert_eq!(stats.logical, 6);
+        // Markup is left out of the comment density
+        assert_eq!(stats.comment_density(), 2.0 / 9.0);
+        assert_eq!(stats.markup_share(), 0.1);
+        assert_eq!(LineStats::default().comment_density(), 0.0);
+        assert_eq!(LineStats::default().markup_share(), 0.0);
+    }
+
+    #[test]
+    fn test_doc_coverage_helpers() {
+        let mut coverage = DocCoverage {
+            documented: 1,
+            public: 4,
+        };
+        assert_eq!(coverage.ratio(), Some(0.25));
+        coverage.merge(&DocCoverage {
+            documented: 1,
+            public: 0,
+        });
+        assert_eq!(coverage.documented, 2);
+        assert_eq!(DocCoverage::default().ratio(), None);
+    }
+
+    #[test]
+    fn test_count_lines_go() {
+        let source = r#"package main
+
+// Greet says hello.
+/* Block comments
+   span lines. */
+func Greet() {
+    fmt.Println("// not a comment") // trailing
+
+}
+"#;
+        let (lines, _) = analyze(source, SupportedLanguage::Go);
+        assert_eq!(
+            lines,
+            LineStats {
+                code: 4,
+                comment: 3,
+                blank: 2,
+                markup: 0,
+                prose: 0,
+                logical: 0,
+            }
+        );
+    }
+
+    #[test]
+    fn test_doc_coverage_go() {
+        let source = r#"package main
+
+type Person struct {
+    Name string
+}
+
+// Greeter greets people.
+type Greeter interface {
+    Greet()
+}
+
+type (
+    // ID identifies a person.
+    ID int
+    Name string
+)
+
+// Greet says hello.
+
+func (p Person) Greet() {}
+
+// New creates a person.
+func New() Person { return Person{} }
+
+func helper() {}
+"#;
+        let (_, coverage) = analyze(source, SupportedLanguage::Go);
+        // Person, Greeter, ID, Name, Greet, New; the comment above Greet is
+        // detached by a blank line
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 3,
+                public: 6,
+            }
+        );
+    }
+
+    #[test]
+    fn test_doc_coverage_rust() {
+        let source = r#"
+/// A documented struct.
+#[derive(Debug)]
+pub struct Documented;
+
+// Plain comment, not docs
+pub struct Undocumented;
+
+#[doc = "Attribute docs"]
+pub fn attribute_docs() {}
+
+/** Block docs */
+pub enum Block {}
+
+pub(crate) fn internal() {}
+
+fn private() {}
+
+impl Documented {
+    /// Method docs
+    pub fn method(&self) {}
+}
+"#;
+        let (lines, coverage) = analyze(source, SupportedLanguage::Rust);
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 4,
+                public: 5,
+            }
+        );
+        assert_eq!(lines.comment, 4);
+    }
+
+    #[test]
+    fn test_doc_coverage_python() {
+        let source = r#"
+def documented():
+    """Docstring."""
+
+def undocumented():
+    pass
+
+def _private():
+    """Private helper."""
+
+class Service:
+    """A service."""
+
+    @staticmethod
+    def create():
+        return Service()
+
+    def __init__(self):
+        def inner():
+            pass
+"#;
+        let (_, coverage) = analyze(source, SupportedLanguage::Python);
+        // documented, undocumented, Service, create
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 2,
+                public: 4,
+            }
+        );
+    }
+
+    #[test]
+    fn test_doc_coverage_typescript() {
+        let source = r#"
+/** Documented function. */
+export function documented() {}
+
+// Plain comment
+export class Plain {}
+
+export interface Shape {}
+
+export { documented as alias };
+
+function internal() {}
+"#;
+        let (_, coverage) = analyze(source, SupportedLanguage::TypeScript);
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 1,
+                public: 3,
+            }
+        );
+    }
+
+    #[test]
+    fn test_doc_coverage_java() {
+        let source = r#"
+/** Entry point. */
+public class Main {
+    /**
+     * Runs the program.
+     */
+    @Override
+    public void run() {}
+
+    public Main() {}
+
+    private void helper() {}
+}
+"#;
+        let (_, coverage) = analyze(source, SupportedLanguage::Java);
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 2,
+                public: 3,
+            }
+        );
+    }
+
+    #[test]
+    fn test_doc_coverage_ruby() {
+        let source = r#"
+# Shopping helpers.
+module Shop
+  # A cart of items.
+  class Cart
+    # Adds an item.
+    def add(item); end
+
+    def remove(item); end
+
+    private
+
+    # Internal.
+    def helper; end
+  end
+
+  class Receipt
+    protected def total; end
+
+    # Prints the receipt.
+    def self.print; end
+  end
+end
+"#;
+        let (lines, coverage) = analyze(source, SupportedLanguage::Ruby);
+        assert_eq!(lines.comment, 5);
+        // Shop, Cart, add, remove, Receipt, print; helper and total are not public
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 4,
+                public: 6,
+            }
+        );
+    }
+
+    #[test]
+    fn test_doc_coverage_kotlin() {
+        let source = r#"
+/** A shopping cart. */
+class Cart {
+    /** Adds an item. */
+    @JvmOverloads
+    fun add(item: String) {
+        fun local() {}
+    }
+
+    // Not KDoc.
+    fun remove(item: String) {}
+
+    private fun helper() {}
+
+    internal fun debug() {}
+}
+
+object Registry
+"#;
+        let (_, coverage) = analyze(source, SupportedLanguage::Kotlin);
+        // Cart, add, remove, Registry; local, helper, and debug are not API
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 2,
+                public: 4,
+            }
+        );
+    }
+
+    #[test]
+    fn test_doc_coverage_csharp() {
+        let source = r#"
+/// <summary>A shopping cart.</summary>
+public class Cart
+{
+    /// <summary>
+    /// Adds an item.
+    /// </summary>
+    [Obsolete]
+    public void Add(Item item) {}
+
+    // Not XML documentation.
+    public int Count { get; }
+
+    internal void Reset() {}
+
+    private void Helper() {}
+}
+"#;
+        let (_, coverage) = analyze(source, SupportedLanguage::CSharp);
+        // Cart, Add, Count; Reset and Helper are not public
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 2,
+                public: 3,
+            }
+        );
+    }
+
+    #[test]
+    fn test_doc_coverage_scala() {
+        let source = r#"
+/** A shopping cart. */
+case class Cart(items: List[String]) {
+  /** Adds an item. */
+  def add(item: String): Cart = {
+    def local(): Unit = ()
+    copy(items = item :: items)
+  }
+
+  // Not Scaladoc.
+  def size: Int = items.length
+
+  private def helper(): Unit = ()
+
+  private[shop] def debug(): Unit = ()
+}
+
+object Cart
+"#;
+        let (_, coverage) = analyze(source, SupportedLanguage::Scala);
+        // Cart, add, size, and the companion object; local, helper, and
+        // debug are not API
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 2,
+                public: 4
+            }
+        );
+    }
+
+    #[test]
+    fn test_doc_coverage_haskell_and_ocaml() {
+        let source = "module Shop.Cart (Cart(..), add, total) where\n\n-- | A shopping cart.\ndata Cart = Cart [Item]\n\n-- | Adds an item.\nadd :: Item -> Cart -> Cart\nadd item (Cart items) = Cart (item : items)\n\ntotal (Cart []) = 0\ntotal (Cart (_ : rest)) = 1 + total (Cart rest)\n\nhelper cart = cart\n";
+        let (_, coverage) = analyze(source, SupportedLanguage::Haskell);
+        // Cart, add, and total once for both equations; helper isn't exported
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 2,
+                public: 3
+            }
+        );
+
+        let source = "(** A shopping cart. *)\ntype cart = item list\n\n(* Not a doc comment *)\nlet add item cart = item :: cart\n\n(** The number of items. *)\nlet total cart = List.length cart\n";
+        let (_, coverage) = analyze(source, SupportedLanguage::OCaml);
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 2,
+                public: 3
+            }
+        );
+    }
+
+    #[test]
+    fn test_doc_coverage_zig_and_nim() {
+        let source = r#"
+/// A shopping cart.
+pub const Cart = struct {
+    items: u32,
+
+    /// Adds an item.
+    pub fn add(self: *Cart, item: u32) void {
+        self.items += item;
+    }
+
+    pub fn clear(self: *Cart) void {
+        self.items = 0;
+    }
+
+    fn check(self: Cart) bool {
+        return self.items > 0;
+    }
+};
+
+//// Not a doc comment
+pub fn total(cart: Cart) u32 {
+    return cart.items;
+}
+"#;
+        let (_, coverage) = analyze(source, SupportedLanguage::Zig);
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 2,
+                public: 4
+            }
+        );
+
+        let source = "type\n  Cart* = object ## A shopping cart.\n    items: seq[string]\n  Item = object\n\nproc add*(cart: var Cart, item: string) =\n  ## Adds an item.\n  cart.items.add(item)\n\nproc clear*(cart: var Cart) =\n  cart.items = @[]\n\nproc helper(cart: Cart) = discard\n";
+        let (_, coverage) = analyze(source, SupportedLanguage::Nim);
+        // Item and helper are not exported
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 2,
+                public: 3
+            }
+        );
+    }
+
+    #[test]
+    fn test_doc_coverage_lua() {
+        let source = r#"
+local M = {}
+
+--- Adds an item to the cart.
+-- @param item the item to add
+function M.add(cart, item)
+  table.insert(cart, item)
+end
+
+-- Not an LDoc comment
+function M.clear(cart)
+  for i = #cart, 1, -1 do cart[i] = nil end
+end
+
+---------------------------------------------------------------------------
+function total(cart)
+  return #cart
+end
+
+local function helper(cart)
+  return cart
+end
+
+return M
+"#;
+        let (_, coverage) = analyze(source, SupportedLanguage::Lua);
+        // `helper` is local to the module
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 1,
+                public: 3
+            }
+        );
+    }
+
+    #[test]
+    fn test_doc_coverage_scss() {
+        let source = r#"
+/// Sizes a button.
+/// @param {Number} $size
+@mixin button-size($size) {
+  height: $size;
+}
+
+// Not a SassDoc comment
+@function rem($px) {
+  @return $px / 16px * 1rem;
+}
+
+@mixin -reset {
+  margin: 0;
+}
+"#;
+        let (_, coverage) = analyze(source, SupportedLanguage::Scss);
+        // `-reset` is private to the module
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 1,
+                public: 2
+            }
+        );
+    }
+
+    #[test]
+    fn test_count_lines_html_leaves_out_inline_code() {
+        let source = "<html>\n<!-- Cart -->\n<script>\n  run();\n\n  stop();\n</script>\n\n<p>Done</p>\n</html>\n";
+        let (lines, _) = analyze(source, SupportedLanguage::Html);
+        // The three lines of the script, its blank line included, are JavaScript
+        assert_eq!(lines.code, 5);
+        assert_eq!(lines.comment, 1);
+        assert_eq!(lines.blank, 1);
+    }
+
+    #[test]
+    fn test_count_lines_template_text_is_markup() {
+        let source = "{# Cart #}\n<ul>\n{% for item in cart %}\n  <li>{{ item }}</li>\n{%- endfor %}\n\n</ul>\n";
+        let (lines, _) = analyze(source, SupportedLanguage::Jinja);
+        // The tags' lines are code, the lines of only HTML markup
+        assert_eq!(lines.code, 3);
+        assert_eq!(lines.markup, 2);
+        assert_eq!(lines.comment, 1);
+        assert_eq!(lines.blank, 1);
+    }
+
+    #[test]
+    fn test_doc_coverage_elixir() {
+        let source = r#"
+defmodule Shop.Cart do
+  @moduledoc "A shopping cart."
+
+  @doc "Adds an item."
+  @spec add(list, term) :: list
+  def add(cart, item), do: [item | cart]
+
+  def total([]), do: 0
+  def total([_ | rest]), do: 1 + total(rest)
+
+  @doc false
+  def debug(cart), do: cart
+
+  defp helper(cart), do: cart
+end
+"#;
+        let (_, coverage) = analyze(source, SupportedLanguage::Elixir);
+        // The module, add, and total once for both clauses; debug is hidden
+        // and helper private
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 2,
+                public: 3
+            }
+        );
+
+        let source = "-module(cart).\n-export([add/2]).\n\n%% @doc Adds an item.\n-spec add(list(), term()) -> list().\nadd(Cart, Item) -> [Item | Cart].\n\nhelper(Cart) -> Cart.\n";
+        let (_, coverage) = analyze(source, SupportedLanguage::Erlang);
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 1,
+                public: 1
+            }
+        );
+    }
+
+    #[test]
+    fn test_doc_coverage_swift() {
+        let source = r#"
+/// A shopping cart.
+public struct Cart {
+    /// Adds an item.
+    @discardableResult
+    public func add(_ item: String) -> Bool {
+        func local() {}
+        return true
+    }
+
+    // Not documentation.
+    public var count: Int { 0 }
+
+    func helper() {}
+}
+
+/** Persists carts. */
+open class Store {}
+
+public extension Cart {
+    /// Removes every item.
+    public func clear() {}
+}
+"#;
+        let (_, coverage) = analyze(source, SupportedLanguage::Swift);
+        // Cart, add, count, Store, clear; helper is internal and the
+        // extension itself is not counted
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 4,
+                public: 5,
+            }
+        );
+    }
+
+    #[test]
+    fn test_count_lines_php_template() {
+        let source = r#"<html>
+<body>
+<?php // Greeting
+$name = "World";
+?>
+
+<h1><?= $name ?></h1>
+<?php if ($admin): ?>
+  <p>Admin</p>
+<?php endif; ?>
+</body>
+</html>
+"#;
+        let (lines, _) = analyze(source, SupportedLanguage::Php);
+        // Only lines holding nothing but HTML are markup
+        assert_eq!(
+            lines,
+            LineStats {
+                code: 6,
+                comment: 0,
+                blank: 1,
+                markup: 5,
+                prose: 0,
+                logical: 0,
+            }
+        );
+    }
+
+    #[test]
+    fn test_doc_coverage_php() {
+        let source = r#"<?php
+/** A shopping cart. */
+class Cart {
+    /** Adds an item. */
+    public function add(string $item): void {
+        function local() {}
+    }
+
+    // Not a doc comment.
+    function remove(string $item): void {}
+
+    private function helper(): void {}
+
+    protected function hook(): void {}
+}
+
+interface Store {}
+
+/** Formats a price. */
+function format_price(int $cents): string {}
+"#;
+        let (_, coverage) = analyze(source, SupportedLanguage::Php);
+        // Cart, add, remove, Store, format_price; local, helper, and hook are
+        // not API
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 3,
+                public: 5,
+            }
+        );
+    }
+
+    #[test]
+    fn test_doc_coverage_protobuf() {
+        let source = r#"syntax = "proto3";
+
+// A line in a cart.
+message Item {
+  string sku = 1;
+  // Nested messages count too.
+  message Price {
+    int64 cents = 1;
+  }
+}
+
+enum Status {
+  STATUS_UNSPECIFIED = 0;
+}
+
+// Manages carts.
+service Carts {
+  // Adds an item.
+  rpc AddItem(Item) returns (Item);
+
+  rpc Clear(Item) returns (Item);
+}
+"#;
+        let (_, coverage) = analyze(source, SupportedLanguage::Protobuf);
+        // Item, Price, Status, Carts, AddItem, Clear
+        assert_eq!(
+            coverage,
+            DocCoverage {
+                documented: 4,
+                public: 6,
+            }
+        );
+    }
+}
@@ -0,0 +1,396 @@
+//! Comparison of two saved `--format json` reports for the `compare`
+//! subcommand.
+//!
+//! Files are matched by the path the reports list them under, so both should
+//! be written from the same directory; functions are matched by qualified
+//! name, and repeated names, such as anonymous closures, by their order
+//! within the file. The result has the shape of a `--diff` report: files that
+//! were added, deleted, or modified, with the functions added, removed, or
+//! changed in length or complexity.
+
+use crate::cli::CompareMetric;
+use crate::diff::{
+    ChangeStatus, DiffReport, FileDiff, FileStatus, FunctionChange, FunctionMetrics,
+};
+use crate::error::{CodeStatsError, Result};
+use crate::formatter::JSON_SCHEMA_VERSION;
+use crate::parser::FunctionStats;
+use crate::stats::FileStats;
+use serde::Deserialize;
+use std::collections::{BTreeMap, HashMap};
+use std::fmt;
+use std::fs;
+use std::path::Path;
+
+/// The parts of a `--format json` report a comparison needs.
+#[derive(Debug, Deserialize)]
+struct SavedReport {
+    schema_version: u32,
+    files: Vec<FileStats>,
+}
+
+/// A metric that grew between the two reports, see `increases`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct Increase {
+    /// What grew, e.g. `max complexity` or `src/lib.rs parse: complexity`
+    pub metric: String,
+    /// Value in the old report
+    pub before: usize,
+    /// Value in the new report
+    pub after: usize,
+}
+
+impl fmt::Display for Increase {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{}: {} -> {}", self.metric, self.before, self.after)
+    }
+}
+
+/// Reads the files of a report written with `--format json`.
+///
+/// # Returns
+///
+/// * `Ok(Vec<FileStats>)` - The files of the report
+/// * `Err(IoError)` - The file could not be read
+/// * `Err(ConfigError)` - The file is not a report of a supported version
+pub(crate) fn load_report(path: &Path) -> Result<Vec<FileStats>> {
+    let content = fs::read_to_string(path).map_err(|e| {
+        CodeStatsError::IoError(format!("Failed to read report {}: {e}", path.display()))
+    })?;
+    let report: SavedReport = serde_json::from_str(&content)
+        .map_err(|e| CodeStatsError::ConfigError(format!("{}: {e}", path.display())))?;
+
+    if report.schema_version != JSON_SCHEMA_VERSION {
+        return Err(CodeStatsError::ConfigError(format!(
+            "{}: unsupported report schema version {} (expected {JSON_SCHEMA_VERSION})",
+            path.display(),
+            report.schema_version
+        )));
+    }
+    Ok(report.files)
+}
+
+/// Compares the files of two reports.
+///
+/// A file in both reports is listed when its lines of code or any of its
+/// functions changed; a function changed when its length or cyclomatic
+/// complexity did, so functions that only moved are not listed.
+///
+/// # Arguments
+///
+/// * `old` - Files of the earlier report
+/// * `new` - Files of the later report
+/// * `base` - Name of the earlier report, shown as what changes are since
+///
+/// # Returns
+///
+/// The changed files sorted by path, each with its changed functions in
+/// source order and removed functions last
+pub(crate) fn compare(old: &[FileStats], new: &[FileStats], base: &str) -> DiffReport {
+    let mut paths: BTreeMap<&Path, (Option<&FileStats>, Option<&FileStats>)> = BTreeMap::new();
+    for file in old {
+        paths.entry(&file.path).or_default().0 = Some(file);
+    }
+    for file in new {
+        paths.entry(&file.path).or_default().1 = Some(file);
+    }
+
+    let mut files = Vec::new();
+    for (path, (before, after)) in paths {
+        let (status, language) = match (before, after) {
+            (None, Some(after)) => (FileStatus::Added, after.language),
+            (Some(before), None) => (FileStatus::Deleted, before.language),
+            (Some(_), Some(after)) => (FileStatus::Modified, after.language),
+            (None, None) => continue,
+        };
+        let functions = compare_functions(
+            before.map_or(&[][..], |file| &file.stats.functions),
+            after.map_or(&[][..], |file| &file.stats.functions),
+        );
+        let code_changed = match (before, after) {
+            (Some(before), Some(after)) => before.stats.lines.code != after.stats.lines.code,
+            _ => true,
+        };
+        if functions.is_empty() && !code_changed {
+            continue;
+        }
+        files.push(FileDiff {
+            path: path.to_path_buf(),
+            language,
+            status,
+            functions,
+        });
+    }
+
+    DiffReport {
+        base: base.to_string(),
+        files,
+    }
+}
+
+/// Matches the functions of two versions of a file and lists those that
+/// were added, removed, or changed.
+fn compare_functions(before: &[FunctionStats], after: &[FunctionStats]) -> Vec<FunctionChange> {
+    let mut previous: HashMap<(&str, usize), &FunctionStats> =
+        index_functions(before).into_iter().collect();
+
+    let mut changes = Vec::new();
+    for (key, function) in index_functions(after) {
+        let now = FunctionMetrics::from(function);
+        match previous.remove(&key) {
+            Some(old) => {
+                let then = FunctionMetrics::from(old);
+                if (then.lines, then.complexity) != (now.lines, now.complexity) {
+                    changes.push(FunctionChange {
+                        name: key.0.to_string(),
+                        status: ChangeStatus::Modified,
+                        before: Some(then),
+                        after: Some(now),
+                    });
+                }
+            }
+            None => changes.push(FunctionChange {
+                name: key.0.to_string(),
+                status: ChangeStatus::Added,
+                before: None,
+                after: Some(now),
+            }),
+        }
+    }
+
+    let mut removed: Vec<_> = previous.into_values().collect();
+    removed.sort_by_key(|function| function.start_line);
+    changes.extend(removed.into_iter().map(|function| FunctionChange {
+        name: function_name(function).to_string(),
+        status: ChangeStatus::Removed,
+        before: Some(FunctionMetrics::from(function)),
+        after: None,
+    }));
+    changes
+}
+
+/// Keys functions by name and the number of earlier functions with the same
+/// name, preserving their order.
+fn index_functions(functions: &[FunctionStats]) -> Vec<((&str, usize), &FunctionStats)> {
+    let mut seen: HashMap<&str, usize> = HashMap::new();
+    functions
+        .iter()
+        .map(|function| {
+            let name = function_name(function);
+            let occurrence = seen.entry(name).or_default();
+            let key = (name, *occurrence);
+            *occurrence += 1;
+            (key, function)
+        })
+        .collect()
+}
+
+/// Returns the qualified name of a function, or its name in reports that
+/// predate qualified names.
+fn function_name(function: &FunctionStats) -> &str {
+    if function.qualified_name.is_empty() {
+        &function.name
+    } else {
+        &function.qualified_name
+    }
+}
+
+/// Lists the values of `metric` that grew: the maximum over all functions,
+/// then each function in both reports, by path.
+///
+/// # Arguments
+///
+/// * `old` - Files of the earlier report
+/// * `new` - Files of the later report
+/// * `report` - The comparison of `old` and `new`, see `compare`
+/// * `metric` - The metric to check
+pub(crate) fn increases(
+    old: &[FileStats],
+    new: &[FileStats],
+    report: &DiffReport,
+    metric: CompareMetric,
+) -> Vec<Increase> {
+    let (label, value): (&str, fn(&FunctionMetrics) -> usize) = match metric {
+        CompareMetric::Complexity => ("complexity", |m| m.complexity),
+        CompareMetric::Lines => ("lines", |m| m.lines),
+    };
+    let maximum = |files: &[FileStats]| {
+        files
+            .iter()
+            .flat_map(|file| &file.stats.functions)
+            .map(|function| value(&FunctionMetrics::from(function)))
+            .max()
+            .unwrap_or(0)
+    };
+
+    let mut increases = Vec::new();
+    let (before, after) = (maximum(old), maximum(new));
+    if after > before {
+        increases.push(Increase {
+            metric: format!("max {label}"),
+            before,
+            after,
+        });
+    }
+    for file in &report.files {
+        for change in &file.functions {
+            if let (Some(then), Some(now)) = (&change.before, &change.after)
+                && value(now) > value(then)
+            {
+                increases.push(Increase {
+                    metric: format!("{} {}: {label}", file.path.display(), change.name),
+                    before: value(then),
+                    after: value(now),
+                });
+            }
+        }
+    }
+    increases
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::stats::test_support::file_with as file;
+
+    fn function(
+        name: &str,
+        start_line: usize,
+        end_line: usize,
+        complexity: usize,
+    ) -> FunctionStats {
+        FunctionStats {
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            start_line,
+            end_line,
+            complexity,
+            ..Default::default()
+        }
+    }
+
+    fn reports() -> (Vec<FileStats>, Vec<FileStats>) {
+        let old = vec![
+            file(
+                "src/lib.rs",
+                40,
+                vec![
+                    function("parse", 1, 20, 4),
+                    function("render", 22, 30, 2),
+                    function("legacy", 32, 40, 3),
+                ],
+            ),
+            file("src/old.rs", 10, vec![function("gone", 1, 10, 1)]),
+            file("src/same.rs", 5, vec![function("keep", 1, 5, 1)]),
+        ];
+        let new = vec![
+            file(
+                "src/lib.rs",
+                45,
+                vec![
+                    // Moved down but unchanged
+                    function("render", 1, 9, 2),
+                    function("parse", 11, 35, 6),
+                ],
+            ),
+            file("src/new.rs", 3, vec![function("fresh", 1, 3, 1)]),
+            file("src/same.rs", 5, vec![function("keep", 1, 5, 1)]),
+        ];
+        (old, new)
+    }
+
+    #[test]
+    fn test_compare() {
+        let (old, new) = reports();
+        let report = compare(&old, &new, "v1.json");
+        assert_eq!(report.base, "v1.json");
+
+        let files: Vec<(String, FileStatus)> = report
+            .files
+            .iter()
+            .map(|file| (file.path.display().to_string(), file.status))
+            .collect();
+        assert_eq!(
+            files,
+            [
+                ("src/lib.rs".to_string(), FileStatus::Modified),
+                ("src/new.rs".to_string(), FileStatus::Added),
+                ("src/old.rs".to_string(), FileStatus::Deleted),
+            ]
+        );
+
+        let lib: Vec<(&str, ChangeStatus)> = report.files[0]
+            .functions
+            .iter()
+            .map(|change| (change.name.as_str(), change.status))
+            .collect();
+        assert_eq!(
+            lib,
+            [
+                ("parse", ChangeStatus::Modified),
+                ("legacy", ChangeStatus::Removed)
+            ]
+        );
+        let parse = &report.files[0].functions[0];
+        assert_eq!(
+            (
+                parse.before.unwrap().complexity,
+                parse.after.unwrap().complexity
+            ),
+            (4, 6)
+        );
+    }
+
+    #[test]
+    fn test_increases() {
+        let (old, new) = reports();
+        let report = compare(&old, &new, "v1.json");
+
+        let complexity: Vec<String> = increases(&old, &new, &report, CompareMetric::Complexity)
+            .iter()
+            .map(ToString::to_string)
+            .collect();
+        assert_eq!(
+            complexity,
+            [
+                "max complexity: 4 -> 6",
+                "src/lib.rs parse: complexity: 4 -> 6"
+            ]
+        );
+        assert!(
+            increases(
+                &new,
+                &old,
+                &compare(&new, &old, "v2.json"),
+                CompareMetric::Complexity
+            )
+            .is_empty()
+        );
+    }
+
+    #[test]
+    fn test_load_report() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("report.json");
+        let (old, _) = reports();
+        let mut stats = crate::stats::DirectoryStats::new();
+        for file in old {
+            stats.add_file(file);
+        }
+        let json = crate::formatter::format_output(
+            &stats,
+            crate::cli::OutputFormat::Json,
+            false,
+            &crate::stats::Thresholds::default(),
+        );
+        fs::write(&path, json).unwrap();
+
+        let files = load_report(&path).unwrap();
+        assert_eq!(files.len(), 3);
+        assert_eq!(files[0].stats.functions[0].qualified_name, "parse");
+
+        fs::write(&path, "{\"schema_version\": 99, \"files\": []}").unwrap();
+        let err = load_report(&path).unwrap_err();
+        assert!(err.to_string().contains("schema version 99"), "{err}");
+    }
+}
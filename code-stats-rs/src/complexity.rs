@@ -0,0 +1,1179 @@
+//! Cyclomatic complexity, cognitive complexity, and nesting depth computation
+//! over tree-sitter syntax trees.
+
+use crate::language::SupportedLanguage;
+use tree_sitter::Node;
+
+/// Returns true if `node` is a function-like declaration whose complexity
+/// should be reported.
+///
+/// This mirrors the declarations counted as functions by the parser. Most
+/// grammars tell them apart by node kind; Elixir's `def` is a call like any
+/// other, so it is recognized by the name it calls, and Haskell and OCaml
+/// bindings by where they are and what they bind.
+pub(crate) fn is_function(node: &Node, source: &[u8], language: &SupportedLanguage) -> bool {
+    language.rules().is_function(node, source)
+}
+
+/// Computes the cyclomatic complexity of a function node.
+///
+/// Complexity starts at 1 and increases by one for every decision point in the
+/// function body: branches, loops, non-default case clauses, catch clauses,
+/// conditional expressions, and short-circuiting boolean operators. Haskell
+/// and OCaml count the branches of their pattern matches instead: each
+/// `case` alternative, guard, or `match` case after the first, plus `if`s,
+/// loops, and exception handlers.
+///
+/// Nested functions are not descended into; each one is measured on its own.
+pub(crate) fn cyclomatic_complexity(
+    function: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> usize {
+    let mut complexity = 1;
+    let mut cursor = function.walk();
+    for child in function.children(&mut cursor) {
+        complexity += count_decision_points(&child, source, language);
+    }
+    complexity
+}
+
+/// Recursively counts decision points under `node`, stopping at nested functions.
+fn count_decision_points(node: &Node, source: &[u8], language: &SupportedLanguage) -> usize {
+    if is_function(node, source, language) {
+        return 0;
+    }
+
+    let mut count = usize::from(language.rules().is_decision_point(node, source));
+    let mut cursor = node.walk();
+    for child in node.children(&mut cursor) {
+        count += count_decision_points(&child, source, language);
+    }
+    count
+}
+
+/// Computes the deepest nesting of control-flow blocks in a function node.
+///
+/// Conditionals, loops, `switch`/`match`, and `try`/`with` blocks each add a
+/// level; straight-line code has depth 0. An `else if` continues the chain of
+/// the `if` it belongs to rather than nesting inside it. Nested functions are
+/// not descended into, as with `cyclomatic_complexity`.
+pub(crate) fn nesting_depth(function: &Node, source: &[u8], language: &SupportedLanguage) -> usize {
+    let mut cursor = function.walk();
+    function
+        .children(&mut cursor)
+        .map(|child| max_nesting(&child, source, language))
+        .max()
+        .unwrap_or(0)
+}
+
+/// Returns the nesting depth of `node` and its descendants, stopping at nested functions.
+fn max_nesting(node: &Node, source: &[u8], language: &SupportedLanguage) -> usize {
+    if is_function(node, source, language) {
+        return 0;
+    }
+
+    let level = usize::from(language.rules().is_nesting_node(node, source) && !is_else_if(node));
+    let mut cursor = node.walk();
+    let deepest = node
+        .children(&mut cursor)
+        .map(|child| max_nesting(&child, source, language))
+        .max()
+        .unwrap_or(0);
+    level + deepest
+}
+
+/// Returns true if `node` is the `if` of an `else if`.
+///
+/// Depending on the grammar the inner `if` is wrapped in an `else_clause`, is
+/// the `alternative` field of the outer one, or (in Kotlin and Swift) follows
+/// its `else` keyword.
+fn is_else_if(node: &Node) -> bool {
+    is_swift_else_if(node)
+        || node.parent().is_some_and(|parent| {
+            parent.kind() == "else_clause"
+                || is_kotlin_else_body(&parent)
+                || parent
+                    .child_by_field_name("alternative")
+                    .is_some_and(|alternative| alternative.id() == node.id())
+        })
+}
+
+/// Returns true if `node` is the body of a Kotlin `else`, which the grammar
+/// leaves as an unlabeled sibling of the `else` keyword.
+fn is_kotlin_else_body(node: &Node) -> bool {
+    node.kind() == "control_structure_body"
+        && node
+            .prev_sibling()
+            .is_some_and(|keyword| keyword.kind() == "else")
+}
+
+/// Returns true if `node` is the `if` of a Swift `else if`, a plain sibling
+/// of the `else` keyword.
+pub(crate) fn is_swift_else_if(node: &Node) -> bool {
+    node.kind() == "if_statement"
+        && node
+            .prev_sibling()
+            .is_some_and(|keyword| keyword.kind() == "else")
+}
+
+/// How a node contributes to cognitive complexity.
+pub(crate) enum Flow {
+    /// Costs 1 plus the current nesting level and nests its contents
+    /// (`if`, loops, `switch`/`match`, `catch`, conditional expressions)
+    Structure,
+    /// Costs 1 regardless of nesting and nests its contents (`else`, `else if`)
+    Branch,
+    /// Nests its contents without a cost of its own (closures and lambdas)
+    Nest,
+    /// Costs 1 without affecting nesting (labeled jumps, `goto`, and each
+    /// sequence of like boolean operators)
+    Break,
+    /// Does not contribute
+    Plain,
+}
+
+/// Computes the cognitive complexity of a function node.
+///
+/// Follows the SonarSource definition: every break in the linear flow costs
+/// 1, and structures nested inside other structures cost 1 more per level, so
+/// deeply nested code scores higher than the same number of flat branches.
+/// `else` and `else if` cost 1 without a nesting penalty, a run of the same
+/// boolean operator costs 1 however long it is, and labeled `break`/`continue`
+/// and `goto` cost 1. Closures that are not reported as functions of their own
+/// add a nesting level. Straight-line code scores 0.
+///
+/// Nested functions are not descended into, as with `cyclomatic_complexity`.
+pub(crate) fn cognitive_complexity(
+    function: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> usize {
+    let mut cursor = function.walk();
+    function
+        .children(&mut cursor)
+        .map(|child| cognitive(&child, source, language, 0))
+        .sum()
+}
+
+/// Recursively scores `node` at the given nesting level, stopping at nested functions.
+fn cognitive(node: &Node, source: &[u8], language: &SupportedLanguage, nesting: usize) -> usize {
+    if is_function(node, source, language) {
+        return 0;
+    }
+
+    let (cost, inner) = match flow(node, source, language) {
+        Flow::Structure => (1 + nesting, nesting + 1),
+        Flow::Branch => (1, nesting + 1),
+        Flow::Nest => (0, nesting + 1),
+        Flow::Break => (1, nesting),
+        Flow::Plain => (0, nesting),
+    };
+    let mut cursor = node.walk();
+    let children: usize = node
+        .children(&mut cursor)
+        .map(|child| {
+            // An `else` continues its `if` at the same level instead of nesting in it
+            let level = if is_else(&child, language) {
+                nesting
+            } else {
+                inner
+            };
+            cognitive(&child, source, language, level)
+        })
+        .sum();
+    cost + children
+}
+
+/// Classifies a node for cognitive complexity.
+fn flow(node: &Node, source: &[u8], language: &SupportedLanguage) -> Flow {
+    let kind = node.kind();
+    if language.rules().is_if(kind) {
+        let chained = is_else(node, language)
+            || node.parent().is_some_and(|parent| {
+                parent.kind() == "else_clause" || is_kotlin_else_body(&parent)
+            });
+        return if chained {
+            Flow::Branch
+        } else {
+            Flow::Structure
+        };
+    }
+    if is_else(node, language) {
+        // An `else_clause` wrapping the `if` of an `else if` leaves the cost to that `if`
+        let mut cursor = node.walk();
+        let wraps_if = node
+            .named_children(&mut cursor)
+            .any(|child| language.rules().is_if(child.kind()));
+        return if wraps_if { Flow::Plain } else { Flow::Branch };
+    }
+    if language.rules().is_labeled_jump(node) || starts_operator_sequence(node, language) {
+        return Flow::Break;
+    }
+
+    language.rules().flow(node, source)
+}
+
+/// Returns true if `node` is the `else`, `else if`, or `elif` part of an `if`.
+fn is_else(node: &Node, language: &SupportedLanguage) -> bool {
+    node.parent().is_some_and(|parent| {
+        language.rules().is_if(parent.kind())
+            && (matches!(
+                node.kind(),
+                "else_clause"
+                    | "elif_clause"
+                    | "else_if_clause"
+                    | "elif_branch"
+                    | "else_branch"
+                    | "elseif_statement"
+                    | "else_statement"
+            ) || is_kotlin_else_body(node)
+                || is_swift_else_if(node)
+                || parent
+                    .child_by_field_name("alternative")
+                    .is_some_and(|alternative| alternative.id() == node.id()))
+    })
+}
+
+/// Returns true if `node` is a boolean operation that does not continue a
+/// sequence of the same operator, such as the `&&` in `a && b || c`.
+fn starts_operator_sequence(node: &Node, language: &SupportedLanguage) -> bool {
+    language
+        .rules()
+        .logical_operator(node)
+        .is_some_and(|operator| {
+            node.parent()
+                .and_then(|parent| language.rules().logical_operator(&parent))
+                != Some(operator)
+        })
+}
+
+/// Returns the boolean operator token among the children of `node`, for
+/// grammars that don't put it in an `operator` field.
+pub(crate) fn operator_token(node: &Node) -> Option<&'static str> {
+    let mut cursor = node.walk();
+    node.children(&mut cursor)
+        .find_map(|child| match child.kind() {
+            "&&" => Some("&&"),
+            "||" => Some("||"),
+            "andalso" => Some("andalso"),
+            "orelse" => Some("orelse"),
+            _ => None,
+        })
+}
+
+/// Returns the `operator` of `node` if it is a `kind` node and the operator
+/// one of `operators`.
+pub(crate) fn binary_operator(node: &Node, kind: &str, operators: &[&str]) -> Option<&'static str> {
+    if node.kind() != kind {
+        return None;
+    }
+    node.child_by_field_name("operator")
+        .map(|op| op.kind())
+        .filter(|op| operators.contains(op))
+}
+
+/// Returns true if the node's `operator` field is one of the given tokens.
+pub(crate) fn has_operator(node: &Node, operators: &[&str]) -> bool {
+    node.child_by_field_name("operator")
+        .is_some_and(|op| operators.contains(&op.kind()))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::{analyze_code, create_parser};
+
+    fn complexities(source: &str, language: SupportedLanguage) -> Vec<(String, usize)> {
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, source, "test", &language).unwrap();
+        stats
+            .functions
+            .into_iter()
+            .map(|f| (f.name, f.complexity))
+            .collect()
+    }
+
+    fn nesting(source: &str, language: SupportedLanguage) -> Vec<(String, usize)> {
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, source, "test", &language).unwrap();
+        stats
+            .functions
+            .into_iter()
+            .map(|f| (f.name, f.max_nesting))
+            .collect()
+    }
+
+    fn cognitive(source: &str, language: SupportedLanguage) -> Vec<(String, usize)> {
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, source, "test", &language).unwrap();
+        stats
+            .functions
+            .into_iter()
+            .map(|f| (f.name, f.cognitive))
+            .collect()
+    }
+
+    #[test]
+    fn test_is_function_node() {
+        assert!(
+            SupportedLanguage::Rust
+                .rules()
+                .is_function_node("function_item")
+        );
+        assert!(
+            SupportedLanguage::Go
+                .rules()
+                .is_function_node("method_declaration")
+        );
+        assert!(
+            SupportedLanguage::TypeScript
+                .rules()
+                .is_function_node("arrow_function")
+        );
+        assert!(
+            !SupportedLanguage::Rust
+                .rules()
+                .is_function_node("struct_item")
+        );
+        assert!(
+            !SupportedLanguage::Python
+                .rules()
+                .is_function_node("class_definition")
+        );
+    }
+
+    #[test]
+    fn test_rust_complexity() {
+        let source = r#"
+fn straight() -> i32 {
+    1
+}
+
+fn branchy(x: i32, flag: bool) -> i32 {
+    if x > 0 && flag {
+        return 1;
+    }
+    for i in 0..x {
+        while i > 2 {}
+    }
+    match x {
+        1 => 1,
+        2 => 2,
+        _ => 0,
+    }
+}
+"#;
+        let result = complexities(source, SupportedLanguage::Rust);
+        assert_eq!(result[0], ("straight".to_string(), 1));
+        // if, &&, for, while, two non-wildcard arms
+        assert_eq!(result[1], ("branchy".to_string(), 7));
+    }
+
+    #[test]
+    fn test_go_complexity() {
+        let source = r#"
+package main
+
+func classify(n int) string {
+    switch {
+    case n < 0:
+        return "negative"
+    case n == 0:
+        return "zero"
+    default:
+        return "positive"
+    }
+}
+"#;
+        let result = complexities(source, SupportedLanguage::Go);
+        assert_eq!(result, vec![("classify".to_string(), 3)]);
+    }
+
+    #[test]
+    fn test_python_complexity() {
+        let source = r#"
+def check(items):
+    for item in items:
+        if item and item.valid:
+            return True
+        elif item is None:
+            continue
+    try:
+        pass
+    except ValueError:
+        pass
+    return False
+"#;
+        let result = complexities(source, SupportedLanguage::Python);
+        // for, if, `and`, elif, except
+        assert_eq!(result, vec![("check".to_string(), 6)]);
+    }
+
+    #[test]
+    fn test_javascript_complexity_excludes_nested_functions() {
+        let source = r#"
+function outer(a, b) {
+    const pick = (x) => x ? a : b;
+    return a ?? b;
+}
+"#;
+        let result = complexities(source, SupportedLanguage::JavaScript);
+        assert_eq!(result[0], ("outer".to_string(), 2)); // ??
+        assert_eq!(result[1], ("pick".to_string(), 2)); // ternary
+    }
+
+    #[test]
+    fn test_java_complexity() {
+        let source = r#"
+class Router {
+    int route(int code) {
+        switch (code) {
+            case 1:
+                return 10;
+            case 2:
+                return 20;
+            default:
+                return 0;
+        }
+    }
+}
+"#;
+        let result = complexities(source, SupportedLanguage::Java);
+        assert_eq!(result, vec![("route".to_string(), 3)]);
+    }
+
+    #[test]
+    fn test_c_complexity() {
+        let source = r#"
+int classify(int code, int strict) {
+    switch (code) {
+        case 1:
+            return strict && code > 0 ? 10 : 11;
+        default:
+            break;
+    }
+    for (int i = 0; i < code; i++) {}
+    return 0;
+}
+"#;
+        let result = complexities(source, SupportedLanguage::C);
+        // case 1, &&, ?:, for
+        assert_eq!(result, vec![("classify".to_string(), 5)]);
+    }
+
+    #[test]
+    fn test_cpp_complexity_excludes_lambdas() {
+        let source = r#"
+int total(const std::vector<int>& values) {
+    int sum = 0;
+    for (int v : values) {
+        sum += v;
+    }
+    auto positive = [](int v) { return v > 0 or v == -1; };
+    try {
+        return sum;
+    } catch (const std::exception& e) {
+        return 0;
+    }
+}
+"#;
+        let result = complexities(source, SupportedLanguage::Cpp);
+        // range-for, catch
+        assert_eq!(result[0], ("total".to_string(), 3));
+        // `or`
+        assert_eq!(result[1], ("positive".to_string(), 2));
+    }
+
+    #[test]
+    fn test_rust_nesting_depth() {
+        let source = r#"
+fn flat(x: i32) -> i32 {
+    x + 1
+}
+
+fn deep(items: &[i32]) -> i32 {
+    for item in items {
+        if *item > 0 {
+            match item {
+                1 => return 1,
+                _ => {}
+            }
+        } else if *item < 0 {
+            return -1;
+        }
+    }
+    0
+}
+"#;
+        let result = nesting(source, SupportedLanguage::Rust);
+        // for > if > match; the `else if` stays at the level of its `if`
+        assert_eq!(
+            result,
+            vec![("flat".to_string(), 0), ("deep".to_string(), 3)]
+        );
+    }
+
+    #[test]
+    fn test_nesting_depth_else_if_chains_and_nested_functions() {
+        let source = r#"
+function route(code) {
+    if (code === 1) {
+        return "one";
+    } else if (code === 2) {
+        return "two";
+    } else if (code === 3) {
+        return "three";
+    }
+    const handler = () => {
+        while (true) {
+            try {
+                return 1;
+            } catch (e) {}
+        }
+    };
+    return handler;
+}
+"#;
+        let result = nesting(source, SupportedLanguage::JavaScript);
+        assert_eq!(result[0], ("route".to_string(), 1));
+        assert_eq!(result[1], ("handler".to_string(), 2));
+
+        let go = r#"
+package main
+
+func classify(n int) string {
+    if n < 0 {
+        return "negative"
+    } else if n == 0 {
+        return "zero"
+    }
+    switch {
+    case n > 10:
+        for i := 0; i < n; i++ {
+        }
+    }
+    return "positive"
+}
+"#;
+        assert_eq!(
+            nesting(go, SupportedLanguage::Go),
+            vec![("classify".to_string(), 2)]
+        );
+    }
+
+    #[test]
+    fn test_python_nesting_depth() {
+        let source = r#"
+def load(paths):
+    for path in paths:
+        with open(path) as f:
+            try:
+                if f.readable():
+                    return f.read()
+            except OSError:
+                pass
+        if path:
+            pass
+        elif not path:
+            pass
+"#;
+        assert_eq!(
+            nesting(source, SupportedLanguage::Python),
+            vec![("load".to_string(), 4)]
+        );
+    }
+
+    #[test]
+    fn test_rust_cognitive_complexity() {
+        let source = r#"
+fn flat() -> i32 {
+    1
+}
+
+fn sum_positive(rows: &[Vec<i32>]) -> i32 {
+    let mut total = 0;
+    'rows: for row in rows {
+        for value in row {
+            if *value < 0 {
+                continue 'rows;
+            } else if *value == 0 && total > 10 || *value > 100 {
+                break;
+            } else {
+                total += value;
+            }
+        }
+    }
+    total
+}
+"#;
+        let result = cognitive(source, SupportedLanguage::Rust);
+        // for +1, nested for +2, nested if +3, labeled continue +1,
+        // else if +1, `&&` then `||` +2, else +1
+        assert_eq!(
+            result,
+            vec![("flat".to_string(), 0), ("sum_positive".to_string(), 11)]
+        );
+    }
+
+    #[test]
+    fn test_python_cognitive_complexity() {
+        let source = r#"
+def walk(tree, seen):
+    for node in tree:
+        if node in seen:
+            continue
+        elif node.leaf and not node.hidden:
+            yield node
+        else:
+            pick = lambda n: n.value if n else None
+    try:
+        return None
+    except KeyError:
+        return seen
+"#;
+        // for +1, if +2, elif +1, `and` +1, else +1,
+        // conditional inside the lambda in the else +4, except +1
+        assert_eq!(
+            cognitive(source, SupportedLanguage::Python),
+            vec![("walk".to_string(), 11)]
+        );
+    }
+
+    #[test]
+    fn test_cognitive_complexity_jumps_and_nested_functions() {
+        let js = r#"
+function dispatch(events) {
+    outer: for (const e of events) {
+        switch (e.type) {
+            case "stop":
+                break outer;
+            default:
+                handle(e.payload ?? e.fallback);
+        }
+    }
+    const pick = (x) => (x ? 1 : 2);
+    return pick;
+}
+"#;
+        // for +1, switch +2, labeled break +1, `??` +1; the arrow function
+        // is measured on its own
+        assert_eq!(
+            cognitive(js, SupportedLanguage::JavaScript),
+            vec![("dispatch".to_string(), 5), ("pick".to_string(), 1)]
+        );
+
+        let go = r#"
+package main
+
+func scan(rows [][]int) int {
+rows:
+    for _, row := range rows {
+        for _, v := range row {
+            if v < 0 {
+                continue rows
+            }
+        }
+    }
+    visit := func(x int) bool { return x > 0 || x < -10 }
+    _ = visit
+    return 0
+}
+"#;
+        // for +1, for +2, if +3, labeled continue +1, `||` in the literal +1
+        assert_eq!(
+            cognitive(go, SupportedLanguage::Go),
+            vec![("scan".to_string(), 8)]
+        );
+
+        let c = r#"
+int skip(const char *s) {
+    while (*s) {
+        if (*s == '#') goto done;
+        s++;
+    }
+done:
+    return *s ? 1 : 0;
+}
+"#;
+        // while +1, if +2, goto +1, ?: +1
+        assert_eq!(
+            cognitive(c, SupportedLanguage::C),
+            vec![("skip".to_string(), 5)]
+        );
+    }
+
+    #[test]
+    fn test_java_cognitive_complexity_lambdas_and_catch() {
+        let source = r#"
+class Job {
+    int run(List<Integer> items) {
+        try {
+            items.forEach(i -> { if (i > 0) { count++; } });
+        } catch (IllegalStateException e) {
+            return e.getMessage() != null ? 1 : 0;
+        }
+        return 0;
+    }
+}
+"#;
+        // if inside the lambda +2, catch +1, ternary inside the catch +2
+        assert_eq!(
+            cognitive(source, SupportedLanguage::Java),
+            vec![("run".to_string(), 5)]
+        );
+    }
+
+    #[test]
+    fn test_ruby_complexity_and_cognitive() {
+        let source = r#"
+def check(items, limit)
+  return nil if items.empty?
+  items.each do |item|
+    if item > limit && item.odd?
+      puts item
+    elsif item.zero?
+      next
+    else
+      puts "small"
+    end
+  end
+  total = items.sum rescue 0
+  total > 10 ? :big : :small
+end
+
+def self.pick(items)
+  items.find { |item| item.valid? } || items.first
+end
+"#;
+        // if modifier, if, `&&`, elsif, rescue modifier, ternary; `||`
+        assert_eq!(
+            complexities(source, SupportedLanguage::Ruby),
+            vec![("check".to_string(), 7), ("pick".to_string(), 2)]
+        );
+        // if modifier +1, if inside the block +2, `&&` +1, elsif +1, else +1,
+        // rescue modifier +1, ternary +1; `||` +1
+        assert_eq!(
+            cognitive(source, SupportedLanguage::Ruby),
+            vec![("check".to_string(), 8), ("pick".to_string(), 1)]
+        );
+        assert_eq!(
+            nesting(source, SupportedLanguage::Ruby),
+            vec![("check".to_string(), 1), ("pick".to_string(), 0)]
+        );
+    }
+
+    #[test]
+    fn test_zig_and_nim_complexity_and_cognitive() {
+        let source = r#"
+fn classify(items: []const u32, limit: ?u32) u32 {
+    const max = limit orelse 10;
+    var count: u32 = 0;
+    for (items) |item| {
+        if (item > max and item % 2 == 1) {
+            break;
+        }
+        count += switch (item) {
+            0 => 0,
+            1, 2 => 1,
+            else => 2,
+        };
+    }
+    return count;
+}
+"#;
+        // orelse, for, if, `and`, two switch cases
+        assert_eq!(
+            complexities(source, SupportedLanguage::Zig),
+            vec![("classify".to_string(), 7)]
+        );
+        // orelse +1, for +1, if +2, `and` +1, switch +2
+        assert_eq!(
+            cognitive(source, SupportedLanguage::Zig),
+            vec![("classify".to_string(), 7)]
+        );
+        assert_eq!(
+            nesting(source, SupportedLanguage::Zig),
+            vec![("classify".to_string(), 2)]
+        );
+
+        let source = r#"
+proc classify(items: seq[int], limit: int): string =
+  for item in items:
+    if item > limit and item mod 2 == 1:
+      break
+    elif item == 0:
+      continue
+  case items.len
+  of 0: result = "empty"
+  of 1, 2: result = "small"
+  else: result = "large"
+"#;
+        // for, if, `and`, elif, two `of` branches
+        assert_eq!(
+            complexities(source, SupportedLanguage::Nim),
+            vec![("classify".to_string(), 7)]
+        );
+        // for +1, if +2, `and` +1, elif +1, case +1
+        assert_eq!(
+            cognitive(source, SupportedLanguage::Nim),
+            vec![("classify".to_string(), 6)]
+        );
+        assert_eq!(
+            nesting(source, SupportedLanguage::Nim),
+            vec![("classify".to_string(), 2)]
+        );
+    }
+
+    #[test]
+    fn test_lua_complexity_and_cognitive() {
+        let source = r#"
+function Cart:classify(limit)
+  limit = limit or 10
+  for _, item in ipairs(self.items) do
+    if item > limit and item % 2 == 1 then
+      goto done
+    elseif item == 0 then
+      return "none"
+    else
+      self.count = self.count + 1
+    end
+  end
+  ::done::
+  while #self.items > limit do
+    table.remove(self.items)
+  end
+end
+"#;
+        // `or`, for, if, `and`, elseif, while
+        assert_eq!(
+            complexities(source, SupportedLanguage::Lua),
+            vec![("Cart:classify".to_string(), 7)]
+        );
+        // `or` +1, for +1, if +2, `and` +1, elseif +1, else +1, goto +1,
+        // while +1
+        assert_eq!(
+            cognitive(source, SupportedLanguage::Lua),
+            vec![("Cart:classify".to_string(), 9)]
+        );
+        assert_eq!(
+            nesting(source, SupportedLanguage::Lua),
+            vec![("Cart:classify".to_string(), 2)]
+        );
+    }
+
+    #[test]
+    fn test_scss_complexity_and_cognitive() {
+        let source = r#"
+@mixin spacing($sizes, $limit) {
+  @each $name, $size in $sizes {
+    @if $size > $limit and $size < 100 {
+      .m-#{$name} { margin: $limit; }
+    } @else if $size == 0 {
+      .m-#{$name} { margin: 0; }
+    } @else {
+      .m-#{$name} { margin: $size; }
+    }
+  }
+}
+"#;
+        // @each, @if, `and`, @else if
+        assert_eq!(
+            complexities(source, SupportedLanguage::Scss),
+            vec![("spacing".to_string(), 5)]
+        );
+        // @each +1, @if +2, `and` +1, @else if +1, @else +1
+        assert_eq!(
+            cognitive(source, SupportedLanguage::Scss),
+            vec![("spacing".to_string(), 6)]
+        );
+        assert_eq!(
+            nesting(source, SupportedLanguage::Scss),
+            vec![("spacing".to_string(), 2)]
+        );
+    }
+
+    #[test]
+    fn test_kotlin_complexity_and_cognitive() {
+        let source = r#"
+fun classify(items: List<Int>, limit: Int?): String {
+    val max = limit ?: 10
+    outer@ for (item in items) {
+        if (item > max && item % 2 == 1) {
+            break@outer
+        } else if (item == 0) {
+            continue
+        } else {
+            println(item)
+        }
+    }
+    return when {
+        items.isEmpty() -> "empty"
+        items.size > max -> "large"
+        else -> "small"
+    }
+}
+
+fun safe(block: () -> Unit) {
+    try {
+        block()
+    } catch (e: Exception) {
+        items.forEach { println(it) }
+    }
+}
+"#;
+        // elvis, for, if, `&&`, else if, two `when` entries; catch
+        assert_eq!(
+            complexities(source, SupportedLanguage::Kotlin),
+            vec![
+                ("classify".to_string(), 8),
+                ("safe".to_string(), 2),
+                ("<anonymous>".to_string(), 1),
+            ]
+        );
+        // elvis +1, for +1, if +2, `&&` +1, labeled break +1, else if +1,
+        // else +1, when +1; catch +1
+        assert_eq!(
+            cognitive(source, SupportedLanguage::Kotlin),
+            vec![
+                ("classify".to_string(), 9),
+                ("safe".to_string(), 1),
+                ("<anonymous>".to_string(), 0),
+            ]
+        );
+        assert_eq!(
+            nesting(source, SupportedLanguage::Kotlin),
+            vec![
+                ("classify".to_string(), 2),
+                ("safe".to_string(), 1),
+                ("<anonymous>".to_string(), 0),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_csharp_complexity_and_cognitive() {
+        let source = r#"
+class Pricing
+{
+    string Describe(Order order)
+    {
+        var name = order.Customer?.Name ?? "guest";
+        foreach (var line in order.Lines)
+        {
+            if (line.Quantity > 10 && line.Discounted)
+            {
+                continue;
+            }
+            else if (line.Quantity == 0)
+            {
+                goto done;
+            }
+        }
+        done:
+        switch (order.Kind)
+        {
+            case Kind.Retail:
+                return name;
+            default:
+                return order.Total > 100 ? "large" : "small";
+        }
+    }
+
+    int Rank(int score) => score switch
+    {
+        > 90 => 1,
+        > 50 => 2,
+        _ => 3,
+    };
+}
+"#;
+        // `??`, foreach, if, `&&`, else if, the retail case, ternary;
+        // two non-discard arms
+        assert_eq!(
+            complexities(source, SupportedLanguage::CSharp),
+            vec![("Describe".to_string(), 8), ("Rank".to_string(), 3)]
+        );
+        // `??` +1, foreach +1, if +2, `&&` +1, else if +1, goto +1, switch +1,
+        // ternary +2; switch expression +1
+        assert_eq!(
+            cognitive(source, SupportedLanguage::CSharp),
+            vec![("Describe".to_string(), 10), ("Rank".to_string(), 1)]
+        );
+        assert_eq!(
+            nesting(source, SupportedLanguage::CSharp),
+            vec![("Describe".to_string(), 2), ("Rank".to_string(), 1)]
+        );
+    }
+
+    #[test]
+    fn test_swift_complexity_and_cognitive() {
+        let source = r#"
+func grade(_ scores: [Int], bonus: Int?) -> String {
+    let extra = bonus ?? 0
+    guard !scores.isEmpty else {
+        return "none"
+    }
+    outer: for score in scores {
+        if score + extra > 90 && score < 100 {
+            break outer
+        } else if score == 0 {
+            continue
+        } else {
+            print(score)
+        }
+    }
+    switch scores.count {
+    case 0:
+        return "empty"
+    case 1...3:
+        return "few"
+    default:
+        return "many"
+    }
+}
+
+func load(_ paths: [String]) {
+    do {
+        try read(paths)
+    } catch {
+        paths.forEach { print($0) }
+    }
+}
+"#;
+        // `??`, guard, for, if, `&&`, else if, two cases; catch
+        assert_eq!(
+            complexities(source, SupportedLanguage::Swift),
+            vec![
+                ("grade".to_string(), 9),
+                ("load".to_string(), 2),
+                ("<anonymous>".to_string(), 1),
+            ]
+        );
+        // `??` +1, guard +1, for +1, if +2, `&&` +1, labeled break +1,
+        // else if +1, else +1, switch +1; catch +1
+        assert_eq!(
+            cognitive(source, SupportedLanguage::Swift),
+            vec![
+                ("grade".to_string(), 10),
+                ("load".to_string(), 1),
+                ("<anonymous>".to_string(), 0),
+            ]
+        );
+        assert_eq!(
+            nesting(source, SupportedLanguage::Swift),
+            vec![
+                ("grade".to_string(), 2),
+                ("load".to_string(), 1),
+                ("<anonymous>".to_string(), 0),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_php_complexity_and_cognitive() {
+        let source = r#"<?php
+function grade(array $scores, ?int $bonus): string {
+    $extra = $bonus ?? 0;
+    foreach ($scores as $score) {
+        if ($score + $extra > 90 && $score < 100) {
+            break;
+        } elseif ($score === 0) {
+            continue;
+        } else {
+            echo $score;
+        }
+    }
+    return match (true) {
+        count($scores) === 0 => "empty",
+        count($scores) < 3 => "few",
+        default => "many",
+    };
+}
+
+function find(array $rows): void {
+    foreach ($rows as $row) {
+        foreach ($row as $cell) {
+            if ($cell) {
+                break 2;
+            }
+        }
+    }
+}
+
+function load(string $path): void {
+    try {
+        read($path);
+    } catch (Exception $e) {
+        array_map(fn($line) => trim($line), []);
+    }
+}
+"#;
+        // `??`, foreach, if, `&&`, elseif, two match arms; two foreach and
+        // if; catch
+        assert_eq!(
+            complexities(source, SupportedLanguage::Php),
+            vec![
+                ("grade".to_string(), 8),
+                ("find".to_string(), 4),
+                ("load".to_string(), 2),
+                ("<anonymous>".to_string(), 1),
+            ]
+        );
+        // `??` +1, foreach +1, if +2, `&&` +1, elseif +1, else +1, match +1;
+        // foreach +1, foreach +2, if +3, `break 2` +1; catch +1
+        assert_eq!(
+            cognitive(source, SupportedLanguage::Php),
+            vec![
+                ("grade".to_string(), 8),
+                ("find".to_string(), 7),
+                ("load".to_string(), 1),
+                ("<anonymous>".to_string(), 0),
+            ]
+        );
+        assert_eq!(
+            nesting(source, SupportedLanguage::Php),
+            vec![
+                ("grade".to_string(), 2),
+                ("find".to_string(), 3),
+                ("load".to_string(), 1),
+                ("<anonymous>".to_string(), 0),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_bash_complexity_and_cognitive() {
+        let source = r#"
+check() {
+    if [[ -z "$1" || -z "$2" ]]; then
+        return 1
+    elif [ -f "$1" ]; then
+        for line in $(cat "$1"); do
+            [ -n "$line" ] && echo "$line"
+        done
+    else
+        echo "missing"
+    fi
+    case "$2" in
+        start|restart) run ;;
+        *) ;;
+    esac
+}
+"#;
+        // if, `||`, elif, for, `&&`, one case item
+        assert_eq!(
+            complexities(source, SupportedLanguage::Bash),
+            vec![("check".to_string(), 7)]
+        );
+        // if +1, `||` +1, elif +1, for +2, `&&` +1, else +1, case +1
+        assert_eq!(
+            cognitive(source, SupportedLanguage::Bash),
+            vec![("check".to_string(), 8)]
+        );
+        assert_eq!(
+            nesting(source, SupportedLanguage::Bash),
+            vec![("check".to_string(), 2)]
+        );
+    }
+}
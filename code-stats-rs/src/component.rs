@@ -0,0 +1,124 @@
+//! Single-file components of Vue (`.vue`) and Svelte (`.svelte`).
+//!
+//! A component keeps its markup, script, and styles in one file. It is parsed
+//! with the HTML grammar, which sees the `<script>` and `<style>` sections as
+//! it does the inline code of HTML documents, and those are analyzed in their
+//! own languages: JavaScript, or TypeScript with `lang="ts"`, and CSS, or
+//! SCSS with `lang="scss"`. Unlike the inline code of an HTML document, their
+//! statistics are the component's own, so a Vue file reports the functions of
+//! its script and the lines of all sections, with the breakdown by section
+//! in `ComponentStats`.
+//!
+//! The markup around the sections, the `<template>` of a Vue component and
+//! everything else in a Svelte one, is the template section, measured by its
+//! elements as HTML is. Expressions and directives in the template are not
+//! analyzed.
+
+use crate::comments::LineStats;
+use crate::fences::EmbeddedCode;
+use crate::language::SupportedLanguage;
+use crate::parser::CodeStats;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+
+/// Lines of the sections of components.
+#[derive(Default, Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct ComponentStats {
+    /// Lines of the markup around the scripts and styles
+    pub template: LineStats,
+    /// Lines of the `<script>` sections
+    pub script: LineStats,
+    /// Lines of the `<style>` sections
+    pub style: LineStats,
+}
+
+impl ComponentStats {
+    /// Adds the line counts of `other`.
+    pub(crate) fn merge(&mut self, other: &ComponentStats) {
+        self.template.merge(&other.template);
+        self.script.merge(&other.script);
+        self.style.merge(&other.style);
+    }
+}
+
+/// Adds the statistics of a component's script and style sections to the
+/// component's own and records the lines of each section.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics of the component's markup, which become the
+///   component's
+/// * `sections` - Statistics of the sections by language, as returned by
+///   `CodeAnalyzer::analyze_blocks`
+pub(crate) fn add_sections(
+    stats: &mut CodeStats,
+    sections: BTreeMap<SupportedLanguage, EmbeddedCode>,
+) {
+    let mut component = ComponentStats {
+        template: stats.lines,
+        ..ComponentStats::default()
+    };
+    for (language, mut section) in sections {
+        let lines = match language {
+            SupportedLanguage::Css | SupportedLanguage::Scss => &mut component.style,
+            _ => &mut component.script,
+        };
+        lines.merge(&section.stats.lines);
+
+        stats.merge(&section.stats);
+        stats.functions.append(&mut section.stats.functions);
+        stats.types.append(&mut section.stats.types);
+        stats.statements.append(&mut section.stats.statements);
+    }
+    stats.component = Some(component);
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn lines(code: usize, comment: usize, blank: usize) -> LineStats {
+        LineStats {
+            code,
+            comment,
+            blank,
+            ..LineStats::default()
+        }
+    }
+
+    fn section(function_count: usize, lines: LineStats) -> EmbeddedCode {
+        EmbeddedCode {
+            blocks: 1,
+            stats: CodeStats {
+                function_count,
+                lines,
+                ..CodeStats::default()
+            },
+        }
+    }
+
+    #[test]
+    fn test_add_sections() {
+        let mut stats = CodeStats {
+            lines: lines(12, 1, 2),
+            ..CodeStats::default()
+        };
+        let sections = BTreeMap::from([
+            (SupportedLanguage::TypeScript, section(3, lines(20, 4, 3))),
+            (SupportedLanguage::Scss, section(0, lines(8, 0, 1))),
+        ]);
+        add_sections(&mut stats, sections);
+
+        // The script's functions and all lines are the component's
+        assert_eq!(stats.function_count, 3);
+        assert_eq!(stats.lines, lines(40, 5, 6));
+        assert_eq!(
+            stats.component,
+            Some(ComponentStats {
+                template: lines(12, 1, 2),
+                script: lines(20, 4, 3),
+                style: lines(8, 0, 1),
+            })
+        );
+    }
+}
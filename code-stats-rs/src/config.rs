@@ -0,0 +1,413 @@
+//! Project configuration loaded from `.codestats.toml`.
+//!
+//! The file holds a team's shared analysis policy so it can be checked in
+//! instead of repeated on every command line:
+//!
+//! ```toml
+//! include = ["src/**", "lib/**"]   # only analyze matching files
+//! exclude = ["**/*_generated.go", "vendor"]
+//! languages = ["rust", "go"]       # skip files in other languages
+//! format = "json"
+//! queries = "codestats-queries.toml"   # relative to this file
+//! todo_markers = ["TODO", "FIXME", "SAFETY"]
+//! max_parse_size = 16              # MiB; larger files only have lines counted
+//! parse_timeout = 10               # seconds; slower files are listed as timed out
+//!
+//! [thresholds]
+//! complexity = 15
+//! function_lines = 80
+//! parameters = 5                  # limits enforced by `check`
+//! returns = 2
+//! type_members = 40               # god objects in `--group-by type`
+//!
+//! [strings]
+//! min_length = 3                   # shorter literals are not listed
+//! include_tests = false
+//! ignore = ["OK", "Loading..."]    # literals never listed
+//!
+//! [grammars]                       # versions the metrics were recorded with
+//! on_mismatch = "error"            # or "warn", the default
+//! rust = "0.24"                    # any 0.24.x release of tree-sitter-rust
+//! go = "0.25.0"
+//!
+//! [[rule]]                         # a --lint rule, see `lint`
+//! id = "no-unwrap"
+//! language = "rust"
+//! message = "handle the error instead of calling {method}"
+//! query = '(call_expression function: (field_expression field: (field_identifier) @method (#eq? @method "unwrap"))) @finding'
+//!
+//! [[plugin]]                       # run with --plugins, see `plugin`
+//! name = "team"
+//! command = ["python3", "tools/metrics.py"]
+//! ```
+//!
+//! Every setting is optional. Command-line flags take precedence over the
+//! values in the file.
+
+use crate::analyzer::glob_set;
+use crate::cli::OutputFormat;
+use crate::error::{CodeStatsError, Result};
+use crate::language::SupportedLanguage;
+use crate::lint::RuleDefinition;
+use crate::plugin::PluginDefinition;
+use serde::Deserialize;
+use std::collections::BTreeMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+
+/// Name of the configuration file looked up in the analyzed directory and its ancestors.
+pub(crate) const CONFIG_FILE: &str = ".codestats.toml";
+
+/// Settings as written in the configuration file.
+#[derive(Debug, Default, Deserialize)]
+#[serde(deny_unknown_fields)]
+struct ConfigFile {
+    #[serde(default)]
+    include: Vec<String>,
+    #[serde(default)]
+    exclude: Vec<String>,
+    #[serde(default)]
+    languages: Vec<String>,
+    format: Option<OutputFormat>,
+    queries: Option<PathBuf>,
+    #[serde(default)]
+    todo_markers: Vec<String>,
+    max_parse_size: Option<u64>,
+    parse_timeout: Option<u64>,
+    #[serde(default)]
+    thresholds: ThresholdConfig,
+    #[serde(default)]
+    strings: StringsConfig,
+    #[serde(default)]
+    grammars: GrammarsConfig,
+    #[serde(default, rename = "rule")]
+    rules: Vec<RuleDefinition>,
+    #[serde(default, rename = "plugin")]
+    plugins: Vec<PluginDefinition>,
+}
+
+/// The `[grammars]` table: what to do on a mismatch and, under any other
+/// key, the version a language's grammar is pinned to.
+#[derive(Debug, Default, Deserialize)]
+struct GrammarsConfig {
+    #[serde(default)]
+    on_mismatch: OnMismatch,
+    #[serde(flatten)]
+    versions: BTreeMap<String, String>,
+}
+
+/// What a grammar that differs from its pin does to a run.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub(crate) enum OnMismatch {
+    /// Print a warning and analyze anyway
+    #[default]
+    Warn,
+    /// Fail before analyzing anything
+    Error,
+}
+
+/// Grammar versions pinned by the `[grammars]` table.
+#[derive(Debug, Default, Clone)]
+pub(crate) struct GrammarPins {
+    pub on_mismatch: OnMismatch,
+    /// Each pinned language with its version, ordered by the name it was
+    /// given under
+    pub versions: Vec<(SupportedLanguage, String)>,
+}
+
+/// The `[thresholds]` table.
+#[derive(Debug, Default, Clone, Copy, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub(crate) struct ThresholdConfig {
+    /// Replaces the default of `--complexity-threshold`
+    pub complexity: Option<usize>,
+    /// Replaces the default of `--max-function-lines`
+    pub function_lines: Option<usize>,
+    /// Limit of `check --max-params` when the flag is not given
+    pub parameters: Option<usize>,
+    /// Limit of `check --max-returns` when the flag is not given
+    pub returns: Option<usize>,
+    /// Replaces the default of `--max-type-members`
+    pub type_members: Option<usize>,
+}
+
+/// The `[strings]` table, which tunes the `--strings` listing.
+#[derive(Debug, Default, Clone, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub(crate) struct StringsConfig {
+    /// Shortest literal, in characters, that is listed
+    pub min_length: Option<usize>,
+    /// Also list the literals of test files
+    #[serde(default)]
+    pub include_tests: bool,
+    /// Literals that are never listed, matched exactly
+    #[serde(default)]
+    pub ignore: Vec<String>,
+}
+
+/// A loaded project configuration, with paths resolved.
+#[derive(Debug, Default, Clone)]
+pub(crate) struct Config {
+    /// Directory containing the configuration file, which globs are relative to
+    pub root: Option<PathBuf>,
+    /// Only analyze files matching one of these globs (all files if empty)
+    pub include: Vec<String>,
+    /// Skip files matching any of these globs
+    pub exclude: Vec<String>,
+    /// Only analyze files in these languages (all languages if empty)
+    pub languages: Vec<SupportedLanguage>,
+    /// Output format used when `--format` is not given
+    pub format: Option<OutputFormat>,
+    /// Custom query file used when `--queries` is not given
+    pub queries: Option<PathBuf>,
+    /// Comment markers used when `--todo-markers` is not given
+    pub todo_markers: Vec<String>,
+    /// Parse size limit in MiB used when `--max-parse-size` is not given
+    pub max_parse_size: Option<u64>,
+    /// Parse timeout in seconds used when `--parse-timeout` is not given
+    pub parse_timeout: Option<u64>,
+    /// Thresholds used when the corresponding flags are not given
+    pub thresholds: ThresholdConfig,
+    /// Settings of the `--strings` listing
+    pub strings: StringsConfig,
+    /// Versions the grammars are expected to have
+    pub grammars: GrammarPins,
+    /// Rules checked by `--lint`, compiled when they are used; `.scm` paths
+    /// are relative to `root`
+    pub rules: Vec<RuleDefinition>,
+    /// Plugins run with `--plugins`, started when they are used; commands
+    /// run in `root`
+    pub plugins: Vec<PluginDefinition>,
+}
+
+impl Config {
+    /// Finds the configuration file that applies to `path`.
+    ///
+    /// Looks for `.codestats.toml` in `path` itself if it is a directory, in
+    /// its parent directory otherwise, and then in each ancestor directory.
+    ///
+    /// # Returns
+    ///
+    /// The path of the closest configuration file, or `None` if there is none.
+    pub(crate) fn discover(path: &Path) -> Option<PathBuf> {
+        let path = path.canonicalize().ok()?;
+        let start = if path.is_dir() {
+            path.as_path()
+        } else {
+            path.parent()?
+        };
+        start
+            .ancestors()
+            .map(|dir| dir.join(CONFIG_FILE))
+            .find(|candidate| candidate.is_file())
+    }
+
+    /// Loads the configuration file at `path`.
+    ///
+    /// `queries` is resolved against the file's directory, and globs are
+    /// checked so that a typo is reported up front rather than silently
+    /// matching nothing.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Config)` - The parsed configuration
+    /// * `Err(ConfigError)` - The file can't be read or parsed, or it names an
+    ///   unknown language or an invalid glob
+    pub(crate) fn load(path: &Path) -> Result<Self> {
+        let content = fs::read_to_string(path).map_err(|e| {
+            CodeStatsError::ConfigError(format!("Failed to read {}: {e}", path.display()))
+        })?;
+        let file: ConfigFile = toml::from_str(&content)
+            .map_err(|e| CodeStatsError::ConfigError(format!("{}: {e}", path.display())))?;
+        let invalid =
+            |message: String| CodeStatsError::ConfigError(format!("{}: {message}", path.display()));
+
+        let languages = file
+            .languages
+            .iter()
+            .map(|name| {
+                SupportedLanguage::from_name(name)
+                    .ok_or_else(|| invalid(format!("unknown language '{name}'")))
+            })
+            .collect::<Result<Vec<_>>>()?;
+        let pinned = file
+            .grammars
+            .versions
+            .into_iter()
+            .map(|(name, version)| {
+                SupportedLanguage::from_name(&name)
+                    .map(|language| (language, version))
+                    .ok_or_else(|| invalid(format!("[grammars]: unknown language '{name}'")))
+            })
+            .collect::<Result<Vec<_>>>()?;
+        for globs in [&file.include, &file.exclude] {
+            glob_set(globs).map_err(|e| match e {
+                CodeStatsError::ConfigError(message) => invalid(message),
+                e => e,
+            })?;
+        }
+
+        let root = path.parent().unwrap_or(Path::new(".")).to_path_buf();
+        Ok(Self {
+            queries: file.queries.map(|queries| root.join(queries)),
+            root: Some(root),
+            include: file.include,
+            exclude: file.exclude,
+            languages,
+            format: file.format,
+            todo_markers: file.todo_markers,
+            max_parse_size: file.max_parse_size,
+            parse_timeout: file.parse_timeout,
+            thresholds: file.thresholds,
+            strings: file.strings,
+            grammars: GrammarPins {
+                on_mismatch: file.grammars.on_mismatch,
+                versions: pinned,
+            },
+            rules: file.rules,
+            plugins: file.plugins,
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_load_resolves_settings() {
+        let temp_dir = TempDir::new().unwrap();
+        let path = temp_dir.path().join(CONFIG_FILE);
+        fs::write(
+            &path,
+            r#"
+include = ["src/**"]
+exclude = ["*_generated.go"]
+languages = ["Rust", "c++"]
+format = "json"
+queries = "queries/codestats.toml"
+todo_markers = ["TODO", "NOTE"]
+max_parse_size = 16
+parse_timeout = 5
+
+[thresholds]
+complexity = 15
+parameters = 5
+
+[strings]
+min_length = 4
+ignore = ["OK"]
+
+[grammars]
+on_mismatch = "error"
+rust = "0.24"
+"c++" = "0.23.4"
+
+[[rule]]
+id = "no-panic"
+language = "go"
+severity = "error"
+message = "panic in library code"
+query = "(call_expression) @finding"
+
+[[plugin]]
+name = "team"
+command = ["python3", "tools/metrics.py"]
+languages = ["go"]
+tree = "none"
+"#,
+        )
+        .unwrap();
+
+        let config = Config::load(&path).unwrap();
+        assert_eq!(config.root.as_deref(), Some(temp_dir.path()));
+        assert_eq!(config.include, vec!["src/**"]);
+        assert_eq!(config.exclude, vec!["*_generated.go"]);
+        assert_eq!(
+            config.languages,
+            vec![SupportedLanguage::Rust, SupportedLanguage::Cpp]
+        );
+        assert_eq!(config.format, Some(OutputFormat::Json));
+        assert_eq!(
+            config.queries,
+            Some(temp_dir.path().join("queries/codestats.toml"))
+        );
+        assert_eq!(config.todo_markers, vec!["TODO", "NOTE"]);
+        assert_eq!(config.max_parse_size, Some(16));
+        assert_eq!(config.parse_timeout, Some(5));
+        assert_eq!(config.thresholds.complexity, Some(15));
+        assert_eq!(config.thresholds.function_lines, None);
+        assert_eq!(config.thresholds.parameters, Some(5));
+        assert_eq!(config.thresholds.returns, None);
+        assert_eq!(config.strings.min_length, Some(4));
+        assert!(!config.strings.include_tests);
+        assert_eq!(config.strings.ignore, vec!["OK"]);
+        assert_eq!(config.grammars.on_mismatch, OnMismatch::Error);
+        assert_eq!(
+            config.grammars.versions,
+            vec![
+                (SupportedLanguage::Cpp, "0.23.4".to_string()),
+                (SupportedLanguage::Rust, "0.24".to_string()),
+            ]
+        );
+        assert_eq!(config.rules.len(), 1);
+        assert_eq!(config.rules[0].id, "no-panic");
+        assert_eq!(config.rules[0].severity, crate::lint::Severity::Error);
+        assert_eq!(config.plugins.len(), 1);
+        assert_eq!(config.plugins[0].name, "team");
+        assert_eq!(
+            config.plugins[0].command,
+            vec!["python3", "tools/metrics.py"]
+        );
+        assert_eq!(config.plugins[0].languages, vec!["go"]);
+    }
+
+    #[test]
+    fn test_load_rejects_invalid_settings() {
+        let temp_dir = TempDir::new().unwrap();
+        let path = temp_dir.path().join(CONFIG_FILE);
+        let error = |content: &str| {
+            fs::write(&path, content).unwrap();
+            Config::load(&path).unwrap_err().to_string()
+        };
+
+        assert!(error(r#"languages = ["cobol"]"#).contains("unknown language 'cobol'"));
+        assert!(error(r#"exclude = ["src/[oops"]"#).contains("invalid glob 'src/[oops'"));
+        assert!(error(r#"format = "yaml""#).contains(CONFIG_FILE));
+        assert!(error("unknown_key = 1").contains("unknown_key"));
+        assert!(
+            error("[grammars]\ncobol = \"1.0\"").contains("[grammars]: unknown language 'cobol'")
+        );
+        assert!(error("[grammars]\non_mismatch = \"ignore\"").contains("ignore"));
+        assert!(error("[[plugin]]\nname = \"x\"\ncommand = []\nshell = true").contains("shell"));
+        assert!(
+            Config::load(&temp_dir.path().join("missing.toml"))
+                .unwrap_err()
+                .to_string()
+                .contains("Failed to read")
+        );
+    }
+
+    #[test]
+    fn test_discover_searches_ancestors() {
+        let temp_dir = TempDir::new().unwrap();
+        let nested = temp_dir.path().join("src").join("deep");
+        fs::create_dir_all(&nested).unwrap();
+        let file = nested.join("main.rs");
+        fs::write(&file, "fn main() {}").unwrap();
+        let root = temp_dir.path().canonicalize().unwrap();
+
+        fs::write(temp_dir.path().join(CONFIG_FILE), "").unwrap();
+        assert_eq!(Config::discover(&nested), Some(root.join(CONFIG_FILE)));
+        assert_eq!(Config::discover(&file), Some(root.join(CONFIG_FILE)));
+
+        // The closest file wins
+        fs::write(nested.join(CONFIG_FILE), "").unwrap();
+        assert_eq!(
+            Config::discover(&file),
+            Some(root.join("src/deep").join(CONFIG_FILE))
+        );
+    }
+}
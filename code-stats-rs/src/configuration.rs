@@ -0,0 +1,364 @@
+//! Key counts and nesting depth of YAML, JSON, and TOML files.
+//!
+//! Configuration files have no functions or types to count, so they are
+//! measured by the keys they define instead. Every key is counted once per
+//! path it is defined at: the TOML header `[server.tls]` defines `server` and
+//! `server.tls`, and a later `[server.http]` only adds `server.http`. Items
+//! of an array are separate paths, so a list of three mappings with a `name`
+//! each defines three `name` keys.
+//!
+//! Nesting depth is the largest number of keys on the path to any value;
+//! arrays along the path do not add to it.
+
+use crate::language::SupportedLanguage;
+use serde::{Deserialize, Serialize};
+use std::collections::{HashMap, HashSet};
+use tree_sitter::Node;
+
+/// Shape of a configuration file.
+#[derive(Default, Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct ConfigStats {
+    /// Number of keys defined, counting each path once
+    pub keys: usize,
+    /// Largest number of keys on the path to a value (1 for a flat file, 0
+    /// for a file without keys)
+    pub max_depth: usize,
+    /// Number of documents: YAML files may hold several separated by `---`,
+    /// JSON and TOML files always hold one
+    pub documents: usize,
+}
+
+impl ConfigStats {
+    /// Adds the counts of `other`, keeping the deeper of the two depths.
+    pub(crate) fn merge(&mut self, other: &ConfigStats) {
+        self.keys += other.keys;
+        self.max_depth = self.max_depth.max(other.max_depth);
+        self.documents += other.documents;
+    }
+}
+
+/// One step of the path from the root of a document to a value.
+#[derive(Debug, Clone, PartialEq, Eq, Hash)]
+enum Segment {
+    Key(String),
+    /// Position in an array, or of a document in a YAML stream
+    Index(usize),
+}
+
+/// Walks a syntax tree and collects the key paths it defines.
+struct KeyWalker<'a> {
+    source: &'a [u8],
+    keys: HashSet<Vec<Segment>>,
+    max_depth: usize,
+    /// Elements seen so far per TOML `[[array]]` header path
+    table_arrays: HashMap<Vec<Segment>, usize>,
+}
+
+/// Measures the keys and nesting depth of a configuration file.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the tree parsed from `source`
+/// * `source` - The file's contents
+/// * `language` - YAML, JSON, or TOML
+///
+/// # Returns
+///
+/// The file's statistics; other languages get all zeros.
+pub(crate) fn config_stats(
+    root: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> ConfigStats {
+    let mut walker = KeyWalker {
+        source,
+        keys: HashSet::new(),
+        max_depth: 0,
+        table_arrays: HashMap::new(),
+    };
+    let mut path = Vec::new();
+    let documents = match language {
+        SupportedLanguage::Yaml => {
+            // Documents are numbered so that equal keys in two of them stay
+            // separate definitions
+            let mut cursor = root.walk();
+            let documents: Vec<_> = root
+                .named_children(&mut cursor)
+                .filter(|child| child.kind() == "document")
+                .collect();
+            for (index, document) in documents.iter().enumerate() {
+                path.push(Segment::Index(index));
+                walker.visit_yaml(document, &mut path);
+                path.pop();
+            }
+            documents.len()
+        }
+        SupportedLanguage::Json => {
+            walker.visit_json(root, &mut path);
+            1
+        }
+        SupportedLanguage::Toml => {
+            walker.visit_toml_document(root);
+            1
+        }
+        _ => return ConfigStats::default(),
+    };
+
+    ConfigStats {
+        keys: walker.keys.len(),
+        max_depth: walker.max_depth,
+        documents,
+    }
+}
+
+impl KeyWalker<'_> {
+    fn text(&self, node: &Node) -> String {
+        node.utf8_text(self.source).unwrap_or_default().to_string()
+    }
+
+    /// Records every key along `path`, so that prefixes a TOML header or
+    /// dotted key implies are defined as well.
+    fn record(&mut self, path: &[Segment]) {
+        for (end, segment) in path.iter().enumerate() {
+            if matches!(segment, Segment::Key(_)) {
+                self.keys.insert(path[..=end].to_vec());
+            }
+        }
+        let depth = path
+            .iter()
+            .filter(|segment| matches!(segment, Segment::Key(_)))
+            .count();
+        self.max_depth = self.max_depth.max(depth);
+    }
+
+    /// Visits the items of an array, numbering each one.
+    fn visit_items<'tree>(
+        &mut self,
+        items: impl Iterator<Item = Node<'tree>>,
+        path: &mut Vec<Segment>,
+        visit: fn(&mut Self, &Node, &mut Vec<Segment>),
+    ) {
+        for (index, item) in items.filter(|item| item.kind() != "comment").enumerate() {
+            path.push(Segment::Index(index));
+            visit(self, &item, path);
+            path.pop();
+        }
+    }
+
+    fn visit_json(&mut self, node: &Node, path: &mut Vec<Segment>) {
+        match node.kind() {
+            "pair" => {
+                let Some(key) = node.child_by_field_name("key") else {
+                    return;
+                };
+                path.push(Segment::Key(self.text(&key)));
+                self.record(path);
+                if let Some(value) = node.child_by_field_name("value") {
+                    self.visit_json(&value, path);
+                }
+                path.pop();
+            }
+            "array" => {
+                let mut cursor = node.walk();
+                self.visit_items(node.named_children(&mut cursor), path, Self::visit_json);
+            }
+            _ => {
+                let mut cursor = node.walk();
+                for child in node.named_children(&mut cursor) {
+                    self.visit_json(&child, path);
+                }
+            }
+        }
+    }
+
+    fn visit_yaml(&mut self, node: &Node, path: &mut Vec<Segment>) {
+        match node.kind() {
+            "block_mapping_pair" | "flow_pair" => {
+                // A complex `? key` without a plain key is still one key
+                let key = node
+                    .child_by_field_name("key")
+                    .map(|key| self.text(&key))
+                    .unwrap_or_default();
+                path.push(Segment::Key(key.trim().to_string()));
+                self.record(path);
+                if let Some(value) = node.child_by_field_name("value") {
+                    self.visit_yaml(&value, path);
+                }
+                path.pop();
+            }
+            "block_sequence" | "flow_sequence" => {
+                let mut cursor = node.walk();
+                self.visit_items(node.named_children(&mut cursor), path, Self::visit_yaml);
+            }
+            _ => {
+                let mut cursor = node.walk();
+                for child in node.named_children(&mut cursor) {
+                    self.visit_yaml(&child, path);
+                }
+            }
+        }
+    }
+
+    /// Visits a TOML document, whose tables are siblings of the top-level
+    /// pairs rather than their children.
+    fn visit_toml_document(&mut self, root: &Node) {
+        let mut cursor = root.walk();
+        for child in root.named_children(&mut cursor) {
+            match child.kind() {
+                "table" | "table_array_element" => {
+                    let mut header = Vec::new();
+                    let mut inner = child.walk();
+                    let mut entries = child.named_children(&mut inner);
+                    if let Some(key) = entries.next() {
+                        self.push_toml_key(&key, &mut header);
+                    }
+                    self.record(&header);
+                    if child.kind() == "table_array_element" {
+                        let count = self.table_arrays.entry(header.clone()).or_default();
+                        header.push(Segment::Index(*count));
+                        *count += 1;
+                    }
+                    for entry in entries {
+                        self.visit_toml(&entry, &mut header);
+                    }
+                }
+                _ => self.visit_toml(&child, &mut Vec::new()),
+            }
+        }
+    }
+
+    fn visit_toml(&mut self, node: &Node, path: &mut Vec<Segment>) {
+        match node.kind() {
+            "pair" => {
+                let depth = path.len();
+                let mut cursor = node.walk();
+                let mut parts = node.named_children(&mut cursor);
+                if let Some(key) = parts.next() {
+                    self.push_toml_key(&key, path);
+                }
+                self.record(path);
+                if let Some(value) = parts.find(|part| part.kind() != "comment") {
+                    self.visit_toml(&value, path);
+                }
+                path.truncate(depth);
+            }
+            "array" => {
+                let mut cursor = node.walk();
+                self.visit_items(node.named_children(&mut cursor), path, Self::visit_toml);
+            }
+            _ => {
+                let mut cursor = node.walk();
+                for child in node.named_children(&mut cursor) {
+                    self.visit_toml(&child, path);
+                }
+            }
+        }
+    }
+
+    /// Appends the segments of a bare, quoted, or dotted TOML key.
+    fn push_toml_key(&self, key: &Node, path: &mut Vec<Segment>) {
+        match key.kind() {
+            "dotted_key" => {
+                let mut cursor = key.walk();
+                for part in key.named_children(&mut cursor) {
+                    self.push_toml_key(&part, path);
+                }
+            }
+            "quoted_key" => {
+                let text = self.text(key);
+                path.push(Segment::Key(text.trim_matches(['"', '\'']).to_string()));
+            }
+            _ => path.push(Segment::Key(self.text(key))),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::create_parser;
+
+    fn measure(language: SupportedLanguage, source: &str) -> ConfigStats {
+        let tree = create_parser(&language)
+            .unwrap()
+            .parse(source, None)
+            .unwrap();
+        config_stats(&tree.root_node(), source.as_bytes(), &language)
+    }
+
+    #[test]
+    fn test_config_stats_json() {
+        let source = r#"{
+  "name": "app",
+  "scripts": { "build": "tsc", "test": "jest" },
+  "files": [{ "path": "dist" }, { "path": "README.md" }]
+}"#;
+        let stats = measure(SupportedLanguage::Json, source);
+        // name, scripts, build, test, files, and one path per item
+        assert_eq!(stats.keys, 7);
+        assert_eq!(stats.max_depth, 2);
+        assert_eq!(stats.documents, 1);
+    }
+
+    #[test]
+    fn test_config_stats_yaml_documents() {
+        let source = "\
+apiVersion: v1
+kind: Service
+spec:
+  ports:
+    - port: 80
+      targetPort: 8080
+---
+apiVersion: v1
+kind: ConfigMap
+";
+        let stats = measure(SupportedLanguage::Yaml, source);
+        assert_eq!(stats.keys, 8);
+        assert_eq!(stats.max_depth, 3);
+        assert_eq!(stats.documents, 2);
+    }
+
+    #[test]
+    fn test_config_stats_toml_tables_share_prefixes() {
+        let source = r#"
+title = "example"
+server.port = 8080
+
+[server.tls]
+cert = "cert.pem"
+
+[[bin]]
+name = "a"
+
+[[bin]]
+name = "b"
+"#;
+        let stats = measure(SupportedLanguage::Toml, source);
+        // title, server, server.port, server.tls, cert, bin, and two names
+        assert_eq!(stats.keys, 8);
+        assert_eq!(stats.max_depth, 3);
+    }
+
+    #[test]
+    fn test_merge_keeps_deepest() {
+        let mut total = ConfigStats {
+            keys: 4,
+            max_depth: 3,
+            documents: 1,
+        };
+        total.merge(&ConfigStats {
+            keys: 2,
+            max_depth: 1,
+            documents: 2,
+        });
+        assert_eq!(
+            total,
+            ConfigStats {
+                keys: 6,
+                max_depth: 3,
+                documents: 3,
+            }
+        );
+    }
+}
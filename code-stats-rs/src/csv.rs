@@ -0,0 +1,399 @@
+//! CSV output for `--format csv`, for spreadsheets and BI tools.
+//!
+//! The output has a header row and one row per file, or per function with
+//! `--level function`. Fields are quoted as described in RFC 4180 only when
+//! they contain a comma, a quote, or a line break, and rows end in `\n`.
+//! Numbers are written without thousands separators and decimals with a
+//! `.`, so they import as numbers in any locale that expects that. The
+//! `history` subcommand has its own columns, one row per date and language,
+//! and so has the `workspace` subcommand, one row per repository.
+
+use crate::cli::Level;
+use crate::history::HistoryPoint;
+use crate::stats::{DirectoryStats, FileStats};
+use crate::workspace::{RepositoryTotals, WorkspaceReport};
+use std::fmt::Display;
+
+/// Columns of the per-file rows.
+const FILE_COLUMNS: [&str; 18] = [
+    "path",
+    "language",
+    "origin",
+    "test",
+    "functions",
+    "classes",
+    "code_lines",
+    "comment_lines",
+    "blank_lines",
+    "max_complexity",
+    "max_nesting",
+    "max_cognitive",
+    "min_maintainability",
+    "doc_coverage",
+    "syntax_tokens",
+    "llm_tokens",
+    "error_nodes",
+    "missing_nodes",
+];
+
+/// Columns of the per-function rows.
+const FUNCTION_COLUMNS: [&str; 14] = [
+    "path",
+    "language",
+    "name",
+    "qualified_name",
+    "start_line",
+    "end_line",
+    "lines",
+    "parameters",
+    "complexity",
+    "nesting",
+    "cognitive",
+    "volume",
+    "effort",
+    "maintainability",
+];
+
+/// Columns of the `history` rows.
+const HISTORY_COLUMNS: [&str; 8] = [
+    "date",
+    "commit",
+    "language",
+    "files",
+    "code_lines",
+    "functions",
+    "max_complexity",
+    "mean_complexity",
+];
+
+/// Columns of the `workspace` rows.
+const WORKSPACE_COLUMNS: [&str; 8] = [
+    "repository",
+    "path",
+    "files",
+    "code_lines",
+    "comment_lines",
+    "functions",
+    "max_complexity",
+    "mean_complexity",
+];
+
+/// Formats directory statistics as CSV.
+///
+/// Every analyzed file is a row at the file level, including configuration,
+/// generated, and test files, which `origin` and `test` tell apart. The
+/// function level lists the functions of code files, including those of
+/// Markdown code blocks under the language of the block.
+///
+/// # Arguments
+///
+/// * `stats` - Directory statistics to list
+/// * `level` - Whether a row is a file or a function
+///
+/// # Returns
+///
+/// The CSV document, ending in a line break
+pub(crate) fn format_csv(stats: &DirectoryStats, level: Level) -> String {
+    let mut files: Vec<&FileStats> = match level {
+        Level::File => stats.files.iter().collect(),
+        Level::Function => stats.code_file_stats().collect(),
+    };
+    files.sort_by(|a, b| a.path.cmp(&b.path));
+
+    let mut output = String::new();
+    match level {
+        Level::File => {
+            push_row(&mut output, &FILE_COLUMNS);
+            for file in files {
+                push_row(&mut output, &file_row(file));
+            }
+        }
+        Level::Function => {
+            push_row(&mut output, &FUNCTION_COLUMNS);
+            for file in files {
+                let embedded = file.stats.embedded.iter().flat_map(|(language, code)| {
+                    code.stats.functions.iter().map(move |f| (*language, f))
+                });
+                let functions = file
+                    .stats
+                    .functions
+                    .iter()
+                    .map(|f| (file.language, f))
+                    .chain(embedded);
+                for (language, function) in functions {
+                    push_row(
+                        &mut output,
+                        &[
+                            file.path.display().to_string(),
+                            language.name().to_string(),
+                            function.name.clone(),
+                            function.qualified_name.clone(),
+                            function.start_line.to_string(),
+                            function.end_line.to_string(),
+                            function.line_count().to_string(),
+                            function.parameters.to_string(),
+                            function.complexity.to_string(),
+                            function.max_nesting.to_string(),
+                            function.cognitive.to_string(),
+                            decimal(function.halstead.volume),
+                            decimal(function.halstead.effort),
+                            decimal(function.maintainability),
+                        ],
+                    );
+                }
+            }
+        }
+    }
+    output
+}
+
+/// Formats the `history` series as CSV, with a row per date for all
+/// languages (`language` is empty) followed by a row per language.
+///
+/// # Arguments
+///
+/// * `points` - The metrics of each date, oldest first
+///
+/// # Returns
+///
+/// The CSV document, ending in a line break
+pub(crate) fn format_history_csv(points: &[HistoryPoint]) -> String {
+    let mut output = String::new();
+    push_row(&mut output, &HISTORY_COLUMNS);
+    for point in points {
+        let languages = point
+            .languages
+            .iter()
+            .map(|(language, totals)| (language.as_str(), totals));
+        for (language, totals) in std::iter::once(("", &point.total)).chain(languages) {
+            push_row(
+                &mut output,
+                &[
+                    point.date.clone(),
+                    point.commit.clone(),
+                    language.to_string(),
+                    totals.files.to_string(),
+                    totals.code_lines.to_string(),
+                    totals.functions.to_string(),
+                    totals.max_complexity.to_string(),
+                    decimal(totals.mean_complexity),
+                ],
+            );
+        }
+    }
+    output
+}
+
+/// Formats the `workspace` comparison as CSV, with a row for all
+/// repositories (`repository` and `path` are empty) followed by a row per
+/// repository.
+pub(crate) fn format_workspace_csv(report: &WorkspaceReport) -> String {
+    let mut output = String::new();
+    push_row(&mut output, &WORKSPACE_COLUMNS);
+    let rows = report.repositories.iter().map(|row| {
+        (
+            row.name.clone(),
+            row.path.display().to_string(),
+            &row.totals,
+        )
+    });
+    for (name, path, totals) in
+        std::iter::once((String::new(), String::new(), &report.total)).chain(rows)
+    {
+        let RepositoryTotals {
+            files,
+            code_lines,
+            comment_lines,
+            functions,
+            max_complexity,
+            mean_complexity,
+            ..
+        } = totals;
+        push_row(
+            &mut output,
+            &[
+                name,
+                path,
+                files.to_string(),
+                code_lines.to_string(),
+                comment_lines.to_string(),
+                functions.to_string(),
+                max_complexity.to_string(),
+                decimal(*mean_complexity),
+            ],
+        );
+    }
+    output
+}
+
+/// Returns the fields of a file's row, see `FILE_COLUMNS`.
+fn file_row(file: &FileStats) -> Vec<String> {
+    let stats = &file.stats;
+    let lines = &stats.lines;
+    vec![
+        file.path.display().to_string(),
+        file.language.name().to_string(),
+        stats
+            .origin
+            .map(|origin| origin.to_string())
+            .unwrap_or_default(),
+        stats.test_file.to_string(),
+        stats.function_count.to_string(),
+        stats.class_struct_count.to_string(),
+        lines.code.to_string(),
+        lines.comment.to_string(),
+        lines.blank.to_string(),
+        stats.max_complexity().to_string(),
+        stats.max_nesting().to_string(),
+        stats.max_cognitive().to_string(),
+        stats.min_maintainability().map(decimal).unwrap_or_default(),
+        stats
+            .docs
+            .ratio()
+            .map(|ratio| decimal(ratio * 100.0))
+            .unwrap_or_default(),
+        stats.tokens.syntax.to_string(),
+        stats.tokens.llm.to_string(),
+        stats.error_nodes.to_string(),
+        stats.missing_nodes.to_string(),
+    ]
+}
+
+/// Formats a decimal with two places.
+fn decimal(value: f64) -> String {
+    format!("{value:.2}")
+}
+
+/// Appends a row of fields, quoting those that need it.
+fn push_row(output: &mut String, fields: &[impl Display]) {
+    let row: Vec<String> = fields
+        .iter()
+        .map(|field| escape(&field.to_string()))
+        .collect();
+    output.push_str(&row.join(","));
+    output.push('\n');
+}
+
+/// Quotes a field containing a comma, a quote, or a line break, doubling its
+/// quotes.
+fn escape(field: &str) -> String {
+    if field.contains([',', '"', '\n', '\r']) {
+        format!("\"{}\"", field.replace('"', "\"\""))
+    } else {
+        field.to_string()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::language::SupportedLanguage;
+    use crate::parser::FunctionStats;
+    use crate::stats::test_support::{directory, file, file_with, function};
+    use std::path::PathBuf;
+
+    fn stats() -> DirectoryStats {
+        directory([
+            file_with(
+                "src/b.rs",
+                0,
+                vec![FunctionStats {
+                    qualified_name: "Cart::total".to_string(),
+                    start_line: 3,
+                    end_line: 9,
+                    maintainability: 101.5,
+                    ..function("total", 2)
+                }],
+            ),
+            FileStats {
+                language: SupportedLanguage::Json,
+                ..file("config, old.json", 0, &[])
+            },
+        ])
+    }
+
+    #[test]
+    fn test_escape() {
+        assert_eq!(escape("plain"), "plain");
+        assert_eq!(escape("a,b"), "\"a,b\"");
+        assert_eq!(escape("say \"hi\""), "\"say \"\"hi\"\"\"");
+        assert_eq!(escape("two\nlines"), "\"two\nlines\"");
+    }
+
+    #[test]
+    fn test_format_csv_file_level() {
+        let csv = format_csv(&stats(), Level::File);
+        let rows: Vec<&str> = csv.lines().collect();
+        assert_eq!(rows.len(), 3);
+        assert!(rows[0].starts_with("path,language,origin,test,functions,"));
+        assert_eq!(rows[0].split(',').count(), FILE_COLUMNS.len());
+        assert!(rows[1].starts_with("\"config, old.json\",Json,,false,0,"));
+        assert!(rows[2].starts_with("src/b.rs,Rust,,false,1,0,0,0,0,2,0,0,101.50,"));
+    }
+
+    #[test]
+    fn test_format_csv_function_level() {
+        let csv = format_csv(&stats(), Level::Function);
+        assert_eq!(
+            csv,
+            "path,language,name,qualified_name,start_line,end_line,lines,parameters,\
+             complexity,nesting,cognitive,volume,effort,maintainability\n\
+             src/b.rs,Rust,total,Cart::total,3,9,7,0,2,0,0,0.00,0.00,101.50\n"
+        );
+    }
+
+    #[test]
+    fn test_format_history_csv() {
+        use crate::history::HistoryTotals;
+
+        let totals = HistoryTotals {
+            files: 2,
+            code_lines: 120,
+            functions: 4,
+            max_complexity: 6,
+            mean_complexity: 2.5,
+        };
+        let point = HistoryPoint {
+            date: "2023-01-01".to_string(),
+            commit: "1a2b3c".to_string(),
+            total: totals.clone(),
+            languages: [("Rust".to_string(), totals)].into(),
+        };
+        assert_eq!(
+            format_history_csv(&[point]),
+            "date,commit,language,files,code_lines,functions,max_complexity,mean_complexity\n\
+             2023-01-01,1a2b3c,,2,120,4,6,2.50\n\
+             2023-01-01,1a2b3c,Rust,2,120,4,6,2.50\n"
+        );
+    }
+
+    #[test]
+    fn test_format_workspace_csv() {
+        use crate::workspace::RepositoryRow;
+
+        let totals = |code_lines| RepositoryTotals {
+            files: 3,
+            code_lines,
+            comment_lines: 10,
+            functions: 4,
+            max_complexity: 6,
+            mean_complexity: 2.5,
+            ..RepositoryTotals::default()
+        };
+        let report = WorkspaceReport {
+            repositories: vec![RepositoryRow {
+                name: "billing".to_string(),
+                path: PathBuf::from("../billing, old"),
+                totals: totals(120),
+            }],
+            total: totals(120),
+        };
+        assert_eq!(
+            format_workspace_csv(&report),
+            "repository,path,files,code_lines,comment_lines,functions,max_complexity,\
+             mean_complexity\n\
+             ,,3,120,10,4,6,2.50\n\
+             billing,\"../billing, old\",3,120,10,4,6,2.50\n"
+        );
+    }
+}
@@ -0,0 +1,449 @@
+//! Content sniffing for language detection: shebangs, editor modelines,
+//! and heuristics for files whose extension is missing or ambiguous.
+//!
+//! Also holds the `--lang-map` overrides, which take precedence over every
+//! other detection method.
+
+use crate::encoding::decode_lossy;
+use crate::error::{CodeStatsError, Result};
+use crate::language::SupportedLanguage;
+use std::collections::HashMap;
+use std::fs::File;
+use std::io::Read;
+use std::path::Path;
+
+/// Number of bytes read from the start of a file for sniffing.
+const HEAD_BYTES: u64 = 16 * 1024;
+
+/// Number of leading lines searched for an editor modeline.
+const MODELINE_LINES: usize = 5;
+
+/// Reads the start of a file for sniffing, transcoding it like the whole
+/// file will be and replacing what can't be decoded.
+///
+/// Returns `None` if the file can't be read; detection then falls back to
+/// the file name alone.
+pub(crate) fn read_head(path: &Path) -> Option<String> {
+    let mut head = Vec::new();
+    File::open(path)
+        .ok()?
+        .take(HEAD_BYTES)
+        .read_to_end(&mut head)
+        .ok()?;
+    Some(decode_lossy(&head))
+}
+
+/// Returns the language named by a Vim or Emacs modeline in the first lines
+/// of a file, if it is a supported one.
+pub(crate) fn modeline_language(head: &str) -> Option<SupportedLanguage> {
+    head.lines()
+        .take(MODELINE_LINES)
+        .find_map(|line| vim_filetype(line).or_else(|| emacs_mode(line)))
+        .and_then(language_from_alias)
+}
+
+/// Returns the language for an interpreter named in a `#!` line.
+///
+/// `#!/usr/bin/env` is followed past its options and variable assignments,
+/// and version suffixes are ignored (`python3.12` is `python`).
+pub(crate) fn shebang_language(head: &str) -> Option<SupportedLanguage> {
+    let line = head.lines().next()?.strip_prefix("#!")?;
+    // `#![attr]` opens a Rust file, it is not a shebang
+    if line.starts_with('[') {
+        return None;
+    }
+
+    let mut words = line.split_whitespace();
+    let mut interpreter = program_name(words.next()?);
+    if interpreter == "env" {
+        interpreter = words
+            .find(|word| !word.starts_with('-') && !word.contains('='))
+            .map(program_name)?;
+    }
+
+    let name = interpreter.trim_end_matches(|c: char| c.is_ascii_digit() || c == '.');
+    match name {
+        "python" | "pypy" => Some(SupportedLanguage::Python),
+        "node" | "nodejs" | "bun" => Some(SupportedLanguage::JavaScript),
+        "deno" | "ts-node" | "tsx" => Some(SupportedLanguage::TypeScript),
+        "rust-script" | "cargo" => Some(SupportedLanguage::Rust),
+        "gorun" => Some(SupportedLanguage::Go),
+        "java" => Some(SupportedLanguage::Java),
+        "tcc" => Some(SupportedLanguage::C),
+        "ruby" | "jruby" | "truffleruby" => Some(SupportedLanguage::Ruby),
+        "kotlin" | "kotlinc" => Some(SupportedLanguage::Kotlin),
+        "dotnet-script" => Some(SupportedLanguage::CSharp),
+        "swift" => Some(SupportedLanguage::Swift),
+        "php" | "php-cgi" => Some(SupportedLanguage::Php),
+        "scala" | "scala-cli" | "amm" => Some(SupportedLanguage::Scala),
+        "groovy" => Some(SupportedLanguage::Groovy),
+        "elixir" | "iex" => Some(SupportedLanguage::Elixir),
+        "escript" => Some(SupportedLanguage::Erlang),
+        "runghc" | "runhaskell" | "stack" => Some(SupportedLanguage::Haskell),
+        "ocaml" => Some(SupportedLanguage::OCaml),
+        // `#!/usr/bin/env -S zig run` and `nim r` compile and run the script
+        "zig" => Some(SupportedLanguage::Zig),
+        "nim" => Some(SupportedLanguage::Nim),
+        "lua" | "luajit" | "resty" => Some(SupportedLanguage::Lua),
+        "sh" | "bash" | "zsh" | "dash" | "ksh" => Some(SupportedLanguage::Bash),
+        // `#!/usr/bin/make -f` makes a Makefile executable
+        "make" | "gmake" => Some(SupportedLanguage::Make),
+        _ => None,
+    }
+}
+
+/// Returns the last component of a program path.
+fn program_name(path: &str) -> &str {
+    path.rsplit('/').next().unwrap_or(path)
+}
+
+/// Extracts the file type from a Vim modeline such as `# vim: set ft=python:`.
+fn vim_filetype(line: &str) -> Option<&str> {
+    let start = ["vim:", "vi:", "ex:"].iter().find_map(|marker| {
+        line.match_indices(marker)
+            .find(|(index, _)| {
+                line[..*index]
+                    .chars()
+                    .next_back()
+                    .is_none_or(char::is_whitespace)
+            })
+            .map(|(index, _)| index + marker.len())
+    })?;
+
+    let options = line[start..].trim_start();
+    let options = options
+        .strip_prefix("set ")
+        .or_else(|| options.strip_prefix("se "))
+        .unwrap_or(options);
+    options
+        .split(|c: char| c == ':' || c.is_whitespace())
+        .find_map(|option| {
+            let (key, value) = option.split_once('=')?;
+            matches!(key, "ft" | "filetype" | "syn" | "syntax").then_some(value)
+        })
+}
+
+/// Extracts the major mode from an Emacs modeline such as
+/// `-*- mode: python -*-` or `-*- python -*-`.
+fn emacs_mode(line: &str) -> Option<&str> {
+    let (_, rest) = line.split_once("-*-")?;
+    let (variables, _) = rest.split_once("-*-")?;
+
+    if !variables.contains(':') {
+        return Some(variables.trim());
+    }
+    variables.split(';').find_map(|variable| {
+        let (key, value) = variable.split_once(':')?;
+        key.trim()
+            .eq_ignore_ascii_case("mode")
+            .then_some(value.trim())
+    })
+}
+
+/// Maps a modeline file type, mode name, or code fence label to a supported
+/// language.
+pub(crate) fn language_from_alias(name: &str) -> Option<SupportedLanguage> {
+    let name = name.to_ascii_lowercase();
+    let name = name.strip_suffix("-mode").unwrap_or(&name);
+    SupportedLanguage::from_name(name).or(match name {
+        "rs" => Some(SupportedLanguage::Rust),
+        "golang" => Some(SupportedLanguage::Go),
+        "py" | "python3" => Some(SupportedLanguage::Python),
+        "js" | "js2" | "jsx" | "javascriptreact" => Some(SupportedLanguage::JavaScript),
+        "ts" | "tsx" | "typescriptreact" => Some(SupportedLanguage::TypeScript),
+        "cc" | "cxx" => Some(SupportedLanguage::Cpp),
+        "rb" => Some(SupportedLanguage::Ruby),
+        "kt" | "kts" => Some(SupportedLanguage::Kotlin),
+        "phtml" => Some(SupportedLanguage::Php),
+        "sc" => Some(SupportedLanguage::Scala),
+        "gvy" => Some(SupportedLanguage::Groovy),
+        "exs" => Some(SupportedLanguage::Elixir),
+        // Emacs' OCaml mode
+        "tuareg" => Some(SupportedLanguage::OCaml),
+        "pgsql" | "mysql" | "plsql" => Some(SupportedLanguage::Sql),
+        _ => None,
+    })
+}
+
+/// Returns true if C-family source uses constructs that only exist in C++.
+///
+/// Used to route `.h` headers, which both languages share. Comment lines are
+/// skipped, and `extern "C"` blocks (common in C headers meant to be
+/// included from C++) don't count.
+pub(crate) fn looks_like_cpp(source: &str) -> bool {
+    source.lines().map(str::trim).any(|line| {
+        if line.starts_with("//") || line.starts_with("/*") || line.starts_with('*') {
+            return false;
+        }
+        // Standard C++ headers have no extension: `#include <vector>`
+        if let Some(header) = line
+            .strip_prefix("#include")
+            .map(str::trim_start)
+            .and_then(|rest| rest.strip_prefix('<'))
+            .and_then(|rest| rest.split_once('>'))
+            .map(|(header, _)| header)
+        {
+            return !header.contains('.');
+        }
+
+        ["class ", "namespace ", "template<", "template <"]
+            .iter()
+            .any(|prefix| line.starts_with(prefix))
+            || matches!(line, "public:" | "private:" | "protected:")
+            || line.contains("std::")
+    })
+}
+
+/// Guesses the language of a file without an extension from its content.
+///
+/// Only used when neither a modeline, a shebang, Magika, nor the file name
+/// identify the file, so the checks are deliberately conservative: each looks for a
+/// line that starts the way files of that language do.
+pub(crate) fn content_language(head: &str) -> Option<SupportedLanguage> {
+    let starts = |prefix: &str| head.lines().any(|line| line.starts_with(prefix));
+
+    if starts("package ") && starts("func ") {
+        Some(SupportedLanguage::Go)
+    } else if starts("import java.") || starts("public class ") || starts("public final class ") {
+        Some(SupportedLanguage::Java)
+    } else if starts("#include ") {
+        Some(if looks_like_cpp(head) {
+            SupportedLanguage::Cpp
+        } else {
+            SupportedLanguage::C
+        })
+    } else {
+        None
+    }
+}
+
+/// User-supplied language overrides, keyed by file extension or file name.
+///
+/// Built from `EXT=LANGUAGE` entries such as `h=cpp` or `Jenkinsfile=java`.
+/// A key matches a file whose extension or whole name equals it, compared
+/// case-insensitively; file names win over extensions.
+#[derive(Debug, Clone, Default)]
+pub struct LanguageMap {
+    overrides: HashMap<String, SupportedLanguage>,
+}
+
+impl LanguageMap {
+    /// Parses `--lang-map` entries.
+    ///
+    /// # Arguments
+    ///
+    /// * `entries` - `KEY=LANGUAGE` pairs; a leading `.` or `*.` on the key is ignored
+    ///
+    /// # Returns
+    ///
+    /// The override map, or `ConfigError` for an entry without `=` or with an
+    /// unknown language name.
+    pub fn parse<S: AsRef<str>>(entries: &[S]) -> Result<Self> {
+        let mut overrides = HashMap::new();
+        for entry in entries {
+            let entry = entry.as_ref();
+            let (key, name) = entry.split_once('=').ok_or_else(|| {
+                CodeStatsError::ConfigError(format!(
+                    "invalid --lang-map entry '{entry}', expected EXT=LANGUAGE"
+                ))
+            })?;
+            let key = key.trim().trim_start_matches('*').trim_start_matches('.');
+            if key.is_empty() {
+                return Err(CodeStatsError::ConfigError(format!(
+                    "invalid --lang-map entry '{entry}', expected EXT=LANGUAGE"
+                )));
+            }
+            let language = SupportedLanguage::from_name(name.trim()).ok_or_else(|| {
+                CodeStatsError::ConfigError(format!(
+                    "unknown language '{}' in --lang-map entry '{entry}'",
+                    name.trim()
+                ))
+            })?;
+            overrides.insert(key.to_lowercase(), language);
+        }
+        Ok(Self { overrides })
+    }
+
+    /// Returns true if no overrides are configured.
+    pub fn is_empty(&self) -> bool {
+        self.overrides.is_empty()
+    }
+
+    /// Returns the language configured for a path, if any.
+    pub fn language_for(&self, file_path: &str) -> Option<SupportedLanguage> {
+        if self.overrides.is_empty() {
+            return None;
+        }
+        let path = Path::new(file_path);
+        let lookup = |part: Option<&std::ffi::OsStr>| {
+            let key = part?.to_str()?.to_lowercase();
+            self.overrides.get(&key).copied()
+        };
+        lookup(path.file_name()).or_else(|| lookup(path.extension()))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_shebang_language() {
+        let cases = [
+            (
+                "#!/usr/bin/env python3\nprint(1)",
+                Some(SupportedLanguage::Python),
+            ),
+            (
+                "#!/usr/bin/python3.12 -u\n",
+                Some(SupportedLanguage::Python),
+            ),
+            (
+                "#!/usr/bin/env -S node --no-warnings\n",
+                Some(SupportedLanguage::JavaScript),
+            ),
+            (
+                "#!/usr/bin/env NODE_ENV=test deno run\n",
+                Some(SupportedLanguage::TypeScript),
+            ),
+            (
+                "#!/usr/bin/env -S cargo +nightly -Zscript\n",
+                Some(SupportedLanguage::Rust),
+            ),
+            (
+                "#!/usr/bin/env ruby -w\nputs 1",
+                Some(SupportedLanguage::Ruby),
+            ),
+            (
+                "#!/usr/bin/env -S scala-cli shebang\n",
+                Some(SupportedLanguage::Scala),
+            ),
+            ("#!/usr/bin/env groovy\n", Some(SupportedLanguage::Groovy)),
+            ("#!/usr/bin/env elixir\n", Some(SupportedLanguage::Elixir)),
+            ("#!/usr/bin/env escript\n", Some(SupportedLanguage::Erlang)),
+            ("#!/usr/bin/env runghc\n", Some(SupportedLanguage::Haskell)),
+            ("#!/usr/bin/env ocaml\n", Some(SupportedLanguage::OCaml)),
+            ("#!/usr/bin/env -S zig run\n", Some(SupportedLanguage::Zig)),
+            (
+                "#!/usr/bin/env -S nim r --hints:off\n",
+                Some(SupportedLanguage::Nim),
+            ),
+            ("#!/usr/bin/env luajit\n", Some(SupportedLanguage::Lua)),
+            ("#!/usr/bin/env resty\n", Some(SupportedLanguage::Lua)),
+            ("#!/bin/sh\n", Some(SupportedLanguage::Bash)),
+            ("#!/usr/bin/env bash\nset -e", Some(SupportedLanguage::Bash)),
+            ("#!/usr/bin/make -f\nall:", Some(SupportedLanguage::Make)),
+            ("#![allow(dead_code)]\nfn main() {}", None),
+            ("print(1)\n#!/usr/bin/env python3", None),
+        ];
+        for (head, expected) in cases {
+            assert_eq!(shebang_language(head), expected, "{head:?}");
+        }
+    }
+
+    #[test]
+    fn test_modelines() {
+        assert_eq!(vim_filetype("# vim: set ft=python :"), Some("python"));
+        assert_eq!(vim_filetype("// vim:ts=4:filetype=cpp"), Some("cpp"));
+        assert_eq!(vim_filetype("/* vi: syntax=c */"), Some("c"));
+        assert_eq!(vim_filetype("let nvim:ft=go"), None);
+        assert_eq!(vim_filetype("# vim: ts=4"), None);
+
+        assert_eq!(
+            emacs_mode("// -*- mode: C++; tab-width: 4 -*-"),
+            Some("C++")
+        );
+        assert_eq!(emacs_mode("# -*- python -*-"), Some("python"));
+        assert_eq!(emacs_mode("# -*- coding: utf-8 -*-"), None);
+    }
+
+    #[test]
+    fn test_modeline_language() {
+        let head = "#!/bin/sh\n# vim: ft=python\n";
+        assert_eq!(modeline_language(head), Some(SupportedLanguage::Python));
+
+        let head = "/* -*- mode: c++ -*- */\nstruct S;";
+        assert_eq!(modeline_language(head), Some(SupportedLanguage::Cpp));
+
+        let head = "-- vim: ft=pgsql\nCREATE TABLE t (id int);\n";
+        assert_eq!(modeline_language(head), Some(SupportedLanguage::Sql));
+
+        let head = "(* -*- mode: tuareg -*- *)\nlet x = 1\n";
+        assert_eq!(modeline_language(head), Some(SupportedLanguage::OCaml));
+
+        // Modelines past the first lines are not searched
+        let head = "a\nb\nc\nd\ne\n// vim: ft=go\n";
+        assert_eq!(modeline_language(head), None);
+        assert_eq!(modeline_language("// vim: ft=cobol"), None);
+        assert_eq!(modeline_language("#!/usr/bin/env node\n"), None);
+    }
+
+    #[test]
+    fn test_looks_like_cpp() {
+        let c_header = r#"
+/* A small C header. This class of helpers is not C++. */
+#include <stdio.h>
+#ifdef __cplusplus
+extern "C" {
+#endif
+struct point { int x; };
+#ifdef __cplusplus
+}
+#endif
+"#;
+        assert!(!looks_like_cpp(c_header));
+
+        assert!(looks_like_cpp("#include <vector>\n"));
+        assert!(looks_like_cpp("namespace geo {\n}\n"));
+        assert!(looks_like_cpp("struct S {\npublic:\n  int x;\n};\n"));
+        assert!(looks_like_cpp("template <typename T>\nT max(T a, T b);\n"));
+        assert!(looks_like_cpp("void f(std::string s);\n"));
+    }
+
+    #[test]
+    fn test_content_language() {
+        assert_eq!(
+            content_language("package main\n\nfunc main() {}\n"),
+            Some(SupportedLanguage::Go)
+        );
+        assert_eq!(
+            content_language("import java.util.List;\n"),
+            Some(SupportedLanguage::Java)
+        );
+        assert_eq!(
+            content_language("#include <stdlib.h>\nint main(void) { return 0; }\n"),
+            Some(SupportedLanguage::C)
+        );
+        assert_eq!(
+            content_language("#include <iostream>\nint main() {}\n"),
+            Some(SupportedLanguage::Cpp)
+        );
+        assert_eq!(content_language("Just some notes about a package\n"), None);
+    }
+
+    #[test]
+    fn test_language_map() {
+        let map = LanguageMap::parse(&["h=cpp", "*.INC=c", "Jenkinsfile=java"]).unwrap();
+        assert!(!map.is_empty());
+        assert_eq!(
+            map.language_for("include/util.h"),
+            Some(SupportedLanguage::Cpp)
+        );
+        assert_eq!(
+            map.language_for("legacy/defs.inc"),
+            Some(SupportedLanguage::C)
+        );
+        assert_eq!(
+            map.language_for("ci/Jenkinsfile"),
+            Some(SupportedLanguage::Java)
+        );
+        assert_eq!(map.language_for("src/main.rs"), None);
+        assert!(LanguageMap::default().language_for("x.h").is_none());
+
+        let err = LanguageMap::parse(&["h"]).unwrap_err();
+        assert!(err.to_string().contains("expected EXT=LANGUAGE"));
+        let err = LanguageMap::parse(&["h=cobol"]).unwrap_err();
+        assert!(err.to_string().contains("unknown language 'cobol'"));
+        assert!(LanguageMap::parse(&["=rust"]).is_err());
+    }
+}
@@ -0,0 +1,574 @@
+//! Git diff mode: statistics for the files and functions changed since a ref.
+//!
+//! The working tree, including uncommitted changes, is compared against a base
+//! revision. Only files touched by the diff are analyzed, once as they are now
+//! and once as they were at the base; functions overlapping the changed lines
+//! are reported with their size and complexity before and after. Untracked
+//! files are not part of `git diff` and are therefore not reported.
+
+use crate::analyzer::{CodeAnalyzer, DirectoryOptions, PathFilter};
+use crate::error::{CodeStatsError, Result};
+use crate::language::SupportedLanguage;
+use crate::parser::FunctionStats;
+use serde::Serialize;
+use std::collections::HashMap;
+use std::ops::RangeInclusive;
+use std::path::{Path, PathBuf};
+use std::process::Command;
+
+/// A file touched by the diff, as reported by `git diff`.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub(crate) struct ChangedFile {
+    /// Path at the base revision relative to the repository root, `None` if added
+    pub old_path: Option<String>,
+    /// Path in the working tree relative to the repository root, `None` if deleted
+    pub new_path: Option<String>,
+    /// Changed line ranges of the working tree version (1-based, inclusive)
+    pub changed_lines: Vec<RangeInclusive<usize>>,
+}
+
+/// How a file changed between the base revision and the working tree.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub(crate) enum FileStatus {
+    Added,
+    Modified,
+    Renamed,
+    Deleted,
+}
+
+impl FileStatus {
+    /// Lowercase label used in text output, matching the JSON representation.
+    pub(crate) fn label(self) -> &'static str {
+        match self {
+            FileStatus::Added => "added",
+            FileStatus::Modified => "modified",
+            FileStatus::Renamed => "renamed",
+            FileStatus::Deleted => "deleted",
+        }
+    }
+}
+
+/// How a function changed between the base revision and the working tree.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub(crate) enum ChangeStatus {
+    Added,
+    Modified,
+    Removed,
+}
+
+/// Size and complexity of one version of a function.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+pub(crate) struct FunctionMetrics {
+    pub start_line: usize,
+    pub end_line: usize,
+    pub lines: usize,
+    pub complexity: usize,
+}
+
+impl From<&FunctionStats> for FunctionMetrics {
+    fn from(function: &FunctionStats) -> Self {
+        Self {
+            start_line: function.start_line,
+            end_line: function.end_line,
+            lines: function.line_count(),
+            complexity: function.complexity,
+        }
+    }
+}
+
+/// A function touched by the diff.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct FunctionChange {
+    /// Qualified function name
+    pub name: String,
+    pub status: ChangeStatus,
+    /// Metrics at the base revision, `None` for added functions
+    pub before: Option<FunctionMetrics>,
+    /// Metrics in the working tree, `None` for removed functions
+    pub after: Option<FunctionMetrics>,
+}
+
+/// Function-level changes of a single file.
+#[derive(Debug, Clone, Serialize)]
+pub(crate) struct FileDiff {
+    /// Path of the file, as for a directory analysis of the same root
+    pub path: PathBuf,
+    pub language: SupportedLanguage,
+    pub status: FileStatus,
+    /// Touched functions in source order, removed functions last
+    pub functions: Vec<FunctionChange>,
+}
+
+/// Result of a `--diff` run.
+#[derive(Debug, Clone, Serialize)]
+pub(crate) struct DiffReport {
+    /// The base ref as given on the command line
+    pub base: String,
+    /// Changed files in a supported language, sorted by path
+    pub files: Vec<FileDiff>,
+}
+
+/// Analyzes the files under `root` that changed since `base`.
+///
+/// Files rejected by the ignore patterns and globs of `options` are skipped,
+/// as are files in unsupported languages and files that fail to parse.
+///
+/// # Arguments
+///
+/// * `analyzer` - Analyzer used for both versions of each file
+/// * `root` - File or directory inside a git working tree
+/// * `base` - Any revision git understands (branch, tag, commit, `HEAD~3`)
+/// * `options` - Exclusion settings; traversal settings don't apply
+///
+/// # Returns
+///
+/// * `Ok(DiffReport)` - The changed files and functions
+/// * `Err(GitError)` - `root` is not in a repository, `base` doesn't exist,
+///   or git could not be run
+pub(crate) fn diff_report(
+    analyzer: &mut CodeAnalyzer,
+    root: &Path,
+    base: &str,
+    options: &DirectoryOptions,
+) -> Result<DiffReport> {
+    let (root_abs, toplevel) = repository_root(root)?;
+    git(
+        &toplevel,
+        &[
+            "rev-parse",
+            "--verify",
+            "--quiet",
+            &format!("{base}^{{commit}}"),
+        ],
+    )
+    .map_err(|_| CodeStatsError::GitError(format!("unknown revision '{base}'")))?;
+
+    let pathspec = root_abs.to_string_lossy();
+    let output = git(
+        &toplevel,
+        &[
+            "diff",
+            "-U0",
+            "-M",
+            "--no-color",
+            "--no-ext-diff",
+            base,
+            "--",
+            &pathspec,
+        ],
+    )?;
+
+    let filter = PathFilter::new(root, options)?;
+    let mut files = Vec::new();
+    for changed in parse_diff(&output) {
+        let Some(current_path) = changed.new_path.as_ref().or(changed.old_path.as_ref()) else {
+            continue;
+        };
+        let path = display_path(root, &root_abs, &toplevel.join(current_path));
+        if !filter.allows(&path) {
+            continue;
+        }
+
+        let after = match changed.new_path {
+            Some(_) => analyzer.analyze_candidate(&path).ok().flatten(),
+            None => None,
+        };
+        let Some(language) = after.as_ref().map(|file| file.language).or_else(|| {
+            changed
+                .old_path
+                .as_deref()
+                .and_then(|old_path| analyzer.language_from_name(old_path))
+        }) else {
+            continue;
+        };
+
+        let before = match &changed.old_path {
+            Some(old_path) => {
+                let source = git(&toplevel, &["show", &format!("{base}:{old_path}")])?;
+                analyzer.analyze_text(&path, language, &source).ok()
+            }
+            None => None,
+        };
+
+        let status = match (&changed.old_path, &changed.new_path) {
+            (None, _) => FileStatus::Added,
+            (_, None) => FileStatus::Deleted,
+            (Some(old), Some(new)) if old != new => FileStatus::Renamed,
+            _ => FileStatus::Modified,
+        };
+        let before = before.map(|file| file.stats.functions).unwrap_or_default();
+        let after = after.map(|file| file.stats.functions).unwrap_or_default();
+
+        files.push(FileDiff {
+            path,
+            language,
+            status,
+            functions: compare_functions(&before, &after, &changed.changed_lines),
+        });
+    }
+
+    files.sort_by(|a, b| a.path.cmp(&b.path));
+    Ok(DiffReport {
+        base: base.to_string(),
+        files,
+    })
+}
+
+/// Resolves `root` to an absolute path and finds the top level of the git
+/// repository containing it.
+///
+/// # Returns
+///
+/// * `Ok((root_abs, toplevel))` - The resolved root and the repository's top level
+/// * `Err(IoError)` - `root` does not exist
+/// * `Err(GitError)` - `root` is not inside a git repository
+pub(crate) fn repository_root(root: &Path) -> Result<(PathBuf, PathBuf)> {
+    let root_abs = root.canonicalize().map_err(|e| {
+        CodeStatsError::IoError(format!("Failed to resolve {}: {e}", root.display()))
+    })?;
+    let git_dir = if root_abs.is_dir() {
+        root_abs.as_path()
+    } else {
+        root_abs.parent().unwrap_or(Path::new("."))
+    };
+    let toplevel = PathBuf::from(git(git_dir, &["rev-parse", "--show-toplevel"])?.trim_end());
+    Ok((root_abs, toplevel))
+}
+
+/// Runs git in `dir` and returns its standard output.
+pub(crate) fn git(dir: &Path, args: &[&str]) -> Result<String> {
+    let output = Command::new("git")
+        .arg("-c")
+        .arg("core.quotePath=false")
+        .arg("-C")
+        .arg(dir)
+        .args(args)
+        .output()
+        .map_err(|e| CodeStatsError::GitError(format!("failed to run git: {e}")))?;
+
+    if !output.status.success() {
+        let stderr = String::from_utf8_lossy(&output.stderr);
+        return Err(CodeStatsError::GitError(stderr.trim().to_string()));
+    }
+    Ok(String::from_utf8_lossy(&output.stdout).into_owned())
+}
+
+/// Maps a file in the repository to the path a directory analysis of `root`
+/// would report for it.
+pub(crate) fn display_path(root: &Path, root_abs: &Path, file: &Path) -> PathBuf {
+    if file == root_abs {
+        return root.to_path_buf();
+    }
+    match file.strip_prefix(root_abs) {
+        Ok(relative) => root.join(relative),
+        Err(_) => file.to_path_buf(),
+    }
+}
+
+/// Parses the output of `git diff -U0` into the changed files and line ranges.
+///
+/// Renames are recognized from `rename from`/`rename to` as well as from
+/// differing `---`/`+++` paths. A pure deletion of lines is recorded as a
+/// change to the line preceding it.
+pub(crate) fn parse_diff(output: &str) -> Vec<ChangedFile> {
+    let mut files = Vec::new();
+    let mut current: Option<ChangedFile> = None;
+
+    for line in output.lines() {
+        if let Some(header) = line.strip_prefix("diff --git ") {
+            files.extend(current.take());
+            let (old, new) = split_header(header);
+            current = Some(ChangedFile {
+                old_path: old,
+                new_path: new,
+                changed_lines: Vec::new(),
+            });
+            continue;
+        }
+        let Some(file) = current.as_mut() else {
+            continue;
+        };
+
+        if line.starts_with("new file mode") {
+            file.old_path = None;
+        } else if line.starts_with("deleted file mode") {
+            file.new_path = None;
+        } else if let Some(path) = line.strip_prefix("rename from ") {
+            file.old_path = Some(unquote(path));
+        } else if let Some(path) = line.strip_prefix("rename to ") {
+            file.new_path = Some(unquote(path));
+        } else if let Some(path) = line.strip_prefix("--- ") {
+            file.old_path = diff_path(path, "a/");
+        } else if let Some(path) = line.strip_prefix("+++ ") {
+            file.new_path = diff_path(path, "b/");
+        } else if let Some(hunk) = line.strip_prefix("@@ ") {
+            file.changed_lines.extend(parse_hunk(hunk));
+        }
+    }
+
+    files.extend(current);
+    files
+}
+
+/// Splits `a/<old> b/<new>` from a `diff --git` header.
+///
+/// The header is ambiguous for paths containing ` b/`; the `---`/`+++` or
+/// `rename` lines that usually follow take precedence.
+fn split_header(header: &str) -> (Option<String>, Option<String>) {
+    let header = header.trim();
+    match header.find(" b/").or_else(|| header.find(" \"b/")) {
+        Some(split) => (
+            diff_path(&header[..split], "a/"),
+            diff_path(&header[split + 1..], "b/"),
+        ),
+        None => (None, None),
+    }
+}
+
+/// Parses a `---`/`+++` path, returning `None` for `/dev/null`.
+fn diff_path(path: &str, prefix: &str) -> Option<String> {
+    let path = unquote(path.trim_end_matches('\t'));
+    if path == "/dev/null" {
+        return None;
+    }
+    Some(path.strip_prefix(prefix).unwrap_or(&path).to_string())
+}
+
+/// Removes the quotes git puts around paths with unusual characters.
+fn unquote(path: &str) -> String {
+    path.strip_prefix('"')
+        .and_then(|p| p.strip_suffix('"'))
+        .map(|p| p.replace("\\\"", "\"").replace("\\\\", "\\"))
+        .unwrap_or_else(|| path.to_string())
+}
+
+/// Parses the new-side range of a hunk header such as `-10,2 +12,4 @@ fn x`.
+fn parse_hunk(hunk: &str) -> Option<RangeInclusive<usize>> {
+    let new_range = hunk
+        .split_whitespace()
+        .find_map(|part| part.strip_prefix('+'))?;
+    let (start, count) = match new_range.split_once(',') {
+        Some((start, count)) => (start.parse::<usize>().ok()?, count.parse::<usize>().ok()?),
+        None => (new_range.parse::<usize>().ok()?, 1),
+    };
+
+    if count == 0 {
+        let line = start.max(1);
+        Some(line..=line)
+    } else {
+        Some(start..=start + count - 1)
+    }
+}
+
+/// Pairs up the functions of both versions and reports those that changed.
+///
+/// Functions are matched by qualified name, and repeated names (such as
+/// anonymous closures) by their order. A function present in both versions
+/// is reported when it overlaps a changed line.
+fn compare_functions(
+    before: &[FunctionStats],
+    after: &[FunctionStats],
+    changed_lines: &[RangeInclusive<usize>],
+) -> Vec<FunctionChange> {
+    let mut unmatched: HashMap<&str, Vec<&FunctionStats>> = HashMap::new();
+    for function in before.iter().rev() {
+        unmatched
+            .entry(function.qualified_name.as_str())
+            .or_default()
+            .push(function);
+    }
+
+    let mut changes = Vec::new();
+    for function in after {
+        let previous = unmatched
+            .get_mut(function.qualified_name.as_str())
+            .and_then(Vec::pop);
+        let touched = changed_lines.iter().any(|range| {
+            *range.start() <= function.end_line && function.start_line <= *range.end()
+        });
+
+        match previous {
+            Some(previous) if touched => changes.push(FunctionChange {
+                name: function.qualified_name.clone(),
+                status: ChangeStatus::Modified,
+                before: Some(previous.into()),
+                after: Some(function.into()),
+            }),
+            Some(_) => {}
+            None => changes.push(FunctionChange {
+                name: function.qualified_name.clone(),
+                status: ChangeStatus::Added,
+                before: None,
+                after: Some(function.into()),
+            }),
+        }
+    }
+
+    let mut removed: Vec<&FunctionStats> = unmatched.into_values().flatten().collect();
+    // Functions starting on the same line would otherwise come in hash order
+    removed.sort_by(|a, b| {
+        (a.start_line, a.end_line, &a.qualified_name).cmp(&(
+            b.start_line,
+            b.end_line,
+            &b.qualified_name,
+        ))
+    });
+    changes.extend(removed.into_iter().map(|function| FunctionChange {
+        name: function.qualified_name.clone(),
+        status: ChangeStatus::Removed,
+        before: Some(function.into()),
+        after: None,
+    }));
+
+    changes
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    fn function(
+        name: &str,
+        start_line: usize,
+        end_line: usize,
+        complexity: usize,
+    ) -> FunctionStats {
+        FunctionStats {
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            start_line,
+            end_line,
+            complexity,
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn test_parse_diff() {
+        let output = "\
+diff --git a/src/lib.rs b/src/lib.rs
+index 1111111..2222222 100644
+--- a/src/lib.rs
++++ b/src/lib.rs
+@@ -3 +3,2 @@ fn parse() {
+-    old();
++    new();
++    more();
+@@ -20,2 +21,0 @@ fn other() {
+diff --git a/src/new.rs b/src/new.rs
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/src/new.rs
+@@ -0,0 +1,5 @@
++fn fresh() {}
+diff --git a/old.py b/old.py
+deleted file mode 100644
+--- a/old.py
++++ /dev/null
+@@ -1,4 +0,0 @@
+diff --git a/a.go b/b.go
+similarity index 100%
+rename from a.go
+rename to b.go
+";
+        let files = parse_diff(output);
+        assert_eq!(
+            files,
+            vec![
+                ChangedFile {
+                    old_path: Some("src/lib.rs".to_string()),
+                    new_path: Some("src/lib.rs".to_string()),
+                    changed_lines: vec![3..=4, 21..=21],
+                },
+                ChangedFile {
+                    old_path: None,
+                    new_path: Some("src/new.rs".to_string()),
+                    changed_lines: vec![1..=5],
+                },
+                ChangedFile {
+                    old_path: Some("old.py".to_string()),
+                    new_path: None,
+                    changed_lines: vec![1..=1],
+                },
+                ChangedFile {
+                    old_path: Some("a.go".to_string()),
+                    new_path: Some("b.go".to_string()),
+                    changed_lines: vec![],
+                },
+            ]
+        );
+    }
+
+    #[test]
+    fn test_parse_quoted_paths() {
+        let output = "\
+diff --git \"a/with \\\"quote\\\".rs\" \"b/with \\\"quote\\\".rs\"
+--- \"a/with \\\"quote\\\".rs\"
++++ \"b/with \\\"quote\\\".rs\"
+@@ -1 +1 @@
+";
+        let files = parse_diff(output);
+        assert_eq!(files[0].new_path.as_deref(), Some("with \"quote\".rs"));
+        assert_eq!(files[0].changed_lines, vec![1..=1]);
+    }
+
+    #[test]
+    fn test_compare_functions() {
+        let before = vec![
+            function("parse", 1, 10, 3),
+            function("<closure>", 12, 12, 1),
+            function("<closure>", 14, 14, 1),
+            function("untouched", 20, 25, 1),
+            function("legacy", 30, 40, 2),
+        ];
+        let after = vec![
+            function("parse", 1, 14, 5),
+            function("<closure>", 16, 16, 1),
+            function("<closure>", 18, 19, 2),
+            function("untouched", 24, 29, 1),
+            function("helper", 31, 33, 1),
+        ];
+
+        let changes = compare_functions(&before, &after, &[5..=8, 19..=19, 31..=33]);
+        let summary: Vec<_> = changes
+            .iter()
+            .map(|c| (c.name.as_str(), c.status))
+            .collect();
+        assert_eq!(
+            summary,
+            vec![
+                ("parse", ChangeStatus::Modified),
+                ("<closure>", ChangeStatus::Modified),
+                ("helper", ChangeStatus::Added),
+                ("legacy", ChangeStatus::Removed),
+            ]
+        );
+
+        assert_eq!(changes[0].before.unwrap().lines, 10);
+        assert_eq!(changes[0].after.unwrap().lines, 14);
+        // The second closure is matched with the second one of the base
+        assert_eq!(changes[1].before.unwrap().start_line, 14);
+        assert!(changes[2].before.is_none());
+        assert!(changes[3].after.is_none());
+    }
+
+    #[test]
+    fn test_diff_report_outside_repository() {
+        let temp_dir = TempDir::new().unwrap();
+        fs::write(temp_dir.path().join("main.rs"), "fn main() {}").unwrap();
+
+        let mut analyzer = CodeAnalyzer::new();
+        let result = diff_report(
+            &mut analyzer,
+            temp_dir.path(),
+            "HEAD",
+            &DirectoryOptions::default(),
+        );
+        assert!(matches!(result, Err(CodeStatsError::GitError(_))));
+    }
+}
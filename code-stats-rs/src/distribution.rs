@@ -0,0 +1,183 @@
+//! Distributions of file and function sizes for `--distribution`.
+//!
+//! Totals and maxima say little about the long tail: a codebase with a
+//! reasonable average can still hide a handful of 2000-line files. Each
+//! distribution reports percentiles by the nearest-rank method (the smallest
+//! value that at least that share of the values do not exceed) and a
+//! histogram over buckets that grow in a 1-2-5 sequence (0, 1, 2-4, 5-9,
+//! 10-19, 20-49, ...), so short and very long items are both visible.
+
+use crate::stats::DirectoryStats;
+use serde::Serialize;
+
+/// A range of values and how many values fall into it.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+pub(crate) struct Bucket {
+    /// Smallest value of the bucket
+    pub low: usize,
+    /// Largest value of the bucket, inclusive
+    pub high: usize,
+    /// Number of values in the bucket
+    pub count: usize,
+}
+
+/// Summary of a set of sizes: percentiles and a histogram.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub(crate) struct Distribution {
+    /// Number of values
+    pub count: usize,
+    pub min: usize,
+    pub max: usize,
+    pub mean: f64,
+    /// Median
+    pub p50: usize,
+    pub p90: usize,
+    pub p99: usize,
+    /// Buckets from the one holding `min` to the one holding `max`,
+    /// including empty buckets in between
+    pub buckets: Vec<Bucket>,
+}
+
+impl Distribution {
+    /// Summarizes `values`; an empty set has a count of zero and no buckets.
+    pub(crate) fn of(mut values: Vec<usize>) -> Self {
+        values.sort_unstable();
+        let (Some(&min), Some(&max)) = (values.first(), values.last()) else {
+            return Self {
+                count: 0,
+                min: 0,
+                max: 0,
+                mean: 0.0,
+                p50: 0,
+                p90: 0,
+                p99: 0,
+                buckets: Vec::new(),
+            };
+        };
+
+        let mut buckets: Vec<Bucket> = bucket_bounds()
+            .take_while(|&(low, _)| low <= max)
+            .filter(|&(_, high)| high >= min)
+            .map(|(low, high)| Bucket {
+                low,
+                high,
+                count: 0,
+            })
+            .collect();
+        for &value in &values {
+            if let Some(bucket) = buckets
+                .iter_mut()
+                .find(|bucket| (bucket.low..=bucket.high).contains(&value))
+            {
+                bucket.count += 1;
+            }
+        }
+
+        Self {
+            count: values.len(),
+            min,
+            max,
+            mean: values.iter().sum::<usize>() as f64 / values.len() as f64,
+            p50: percentile(&values, 50),
+            p90: percentile(&values, 90),
+            p99: percentile(&values, 99),
+            buckets,
+        }
+    }
+}
+
+/// Distributions of the sizes of a directory analysis.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub(crate) struct DistributionReport {
+    /// Lines of code per file, not counting configuration, generated, and
+    /// vendored files
+    pub file_lines: Distribution,
+    /// Lines spanned per function
+    pub function_lines: Distribution,
+}
+
+/// Computes the size distributions of `stats`.
+///
+/// # Arguments
+///
+/// * `stats` - The analysis whose code files and functions are measured
+///
+/// # Returns
+///
+/// The distributions of file lines of code and function lengths
+pub(crate) fn distributions(stats: &DirectoryStats) -> DistributionReport {
+    DistributionReport {
+        file_lines: Distribution::of(
+            stats
+                .code_file_stats()
+                .map(|file| file.stats.lines.code)
+                .collect(),
+        ),
+        function_lines: Distribution::of(
+            stats.functions().map(|f| f.function.line_count()).collect(),
+        ),
+    }
+}
+
+/// Returns the `p`th percentile of sorted, non-empty `values` by the
+/// nearest-rank method.
+fn percentile(values: &[usize], p: usize) -> usize {
+    let rank = (values.len() * p).div_ceil(100).max(1);
+    values[rank - 1]
+}
+
+/// Yields the `(low, high)` bounds of every bucket, in increasing order.
+fn bucket_bounds() -> impl Iterator<Item = (usize, usize)> {
+    // Lower bounds: 0, then 1, 2, 5 times each power of ten
+    let lows = std::iter::once(0).chain((0..).flat_map(|exponent: u32| {
+        let scale = 10usize.saturating_pow(exponent);
+        [1usize, 2, 5].map(|step| step.saturating_mul(scale))
+    }));
+    let mut lows = lows.peekable();
+    std::iter::from_fn(move || {
+        let low = lows.next()?;
+        let high = lows.peek()?.saturating_sub(1);
+        (high >= low).then_some((low, high))
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_percentiles_by_nearest_rank() {
+        let distribution = Distribution::of((1..=100).rev().collect());
+        assert_eq!(distribution.count, 100);
+        assert_eq!((distribution.min, distribution.max), (1, 100));
+        assert_eq!(distribution.mean, 50.5);
+        assert_eq!(
+            (distribution.p50, distribution.p90, distribution.p99),
+            (50, 90, 99)
+        );
+
+        // A single long value dominates only the top percentiles
+        let tail = Distribution::of(vec![10, 12, 11, 9, 2000]);
+        assert_eq!((tail.p50, tail.p90, tail.p99), (11, 2000, 2000));
+        assert_eq!(Distribution::of(vec![7]).p50, 7);
+    }
+
+    #[test]
+    fn test_buckets_span_min_to_max() {
+        let distribution = Distribution::of(vec![3, 4, 12, 60, 61, 62]);
+        let buckets: Vec<(usize, usize, usize)> = distribution
+            .buckets
+            .iter()
+            .map(|bucket| (bucket.low, bucket.high, bucket.count))
+            .collect();
+        assert_eq!(
+            buckets,
+            vec![(2, 4, 2), (5, 9, 0), (10, 19, 1), (20, 49, 0), (50, 99, 3)]
+        );
+
+        assert_eq!(Distribution::of(vec![0]).buckets[0].high, 0);
+        let empty = Distribution::of(Vec::new());
+        assert_eq!(empty.count, 0);
+        assert!(empty.buckets.is_empty());
+    }
+}
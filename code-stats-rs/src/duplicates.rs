@@ -0,0 +1,399 @@
+//! Duplicate code detection for `--duplicates`.
+//!
+//! Every function and block is fingerprinted by hashing its syntax subtree
+//! with identifiers and literals abstracted away, so copies that only rename
+//! variables or change constants still match. Fingerprints shared by two or
+//! more subtrees of at least `min_tokens` tokens form a clone group. Comments
+//! are ignored, and a clone nested inside a larger reported clone is dropped.
+
+use crate::analyzer::{CodeAnalyzer, DirectoryOptions};
+use crate::complexity::is_function;
+use crate::error::Result;
+use crate::language::SupportedLanguage;
+use crate::signature::function_name;
+use serde::Serialize;
+use std::collections::HashMap;
+use std::hash::{DefaultHasher, Hash, Hasher};
+use std::ops::Range;
+use std::path::{Path, PathBuf};
+use tree_sitter::Node;
+
+/// Default minimum clone size, in tokens.
+pub(crate) const DEFAULT_MIN_TOKENS: usize = 50;
+
+/// One copy of a cloned function or block.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct CloneLocation {
+    /// File containing the copy
+    pub path: PathBuf,
+    /// 1-based first line of the copy
+    pub start_line: usize,
+    /// 1-based last line of the copy
+    pub end_line: usize,
+    /// Function name, or `None` for a block
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub function: Option<String>,
+    /// Byte range of the copy, for nesting checks
+    #[serde(skip)]
+    bytes: Range<usize>,
+}
+
+impl CloneLocation {
+    /// Number of source lines spanned by the copy, including both ends.
+    pub(crate) fn line_count(&self) -> usize {
+        self.end_line - self.start_line + 1
+    }
+
+    /// Returns true if this copy lies within `other`.
+    fn is_within(&self, other: &CloneLocation) -> bool {
+        self.path == other.path
+            && self.bytes.start >= other.bytes.start
+            && self.bytes.end <= other.bytes.end
+    }
+}
+
+/// Structurally identical subtrees found in two or more places.
+#[derive(Debug, Clone, Serialize)]
+pub(crate) struct CloneGroup {
+    /// Size of each copy in tokens, after normalization
+    pub tokens: usize,
+    /// The copies, ordered by path and line
+    pub locations: Vec<CloneLocation>,
+}
+
+/// Result of a duplicate scan.
+#[derive(Debug, Clone, Serialize)]
+pub(crate) struct DuplicateReport {
+    /// Minimum clone size in tokens that was searched for
+    pub min_tokens: usize,
+    /// Clone groups, largest first
+    pub groups: Vec<CloneGroup>,
+}
+
+impl DuplicateReport {
+    /// Total number of copies across all groups.
+    pub(crate) fn location_count(&self) -> usize {
+        self.groups.iter().map(|group| group.locations.len()).sum()
+    }
+}
+
+/// A fingerprinted subtree that is large enough to be reported.
+struct Candidate {
+    hash: u64,
+    tokens: usize,
+    location: CloneLocation,
+}
+
+/// Scans a file or directory for duplicated functions and blocks.
+///
+/// Files are read and skipped as described in `CodeAnalyzer::visit_sources`.
+///
+/// # Arguments
+///
+/// * `analyzer` - Analyzer providing the parsers
+/// * `path` - File or directory to scan
+/// * `options` - Traversal and exclusion settings for directories
+/// * `min_tokens` - Smallest subtree, in tokens, that is considered a clone
+///
+/// # Returns
+///
+/// The clone groups found, or an error if no file could be scanned.
+pub(crate) fn find_duplicates(
+    analyzer: &mut CodeAnalyzer,
+    path: &Path,
+    options: &DirectoryOptions,
+    min_tokens: usize,
+) -> Result<DuplicateReport> {
+    let mut candidates = Vec::new();
+    analyzer.visit_sources(path, options, |analyzer, file, language, source_code| {
+        let tree = analyzer.parse(file, language, source_code)?;
+        let mut scan = Scan {
+            path: file,
+            source: source_code.as_bytes(),
+            language,
+            min_tokens,
+            candidates: &mut candidates,
+        };
+        scan.fingerprint(&tree.root_node());
+        Ok(())
+    })?;
+
+    Ok(DuplicateReport {
+        min_tokens,
+        groups: group_clones(candidates),
+    })
+}
+
+/// Per-file state of the fingerprinting traversal.
+struct Scan<'a> {
+    path: &'a Path,
+    source: &'a [u8],
+    language: SupportedLanguage,
+    min_tokens: usize,
+    candidates: &'a mut Vec<Candidate>,
+}
+
+impl Scan<'_> {
+    /// Hashes the subtree at `node` and records it if it is a large enough
+    /// function or block.
+    ///
+    /// # Returns
+    ///
+    /// The normalized hash of the subtree and its number of tokens.
+    fn fingerprint(&mut self, node: &Node) -> (u64, usize) {
+        let mut hasher = DefaultHasher::new();
+        let kind = node.kind();
+
+        if is_identifier(kind) {
+            "identifier".hash(&mut hasher);
+            return (hasher.finish(), 1);
+        }
+        if is_literal(kind) {
+            "literal".hash(&mut hasher);
+            return (hasher.finish(), 1);
+        }
+
+        kind.hash(&mut hasher);
+        let mut tokens = 0;
+        let mut cursor = node.walk();
+        for child in node.children(&mut cursor) {
+            if child.is_extra() {
+                continue;
+            }
+            let (hash, count) = self.fingerprint(&child);
+            hash.hash(&mut hasher);
+            tokens += count;
+        }
+        let tokens = tokens.max(1);
+        let hash = hasher.finish();
+
+        let is_function = is_function(node, self.source, &self.language);
+        if tokens >= self.min_tokens && (is_function || self.language.rules().is_block(kind)) {
+            self.candidates.push(Candidate {
+                hash,
+                tokens,
+                location: CloneLocation {
+                    path: self.path.to_path_buf(),
+                    start_line: node.start_position().row + 1,
+                    end_line: node.end_position().row + 1,
+                    function: is_function.then(|| function_name(node, self.source)),
+                    bytes: node.byte_range(),
+                },
+            });
+        }
+        (hash, tokens)
+    }
+}
+
+/// Returns true for tokens that name something and are abstracted away.
+fn is_identifier(kind: &str) -> bool {
+    kind.ends_with("identifier")
+}
+
+/// Returns true for literal values, which are abstracted away as a whole.
+fn is_literal(kind: &str) -> bool {
+    kind.ends_with("_literal")
+        || kind.contains("string")
+        || matches!(
+            kind,
+            "number"
+                | "integer"
+                | "float"
+                | "true"
+                | "false"
+                | "nil"
+                | "char"
+                | "rune_literal"
+                | "simple_symbol"
+        )
+}
+
+/// Groups candidates with equal fingerprints and drops nested clones.
+///
+/// Groups are considered largest first; a group whose copies all lie within
+/// copies already reported (such as the body block of a cloned function)
+/// adds nothing and is skipped.
+fn group_clones(candidates: Vec<Candidate>) -> Vec<CloneGroup> {
+    let mut by_hash: HashMap<u64, CloneGroup> = HashMap::new();
+    for candidate in candidates {
+        by_hash
+            .entry(candidate.hash)
+            .or_insert_with(|| CloneGroup {
+                tokens: candidate.tokens,
+                locations: Vec::new(),
+            })
+            .locations
+            .push(candidate.location);
+    }
+
+    let mut groups: Vec<CloneGroup> = by_hash
+        .into_values()
+        .filter(|group| group.locations.len() > 1)
+        .collect();
+    for group in &mut groups {
+        group
+            .locations
+            .sort_by(|a, b| (&a.path, a.start_line).cmp(&(&b.path, b.start_line)));
+    }
+    // Groups come out of the map in hash order; every location takes part in
+    // the comparison so that groups of equal size starting at the same place
+    // are still ordered the same way on every run
+    groups.sort_by(|a, b| {
+        b.tokens.cmp(&a.tokens).then_with(|| {
+            let key = |group: &CloneGroup| {
+                group
+                    .locations
+                    .iter()
+                    .map(|location| {
+                        (
+                            location.path.clone(),
+                            location.start_line,
+                            location.bytes.start,
+                        )
+                    })
+                    .collect::<Vec<_>>()
+            };
+            key(a).cmp(&key(b))
+        })
+    });
+
+    let mut reported: Vec<CloneLocation> = Vec::new();
+    groups.retain(|group| {
+        let nested = group
+            .locations
+            .iter()
+            .all(|location| reported.iter().any(|outer| location.is_within(outer)));
+        if !nested {
+            reported.extend(group.locations.iter().cloned());
+        }
+        !nested
+    });
+    groups
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn scan(
+        source: &str,
+        name: &str,
+        language: SupportedLanguage,
+        min_tokens: usize,
+    ) -> Vec<Candidate> {
+        let mut analyzer = CodeAnalyzer::new();
+        let path = Path::new(name);
+        let tree = analyzer.parse(path, language, source).unwrap();
+        let mut candidates = Vec::new();
+        Scan {
+            path,
+            source: source.as_bytes(),
+            language,
+            min_tokens,
+            candidates: &mut candidates,
+        }
+        .fingerprint(&tree.root_node());
+        candidates
+    }
+
+    fn location(path: &str, lines: (usize, usize), bytes: Range<usize>) -> CloneLocation {
+        CloneLocation {
+            path: PathBuf::from(path),
+            start_line: lines.0,
+            end_line: lines.1,
+            function: None,
+            bytes,
+        }
+    }
+
+    #[test]
+    fn test_renamed_copies_match() {
+        let source = r#"
+fn total(items: &[u32]) -> u32 {
+    let mut sum = 0;
+    for item in items {
+        if *item > 10 {
+            sum += item * 2;
+        }
+    }
+    sum
+}
+
+fn weight(values: &[u32]) -> u32 {
+    let mut acc = 0;
+    for v in values {
+        if *v > 99 {
+            acc += v * 7;
+        }
+    }
+    acc
+}
+
+fn other(values: &[u32]) -> u32 {
+    values.iter().sum()
+}
+"#;
+        let groups = group_clones(scan(source, "lib.rs", SupportedLanguage::Rust, 20));
+
+        // The function bodies are nested in the function clone and not repeated
+        assert_eq!(groups.len(), 1);
+        let names: Vec<_> = groups[0]
+            .locations
+            .iter()
+            .map(|l| (l.function.as_deref(), l.start_line, l.end_line))
+            .collect();
+        assert_eq!(
+            names,
+            vec![(Some("total"), 2, 10), (Some("weight"), 12, 20)]
+        );
+    }
+
+    #[test]
+    fn test_min_tokens_and_comments() {
+        let source = r#"
+function a(x) {
+  // first copy
+  return x + 1;
+}
+function b(y) {
+  return y + 2;
+}
+"#;
+        let small = scan(source, "a.js", SupportedLanguage::JavaScript, 5);
+        let groups = group_clones(small);
+        assert_eq!(groups.len(), 1);
+        assert_eq!(groups[0].locations.len(), 2);
+
+        let large = scan(source, "a.js", SupportedLanguage::JavaScript, 50);
+        assert!(group_clones(large).is_empty());
+    }
+
+    #[test]
+    fn test_group_clones_drops_nested_groups() {
+        let candidate = |hash, tokens, location| Candidate {
+            hash,
+            tokens,
+            location,
+        };
+        let groups = group_clones(vec![
+            candidate(1, 80, location("a.rs", (1, 10), 0..200)),
+            candidate(1, 80, location("b.rs", (5, 14), 50..250)),
+            // Blocks inside both copies of the first group
+            candidate(2, 40, location("a.rs", (2, 6), 20..100)),
+            candidate(2, 40, location("b.rs", (6, 10), 70..150)),
+            // A block that also appears outside of them
+            candidate(3, 30, location("a.rs", (7, 9), 120..180)),
+            candidate(3, 30, location("c.rs", (1, 3), 0..60)),
+            // Unique subtree
+            candidate(4, 60, location("c.rs", (10, 20), 100..400)),
+        ]);
+
+        let summary: Vec<_> = groups
+            .iter()
+            .map(|g| (g.tokens, g.locations.len()))
+            .collect();
+        assert_eq!(summary, vec![(80, 2), (30, 2)]);
+        assert_eq!(groups[1].locations[1].path, PathBuf::from("c.rs"));
+        assert_eq!(groups[0].locations[0].line_count(), 10);
+    }
+}
@@ -0,0 +1,437 @@
+//! Lua embedded in other files, analyzed with `--embedded-lua`.
+//!
+//! OpenResty runs Lua from nginx configuration files, and proxies, game
+//! engines, and other tools keep Lua scripts in the long strings of their
+//! YAML or TOML configuration. The code of these blocks is extracted and
+//! analyzed as Lua, like the fenced blocks of Markdown documents are in
+//! their languages:
+//!
+//! - nginx: the body of every `*_by_lua_block { ... }` directive and the
+//!   quoted argument of every `*_by_lua '...'` directive
+//! - YAML: literal block scalars (`key: |`) of Lua keys
+//! - TOML: multi-line strings (`key = """ ... """`) of Lua keys
+//!
+//! A Lua key has `lua` at the start or end of one of its words, as in `lua`,
+//! `inline_lua`, or `luaScript`, or is Envoy's `inline_code`. JSON strings
+//! escape their line breaks, so no code is extracted from JSON files.
+//!
+//! nginx configurations are not a supported language of their own: in this
+//! mode they are analyzed as Lua files measured only by the Lua they hold.
+
+use crate::fences::CodeBlock;
+use crate::language::SupportedLanguage;
+use std::path::Path;
+
+/// Keys whose strings hold Lua without saying so in their name.
+const LUA_KEYS: [&str; 1] = ["inline_code"];
+
+/// Suffix of the nginx directives that run Lua, as in `content_by_lua`.
+const NGINX_LUA_DIRECTIVE: &str = "_by_lua";
+
+/// Returns true if `path` names an nginx configuration file: `nginx.conf`, a
+/// `.nginx` file, or a `.conf` file below an `nginx` or `openresty`
+/// directory.
+pub(crate) fn is_nginx_config(path: &str) -> bool {
+    let path = Path::new(path);
+    let name = path
+        .file_name()
+        .and_then(|name| name.to_str())
+        .unwrap_or_default();
+    let extension = path
+        .extension()
+        .and_then(|extension| extension.to_str())
+        .unwrap_or_default();
+    name == "nginx.conf"
+        || extension == "nginx"
+        || (extension == "conf"
+            && path.parent().is_some_and(|dir| {
+                dir.components()
+                    .any(|part| matches!(part.as_os_str().to_str(), Some("nginx" | "openresty")))
+            }))
+}
+
+/// Lists the blocks of Lua embedded in a file, in source order.
+///
+/// # Arguments
+///
+/// * `path` - Path of the file, which tells nginx configurations apart
+/// * `language` - The language the file is analyzed in
+/// * `source` - The file's contents
+pub(crate) fn lua_blocks<'a>(
+    path: &str,
+    language: SupportedLanguage,
+    source: &'a str,
+) -> Vec<CodeBlock<'a>> {
+    if is_nginx_config(path) {
+        return nginx_blocks(source);
+    }
+    match language {
+        SupportedLanguage::Yaml => yaml_blocks(source),
+        SupportedLanguage::Toml => toml_blocks(source),
+        _ => Vec::new(),
+    }
+}
+
+/// Returns true if the value of `key` is Lua code.
+fn is_lua_key(key: &str) -> bool {
+    let key = key.trim().trim_matches(['"', '\'']);
+    LUA_KEYS.contains(&key)
+        || key
+            .split(|c: char| !c.is_ascii_alphanumeric())
+            .map(str::to_ascii_lowercase)
+            .any(|word| word.starts_with("lua") || word.ends_with("lua"))
+}
+
+/// Creates a Lua block of `source[start..end]`.
+fn block(source: &str, start: usize, end: usize) -> CodeBlock<'_> {
+    CodeBlock {
+        language: SupportedLanguage::Lua,
+        code: &source[start..end],
+        first_line: source[..start].matches('\n').count(),
+    }
+}
+
+fn nginx_blocks(source: &str) -> Vec<CodeBlock<'_>> {
+    let mut blocks = Vec::new();
+    let mut offset = 0;
+    while let Some(found) = source[offset..].find(NGINX_LUA_DIRECTIVE) {
+        let at = offset + found;
+        offset = at + NGINX_LUA_DIRECTIVE.len();
+        // A directive mentioned in a `#` comment
+        let line_start = source[..at].rfind('\n').map_or(0, |newline| newline + 1);
+        if source[line_start..at].contains('#') {
+            continue;
+        }
+
+        let rest = &source[offset..];
+        let (start, end) = if let Some(body) = rest.strip_prefix("_block") {
+            let body = body.trim_start();
+            if !body.starts_with('{') {
+                continue;
+            }
+            let open = source.len() - body.len();
+            let Some(close) = closing_brace(source.as_bytes(), open + 1) else {
+                break;
+            };
+            (open + 1, close)
+        } else if rest.starts_with(char::is_whitespace) {
+            // `*_by_lua_file` names a file instead, which is analyzed on its own
+            let argument = rest.trim_start();
+            if !argument.starts_with(['\'', '"']) {
+                continue;
+            }
+            let open = source.len() - argument.len();
+            let close = quoted_end(source.as_bytes(), open, true);
+            (open + 1, close.saturating_sub(1).max(open + 1))
+        } else {
+            continue;
+        };
+        blocks.push(block(source, start, end));
+        offset = end;
+    }
+    blocks
+}
+
+/// Returns the offset of the `}` that closes a Lua block starting at
+/// `start`, skipping the braces in its strings and comments.
+fn closing_brace(bytes: &[u8], start: usize) -> Option<usize> {
+    let mut depth = 0;
+    let mut index = start;
+    while index < bytes.len() {
+        match bytes[index] {
+            b'{' => depth += 1,
+            b'}' if depth == 0 => return Some(index),
+            b'}' => depth -= 1,
+            b'\'' | b'"' => {
+                index = quoted_end(bytes, index, false);
+                continue;
+            }
+            b'-' if bytes.get(index + 1) == Some(&b'-') => {
+                index = long_bracket_end(bytes, index + 2).unwrap_or_else(|| {
+                    bytes[index..]
+                        .iter()
+                        .position(|&byte| byte == b'\n')
+                        .map_or(bytes.len(), |newline| index + newline)
+                });
+                continue;
+            }
+            b'[' => {
+                if let Some(end) = long_bracket_end(bytes, index) {
+                    index = end;
+                    continue;
+                }
+            }
+            _ => {}
+        }
+        index += 1;
+    }
+    None
+}
+
+/// Returns the offset just past the string quoted at `open`, whose quote is
+/// escaped with a backslash inside it. Lua strings end at the line if
+/// unterminated; nginx strings may span lines.
+fn quoted_end(bytes: &[u8], open: usize, multiline: bool) -> usize {
+    let quote = bytes[open];
+    let mut index = open + 1;
+    while index < bytes.len() {
+        match bytes[index] {
+            b'\\' => index += 1,
+            b'\n' if !multiline => return index,
+            byte if byte == quote => return index + 1,
+            _ => {}
+        }
+        index += 1;
+    }
+    bytes.len()
+}
+
+/// Returns the offset just past a Lua long bracket opened at `open`, as in
+/// `[[ ... ]]` or `[==[ ... ]==]`, or `None` if none opens there.
+fn long_bracket_end(bytes: &[u8], open: usize) -> Option<usize> {
+    if bytes.get(open) != Some(&b'[') {
+        return None;
+    }
+    let level = bytes[open + 1..]
+        .iter()
+        .take_while(|&&byte| byte == b'=')
+        .count();
+    if bytes.get(open + 1 + level) != Some(&b'[') {
+        return None;
+    }
+    let mut closing = vec![b']'];
+    closing.extend(std::iter::repeat_n(b'=', level));
+    closing.push(b']');
+    let body = open + level + 2;
+    let end = bytes[body..]
+        .windows(closing.len())
+        .position(|window| window == closing.as_slice())
+        .map_or(bytes.len(), |close| body + close + closing.len());
+    Some(end)
+}
+
+/// Returns the lines of `source` with the offset each starts at.
+fn lines_with_offsets(source: &str) -> Vec<(usize, &str)> {
+    let mut offset = 0;
+    source
+        .split_inclusive('\n')
+        .map(|line| {
+            let start = offset;
+            offset += line.len();
+            (start, line)
+        })
+        .collect()
+}
+
+/// Returns the number of spaces `line` is indented by.
+fn indentation(line: &str) -> usize {
+    line.len() - line.trim_start_matches(' ').len()
+}
+
+fn yaml_blocks(source: &str) -> Vec<CodeBlock<'_>> {
+    let lines = lines_with_offsets(source);
+    let mut blocks = Vec::new();
+    let mut index = 0;
+    while index < lines.len() {
+        let (_, line) = lines[index];
+        index += 1;
+        if !is_lua_block_scalar(line) {
+            continue;
+        }
+
+        // The scalar holds the lines indented deeper than its key, with the
+        // blank lines among them
+        let indent = indentation(line);
+        let content: Vec<(usize, &str)> = lines[index..]
+            .iter()
+            .take_while(|(_, text)| text.trim().is_empty() || indentation(text) > indent)
+            .copied()
+            .collect();
+        index += content.len();
+        let mut code = content
+            .iter()
+            .skip_while(|(_, text)| text.trim().is_empty());
+        let Some(&(start, _)) = code.next() else {
+            continue;
+        };
+        let end = content
+            .iter()
+            .rfind(|(_, text)| !text.trim().is_empty())
+            .map_or(start, |(offset, text)| offset + text.len());
+        blocks.push(block(source, start, end));
+    }
+    blocks
+}
+
+/// Returns true if a YAML line opens a literal block scalar of a Lua key,
+/// as in `lua: |`, `- inline_code: |-`, or `script.lua: |2 # comment`.
+fn is_lua_block_scalar(line: &str) -> bool {
+    let line = line.trim();
+    let line = line.strip_prefix("- ").unwrap_or(line);
+    let Some((key, value)) = line.split_once(": ") else {
+        return false;
+    };
+    let value = value.split(" #").next().unwrap_or_default().trim();
+    is_lua_key(key)
+        && value.strip_prefix('|').is_some_and(|indicators| {
+            indicators
+                .chars()
+                .all(|c| matches!(c, '-' | '+' | '0'..='9'))
+        })
+}
+
+fn toml_blocks(source: &str) -> Vec<CodeBlock<'_>> {
+    let mut blocks = Vec::new();
+    let mut offset = 0;
+    while offset < source.len() {
+        let line_end = source[offset..]
+            .find('\n')
+            .map_or(source.len(), |newline| offset + newline + 1);
+        let line = &source[offset..line_end];
+        let next = line_end;
+
+        let Some((key, value)) = line
+            .split_once('=')
+            .filter(|_| !line.trim_start().starts_with('#'))
+        else {
+            offset = next;
+            continue;
+        };
+        let value = value.trim_start();
+        let Some(delimiter) = ["\"\"\"", "'''"]
+            .into_iter()
+            .find(|delimiter| value.starts_with(delimiter))
+        else {
+            offset = next;
+            continue;
+        };
+
+        // A newline right after the opening delimiter is not part of the string
+        let mut start = line_end - value.len() + delimiter.len();
+        if source[start..line_end].trim().is_empty() {
+            start = line_end;
+        }
+        let Some(close) = source[start..].find(delimiter).map(|close| start + close) else {
+            break;
+        };
+        // Strings of other keys are skipped whole, so none of their lines is
+        // read as a key
+        if is_lua_key(key) {
+            blocks.push(block(source, start, close));
+        }
+        offset = close + delimiter.len();
+    }
+    blocks
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_is_nginx_config() {
+        assert!(is_nginx_config("conf/nginx.conf"));
+        assert!(is_nginx_config("deploy/nginx/sites/shop.conf"));
+        assert!(is_nginx_config("openresty/api.conf"));
+        assert!(is_nginx_config("gateway.nginx"));
+        assert!(!is_nginx_config("etc/supervisord.conf"));
+        assert!(!is_nginx_config("nginx/README.md"));
+    }
+
+    #[test]
+    fn test_nginx_blocks() {
+        let source = r#"http {
+    # content_by_lua_block in a comment
+    init_by_lua_block {
+        cart = require "cart"
+    }
+    server {
+        location /cart {
+            content_by_lua_block {
+                local items = { "}" }
+                -- a } in a comment
+                ngx.say(cart.total(items), [[ } ]])
+            }
+        }
+        location /ping {
+            content_by_lua 'ngx.say("pong")';
+        }
+        location /static {
+            access_by_lua_file lua/access.lua;
+        }
+    }
+}
+"#;
+        let blocks = nginx_blocks(source);
+        let code: Vec<_> = blocks.iter().map(|block| block.code.trim()).collect();
+        assert_eq!(code.len(), 3);
+        assert_eq!(code[0], "cart = require \"cart\"");
+        assert!(code[1].starts_with("local items = { \"}\" }"));
+        assert!(code[1].ends_with("[[ } ]])"));
+        assert_eq!(code[2], "ngx.say(\"pong\")");
+        let lines: Vec<_> = blocks.iter().map(|block| block.first_line).collect();
+        assert_eq!(lines, [2, 7, 14]);
+    }
+
+    #[test]
+    fn test_yaml_blocks() {
+        let source = "\
+filters:
+  - name: envoy.filters.http.lua
+    typed_config:
+      inline_code: |
+        function envoy_on_request(handle)
+          handle:logInfo(\"request\")
+        end
+
+      stat_prefix: lua
+  - script: |
+      echo not lua
+game:
+  on_load.lua: |-
+    score = 0
+";
+        let blocks = yaml_blocks(source);
+        assert_eq!(blocks.len(), 2);
+        assert_eq!(blocks[0].first_line, 4);
+        assert!(
+            blocks[0]
+                .code
+                .trim_start()
+                .starts_with("function envoy_on_request")
+        );
+        assert!(blocks[0].code.ends_with("end\n"));
+        assert_eq!(blocks[1].first_line, 13);
+        assert_eq!(blocks[1].code.trim(), "score = 0");
+    }
+
+    #[test]
+    fn test_toml_blocks() {
+        let source = r#"
+[scripts]
+description = """
+lua = "not a key"
+"""
+on_load_lua = """
+score = 0
+function bonus(points) score = score + points end
+"""
+inline_lua = '''return 1'''
+"#;
+        let blocks = toml_blocks(source);
+        let code: Vec<_> = blocks
+            .iter()
+            .map(|block| (block.code, block.first_line))
+            .collect();
+        assert_eq!(
+            code,
+            [
+                (
+                    "score = 0\nfunction bonus(points) score = score + points end\n",
+                    6
+                ),
+                ("return 1", 9),
+            ]
+        );
+    }
+}
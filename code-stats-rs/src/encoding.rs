@@ -0,0 +1,263 @@
+//! Text encoding detection and transcoding of source files.
+//!
+//! tree-sitter parses UTF-8, so files in other encodings are transcoded
+//! before parsing. A byte order mark decides the encoding when there is one;
+//! otherwise UTF-16 is recognized by its NUL bytes, valid UTF-8 is taken as
+//! is, and any other text is read as Latin-1. Content that is none of these,
+//! such as binary data, is reported instead of being parsed into one large
+//! ERROR node.
+
+use serde::{Deserialize, Serialize};
+
+const UTF8_BOM: [u8; 3] = [0xEF, 0xBB, 0xBF];
+const UTF16_LE_BOM: [u8; 2] = [0xFF, 0xFE];
+const UTF16_BE_BOM: [u8; 2] = [0xFE, 0xFF];
+
+/// Number of leading bytes inspected for UTF-16 without a byte order mark.
+const SNIFF_BYTES: usize = 1024;
+
+/// Characters of Windows-1252 at `0x80..=0x9F`, where Latin-1 has control
+/// characters. The five unassigned positions keep their Latin-1 meaning.
+const WINDOWS_1252_HIGH: [char; 32] = [
+    '€', '\u{81}', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\u{8D}', 'Ž', '\u{8F}',
+    '\u{90}', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\u{9D}', 'ž', 'Ÿ',
+];
+
+/// Encoding a source file was read in.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub enum SourceEncoding {
+    /// UTF-8 without a byte order mark
+    #[default]
+    #[serde(rename = "utf-8")]
+    Utf8,
+    /// UTF-8 with a byte order mark, which is dropped before parsing
+    #[serde(rename = "utf-8-bom")]
+    Utf8Bom,
+    /// Little-endian UTF-16, with or without a byte order mark
+    #[serde(rename = "utf-16le")]
+    Utf16Le,
+    /// Big-endian UTF-16, with or without a byte order mark
+    #[serde(rename = "utf-16be")]
+    Utf16Be,
+    /// Single-byte text that is not valid UTF-8, read as Windows-1252 (the
+    /// superset of Latin-1 that Windows editors save)
+    #[serde(rename = "latin-1")]
+    Latin1,
+}
+
+impl SourceEncoding {
+    /// Returns true for plain UTF-8, which needs no transcoding.
+    pub fn is_utf8(&self) -> bool {
+        *self == SourceEncoding::Utf8
+    }
+}
+
+impl std::fmt::Display for SourceEncoding {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str(match self {
+            SourceEncoding::Utf8 => "UTF-8",
+            SourceEncoding::Utf8Bom => "UTF-8 with BOM",
+            SourceEncoding::Utf16Le => "UTF-16LE",
+            SourceEncoding::Utf16Be => "UTF-16BE",
+            SourceEncoding::Latin1 => "Latin-1",
+        })
+    }
+}
+
+/// Decodes the content of a source file into UTF-8.
+///
+/// # Returns
+///
+/// * `Ok((String, SourceEncoding))` - The text, without byte order mark, and
+///   the encoding it was read in
+/// * `Err(String)` - Why the content is not text in a supported encoding
+pub(crate) fn decode(bytes: &[u8]) -> std::result::Result<(String, SourceEncoding), String> {
+    let (encoding, body) = sniff(bytes);
+    let text = match encoding {
+        SourceEncoding::Utf8 | SourceEncoding::Utf8Bom => {
+            String::from_utf8(body.to_vec()).map_err(|e| format!("invalid UTF-8: {e}"))?
+        }
+        SourceEncoding::Utf16Le | SourceEncoding::Utf16Be => {
+            if body.len() % 2 != 0 {
+                return Err(format!("{encoding} content has an odd number of bytes"));
+            }
+            char::decode_utf16(utf16_units(body, encoding))
+                .collect::<std::result::Result<String, _>>()
+                .map_err(|e| {
+                    format!(
+                        "invalid {encoding}: unpaired surrogate {:#06x}",
+                        e.unpaired_surrogate()
+                    )
+                })?
+        }
+        SourceEncoding::Latin1 => {
+            if body.contains(&0) {
+                return Err("binary content (NUL bytes) that is not UTF-16".to_string());
+            }
+            body.iter().copied().map(windows_1252_char).collect()
+        }
+    };
+    Ok((text, encoding))
+}
+
+/// Decodes the start of a file like `decode`, replacing what can't be
+/// decoded, for sniffing content that may have been cut anywhere.
+pub(crate) fn decode_lossy(bytes: &[u8]) -> String {
+    let (encoding, body) = sniff(bytes);
+    match encoding {
+        SourceEncoding::Utf8 | SourceEncoding::Utf8Bom => {
+            String::from_utf8_lossy(body).into_owned()
+        }
+        SourceEncoding::Utf16Le | SourceEncoding::Utf16Be => {
+            char::decode_utf16(utf16_units(body, encoding))
+                .map(|c| c.unwrap_or(char::REPLACEMENT_CHARACTER))
+                .collect()
+        }
+        SourceEncoding::Latin1 => body.iter().copied().map(windows_1252_char).collect(),
+    }
+}
+
+/// Determines the encoding of `bytes` and returns it with the content after
+/// the byte order mark, if any.
+fn sniff(bytes: &[u8]) -> (SourceEncoding, &[u8]) {
+    if let Some(body) = bytes.strip_prefix(&UTF8_BOM) {
+        return (SourceEncoding::Utf8Bom, body);
+    }
+    if let Some(body) = bytes.strip_prefix(&UTF16_LE_BOM) {
+        return (SourceEncoding::Utf16Le, body);
+    }
+    if let Some(body) = bytes.strip_prefix(&UTF16_BE_BOM) {
+        return (SourceEncoding::Utf16Be, body);
+    }
+    if let Some(encoding) = bomless_utf16(bytes) {
+        return (encoding, bytes);
+    }
+    match std::str::from_utf8(bytes) {
+        Ok(_) => (SourceEncoding::Utf8, bytes),
+        // A multi-byte character cut off at the end of a sniffed head is
+        // still UTF-8
+        Err(e) if e.error_len().is_none() => (SourceEncoding::Utf8, bytes),
+        Err(_) => (SourceEncoding::Latin1, bytes),
+    }
+}
+
+/// Recognizes UTF-16 without a byte order mark by its NUL bytes: source
+/// code is mostly ASCII, whose UTF-16 code units have a zero high byte,
+/// while text in other encodings has no NUL bytes at all.
+fn bomless_utf16(bytes: &[u8]) -> Option<SourceEncoding> {
+    let sample = &bytes[..bytes.len().min(SNIFF_BYTES) & !1];
+    let pairs = sample.len() / 2;
+    if pairs == 0 {
+        return None;
+    }
+    let zeros_at = |offset: usize| {
+        sample
+            .iter()
+            .skip(offset)
+            .step_by(2)
+            .filter(|&&b| b == 0)
+            .count()
+    };
+    let (even, odd) = (zeros_at(0), zeros_at(1));
+    if odd * 2 > pairs && even * 16 < pairs {
+        Some(SourceEncoding::Utf16Le)
+    } else if even * 2 > pairs && odd * 16 < pairs {
+        Some(SourceEncoding::Utf16Be)
+    } else {
+        None
+    }
+}
+
+/// Splits UTF-16 content into code units of the given byte order. A trailing
+/// odd byte is ignored.
+fn utf16_units(body: &[u8], encoding: SourceEncoding) -> impl Iterator<Item = u16> + '_ {
+    body.chunks_exact(2).map(move |pair| match encoding {
+        SourceEncoding::Utf16Be => u16::from_be_bytes([pair[0], pair[1]]),
+        _ => u16::from_le_bytes([pair[0], pair[1]]),
+    })
+}
+
+/// Maps a Windows-1252 byte to its character.
+fn windows_1252_char(byte: u8) -> char {
+    match byte {
+        0x80..=0x9F => WINDOWS_1252_HIGH[usize::from(byte - 0x80)],
+        _ => char::from(byte),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn utf16(text: &str, big_endian: bool) -> Vec<u8> {
+        text.encode_utf16()
+            .flat_map(|unit| {
+                if big_endian {
+                    unit.to_be_bytes()
+                } else {
+                    unit.to_le_bytes()
+                }
+            })
+            .collect()
+    }
+
+    #[test]
+    fn test_decode_utf8() {
+        assert_eq!(
+            decode("fn main() {}\n".as_bytes()).unwrap(),
+            ("fn main() {}\n".to_string(), SourceEncoding::Utf8)
+        );
+        assert_eq!(
+            decode(b"\xEF\xBB\xBFint x;\n").unwrap(),
+            ("int x;\n".to_string(), SourceEncoding::Utf8Bom)
+        );
+        assert!(decode(b"\xEF\xBB\xBFint \xFF;\n").is_err());
+    }
+
+    #[test]
+    fn test_decode_utf16() {
+        let source = "class Main { /* é */ }\r\n";
+        let mut with_bom = vec![0xFF, 0xFE];
+        with_bom.extend(utf16(source, false));
+        assert_eq!(
+            decode(&with_bom).unwrap(),
+            (source.to_string(), SourceEncoding::Utf16Le)
+        );
+        assert_eq!(
+            decode(&utf16(source, false)).unwrap().1,
+            SourceEncoding::Utf16Le
+        );
+        assert_eq!(
+            decode(&utf16(source, true)).unwrap(),
+            (source.to_string(), SourceEncoding::Utf16Be)
+        );
+
+        // An unpaired high surrogate
+        let mut broken = vec![0xFF, 0xFE];
+        broken.extend([0x3D, 0xD8, b'x', 0x00]);
+        assert!(decode(&broken).unwrap_err().contains("unpaired surrogate"));
+    }
+
+    #[test]
+    fn test_decode_latin1_and_binary() {
+        assert_eq!(
+            decode(b"// caf\xE9 \x80 \x96\nint x;\n").unwrap(),
+            ("// café € –\nint x;\n".to_string(), SourceEncoding::Latin1)
+        );
+        assert!(
+            decode(b"\x7FELF\x02\x01\x01\x00\x00\x00\xFF")
+                .unwrap_err()
+                .contains("binary")
+        );
+    }
+
+    #[test]
+    fn test_decode_lossy_head() {
+        // A head cut inside a multi-byte character is still UTF-8
+        assert_eq!(
+            decode_lossy(&"#!/bin/sh\n# é".as_bytes()[..13]),
+            "#!/bin/sh\n# \u{FFFD}"
+        );
+        assert_eq!(decode_lossy(&utf16("package main", false)), "package main");
+    }
+}
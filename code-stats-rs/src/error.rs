@@ -8,7 +8,7 @@ use thiserror::Error;
 /// source code files, from file system operations to tree-sitter parsing failures.
 /// Each variant provides specific context about the error that occurred.
 #[derive(Debug, Error)]
-pub(crate) enum CodeStatsError {
+pub enum CodeStatsError {
     /// Indicates that tree-sitter failed to parse a source code file.
     ///
     /// This error occurs when the tree-sitter parser encounters syntax errors
@@ -56,6 +56,85 @@ pub(crate) enum CodeStatsError {
     /// - Disk I/O errors or corrupted file systems
     #[error("IO error: {0}")]
     IoError(String),
+
+    /// Indicates that a user-supplied configuration file is invalid.
+    ///
+    /// This error occurs when a configuration file cannot be read or parsed,
+    /// or when one of its entries is rejected (for example, a custom query
+    /// that does not compile for its language).
+    #[error("Invalid configuration: {0}")]
+    ConfigError(String),
+
+    /// Indicates that a git command needed for `--diff` failed.
+    ///
+    /// # Common causes
+    /// - The analyzed path is not inside a git repository
+    /// - The base ref does not exist
+    /// - `git` is not installed or not on `PATH`
+    #[error("Git error: {0}")]
+    GitError(String),
+
+    /// Indicates that a grammar from `--grammar-dir` could not be loaded.
+    ///
+    /// # Common causes
+    /// - The file is not a shared library for this platform
+    /// - The library does not export the `tree_sitter_<name>` function its
+    ///   file name implies
+    /// - The grammar was generated for an incompatible tree-sitter ABI version
+    /// - The grammar's name is that of a built-in language
+    #[error("Failed to load grammar: {0}")]
+    GrammarError(String),
+
+    /// Indicates that a file's content is not text in a supported encoding.
+    ///
+    /// Files are read as UTF-8, UTF-16 (with or without byte order mark), or
+    /// Latin-1; directory analysis lists the files it skipped for this reason.
+    ///
+    /// # Common causes
+    /// - Binary files with a source file extension
+    /// - UTF-16 files with unpaired surrogates or an odd number of bytes
+    /// - Invalid UTF-8 after a UTF-8 byte order mark
+    #[error("Failed to decode file: {0}")]
+    EncodingError(String),
+
+    /// Indicates that a snapshot could not be written to an `--output`
+    /// database.
+    ///
+    /// # Common causes
+    /// - The file is not an SQLite database, or is locked by another writer
+    /// - The database was created by a newer version with a different schema
+    /// - The directory of the file is not writable
+    #[error("Database error: {0}")]
+    DatabaseError(String),
+
+    /// Indicates that parsing a file took longer than the parse timeout.
+    ///
+    /// Directory analysis lists the files it gave up on for this reason
+    /// instead of failing.
+    ///
+    /// # Common causes
+    /// - Deeply nested generated code
+    /// - Huge files whose grammar backtracks heavily on error recovery
+    #[error("Parse timed out: {0}")]
+    Timeout(String),
+
+    /// Indicates that analysis was stopped before it finished, by Ctrl-C on
+    /// the command line.
+    #[error("Analysis interrupted")]
+    Cancelled,
+
+    /// Indicates that a plugin from the configuration file could not be
+    /// started.
+    ///
+    /// Failures of a plugin on single files are recorded with the file
+    /// instead.
+    ///
+    /// # Common causes
+    /// - The program of `command` is not installed or not on `PATH`
+    /// - A relative program path that doesn't resolve from the directory of
+    ///   the configuration file
+    #[error("Plugin error: {0}")]
+    PluginError(String),
 }
 
 /// A type alias for `Result<T, CodeStatsError>`.
@@ -63,7 +142,7 @@ pub(crate) enum CodeStatsError {
 /// This provides a convenient shorthand for functions that return results
 /// with `CodeStatsError` as the error type. This is the standard pattern
 /// used throughout the codebase for error handling.
-pub(crate) type Result<T> = std::result::Result<T, CodeStatsError>;
+pub type Result<T> = std::result::Result<T, CodeStatsError>;
 
 #[cfg(test)]
 mod tests {
@@ -82,6 +161,42 @@ mod tests {
 
         let err = CodeStatsError::IoError("File not found".to_string());
         assert_eq!(err.to_string(), "IO error: File not found");
+
+        let err = CodeStatsError::ConfigError("unknown language 'cobol'".to_string());
+        assert_eq!(
+            err.to_string(),
+            "Invalid configuration: unknown language 'cobol'"
+        );
+
+        let err = CodeStatsError::GitError("unknown revision 'nope'".to_string());
+        assert_eq!(err.to_string(), "Git error: unknown revision 'nope'");
+
+        let err = CodeStatsError::GrammarError("dart.so: undefined symbol".to_string());
+        assert_eq!(
+            err.to_string(),
+            "Failed to load grammar: dart.so: undefined symbol"
+        );
+
+        let err = CodeStatsError::EncodingError("logo.c: binary content".to_string());
+        assert_eq!(
+            err.to_string(),
+            "Failed to decode file: logo.c: binary content"
+        );
+
+        let err = CodeStatsError::DatabaseError("stats.db: database is locked".to_string());
+        assert_eq!(
+            err.to_string(),
+            "Database error: stats.db: database is locked"
+        );
+
+        let err = CodeStatsError::Timeout("parser_tables.c".to_string());
+        assert_eq!(err.to_string(), "Parse timed out: parser_tables.c");
+
+        let err = CodeStatsError::Cancelled;
+        assert_eq!(err.to_string(), "Analysis interrupted");
+
+        let err = CodeStatsError::PluginError("failed to start 'team'".to_string());
+        assert_eq!(err.to_string(), "Plugin error: failed to start 'team'");
     }
 
     #[test]
@@ -121,6 +236,14 @@ mod tests {
             CodeStatsError::LanguageSetupError,
             CodeStatsError::UnsupportedFileType("file.doc".to_string()),
             CodeStatsError::IoError("Permission denied".to_string()),
+            CodeStatsError::ConfigError("missing name".to_string()),
+            CodeStatsError::GitError("not a git repository".to_string()),
+            CodeStatsError::GrammarError("incompatible ABI".to_string()),
+            CodeStatsError::EncodingError("unpaired surrogate".to_string()),
+            CodeStatsError::DatabaseError("file is not a database".to_string()),
+            CodeStatsError::Timeout("generated.c".to_string()),
+            CodeStatsError::Cancelled,
+            CodeStatsError::PluginError("failed to start 'team'".to_string()),
         ];
 
         for error in errors {
@@ -135,6 +258,28 @@ mod tests {
                 CodeStatsError::IoError(msg) => {
                     assert!(!msg.is_empty());
                 }
+                CodeStatsError::ConfigError(msg) => {
+                    assert!(!msg.is_empty());
+                }
+                CodeStatsError::GitError(msg) => {
+                    assert!(!msg.is_empty());
+                }
+                CodeStatsError::GrammarError(msg) => {
+                    assert!(!msg.is_empty());
+                }
+                CodeStatsError::EncodingError(msg) => {
+                    assert!(!msg.is_empty());
+                }
+                CodeStatsError::DatabaseError(msg) => {
+                    assert!(!msg.is_empty());
+                }
+                CodeStatsError::Timeout(file) => {
+                    assert!(!file.is_empty());
+                }
+                CodeStatsError::Cancelled => {}
+                CodeStatsError::PluginError(msg) => {
+                    assert!(!msg.is_empty());
+                }
             }
         }
     }
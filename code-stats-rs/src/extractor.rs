@@ -0,0 +1,700 @@
+//! Pluggable per-language analysis of parsed files.
+//!
+//! Every file is parsed by the analyzer and handed to the `Extractor`
+//! registered for its language, which turns the syntax tree into `CodeStats`.
+//! Languages without a registered extractor use `BuiltinExtractor`, the
+//! analysis the reports are documented with. Programs embedding the library
+//! register their own extractor to replace or extend it for a language:
+//!
+//! ```no_run
+//! use code_stats_rs::{
+//!     BuiltinExtractor, CodeAnalyzer, CodeStats, Extractor, ExtractorQuery,
+//!     ExtractorRegistry, SupportedLanguage,
+//! };
+//! use std::sync::Arc;
+//! use tree_sitter::Tree;
+//!
+//! /// The built-in Go statistics plus a count of `go` statements.
+//! struct GoroutineExtractor;
+//!
+//! impl Extractor for GoroutineExtractor {
+//!     fn language(&self) -> &str {
+//!         "go"
+//!     }
+//!
+//!     fn name(&self) -> &str {
+//!         "goroutines-v1"
+//!     }
+//!
+//!     fn queries(&self) -> Vec<ExtractorQuery> {
+//!         vec![ExtractorQuery::new("goroutines", "(go_statement) @go")]
+//!     }
+//!
+//!     fn extract(&self, tree: &Tree, source: &str) -> CodeStats {
+//!         BuiltinExtractor::new(SupportedLanguage::Go).extract(tree, source)
+//!     }
+//! }
+//!
+//! let mut extractors = ExtractorRegistry::new();
+//! extractors.register(Arc::new(GoroutineExtractor))?;
+//! let mut analyzer = CodeAnalyzer::new().with_extractors(extractors);
+//! # Ok::<(), code_stats_rs::CodeStatsError>(())
+//! ```
+//!
+//! An extractor names its language as `--lang` does. For a language that is
+//! neither built in nor loaded with `--grammar-dir`, it supplies the grammar
+//! and file extensions, which registering it adds as a dynamic grammar, so
+//! that files of the language are detected and parsed from then on.
+
+mod bash;
+mod c;
+mod cpp;
+mod csharp;
+mod css;
+mod dockerfile;
+mod elixir;
+mod erb;
+mod erlang;
+mod generic;
+mod go;
+mod gotemplate;
+mod graphql;
+mod groovy;
+mod haskell;
+mod hcl;
+mod html;
+mod java;
+mod javascript;
+mod jinja;
+mod json;
+mod jupyter;
+mod kotlin;
+mod lua;
+mod make;
+mod markdown;
+mod nim;
+mod ocaml;
+mod php;
+mod protobuf;
+mod python;
+mod ruby;
+mod rust;
+mod scala;
+mod scss;
+mod sql;
+mod svelte;
+mod swift;
+mod toml;
+mod typescript;
+mod vue;
+mod yaml;
+mod zig;
+
+use crate::complexity::{Flow, binary_operator};
+use crate::error::{CodeStatsError, Result};
+use crate::grammar;
+use crate::imports::Index;
+use crate::language::{Dialect, SupportedLanguage};
+use crate::members::Members;
+use crate::parser::{CodeStats, Declaration, analyze_tree};
+use crate::query::NamedQuery;
+use std::collections::HashMap;
+use std::sync::Arc;
+use tree_sitter::{Language, Node, Query, Tree};
+
+/// Turns the syntax tree of a file in one language into statistics.
+///
+/// Implementations must be thread-safe, as directory analysis shares them
+/// between its worker threads.
+pub trait Extractor: Send + Sync {
+    /// Name of the language of the files this extractor analyzes: a built-in
+    /// language (`"go"`, `"c++"`), a loaded grammar, or the language `grammar`
+    /// adds.
+    fn language(&self) -> &str;
+
+    /// Identifies the extractor in the result cache. Change it whenever
+    /// `extract` starts returning different results, so that cached
+    /// statistics are recomputed.
+    fn name(&self) -> &str;
+
+    /// Queries counted in every file, reported under their names like those
+    /// of `--queries`. None by default.
+    fn queries(&self) -> Vec<ExtractorQuery> {
+        Vec::new()
+    }
+
+    /// Grammar of a language that is neither built in nor loaded, added under
+    /// the name `language` returns when the extractor is registered. Only
+    /// consulted for such languages; `None` by default.
+    fn grammar(&self) -> Option<Language> {
+        None
+    }
+
+    /// Extensions, without the `.`, of the files in the language `grammar`
+    /// adds. None by default.
+    fn extensions(&self) -> Vec<String> {
+        Vec::new()
+    }
+
+    /// Computes the statistics of a file.
+    ///
+    /// # Arguments
+    ///
+    /// * `tree` - The file parsed with the language's grammar
+    /// * `source` - The file's contents
+    fn extract(&self, tree: &Tree, source: &str) -> CodeStats;
+}
+
+/// A named counter an extractor adds to every file of its language.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ExtractorQuery {
+    /// Counter name shown in reports
+    pub name: String,
+    /// tree-sitter query whose matches are counted
+    pub pattern: String,
+}
+
+impl ExtractorQuery {
+    /// Creates a counter of the matches of `pattern`.
+    pub fn new(name: impl Into<String>, pattern: impl Into<String>) -> Self {
+        Self {
+            name: name.into(),
+            pattern: pattern.into(),
+        }
+    }
+}
+
+/// The statistics this crate computes for a language out of the box.
+///
+/// Custom extractors can wrap it to report the built-in counts alongside
+/// their own.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct BuiltinExtractor {
+    language: SupportedLanguage,
+}
+
+impl BuiltinExtractor {
+    /// Creates the built-in extractor for `language`.
+    pub fn new(language: SupportedLanguage) -> Self {
+        Self { language }
+    }
+}
+
+impl Extractor for BuiltinExtractor {
+    fn language(&self) -> &str {
+        self.language.name()
+    }
+
+    fn name(&self) -> &str {
+        "builtin"
+    }
+
+    fn extract(&self, tree: &Tree, source: &str) -> CodeStats {
+        analyze_tree(&tree.root_node(), source, &self.language)
+    }
+}
+
+/// An extractor with its queries compiled for each dialect of its language.
+#[derive(Clone)]
+pub(crate) struct RegisteredExtractor {
+    pub extractor: Arc<dyn Extractor>,
+    queries: Arc<HashMap<Dialect, Vec<NamedQuery>>>,
+}
+
+impl RegisteredExtractor {
+    /// Returns the extractor's queries compiled for `dialect`.
+    pub(crate) fn queries(&self, dialect: Dialect) -> &[NamedQuery] {
+        self.queries.get(&dialect).map_or(&[], Vec::as_slice)
+    }
+}
+
+/// The extractors registered for each language, by language name.
+#[derive(Clone, Default)]
+pub struct ExtractorRegistry {
+    extractors: HashMap<String, RegisteredExtractor>,
+}
+
+impl ExtractorRegistry {
+    /// Creates a registry without custom extractors, so that every language
+    /// uses `BuiltinExtractor`.
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Registers `extractor` for its language, replacing any extractor
+    /// registered for it before.
+    ///
+    /// A language that is neither built in nor loaded is added with the
+    /// extractor's grammar, for as long as the process runs.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(())` - The extractor's queries compiled for every dialect of its
+    ///   language
+    /// * `Err(ConfigError)` - The language is unknown and the extractor
+    ///   supplies no grammar, or a query does not compile
+    /// * `Err(GrammarError)` - The supplied grammar has an incompatible ABI
+    ///   version
+    pub fn register(&mut self, extractor: Arc<dyn Extractor>) -> Result<()> {
+        let language = match SupportedLanguage::from_name(extractor.language()) {
+            Some(language) => language,
+            None => match extractor.grammar() {
+                Some(grammar) => {
+                    grammar::define_grammar(extractor.language(), grammar, extractor.extensions())?
+                }
+                None => {
+                    return Err(CodeStatsError::ConfigError(format!(
+                        "extractor '{}': unknown language '{}'",
+                        extractor.name(),
+                        extractor.language()
+                    )));
+                }
+            },
+        };
+        let mut queries = HashMap::new();
+        for &dialect in Dialect::all(language) {
+            let compiled = extractor
+                .queries()
+                .into_iter()
+                .map(|definition| {
+                    Query::new(
+                        &language.get_language_with_dialect(dialect),
+                        &definition.pattern,
+                    )
+                    .map(|query| NamedQuery::new(definition.name.clone(), query))
+                    .map_err(|e| {
+                        CodeStatsError::ConfigError(format!(
+                            "extractor '{}', query '{}': {e} (line {})",
+                            extractor.name(),
+                            definition.name,
+                            e.row + 1
+                        ))
+                    })
+                })
+                .collect::<Result<Vec<_>>>()?;
+            queries.insert(dialect, compiled);
+        }
+
+        self.extractors.insert(
+            language.name().to_string(),
+            RegisteredExtractor {
+                extractor,
+                queries: Arc::new(queries),
+            },
+        );
+        Ok(())
+    }
+
+    /// Returns the extractor registered for `language`, or `None` if the
+    /// language uses `BuiltinExtractor`.
+    pub(crate) fn get(&self, language: SupportedLanguage) -> Option<&RegisteredExtractor> {
+        self.extractors.get(language.name())
+    }
+
+    /// Returns true if no custom extractor is registered.
+    pub fn is_empty(&self) -> bool {
+        self.extractors.is_empty()
+    }
+}
+
+impl std::fmt::Debug for ExtractorRegistry {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        let mut names: Vec<_> = self
+            .extractors
+            .iter()
+            .map(|(language, registered)| (language.as_str(), registered.extractor.name()))
+            .collect();
+        names.sort();
+        f.debug_map().entries(names).finish()
+    }
+}
+
+/// The node kinds and hooks the built-in analysis looks up per language.
+///
+/// Every built-in language implements it in a module of its own, and the
+/// grammars loaded at runtime share `generic::Generic`. The defaults are what
+/// most grammars have in common, so each language only overrides what its
+/// grammar names or measures differently.
+pub(crate) trait LanguageRules: Sync {
+    /// Returns true if `node` is a function-like declaration whose complexity
+    /// should be reported.
+    fn is_function(&self, node: &Node, _source: &[u8]) -> bool {
+        self.is_function_node(node.kind())
+    }
+
+    /// Returns true if a node of the given kind is a function-like declaration,
+    /// see `is_function`.
+    fn is_function_node(&self, _kind: &str) -> bool {
+        false
+    }
+
+    /// Returns true if the node adds an independent path through the function.
+    fn is_decision_point(&self, _node: &Node, _source: &[u8]) -> bool {
+        false
+    }
+
+    /// Returns true if `node` opens a nested control-flow block.
+    fn is_nesting_node(&self, _node: &Node, _source: &[u8]) -> bool {
+        false
+    }
+
+    /// Classifies a node for cognitive complexity.
+    fn flow(&self, _node: &Node, _source: &[u8]) -> Flow {
+        Flow::Plain
+    }
+
+    /// Returns true if a node of the given kind is an `if` statement or expression.
+    fn is_if(&self, kind: &str) -> bool {
+        kind == "if_statement"
+    }
+
+    /// Returns true for `break`/`continue` with a label and for `goto`.
+    fn is_labeled_jump(&self, _node: &Node) -> bool {
+        false
+    }
+
+    /// Returns the operator of a short-circuiting boolean operation, if `node` is one.
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        binary_operator(node, "binary_expression", &["&&", "||"])
+    }
+
+    /// Returns the name a node contributes to qualified names, if it is a scope.
+    fn scope_name(&self, _node: &Node, _source: &[u8]) -> Option<String> {
+        None
+    }
+
+    /// Returns the declared name of a type declaration.
+    fn type_name<'a>(&self, node: &Node, source: &'a [u8]) -> Option<&'a str> {
+        node.child_by_field_name("name")?.utf8_text(source).ok()
+    }
+
+    /// Returns the arity of a function in a grammar that doesn't list its
+    /// parameters in a `parameters` field, or `None` to count that list.
+    fn arity(&self, _node: &Node) -> Option<usize> {
+        None
+    }
+
+    /// Returns how many values a function returns in a language where its
+    /// declaration says, or `None` to count its `return` statements.
+    fn declared_returns(&self, _node: &Node, _source: &[u8]) -> Option<usize> {
+        None
+    }
+
+    /// Returns true for functions whose body is a single expression rather than
+    /// a block: `x => x * 2`, `fn($x) => $x * 2`, C# `=> expression` members,
+    /// and Kotlin `fun twice(x: Int) = x * 2`.
+    fn has_expression_body(&self, _node: &Node) -> bool {
+        false
+    }
+
+    /// Returns true if `node` is a `return`, which Kotlin and Swift parse as
+    /// their generic jump statement.
+    fn is_return(&self, node: &Node) -> bool {
+        node.kind() == "return_statement"
+    }
+
+    /// Classifies a syntax node as one of the declarations counted for `language`.
+    fn classify(&self, _node: &Node, _source: &[u8]) -> Option<Declaration> {
+        None
+    }
+
+    /// Adds what the language counts for `node` besides the declaration
+    /// `classify` made of it, if any, such as extra breakdown kinds.
+    fn node_stats(
+        &self,
+        _node: &Node,
+        _source: &[u8],
+        _declaration: Option<Declaration>,
+        _stats: &mut CodeStats,
+    ) {
+    }
+
+    /// Adds the statistics only the language reports to those of a file, once
+    /// `stats` lists its functions.
+    fn file_stats(&self, _root: &Node, _source: &[u8], _stats: &mut CodeStats) {}
+
+    /// Returns true if a type declaration is partial, the type being spread
+    /// over several declarations.
+    fn is_partial(&self, _node: &Node) -> bool {
+        false
+    }
+
+    /// Returns true for the languages whose switch statements are listed.
+    fn has_switches(&self) -> bool {
+        false
+    }
+
+    /// Returns the keyword of a switch statement node, or `None` for other
+    /// nodes.
+    fn switch_kind(&self, _node: &Node) -> Option<&'static str> {
+        None
+    }
+
+    /// Returns true if `node` is an arm of a switch statement.
+    fn is_switch_arm(&self, _node: &Node) -> bool {
+        false
+    }
+
+    /// Returns true if the arm is taken when no other arm matches.
+    fn is_default_arm(&self, _arm: &Node, _source: &[u8]) -> bool {
+        false
+    }
+
+    /// Returns true for statement blocks, the other unit clones are reported for.
+    fn is_block(&self, _kind: &str) -> bool {
+        false
+    }
+
+    /// Returns `Some(documented)` if `node` is a public declaration, `None` otherwise.
+    fn public_declaration(&self, _node: &Node, _source: &[u8]) -> Option<bool> {
+        None
+    }
+
+    /// Returns true if `node`, a named node below `parent`, is a logical line.
+    fn is_logical_line(&self, _node: &Node, _parent: Option<Node>) -> bool {
+        false
+    }
+
+    /// Returns whether a file named `name` (`stem` without its extensions) is a
+    /// test by the conventions of its language, or `None` for languages that
+    /// are not code.
+    fn is_test_name(&self, _name: &str, _stem: &str) -> Option<bool> {
+        None
+    }
+
+    /// Counts the fields and base types of a type declaration.
+    fn type_members(&self, _node: &Node, _source: &[u8]) -> Members {
+        Members::default()
+    }
+
+    /// Adds the modules `node` itself imports to `found`, counting the inline
+    /// Rust module it opens in `inline_modules`.
+    fn collect_imports(
+        &self,
+        _node: &Node,
+        _source: &[u8],
+        _inline_modules: &mut usize,
+        _found: &mut Vec<String>,
+    ) {
+    }
+
+    /// Resolves an import of the file at `relative` to the imported module
+    /// and whether it is one of the analyzed files, which by default it isn't.
+    fn resolve_import(&self, _index: &Index, _relative: &str, spec: &str) -> (String, bool) {
+        (spec.to_string(), false)
+    }
+}
+
+impl SupportedLanguage {
+    /// Returns the rules the built-in analysis applies to the language.
+    pub(crate) fn rules(&self) -> &'static dyn LanguageRules {
+        match self {
+            SupportedLanguage::Rust => &rust::Rust,
+            SupportedLanguage::Go => &go::Go,
+            SupportedLanguage::Python => &python::Python,
+            SupportedLanguage::JavaScript => &javascript::JavaScript,
+            SupportedLanguage::TypeScript => &typescript::TypeScript,
+            SupportedLanguage::Java => &java::Java,
+            SupportedLanguage::C => &c::C,
+            SupportedLanguage::Cpp => &cpp::Cpp,
+            SupportedLanguage::Ruby => &ruby::Ruby,
+            SupportedLanguage::Kotlin => &kotlin::Kotlin,
+            SupportedLanguage::CSharp => &csharp::CSharp,
+            SupportedLanguage::Swift => &swift::Swift,
+            SupportedLanguage::Php => &php::Php,
+            SupportedLanguage::Bash => &bash::Bash,
+            SupportedLanguage::Sql => &sql::Sql,
+            SupportedLanguage::Markdown => &markdown::Markdown,
+            SupportedLanguage::Yaml => &yaml::Yaml,
+            SupportedLanguage::Json => &json::Json,
+            SupportedLanguage::Toml => &toml::Toml,
+            SupportedLanguage::Dockerfile => &dockerfile::Dockerfile,
+            SupportedLanguage::Make => &make::Make,
+            SupportedLanguage::Protobuf => &protobuf::Protobuf,
+            SupportedLanguage::Scala => &scala::Scala,
+            SupportedLanguage::Groovy => &groovy::Groovy,
+            SupportedLanguage::Elixir => &elixir::Elixir,
+            SupportedLanguage::Erlang => &erlang::Erlang,
+            SupportedLanguage::Haskell => &haskell::Haskell,
+            SupportedLanguage::OCaml => &ocaml::OCaml,
+            SupportedLanguage::Zig => &zig::Zig,
+            SupportedLanguage::Nim => &nim::Nim,
+            SupportedLanguage::Lua => &lua::Lua,
+            SupportedLanguage::Html => &html::Html,
+            SupportedLanguage::Css => &css::Css,
+            SupportedLanguage::Scss => &scss::Scss,
+            SupportedLanguage::Jupyter => &jupyter::Jupyter,
+            SupportedLanguage::Vue => &vue::Vue,
+            SupportedLanguage::Svelte => &svelte::Svelte,
+            SupportedLanguage::Jinja => &jinja::Jinja,
+            SupportedLanguage::GoTemplate => &gotemplate::GoTemplate,
+            SupportedLanguage::Erb => &erb::Erb,
+            SupportedLanguage::Graphql => &graphql::Graphql,
+            SupportedLanguage::Hcl => &hcl::Hcl,
+            SupportedLanguage::Dynamic(_) => &generic::Generic,
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::analyzer::CodeAnalyzer;
+    use std::path::Path;
+
+    struct Fixed {
+        queries: Vec<ExtractorQuery>,
+    }
+
+    impl Extractor for Fixed {
+        fn language(&self) -> &str {
+            "typescript"
+        }
+
+        fn name(&self) -> &str {
+            "fixed"
+        }
+
+        fn queries(&self) -> Vec<ExtractorQuery> {
+            self.queries.clone()
+        }
+
+        fn extract(&self, _tree: &Tree, _source: &str) -> CodeStats {
+            CodeStats {
+                function_count: 42,
+                ..CodeStats::default()
+            }
+        }
+    }
+
+    #[test]
+    fn test_register_compiles_queries_for_every_dialect() {
+        let mut registry = ExtractorRegistry::new();
+        assert!(registry.is_empty());
+        registry
+            .register(Arc::new(Fixed {
+                queries: vec![ExtractorQuery::new(
+                    "functions",
+                    "(function_declaration) @f",
+                )],
+            }))
+            .unwrap();
+
+        let registered = registry.get(SupportedLanguage::TypeScript).unwrap();
+        assert_eq!(registered.extractor.name(), "fixed");
+        assert_eq!(registered.queries(Dialect::Standard).len(), 1);
+        assert_eq!(registered.queries(Dialect::Tsx).len(), 1);
+        assert!(registry.get(SupportedLanguage::Go).is_none());
+        assert_eq!(format!("{registry:?}"), r#"{"TypeScript": "fixed"}"#);
+    }
+
+    #[test]
+    fn test_register_rejects_invalid_queries() {
+        let mut registry = ExtractorRegistry::new();
+        let err = registry
+            .register(Arc::new(Fixed {
+                queries: vec![ExtractorQuery::new("broken", "(function_declaration")],
+            }))
+            .unwrap_err();
+
+        assert!(
+            err.to_string()
+                .contains("extractor 'fixed', query 'broken'")
+        );
+        assert!(registry.is_empty());
+    }
+
+    /// The built-in Go statistics plus a count of `go` statements, as in the
+    /// module documentation.
+    struct GoroutineExtractor;
+
+    impl Extractor for GoroutineExtractor {
+        fn language(&self) -> &str {
+            "go"
+        }
+
+        fn name(&self) -> &str {
+            "goroutines-v1"
+        }
+
+        fn queries(&self) -> Vec<ExtractorQuery> {
+            vec![ExtractorQuery::new("goroutines", "(go_statement) @go")]
+        }
+
+        fn extract(&self, tree: &Tree, source: &str) -> CodeStats {
+            let mut stats = BuiltinExtractor::new(SupportedLanguage::Go).extract(tree, source);
+            stats.record_kind("extended");
+            stats
+        }
+    }
+
+    #[test]
+    fn test_registered_extractor_extends_builtin_analysis() {
+        let mut registry = ExtractorRegistry::new();
+        registry.register(Arc::new(GoroutineExtractor)).unwrap();
+        let mut analyzer = CodeAnalyzer::new().with_extractors(registry);
+        let source =
+            "package main\n\nfunc work() {}\n\nfunc main() {\n\tgo work()\n\tgo work()\n}\n";
+
+        let file = analyzer
+            .analyze_text(Path::new("main.go"), SupportedLanguage::Go, source)
+            .unwrap();
+        // The hooks of the Go rules still apply through `BuiltinExtractor`
+        assert_eq!(file.stats.function_count, 2);
+        assert_eq!(file.stats.go.as_ref().unwrap().goroutines, 2);
+        assert_eq!(file.stats.kinds.get("extended"), Some(&1));
+        assert_eq!(file.stats.queries.get("goroutines"), Some(&2));
+    }
+
+    /// An extractor for a language of its own, parsed with the Rust grammar.
+    struct Supplied {
+        grammar: Option<Language>,
+    }
+
+    impl Extractor for Supplied {
+        fn language(&self) -> &str {
+            "rust-script"
+        }
+
+        fn name(&self) -> &str {
+            "supplied"
+        }
+
+        fn grammar(&self) -> Option<Language> {
+            self.grammar.clone()
+        }
+
+        fn extensions(&self) -> Vec<String> {
+            vec!["rss".to_string()]
+        }
+
+        fn extract(&self, tree: &Tree, source: &str) -> CodeStats {
+            let language = SupportedLanguage::from_name("rust-script").unwrap();
+            BuiltinExtractor::new(language).extract(tree, source)
+        }
+    }
+
+    #[test]
+    fn test_register_adds_the_grammar_of_a_new_language() {
+        let mut registry = ExtractorRegistry::new();
+        let err = registry
+            .register(Arc::new(Supplied { grammar: None }))
+            .unwrap_err();
+        assert!(
+            err.to_string()
+                .contains("extractor 'supplied': unknown language 'rust-script'")
+        );
+
+        registry
+            .register(Arc::new(Supplied {
+                grammar: Some(SupportedLanguage::Rust.get_language()),
+            }))
+            .unwrap();
+        let language = SupportedLanguage::from_file_extension("build.rss").unwrap();
+        assert_eq!(language.name(), "rust-script");
+        assert!(
+            matches!(language, SupportedLanguage::Dynamic(grammar) if grammar.path().is_none())
+        );
+        assert_eq!(registry.get(language).unwrap().extractor.name(), "supplied");
+    }
+}
@@ -0,0 +1,162 @@
+//! The node kinds and hooks of the built-in Bash analysis.
+//!
+//! Shell functions are all visible to whoever sources the script, so doc
+//! coverage counts no declarations.
+
+use crate::complexity::cyclomatic_complexity;
+use crate::complexity::{Flow, binary_operator, has_operator, operator_token};
+use crate::extractor::LanguageRules;
+use crate::language::SupportedLanguage;
+use crate::parser::CodeStats;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for Bash.
+pub(crate) struct Bash;
+
+impl LanguageRules for Bash {
+    fn is_function_node(&self, kind: &str) -> bool {
+        kind == "function_definition"
+    }
+
+    fn is_decision_point(&self, node: &Node, source: &[u8]) -> bool {
+        match node.kind() {
+            "if_statement"
+            | "elif_clause"
+            | "for_statement"
+            | "c_style_for_statement"
+            | "while_statement" => true,
+            // `*)` is the default branch of a `case`
+            "case_item" => node
+                .child_by_field_name("value")
+                .and_then(|value| value.utf8_text(source).ok())
+                .is_none_or(|pattern| pattern.trim() != "*"),
+            // `cmd && ok || fail` chains and `[[ a && b ]]` tests
+            "list" => self.logical_operator(node).is_some(),
+            "binary_expression" => has_operator(node, &["&&", "||"]),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_statement"
+                | "for_statement"
+                | "c_style_for_statement"
+                | "while_statement"
+                | "case_statement"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "for_statement" | "c_style_for_statement" | "while_statement" | "case_statement" => {
+                Flow::Structure
+            }
+            _ => Flow::Plain,
+        }
+    }
+
+    // A shell `list` joins two commands with an unlabeled `&&` or `||`
+    // token, as Erlang's `binary_op_expr` does with `andalso` and `orelse`
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        if node.kind() == "list" {
+            operator_token(node)
+        } else {
+            binary_operator(node, "binary_expression", &["&&", "||"])
+        }
+    }
+
+    fn declared_returns(&self, _node: &Node, _source: &[u8]) -> Option<usize> {
+        Some(0)
+    }
+
+    // Scripts keep much of their logic outside functions, so conditionals
+    // and loops are listed in the breakdown too
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly};
+        match node.kind() {
+            "function_definition" => Declaration::new("function", Function),
+            "if_statement" => Declaration::new("if", KindOnly),
+            "case_statement" => Declaration::new("case", KindOnly),
+            "for_statement" | "c_style_for_statement" | "while_statement" => {
+                Declaration::new("loop", KindOnly)
+            }
+            _ => None,
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        matches!(kind, "compound_statement" | "do_group")
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        // The condition of an `if` or `while` is its header line
+        let counted = matches!(
+            kind,
+            "command"
+                | "declaration_command"
+                | "unset_command"
+                | "variable_assignment"
+                | "pipeline"
+                | "list"
+                | "negated_command"
+                | "test_command"
+                | "redirected_statement"
+                | "for_statement"
+                | "c_style_for_statement"
+                | "case_statement"
+                | "function_definition"
+        );
+        // Parts of a pipeline, chain, or substitution are part of one line
+        counted
+            && !matches!(
+                parent_kind,
+                "pipeline"
+                    | "list"
+                    | "negated_command"
+                    | "redirected_statement"
+                    | "command"
+                    | "declaration_command"
+                    | "command_substitution"
+                    | "process_substitution"
+            )
+    }
+
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.ends_with("_test") || stem.ends_with("_unittest") || stem.starts_with("test_"))
+    }
+
+    // The top level is measured like a function body and stops at
+    // functions, which add their own decision points
+    fn file_stats(&self, root: &Node, source: &[u8], stats: &mut CodeStats) {
+        let top_level = cyclomatic_complexity(root, source, &SupportedLanguage::Bash);
+        stats.script_complexity = top_level
+            + stats
+                .functions
+                .iter()
+                .map(|function| function.complexity - 1)
+                .sum::<usize>();
+    }
+
+    // `source lib.sh` and `. lib.sh` pull in another script
+    fn node_stats(
+        &self,
+        node: &Node,
+        source: &[u8],
+        _declaration: Option<Declaration>,
+        stats: &mut CodeStats,
+    ) {
+        if node.kind() == "command"
+            && node
+                .child_by_field_name("name")
+                .and_then(|name| name.utf8_text(source).ok())
+                .is_some_and(|name| matches!(name, "source" | "."))
+        {
+            stats.record_kind("source");
+        }
+    }
+}
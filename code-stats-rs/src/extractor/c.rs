@@ -0,0 +1,191 @@
+//! The node kinds and hooks of the built-in C analysis.
+//!
+//! C has no visibility keyword that marks public API, so doc coverage counts
+//! no declarations.
+
+use crate::complexity::{Flow, binary_operator, has_operator};
+use crate::extractor::LanguageRules;
+use crate::imports::{Index, join, normalize, parent};
+use crate::logical::is_statement;
+use crate::members::{Members, body_children, named};
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for C.
+pub(crate) struct C;
+
+impl LanguageRules for C {
+    fn is_function_node(&self, kind: &str) -> bool {
+        kind == "function_definition"
+    }
+
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        match node.kind() {
+            "if_statement"
+            | "for_statement"
+            | "for_range_loop"
+            | "while_statement"
+            | "do_statement"
+            | "catch_clause"
+            | "conditional_expression" => true,
+            // `default:` is a case_statement without a value
+            "case_statement" => node.child_by_field_name("value").is_some(),
+            // C++ also spells the operators `and` and `or`
+            "binary_expression" => has_operator(node, &["&&", "||", "and", "or"]),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_statement"
+                | "for_statement"
+                | "for_range_loop"
+                | "while_statement"
+                | "do_statement"
+                | "switch_statement"
+                | "try_statement"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "for_statement"
+            | "for_range_loop"
+            | "while_statement"
+            | "do_statement"
+            | "switch_statement"
+            | "catch_clause"
+            | "conditional_expression" => Flow::Structure,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn is_labeled_jump(&self, node: &Node) -> bool {
+        node.kind() == "goto_statement"
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        binary_operator(node, "binary_expression", &["&&", "||", "and", "or"])
+    }
+
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        let node_kind = node.kind();
+        match node_kind {
+            "function_definition" if is_cpp_method(node) => Declaration::new("method", Function),
+            "function_definition" => Declaration::new("function", Function),
+            // `struct Point p;` names a type without defining it, so only
+            // specifiers with a body are declarations
+            "struct_specifier" | "class_specifier" | "union_specifier" | "enum_specifier"
+                if node.child_by_field_name("body").is_some() =>
+            {
+                Declaration::new(node_kind.trim_end_matches("_specifier"), Type)
+            }
+            "lambda_expression" => Declaration::new("lambda", Function),
+            "template_declaration" => Declaration::new("template", KindOnly),
+            "namespace_definition" => Declaration::new("namespace", KindOnly),
+            "preproc_def" | "preproc_function_def" => Declaration::new("macro", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn has_switches(&self) -> bool {
+        true
+    }
+
+    fn switch_kind(&self, node: &Node) -> Option<&'static str> {
+        (node.kind() == "switch_statement").then_some("switch")
+    }
+
+    fn is_switch_arm(&self, node: &Node) -> bool {
+        node.kind() == "case_statement"
+    }
+
+    // `default:` is a case_statement without a value
+    fn is_default_arm(&self, arm: &Node, _source: &[u8]) -> bool {
+        arm.child_by_field_name("value").is_none()
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "compound_statement"
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        is_statement(kind, parent_kind)
+    }
+
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.ends_with("_test") || stem.ends_with("_unittest") || stem.starts_with("test_"))
+    }
+
+    fn type_members(&self, node: &Node, _source: &[u8]) -> Members {
+        Members {
+            fields: body_children(node, "body")
+                .iter()
+                .filter(|child| child.kind() == "field_declaration")
+                .map(cpp_field_count)
+                .sum(),
+            bases: named(node)
+                .iter()
+                .filter(|child| child.kind() == "base_class_clause")
+                .flat_map(named)
+                .filter(|base| base.kind() != "access_specifier")
+                .count(),
+        }
+    }
+
+    fn collect_imports(
+        &self,
+        node: &Node,
+        source: &[u8],
+        _inline_modules: &mut usize,
+        found: &mut Vec<String>,
+    ) {
+        let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+        let field = |name: &str| node.child_by_field_name(name);
+        if node.kind() == "preproc_include" {
+            found.extend(field("path").map(|path| text(&path)));
+        }
+    }
+
+    fn resolve_import(&self, index: &Index, relative: &str, spec: &str) -> (String, bool) {
+        let directory = parent(relative);
+        let internal = |name: String| (name, true);
+        let external = |name: &str| (name.to_string(), false);
+        let Some(path) = spec.strip_prefix('"').and_then(|s| s.strip_suffix('"')) else {
+            return external(spec.trim_matches(|c| c == '<' || c == '>'));
+        };
+        let (stem, ext) = path.rsplit_once('.').unwrap_or((path, ""));
+        let candidates = [normalize(&join(directory, path)), normalize(path)];
+        index
+            .first_file(candidates)
+            .or_else(|| index.by_suffix(stem, &[ext]))
+            .map_or_else(|| external(path), internal)
+    }
+}
+
+/// Counts the fields of a C or C++ field declaration: one per declarator,
+/// except for the function declarators of methods.
+fn cpp_field_count(declaration: &Node) -> usize {
+    let mut cursor = declaration.walk();
+    declaration
+        .children_by_field_name("declarator", &mut cursor)
+        .filter(|declarator| declarator.kind() != "function_declarator")
+        .count()
+}
+
+/// Returns true if a C++ `function_definition` is defined inside a class,
+/// struct, or union body (possibly as a template member).
+fn is_cpp_method(node: &Node) -> bool {
+    let mut parent = node.parent();
+    if let Some(p) = parent
+        && p.kind() == "template_declaration"
+    {
+        parent = p.parent();
+    }
+    parent.is_some_and(|body| body.kind() == "field_declaration_list")
+}
@@ -0,0 +1,108 @@
+//! The node kinds and hooks of the built-in C++ analysis.
+//!
+//! C++ has no visibility keyword that marks public API, so doc coverage counts
+//! no declarations.
+
+use crate::complexity::{Flow, binary_operator};
+use crate::extractor::LanguageRules;
+use crate::imports::Index;
+use crate::logical::is_statement;
+use crate::members::Members;
+use crate::parser::Declaration;
+use tree_sitter::Node;
+
+/// The built-in rules for C++.
+pub(crate) struct Cpp;
+
+impl LanguageRules for Cpp {
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(kind, "function_definition" | "lambda_expression")
+    }
+
+    fn is_decision_point(&self, node: &Node, source: &[u8]) -> bool {
+        super::c::C.is_decision_point(node, source)
+    }
+
+    fn is_nesting_node(&self, node: &Node, source: &[u8]) -> bool {
+        super::c::C.is_nesting_node(node, source)
+    }
+
+    fn flow(&self, node: &Node, source: &[u8]) -> Flow {
+        super::c::C.flow(node, source)
+    }
+
+    fn is_labeled_jump(&self, node: &Node) -> bool {
+        node.kind() == "goto_statement"
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        binary_operator(node, "binary_expression", &["&&", "||", "and", "or"])
+    }
+
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+        match node.kind() {
+            "namespace_definition" | "class_specifier" | "struct_specifier" | "union_specifier" => {
+                node.child_by_field_name("name").and_then(text)
+            }
+            _ => None,
+        }
+    }
+
+    fn classify(&self, node: &Node, source: &[u8]) -> Option<Declaration> {
+        super::c::C.classify(node, source)
+    }
+
+    fn has_switches(&self) -> bool {
+        true
+    }
+
+    fn switch_kind(&self, node: &Node) -> Option<&'static str> {
+        (node.kind() == "switch_statement").then_some("switch")
+    }
+
+    fn is_switch_arm(&self, node: &Node) -> bool {
+        node.kind() == "case_statement"
+    }
+
+    // `default:` is a case_statement without a value
+    fn is_default_arm(&self, arm: &Node, _source: &[u8]) -> bool {
+        arm.child_by_field_name("value").is_none()
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "compound_statement"
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        is_statement(kind, parent_kind)
+    }
+
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.ends_with("_test") || stem.ends_with("_unittest") || stem.starts_with("test_"))
+    }
+
+    fn type_members(&self, node: &Node, source: &[u8]) -> Members {
+        super::c::C.type_members(node, source)
+    }
+
+    fn collect_imports(
+        &self,
+        node: &Node,
+        source: &[u8],
+        _inline_modules: &mut usize,
+        found: &mut Vec<String>,
+    ) {
+        let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+        let field = |name: &str| node.child_by_field_name(name);
+        if node.kind() == "preproc_include" {
+            found.extend(field("path").map(|path| text(&path)));
+        }
+    }
+
+    fn resolve_import(&self, index: &Index, relative: &str, spec: &str) -> (String, bool) {
+        super::c::C.resolve_import(index, relative, spec)
+    }
+}
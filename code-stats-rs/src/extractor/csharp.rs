@@ -0,0 +1,289 @@
+//! The node kinds and hooks of the built-in C# analysis.
+
+use crate::comments::preceding_comment;
+use crate::complexity::{Flow, binary_operator, has_operator};
+use crate::extractor::LanguageRules;
+use crate::logical::is_statement;
+use crate::members::{Members, body_children, named};
+use crate::parser::{Declaration, Tally, has_child_kind};
+use tree_sitter::Node;
+
+/// The built-in rules for C#.
+pub(crate) struct CSharp;
+
+impl LanguageRules for CSharp {
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(
+            kind,
+            "method_declaration"
+                | "constructor_declaration"
+                | "destructor_declaration"
+                | "operator_declaration"
+                | "conversion_operator_declaration"
+                | "local_function_statement"
+                | "lambda_expression"
+                | "anonymous_method_expression"
+        )
+    }
+
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        let kind = node.kind();
+        match kind {
+            "if_statement"
+            | "for_statement"
+            | "foreach_statement"
+            | "while_statement"
+            | "do_statement"
+            | "catch_clause"
+            | "conditional_expression" => true,
+            // A section holding `default:` is the default branch
+            "switch_section" => {
+                let mut cursor = node.walk();
+                !node
+                    .children(&mut cursor)
+                    .any(|child| matches!(child.kind(), "default" | "default_switch_label"))
+            }
+            // The discard arm `_ => ...` is the default of a switch expression
+            "switch_expression_arm" => {
+                let mut cursor = node.walk();
+                node.named_children(&mut cursor)
+                    .next()
+                    .is_none_or(|pattern| pattern.kind() != "discard")
+            }
+            "binary_expression" => has_operator(node, &["&&", "||", "??"]),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_statement"
+                | "for_statement"
+                | "foreach_statement"
+                | "while_statement"
+                | "do_statement"
+                | "switch_statement"
+                | "switch_expression"
+                | "try_statement"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "for_statement"
+            | "foreach_statement"
+            | "while_statement"
+            | "do_statement"
+            | "switch_statement"
+            | "switch_expression"
+            | "catch_clause"
+            | "conditional_expression" => Flow::Structure,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn is_labeled_jump(&self, node: &Node) -> bool {
+        node.kind() == "goto_statement"
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        binary_operator(node, "binary_expression", &["&&", "||", "??"])
+    }
+
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+        match node.kind() {
+            "namespace_declaration"
+            | "file_scoped_namespace_declaration"
+            | "class_declaration"
+            | "struct_declaration"
+            | "record_declaration"
+            | "record_struct_declaration"
+            | "interface_declaration" => node.child_by_field_name("name").and_then(text),
+            _ => None,
+        }
+    }
+
+    fn has_expression_body(&self, node: &Node) -> bool {
+        let mut cursor = node.walk();
+        (node.kind() == "lambda_expression"
+            && node
+                .child_by_field_name("body")
+                .is_some_and(|body| body.kind() != "block"))
+            || node
+                .named_children(&mut cursor)
+                .any(|child| child.kind() == "arrow_expression_clause")
+    }
+
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "method_declaration" => Declaration::new("method", Function),
+            "constructor_declaration" => Declaration::new("constructor", Function),
+            "destructor_declaration" => Declaration::new("destructor", Function),
+            "operator_declaration" | "conversion_operator_declaration" => {
+                Declaration::new("operator", Function)
+            }
+            "local_function_statement" => Declaration::new("local_function", Function),
+            "lambda_expression" | "anonymous_method_expression" => {
+                Declaration::new("lambda", Function)
+            }
+            "class_declaration" => Declaration::new("class", Type),
+            "struct_declaration" => Declaration::new("struct", Type),
+            "record_declaration" | "record_struct_declaration" => Declaration::new("record", Type),
+            "interface_declaration" => Declaration::new("interface", Type),
+            "enum_declaration" => Declaration::new("enum", Type),
+            // Namespaces, properties, and delegates in the breakdown only
+            "namespace_declaration" | "file_scoped_namespace_declaration" => {
+                Declaration::new("namespace", KindOnly)
+            }
+            "property_declaration" => Declaration::new("property", KindOnly),
+            "delegate_declaration" => Declaration::new("delegate", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn has_switches(&self) -> bool {
+        true
+    }
+
+    fn switch_kind(&self, node: &Node) -> Option<&'static str> {
+        matches!(node.kind(), "switch_statement" | "switch_expression").then_some("switch")
+    }
+
+    fn is_switch_arm(&self, node: &Node) -> bool {
+        matches!(node.kind(), "switch_section" | "switch_expression_arm")
+    }
+
+    fn is_default_arm(&self, arm: &Node, _source: &[u8]) -> bool {
+        let mut cursor = arm.walk();
+        match arm.kind() {
+            "switch_section" => arm
+                .children(&mut cursor)
+                .any(|child| matches!(child.kind(), "default" | "default_switch_label")),
+            _ => arm
+                .named_children(&mut cursor)
+                .next()
+                .is_some_and(|pattern| pattern.kind() == "discard"),
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "block"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        csharp_declaration(node, source)
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        is_statement(kind, parent_kind)
+    }
+
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.ends_with("Test") || stem.ends_with("Tests") || stem.ends_with("Spec"))
+    }
+
+    fn type_members(&self, node: &Node, _source: &[u8]) -> Members {
+        csharp_members(node)
+    }
+
+    fn collect_imports(
+        &self,
+        node: &Node,
+        source: &[u8],
+        _inline_modules: &mut usize,
+        found: &mut Vec<String>,
+    ) {
+        let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+        if node.kind() == "using_directive" {
+            let mut cursor = node.walk();
+            found.extend(
+                node.named_children(&mut cursor)
+                    .filter(|child| matches!(child.kind(), "qualified_name" | "identifier"))
+                    .last()
+                    .map(|name| text(&name)),
+            );
+        }
+    }
+
+    fn is_partial(&self, node: &Node) -> bool {
+        has_csharp_modifier(node, "partial")
+    }
+}
+
+fn csharp_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    if !matches!(
+        node.kind(),
+        "class_declaration"
+            | "struct_declaration"
+            | "record_declaration"
+            | "record_struct_declaration"
+            | "interface_declaration"
+            | "enum_declaration"
+            | "method_declaration"
+            | "constructor_declaration"
+            | "property_declaration"
+    ) {
+        return None;
+    }
+
+    let mut cursor = node.walk();
+    let is_public = node
+        .children(&mut cursor)
+        .filter(|child| child.kind() == "modifier")
+        .any(|modifier| modifier.utf8_text(source) == Ok("public"));
+    if !is_public {
+        return None;
+    }
+
+    // XML documentation is one `///` comment node per line; the last line
+    // sits directly above the declaration's attributes
+    let documented = preceding_comment(node, &[])
+        .and_then(|comment| comment.utf8_text(source).ok())
+        .is_some_and(|text| text.starts_with("///"));
+    Some(documented)
+}
+
+/// Counts the fields, properties, record parameters, and base types of a C#
+/// type.
+fn csharp_members(node: &Node) -> Members {
+    let fields = body_children(node, "body")
+        .iter()
+        .map(|child| match child.kind() {
+            "field_declaration" => named(child)
+                .iter()
+                .filter(|declaration| declaration.kind() == "variable_declaration")
+                .flat_map(named)
+                .filter(|declarator| declarator.kind() == "variable_declarator")
+                .count(),
+            "property_declaration" => 1,
+            _ => 0,
+        })
+        .sum::<usize>()
+        + named(node)
+            .iter()
+            .filter(|child| child.kind() == "parameter_list")
+            .flat_map(named)
+            .filter(|parameter| parameter.kind() == "parameter")
+            .count();
+    // `record Point(int X) : Shape(X)` passes arguments to its base
+    let bases = named(node)
+        .iter()
+        .filter(|child| child.kind() == "base_list")
+        .flat_map(named)
+        .filter(|base| base.kind() != "argument_list")
+        .count();
+    Members { fields, bases }
+}
+
+/// Returns true if a C# declaration carries the given modifier keyword.
+fn has_csharp_modifier(node: &Node, keyword: &str) -> bool {
+    let mut cursor = node.walk();
+    node.children(&mut cursor)
+        .filter(|child| child.kind() == "modifier")
+        .any(|modifier| has_child_kind(&modifier, keyword))
+}
@@ -0,0 +1,42 @@
+//! The node kinds and hooks of the built-in CSS analysis.
+//!
+//! Stylesheets are measured by their rules, see `web`.
+
+use crate::extractor::LanguageRules;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for CSS.
+pub(crate) struct Css;
+
+impl LanguageRules for Css {
+    // SCSS mixins and `@function`s take parameters and branch with
+    // `@if` and loops, so they are its functions
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly};
+        match node.kind() {
+            "rule_set" => Declaration::new("rule", KindOnly),
+            "media_statement" => Declaration::new("media", KindOnly),
+            "supports_statement" => Declaration::new("supports", KindOnly),
+            "keyframes_statement" => Declaration::new("keyframes", KindOnly),
+            "import_statement" | "use_statement" | "forward_statement" => {
+                Declaration::new("import", KindOnly)
+            }
+            "mixin_statement" => Declaration::new("mixin", Function),
+            "function_statement" => Declaration::new("function", Function),
+            "include_statement" => Declaration::new("include", KindOnly),
+            "extend_statement" => Declaration::new("extend", KindOnly),
+            _ => None,
+        }
+    }
+
+    // Rules repeating the same declarations under other selectors
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "block"
+    }
+
+    fn is_logical_line(&self, _node: &Node, parent: Option<Node>) -> bool {
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        matches!(parent_kind, "stylesheet" | "block")
+    }
+}
@@ -0,0 +1,61 @@
+//! The node kinds and hooks of the built-in Dockerfile analysis.
+//!
+//! Dockerfiles have no functions; they are measured by their instructions.
+
+use crate::extractor::LanguageRules;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for Dockerfile.
+pub(crate) struct Dockerfile;
+
+impl LanguageRules for Dockerfile {
+    // An `ONBUILD RUN ...` only runs in images built from this one, so
+    // the wrapped instruction is not counted again
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::KindOnly;
+        match node.kind() {
+            kind if kind.ends_with("_instruction")
+                && node
+                    .parent()
+                    .is_none_or(|parent| parent.kind() != "onbuild_instruction") =>
+            {
+                Declaration::new(dockerfile_instruction(kind), KindOnly)
+            }
+            _ => None,
+        }
+    }
+
+    // `HEALTHCHECK CMD ...` and `ONBUILD RUN ...` are one instruction
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        kind.ends_with("_instruction") && !parent_kind.ends_with("_instruction")
+    }
+}
+
+/// Returns the breakdown label of a Dockerfile instruction node, its keyword
+/// in lowercase (`from`, `run`, `copy`, ...).
+fn dockerfile_instruction(kind: &str) -> &'static str {
+    match kind {
+        "from_instruction" => "from",
+        "run_instruction" => "run",
+        "cmd_instruction" => "cmd",
+        "label_instruction" => "label",
+        "maintainer_instruction" => "maintainer",
+        "expose_instruction" => "expose",
+        "env_instruction" => "env",
+        "add_instruction" => "add",
+        "copy_instruction" => "copy",
+        "entrypoint_instruction" => "entrypoint",
+        "volume_instruction" => "volume",
+        "user_instruction" => "user",
+        "workdir_instruction" => "workdir",
+        "arg_instruction" => "arg",
+        "onbuild_instruction" => "onbuild",
+        "stopsignal_instruction" => "stopsignal",
+        "healthcheck_instruction" => "healthcheck",
+        "shell_instruction" => "shell",
+        _ => "instruction",
+    }
+}
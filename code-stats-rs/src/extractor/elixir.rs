@@ -0,0 +1,227 @@
+//! The node kinds and hooks of the built-in Elixir analysis.
+
+use crate::beam::is_genserver_callback;
+use crate::beam::{
+    self, elixir_attribute, elixir_call_name, elixir_definition, elixir_module_name,
+};
+use crate::comments::{is_comment, is_elixir_false};
+use crate::complexity::{Flow, binary_operator, has_operator};
+use crate::extractor::LanguageRules;
+use crate::language::SupportedLanguage;
+use crate::parser::CodeStats;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for Elixir.
+pub(crate) struct Elixir;
+
+impl LanguageRules for Elixir {
+    fn is_function(&self, node: &Node, source: &[u8]) -> bool {
+        node.kind() == "anonymous_function" || elixir_definition(node, source).is_some()
+    }
+
+    // `def` and its relatives are calls, see `is_function`
+    fn is_function_node(&self, kind: &str) -> bool {
+        kind == "anonymous_function"
+    }
+
+    fn is_decision_point(&self, node: &Node, source: &[u8]) -> bool {
+        let kind = node.kind();
+        match kind {
+            "call" => matches!(
+                elixir_call_name(node, source),
+                Some("if" | "unless" | "for" | "with")
+            ),
+            // The clauses of `case`, `cond`, `receive`, and `rescue`, and
+            // every clause but the first of a multi-clause `fn`
+            "stab_clause" => {
+                if node
+                    .parent()
+                    .is_some_and(|parent| parent.kind() == "anonymous_function")
+                {
+                    node.prev_named_sibling()
+                        .is_some_and(|previous| previous.kind() == "stab_clause")
+                } else {
+                    !is_catch_all_clause(node, source)
+                }
+            }
+            "binary_operator" => has_operator(node, &["and", "or", "&&", "||"]),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, source: &[u8]) -> bool {
+        is_elixir_structure(node, source)
+    }
+
+    // `try` only nests; its `rescue` and `catch` blocks are what branch
+    fn flow(&self, node: &Node, source: &[u8]) -> Flow {
+        match node.kind() {
+            "call" if is_elixir_structure(node, source) => {
+                if elixir_call_name(node, source) == Some("try") {
+                    Flow::Nest
+                } else {
+                    Flow::Structure
+                }
+            }
+            "rescue_block" | "catch_block" => Flow::Structure,
+            "else_block" => Flow::Branch,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        binary_operator(node, "binary_operator", &["and", "or", "&&", "||"])
+    }
+
+    // A nested `defmodule` is prefixed by the enclosing module, as it is
+    // by the compiler
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        elixir_module_name(node, source).map(str::to_string)
+    }
+
+    fn arity(&self, node: &Node) -> Option<usize> {
+        Some(beam::arity(node))
+    }
+
+    fn declared_returns(&self, _node: &Node, _source: &[u8]) -> Option<usize> {
+        Some(1)
+    }
+
+    // Modules, protocols, and implementations hold functions, like Ruby
+    // modules; the structs and exceptions defined in a module are its
+    // types
+    fn classify(&self, node: &Node, source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "call" => {
+                if let Some(kind) = elixir_definition(node, source) {
+                    return Declaration::new(kind, Function);
+                }
+                match elixir_call_name(node, source)? {
+                    "defmodule" => Declaration::new("module", KindOnly),
+                    "defprotocol" => Declaration::new("protocol", KindOnly),
+                    "defimpl" => Declaration::new("impl", KindOnly),
+                    "defstruct" => Declaration::new("struct", Type),
+                    "defexception" => Declaration::new("exception", Type),
+                    _ => None,
+                }
+            }
+            "anonymous_function" => Declaration::new("lambda", Function),
+            _ => None,
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "do_block"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        elixir_declaration(node, source)
+    }
+
+    // Clauses of `case`, `cond`, and `fn` hold their statements in a
+    // `body`
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        matches!(
+            parent_kind,
+            "source"
+                | "do_block"
+                | "body"
+                | "else_block"
+                | "rescue_block"
+                | "catch_block"
+                | "after_block"
+        ) && kind != "stab_clause"
+    }
+
+    // ExUnit requires `_test.exs`
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.ends_with("_test"))
+    }
+
+    fn node_stats(
+        &self,
+        node: &Node,
+        source: &[u8],
+        declaration: Option<Declaration>,
+        stats: &mut CodeStats,
+    ) {
+        if declaration.is_some_and(|declaration| declaration.tally == Tally::Function)
+            && is_genserver_callback(node, source, &SupportedLanguage::Elixir)
+        {
+            stats.record_kind("genserver_callback");
+        }
+    }
+}
+
+fn elixir_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    match elixir_call_name(node, source)? {
+        "defmodule" | "defprotocol" => {
+            // `@moduledoc` is the first statement of the module, by
+            // convention, but may be anywhere in its body
+            let mut cursor = node.walk();
+            let body = node
+                .named_children(&mut cursor)
+                .find(|child| child.kind() == "do_block");
+            let moduledoc = body.and_then(|body| {
+                let mut cursor = body.walk();
+                body.named_children(&mut cursor).find_map(|statement| {
+                    match elixir_attribute(&statement, source) {
+                        Some(("moduledoc", value)) => Some(value),
+                        _ => None,
+                    }
+                })
+            });
+            match moduledoc {
+                Some(value) if is_elixir_false(value, source) => None,
+                moduledoc => Some(moduledoc.is_some()),
+            }
+        }
+        "def" | "defmacro" | "defguard" => {
+            // Only the first clause of a function is documented
+            let name = beam::function_name(node, source)?;
+            let mut sibling = node.prev_named_sibling();
+            let mut doc = None;
+            while let Some(previous) = sibling {
+                if let Some((attribute, value)) = elixir_attribute(&previous, source) {
+                    if attribute == "doc" && doc.is_none() {
+                        doc = Some(value);
+                    }
+                } else if elixir_definition(&previous, source).is_some()
+                    && beam::function_name(&previous, source).as_ref() == Some(&name)
+                {
+                    return None;
+                } else if !is_comment(&previous) {
+                    break;
+                }
+                sibling = previous.prev_named_sibling();
+            }
+            match doc {
+                Some(value) if is_elixir_false(value, source) => None,
+                doc => Some(doc.is_some()),
+            }
+        }
+        _ => None,
+    }
+}
+
+/// Returns true for the clause of an Elixir `case`, `cond`, or `receive`
+/// that matches anything: `_ ->`, or `true ->` in a `cond`.
+fn is_catch_all_clause(clause: &Node, source: &[u8]) -> bool {
+    clause
+        .child_by_field_name("left")
+        .and_then(|patterns| patterns.utf8_text(source).ok())
+        .is_some_and(|pattern| matches!(pattern.trim(), "_" | "true"))
+}
+
+/// Returns true for the Elixir calls that open a control-flow block, such
+/// as `case` and `receive`.
+fn is_elixir_structure(node: &Node, source: &[u8]) -> bool {
+    matches!(
+        elixir_call_name(node, source),
+        Some("if" | "unless" | "case" | "cond" | "with" | "for" | "receive" | "try")
+    )
+}
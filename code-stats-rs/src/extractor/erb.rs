@@ -0,0 +1,15 @@
+//! The node kinds and hooks of the built-in ERB analysis.
+
+use crate::extractor::LanguageRules;
+use crate::parser::Declaration;
+use tree_sitter::Node;
+
+/// The built-in rules for ERB.
+pub(crate) struct Erb;
+
+impl LanguageRules for Erb {
+    // Templates are measured by their tags, see `templates`
+    fn classify(&self, _node: &Node, _source: &[u8]) -> Option<Declaration> {
+        None
+    }
+}
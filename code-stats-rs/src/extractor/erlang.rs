@@ -0,0 +1,137 @@
+//! The node kinds and hooks of the built-in Erlang analysis.
+
+use crate::beam;
+use crate::beam::is_genserver_callback;
+use crate::comments::preceding_comment;
+use crate::complexity::{Flow, binary_operator, operator_token};
+use crate::extractor::LanguageRules;
+use crate::language::SupportedLanguage;
+use crate::parser::CodeStats;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for Erlang.
+pub(crate) struct Erlang;
+
+impl LanguageRules for Erlang {
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(kind, "fun_decl" | "anonymous_fun")
+    }
+
+    // A function's clauses after the first are alternatives to it, like
+    // the clauses of a `case`
+    fn is_decision_point(&self, node: &Node, source: &[u8]) -> bool {
+        let kind = node.kind();
+        match kind {
+            "function_clause" | "fun_clause" => node
+                .prev_named_sibling()
+                .is_some_and(|previous| previous.kind() == kind),
+            "cr_clause" => node
+                .child_by_field_name("pat")
+                .and_then(|pattern| pattern.utf8_text(source).ok())
+                .is_none_or(|pattern| pattern.trim() != "_"),
+            // `true -> ...` is the default branch of an `if`
+            "if_clause" => node
+                .child_by_field_name("guard")
+                .and_then(|guard| guard.utf8_text(source).ok())
+                .is_none_or(|guard| guard.trim() != "true"),
+            "catch_clause" => true,
+            "binary_op_expr" => self.logical_operator(node).is_some(),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "case_expr" | "if_expr" | "receive_expr" | "try_expr" | "maybe_expr"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "case_expr" | "if_expr" | "receive_expr" | "catch_clause" => Flow::Structure,
+            "try_expr" | "maybe_expr" => Flow::Nest,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        if node.kind() == "binary_op_expr" {
+            operator_token(node)
+        } else {
+            binary_operator(node, "binary_expression", &["&&", "||"])
+        }
+    }
+
+    fn arity(&self, node: &Node) -> Option<usize> {
+        Some(beam::arity(node))
+    }
+
+    fn declared_returns(&self, _node: &Node, _source: &[u8]) -> Option<usize> {
+        Some(1)
+    }
+
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "fun_decl" => Declaration::new("function", Function),
+            "anonymous_fun" => Declaration::new("lambda", Function),
+            "record_decl" => Declaration::new("record", Type),
+            "module_attribute" => Declaration::new("module", KindOnly),
+            "type_alias" | "opaque" => Declaration::new("type", KindOnly),
+            // Preprocessor macros, `-define(TIMEOUT, 5000).`
+            "pp_define" => Declaration::new("macro", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "clause_body"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        erlang_declaration(node, source)
+    }
+
+    // Forms and the expressions of clause bodies
+    fn is_logical_line(&self, _node: &Node, parent: Option<Node>) -> bool {
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        matches!(parent_kind, "source_file" | "clause_body")
+    }
+
+    // EUnit modules and Common Test suites
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.ends_with("_tests") || stem.ends_with("_SUITE"))
+    }
+
+    fn node_stats(
+        &self,
+        node: &Node,
+        source: &[u8],
+        declaration: Option<Declaration>,
+        stats: &mut CodeStats,
+    ) {
+        if declaration.is_some_and(|declaration| declaration.tally == Tally::Function)
+            && is_genserver_callback(node, source, &SupportedLanguage::Erlang)
+        {
+            stats.record_kind("genserver_callback");
+        }
+    }
+}
+
+fn erlang_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    if node.kind() != "fun_decl" {
+        return None;
+    }
+    let root = node.parent()?;
+    if !beam::erlang_exports_all(&root, source) {
+        let name = beam::function_name(node, source)?;
+        if !beam::erlang_exports(&root, source).contains(&name) {
+            return None;
+        }
+    }
+
+    // `%% @doc` comments (EDoc) sit above the `-spec`
+    Some(preceding_comment(node, &["spec"]).is_some())
+}
@@ -0,0 +1,137 @@
+//! Rules for the grammars loaded at runtime, which only know the node kinds
+//! tree-sitter grammars commonly share.
+
+use crate::complexity::Flow;
+use crate::extractor::LanguageRules;
+use crate::logical::is_statement;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The rules of every grammar loaded at runtime.
+pub(crate) struct Generic;
+
+impl LanguageRules for Generic {
+    fn is_function_node(&self, kind: &str) -> bool {
+        is_generic_function(kind)
+    }
+
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_statement"
+                | "if_expression"
+                | "elseif_statement"
+                | "elseif_clause"
+                | "elif_clause"
+                | "elsif_clause"
+                | "else_if_clause"
+                | "for_statement"
+                | "for_expression"
+                | "for_in_statement"
+                | "while_statement"
+                | "while_expression"
+                | "do_statement"
+                | "repeat_statement"
+                | "case_clause"
+                | "switch_case"
+                | "match_arm"
+                | "catch_clause"
+                | "conditional_expression"
+                | "ternary_expression"
+        )
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        is_generic_structure(node.kind())
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        if is_generic_structure(node.kind()) {
+            Flow::Structure
+        } else {
+            Flow::Plain
+        }
+    }
+
+    // Grammars loaded at runtime are read by the node names most
+    // grammars share, see `is_generic_function`
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        let node_kind = node.kind();
+        if let Some(label) = generic_function_label(node_kind) {
+            return Declaration::new(label, Function);
+        }
+        let (subject, suffix) = node_kind.rsplit_once('_')?;
+        if !matches!(suffix, "definition" | "declaration" | "item" | "specifier") {
+            return None;
+        }
+        match subject {
+            "class" => Declaration::new("class", Type),
+            "struct" => Declaration::new("struct", Type),
+            "enum" => Declaration::new("enum", Type),
+            "interface" => Declaration::new("interface", KindOnly),
+            "trait" => Declaration::new("trait", KindOnly),
+            "module" => Declaration::new("module", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        matches!(kind, "block" | "compound_statement" | "statement_block")
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        is_statement(kind, parent_kind)
+    }
+
+    // No naming convention is known for these grammars, so only the files in
+    // test directories are recognized
+    fn is_test_name(&self, _name: &str, _stem: &str) -> Option<bool> {
+        Some(false)
+    }
+}
+
+/// Returns true for function nodes of a grammar loaded at runtime, going by
+/// the naming most grammars share: `function_definition`,
+/// `method_declaration`, `function_item`, and the like.
+fn is_generic_function(kind: &str) -> bool {
+    generic_function_label(kind).is_some()
+}
+
+/// Returns the breakdown label of a function node of a grammar loaded at
+/// runtime (`function`, `method`, or `constructor`), see `is_generic_function`.
+fn generic_function_label(kind: &str) -> Option<&'static str> {
+    let (subject, suffix) = kind.rsplit_once('_')?;
+    if !matches!(suffix, "definition" | "declaration" | "item") {
+        return None;
+    }
+    match subject {
+        "function" => Some("function"),
+        "method" => Some("method"),
+        "constructor" => Some("constructor"),
+        _ => None,
+    }
+}
+
+/// Returns true for the control-flow structures of a grammar loaded at
+/// runtime, which nest and add to the cognitive complexity.
+fn is_generic_structure(kind: &str) -> bool {
+    matches!(
+        kind,
+        "if_statement"
+            | "if_expression"
+            | "for_statement"
+            | "for_expression"
+            | "for_in_statement"
+            | "while_statement"
+            | "while_expression"
+            | "do_statement"
+            | "repeat_statement"
+            | "switch_statement"
+            | "case_statement"
+            | "match_expression"
+            | "try_statement"
+    )
+}
@@ -0,0 +1,236 @@
+//! The node kinds and hooks of the built-in Go analysis.
+
+use crate::comments::preceding_comment;
+use crate::complexity::{Flow, has_operator};
+use crate::extractor::LanguageRules;
+use crate::golang::go_stats;
+use crate::imports::{Index, unquote};
+use crate::language::SupportedLanguage;
+use crate::logical::is_statement;
+use crate::members::{Members, named};
+use crate::parser::CodeStats;
+use crate::parser::{Declaration, Tally};
+use crate::signature::parameter_weight;
+use tree_sitter::Node;
+
+/// The built-in rules for Go.
+pub(crate) struct Go;
+
+impl LanguageRules for Go {
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(kind, "function_declaration" | "method_declaration")
+    }
+
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        match node.kind() {
+            "if_statement" | "for_statement" | "expression_case" | "type_case"
+            | "communication_case" => true,
+            "binary_expression" => has_operator(node, &["&&", "||"]),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_statement"
+                | "for_statement"
+                | "expression_switch_statement"
+                | "type_switch_statement"
+                | "select_statement"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "for_statement"
+            | "expression_switch_statement"
+            | "type_switch_statement"
+            | "select_statement" => Flow::Structure,
+            "func_literal" => Flow::Nest,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn is_labeled_jump(&self, node: &Node) -> bool {
+        let kind = node.kind();
+        let has_child = |label: &str| {
+            let mut cursor = node.walk();
+            node.named_children(&mut cursor)
+                .any(|child| child.kind() == label)
+        };
+        kind == "goto_statement"
+            || (matches!(kind, "break_statement" | "continue_statement") && has_child("label_name"))
+    }
+
+    fn declared_returns(&self, node: &Node, source: &[u8]) -> Option<usize> {
+        let language = &SupportedLanguage::Go;
+        Some(node.child_by_field_name("result").map_or(0, |result| {
+            if result.kind() == "parameter_list" {
+                let mut cursor = result.walk();
+                result
+                    .named_children(&mut cursor)
+                    .map(|value| parameter_weight(&value, source, language))
+                    .sum()
+            } else {
+                1
+            }
+        }))
+    }
+
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, Type};
+        match node.kind() {
+            "function_declaration" => Declaration::new("function", Function),
+            "method_declaration" => Declaration::new("method", Function),
+            // Go uses type_spec for type declarations, but we only want to count structs.
+            // A type_spec node has a "type" field that contains the actual type definition.
+            // We need to check if this type is specifically a struct_type, not an interface,
+            // type alias, or other type declaration.
+            "type_spec"
+                if node
+                    .child_by_field_name("type")
+                    .is_some_and(|type_node| type_node.kind() == "struct_type") =>
+            {
+                Declaration::new("struct", Type)
+            }
+            _ => None,
+        }
+    }
+
+    fn has_switches(&self) -> bool {
+        true
+    }
+
+    fn switch_kind(&self, node: &Node) -> Option<&'static str> {
+        match node.kind() {
+            "expression_switch_statement" | "type_switch_statement" => Some("switch"),
+            "select_statement" => Some("select"),
+            _ => None,
+        }
+    }
+
+    fn is_switch_arm(&self, node: &Node) -> bool {
+        matches!(
+            node.kind(),
+            "expression_case" | "type_case" | "communication_case" | "default_case"
+        )
+    }
+
+    fn is_default_arm(&self, arm: &Node, _source: &[u8]) -> bool {
+        arm.kind() == "default_case"
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "block"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        go_declaration(node, source)
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        is_statement(kind, parent_kind)
+    }
+
+    fn is_test_name(&self, name: &str, _stem: &str) -> Option<bool> {
+        Some(name.ends_with("_test.go"))
+    }
+
+    fn type_members(&self, node: &Node, _source: &[u8]) -> Members {
+        go_members(node)
+    }
+
+    fn collect_imports(
+        &self,
+        node: &Node,
+        source: &[u8],
+        _inline_modules: &mut usize,
+        found: &mut Vec<String>,
+    ) {
+        let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+        let field = |name: &str| node.child_by_field_name(name);
+        if node.kind() == "import_spec" {
+            found.extend(field("path").map(|path| unquote(&text(&path))));
+        }
+    }
+
+    fn resolve_import(&self, index: &Index, _relative: &str, spec: &str) -> (String, bool) {
+        let internal = |name: String| (name, true);
+        let external = |name: &str| (name.to_string(), false);
+        if let Some(module) = &index.go_module {
+            if spec == module {
+                return internal(".".to_string());
+            }
+            if let Some(package) = spec
+                .strip_prefix(module.as_str())
+                .and_then(|rest| rest.strip_prefix('/'))
+            {
+                return internal(package.to_string());
+            }
+            return external(spec);
+        }
+        index
+            .go_packages
+            .iter()
+            .filter(|package| {
+                *package != "." && (spec == *package || spec.ends_with(&format!("/{package}")))
+            })
+            .max_by_key(|package| package.len())
+            .map_or_else(|| external(spec), |package| internal(package.clone()))
+    }
+
+    fn file_stats(&self, root: &Node, source: &[u8], stats: &mut CodeStats) {
+        stats.go = Some(go_stats(root, source));
+    }
+}
+
+fn go_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    if !matches!(
+        node.kind(),
+        "function_declaration" | "method_declaration" | "type_spec" | "type_alias"
+    ) {
+        return None;
+    }
+
+    let name = node.child_by_field_name("name")?.utf8_text(source).ok()?;
+    if !name.starts_with(|c: char| c.is_uppercase()) {
+        return None;
+    }
+
+    // `type Foo struct{}` is documented above the `type` keyword, while each
+    // spec of a grouped `type ( ... )` declaration has its own comment
+    let documented = preceding_comment(node, &[]).is_some()
+        || node
+            .parent()
+            .filter(|parent| parent.kind() == "type_declaration")
+            .is_some_and(|parent| preceding_comment(&parent, &[]).is_some());
+    Some(documented)
+}
+
+/// Counts the fields of a Go struct; a field without a name is an embedded
+/// type, which is a base.
+fn go_members(node: &Node) -> Members {
+    let mut members = Members::default();
+    let Some(structure) = node.child_by_field_name("type") else {
+        return members;
+    };
+    let declarations = named(&structure)
+        .into_iter()
+        .filter(|child| child.kind() == "field_declaration_list")
+        .flat_map(|list| named(&list))
+        .filter(|child| child.kind() == "field_declaration");
+    for declaration in declarations {
+        let mut cursor = declaration.walk();
+        match declaration
+            .children_by_field_name("name", &mut cursor)
+            .count()
+        {
+            0 => members.bases += 1,
+            names => members.fields += names,
+        }
+    }
+    members
+}
@@ -0,0 +1,15 @@
+//! The node kinds and hooks of the built-in Go template analysis.
+
+use crate::extractor::LanguageRules;
+use crate::parser::Declaration;
+use tree_sitter::Node;
+
+/// The built-in rules for Go template.
+pub(crate) struct GoTemplate;
+
+impl LanguageRules for GoTemplate {
+    // Templates are measured by their tags, see `templates`
+    fn classify(&self, _node: &Node, _source: &[u8]) -> Option<Declaration> {
+        None
+    }
+}
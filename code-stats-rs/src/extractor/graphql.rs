@@ -0,0 +1,128 @@
+//! The node kinds and hooks of the built-in GraphQL analysis.
+
+use crate::comments::preceding_comment;
+use crate::complexity::Flow;
+use crate::extractor::LanguageRules;
+use crate::graphql::{self, graphql_name, is_conditional_directive, operation_type, type_keyword};
+use crate::members::Members;
+use crate::parser::CodeStats;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for GraphQL.
+pub(crate) struct Graphql;
+
+impl LanguageRules for Graphql {
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(kind, "operation_definition" | "fragment_definition")
+    }
+
+    // Selections with `@include(if: $flag)` or `@skip(if: $flag)`
+    fn is_decision_point(&self, node: &Node, source: &[u8]) -> bool {
+        is_conditional_directive(node, source)
+    }
+
+    // The directive is a child of the selection it applies to, so nothing
+    // nests in it
+    fn flow(&self, node: &Node, source: &[u8]) -> Flow {
+        if is_conditional_directive(node, source) {
+            Flow::Break
+        } else {
+            Flow::Plain
+        }
+    }
+
+    // Type definitions are named by their `name` child
+    fn type_name<'a>(&self, node: &Node, source: &'a [u8]) -> Option<&'a str> {
+        node.child_by_field_name("name")
+            .or_else(|| graphql_name(node))?
+            .utf8_text(source)
+            .ok()
+    }
+
+    fn arity(&self, node: &Node) -> Option<usize> {
+        Some(graphql::variable_count(node))
+    }
+
+    // Operations and fragments are a document's functions, and their
+    // variables its parameters
+    fn classify(&self, node: &Node, source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "operation_definition" => Declaration::new(operation_type(node, source), Function),
+            "fragment_definition" => Declaration::new("fragment", Function),
+            kind if type_keyword(kind).is_some() => Declaration::new(type_keyword(kind)?, Type),
+            kind if kind.ends_with("_type_extension") => Declaration::new("extension", KindOnly),
+            "field_definition" => Declaration::new("field", KindOnly),
+            "directive_definition" => Declaration::new("directive", KindOnly),
+            _ => None,
+        }
+    }
+
+    // Operations copied with a different name repeat their selections
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "selection_set"
+    }
+
+    fn public_declaration(&self, node: &Node, _source: &[u8]) -> Option<bool> {
+        graphql_declaration(node)
+    }
+
+    // Definitions and their fields, values, and selections; a selection's
+    // arguments and directives are part of it
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        matches!(
+            kind,
+            "schema_definition"
+                | "root_operation_type_definition"
+                | "object_type_definition"
+                | "interface_type_definition"
+                | "union_type_definition"
+                | "enum_type_definition"
+                | "input_object_type_definition"
+                | "scalar_type_definition"
+                | "directive_definition"
+                | "schema_extension"
+                | "field_definition"
+                | "enum_value_definition"
+                | "operation_definition"
+                | "fragment_definition"
+                | "field"
+                | "fragment_spread"
+                | "inline_fragment"
+        ) || kind.ends_with("_type_extension")
+            || (kind == "input_value_definition" && parent_kind == "input_fields_definition")
+    }
+
+    fn type_members(&self, node: &Node, source: &[u8]) -> Members {
+        let (fields, bases) = graphql::type_members(node, source);
+        Members { fields, bases }
+    }
+
+    fn file_stats(&self, root: &Node, source: &[u8], stats: &mut CodeStats) {
+        let (graphql, schema) = graphql::graphql_stats(root, source);
+        stats.graphql = Some(graphql);
+        stats.schema = schema;
+    }
+}
+
+/// Type definitions and their fields are the schema's API, documented by a
+/// description string (`"A shopping cart."`) or a `#` comment above them.
+fn graphql_declaration(node: &Node) -> Option<bool> {
+    let is_type = graphql::type_keyword(node.kind()).is_some();
+    let is_field = node.kind() == "field_definition"
+        || (node.kind() == "input_value_definition"
+            && node
+                .parent()
+                .is_some_and(|parent| parent.kind() == "input_fields_definition"));
+    if !is_type && !is_field {
+        return None;
+    }
+    let mut cursor = node.walk();
+    let described = node
+        .named_children(&mut cursor)
+        .any(|child| child.kind() == "description");
+    Some(described || preceding_comment(node, &[]).is_some())
+}
@@ -0,0 +1,181 @@
+//! The node kinds and hooks of the built-in Groovy analysis.
+
+use crate::comments::{is_jsdoc, preceding_comment};
+use crate::complexity::{Flow, binary_operator, has_operator};
+use crate::extractor::LanguageRules;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for Groovy.
+pub(crate) struct Groovy;
+
+impl LanguageRules for Groovy {
+    // Closures nest like Ruby blocks instead, see `flow`
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(kind, "function_definition" | "function_declaration")
+    }
+
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        match node.kind() {
+            "if_statement" | "for_loop" | "for_in_loop" | "while_loop" | "do_while_loop"
+            | "case" | "catch_clause" | "ternary_op" => true,
+            "binary_op" => has_operator(node, &["&&", "||", "?:"]),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_statement"
+                | "for_loop"
+                | "for_in_loop"
+                | "while_loop"
+                | "do_while_loop"
+                | "switch_statement"
+                | "try_statement"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "for_loop" | "for_in_loop" | "while_loop" | "do_while_loop" | "switch_statement"
+            | "catch_clause" | "ternary_op" => Flow::Structure,
+            "closure" if !is_body(node) => Flow::Nest,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        binary_operator(node, "binary_op", &["&&", "||", "?:"])
+    }
+
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+        match node.kind() {
+            "class_definition"
+            | "interface_definition"
+            | "enum_definition"
+            | "trait_definition" => node.child_by_field_name("name").and_then(text),
+            _ => None,
+        }
+    }
+
+    fn is_return(&self, node: &Node) -> bool {
+        matches!(node.kind(), "return" | "return_statement")
+    }
+
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "function_definition" | "function_declaration" if is_groovy_member(node) => {
+                Declaration::new("method", Function)
+            }
+            "function_definition" | "function_declaration" => {
+                Declaration::new("function", Function)
+            }
+            // Closures are everywhere in Gradle and Jenkins DSLs, so like
+            // Ruby blocks they are only listed in the breakdown
+            "closure" if !is_groovy_body(node) => Declaration::new("closure", KindOnly),
+            "class_definition" => Declaration::new("class", Type),
+            "interface_definition" => Declaration::new("interface", Type),
+            "enum_definition" => Declaration::new("enum", Type),
+            "trait_definition" => Declaration::new("trait", Type),
+            _ => None,
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "closure"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        groovy_declaration(node, source)
+    }
+
+    // Class, function, and loop bodies are closures as well
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        matches!(parent_kind, "source_file" | "closure")
+            && !matches!(kind, "closure" | "parameter_list")
+    }
+
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.ends_with("Test") || stem.ends_with("Tests") || stem.ends_with("Spec"))
+    }
+}
+
+fn groovy_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    let is_type = matches!(
+        node.kind(),
+        "class_definition" | "interface_definition" | "enum_definition" | "trait_definition"
+    );
+    // Functions of a script are not API, the methods of its classes are
+    let is_method = matches!(node.kind(), "function_definition" | "function_declaration")
+        && node.parent().is_some_and(|body| {
+            body.parent().is_some_and(|declaration| {
+                matches!(
+                    declaration.kind(),
+                    "class_definition"
+                        | "interface_definition"
+                        | "enum_definition"
+                        | "trait_definition"
+                )
+            })
+        });
+    if !is_type && !is_method {
+        return None;
+    }
+
+    let mut cursor = node.walk();
+    let is_hidden = node.children(&mut cursor).any(|child| {
+        child.kind() == "access_modifier"
+            && child
+                .utf8_text(source)
+                .is_ok_and(|text| matches!(text, "private" | "protected"))
+    });
+    if is_hidden {
+        return None;
+    }
+
+    Some(is_jsdoc(preceding_comment(node, &[]), source))
+}
+
+/// Returns true if `node` is the `body` of its parent, as the closures that
+/// make up Groovy class, function, and loop bodies are.
+fn is_body(node: &Node) -> bool {
+    node.parent().is_some_and(|parent| {
+        parent
+            .child_by_field_name("body")
+            .is_some_and(|body| body.id() == node.id())
+    })
+}
+
+/// Returns true if a Groovy closure node is the body of a declaration or
+/// statement, as class, function, and loop bodies are, rather than a closure
+/// value.
+fn is_groovy_body(node: &Node) -> bool {
+    node.parent().is_some_and(|parent| {
+        parent
+            .child_by_field_name("body")
+            .is_some_and(|body| body.id() == node.id())
+    })
+}
+
+/// Returns true if a Groovy function is declared in a class, interface,
+/// enum, or trait rather than at the top of a script.
+fn is_groovy_member(node: &Node) -> bool {
+    let mut parent = node.parent();
+    while let Some(ancestor) = parent {
+        match ancestor.kind() {
+            "class_definition"
+            | "interface_definition"
+            | "enum_definition"
+            | "trait_definition" => return true,
+            "function_definition" => return false,
+            _ => parent = ancestor.parent(),
+        }
+    }
+    false
+}
@@ -0,0 +1,178 @@
+//! The node kinds and hooks of the built-in Haskell analysis.
+
+use crate::comments::last_row;
+use crate::complexity::Flow;
+use crate::extractor::LanguageRules;
+use crate::functional::{self, is_binding_function, is_lambda};
+use crate::language::SupportedLanguage;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for Haskell.
+pub(crate) struct Haskell;
+
+impl LanguageRules for Haskell {
+    fn is_function(&self, node: &Node, _source: &[u8]) -> bool {
+        let language = &SupportedLanguage::Haskell;
+        is_binding_function(node, language) || is_lambda(node, language)
+    }
+
+    // Bindings are functions depending on their place, see `is_function`
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(kind, "function" | "lambda" | "lambda_case")
+    }
+
+    // Pattern matches stand in for branches: every alternative of a
+    // `case` and every guard of an equation after the first is a path of
+    // its own, like each arm of an `if`
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        let kind = node.kind();
+        match kind {
+            "conditional" => true,
+            "alternative" | "match" => node
+                .prev_named_sibling()
+                .is_some_and(|previous| previous.kind() == kind),
+            _ => false,
+        }
+    }
+
+    // The `if` in `else if` continues the chain, see `is_haskell_else_if`
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        let kind = node.kind();
+        matches!(kind, "case" | "lambda_case" | "multi_way_if")
+            || (kind == "conditional" && !is_haskell_else_if(node))
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "conditional" if is_haskell_else_if(node) => Flow::Branch,
+            "case" | "lambda_case" | "multi_way_if" | "conditional" => Flow::Structure,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn arity(&self, node: &Node) -> Option<usize> {
+        Some(functional::arity(node))
+    }
+
+    fn declared_returns(&self, _node: &Node, _source: &[u8]) -> Option<usize> {
+        Some(1)
+    }
+
+    // Type classes and instances hold methods, like Rust traits and impl
+    // blocks; the data types declared with `data` and `newtype` are the
+    // types
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        let language = &SupportedLanguage::Haskell;
+        use Tally::{Function, KindOnly, Type};
+        let node_kind = node.kind();
+        match node_kind {
+            "function" | "bind" if is_binding_function(node, language) => {
+                let in_class = node.parent().is_some_and(|parent| {
+                    matches!(
+                        parent.kind(),
+                        "class_declarations" | "instance_declarations"
+                    )
+                });
+                match (in_class, node_kind) {
+                    (true, _) => Declaration::new("method", Function),
+                    (false, "function") => Declaration::new("function", Function),
+                    (false, _) => Declaration::new("binding", Function),
+                }
+            }
+            "lambda" | "lambda_case" => Declaration::new("lambda", Function),
+            "data_type" => Declaration::new("data", Type),
+            "newtype" => Declaration::new("newtype", Type),
+            "type_synomym" => Declaration::new("type_synonym", KindOnly),
+            "type_family" | "data_family" => Declaration::new("type_family", KindOnly),
+            "class" => Declaration::new("class", KindOnly),
+            "instance" | "deriving_instance" => Declaration::new("instance", KindOnly),
+            "header" => Declaration::new("module", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        matches!(kind, "do" | "alternatives")
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        haskell_declaration(node, source)
+    }
+
+    // Declarations, `do` statements, and `case` alternatives
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        matches!(
+            parent_kind,
+            "imports"
+                | "declarations"
+                | "class_declarations"
+                | "instance_declarations"
+                | "local_binds"
+                | "do"
+                | "alternatives"
+        ) && kind != "haddock"
+    }
+
+    // Hspec discovers `*Spec.hs` modules
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.ends_with("Spec") || stem.ends_with("Test"))
+    }
+}
+
+fn haskell_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    if !matches!(
+        node.kind(),
+        "function" | "bind" | "data_type" | "newtype" | "type_synomym" | "class"
+    ) {
+        return None;
+    }
+    let declarations = node
+        .parent()
+        .filter(|parent| parent.kind() == "declarations")?;
+    let name = node.child_by_field_name("name")?.utf8_text(source).ok()?;
+    if let Some(exports) = declarations
+        .parent()
+        .and_then(|root| functional::haskell_exports(&root, source))
+        && !exports.iter().any(|export| export == name)
+    {
+        return None;
+    }
+
+    // Only the first equation of a function is documented, above its type
+    // signature
+    let mut sibling = node.prev_named_sibling();
+    let mut next_row = node.start_position().row;
+    while let Some(previous) = sibling {
+        let same_function = matches!(previous.kind(), "function" | "bind" | "signature")
+            && previous
+                .child_by_field_name("name")
+                .and_then(|previous| previous.utf8_text(source).ok())
+                == Some(name);
+        if !same_function {
+            break;
+        }
+        if previous.kind() != "signature" {
+            return None;
+        }
+        next_row = previous.start_position().row;
+        sibling = previous.prev_named_sibling();
+    }
+    let documented = sibling
+        .is_some_and(|comment| comment.kind() == "haddock" && last_row(&comment) + 1 == next_row);
+    Some(documented)
+}
+
+/// Returns true if `node` is the `if` of a Haskell `else if`: a
+/// `conditional` in the `else` field of another.
+fn is_haskell_else_if(node: &Node) -> bool {
+    node.kind() == "conditional"
+        && node.parent().is_some_and(|parent| {
+            parent.kind() == "conditional"
+                && parent
+                    .child_by_field_name("else")
+                    .is_some_and(|alternative| alternative.id() == node.id())
+        })
+}
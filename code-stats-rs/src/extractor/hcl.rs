@@ -0,0 +1,74 @@
+//! The node kinds and hooks of the built-in HCL analysis.
+//!
+//! Terraform files have no functions; they are measured by their blocks.
+
+use crate::extractor::LanguageRules;
+use crate::parser::CodeStats;
+use crate::parser::{Declaration, Tally};
+use crate::terraform;
+use tree_sitter::Node;
+
+/// The built-in rules for HCL.
+pub(crate) struct Hcl;
+
+impl LanguageRules for Hcl {
+    // Resources and the other top-level blocks are reported in the
+    // breakdown only, as infrastructure has neither functions nor types
+    fn classify(&self, node: &Node, source: &[u8]) -> Option<Declaration> {
+        use Tally::KindOnly;
+        match node.kind() {
+            "block" if terraform::is_top_level(node) => {
+                match terraform::block_type(node, source)? {
+                    "resource" => Declaration::new("resource", KindOnly),
+                    "data" => Declaration::new("data", KindOnly),
+                    "module" => Declaration::new("module", KindOnly),
+                    "variable" => Declaration::new("variable", KindOnly),
+                    "output" => Declaration::new("output", KindOnly),
+                    "locals" => Declaration::new("locals", KindOnly),
+                    "provider" => Declaration::new("provider", KindOnly),
+                    _ => None,
+                }
+            }
+            _ => None,
+        }
+    }
+
+    // Resources copied for another environment or region
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "block"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        terraform_declaration(node, source)
+    }
+
+    // Blocks and their arguments, nested blocks included
+    fn is_logical_line(&self, node: &Node, _parent: Option<Node>) -> bool {
+        matches!(node.kind(), "block" | "attribute")
+    }
+
+    // `terraform test` runs `.tftest.hcl` files
+    fn is_test_name(&self, name: &str, _stem: &str) -> Option<bool> {
+        Some(name.ends_with(".tftest.hcl"))
+    }
+
+    fn file_stats(&self, root: &Node, source: &[u8], stats: &mut CodeStats) {
+        stats.terraform = Some(terraform::terraform_stats(root, source));
+    }
+}
+
+/// Variables and outputs are a module's interface, documented by their
+/// `description` argument, which `terraform-docs` and the registry show.
+fn terraform_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    if node.kind() != "block" || !terraform::is_top_level(node) {
+        return None;
+    }
+    if !matches!(
+        terraform::block_type(node, source),
+        Some("variable" | "output")
+    ) {
+        return None;
+    }
+    let description = terraform::argument(node, source, "description");
+    Some(description.is_some_and(|text| !text.trim_matches('"').trim().is_empty()))
+}
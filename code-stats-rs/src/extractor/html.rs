@@ -0,0 +1,22 @@
+//! The node kinds and hooks of the built-in HTML analysis.
+
+use crate::extractor::LanguageRules;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for HTML.
+pub(crate) struct Html;
+
+impl LanguageRules for Html {
+    // HTML is measured by its elements, see `web`; the inline scripts and
+    // styles, and the sections of components, are analyzed in their own
+    // languages
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::KindOnly;
+        match node.kind() {
+            "script_element" => Declaration::new("script", KindOnly),
+            "style_element" => Declaration::new("style", KindOnly),
+            _ => None,
+        }
+    }
+}
@@ -0,0 +1,288 @@
+//! The node kinds and hooks of the built-in Java analysis.
+
+use crate::comments::{is_jsdoc, preceding_comment};
+use crate::complexity::{Flow, has_operator};
+use crate::extractor::LanguageRules;
+use crate::imports::Index;
+use crate::logical::is_statement;
+use crate::members::{Members, body_children, declarator_count, named};
+use crate::parser::CodeStats;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for Java.
+pub(crate) struct Java;
+
+impl LanguageRules for Java {
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(
+            kind,
+            "method_declaration" | "constructor_declaration" | "compact_constructor_declaration"
+        )
+    }
+
+    fn is_decision_point(&self, node: &Node, source: &[u8]) -> bool {
+        match node.kind() {
+            "if_statement"
+            | "for_statement"
+            | "enhanced_for_statement"
+            | "while_statement"
+            | "do_statement"
+            | "catch_clause"
+            | "ternary_expression" => true,
+            // `switch_label` covers both `case X:` and `default:`
+            "switch_label" => node
+                .utf8_text(source)
+                .is_ok_and(|label| label.trim_start().starts_with("case")),
+            "binary_expression" => has_operator(node, &["&&", "||"]),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_statement"
+                | "for_statement"
+                | "enhanced_for_statement"
+                | "while_statement"
+                | "do_statement"
+                | "switch_expression"
+                | "try_statement"
+                | "try_with_resources_statement"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "for_statement"
+            | "enhanced_for_statement"
+            | "while_statement"
+            | "do_statement"
+            | "switch_expression"
+            | "catch_clause"
+            | "ternary_expression" => Flow::Structure,
+            "lambda_expression" => Flow::Nest,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn is_labeled_jump(&self, node: &Node) -> bool {
+        let kind = node.kind();
+        let has_child = |label: &str| {
+            let mut cursor = node.walk();
+            node.named_children(&mut cursor)
+                .any(|child| child.kind() == label)
+        };
+        matches!(kind, "break_statement" | "continue_statement") && has_child("identifier")
+    }
+
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+        match node.kind() {
+            "class_declaration"
+            | "interface_declaration"
+            | "enum_declaration"
+            | "record_declaration" => node.child_by_field_name("name").and_then(text),
+            _ => None,
+        }
+    }
+
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "method_declaration" => Declaration::new("method", Function),
+            // Records may declare a compact constructor without a parameter list
+            "constructor_declaration" | "compact_constructor_declaration" => {
+                Declaration::new("constructor", Function)
+            }
+            "class_declaration" => Declaration::new("class", Type),
+            "interface_declaration" => Declaration::new("interface", Type),
+            "enum_declaration" => Declaration::new("enum", Type),
+            "record_declaration" => Declaration::new("record", Type),
+            // `@interface` declarations and annotation uses, in the breakdown only
+            "annotation_type_declaration" => Declaration::new("annotation_type", KindOnly),
+            "annotation" | "marker_annotation" => Declaration::new("annotation", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn has_switches(&self) -> bool {
+        true
+    }
+
+    fn switch_kind(&self, node: &Node) -> Option<&'static str> {
+        (node.kind() == "switch_expression").then_some("switch")
+    }
+
+    fn is_switch_arm(&self, node: &Node) -> bool {
+        matches!(node.kind(), "switch_block_statement_group" | "switch_rule")
+    }
+
+    // `switch_label` covers both `case X:` and `default:`
+    fn is_default_arm(&self, arm: &Node, source: &[u8]) -> bool {
+        let mut cursor = arm.walk();
+        arm.named_children(&mut cursor).any(|child| {
+            child.kind() == "switch_label"
+                && child
+                    .utf8_text(source)
+                    .is_ok_and(|label| label.trim_start().starts_with("default"))
+        })
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        matches!(kind, "block" | "constructor_body")
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        java_declaration(node, source)
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        is_statement(kind, parent_kind)
+    }
+
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.ends_with("Test") || stem.ends_with("Tests") || stem.ends_with("Spec"))
+    }
+
+    fn type_members(&self, node: &Node, _source: &[u8]) -> Members {
+        java_members(node)
+    }
+
+    fn collect_imports(
+        &self,
+        node: &Node,
+        source: &[u8],
+        _inline_modules: &mut usize,
+        found: &mut Vec<String>,
+    ) {
+        let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+        if node.kind() == "import_declaration" {
+            let declaration = text(node);
+            let name = declaration
+                .trim_start_matches("import")
+                .trim()
+                .trim_start_matches("static ")
+                .trim_end_matches(';');
+            found.push(name.split_whitespace().collect());
+        }
+    }
+
+    fn resolve_import(&self, index: &Index, _relative: &str, spec: &str) -> (String, bool) {
+        let internal = |name: String| (name, true);
+        let external = |name: &str| (name.to_string(), false);
+        let segments: Vec<&str> = spec.split('.').collect();
+        if segments.last() != Some(&"*") {
+            for end in (2..=segments.len()).rev() {
+                if let Some(path) =
+                    index.by_suffix(&segments[..end].join("/"), &["java", "kt", "kts"])
+                {
+                    return internal(path);
+                }
+            }
+        }
+        let package: Vec<&str> = segments
+            .iter()
+            .take_while(|segment| !segment.starts_with(char::is_uppercase) && **segment != "*")
+            .copied()
+            .collect();
+        external(&package.join("."))
+    }
+
+    fn file_stats(&self, root: &Node, _source: &[u8], stats: &mut CodeStats) {
+        stats.max_type_depth = java_type_depth(root);
+    }
+}
+
+fn java_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    if !matches!(
+        node.kind(),
+        "class_declaration"
+            | "interface_declaration"
+            | "enum_declaration"
+            | "record_declaration"
+            | "method_declaration"
+            | "constructor_declaration"
+    ) {
+        return None;
+    }
+
+    let mut cursor = node.walk();
+    let is_public = node
+        .children(&mut cursor)
+        .find(|child| child.kind() == "modifiers")
+        .and_then(|modifiers| modifiers.utf8_text(source).ok())
+        .is_some_and(|text| text.split_whitespace().any(|word| word == "public"));
+    if !is_public {
+        return None;
+    }
+
+    Some(is_jsdoc(preceding_comment(node, &[]), source))
+}
+
+/// Counts the fields, record components, superclass, and interfaces of a
+/// Java type.
+fn java_members(node: &Node) -> Members {
+    let mut body = body_children(node, "body");
+    // An enum's fields follow its constants
+    let enum_declarations: Vec<Node> = body
+        .iter()
+        .filter(|child| child.kind() == "enum_body_declarations")
+        .flat_map(named)
+        .collect();
+    body.extend(enum_declarations);
+    let fields = body
+        .iter()
+        .filter(|child| matches!(child.kind(), "field_declaration" | "constant_declaration"))
+        .map(declarator_count)
+        .sum::<usize>()
+        + node
+            .child_by_field_name("parameters")
+            .map(|components| named(&components).len())
+            .unwrap_or(0);
+
+    let bases = named(node)
+        .iter()
+        .map(|child| match child.kind() {
+            "superclass" => 1,
+            "super_interfaces" | "extends_interfaces" => named(child)
+                .iter()
+                .filter(|list| list.kind() == "type_list")
+                .map(|list| named(list).len())
+                .sum(),
+            _ => 0,
+        })
+        .sum();
+    Members { fields, bases }
+}
+
+/// Returns the deepest nesting of Java type declarations below `node`.
+///
+/// Inner classes, nested enums and records, and anonymous class bodies
+/// (`new Runnable() { ... }`) all add a level.
+fn java_type_depth(node: &Node) -> usize {
+    let level = usize::from(
+        matches!(
+            node.kind(),
+            "class_declaration"
+                | "interface_declaration"
+                | "enum_declaration"
+                | "record_declaration"
+                | "annotation_type_declaration"
+        ) || (node.kind() == "class_body"
+            && node
+                .parent()
+                .is_some_and(|parent| parent.kind() == "object_creation_expression")),
+    );
+
+    let mut cursor = node.walk();
+    let deepest = node
+        .children(&mut cursor)
+        .map(|child| java_type_depth(&child))
+        .max()
+        .unwrap_or(0);
+    level + deepest
+}
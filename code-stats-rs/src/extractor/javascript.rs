@@ -0,0 +1,202 @@
+//! The node kinds and hooks of the built-in JavaScript analysis.
+
+use crate::comments::js_declaration;
+use crate::complexity::{Flow, binary_operator, has_operator};
+use crate::extractor::LanguageRules;
+use crate::imports::{Index, SCRIPT_EXTENSIONS, join, normalize, parent, string_argument, unquote};
+use crate::language::SupportedLanguage;
+use crate::logical::is_statement;
+use crate::members::{Members, assigned_names, body_children, js_heritage_count, named};
+use crate::parser::{Declaration, Tally};
+use crate::signature::function_name;
+use tree_sitter::Node;
+
+/// The built-in rules for JavaScript.
+pub(crate) struct JavaScript;
+
+impl LanguageRules for JavaScript {
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(
+            kind,
+            "function_declaration" | "function_expression" | "arrow_function" | "method_definition"
+        )
+    }
+
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        match node.kind() {
+            "if_statement" | "for_statement" | "for_in_statement" | "while_statement"
+            | "do_statement" | "switch_case" | "catch_clause" | "ternary_expression" => true,
+            "binary_expression" => has_operator(node, &["&&", "||", "??"]),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_statement"
+                | "for_statement"
+                | "for_in_statement"
+                | "while_statement"
+                | "do_statement"
+                | "switch_statement"
+                | "try_statement"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "for_statement" | "for_in_statement" | "while_statement" | "do_statement"
+            | "switch_statement" | "catch_clause" | "ternary_expression" => Flow::Structure,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn is_labeled_jump(&self, node: &Node) -> bool {
+        matches!(node.kind(), "break_statement" | "continue_statement")
+            && node.child_by_field_name("label").is_some()
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        binary_operator(node, "binary_expression", &["&&", "||", "??"])
+    }
+
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        match node.kind() {
+            // Class expressions take the name of the variable they are assigned to
+            "class_declaration" | "abstract_class_declaration" | "class" => {
+                let name = function_name(node, source);
+                (name != "<anonymous>").then_some(name)
+            }
+            _ => None,
+        }
+    }
+
+    fn has_expression_body(&self, node: &Node) -> bool {
+        node.kind() == "arrow_function"
+            && node
+                .child_by_field_name("body")
+                .is_some_and(|body| body.kind() != "statement_block")
+    }
+
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "function_declaration" => Declaration::new("function", Function),
+            "function_expression" => Declaration::new("function_expression", Function),
+            "arrow_function" => Declaration::new("arrow_function", Function),
+            "method_definition" => Declaration::new("method", Function),
+            "class_declaration" | "abstract_class_declaration" => Declaration::new("class", Type),
+            // TypeScript-only declarations, reported in the breakdown only
+            "interface_declaration" => Declaration::new("interface", KindOnly),
+            "type_alias_declaration" => Declaration::new("type_alias", KindOnly),
+            "enum_declaration" => Declaration::new("enum", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn has_switches(&self) -> bool {
+        true
+    }
+
+    fn switch_kind(&self, node: &Node) -> Option<&'static str> {
+        (node.kind() == "switch_statement").then_some("switch")
+    }
+
+    fn is_switch_arm(&self, node: &Node) -> bool {
+        matches!(node.kind(), "switch_case" | "switch_default")
+    }
+
+    fn is_default_arm(&self, arm: &Node, _source: &[u8]) -> bool {
+        arm.kind() == "switch_default"
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "statement_block"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        js_declaration(node, source)
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        is_statement(kind, parent_kind)
+    }
+
+    fn is_test_name(&self, name: &str, _stem: &str) -> Option<bool> {
+        Some(name.contains(".test.") || name.contains(".spec."))
+    }
+
+    fn type_members(&self, node: &Node, source: &[u8]) -> Members {
+        let language = &SupportedLanguage::JavaScript;
+        Members {
+            fields: body_children(node, "body")
+                .iter()
+                .filter(|child| {
+                    matches!(child.kind(), "field_definition" | "public_field_definition")
+                })
+                .count()
+                + assigned_names(node, source, language).len(),
+            bases: named(node)
+                .iter()
+                .filter(|child| child.kind() == "class_heritage")
+                .map(js_heritage_count)
+                .sum(),
+        }
+    }
+
+    fn collect_imports(
+        &self,
+        node: &Node,
+        source: &[u8],
+        _inline_modules: &mut usize,
+        found: &mut Vec<String>,
+    ) {
+        let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+        let field = |name: &str| node.child_by_field_name(name);
+        match node.kind() {
+            "import_statement" | "export_statement" => {
+                found.extend(field("source").map(|path| unquote(&text(&path))));
+            }
+            "call_expression" => {
+                let is_import = field("function")
+                    .is_some_and(|callee| callee.kind() == "import" || text(&callee) == "require");
+                if is_import && let Some(path) = string_argument(node, &["string"]) {
+                    found.push(unquote(&text(&path)));
+                }
+            }
+            _ => {}
+        }
+    }
+
+    fn resolve_import(&self, index: &Index, relative: &str, spec: &str) -> (String, bool) {
+        let directory = parent(relative);
+        let internal = |name: String| (name, true);
+        let external = |name: &str| (name.to_string(), false);
+        if !spec.starts_with('.') {
+            return external(&js_package(spec));
+        }
+        let base = normalize(&join(directory, spec));
+        let stem = SCRIPT_EXTENSIONS
+            .iter()
+            .find_map(|ext| base.strip_suffix(&format!(".{ext}")))
+            .unwrap_or(&base);
+        let candidates = std::iter::once(base.clone())
+            .chain(SCRIPT_EXTENSIONS.iter().map(|ext| format!("{stem}.{ext}")))
+            .chain(
+                SCRIPT_EXTENSIONS
+                    .iter()
+                    .map(|ext| format!("{base}/index.{ext}")),
+            );
+        internal(index.first_file(candidates).unwrap_or(base))
+    }
+}
+
+/// Names an npm package by an import of it: the first segment of the path,
+/// or the first two for scoped packages (`@scope/name`).
+fn js_package(spec: &str) -> String {
+    let segments = if spec.starts_with('@') { 2 } else { 1 };
+    spec.split('/').take(segments).collect::<Vec<_>>().join("/")
+}
@@ -0,0 +1,11 @@
+//! The node kinds and hooks of the built-in JSON analysis.
+//!
+//! Configuration files have no declarations; they are measured by their keys,
+//! see `configuration`.
+
+use crate::extractor::LanguageRules;
+
+/// The built-in rules for JSON.
+pub(crate) struct Json;
+
+impl LanguageRules for Json {}
@@ -0,0 +1,15 @@
+//! The node kinds and hooks of the built-in Jupyter notebook analysis.
+
+use crate::extractor::LanguageRules;
+use crate::parser::Declaration;
+use tree_sitter::Node;
+
+/// The built-in rules for Jupyter notebook.
+pub(crate) struct Jupyter;
+
+impl LanguageRules for Jupyter {
+    // Notebooks are measured by their cells, see `notebook`
+    fn classify(&self, _node: &Node, _source: &[u8]) -> Option<Declaration> {
+        None
+    }
+}
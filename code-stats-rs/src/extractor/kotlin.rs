@@ -0,0 +1,417 @@
+//! The node kinds and hooks of the built-in Kotlin analysis.
+
+use crate::comments::{is_jsdoc, preceding_comment};
+use crate::complexity::Flow;
+use crate::extractor::LanguageRules;
+use crate::imports::Index;
+use crate::members::{Members, named};
+use crate::parser::CodeStats;
+use crate::parser::{Declaration, Tally, has_child_kind, has_kotlin_modifier};
+use crate::signature::kotlin_identifier;
+use tree_sitter::Node;
+
+/// The built-in rules for Kotlin.
+pub(crate) struct Kotlin;
+
+impl LanguageRules for Kotlin {
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(
+            kind,
+            "function_declaration"
+                | "secondary_constructor"
+                | "lambda_literal"
+                | "anonymous_function"
+        )
+    }
+
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        let kind = node.kind();
+        match kind {
+            "if_expression"
+            | "for_statement"
+            | "while_statement"
+            | "do_while_statement"
+            | "catch_block"
+            | "elvis_expression"
+            | "conjunction_expression"
+            | "disjunction_expression" => true,
+            // The `else ->` entry is the default branch of a `when`
+            "when_entry" => {
+                let mut cursor = node.walk();
+                !node
+                    .children(&mut cursor)
+                    .any(|child| child.kind() == "else")
+            }
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_expression"
+                | "for_statement"
+                | "while_statement"
+                | "do_while_statement"
+                | "when_expression"
+                | "try_expression"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "for_statement" | "while_statement" | "do_while_statement" | "when_expression"
+            | "catch_block" => Flow::Structure,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn is_if(&self, kind: &str) -> bool {
+        kind == "if_expression"
+    }
+
+    // `break@outer` and `continue@outer` are single tokens
+    fn is_labeled_jump(&self, node: &Node) -> bool {
+        let kind = node.kind();
+        let mut cursor = node.walk();
+        kind == "jump_expression"
+            && node
+                .children(&mut cursor)
+                .any(|child| matches!(child.kind(), "break@" | "continue@"))
+    }
+
+    // Kotlin and Swift have a node kind per operator instead of an `operator` field
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        match node.kind() {
+            "conjunction_expression" => Some("&&"),
+            "disjunction_expression" => Some("||"),
+            "elvis_expression" => Some("?:"),
+            "nil_coalescing_expression" => Some("??"),
+            _ => None,
+        }
+    }
+
+    // Companion object members are qualified by the class alone, as they
+    // are called in Kotlin
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+        match node.kind() {
+            "class_declaration" | "object_declaration" => node
+                .child_by_field_name("name")
+                .or_else(|| kotlin_identifier(node))
+                .and_then(text),
+            _ => None,
+        }
+    }
+
+    // The grammar names declarations by their identifier child
+    fn type_name<'a>(&self, node: &Node, source: &'a [u8]) -> Option<&'a str> {
+        node.child_by_field_name("name")
+            .or_else(|| kotlin_identifier(node))?
+            .utf8_text(source)
+            .ok()
+    }
+
+    fn arity(&self, node: &Node) -> Option<usize> {
+        Some(kotlin_parameter_count(node))
+    }
+
+    fn has_expression_body(&self, node: &Node) -> bool {
+        let mut cursor = node.walk();
+        node.named_children(&mut cursor)
+            .filter(|child| child.kind() == "function_body")
+            .any(|body| {
+                body.children(&mut body.walk())
+                    .next()
+                    .is_some_and(|first| first.kind() == "=")
+            })
+    }
+
+    fn is_return(&self, node: &Node) -> bool {
+        let keyword = || {
+            node.children(&mut node.walk())
+                .next()
+                .map(|keyword| keyword.kind())
+        };
+        node.kind() == "jump_expression"
+            && keyword().is_some_and(|keyword| keyword.starts_with("return"))
+    }
+
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "function_declaration" if is_kotlin_member(node) => {
+                Declaration::new("method", Function)
+            }
+            "function_declaration" => Declaration::new("function", Function),
+            "secondary_constructor" => Declaration::new("constructor", Function),
+            "lambda_literal" | "anonymous_function" => Declaration::new("lambda", Function),
+            "class_declaration" if has_child_kind(node, "interface") => {
+                Declaration::new("interface", Type)
+            }
+            "class_declaration" if has_kotlin_modifier(node, "data") => {
+                Declaration::new("data_class", Type)
+            }
+            "class_declaration" if has_kotlin_modifier(node, "enum") => {
+                Declaration::new("enum", Type)
+            }
+            "class_declaration" => Declaration::new("class", Type),
+            "object_declaration" => Declaration::new("object", Type),
+            // A companion object belongs to its class rather than being a type of its own
+            "companion_object" => Declaration::new("companion_object", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn has_switches(&self) -> bool {
+        true
+    }
+
+    fn switch_kind(&self, node: &Node) -> Option<&'static str> {
+        (node.kind() == "when_expression").then_some("when")
+    }
+
+    fn is_switch_arm(&self, node: &Node) -> bool {
+        node.kind() == "when_entry"
+    }
+
+    fn is_default_arm(&self, arm: &Node, _source: &[u8]) -> bool {
+        let mut cursor = arm.walk();
+        arm.children(&mut cursor)
+            .any(|child| child.kind() == "else")
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "statements"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        kotlin_declaration(node, source)
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        let containers = [
+            "source_file",
+            "statements",
+            "class_body",
+            "enum_class_body",
+            "protocol_body",
+            "import_list",
+        ];
+        containers.contains(&parent_kind) && !containers.contains(&kind)
+    }
+
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.ends_with("Test") || stem.ends_with("Tests") || stem.ends_with("Spec"))
+    }
+
+    fn type_members(&self, node: &Node, _source: &[u8]) -> Members {
+        kotlin_members(node)
+    }
+
+    fn collect_imports(
+        &self,
+        node: &Node,
+        source: &[u8],
+        _inline_modules: &mut usize,
+        found: &mut Vec<String>,
+    ) {
+        let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+        if node.kind() == "import_header" {
+            let mut cursor = node.walk();
+            let children: Vec<_> = node.named_children(&mut cursor).collect();
+            if let Some(name) = children.iter().find(|child| child.kind() == "identifier") {
+                let wildcard = children
+                    .iter()
+                    .any(|child| child.kind() == "wildcard_import");
+                found.push(text(name) + if wildcard { ".*" } else { "" });
+            }
+        }
+    }
+
+    fn resolve_import(&self, index: &Index, relative: &str, spec: &str) -> (String, bool) {
+        super::java::Java.resolve_import(index, relative, spec)
+    }
+
+    // Extension and `suspend` functions are counted on top of their kind,
+    // as one function can be both
+    fn node_stats(
+        &self,
+        node: &Node,
+        _source: &[u8],
+        declaration: Option<Declaration>,
+        stats: &mut CodeStats,
+    ) {
+        if declaration.is_some() && node.kind() == "function_declaration" {
+            if is_kotlin_extension(node) {
+                stats.record_kind("extension_function");
+            }
+            if has_kotlin_modifier(node, "suspend") {
+                stats.record_kind("suspend_function");
+            }
+        }
+    }
+}
+
+fn kotlin_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    if !matches!(
+        node.kind(),
+        "class_declaration" | "object_declaration" | "function_declaration"
+    ) {
+        return None;
+    }
+    // Local declarations inside function bodies are not API
+    let parent = node.parent()?;
+    if !matches!(
+        parent.kind(),
+        "source_file" | "class_body" | "enum_class_body"
+    ) {
+        return None;
+    }
+
+    // Declarations are public unless marked otherwise
+    let mut cursor = node.walk();
+    let is_hidden = node
+        .children(&mut cursor)
+        .find(|child| child.kind() == "modifiers")
+        .and_then(|modifiers| modifiers.utf8_text(source).ok())
+        .is_some_and(|text| {
+            text.split_whitespace()
+                .any(|word| matches!(word, "private" | "internal" | "protected"))
+        });
+    if is_hidden {
+        return None;
+    }
+
+    Some(is_jsdoc(preceding_comment(node, &[]), source))
+}
+
+/// Counts the properties and supertypes of a Kotlin class or object,
+/// including the `val` and `var` parameters of its primary constructor.
+fn kotlin_members(node: &Node) -> Members {
+    let children = named(node);
+    let constructor_properties = children
+        .iter()
+        .filter(|child| child.kind() == "primary_constructor")
+        .flat_map(named)
+        .filter(|child| child.kind() == "class_parameters")
+        .flat_map(|parameters| named(&parameters))
+        .filter(|parameter| {
+            let mut cursor = parameter.walk();
+            parameter
+                .children(&mut cursor)
+                .any(|token| matches!(token.kind(), "val" | "var"))
+        })
+        .count();
+    let properties = children
+        .iter()
+        .filter(|child| matches!(child.kind(), "class_body" | "enum_class_body"))
+        .flat_map(named)
+        .filter(|child| child.kind() == "property_declaration")
+        .count();
+    let bases = children
+        .iter()
+        .map(|child| match child.kind() {
+            "delegation_specifier" => 1,
+            "delegation_specifiers" => named(child)
+                .iter()
+                .filter(|specifier| specifier.kind() == "delegation_specifier")
+                .count(),
+            _ => 0,
+        })
+        .sum();
+    Members {
+        fields: constructor_properties + properties,
+        bases,
+    }
+}
+
+/// Returns true if a Kotlin `function_declaration` is a member of a class,
+/// object, or interface body.
+fn is_kotlin_member(node: &Node) -> bool {
+    node.parent()
+        .is_some_and(|body| matches!(body.kind(), "class_body" | "enum_class_body"))
+}
+
+/// Counts the parameters of a Kotlin function, constructor, or lambda.
+///
+/// Parameter lists hold modifiers and default values next to the parameters
+/// themselves, so only the parameter nodes are counted.
+fn kotlin_parameter_count(node: &Node) -> usize {
+    let mut cursor = node.walk();
+    let Some(parameters) = node.named_children(&mut cursor).find(|child| {
+        matches!(
+            child.kind(),
+            "function_value_parameters" | "lambda_parameters"
+        )
+    }) else {
+        return 0;
+    };
+    let mut cursor = parameters.walk();
+    parameters
+        .named_children(&mut cursor)
+        .filter(|parameter| {
+            matches!(
+                parameter.kind(),
+                "parameter" | "variable_declaration" | "multi_variable_declaration"
+            )
+        })
+        .count()
+}
+
+/// Returns true if a Kotlin function declares a receiver type, as in
+/// `fun String.shout()`.
+///
+/// The receiver is the only type that can appear before the parameter list;
+/// type parameters and the return type are other node kinds or come after.
+fn is_kotlin_extension(node: &Node) -> bool {
+    let mut cursor = node.walk();
+    node.children(&mut cursor)
+        .take_while(|child| child.kind() != "function_value_parameters")
+        .any(|child| {
+            matches!(
+                child.kind(),
+                "user_type" | "nullable_type" | "parenthesized_type" | "function_type"
+            )
+        })
+}
+
+#[cfg(test)]
+mod tests {
+    use crate::language::SupportedLanguage;
+    use crate::parser::{analyze_code, create_parser};
+
+    #[test]
+    fn test_kotlin_rules() {
+        let source = r#"
+class Cart(val owner: String) {
+    suspend fun String.shout(times: Int) = this.repeat(times)
+
+    fun total(): Int {
+        return if (owner.isEmpty()) 0 else 1
+    }
+}
+"#;
+        let language = SupportedLanguage::Kotlin;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, source, "test", &language).unwrap();
+
+        assert_eq!(stats.function_count, 2);
+        assert_eq!(
+            stats
+                .types
+                .iter()
+                .map(|t| t.name.as_str())
+                .collect::<Vec<_>>(),
+            ["Cart"]
+        );
+        assert_eq!(stats.kinds.get("extension_function"), Some(&1));
+        assert_eq!(stats.kinds.get("suspend_function"), Some(&1));
+        let total = stats.functions.iter().find(|f| f.name == "total").unwrap();
+        assert_eq!(total.qualified_name, "Cart.total");
+        assert_eq!(total.complexity, 2);
+        assert_eq!(total.returns, 1);
+    }
+}
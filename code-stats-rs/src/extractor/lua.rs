@@ -0,0 +1,115 @@
+//! The node kinds and hooks of the built-in Lua analysis.
+
+use crate::comments::preceding_comment;
+use crate::complexity::{Flow, binary_operator, has_operator};
+use crate::extractor::LanguageRules;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for Lua.
+pub(crate) struct Lua;
+
+impl LanguageRules for Lua {
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(kind, "function_declaration" | "function_definition")
+    }
+
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        match node.kind() {
+            "if_statement" | "elseif_statement" | "while_statement" | "repeat_statement"
+            | "for_statement" => true,
+            // `x = x or default` is the idiom for optional arguments
+            "binary_expression" => has_operator(node, &["and", "or"]),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_statement" | "while_statement" | "repeat_statement" | "for_statement"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "while_statement" | "repeat_statement" | "for_statement" => Flow::Structure,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn is_labeled_jump(&self, node: &Node) -> bool {
+        node.kind() == "goto_statement"
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        binary_operator(node, "binary_expression", &["and", "or"])
+    }
+
+    // Lua has no type declarations; `function Cart:add()` is a method of
+    // the table it is defined on, taking `self` implicitly
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::Function;
+        match node.kind() {
+            "function_declaration" => {
+                let is_method = node
+                    .child_by_field_name("name")
+                    .is_some_and(|name| name.kind() == "method_index_expression");
+                if is_method {
+                    Declaration::new("method", Function)
+                } else {
+                    Declaration::new("function", Function)
+                }
+            }
+            "function_definition" => Declaration::new("lambda", Function),
+            _ => None,
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "block"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        lua_declaration(node, source)
+    }
+
+    fn is_logical_line(&self, _node: &Node, parent: Option<Node>) -> bool {
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        matches!(parent_kind, "chunk" | "block")
+    }
+
+    // busted, the usual Lua test runner, follows RSpec's `*_spec` names
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.ends_with("_spec") || stem.ends_with("_test") || stem.starts_with("test_"))
+    }
+}
+
+fn lua_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    // Functions defined at the top of a chunk that are not `local`: the
+    // globals and module table members a `require` exposes
+    if node.kind() != "function_declaration"
+        || node.parent().is_none_or(|parent| parent.kind() != "chunk")
+    {
+        return None;
+    }
+    let mut cursor = node.walk();
+    if node
+        .children(&mut cursor)
+        .next()
+        .is_some_and(|keyword| keyword.kind() == "local")
+    {
+        return None;
+    }
+
+    // An LDoc comment opens with a third `-` and may go on with plain `--`
+    // lines; `----` is a separator line
+    let mut first = preceding_comment(node, &[]);
+    while let Some(earlier) = first.and_then(|comment| preceding_comment(&comment, &[])) {
+        first = Some(earlier);
+    }
+    let documented = first
+        .and_then(|comment| comment.utf8_text(source).ok())
+        .is_some_and(|text| text.starts_with("---") && !text.starts_with("----"));
+    Some(documented)
+}
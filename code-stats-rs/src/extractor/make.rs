@@ -0,0 +1,112 @@
+//! The node kinds and hooks of the built-in Makefile analysis.
+
+use crate::complexity::Flow;
+use crate::extractor::LanguageRules;
+use crate::parser::{CodeStats, is_make_special_target};
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for Makefile.
+pub(crate) struct Make;
+
+impl LanguageRules for Make {
+    fn is_function_node(&self, kind: &str) -> bool {
+        kind == "rule"
+    }
+
+    // `ifeq`/`ifdef` blocks with their `else ifeq` arms, and the
+    // `$(if ...)`, `$(or ...)`, and `$(and ...)` functions
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        match node.kind() {
+            "conditional" | "elsif_directive" => true,
+            "function_call" => is_make_conditional_function(node),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        node.kind() == "conditional"
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "conditional" => Flow::Structure,
+            "elsif_directive" | "else_directive" => Flow::Branch,
+            "function_call" if is_make_conditional_function(node) => Flow::Structure,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn declared_returns(&self, _node: &Node, _source: &[u8]) -> Option<usize> {
+        Some(0)
+    }
+
+    // Every rule is a function, special targets such as `.PHONY`
+    // included; `count_nodes` tallies the targets themselves
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly};
+        match node.kind() {
+            "rule" => Declaration::new("rule", Function),
+            "variable_assignment" | "define_directive" => Declaration::new("variable", KindOnly),
+            "include_directive" => Declaration::new("include", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "recipe"
+    }
+
+    fn is_logical_line(&self, node: &Node, _parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        matches!(
+            kind,
+            "rule" | "recipe_line" | "variable_assignment" | "conditional"
+        ) || kind.ends_with("_directive")
+    }
+
+    // `build test: deps` defines two targets; `.PHONY: build test` marks
+    // them as not producing files
+    fn node_stats(
+        &self,
+        node: &Node,
+        source: &[u8],
+        _declaration: Option<Declaration>,
+        stats: &mut CodeStats,
+    ) {
+        if node.kind() != "rule" {
+            return;
+        }
+        let words = |kind: &str| -> Vec<&str> {
+            let mut cursor = node.walk();
+            node.named_children(&mut cursor)
+                .find(|child| child.kind() == kind)
+                .and_then(|child| child.utf8_text(source).ok())
+                .map(|text| text.split_whitespace().collect())
+                .unwrap_or_default()
+        };
+        let targets = words("targets");
+        let mut record = |kind: &str, count: usize| {
+            if count > 0 {
+                *stats.kinds.entry(kind.to_string()).or_default() += count;
+            }
+        };
+        if targets.contains(&".PHONY") {
+            record("phony", words("prerequisites").len());
+        }
+        record(
+            "target",
+            targets
+                .iter()
+                .filter(|target| !is_make_special_target(target))
+                .count(),
+        );
+    }
+}
+
+/// Returns true for the Make functions that choose between their arguments:
+/// `$(if ...)`, `$(or ...)`, and `$(and ...)`.
+fn is_make_conditional_function(node: &Node) -> bool {
+    node.child_by_field_name("function")
+        .is_some_and(|function| matches!(function.kind(), "if" | "or" | "and"))
+}
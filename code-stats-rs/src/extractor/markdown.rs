@@ -0,0 +1,22 @@
+//! The node kinds and hooks of the built-in Markdown analysis.
+//!
+//! Markdown has no functions; it is measured by the code blocks extracted
+//! from it, see `fences`.
+
+use crate::extractor::LanguageRules;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for Markdown.
+pub(crate) struct Markdown;
+
+impl LanguageRules for Markdown {
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::KindOnly;
+        match node.kind() {
+            "atx_heading" | "setext_heading" => Declaration::new("heading", KindOnly),
+            "fenced_code_block" | "indented_code_block" => Declaration::new("code_block", KindOnly),
+            _ => None,
+        }
+    }
+}
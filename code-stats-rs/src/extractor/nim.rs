@@ -0,0 +1,176 @@
+//! The node kinds and hooks of the built-in Nim analysis.
+
+use crate::complexity::{Flow, binary_operator, has_operator};
+use crate::extractor::LanguageRules;
+use crate::parser::{Declaration, Tally};
+use crate::systems;
+use tree_sitter::Node;
+
+/// The built-in rules for Nim.
+pub(crate) struct Nim;
+
+impl LanguageRules for Nim {
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(
+            kind,
+            "proc_declaration"
+                | "func_declaration"
+                | "method_declaration"
+                | "iterator_declaration"
+                | "converter_declaration"
+                | "template_declaration"
+                | "macro_declaration"
+                | "proc_expression"
+                | "func_expression"
+                | "iterator_expression"
+        )
+    }
+
+    // `when` is the compile-time `if`; the `else` of a `case` is its
+    // default branch
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        match node.kind() {
+            "if" | "when" | "elif_branch" | "of_branch" | "while" | "for" | "except_branch" => true,
+            "infix_expression" => has_operator(node, &["and", "or"]),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if" | "when" | "case" | "while" | "for" | "try"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "case" | "while" | "for" | "except_branch" => Flow::Structure,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn is_if(&self, kind: &str) -> bool {
+        matches!(kind, "if" | "when")
+    }
+
+    // Only `break` takes the label of a `block`
+    fn is_labeled_jump(&self, node: &Node) -> bool {
+        let kind = node.kind();
+        let has_child = |label: &str| {
+            let mut cursor = node.walk();
+            node.named_children(&mut cursor)
+                .any(|child| child.kind() == label)
+        };
+        kind == "break_statement" && has_child("identifier")
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        binary_operator(node, "infix_expression", &["and", "or"])
+    }
+
+    fn type_name<'a>(&self, node: &Node, source: &'a [u8]) -> Option<&'a str> {
+        systems::nim_name(node)?.utf8_text(source).ok()
+    }
+
+    fn declared_returns(&self, node: &Node, source: &[u8]) -> Option<usize> {
+        Some(
+            node.child_by_field_name("return_type")
+                .map_or(0, |return_type| {
+                    usize::from(return_type.utf8_text(source) != Ok("void"))
+                }),
+        )
+    }
+
+    // Templates and macros are counted as functions, as Elixir macros are
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "proc_declaration" => Declaration::new("proc", Function),
+            "func_declaration" => Declaration::new("func", Function),
+            "method_declaration" => Declaration::new("method", Function),
+            "iterator_declaration" => Declaration::new("iterator", Function),
+            "converter_declaration" => Declaration::new("converter", Function),
+            "template_declaration" => Declaration::new("template", Function),
+            "macro_declaration" => Declaration::new("macro", Function),
+            "proc_expression" | "func_expression" | "iterator_expression" => {
+                Declaration::new("lambda", Function)
+            }
+            "object_declaration" => Declaration::new("object", Type),
+            "enum_declaration" => Declaration::new("enum", Type),
+            "concept_declaration" => Declaration::new("concept", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "statement_list"
+    }
+
+    fn public_declaration(&self, node: &Node, _source: &[u8]) -> Option<bool> {
+        nim_declaration(node)
+    }
+
+    // Each declaration of a `let`, `var`, `const`, or `type` section
+    // counts rather than the section
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        (matches!(parent_kind, "source_file" | "statement_list") && !kind.ends_with("_section"))
+            || parent_kind.ends_with("_section")
+    }
+
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.starts_with("test_") || stem.ends_with("_test") || stem.ends_with("_tests"))
+    }
+}
+
+fn nim_declaration(node: &Node) -> Option<bool> {
+    let routine = matches!(
+        node.kind(),
+        "proc_declaration"
+            | "func_declaration"
+            | "method_declaration"
+            | "iterator_declaration"
+            | "converter_declaration"
+            | "template_declaration"
+            | "macro_declaration"
+    );
+    if !(routine || node.kind() == "type_declaration") || !systems::is_nim_exported(node) {
+        return None;
+    }
+
+    // `##` comments follow what they document: they open a routine's body,
+    // and end a type's line or start the line below it
+    let is_doc = |comment: &Node| {
+        matches!(
+            comment.kind(),
+            "documentation_comment" | "block_documentation_comment"
+        )
+    };
+    let documented = if routine {
+        node.child_by_field_name("body").is_some_and(|body| {
+            let mut cursor = body.walk();
+            is_doc(&body)
+                || body
+                    .named_children(&mut cursor)
+                    .next()
+                    .is_some_and(|first| is_doc(&first))
+        })
+    } else {
+        let row = node.start_position().row;
+        let mut stack = vec![*node];
+        stack.extend(node.next_named_sibling());
+        let mut found = false;
+        while let Some(current) = stack.pop() {
+            if is_doc(&current) && current.start_position().row <= row + 1 {
+                found = true;
+                break;
+            }
+            let mut cursor = current.walk();
+            stack.extend(current.named_children(&mut cursor));
+        }
+        found
+    };
+    Some(documented)
+}
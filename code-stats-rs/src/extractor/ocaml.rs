@@ -0,0 +1,158 @@
+//! The node kinds and hooks of the built-in OCaml analysis.
+
+use crate::comments::preceding_comment;
+use crate::complexity::Flow;
+use crate::extractor::LanguageRules;
+use crate::functional::{self, is_binding_function, is_lambda};
+use crate::language::SupportedLanguage;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for OCaml.
+pub(crate) struct OCaml;
+
+impl LanguageRules for OCaml {
+    fn is_function(&self, node: &Node, _source: &[u8]) -> bool {
+        let language = &SupportedLanguage::OCaml;
+        is_binding_function(node, language) || is_lambda(node, language)
+    }
+
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(kind, "fun_expression" | "function_expression")
+    }
+
+    // The handlers of a `try` are all paths besides its body
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        let kind = node.kind();
+        match kind {
+            "if_expression" | "while_expression" | "for_expression" => true,
+            "match_case" => {
+                node.parent()
+                    .is_some_and(|parent| parent.kind() == "try_expression")
+                    || node
+                        .prev_named_sibling()
+                        .is_some_and(|previous| previous.kind() == kind)
+            }
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_expression"
+                | "match_expression"
+                | "try_expression"
+                | "while_expression"
+                | "for_expression"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "match_expression" | "try_expression" | "while_expression" | "for_expression" => {
+                Flow::Structure
+            }
+            _ => Flow::Plain,
+        }
+    }
+
+    fn is_if(&self, kind: &str) -> bool {
+        kind == "if_expression"
+    }
+
+    // `module Cart = struct ... end`
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+        match node.kind() {
+            "module_binding" => node.child_by_field_name("name").and_then(text),
+            _ => None,
+        }
+    }
+
+    fn arity(&self, node: &Node) -> Option<usize> {
+        Some(functional::arity(node))
+    }
+
+    fn declared_returns(&self, _node: &Node, _source: &[u8]) -> Option<usize> {
+        Some(1)
+    }
+
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        let language = &SupportedLanguage::OCaml;
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "let_binding" if is_binding_function(node, language) => {
+                if functional::arity(node) > 0 {
+                    Declaration::new("function", Function)
+                } else {
+                    Declaration::new("binding", Function)
+                }
+            }
+            "fun_expression" | "function_expression" => Declaration::new("lambda", Function),
+            "type_binding" => Declaration::new("type", Type),
+            "class_binding" => Declaration::new("class", Type),
+            "module_binding" => Declaration::new("module", KindOnly),
+            "module_type_definition" => Declaration::new("module_type", KindOnly),
+            "exception_definition" => Declaration::new("exception", KindOnly),
+            // The `val` and `external` declarations of interfaces
+            "value_specification" | "external" => Declaration::new("val", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        matches!(kind, "structure" | "do_clause")
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        ocaml_declaration(node, source)
+    }
+
+    // Definitions, the local `let`s and `;` sequences of expressions,
+    // and `match` cases
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        (matches!(
+            parent_kind,
+            "compilation_unit" | "structure" | "signature" | "sequence_expression"
+        ) && kind != "sequence_expression")
+            || (parent_kind == "let_expression" && kind == "value_definition")
+            || kind == "match_case"
+    }
+
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.starts_with("test_") || stem.ends_with("_test") || stem.ends_with("_tests"))
+    }
+}
+
+fn ocaml_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    // Every top-level definition is public unless an interface hides it,
+    // which a single file doesn't tell
+    if !matches!(
+        node.kind(),
+        "value_definition"
+            | "type_definition"
+            | "module_definition"
+            | "module_type_definition"
+            | "exception_definition"
+            | "class_definition"
+            | "value_specification"
+            | "external"
+    ) {
+        return None;
+    }
+    let parent = node.parent()?;
+    if !matches!(
+        parent.kind(),
+        "compilation_unit" | "structure" | "signature"
+    ) {
+        return None;
+    }
+
+    let documented = preceding_comment(node, &[])
+        .and_then(|comment| comment.utf8_text(source).ok())
+        .is_some_and(|text| text.starts_with("(**") && text != "(**)");
+    Some(documented)
+}
@@ -0,0 +1,261 @@
+//! The node kinds and hooks of the built-in PHP analysis.
+
+use crate::comments::{is_jsdoc, preceding_comment};
+use crate::complexity::{Flow, binary_operator, has_operator};
+use crate::extractor::LanguageRules;
+use crate::imports::{Index, join, normalize, parent, unquote};
+use crate::logical::is_statement;
+use crate::members::{Members, body_children, named};
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for PHP.
+pub(crate) struct Php;
+
+impl LanguageRules for Php {
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(
+            kind,
+            "function_definition"
+                | "method_declaration"
+                | "anonymous_function"
+                | "anonymous_function_creation_expression"
+                | "arrow_function"
+        )
+    }
+
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        match node.kind() {
+            "if_statement"
+            | "else_if_clause"
+            | "for_statement"
+            | "foreach_statement"
+            | "while_statement"
+            | "do_statement"
+            | "case_statement"
+            | "match_conditional_expression"
+            | "catch_clause"
+            | "conditional_expression" => true,
+            "binary_expression" => has_operator(node, &["&&", "||", "and", "or", "??"]),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_statement"
+                | "for_statement"
+                | "foreach_statement"
+                | "while_statement"
+                | "do_statement"
+                | "switch_statement"
+                | "match_expression"
+                | "try_statement"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "for_statement"
+            | "foreach_statement"
+            | "while_statement"
+            | "do_statement"
+            | "switch_statement"
+            | "match_expression"
+            | "catch_clause"
+            | "conditional_expression" => Flow::Structure,
+            _ => Flow::Plain,
+        }
+    }
+
+    // `break 2` leaves two loops at once, like a labeled break
+    fn is_labeled_jump(&self, node: &Node) -> bool {
+        let kind = node.kind();
+        let has_child = |label: &str| {
+            let mut cursor = node.walk();
+            node.named_children(&mut cursor)
+                .any(|child| child.kind() == label)
+        };
+        kind == "goto_statement"
+            || (matches!(kind, "break_statement" | "continue_statement") && has_child("integer"))
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        binary_operator(node, "binary_expression", &["&&", "||", "and", "or", "??"])
+    }
+
+    // Namespaces are prefixed separately, as they are joined with `\`
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+        match node.kind() {
+            "class_declaration"
+            | "interface_declaration"
+            | "trait_declaration"
+            | "enum_declaration" => node.child_by_field_name("name").and_then(text),
+            _ => None,
+        }
+    }
+
+    fn has_expression_body(&self, node: &Node) -> bool {
+        node.kind() == "arrow_function"
+    }
+
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "function_definition" => Declaration::new("function", Function),
+            "method_declaration" => Declaration::new("method", Function),
+            "anonymous_function" | "anonymous_function_creation_expression" => {
+                Declaration::new("closure", Function)
+            }
+            "arrow_function" => Declaration::new("arrow_function", Function),
+            // Traits carry properties as well as methods, so they count as types
+            "class_declaration" => Declaration::new("class", Type),
+            "interface_declaration" => Declaration::new("interface", Type),
+            "trait_declaration" => Declaration::new("trait", Type),
+            "enum_declaration" => Declaration::new("enum", Type),
+            "namespace_definition" => Declaration::new("namespace", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "compound_statement"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        php_declaration(node, source)
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        is_statement(kind, parent_kind)
+    }
+
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.ends_with("Test") || stem.ends_with("Tests") || stem.ends_with("Spec"))
+    }
+
+    fn type_members(&self, node: &Node, _source: &[u8]) -> Members {
+        php_members(node)
+    }
+
+    fn collect_imports(
+        &self,
+        node: &Node,
+        source: &[u8],
+        _inline_modules: &mut usize,
+        found: &mut Vec<String>,
+    ) {
+        let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+        match node.kind() {
+            "namespace_use_clause" => {
+                let mut cursor = node.walk();
+                found.extend(
+                    node.named_children(&mut cursor)
+                        .find(|child| matches!(child.kind(), "qualified_name" | "name"))
+                        .map(|name| text(&name).trim_start_matches('\\').to_string()),
+                );
+            }
+            "require_expression"
+            | "require_once_expression"
+            | "include_expression"
+            | "include_once_expression" => {
+                let mut cursor = node.walk();
+                found.extend(
+                    node.named_children(&mut cursor)
+                        .find(|child| matches!(child.kind(), "string" | "encapsed_string"))
+                        .map(|path| unquote(&text(&path))),
+                );
+            }
+            _ => {}
+        }
+    }
+
+    fn resolve_import(&self, index: &Index, relative: &str, spec: &str) -> (String, bool) {
+        let directory = parent(relative);
+        let internal = |name: String| (name, true);
+        let external = |name: &str| (name.to_string(), false);
+        if spec.ends_with(".php") {
+            let candidates = [normalize(&join(directory, spec)), normalize(spec)];
+            return internal(
+                index
+                    .first_file(candidates)
+                    .unwrap_or_else(|| normalize(&join(directory, spec))),
+            );
+        }
+        index
+            .by_suffix(&spec.replace('\\', "/"), &["php"])
+            .map_or_else(
+                || external(spec.split('\\').next().unwrap_or(spec)),
+                internal,
+            )
+    }
+}
+
+fn php_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    match node.kind() {
+        "class_declaration"
+        | "interface_declaration"
+        | "trait_declaration"
+        | "enum_declaration" => {}
+        // Functions declared inside another function or a condition are
+        // defined only when that code runs
+        "function_definition"
+            if node.parent().is_some_and(|parent| {
+                matches!(parent.kind(), "program" | "compound_statement")
+                    && parent
+                        .parent()
+                        .is_none_or(|owner| owner.kind() == "namespace_definition")
+            }) => {}
+        // Methods without a modifier are public
+        "method_declaration" => {
+            let mut cursor = node.walk();
+            let hidden = node
+                .children(&mut cursor)
+                .filter(|child| child.kind() == "visibility_modifier")
+                .any(|modifier| matches!(modifier.utf8_text(source), Ok("private" | "protected")));
+            if hidden {
+                return None;
+            }
+        }
+        _ => return None,
+    }
+    Some(is_jsdoc(preceding_comment(node, &[]), source))
+}
+
+/// Counts the properties, promoted constructor parameters, parent class,
+/// interfaces, and traits of a PHP type.
+fn php_members(node: &Node) -> Members {
+    let body = body_children(node, "body");
+    let properties = body
+        .iter()
+        .filter(|child| child.kind() == "property_declaration")
+        .flat_map(named)
+        .filter(|element| element.kind() == "property_element")
+        .count();
+    let promoted = body
+        .iter()
+        .filter(|child| child.kind() == "method_declaration")
+        .filter_map(|method| method.child_by_field_name("parameters"))
+        .flat_map(|parameters| named(&parameters))
+        .filter(|parameter| parameter.kind() == "property_promotion_parameter")
+        .count();
+    let traits = body
+        .iter()
+        .filter(|child| child.kind() == "use_declaration")
+        .flat_map(named)
+        .filter(|name| name.kind().ends_with("name"))
+        .count();
+    let supertypes = named(node)
+        .iter()
+        .filter(|child| matches!(child.kind(), "base_clause" | "class_interface_clause"))
+        .flat_map(named)
+        .count();
+    Members {
+        fields: properties + promoted,
+        bases: supertypes + traits,
+    }
+}
@@ -0,0 +1,153 @@
+//! The node kinds and hooks of the built-in Protobuf analysis.
+
+use crate::comments::preceding_comment;
+use crate::extractor::LanguageRules;
+use crate::imports::{Index, join, normalize, parent, unquote};
+use crate::members::{Members, named};
+use crate::parser::CodeStats;
+use crate::parser::{Declaration, Tally};
+use crate::proto::proto_services;
+use crate::signature::proto_name;
+use tree_sitter::Node;
+
+/// The built-in rules for Protobuf.
+pub(crate) struct Protobuf;
+
+impl LanguageRules for Protobuf {
+    fn is_function_node(&self, kind: &str) -> bool {
+        kind == "rpc"
+    }
+
+    // Nested messages are qualified by the messages around them, as in
+    // `Order.Item`
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+        match node.kind() {
+            "message" | "enum" | "service" => proto_name(node).and_then(text),
+            _ => None,
+        }
+    }
+
+    // Messages, enums, and services are named by their `*_name` child
+    fn type_name<'a>(&self, node: &Node, source: &'a [u8]) -> Option<&'a str> {
+        node.child_by_field_name("name")
+            .or_else(|| proto_name(node))?
+            .utf8_text(source)
+            .ok()
+    }
+
+    fn declared_returns(&self, _node: &Node, _source: &[u8]) -> Option<usize> {
+        Some(1)
+    }
+
+    // Services are reported in the breakdown only, like traits, and each
+    // RPC method is a function
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "message" => Declaration::new("message", Type),
+            "enum" => Declaration::new("enum", Type),
+            "service" => Declaration::new("service", KindOnly),
+            "rpc" => Declaration::new("rpc", Function),
+            "field" | "map_field" | "oneof_field" => Declaration::new("field", KindOnly),
+            "oneof" => Declaration::new("oneof", KindOnly),
+            "enum_field" => Declaration::new("enum_value", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "message_body"
+    }
+
+    fn public_declaration(&self, node: &Node, _source: &[u8]) -> Option<bool> {
+        proto_declaration(node)
+    }
+
+    fn is_logical_line(&self, node: &Node, _parent: Option<Node>) -> bool {
+        matches!(
+            node.kind(),
+            "syntax"
+                | "package"
+                | "import"
+                | "option"
+                | "message"
+                | "enum"
+                | "service"
+                | "rpc"
+                | "field"
+                | "enum_field"
+                | "map_field"
+                | "oneof"
+                | "oneof_field"
+                | "reserved"
+                | "extend"
+        )
+    }
+
+    fn type_members(&self, node: &Node, _source: &[u8]) -> Members {
+        Members {
+            fields: named(node)
+                .iter()
+                .filter(|child| child.kind() == "message_body")
+                .flat_map(named)
+                .map(|child| match child.kind() {
+                    "field" | "map_field" => 1,
+                    "oneof" => named(&child)
+                        .iter()
+                        .filter(|field| field.kind() == "oneof_field")
+                        .count(),
+                    _ => 0,
+                })
+                .sum(),
+            bases: 0,
+        }
+    }
+
+    fn collect_imports(
+        &self,
+        node: &Node,
+        source: &[u8],
+        _inline_modules: &mut usize,
+        found: &mut Vec<String>,
+    ) {
+        let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+        let field = |name: &str| node.child_by_field_name(name);
+        if node.kind() == "import" {
+            let mut cursor = node.walk();
+            found.extend(
+                field("path")
+                    .or_else(|| {
+                        node.named_children(&mut cursor)
+                            .find(|child| child.kind() == "string")
+                    })
+                    .map(|path| unquote(&text(&path))),
+            );
+        }
+    }
+
+    fn resolve_import(&self, index: &Index, relative: &str, spec: &str) -> (String, bool) {
+        let directory = parent(relative);
+        let internal = |name: String| (name, true);
+        let external = |name: &str| (name.to_string(), false);
+        let candidates = [normalize(spec), normalize(&join(directory, spec))];
+        let stem = spec.strip_suffix(".proto").unwrap_or(spec);
+        index
+            .first_file(candidates)
+            .or_else(|| index.by_suffix(stem, &["proto"]))
+            .map_or_else(|| external(spec), internal)
+    }
+
+    fn file_stats(&self, root: &Node, source: &[u8], stats: &mut CodeStats) {
+        stats.services = proto_services(root, source);
+    }
+}
+
+/// Every message, enum, service, and RPC method of a `.proto` file is part
+/// of its API; nested messages included, as other files refer to them too.
+fn proto_declaration(node: &Node) -> Option<bool> {
+    if !matches!(node.kind(), "message" | "enum" | "service" | "rpc") {
+        return None;
+    }
+    Some(preceding_comment(node, &[]).is_some())
+}
@@ -0,0 +1,243 @@
+//! The node kinds and hooks of the built-in Python analysis.
+
+use crate::comments::first_named_child;
+use crate::complexity::{Flow, binary_operator};
+use crate::extractor::LanguageRules;
+use crate::imports::{Index, parent};
+use crate::language::SupportedLanguage;
+use crate::logical::is_statement;
+use crate::members::{Members, assigned_names, named};
+use crate::parser::CodeStats;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for Python.
+pub(crate) struct Python;
+
+impl LanguageRules for Python {
+    fn is_function_node(&self, kind: &str) -> bool {
+        kind == "function_definition"
+    }
+
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_statement"
+                | "elif_clause"
+                | "for_statement"
+                | "while_statement"
+                | "except_clause"
+                | "conditional_expression"
+                | "boolean_operator"
+                | "case_clause"
+                | "for_in_clause"
+                | "if_clause"
+        )
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_statement"
+                | "for_statement"
+                | "while_statement"
+                | "try_statement"
+                | "with_statement"
+                | "match_statement"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "for_statement"
+            | "while_statement"
+            | "except_clause"
+            | "match_statement"
+            | "conditional_expression" => Flow::Structure,
+            "lambda" => Flow::Nest,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        binary_operator(node, "boolean_operator", &["and", "or"])
+    }
+
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+        match node.kind() {
+            "class_definition" => node.child_by_field_name("name").and_then(text),
+            _ => None,
+        }
+    }
+
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "function_definition" if is_python_method(node) => Declaration::new("method", Function),
+            "function_definition" => Declaration::new("function", Function),
+            "class_definition" => Declaration::new("class", Type),
+            "decorator" => Declaration::new("decorator", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn has_switches(&self) -> bool {
+        true
+    }
+
+    fn switch_kind(&self, node: &Node) -> Option<&'static str> {
+        (node.kind() == "match_statement").then_some("match")
+    }
+
+    fn is_switch_arm(&self, node: &Node) -> bool {
+        node.kind() == "case_clause"
+    }
+
+    fn is_default_arm(&self, arm: &Node, source: &[u8]) -> bool {
+        let mut cursor = arm.walk();
+        let mut patterns = arm
+            .named_children(&mut cursor)
+            .filter(|child| child.kind() == "case_pattern");
+        let wildcard = patterns
+            .next()
+            .and_then(|pattern| pattern.utf8_text(source).ok())
+            .is_some_and(|pattern| pattern.trim() == "_");
+        wildcard && patterns.next().is_none() && arm.child_by_field_name("guard").is_none()
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "block"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        python_declaration(node, source)
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        is_statement(kind, parent_kind)
+    }
+
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.starts_with("test_") || stem.ends_with("_test") || stem == "conftest")
+    }
+
+    fn type_members(&self, node: &Node, source: &[u8]) -> Members {
+        let language = &SupportedLanguage::Python;
+        Members {
+            fields: assigned_names(node, source, language).len(),
+            bases: node
+                .child_by_field_name("superclasses")
+                .map(|list| {
+                    named(&list)
+                        .iter()
+                        .filter(|base| base.kind() != "keyword_argument")
+                        .count()
+                })
+                .unwrap_or(0),
+        }
+    }
+
+    fn collect_imports(
+        &self,
+        node: &Node,
+        source: &[u8],
+        _inline_modules: &mut usize,
+        found: &mut Vec<String>,
+    ) {
+        let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+        let field = |name: &str| node.child_by_field_name(name);
+        match node.kind() {
+            "import_statement" => {
+                let mut cursor = node.walk();
+                for child in node.named_children(&mut cursor) {
+                    match child.kind() {
+                        "dotted_name" => found.push(text(&child)),
+                        "aliased_import" => {
+                            found.extend(child.child_by_field_name("name").map(|name| text(&name)));
+                        }
+                        _ => {}
+                    }
+                }
+            }
+            "import_from_statement" => {
+                found.extend(field("module_name").map(|name| text(&name)));
+            }
+            _ => {}
+        }
+    }
+
+    fn resolve_import(&self, index: &Index, relative: &str, spec: &str) -> (String, bool) {
+        let directory = parent(relative);
+        index.resolve_python(directory, spec)
+    }
+
+    // `async def` is a function_definition with a leading `async` token
+    fn node_stats(
+        &self,
+        node: &Node,
+        _source: &[u8],
+        declaration: Option<Declaration>,
+        stats: &mut CodeStats,
+    ) {
+        if declaration.is_some_and(|declaration| declaration.tally == Tally::Function) {
+            let mut cursor = node.walk();
+            if node.children(&mut cursor).any(|c| c.kind() == "async") {
+                stats.record_kind("async_function");
+            }
+        }
+    }
+}
+
+fn python_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    if !matches!(node.kind(), "function_definition" | "class_definition") {
+        return None;
+    }
+
+    let name = node.child_by_field_name("name")?.utf8_text(source).ok()?;
+    if name.starts_with('_') {
+        return None;
+    }
+
+    let mut parent = node.parent()?;
+    if parent.kind() == "decorated_definition" {
+        parent = parent.parent()?;
+    }
+    let at_top_level = parent.kind() == "module"
+        || (parent.kind() == "block"
+            && parent
+                .parent()
+                .is_some_and(|owner| owner.kind() == "class_definition"));
+    if !at_top_level {
+        return None;
+    }
+
+    Some(node.child_by_field_name("body").is_some_and(|body| {
+        first_named_child(&body)
+            .filter(|statement| statement.kind() == "expression_statement")
+            .and_then(|statement| first_named_child(&statement))
+            .is_some_and(|expression| expression.kind() == "string")
+    }))
+}
+
+/// Returns true if a Python `function_definition` is defined directly in a class body.
+///
+/// Decorated methods are wrapped in a `decorated_definition` node, so that
+/// wrapper is skipped before checking for the enclosing class block.
+fn is_python_method(node: &Node) -> bool {
+    let mut parent = node.parent();
+    if let Some(p) = parent
+        && p.kind() == "decorated_definition"
+    {
+        parent = p.parent();
+    }
+
+    parent.is_some_and(|block| {
+        block.kind() == "block"
+            && block
+                .parent()
+                .is_some_and(|owner| owner.kind() == "class_definition")
+    })
+}
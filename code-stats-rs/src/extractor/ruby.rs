@@ -0,0 +1,272 @@
+//! The node kinds and hooks of the built-in Ruby analysis.
+
+use crate::comments::preceding_comment;
+use crate::complexity::{Flow, binary_operator, has_operator};
+use crate::extractor::LanguageRules;
+use crate::imports::{Index, join, normalize, parent, string_argument, unquote};
+use crate::language::SupportedLanguage;
+use crate::members::{Members, assigned_names, body_children, named};
+use crate::parser::{Declaration, Tally};
+use crate::signature::is_ruby_singleton_method;
+use tree_sitter::Node;
+
+/// The built-in rules for Ruby.
+pub(crate) struct Ruby;
+
+impl LanguageRules for Ruby {
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(kind, "method" | "singleton_method" | "lambda")
+    }
+
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        match node.kind() {
+            "if" | "unless" | "elsif" | "while" | "until" | "for" | "when" | "in_clause"
+            | "rescue" | "conditional" | "if_modifier" | "unless_modifier" | "while_modifier"
+            | "until_modifier" | "rescue_modifier" => true,
+            "binary" => has_operator(node, &["&&", "||", "and", "or"]),
+            _ => false,
+        }
+    }
+
+    // Statement modifiers (`return if done`) guard a single statement
+    // and don't open a block
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if" | "unless" | "while" | "until" | "for" | "case" | "case_match" | "begin"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "while" | "until" | "for" | "case" | "case_match" | "rescue" | "conditional"
+            | "if_modifier" | "unless_modifier" | "while_modifier" | "until_modifier"
+            | "rescue_modifier" => Flow::Structure,
+            "block" | "do_block" => Flow::Nest,
+            _ => Flow::Plain,
+        }
+    }
+
+    // `elsif` carries the rest of the chain as its own `alternative`
+    fn is_if(&self, kind: &str) -> bool {
+        matches!(kind, "if" | "unless" | "elsif")
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        binary_operator(node, "binary", &["&&", "||", "and", "or"])
+    }
+
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+        match node.kind() {
+            "class" | "module" => node.child_by_field_name("name").and_then(text),
+            _ => None,
+        }
+    }
+
+    fn is_return(&self, node: &Node) -> bool {
+        node.kind() == "return"
+    }
+
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            // `def self.name`, or `def name` inside `class << self`
+            "method" | "singleton_method" if is_ruby_singleton_method(node) => {
+                Declaration::new("singleton_method", Function)
+            }
+            "method" => Declaration::new("method", Function),
+            "lambda" => Declaration::new("lambda", Function),
+            "class" => Declaration::new("class", Type),
+            // Modules are namespaces and mixins rather than data types, and
+            // blocks are far too common to count as functions
+            "module" => Declaration::new("module", KindOnly),
+            "singleton_class" => Declaration::new("singleton_class", KindOnly),
+            // A lambda's body is a block, which the lambda already accounts for
+            "block" | "do_block"
+                if node.parent().is_none_or(|parent| parent.kind() != "lambda") =>
+            {
+                Declaration::new("block", KindOnly)
+            }
+            _ => None,
+        }
+    }
+
+    fn has_switches(&self) -> bool {
+        true
+    }
+
+    fn switch_kind(&self, node: &Node) -> Option<&'static str> {
+        matches!(node.kind(), "case" | "case_match").then_some("case")
+    }
+
+    fn is_switch_arm(&self, node: &Node) -> bool {
+        matches!(node.kind(), "when" | "in_clause" | "else")
+    }
+
+    fn is_default_arm(&self, arm: &Node, _source: &[u8]) -> bool {
+        arm.kind() == "else"
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        matches!(kind, "body_statement" | "block_body")
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        ruby_declaration(node, source)
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        matches!(
+            parent_kind,
+            "program"
+                | "body_statement"
+                | "block_body"
+                | "then"
+                | "else"
+                | "do"
+                | "begin"
+                | "ensure"
+                | "parenthesized_statements"
+        ) && !matches!(kind, "then" | "empty_statement")
+    }
+
+    // RSpec runs `*_spec` files and Minitest `*_test` or `test_*` files
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.ends_with("_spec") || stem.ends_with("_test") || stem.starts_with("test_"))
+    }
+
+    fn type_members(&self, node: &Node, source: &[u8]) -> Members {
+        let language = &SupportedLanguage::Ruby;
+        ruby_members(node, source, language)
+    }
+
+    fn collect_imports(
+        &self,
+        node: &Node,
+        source: &[u8],
+        _inline_modules: &mut usize,
+        found: &mut Vec<String>,
+    ) {
+        let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+        let field = |name: &str| node.child_by_field_name(name);
+        if node.kind() == "call" {
+            let method = field("method").map(|method| text(&method));
+            if let Some(method @ ("require" | "require_relative" | "load")) = method.as_deref()
+                && let Some(path) = string_argument(node, &["string"])
+            {
+                let path = unquote(&text(&path));
+                if method == "require_relative" && !path.starts_with('.') {
+                    found.push(format!("./{path}"));
+                } else {
+                    found.push(path);
+                }
+            }
+        }
+    }
+
+    fn resolve_import(&self, index: &Index, relative: &str, spec: &str) -> (String, bool) {
+        let directory = parent(relative);
+        let internal = |name: String| (name, true);
+        let external = |name: &str| (name.to_string(), false);
+        let path = spec.strip_suffix(".rb").unwrap_or(spec);
+        if path.starts_with('.') {
+            return internal(normalize(&join(directory, &format!("{path}.rb"))));
+        }
+        index.by_suffix(path, &["rb"]).map_or_else(
+            || external(path.split('/').next().unwrap_or(path)),
+            internal,
+        )
+    }
+}
+
+fn ruby_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    let kind = node.kind();
+    if !matches!(kind, "class" | "module" | "method" | "singleton_method") {
+        return None;
+    }
+
+    let is_visibility = |candidate: &Node, words: &[&str]| {
+        candidate
+            .utf8_text(source)
+            .is_ok_and(|text| words.contains(&text))
+    };
+    let mut statement = *node;
+    if kind != "class" && kind != "module" {
+        // `private def helper` passes the method to `private`
+        if let Some(call) = node
+            .parent()
+            .filter(|parent| parent.kind() == "argument_list")
+            .and_then(|arguments| arguments.parent())
+        {
+            if call
+                .child_by_field_name("method")
+                .is_some_and(|method| is_visibility(&method, &["private", "protected"]))
+            {
+                return None;
+            }
+            statement = call;
+        }
+
+        // A bare `private` applies to every method after it in the body
+        let mut sibling = statement.prev_named_sibling();
+        while let Some(previous) = sibling {
+            if previous.kind() == "identifier" {
+                if is_visibility(&previous, &["private", "protected"]) {
+                    return None;
+                }
+                if is_visibility(&previous, &["public"]) {
+                    break;
+                }
+            }
+            sibling = previous.prev_named_sibling();
+        }
+    }
+
+    // A comment before the first statement of a body is left outside of it
+    let documented = preceding_comment(&statement, &[]).is_some()
+        || (statement.prev_sibling().is_none()
+            && statement
+                .parent()
+                .filter(|body| body.kind() == "body_statement")
+                .is_some_and(|body| preceding_comment(&body, &[]).is_some()));
+    Some(documented)
+}
+
+/// Counts the attributes and mixins of a Ruby class: the names given to
+/// `attr_*` and the instance variables its methods assign, and the
+/// superclass along with every `include`d, `extend`ed, or `prepend`ed
+/// module.
+fn ruby_members(node: &Node, source: &[u8], language: &SupportedLanguage) -> Members {
+    let mut names = assigned_names(node, source, language);
+    let mut bases = usize::from(node.child_by_field_name("superclass").is_some());
+    let calls = body_children(node, "body")
+        .into_iter()
+        .filter(|child| child.kind() == "call");
+    for call in calls {
+        let method = call
+            .child_by_field_name("method")
+            .and_then(|method| method.utf8_text(source).ok())
+            .unwrap_or_default();
+        let arguments = call
+            .child_by_field_name("arguments")
+            .map(|arguments| named(&arguments))
+            .unwrap_or_default();
+        match method {
+            "attr_accessor" | "attr_reader" | "attr_writer" => {
+                names.extend(arguments.iter().filter_map(|argument| {
+                    let name = argument.utf8_text(source).ok()?;
+                    Some(name.trim_start_matches(':').to_string())
+                }));
+            }
+            "include" | "extend" | "prepend" => bases += arguments.len(),
+            _ => {}
+        }
+    }
+    Members {
+        fields: names.len(),
+        bases,
+    }
+}
@@ -0,0 +1,276 @@
+//! The node kinds and hooks of the built-in Rust analysis.
+
+use crate::comments::preceding_comment;
+use crate::complexity::{Flow, has_operator};
+use crate::extractor::LanguageRules;
+use crate::imports::{Index, use_paths};
+use crate::members::{Members, body_children, named};
+use crate::parser::{Declaration, Tally};
+use crate::signature::value_count;
+use tree_sitter::Node;
+
+/// The built-in rules for Rust.
+pub(crate) struct Rust;
+
+impl LanguageRules for Rust {
+    fn is_function_node(&self, kind: &str) -> bool {
+        kind == "function_item"
+    }
+
+    fn is_decision_point(&self, node: &Node, source: &[u8]) -> bool {
+        match node.kind() {
+            "if_expression" | "while_expression" | "for_expression" => true,
+            // The wildcard arm is the "default" branch of a match
+            "match_arm" => node
+                .child_by_field_name("pattern")
+                .and_then(|p| p.utf8_text(source).ok())
+                .is_none_or(|pattern| pattern.trim() != "_"),
+            "binary_expression" => has_operator(node, &["&&", "||"]),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_expression"
+                | "match_expression"
+                | "while_expression"
+                | "for_expression"
+                | "loop_expression"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "match_expression" | "while_expression" | "for_expression" | "loop_expression" => {
+                Flow::Structure
+            }
+            "closure_expression" => Flow::Nest,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn is_if(&self, kind: &str) -> bool {
+        kind == "if_expression"
+    }
+
+    fn is_labeled_jump(&self, node: &Node) -> bool {
+        let kind = node.kind();
+        let has_child = |label: &str| {
+            let mut cursor = node.walk();
+            node.named_children(&mut cursor)
+                .any(|child| child.kind() == label)
+        };
+        matches!(kind, "break_expression" | "continue_expression") && has_child("label")
+    }
+
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+        match node.kind() {
+            "mod_item" | "trait_item" => node.child_by_field_name("name").and_then(text),
+            // `impl Trait for Type` is qualified by the implementing type
+            "impl_item" => node.child_by_field_name("type").and_then(text),
+            _ => None,
+        }
+    }
+
+    fn declared_returns(&self, node: &Node, _source: &[u8]) -> Option<usize> {
+        Some(
+            node.child_by_field_name("return_type")
+                .map_or(0, |return_type| match return_type.kind() {
+                    "unit_type" | "never_type" => 0,
+                    "tuple_type" => value_count(&return_type),
+                    _ => 1,
+                }),
+        )
+    }
+
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "function_item" => Declaration::new("function", Function),
+            "struct_item" => Declaration::new("struct", Type),
+            "enum_item" => Declaration::new("enum", Type),
+            // Traits and impl blocks are reported in the breakdown only, so the
+            // class/struct total keeps meaning "type definitions with data".
+            "trait_item" => Declaration::new("trait", KindOnly),
+            "impl_item" => Declaration::new("impl", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn has_switches(&self) -> bool {
+        true
+    }
+
+    fn switch_kind(&self, node: &Node) -> Option<&'static str> {
+        (node.kind() == "match_expression").then_some("match")
+    }
+
+    fn is_switch_arm(&self, node: &Node) -> bool {
+        node.kind() == "match_arm"
+    }
+
+    // The pattern of a match arm includes its guard, so `_ if x` is not a
+    // default
+    fn is_default_arm(&self, arm: &Node, source: &[u8]) -> bool {
+        arm.child_by_field_name("pattern")
+            .and_then(|pattern| pattern.utf8_text(source).ok())
+            .is_some_and(|pattern| pattern.trim() == "_")
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "block"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        rust_declaration(node, source)
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        is_rust_statement(kind)
+                // The value a block evaluates to
+                || (parent_kind == "block" && !kind.ends_with("attribute_item"))
+    }
+
+    // Unit tests live next to the code in `#[cfg(test)]` modules, so only
+    // integration tests in `tests/` are recognized
+    fn is_test_name(&self, _name: &str, _stem: &str) -> Option<bool> {
+        Some(false)
+    }
+
+    fn type_members(&self, node: &Node, _source: &[u8]) -> Members {
+        Members {
+            fields: body_children(node, "body")
+                .iter()
+                .filter(|child| child.kind() == "field_declaration")
+                .count()
+                + tuple_fields(node),
+            bases: 0,
+        }
+    }
+
+    fn collect_imports(
+        &self,
+        node: &Node,
+        source: &[u8],
+        inline_modules: &mut usize,
+        found: &mut Vec<String>,
+    ) {
+        let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+        let field = |name: &str| node.child_by_field_name(name);
+        match node.kind() {
+            "use_declaration" => {
+                if let Some(argument) = field("argument") {
+                    let mut paths = Vec::new();
+                    use_paths(&argument, source, "", &mut paths);
+                    found.extend(
+                        paths
+                            .into_iter()
+                            .map(|path| inline_super(path, *inline_modules)),
+                    );
+                }
+            }
+            "mod_item" if field("body").is_some() => *inline_modules += 1,
+            "extern_crate_declaration" => {
+                found.extend(field("name").map(|name| text(&name)));
+            }
+            _ => {}
+        }
+    }
+
+    fn resolve_import(&self, index: &Index, relative: &str, spec: &str) -> (String, bool) {
+        index.resolve_rust(relative, spec)
+    }
+}
+
+fn rust_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    if !matches!(
+        node.kind(),
+        "function_item"
+            | "struct_item"
+            | "enum_item"
+            | "union_item"
+            | "trait_item"
+            | "type_item"
+            | "const_item"
+            | "static_item"
+            | "mod_item"
+    ) {
+        return None;
+    }
+
+    let mut cursor = node.walk();
+    let is_pub = node.children(&mut cursor).any(|child| {
+        child.kind() == "visibility_modifier" && child.utf8_text(source).ok() == Some("pub")
+    });
+    if !is_pub {
+        return None;
+    }
+
+    // Attributes sit between the doc comment and the item; `#[doc = "..."]`
+    // is a doc comment in its own right
+    let mut sibling = node.prev_sibling();
+    while let Some(attribute) = sibling.filter(|s| s.kind() == "attribute_item") {
+        if attribute
+            .utf8_text(source)
+            .is_ok_and(|text| text.starts_with("#[doc"))
+        {
+            return Some(true);
+        }
+        sibling = attribute.prev_sibling();
+    }
+
+    let documented = preceding_comment(node, &["attribute_item"])
+        .and_then(|comment| comment.utf8_text(source).ok())
+        .is_some_and(|text| {
+            (text.starts_with("///") && !text.starts_with("////"))
+                || (text.starts_with("/**") && !text.starts_with("/**/"))
+        });
+    Some(documented)
+}
+
+/// Rewrites the leading `super`s of a Rust path that only leave inline
+/// modules to `self`, as they refer to the same file: `use super::*` in a
+/// `mod tests` block imports from the enclosing file, not its parent.
+fn inline_super(path: String, inline_modules: usize) -> String {
+    let supers = path.split("::").take_while(|s| *s == "super").count();
+    let inline = supers.min(inline_modules);
+    if inline == 0 {
+        return path;
+    }
+    let rest: Vec<&str> = path.split("::").skip(inline).collect();
+    if inline < supers {
+        return rest.join("::");
+    }
+    std::iter::once("self")
+        .chain(rest)
+        .collect::<Vec<_>>()
+        .join("::")
+}
+
+/// Returns true for Rust statements and items; attributes belong to the
+/// item they annotate.
+fn is_rust_statement(kind: &str) -> bool {
+    (kind.ends_with("_item") && !kind.ends_with("attribute_item"))
+        || kind.ends_with("_declaration")
+        || matches!(
+            kind,
+            "expression_statement" | "macro_definition" | "enum_variant"
+        )
+}
+
+/// Counts the fields of a Rust tuple struct, `struct Meters(f64);`.
+fn tuple_fields(node: &Node) -> usize {
+    named(node)
+        .iter()
+        .filter(|child| child.kind() == "ordered_field_declaration_list")
+        .map(|list| {
+            let mut cursor = list.walk();
+            list.children_by_field_name("type", &mut cursor).count()
+        })
+        .sum()
+}
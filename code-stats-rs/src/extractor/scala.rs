@@ -0,0 +1,219 @@
+//! The node kinds and hooks of the built-in Scala analysis.
+
+use crate::comments::{is_jsdoc, preceding_comment};
+use crate::complexity::Flow;
+use crate::extractor::LanguageRules;
+use crate::parser::{Declaration, Tally, has_child_kind};
+use tree_sitter::Node;
+
+/// The built-in rules for Scala.
+pub(crate) struct Scala;
+
+impl LanguageRules for Scala {
+    // Abstract `def`s have no body and a complexity of 1
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(
+            kind,
+            "function_definition" | "function_declaration" | "lambda_expression"
+        )
+    }
+
+    // The cases of `match` and of `catch` are both `case_clause`s; a
+    // wildcard `case _ =>` is their default
+    fn is_decision_point(&self, node: &Node, source: &[u8]) -> bool {
+        let kind = node.kind();
+        match kind {
+            "if_expression" | "while_expression" | "do_while_expression" | "for_expression" => true,
+            "case_clause" => node
+                .child_by_field_name("pattern")
+                .is_none_or(|pattern| pattern.kind() != "wildcard"),
+            // Operators are identifiers, told apart by their text
+            "infix_expression" => node
+                .child_by_field_name("operator")
+                .and_then(|op| op.utf8_text(source).ok())
+                .is_some_and(|op| matches!(op, "&&" | "||")),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_expression"
+                | "match_expression"
+                | "while_expression"
+                | "do_while_expression"
+                | "for_expression"
+                | "try_expression"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "match_expression"
+            | "while_expression"
+            | "do_while_expression"
+            | "for_expression"
+            | "catch_clause" => Flow::Structure,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn is_if(&self, kind: &str) -> bool {
+        kind == "if_expression"
+    }
+
+    // Scala operators are identifiers, which can't be told apart without
+    // the source, so its sequences don't add to the cognitive complexity
+    fn logical_operator(&self, _node: &Node) -> Option<&'static str> {
+        None
+    }
+
+    // Companion object members are qualified by the object, as they are
+    // by the class in Kotlin
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+        match node.kind() {
+            "class_definition" | "object_definition" | "trait_definition" | "enum_definition" => {
+                node.child_by_field_name("name").and_then(text)
+            }
+            _ => None,
+        }
+    }
+
+    fn arity(&self, node: &Node) -> Option<usize> {
+        Some(scala_parameter_count(node))
+    }
+
+    fn declared_returns(&self, node: &Node, source: &[u8]) -> Option<usize> {
+        Some(node.child_by_field_name("return_type").map_or(
+            usize::from(node.child_by_field_name("body").is_some()),
+            |return_type| usize::from(return_type.utf8_text(source) != Ok("Unit")),
+        ))
+    }
+
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            // Abstract `def`s without a body are declarations of their own
+            "function_definition" | "function_declaration" if is_scala_member(node) => {
+                Declaration::new("method", Function)
+            }
+            "function_definition" | "function_declaration" => {
+                Declaration::new("function", Function)
+            }
+            "lambda_expression" => Declaration::new("lambda", Function),
+            "class_definition" if has_child_kind(node, "case") => {
+                Declaration::new("case_class", Type)
+            }
+            "class_definition" => Declaration::new("class", Type),
+            "object_definition" if has_child_kind(node, "case") => {
+                Declaration::new("case_object", Type)
+            }
+            "object_definition" => Declaration::new("object", Type),
+            // Traits carry fields and are mixed in like abstract classes
+            "trait_definition" => Declaration::new("trait", Type),
+            "enum_definition" => Declaration::new("enum", Type),
+            // Givens and extensions add to types declared elsewhere
+            "given_definition" => Declaration::new("given", KindOnly),
+            "extension_definition" => Declaration::new("extension", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        matches!(kind, "block" | "indented_block")
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        scala_declaration(node, source)
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        let containers = [
+            "compilation_unit",
+            "template_body",
+            "enum_body",
+            "block",
+            "indented_block",
+        ];
+        containers.contains(&parent_kind) && !containers.contains(&kind)
+    }
+
+    // ScalaTest suites are often named after the style they extend
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(
+            ["Test", "Tests", "Spec", "Suite"]
+                .iter()
+                .any(|suffix| stem.ends_with(suffix)),
+        )
+    }
+}
+
+fn scala_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    if !matches!(
+        node.kind(),
+        "class_definition"
+            | "object_definition"
+            | "trait_definition"
+            | "enum_definition"
+            | "function_definition"
+            | "function_declaration"
+    ) {
+        return None;
+    }
+    // Local definitions inside blocks are not API
+    let parent = node.parent()?;
+    if !matches!(
+        parent.kind(),
+        "compilation_unit" | "template_body" | "package_clause" | "enum_body"
+    ) {
+        return None;
+    }
+
+    // Definitions are public unless marked otherwise; `private[pkg]`
+    // included
+    let mut cursor = node.walk();
+    let is_hidden = node
+        .children(&mut cursor)
+        .find(|child| child.kind() == "modifiers")
+        .and_then(|modifiers| modifiers.utf8_text(source).ok())
+        .is_some_and(|text| text.contains("private") || text.contains("protected"));
+    if is_hidden {
+        return None;
+    }
+
+    Some(is_jsdoc(preceding_comment(node, &[]), source))
+}
+
+/// Returns true if a Scala `def` is a member of a class, object, trait, or
+/// enum rather than a local or top-level function.
+fn is_scala_member(node: &Node) -> bool {
+    node.parent()
+        .is_some_and(|body| matches!(body.kind(), "template_body" | "enum_body"))
+}
+
+/// Counts the parameters of a Scala `def` or lambda.
+///
+/// A `def` has a `parameters` field per parameter list; a lambda's field is
+/// its bindings, or a lone identifier as in `x => x * 2`.
+fn scala_parameter_count(node: &Node) -> usize {
+    let mut cursor = node.walk();
+    let lists: Vec<Node> = node
+        .children_by_field_name("parameters", &mut cursor)
+        .collect();
+    lists
+        .iter()
+        .map(|list| match list.kind() {
+            "identifier" | "wildcard" => 1,
+            _ => {
+                let mut cursor = list.walk();
+                list.named_children(&mut cursor)
+                    .filter(|parameter| matches!(parameter.kind(), "parameter" | "binding"))
+                    .count()
+            }
+        })
+        .sum()
+}
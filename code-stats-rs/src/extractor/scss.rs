@@ -0,0 +1,93 @@
+//! The node kinds and hooks of the built-in SCSS analysis.
+
+use crate::comments::preceding_comment;
+use crate::complexity::{Flow, binary_operator, has_operator};
+use crate::extractor::LanguageRules;
+use crate::parser::Declaration;
+use crate::signature::listed_parameter_count;
+use tree_sitter::Node;
+
+/// The built-in rules for SCSS.
+pub(crate) struct Scss;
+
+impl LanguageRules for Scss {
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(kind, "mixin_statement" | "function_statement")
+    }
+
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        match node.kind() {
+            "if_statement" | "else_if_clause" | "each_statement" | "for_statement"
+            | "while_statement" => true,
+            "binary_expression" => has_operator(node, &["and", "or"]),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_statement" | "each_statement" | "for_statement" | "while_statement"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "each_statement" | "for_statement" | "while_statement" => Flow::Structure,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        binary_operator(node, "binary_expression", &["and", "or"])
+    }
+
+    fn arity(&self, node: &Node) -> Option<usize> {
+        Some(listed_parameter_count(node))
+    }
+
+    fn classify(&self, node: &Node, source: &[u8]) -> Option<Declaration> {
+        super::css::Css.classify(node, source)
+    }
+
+    // Rules repeating the same declarations under other selectors
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "block"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        scss_declaration(node, source)
+    }
+
+    fn is_logical_line(&self, _node: &Node, parent: Option<Node>) -> bool {
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        matches!(parent_kind, "stylesheet" | "block")
+    }
+}
+
+fn scss_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    if !matches!(node.kind(), "mixin_statement" | "function_statement") {
+        return None;
+    }
+    // Sass modules don't export members whose name starts with `-` or `_`
+    let mut cursor = node.walk();
+    let name = node
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "identifier")
+        .and_then(|name| name.utf8_text(source).ok())?;
+    if name.starts_with(['-', '_']) {
+        return None;
+    }
+
+    // SassDoc comments are `///` lines or `/** ... */` blocks
+    let mut first = preceding_comment(node, &[]);
+    while let Some(earlier) = first.and_then(|comment| preceding_comment(&comment, &[])) {
+        first = Some(earlier);
+    }
+    let documented = first
+        .and_then(|comment| comment.utf8_text(source).ok())
+        .is_some_and(|text| {
+            (text.starts_with("///") && !text.starts_with("////")) || text.starts_with("/**")
+        });
+    Some(documented)
+}
@@ -0,0 +1,86 @@
+//! The node kinds and hooks of the built-in SQL analysis.
+//!
+//! SQL files have no functions; they are measured per statement instead.
+
+use crate::extractor::LanguageRules;
+use crate::parser::{CodeStats, StatementStats};
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for SQL.
+pub(crate) struct Sql;
+
+impl LanguageRules for Sql {
+    // Statements are reported by kind; a statement nested in a CTE is
+    // part of its outer statement and counted as the `cte` instead
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::KindOnly;
+        match node.kind() {
+            "statement" if node.parent().is_none_or(|parent| parent.kind() != "cte") => {
+                Declaration::new(sql_statement_kind(node), KindOnly)
+            }
+            "cte" => Declaration::new("cte", KindOnly),
+            _ => None,
+        }
+    }
+
+    // Migrations often repeat whole statements with other table names
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "statement"
+    }
+
+    // Common table expressions are part of the statement they precede
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        kind == "statement" && parent_kind != "cte"
+    }
+
+    fn node_stats(
+        &self,
+        node: &Node,
+        _source: &[u8],
+        declaration: Option<Declaration>,
+        stats: &mut CodeStats,
+    ) {
+        if let Some(declaration) = declaration
+            && declaration.kind != "cte"
+        {
+            let mut cursor = node.walk();
+            stats.statements.push(StatementStats {
+                kind: declaration.kind.to_string(),
+                start_line: node.start_position().row + 1,
+                end_line: node.end_position().row + 1,
+                ctes: node
+                    .named_children(&mut cursor)
+                    .filter(|child| child.kind() == "cte")
+                    .count(),
+            });
+        }
+    }
+}
+
+/// Returns the breakdown label of an SQL `statement` node.
+///
+/// The statement's first child after its `WITH` clause says what it does:
+/// `select`, `insert`, `update`, and `delete` keep their names, and every
+/// `CREATE`, `ALTER`, `DROP`, or `TRUNCATE` is `ddl`.
+fn sql_statement_kind(node: &Node) -> &'static str {
+    let mut cursor = node.walk();
+    node.named_children(&mut cursor)
+        .find_map(|child| match child.kind() {
+            "select" => Some("select"),
+            "insert" => Some("insert"),
+            "update" => Some("update"),
+            "delete" => Some("delete"),
+            kind if kind.starts_with("create_")
+                || kind.starts_with("alter_")
+                || kind.starts_with("drop_")
+                || kind == "truncate" =>
+            {
+                Some("ddl")
+            }
+            _ => None,
+        })
+        .unwrap_or("statement")
+}
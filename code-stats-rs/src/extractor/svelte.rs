@@ -0,0 +1,14 @@
+//! The node kinds and hooks of the built-in Svelte analysis.
+
+use crate::extractor::LanguageRules;
+use crate::parser::Declaration;
+use tree_sitter::Node;
+
+/// The built-in rules for Svelte.
+pub(crate) struct Svelte;
+
+impl LanguageRules for Svelte {
+    fn classify(&self, node: &Node, source: &[u8]) -> Option<Declaration> {
+        super::html::Html.classify(node, source)
+    }
+}
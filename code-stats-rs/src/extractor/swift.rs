@@ -0,0 +1,347 @@
+//! The node kinds and hooks of the built-in Swift analysis.
+
+use crate::comments::preceding_comment;
+use crate::complexity::{Flow, is_swift_else_if};
+use crate::extractor::LanguageRules;
+use crate::members::{Members, body_children, named};
+use crate::parser::CodeStats;
+use crate::parser::{Declaration, Tally};
+use tree_sitter::Node;
+
+/// The built-in rules for Swift.
+pub(crate) struct Swift;
+
+impl LanguageRules for Swift {
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(
+            kind,
+            "function_declaration"
+                | "protocol_function_declaration"
+                | "init_declaration"
+                | "deinit_declaration"
+                | "lambda_literal"
+        )
+    }
+
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        let kind = node.kind();
+        match kind {
+            "if_statement"
+            | "guard_statement"
+            | "for_statement"
+            | "while_statement"
+            | "repeat_while_statement"
+            | "catch_block"
+            | "ternary_expression"
+            | "conjunction_expression"
+            | "disjunction_expression"
+            | "nil_coalescing_expression" => true,
+            // `default:` is the default branch of a `switch`
+            "switch_entry" => {
+                let mut cursor = node.walk();
+                !node
+                    .children(&mut cursor)
+                    .any(|child| child.kind() == "default_keyword")
+            }
+            _ => false,
+        }
+    }
+
+    // A `guard` exits early instead of wrapping the code it protects
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_statement"
+                | "for_statement"
+                | "while_statement"
+                | "repeat_while_statement"
+                | "switch_statement"
+                | "do_statement"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        let kind = node.kind();
+        match kind {
+            "guard_statement"
+            | "for_statement"
+            | "while_statement"
+            | "repeat_while_statement"
+            | "switch_statement"
+            | "catch_block"
+            | "ternary_expression" => Flow::Structure,
+            // The body of a final `else` is not wrapped in a node, so the
+            // keyword itself takes the branch's cost
+            "else"
+                if node
+                    .parent()
+                    .is_some_and(|parent| parent.kind() == "if_statement")
+                    && !node
+                        .next_sibling()
+                        .is_some_and(|next| is_swift_else_if(&next)) =>
+            {
+                Flow::Branch
+            }
+            _ => Flow::Plain,
+        }
+    }
+
+    // `break outer`; the label is the only identifier a `break` or
+    // `continue` can have, unlike the value of a `return`
+    fn is_labeled_jump(&self, node: &Node) -> bool {
+        let kind = node.kind();
+        let has_child = |label: &str| {
+            let mut cursor = node.walk();
+            node.named_children(&mut cursor)
+                .any(|child| child.kind() == label)
+        };
+        kind == "control_transfer_statement"
+            && node
+                .children(&mut node.walk())
+                .next()
+                .is_some_and(|keyword| matches!(keyword.kind(), "break" | "continue"))
+            && has_child("simple_identifier")
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        super::kotlin::Kotlin.logical_operator(node)
+    }
+
+    // Extension members are qualified by the extended type
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+        match node.kind() {
+            "class_declaration" | "protocol_declaration" => {
+                node.child_by_field_name("name").and_then(text)
+            }
+            _ => None,
+        }
+    }
+
+    fn arity(&self, node: &Node) -> Option<usize> {
+        Some(swift_parameter_count(node))
+    }
+
+    fn is_return(&self, node: &Node) -> bool {
+        let keyword = || {
+            node.children(&mut node.walk())
+                .next()
+                .map(|keyword| keyword.kind())
+        };
+        node.kind() == "control_transfer_statement" && keyword() == Some("return")
+    }
+
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "function_declaration" if is_swift_member(node) => Declaration::new("method", Function),
+            "function_declaration" => Declaration::new("function", Function),
+            "protocol_function_declaration" => Declaration::new("method", Function),
+            "init_declaration" => Declaration::new("initializer", Function),
+            "deinit_declaration" => Declaration::new("deinitializer", Function),
+            "lambda_literal" => Declaration::new("closure", Function),
+            // Classes, structs, enums, and extensions share one node kind,
+            // told apart by their keyword
+            "class_declaration" => match node.child_by_field_name("declaration_kind")?.kind() {
+                "class" => Declaration::new("class", Type),
+                "struct" => Declaration::new("struct", Type),
+                "enum" => Declaration::new("enum", Type),
+                "actor" => Declaration::new("actor", Type),
+                // Extensions add to a type declared elsewhere, like Rust impl blocks
+                "extension" => Declaration::new("extension", KindOnly),
+                _ => None,
+            },
+            "protocol_declaration" => Declaration::new("protocol", KindOnly),
+            "subscript_declaration" => Declaration::new("subscript", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "statements"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        swift_declaration(node, source)
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        super::kotlin::Kotlin.is_logical_line(node, parent)
+    }
+
+    fn is_test_name(&self, _name: &str, stem: &str) -> Option<bool> {
+        Some(stem.ends_with("Test") || stem.ends_with("Tests") || stem.ends_with("Spec"))
+    }
+
+    fn type_members(&self, node: &Node, _source: &[u8]) -> Members {
+        Members {
+            fields: body_children(node, "body")
+                .iter()
+                .filter(|child| child.kind() == "property_declaration")
+                .count(),
+            bases: named(node)
+                .iter()
+                .filter(|child| child.kind() == "inheritance_specifier")
+                .count(),
+        }
+    }
+
+    fn collect_imports(
+        &self,
+        node: &Node,
+        source: &[u8],
+        _inline_modules: &mut usize,
+        found: &mut Vec<String>,
+    ) {
+        let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+        if node.kind() == "import_declaration" {
+            let mut cursor = node.walk();
+            found.extend(
+                node.named_children(&mut cursor)
+                    .find(|child| child.kind() == "identifier")
+                    .map(|name| text(&name)),
+            );
+        }
+    }
+
+    fn node_stats(
+        &self,
+        node: &Node,
+        source: &[u8],
+        declaration: Option<Declaration>,
+        stats: &mut CodeStats,
+    ) {
+        // A `@propertyWrapper` type is still counted as the struct or class it is
+        if declaration.is_some_and(|declaration| declaration.tally == Tally::Type)
+            && swift_attributes(node, source).contains(&"propertyWrapper")
+        {
+            stats.record_kind("property_wrapper");
+        }
+        // Properties are not declarations of their own, but wrapped ones
+        // (`@Published var items`) show how much state the wrappers manage
+        if node.kind() == "property_declaration"
+            && swift_attributes(node, source)
+                .iter()
+                .any(|attribute| is_property_wrapper_attribute(attribute))
+        {
+            stats.record_kind("wrapped_property");
+        }
+    }
+}
+
+fn swift_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    match node.kind() {
+        "protocol_declaration"
+        | "function_declaration"
+        | "init_declaration"
+        | "property_declaration" => {}
+        // An extension documents nothing of its own; its members are counted
+        "class_declaration"
+            if node
+                .child_by_field_name("declaration_kind")
+                .is_some_and(|keyword| keyword.kind() != "extension") => {}
+        _ => return None,
+    }
+
+    // Attributes such as `@MainActor` are modifiers too, so the comment sits
+    // directly above the declaration node
+    let mut cursor = node.walk();
+    let is_public = node
+        .children(&mut cursor)
+        .filter(|child| child.kind() == "modifiers")
+        .any(|modifiers| {
+            let mut cursor = modifiers.walk();
+            modifiers
+                .named_children(&mut cursor)
+                .filter(|modifier| modifier.kind() == "visibility_modifier")
+                .any(|modifier| matches!(modifier.utf8_text(source), Ok("public" | "open")))
+        });
+    if !is_public {
+        return None;
+    }
+
+    let documented = preceding_comment(node, &[])
+        .and_then(|comment| comment.utf8_text(source).ok())
+        .is_some_and(|text| text.starts_with("///") || (text.starts_with("/**") && text != "/**/"));
+    Some(documented)
+}
+
+/// Returns true if a Swift function is a member of a type, extension, or
+/// protocol body.
+fn is_swift_member(node: &Node) -> bool {
+    node.parent().is_some_and(|body| {
+        matches!(
+            body.kind(),
+            "class_body" | "enum_class_body" | "protocol_body"
+        )
+    })
+}
+
+/// Counts the parameters of a Swift function, initializer, or closure.
+///
+/// Function parameters are direct children of the declaration; a closure's
+/// are in the parameter list of its `(a, b) in` signature.
+fn swift_parameter_count(node: &Node) -> usize {
+    let count = |list: &Node, kind: &str| {
+        let mut cursor = list.walk();
+        list.named_children(&mut cursor)
+            .filter(|child| child.kind() == kind)
+            .count()
+    };
+    if node.kind() != "lambda_literal" {
+        return count(node, "parameter");
+    }
+    let mut cursor = node.walk();
+    let parameters = node
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "lambda_function_type")
+        .and_then(|signature| {
+            let mut cursor = signature.walk();
+            signature
+                .named_children(&mut cursor)
+                .find(|child| child.kind() == "lambda_function_type_parameters")
+        });
+    parameters.map_or(0, |list| count(&list, "lambda_parameter"))
+}
+
+/// Returns the names of the attributes on a Swift declaration, without the
+/// `@` and any arguments: `["MainActor", "Published"]`.
+fn swift_attributes<'a>(node: &Node, source: &'a [u8]) -> Vec<&'a str> {
+    let mut cursor = node.walk();
+    let Some(modifiers) = node
+        .children(&mut cursor)
+        .find(|child| child.kind() == "modifiers")
+    else {
+        return Vec::new();
+    };
+    let mut cursor = modifiers.walk();
+    modifiers
+        .named_children(&mut cursor)
+        .filter(|modifier| modifier.kind() == "attribute")
+        .filter_map(|attribute| attribute.utf8_text(source).ok())
+        .map(|text| {
+            let name = text.trim_start_matches('@');
+            name.split(['(', '<']).next().unwrap_or(name).trim()
+        })
+        .collect()
+}
+
+/// Returns true if a Swift attribute names a property wrapper.
+///
+/// Wrappers are types, so their names are capitalized, unlike most built-in
+/// attributes (`@objc`, `@available`); the capitalized built-ins are listed.
+fn is_property_wrapper_attribute(name: &str) -> bool {
+    name.starts_with(|c: char| c.is_ascii_uppercase())
+        && !matches!(
+            name,
+            "MainActor"
+                | "IBOutlet"
+                | "IBAction"
+                | "IBInspectable"
+                | "IBDesignable"
+                | "NSManaged"
+                | "NSCopying"
+                | "GKInspectable"
+                | "Sendable"
+        )
+}
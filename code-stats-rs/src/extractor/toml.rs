@@ -0,0 +1,11 @@
+//! The node kinds and hooks of the built-in TOML analysis.
+//!
+//! Configuration files have no declarations; they are measured by their keys,
+//! see `configuration`.
+
+use crate::extractor::LanguageRules;
+
+/// The built-in rules for TOML.
+pub(crate) struct Toml;
+
+impl LanguageRules for Toml {}
@@ -0,0 +1,133 @@
+//! The node kinds and hooks of the built-in TypeScript analysis.
+
+use crate::comments::js_declaration;
+use crate::complexity::{Flow, binary_operator};
+use crate::extractor::LanguageRules;
+use crate::imports::{Index, string_argument, unquote};
+use crate::language::SupportedLanguage;
+use crate::logical::is_statement;
+use crate::members::{Members, assigned_names, body_children, js_heritage_count, named};
+use crate::parser::Declaration;
+use tree_sitter::Node;
+
+/// The built-in rules for TypeScript.
+pub(crate) struct TypeScript;
+
+impl LanguageRules for TypeScript {
+    fn is_function_node(&self, kind: &str) -> bool {
+        super::javascript::JavaScript.is_function_node(kind)
+    }
+
+    fn is_decision_point(&self, node: &Node, source: &[u8]) -> bool {
+        super::javascript::JavaScript.is_decision_point(node, source)
+    }
+
+    fn is_nesting_node(&self, node: &Node, source: &[u8]) -> bool {
+        super::javascript::JavaScript.is_nesting_node(node, source)
+    }
+
+    fn flow(&self, node: &Node, source: &[u8]) -> Flow {
+        super::javascript::JavaScript.flow(node, source)
+    }
+
+    fn is_labeled_jump(&self, node: &Node) -> bool {
+        matches!(node.kind(), "break_statement" | "continue_statement")
+            && node.child_by_field_name("label").is_some()
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        binary_operator(node, "binary_expression", &["&&", "||", "??"])
+    }
+
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        super::javascript::JavaScript.scope_name(node, source)
+    }
+
+    fn has_expression_body(&self, node: &Node) -> bool {
+        super::javascript::JavaScript.has_expression_body(node)
+    }
+
+    fn classify(&self, node: &Node, source: &[u8]) -> Option<Declaration> {
+        super::javascript::JavaScript.classify(node, source)
+    }
+
+    fn has_switches(&self) -> bool {
+        true
+    }
+
+    fn switch_kind(&self, node: &Node) -> Option<&'static str> {
+        (node.kind() == "switch_statement").then_some("switch")
+    }
+
+    fn is_switch_arm(&self, node: &Node) -> bool {
+        matches!(node.kind(), "switch_case" | "switch_default")
+    }
+
+    fn is_default_arm(&self, arm: &Node, _source: &[u8]) -> bool {
+        arm.kind() == "switch_default"
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "statement_block"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        js_declaration(node, source)
+    }
+
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        is_statement(kind, parent_kind)
+    }
+
+    fn is_test_name(&self, name: &str, _stem: &str) -> Option<bool> {
+        Some(name.contains(".test.") || name.contains(".spec."))
+    }
+
+    fn type_members(&self, node: &Node, source: &[u8]) -> Members {
+        let language = &SupportedLanguage::TypeScript;
+        Members {
+            fields: body_children(node, "body")
+                .iter()
+                .filter(|child| {
+                    matches!(child.kind(), "field_definition" | "public_field_definition")
+                })
+                .count()
+                + assigned_names(node, source, language).len(),
+            bases: named(node)
+                .iter()
+                .filter(|child| child.kind() == "class_heritage")
+                .map(js_heritage_count)
+                .sum(),
+        }
+    }
+
+    fn collect_imports(
+        &self,
+        node: &Node,
+        source: &[u8],
+        _inline_modules: &mut usize,
+        found: &mut Vec<String>,
+    ) {
+        let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+        let field = |name: &str| node.child_by_field_name(name);
+        match node.kind() {
+            "import_statement" | "export_statement" => {
+                found.extend(field("source").map(|path| unquote(&text(&path))));
+            }
+            "call_expression" => {
+                let is_import = field("function")
+                    .is_some_and(|callee| callee.kind() == "import" || text(&callee) == "require");
+                if is_import && let Some(path) = string_argument(node, &["string"]) {
+                    found.push(unquote(&text(&path)));
+                }
+            }
+            _ => {}
+        }
+    }
+
+    fn resolve_import(&self, index: &Index, relative: &str, spec: &str) -> (String, bool) {
+        super::javascript::JavaScript.resolve_import(index, relative, spec)
+    }
+}
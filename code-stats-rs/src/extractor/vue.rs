@@ -0,0 +1,14 @@
+//! The node kinds and hooks of the built-in Vue analysis.
+
+use crate::extractor::LanguageRules;
+use crate::parser::Declaration;
+use tree_sitter::Node;
+
+/// The built-in rules for Vue.
+pub(crate) struct Vue;
+
+impl LanguageRules for Vue {
+    fn classify(&self, node: &Node, source: &[u8]) -> Option<Declaration> {
+        super::html::Html.classify(node, source)
+    }
+}
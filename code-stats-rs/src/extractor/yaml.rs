@@ -0,0 +1,11 @@
+//! The node kinds and hooks of the built-in YAML analysis.
+//!
+//! Configuration files have no declarations; they are measured by their keys,
+//! see `configuration`.
+
+use crate::extractor::LanguageRules;
+
+/// The built-in rules for YAML.
+pub(crate) struct Yaml;
+
+impl LanguageRules for Yaml {}
@@ -0,0 +1,176 @@
+//! The node kinds and hooks of the built-in Zig analysis.
+
+use crate::comments::preceding_comment;
+use crate::complexity::{Flow, binary_operator, has_operator};
+use crate::extractor::LanguageRules;
+use crate::parser::{Declaration, Tally};
+use crate::signature::listed_parameter_count;
+use crate::systems::{self, ZIG_MODIFIERS};
+use tree_sitter::Node;
+
+/// The built-in rules for Zig.
+pub(crate) struct Zig;
+
+impl LanguageRules for Zig {
+    fn is_function_node(&self, kind: &str) -> bool {
+        matches!(kind, "function_declaration" | "test_declaration")
+    }
+
+    fn is_decision_point(&self, node: &Node, _source: &[u8]) -> bool {
+        let kind = node.kind();
+        match kind {
+            "if_statement" | "if_expression" | "for_statement" | "for_expression"
+            | "while_statement" | "while_expression" => true,
+            // `else =>` is the default branch of a `switch`
+            "switch_case" => {
+                let mut cursor = node.walk();
+                !node
+                    .children(&mut cursor)
+                    .any(|child| child.kind() == "else")
+            }
+            // `catch` and `orelse` take another path on an error or null
+            "binary_expression" => has_operator(node, &["and", "or", "orelse", "catch"]),
+            _ => false,
+        }
+    }
+
+    fn is_nesting_node(&self, node: &Node, _source: &[u8]) -> bool {
+        matches!(
+            node.kind(),
+            "if_statement"
+                | "if_expression"
+                | "for_statement"
+                | "for_expression"
+                | "while_statement"
+                | "while_expression"
+                | "switch_expression"
+        )
+    }
+
+    fn flow(&self, node: &Node, _source: &[u8]) -> Flow {
+        match node.kind() {
+            "for_statement" | "for_expression" | "while_statement" | "while_expression"
+            | "switch_expression" => Flow::Structure,
+            "binary_expression" if has_operator(node, &["catch"]) => Flow::Structure,
+            _ => Flow::Plain,
+        }
+    }
+
+    fn is_if(&self, kind: &str) -> bool {
+        matches!(kind, "if_statement" | "if_expression")
+    }
+
+    fn is_labeled_jump(&self, node: &Node) -> bool {
+        let kind = node.kind();
+        let has_child = |label: &str| {
+            let mut cursor = node.walk();
+            node.named_children(&mut cursor)
+                .any(|child| child.kind() == label)
+        };
+        matches!(kind, "break_expression" | "continue_expression") && has_child("break_label")
+    }
+
+    fn logical_operator(&self, node: &Node) -> Option<&'static str> {
+        binary_operator(node, "binary_expression", &["and", "or", "orelse"])
+    }
+
+    // Named containers; an anonymous `struct` returned from a generic
+    // function is not a scope of its own
+    fn scope_name(&self, node: &Node, source: &[u8]) -> Option<String> {
+        if systems::is_zig_container(node) {
+            systems::zig_container_name(node, source).map(str::to_string)
+        } else {
+            None
+        }
+    }
+
+    fn type_name<'a>(&self, node: &Node, source: &'a [u8]) -> Option<&'a str> {
+        systems::zig_container_name(node, source)
+    }
+
+    fn arity(&self, node: &Node) -> Option<usize> {
+        Some(listed_parameter_count(node))
+    }
+
+    fn is_return(&self, node: &Node) -> bool {
+        node.kind() == "return_expression"
+    }
+
+    // Zig types are values: `const Point = struct { ... };` is counted by
+    // its `struct`, which may as well be returned from a generic function
+    fn classify(&self, node: &Node, _source: &[u8]) -> Option<Declaration> {
+        use Tally::{Function, KindOnly, Type};
+        match node.kind() {
+            "function_declaration" if is_zig_method(node) => Declaration::new("method", Function),
+            "function_declaration" => Declaration::new("function", Function),
+            "test_declaration" => Declaration::new("test", Function),
+            "struct_declaration" => Declaration::new("struct", Type),
+            "union_declaration" => Declaration::new("union", Type),
+            "enum_declaration" => Declaration::new("enum", Type),
+            "opaque_declaration" => Declaration::new("opaque", Type),
+            "error_set_declaration" => Declaration::new("error_set", KindOnly),
+            "comptime_declaration" => Declaration::new("comptime", KindOnly),
+            _ => None,
+        }
+    }
+
+    fn is_block(&self, kind: &str) -> bool {
+        kind == "block"
+    }
+
+    fn public_declaration(&self, node: &Node, source: &[u8]) -> Option<bool> {
+        zig_declaration(node, source)
+    }
+
+    // Declarations and fields of files and containers, and the
+    // statements of blocks
+    fn is_logical_line(&self, node: &Node, parent: Option<Node>) -> bool {
+        let kind = node.kind();
+        let parent_kind = parent.map(|parent| parent.kind()).unwrap_or_default();
+        matches!(
+            parent_kind,
+            "source_file"
+                | "block"
+                | "struct_declaration"
+                | "union_declaration"
+                | "enum_declaration"
+                | "opaque_declaration"
+        ) && kind != "block"
+    }
+
+    // Unit tests live next to the code in `test` blocks, so only the files in
+    // test directories are recognized
+    fn is_test_name(&self, _name: &str, _stem: &str) -> Option<bool> {
+        Some(false)
+    }
+}
+
+fn zig_declaration(node: &Node, source: &[u8]) -> Option<bool> {
+    if !matches!(node.kind(), "function_declaration" | "variable_declaration") {
+        return None;
+    }
+    // A file is a struct itself, whose `pub` declarations are its API
+    let parent = node.parent()?;
+    if parent.kind() != "source_file" && !systems::is_zig_container(&parent) {
+        return None;
+    }
+    if !systems::is_zig_pub(node) {
+        return None;
+    }
+
+    let documented = preceding_comment(node, &ZIG_MODIFIERS)
+        .and_then(|comment| comment.utf8_text(source).ok())
+        .is_some_and(|text| text.starts_with("///") && !text.starts_with("////"));
+    Some(documented)
+}
+
+/// Returns true if a Zig function is declared in the body of a struct,
+/// union, enum, or opaque type, whether or not it takes the type as `self`.
+fn is_zig_method(node: &Node) -> bool {
+    node.parent().is_some_and(|parent| {
+        matches!(
+            parent.kind(),
+            "struct_declaration" | "union_declaration" | "enum_declaration" | "opaque_declaration"
+        )
+    })
+}
@@ -0,0 +1,287 @@
+//! Markdown documents: prose lines and the code blocks fenced in them.
+//!
+//! A fenced block whose info string names a supported language (` ```go `,
+//! ` ```py `) is extracted and analyzed in that language, so examples in the
+//! documentation count toward the language they are written in. The fence
+//! lines around such a block are markup, and its content is left out of the
+//! document's own line counts. Blocks in other or no languages stay in the
+//! document as code lines.
+
+use crate::comments::LineStats;
+use crate::detect::language_from_alias;
+use crate::language::SupportedLanguage;
+use crate::parser::{CodeStats, child_of_kind};
+use crate::tokens::TokenStats;
+use serde::{Deserialize, Serialize};
+use tree_sitter::Node;
+
+/// Code from the blocks of one language inside a document: the fenced
+/// blocks of Markdown, or the Lua of configuration files.
+#[derive(Default, Debug, Clone, Serialize, Deserialize)]
+pub struct EmbeddedCode {
+    /// Number of blocks in the language
+    pub blocks: usize,
+    /// Statistics of the blocks combined, with lines numbered as in the
+    /// document
+    pub stats: CodeStats,
+}
+
+impl EmbeddedCode {
+    /// Adds the statistics of one more block.
+    ///
+    /// # Arguments
+    ///
+    /// * `stats` - Statistics of the block on its own
+    /// * `first_line` - 0-based line of the document the block's code starts on
+    pub(crate) fn add_block(&mut self, mut stats: CodeStats, first_line: usize) {
+        for function in &mut stats.functions {
+            function.start_line += first_line;
+            function.end_line += first_line;
+        }
+        for declaration in &mut stats.types {
+            declaration.start_line += first_line;
+            declaration.end_line += first_line;
+        }
+        for statement in &mut stats.statements {
+            statement.start_line += first_line;
+            statement.end_line += first_line;
+        }
+
+        // The document's own counts already cover the code of its blocks
+        stats.tokens = TokenStats::default();
+
+        self.blocks += 1;
+        self.stats.merge(&stats);
+        self.stats.functions.append(&mut stats.functions);
+        self.stats.types.append(&mut stats.types);
+        self.stats.statements.append(&mut stats.statements);
+        self.stats.plugin_errors.append(&mut stats.plugin_errors);
+    }
+}
+
+/// A block of embedded code that can be analyzed.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) struct CodeBlock<'a> {
+    /// Language named in the fence, or of the embedded code
+    pub language: SupportedLanguage,
+    /// The code between the fence lines or delimiters
+    pub code: &'a str,
+    /// 0-based line of the document the code starts on
+    pub first_line: usize,
+}
+
+/// Lists the fenced blocks of a Markdown document that are in a supported
+/// language, in source order.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the tree parsed from `source`
+/// * `source` - The Markdown document
+pub(crate) fn code_blocks<'a>(root: &Node, source: &'a str) -> Vec<CodeBlock<'a>> {
+    let mut blocks = Vec::new();
+    collect_code_blocks(root, source, &mut blocks);
+    blocks
+}
+
+fn collect_code_blocks<'a>(node: &Node, source: &'a str, blocks: &mut Vec<CodeBlock<'a>>) {
+    if node.kind() == "fenced_code_block" {
+        // An empty block has no content node and nothing to analyze
+        if let Some(language) = fence_language(node, source)
+            && let Some(content) = child_of_kind(node, "code_fence_content")
+        {
+            blocks.push(CodeBlock {
+                language,
+                code: &source[content.byte_range()],
+                first_line: content.start_position().row,
+            });
+        }
+        return;
+    }
+
+    let mut cursor = node.walk();
+    for child in node.children(&mut cursor) {
+        collect_code_blocks(&child, source, blocks);
+    }
+}
+
+/// Returns the supported language named in the info string of a fenced
+/// block, such as `go` in ` ```go title="main.go" `.
+///
+/// Markdown inside Markdown (` ```md `) is an example of the syntax rather
+/// than code and is not extracted.
+fn fence_language(node: &Node, source: &str) -> Option<SupportedLanguage> {
+    let info = child_of_kind(node, "info_string")?;
+    let name = child_of_kind(&info, "language")?
+        .utf8_text(source.as_bytes())
+        .ok()?;
+    language_from_alias(name).filter(|language| *language != SupportedLanguage::Markdown)
+}
+
+/// What a line of a Markdown document counts as.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum MarkdownLine {
+    Prose,
+    Code,
+    Markup,
+    /// Code of an extracted block, counted in its own language instead
+    Extracted,
+}
+
+/// Classifies every line of a Markdown document.
+///
+/// Text is prose, fence lines and HTML blocks are markup, and code blocks
+/// that are not extracted (indented blocks and fences without a supported
+/// language) are code. The content of extracted blocks, blank lines
+/// included, is not counted here at all.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the tree parsed from `source`
+/// * `source` - The Markdown document
+pub(crate) fn count_markdown_lines(root: &Node, source: &str) -> LineStats {
+    let lines: Vec<&str> = source.split_inclusive('\n').collect();
+    let mut kinds = vec![MarkdownLine::Prose; lines.len()];
+    classify_lines(root, source, &mut kinds);
+
+    let mut stats = LineStats::default();
+    for (line, kind) in lines.iter().zip(kinds) {
+        match kind {
+            MarkdownLine::Extracted => {}
+            _ if line.trim().is_empty() => stats.blank += 1,
+            MarkdownLine::Prose => stats.prose += 1,
+            MarkdownLine::Code => stats.code += 1,
+            MarkdownLine::Markup => stats.markup += 1,
+        }
+    }
+    stats
+}
+
+fn classify_lines(node: &Node, source: &str, kinds: &mut [MarkdownLine]) {
+    let mut mark = |node: &Node, kind| {
+        for line in line_span(node) {
+            if let Some(slot) = kinds.get_mut(line) {
+                *slot = kind;
+            }
+        }
+    };
+
+    match node.kind() {
+        "fenced_code_block" if fence_language(node, source).is_some() => {
+            mark(node, MarkdownLine::Markup);
+            if let Some(content) = child_of_kind(node, "code_fence_content") {
+                mark(&content, MarkdownLine::Extracted);
+            }
+        }
+        "fenced_code_block" | "indented_code_block" => mark(node, MarkdownLine::Code),
+        "html_block" => mark(node, MarkdownLine::Markup),
+        _ => {
+            let mut cursor = node.walk();
+            for child in node.children(&mut cursor) {
+                classify_lines(&child, source, kinds);
+            }
+        }
+    }
+}
+
+/// Returns the 0-based lines a block node covers.
+///
+/// Markdown blocks end after their last newline, so a node ending at the
+/// start of a line does not cover that line.
+fn line_span(node: &Node) -> std::ops::Range<usize> {
+    let start = node.start_position();
+    let end = node.end_position();
+    if end.column == 0 && end.row > start.row {
+        start.row..end.row
+    } else {
+        start.row..end.row + 1
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::create_parser;
+
+    const GUIDE: &str = r#"# Getting started
+
+Install the client and call it:
+
+```go
+package main
+
+func main() {
+	run()
+}
+```
+
+<div class="note">Requires Go 1.22.</div>
+
+```text
+plain output
+```
+
+    indented example
+"#;
+
+    fn parse(source: &str) -> tree_sitter::Tree {
+        create_parser(&SupportedLanguage::Markdown)
+            .unwrap()
+            .parse(source, None)
+            .unwrap()
+    }
+
+    #[test]
+    fn test_code_blocks_use_fence_language() {
+        let tree = parse(GUIDE);
+        let blocks = code_blocks(&tree.root_node(), GUIDE);
+
+        assert_eq!(blocks.len(), 1);
+        assert_eq!(blocks[0].language, SupportedLanguage::Go);
+        assert_eq!(blocks[0].first_line, 5);
+        assert!(blocks[0].code.starts_with("package main\n"));
+        assert!(blocks[0].code.ends_with("}\n"));
+    }
+
+    #[test]
+    fn test_count_markdown_lines() {
+        let tree = parse(GUIDE);
+        let lines = count_markdown_lines(&tree.root_node(), GUIDE);
+
+        // Heading and paragraph; the Go fences and the HTML block; the text
+        // fence with its content and the indented block
+        assert_eq!(lines.prose, 2);
+        assert_eq!(lines.markup, 3);
+        assert_eq!(lines.code, 4);
+        assert_eq!(lines.blank, 5);
+        assert_eq!(lines.comment, 0);
+    }
+
+    #[test]
+    fn test_add_block_renumbers_lines() {
+        let block = |name: &str, start_line| CodeStats {
+            function_count: 1,
+            functions: vec![crate::parser::FunctionStats {
+                name: name.to_string(),
+                start_line,
+                end_line: start_line + 2,
+                complexity: 1,
+                ..Default::default()
+            }],
+            ..Default::default()
+        };
+
+        let mut embedded = EmbeddedCode::default();
+        embedded.add_block(block("main", 3), 5);
+        embedded.add_block(block("helper", 1), 20);
+
+        assert_eq!(embedded.blocks, 2);
+        assert_eq!(embedded.stats.function_count, 2);
+        let lines: Vec<_> = embedded
+            .stats
+            .functions
+            .iter()
+            .map(|f| (f.name.as_str(), f.start_line, f.end_line))
+            .collect();
+        assert_eq!(lines, vec![("main", 8, 10), ("helper", 21, 23)]);
+    }
+}
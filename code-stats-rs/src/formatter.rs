@@ -1,7 +1,468 @@
-//! Output formatting for code statistics in Summary, Detail, and JSON formats.
+//! Output formatting for code statistics in Summary, Detail, JSON, SARIF, HTML, Markdown, CSV, and Prometheus formats.
 
-use crate::cli::OutputFormat;
-use crate::stats::{DirectoryStats, FileStats};
+use crate::annotations::{
+    format_findings_codequality, format_findings_github, format_github_annotations,
+    format_gitlab_codequality,
+};
+use crate::calls::{CallGraph, CallNode};
+use crate::cli::{FunctionSort, Level, OutputFormat, TopMetric};
+use crate::closures::ClosureStats;
+use crate::comments::{DocCoverage, LineStats, is_zero};
+use crate::component::ComponentStats;
+use crate::configuration::ConfigStats;
+use crate::csv::{format_csv, format_history_csv, format_workspace_csv};
+use crate::diff::{ChangeStatus, DiffReport, FunctionMetrics};
+use crate::distribution::{Distribution, DistributionReport};
+use crate::duplicates::DuplicateReport;
+use crate::fences::EmbeddedCode;
+use crate::generics::GenericsStats;
+use crate::golang::{ApiKind, GoStats};
+use crate::graphql::{self, GraphqlStats, SchemaEntry};
+use crate::handling::ErrorHandlingStats;
+use crate::history::HistoryPoint;
+use crate::hotspots::Hotspot;
+use crate::html::format_html;
+use crate::identifiers::IdentifierReport;
+use crate::imports::DependencyGraph;
+use crate::interfaces::InterfaceReport;
+use crate::language::SupportedLanguage;
+use crate::license::LicenseReport;
+use crate::lint::{Finding, RuleDefinition, Severity, count};
+use crate::markdown::{format_diff_markdown, format_markdown};
+use crate::notebook::NotebookStats;
+use crate::ownership::Ownership;
+use crate::parser::{CodeStats, StatementStats};
+use crate::profile::ProfileReport;
+use crate::prometheus::format_prometheus;
+use crate::proto::RpcStats;
+use crate::rollup::{DirectoryRollup, TypeRollup};
+use crate::sarif::{format_findings_sarif, format_sarif};
+use crate::stats::{
+    ConfigurationStats, DirectoryStats, FileStats, FunctionRef, GeneratedStats, LanguageStats,
+    TestStats, Thresholds,
+};
+use crate::strings::StringLiteral;
+use crate::switches::SwitchStats;
+use crate::templates::TemplateStats;
+use crate::terraform::TerraformStats;
+use crate::todos::TodoItem;
+use crate::tokens::{TokenReport, TokenRow};
+use crate::versions::{GrammarInfo, crate_version};
+use crate::web::WebStats;
+use crate::workspace::{RepositoryTotals, WorkspaceReport};
+use serde::Serialize;
+use std::collections::{BTreeMap, BTreeSet};
+use std::path::PathBuf;
+use std::time::Duration;
+
+/// Number of statements listed under `Longest statements:` for an SQL file.
+const LONGEST_STATEMENTS: usize = 3;
+
+/// Number of files listed under `Largest configuration files:`.
+const LARGEST_CONFIG_FILES: usize = 3;
+
+/// Number of statements listed under `Largest switches:`.
+const LARGEST_SWITCHES: usize = 3;
+
+/// Number of functions listed under `Unhandled fallible calls:`.
+const UNHANDLED_FUNCTIONS: usize = 5;
+
+/// Width, in characters, of the largest bar of a `--distribution` histogram.
+const HISTOGRAM_WIDTH: usize = 40;
+
+/// Number of files named on the `Undecodable:` line of the summary.
+const UNDECODABLE_FILES: usize = 3;
+
+/// Number of files named on the `Not parsed:` line of the summary.
+const OVERSIZED_FILES: usize = 3;
+
+/// Number of files named on the `Timed out:` line of the summary.
+const TIMED_OUT_FILES: usize = 3;
+
+/// Number of files named on the `Plugin errors:` line of the summary.
+const PLUGIN_ERROR_FILES: usize = 3;
+
+/// Version of the JSON report schema produced by `--format json`.
+///
+/// Bump this whenever a field is renamed, removed, or changes meaning so that
+/// consumers can detect incompatible reports. Adding new fields does not
+/// require a bump.
+pub(crate) const JSON_SCHEMA_VERSION: u32 = 1;
+
+/// Version of code-stats-rs recorded in every JSON report next to
+/// `JSON_SCHEMA_VERSION`, so that a change in the numbers between two
+/// reports can be told apart from a change in how they are counted.
+pub(crate) const ANALYZER_VERSION: &str = env!("CARGO_PKG_VERSION");
+
+/// Top-level structure of the JSON report.
+///
+/// Files are sorted by path and languages by name so that the same input
+/// always serializes to the same output.
+#[derive(Serialize)]
+struct JsonReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// Per-file section: statistics for each analyzed file
+    files: Vec<&'a FileStats>,
+    /// Aggregate section: statistics grouped by programming language
+    total_by_language: BTreeMap<SupportedLanguage, &'a LanguageStats>,
+    /// Aggregate section: totals across all files and languages
+    total_stats: &'a CodeStats,
+    /// Aggregate section: totals of the configuration files, which are not
+    /// part of `total_by_language` and `total_stats`
+    #[serde(skip_serializing_if = "Option::is_none")]
+    configuration: Option<&'a ConfigurationStats>,
+    /// Aggregate section: totals of the generated and vendored files, which
+    /// are not part of `total_by_language` and `total_stats`
+    #[serde(skip_serializing_if = "Option::is_none")]
+    generated: Option<&'a GeneratedStats>,
+    /// Aggregate section: totals of the test files, which are part of
+    /// `total_by_language` and `total_stats`
+    #[serde(skip_serializing_if = "Option::is_none")]
+    tests: Option<TestReport<'a>>,
+    /// Number of files included in the report
+    total_files: usize,
+    /// Percentage of files parsed without ERROR or MISSING nodes
+    parse_health: f64,
+    /// Files skipped because they are not text in a supported encoding
+    #[serde(skip_serializing_if = "<[_]>::is_empty")]
+    undecodable: &'a [PathBuf],
+    /// Files above the parse size limit, whose lines were counted without
+    /// parsing them
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    oversized: Vec<PathBuf>,
+    /// Files skipped because parsing them took longer than the parse timeout
+    #[serde(skip_serializing_if = "<[_]>::is_empty")]
+    timed_out: &'a [PathBuf],
+    /// Whether the analysis was interrupted before every file was analyzed
+    #[serde(skip_serializing_if = "std::ops::Not::not")]
+    incomplete: bool,
+    /// Number of files left unanalyzed by the interruption
+    #[serde(skip_serializing_if = "is_zero")]
+    interrupted: usize,
+    /// Aggregate section: repository-wide complexity metrics
+    complexity: ComplexityReport<'a>,
+}
+
+/// Test code summary included in the JSON report.
+#[derive(Serialize)]
+struct TestReport<'a> {
+    #[serde(flatten)]
+    totals: &'a TestStats,
+    /// Lines of test code per line of production code, null without
+    /// production code
+    ratio: Option<f64>,
+}
+
+/// Complexity summary included in the JSON report.
+#[derive(Serialize)]
+struct ComplexityReport<'a> {
+    /// Highest cyclomatic complexity of any function
+    max: usize,
+    /// Mean cyclomatic complexity across all functions
+    mean: f64,
+    /// Deepest control-flow nesting of any function
+    max_nesting: usize,
+    /// Highest cognitive complexity of any function
+    max_cognitive: usize,
+    /// Lowest maintainability index of any function, null without functions
+    min_maintainability: Option<f64>,
+    /// Threshold used to select offenders
+    threshold: usize,
+    /// Functions above the threshold, most complex first
+    offenders: Vec<FunctionRef<'a>>,
+}
+
+/// Top-level structure of the `--functions --format json` report.
+#[derive(Serialize)]
+struct FunctionsReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// Every function, in the requested sort order
+    functions: Vec<FunctionRow<'a>>,
+}
+
+/// A single entry of the function listing.
+#[derive(Serialize)]
+struct FunctionRow<'a> {
+    path: &'a std::path::Path,
+    name: &'a str,
+    qualified_name: &'a str,
+    start_line: usize,
+    end_line: usize,
+    lines: usize,
+    parameters: usize,
+    returns: usize,
+    complexity: usize,
+    nesting: usize,
+    cognitive: usize,
+    volume: f64,
+    effort: f64,
+    maintainability: f64,
+}
+
+/// Top-level structure of the `--proto-inventory --format json` report.
+#[derive(Serialize)]
+struct ProtoInventoryReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// Every service, ordered by file and line
+    services: Vec<ServiceRow<'a>>,
+}
+
+/// Top-level structure of the `--graphql-schema --format json` report.
+#[derive(Serialize)]
+struct GraphqlSchemaReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// Every type of the schema with its definition and extensions
+    types: Vec<SchemaEntry<'a>>,
+}
+
+/// A single service of the inventory with the file it is declared in.
+#[derive(Serialize)]
+struct ServiceRow<'a> {
+    path: &'a std::path::Path,
+    name: &'a str,
+    start_line: usize,
+    methods: &'a [RpcStats],
+}
+
+/// Top-level structure of the `--todos --format json` report.
+#[derive(Serialize)]
+struct TodoReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// Marked comments, ordered by path and line
+    todos: &'a [TodoItem],
+    /// Number of comments per marker
+    counts: BTreeMap<&'a str, usize>,
+}
+
+/// Top-level structure of the `--tokens --format json` report.
+#[derive(Serialize)]
+struct TokensReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    #[serde(flatten)]
+    report: &'a TokenReport,
+}
+
+/// Top-level structure of the `--distribution --format json` report.
+#[derive(Serialize)]
+struct DistributionsReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    #[serde(flatten)]
+    report: &'a DistributionReport,
+}
+
+/// Top-level structure of the `hotspots --format json` report.
+#[derive(Serialize)]
+struct HotspotsReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// Number of files with a score, before the limit was applied
+    total: usize,
+    /// The highest ranked files, first place first
+    hotspots: Vec<HotspotEntry<'a>>,
+}
+
+/// A single entry of the `hotspots` ranking.
+#[derive(Serialize)]
+struct HotspotEntry<'a> {
+    /// 1-based position in the ranking
+    rank: usize,
+    #[serde(flatten)]
+    hotspot: &'a Hotspot,
+}
+
+/// Top-level structure of the `--by-author --format json` report.
+#[derive(Serialize)]
+struct OwnershipReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    #[serde(flatten)]
+    ownership: &'a Ownership,
+}
+
+/// Top-level structure of the `history --format json` report.
+#[derive(Serialize)]
+struct HistoryReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// The metrics of each date, oldest first
+    points: &'a [HistoryPoint],
+}
+
+/// Top-level structure of the `workspace --format json` report.
+#[derive(Serialize)]
+struct WorkspaceJson<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    #[serde(flatten)]
+    report: &'a WorkspaceReport,
+}
+
+/// Top-level structure of the `languages --format json` report.
+#[derive(Serialize)]
+struct LanguagesReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// Version of the tree-sitter runtime, if recorded at build time
+    tree_sitter: Option<&'static str>,
+    /// Oldest grammar ABI version the runtime can load
+    min_abi: usize,
+    /// Newest grammar ABI version the runtime can load
+    max_abi: usize,
+    grammars: &'a [GrammarInfo],
+}
+
+/// Top-level structure of the `--strings --format json` report.
+#[derive(Serialize)]
+struct StringsReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// Number of files with at least one listed literal
+    files: usize,
+    /// User-facing literals, in file and source order
+    strings: &'a [StringLiteral],
+}
+
+/// Top-level structure of the `--identifiers --format json` report.
+#[derive(Serialize)]
+struct IdentifiersReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    #[serde(flatten)]
+    report: &'a IdentifierReport,
+}
+
+/// Top-level structure of the `--licenses --format json` report.
+#[derive(Serialize)]
+struct LicensesReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    #[serde(flatten)]
+    report: &'a LicenseReport,
+}
+
+/// Top-level structure of the `--lint --format json` report.
+#[derive(Serialize)]
+struct LintReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    errors: usize,
+    warnings: usize,
+    notes: usize,
+    /// Findings, in file and source order
+    findings: &'a [Finding],
+}
+
+/// Top-level structure of the `--call-graph --format json` report.
+#[derive(Serialize)]
+struct CallGraphReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// Functions and the calls between them
+    #[serde(flatten)]
+    graph: &'a CallGraph,
+}
+
+/// Top-level structure of the `--unreached --format json` report.
+#[derive(Serialize)]
+struct UnreachedReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// Number of functions in the call graph
+    functions: usize,
+    /// Functions that nothing calls and that are not entry points
+    unreached: Vec<&'a CallNode>,
+}
+
+/// Top-level structure of the `--deps --format json` report.
+#[derive(Serialize)]
+struct DependencyReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// Modules, dependencies, and cycles
+    #[serde(flatten)]
+    graph: &'a DependencyGraph,
+}
+
+/// Top-level structure of the `--api-surface --format json` report.
+#[derive(Serialize)]
+struct ApiSurfaceReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// Go packages, ordered by directory and name
+    packages: Vec<PackageRow<'a>>,
+    /// Exported declarations across all packages
+    exported: usize,
+    /// Unexported declarations across all packages
+    unexported: usize,
+}
+
+/// A Go package of the API surface report: the files of one directory that
+/// share a package clause.
+#[derive(Serialize)]
+struct PackageRow<'a> {
+    name: &'a str,
+    directory: &'a std::path::Path,
+    /// Exported declarations, ordered by kind and name
+    symbols: Vec<ApiRow<'a>>,
+    exported: usize,
+    unexported: usize,
+}
+
+/// An exported declaration with the file it is declared in.
+#[derive(Serialize)]
+struct ApiRow<'a> {
+    kind: ApiKind,
+    name: &'a str,
+    path: &'a std::path::Path,
+    line: usize,
+}
 
 /// Formats directory statistics according to the specified output format.
 ///
@@ -11,8 +472,10 @@ use crate::stats::{DirectoryStats, FileStats};
 /// # Arguments
 ///
 /// * `stats` - Directory statistics containing aggregated results from all analyzed files
-/// * `format` - The desired output format (Summary, Detail, or JSON)
+/// * `format` - The desired output format (Summary, Detail, JSON, SARIF, HTML, Markdown, CSV,
+///   Prometheus, or a CI annotation format)
 /// * `_show_detail` - Currently unused parameter (reserved for future functionality)
+/// * `thresholds` - Limits used to flag offending functions
 ///
 /// # Returns
 ///
@@ -21,398 +484,6357 @@ pub(crate) fn format_output(
     stats: &DirectoryStats,
     format: OutputFormat,
     _show_detail: bool,
+    thresholds: &Thresholds,
 ) -> String {
     match format {
-        OutputFormat::Summary => format_summary(stats),
-        OutputFormat::Detail => format_detail(stats),
-        OutputFormat::Json => format_json(stats),
+        OutputFormat::Summary => format_summary(stats) + &format_complexity(stats, thresholds),
+        OutputFormat::Detail => format_detail(stats) + &format_complexity(stats, thresholds),
+        OutputFormat::Json => format_json(stats, thresholds),
+        OutputFormat::Sarif => format_sarif(stats, thresholds),
+        OutputFormat::Html => format_html(stats, thresholds),
+        OutputFormat::Markdown => format_markdown(stats, thresholds),
+        // Only the dependency graph has a DOT form; the CLI rejects it
+        // without `--deps`
+        OutputFormat::Dot => format_summary(stats) + &format_complexity(stats, thresholds),
+        OutputFormat::Csv => format_csv(stats, Level::File),
+        OutputFormat::Prometheus => format_prometheus(stats, thresholds),
+        OutputFormat::GithubAnnotations => format_github_annotations(stats, thresholds),
+        OutputFormat::GitlabCodequality => format_gitlab_codequality(stats, thresholds),
     }
 }
 
-/// Formats statistics for a single file analysis.
+/// Formats the per-function listing used by `--functions`.
 ///
-/// This function is used when analyzing individual files rather than entire directories.
-/// It provides a clear, human-readable summary of the code statistics for the specific file.
+/// Text formats render an aligned table with one row per function; JSON
+/// emits a versioned report with the same columns.
 ///
 /// # Arguments
 ///
-/// * `file_stats` - Statistics for a single file including path, language, and counts
+/// * `stats` - Statistics whose per-file function metrics are listed
+/// * `format` - `Json` for machine-readable output, anything else for a table
+/// * `sort` - Column to order the rows by
 ///
 /// # Returns
 ///
-/// A formatted string containing the file path, detected language, and code statistics
-pub(crate) fn format_single_file(file_stats: &FileStats) -> String {
-    format!(
-        "Analyzing file: {} (Language: {:?})\n\
-         Code Statistics:\n\
-         Functions: {}\n\
-         Classes/Structs: {}",
-        file_stats.path.display(),
-        file_stats.language,
-        file_stats.stats.function_count,
-        file_stats.stats.class_struct_count
-    )
+/// A formatted string ready for display or further processing
+pub(crate) fn format_functions(
+    stats: &DirectoryStats,
+    format: OutputFormat,
+    sort: FunctionSort,
+) -> String {
+    let mut functions: Vec<FunctionRef> = stats.functions().collect();
+    sort_functions(&mut functions, sort);
+
+    if format == OutputFormat::Json {
+        let report = FunctionsReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            functions: functions
+                .iter()
+                .map(|f| FunctionRow {
+                    path: f.path,
+                    name: &f.function.name,
+                    qualified_name: &f.function.qualified_name,
+                    start_line: f.function.start_line,
+                    end_line: f.function.end_line,
+                    lines: f.function.line_count(),
+                    parameters: f.function.parameters,
+                    returns: f.function.returns,
+                    complexity: f.function.complexity,
+                    nesting: f.function.max_nesting,
+                    cognitive: f.function.cognitive,
+                    volume: f.function.halstead.volume,
+                    effort: f.function.halstead.effort,
+                    maintainability: f.function.maintainability,
+                })
+                .collect(),
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    if functions.is_empty() {
+        return "No functions found".to_string();
+    }
+
+    let locations: Vec<String> = functions
+        .iter()
+        .map(|f| {
+            format!(
+                "{}:{}-{}",
+                f.path.display(),
+                f.function.start_line,
+                f.function.end_line
+            )
+        })
+        .collect();
+    let name_width = functions
+        .iter()
+        .map(|f| f.function.qualified_name.len())
+        .chain(std::iter::once("Function".len()))
+        .max()
+        .unwrap_or_default();
+    let location_width = locations
+        .iter()
+        .map(String::len)
+        .chain(std::iter::once("Location".len()))
+        .max()
+        .unwrap_or_default();
+
+    let mut output = format!(
+        "{:name_width$}  {:location_width$}  {:>5}  {:>6}  {:>10}  {:>7}  {:>9}  {:>7}  {:>6}\n",
+        "Function",
+        "Location",
+        "Lines",
+        "Params",
+        "Complexity",
+        "Nesting",
+        "Cognitive",
+        "Volume",
+        "MI"
+    );
+    for (function, location) in functions.iter().zip(&locations) {
+        output.push_str(&format!(
+            "{:name_width$}  {:location_width$}  {:>5}  {:>6}  {:>10}  {:>7}  {:>9}  {:>7.0}  {:>6.1}\n",
+            function.function.qualified_name,
+            location,
+            function.function.line_count(),
+            function.function.parameters,
+            function.function.complexity,
+            function.function.max_nesting,
+            function.function.cognitive,
+            function.function.halstead.volume,
+            function.function.maintainability
+        ));
+    }
+    output.push_str(&format!("\n{} functions", functions.len()));
+
+    output
 }
 
-/// Formats directory statistics as a summary view.
+/// Formats the service listing used by `--proto-inventory`.
 ///
-/// Creates a concise overview showing aggregated statistics by programming language,
-/// followed by overall totals. Languages are sorted alphabetically for consistent output.
+/// Text formats list each service with its location, followed by one line
+/// per RPC method in the form of its `.proto` declaration; JSON emits a
+/// versioned report with the same data.
 ///
 /// # Arguments
 ///
-/// * `stats` - Directory statistics containing per-language aggregations
+/// * `stats` - Statistics whose per-file services are listed
+/// * `format` - `Json` for machine-readable output, anything else for text
 ///
 /// # Returns
 ///
-/// A formatted string with language-wise summaries and grand totals
+/// A formatted string ready for display or further processing
 ///
 /// # Output Format
 ///
 /// ```text
-/// Language Summary:
-///   Go:           15 functions,    3 structs/classes in 5 files
-///   Python:       8 functions,    2 structs/classes in 3 files
-///   Rust:         20 functions,   12 structs/classes in 8 files
+/// shop.v1.CartService (api/cart.proto:12)
+///   GetCart(GetCartRequest) returns (Cart)
+///   WatchCart(GetCartRequest) returns (stream Cart)
 ///
-/// Total: 43 functions, 17 structs/classes in 16 files
+/// 1 services, 2 methods
 /// ```
-fn format_summary(stats: &DirectoryStats) -> String {
+pub(crate) fn format_proto_inventory(stats: &DirectoryStats, format: OutputFormat) -> String {
+    let mut services: Vec<ServiceRow> = stats
+        .files
+        .iter()
+        .flat_map(|file| {
+            file.stats.services.iter().map(|service| ServiceRow {
+                path: &file.path,
+                name: &service.name,
+                start_line: service.start_line,
+                methods: &service.methods,
+            })
+        })
+        .collect();
+    services.sort_by(|a, b| (a.path, a.start_line).cmp(&(b.path, b.start_line)));
+
+    if format == OutputFormat::Json {
+        let report = ProtoInventoryReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            services,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    if services.is_empty() {
+        return "No services found".to_string();
+    }
+
+    let stream = |streaming: bool| if streaming { "stream " } else { "" };
     let mut output = String::new();
+    for service in &services {
+        output.push_str(&format!(
+            "{} ({}:{})\n",
+            service.name,
+            service.path.display(),
+            service.start_line
+        ));
+        for method in service.methods {
+            output.push_str(&format!(
+                "  {}({}{}) returns ({}{})\n",
+                method.name,
+                stream(method.client_streaming),
+                method.request,
+                stream(method.server_streaming),
+                method.response
+            ));
+        }
+    }
+    let methods: usize = services.iter().map(|service| service.methods.len()).sum();
+    output.push_str(&format!("\n{} services, {methods} methods", services.len()));
 
-    output.push_str("Language Summary:\n");
+    output
+}
 
-    // Sort languages alphabetically for consistent output ordering
-    let mut languages: Vec<_> = stats.total_by_language.iter().collect();
-    languages.sort_by_key(|(lang, _)| format!("{lang:?}"));
+/// Formats the schema assembled from every GraphQL file for
+/// `--graphql-schema`.
+///
+/// Each type is listed once with the files and lines defining and extending
+/// it, followed by its fields with their arguments and types in the order of
+/// those locations; JSON emits a versioned report with the same data.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics whose GraphQL files are assembled
+/// * `format` - `Json` for machine-readable output, anything else for text
+///
+/// # Output Format
+///
+/// ```text
+/// type Query (schema/schema.graphql:1, schema/cart.graphql:8)
+///   viewer: User
+///   cart(id: ID!): Cart
+///
+/// 1 types, 2 fields
+/// ```
+pub(crate) fn format_graphql_schema(stats: &DirectoryStats, format: OutputFormat) -> String {
+    let types = graphql::schema(stats);
 
-    // Format each language's statistics with aligned columns
-    for (language, lang_stats) in languages {
+    if format == OutputFormat::Json {
+        let report = GraphqlSchemaReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            types,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    if types.is_empty() {
+        return "No schema types found".to_string();
+    }
+
+    let mut output = String::new();
+    for entry in &types {
+        let locations: Vec<String> = entry
+            .locations
+            .iter()
+            .map(|location| format!("{}:{}", location.path.display(), location.line))
+            .collect();
+        let implements = if entry.interfaces.is_empty() {
+            String::new()
+        } else {
+            format!(" implements {}", entry.interfaces.join(" & "))
+        };
+        let extended = if entry.defined { "" } else { "extend " };
         output.push_str(&format!(
-            "  {:12} {:4} functions, {:4} structs/classes in {} files\n",
-            format!("{:?}:", language),
-            lang_stats.function_count,
-            lang_stats.class_struct_count,
-            lang_stats.file_count
+            "{extended}{} {}{implements} ({})\n",
+            entry.kind,
+            entry.name,
+            locations.join(", ")
         ));
+        for field in &entry.fields {
+            output.push_str(&format!("  {}\n", field.signature));
+        }
     }
+    let fields: usize = types.iter().map(|entry| entry.fields.len()).sum();
+    output.push_str(&format!("\n{} types, {fields} fields", types.len()));
 
-    // Add grand totals at the end
+    output
+}
+
+/// Formats the exported API of every Go package for `--api-surface`.
+///
+/// A package is the set of Go files in one directory with the same package
+/// clause. Text formats list each package's exported types, functions,
+/// methods, and constants with their location and the share of top-level
+/// declarations that are exported; JSON emits a versioned report with the
+/// same data.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics whose Go files are listed
+/// * `format` - `Json` for machine-readable output, anything else for text
+///
+/// # Output Format
+///
+/// ```text
+/// main (tests/fixtures)
+///   type Person (tests/fixtures/test.go:5)
+///   method Person.Greet (tests/fixtures/test.go:10)
+///   2 exported, 2 unexported (50% exported)
+///
+/// 1 package: 2 exported, 2 unexported (50% exported)
+/// ```
+pub(crate) fn format_api_surface(stats: &DirectoryStats, format: OutputFormat) -> String {
+    let mut packages: BTreeMap<(&std::path::Path, &str), PackageRow> = BTreeMap::new();
+    for file in stats.code_file_stats() {
+        let Some(go) = &file.stats.go else {
+            continue;
+        };
+        let directory = match file.path.parent() {
+            Some(parent) if !parent.as_os_str().is_empty() => parent,
+            _ => std::path::Path::new("."),
+        };
+        let package = packages
+            .entry((directory, go.package.as_str()))
+            .or_insert_with(|| PackageRow {
+                name: &go.package,
+                directory,
+                symbols: Vec::new(),
+                exported: 0,
+                unexported: 0,
+            });
+        package.exported += go.exported;
+        package.unexported += go.unexported;
+        package.symbols.extend(
+            go.api
+                .iter()
+                .filter(|symbol| symbol.exported)
+                .map(|symbol| ApiRow {
+                    kind: symbol.kind,
+                    name: &symbol.name,
+                    path: &file.path,
+                    line: symbol.line,
+                }),
+        );
+    }
+    let mut packages: Vec<PackageRow> = packages.into_values().collect();
+    for package in &mut packages {
+        package.symbols.sort_by(|a, b| {
+            (a.kind, a.name, a.path, a.line).cmp(&(b.kind, b.name, b.path, b.line))
+        });
+    }
+    let exported = packages.iter().map(|package| package.exported).sum();
+    let unexported = packages.iter().map(|package| package.unexported).sum();
+
+    if format == OutputFormat::Json {
+        let report = ApiSurfaceReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            packages,
+            exported,
+            unexported,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    if packages.is_empty() {
+        return "No Go packages found".to_string();
+    }
+
+    let mut output = String::new();
+    for package in &packages {
+        output.push_str(&format!(
+            "{} ({})\n",
+            package.name,
+            package.directory.display()
+        ));
+        for symbol in &package.symbols {
+            output.push_str(&format!(
+                "  {} {} ({}:{})\n",
+                symbol.kind,
+                symbol.name,
+                symbol.path.display(),
+                symbol.line
+            ));
+        }
+        output.push_str(&format!(
+            "  {}\n\n",
+            format_exported(package.exported, package.unexported)
+        ));
+    }
     output.push_str(&format!(
-        "\nTotal: {} functions, {} structs/classes in {} files",
-        stats.total_stats.function_count,
-        stats.total_stats.class_struct_count,
-        stats.total_files()
+        "{} package{}: {}",
+        packages.len(),
+        if packages.len() == 1 { "" } else { "s" },
+        format_exported(exported, unexported)
     ));
 
     output
 }
 
-/// Formats directory statistics as a detailed view.
+/// Top-level structure of the `--implementations --format json` report.
+#[derive(Serialize)]
+struct ImplementationsReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// Interfaces, the most implemented first
+    interfaces: &'a [InterfaceReport],
+}
+
+/// Formats the interface inventory of `--implementations`.
 ///
-/// Provides comprehensive output showing individual file statistics followed by
-/// the summary view. Files are sorted by path for deterministic output ordering.
+/// Text formats list each interface with its location and number of
+/// implementations, followed by one line per implementing type; types found
+/// by a Go method set rather than a declared clause are marked as such.
 ///
 /// # Arguments
 ///
-/// * `stats` - Directory statistics containing individual file results
+/// * `interfaces` - Interfaces in the order they are listed
+/// * `format` - `Json` for machine-readable output, anything else for text
 ///
 /// # Returns
 ///
-/// A formatted string with per-file details and summary statistics
+/// A formatted string ready for display or further processing
 ///
 /// # Output Format
 ///
 /// ```text
-/// src/main.rs (Rust):
-///   Functions: 3
-///   Structs/Classes: 2
-///
-/// src/lib.rs (Rust):
-///   Functions: 5
-///   Structs/Classes: 1
+/// Shape (interface, shapes/shape.go:3): 2 implementations
+///   Circle (shapes/circle.go:5, by method set)
+///   Square (shapes/square.go:4, by method set)
+/// Draw (trait, src/draw.rs:1): 0 implementations
 ///
-/// Language Summary:
-/// [... summary content ...]
+/// 2 interfaces, 2 implementations
 /// ```
-fn format_detail(stats: &DirectoryStats) -> String {
-    let mut output = String::new();
-
-    // Sort files by path for consistent, deterministic output
-    let mut files = stats.files.clone();
-    files.sort_by(|a, b| a.path.cmp(&b.path));
+pub(crate) fn format_implementations(
+    interfaces: &[InterfaceReport],
+    format: OutputFormat,
+) -> String {
+    if format == OutputFormat::Json {
+        let report = ImplementationsReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            interfaces,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+    if interfaces.is_empty() {
+        return "No interfaces found".to_string();
+    }
 
-    // Display individual file statistics
-    for file in &files {
+    let mut output = String::new();
+    for interface in interfaces {
         output.push_str(&format!(
-            "{} ({:?}):\n  Functions: {}\n  Structs/Classes: {}\n\n",
-            file.path.display(),
-            file.language,
-            file.stats.function_count,
-            file.stats.class_struct_count
+            "{} ({}, {}:{}): {} implementations\n",
+            interface.name,
+            interface.kind,
+            interface.path.display(),
+            interface.start_line,
+            interface.implementors.len()
         ));
+        for implementor in &interface.implementors {
+            let inferred = if implementor.inferred {
+                ", by method set"
+            } else {
+                ""
+            };
+            output.push_str(&format!(
+                "  {} ({}:{}{inferred})\n",
+                implementor.name,
+                implementor.path.display(),
+                implementor.line
+            ));
+        }
     }
-
-    // Append summary statistics at the end
-    output.push_str(&format_summary(stats));
-
+    let implementations: usize = interfaces.iter().map(|i| i.implementors.len()).sum();
+    output.push_str(&format!(
+        "\n{} interfaces, {implementations} implementations",
+        interfaces.len()
+    ));
     output
 }
 
-/// Formats directory statistics as JSON for machine consumption.
+/// Formats the `--deps` module dependency graph as DOT, JSON, or text.
 ///
-/// Serializes the complete directory statistics structure to pretty-printed JSON.
-/// This format is ideal for programmatic processing, integration with other tools,
-/// or storage for later analysis.
+/// Text lists the modules each module imports, then totals and the import
+/// cycles. DOT draws external modules dashed and the edges of cycles red.
 ///
 /// # Arguments
 ///
-/// * `stats` - Directory statistics to serialize
+/// * `graph` - The graph built from the analyzed files
+/// * `format` - `Dot`, `Json`, or any other format for text
 ///
 /// # Returns
 ///
-/// A JSON string with pretty formatting, or an error message if serialization fails
+/// * `String` - The formatted graph
+pub(crate) fn format_dependency_graph(graph: &DependencyGraph, format: OutputFormat) -> String {
+    match format {
+        OutputFormat::Json => {
+            let report = DependencyReport {
+                schema_version: JSON_SCHEMA_VERSION,
+                analyzer_version: ANALYZER_VERSION,
+                graph,
+            };
+            serde_json::to_string_pretty(&report)
+                .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"))
+        }
+        OutputFormat::Dot => {
+            let quote =
+                |name: &str| format!("\"{}\"", name.replace('\\', "\\\\").replace('"', "\\\""));
+            let mut output = String::from("digraph dependencies {\n    rankdir=LR;\n");
+            for module in &graph.modules {
+                if module.internal {
+                    output.push_str(&format!("    {};\n", quote(&module.name)));
+                } else {
+                    output.push_str(&format!("    {} [style=dashed];\n", quote(&module.name)));
+                }
+            }
+            for dependency in &graph.dependencies {
+                let color = if graph.in_cycle(&dependency.from, &dependency.to) {
+                    " [color=red]"
+                } else {
+                    ""
+                };
+                output.push_str(&format!(
+                    "    {} -> {}{color};\n",
+                    quote(&dependency.from),
+                    quote(&dependency.to)
+                ));
+            }
+            output.push('}');
+            output
+        }
+        _ => {
+            if graph.modules.is_empty() {
+                return "No modules found".to_string();
+            }
+            let mut imported: BTreeMap<&str, Vec<&str>> = BTreeMap::new();
+            for dependency in &graph.dependencies {
+                imported
+                    .entry(&dependency.from)
+                    .or_default()
+                    .push(&dependency.to);
+            }
+            let mut output = String::new();
+            for (from, targets) in &imported {
+                output.push_str(&format!("{from} -> {}\n", targets.join(", ")));
+            }
+            let external = graph
+                .modules
+                .iter()
+                .filter(|module| !module.internal)
+                .count();
+            output.push_str(&format!(
+                "\n{} module{} ({external} external), {} dependenc{}, {} cycle{}",
+                graph.modules.len(),
+                if graph.modules.len() == 1 { "" } else { "s" },
+                graph.dependencies.len(),
+                if graph.dependencies.len() == 1 {
+                    "y"
+                } else {
+                    "ies"
+                },
+                graph.cycles.len(),
+                if graph.cycles.len() == 1 { "" } else { "s" },
+            ));
+            for cycle in &graph.cycles {
+                output.push_str(&format!("\nCycle: {}", cycle.join(", ")));
+            }
+            output
+        }
+    }
+}
+
+/// Formats the `--call-graph` of the analyzed functions as DOT, JSON, or
+/// text.
 ///
-/// # JSON Structure
+/// Text lists, per package, what each function calls, then totals. DOT
+/// draws each package as a cluster with unreached functions dashed.
 ///
-/// The output includes:
-/// - `files`: Array of individual file statistics
-/// - `total_by_language`: Language-aggregated statistics
-/// - `total_stats`: Overall totals across all languages
+/// # Arguments
 ///
-/// # Error Handling
+/// * `graph` - The graph built from the analyzed files
+/// * `format` - `Dot`, `Json`, or any other format for text
 ///
-/// If JSON serialization fails (highly unlikely with our data structures),
-/// returns a formatted error message instead of panicking.
-fn format_json(stats: &DirectoryStats) -> String {
-    serde_json::to_string_pretty(stats)
-        .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"))
+/// # Returns
+///
+/// * `String` - The formatted graph
+pub(crate) fn format_call_graph(graph: &CallGraph, format: OutputFormat) -> String {
+    match format {
+        OutputFormat::Json => {
+            let report = CallGraphReport {
+                schema_version: JSON_SCHEMA_VERSION,
+                analyzer_version: ANALYZER_VERSION,
+                graph,
+            };
+            serde_json::to_string_pretty(&report)
+                .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"))
+        }
+        OutputFormat::Dot => {
+            let quote =
+                |text: &str| format!("\"{}\"", text.replace('\\', "\\\\").replace('"', "\\\""));
+            let mut output = String::from("digraph calls {\n    rankdir=LR;\n");
+            let mut packages: Vec<&str> = graph
+                .functions
+                .iter()
+                .map(|function| function.package.as_str())
+                .collect();
+            packages.dedup();
+            for (cluster, package) in packages.iter().enumerate() {
+                output.push_str(&format!(
+                    "    subgraph cluster_{cluster} {{\n        label={};\n",
+                    quote(package)
+                ));
+                for (index, function) in graph.functions.iter().enumerate() {
+                    if function.package != *package {
+                        continue;
+                    }
+                    let style = if function.is_unreached() {
+                        ", style=dashed"
+                    } else {
+                        ""
+                    };
+                    output.push_str(&format!(
+                        "        f{index} [label={}{style}];\n",
+                        quote(&function.name)
+                    ));
+                }
+                output.push_str("    }\n");
+            }
+            for call in &graph.calls {
+                output.push_str(&format!("    f{} -> f{};\n", call.from, call.to));
+            }
+            output.push('}');
+            output
+        }
+        _ => {
+            if graph.functions.is_empty() {
+                return "No functions found".to_string();
+            }
+            let mut output = String::new();
+            let mut package = None;
+            for (index, function) in graph.functions.iter().enumerate() {
+                let callees: Vec<&str> = graph
+                    .calls
+                    .iter()
+                    .filter(|call| call.from == index)
+                    .map(|call| graph.functions[call.to].name.as_str())
+                    .collect();
+                if callees.is_empty() {
+                    continue;
+                }
+                if package != Some(&function.package) {
+                    if package.is_some() {
+                        output.push('\n');
+                    }
+                    output.push_str(&format!("{}\n", function.package));
+                    package = Some(&function.package);
+                }
+                output.push_str(&format!("  {} -> {}\n", function.name, callees.join(", ")));
+            }
+            if package.is_some() {
+                output.push('\n');
+            }
+            output.push_str(&format!(
+                "{} function{}, {} call{}, {} unreached",
+                graph.functions.len(),
+                if graph.functions.len() == 1 { "" } else { "s" },
+                graph.calls.len(),
+                if graph.calls.len() == 1 { "" } else { "s" },
+                graph.unreached().count()
+            ));
+            output
+        }
+    }
 }
 
-#[cfg(test)]
-mod tests {
-    use super::*;
-    use crate::language::SupportedLanguage;
-    use crate::parser::CodeStats;
-    use std::path::PathBuf;
-
-    /// Creates a sample DirectoryStats for testing purposes.
-    ///
-    /// This helper function sets up realistic test data with multiple files
-    /// across different programming languages to verify formatting behavior.
-    fn create_test_directory_stats() -> DirectoryStats {
-        let mut stats = DirectoryStats::new();
+/// Formats the functions that `--unreached` reports as dead code
+/// candidates, as JSON or as one `path:line name` line each.
+///
+/// # Arguments
+///
+/// * `graph` - The call graph built from the analyzed files
+/// * `format` - `Json`, or any other format for text
+///
+/// # Returns
+///
+/// * `String` - The formatted list
+pub(crate) fn format_unreached(graph: &CallGraph, format: OutputFormat) -> String {
+    let unreached: Vec<&CallNode> = graph.unreached().collect();
+    if format == OutputFormat::Json {
+        let report = UnreachedReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            functions: graph.functions.len(),
+            unreached,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    if graph.functions.is_empty() {
+        return "No functions found".to_string();
+    }
+    let mut output = String::new();
+    for function in &unreached {
+        output.push_str(&format!(
+            "{}:{} {}\n",
+            function.path.display(),
+            function.line,
+            function.name
+        ));
+    }
+    if !unreached.is_empty() {
+        output.push('\n');
+    }
+    output.push_str(&format!(
+        "{} of {} function{} unreached",
+        unreached.len(),
+        graph.functions.len(),
+        if graph.functions.len() == 1 { "" } else { "s" }
+    ));
+    output
+}
+
+/// Formats the `--todos` inventory as JSON or as one `path:line MARKER text`
+/// line per comment, followed by the count of each marker.
+///
+/// # Arguments
+///
+/// * `items` - The marked comments, with git blame details if requested
+/// * `format` - `Json`, or any other format for text
+///
+/// # Returns
+///
+/// * `String` - The formatted inventory
+pub(crate) fn format_todos(items: &[TodoItem], format: OutputFormat) -> String {
+    let mut counts: BTreeMap<&str, usize> = BTreeMap::new();
+    for item in items {
+        *counts.entry(&item.comment.marker).or_default() += 1;
+    }
+
+    if format == OutputFormat::Json {
+        let report = TodoReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            todos: items,
+            counts,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    if items.is_empty() {
+        return "No TODO comments found".to_string();
+    }
+    let mut output = String::new();
+    for item in items {
+        output.push_str(&format!(
+            "{}:{} {}",
+            item.path.display(),
+            item.comment.line,
+            item.comment.marker
+        ));
+        if !item.comment.text.is_empty() {
+            output.push_str(&format!(" {}", item.comment.text));
+        }
+        if let (Some(author), Some(age)) = (&item.author, item.age_days) {
+            output.push_str(&format!(
+                " ({author}, {age} day{} ago)",
+                if age == 1 { "" } else { "s" }
+            ));
+        }
+        output.push('\n');
+    }
+    let counts: Vec<String> = counts
+        .iter()
+        .map(|(marker, count)| format!("{count} {marker}"))
+        .collect();
+    output.push_str(&format!(
+        "\n{} comment{}: {}",
+        items.len(),
+        if items.len() == 1 { "" } else { "s" },
+        counts.join(", ")
+    ));
+    output
+}
+
+/// Formats the `--tokens` listing as JSON or as a table of the syntax and
+/// estimated LLM tokens of every file and directory, followed by the total
+/// and, with `--fit-budget`, the files that fit.
+///
+/// # Arguments
+///
+/// * `report` - Token counts, and the budget selection if requested
+/// * `format` - `Json`, or any other format for text
+///
+/// # Returns
+///
+/// * `String` - The formatted listing
+pub(crate) fn format_tokens(report: &TokenReport, format: OutputFormat) -> String {
+    if format == OutputFormat::Json {
+        let report = TokensReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            report,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    if report.files.is_empty() {
+        return "No files found".to_string();
+    }
+    let width = |header: &str, count: usize| header.len().max(count.to_string().len());
+    let syntax_width = width("Syntax", report.total.syntax);
+    let llm_width = width("LLM", report.total.llm);
+    let row = |row: &TokenRow| {
+        format!(
+            "{:>syntax_width$}  {:>llm_width$}  {}\n",
+            row.tokens.syntax,
+            row.tokens.llm,
+            row.path.display()
+        )
+    };
+
+    let mut output = format!("{:>syntax_width$}  {:>llm_width$}  Path\n", "Syntax", "LLM");
+    for file in &report.files {
+        output.push_str(&row(file));
+    }
+    if report.directories.len() > 1 {
+        output.push_str("\nDirectories:\n");
+        for dir in &report.directories {
+            output.push_str(&row(dir));
+        }
+    }
+    output.push_str(&format!(
+        "\nTotal: {} syntax tokens, ~{} LLM tokens in {} file{}",
+        report.total.syntax,
+        report.total.llm,
+        report.files.len(),
+        if report.files.len() == 1 { "" } else { "s" }
+    ));
+
+    if let Some(fit) = &report.budget {
+        output.push_str(&format!(
+            "\n\nFits in {} LLM tokens: {} of {} files, ~{} used",
+            fit.budget,
+            fit.fits.len(),
+            report.files.len(),
+            fit.used
+        ));
+        for path in &fit.fits {
+            output.push_str(&format!("\n  {}", path.display()));
+        }
+        if !fit.left_out.is_empty() {
+            output.push_str("\nLeft out:");
+            for path in &fit.left_out {
+                output.push_str(&format!("\n  {}", path.display()));
+            }
+        }
+    }
+    output
+}
+
+/// Formats the `--distribution` report as JSON or as the percentiles and an
+/// ASCII histogram of file and function sizes.
+///
+/// # Arguments
+///
+/// * `report` - The distributions of file lines of code and function lengths
+/// * `format` - `Json`, or any other format for text
+///
+/// # Returns
+///
+/// * `String` - The formatted report
+///
+/// # Output Format
+///
+/// ```text
+/// File lines of code (33 files)
+///   min 3  p50 14  p90 18  p99 19  max 19  mean 12.6
+///     2-4  ###                                        2
+///     5-9  ######                                     4
+///   10-19  ########################################  27
+/// ```
+pub(crate) fn format_distributions(report: &DistributionReport, format: OutputFormat) -> String {
+    if format == OutputFormat::Json {
+        let report = DistributionsReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            report,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    if report.file_lines.count == 0 {
+        return "No files found".to_string();
+    }
+    let mut output = format_distribution(
+        &format!("File lines of code ({} files)", report.file_lines.count),
+        &report.file_lines,
+    );
+    output.push('\n');
+    if report.function_lines.count == 0 {
+        output.push_str("No functions found");
+    } else {
+        output.push_str(&format_distribution(
+            &format!("Function lines ({} functions)", report.function_lines.count),
+            &report.function_lines,
+        ));
+    }
+    output.trim_end().to_string()
+}
+
+/// Formats one distribution of `format_distributions` under `title`.
+fn format_distribution(title: &str, distribution: &Distribution) -> String {
+    let mut output = format!(
+        "{title}\n  min {}  p50 {}  p90 {}  p99 {}  max {}  mean {:.1}\n",
+        distribution.min,
+        distribution.p50,
+        distribution.p90,
+        distribution.p99,
+        distribution.max,
+        distribution.mean
+    );
+    let ranges: Vec<String> = distribution
+        .buckets
+        .iter()
+        .map(|bucket| {
+            if bucket.low == bucket.high {
+                bucket.low.to_string()
+            } else {
+                format!("{}-{}", bucket.low, bucket.high)
+            }
+        })
+        .collect();
+    let range_width = ranges.iter().map(String::len).max().unwrap_or_default();
+    let largest = distribution
+        .buckets
+        .iter()
+        .map(|bucket| bucket.count)
+        .max()
+        .unwrap_or_default()
+        .max(1);
+    let count_width = largest.to_string().len();
+    for (bucket, range) in distribution.buckets.iter().zip(&ranges) {
+        // Every non-empty bucket gets at least one mark
+        let bar = (bucket.count * HISTOGRAM_WIDTH).div_ceil(largest);
+        output.push_str(&format!(
+            "  {range:>range_width$}  {:HISTOGRAM_WIDTH$}  {:>count_width$}\n",
+            "#".repeat(bar),
+            bucket.count
+        ));
+    }
+    output
+}
+
+/// Formats the `history` series as JSON, CSV, or two text tables: the totals
+/// of every date, then the lines of code of every language by date.
+///
+/// # Arguments
+///
+/// * `points` - The metrics of each date, oldest first
+/// * `format` - `Json`, `Csv`, or any other format for text
+///
+/// # Returns
+///
+/// * `String` - The formatted series
+///
+/// # Output Format
+///
+/// ```text
+/// Date        Commit    Files   Code  Functions  Max CC  Mean CC
+/// 2023-01-01  1a2b3c4d     84   9120        502      19     2.84
+/// 2023-02-01  9f8e7d6c     91  10045        561      21     2.90
+///
+/// Code by language:
+/// Date          Go  Rust
+/// 2023-01-01  1840  7280
+/// 2023-02-01  1902  8143
+/// ```
+pub(crate) fn format_history(points: &[HistoryPoint], format: OutputFormat) -> String {
+    match format {
+        OutputFormat::Json => {
+            let report = HistoryReport {
+                schema_version: JSON_SCHEMA_VERSION,
+                analyzer_version: ANALYZER_VERSION,
+                points,
+            };
+            return serde_json::to_string_pretty(&report)
+                .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+        }
+        OutputFormat::Csv => return format_history_csv(points),
+        _ => {}
+    }
+
+    if points.is_empty() {
+        return "No commits found in the requested range".to_string();
+    }
+    let rows: Vec<[String; 7]> = points
+        .iter()
+        .map(|point| {
+            let total = &point.total;
+            [
+                point.date.clone(),
+                point.commit.chars().take(8).collect(),
+                total.files.to_string(),
+                total.code_lines.to_string(),
+                total.functions.to_string(),
+                total.max_complexity.to_string(),
+                format!("{:.2}", total.mean_complexity),
+            ]
+        })
+        .collect();
+    let mut output = aligned_table(
+        &[
+            "Date",
+            "Commit",
+            "Files",
+            "Code",
+            "Functions",
+            "Max CC",
+            "Mean CC",
+        ],
+        &rows,
+        2,
+    );
+
+    let languages: BTreeSet<&str> = points
+        .iter()
+        .flat_map(|point| point.languages.keys().map(String::as_str))
+        .collect();
+    if languages.len() > 1 {
+        let headers: Vec<&str> = std::iter::once("Date")
+            .chain(languages.iter().copied())
+            .collect();
+        let rows: Vec<Vec<String>> = points
+            .iter()
+            .map(|point| {
+                std::iter::once(point.date.clone())
+                    .chain(languages.iter().map(|language| {
+                        point
+                            .languages
+                            .get(*language)
+                            .map_or(0, |totals| totals.code_lines)
+                            .to_string()
+                    }))
+                    .collect()
+            })
+            .collect();
+        output.push_str("\nCode by language:\n");
+        output.push_str(&aligned_table(&headers, &rows, 1));
+    }
+    output.trim_end().to_string()
+}
+
+/// Formats the `languages` listing: the tree-sitter runtime and the ABI
+/// versions it loads, then a row per grammar.
+///
+/// # Arguments
+///
+/// * `grammars` - The compiled-in and loaded grammars
+/// * `format` - `Json` for machine-readable output, anything else for a table
+pub(crate) fn format_languages(grammars: &[GrammarInfo], format: OutputFormat) -> String {
+    let runtime = crate_version("tree-sitter");
+    if format == OutputFormat::Json {
+        let report = LanguagesReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            tree_sitter: runtime,
+            min_abi: tree_sitter::MIN_COMPATIBLE_LANGUAGE_VERSION,
+            max_abi: tree_sitter::LANGUAGE_VERSION,
+            grammars,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    let rows: Vec<[String; 4]> = grammars
+        .iter()
+        .map(|info| {
+            let grammar = match (&info.path, info.crate_name) {
+                (Some(path), _) => path.display().to_string(),
+                (None, Some(crate_name)) => crate_name.to_string(),
+                (None, None) => "-".to_string(),
+            };
+            let version = match (&info.path, info.version) {
+                (_, Some(version)) => version,
+                (Some(_), None) => "-",
+                (None, None) => "unknown",
+            };
+            [
+                info.language.name().to_string(),
+                grammar,
+                version.to_string(),
+                info.abi.to_string(),
+            ]
+        })
+        .collect();
+    format!(
+        "tree-sitter {} (grammar ABI {} to {})\n\n{}",
+        runtime.unwrap_or("unknown"),
+        tree_sitter::MIN_COMPATIBLE_LANGUAGE_VERSION,
+        tree_sitter::LANGUAGE_VERSION,
+        aligned_table(&["Language", "Grammar", "Version", "ABI"], &rows, 3).trim_end()
+    )
+}
+
+/// Formats the `workspace` report: a table comparing the repositories,
+/// followed by the summary of all their files together.
+///
+/// # Arguments
+///
+/// * `report` - Totals of each repository and of all of them
+/// * `merged` - Statistics of the files of all repositories
+/// * `format` - `Json` and `Csv` for the comparison alone, anything else
+///   for text
+/// * `thresholds` - Limits for the merged summary's complexity report
+pub(crate) fn format_workspace(
+    report: &WorkspaceReport,
+    merged: &DirectoryStats,
+    format: OutputFormat,
+    thresholds: &Thresholds,
+) -> String {
+    match format {
+        OutputFormat::Json => {
+            let report = WorkspaceJson {
+                schema_version: JSON_SCHEMA_VERSION,
+                analyzer_version: ANALYZER_VERSION,
+                report,
+            };
+            return serde_json::to_string_pretty(&report)
+                .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+        }
+        OutputFormat::Csv => return format_workspace_csv(report),
+        _ => {}
+    }
+
+    let row = |name: &str, totals: &RepositoryTotals| {
+        let share = if report.total.code_lines > 0 {
+            totals.code_lines as f64 / report.total.code_lines as f64 * 100.0
+        } else {
+            0.0
+        };
+        [
+            name.to_string(),
+            totals.files.to_string(),
+            totals.code_lines.to_string(),
+            totals.comment_lines.to_string(),
+            totals.functions.to_string(),
+            totals.max_complexity.to_string(),
+            format!("{:.2}", totals.mean_complexity),
+            format!("{share:.1}%"),
+        ]
+    };
+    let rows: Vec<[String; 8]> = report
+        .repositories
+        .iter()
+        .map(|repository| row(&repository.name, &repository.totals))
+        .chain(std::iter::once(row("Total", &report.total)))
+        .collect();
+    let table = aligned_table(
+        &[
+            "Repository",
+            "Files",
+            "Code",
+            "Comments",
+            "Functions",
+            "Max CC",
+            "Mean CC",
+            "Share",
+        ],
+        &rows,
+        1,
+    );
+    format!(
+        "{table}\nAll repositories:\n{}{}",
+        format_summary(merged),
+        format_complexity(merged, thresholds)
+    )
+}
+
+/// Renders rows under headers, the first `left` columns left-aligned and
+/// the others right-aligned, each wide enough for its widest cell.
+fn aligned_table(headers: &[&str], rows: &[impl AsRef<[String]>], left: usize) -> String {
+    let widths: Vec<usize> = headers
+        .iter()
+        .enumerate()
+        .map(|(column, header)| {
+            rows.iter()
+                .map(|row| row.as_ref()[column].len())
+                .chain(std::iter::once(header.len()))
+                .max()
+                .unwrap_or_default()
+        })
+        .collect();
+    let line = |cells: Vec<&str>| {
+        let cells: Vec<String> = cells
+            .iter()
+            .zip(&widths)
+            .enumerate()
+            .map(|(column, (cell, width))| {
+                if column < left {
+                    format!("{cell:<width$}")
+                } else {
+                    format!("{cell:>width$}")
+                }
+            })
+            .collect();
+        format!("{}\n", cells.join("  ").trim_end())
+    };
+    let mut output = line(headers.to_vec());
+    for row in rows {
+        output.push_str(&line(row.as_ref().iter().map(String::as_str).collect()));
+    }
+    output
+}
+
+/// Formats the `hotspots` ranking as JSON or as a table, highest score
+/// first.
+///
+/// # Arguments
+///
+/// * `hotspots` - Files ranked by hotspot score, see `hotspots::hotspots`
+/// * `limit` - Maximum number of files to show (0 shows all)
+/// * `format` - `Json` for machine-readable output, anything else for text
+///
+/// # Returns
+///
+/// * `String` - The formatted ranking
+///
+/// # Output Format
+///
+/// ```text
+/// Rank  Score  Commits  Complexity  Max CC  Code  File
+///    1   1840       46          40      14   512  src/parser.rs
+///    2    990       90          11       4   230  src/cli.rs
+///
+/// Top 2 of 31 files by commits x complexity
+/// ```
+pub(crate) fn format_hotspots(hotspots: &[Hotspot], limit: usize, format: OutputFormat) -> String {
+    let shown = if limit > 0 {
+        &hotspots[..limit.min(hotspots.len())]
+    } else {
+        hotspots
+    };
+    if format == OutputFormat::Json {
+        let report = HotspotsReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            total: hotspots.len(),
+            hotspots: shown
+                .iter()
+                .enumerate()
+                .map(|(index, hotspot)| HotspotEntry {
+                    rank: index + 1,
+                    hotspot,
+                })
+                .collect(),
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    if shown.is_empty() {
+        return "No hotspots found".to_string();
+    }
+    let headers = ["Rank", "Score", "Commits", "Complexity", "Max CC", "Code"];
+    let rows: Vec<[String; 6]> = shown
+        .iter()
+        .enumerate()
+        .map(|(index, hotspot)| {
+            [
+                (index + 1).to_string(),
+                hotspot.score.to_string(),
+                hotspot.commits.to_string(),
+                hotspot.complexity.to_string(),
+                hotspot.max_complexity.to_string(),
+                hotspot.code_lines.to_string(),
+            ]
+        })
+        .collect();
+    let widths: Vec<usize> = headers
+        .iter()
+        .enumerate()
+        .map(|(column, header)| {
+            rows.iter()
+                .map(|row| row[column].len())
+                .chain(std::iter::once(header.len()))
+                .max()
+                .unwrap_or_default()
+        })
+        .collect();
+    let line = |cells: &[&str], path: &str| {
+        let cells: Vec<String> = cells
+            .iter()
+            .zip(&widths)
+            .map(|(cell, width)| format!("{cell:>width$}"))
+            .collect();
+        format!("{}  {path}\n", cells.join("  "))
+    };
+
+    let mut output = line(&headers, "File");
+    for (row, hotspot) in rows.iter().zip(shown) {
+        let cells: Vec<&str> = row.iter().map(String::as_str).collect();
+        output.push_str(&line(&cells, &hotspot.path.display().to_string()));
+    }
+    output.push_str(&format!(
+        "\nTop {} of {} files by commits x complexity",
+        shown.len(),
+        hotspots.len()
+    ));
+    output
+}
+
+/// Formats the `--by-author` breakdown as JSON or as a table, owners with
+/// the most complexity first.
+///
+/// # Arguments
+///
+/// * `ownership` - The code by owner, see `ownership::by_author`
+/// * `format` - `Json` for machine-readable output, anything else for text
+///
+/// # Returns
+///
+/// * `String` - The formatted breakdown
+///
+/// # Output Format
+///
+/// ```text
+/// Owner      Files  Lines  Functions  Complexity  Max CC
+/// @org/core     12   3410         84         402      25
+/// @org/ux        5    960         31          77       9
+///
+/// 2 owners from CODEOWNERS
+/// ```
+pub(crate) fn format_ownership(ownership: &Ownership, format: OutputFormat) -> String {
+    if format == OutputFormat::Json {
+        let report = OwnershipReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            ownership,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    let source = if ownership.grouping == "codeowners" {
+        "from CODEOWNERS"
+    } else {
+        "by git blame"
+    };
+    if ownership.owners.is_empty() {
+        return format!("No owners found {source}");
+    }
+    let rows: Vec<[String; 6]> = ownership
+        .owners
+        .iter()
+        .map(|owner| {
+            [
+                owner.owner.clone(),
+                owner.files.to_string(),
+                owner.lines.to_string(),
+                owner.functions.to_string(),
+                owner.complexity.to_string(),
+                owner.max_complexity.to_string(),
+            ]
+        })
+        .collect();
+    let headers = [
+        "Owner",
+        "Files",
+        "Lines",
+        "Functions",
+        "Complexity",
+        "Max CC",
+    ];
+    let noun = if rows.len() == 1 { "owner" } else { "owners" };
+    format!(
+        "{}\n{} {noun} {source}",
+        aligned_table(&headers, &rows, 1),
+        rows.len()
+    )
+}
+
+/// Formats the `--strings` listing as JSON or as one `path:line "text"` line
+/// per literal, followed by the number of literals and files.
+///
+/// # Arguments
+///
+/// * `strings` - The user-facing literals, in file and source order
+/// * `format` - `Json`, or any other format for text
+///
+/// # Returns
+///
+/// * `String` - The formatted listing
+pub(crate) fn format_strings(strings: &[StringLiteral], format: OutputFormat) -> String {
+    let files = strings
+        .iter()
+        .map(|literal| &literal.path)
+        .collect::<BTreeSet<_>>()
+        .len();
+
+    if format == OutputFormat::Json {
+        let report = StringsReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            files,
+            strings,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    if strings.is_empty() {
+        return "No user-facing strings found".to_string();
+    }
+    let mut output = String::new();
+    for literal in strings {
+        output.push_str(&format!(
+            "{}:{} \"{}\"\n",
+            literal.path.display(),
+            literal.line,
+            literal.text
+        ));
+    }
+    output.push_str(&format!(
+        "\n{} string{} in {files} file{}",
+        strings.len(),
+        if strings.len() == 1 { "" } else { "s" },
+        if files == 1 { "" } else { "s" }
+    ));
+    output
+}
+
+/// Formats the naming statistics of `--identifiers` as JSON or as a table of
+/// languages followed by the longest identifiers and the single-letter
+/// variables outside loops.
+///
+/// # Arguments
+///
+/// * `report` - The statistics to format
+/// * `format` - `Json`, or any other format for text
+///
+/// # Output Format
+///
+/// ```text
+/// Language      Declared  Avg length  Single-letter  In loops
+/// Go                 120         6.1              1         3
+/// Rust               292        10.8              0         7
+///
+/// Longest identifiers:
+///   handle_incoming_webhook (23, src/hooks.rs:12)
+///
+/// Single-letter variables outside loops:
+///   s (src/geo.go:8)
+/// ```
+pub(crate) fn format_identifiers(report: &IdentifierReport, format: OutputFormat) -> String {
+    if format == OutputFormat::Json {
+        let report = IdentifiersReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            report,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    if report.languages.is_empty() {
+        return "No identifiers found".to_string();
+    }
+    let mut output = format!(
+        "{:12}  {:>8}  {:>10}  {:>13}  {:>8}\n",
+        "Language", "Declared", "Avg length", "Single-letter", "In loops"
+    );
+    for language in &report.languages {
+        output.push_str(&format!(
+            "{:12}  {:>8}  {:>10.1}  {:>13}  {:>8}\n",
+            format!("{:?}", language.language),
+            language.declared,
+            language.average_length,
+            language.single_letter,
+            language.single_letter_in_loops
+        ));
+    }
+    output.push_str("\nLongest identifiers:\n");
+    for identifier in &report.longest {
+        output.push_str(&format!(
+            "  {} ({}, {}:{})\n",
+            identifier.name,
+            identifier.length,
+            identifier.path.display(),
+            identifier.line
+        ));
+    }
+    if report.single_letter.is_empty() {
+        output.push_str("\nNo single-letter variables outside loops");
+    } else {
+        output.push_str("\nSingle-letter variables outside loops:\n");
+        for identifier in &report.single_letter {
+            output.push_str(&format!(
+                "  {} ({}:{})\n",
+                identifier.name,
+                identifier.path.display(),
+                identifier.line
+            ));
+        }
+    }
+    output.trim_end().to_string()
+}
+
+/// Formats the license headers of `--licenses` as JSON or as the number of
+/// files per license, the files without a header, and the share of files
+/// with one.
+///
+/// # Arguments
+///
+/// * `report` - The license headers to format
+/// * `format` - `Json`, or any other format for text
+///
+/// # Output Format
+///
+/// ```text
+/// Apache-2.0  41 files
+/// Unknown      1 file
+///
+/// Missing license header:
+///   tools/build.py
+///
+/// 42 of 43 files have a license header (97.7%)
+/// ```
+pub(crate) fn format_licenses(report: &LicenseReport, format: OutputFormat) -> String {
+    if format == OutputFormat::Json {
+        let report = LicensesReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            report,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    if report.files == 0 {
+        return "No files found".to_string();
+    }
+    let plural = |count: usize| if count == 1 { "" } else { "s" };
+    let license_width = report
+        .licenses
+        .iter()
+        .map(|count| count.license.len())
+        .max()
+        .unwrap_or_default();
+    let count_width = report
+        .licenses
+        .iter()
+        .map(|count| count.files.to_string().len())
+        .max()
+        .unwrap_or_default();
+    let mut output = String::new();
+    for count in &report.licenses {
+        output.push_str(&format!(
+            "{:license_width$}  {:>count_width$} file{}\n",
+            count.license,
+            count.files,
+            plural(count.files)
+        ));
+    }
+    if !report.missing.is_empty() {
+        if !output.is_empty() {
+            output.push('\n');
+        }
+        output.push_str("Missing license header:\n");
+        for path in &report.missing {
+            output.push_str(&format!("  {}\n", path.display()));
+        }
+    }
+    let with_header = report.files - report.missing.len();
+    output.push_str(&format!(
+        "\n{with_header} of {} file{} {} a license header ({:.1}%)",
+        report.files,
+        plural(report.files),
+        if report.files == 1 { "has" } else { "have" },
+        with_header as f64 * 100.0 / report.files as f64
+    ));
+    output
+}
+
+/// Formats the telemetry of `--profile`: the totals of the run, a table of
+/// the time and bytes per language, and the slowest files.
+///
+/// # Arguments
+///
+/// * `report` - The telemetry to format
+///
+/// # Output Format
+///
+/// ```text
+/// Profile: 120 files, 1.4 MiB in 312.5 ms (peak memory 48.2 MiB)
+///
+/// Language  Files  Cached      Bytes    Parse  Queries    Total
+/// Go           80      12  900.0 KiB  150.2ms   20.1ms  201.4ms
+///
+/// Slowest files:
+///   12.3ms  src/parser/grammar.go (Go, 80.0 KiB)
+/// ```
+pub(crate) fn format_profile(report: &ProfileReport) -> String {
+    let millis = |duration: Duration| format!("{:.1}ms", duration.as_secs_f64() * 1000.0);
+    let mut output = format!(
+        "Profile: {} file{}, {} in {}",
+        report.total.files,
+        if report.total.files == 1 { "" } else { "s" },
+        format_bytes(report.total.bytes),
+        millis(report.wall).replace("ms", " ms")
+    );
+    if let Some(peak) = report.peak_memory {
+        output.push_str(&format!(" (peak memory {})", format_bytes(peak)));
+    }
+    output.push('\n');
+    if report.languages.is_empty() {
+        return output;
+    }
+
+    output.push_str(&format!(
+        "\n{:12}  {:>6}  {:>6}  {:>10}  {:>9}  {:>9}  {:>9}\n",
+        "Language", "Files", "Cached", "Bytes", "Parse", "Queries", "Total"
+    ));
+    for (language, profile) in &report.languages {
+        output.push_str(&format!(
+            "{:12}  {:>6}  {:>6}  {:>10}  {:>9}  {:>9}  {:>9}\n",
+            format!("{language:?}"),
+            profile.files,
+            profile.cached,
+            format_bytes(profile.bytes),
+            millis(profile.parse),
+            millis(profile.queries),
+            millis(profile.total)
+        ));
+    }
+    output.push_str("\nSlowest files:\n");
+    for file in &report.slowest {
+        output.push_str(&format!(
+            "  {:>9}  {} ({:?}, {}{})\n",
+            millis(file.total),
+            file.path.display(),
+            file.language,
+            format_bytes(file.bytes),
+            if file.timing.cached { ", cached" } else { "" }
+        ));
+    }
+    output
+}
+
+/// Formats a byte count in bytes, KiB, or MiB.
+fn format_bytes(bytes: u64) -> String {
+    const KIB: f64 = 1024.0;
+    let size = bytes as f64;
+    if size >= KIB * KIB {
+        format!("{:.1} MiB", size / (KIB * KIB))
+    } else if size >= KIB {
+        format!("{:.1} KiB", size / KIB)
+    } else {
+        format!("{bytes} B")
+    }
+}
+
+/// Formats the findings of `--lint` as SARIF, JSON, or as one
+/// `path:line:column: severity[rule] message` line per finding, followed by
+/// the number of findings of each severity.
+///
+/// # Arguments
+///
+/// * `findings` - The findings, in file and source order
+/// * `rules` - The configured rules, described in the SARIF log
+/// * `format` - `Sarif`, `Json`, the CI annotation formats, or any other
+///   format for text
+///
+/// # Returns
+///
+/// * `String` - The formatted findings
+pub(crate) fn format_findings(
+    findings: &[Finding],
+    rules: &[RuleDefinition],
+    format: OutputFormat,
+) -> String {
+    let (errors, warnings, notes) = (
+        count(findings, Severity::Error),
+        count(findings, Severity::Warning),
+        count(findings, Severity::Note),
+    );
+    match format {
+        OutputFormat::Sarif => return format_findings_sarif(findings, rules),
+        OutputFormat::GithubAnnotations => return format_findings_github(findings),
+        OutputFormat::GitlabCodequality => return format_findings_codequality(findings),
+        OutputFormat::Json => {
+            let report = LintReport {
+                schema_version: JSON_SCHEMA_VERSION,
+                analyzer_version: ANALYZER_VERSION,
+                errors,
+                warnings,
+                notes,
+                findings,
+            };
+            return serde_json::to_string_pretty(&report)
+                .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+        }
+        _ => {}
+    }
+
+    if findings.is_empty() {
+        return "No lint findings".to_string();
+    }
+    let mut output = String::new();
+    for finding in findings {
+        output.push_str(&format!(
+            "{}:{}:{}: {}[{}] {}\n",
+            finding.path.display(),
+            finding.line,
+            finding.column,
+            finding.severity.label(),
+            finding.rule,
+            finding.message
+        ));
+    }
+    let plural = |n: usize| if n == 1 { "" } else { "s" };
+    output.push_str(&format!(
+        "\n{errors} error{}, {warnings} warning{}, {notes} note{}",
+        plural(errors),
+        plural(warnings),
+        plural(notes)
+    ));
+    output
+}
+
+/// Formats exported and unexported declaration counts, e.g. `2 exported, 2
+/// unexported (50% exported)`.
+fn format_exported(exported: usize, unexported: usize) -> String {
+    let total = exported + unexported;
+    if total == 0 {
+        return "0 exported, 0 unexported".to_string();
+    }
+    format!(
+        "{exported} exported, {unexported} unexported ({:.0}% exported)",
+        exported as f64 * 100.0 / total as f64
+    )
+}
+
+/// Orders functions by the requested column, breaking ties by location.
+pub(crate) fn sort_functions(functions: &mut [FunctionRef], sort: FunctionSort) {
+    functions.sort_by(|a, b| {
+        let primary = match sort {
+            FunctionSort::Location => std::cmp::Ordering::Equal,
+            FunctionSort::Name => a.function.qualified_name.cmp(&b.function.qualified_name),
+            FunctionSort::Lines => b.function.line_count().cmp(&a.function.line_count()),
+            FunctionSort::Params => b.function.parameters.cmp(&a.function.parameters),
+            FunctionSort::Complexity => b.function.complexity.cmp(&a.function.complexity),
+            FunctionSort::Nesting => b.function.max_nesting.cmp(&a.function.max_nesting),
+            FunctionSort::Cognitive => b.function.cognitive.cmp(&a.function.cognitive),
+            FunctionSort::Volume => b
+                .function
+                .halstead
+                .volume
+                .total_cmp(&a.function.halstead.volume),
+            FunctionSort::Maintainability => a
+                .function
+                .maintainability
+                .total_cmp(&b.function.maintainability),
+        };
+        primary
+            .then_with(|| a.path.cmp(b.path))
+            .then_with(|| a.function.start_line.cmp(&b.function.start_line))
+    });
+}
+
+/// Top-level structure of the `top --format json` report.
+#[derive(Serialize)]
+struct TopReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// Metric the entries are ranked by
+    by: &'static str,
+    /// Number of files or functions ranked, before the limit was applied
+    total: usize,
+    /// The highest ranked entries, first place first
+    entries: Vec<TopEntry<'a>>,
+}
+
+/// A single entry of a `top` ranking.
+#[derive(Serialize)]
+struct TopEntry<'a> {
+    /// 1-based position in the ranking
+    rank: usize,
+    path: &'a std::path::Path,
+    /// Qualified function name, for function rankings
+    #[serde(skip_serializing_if = "Option::is_none")]
+    function: Option<&'a str>,
+    /// 1-based line where the function starts, for function rankings
+    #[serde(skip_serializing_if = "Option::is_none")]
+    start_line: Option<usize>,
+    /// Value of the ranked metric
+    value: usize,
+}
+
+impl TopMetric {
+    /// Name of the metric as given to `--by`.
+    fn name(self) -> &'static str {
+        match self {
+            TopMetric::Loc => "loc",
+            TopMetric::Functions => "functions",
+            TopMetric::Complexity => "complexity",
+            TopMetric::Lines => "lines",
+        }
+    }
+
+    /// Returns true if the metric ranks files rather than functions.
+    fn ranks_files(self) -> bool {
+        matches!(self, TopMetric::Loc | TopMetric::Functions)
+    }
+
+    /// Column header of the metric in the text ranking.
+    fn header(self) -> &'static str {
+        match self {
+            TopMetric::Loc => "Code",
+            TopMetric::Functions => "Functions",
+            TopMetric::Complexity => "Complexity",
+            TopMetric::Lines => "Lines",
+        }
+    }
+
+    /// Description of the metric in the text ranking's footer.
+    fn description(self) -> &'static str {
+        match self {
+            TopMetric::Loc => "lines of code",
+            TopMetric::Functions => "number of functions",
+            TopMetric::Complexity => "cyclomatic complexity",
+            TopMetric::Lines => "length in lines",
+        }
+    }
+}
+
+/// Formats the files or functions with the highest value of a metric.
+///
+/// Entries are ranked by value, highest first; ties are broken by path and
+/// then by line so the result is deterministic.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics to rank
+/// * `metric` - Metric to rank by, which also decides whether files or functions are ranked
+/// * `limit` - Maximum number of entries to show (0 shows all)
+/// * `format` - `Json` for machine-readable output, anything else for text
+///
+/// # Returns
+///
+/// A formatted string ready for display or further processing
+///
+/// # Output Format
+///
+/// ```text
+/// Rank  Function     Location          Complexity
+///    1  count_nodes  src/parser.rs:88          14
+///    2  run          src/cli.rs:156            12
+///
+/// Top 2 of 52 functions by cyclomatic complexity
+/// ```
+pub(crate) fn format_top(
+    stats: &DirectoryStats,
+    metric: TopMetric,
+    limit: usize,
+    format: OutputFormat,
+) -> String {
+    let mut entries: Vec<TopEntry> = if metric.ranks_files() {
+        stats
+            .code_file_stats()
+            .map(|file| TopEntry {
+                rank: 0,
+                path: &file.path,
+                function: None,
+                start_line: None,
+                value: match metric {
+                    TopMetric::Loc => file.stats.lines.code,
+                    _ => file.stats.function_count,
+                },
+            })
+            .collect()
+    } else {
+        stats
+            .functions()
+            .map(|f| TopEntry {
+                rank: 0,
+                path: f.path,
+                function: Some(&f.function.qualified_name),
+                start_line: Some(f.function.start_line),
+                value: match metric {
+                    TopMetric::Complexity => f.function.complexity,
+                    _ => f.function.line_count(),
+                },
+            })
+            .collect()
+    };
+    entries.sort_by(|a, b| {
+        b.value
+            .cmp(&a.value)
+            .then_with(|| a.path.cmp(b.path))
+            .then_with(|| a.start_line.cmp(&b.start_line))
+    });
+    let total = entries.len();
+    if limit > 0 {
+        entries.truncate(limit);
+    }
+    for (index, entry) in entries.iter_mut().enumerate() {
+        entry.rank = index + 1;
+    }
+
+    if format == OutputFormat::Json {
+        let report = TopReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            by: metric.name(),
+            total,
+            entries,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    let subject = if metric.ranks_files() {
+        "files"
+    } else {
+        "functions"
+    };
+    if entries.is_empty() {
+        return format!("No {subject} found");
+    }
+
+    // Files have a single label column, functions a name and a location
+    let labels: Vec<Vec<String>> = entries
+        .iter()
+        .map(|entry| match (entry.function, entry.start_line) {
+            (Some(name), Some(line)) => {
+                vec![name.to_string(), format!("{}:{line}", entry.path.display())]
+            }
+            _ => vec![entry.path.display().to_string()],
+        })
+        .collect();
+    let headers: &[&str] = if metric.ranks_files() {
+        &["File"]
+    } else {
+        &["Function", "Location"]
+    };
+    let widths: Vec<usize> = headers
+        .iter()
+        .enumerate()
+        .map(|(column, header)| {
+            labels
+                .iter()
+                .map(|row| row[column].len())
+                .chain(std::iter::once(header.len()))
+                .max()
+                .unwrap_or_default()
+        })
+        .collect();
+    let value_width = metric.header().len();
+
+    let mut output = String::from("Rank");
+    for (header, width) in headers.iter().zip(&widths) {
+        output.push_str(&format!("  {header:width$}"));
+    }
+    output.push_str(&format!("  {}\n", metric.header()));
+    for (entry, row) in entries.iter().zip(&labels) {
+        output.push_str(&format!("{:>4}", entry.rank));
+        for (label, width) in row.iter().zip(&widths) {
+            output.push_str(&format!("  {label:width$}"));
+        }
+        output.push_str(&format!("  {:>value_width$}\n", entry.value));
+    }
+    output.push_str(&format!(
+        "\nTop {} of {total} {subject} by {}",
+        entries.len(),
+        metric.description()
+    ));
+
+    output
+}
+
+/// Top-level structure of the `--group-by dir --format json` report.
+#[derive(Serialize)]
+struct RollupReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// The analyzed directory, with its subdirectories nested in `children`
+    root: &'a DirectoryRollup,
+}
+
+/// Formats per-directory totals as an indented tree.
+///
+/// # Arguments
+///
+/// * `tree` - The analyzed directory with its subdirectories, already limited to `--depth`
+/// * `format` - `Json` for machine-readable output, anything else for text
+///
+/// # Returns
+///
+/// A formatted string ready for display or further processing
+///
+/// # Output Format
+///
+/// ```text
+/// Directory   Files  Code  Functions  Complexity  Max
+/// .               4   130          6          15    7
+///   src           2    80          3          12    7
+///     parser      1    50          1           7    7
+///   tests         1    40          2           2    1
+/// ```
+pub(crate) fn format_rollup(tree: &DirectoryRollup, format: OutputFormat) -> String {
+    if format == OutputFormat::Json {
+        let report = RollupReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            root: tree,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    fn collect<'a>(
+        node: &'a DirectoryRollup,
+        depth: usize,
+        rows: &mut Vec<(String, &'a DirectoryRollup)>,
+    ) {
+        rows.push((
+            format!("{}{}", "  ".repeat(depth), node.name(depth == 0)),
+            node,
+        ));
+        for child in &node.children {
+            collect(child, depth + 1, rows);
+        }
+    }
+    let mut rows = Vec::new();
+    collect(tree, 0, &mut rows);
+
+    const HEADERS: [&str; 7] = [
+        "Files",
+        "Code",
+        "Functions",
+        "Complexity",
+        "Max",
+        "Tests",
+        "Ratio",
+    ];
+    let values: Vec<[String; 7]> = rows
+        .iter()
+        .map(|(_, node)| {
+            [
+                node.files.to_string(),
+                node.code_lines.to_string(),
+                node.functions.to_string(),
+                node.complexity.to_string(),
+                node.max_complexity.to_string(),
+                node.test_code_lines.to_string(),
+                format_test_ratio(node.test_ratio()),
+            ]
+        })
+        .collect();
+    let label_width = rows
+        .iter()
+        .map(|(label, _)| label.len())
+        .chain(std::iter::once("Directory".len()))
+        .max()
+        .unwrap_or_default();
+    let widths: Vec<usize> = (0..HEADERS.len())
+        .map(|column| {
+            values
+                .iter()
+                .map(|row| row[column].len())
+                .chain(std::iter::once(HEADERS[column].len()))
+                .max()
+                .unwrap_or_default()
+        })
+        .collect();
+
+    let mut output = format!("{:label_width$}", "Directory");
+    for (header, width) in HEADERS.iter().zip(&widths) {
+        output.push_str(&format!("  {header:>width$}"));
+    }
+    for ((label, _), row) in rows.iter().zip(&values) {
+        output.push_str(&format!("\n{label:label_width$}"));
+        for (value, width) in row.iter().zip(&widths) {
+            output.push_str(&format!("  {value:>width$}"));
+        }
+    }
+    output
+}
+
+/// Top-level structure of the `--group-by type --format json` report.
+#[derive(Serialize)]
+struct TypeRollupReport<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    /// Types, largest first
+    types: &'a [TypeRollup],
+}
+
+/// Formats per-type totals as a table, one row per type, followed by the
+/// names of the types flagged as god objects.
+///
+/// # Arguments
+///
+/// * `types` - Types in the order they are listed
+/// * `format` - `Json` for machine-readable output, anything else for text
+///
+/// # Returns
+///
+/// A formatted string ready for display or further processing
+///
+/// # Output Format
+///
+/// ```text
+/// Type              Kind    Lines  Fields  Methods  Bases  Complexity  Max  Location
+/// Shop.Models.Cart  class      42       3        5      1          12    4  src/Cart.cs:3 (+1 more)
+/// Shop.Models.Item  record      1       2        0      0           0    0  src/Item.cs:5
+///
+/// God objects: Shop.Models.Cart
+/// ```
+pub(crate) fn format_type_rollup(types: &[TypeRollup], format: OutputFormat) -> String {
+    if format == OutputFormat::Json {
+        let report = TypeRollupReport {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            types,
+        };
+        return serde_json::to_string_pretty(&report)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+    if types.is_empty() {
+        return "No types found".to_string();
+    }
+
+    const HEADERS: [&str; 6] = ["Lines", "Fields", "Methods", "Bases", "Complexity", "Max"];
+    let values: Vec<[usize; 6]> = types
+        .iter()
+        .map(|t| {
+            [
+                t.lines,
+                t.fields,
+                t.methods,
+                t.bases,
+                t.complexity,
+                t.max_complexity,
+            ]
+        })
+        .collect();
+    let text_width = |header: &str, text: &dyn Fn(&TypeRollup) -> usize| {
+        types
+            .iter()
+            .map(text)
+            .chain([header.len()])
+            .max()
+            .unwrap_or_default()
+    };
+    let name_width = text_width("Type", &|t| t.name.len());
+    let kind_width = text_width("Kind", &|t| t.kind.len());
+    let widths: Vec<usize> = (0..HEADERS.len())
+        .map(|column| {
+            values
+                .iter()
+                .map(|row| row[column].to_string().len())
+                .chain([HEADERS[column].len()])
+                .max()
+                .unwrap_or_default()
+        })
+        .collect();
+
+    let mut output = format!("{:name_width$}  {:kind_width$}", "Type", "Kind");
+    for (header, width) in HEADERS.iter().zip(&widths) {
+        output.push_str(&format!("  {header:>width$}"));
+    }
+    output.push_str("  Location");
+    for (rollup, row) in types.iter().zip(&values) {
+        output.push_str(&format!(
+            "\n{:name_width$}  {:kind_width$}",
+            rollup.name, rollup.kind
+        ));
+        for (value, width) in row.iter().zip(&widths) {
+            output.push_str(&format!("  {value:>width$}"));
+        }
+        let first = &rollup.locations[0];
+        output.push_str(&format!("  {}:{}", first.path.display(), first.start_line));
+        if rollup.locations.len() > 1 {
+            output.push_str(&format!(" (+{} more)", rollup.locations.len() - 1));
+        }
+    }
+    let god_objects: Vec<&str> = types
+        .iter()
+        .filter(|t| t.god_object)
+        .map(|t| t.name.as_str())
+        .collect();
+    if !god_objects.is_empty() {
+        output.push_str(&format!("\n\nGod objects: {}", god_objects.join(", ")));
+    }
+    output
+}
+
+/// Top-level structure of the `--diff --format json` report.
+#[derive(Serialize)]
+struct DiffJson<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    #[serde(flatten)]
+    report: &'a DiffReport,
+}
+
+/// Formats the files and functions changed since the base ref of `--diff`.
+///
+/// # Arguments
+///
+/// * `report` - Changed files with their touched functions
+/// * `format` - `Json` for machine-readable output, `Markdown` for a summary
+///   of the largest changes, anything else for text
+///
+/// # Returns
+///
+/// A formatted string ready for display or further processing
+///
+/// # Output Format
+///
+/// ```text
+/// Changes since main: 2 files, 3 functions touched
+///
+/// src/lib.rs (modified):
+///   ~ parse   lines 20 -> 25 (+5), complexity 4 -> 6 (+2)
+///   - legacy  lines 10, complexity 2
+/// src/new.rs (added):
+///   + fresh   lines 2, complexity 1
+/// ```
+pub(crate) fn format_diff(report: &DiffReport, format: OutputFormat) -> String {
+    if format == OutputFormat::Json {
+        let json = DiffJson {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            report,
+        };
+        return serde_json::to_string_pretty(&json)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+    if format == OutputFormat::Markdown {
+        return format_diff_markdown(report);
+    }
+
+    if report.files.is_empty() {
+        return format!("No changes since {}", report.base);
+    }
+
+    let touched: usize = report.files.iter().map(|file| file.functions.len()).sum();
+    let name_width = report
+        .files
+        .iter()
+        .flat_map(|file| &file.functions)
+        .map(|change| change.name.len())
+        .max()
+        .unwrap_or_default();
+
+    let mut output = format!(
+        "Changes since {}: {} files, {} functions touched\n",
+        report.base,
+        report.files.len(),
+        touched
+    );
+    for file in &report.files {
+        output.push_str(&format!(
+            "\n{} ({}):",
+            file.path.display(),
+            file.status.label()
+        ));
+        if file.functions.is_empty() {
+            output.push_str("\n  no functions touched");
+        }
+        for change in &file.functions {
+            let (marker, metrics) = match (change.status, change.before, change.after) {
+                (ChangeStatus::Modified, Some(before), Some(after)) => {
+                    ("~", format_metric_change(&before, &after))
+                }
+                (ChangeStatus::Removed, Some(metrics), _) | (_, _, Some(metrics)) => {
+                    let marker = if change.status == ChangeStatus::Removed {
+                        "-"
+                    } else {
+                        "+"
+                    };
+                    (
+                        marker,
+                        format!("lines {}, complexity {}", metrics.lines, metrics.complexity),
+                    )
+                }
+                (_, _, None) => continue,
+            };
+            output.push_str(&format!(
+                "\n  {marker} {:name_width$}  {metrics}",
+                change.name
+            ));
+        }
+    }
+
+    output
+}
+
+/// Top-level structure of the `--duplicates --format json` report.
+#[derive(Serialize)]
+struct DuplicatesJson<'a> {
+    /// Version of this schema, see `JSON_SCHEMA_VERSION`
+    schema_version: u32,
+    /// Version of code-stats-rs that wrote the report, see `ANALYZER_VERSION`
+    analyzer_version: &'static str,
+    #[serde(flatten)]
+    report: &'a DuplicateReport,
+}
+
+/// Formats the clone groups found by `--duplicates`.
+///
+/// # Arguments
+///
+/// * `report` - Clone groups, largest first
+/// * `format` - `Json` for machine-readable output, anything else for text
+///
+/// # Returns
+///
+/// A formatted string ready for display or further processing
+///
+/// # Output Format
+///
+/// ```text
+/// Duplicates: 1 clone group, 2 copies (at least 50 tokens)
+///
+/// Clone group 1: 2 copies of 84 tokens (12 lines)
+///   src/a.rs:10-21  parse_a
+///   src/b.rs:30-41  parse_b
+/// ```
+pub(crate) fn format_duplicates(report: &DuplicateReport, format: OutputFormat) -> String {
+    if format == OutputFormat::Json {
+        let json = DuplicatesJson {
+            schema_version: JSON_SCHEMA_VERSION,
+            analyzer_version: ANALYZER_VERSION,
+            report,
+        };
+        return serde_json::to_string_pretty(&json)
+            .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"));
+    }
+
+    if report.groups.is_empty() {
+        return format!(
+            "No duplicates of at least {} tokens found",
+            report.min_tokens
+        );
+    }
+
+    let mut output = format!(
+        "Duplicates: {} clone {}, {} copies (at least {} tokens)\n",
+        report.groups.len(),
+        if report.groups.len() == 1 {
+            "group"
+        } else {
+            "groups"
+        },
+        report.location_count(),
+        report.min_tokens
+    );
+    for (index, group) in report.groups.iter().enumerate() {
+        output.push_str(&format!(
+            "\nClone group {}: {} copies of {} tokens ({} lines)",
+            index + 1,
+            group.locations.len(),
+            group.tokens,
+            group.locations[0].line_count()
+        ));
+        let spans: Vec<String> = group
+            .locations
+            .iter()
+            .map(|location| {
+                format!(
+                    "{}:{}-{}",
+                    location.path.display(),
+                    location.start_line,
+                    location.end_line
+                )
+            })
+            .collect();
+        let width = spans.iter().map(String::len).max().unwrap_or_default();
+        for (span, location) in spans.iter().zip(&group.locations) {
+            match &location.function {
+                Some(name) => output.push_str(&format!("\n  {span:width$}  {name}")),
+                None => output.push_str(&format!("\n  {span:width$}  (block)")),
+            }
+        }
+    }
+
+    output
+}
+
+/// Formats `lines 20 -> 25 (+5), complexity 4 -> 6 (+2)`, omitting the delta
+/// of unchanged metrics.
+fn format_metric_change(before: &FunctionMetrics, after: &FunctionMetrics) -> String {
+    let change = |label: &str, before: usize, after: usize| {
+        if before == after {
+            format!("{label} {after}")
+        } else {
+            let delta = after as i64 - before as i64;
+            format!("{label} {before} -> {after} ({delta:+})")
+        }
+    };
+    format!(
+        "{}, {}",
+        change("lines", before.lines, after.lines),
+        change("complexity", before.complexity, after.complexity)
+    )
+}
+
+/// Formats statistics for a single file analysis.
+///
+/// This function is used when analyzing individual files rather than entire directories.
+/// It provides a clear, human-readable summary of the code statistics for the specific file.
+///
+/// # Arguments
+///
+/// * `file_stats` - Statistics for a single file including path, language, and counts
+/// * `thresholds` - Limits used to flag offending functions
+///
+/// # Returns
+///
+/// A formatted string containing the file path, detected language, and code statistics
+pub(crate) fn format_single_file(file_stats: &FileStats, thresholds: &Thresholds) -> String {
+    let mut output = format!(
+        "Analyzing file: {} (Language: {:?})\n\
+         Code Statistics:\n\
+         Functions: {}\n\
+         Classes/Structs: {}",
+        file_stats.path.display(),
+        file_stats.language,
+        file_stats.stats.function_count,
+        file_stats.stats.class_struct_count
+    );
+
+    if !file_stats.stats.kinds.is_empty() {
+        output.push_str(&format!(
+            "\nBreakdown: {}",
+            format_kinds(&file_stats.stats.kinds)
+        ));
+    }
+
+    if !file_stats.stats.queries.is_empty() {
+        output.push_str(&format!(
+            "\nQueries: {}",
+            format_kinds(&file_stats.stats.queries)
+        ));
+    }
+
+    if !file_stats.stats.plugins.is_empty() {
+        output.push_str(&format!(
+            "\nPlugin metrics: {}",
+            format_plugin_metrics(&file_stats.stats.plugins)
+        ));
+    }
+
+    if !file_stats.stats.plugin_errors.is_empty() {
+        output.push_str(&format!(
+            "\nPlugin errors: {}",
+            file_stats.stats.plugin_errors.join("; ")
+        ));
+    }
+
+    if !file_stats.stats.parsed_cleanly() {
+        output.push_str(&format!(
+            "\nParse errors: {} (counts may be incomplete)",
+            format_file_parse_issues(&file_stats.stats)
+        ));
+    }
+
+    if file_stats.stats.oversized {
+        output.push_str("\nNot parsed: above the parse size limit, only lines counted");
+    }
+
+    if !file_stats.stats.encoding.is_utf8() {
+        output.push_str(&format!(
+            "\nEncoding: {} (transcoded to UTF-8)",
+            file_stats.stats.encoding
+        ));
+    }
+
+    if let Some(origin) = file_stats.stats.origin {
+        output.push_str(&format!("\nOrigin: {origin}"));
+    }
+    if file_stats.stats.test_file {
+        output.push_str("\nTest file: yes");
+    }
+
+    if file_stats.stats.max_type_depth > 0 {
+        output.push_str(&format!(
+            "\nType nesting depth: {}",
+            file_stats.stats.max_type_depth
+        ));
+    }
+
+    if file_stats.stats.script_complexity > 0 {
+        output.push_str(&format!(
+            "\nScript complexity: {}",
+            file_stats.stats.script_complexity
+        ));
+    }
+
+    if let Some(config) = &file_stats.stats.config {
+        output.push_str(&format!("\nConfiguration: {}", format_config(config)));
+    }
+
+    if let Some(web) = &file_stats.stats.web {
+        output.push_str(&format!("\nWeb: {}", format_web(web)));
+    }
+
+    if let Some(notebook) = &file_stats.stats.notebook {
+        output.push_str(&format!("\nNotebook: {}", format_notebook(notebook)));
+    }
+
+    if let Some(component) = &file_stats.stats.component {
+        output.push_str(&format!("\nSections: {}", format_sections(component)));
+    }
+
+    if let Some(template) = &file_stats.stats.template {
+        output.push_str(&format!("\nTemplate: {}", format_template(template)));
+    }
+
+    if let Some(graphql) = &file_stats.stats.graphql {
+        output.push_str(&format!("\nGraphQL: {}", format_graphql(graphql)));
+    }
+
+    if let Some(terraform) = &file_stats.stats.terraform {
+        output.push_str(&format!("\nTerraform: {}", format_terraform(terraform)));
+    }
+
+    if let Some(go) = &file_stats.stats.go {
+        output.push_str(&format!("\nGo: {}", format_go(go)));
+        if !go.method_sets.is_empty() {
+            output.push_str(&format!("\nMethod sets: {}", format_method_sets(go)));
+        }
+    }
+
+    if let Some(generics) = file_stats.stats.generics.filter(|g| !g.is_empty()) {
+        output.push_str(&format!("\nGenerics: {}", format_generics(&generics)));
+    }
+
+    if let Some(closures) = file_stats.stats.closures.filter(|c| !c.is_empty()) {
+        output.push_str(&format!("\nClosures: {}", format_closures(&closures)));
+    }
+
+    if let Some(error_handling) = file_stats.stats.error_handling.filter(|e| !e.is_empty()) {
+        output.push_str(&format!(
+            "\nError handling: {}",
+            format_error_handling(&error_handling)
+        ));
+    }
+
+    if !file_stats.stats.switches.is_empty() {
+        output.push_str(&format!(
+            "\nSwitches: {}",
+            format_switches(&file_stats.stats.switches)
+        ));
+    }
+
+    output.push_str(&format!(
+        "\nLines: {}",
+        format_lines(&file_stats.stats.lines)
+    ));
+    if let Some(coverage) = format_doc_coverage(&file_stats.stats.docs) {
+        output.push_str(&format!("\nDoc coverage: {coverage}"));
+    }
+    for (language, embedded) in &file_stats.stats.embedded {
+        output.push_str(&format!(
+            "\nEmbedded {language:?}: {}",
+            format_embedded(embedded)
+        ));
+    }
+
+    let longest = file_stats.stats.longest_statements(LONGEST_STATEMENTS);
+    if !longest.is_empty() {
+        output.push_str("\nLongest statements:");
+        for statement in longest {
+            output.push_str(&format!("\n  {}", format_statement(statement)));
+        }
+    }
+
+    let functions = &file_stats.stats.functions;
+    if !functions.is_empty() {
+        let sum: usize = functions.iter().map(|f| f.complexity).sum();
+        output.push_str(&format!(
+            "\nComplexity: max {}, mean {:.2}",
+            file_stats.stats.max_complexity(),
+            sum as f64 / functions.len() as f64
+        ));
+        if let Some(deepest) = functions.iter().max_by(|a, b| {
+            a.max_nesting
+                .cmp(&b.max_nesting)
+                .then_with(|| b.start_line.cmp(&a.start_line))
+        }) {
+            output.push_str(&format!(
+                "\nNesting depth: max {} (line {} {})",
+                deepest.max_nesting, deepest.start_line, deepest.name
+            ));
+        }
+        if let Some(tangled) = functions.iter().max_by(|a, b| {
+            a.cognitive
+                .cmp(&b.cognitive)
+                .then_with(|| b.start_line.cmp(&a.start_line))
+        }) {
+            output.push_str(&format!(
+                "\nCognitive complexity: max {} (line {} {})",
+                tangled.cognitive, tangled.start_line, tangled.name
+            ));
+        }
+        if let Some(fragile) = functions.iter().min_by(|a, b| {
+            a.maintainability
+                .total_cmp(&b.maintainability)
+                .then_with(|| a.start_line.cmp(&b.start_line))
+        }) {
+            output.push_str(&format!(
+                "\nMaintainability index: min {:.1} (line {} {})",
+                fragile.maintainability, fragile.start_line, fragile.name
+            ));
+        }
+
+        let mut offenders: Vec<_> = functions
+            .iter()
+            .filter(|f| f.complexity > thresholds.complexity)
+            .collect();
+        offenders.sort_by(|a, b| {
+            b.complexity
+                .cmp(&a.complexity)
+                .then_with(|| a.start_line.cmp(&b.start_line))
+        });
+        if !offenders.is_empty() {
+            output.push_str(&format!(
+                "\nFunctions above complexity threshold {}:",
+                thresholds.complexity
+            ));
+            for function in offenders {
+                output.push_str(&format!(
+                    "\n  line {} {} (complexity {})",
+                    function.start_line, function.name, function.complexity
+                ));
+            }
+        }
+    }
+
+    output
+}
+
+/// Formats the repository-wide complexity section appended to text reports.
+///
+/// Returns an empty string when no per-function metrics were recorded.
+///
+/// # Output Format
+///
+/// ```text
+///
+///
+/// Complexity: max 14, mean 2.31 across 52 functions
+/// Nesting depth: max 5 (src/parser.rs:88 count_nodes)
+/// Cognitive complexity: max 21 (src/parser.rs:88 count_nodes)
+/// Maintainability index: min 38.4 (src/parser.rs:88 count_nodes)
+/// Functions above complexity threshold 10:
+///   src/parser.rs:88 count_nodes (complexity 14)
+/// ```
+fn format_complexity(stats: &DirectoryStats, thresholds: &Thresholds) -> String {
+    let function_count = stats.functions().count();
+    if function_count == 0 {
+        return String::new();
+    }
+
+    let mut output = format!(
+        "\n\nComplexity: max {}, mean {:.2} across {} functions",
+        stats.max_complexity(),
+        stats.mean_complexity(),
+        function_count
+    );
+    if let Some(deepest) = stats.deepest_function() {
+        output.push_str(&format!(
+            "\nNesting depth: max {} ({}:{} {})",
+            deepest.function.max_nesting,
+            deepest.path.display(),
+            deepest.function.start_line,
+            deepest.function.name
+        ));
+    }
+    if let Some(tangled) = stats.most_cognitive_function() {
+        output.push_str(&format!(
+            "\nCognitive complexity: max {} ({}:{} {})",
+            tangled.function.cognitive,
+            tangled.path.display(),
+            tangled.function.start_line,
+            tangled.function.name
+        ));
+    }
+    if let Some(fragile) = stats.least_maintainable_function() {
+        output.push_str(&format!(
+            "\nMaintainability index: min {:.1} ({}:{} {})",
+            fragile.function.maintainability,
+            fragile.path.display(),
+            fragile.function.start_line,
+            fragile.function.name
+        ));
+    }
+
+    let offenders = stats.complexity_offenders(thresholds.complexity);
+    if offenders.is_empty() {
+        output.push_str(&format!(
+            "\nNo functions above complexity threshold {}",
+            thresholds.complexity
+        ));
+    } else {
+        output.push_str(&format!(
+            "\nFunctions above complexity threshold {}:",
+            thresholds.complexity
+        ));
+        for offender in offenders {
+            output.push_str(&format!(
+                "\n  {}:{} {} (complexity {})",
+                offender.path.display(),
+                offender.function.start_line,
+                offender.function.name,
+                offender.function.complexity
+            ));
+        }
+    }
+
+    output
+}
+
+/// Formats a per-kind breakdown as a comma-separated `kind: count` list.
+///
+/// Kinds appear in the map's (alphabetical) order, e.g. `enum: 1, function: 4, struct: 1`.
+/// Also used for custom query counters, which share the same shape.
+fn format_kinds(kinds: &BTreeMap<String, usize>) -> String {
+    kinds
+        .iter()
+        .map(|(kind, count)| format!("{kind}: {count}"))
+        .collect::<Vec<_>>()
+        .join(", ")
+}
+
+/// Formats plugin metrics, e.g. `team.handlers: 3, team.ratio: 0.5`.
+fn format_plugin_metrics(metrics: &BTreeMap<String, f64>) -> String {
+    metrics
+        .iter()
+        .map(|(name, value)| format!("{name}: {value}"))
+        .collect::<Vec<_>>()
+        .join(", ")
+}
+
+/// Formats line counts, e.g. `17 code, 3 comments, 4 blank (15.0% comments)`.
+///
+/// The percentage is the comment density: comment lines over non-blank lines
+/// of code and comments. Embedded markup, such as the HTML in PHP templates,
+/// follows with its share of all non-blank lines when there is any:
+/// `..., 20 markup (50.0% of non-blank)`.
+fn format_lines(lines: &LineStats) -> String {
+    let mut output = format!(
+        "{} code, {} comments, {} blank ({:.1}% comments)",
+        lines.code,
+        lines.comment,
+        lines.blank,
+        lines.comment_density() * 100.0
+    );
+    if lines.markup > 0 {
+        output.push_str(&format!(
+            ", {} markup ({:.1}% of non-blank)",
+            lines.markup,
+            lines.markup_share() * 100.0
+        ));
+    }
+    if lines.prose > 0 {
+        output.push_str(&format!(", {} prose", lines.prose));
+    }
+    output
+}
+
+/// Formats the code extracted from a document's blocks in one language, e.g.
+/// `3 code blocks, 2 functions, 0 structs/classes, 12 code lines`.
+fn format_embedded(embedded: &EmbeddedCode) -> String {
+    format!(
+        "{} code block{}, {} functions, {} structs/classes, {} code lines",
+        embedded.blocks,
+        if embedded.blocks == 1 { "" } else { "s" },
+        embedded.stats.function_count,
+        embedded.stats.class_struct_count,
+        embedded.stats.lines.code
+    )
+}
+
+/// Formats the shape of a configuration file or directory, e.g.
+/// `41 keys, max depth 4, 3 documents`; the document count is left out when
+/// there is only one.
+fn format_config(config: &ConfigStats) -> String {
+    let mut output = format!(
+        "{} key{}, max depth {}",
+        config.keys,
+        if config.keys == 1 { "" } else { "s" },
+        config.max_depth
+    );
+    if config.documents > 1 {
+        output.push_str(&format!(", {} documents", config.documents));
+    }
+    output
+}
+
+/// Formats Go metrics, e.g. `3 goroutines, 5 channel operations (2 sends,
+/// 3 receives), 1 select, 4 defers, 6 of 10 functions return an error (60%)`.
+fn format_go(go: &GoStats) -> String {
+    let plural =
+        |count: usize, word: &str| format!("{count} {word}{}", if count == 1 { "" } else { "s" });
+    let mut output = format!(
+        "{}, {} ({}, {}), {}, {}",
+        plural(go.goroutines, "goroutine"),
+        plural(go.channel_sends + go.channel_receives, "channel operation"),
+        plural(go.channel_sends, "send"),
+        plural(go.channel_receives, "receive"),
+        plural(go.selects, "select"),
+        plural(go.defers, "defer"),
+    );
+    if let Some(ratio) = go.error_return_ratio() {
+        output.push_str(&format!(
+            ", {} of {} return an error ({:.0}%)",
+            go.error_returning,
+            plural(go.functions, "function"),
+            ratio * 100.0
+        ));
+    }
+    output
+}
+
+/// Formats the structure of HTML documents and stylesheets, e.g. `42
+/// elements, 12 rules, 17 selectors, max depth 7`; element or rule counts
+/// are left out when there are none.
+fn format_web(web: &WebStats) -> String {
+    let plural =
+        |count: usize, word: &str| format!("{count} {word}{}", if count == 1 { "" } else { "s" });
+    let mut parts = Vec::new();
+    if web.elements > 0 {
+        parts.push(plural(web.elements, "element"));
+    }
+    if web.rules > 0 {
+        parts.push(plural(web.rules, "rule"));
+        parts.push(plural(web.selectors, "selector"));
+    }
+    parts.push(format!("max depth {}", web.max_depth));
+    parts.join(", ")
+}
+
+/// Formats the cells of notebooks, e.g. `12 code cells, 5 markdown cells,
+/// 38.5% markdown`; raw cells are left out when there are none.
+fn format_notebook(notebook: &NotebookStats) -> String {
+    let plural =
+        |count: usize, word: &str| format!("{count} {word}{}", if count == 1 { "" } else { "s" });
+    let mut parts = vec![
+        plural(notebook.code_cells, "code cell"),
+        plural(notebook.markdown_cells, "markdown cell"),
+    ];
+    if notebook.raw_cells > 0 {
+        parts.push(plural(notebook.raw_cells, "raw cell"));
+    }
+    parts.push(format!(
+        "{:.1}% markdown",
+        notebook.markdown_share() * 100.0
+    ));
+    parts.join(", ")
+}
+
+/// Formats the code lines of each section of components, e.g. `template 24,
+/// script 40, style 12 code lines`; sections without any lines are left out.
+fn format_sections(component: &ComponentStats) -> String {
+    let sections: Vec<String> = [
+        ("template", &component.template),
+        ("script", &component.script),
+        ("style", &component.style),
+    ]
+    .into_iter()
+    .filter(|(_, lines)| lines.total() > 0)
+    .map(|(name, lines)| format!("{name} {}", lines.code))
+    .collect();
+    format!("{} code lines", sections.join(", "))
+}
+
+/// Formats the tags of templates, e.g. `14 interpolations, 5 conditionals,
+/// 3 loops, max depth 2`.
+fn format_template(template: &TemplateStats) -> String {
+    let plural =
+        |count: usize, word: &str| format!("{count} {word}{}", if count == 1 { "" } else { "s" });
+    format!(
+        "{}, {}, {}, max depth {}",
+        plural(template.interpolations, "interpolation"),
+        plural(template.conditionals, "conditional"),
+        plural(template.loops, "loop"),
+        template.max_depth
+    )
+}
+
+/// Formats the definitions of GraphQL files, e.g. `12 types, 48 fields,
+/// 3 queries, 1 fragment`; operations and fragments are left out when there
+/// are none.
+fn format_graphql(graphql: &GraphqlStats) -> String {
+    let plural =
+        |count: usize, word: &str| format!("{count} {word}{}", if count == 1 { "" } else { "s" });
+    let mut parts = vec![
+        plural(graphql.types, "type"),
+        plural(graphql.fields, "field"),
+    ];
+    let queries = match graphql.queries {
+        1 => "1 query".to_string(),
+        count => format!("{count} queries"),
+    };
+    for (count, part) in [
+        (graphql.queries, queries),
+        (graphql.mutations, plural(graphql.mutations, "mutation")),
+        (
+            graphql.subscriptions,
+            plural(graphql.subscriptions, "subscription"),
+        ),
+        (graphql.fragments, plural(graphql.fragments, "fragment")),
+    ] {
+        if count > 0 {
+            parts.push(part);
+        }
+    }
+    parts.join(", ")
+}
+
+/// Formats the blocks of Terraform files with the resources of each provider
+/// by count, e.g. `12 resources (aws 9, random 3), 2 data sources, 1 module,
+/// 4 variables, 3 outputs`.
+fn format_terraform(terraform: &TerraformStats) -> String {
+    let plural =
+        |count: usize, word: &str| format!("{count} {word}{}", if count == 1 { "" } else { "s" });
+    let mut providers: Vec<(&String, &usize)> = terraform.providers.iter().collect();
+    providers.sort_by(|a, b| b.1.cmp(a.1).then(a.0.cmp(b.0)));
+    let providers: Vec<String> = providers
+        .into_iter()
+        .map(|(provider, count)| format!("{provider} {count}"))
+        .collect();
+    let mut resources = plural(terraform.resources, "resource");
+    if !providers.is_empty() {
+        resources.push_str(&format!(" ({})", providers.join(", ")));
+    }
+    format!(
+        "{resources}, {}, {}, {}, {}",
+        plural(terraform.data_sources, "data source"),
+        plural(terraform.modules, "module"),
+        plural(terraform.variables, "variable"),
+        plural(terraform.outputs, "output")
+    )
+}
+
+/// Formats generic code counts, e.g. `4 declarations (max 3 type
+/// parameters), 12 instantiations`.
+fn format_generics(generics: &GenericsStats) -> String {
+    let plural =
+        |count: usize, word: &str| format!("{count} {word}{}", if count == 1 { "" } else { "s" });
+    format!(
+        "{} (max {}), {}",
+        plural(generics.declarations, "declaration"),
+        plural(generics.max_type_parameters, "type parameter"),
+        plural(generics.instantiations, "instantiation")
+    )
+}
+
+/// Formats anonymous function counts, e.g. `12 anonymous functions (3
+/// nested, 4 at top level), max depth 2`.
+fn format_closures(closures: &ClosureStats) -> String {
+    format!(
+        "{} anonymous function{} ({} nested, {} at top level), max depth {}",
+        closures.count,
+        if closures.count == 1 { "" } else { "s" },
+        closures.nested,
+        closures.top_level,
+        closures.max_depth
+    )
+}
+
+/// Formats error-handling counts, e.g. `12 checks (1.50 per function), 8
+/// fallible calls, 3 panics, 2 assertions, 1 unhandled function`.
+fn format_error_handling(error_handling: &ErrorHandlingStats) -> String {
+    let plural =
+        |count: usize, word: &str| format!("{count} {word}{}", if count == 1 { "" } else { "s" });
+    let counts = &error_handling.counts;
+    let mut checks = plural(counts.checks, "check");
+    if let Some(density) = error_handling.checks_per_function() {
+        checks.push_str(&format!(" ({density:.2} per function)"));
+    }
+    format!(
+        "{checks}, {}, {}, {}, {}",
+        plural(counts.fallible_calls, "fallible call"),
+        plural(counts.panics, "panic"),
+        plural(counts.assertions, "assertion"),
+        plural(error_handling.unhandled, "unhandled function")
+    )
+}
+
+/// Joins a summary of each language into one line sorted by language name,
+/// e.g. `Go 3 closures; Rust 5 closures`.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics whose per-language totals are summarized
+/// * `summary` - Summary of one language, `None` to leave it out
+///
+/// # Returns
+///
+/// `None` if no language has a summary
+fn per_language_summary(
+    stats: &DirectoryStats,
+    summary: impl Fn(&LanguageStats) -> Option<String>,
+) -> Option<String> {
+    let mut languages: Vec<String> = stats
+        .total_by_language
+        .iter()
+        .filter_map(|(language, lang_stats)| Some(format!("{language:?} {}", summary(lang_stats)?)))
+        .collect();
+    if languages.is_empty() {
+        return None;
+    }
+    languages.sort();
+    Some(languages.join("; "))
+}
+
+/// Formats switch statement counts, e.g. `5 switch/match statements, 2
+/// without a default arm, max 14 branches`.
+fn format_switches<'a>(switches: impl IntoIterator<Item = &'a SwitchStats>) -> String {
+    let (mut count, mut without_default, mut max_branches) = (0, 0, 0);
+    for switch in switches {
+        count += 1;
+        without_default += usize::from(!switch.has_default);
+        max_branches = max_branches.max(switch.branches);
+    }
+    format!(
+        "{count} switch/match statement{}, {without_default} without a default arm, \
+         max {max_branches} branch{}",
+        if count == 1 { "" } else { "s" },
+        if max_branches == 1 { "" } else { "es" }
+    )
+}
+
+/// Formats the method sets of a Go file's receiver types, e.g. `Cart (1
+/// value, 2 pointer), Stack (1 value)`.
+fn format_method_sets(go: &GoStats) -> String {
+    let sets: Vec<String> = go
+        .method_sets
+        .iter()
+        .map(|(name, set)| {
+            let mut receivers = Vec::new();
+            if set.value > 0 {
+                receivers.push(format!("{} value", set.value));
+            }
+            if set.pointer > 0 {
+                receivers.push(format!("{} pointer", set.pointer));
+            }
+            format!("{name} ({})", receivers.join(", "))
+        })
+        .collect();
+    sets.join(", ")
+}
+
+/// Formats the configuration bucket of a summary, e.g.
+/// `3 files (Yaml: 2, Json: 1), 54 keys, max depth 5, 4 documents, 60 code lines`.
+fn format_configuration(configuration: &ConfigurationStats) -> String {
+    let formats: Vec<String> = configuration
+        .by_language
+        .iter()
+        .map(|(language, files)| format!("{language:?}: {files}"))
+        .collect();
+    format!(
+        "{} file{} ({}), {}, {} code lines",
+        configuration.files,
+        if configuration.files == 1 { "" } else { "s" },
+        formats.join(", "),
+        format_config(&configuration.config),
+        configuration.lines.code
+    )
+}
+
+/// Formats doc coverage, e.g. `3/4 public items documented (75.0%)`.
+///
+/// Returns `None` when there are no public declarations to document.
+fn format_doc_coverage(docs: &DocCoverage) -> Option<String> {
+    docs.ratio().map(|ratio| {
+        format!(
+            "{}/{} public items documented ({:.1}%)",
+            docs.documented,
+            docs.public,
+            ratio * 100.0
+        )
+    })
+}
+
+/// Formats directory statistics as a summary view.
+///
+/// Creates a concise overview showing aggregated statistics by programming language,
+/// followed by overall totals. Languages are sorted alphabetically for consistent output.
+///
+/// # Arguments
+///
+/// * `stats` - Directory statistics containing per-language aggregations
+///
+/// # Returns
+///
+/// A formatted string with language-wise summaries and grand totals
+///
+/// # Output Format
+///
+/// ```text
+/// Language Summary:
+///   Go:           15 functions,    3 structs/classes in 5 files
+///   Python:       8 functions,    2 structs/classes in 3 files
+///   Rust:         20 functions,   12 structs/classes in 8 files
+///
+/// Total: 43 functions, 17 structs/classes in 16 files
+/// Lines: 2210 code, 405 comments, 388 blank (15.5% comments)
+/// Logical lines: 1630
+/// Doc coverage: 31/40 public items documented (77.5%)
+///
+/// Configuration: 2 files (Json: 1, Toml: 1), 48 keys, max depth 3, 2 documents, 52 code lines
+/// Largest configuration files:
+///   Cargo.toml (36 keys, max depth 3)
+///   package.json (12 keys, max depth 2)
+///
+/// Switches: 41 switch/match statements, 6 without a default arm, max 14 branches
+/// Largest switches:
+///   src/parser.rs:212 match (14 branches)
+///   src/lexer.rs:88 match (9 branches, no default)
+/// ```
+///
+/// Configuration files are left out of the language rows and the totals.
+/// An interrupted analysis starts with an `Incomplete:` line.
+fn format_summary(stats: &DirectoryStats) -> String {
+    let mut output = String::new();
+
+    if stats.interrupted > 0 {
+        output.push_str(&format!(
+            "Incomplete: analysis interrupted, {} file{} not analyzed\n\n",
+            stats.interrupted,
+            if stats.interrupted == 1 { "" } else { "s" }
+        ));
+    }
+
+    output.push_str("Language Summary:\n");
+
+    // Sort languages alphabetically for consistent output ordering
+    let mut languages: Vec<_> = stats.total_by_language.iter().collect();
+    languages.sort_by_key(|(lang, _)| format!("{lang:?}"));
+
+    // Format each language's statistics with aligned columns
+    for (language, lang_stats) in languages {
+        output.push_str(&format!(
+            "  {:12} {:4} functions, {:4} structs/classes in {} files",
+            format!("{:?}:", language),
+            lang_stats.function_count,
+            lang_stats.class_struct_count,
+            lang_stats.file_count
+        ));
+        if lang_stats.code_blocks > 0 {
+            output.push_str(&format!(
+                " and {} embedded code blocks",
+                lang_stats.code_blocks
+            ));
+        }
+        output.push('\n');
+    }
+
+    // Add grand totals at the end
+    output.push_str(&format!(
+        "\nTotal: {} functions, {} structs/classes in {} files",
+        stats.total_stats.function_count,
+        stats.total_stats.class_struct_count,
+        stats.code_files()
+    ));
+
+    if !stats.total_stats.queries.is_empty() {
+        output.push_str(&format!(
+            "\nQueries: {}",
+            format_kinds(&stats.total_stats.queries)
+        ));
+    }
+
+    if !stats.total_stats.plugins.is_empty() {
+        output.push_str(&format!(
+            "\nPlugin metrics: {}",
+            format_plugin_metrics(&stats.total_stats.plugins)
+        ));
+    }
+
+    if stats.total_stats.lines.total() > 0 {
+        output.push_str(&format!(
+            "\nLines: {}",
+            format_lines(&stats.total_stats.lines)
+        ));
+    }
+    if stats.total_stats.lines.logical > 0 {
+        output.push_str(&format!(
+            "\nLogical lines: {}",
+            stats.total_stats.lines.logical
+        ));
+    }
+    if let Some(coverage) = format_doc_coverage(&stats.total_stats.docs) {
+        output.push_str(&format!("\nDoc coverage: {coverage}"));
+    }
+    if let Some(go) = &stats.total_stats.go {
+        output.push_str(&format!("\nGo: {}", format_go(go)));
+    }
+    if let Some(web) = &stats.total_stats.web {
+        output.push_str(&format!("\nWeb: {}", format_web(web)));
+    }
+    if let Some(notebook) = &stats.total_stats.notebook {
+        output.push_str(&format!("\nNotebook: {}", format_notebook(notebook)));
+    }
+    if let Some(component) = &stats.total_stats.component {
+        output.push_str(&format!("\nSections: {}", format_sections(component)));
+    }
+    if let Some(template) = &stats.total_stats.template {
+        output.push_str(&format!("\nTemplate: {}", format_template(template)));
+    }
+    if let Some(graphql) = &stats.total_stats.graphql {
+        output.push_str(&format!("\nGraphQL: {}", format_graphql(graphql)));
+    }
+    if let Some(terraform) = &stats.total_stats.terraform {
+        output.push_str(&format!("\nTerraform: {}", format_terraform(terraform)));
+    }
+    let generics = per_language_summary(stats, |lang_stats| {
+        let generics = lang_stats.generics.as_ref().filter(|g| !g.is_empty())?;
+        Some(format_generics(generics))
+    });
+    if let Some(generics) = generics {
+        output.push_str(&format!("\nGenerics: {generics}"));
+    }
+    let closures = per_language_summary(stats, |lang_stats| {
+        let closures = lang_stats.closures.as_ref().filter(|c| !c.is_empty())?;
+        Some(format_closures(closures))
+    });
+    if let Some(closures) = closures {
+        output.push_str(&format!("\nClosures: {closures}"));
+    }
+    let error_handling = per_language_summary(stats, |lang_stats| {
+        let error_handling = lang_stats
+            .error_handling
+            .as_ref()
+            .filter(|e| !e.is_empty())?;
+        Some(format_error_handling(error_handling))
+    });
+    if let Some(error_handling) = error_handling {
+        output.push_str(&format!("\nError handling: {error_handling}"));
+    }
+    let unhandled = stats.unhandled_functions();
+    if !unhandled.is_empty() {
+        output.push_str("\nUnhandled fallible calls:");
+        for found in unhandled.iter().take(UNHANDLED_FUNCTIONS) {
+            let calls = found.function.error_handling.fallible_calls;
+            output.push_str(&format!(
+                "\n  {}:{} {} ({calls} fallible call{}, no checks)",
+                found.path.display(),
+                found.function.start_line,
+                found.function.name,
+                if calls == 1 { "" } else { "s" }
+            ));
+        }
+        if unhandled.len() > UNHANDLED_FUNCTIONS {
+            output.push_str("\n  ...");
+        }
+    }
+    if stats.tests.files > 0 {
+        output.push_str(&format!(
+            "\nTests: {} file{}, {} code lines, {} functions (test-to-code ratio {})",
+            stats.tests.files,
+            if stats.tests.files == 1 { "" } else { "s" },
+            stats.tests.lines.code,
+            stats.tests.function_count,
+            format_test_ratio(stats.test_ratio())
+        ));
+    }
+
+    let files = stats.files_with_parse_issues().count();
+    if files > 0 {
+        output.push_str(&format!(
+            "\nParse errors: {} in {files} files (counts may be incomplete; see --detail)",
+            format_parse_issue_counts(
+                stats.total_stats.error_nodes + stats.configuration.error_nodes,
+                stats.total_stats.missing_nodes + stats.configuration.missing_nodes
+            )
+        ));
+        output.push_str(&format!(
+            "\nParse health: {:.1}% ({} of {} files parsed cleanly)",
+            stats.parse_health(),
+            stats.files.len() - files,
+            stats.files.len()
+        ));
+    }
+
+    let mut encodings: BTreeMap<String, usize> = BTreeMap::new();
+    for file in &stats.files {
+        if !file.stats.encoding.is_utf8() {
+            *encodings
+                .entry(file.stats.encoding.to_string())
+                .or_default() += 1;
+        }
+    }
+    if !encodings.is_empty() {
+        let files = encodings.values().sum::<usize>();
+        output.push_str(&format!(
+            "\nTranscoded: {files} file{} ({})",
+            if files == 1 { "" } else { "s" },
+            format_kinds(&encodings)
+        ));
+    }
+    if !stats.undecodable.is_empty() {
+        output.push_str(&format!(
+            "\nUndecodable: {} file{} skipped ({})",
+            stats.undecodable.len(),
+            if stats.undecodable.len() == 1 {
+                ""
+            } else {
+                "s"
+            },
+            format_paths(&stats.undecodable, UNDECODABLE_FILES)
+        ));
+    }
+    let oversized = stats.oversized_files();
+    if !oversized.is_empty() {
+        output.push_str(&format!(
+            "\nNot parsed: {} file{} above the parse size limit, only lines counted ({})",
+            oversized.len(),
+            if oversized.len() == 1 { "" } else { "s" },
+            format_paths(&oversized, OVERSIZED_FILES)
+        ));
+    }
+    if !stats.timed_out.is_empty() {
+        output.push_str(&format!(
+            "\nTimed out: {} file{} not parsed within the parse timeout ({})",
+            stats.timed_out.len(),
+            if stats.timed_out.len() == 1 { "" } else { "s" },
+            format_paths(&stats.timed_out, TIMED_OUT_FILES)
+        ));
+    }
+    let plugin_failures: Vec<PathBuf> = stats
+        .files
+        .iter()
+        .filter(|file| !file.stats.plugin_errors.is_empty())
+        .map(|file| file.path.clone())
+        .collect();
+    if !plugin_failures.is_empty() {
+        output.push_str(&format!(
+            "\nPlugin errors: {} file{} without some plugin metrics ({})",
+            plugin_failures.len(),
+            if plugin_failures.len() == 1 { "" } else { "s" },
+            format_paths(&plugin_failures, PLUGIN_ERROR_FILES)
+        ));
+    }
+
+    let switches = stats.largest_switches(LARGEST_SWITCHES);
+    if !switches.is_empty() {
+        output.push_str(&format!(
+            "\n\nSwitches: {}",
+            format_switches(stats.switches().map(|found| found.switch))
+        ));
+        output.push_str("\nLargest switches:");
+        for found in switches {
+            output.push_str(&format!(
+                "\n  {}:{} {} ({} branch{}{})",
+                found.path.display(),
+                found.switch.start_line,
+                found.switch.kind,
+                found.switch.branches,
+                if found.switch.branches == 1 { "" } else { "es" },
+                if found.switch.has_default {
+                    ""
+                } else {
+                    ", no default"
+                }
+            ));
+        }
+    }
+
+    if stats.configuration.files > 0 {
+        output.push_str(&format!(
+            "\n\nConfiguration: {}",
+            format_configuration(&stats.configuration)
+        ));
+        output.push_str("\nLargest configuration files:");
+        for file in stats.largest_config_files(LARGEST_CONFIG_FILES) {
+            if let Some(config) = &file.stats.config {
+                output.push_str(&format!(
+                    "\n  {} ({})",
+                    file.path.display(),
+                    format_config(config)
+                ));
+            }
+        }
+    }
+
+    if stats.generated.files > 0 {
+        output.push_str(&format!(
+            "\n\nGenerated and vendored: {} (not in the totals above; \
+             --include-generated to count them)",
+            format_generated(&stats.generated)
+        ));
+    }
+
+    output
+}
+
+/// Formats the totals of the generated and vendored files, e.g. `3 files
+/// (generated: 2, vendored: 1), 1200 code lines, 85 functions`.
+fn format_generated(generated: &GeneratedStats) -> String {
+    let origins: Vec<String> = generated
+        .by_origin
+        .iter()
+        .map(|(origin, files)| format!("{origin}: {files}"))
+        .collect();
+    format!(
+        "{} file{} ({}), {} code lines, {} functions",
+        generated.files,
+        if generated.files == 1 { "" } else { "s" },
+        origins.join(", "),
+        generated.lines.code,
+        generated.function_count
+    )
+}
+
+/// Formats lines of test code per line of production code with two decimals,
+/// or `-` if there is no production code.
+fn format_test_ratio(ratio: Option<f64>) -> String {
+    ratio.map_or_else(|| "-".to_string(), |ratio| format!("{ratio:.2}"))
+}
+
+/// Formats the first `limit` paths separated by commas, followed by `...` if
+/// there are more.
+fn format_paths(paths: &[PathBuf], limit: usize) -> String {
+    let mut listed: Vec<String> = paths
+        .iter()
+        .take(limit)
+        .map(|path| path.display().to_string())
+        .collect();
+    if paths.len() > limit {
+        listed.push("...".to_string());
+    }
+    listed.join(", ")
+}
+
+/// Formats ERROR and MISSING node counts, e.g. `3 ERROR nodes, 1 MISSING
+/// node`, leaving out a kind that does not occur.
+fn format_parse_issue_counts(errors: usize, missing: usize) -> String {
+    let plural = |count: usize| if count == 1 { "" } else { "s" };
+    let mut parts = Vec::new();
+    if errors > 0 {
+        parts.push(format!("{errors} ERROR node{}", plural(errors)));
+    }
+    if missing > 0 {
+        parts.push(format!("{missing} MISSING node{}", plural(missing)));
+    }
+    parts.join(", ")
+}
+
+/// Formats a file's ERROR and MISSING node counts followed by the locations
+/// kept for them, e.g. `2 ERROR nodes, 1 MISSING node at 3:5, 9:1 (missing }),
+/// ...`.
+fn format_file_parse_issues(stats: &CodeStats) -> String {
+    let mut output = format_parse_issue_counts(stats.error_nodes, stats.missing_nodes);
+    if stats.parse_issues.is_empty() {
+        return output;
+    }
+    let locations: Vec<String> = stats
+        .parse_issues
+        .iter()
+        .map(|issue| match &issue.expected {
+            Some(expected) => format!("{}:{} (missing {expected})", issue.line, issue.column),
+            None => format!("{}:{}", issue.line, issue.column),
+        })
+        .collect();
+    output.push_str(&format!(" at {}", locations.join(", ")));
+    if stats.parse_issues.len() < stats.error_nodes + stats.missing_nodes {
+        output.push_str(", ...");
+    }
+    output
+}
+
+/// Formats `line 9 insert (7 lines, 2 CTEs)` for an SQL statement.
+fn format_statement(statement: &StatementStats) -> String {
+    let lines = statement.line_count();
+    let mut output = format!(
+        "line {} {} ({lines} line{}",
+        statement.start_line,
+        statement.kind,
+        if lines == 1 { "" } else { "s" }
+    );
+    if statement.ctes > 0 {
+        output.push_str(&format!(
+            ", {} CTE{}",
+            statement.ctes,
+            if statement.ctes == 1 { "" } else { "s" }
+        ));
+    }
+    output.push(')');
+    output
+}
+
+/// Formats directory statistics as a detailed view.
+///
+/// Provides comprehensive output showing individual file statistics followed by
+/// the summary view. Files are sorted by path for deterministic output ordering.
+///
+/// # Arguments
+///
+/// * `stats` - Directory statistics containing individual file results
+///
+/// # Returns
+///
+/// A formatted string with per-file details and summary statistics
+///
+/// # Output Format
+///
+/// ```text
+/// src/main.rs (Rust):
+///   Functions: 3
+///   Structs/Classes: 2
+///
+/// src/lib.rs (Rust):
+///   Functions: 5
+///   Structs/Classes: 1
+///
+/// Language Summary:
+/// [... summary content ...]
+/// ```
+fn format_detail(stats: &DirectoryStats) -> String {
+    let mut output = String::new();
+
+    // Sort files by path for consistent, deterministic output
+    let mut files = stats.files.clone();
+    files.sort_by(|a, b| a.path.cmp(&b.path));
+
+    // Display individual file statistics
+    for file in &files {
+        output.push_str(&format!(
+            "{} ({:?}):\n  Functions: {}\n  Structs/Classes: {}\n",
+            file.path.display(),
+            file.language,
+            file.stats.function_count,
+            file.stats.class_struct_count
+        ));
+        if !file.stats.kinds.is_empty() {
+            output.push_str(&format!(
+                "  Breakdown: {}\n",
+                format_kinds(&file.stats.kinds)
+            ));
+        }
+        if !file.stats.queries.is_empty() {
+            output.push_str(&format!(
+                "  Queries: {}\n",
+                format_kinds(&file.stats.queries)
+            ));
+        }
+        if !file.stats.plugins.is_empty() {
+            output.push_str(&format!(
+                "  Plugin metrics: {}\n",
+                format_plugin_metrics(&file.stats.plugins)
+            ));
+        }
+        if file.stats.lines.total() > 0 {
+            output.push_str(&format!("  Lines: {}\n", format_lines(&file.stats.lines)));
+        }
+        if file.stats.lines.logical > 0 {
+            output.push_str(&format!("  Logical lines: {}\n", file.stats.lines.logical));
+        }
+        if let Some(coverage) = format_doc_coverage(&file.stats.docs) {
+            output.push_str(&format!("  Doc coverage: {coverage}\n"));
+        }
+        if file.stats.script_complexity > 0 {
+            output.push_str(&format!(
+                "  Script complexity: {}\n",
+                file.stats.script_complexity
+            ));
+        }
+        if let Some(config) = &file.stats.config {
+            output.push_str(&format!("  Configuration: {}\n", format_config(config)));
+        }
+        for (language, embedded) in &file.stats.embedded {
+            output.push_str(&format!(
+                "  Embedded {language:?}: {}\n",
+                format_embedded(embedded)
+            ));
+        }
+        if let Some(statement) = file.stats.longest_statements(1).first() {
+            output.push_str(&format!(
+                "  Longest statement: {}\n",
+                format_statement(statement)
+            ));
+        }
+        if !file.stats.functions.is_empty() {
+            output.push_str(&format!(
+                "  Nesting depth: max {}\n",
+                file.stats.max_nesting()
+            ));
+            output.push_str(&format!(
+                "  Cognitive complexity: max {}\n",
+                file.stats.max_cognitive()
+            ));
+            if let Some(index) = file.stats.min_maintainability() {
+                output.push_str(&format!("  Maintainability index: min {index:.1}\n"));
+            }
+        }
+        if !file.stats.parsed_cleanly() {
+            output.push_str(&format!(
+                "  Parse errors: {}\n",
+                format_file_parse_issues(&file.stats)
+            ));
+        }
+        if file.stats.oversized {
+            output.push_str("  Not parsed: only lines counted\n");
+        }
+        if !file.stats.encoding.is_utf8() {
+            output.push_str(&format!("  Encoding: {}\n", file.stats.encoding));
+        }
+        if let Some(origin) = file.stats.origin {
+            output.push_str(&format!("  Origin: {origin} (not in the totals)\n"));
+        }
+        if file.stats.test_file {
+            output.push_str("  Test file\n");
+        }
+        output.push('\n');
+    }
+
+    // Append summary statistics at the end
+    output.push_str(&format_summary(stats));
+
+    output
+}
+
+/// Formats directory statistics as JSON for machine consumption.
+///
+/// Serializes the complete directory statistics structure to pretty-printed JSON.
+/// This format is ideal for programmatic processing, integration with other tools,
+/// or storage for later analysis.
+///
+/// # Arguments
+///
+/// * `stats` - Directory statistics to serialize
+/// * `thresholds` - Limits used to select complexity offenders
+///
+/// # Returns
+///
+/// A JSON string with pretty formatting, or an error message if serialization fails
+///
+/// # JSON Structure
+///
+/// The output includes:
+/// - `schema_version`: Version of the report schema (see `JSON_SCHEMA_VERSION`)
+/// - `analyzer_version`: Version of code-stats-rs that wrote the report
+/// - `files`: Array of individual file statistics, sorted by path
+/// - `total_by_language`: Language-aggregated statistics, sorted by language
+/// - `total_stats`: Overall totals across all languages
+/// - `configuration`: Totals of the YAML, JSON, and TOML files, if any
+/// - `generated`: Totals of the generated and vendored files, if any
+/// - `tests`: Totals of the test files and the test-to-code ratio, if any
+/// - `total_files`: Number of analyzed files
+/// - `parse_health`: Percentage of files without ERROR or MISSING nodes
+/// - `undecodable`: Files skipped because they could not be decoded, if any
+/// - `oversized`: Files above the parse size limit with only their lines counted, if any
+/// - `timed_out`: Files skipped because their parse timed out, if any
+/// - `incomplete` and `interrupted`: Set, with the number of files left
+///   unanalyzed, if the analysis was interrupted
+/// - `complexity`: Maximum and mean complexity plus functions above the threshold
+///
+/// # Error Handling
+///
+/// If JSON serialization fails (highly unlikely with our data structures),
+/// returns a formatted error message instead of panicking.
+fn format_json(stats: &DirectoryStats, thresholds: &Thresholds) -> String {
+    let mut files: Vec<&FileStats> = stats.files.iter().collect();
+    files.sort_by(|a, b| a.path.cmp(&b.path));
+
+    let report = JsonReport {
+        schema_version: JSON_SCHEMA_VERSION,
+        analyzer_version: ANALYZER_VERSION,
+        files,
+        total_by_language: stats
+            .total_by_language
+            .iter()
+            .map(|(k, v)| (*k, v))
+            .collect(),
+        total_stats: &stats.total_stats,
+        configuration: (stats.configuration.files > 0).then_some(&stats.configuration),
+        generated: (stats.generated.files > 0).then_some(&stats.generated),
+        tests: (stats.tests.files > 0).then(|| TestReport {
+            totals: &stats.tests,
+            ratio: stats.test_ratio(),
+        }),
+        total_files: stats.total_files(),
+        parse_health: stats.parse_health(),
+        undecodable: &stats.undecodable,
+        oversized: stats.oversized_files(),
+        timed_out: &stats.timed_out,
+        incomplete: stats.interrupted > 0,
+        interrupted: stats.interrupted,
+        complexity: ComplexityReport {
+            max: stats.max_complexity(),
+            mean: stats.mean_complexity(),
+            max_nesting: stats
+                .deepest_function()
+                .map_or(0, |f| f.function.max_nesting),
+            max_cognitive: stats
+                .most_cognitive_function()
+                .map_or(0, |f| f.function.cognitive),
+            min_maintainability: stats
+                .least_maintainable_function()
+                .map(|f| f.function.maintainability),
+            threshold: thresholds.complexity,
+            offenders: stats.complexity_offenders(thresholds.complexity),
+        },
+    };
+
+    serde_json::to_string_pretty(&report)
+        .unwrap_or_else(|e| format!("Error serializing to JSON: {e}"))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::encoding::SourceEncoding;
+    use crate::health::{ParseIssue, ParseIssueKind};
+    use crate::origin::CodeOrigin;
+    use std::path::PathBuf;
+
+    /// Creates a sample DirectoryStats for testing purposes.
+    ///
+    /// This helper function sets up realistic test data with multiple files
+    /// across different programming languages to verify formatting behavior.
+    fn create_test_directory_stats() -> DirectoryStats {
+        let mut stats = DirectoryStats::new();
+
+        stats.add_file(FileStats {
+            path: PathBuf::from("src/main.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                function_count: 3,
+                class_struct_count: 2,
+                ..Default::default()
+            },
+        });
+
+        stats.add_file(FileStats {
+            path: PathBuf::from("src/lib.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                function_count: 5,
+                class_struct_count: 1,
+                ..Default::default()
+            },
+        });
+
+        stats.add_file(FileStats {
+            path: PathBuf::from("test.py"),
+            language: SupportedLanguage::Python,
+            stats: CodeStats {
+                function_count: 2,
+                class_struct_count: 1,
+                ..Default::default()
+            },
+        });
+
+        stats
+    }
+
+    /// Tests single file formatting output.
+    ///
+    /// Verifies that format_single_file produces the expected content including
+    /// file path, language detection, and statistical counts.
+    #[test]
+    fn test_format_single_file() {
+        let file_stats = FileStats {
+            path: PathBuf::from("test.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                function_count: 10,
+                class_struct_count: 5,
+                ..Default::default()
+            },
+        };
+
+        let output = format_single_file(&file_stats, &Thresholds::default());
+
+        assert!(output.contains("Analyzing file: test.rs"));
+        assert!(output.contains("Language: Rust"));
+        assert!(output.contains("Functions: 10"));
+        assert!(output.contains("Classes/Structs: 5"));
+        // No breakdown line when no kinds were recorded
+        assert!(!output.contains("Breakdown:"));
+    }
+
+    /// Tests that the per-kind breakdown is rendered in alphabetical order.
+    #[test]
+    fn test_format_single_file_with_breakdown() {
+        let mut stats = CodeStats {
+            function_count: 2,
+            class_struct_count: 1,
+            ..Default::default()
+        };
+        stats.record_kind("trait");
+        stats.record_kind("function");
+        stats.record_kind("function");
+        stats.record_kind("struct");
+
+        let file_stats = FileStats {
+            path: PathBuf::from("shapes.rs"),
+            language: SupportedLanguage::Rust,
+            stats,
+        };
+
+        let output = format_single_file(&file_stats, &Thresholds::default());
+        assert!(output.contains("Breakdown: function: 2, struct: 1, trait: 1"));
+    }
+
+    /// Tests line counts and doc coverage in single-file and summary output.
+    #[test]
+    fn test_format_lines_and_doc_coverage() {
+        let file_stats = FileStats {
+            path: PathBuf::from("lib.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                lines: LineStats {
+                    code: 30,
+                    comment: 10,
+                    blank: 5,
+                    logical: 22,
+                    ..Default::default()
+                },
+                docs: DocCoverage {
+                    documented: 3,
+                    public: 4,
+                },
+                ..Default::default()
+            },
+        };
+
+        let output = format_single_file(&file_stats, &Thresholds::default());
+        assert!(output.contains("Lines: 30 code, 10 comments, 5 blank (25.0% comments)"));
+        // The single-file report leaves logical lines to JSON
+        assert!(!output.contains("Logical lines"));
+        assert!(output.contains("Doc coverage: 3/4 public items documented (75.0%)"));
+        assert!(!output.contains("markup"));
+
+        let template = FileStats {
+            path: PathBuf::from("cart.php"),
+            language: SupportedLanguage::Php,
+            stats: CodeStats {
+                lines: LineStats {
+                    code: 6,
+                    comment: 2,
+                    blank: 1,
+                    markup: 12,
+                    prose: 0,
+                    logical: 0,
+                },
+                ..Default::default()
+            },
+        };
+        assert!(
+            format_single_file(&template, &Thresholds::default()).contains(
+                "Lines: 6 code, 2 comments, 1 blank (25.0% comments), 12 markup (60.0% of non-blank)"
+            )
+        );
+
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file_stats.clone());
+        stats.add_file(FileStats {
+            path: PathBuf::from("main.rs"),
+            ..file_stats
+        });
+        let output = format_summary(&stats);
+        assert!(output.contains("\nLines: 60 code, 20 comments, 10 blank (25.0% comments)"));
+        assert!(output.contains("\nLogical lines: 44\n"));
+        assert!(output.contains("\nDoc coverage: 6/8 public items documented (75.0%)"));
+
+        // Nothing to report without public declarations
+        assert!(!format_summary(&create_test_directory_stats()).contains("Doc coverage"));
+    }
+
+    #[test]
+    fn test_format_parse_errors() {
+        let broken = FileStats {
+            path: PathBuf::from("src/macros.c"),
+            language: SupportedLanguage::C,
+            stats: CodeStats {
+                function_count: 1,
+                error_nodes: 2,
+                ..Default::default()
+            },
+        };
+
+        let output = format_single_file(&broken, &Thresholds::default());
+        assert!(output.contains("\nParse errors: 2 ERROR nodes (counts may be incomplete)"));
+
+        let mut stats = create_test_directory_stats();
+        assert!(!format_summary(&stats).contains("Parse errors"));
+        stats.add_file(broken);
+        stats.add_file(FileStats {
+            path: PathBuf::from("src/other.c"),
+            language: SupportedLanguage::C,
+            stats: CodeStats {
+                error_nodes: 1,
+                ..Default::default()
+            },
+        });
+        assert!(format_summary(&stats).contains(
+            "\nParse errors: 3 ERROR nodes in 2 files (counts may be incomplete; see --detail)"
+        ));
+        let detail = format_detail(&stats);
+        assert!(detail.contains("src/macros.c (C):"));
+        assert!(detail.contains("  Parse errors: 2 ERROR nodes\n"));
+        assert!(detail.contains("  Parse errors: 1 ERROR node\n"));
+        assert!(
+            format_summary(&stats).contains("\nParse health: 60.0% (3 of 5 files parsed cleanly)")
+        );
+    }
+
+    #[test]
+    fn test_format_encodings() {
+        let legacy = FileStats {
+            path: PathBuf::from("src/legacy.cs"),
+            language: SupportedLanguage::CSharp,
+            stats: CodeStats {
+                encoding: SourceEncoding::Utf16Le,
+                ..Default::default()
+            },
+        };
+        let output = format_single_file(&legacy, &Thresholds::default());
+        assert!(output.contains("\nEncoding: UTF-16LE (transcoded to UTF-8)"));
+
+        let mut stats = create_test_directory_stats();
+        assert!(!format_summary(&stats).contains("Transcoded"));
+        stats.add_file(legacy);
+        stats.undecodable = vec![PathBuf::from("a.c"), PathBuf::from("b.c")];
+        let summary = format_summary(&stats);
+        assert!(summary.contains("\nTranscoded: 1 file (UTF-16LE: 1)"));
+        assert!(summary.contains("\nUndecodable: 2 files skipped (a.c, b.c)"));
+        assert!(format_detail(&stats).contains("  Encoding: UTF-16LE\n"));
+
+        let json: serde_json::Value = serde_json::from_str(&format_output(
+            &stats,
+            OutputFormat::Json,
+            false,
+            &Thresholds::default(),
+        ))
+        .unwrap();
+        assert_eq!(json["undecodable"], serde_json::json!(["a.c", "b.c"]));
+        let files = json["files"].as_array().unwrap();
+        assert!(
+            files
+                .iter()
+                .any(|file| file["stats"]["encoding"] == "utf-16le")
+        );
+    }
+
+    #[test]
+    fn test_format_oversized_files() {
+        let tables = FileStats {
+            path: PathBuf::from("gen/tables.go"),
+            language: SupportedLanguage::Go,
+            stats: CodeStats {
+                lines: LineStats {
+                    code: 900_000,
+                    ..Default::default()
+                },
+                oversized: true,
+                ..Default::default()
+            },
+        };
+        let output = format_single_file(&tables, &Thresholds::default());
+        assert!(output.contains("\nNot parsed: above the parse size limit, only lines counted"));
+
+        let mut stats = create_test_directory_stats();
+        assert!(!format_summary(&stats).contains("Not parsed"));
+        stats.add_file(tables);
+        assert!(format_summary(&stats).contains(
+            "\nNot parsed: 1 file above the parse size limit, only lines counted (gen/tables.go)"
+        ));
+        assert!(format_detail(&stats).contains("  Not parsed: only lines counted\n"));
+
+        let json: serde_json::Value = serde_json::from_str(&format_output(
+            &stats,
+            OutputFormat::Json,
+            false,
+            &Thresholds::default(),
+        ))
+        .unwrap();
+        assert_eq!(json["oversized"], serde_json::json!(["gen/tables.go"]));
+        let files = json["files"].as_array().unwrap();
+        assert!(files.iter().any(|file| file["stats"]["oversized"] == true));
+    }
+
+    #[test]
+    fn test_format_timed_out_and_interrupted() {
+        let mut stats = create_test_directory_stats();
+        let summary = format_summary(&stats);
+        assert!(!summary.contains("Timed out") && !summary.contains("Incomplete"));
+        let json = format_output(&stats, OutputFormat::Json, false, &Thresholds::default());
+        assert!(!json.contains("\"incomplete\""));
+
+        stats.timed_out = vec![PathBuf::from("gen/parser.c")];
+        stats.interrupted = 12;
+        let summary = format_summary(&stats);
+        assert!(summary.starts_with("Incomplete: analysis interrupted, 12 files not analyzed\n\n"));
+        assert!(
+            summary
+                .contains("\nTimed out: 1 file not parsed within the parse timeout (gen/parser.c)")
+        );
+
+        let json: serde_json::Value = serde_json::from_str(&format_output(
+            &stats,
+            OutputFormat::Json,
+            false,
+            &Thresholds::default(),
+        ))
+        .unwrap();
+        assert_eq!(json["incomplete"], true);
+        assert_eq!(json["interrupted"], 12);
+        assert_eq!(json["timed_out"], serde_json::json!(["gen/parser.c"]));
+    }
+
+    #[test]
+    fn test_format_plugin_metrics() {
+        let metrics = |handlers: f64| {
+            BTreeMap::from([
+                ("team.handlers".to_string(), handlers),
+                ("team.weight".to_string(), 0.5),
+            ])
+        };
+        let mut stats = DirectoryStats::new();
+        stats.add_file(FileStats {
+            path: PathBuf::from("api/routes.go"),
+            language: SupportedLanguage::Go,
+            stats: CodeStats {
+                plugins: metrics(3.0),
+                ..Default::default()
+            },
+        });
+        stats.add_file(FileStats {
+            path: PathBuf::from("api/legacy.go"),
+            language: SupportedLanguage::Go,
+            stats: CodeStats {
+                plugin_errors: vec!["team: unsupported construct".to_string()],
+                ..Default::default()
+            },
+        });
+
+        let summary = format_summary(&stats);
+        assert!(summary.contains("\nPlugin metrics: team.handlers: 3, team.weight: 0.5"));
+        assert!(
+            summary.contains("\nPlugin errors: 1 file without some plugin metrics (api/legacy.go)")
+        );
+
+        let single = format_single_file(&stats.files[1], &Thresholds::default());
+        assert!(single.contains("\nPlugin errors: team: unsupported construct"));
+        let json = format_output(&stats, OutputFormat::Json, false, &Thresholds::default());
+        assert!(json.contains("\"team.handlers\": 3.0"));
+        assert!(json.contains("\"plugin_errors\""));
+    }
+
+    #[test]
+    fn test_format_generated_files() {
+        let generated = FileStats {
+            path: PathBuf::from("api/cart.pb.go"),
+            language: SupportedLanguage::Go,
+            stats: CodeStats {
+                function_count: 30,
+                lines: LineStats {
+                    code: 900,
+                    ..Default::default()
+                },
+                origin: Some(CodeOrigin::Generated),
+                ..Default::default()
+            },
+        };
+        assert!(
+            format_single_file(&generated, &Thresholds::default()).contains("\nOrigin: generated")
+        );
+
+        let mut stats = create_test_directory_stats();
+        let before = format_summary(&stats);
+        assert!(!before.contains("Generated and vendored"));
+        stats.add_file(generated);
+        let summary = format_summary(&stats);
+        assert!(summary.contains(
+            "\n\nGenerated and vendored: 1 file (generated: 1), 900 code lines, 30 functions \
+             (not in the totals above; --include-generated to count them)"
+        ));
+        // The code totals are unchanged
+        assert_eq!(
+            before.lines().find(|line| line.starts_with("Total:")),
+            summary.lines().find(|line| line.starts_with("Total:"))
+        );
+        assert!(format_detail(&stats).contains("  Origin: generated (not in the totals)\n"));
+
+        let json: serde_json::Value = serde_json::from_str(&format_output(
+            &stats,
+            OutputFormat::Json,
+            false,
+            &Thresholds::default(),
+        ))
+        .unwrap();
+        assert_eq!(json["generated"]["files"], 1);
+        assert_eq!(json["generated"]["by_origin"]["generated"], 1);
+    }
+
+    #[test]
+    fn test_format_test_files() {
+        let test = FileStats {
+            path: PathBuf::from("tests/cli.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                function_count: 4,
+                lines: LineStats {
+                    code: 40,
+                    ..Default::default()
+                },
+                test_file: true,
+                ..Default::default()
+            },
+        };
+        assert!(format_single_file(&test, &Thresholds::default()).contains("\nTest file: yes"));
+
+        let mut stats = create_test_directory_stats();
+        stats.add_file(FileStats {
+            path: PathBuf::from("src/cli.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                lines: LineStats {
+                    code: 160,
+                    ..Default::default()
+                },
+                ..Default::default()
+            },
+        });
+        assert!(!format_summary(&stats).contains("\nTests:"));
+        stats.add_file(test);
+        assert!(
+            format_summary(&stats)
+                .contains("\nTests: 1 file, 40 code lines, 4 functions (test-to-code ratio 0.25)")
+        );
+        assert!(format_detail(&stats).contains("  Test file\n"));
+
+        let json: serde_json::Value = serde_json::from_str(&format_output(
+            &stats,
+            OutputFormat::Json,
+            false,
+            &Thresholds::default(),
+        ))
+        .unwrap();
+        assert_eq!(json["tests"]["files"], 1);
+        assert_eq!(json["tests"]["lines"]["code"], 40);
+        assert!(json["tests"]["ratio"].is_number());
+        assert_eq!(format_test_ratio(None), "-");
+    }
+
+    #[test]
+    fn test_format_parse_issue_locations() {
+        let file = FileStats {
+            path: PathBuf::from("main.go"),
+            language: SupportedLanguage::Go,
+            stats: CodeStats {
+                error_nodes: 6,
+                missing_nodes: 1,
+                parse_issues: vec![
+                    ParseIssue {
+                        kind: ParseIssueKind::Missing,
+                        line: 4,
+                        column: 1,
+                        expected: Some("}".to_string()),
+                    },
+                    ParseIssue {
+                        kind: ParseIssueKind::Error,
+                        line: 7,
+                        column: 3,
+                        expected: None,
+                    },
+                ],
+                ..Default::default()
+            },
+        };
+
+        let output = format_single_file(&file, &Thresholds::default());
+        assert!(output.contains(
+            "\nParse errors: 6 ERROR nodes, 1 MISSING node at 4:1 (missing }), 7:3, ... \
+             (counts may be incomplete)"
+        ));
+    }
+
+    #[test]
+    fn test_format_script_complexity() {
+        let script = FileStats {
+            path: PathBuf::from("scripts/deploy.sh"),
+            language: SupportedLanguage::Bash,
+            stats: CodeStats {
+                function_count: 2,
+                script_complexity: 14,
+                ..Default::default()
+            },
+        };
+
+        let output = format_single_file(&script, &Thresholds::default());
+        assert!(output.contains("\nScript complexity: 14"));
+
+        let mut stats = create_test_directory_stats();
+        assert!(!format_detail(&stats).contains("Script complexity"));
+        stats.add_file(script);
+        assert!(format_detail(&stats).contains("  Script complexity: 14\n"));
+    }
+
+    #[test]
+    fn test_format_longest_statements() {
+        let statement = |kind: &str, start_line, end_line, ctes| StatementStats {
+            kind: kind.to_string(),
+            start_line,
+            end_line,
+            ctes,
+        };
+        let migration = FileStats {
+            path: PathBuf::from("migrations/0042_orders.sql"),
+            language: SupportedLanguage::Sql,
+            stats: CodeStats {
+                statements: vec![
+                    statement("ddl", 1, 6, 0),
+                    statement("select", 8, 8, 0),
+                    statement("insert", 10, 30, 1),
+                    statement("update", 32, 37, 0),
+                ],
+                ..Default::default()
+            },
+        };
+
+        let output = format_single_file(&migration, &Thresholds::default());
+        assert!(output.contains(
+            "\nLongest statements:\n  line 10 insert (21 lines, 1 CTE)\n  \
+             line 1 ddl (6 lines)\n  line 32 update (6 lines)"
+        ));
+        assert!(!output.contains("line 8 select"));
+
+        let mut stats = create_test_directory_stats();
+        assert!(!format_detail(&stats).contains("Longest statement"));
+        stats.add_file(migration);
+        assert!(
+            format_detail(&stats)
+                .contains("  Longest statement: line 10 insert (21 lines, 1 CTE)\n")
+        );
+        assert_eq!(
+            format_statement(&statement("select", 8, 8, 0)),
+            "line 8 select (1 line)"
+        );
+    }
+
+    #[test]
+    fn test_format_embedded_code() {
+        let mut document = CodeStats {
+            kinds: BTreeMap::from([("code_block".to_string(), 2)]),
+            lines: LineStats {
+                blank: 4,
+                markup: 4,
+                prose: 9,
+                ..Default::default()
+            },
+            ..Default::default()
+        };
+        document.embedded.insert(
+            SupportedLanguage::Go,
+            EmbeddedCode {
+                blocks: 2,
+                stats: CodeStats {
+                    function_count: 3,
+                    lines: LineStats {
+                        code: 14,
+                        ..Default::default()
+                    },
+                    ..Default::default()
+                },
+            },
+        );
+        let guide = FileStats {
+            path: PathBuf::from("docs/guide.md"),
+            language: SupportedLanguage::Markdown,
+            stats: document,
+        };
+
+        let output = format_single_file(&guide, &Thresholds::default());
+        assert!(output.contains(
+            "\nLines: 0 code, 0 comments, 4 blank (0.0% comments), 4 markup (30.8% of non-blank), 9 prose"
+        ));
+        assert!(output.contains(
+            "\nEmbedded Go: 2 code blocks, 3 functions, 0 structs/classes, 14 code lines"
+        ));
+
+        let mut stats = DirectoryStats::new();
+        stats.add_file(guide);
+        assert!(format_detail(&stats).contains("  Embedded Go: 2 code blocks,"));
+        let summary = format_summary(&stats);
+        assert!(summary.contains("in 0 files and 2 embedded code blocks\n"));
+        assert!(summary.contains("Markdown:       0 functions,    0 structs/classes in 1 files\n"));
+        assert!(summary.contains("Total: 3 functions, 0 structs/classes in 1 files"));
+    }
+
+    /// Tests summary format output structure and content.
+    ///
+    /// Validates that format_summary correctly aggregates statistics by language,
+    /// sorts languages alphabetically, and includes accurate totals.
+    #[test]
+    fn test_format_summary() {
+        let stats = create_test_directory_stats();
+        let output = format_summary(&stats);
+
+        // Check structure
+        assert!(output.contains("Language Summary:"));
+        assert!(output.contains("Total:"));
+
+        // Check language stats
+        assert!(output.contains("Rust:"));
+        assert!(output.contains("8 functions")); // 3 + 5
+        assert!(output.contains("3 structs/classes")); // 2 + 1
+        assert!(output.contains("in 2 files"));
+
+        assert!(output.contains("Python:"));
+        assert!(output.contains("2 functions"));
+        assert!(output.contains("1 structs/classes"));
+        assert!(output.contains("in 1 files"));
+
+        // Check totals
+        assert!(output.contains("Total: 10 functions, 4 structs/classes in 3 files"));
+    }
+
+    /// Tests detailed format output including individual files and summary.
+    ///
+    /// Ensures that format_detail displays each file's statistics separately
+    /// and includes the summary section at the end.
+    #[test]
+    fn test_format_detail() {
+        let stats = create_test_directory_stats();
+        let output = format_detail(&stats);
+
+        // Check individual file details
+        assert!(output.contains("src/lib.rs (Rust):"));
+        assert!(output.contains("src/main.rs (Rust):"));
+        assert!(output.contains("test.py (Python):"));
+
+        // Should also include summary
+        assert!(output.contains("Language Summary:"));
+        assert!(output.contains("Total:"));
+    }
+
+    /// Tests JSON format serialization and structure.
+    ///
+    /// Verifies that format_json produces valid JSON with the expected
+    /// structure and correct data values.
+    #[test]
+    fn test_format_json() {
+        let stats = create_test_directory_stats();
+        let output = format_json(&stats, &Thresholds::default());
+
+        // Parse JSON to verify it's valid
+        let parsed: serde_json::Value = serde_json::from_str(&output).unwrap();
+
+        // Check structure
+        assert_eq!(parsed["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(parsed["analyzer_version"], env!("CARGO_PKG_VERSION"));
+        assert!(parsed.get("files").is_some());
+        assert!(parsed.get("total_by_language").is_some());
+        assert!(parsed.get("total_stats").is_some());
+        assert_eq!(parsed["total_files"], 3);
+
+        // Check file count and deterministic ordering by path
+        let files = parsed["files"].as_array().unwrap();
+        assert_eq!(files.len(), 3);
+        assert_eq!(files[0]["path"], "src/lib.rs");
+        assert_eq!(files[1]["path"], "src/main.rs");
+        assert_eq!(files[2]["path"], "test.py");
+
+        // Check total stats
+        assert_eq!(parsed["total_stats"]["function_count"], 10);
+        assert_eq!(parsed["total_stats"]["class_struct_count"], 4);
+    }
+
+    /// Tests the main format_output function with all supported formats.
+    ///
+    /// Validates that the format dispatcher correctly routes to the appropriate
+    /// formatting function based on the OutputFormat parameter.
+    #[test]
+    fn test_format_output_with_different_formats() {
+        let stats = create_test_directory_stats();
+
+        let summary = format_output(&stats, OutputFormat::Summary, false, &Thresholds::default());
+        assert!(summary.contains("Language Summary:"));
+        assert!(!summary.contains("src/main.rs"));
+
+        let detail = format_output(&stats, OutputFormat::Detail, false, &Thresholds::default());
+        assert!(detail.contains("src/main.rs"));
+        assert!(detail.contains("Language Summary:"));
+
+        let json = format_output(&stats, OutputFormat::Json, false, &Thresholds::default());
+        assert!(json.starts_with('{'));
+        assert!(json.contains("\"files\""));
+    }
+
+    /// Tests formatting behavior with empty statistics.
+    ///
+    /// Ensures that all formatters handle the edge case of no analyzed files
+    /// gracefully, displaying appropriate zero values.
+    #[test]
+    fn test_format_empty_stats() {
+        let stats = DirectoryStats::new();
+
+        let summary = format_summary(&stats);
+        assert!(summary.contains("Total: 0 functions, 0 structs/classes in 0 files"));
+
+        let detail = format_detail(&stats);
+        assert!(detail.contains("Total: 0 functions, 0 structs/classes in 0 files"));
+
+        let json = format_json(&stats, &Thresholds::default());
+        let parsed: serde_json::Value = serde_json::from_str(&json).unwrap();
+        assert_eq!(parsed["files"].as_array().unwrap().len(), 0);
+    }
+
+    /// Tests the complexity section for single files and directories.
+    ///
+    /// Verifies max/mean reporting and that only functions above the
+    /// threshold are listed, most complex first.
+    #[test]
+    fn test_format_diff() {
+        use crate::diff::{FileDiff, FileStatus, FunctionChange};
+
+        let metrics = |lines, complexity| FunctionMetrics {
+            start_line: 1,
+            end_line: lines,
+            lines,
+            complexity,
+        };
+        let report = DiffReport {
+            base: "main".to_string(),
+            files: vec![
+                FileDiff {
+                    path: PathBuf::from("src/lib.rs"),
+                    language: SupportedLanguage::Rust,
+                    status: FileStatus::Modified,
+                    functions: vec![
+                        FunctionChange {
+                            name: "parse".to_string(),
+                            status: ChangeStatus::Modified,
+                            before: Some(metrics(20, 4)),
+                            after: Some(metrics(25, 4)),
+                        },
+                        FunctionChange {
+                            name: "legacy".to_string(),
+                            status: ChangeStatus::Removed,
+                            before: Some(metrics(10, 2)),
+                            after: None,
+                        },
+                    ],
+                },
+                FileDiff {
+                    path: PathBuf::from("src/new.rs"),
+                    language: SupportedLanguage::Rust,
+                    status: FileStatus::Added,
+                    functions: vec![FunctionChange {
+                        name: "fresh".to_string(),
+                        status: ChangeStatus::Added,
+                        before: None,
+                        after: Some(metrics(2, 1)),
+                    }],
+                },
+            ],
+        };
+
+        let text = format_diff(&report, OutputFormat::Summary);
+        assert_eq!(
+            text,
+            "Changes since main: 2 files, 3 functions touched\n\
+             \nsrc/lib.rs (modified):\
+             \n  ~ parse   lines 20 -> 25 (+5), complexity 4\
+             \n  - legacy  lines 10, complexity 2\
+             \nsrc/new.rs (added):\
+             \n  + fresh   lines 2, complexity 1"
+        );
+
+        let json: serde_json::Value =
+            serde_json::from_str(&format_diff(&report, OutputFormat::Json)).unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["base"], "main");
+        assert_eq!(json["files"][0]["status"], "modified");
+        assert_eq!(json["files"][0]["functions"][1]["status"], "removed");
+        assert!(json["files"][1]["functions"][0]["before"].is_null());
+
+        let empty = DiffReport {
+            base: "HEAD".to_string(),
+            files: Vec::new(),
+        };
+        assert_eq!(
+            format_diff(&empty, OutputFormat::Summary),
+            "No changes since HEAD"
+        );
+    }
+
+    #[test]
+    fn test_format_functions_table_and_sorting() {
+        use crate::parser::FunctionStats;
+
+        let function =
+            |qualified_name: &str, start_line, end_line, parameters, complexity| FunctionStats {
+                name: qualified_name.rsplit('.').next().unwrap().to_string(),
+                qualified_name: qualified_name.to_string(),
+                start_line,
+                end_line,
+                parameters,
+                complexity,
+                // Each decision point nests inside the previous one
+                max_nesting: complexity - 1,
+                cognitive: complexity * (complexity - 1) / 2,
+                maintainability: 100.0 - 10.0 * complexity as f64,
+                ..Default::default()
+            };
+
+        let mut stats = DirectoryStats::new();
+        stats.add_file(FileStats {
+            path: PathBuf::from("main.go"),
+            language: SupportedLanguage::Go,
+            stats: CodeStats {
+                function_count: 3,
+                functions: vec![
+                    function("Person.Greet", 10, 12, 0, 1),
+                    function("main", 14, 17, 0, 1),
+                    function("add", 19, 21, 2, 3),
+                ],
+                ..Default::default()
+            },
+        });
+
+        let table = format_functions(&stats, OutputFormat::Summary, FunctionSort::Location);
+        let lines: Vec<&str> = table.lines().collect();
+        assert_eq!(
+            lines[0],
+            "Function      Location       Lines  Params  Complexity  Nesting  Cognitive   Volume      MI"
+        );
+        assert_eq!(
+            lines[1],
+            "Person.Greet  main.go:10-12      3       0           1        0          0        0    90.0"
+        );
+        assert!(table.ends_with("3 functions"));
+
+        let by_name = format_functions(&stats, OutputFormat::Summary, FunctionSort::Name);
+        let rows: Vec<&str> = by_name.lines().skip(1).take(3).collect();
+        assert!(rows[0].starts_with("Person.Greet"));
+        assert!(rows[1].starts_with("add"));
+        assert!(rows[2].starts_with("main"));
+
+        // Numeric columns put the largest first; ties keep source order
+        let by_lines = format_functions(&stats, OutputFormat::Summary, FunctionSort::Lines);
+        assert!(by_lines.lines().nth(1).unwrap().starts_with("main"));
+        assert!(by_lines.lines().nth(2).unwrap().starts_with("Person.Greet"));
+        let by_nesting = format_functions(&stats, OutputFormat::Summary, FunctionSort::Nesting);
+        assert!(
+            by_nesting
+                .lines()
+                .nth(1)
+                .unwrap()
+                .contains("3        2          3  ")
+        );
+        let by_cognitive = format_functions(&stats, OutputFormat::Summary, FunctionSort::Cognitive);
+        assert!(by_cognitive.lines().nth(1).unwrap().starts_with("add"));
+        // The maintainability index puts the lowest first
+        let by_index =
+            format_functions(&stats, OutputFormat::Summary, FunctionSort::Maintainability);
+        assert!(by_index.lines().nth(1).unwrap().ends_with("70.0"));
+        assert!(by_index.lines().nth(2).unwrap().starts_with("Person.Greet"));
+
+        let json = format_functions(&stats, OutputFormat::Json, FunctionSort::Complexity);
+        let parsed: serde_json::Value = serde_json::from_str(&json).unwrap();
+        assert_eq!(parsed["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(parsed["functions"][0]["qualified_name"], "add");
+        assert_eq!(parsed["functions"][0]["lines"], 3);
+        assert_eq!(parsed["functions"][0]["nesting"], 2);
+        assert_eq!(parsed["functions"][0]["maintainability"], 70.0);
+        assert_eq!(parsed["functions"][0]["cognitive"], 3);
+        assert_eq!(parsed["functions"][0]["path"], "main.go");
+
+        assert_eq!(
+            format_functions(
+                &DirectoryStats::new(),
+                OutputFormat::Summary,
+                FunctionSort::Location
+            ),
+            "No functions found"
+        );
+    }
+
+    #[test]
+    fn test_format_rollup() {
+        use crate::parser::FunctionStats;
+        use crate::rollup::rollup;
+
+        let mut stats = DirectoryStats::new();
+        for (path, code, complexity, test_file) in [
+            ("proj/main.rs", 10, 1, false),
+            ("proj/src/lib.rs", 30, 3, false),
+            ("proj/src/parser/mod.rs", 1200, 7, false),
+            ("proj/tests/cli.rs", 62, 2, true),
+        ] {
+            stats.add_file(FileStats {
+                path: PathBuf::from(path),
+                language: SupportedLanguage::Rust,
+                stats: CodeStats {
+                    function_count: 1,
+                    functions: vec![FunctionStats {
+                        complexity,
+                        ..Default::default()
+                    }],
+                    lines: LineStats {
+                        code,
+                        ..Default::default()
+                    },
+                    test_file,
+                    ..Default::default()
+                },
+            });
+        }
+        let mut tree = rollup(&stats, std::path::Path::new("proj"));
+
+        let text = format_rollup(&tree, OutputFormat::Summary);
+        assert_eq!(
+            text.lines().collect::<Vec<_>>(),
+            vec![
+                "Directory   Files  Code  Functions  Complexity  Max  Tests  Ratio",
+                "proj            4  1302          4          13    7     62   0.05",
+                "  src           2  1230          2          10    7      0   0.00",
+                "    parser      1  1200          1           7    7      0   0.00",
+                "  tests         1    62          1           2    2     62      -",
+            ]
+        );
+
+        tree.truncate(1);
+        let json: serde_json::Value =
+            serde_json::from_str(&format_rollup(&tree, OutputFormat::Json)).unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["root"]["path"], "proj");
+        assert_eq!(json["root"]["children"][0]["path"], "proj/src");
+        assert_eq!(json["root"]["children"][0]["code_lines"], 1230);
+        assert_eq!(
+            json["root"]["children"][0]["children"],
+            serde_json::json!([])
+        );
+    }
+
+    #[test]
+    fn test_format_type_rollup() {
+        use crate::rollup::{TypeLocation, TypeRollup};
+
+        let location = |path: &str, start_line| TypeLocation {
+            path: PathBuf::from(path),
+            start_line,
+        };
+        let types = vec![
+            TypeRollup {
+                name: "Shop.Models.Cart".to_string(),
+                kind: "class".to_string(),
+                language: SupportedLanguage::CSharp,
+                locations: vec![location("src/Cart.cs", 3), location("src/Cart.g.cs", 1)],
+                lines: 42,
+                fields: 3,
+                methods: 5,
+                bases: 1,
+                complexity: 12,
+                max_complexity: 4,
+                god_object: true,
+            },
+            TypeRollup {
+                name: "Shop.Models.Item".to_string(),
+                kind: "record".to_string(),
+                language: SupportedLanguage::CSharp,
+                locations: vec![location("src/Item.cs", 5)],
+                lines: 1,
+                fields: 2,
+                methods: 0,
+                bases: 0,
+                complexity: 0,
+                max_complexity: 0,
+                god_object: false,
+            },
+        ];
+
+        let text = format_type_rollup(&types, OutputFormat::Summary);
+        assert_eq!(
+            text.lines().collect::<Vec<_>>(),
+            vec![
+                "Type              Kind    Lines  Fields  Methods  Bases  Complexity  Max  Location",
+                "Shop.Models.Cart  class      42       3        5      1          12    4  src/Cart.cs:3 (+1 more)",
+                "Shop.Models.Item  record      1       2        0      0           0    0  src/Item.cs:5",
+                "",
+                "God objects: Shop.Models.Cart",
+            ]
+        );
+        assert_eq!(
+            format_type_rollup(&[], OutputFormat::Summary),
+            "No types found"
+        );
+
+        let json: serde_json::Value =
+            serde_json::from_str(&format_type_rollup(&types, OutputFormat::Json)).unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["types"][0]["name"], "Shop.Models.Cart");
+        assert_eq!(json["types"][0]["locations"][1]["path"], "src/Cart.g.cs");
+        assert_eq!(json["types"][1]["language"], "CSharp");
+        assert_eq!(json["types"][0]["fields"], 3);
+        assert_eq!(json["types"][0]["god_object"], true);
+    }
+
+    #[test]
+    fn test_format_top() {
+        use crate::comments::LineStats;
+        use crate::parser::FunctionStats;
+
+        let function = |name: &str, start_line: usize, lines: usize, complexity| FunctionStats {
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            start_line,
+            end_line: start_line + lines - 1,
+            complexity,
+            ..Default::default()
+        };
+        let file = |path: &str, code, functions: Vec<FunctionStats>| FileStats {
+            path: PathBuf::from(path),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                function_count: functions.len(),
+                functions,
+                lines: LineStats {
+                    code,
+                    ..Default::default()
+                },
+                ..Default::default()
+            },
+        };
+
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file("src/small.rs", 12, vec![function("tiny", 1, 3, 1)]));
+        stats.add_file(file(
+            "src/cli.rs",
+            420,
+            vec![function("run", 10, 80, 12), function("parse", 100, 20, 4)],
+        ));
+        stats.add_file(file("src/lib.rs", 12, Vec::new()));
+
+        let by_loc = format_top(&stats, TopMetric::Loc, 2, OutputFormat::Summary);
+        let lines: Vec<&str> = by_loc.lines().collect();
+        assert_eq!(lines[0], "Rank  File        Code");
+        assert_eq!(lines[1], "   1  src/cli.rs   420");
+        // Ties are broken by path
+        assert_eq!(lines[2], "   2  src/lib.rs    12");
+        assert_eq!(lines[3], "");
+        assert_eq!(lines[4], "Top 2 of 3 files by lines of code");
+
+        let by_complexity = format_top(&stats, TopMetric::Complexity, 0, OutputFormat::Summary);
+        let lines: Vec<&str> = by_complexity.lines().collect();
+        assert_eq!(lines[0], "Rank  Function  Location        Complexity");
+        assert_eq!(lines[1], "   1  run       src/cli.rs:10           12");
+        assert_eq!(lines[3], "   3  tiny      src/small.rs:1           1");
+        assert!(by_complexity.ends_with("Top 3 of 3 functions by cyclomatic complexity"));
+
+        let json: serde_json::Value =
+            serde_json::from_str(&format_top(&stats, TopMetric::Lines, 1, OutputFormat::Json))
+                .unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["by"], "lines");
+        assert_eq!(json["total"], 3);
+        assert_eq!(json["entries"].as_array().unwrap().len(), 1);
+        assert_eq!(json["entries"][0]["rank"], 1);
+        assert_eq!(json["entries"][0]["function"], "run");
+        assert_eq!(json["entries"][0]["start_line"], 10);
+        assert_eq!(json["entries"][0]["value"], 80);
+
+        let files: serde_json::Value = serde_json::from_str(&format_top(
+            &stats,
+            TopMetric::Functions,
+            1,
+            OutputFormat::Json,
+        ))
+        .unwrap();
+        assert_eq!(files["entries"][0]["path"], "src/cli.rs");
+        assert_eq!(files["entries"][0]["value"], 2);
+        assert!(files["entries"][0].get("function").is_none());
+
+        assert_eq!(
+            format_top(
+                &DirectoryStats::new(),
+                TopMetric::Lines,
+                20,
+                OutputFormat::Summary
+            ),
+            "No functions found"
+        );
+    }
+
+    #[test]
+    fn test_format_nesting_depth() {
+        use crate::parser::FunctionStats;
+
+        let function = |name: &str, start_line: usize, max_nesting: usize| FunctionStats {
+            name: name.to_string(),
+            start_line,
+            end_line: start_line + 3,
+            complexity: 1,
+            max_nesting,
+            ..Default::default()
+        };
+
+        let file_stats = FileStats {
+            path: PathBuf::from("src/walk.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                function_count: 3,
+                functions: vec![
+                    function("flat", 1, 0),
+                    function("visit", 10, 3),
+                    function("descend", 20, 3),
+                ],
+                ..Default::default()
+            },
+        };
+
+        // Ties go to the first function in the file
+        let single = format_single_file(&file_stats, &Thresholds::default());
+        assert!(single.contains("\nNesting depth: max 3 (line 10 visit)"));
+
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file_stats);
+        let output = format_output(&stats, OutputFormat::Detail, false, &Thresholds::default());
+        assert!(output.contains("  Nesting depth: max 3\n"));
+        assert!(output.contains("\nNesting depth: max 3 (src/walk.rs:10 visit)"));
+
+        let json: serde_json::Value =
+            serde_json::from_str(&format_json(&stats, &Thresholds::default())).unwrap();
+        assert_eq!(json["complexity"]["max_nesting"], 3);
+        assert_eq!(json["files"][0]["stats"]["functions"][1]["max_nesting"], 3);
+    }
+
+    #[test]
+    fn test_format_cognitive_complexity() {
+        use crate::parser::FunctionStats;
+
+        let function = |name: &str, start_line: usize, cognitive: usize| FunctionStats {
+            name: name.to_string(),
+            start_line,
+            end_line: start_line + 5,
+            complexity: 2,
+            cognitive,
+            ..Default::default()
+        };
+
+        let file_stats = FileStats {
+            path: PathBuf::from("src/route.go"),
+            language: SupportedLanguage::Go,
+            stats: CodeStats {
+                function_count: 2,
+                functions: vec![function("route", 1, 4), function("dispatch", 10, 9)],
+                ..Default::default()
+            },
+        };
+
+        let single = format_single_file(&file_stats, &Thresholds::default());
+        assert!(single.contains("\nCognitive complexity: max 9 (line 10 dispatch)"));
+
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file_stats);
+        let output = format_output(&stats, OutputFormat::Detail, false, &Thresholds::default());
+        assert!(output.contains("  Cognitive complexity: max 9\n"));
+        assert!(output.contains("\nCognitive complexity: max 9 (src/route.go:10 dispatch)"));
+
+        let json: serde_json::Value =
+            serde_json::from_str(&format_json(&stats, &Thresholds::default())).unwrap();
+        assert_eq!(json["complexity"]["max_cognitive"], 9);
+        assert_eq!(json["files"][0]["stats"]["functions"][0]["cognitive"], 4);
+    }
+
+    #[test]
+    fn test_format_complexity_offenders() {
+        use crate::parser::FunctionStats;
+
+        let function = |name: &str, start_line: usize, complexity: usize| FunctionStats {
+            name: name.to_string(),
+            start_line,
+            end_line: start_line + 3,
+            complexity,
+            ..Default::default()
+        };
+
+        let file_stats = FileStats {
+            path: PathBuf::from("src/router.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                function_count: 3,
+                functions: vec![
+                    function("route", 3, 6),
+                    function("dispatch", 10, 12),
+                    function("new", 20, 1),
+                ],
+                ..Default::default()
+            },
+        };
+        let thresholds = Thresholds {
+            complexity: 5,
+            ..Default::default()
+        };
+
+        let single = format_single_file(&file_stats, &thresholds);
+        assert!(single.contains("Complexity: max 12, mean 6.33"));
+        let dispatch = single.find("line 10 dispatch (complexity 12)").unwrap();
+        let route = single.find("line 3 route (complexity 6)").unwrap();
+        assert!(dispatch < route);
+        assert!(!single.contains("new (complexity"));
+
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file_stats);
+
+        let summary = format_output(&stats, OutputFormat::Summary, false, &thresholds);
+        assert!(summary.contains("Complexity: max 12, mean 6.33 across 3 functions"));
+        assert!(summary.contains("Functions above complexity threshold 5:"));
+        assert!(summary.contains("src/router.rs:10 dispatch (complexity 12)"));
+
+        let relaxed = format_output(
+            &stats,
+            OutputFormat::Summary,
+            false,
+            &Thresholds {
+                complexity: 20,
+                ..Default::default()
+            },
+        );
+        assert!(relaxed.contains("No functions above complexity threshold 20"));
+
+        let json = format_json(&stats, &thresholds);
+        let parsed: serde_json::Value = serde_json::from_str(&json).unwrap();
+        assert_eq!(parsed["complexity"]["max"], 12);
+        assert_eq!(parsed["complexity"]["threshold"], 5);
+        let offenders = parsed["complexity"]["offenders"].as_array().unwrap();
+        assert_eq!(offenders.len(), 2);
+        assert_eq!(offenders[0]["name"], "dispatch");
+        assert_eq!(offenders[0]["path"], "src/router.rs");
+        assert_eq!(offenders[0]["complexity"], 12);
+    }
+
+    /// Tests that languages are sorted alphabetically in summary output.
+    ///
+    /// Verifies the alphabetical ordering requirement by adding languages
+    /// in non-alphabetical order and checking their position in the output.
+    #[test]
+    fn test_format_language_sorting() {
+        let mut stats = DirectoryStats::new();
+
+        // Add files in non-alphabetical order
+        stats.add_file(FileStats {
+            path: PathBuf::from("test.py"),
+            language: SupportedLanguage::Python,
+            stats: CodeStats {
+                function_count: 1,
+                class_struct_count: 0,
+                ..Default::default()
+            },
+        });
+
+        stats.add_file(FileStats {
+            path: PathBuf::from("test.go"),
+            language: SupportedLanguage::Go,
+            stats: CodeStats {
+                function_count: 1,
+                class_struct_count: 0,
+                ..Default::default()
+            },
+        });
+
+        stats.add_file(FileStats {
+            path: PathBuf::from("test.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                function_count: 1,
+                class_struct_count: 0,
+                ..Default::default()
+            },
+        });
+
+        let output = format_summary(&stats);
+
+        // Languages should be sorted alphabetically
+        let go_pos = output.find("Go:").unwrap();
+        let python_pos = output.find("Python:").unwrap();
+        let rust_pos = output.find("Rust:").unwrap();
+
+        assert!(go_pos < python_pos);
+        assert!(python_pos < rust_pos);
+    }
+
+    #[test]
+    fn test_format_go_metrics() {
+        use crate::golang::MethodSet;
+
+        let go = GoStats {
+            goroutines: 1,
+            channel_sends: 2,
+            channel_receives: 3,
+            selects: 1,
+            defers: 4,
+            functions: 10,
+            error_returning: 6,
+            method_sets: BTreeMap::from([
+                (
+                    "Cart".to_string(),
+                    MethodSet {
+                        value: 1,
+                        pointer: 2,
+                    },
+                ),
+                (
+                    "Stack".to_string(),
+                    MethodSet {
+                        value: 1,
+                        pointer: 0,
+                    },
+                ),
+            ]),
+            ..Default::default()
+        };
+        let file = FileStats {
+            path: PathBuf::from("cart.go"),
+            language: SupportedLanguage::Go,
+            stats: CodeStats {
+                go: Some(go),
+                ..Default::default()
+            },
+        };
+        let output = format_single_file(&file, &Thresholds::default());
+        assert!(output.contains(
+            "\nGo: 1 goroutine, 5 channel operations (2 sends, 3 receives), 1 select, \
+             4 defers, 6 of 10 functions return an error (60%)"
+        ));
+        assert!(output.contains("\nMethod sets: Cart (1 value, 2 pointer), Stack (1 value)"));
+
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file.clone());
+        stats.add_file(file);
+        let summary = format_summary(&stats);
+        assert!(summary.contains("\nGo: 2 goroutines, 10 channel operations"));
+        assert!(summary.contains("12 of 20 functions return an error (60%)"));
+        assert!(!summary.contains("Method sets"));
+    }
+
+    #[test]
+    fn test_format_web_structure() {
+        let file = |path: &str, language, web| FileStats {
+            path: PathBuf::from(path),
+            language,
+            stats: CodeStats {
+                web: Some(web),
+                ..Default::default()
+            },
+        };
+        let page = file(
+            "index.html",
+            SupportedLanguage::Html,
+            WebStats {
+                elements: 42,
+                max_depth: 7,
+                ..Default::default()
+            },
+        );
+        let styles = file(
+            "site.css",
+            SupportedLanguage::Css,
+            WebStats {
+                rules: 12,
+                selectors: 17,
+                max_depth: 2,
+                ..Default::default()
+            },
+        );
+        let output = format_single_file(&page, &Thresholds::default());
+        assert!(output.contains("\nWeb: 42 elements, max depth 7"));
+        let output = format_single_file(&styles, &Thresholds::default());
+        assert!(output.contains("\nWeb: 12 rules, 17 selectors, max depth 2"));
+
+        let mut stats = DirectoryStats::new();
+        stats.add_file(page);
+        stats.add_file(styles);
+        let summary = format_summary(&stats);
+        assert!(summary.contains("\nWeb: 42 elements, 12 rules, 17 selectors, max depth 7"));
+    }
+
+    #[test]
+    fn test_format_component_sections() {
+        let lines = |code| LineStats {
+            code,
+            ..Default::default()
+        };
+        let component = FileStats {
+            path: PathBuf::from("Cart.vue"),
+            language: SupportedLanguage::Vue,
+            stats: CodeStats {
+                component: Some(ComponentStats {
+                    template: lines(24),
+                    script: lines(40),
+                    style: LineStats::default(),
+                }),
+                ..Default::default()
+            },
+        };
+        let output = format_single_file(&component, &Thresholds::default());
+        assert!(output.contains("\nSections: template 24, script 40 code lines"));
+    }
+
+    #[test]
+    fn test_format_notebook_cells() {
+        let notebook = FileStats {
+            path: PathBuf::from("analysis.ipynb"),
+            language: SupportedLanguage::Jupyter,
+            stats: CodeStats {
+                notebook: Some(NotebookStats {
+                    code_cells: 12,
+                    markdown_cells: 5,
+                    raw_cells: 0,
+                    code_lines: 80,
+                    markdown_lines: 20,
+                }),
+                ..Default::default()
+            },
+        };
+        let output = format_single_file(&notebook, &Thresholds::default());
+        assert!(output.contains("\nNotebook: 12 code cells, 5 markdown cells, 20.0% markdown"));
+
+        let mut raw = notebook.clone();
+        raw.stats.notebook = Some(NotebookStats {
+            code_cells: 1,
+            raw_cells: 1,
+            code_lines: 20,
+            ..Default::default()
+        });
+        let mut stats = DirectoryStats::new();
+        stats.add_file(notebook);
+        stats.add_file(raw);
+        let summary = format_summary(&stats);
+        assert!(
+            summary.contains(
+                "\nNotebook: 13 code cells, 5 markdown cells, 1 raw cell, 16.7% markdown"
+            )
+        );
+    }
+
+    #[test]
+    fn test_format_template_tags() {
+        let template = FileStats {
+            path: PathBuf::from("templates/order.html.j2"),
+            language: SupportedLanguage::Jinja,
+            stats: CodeStats {
+                template: Some(TemplateStats {
+                    interpolations: 14,
+                    conditionals: 5,
+                    loops: 1,
+                    max_depth: 2,
+                }),
+                ..Default::default()
+            },
+        };
+        let output = format_single_file(&template, &Thresholds::default());
+        assert!(
+            output.contains("\nTemplate: 14 interpolations, 5 conditionals, 1 loop, max depth 2")
+        );
+    }
+
+    #[test]
+    fn test_format_graphql_counts() {
+        let file = |graphql| FileStats {
+            path: PathBuf::from("schema/cart.graphql"),
+            language: SupportedLanguage::Graphql,
+            stats: CodeStats {
+                graphql: Some(graphql),
+                ..Default::default()
+            },
+        };
+        let schema = file(GraphqlStats {
+            types: 4,
+            fields: 11,
+            ..Default::default()
+        });
+        let output = format_single_file(&schema, &Thresholds::default());
+        assert!(output.contains("\nGraphQL: 4 types, 11 fields"));
+
+        let operations = file(GraphqlStats {
+            queries: 1,
+            mutations: 2,
+            fragments: 1,
+            ..Default::default()
+        });
+        let output = format_single_file(&operations, &Thresholds::default());
+        assert!(output.contains("\nGraphQL: 0 types, 0 fields, 1 query, 2 mutations, 1 fragment"));
+    }
+
+    #[test]
+    fn test_format_generics() {
+        let file = |path: &str, language, generics| FileStats {
+            path: PathBuf::from(path),
+            language,
+            stats: CodeStats {
+                generics: Some(generics),
+                ..Default::default()
+            },
+        };
+        let go = file(
+            "pair.go",
+            SupportedLanguage::Go,
+            GenericsStats {
+                declarations: 2,
+                type_parameters: 3,
+                max_type_parameters: 2,
+                instantiations: 1,
+            },
+        );
+        let output = format_single_file(&go, &Thresholds::default());
+        assert!(
+            output.contains("\nGenerics: 2 declarations (max 2 type parameters), 1 instantiation")
+        );
+
+        let mut stats = DirectoryStats::new();
+        stats.add_file(go);
+        stats.add_file(file(
+            "Cache.java",
+            SupportedLanguage::Java,
+            GenericsStats {
+                declarations: 1,
+                type_parameters: 1,
+                max_type_parameters: 1,
+                instantiations: 4,
+            },
+        ));
+        // Files without generic code are left out
+        stats.add_file(file(
+            "main.rs",
+            SupportedLanguage::Rust,
+            GenericsStats::default(),
+        ));
+        let summary = format_summary(&stats);
+        assert!(summary.contains(
+            "\nGenerics: Go 2 declarations (max 2 type parameters), 1 instantiation; \
+             Java 1 declaration (max 1 type parameter), 4 instantiations"
+        ));
+        assert!(!summary.contains("; Rust"));
+    }
+
+    #[test]
+    fn test_format_closures() {
+        let file = |path: &str, language, closures| FileStats {
+            path: PathBuf::from(path),
+            language,
+            stats: CodeStats {
+                closures: Some(closures),
+                ..Default::default()
+            },
+        };
+        let routes = file(
+            "routes.js",
+            SupportedLanguage::JavaScript,
+            ClosureStats {
+                count: 5,
+                nested: 2,
+                top_level: 3,
+                max_depth: 3,
+            },
+        );
+        let output = format_single_file(&routes, &Thresholds::default());
+        assert!(
+            output.contains(
+                "\nClosures: 5 anonymous functions (2 nested, 3 at top level), max depth 3"
+            )
+        );
+
+        let mut stats = DirectoryStats::new();
+        stats.add_file(routes);
+        stats.add_file(file(
+            "serve.go",
+            SupportedLanguage::Go,
+            ClosureStats {
+                count: 1,
+                nested: 0,
+                top_level: 0,
+                max_depth: 1,
+            },
+        ));
+        // Files without closures are left out
+        stats.add_file(file(
+            "main.rs",
+            SupportedLanguage::Rust,
+            ClosureStats::default(),
+        ));
+        let summary = format_summary(&stats);
+        assert!(summary.contains(
+            "\nClosures: Go 1 anonymous function (0 nested, 0 at top level), max depth 1; \
+             JavaScript 5 anonymous functions (2 nested, 3 at top level), max depth 3"
+        ));
+        assert!(!summary.contains("; Rust"));
+    }
+
+    #[test]
+    fn test_format_error_handling() {
+        use crate::handling::ErrorHandling;
+        use crate::parser::FunctionStats;
+
+        let function = |name: &str, start_line, checks, fallible_calls| FunctionStats {
+            name: name.to_string(),
+            start_line,
+            end_line: start_line + 5,
+            error_handling: ErrorHandling {
+                checks,
+                fallible_calls,
+                panics: 0,
+                assertions: 0,
+            },
+            ..Default::default()
+        };
+        let file = FileStats {
+            path: PathBuf::from("store.go"),
+            language: SupportedLanguage::Go,
+            stats: CodeStats {
+                function_count: 3,
+                functions: vec![
+                    function("Load", 3, 2, 2),
+                    function("Save", 12, 0, 1),
+                    function("Sync", 20, 0, 3),
+                ],
+                error_handling: Some(ErrorHandlingStats {
+                    counts: ErrorHandling {
+                        checks: 2,
+                        fallible_calls: 6,
+                        panics: 1,
+                        assertions: 0,
+                    },
+                    functions: 3,
+                    unhandled: 2,
+                }),
+                ..Default::default()
+            },
+        };
+        let output = format_single_file(&file, &Thresholds::default());
+        assert!(output.contains(
+            "\nError handling: 2 checks (0.67 per function), 6 fallible calls, 1 panic, \
+             0 assertions, 2 unhandled functions"
+        ));
+
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file);
+        let summary = format_summary(&stats);
+        assert!(summary.contains(
+            "\nError handling: Go 2 checks (0.67 per function), 6 fallible calls, 1 panic, \
+             0 assertions, 2 unhandled functions\n\
+             Unhandled fallible calls:\n  \
+             store.go:20 Sync (3 fallible calls, no checks)\n  \
+             store.go:12 Save (1 fallible call, no checks)"
+        ));
+    }
+
+    #[test]
+    fn test_format_switches() {
+        let switch = |kind: &str, start_line, branches, has_default| SwitchStats {
+            kind: kind.to_string(),
+            start_line,
+            end_line: start_line + branches,
+            branches,
+            has_default,
+        };
+        let lexer = FileStats {
+            path: PathBuf::from("src/lexer.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                switches: vec![switch("match", 12, 9, false), switch("match", 40, 2, true)],
+                ..Default::default()
+            },
+        };
+        let output = format_single_file(&lexer, &Thresholds::default());
+        assert!(output.contains(
+            "\nSwitches: 2 switch/match statements, 1 without a default arm, max 9 branches"
+        ));
+
+        let mut stats = DirectoryStats::new();
+        stats.add_file(lexer);
+        stats.add_file(FileStats {
+            path: PathBuf::from("cmd/main.go"),
+            language: SupportedLanguage::Go,
+            stats: CodeStats {
+                switches: vec![switch("select", 7, 14, true)],
+                ..Default::default()
+            },
+        });
+        let summary = format_summary(&stats);
+        assert!(summary.contains(
+            "\n\nSwitches: 3 switch/match statements, 1 without a default arm, max 14 branches\n\
+             Largest switches:\n  \
+             cmd/main.go:7 select (14 branches)\n  \
+             src/lexer.rs:12 match (9 branches, no default)\n  \
+             src/lexer.rs:40 match (2 branches)"
+        ));
+
+        // Without any switch statement the section is left out
+        assert!(!format_summary(&DirectoryStats::new()).contains("Switches:"));
+    }
+
+    #[test]
+    fn test_format_api_surface() {
+        use crate::golang::ApiSymbol;
+
+        let symbol = |kind, name: &str, line, exported| ApiSymbol {
+            kind,
+            name: name.to_string(),
+            line,
+            exported,
+        };
+        let file = |path: &str, package: &str, api: Vec<ApiSymbol>| {
+            let exported = api.iter().filter(|symbol| symbol.exported).count();
+            FileStats {
+                path: PathBuf::from(path),
+                language: SupportedLanguage::Go,
+                stats: CodeStats {
+                    go: Some(GoStats {
+                        package: package.to_string(),
+                        exported,
+                        unexported: api.len() - exported,
+                        api,
+                        ..Default::default()
+                    }),
+                    ..Default::default()
+                },
+            }
+        };
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file(
+            "shop/cart.go",
+            "shop",
+            vec![
+                symbol(ApiKind::Method, "Cart.Add", 9, true),
+                symbol(ApiKind::Type, "Cart", 3, true),
+                symbol(ApiKind::Func, "helper", 12, false),
+            ],
+        ));
+        stats.add_file(file(
+            "shop/order.go",
+            "shop",
+            vec![symbol(ApiKind::Func, "NewOrder", 5, true)],
+        ));
+        stats.add_file(file(
+            "main.go",
+            "main",
+            vec![symbol(ApiKind::Func, "main", 3, false)],
+        ));
 
-        stats.add_file(FileStats {
-            path: PathBuf::from("src/main.rs"),
-            language: SupportedLanguage::Rust,
-            stats: CodeStats {
-                function_count: 3,
-                class_struct_count: 2,
+        assert_eq!(
+            format_api_surface(&stats, OutputFormat::Summary),
+            "main (.)\n  0 exported, 1 unexported (0% exported)\n\n\
+             shop (shop)\n  \
+             type Cart (shop/cart.go:3)\n  \
+             func NewOrder (shop/order.go:5)\n  \
+             method Cart.Add (shop/cart.go:9)\n  \
+             3 exported, 1 unexported (75% exported)\n\n\
+             2 packages: 3 exported, 2 unexported (60% exported)"
+        );
+
+        let json: serde_json::Value =
+            serde_json::from_str(&format_api_surface(&stats, OutputFormat::Json)).unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["packages"][1]["name"], "shop");
+        assert_eq!(json["packages"][1]["symbols"][2]["kind"], "method");
+        assert_eq!(json["exported"], 3);
+        assert_eq!(
+            format_api_surface(&DirectoryStats::new(), OutputFormat::Summary),
+            "No Go packages found"
+        );
+    }
+
+    #[test]
+    fn test_format_implementations() {
+        use crate::interfaces::{Implementor, InterfaceReport};
+
+        let implementor = |name: &str, path: &str, line, inferred| Implementor {
+            name: name.to_string(),
+            path: PathBuf::from(path),
+            line,
+            inferred,
+        };
+        let interfaces = vec![
+            InterfaceReport {
+                name: "Shape".to_string(),
+                kind: "interface".to_string(),
+                language: SupportedLanguage::Go,
+                path: PathBuf::from("shapes/shape.go"),
+                start_line: 3,
+                methods: 2,
+                implementors: vec![
+                    implementor("Circle", "shapes/circle.go", 5, true),
+                    implementor("Square", "shapes/square.go", 4, true),
+                ],
             },
-        });
+            InterfaceReport {
+                name: "Draw".to_string(),
+                kind: "trait".to_string(),
+                language: SupportedLanguage::Rust,
+                path: PathBuf::from("src/draw.rs"),
+                start_line: 1,
+                methods: 1,
+                implementors: vec![implementor("Canvas", "src/canvas.rs", 10, false)],
+            },
+        ];
+
+        assert_eq!(
+            format_implementations(&interfaces, OutputFormat::Summary),
+            "Shape (interface, shapes/shape.go:3): 2 implementations\n  \
+             Circle (shapes/circle.go:5, by method set)\n  \
+             Square (shapes/square.go:4, by method set)\n\
+             Draw (trait, src/draw.rs:1): 1 implementations\n  \
+             Canvas (src/canvas.rs:10)\n\n\
+             2 interfaces, 3 implementations"
+        );
+        assert_eq!(
+            format_implementations(&[], OutputFormat::Summary),
+            "No interfaces found"
+        );
+
+        let json: serde_json::Value =
+            serde_json::from_str(&format_implementations(&interfaces, OutputFormat::Json)).unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["interfaces"][0]["implementors"][1]["name"], "Square");
+        assert_eq!(json["interfaces"][0]["implementors"][1]["inferred"], true);
+        assert!(
+            json["interfaces"][1]["implementors"][0]
+                .get("inferred")
+                .is_none()
+        );
+    }
+
+    #[test]
+    fn test_format_configuration_bucket() {
+        let mut stats = create_test_directory_stats();
+        let code_files = stats.total_files();
+        for (path, language, keys, max_depth, documents) in [
+            ("package.json", SupportedLanguage::Json, 12, 2, 1),
+            ("deploy.yaml", SupportedLanguage::Yaml, 30, 4, 3),
+        ] {
+            stats.add_file(FileStats {
+                path: PathBuf::from(path),
+                language,
+                stats: CodeStats {
+                    config: Some(ConfigStats {
+                        keys,
+                        max_depth,
+                        documents,
+                    }),
+                    lines: LineStats {
+                        code: keys,
+                        ..Default::default()
+                    },
+                    ..Default::default()
+                },
+            });
+        }
+
+        let output = format_summary(&stats);
+        assert!(!output.contains("  Json:"));
+        assert!(output.contains(&format!("in {code_files} files\n")));
+        assert!(output.ends_with(
+            "\n\nConfiguration: 2 files (Yaml: 1, Json: 1), 42 keys, max depth 4, 4 documents, 42 code lines\n\
+             Largest configuration files:\n  \
+             deploy.yaml (30 keys, max depth 4, 3 documents)\n  \
+             package.json (12 keys, max depth 2)"
+        ));
+
+        let detail = format_detail(&stats);
+        assert!(detail.contains("package.json (Json):\n"));
+        assert!(detail.contains("  Configuration: 12 keys, max depth 2\n"));
+    }
+
+    #[test]
+    fn test_format_proto_inventory() {
+        use crate::proto::{RpcStats, ServiceStats};
 
+        let rpc = |name: &str, server_streaming| RpcStats {
+            name: name.to_string(),
+            request: "GetCartRequest".to_string(),
+            response: "Cart".to_string(),
+            client_streaming: false,
+            server_streaming,
+            line: 1,
+        };
+        let mut stats = DirectoryStats::new();
         stats.add_file(FileStats {
-            path: PathBuf::from("src/lib.rs"),
-            language: SupportedLanguage::Rust,
+            path: PathBuf::from("cart.proto"),
+            language: SupportedLanguage::Protobuf,
             stats: CodeStats {
-                function_count: 5,
-                class_struct_count: 1,
+                services: vec![ServiceStats {
+                    name: "shop.v1.CartService".to_string(),
+                    start_line: 12,
+                    methods: vec![rpc("GetCart", false), rpc("WatchCart", true)],
+                }],
+                ..Default::default()
             },
         });
 
-        stats.add_file(FileStats {
-            path: PathBuf::from("test.py"),
-            language: SupportedLanguage::Python,
+        assert_eq!(
+            format_proto_inventory(&stats, OutputFormat::Summary),
+            "shop.v1.CartService (cart.proto:12)\
+             \n  GetCart(GetCartRequest) returns (Cart)\
+             \n  WatchCart(GetCartRequest) returns (stream Cart)\
+             \n\
+             \n1 services, 2 methods"
+        );
+
+        let json: serde_json::Value =
+            serde_json::from_str(&format_proto_inventory(&stats, OutputFormat::Json)).unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["services"][0]["path"], "cart.proto");
+        assert_eq!(json["services"][0]["methods"][1]["server_streaming"], true);
+        assert!(json["services"][0]["methods"][0]["server_streaming"].is_null());
+
+        assert_eq!(
+            format_proto_inventory(&DirectoryStats::new(), OutputFormat::Summary),
+            "No services found"
+        );
+    }
+
+    #[test]
+    fn test_format_terraform() {
+        let file = FileStats {
+            path: PathBuf::from("infra/main.tf"),
+            language: SupportedLanguage::Hcl,
             stats: CodeStats {
-                function_count: 2,
-                class_struct_count: 1,
+                terraform: Some(TerraformStats {
+                    resources: 12,
+                    data_sources: 2,
+                    modules: 1,
+                    variables: 4,
+                    outputs: 3,
+                    providers: BTreeMap::from([("aws".to_string(), 9), ("random".to_string(), 3)]),
+                }),
+                ..Default::default()
             },
-        });
-
-        stats
+        };
+        let output = format_single_file(&file, &Thresholds::default());
+        assert!(output.contains(
+            "\nTerraform: 12 resources (aws 9, random 3), 2 data sources, 1 module, 4 variables, 3 outputs"
+        ));
     }
 
-    /// Tests single file formatting output.
-    ///
-    /// Verifies that format_single_file produces the expected content including
-    /// file path, language detection, and statistical counts.
     #[test]
-    fn test_format_single_file() {
-        let file_stats = FileStats {
-            path: PathBuf::from("test.rs"),
-            language: SupportedLanguage::Rust,
+    fn test_format_graphql_schema() {
+        use crate::graphql::{SchemaField, SchemaType};
+
+        let field = |signature: &str, line| SchemaField {
+            name: signature[..signature.find([':', '(']).unwrap()].to_string(),
+            signature: signature.to_string(),
+            line,
+        };
+        let file = |path: &str, schema| FileStats {
+            path: PathBuf::from(path),
+            language: SupportedLanguage::Graphql,
             stats: CodeStats {
-                function_count: 10,
-                class_struct_count: 5,
+                schema,
+                ..Default::default()
             },
         };
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file(
+            "schema/cart.graphql",
+            vec![SchemaType {
+                name: "Query".to_string(),
+                kind: "type".to_string(),
+                extension: true,
+                fields: vec![field("cart(id: ID!): Cart", 9)],
+                line: 8,
+                ..Default::default()
+            }],
+        ));
+        stats.add_file(file(
+            "schema/schema.graphql",
+            vec![SchemaType {
+                name: "Query".to_string(),
+                kind: "type".to_string(),
+                interfaces: vec!["Node".to_string()],
+                fields: vec![field("viewer: User", 2)],
+                line: 1,
+                ..Default::default()
+            }],
+        ));
 
-        let output = format_single_file(&file_stats);
+        // The definition comes first although its file sorts after the extension
+        assert_eq!(
+            format_graphql_schema(&stats, OutputFormat::Summary),
+            "type Query implements Node (schema/schema.graphql:1, schema/cart.graphql:8)\
+             \n  viewer: User\
+             \n  cart(id: ID!): Cart\
+             \n\
+             \n1 types, 2 fields"
+        );
 
-        assert!(output.contains("Analyzing file: test.rs"));
-        assert!(output.contains("Language: Rust"));
-        assert!(output.contains("Functions: 10"));
-        assert!(output.contains("Classes/Structs: 5"));
+        let json: serde_json::Value =
+            serde_json::from_str(&format_graphql_schema(&stats, OutputFormat::Json)).unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["types"][0]["name"], "Query");
+        assert_eq!(
+            json["types"][0]["locations"][1]["path"],
+            "schema/cart.graphql"
+        );
+        assert_eq!(json["types"][0]["fields"][1]["name"], "cart");
+
+        assert_eq!(
+            format_graphql_schema(&DirectoryStats::new(), OutputFormat::Summary),
+            "No schema types found"
+        );
     }
 
-    /// Tests summary format output structure and content.
-    ///
-    /// Validates that format_summary correctly aggregates statistics by language,
-    /// sorts languages alphabetically, and includes accurate totals.
     #[test]
-    fn test_format_summary() {
-        let stats = create_test_directory_stats();
-        let output = format_summary(&stats);
+    fn test_format_dependency_graph() {
+        use crate::imports::{Dependency, Module};
 
-        // Check structure
-        assert!(output.contains("Language Summary:"));
-        assert!(output.contains("Total:"));
+        let module = |name: &str, internal| Module {
+            name: name.to_string(),
+            internal,
+        };
+        let dependency = |from: &str, to: &str| Dependency {
+            from: from.to_string(),
+            to: to.to_string(),
+        };
+        let graph = DependencyGraph {
+            modules: vec![
+                module("src/a.rs", true),
+                module("src/b.rs", true),
+                module("serde", false),
+            ],
+            dependencies: vec![
+                dependency("src/a.rs", "serde"),
+                dependency("src/a.rs", "src/b.rs"),
+                dependency("src/b.rs", "src/a.rs"),
+            ],
+            cycles: vec![vec!["src/a.rs".to_string(), "src/b.rs".to_string()]],
+        };
 
-        // Check language stats
-        assert!(output.contains("Rust:"));
-        assert!(output.contains("8 functions")); // 3 + 5
-        assert!(output.contains("3 structs/classes")); // 2 + 1
-        assert!(output.contains("in 2 files"));
+        assert_eq!(
+            format_dependency_graph(&graph, OutputFormat::Summary),
+            "src/a.rs -> serde, src/b.rs\n\
+             src/b.rs -> src/a.rs\n\
+             \n\
+             3 modules (1 external), 3 dependencies, 1 cycle\n\
+             Cycle: src/a.rs, src/b.rs"
+        );
 
-        assert!(output.contains("Python:"));
-        assert!(output.contains("2 functions"));
-        assert!(output.contains("1 structs/classes"));
-        assert!(output.contains("in 1 files"));
+        let dot = format_dependency_graph(&graph, OutputFormat::Dot);
+        assert!(dot.starts_with("digraph dependencies {"));
+        assert!(dot.contains("    \"serde\" [style=dashed];\n"));
+        assert!(dot.contains("    \"src/a.rs\" -> \"serde\";\n"));
+        assert!(dot.contains("    \"src/a.rs\" -> \"src/b.rs\" [color=red];\n"));
 
-        // Check totals
-        assert!(output.contains("Total: 10 functions, 4 structs/classes in 3 files"));
+        let json: serde_json::Value =
+            serde_json::from_str(&format_dependency_graph(&graph, OutputFormat::Json)).unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["modules"][2]["internal"], false);
+        assert_eq!(json["dependencies"][2]["from"], "src/b.rs");
+        assert_eq!(json["cycles"][0][1], "src/b.rs");
+
+        assert_eq!(
+            format_dependency_graph(&DependencyGraph::default(), OutputFormat::Summary),
+            "No modules found"
+        );
     }
 
-    /// Tests detailed format output including individual files and summary.
-    ///
-    /// Ensures that format_detail displays each file's statistics separately
-    /// and includes the summary section at the end.
     #[test]
-    fn test_format_detail() {
-        let stats = create_test_directory_stats();
-        let output = format_detail(&stats);
+    fn test_format_call_graph_and_unreached() {
+        use crate::calls::{Call, CallNode};
 
-        // Check individual file details
-        assert!(output.contains("src/lib.rs (Rust):"));
-        assert!(output.contains("src/main.rs (Rust):"));
-        assert!(output.contains("test.py (Python):"));
+        let node = |package: &str, name: &str, line, entry_point, callers| CallNode {
+            package: package.to_string(),
+            name: name.to_string(),
+            path: PathBuf::from(package),
+            line,
+            entry_point,
+            callers,
+        };
+        let graph = CallGraph {
+            functions: vec![
+                node("src/cart.rs", "Cart::total", 1, true, 0),
+                node("src/cart.rs", "round", 5, false, 1),
+                node("src/cart.rs", "unused", 9, false, 0),
+                node("src/tax.rs", "rate", 1, true, 0),
+            ],
+            calls: vec![Call { from: 0, to: 1 }],
+        };
 
-        // Should also include summary
-        assert!(output.contains("Language Summary:"));
-        assert!(output.contains("Total:"));
+        assert_eq!(
+            format_call_graph(&graph, OutputFormat::Summary),
+            "src/cart.rs\n\
+             \x20 Cart::total -> round\n\
+             \n\
+             4 functions, 1 call, 1 unreached"
+        );
+
+        let dot = format_call_graph(&graph, OutputFormat::Dot);
+        assert!(dot.starts_with("digraph calls {"));
+        assert!(dot.contains("    subgraph cluster_1 {\n        label=\"src/tax.rs\";\n"));
+        assert!(dot.contains("        f2 [label=\"unused\", style=dashed];\n"));
+        assert!(dot.contains("    f0 -> f1;\n"));
+
+        let json: serde_json::Value =
+            serde_json::from_str(&format_call_graph(&graph, OutputFormat::Json)).unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["functions"][1]["callers"], 1);
+        assert_eq!(json["calls"][0]["to"], 1);
+
+        assert_eq!(
+            format_unreached(&graph, OutputFormat::Summary),
+            "src/cart.rs:9 unused\n\n1 of 4 functions unreached"
+        );
+        let json: serde_json::Value =
+            serde_json::from_str(&format_unreached(&graph, OutputFormat::Json)).unwrap();
+        assert_eq!(json["functions"], 4);
+        assert_eq!(json["unreached"][0]["name"], "unused");
+
+        assert_eq!(
+            format_unreached(&CallGraph::default(), OutputFormat::Summary),
+            "No functions found"
+        );
     }
 
-    /// Tests JSON format serialization and structure.
-    ///
-    /// Verifies that format_json produces valid JSON with the expected
-    /// structure and correct data values.
     #[test]
-    fn test_format_json() {
-        let stats = create_test_directory_stats();
-        let output = format_json(&stats);
+    fn test_format_todos() {
+        use crate::todos::TodoComment;
 
-        // Parse JSON to verify it's valid
-        let parsed: serde_json::Value = serde_json::from_str(&output).unwrap();
+        let item =
+            |path: &str, line, marker: &str, text: &str, blame: Option<(&str, u64)>| TodoItem {
+                path: PathBuf::from(path),
+                comment: TodoComment {
+                    marker: marker.to_string(),
+                    line,
+                    text: text.to_string(),
+                },
+                author: blame.map(|(author, _)| author.to_string()),
+                age_days: blame.map(|(_, age)| age),
+            };
+        let items = [
+            item(
+                "src/cart.rs",
+                3,
+                "TODO",
+                "apply discounts",
+                Some(("Alice", 42)),
+            ),
+            item("src/cart.rs", 9, "FIXME", "", Some(("Bob", 1))),
+            item("src/tax.rs", 1, "TODO", "rates per region", None),
+        ];
 
-        // Check structure
-        assert!(parsed.get("files").is_some());
-        assert!(parsed.get("total_by_language").is_some());
-        assert!(parsed.get("total_stats").is_some());
+        assert_eq!(
+            format_todos(&items, OutputFormat::Summary),
+            "src/cart.rs:3 TODO apply discounts (Alice, 42 days ago)\n\
+             src/cart.rs:9 FIXME (Bob, 1 day ago)\n\
+             src/tax.rs:1 TODO rates per region\n\
+             \n\
+             3 comments: 1 FIXME, 2 TODO"
+        );
 
-        // Check file count
-        let files = parsed["files"].as_array().unwrap();
-        assert_eq!(files.len(), 3);
+        let json: serde_json::Value =
+            serde_json::from_str(&format_todos(&items, OutputFormat::Json)).unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["todos"][0]["marker"], "TODO");
+        assert_eq!(json["todos"][0]["age_days"], 42);
+        assert!(json["todos"][2].get("author").is_none());
+        assert_eq!(json["counts"]["TODO"], 2);
 
-        // Check total stats
-        assert_eq!(parsed["total_stats"]["function_count"], 10);
-        assert_eq!(parsed["total_stats"]["class_struct_count"], 4);
+        assert_eq!(
+            format_todos(&[], OutputFormat::Summary),
+            "No TODO comments found"
+        );
     }
 
-    /// Tests the main format_output function with all supported formats.
-    ///
-    /// Validates that the format dispatcher correctly routes to the appropriate
-    /// formatting function based on the OutputFormat parameter.
     #[test]
-    fn test_format_output_with_different_formats() {
-        let stats = create_test_directory_stats();
+    fn test_format_strings() {
+        let literal = |path: &str, line, text: &str| StringLiteral {
+            path: PathBuf::from(path),
+            line,
+            text: text.to_string(),
+        };
+        let strings = [
+            literal("src/cart.rs", 4, "Cart is empty"),
+            literal("src/cart.rs", 9, "Removed {} items"),
+            literal("src/tax.rs", 2, "Unknown region"),
+        ];
 
-        let summary = format_output(&stats, OutputFormat::Summary, false);
-        assert!(summary.contains("Language Summary:"));
-        assert!(!summary.contains("src/main.rs"));
+        assert_eq!(
+            format_strings(&strings, OutputFormat::Summary),
+            "src/cart.rs:4 \"Cart is empty\"\n\
+             src/cart.rs:9 \"Removed {} items\"\n\
+             src/tax.rs:2 \"Unknown region\"\n\
+             \n\
+             3 strings in 2 files"
+        );
 
-        let detail = format_output(&stats, OutputFormat::Detail, false);
-        assert!(detail.contains("src/main.rs"));
-        assert!(detail.contains("Language Summary:"));
+        let json: serde_json::Value =
+            serde_json::from_str(&format_strings(&strings, OutputFormat::Json)).unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["files"], 2);
+        assert_eq!(json["strings"][1]["line"], 9);
+        assert_eq!(json["strings"][2]["text"], "Unknown region");
 
-        let json = format_output(&stats, OutputFormat::Json, false);
-        assert!(json.starts_with('{'));
-        assert!(json.contains("\"files\""));
+        assert_eq!(
+            format_strings(&[], OutputFormat::Summary),
+            "No user-facing strings found"
+        );
     }
 
-    /// Tests formatting behavior with empty statistics.
-    ///
-    /// Ensures that all formatters handle the edge case of no analyzed files
-    /// gracefully, displaying appropriate zero values.
     #[test]
-    fn test_format_empty_stats() {
-        let stats = DirectoryStats::new();
+    fn test_format_licenses() {
+        use crate::license::LicenseCount;
 
-        let summary = format_summary(&stats);
-        assert!(summary.contains("Total: 0 functions, 0 structs/classes in 0 files"));
+        let count = |license: &str, files| LicenseCount {
+            license: license.to_string(),
+            files,
+        };
+        let report = LicenseReport {
+            files: 4,
+            licenses: vec![count("Apache-2.0", 2), count("MIT", 1)],
+            missing: vec![PathBuf::from("tools/build.py")],
+        };
+        assert_eq!(
+            format_licenses(&report, OutputFormat::Summary),
+            "Apache-2.0  2 files\n\
+             MIT         1 file\n\
+             \n\
+             Missing license header:\n\
+             \x20 tools/build.py\n\
+             \n\
+             3 of 4 files have a license header (75.0%)"
+        );
 
-        let detail = format_detail(&stats);
-        assert!(detail.contains("Total: 0 functions, 0 structs/classes in 0 files"));
+        let json: serde_json::Value =
+            serde_json::from_str(&format_licenses(&report, OutputFormat::Json)).unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["licenses"][0]["license"], "Apache-2.0");
+        assert_eq!(json["missing"][0], "tools/build.py");
 
-        let json = format_json(&stats);
-        let parsed: serde_json::Value = serde_json::from_str(&json).unwrap();
-        assert_eq!(parsed["files"].as_array().unwrap().len(), 0);
+        let empty = LicenseReport {
+            files: 0,
+            licenses: Vec::new(),
+            missing: Vec::new(),
+        };
+        assert_eq!(
+            format_licenses(&empty, OutputFormat::Summary),
+            "No files found"
+        );
     }
 
-    /// Tests that languages are sorted alphabetically in summary output.
-    ///
-    /// Verifies the alphabetical ordering requirement by adding languages
-    /// in non-alphabetical order and checking their position in the output.
     #[test]
-    fn test_format_language_sorting() {
-        let mut stats = DirectoryStats::new();
+    fn test_format_profile() {
+        use crate::profile::{FileProfile, Profiler, Timing};
 
-        // Add files in non-alphabetical order
-        stats.add_file(FileStats {
-            path: PathBuf::from("test.py"),
-            language: SupportedLanguage::Python,
-            stats: CodeStats {
-                function_count: 1,
-                class_struct_count: 0,
+        let profiler = Profiler::new();
+        profiler.record(FileProfile {
+            path: PathBuf::from("src/grammar.go"),
+            language: SupportedLanguage::Go,
+            bytes: 2048,
+            timing: Timing {
+                parse: Duration::from_millis(8),
+                queries: Duration::from_millis(2),
+                cached: false,
             },
+            total: Duration::from_millis(12),
         });
+        let mut report = profiler.report(Duration::from_millis(20), 10);
+        report.peak_memory = Some(3 * 1024 * 1024);
+        assert_eq!(
+            format_profile(&report),
+            "Profile: 1 file, 2.0 KiB in 20.0 ms (peak memory 3.0 MiB)\n\
+             \n\
+             Language       Files  Cached       Bytes      Parse    Queries      Total\n\
+             Go                 1       0     2.0 KiB      8.0ms      2.0ms     12.0ms\n\
+             \n\
+             Slowest files:\n\
+             \x20    12.0ms  src/grammar.go (Go, 2.0 KiB)\n"
+        );
 
-        stats.add_file(FileStats {
-            path: PathBuf::from("test.go"),
-            language: SupportedLanguage::Go,
-            stats: CodeStats {
-                function_count: 1,
-                class_struct_count: 0,
+        let empty = Profiler::new().report(Duration::from_millis(1), 10);
+        assert!(format_profile(&empty).starts_with("Profile: 0 files, 0 B in 1.0 ms"));
+    }
+
+    #[test]
+    fn test_format_identifiers() {
+        use crate::identifiers::{Identifier, LanguageIdentifiers};
+
+        let identifier = |name: &str, line| Identifier {
+            path: PathBuf::from("geo.go"),
+            line,
+            name: name.to_string(),
+            length: name.len(),
+        };
+        let report = IdentifierReport {
+            languages: vec![LanguageIdentifiers {
+                language: SupportedLanguage::Go,
+                declared: 3,
+                average_length: 16.0 / 3.0,
+                single_letter: 1,
+                single_letter_in_loops: 2,
+            }],
+            longest: vec![identifier("distance", 3), identifier("origin", 7)],
+            single_letter: vec![identifier("s", 8)],
+        };
+        assert_eq!(
+            format_identifiers(&report, OutputFormat::Summary),
+            "Language      Declared  Avg length  Single-letter  In loops\n\
+             Go                   3         5.3              1         2\n\
+             \n\
+             Longest identifiers:\n\
+             \x20 distance (8, geo.go:3)\n\
+             \x20 origin (6, geo.go:7)\n\
+             \n\
+             Single-letter variables outside loops:\n\
+             \x20 s (geo.go:8)"
+        );
+
+        let json: serde_json::Value =
+            serde_json::from_str(&format_identifiers(&report, OutputFormat::Json)).unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["languages"][0]["language"], "Go");
+        assert_eq!(json["longest"][0]["length"], 8);
+        assert_eq!(json["single_letter"][0]["name"], "s");
+
+        let empty = IdentifierReport {
+            languages: Vec::new(),
+            longest: Vec::new(),
+            single_letter: Vec::new(),
+        };
+        assert_eq!(
+            format_identifiers(&empty, OutputFormat::Summary),
+            "No identifiers found"
+        );
+    }
+
+    #[test]
+    fn test_format_findings() {
+        let finding = |line, severity, rule: &str, message: &str| Finding {
+            rule: rule.to_string(),
+            severity,
+            path: PathBuf::from("util.go"),
+            line,
+            column: 2,
+            end_line: line,
+            end_column: 20,
+            message: message.to_string(),
+        };
+        let findings = [
+            finding(4, Severity::Warning, "no-printf", "use the logger"),
+            finding(9, Severity::Error, "no-panic", "panic in library code"),
+        ];
+
+        assert_eq!(
+            format_findings(&findings, &[], OutputFormat::Summary),
+            "util.go:4:2: warning[no-printf] use the logger\n\
+             util.go:9:2: error[no-panic] panic in library code\n\
+             \n\
+             1 error, 1 warning, 0 notes"
+        );
+
+        let json: serde_json::Value =
+            serde_json::from_str(&format_findings(&findings, &[], OutputFormat::Json)).unwrap();
+        assert_eq!(json["errors"], 1);
+        assert_eq!(json["findings"][1]["severity"], "error");
+        assert_eq!(json["findings"][0]["end_column"], 20);
+
+        assert_eq!(
+            format_findings(&[], &[], OutputFormat::Summary),
+            "No lint findings"
+        );
+    }
+
+    #[test]
+    fn test_format_tokens() {
+        use crate::tokens::{BudgetFit, TokenStats};
+
+        let row = |path: &str, syntax, llm| TokenRow {
+            path: PathBuf::from(path),
+            tokens: TokenStats { syntax, llm },
+        };
+        let mut report = TokenReport {
+            files: vec![row("src/a.rs", 120, 90), row("src/b.rs", 4000, 3100)],
+            directories: vec![row("src", 4120, 3190)],
+            total: TokenStats {
+                syntax: 4120,
+                llm: 3190,
             },
+            budget: None,
+        };
+        assert_eq!(
+            format_tokens(&report, OutputFormat::Summary),
+            "Syntax   LLM  Path\n\
+             \x20  120    90  src/a.rs\n\
+             \x20 4000  3100  src/b.rs\n\
+             \n\
+             Total: 4120 syntax tokens, ~3190 LLM tokens in 2 files"
+        );
+
+        report.budget = Some(BudgetFit {
+            budget: 1000,
+            used: 90,
+            fits: vec![PathBuf::from("src/a.rs")],
+            left_out: vec![PathBuf::from("src/b.rs")],
         });
+        assert!(format_tokens(&report, OutputFormat::Summary).ends_with(
+            "Fits in 1000 LLM tokens: 1 of 2 files, ~90 used\n  src/a.rs\nLeft out:\n  src/b.rs"
+        ));
 
-        stats.add_file(FileStats {
-            path: PathBuf::from("test.rs"),
-            language: SupportedLanguage::Rust,
-            stats: CodeStats {
-                function_count: 1,
-                class_struct_count: 0,
+        let json: serde_json::Value =
+            serde_json::from_str(&format_tokens(&report, OutputFormat::Json)).unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["files"][1]["llm"], 3100);
+        assert_eq!(json["total"]["syntax"], 4120);
+        assert_eq!(json["budget"]["left_out"][0], "src/b.rs");
+    }
+
+    #[test]
+    fn test_format_distributions() {
+        let report = DistributionReport {
+            file_lines: Distribution::of(vec![3, 4, 12]),
+            function_lines: Distribution::of(Vec::new()),
+        };
+        let output = format_distributions(&report, OutputFormat::Summary);
+        let lines: Vec<&str> = output.lines().collect();
+        assert_eq!(lines[0], "File lines of code (3 files)");
+        assert_eq!(lines[1], "  min 3  p50 4  p90 12  p99 12  max 12  mean 6.3");
+        assert_eq!(lines[2], format!("    2-4  {}  2", "#".repeat(40)));
+        assert_eq!(lines[3], format!("    5-9  {}  0", " ".repeat(40)));
+        assert_eq!(lines[4], format!("  10-19  {:40}  1", "#".repeat(20)));
+        assert_eq!(lines[6], "No functions found");
+
+        let json: serde_json::Value =
+            serde_json::from_str(&format_distributions(&report, OutputFormat::Json)).unwrap();
+        assert_eq!(json["schema_version"], JSON_SCHEMA_VERSION);
+        assert_eq!(json["file_lines"]["p90"], 12);
+        assert_eq!(json["file_lines"]["buckets"][2]["low"], 10);
+        assert_eq!(json["function_lines"]["count"], 0);
+    }
+
+    #[test]
+    fn test_format_history() {
+        use crate::history::HistoryTotals;
+
+        let totals = |code_lines| HistoryTotals {
+            files: 1,
+            code_lines,
+            functions: 2,
+            max_complexity: 4,
+            mean_complexity: 2.5,
+        };
+        let point = |date: &str, commit: &str, go, rust| HistoryPoint {
+            date: date.to_string(),
+            commit: commit.to_string(),
+            total: totals(go + rust),
+            languages: [
+                ("Go".to_string(), totals(go)),
+                ("Rust".to_string(), totals(rust)),
+            ]
+            .into(),
+        };
+        let points = [
+            point("2023-01-01", "1a2b3c4d5e6f", 40, 960),
+            point("2023-02-01", "9f8e7d6c5b4a", 45, 1200),
+        ];
+
+        assert_eq!(
+            format_history(&points, OutputFormat::Summary),
+            "Date        Commit    Files  Code  Functions  Max CC  Mean CC\n\
+             2023-01-01  1a2b3c4d      1  1000          2       4     2.50\n\
+             2023-02-01  9f8e7d6c      1  1245          2       4     2.50\n\
+             \n\
+             Code by language:\n\
+             Date        Go  Rust\n\
+             2023-01-01  40   960\n\
+             2023-02-01  45  1200"
+        );
+        assert!(format_history(&points, OutputFormat::Json).contains("\"schema_version\""));
+        assert_eq!(
+            format_history(&[], OutputFormat::Summary),
+            "No commits found in the requested range"
+        );
+    }
+
+    #[test]
+    fn test_format_languages() {
+        let grammars = [
+            GrammarInfo {
+                language: SupportedLanguage::Rust,
+                crate_name: Some("tree-sitter-rust"),
+                version: Some("0.24.2"),
+                abi: 14,
+                path: None,
             },
-        });
+            GrammarInfo {
+                language: SupportedLanguage::Go,
+                crate_name: Some("tree-sitter-go"),
+                version: None,
+                abi: 15,
+                path: None,
+            },
+        ];
+        let text = format_languages(&grammars, OutputFormat::Summary);
+        assert!(text.starts_with("tree-sitter "));
+        assert!(text.ends_with(
+            "Language  Grammar           Version  ABI\n\
+             Rust      tree-sitter-rust  0.24.2    14\n\
+             Go        tree-sitter-go    unknown   15"
+        ));
 
-        let output = format_summary(&stats);
+        let json: serde_json::Value =
+            serde_json::from_str(&format_languages(&grammars, OutputFormat::Json)).unwrap();
+        assert_eq!(json["grammars"][0]["language"], "Rust");
+        assert_eq!(json["grammars"][0]["crate"], "tree-sitter-rust");
+        assert_eq!(json["grammars"][1]["version"], serde_json::Value::Null);
+        assert!(json["grammars"][0].get("path").is_none());
+        assert_eq!(json["max_abi"], tree_sitter::LANGUAGE_VERSION);
+    }
 
-        // Languages should be sorted alphabetically
-        let go_pos = output.find("Go:").unwrap();
-        let python_pos = output.find("Python:").unwrap();
-        let rust_pos = output.find("Rust:").unwrap();
+    #[test]
+    fn test_format_workspace() {
+        use crate::workspace::RepositoryRow;
 
-        assert!(go_pos < python_pos);
-        assert!(python_pos < rust_pos);
+        let totals = |code_lines, max_complexity| RepositoryTotals {
+            files: 2,
+            code_lines,
+            comment_lines: 20,
+            functions: 8,
+            max_complexity,
+            mean_complexity: 2.5,
+            ..RepositoryTotals::default()
+        };
+        let row = |name: &str, code_lines, max_complexity| RepositoryRow {
+            name: name.to_string(),
+            path: PathBuf::from(format!("../{name}")),
+            totals: totals(code_lines, max_complexity),
+        };
+        let report = WorkspaceReport {
+            repositories: vec![row("billing", 300, 12), row("search", 100, 4)],
+            total: RepositoryTotals {
+                files: 4,
+                comment_lines: 40,
+                functions: 16,
+                ..totals(400, 12)
+            },
+        };
+        let text = format_workspace(
+            &report,
+            &DirectoryStats::new(),
+            OutputFormat::Summary,
+            &Thresholds::default(),
+        );
+        assert!(text.starts_with(
+            "Repository  Files  Code  Comments  Functions  Max CC  Mean CC   Share\n\
+             billing         2   300        20          8      12     2.50   75.0%\n\
+             search          2   100        20          8       4     2.50   25.0%\n\
+             Total           4   400        40         16      12     2.50  100.0%\n\
+             \n\
+             All repositories:\n\
+             Language Summary:\n"
+        ));
+
+        let json: serde_json::Value = serde_json::from_str(&format_workspace(
+            &report,
+            &DirectoryStats::new(),
+            OutputFormat::Json,
+            &Thresholds::default(),
+        ))
+        .unwrap();
+        assert_eq!(json["repositories"][1]["name"], "search");
+        assert_eq!(json["repositories"][1]["code_lines"], 100);
+        assert_eq!(json["total"]["functions"], 16);
+    }
+
+    #[test]
+    fn test_format_hotspots() {
+        let hotspot = |path: &str, commits, complexity| Hotspot {
+            path: PathBuf::from(path),
+            commits,
+            complexity,
+            max_complexity: complexity / 2,
+            code_lines: complexity * 10,
+            score: commits * complexity,
+        };
+        let hotspots = [
+            hotspot("src/parser.rs", 46, 40),
+            hotspot("src/cli.rs", 90, 11),
+            hotspot("src/lib.rs", 3, 2),
+        ];
+
+        assert_eq!(
+            format_hotspots(&hotspots, 2, OutputFormat::Summary),
+            "Rank  Score  Commits  Complexity  Max CC  Code  File\n\
+             \x20  1   1840       46          40      20   400  src/parser.rs\n\
+             \x20  2    990       90          11       5   110  src/cli.rs\n\
+             \n\
+             Top 2 of 3 files by commits x complexity"
+        );
+        let json = format_hotspots(&hotspots, 1, OutputFormat::Json);
+        assert!(json.contains("\"total\": 3"), "{json}");
+        assert!(json.contains("\"rank\": 1"), "{json}");
+        assert!(!json.contains("src/cli.rs"), "{json}");
+        assert_eq!(
+            format_hotspots(&[], 20, OutputFormat::Summary),
+            "No hotspots found"
+        );
+    }
+
+    #[test]
+    fn test_format_ownership() {
+        use crate::ownership::OwnerStats;
+
+        let ownership = Ownership {
+            grouping: "codeowners",
+            owners: vec![
+                OwnerStats {
+                    owner: "@org/core".to_string(),
+                    files: 12,
+                    lines: 3410,
+                    functions: 84,
+                    complexity: 402,
+                    max_complexity: 25,
+                },
+                OwnerStats {
+                    owner: "@org/ux".to_string(),
+                    files: 5,
+                    lines: 960,
+                    functions: 31,
+                    complexity: 77,
+                    max_complexity: 9,
+                },
+            ],
+            skipped: Vec::new(),
+        };
+        assert_eq!(
+            format_ownership(&ownership, OutputFormat::Summary),
+            "Owner      Files  Lines  Functions  Complexity  Max CC\n\
+             @org/core     12   3410         84         402      25\n\
+             @org/ux        5    960         31          77       9\n\
+             \n\
+             2 owners from CODEOWNERS"
+        );
+        let json = format_ownership(&ownership, OutputFormat::Json);
+        assert!(json.contains("\"grouping\": \"codeowners\""), "{json}");
+        assert!(json.contains("\"owner\": \"@org/ux\""), "{json}");
+        assert_eq!(
+            format_ownership(&Ownership::default(), OutputFormat::Summary),
+            "No owners found by git blame"
+        );
     }
 }
@@ -0,0 +1,211 @@
+//! Bindings and declarations of Haskell and OCaml.
+//!
+//! Both languages define functions as bindings: `add a b = a + b` in
+//! Haskell, `let add a b = a + b` in OCaml. A binding with parameters is a
+//! function; a top-level binding without any is counted as a `binding`, as
+//! `main = do ...` and point-free definitions such as `total = sum . prices`
+//! are functions in all but syntax. A binding whose value is a lambda is left
+//! to the lambda, which takes the binding's name.
+//!
+//! Each equation of a Haskell function is a node of its own, so, as with
+//! Elixir's `def` clauses, every equation is a function; an OCaml function is
+//! one `let_binding` whatever patterns it matches.
+
+use crate::language::SupportedLanguage;
+use tree_sitter::Node;
+
+/// Parents of the Haskell declarations that make up a module, a class, or
+/// an instance.
+const HASKELL_DECLARATION_LISTS: [&str; 3] = [
+    "declarations",
+    "class_declarations",
+    "instance_declarations",
+];
+
+/// Returns true if `node` is a Haskell or OCaml binding that is reported as a
+/// function: a `function` equation, an OCaml `let` with parameters, or a
+/// top-level binding without parameters whose value is not a lambda.
+pub(crate) fn is_binding_function(node: &Node, language: &SupportedLanguage) -> bool {
+    match (language, node.kind()) {
+        (SupportedLanguage::Haskell, "function") => true,
+        (SupportedLanguage::Haskell, "bind") => {
+            node.parent()
+                .is_some_and(|parent| HASKELL_DECLARATION_LISTS.contains(&parent.kind()))
+                && !node
+                    .child_by_field_name("match")
+                    .and_then(|body| body.child_by_field_name("expression"))
+                    .is_some_and(|value| is_lambda(&value, language))
+        }
+        (SupportedLanguage::OCaml, "let_binding") => {
+            has_ocaml_parameters(node)
+                || (is_top_level(node)
+                    && !node
+                        .child_by_field_name("body")
+                        .is_some_and(|value| is_lambda(&value, language)))
+        }
+        _ => false,
+    }
+}
+
+/// Returns true for Haskell and OCaml lambdas: `\x -> ...` and `\case` in
+/// Haskell, `fun x -> ...` and `function | ... -> ...` in OCaml.
+pub(crate) fn is_lambda(node: &Node, language: &SupportedLanguage) -> bool {
+    match language {
+        SupportedLanguage::Haskell => matches!(node.kind(), "lambda" | "lambda_case"),
+        SupportedLanguage::OCaml => matches!(node.kind(), "fun_expression" | "function_expression"),
+        _ => false,
+    }
+}
+
+/// Returns true if an OCaml `let_binding` takes parameters.
+fn has_ocaml_parameters(node: &Node) -> bool {
+    let mut cursor = node.walk();
+    node.named_children(&mut cursor)
+        .any(|child| child.kind() == "parameter")
+}
+
+/// Returns true if an OCaml `let_binding` is defined at the top level of a
+/// file or module rather than in a `let ... in` expression.
+pub(crate) fn is_top_level(node: &Node) -> bool {
+    node.parent()
+        .filter(|definition| definition.kind() == "value_definition")
+        .and_then(|definition| definition.parent())
+        .is_some_and(|parent| matches!(parent.kind(), "compilation_unit" | "structure"))
+}
+
+/// Returns the name of a Haskell or OCaml binding: the `name` of a Haskell
+/// equation, or the `pattern` of an OCaml `let` when it is a plain name.
+pub(crate) fn binding_name<'a>(node: &Node, source: &'a [u8]) -> Option<&'a str> {
+    let name = match node.kind() {
+        "function" | "bind" => node.child_by_field_name("name")?,
+        "let_binding" => node
+            .child_by_field_name("pattern")
+            .filter(|pattern| pattern.kind() == "value_name")?,
+        _ => return None,
+    };
+    name.utf8_text(source).ok()
+}
+
+/// Counts the parameters of a Haskell or OCaml function or lambda. A `\case`
+/// or OCaml `function` takes the one value it matches on.
+pub(crate) fn arity(node: &Node) -> usize {
+    let mut cursor = node.walk();
+    match node.kind() {
+        "function" | "lambda" => node.child_by_field_name("patterns").map_or(0, |patterns| {
+            let mut cursor = patterns.walk();
+            patterns
+                .named_children(&mut cursor)
+                .filter(|pattern| !pattern.kind().contains("comment"))
+                .count()
+        }),
+        "lambda_case" | "function_expression" => 1,
+        "let_binding" | "fun_expression" => node
+            .named_children(&mut cursor)
+            .filter(|child| child.kind() == "parameter")
+            .count(),
+        _ => 0,
+    }
+}
+
+/// Returns the name of the module a Haskell file declares in its
+/// `module Shop.Cart where` header.
+pub(crate) fn haskell_module<'a>(node: &Node, source: &'a [u8]) -> Option<&'a str> {
+    let mut root = *node;
+    while let Some(parent) = root.parent() {
+        root = parent;
+    }
+    let mut cursor = root.walk();
+    root.named_children(&mut cursor)
+        .find(|child| child.kind() == "header")
+        .and_then(|header| header.child_by_field_name("module"))
+        .and_then(|module| module.utf8_text(source).ok())
+}
+
+/// Returns the names a Haskell module exports, or `None` if its header has
+/// no export list and everything is exported.
+///
+/// `Cart(..)` exports the type `Cart`; re-exported modules (`module X`) are
+/// skipped.
+pub(crate) fn haskell_exports(root: &Node, source: &[u8]) -> Option<Vec<String>> {
+    let mut cursor = root.walk();
+    let exports = root
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "header")?
+        .child_by_field_name("exports")?
+        .utf8_text(source)
+        .ok()?;
+    let list = exports
+        .trim()
+        .strip_prefix('(')
+        .and_then(|list| list.strip_suffix(')'))
+        .unwrap_or(exports);
+
+    // Split at the commas outside of constructor lists
+    let mut names = Vec::new();
+    let mut depth = 0;
+    let mut start = 0;
+    for (index, c) in list.char_indices().chain([(list.len(), ',')]) {
+        match c {
+            '(' => depth += 1,
+            ')' => depth -= 1,
+            ',' if depth == 0 => {
+                let entry = list[start..index].trim();
+                start = index + 1;
+                if entry.starts_with("module ") {
+                    continue;
+                }
+                let name = entry
+                    .split(|c: char| c == '(' || c.is_whitespace())
+                    .find(|part| !part.is_empty() && *part != "type" && *part != "pattern");
+                names.extend(name.map(str::to_string));
+            }
+            _ => {}
+        }
+    }
+    Some(names)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::create_parser;
+
+    #[test]
+    fn test_haskell_exports() {
+        let source = "module Shop.Cart\n  ( Cart(..)\n  , add\n  , module Shop.Item\n  ) where\n\nadd = undefined\n";
+        let mut parser = create_parser(&SupportedLanguage::Haskell).unwrap();
+        let tree = parser.parse(source, None).unwrap();
+        let root = tree.root_node();
+        assert_eq!(
+            haskell_exports(&root, source.as_bytes()),
+            Some(vec!["Cart".to_string(), "add".to_string()])
+        );
+        assert_eq!(haskell_module(&root, source.as_bytes()), Some("Shop.Cart"));
+
+        let source = "module Main where\n\nmain = pure ()\n";
+        let tree = parser.parse(source, None).unwrap();
+        assert_eq!(haskell_exports(&tree.root_node(), source.as_bytes()), None);
+    }
+
+    #[test]
+    fn test_ocaml_binding_functions() {
+        let source = "let add a b = a + b\nlet total = List.fold_left add 0\nlet double = fun x -> x * 2\nlet run () = let limit = 10 in limit\n";
+        let mut parser = create_parser(&SupportedLanguage::OCaml).unwrap();
+        let tree = parser.parse(source, None).unwrap();
+        let mut found = Vec::new();
+        let mut stack = vec![tree.root_node()];
+        while let Some(node) = stack.pop() {
+            if is_binding_function(&node, &SupportedLanguage::OCaml) {
+                found.push((
+                    binding_name(&node, source.as_bytes()).unwrap(),
+                    arity(&node),
+                ));
+            }
+            let mut cursor = node.walk();
+            let children: Vec<Node> = node.named_children(&mut cursor).collect();
+            stack.extend(children.into_iter().rev());
+        }
+        // `double` is its lambda and `limit` a local value
+        assert_eq!(found, [("add", 2), ("total", 0), ("run", 1)]);
+    }
+}
@@ -0,0 +1,230 @@
+//! Generic declarations and instantiations in Go, Rust, TypeScript, and
+//! Java.
+//!
+//! A generic declaration is a function, method, type, or `impl` block with a
+//! type parameter list; its size is the number of type parameters, leaving
+//! out Rust lifetimes, which do not make code generic over types. An
+//! instantiation is every list of type arguments, whether it names a type
+//! (`Vec<String>`, `Map[K, V]`) or calls a function explicitly
+//! (`parse::<u32>()`). Java's diamond `new ArrayList<>()` is an instantiation
+//! as well, with the arguments inferred.
+
+use crate::language::SupportedLanguage;
+use serde::{Deserialize, Serialize};
+use tree_sitter::Node;
+
+/// Generic declarations and instantiations of a file or a group of files.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct GenericsStats {
+    /// Number of declarations with type parameters
+    pub declarations: usize,
+    /// Number of type parameters across those declarations
+    pub type_parameters: usize,
+    /// Most type parameters of any single declaration
+    pub max_type_parameters: usize,
+    /// Number of type argument lists
+    pub instantiations: usize,
+}
+
+impl GenericsStats {
+    /// Adds the counts of `other` and keeps the larger maximum.
+    pub(crate) fn merge(&mut self, other: &GenericsStats) {
+        self.declarations += other.declarations;
+        self.type_parameters += other.type_parameters;
+        self.max_type_parameters = self.max_type_parameters.max(other.max_type_parameters);
+        self.instantiations += other.instantiations;
+    }
+
+    /// Returns true if nothing generic was found.
+    pub(crate) fn is_empty(&self) -> bool {
+        self.declarations == 0 && self.instantiations == 0
+    }
+}
+
+/// Counts the generic declarations and instantiations of a parsed file.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the parsed file
+/// * `language` - The programming language of the source code
+///
+/// # Returns
+///
+/// The counts, or `None` for languages other than Go, Rust, TypeScript, and
+/// Java
+pub(crate) fn generics_stats(root: &Node, language: &SupportedLanguage) -> Option<GenericsStats> {
+    let parameter_list = match language {
+        SupportedLanguage::Go => "type_parameter_list",
+        SupportedLanguage::Rust | SupportedLanguage::TypeScript | SupportedLanguage::Java => {
+            "type_parameters"
+        }
+        _ => return None,
+    };
+
+    let mut stats = GenericsStats::default();
+    let mut stack = vec![*root];
+    while let Some(node) = stack.pop() {
+        let kind = node.kind();
+        if kind == parameter_list {
+            let count = type_parameter_count(&node, language);
+            stats.declarations += 1;
+            stats.type_parameters += count;
+            stats.max_type_parameters = stats.max_type_parameters.max(count);
+        } else if kind == "type_arguments" {
+            stats.instantiations += 1;
+        }
+        let mut cursor = node.walk();
+        stack.extend(node.named_children(&mut cursor));
+    }
+    Some(stats)
+}
+
+/// Counts the type parameters of a parameter list.
+///
+/// A Go declaration such as `K, V comparable` declares one parameter per
+/// name.
+fn type_parameter_count(list: &Node, language: &SupportedLanguage) -> usize {
+    let mut cursor = list.walk();
+    let parameters: Vec<Node> = list.named_children(&mut cursor).collect();
+    match language {
+        SupportedLanguage::Go => parameters
+            .iter()
+            .filter(|parameter| parameter.kind() == "type_parameter_declaration")
+            .map(|parameter| {
+                let mut cursor = parameter.walk();
+                parameter
+                    .children_by_field_name("name", &mut cursor)
+                    .count()
+            })
+            .sum(),
+        SupportedLanguage::Rust => parameters
+            .iter()
+            .filter(|parameter| {
+                !matches!(
+                    parameter.kind(),
+                    "lifetime"
+                        | "lifetime_parameter"
+                        | "attribute_item"
+                        | "line_comment"
+                        | "block_comment"
+                )
+            })
+            .count(),
+        _ => parameters
+            .iter()
+            .filter(|parameter| parameter.kind() == "type_parameter")
+            .count(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::create_parser;
+
+    fn generics(source: &str, language: SupportedLanguage) -> Option<GenericsStats> {
+        let mut parser = create_parser(&language).unwrap();
+        let tree = parser.parse(source, None).unwrap();
+        generics_stats(&tree.root_node(), &language)
+    }
+
+    #[test]
+    fn test_go_type_parameters() {
+        let source = r#"
+package main
+
+type Pair[K comparable, V any] struct {
+    Key K
+    Value V
+}
+
+func Map[T, U any](items []T, f func(T) U) []U {
+    return nil
+}
+
+func main() {
+    p := Pair[string, int]{}
+    _ = Map[int, string](nil, nil)
+}
+"#;
+        assert_eq!(
+            generics(source, SupportedLanguage::Go),
+            Some(GenericsStats {
+                declarations: 2,
+                type_parameters: 4,
+                max_type_parameters: 2,
+                instantiations: 2,
+            })
+        );
+    }
+
+    #[test]
+    fn test_rust_lifetimes_are_not_type_parameters() {
+        let source = r#"
+struct Parser<'a, T, const N: usize> {
+    input: &'a [T; N],
+}
+
+impl<'a, T> Parser<'a, T, 4> {
+    fn items(&self) -> Vec<Option<T>> {
+        "1".parse::<u32>().ok();
+        Vec::new()
+    }
+}
+"#;
+        // Parser<'a, T, 4>, Vec<Option<T>>, Option<T>, and ::<u32>
+        assert_eq!(
+            generics(source, SupportedLanguage::Rust),
+            Some(GenericsStats {
+                declarations: 2,
+                type_parameters: 3,
+                max_type_parameters: 2,
+                instantiations: 4,
+            })
+        );
+    }
+
+    #[test]
+    fn test_typescript_and_java_generics() {
+        let typescript = "function first<T>(items: Array<T>): T { return items[0]; }\n";
+        let stats = generics(typescript, SupportedLanguage::TypeScript).unwrap();
+        assert_eq!((stats.declarations, stats.instantiations), (1, 1));
+
+        let java = r#"
+class Cache<K, V extends Comparable<V>> {
+    private final Map<K, V> entries = new HashMap<>();
+}
+"#;
+        let stats = generics(java, SupportedLanguage::Java).unwrap();
+        assert_eq!(stats.max_type_parameters, 2);
+        assert_eq!(stats.instantiations, 3);
+
+        assert_eq!(generics("def f(): pass\n", SupportedLanguage::Python), None);
+    }
+
+    #[test]
+    fn test_merge_keeps_largest_declaration() {
+        let mut total = GenericsStats {
+            declarations: 1,
+            type_parameters: 3,
+            max_type_parameters: 3,
+            instantiations: 2,
+        };
+        total.merge(&GenericsStats {
+            declarations: 2,
+            type_parameters: 2,
+            max_type_parameters: 1,
+            instantiations: 5,
+        });
+        assert_eq!(
+            total,
+            GenericsStats {
+                declarations: 3,
+                type_parameters: 5,
+                max_type_parameters: 3,
+                instantiations: 7,
+            }
+        );
+        assert!(GenericsStats::default().is_empty());
+    }
+}
@@ -0,0 +1,436 @@
+//! Go idioms that line and function counts don't show: goroutines, channel
+//! operations, `defer`, error returns, the method sets of receiver types,
+//! and the exported API of a package.
+//!
+//! Method sets decide which interfaces a type satisfies: the method set of
+//! `T` holds its value-receiver methods, and that of `*T` holds the
+//! pointer-receiver methods as well, so a type whose methods are split
+//! between both only satisfies an interface through a pointer.
+//!
+//! A top-level name is exported if it starts with an upper-case letter. A
+//! method is only part of the API if its receiver type is exported as well,
+//! since other packages can't name the type otherwise.
+
+use crate::signature::go_receiver_type;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use tree_sitter::Node;
+
+/// Counts of Go concurrency and error handling constructs.
+#[derive(Default, Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct GoStats {
+    /// Number of `go` statements
+    pub goroutines: usize,
+    /// Number of channel sends (`ch <- v`)
+    pub channel_sends: usize,
+    /// Number of channel receives (`<-ch`), including those in `select` cases
+    pub channel_receives: usize,
+    /// Number of `select` statements
+    pub selects: usize,
+    /// Number of `defer` statements
+    pub defers: usize,
+    /// Number of function and method declarations
+    pub functions: usize,
+    /// Number of function and method declarations with an `error` result
+    pub error_returning: usize,
+    /// Number of exported top-level types, functions, methods, and constants
+    pub exported: usize,
+    /// Number of unexported top-level types, functions, methods, and
+    /// constants
+    pub unexported: usize,
+    /// Methods declared per receiver type name. Only populated for individual
+    /// files; totals leave this empty.
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub method_sets: BTreeMap<String, MethodSet>,
+    /// Name in the file's package clause. Only set for individual files.
+    #[serde(default, skip_serializing_if = "String::is_empty")]
+    pub package: String,
+    /// Top-level declarations, in source order. Only populated for
+    /// individual files, like `method_sets`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub api: Vec<ApiSymbol>,
+}
+
+/// Kind of a top-level Go declaration, named by its keyword.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum ApiKind {
+    /// A type declaration or alias
+    Type,
+    /// A function
+    Func,
+    /// A method, named `Type.Method`
+    Method,
+    /// A constant
+    Const,
+}
+
+impl std::fmt::Display for ApiKind {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str(match self {
+            ApiKind::Type => "type",
+            ApiKind::Func => "func",
+            ApiKind::Method => "method",
+            ApiKind::Const => "const",
+        })
+    }
+}
+
+/// A top-level declaration of a Go file.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct ApiSymbol {
+    /// Kind of declaration
+    pub kind: ApiKind,
+    /// Declared name; methods are qualified by their receiver type
+    pub name: String,
+    /// 1-based line of the declaration
+    pub line: usize,
+    /// True if other packages can use the declaration
+    pub exported: bool,
+}
+
+/// Methods declared with a receiver type `T` or `*T`.
+#[derive(Default, Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct MethodSet {
+    /// Methods with a value receiver, the method set of `T`
+    pub value: usize,
+    /// Methods with a pointer receiver, which only `*T` has
+    pub pointer: usize,
+}
+
+impl GoStats {
+    /// Returns the fraction of functions with an `error` result, or `None`
+    /// if there are no functions.
+    pub fn error_return_ratio(&self) -> Option<f64> {
+        (self.functions > 0).then(|| self.error_returning as f64 / self.functions as f64)
+    }
+
+    /// Adds the counts of `other`. Method sets are not merged, as types of
+    /// the same name in different packages are different types.
+    pub(crate) fn merge(&mut self, other: &GoStats) {
+        self.goroutines += other.goroutines;
+        self.channel_sends += other.channel_sends;
+        self.channel_receives += other.channel_receives;
+        self.selects += other.selects;
+        self.defers += other.defers;
+        self.functions += other.functions;
+        self.error_returning += other.error_returning;
+        self.exported += other.exported;
+        self.unexported += other.unexported;
+    }
+
+    /// Returns the fraction of top-level declarations that are exported, or
+    /// `None` if there are none.
+    pub fn exported_ratio(&self) -> Option<f64> {
+        let total = self.exported + self.unexported;
+        (total > 0).then(|| self.exported as f64 / total as f64)
+    }
+}
+
+/// Collects the Go metrics of the tree rooted at `root`.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the tree parsed from `source`
+/// * `source` - The file's contents
+pub(crate) fn go_stats(root: &Node, source: &[u8]) -> GoStats {
+    let mut stats = GoStats::default();
+    collect(root, source, &mut stats);
+    api(root, source, &mut stats);
+    stats
+}
+
+/// Records the package name and top-level declarations of a file.
+fn api(root: &Node, source: &[u8], stats: &mut GoStats) {
+    let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+    let symbol = |kind, name: String, node: &Node, exported: bool| ApiSymbol {
+        kind,
+        name,
+        line: node.start_position().row + 1,
+        exported,
+    };
+
+    let mut cursor = root.walk();
+    for declaration in root.named_children(&mut cursor) {
+        match declaration.kind() {
+            "package_clause" => {
+                let mut inner = declaration.walk();
+                if let Some(name) = declaration
+                    .named_children(&mut inner)
+                    .find(|child| child.kind() == "package_identifier")
+                {
+                    stats.package = text(&name);
+                }
+            }
+            "function_declaration" => {
+                if let Some(name) = declaration.child_by_field_name("name") {
+                    let name_text = text(&name);
+                    let exported = is_exported(&name_text);
+                    stats
+                        .api
+                        .push(symbol(ApiKind::Func, name_text, &name, exported));
+                }
+            }
+            "method_declaration" => {
+                if let Some(name) = declaration.child_by_field_name("name") {
+                    let receiver = go_receiver_type(&declaration, source).unwrap_or_default();
+                    let name_text = text(&name);
+                    let exported = is_exported(&receiver) && is_exported(&name_text);
+                    stats.api.push(symbol(
+                        ApiKind::Method,
+                        format!("{receiver}.{name_text}"),
+                        &name,
+                        exported,
+                    ));
+                }
+            }
+            "type_declaration" | "const_declaration" => {
+                let (kind, specs): (_, &[&str]) = if declaration.kind() == "type_declaration" {
+                    (ApiKind::Type, &["type_spec", "type_alias"])
+                } else {
+                    (ApiKind::Const, &["const_spec"])
+                };
+                let mut inner = declaration.walk();
+                for spec in declaration
+                    .named_children(&mut inner)
+                    .filter(|child| specs.contains(&child.kind()))
+                {
+                    let mut names = spec.walk();
+                    for name in spec.children_by_field_name("name", &mut names) {
+                        let name_text = text(&name);
+                        let exported = is_exported(&name_text);
+                        stats.api.push(symbol(kind, name_text, &name, exported));
+                    }
+                }
+            }
+            _ => {}
+        }
+    }
+    stats.exported = stats.api.iter().filter(|symbol| symbol.exported).count();
+    stats.unexported = stats.api.len() - stats.exported;
+}
+
+/// Returns true if a Go identifier is exported, that is starts with an
+/// upper-case letter.
+fn is_exported(name: &str) -> bool {
+    name.chars().next().is_some_and(char::is_uppercase)
+}
+
+fn collect(node: &Node, source: &[u8], stats: &mut GoStats) {
+    match node.kind() {
+        "go_statement" => stats.goroutines += 1,
+        "send_statement" => stats.channel_sends += 1,
+        "select_statement" => stats.selects += 1,
+        "defer_statement" => stats.defers += 1,
+        "unary_expression" => {
+            if node
+                .child_by_field_name("operator")
+                .is_some_and(|operator| operator.kind() == "<-")
+            {
+                stats.channel_receives += 1;
+            }
+        }
+        "function_declaration" | "method_declaration" => {
+            stats.functions += 1;
+            if node
+                .child_by_field_name("result")
+                .is_some_and(|result| returns_error(&result, source))
+            {
+                stats.error_returning += 1;
+            }
+            if let Some((name, pointer)) = receiver_type(node, source) {
+                let set = stats.method_sets.entry(name).or_default();
+                if pointer {
+                    set.pointer += 1;
+                } else {
+                    set.value += 1;
+                }
+            }
+        }
+        _ => {}
+    }
+
+    let mut cursor = node.walk();
+    for child in node.named_children(&mut cursor) {
+        collect(&child, source, stats);
+    }
+}
+
+/// Returns true if a function's result, a single type or a parenthesized
+/// list, includes the `error` type.
+fn returns_error(result: &Node, source: &[u8]) -> bool {
+    let is_error = |node: &Node| {
+        node.kind() == "type_identifier" && node.utf8_text(source).unwrap_or_default() == "error"
+    };
+    if result.kind() != "parameter_list" {
+        return is_error(result);
+    }
+    let mut cursor = result.walk();
+    result
+        .named_children(&mut cursor)
+        .filter_map(|parameter| parameter.child_by_field_name("type"))
+        .any(|ty| is_error(&ty))
+}
+
+/// Returns the name of a method's receiver type, without type arguments,
+/// and whether it is a pointer receiver.
+fn receiver_type(method: &Node, source: &[u8]) -> Option<(String, bool)> {
+    let name = go_receiver_type(method, source)?;
+    let receiver = method.child_by_field_name("receiver")?;
+    let mut cursor = receiver.walk();
+    let pointer = receiver
+        .named_children(&mut cursor)
+        .filter_map(|parameter| parameter.child_by_field_name("type"))
+        .any(|ty| ty.kind() == "pointer_type");
+    Some((name, pointer))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::language::SupportedLanguage;
+    use crate::parser::create_parser;
+
+    fn stats(source: &str) -> GoStats {
+        let tree = create_parser(&SupportedLanguage::Go)
+            .unwrap()
+            .parse(source, None)
+            .unwrap();
+        go_stats(&tree.root_node(), source.as_bytes())
+    }
+
+    #[test]
+    fn test_go_stats_concurrency() {
+        let found = stats(
+            r#"package main
+
+func worker(jobs <-chan int, results chan<- int, done chan struct{}) {
+	defer close(results)
+	for {
+		select {
+		case j := <-jobs:
+			results <- j * 2
+		case <-done:
+			return
+		}
+	}
+}
+
+func main() {
+	go worker(nil, nil, nil)
+	go func() {}()
+}
+"#,
+        );
+        assert_eq!(found.goroutines, 2);
+        assert_eq!(found.channel_sends, 1);
+        // Channel types like `<-chan int` are not receives
+        assert_eq!(found.channel_receives, 2);
+        assert_eq!(found.selects, 1);
+        assert_eq!(found.defers, 1);
+        assert_eq!(found.functions, 2);
+        assert_eq!(found.error_returning, 0);
+    }
+
+    #[test]
+    fn test_go_stats_error_returns_and_method_sets() {
+        let found = stats(
+            r#"package cart
+
+type Cart struct{}
+
+func New() (*Cart, error) { return &Cart{}, nil }
+
+func (c Cart) Total() int { return 0 }
+
+func (c *Cart) Add(id string) error { return nil }
+
+func (c *Cart) Clear() {}
+
+func (s Stack[T]) Peek() (v T, err error) { return }
+"#,
+        );
+        assert_eq!(found.functions, 5);
+        assert_eq!(found.error_returning, 3);
+        assert_eq!(found.error_return_ratio(), Some(0.6));
+        assert_eq!(
+            found.method_sets["Cart"],
+            MethodSet {
+                value: 1,
+                pointer: 2
+            }
+        );
+        assert_eq!(
+            found.method_sets["Stack"],
+            MethodSet {
+                value: 1,
+                pointer: 0
+            }
+        );
+    }
+
+    #[test]
+    fn test_go_stats_api() {
+        let found = stats(
+            r#"package shop
+
+const (
+	MaxItems = 10
+	minItems = 1
+)
+
+type Cart struct{}
+
+type cache map[string]int
+
+func NewCart() *Cart { return &Cart{} }
+
+func (c *Cart) Add() {}
+
+func (c cache) Get() {}
+
+func init() {
+	const Local = 1
+}
+"#,
+        );
+        assert_eq!(found.package, "shop");
+        let exported: Vec<_> = found
+            .api
+            .iter()
+            .filter(|symbol| symbol.exported)
+            .map(|symbol| (symbol.kind, symbol.name.as_str()))
+            .collect();
+        assert_eq!(
+            exported,
+            vec![
+                (ApiKind::Const, "MaxItems"),
+                (ApiKind::Type, "Cart"),
+                (ApiKind::Func, "NewCart"),
+                (ApiKind::Method, "Cart.Add"),
+            ]
+        );
+        // An exported method of an unexported type is not part of the API,
+        // and constants in function bodies are not top-level declarations
+        assert_eq!(found.unexported, 4);
+        assert_eq!(found.exported_ratio(), Some(0.5));
+    }
+
+    #[test]
+    fn test_go_stats_merge_drops_method_sets() {
+        let mut total = GoStats::default();
+        assert_eq!(total.error_return_ratio(), None);
+        let file = GoStats {
+            goroutines: 2,
+            functions: 4,
+            error_returning: 1,
+            method_sets: BTreeMap::from([("Cart".to_string(), MethodSet::default())]),
+            ..Default::default()
+        };
+        total.merge(&file);
+        total.merge(&file);
+        assert_eq!(total.goroutines, 4);
+        assert_eq!(total.error_return_ratio(), Some(0.25));
+        assert!(total.method_sets.is_empty());
+    }
+}
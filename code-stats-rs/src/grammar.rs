@@ -0,0 +1,316 @@
+//! Tree-sitter grammars loaded at runtime from shared libraries.
+//!
+//! `--grammar-dir DIR` loads every `.so`, `.dylib`, and `.dll` file in `DIR`
+//! as a grammar, so languages that are not compiled in can still be analyzed.
+//! A library is named after its language: `dart.so`, `libtree-sitter-dart.so`,
+//! and `tree-sitter-dart.dylib` all provide `dart`, and must export the
+//! `tree_sitter_dart` function that `tree-sitter build` generates. Files with
+//! the language's name as extension (`.dart`) are analyzed with the grammar;
+//! `--lang-map` maps other files to it by name.
+//!
+//! Extractors registered for a language that is neither built in nor loaded
+//! supply its grammar instead, see `Extractor::grammar`.
+//!
+//! Loaded grammars live until the process exits: statistics refer to them by
+//! `SupportedLanguage::Dynamic`, which must stay valid wherever results are
+//! kept.
+
+use crate::error::{CodeStatsError, Result};
+use crate::language::SupportedLanguage;
+use libloading::{Library, Symbol};
+use std::cmp::Ordering;
+use std::hash::{Hash, Hasher};
+use std::path::{Path, PathBuf};
+use std::sync::RwLock;
+use tree_sitter::{Language, LanguageFn, Parser};
+
+/// File extensions of shared libraries on the supported platforms.
+const LIBRARY_EXTENSIONS: [&str; 3] = ["so", "dylib", "dll"];
+
+/// Grammars loaded so far, in loading order.
+static GRAMMARS: RwLock<Vec<&'static DynamicGrammar>> = RwLock::new(Vec::new());
+
+/// A grammar loaded from a shared library or supplied by an extractor.
+///
+/// Grammars are compared, ordered, and hashed by name, as no two loaded
+/// grammars share one.
+pub struct DynamicGrammar {
+    name: String,
+    path: Option<PathBuf>,
+    language: Language,
+    /// Extensions of the files parsed with the grammar
+    extensions: Vec<String>,
+    /// Keeps the code `language` points into loaded
+    _library: Option<Library>,
+}
+
+impl DynamicGrammar {
+    /// Name of the language, as derived from the library's file name.
+    pub fn name(&self) -> &str {
+        &self.name
+    }
+
+    /// Path of the shared library the grammar was loaded from, `None` for a
+    /// grammar an extractor supplies.
+    pub fn path(&self) -> Option<&Path> {
+        self.path.as_deref()
+    }
+
+    /// The grammar, ready to be set on a parser.
+    pub(crate) fn language(&self) -> Language {
+        self.language.clone()
+    }
+}
+
+impl std::fmt::Debug for DynamicGrammar {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.debug_struct("DynamicGrammar")
+            .field("name", &self.name)
+            .field("path", &self.path)
+            .finish()
+    }
+}
+
+impl PartialEq for DynamicGrammar {
+    fn eq(&self, other: &Self) -> bool {
+        self.name == other.name
+    }
+}
+
+impl Eq for DynamicGrammar {}
+
+impl PartialOrd for DynamicGrammar {
+    fn partial_cmp(&self, other: &Self) -> Option<Ordering> {
+        Some(self.cmp(other))
+    }
+}
+
+impl Ord for DynamicGrammar {
+    fn cmp(&self, other: &Self) -> Ordering {
+        self.name.cmp(&other.name)
+    }
+}
+
+impl Hash for DynamicGrammar {
+    fn hash<H: Hasher>(&self, state: &mut H) {
+        self.name.hash(state);
+    }
+}
+
+/// Loads every shared library in `dir` as a grammar.
+///
+/// Libraries are loaded in file name order; one that is already loaded is
+/// not loaded again.
+///
+/// # Arguments
+///
+/// * `dir` - Directory containing `.so`, `.dylib`, or `.dll` grammars
+///
+/// # Returns
+///
+/// * `Ok(Vec<SupportedLanguage>)` - The languages the directory provides
+/// * `Err(IoError)` - The directory can't be read
+/// * `Err(GrammarError)` - A library can't be loaded as a grammar
+pub fn load_grammar_dir(dir: &Path) -> Result<Vec<SupportedLanguage>> {
+    let entries = std::fs::read_dir(dir)
+        .map_err(|e| CodeStatsError::IoError(format!("Failed to read {}: {e}", dir.display())))?;
+    let mut libraries: Vec<PathBuf> = entries
+        .filter_map(|entry| entry.ok().map(|entry| entry.path()))
+        .filter(|path| {
+            path.extension()
+                .and_then(|ext| ext.to_str())
+                .is_some_and(|ext| LIBRARY_EXTENSIONS.contains(&ext))
+        })
+        .collect();
+    libraries.sort();
+
+    libraries.iter().map(|path| load_grammar(path)).collect()
+}
+
+/// Loads the grammar in the shared library at `path`.
+///
+/// # Returns
+///
+/// * `Ok(SupportedLanguage::Dynamic)` - The loaded grammar, or the one
+///   already loaded under the same name
+/// * `Err(GrammarError)` - The library can't be loaded, lacks the grammar's
+///   function, has an incompatible ABI version, or is named like a built-in
+///   language
+pub fn load_grammar(path: &Path) -> Result<SupportedLanguage> {
+    let invalid =
+        |message: String| CodeStatsError::GrammarError(format!("{}: {message}", path.display()));
+
+    let stem = path
+        .file_stem()
+        .and_then(|stem| stem.to_str())
+        .ok_or_else(|| invalid("file name is not valid UTF-8".to_string()))?;
+    let name = grammar_name(stem);
+    if let Some(language) = SupportedLanguage::from_name(&name) {
+        return match language {
+            SupportedLanguage::Dynamic(_) => Ok(language),
+            _ => Err(invalid(format!(
+                "'{name}' is a built-in language and can't be replaced"
+            ))),
+        };
+    }
+
+    // SAFETY: loading a library runs its initializers; grammar libraries
+    // generated by tree-sitter have none beyond the C runtime's
+    let library = unsafe { Library::new(path) }.map_err(|e| invalid(e.to_string()))?;
+    let symbol = format!("tree_sitter_{}", name.replace('-', "_"));
+    // SAFETY: the standard grammar ABI declares this function as
+    // `const TSLanguage *tree_sitter_<name>(void)`
+    let language: Language = unsafe {
+        let constructor: Symbol<unsafe extern "C" fn() -> *const ()> = library
+            .get(symbol.as_bytes())
+            .map_err(|_| invalid(format!("does not export `{symbol}`")))?;
+        LanguageFn::from_raw(*constructor).into()
+    };
+    check_abi(&language).map_err(invalid)?;
+
+    Ok(register(DynamicGrammar {
+        extensions: vec![name.clone()],
+        name,
+        path: Some(path.to_path_buf()),
+        language,
+        _library: Some(library),
+    }))
+}
+
+/// Adds the grammar an extractor supplies for the language `name`.
+///
+/// # Arguments
+///
+/// * `name` - Name of the language, which must not be a built-in or loaded one
+/// * `language` - The grammar, usually from the language's tree-sitter crate
+/// * `extensions` - Extensions of the files to parse with it, without the `.`
+///
+/// # Returns
+///
+/// * `Ok(SupportedLanguage::Dynamic)` - The added grammar
+/// * `Err(GrammarError)` - The grammar has an incompatible ABI version
+pub(crate) fn define_grammar(
+    name: &str,
+    language: Language,
+    extensions: Vec<String>,
+) -> Result<SupportedLanguage> {
+    check_abi(&language)
+        .map_err(|message| CodeStatsError::GrammarError(format!("grammar '{name}': {message}")))?;
+    Ok(register(DynamicGrammar {
+        name: name.to_ascii_lowercase(),
+        path: None,
+        language,
+        extensions: extensions
+            .iter()
+            .map(|ext| ext.trim_start_matches('.').to_ascii_lowercase())
+            .collect(),
+        _library: None,
+    }))
+}
+
+/// Returns an error message if parsers can't use `language`.
+fn check_abi(language: &Language) -> std::result::Result<(), String> {
+    Parser::new().set_language(language).map_err(|_| {
+        format!(
+            "grammar ABI version {} is not supported (expected {} to {})",
+            language.abi_version(),
+            tree_sitter::MIN_COMPATIBLE_LANGUAGE_VERSION,
+            tree_sitter::LANGUAGE_VERSION
+        )
+    })
+}
+
+/// Keeps `grammar` until the process exits, see the module documentation.
+fn register(grammar: DynamicGrammar) -> SupportedLanguage {
+    let grammar: &'static DynamicGrammar = Box::leak(Box::new(grammar));
+    GRAMMARS.write().unwrap().push(grammar);
+    SupportedLanguage::Dynamic(grammar)
+}
+
+/// Returns the loaded grammars, in loading order.
+pub(crate) fn loaded() -> Vec<SupportedLanguage> {
+    GRAMMARS
+        .read()
+        .unwrap()
+        .iter()
+        .map(|grammar| SupportedLanguage::Dynamic(grammar))
+        .collect()
+}
+
+/// Returns the loaded grammar called `name`, case-insensitively.
+pub(crate) fn find(name: &str) -> Option<SupportedLanguage> {
+    GRAMMARS
+        .read()
+        .unwrap()
+        .iter()
+        .find(|grammar| grammar.name.eq_ignore_ascii_case(name))
+        .map(|grammar| SupportedLanguage::Dynamic(grammar))
+}
+
+/// Returns the loaded grammar for files with extension `ext`: the grammar's
+/// name, or one of the extensions its extractor lists.
+pub(crate) fn for_extension(ext: &str) -> Option<SupportedLanguage> {
+    GRAMMARS
+        .read()
+        .unwrap()
+        .iter()
+        .find(|grammar| {
+            grammar
+                .extensions
+                .iter()
+                .any(|extension| extension.eq_ignore_ascii_case(ext))
+        })
+        .map(|grammar| SupportedLanguage::Dynamic(grammar))
+}
+
+/// Derives a language name from a library's file stem, stripping the `lib`
+/// and `tree-sitter-` prefixes (`libtree-sitter-dart` is `dart`).
+fn grammar_name(stem: &str) -> String {
+    let stem = stem.strip_prefix("lib").unwrap_or(stem);
+    let stem = stem
+        .strip_prefix("tree-sitter-")
+        .or_else(|| stem.strip_prefix("tree_sitter_"))
+        .unwrap_or(stem);
+    stem.to_ascii_lowercase()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_grammar_name() {
+        assert_eq!(grammar_name("dart"), "dart");
+        assert_eq!(grammar_name("libtree-sitter-dart"), "dart");
+        assert_eq!(grammar_name("tree-sitter-gleam"), "gleam");
+        assert_eq!(grammar_name("libtree_sitter_Elixir"), "elixir");
+        assert_eq!(
+            grammar_name("tree-sitter-embedded-template"),
+            "embedded-template"
+        );
+    }
+
+    #[test]
+    fn test_load_grammar_rejects_builtin_names_and_invalid_libraries() {
+        let temp_dir = TempDir::new().unwrap();
+        let rust = temp_dir.path().join("libtree-sitter-rust.so");
+        std::fs::write(&rust, "not a library").unwrap();
+        let err = load_grammar(&rust).unwrap_err();
+        assert!(err.to_string().contains("'rust' is a built-in language"));
+
+        let dart = temp_dir.path().join("dart.so");
+        std::fs::write(&dart, "not a library").unwrap();
+        let err = load_grammar_dir(temp_dir.path()).unwrap_err();
+        assert!(matches!(err, CodeStatsError::GrammarError(_)));
+        assert!(find("dart").is_none());
+    }
+
+    #[test]
+    fn test_load_grammar_dir_ignores_other_files() {
+        let temp_dir = TempDir::new().unwrap();
+        std::fs::write(temp_dir.path().join("README.md"), "# Grammars").unwrap();
+        assert!(load_grammar_dir(temp_dir.path()).unwrap().is_empty());
+        assert!(load_grammar_dir(&temp_dir.path().join("missing")).is_err());
+    }
+}
@@ -0,0 +1,511 @@
+//! Types, fields, and operations of GraphQL schemas and documents.
+//!
+//! A schema is often split over many files, with the root types extended in
+//! each of them (`extend type Query { ... }`). Every file records the types
+//! it defines or extends with their fields, and `schema` assembles them into
+//! one inventory of the whole schema, listing each type once with the files
+//! contributing to it. Operations (`query`, `mutation`, `subscription`) and
+//! fragments are counted per file; in the syntax tree they are the
+//! functions of a GraphQL document, with the `@include` and `@skip`
+//! directives of their selections as decision points.
+
+use crate::parser::child_of_kind;
+use crate::stats::DirectoryStats;
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::path::Path;
+use tree_sitter::Node;
+
+/// Type definition node kinds with the keyword they are declared with.
+const TYPE_KINDS: [(&str, &str); 6] = [
+    ("object_type", "type"),
+    ("interface_type", "interface"),
+    ("input_object_type", "input"),
+    ("enum_type", "enum"),
+    ("union_type", "union"),
+    ("scalar_type", "scalar"),
+];
+
+/// Counts of a GraphQL file's definitions.
+#[derive(Default, Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct GraphqlStats {
+    /// Number of type definitions, extensions not included
+    pub types: usize,
+    /// Number of fields of object, interface, and input types, extensions
+    /// included
+    pub fields: usize,
+    /// Number of query operations, anonymous `{ ... }` operations included
+    pub queries: usize,
+    /// Number of mutation operations
+    pub mutations: usize,
+    /// Number of subscription operations
+    pub subscriptions: usize,
+    /// Number of fragment definitions
+    pub fragments: usize,
+}
+
+impl GraphqlStats {
+    /// Adds all counts from `other` into this instance.
+    pub(crate) fn merge(&mut self, other: &GraphqlStats) {
+        self.types += other.types;
+        self.fields += other.fields;
+        self.queries += other.queries;
+        self.mutations += other.mutations;
+        self.subscriptions += other.subscriptions;
+        self.fragments += other.fragments;
+    }
+}
+
+/// A type defined or extended in a GraphQL file.
+#[derive(Default, Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct SchemaType {
+    /// Type name
+    pub name: String,
+    /// Keyword of the definition: `type`, `interface`, `input`, `enum`,
+    /// `union`, or `scalar`
+    pub kind: String,
+    /// True for an `extend` of a type defined elsewhere
+    #[serde(default, skip_serializing_if = "std::ops::Not::not")]
+    pub extension: bool,
+    /// Interfaces named after `implements`
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub interfaces: Vec<String>,
+    /// Fields, enum values, or union members, in source order
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub fields: Vec<SchemaField>,
+    /// 1-based line where the definition starts
+    pub line: usize,
+}
+
+/// A field of a schema type, or a value of an enum or member of a union.
+#[derive(Default, Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct SchemaField {
+    /// Field name
+    pub name: String,
+    /// The field as declared, without description and directives, e.g.
+    /// `cart(id: ID!): Cart`; the name alone for enum values and union
+    /// members
+    pub signature: String,
+    /// 1-based line where the field is declared
+    pub line: usize,
+}
+
+/// A type of the assembled schema with the files defining and extending it.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct SchemaEntry<'a> {
+    pub name: &'a str,
+    pub kind: &'a str,
+    /// False if the type is only extended in the analyzed files
+    pub defined: bool,
+    /// Files and lines of the definition and extensions, the definition first
+    pub locations: Vec<SchemaLocation<'a>>,
+    pub interfaces: Vec<&'a str>,
+    pub fields: Vec<&'a SchemaField>,
+}
+
+/// A definition or extension of a schema type.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+pub(crate) struct SchemaLocation<'a> {
+    pub path: &'a Path,
+    pub line: usize,
+}
+
+/// Counts the definitions of a GraphQL file and lists its schema types.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the tree parsed from `source`
+/// * `source` - The file's contents
+///
+/// # Returns
+///
+/// The counts and the types defined or extended, in source order.
+pub(crate) fn graphql_stats(root: &Node, source: &[u8]) -> (GraphqlStats, Vec<SchemaType>) {
+    let mut stats = GraphqlStats::default();
+    let mut types = Vec::new();
+    let mut stack = vec![*root];
+    while let Some(node) = stack.pop() {
+        match node.kind() {
+            "operation_definition" => {
+                match operation_type(&node, source) {
+                    "mutation" => stats.mutations += 1,
+                    "subscription" => stats.subscriptions += 1,
+                    _ => stats.queries += 1,
+                }
+                continue;
+            }
+            "fragment_definition" => {
+                stats.fragments += 1;
+                continue;
+            }
+            kind => {
+                if let Some(schema_type) = schema_type(&node, kind, source) {
+                    if !schema_type.extension {
+                        stats.types += 1;
+                    }
+                    if matches!(schema_type.kind.as_str(), "type" | "interface" | "input") {
+                        stats.fields += schema_type.fields.len();
+                    }
+                    types.push(schema_type);
+                    continue;
+                }
+            }
+        }
+        let mut cursor = node.walk();
+        let children: Vec<Node> = node.named_children(&mut cursor).collect();
+        stack.extend(children.into_iter().rev());
+    }
+    (stats, types)
+}
+
+/// Assembles the schema types of all analyzed GraphQL files, merging the
+/// definition and the extensions of each type.
+///
+/// Types are ordered by the location of their definition, or of their first
+/// extension for types only extended, and fields by the order of the
+/// locations.
+pub(crate) fn schema(stats: &DirectoryStats) -> Vec<SchemaEntry<'_>> {
+    let mut found: Vec<(SchemaLocation, &SchemaType)> = stats
+        .files
+        .iter()
+        .flat_map(|file| {
+            file.stats.schema.iter().map(|schema_type| {
+                let location = SchemaLocation {
+                    path: &file.path,
+                    line: schema_type.line,
+                };
+                (location, schema_type)
+            })
+        })
+        .collect();
+    // Definitions before extensions, then by file and line
+    found.sort_by(|(a, a_type), (b, b_type)| {
+        (a_type.extension, a.path, a.line).cmp(&(b_type.extension, b.path, b.line))
+    });
+
+    let mut entries: Vec<SchemaEntry> = Vec::new();
+    let mut index: HashMap<&str, usize> = HashMap::new();
+    for (location, schema_type) in found {
+        let position = *index.entry(&schema_type.name).or_insert_with(|| {
+            entries.push(SchemaEntry {
+                name: &schema_type.name,
+                kind: &schema_type.kind,
+                defined: !schema_type.extension,
+                locations: Vec::new(),
+                interfaces: Vec::new(),
+                fields: Vec::new(),
+            });
+            entries.len() - 1
+        });
+        let entry = &mut entries[position];
+        entry.locations.push(location);
+        for interface in &schema_type.interfaces {
+            if !entry.interfaces.contains(&interface.as_str()) {
+                entry.interfaces.push(interface);
+            }
+        }
+        entry.fields.extend(&schema_type.fields);
+    }
+    entries.sort_by_key(|entry| (entry.locations[0].path, entry.locations[0].line));
+    entries
+}
+
+/// Returns the name node of a type definition or extension, an operation,
+/// or a fragment, as the grammar has no `name` field.
+pub(crate) fn graphql_name<'a>(node: &Node<'a>) -> Option<Node<'a>> {
+    let name = child_of_kind(node, "fragment_name").unwrap_or(*node);
+    child_of_kind(&name, "name")
+}
+
+/// Returns the keyword of a type definition node kind, as in `input` for
+/// `input_object_type_definition`, or `None` for other kinds, extensions
+/// included.
+pub(crate) fn type_keyword(kind: &str) -> Option<&'static str> {
+    let base = kind.strip_suffix("_definition")?;
+    TYPE_KINDS
+        .iter()
+        .find(|(name, _)| *name == base)
+        .map(|(_, keyword)| *keyword)
+}
+
+/// Counts the fields and implemented interfaces of an object, interface, or
+/// input type definition; enums and unions have neither.
+pub(crate) fn type_members(node: &Node, source: &[u8]) -> (usize, usize) {
+    match schema_type(node, node.kind(), source) {
+        Some(schema_type)
+            if matches!(schema_type.kind.as_str(), "type" | "interface" | "input") =>
+        {
+            (schema_type.fields.len(), schema_type.interfaces.len())
+        }
+        _ => (0, 0),
+    }
+}
+
+/// Counts the variables an operation declares, its parameters.
+pub(crate) fn variable_count(node: &Node) -> usize {
+    child_of_kind(node, "variable_definitions").map_or(0, |variables| {
+        let mut cursor = variables.walk();
+        variables
+            .named_children(&mut cursor)
+            .filter(|child| child.kind() == "variable_definition")
+            .count()
+    })
+}
+
+/// Returns true if `node` is an `@include` or `@skip` directive, which makes
+/// a selection conditional.
+pub(crate) fn is_conditional_directive(node: &Node, source: &[u8]) -> bool {
+    node.kind() == "directive"
+        && graphql_name(node)
+            .and_then(|name| name.utf8_text(source).ok())
+            .is_some_and(|name| matches!(name, "include" | "skip"))
+}
+
+/// Returns the keyword of an operation, `query` for the anonymous shorthand.
+pub(crate) fn operation_type(node: &Node, source: &[u8]) -> &'static str {
+    let keyword =
+        child_of_kind(node, "operation_type").and_then(|keyword| keyword.utf8_text(source).ok());
+    match keyword {
+        Some("mutation") => "mutation",
+        Some("subscription") => "subscription",
+        _ => "query",
+    }
+}
+
+/// Reads a type definition or extension, or returns `None` for other nodes.
+fn schema_type(node: &Node, kind: &str, source: &[u8]) -> Option<SchemaType> {
+    let (base, extension) = match kind.strip_suffix("_extension") {
+        Some(base) => (base, true),
+        None => (kind.strip_suffix("_definition")?, false),
+    };
+    let (_, keyword) = TYPE_KINDS.iter().find(|(name, _)| *name == base)?;
+    let text = |node: Node| node.utf8_text(source).unwrap_or_default().to_string();
+
+    let mut interfaces = Vec::new();
+    let mut fields = Vec::new();
+    let mut stack = vec![*node];
+    while let Some(current) = stack.pop() {
+        match current.kind() {
+            "named_type"
+                if current
+                    .parent()
+                    .is_some_and(|parent| parent.kind() == "implements_interfaces") =>
+            {
+                interfaces.push(text(current));
+                continue;
+            }
+            "named_type"
+                if current
+                    .parent()
+                    .is_some_and(|parent| parent.kind() == "union_member_types") =>
+            {
+                fields.push(SchemaField {
+                    name: text(current),
+                    signature: text(current),
+                    line: current.start_position().row + 1,
+                });
+                continue;
+            }
+            "field_definition" | "input_value_definition" | "enum_value_definition" => {
+                fields.push(field(&current, source));
+                continue;
+            }
+            _ => {}
+        }
+        let mut cursor = current.walk();
+        let children: Vec<Node> = current.named_children(&mut cursor).collect();
+        stack.extend(children.into_iter().rev());
+    }
+
+    Some(SchemaType {
+        name: graphql_name(node).map(text).unwrap_or_default(),
+        kind: keyword.to_string(),
+        extension,
+        interfaces,
+        fields,
+        line: node.start_position().row + 1,
+    })
+}
+
+/// Reads a field, input field, or enum value with its declaration.
+fn field(node: &Node, source: &[u8]) -> SchemaField {
+    let text = |node: &Node| node.utf8_text(source).unwrap_or_default();
+    let mut name = String::new();
+    let mut signature = String::new();
+    let mut cursor = node.walk();
+    for child in node.named_children(&mut cursor) {
+        match child.kind() {
+            "name" | "enum_value" => {
+                name = text(&child).to_string();
+                signature.push_str(&name);
+            }
+            // Arguments may span lines
+            "arguments_definition" => {
+                signature.push_str(
+                    &text(&child)
+                        .split_whitespace()
+                        .collect::<Vec<_>>()
+                        .join(" "),
+                );
+            }
+            "type" => {
+                signature.push_str(": ");
+                signature.push_str(text(&child));
+            }
+            "default_value" => {
+                signature.push(' ');
+                signature.push_str(text(&child));
+            }
+            _ => {}
+        }
+    }
+    SchemaField {
+        name,
+        signature,
+        line: node.start_position().row + 1,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::language::SupportedLanguage;
+    use crate::parser::{CodeStats, create_parser};
+    use crate::stats::FileStats;
+    use std::path::PathBuf;
+
+    fn analyze(source: &str) -> (GraphqlStats, Vec<SchemaType>) {
+        let tree = create_parser(&SupportedLanguage::Graphql)
+            .unwrap()
+            .parse(source, None)
+            .unwrap();
+        graphql_stats(&tree.root_node(), source.as_bytes())
+    }
+
+    #[test]
+    fn test_graphql_stats() {
+        let source = r#""A shopping cart."
+type Cart implements Node & Priced {
+  id: ID!
+  items(first: Int = 10, after: String): [Item!]!
+  total: Money
+}
+
+input ItemInput {
+  sku: String!
+  quantity: Int = 1
+}
+
+enum Status { OPEN CLOSED }
+
+union SearchResult = Cart | Item
+
+extend type Query {
+  cart(id: ID!): Cart
+}
+
+query GetCart($id: ID!) {
+  cart(id: $id) { ...CartFields }
+}
+
+mutation { checkout { id } }
+
+fragment CartFields on Cart { id total }
+"#;
+        let (stats, types) = analyze(source);
+        assert_eq!(
+            stats,
+            GraphqlStats {
+                types: 4,
+                fields: 6,
+                queries: 1,
+                mutations: 1,
+                subscriptions: 0,
+                fragments: 1,
+            }
+        );
+
+        let names: Vec<_> = types
+            .iter()
+            .map(|t| (t.kind.as_str(), t.name.as_str()))
+            .collect();
+        assert_eq!(
+            names,
+            [
+                ("type", "Cart"),
+                ("input", "ItemInput"),
+                ("enum", "Status"),
+                ("union", "SearchResult"),
+                ("type", "Query"),
+            ]
+        );
+        assert_eq!(types[0].interfaces, ["Node", "Priced"]);
+        assert_eq!(types[0].line, 2);
+        assert_eq!(
+            types[0].fields[1].signature,
+            "items(first: Int = 10, after: String): [Item!]!"
+        );
+        assert_eq!(types[1].fields[1].signature, "quantity: Int = 1");
+        assert_eq!(types[2].fields[1].signature, "CLOSED");
+        assert_eq!(types[3].fields[0].name, "Cart");
+        assert!(types[4].extension);
+    }
+
+    #[test]
+    fn test_schema_merges_extensions() {
+        let file = |path: &str, schema| FileStats {
+            path: PathBuf::from(path),
+            language: SupportedLanguage::Graphql,
+            stats: CodeStats {
+                schema,
+                ..Default::default()
+            },
+        };
+        let field = |name: &str, line| SchemaField {
+            name: name.to_string(),
+            signature: format!("{name}: String"),
+            line,
+        };
+        let query = |extension, fields, line| SchemaType {
+            name: "Query".to_string(),
+            kind: "type".to_string(),
+            extension,
+            interfaces: Vec::new(),
+            fields,
+            line,
+        };
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file(
+            "schema/cart.graphql",
+            vec![
+                SchemaType {
+                    name: "Cart".to_string(),
+                    kind: "type".to_string(),
+                    fields: vec![field("id", 2)],
+                    line: 1,
+                    ..Default::default()
+                },
+                query(true, vec![field("cart", 6)], 5),
+            ],
+        ));
+        stats.add_file(file(
+            "schema/schema.graphql",
+            vec![query(false, vec![field("version", 2)], 1)],
+        ));
+
+        let entries = schema(&stats);
+        let names: Vec<_> = entries.iter().map(|entry| entry.name).collect();
+        assert_eq!(names, ["Cart", "Query"]);
+        let query = &entries[1];
+        assert!(query.defined);
+        // The definition comes first, then the extensions
+        assert_eq!(query.locations[0].path, Path::new("schema/schema.graphql"));
+        assert_eq!(query.locations[1].line, 5);
+        let fields: Vec<_> = query
+            .fields
+            .iter()
+            .map(|field| field.name.as_str())
+            .collect();
+        assert_eq!(fields, ["version", "cart"]);
+    }
+}
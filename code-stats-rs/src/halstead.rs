@@ -0,0 +1,180 @@
+//! Halstead metrics and the maintainability index of functions.
+//!
+//! Every token of a function is an operator or an operand. Named leaves of
+//! the syntax tree (identifiers, numbers, `true`, type names) and whole
+//! string and character literals are operands; anonymous leaves (keywords,
+//! operators, and punctuation) are operators, except closing brackets, which
+//! are counted with their opening one. Comments are not tokens.
+//!
+//! From the distinct (`n1`, `n2`) and total (`N1`, `N2`) operator and operand
+//! counts:
+//!
+//! - volume `V = (N1 + N2) * log2(n1 + n2)`
+//! - difficulty `D = n1 / 2 * N2 / n2`
+//! - effort `E = D * V`
+//!
+//! The maintainability index combines volume with cyclomatic complexity `G`
+//! and line count `LOC` as in its original definition,
+//! `171 - 5.2 * ln(V) - 0.23 * G - 16.2 * ln(LOC)`, without the 0-100
+//! rescaling some tools apply (`max(0, MI * 100 / 171)`).
+
+use crate::comments::is_comment;
+use serde::{Deserialize, Serialize};
+use std::collections::HashSet;
+use tree_sitter::Node;
+
+/// Operator and operand counts of a function, with the metrics derived from
+/// them.
+#[derive(Default, Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct Halstead {
+    /// Number of distinct operators (`n1`)
+    pub distinct_operators: usize,
+    /// Number of distinct operands (`n2`)
+    pub distinct_operands: usize,
+    /// Number of operator occurrences (`N1`)
+    pub operators: usize,
+    /// Number of operand occurrences (`N2`)
+    pub operands: usize,
+    /// Program volume in bits
+    pub volume: f64,
+    /// How hard the code is to write or understand
+    pub difficulty: f64,
+    /// Mental effort to write or understand the code
+    pub effort: f64,
+}
+
+impl Halstead {
+    /// Derives volume, difficulty, and effort from the token counts.
+    pub(crate) fn new(
+        distinct_operators: usize,
+        distinct_operands: usize,
+        operators: usize,
+        operands: usize,
+    ) -> Self {
+        let vocabulary = distinct_operators + distinct_operands;
+        let volume = if vocabulary == 0 {
+            0.0
+        } else {
+            (operators + operands) as f64 * (vocabulary as f64).log2()
+        };
+        let difficulty = if distinct_operands == 0 {
+            0.0
+        } else {
+            distinct_operators as f64 / 2.0 * operands as f64 / distinct_operands as f64
+        };
+        Self {
+            distinct_operators,
+            distinct_operands,
+            operators,
+            operands,
+            volume,
+            difficulty,
+            effort: difficulty * volume,
+        }
+    }
+}
+
+/// Counts the operators and operands of a function.
+///
+/// # Arguments
+///
+/// * `function` - The function node
+/// * `source` - The source code the tree was parsed from
+pub(crate) fn halstead(function: &Node, source: &[u8]) -> Halstead {
+    let mut operators = HashSet::new();
+    let mut operands = HashSet::new();
+    let (mut operator_count, mut operand_count) = (0, 0);
+    let mut stack = vec![*function];
+    while let Some(node) = stack.pop() {
+        if is_comment(&node) {
+            continue;
+        }
+        let text = &source[node.byte_range()];
+        if is_literal(node.kind()) || (node.child_count() == 0 && node.is_named()) {
+            if !text.is_empty() {
+                operands.insert(text);
+                operand_count += 1;
+            }
+        } else if node.child_count() == 0 {
+            if !text.is_empty() && !matches!(text, b")" | b"]" | b"}") {
+                operators.insert(text);
+                operator_count += 1;
+            }
+        } else {
+            let mut cursor = node.walk();
+            stack.extend(node.children(&mut cursor));
+        }
+    }
+    Halstead::new(
+        operators.len(),
+        operands.len(),
+        operator_count,
+        operand_count,
+    )
+}
+
+/// Returns true for string and character literals, which are one operand
+/// however many tokens the grammar splits them into.
+fn is_literal(kind: &str) -> bool {
+    kind.contains("string") || matches!(kind, "char_literal" | "character_literal")
+}
+
+/// Computes the maintainability index of a function, see the module
+/// documentation. Empty functions count as having a volume of 1.
+///
+/// # Arguments
+///
+/// * `volume` - Halstead volume
+/// * `complexity` - Cyclomatic complexity
+/// * `lines` - Number of lines spanned
+pub(crate) fn maintainability_index(volume: f64, complexity: usize, lines: usize) -> f64 {
+    171.0
+        - 5.2 * volume.max(1.0).ln()
+        - 0.23 * complexity as f64
+        - 16.2 * (lines.max(1) as f64).ln()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::language::SupportedLanguage;
+    use crate::parser::create_parser;
+
+    #[test]
+    fn test_halstead_derived_metrics() {
+        // n1 = 4, n2 = 4, N1 = 8, N2 = 8
+        let metrics = Halstead::new(4, 4, 8, 8);
+        assert_eq!(metrics.volume, 48.0);
+        assert_eq!(metrics.difficulty, 4.0);
+        assert_eq!(metrics.effort, 192.0);
+
+        let empty = Halstead::new(0, 0, 0, 0);
+        assert_eq!(
+            (empty.volume, empty.difficulty, empty.effort),
+            (0.0, 0.0, 0.0)
+        );
+    }
+
+    #[test]
+    fn test_maintainability_index() {
+        assert_eq!(maintainability_index(0.0, 0, 1), 171.0);
+        let index = maintainability_index(100.0, 3, 10);
+        assert!((index - 109.06).abs() < 0.01, "{index}");
+        // More code and more branches make it lower
+        assert!(maintainability_index(1000.0, 10, 60) < index);
+    }
+
+    #[test]
+    fn test_halstead_counts_tokens() {
+        let source = "fn add(a: i32, b: i32) -> i32 {\n    // sum\n    a + b\n}\n";
+        let mut parser = create_parser(&SupportedLanguage::Rust).unwrap();
+        let tree = parser.parse(source, None).unwrap();
+        let root = tree.root_node();
+        let function = root.named_children(&mut root.walk()).next().unwrap();
+        let metrics = halstead(&function, source.as_bytes());
+        // Operators: fn ( : , : -> { + (`:` twice)
+        assert_eq!((metrics.distinct_operators, metrics.operators), (7, 8));
+        // Operands: add a i32 b i32 i32 a b
+        assert_eq!((metrics.distinct_operands, metrics.operands), (4, 8));
+    }
+}
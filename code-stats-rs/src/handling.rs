@@ -0,0 +1,538 @@
+//! Error-handling constructs, panics, and assertions in Go, JavaScript,
+//! TypeScript, Python, and Rust.
+//!
+//! Every function gets four counts:
+//!
+//! - checks: constructs that handle or propagate an error. These are Go `if`
+//!   statements comparing an `err` variable to `nil` (`err`, `readErr`, ...),
+//!   `try` statements with an `except` or `catch` clause, JavaScript
+//!   `.catch()` calls, and Rust's `?` operator.
+//! - fallible calls: calls that can fail. In Go these are calls whose results
+//!   are assigned to an `err` variable. In Rust they are calls followed by
+//!   `?`, `.unwrap()`, or `.expect()`. In Python and JavaScript they are the
+//!   calls of a fixed list of APIs that raise on bad input or I/O errors:
+//!   `open`, `json.load(s)`, `subprocess` and `requests` calls, `JSON.parse`,
+//!   `fetch`, and the synchronous `fs` functions.
+//! - panics: `.unwrap()` and `.expect()` calls and the `panic!`, `todo!`,
+//!   `unimplemented!`, and `unreachable!` macros in Rust, and `panic` and
+//!   `log.Fatal`/`log.Panic` calls in Go.
+//! - assertions: Rust `assert!` macros and their `debug_` forms, Python
+//!   `assert` statements, and JavaScript `assert` and `console.assert` calls.
+//!
+//! A function with fallible calls and no check is unhandled: its errors
+//! either abort the program or are dropped. Constructs inside nested
+//! functions count for those, as with complexity.
+
+use crate::calls::{callee, last_segment};
+use crate::complexity::is_function;
+use crate::language::SupportedLanguage;
+use crate::parser::FunctionStats;
+use serde::{Deserialize, Serialize};
+use tree_sitter::Node;
+
+/// Python calls that raise on I/O errors or malformed input.
+const PYTHON_FALLIBLE: &[&str] = &[
+    "open",
+    "json.load",
+    "json.loads",
+    "subprocess.run",
+    "subprocess.check_call",
+    "subprocess.check_output",
+    "urlopen",
+    "urllib.request.urlopen",
+];
+
+/// Rust macros that abort the program.
+const RUST_PANICS: &[&str] = &["panic", "todo", "unimplemented", "unreachable"];
+
+/// Rust assertion macros.
+const RUST_ASSERTIONS: &[&str] = &[
+    "assert",
+    "assert_eq",
+    "assert_ne",
+    "debug_assert",
+    "debug_assert_eq",
+    "debug_assert_ne",
+];
+
+/// Error-handling counts of a function.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct ErrorHandling {
+    /// Error checks, `try` statements with handlers, and `?` operators
+    pub checks: usize,
+    /// Calls that can fail
+    pub fallible_calls: usize,
+    /// Calls and macros that abort the program
+    pub panics: usize,
+    /// Assertion statements, calls, and macros
+    pub assertions: usize,
+}
+
+impl ErrorHandling {
+    /// Returns true if no construct was found.
+    pub(crate) fn is_empty(&self) -> bool {
+        *self == Self::default()
+    }
+
+    /// Returns true if the function calls fallible APIs without handling
+    /// any error.
+    pub(crate) fn is_unhandled(&self) -> bool {
+        self.fallible_calls > 0 && self.checks == 0
+    }
+}
+
+/// Error-handling counts of a file or a group of files.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct ErrorHandlingStats {
+    /// Counts of the whole file, top-level code included
+    #[serde(flatten)]
+    pub counts: ErrorHandling,
+    /// Number of functions
+    pub functions: usize,
+    /// Number of functions with fallible calls and no checks
+    pub unhandled: usize,
+}
+
+impl ErrorHandlingStats {
+    /// Adds the counts of `other`.
+    pub(crate) fn merge(&mut self, other: &ErrorHandlingStats) {
+        self.counts.checks += other.counts.checks;
+        self.counts.fallible_calls += other.counts.fallible_calls;
+        self.counts.panics += other.counts.panics;
+        self.counts.assertions += other.counts.assertions;
+        self.functions += other.functions;
+        self.unhandled += other.unhandled;
+    }
+
+    /// Returns true if no construct was found.
+    pub(crate) fn is_empty(&self) -> bool {
+        self.counts.is_empty()
+    }
+
+    /// Returns the mean number of checks per function, or `None` without
+    /// functions.
+    pub fn checks_per_function(&self) -> Option<f64> {
+        (self.functions > 0).then(|| self.counts.checks as f64 / self.functions as f64)
+    }
+}
+
+/// Counts the error-handling constructs of a parsed file.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the parsed file
+/// * `source` - The source code the tree was parsed from
+/// * `language` - The programming language of the source code
+/// * `functions` - The functions found in the file, with their counts
+///
+/// # Returns
+///
+/// The counts, or `None` for languages other than Go, JavaScript,
+/// TypeScript, Python, and Rust
+pub(crate) fn error_handling_stats(
+    root: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+    functions: &[FunctionStats],
+) -> Option<ErrorHandlingStats> {
+    if !has_error_handling(language) {
+        return None;
+    }
+
+    let mut counts = ErrorHandling::default();
+    let mut stack = vec![*root];
+    while let Some(node) = stack.pop() {
+        count_construct(&node, source, language, &mut counts);
+        let mut cursor = node.walk();
+        stack.extend(node.named_children(&mut cursor));
+    }
+    Some(ErrorHandlingStats {
+        counts,
+        functions: functions.len(),
+        unhandled: functions
+            .iter()
+            .filter(|function| function.error_handling.is_unhandled())
+            .count(),
+    })
+}
+
+/// Counts the error-handling constructs of a function, leaving out those of
+/// functions nested in it.
+///
+/// # Returns
+///
+/// The counts, all 0 for languages other than Go, JavaScript, TypeScript,
+/// Python, and Rust
+pub(crate) fn function_error_handling(
+    function: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> ErrorHandling {
+    let mut counts = ErrorHandling::default();
+    if !has_error_handling(language) {
+        return counts;
+    }
+
+    let mut cursor = function.walk();
+    let mut stack: Vec<Node> = function.named_children(&mut cursor).collect();
+    while let Some(node) = stack.pop() {
+        if is_function(&node, source, language) {
+            continue;
+        }
+        count_construct(&node, source, language, &mut counts);
+        let mut cursor = node.walk();
+        stack.extend(node.named_children(&mut cursor));
+    }
+    counts
+}
+
+/// Returns true for the languages whose error handling is counted.
+fn has_error_handling(language: &SupportedLanguage) -> bool {
+    matches!(
+        language,
+        SupportedLanguage::Go
+            | SupportedLanguage::JavaScript
+            | SupportedLanguage::TypeScript
+            | SupportedLanguage::Python
+            | SupportedLanguage::Rust
+    )
+}
+
+/// Adds `node` to the counts if it is one of the counted constructs.
+fn count_construct(
+    node: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+    counts: &mut ErrorHandling,
+) {
+    let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+    // Full text of the callee of a call, e.g. `json.loads`
+    let called = || callee(node).map(|callee| text(&callee));
+    match language {
+        SupportedLanguage::Go => match node.kind() {
+            "if_statement" => {
+                if node
+                    .child_by_field_name("condition")
+                    .is_some_and(|condition| has_err_check(&condition, source))
+                {
+                    counts.checks += 1;
+                }
+            }
+            "short_var_declaration" | "assignment_statement" => {
+                let assigns_err = node.child_by_field_name("left").is_some_and(|left| {
+                    let mut cursor = left.walk();
+                    left.named_children(&mut cursor)
+                        .any(|name| is_err_name(&text(&name)))
+                });
+                let calls = node.child_by_field_name("right").is_some_and(|right| {
+                    let mut cursor = right.walk();
+                    right
+                        .named_children(&mut cursor)
+                        .any(|value| value.kind() == "call_expression")
+                });
+                if assigns_err && calls {
+                    counts.fallible_calls += 1;
+                }
+            }
+            "call_expression" => {
+                if called().is_some_and(|name| {
+                    name == "panic"
+                        || name.starts_with("log.Fatal")
+                        || name.starts_with("log.Panic")
+                }) {
+                    counts.panics += 1;
+                }
+            }
+            _ => {}
+        },
+        SupportedLanguage::Rust => match node.kind() {
+            "try_expression" => {
+                counts.checks += 1;
+                counts.fallible_calls += 1;
+            }
+            "call_expression" => {
+                let method = callee(node)
+                    .filter(|callee| callee.kind() == "field_expression")
+                    .and_then(|callee| last_segment(&callee))
+                    .map(|name| text(&name));
+                if matches!(method.as_deref(), Some("unwrap" | "expect")) {
+                    counts.fallible_calls += 1;
+                    counts.panics += 1;
+                }
+            }
+            "macro_invocation" => {
+                let name = node
+                    .child_by_field_name("macro")
+                    .and_then(|name| last_segment(&name))
+                    .map(|name| text(&name))
+                    .unwrap_or_default();
+                if RUST_PANICS.contains(&name.as_str()) {
+                    counts.panics += 1;
+                } else if RUST_ASSERTIONS.contains(&name.as_str()) {
+                    counts.assertions += 1;
+                }
+            }
+            _ => {}
+        },
+        SupportedLanguage::Python => match node.kind() {
+            "try_statement" => {
+                let mut cursor = node.walk();
+                if node
+                    .named_children(&mut cursor)
+                    .any(|child| matches!(child.kind(), "except_clause" | "except_group_clause"))
+                {
+                    counts.checks += 1;
+                }
+            }
+            "assert_statement" => counts.assertions += 1,
+            "call" => {
+                if called().is_some_and(|name| {
+                    PYTHON_FALLIBLE.contains(&name.as_str()) || name.starts_with("requests.")
+                }) {
+                    counts.fallible_calls += 1;
+                }
+            }
+            _ => {}
+        },
+        SupportedLanguage::JavaScript | SupportedLanguage::TypeScript => match node.kind() {
+            "try_statement" => {
+                if node.child_by_field_name("handler").is_some() {
+                    counts.checks += 1;
+                }
+            }
+            "call_expression" => {
+                let Some(name) = called() else {
+                    return;
+                };
+                if name.ends_with(".catch") {
+                    counts.checks += 1;
+                } else if name == "JSON.parse"
+                    || name == "fetch"
+                    || (name.starts_with("fs.") && name.ends_with("Sync"))
+                {
+                    counts.fallible_calls += 1;
+                } else if name == "assert"
+                    || name == "console.assert"
+                    || name.starts_with("assert.")
+                {
+                    counts.assertions += 1;
+                }
+            }
+            _ => {}
+        },
+        _ => {}
+    }
+}
+
+/// Returns true if a Go condition compares an error variable to `nil`,
+/// alone or as an operand of `&&` and `||`.
+fn has_err_check(condition: &Node, source: &[u8]) -> bool {
+    match condition.kind() {
+        "parenthesized_expression" => {
+            let mut cursor = condition.walk();
+            condition
+                .named_children(&mut cursor)
+                .any(|inner| has_err_check(&inner, source))
+        }
+        "binary_expression" => {
+            let operand = |field| {
+                condition
+                    .child_by_field_name(field)
+                    .and_then(|node| node.utf8_text(source).ok())
+                    .unwrap_or_default()
+            };
+            let operator = condition
+                .child_by_field_name("operator")
+                .map(|operator| operator.kind())
+                .unwrap_or_default();
+            match operator {
+                "!=" | "==" => {
+                    (is_err_name(operand("left")) && operand("right") == "nil")
+                        || (operand("left") == "nil" && is_err_name(operand("right")))
+                }
+                "&&" | "||" => ["left", "right"].iter().any(|field| {
+                    condition
+                        .child_by_field_name(field)
+                        .is_some_and(|side| has_err_check(&side, source))
+                }),
+                _ => false,
+            }
+        }
+        _ => false,
+    }
+}
+
+/// Returns true for the names Go code conventionally gives errors: `err`
+/// and names ending in `err` or `Err`.
+fn is_err_name(name: &str) -> bool {
+    name.ends_with("err") || name.ends_with("Err")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::{analyze_code, create_parser};
+
+    fn handling(source: &str, language: SupportedLanguage) -> Vec<(String, ErrorHandling)> {
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, source, "test", &language).unwrap();
+        stats
+            .functions
+            .into_iter()
+            .map(|function| (function.name, function.error_handling))
+            .collect()
+    }
+
+    fn counts(
+        checks: usize,
+        fallible_calls: usize,
+        panics: usize,
+        assertions: usize,
+    ) -> ErrorHandling {
+        ErrorHandling {
+            checks,
+            fallible_calls,
+            panics,
+            assertions,
+        }
+    }
+
+    #[test]
+    fn test_go_err_checks() {
+        let source = r#"
+package main
+
+func load(path string) ([]byte, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    if closeErr := f.Close(); closeErr != nil && !quiet {
+        log.Print(closeErr)
+    }
+    return data, nil
+}
+
+func mustLoad(path string) []byte {
+    data, err := os.ReadFile(path)
+    _ = err
+    if data == nil {
+        log.Fatalf("empty %s", path)
+    }
+    return data
+}
+"#;
+        assert_eq!(
+            handling(source, SupportedLanguage::Go),
+            vec![
+                ("load".to_string(), counts(2, 2, 0, 0)),
+                ("mustLoad".to_string(), counts(0, 1, 1, 0)),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_rust_propagation_and_panics() {
+        let source = r#"
+fn read(path: &str) -> io::Result<String> {
+    let text = fs::read_to_string(path)?;
+    assert!(!text.is_empty());
+    Ok(text)
+}
+
+fn read_or_die(path: &str) -> String {
+    let text = fs::read_to_string(path).expect("readable");
+    let first = text.lines().next().unwrap();
+    if first.is_empty() {
+        unreachable!();
+    }
+    first.unwrap_or_default()
+}
+"#;
+        let found = handling(source, SupportedLanguage::Rust);
+        assert_eq!(found[0], ("read".to_string(), counts(1, 1, 0, 1)));
+        assert_eq!(found[1], ("read_or_die".to_string(), counts(0, 2, 3, 0)));
+        assert!(found[1].1.is_unhandled());
+        assert!(!found[0].1.is_unhandled());
+    }
+
+    #[test]
+    fn test_python_and_javascript_handlers() {
+        let python = r#"
+def load(path):
+    try:
+        with open(path) as f:
+            return json.load(f)
+    except OSError:
+        return None
+
+def load_unchecked(path):
+    assert path
+    return json.loads(open(path).read())
+"#;
+        assert_eq!(
+            handling(python, SupportedLanguage::Python),
+            vec![
+                ("load".to_string(), counts(1, 2, 0, 0)),
+                ("load_unchecked".to_string(), counts(0, 2, 0, 1)),
+            ]
+        );
+
+        let javascript = r#"
+function config(text) {
+    try {
+        return JSON.parse(text);
+    } finally {
+        console.log("parsed");
+    }
+}
+
+function user(id) {
+    return fetch(`/users/${id}`).then((r) => r.json()).catch(report);
+}
+"#;
+        let found = handling(javascript, SupportedLanguage::JavaScript);
+        assert_eq!(found[0], ("config".to_string(), counts(0, 1, 0, 0)));
+        assert_eq!(found[1], ("user".to_string(), counts(1, 1, 0, 0)));
+    }
+
+    #[test]
+    fn test_file_totals_include_top_level_code() {
+        let source = "import json\n\nCONFIG = json.load(open('c.json'))\n\n\
+                      def check(x):\n    assert x > 0\n";
+        let mut parser = create_parser(&SupportedLanguage::Python).unwrap();
+        let stats =
+            analyze_code(&mut parser, source, "test.py", &SupportedLanguage::Python).unwrap();
+        assert_eq!(
+            stats.error_handling,
+            Some(ErrorHandlingStats {
+                counts: counts(0, 2, 0, 1),
+                functions: 1,
+                unhandled: 0,
+            })
+        );
+        assert_eq!(
+            stats.error_handling.unwrap().checks_per_function(),
+            Some(0.0)
+        );
+    }
+
+    #[test]
+    fn test_merge() {
+        let mut stats = ErrorHandlingStats {
+            counts: counts(3, 4, 1, 0),
+            functions: 2,
+            unhandled: 1,
+        };
+        stats.merge(&ErrorHandlingStats {
+            counts: counts(1, 0, 0, 2),
+            functions: 2,
+            unhandled: 0,
+        });
+        assert_eq!(stats.counts, counts(4, 4, 1, 2));
+        assert_eq!(stats.checks_per_function(), Some(1.0));
+        assert_eq!(stats.unhandled, 1);
+        assert!(ErrorHandlingStats::default().is_empty());
+        assert_eq!(ErrorHandlingStats::default().checks_per_function(), None);
+    }
+}
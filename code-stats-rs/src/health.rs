@@ -0,0 +1,127 @@
+//! ERROR and MISSING nodes left in syntax trees by tree-sitter's recovery.
+//!
+//! tree-sitter always produces a tree: syntax it cannot parse is wrapped in an
+//! ERROR node, and a token it had to assume (a closing brace, a semicolon) is
+//! inserted as a zero-width MISSING node. Declarations in or around such places
+//! are easily missed, so files with either are reported as not parsed cleanly.
+
+use serde::{Deserialize, Serialize};
+use tree_sitter::Node;
+
+/// Number of issues whose location is kept per file.
+pub(crate) const MAX_PARSE_ISSUES: usize = 5;
+
+/// What tree-sitter did to recover from a syntax error.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum ParseIssueKind {
+    /// A region that could not be parsed
+    Error,
+    /// A token that was expected but absent
+    Missing,
+}
+
+/// Location of an ERROR or MISSING node.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct ParseIssue {
+    /// Kind of recovery
+    pub kind: ParseIssueKind,
+    /// 1-based line where the node starts
+    pub line: usize,
+    /// 1-based column where the node starts: in bytes as extracted, in
+    /// display columns with tabs expanded once analyzed
+    pub column: usize,
+    /// Node kind of the missing token (e.g. `;`), only set for MISSING nodes
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub expected: Option<String>,
+}
+
+/// The ERROR and MISSING nodes of one syntax tree.
+#[derive(Debug, Default, PartialEq, Eq)]
+pub(crate) struct ParseIssues {
+    /// Outermost ERROR nodes
+    pub errors: usize,
+    /// MISSING nodes outside ERROR regions
+    pub missing: usize,
+    /// The first `MAX_PARSE_ISSUES` of both, in source order
+    pub first: Vec<ParseIssue>,
+}
+
+/// Collects the ERROR and MISSING nodes below `root`.
+///
+/// Errors nested inside another ERROR node belong to the same unparsed
+/// region and are not counted again, nor are MISSING nodes inside one.
+pub(crate) fn parse_issues(root: &Node) -> ParseIssues {
+    let mut issues = ParseIssues::default();
+    collect(root, &mut issues);
+    issues
+}
+
+fn collect(node: &Node, issues: &mut ParseIssues) {
+    let kind = if node.is_error() {
+        issues.errors += 1;
+        ParseIssueKind::Error
+    } else if node.is_missing() {
+        issues.missing += 1;
+        ParseIssueKind::Missing
+    } else {
+        if node.has_error() {
+            let mut cursor = node.walk();
+            for child in node.children(&mut cursor) {
+                collect(&child, issues);
+            }
+        }
+        return;
+    };
+
+    if issues.first.len() < MAX_PARSE_ISSUES {
+        let start = node.start_position();
+        issues.first.push(ParseIssue {
+            kind,
+            line: start.row + 1,
+            column: start.column + 1,
+            expected: (kind == ParseIssueKind::Missing).then(|| node.kind().to_string()),
+        });
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::language::SupportedLanguage;
+    use crate::parser::create_parser;
+
+    fn issues(language: SupportedLanguage, source: &str) -> ParseIssues {
+        let tree = create_parser(&language)
+            .unwrap()
+            .parse(source, None)
+            .unwrap();
+        parse_issues(&tree.root_node())
+    }
+
+    #[test]
+    fn test_parse_issues_clean_file() {
+        let found = issues(SupportedLanguage::Rust, "fn main() {}\n");
+        assert_eq!(found, ParseIssues::default());
+    }
+
+    #[test]
+    fn test_parse_issues_missing_token() {
+        let found = issues(SupportedLanguage::Go, "package main\n\nfunc main() {\n");
+        assert_eq!(found.errors, 0);
+        assert_eq!(found.missing, 1);
+        assert_eq!(found.first[0].kind, ParseIssueKind::Missing);
+        assert_eq!(found.first[0].expected.as_deref(), Some("}"));
+        assert!(found.first[0].line >= 3);
+    }
+
+    #[test]
+    fn test_parse_issues_keeps_first_locations() {
+        let source = "int ok(void) { return 0; }\n".to_string() + &"@@ $$\n".repeat(8);
+        let found = issues(SupportedLanguage::C, &source);
+        assert!(found.errors > 0);
+        assert!(found.first.len() <= MAX_PARSE_ISSUES);
+        assert_eq!(found.first[0].kind, ParseIssueKind::Error);
+        assert!(found.first[0].line >= 2);
+    }
+}
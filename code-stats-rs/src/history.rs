@@ -0,0 +1,624 @@
+//! Metrics across git history for the `history` subcommand.
+//!
+//! For every date of a series, the last commit on the first-parent line of
+//! `HEAD` at the end of that day is analyzed. Revisions are read with git
+//! plumbing (`rev-list`, `ls-tree`, and a `cat-file --batch` process), so the
+//! working tree, the index, and the checked-out branch are never touched.
+//!
+//! Files are selected by their name, since there is no file on disk to
+//! inspect, and filtered as in directory analysis; files that can't be
+//! decoded or parsed are left out. A file whose content is unchanged since
+//! the previous date is not analyzed again.
+
+use crate::analyzer::{CodeAnalyzer, DirectoryOptions, PathFilter, classify_file};
+use crate::cli::HistoryStep;
+use crate::diff::{display_path, git, repository_root};
+use crate::encoding::decode;
+use crate::error::{CodeStatsError, Result};
+use crate::language::SupportedLanguage;
+use crate::origin::{CodeOrigin, is_generated};
+use crate::stats::{DirectoryStats, FileStats};
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap};
+use std::fmt;
+use std::io::{BufRead, BufReader, Read, Write};
+use std::path::{Path, PathBuf};
+use std::process::{Child, ChildStdin, ChildStdout, Command, Stdio};
+use std::str::FromStr;
+use std::time::{SystemTime, UNIX_EPOCH};
+
+/// A calendar date, as given to `--since` and `--until`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord)]
+pub struct Date {
+    year: i64,
+    month: u32,
+    day: u32,
+}
+
+impl Date {
+    /// Returns the current date in UTC.
+    pub(crate) fn today() -> Self {
+        let seconds = SystemTime::now()
+            .duration_since(UNIX_EPOCH)
+            .map_or(0, |elapsed| elapsed.as_secs());
+        Self::from_days((seconds / 86_400) as i64)
+    }
+
+    /// Returns the date `n` steps after this one. Months and quarters keep
+    /// the day of the month where it exists and use the last day otherwise,
+    /// so a series starting on the 31st stays at the end of each month.
+    fn advance(self, step: HistoryStep, n: i64) -> Self {
+        match step {
+            HistoryStep::Daily => Self::from_days(self.days() + n),
+            HistoryStep::Weekly => Self::from_days(self.days() + 7 * n),
+            HistoryStep::Monthly => self.add_months(n),
+            HistoryStep::Quarterly => self.add_months(3 * n),
+            HistoryStep::Yearly => self.add_months(12 * n),
+        }
+    }
+
+    fn add_months(self, n: i64) -> Self {
+        let months = self.year * 12 + i64::from(self.month) - 1 + n;
+        let (year, month) = (months.div_euclid(12), months.rem_euclid(12) as u32 + 1);
+        Self {
+            year,
+            month,
+            day: self.day.min(days_in_month(year, month)),
+        }
+    }
+
+    /// Converts the date to days since 1970-01-01.
+    fn days(self) -> i64 {
+        // Howard Hinnant's days_from_civil
+        let year = if self.month <= 2 {
+            self.year - 1
+        } else {
+            self.year
+        };
+        let era = year.div_euclid(400);
+        let year_of_era = year - era * 400;
+        let month = i64::from(self.month);
+        let day_of_year = (153 * (if month > 2 { month - 3 } else { month + 9 }) + 2) / 5
+            + i64::from(self.day)
+            - 1;
+        let day_of_era = year_of_era * 365 + year_of_era / 4 - year_of_era / 100 + day_of_year;
+        era * 146_097 + day_of_era - 719_468
+    }
+
+    /// Converts days since 1970-01-01 to a date.
+    fn from_days(days: i64) -> Self {
+        // Howard Hinnant's civil_from_days
+        let days = days + 719_468;
+        let era = days.div_euclid(146_097);
+        let day_of_era = days - era * 146_097;
+        let year_of_era =
+            (day_of_era - day_of_era / 1460 + day_of_era / 36_524 - day_of_era / 146_096) / 365;
+        let day_of_year = day_of_era - (365 * year_of_era + year_of_era / 4 - year_of_era / 100);
+        let shifted_month = (5 * day_of_year + 2) / 153;
+        let day = (day_of_year - (153 * shifted_month + 2) / 5 + 1) as u32;
+        let month = if shifted_month < 10 {
+            shifted_month + 3
+        } else {
+            shifted_month - 9
+        } as u32;
+        let year = year_of_era + era * 400 + i64::from(month <= 2);
+        Self { year, month, day }
+    }
+}
+
+impl FromStr for Date {
+    type Err = String;
+
+    fn from_str(text: &str) -> std::result::Result<Self, Self::Err> {
+        let invalid = || format!("expected a date as YYYY-MM-DD, got '{text}'");
+        let parts: Vec<&str> = text.split('-').collect();
+        let [year, month, day] = parts[..] else {
+            return Err(invalid());
+        };
+        let (Ok(year), Ok(month), Ok(day)) = (year.parse(), month.parse(), day.parse()) else {
+            return Err(invalid());
+        };
+        if !(1..=12).contains(&month) || day == 0 || day > days_in_month(year, month) {
+            return Err(invalid());
+        }
+        Ok(Self { year, month, day })
+    }
+}
+
+impl fmt::Display for Date {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{:04}-{:02}-{:02}", self.year, self.month, self.day)
+    }
+}
+
+/// Returns the number of days of a month.
+fn days_in_month(year: i64, month: u32) -> u32 {
+    match month {
+        2 if year % 4 == 0 && (year % 100 != 0 || year % 400 == 0) => 29,
+        2 => 28,
+        4 | 6 | 9 | 11 => 30,
+        _ => 31,
+    }
+}
+
+/// Returns the dates from `since` to `until`, both included, `step` apart.
+pub(crate) fn series(since: Date, until: Date, step: HistoryStep) -> Vec<Date> {
+    (0..)
+        .map(|n| since.advance(step, n))
+        .take_while(|date| *date <= until)
+        .collect()
+}
+
+/// Totals of a language, or of all languages, at one date.
+#[derive(Debug, Clone, Default, PartialEq, Serialize)]
+pub(crate) struct HistoryTotals {
+    /// Number of files
+    pub files: usize,
+    /// Lines of code
+    pub code_lines: usize,
+    /// Number of functions
+    pub functions: usize,
+    /// Highest cyclomatic complexity of any function
+    pub max_complexity: usize,
+    /// Mean cyclomatic complexity of the functions, 0 without functions
+    pub mean_complexity: f64,
+}
+
+/// The metrics of the revision analyzed for one date.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub(crate) struct HistoryPoint {
+    /// The date as YYYY-MM-DD
+    pub date: String,
+    /// The commit analyzed for the date
+    pub commit: String,
+    /// Totals of the files counted in the code totals
+    pub total: HistoryTotals,
+    /// Totals per language, by language name
+    pub languages: BTreeMap<String, HistoryTotals>,
+}
+
+impl HistoryPoint {
+    fn new(date: Date, commit: String, stats: &DirectoryStats) -> Self {
+        let mut languages: BTreeMap<String, HistoryTotals> = stats
+            .total_by_language
+            .iter()
+            .map(|(language, totals)| {
+                let history = HistoryTotals {
+                    files: totals.file_count,
+                    code_lines: totals.lines.code,
+                    functions: totals.function_count,
+                    ..Default::default()
+                };
+                (language.name().to_string(), history)
+            })
+            .collect();
+        let mut complexity: HashMap<SupportedLanguage, (usize, usize)> = HashMap::new();
+        for file in stats.code_file_stats() {
+            let (sum, count) = complexity.entry(file.language).or_default();
+            for function in &file.stats.functions {
+                *sum += function.complexity;
+                *count += 1;
+            }
+            if let Some(totals) = languages.get_mut(file.language.name()) {
+                totals.max_complexity = totals.max_complexity.max(file.stats.max_complexity());
+            }
+        }
+        for (language, (sum, count)) in complexity {
+            if let Some(totals) = languages.get_mut(language.name())
+                && count > 0
+            {
+                totals.mean_complexity = sum as f64 / count as f64;
+            }
+        }
+
+        Self {
+            date: date.to_string(),
+            commit,
+            total: HistoryTotals {
+                files: stats.code_files(),
+                code_lines: stats.total_stats.lines.code,
+                functions: stats.total_stats.function_count,
+                max_complexity: stats.max_complexity(),
+                mean_complexity: stats.mean_complexity(),
+            },
+            languages,
+        }
+    }
+}
+
+/// Analyzes `root` as of every date of a series.
+///
+/// Dates before the first commit have no revision and are left out; dates
+/// with the same commit as the previous one repeat its metrics.
+///
+/// # Arguments
+///
+/// * `analyzer` - Analyzer used for the files of every revision
+/// * `root` - File or directory inside a git repository
+/// * `options` - Ignore patterns, include/exclude globs, and whether
+///   generated files are counted as code
+/// * `dates` - The dates of the series, oldest first
+///
+/// # Returns
+///
+/// * `Ok(Vec<HistoryPoint>)` - The metrics of each date with a revision
+/// * `Err(GitError)` - `root` is not in a git repository or git failed
+pub(crate) fn history(
+    analyzer: &mut CodeAnalyzer,
+    root: &Path,
+    options: &DirectoryOptions,
+    dates: &[Date],
+) -> Result<Vec<HistoryPoint>> {
+    let (root_abs, toplevel) = repository_root(root)?;
+    let pathspec = match root_abs.strip_prefix(&toplevel) {
+        Ok(relative) if !relative.as_os_str().is_empty() => relative.to_string_lossy().into_owned(),
+        _ => ".".to_string(),
+    };
+
+    let filter = PathFilter::new(root, options)?;
+    let mut blobs = BlobReader::new(&toplevel)?;
+    let mut previous: HashMap<(String, PathBuf), Option<FileStats>> = HashMap::new();
+    let mut points: Vec<HistoryPoint> = Vec::new();
+    for date in dates {
+        let before = format!("--before={date} 23:59:59");
+        let commit = git(
+            &toplevel,
+            &["rev-list", "-1", "--first-parent", &before, "HEAD"],
+        )?
+        .trim()
+        .to_string();
+        if commit.is_empty() {
+            continue;
+        }
+        if let Some(last) = points.last().filter(|last| last.commit == commit) {
+            let point = HistoryPoint {
+                date: date.to_string(),
+                ..last.clone()
+            };
+            points.push(point);
+            continue;
+        }
+
+        let listing = git(
+            &toplevel,
+            &["ls-tree", "-r", "-z", &commit, "--", &pathspec],
+        )?;
+        let mut stats = DirectoryStats::new();
+        let mut current = HashMap::new();
+        for (object, file) in tree_files(&listing) {
+            let path = display_path(root, &root_abs, &toplevel.join(file));
+            if !filter.allows(&path) {
+                continue;
+            }
+            let Some(language) = analyzer.language_from_name(file) else {
+                continue;
+            };
+
+            let key = (object.to_string(), path);
+            let file_stats = match previous.remove(&key) {
+                Some(file_stats) => file_stats,
+                None => {
+                    let source = blobs.read(object)?;
+                    analyze_blob(analyzer, &key.1, language, &source, root, options)
+                }
+            };
+            if let Some(file_stats) = &file_stats {
+                stats.add_file(file_stats.clone());
+            }
+            current.insert(key, file_stats);
+        }
+        previous = current;
+        points.push(HistoryPoint::new(*date, commit, &stats));
+    }
+    Ok(points)
+}
+
+/// Lists the regular files of a `git ls-tree -r -z` listing as pairs of
+/// object name and path; symlinks and submodules are skipped.
+pub(crate) fn tree_files(listing: &str) -> impl Iterator<Item = (&str, &str)> {
+    listing.split('\0').filter_map(|entry| {
+        // `<mode> blob <object>\t<path>`
+        let (meta, file) = entry.split_once('\t')?;
+        let mut meta = meta.split(' ');
+        match (meta.next(), meta.next(), meta.next()) {
+            (Some(mode), Some("blob"), Some(object)) if mode != "120000" => Some((object, file)),
+            _ => None,
+        }
+    })
+}
+
+/// Analyzes the content of a file that is not on disk, such as a file at a
+/// revision, or returns `None` if it can't be decoded or parsed. Content
+/// above the parse size limit is not decoded and only has its lines counted.
+pub(crate) fn analyze_blob(
+    analyzer: &mut CodeAnalyzer,
+    path: &Path,
+    language: SupportedLanguage,
+    bytes: &[u8],
+    root: &Path,
+    options: &DirectoryOptions,
+) -> Option<FileStats> {
+    if let Some(mut file_stats) = analyzer.oversized_stats(path, language, bytes) {
+        classify_file(&mut file_stats, root, options);
+        return Some(file_stats);
+    }
+    let (source, encoding) = decode(bytes).ok()?;
+    let mut file_stats = analyzer.analyze_text(path, language, &source).ok()?;
+    file_stats.stats.encoding = encoding;
+    if is_generated(path, &source) {
+        file_stats.stats.origin = Some(CodeOrigin::Generated);
+    }
+    classify_file(&mut file_stats, root, options);
+    Some(file_stats)
+}
+
+/// Reads objects from a long-running `git cat-file --batch` process.
+pub(crate) struct BlobReader {
+    child: Child,
+    input: Option<ChildStdin>,
+    output: BufReader<ChildStdout>,
+}
+
+impl BlobReader {
+    pub(crate) fn new(dir: &Path) -> Result<Self> {
+        let mut child = Command::new("git")
+            .arg("-C")
+            .arg(dir)
+            .args(["cat-file", "--batch"])
+            .stdin(Stdio::piped())
+            .stdout(Stdio::piped())
+            .spawn()
+            .map_err(|e| CodeStatsError::GitError(format!("failed to run git: {e}")))?;
+        let input = child.stdin.take();
+        let output = child.stdout.take().map(BufReader::new).ok_or_else(|| {
+            CodeStatsError::GitError("failed to read from git cat-file".to_string())
+        })?;
+        Ok(Self {
+            child,
+            input,
+            output,
+        })
+    }
+
+    /// Returns the content of an object, given by its name.
+    pub(crate) fn read(&mut self, object: &str) -> Result<Vec<u8>> {
+        let error = |e: std::io::Error| CodeStatsError::GitError(format!("git cat-file: {e}"));
+        let input = self.input.as_mut().ok_or_else(|| {
+            CodeStatsError::GitError("git cat-file has already exited".to_string())
+        })?;
+        writeln!(input, "{object}").map_err(error)?;
+        input.flush().map_err(error)?;
+
+        // `<object> <type> <size>`, or `<object> missing`
+        let mut header = String::new();
+        self.output.read_line(&mut header).map_err(error)?;
+        let size = header
+            .split_whitespace()
+            .nth(2)
+            .and_then(|size| size.parse::<usize>().ok())
+            .ok_or_else(|| {
+                CodeStatsError::GitError(format!("git cat-file: {object}: {}", header.trim_end()))
+            })?;
+        // The content is followed by a line break
+        let mut content = vec![0; size + 1];
+        self.output.read_exact(&mut content).map_err(error)?;
+        content.pop();
+        Ok(content)
+    }
+}
+
+impl Drop for BlobReader {
+    fn drop(&mut self) {
+        // Closing the input makes git exit
+        self.input.take();
+        let _ = self.child.wait();
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn date(text: &str) -> Date {
+        text.parse().unwrap()
+    }
+
+    #[test]
+    fn test_parse_date() {
+        assert_eq!(date("2023-01-05").to_string(), "2023-01-05");
+        assert_eq!(date("2024-02-29").to_string(), "2024-02-29");
+        for text in [
+            "2023-13-01",
+            "2023-02-29",
+            "2023-01",
+            "yesterday",
+            "2023-01-00",
+        ] {
+            assert!(text.parse::<Date>().is_err(), "{text}");
+        }
+    }
+
+    #[test]
+    fn test_days_round_trip() {
+        assert_eq!(date("1970-01-01").days(), 0);
+        assert_eq!(date("2000-03-01").days(), 11_017);
+        for days in [-1, 0, 59, 365, 11_016, 19_723, 20_000] {
+            assert_eq!(Date::from_days(days).days(), days);
+        }
+    }
+
+    #[test]
+    fn test_series() {
+        let dates: Vec<String> =
+            series(date("2023-01-31"), date("2023-04-30"), HistoryStep::Monthly)
+                .iter()
+                .map(Date::to_string)
+                .collect();
+        assert_eq!(
+            dates,
+            ["2023-01-31", "2023-02-28", "2023-03-31", "2023-04-30"]
+        );
+
+        let dates = series(date("2023-12-25"), date("2024-01-08"), HistoryStep::Weekly);
+        assert_eq!(dates.last().unwrap().to_string(), "2024-01-08");
+        assert_eq!(dates.len(), 3);
+
+        let dates = series(
+            date("2023-01-01"),
+            date("2023-12-31"),
+            HistoryStep::Quarterly,
+        );
+        assert_eq!(dates.len(), 4);
+        assert!(series(date("2023-02-01"), date("2023-01-01"), HistoryStep::Daily).is_empty());
+    }
+
+    #[test]
+    fn test_history_point_totals() {
+        use crate::parser::{CodeStats, FunctionStats};
+
+        let mut stats = DirectoryStats::new();
+        stats.add_file(FileStats {
+            path: PathBuf::from("src/lib.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                function_count: 2,
+                functions: vec![
+                    FunctionStats {
+                        complexity: 5,
+                        ..Default::default()
+                    },
+                    FunctionStats {
+                        complexity: 1,
+                        ..Default::default()
+                    },
+                ],
+                ..Default::default()
+            },
+        });
+
+        let point = HistoryPoint::new(date("2023-01-01"), "abc".to_string(), &stats);
+        assert_eq!(point.date, "2023-01-01");
+        assert_eq!(point.total.functions, 2);
+        assert_eq!(point.total.max_complexity, 5);
+        let rust = &point.languages["Rust"];
+        assert_eq!((rust.files, rust.max_complexity), (1, 5));
+        assert_eq!(rust.mean_complexity, 3.0);
+    }
+
+    /// Commits `files` to the repository in `dir` with the given date.
+    fn commit(dir: &Path, files: &[(&str, &str)], date: &str) {
+        for (name, content) in files {
+            std::fs::write(dir.join(name), content).unwrap();
+        }
+        let run = |args: &[&str]| {
+            let status = Command::new("git")
+                .arg("-C")
+                .arg(dir)
+                .args(args)
+                .env("GIT_AUTHOR_DATE", date)
+                .env("GIT_COMMITTER_DATE", date)
+                .status()
+                .unwrap();
+            assert!(status.success(), "git {args:?}");
+        };
+        run(&["add", "-A"]);
+        run(&[
+            "-c",
+            "user.name=Test",
+            "-c",
+            "user.email=test@example.com",
+            "commit",
+            "-q",
+            "-m",
+            "change",
+        ]);
+    }
+
+    #[test]
+    fn test_history_reads_revisions() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let dir = temp_dir.path();
+        let status = Command::new("git")
+            .args(["init", "-q"])
+            .arg(dir)
+            .status()
+            .unwrap();
+        assert!(status.success());
+        commit(dir, &[("a.rs", "fn a() {}\n")], "2023-01-15T12:00:00");
+        commit(
+            dir,
+            &[("b.rs", "fn b() {}\nfn c() {}\n")],
+            "2023-03-10T12:00:00",
+        );
+        // The working tree is not what is analyzed
+        std::fs::write(dir.join("a.rs"), "").unwrap();
+
+        let dates = series(date("2022-12-01"), date("2023-04-01"), HistoryStep::Monthly);
+        let mut analyzer = CodeAnalyzer::new();
+        let points = history(&mut analyzer, dir, &DirectoryOptions::default(), &dates).unwrap();
+
+        let summary: Vec<(&str, usize, usize)> = points
+            .iter()
+            .map(|point| {
+                (
+                    point.date.as_str(),
+                    point.total.files,
+                    point.total.functions,
+                )
+            })
+            .collect();
+        assert_eq!(
+            summary,
+            [
+                ("2023-02-01", 1, 1),
+                ("2023-03-01", 1, 1),
+                ("2023-04-01", 2, 3)
+            ]
+        );
+        assert_eq!(points[0].commit, points[1].commit);
+        assert_ne!(points[1].commit, points[2].commit);
+    }
+
+    #[test]
+    fn test_tree_files() {
+        let listing = "100644 blob 1111\tsrc/lib.rs\0\
+                       120000 blob 2222\tlink.rs\0\
+                       160000 commit 3333\tvendor/sub\0\
+                       100755 blob 4444\tbuild.sh\0";
+        let files: Vec<_> = tree_files(listing).collect();
+        assert_eq!(files, [("1111", "src/lib.rs"), ("4444", "build.sh")]);
+    }
+
+    #[test]
+    fn test_analyze_blob_above_parse_size() {
+        // Not valid UTF-8 either, so it would fail to decode if it were read
+        let mut bytes = b"package vendor\n\nvar Table = []byte{\n".to_vec();
+        bytes.extend_from_slice(&[0xff, 0xfe, b'\n']);
+        let mut analyzer = CodeAnalyzer::new().with_max_parse_size(16);
+        let file_stats = analyze_blob(
+            &mut analyzer,
+            Path::new("repo/vendor/table.go"),
+            SupportedLanguage::Go,
+            &bytes,
+            Path::new("repo"),
+            &DirectoryOptions::default(),
+        )
+        .unwrap();
+        assert!(file_stats.stats.oversized);
+        assert_eq!(file_stats.stats.lines.code, 3);
+        assert_eq!(file_stats.stats.origin, Some(CodeOrigin::Vendored));
+    }
+
+    #[test]
+    fn test_history_outside_repository() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let mut analyzer = CodeAnalyzer::new();
+        let result = history(
+            &mut analyzer,
+            temp_dir.path(),
+            &DirectoryOptions::default(),
+            &[Date::today()],
+        );
+        assert!(matches!(result, Err(CodeStatsError::GitError(_))));
+    }
+}
@@ -0,0 +1,144 @@
+//! Threshold checks of staged changes for the `hook` subcommand.
+//!
+//! A pre-commit hook has to judge the commit being made, not the working
+//! tree, which may hold further edits that are not staged. The staged files
+//! are therefore listed with `git diff --cached --raw`, which names the blob
+//! in the index for each of them, and read with `git cat-file --batch`, so
+//! partially staged files are checked as they will be committed.
+//!
+//! Files are selected by their name and filtered as in directory analysis;
+//! deleted files, symbolic links, submodules, and files that can't be
+//! decoded or parsed are left out.
+
+use crate::analyzer::{CodeAnalyzer, DirectoryOptions, PathFilter};
+use crate::diff::{display_path, git, repository_root};
+use crate::error::Result;
+use crate::history::{BlobReader, analyze_blob};
+use crate::stats::DirectoryStats;
+use std::path::{Path, PathBuf};
+
+/// Analyzes the staged content of the files under `root`.
+///
+/// # Arguments
+///
+/// * `analyzer` - Analyzer used for every staged file
+/// * `root` - Directory inside a git working tree; paths are reported
+///   relative to it
+/// * `paths` - Files or directories the check is limited to, as passed by
+///   pre-commit frameworks; empty checks everything staged under `root`
+/// * `options` - Exclusion settings; traversal settings don't apply
+///
+/// # Returns
+///
+/// * `Ok(DirectoryStats)` - Statistics of the staged files
+/// * `Err(GitError)` - `root` is not in a repository or git could not be run
+pub(crate) fn staged_stats(
+    analyzer: &mut CodeAnalyzer,
+    root: &Path,
+    paths: &[PathBuf],
+    options: &DirectoryOptions,
+) -> Result<DirectoryStats> {
+    let (root_abs, toplevel) = repository_root(root)?;
+    let mut args = vec![
+        "diff",
+        "--cached",
+        "--raw",
+        "-z",
+        "--no-abbrev",
+        "--no-renames",
+        "--diff-filter=ACM",
+        "--",
+    ];
+    // Pathspecs are relative to the directory git runs in
+    let pathspecs: Vec<String> = paths
+        .iter()
+        .map(|path| path.to_string_lossy().into_owned())
+        .collect();
+    if pathspecs.is_empty() {
+        args.push(".");
+    } else {
+        args.extend(pathspecs.iter().map(String::as_str));
+    }
+    let output = git(&root_abs, &args)?;
+
+    let filter = PathFilter::new(root, options)?;
+    let mut blobs = BlobReader::new(&toplevel)?;
+    let mut stats = DirectoryStats::new();
+    for (object, file) in staged_blobs(&output) {
+        let path = display_path(root, &root_abs, &toplevel.join(file));
+        if !filter.allows(&path) {
+            continue;
+        }
+        let Some(language) = analyzer.language_from_name(file) else {
+            continue;
+        };
+        let bytes = blobs.read(object)?;
+        if let Some(file_stats) = analyze_blob(analyzer, &path, language, &bytes, root, options) {
+            stats.add_file(file_stats);
+        }
+    }
+    Ok(stats)
+}
+
+/// Parses the output of `git diff --raw -z` into the index object and path
+/// of every regular file.
+///
+/// Each entry is `:<old mode> <new mode> <old object> <new object>
+/// <status>` followed by the path, both terminated by NUL.
+fn staged_blobs(output: &str) -> Vec<(&str, &str)> {
+    let mut fields = output.split('\0');
+    let mut blobs = Vec::new();
+    while let (Some(meta), Some(file)) = (fields.next(), fields.next()) {
+        let mut meta = meta.trim_start_matches(':').split(' ');
+        let (Some(_), Some(mode), Some(_), Some(object)) =
+            (meta.next(), meta.next(), meta.next(), meta.next())
+        else {
+            continue;
+        };
+        // Only regular files, and no intent-to-add entries without content
+        let regular = mode == "100644" || mode == "100755";
+        if regular && !object.bytes().all(|byte| byte == b'0') {
+            blobs.push((object, file));
+        }
+    }
+    blobs
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::error::CodeStatsError;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_staged_blobs() {
+        let zero = "0".repeat(40);
+        let old = "a".repeat(40);
+        let new = "b".repeat(40);
+        let output = format!(
+            ":100644 100644 {old} {new} M\0src/lib.rs\0\
+             :000000 100755 {zero} {new} A\0run.sh\0\
+             :000000 120000 {zero} {new} A\0link.rs\0\
+             :000000 160000 {zero} {new} A\0vendor/dep\0\
+             :000000 100644 {zero} {zero} A\0planned.rs\0"
+        );
+        assert_eq!(
+            staged_blobs(&output),
+            vec![(new.as_str(), "src/lib.rs"), (new.as_str(), "run.sh")]
+        );
+        assert!(staged_blobs("").is_empty());
+    }
+
+    #[test]
+    fn test_staged_stats_requires_repository() {
+        let temp_dir = TempDir::new().unwrap();
+        let mut analyzer = CodeAnalyzer::new();
+        let result = staged_stats(
+            &mut analyzer,
+            temp_dir.path(),
+            &[],
+            &DirectoryOptions::default(),
+        );
+        assert!(matches!(result, Err(CodeStatsError::GitError(_))));
+    }
+}
@@ -0,0 +1,152 @@
+//! Churn and hotspot ranking for the `hotspots` subcommand.
+//!
+//! A hotspot is code that is both hard to understand and changed often, where
+//! a refactoring pays off the most. The churn of a file is the number of
+//! commits reachable from `HEAD`, merges excluded, that touched it, from
+//! `git log`; its complexity is the sum of the cyclomatic complexity of its
+//! functions. The hotspot score is their product, so a file needs both to
+//! rank high: a complex file nobody touches, or a simple one everybody
+//! touches, scores low.
+//!
+//! Files are followed by their current path; commits from before a rename
+//! count for the old path only.
+
+use crate::diff::{display_path, git, repository_root};
+use crate::error::Result;
+use crate::stats::DirectoryStats;
+use serde::Serialize;
+use std::collections::HashMap;
+use std::path::{Path, PathBuf};
+
+/// A file ranked by its hotspot score.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct Hotspot {
+    /// The file, as reported by directory analysis
+    pub path: PathBuf,
+    /// Commits touching the file (churn)
+    pub commits: usize,
+    /// Sum of the cyclomatic complexity of the file's functions
+    pub complexity: usize,
+    /// Highest cyclomatic complexity of any of the file's functions
+    pub max_complexity: usize,
+    /// Lines of code
+    pub code_lines: usize,
+    /// `commits * complexity`
+    pub score: usize,
+}
+
+/// Counts the commits touching each file below `root`.
+///
+/// # Arguments
+///
+/// * `root` - The analyzed file or directory
+/// * `since` - Only count commits after this date, in any form `git log
+///   --since` accepts (`2023-01-01`, `6 months ago`)
+///
+/// # Returns
+///
+/// * `Ok(HashMap)` - Commit counts by the path directory analysis of `root`
+///   reports for each file
+/// * `Err(GitError)` - `root` is not in a git repository or git failed
+pub(crate) fn churn(root: &Path, since: Option<&str>) -> Result<HashMap<PathBuf, usize>> {
+    let (root_abs, toplevel) = repository_root(root)?;
+    let pathspec = root_abs.to_string_lossy();
+    let since = since.map(|since| format!("--since={since}"));
+    let mut args = vec![
+        "log",
+        "--no-renames",
+        "--no-merges",
+        "--format=",
+        "--name-only",
+        "-z",
+    ];
+    args.extend(since.as_deref());
+    args.extend(["--", &pathspec]);
+
+    let mut commits = HashMap::new();
+    for file in git(&toplevel, &args)?.split(['\0', '\n']) {
+        if file.is_empty() {
+            continue;
+        }
+        let path = display_path(root, &root_abs, &toplevel.join(file));
+        *commits.entry(path).or_insert(0) += 1;
+    }
+    Ok(commits)
+}
+
+/// Ranks the code files of `stats` by hotspot score, highest first; ties are
+/// ordered by path. Files without commits or without complexity are left
+/// out.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics of the analyzed files
+/// * `churn` - Commit counts by path, see `churn`
+pub(crate) fn hotspots(stats: &DirectoryStats, churn: &HashMap<PathBuf, usize>) -> Vec<Hotspot> {
+    let mut hotspots: Vec<Hotspot> = stats
+        .code_file_stats()
+        .filter_map(|file| {
+            let commits = churn.get(&file.path).copied().unwrap_or(0);
+            let complexity: usize = file.stats.functions.iter().map(|f| f.complexity).sum();
+            let score = commits * complexity;
+            (score > 0).then(|| Hotspot {
+                path: file.path.clone(),
+                commits,
+                complexity,
+                max_complexity: file.stats.max_complexity(),
+                code_lines: file.stats.lines.code,
+                score,
+            })
+        })
+        .collect();
+    hotspots.sort_by(|a, b| b.score.cmp(&a.score).then_with(|| a.path.cmp(&b.path)));
+    hotspots
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::error::CodeStatsError;
+    use crate::stats::test_support::{directory, file};
+
+    #[test]
+    fn test_hotspots_rank_churn_times_complexity() {
+        let stats = directory([
+            file("src/parser.rs", 0, &[12, 8]),
+            file("src/cli.rs", 0, &[3, 2]),
+            file("src/legacy.rs", 0, &[30]),
+            file("src/lib.rs", 0, &[1]),
+        ]);
+        let churn = HashMap::from([
+            (PathBuf::from("src/parser.rs"), 10),
+            (PathBuf::from("src/cli.rs"), 40),
+            (PathBuf::from("src/lib.rs"), 150),
+        ]);
+
+        let ranked: Vec<(String, usize)> = hotspots(&stats, &churn)
+            .into_iter()
+            .map(|h| (h.path.display().to_string(), h.score))
+            .collect();
+        assert_eq!(
+            ranked,
+            [
+                ("src/cli.rs".to_string(), 200),
+                ("src/parser.rs".to_string(), 200),
+                ("src/lib.rs".to_string(), 150)
+            ]
+        );
+
+        let parser = &hotspots(&stats, &churn)[1];
+        assert_eq!(
+            (parser.commits, parser.complexity, parser.max_complexity),
+            (10, 20, 12)
+        );
+    }
+
+    #[test]
+    fn test_churn_outside_repository() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let result = churn(temp_dir.path(), None);
+        assert!(matches!(result, Err(CodeStatsError::GitError(_))));
+    }
+}
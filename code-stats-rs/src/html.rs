@@ -0,0 +1,390 @@
+//! Self-contained HTML report for `--format html`.
+//!
+//! The report is a single file with embedded CSS and JavaScript so it can be
+//! attached to a ticket or published as a CI artifact without any assets.
+//! Every table can be sorted by clicking a column header; numeric cells carry
+//! their raw value in `data-value` so they sort numerically.
+
+use crate::stats::{DirectoryStats, FunctionRef, Thresholds};
+use std::fmt::Write;
+
+/// Number of files shown in the "Largest files" bar chart.
+const LARGEST_FILES: usize = 15;
+
+/// Stylesheet embedded in the report.
+const STYLE: &str = r#"
+body { font-family: system-ui, sans-serif; margin: 2rem; color: #222; }
+h1 { margin-bottom: 0.25rem; }
+h2 { margin-top: 2rem; border-bottom: 1px solid #ddd; padding-bottom: 0.25rem; }
+.totals { display: flex; gap: 1rem; flex-wrap: wrap; padding: 0; list-style: none; }
+.totals li { background: #f4f6f8; border-radius: 6px; padding: 0.5rem 1rem; }
+.totals strong { display: block; font-size: 1.4rem; }
+table { border-collapse: collapse; width: 100%; font-size: 0.9rem; }
+th, td { padding: 0.3rem 0.6rem; border-bottom: 1px solid #eee; text-align: left; }
+td.num, th.num { text-align: right; font-variant-numeric: tabular-nums; }
+th { background: #f4f6f8; cursor: pointer; user-select: none; position: sticky; top: 0; }
+th[aria-sort="ascending"]::after { content: " \25B2"; }
+th[aria-sort="descending"]::after { content: " \25BC"; }
+tr.over td { background: #fff1f0; }
+.chart { display: grid; grid-template-columns: minmax(10rem, 30%) 1fr; gap: 0.25rem 0.75rem; font-size: 0.85rem; }
+.chart .label { overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+.chart .bar { background: #4c8bf5; color: #fff; padding: 0.1rem 0.4rem; border-radius: 3px; min-width: 2rem; box-sizing: border-box; }
+"#;
+
+/// Script that makes every `table.sortable` sortable by column.
+const SCRIPT: &str = r#"
+document.querySelectorAll("table.sortable").forEach(function (table) {
+  table.querySelectorAll("th").forEach(function (th, column) {
+    th.addEventListener("click", function () {
+      var ascending = th.getAttribute("aria-sort") !== "ascending";
+      table.querySelectorAll("th").forEach(function (other) { other.removeAttribute("aria-sort"); });
+      th.setAttribute("aria-sort", ascending ? "ascending" : "descending");
+      var body = table.tBodies[0];
+      var rows = Array.prototype.slice.call(body.rows);
+      rows.sort(function (a, b) {
+        var x = a.cells[column], y = b.cells[column];
+        var order = x.hasAttribute("data-value")
+          ? Number(x.getAttribute("data-value")) - Number(y.getAttribute("data-value"))
+          : x.textContent.localeCompare(y.textContent);
+        return ascending ? order : -order;
+      });
+      rows.forEach(function (row) { body.appendChild(row); });
+    });
+  });
+});
+"#;
+
+/// Escapes text for use in HTML element content and attribute values.
+pub(crate) fn escape(text: &str) -> String {
+    let mut escaped = String::with_capacity(text.len());
+    for c in text.chars() {
+        match c {
+            '&' => escaped.push_str("&amp;"),
+            '<' => escaped.push_str("&lt;"),
+            '>' => escaped.push_str("&gt;"),
+            '"' => escaped.push_str("&quot;"),
+            '\'' => escaped.push_str("&#39;"),
+            _ => escaped.push(c),
+        }
+    }
+    escaped
+}
+
+/// Renders a numeric table cell that sorts by `value`.
+fn num(value: impl std::fmt::Display) -> String {
+    format!("<td class=\"num\" data-value=\"{value}\">{value}</td>")
+}
+
+/// Renders a percentage cell, or an empty one that sorts first when there is no ratio.
+fn percent(ratio: Option<f64>) -> String {
+    match ratio {
+        Some(ratio) => format!(
+            "<td class=\"num\" data-value=\"{ratio:.4}\">{:.1}%</td>",
+            ratio * 100.0
+        ),
+        None => "<td class=\"num\" data-value=\"-1\">-</td>".to_string(),
+    }
+}
+
+/// Renders a sortable table with the given header cells and body rows.
+///
+/// Headers starting with `#` are right-aligned numeric columns; the marker is
+/// not shown.
+fn table(headers: &[&str], rows: &[String]) -> String {
+    let mut output = String::from("<table class=\"sortable\">\n<thead><tr>");
+    for header in headers {
+        match header.strip_prefix('#') {
+            Some(header) => {
+                let _ = write!(output, "<th class=\"num\">{}</th>", escape(header));
+            }
+            None => {
+                let _ = write!(output, "<th>{}</th>", escape(header));
+            }
+        }
+    }
+    output.push_str("</tr></thead>\n<tbody>\n");
+    for row in rows {
+        output.push_str(row);
+        output.push('\n');
+    }
+    output.push_str("</tbody>\n</table>\n");
+    output
+}
+
+/// Renders the per-language summary table.
+fn language_table(stats: &DirectoryStats) -> String {
+    let mut languages: Vec<_> = stats.total_by_language.iter().collect();
+    languages.sort_by_key(|(language, _)| format!("{language:?}"));
+
+    let rows: Vec<String> = languages
+        .into_iter()
+        .map(|(language, lang_stats)| {
+            format!(
+                "<tr><td>{language:?}</td>{}{}{}{}{}{}{}</tr>",
+                num(lang_stats.file_count),
+                num(lang_stats.function_count),
+                num(lang_stats.class_struct_count),
+                num(lang_stats.lines.code),
+                num(lang_stats.lines.comment),
+                num(lang_stats.lines.blank),
+                percent(lang_stats.docs.ratio()),
+            )
+        })
+        .collect();
+
+    table(
+        &[
+            "Language",
+            "#Files",
+            "#Functions",
+            "#Structs/Classes",
+            "#Code",
+            "#Comments",
+            "#Blank",
+            "#Doc coverage",
+        ],
+        &rows,
+    )
+}
+
+/// Renders a bar chart of the files with the most lines.
+fn largest_files_chart(stats: &DirectoryStats) -> String {
+    let mut files: Vec<_> = stats.code_file_stats().collect();
+    files.sort_by(|a, b| {
+        b.stats
+            .lines
+            .total()
+            .cmp(&a.stats.lines.total())
+            .then_with(|| a.path.cmp(&b.path))
+    });
+    files.truncate(LARGEST_FILES);
+
+    let largest = files
+        .first()
+        .map_or(0, |file| file.stats.lines.total())
+        .max(1);
+    let mut output = String::from("<div class=\"chart\">\n");
+    for file in files {
+        let lines = file.stats.lines.total();
+        let path = escape(&file.path.display().to_string());
+        let _ = writeln!(
+            output,
+            "<div class=\"label\" title=\"{path}\">{path}</div><div class=\"bar\" style=\"width: {:.1}%\">{lines}</div>",
+            lines as f64 * 100.0 / largest as f64
+        );
+    }
+    output.push_str("</div>\n");
+    output
+}
+
+/// Renders the per-file table.
+fn file_table(stats: &DirectoryStats) -> String {
+    let mut files: Vec<_> = stats.files.iter().collect();
+    files.sort_by(|a, b| a.path.cmp(&b.path));
+
+    let rows: Vec<String> = files
+        .into_iter()
+        .map(|file| {
+            format!(
+                "<tr><td>{}</td><td>{:?}</td>{}{}{}{}{}{}{}</tr>",
+                escape(&file.path.display().to_string()),
+                file.language,
+                num(file.stats.function_count),
+                num(file.stats.class_struct_count),
+                num(file.stats.lines.code),
+                num(file.stats.lines.comment),
+                num(file.stats.lines.blank),
+                num(file.stats.max_complexity()),
+                num(file.stats.max_nesting()),
+            )
+        })
+        .collect();
+
+    table(
+        &[
+            "Path",
+            "Language",
+            "#Functions",
+            "#Structs/Classes",
+            "#Code",
+            "#Comments",
+            "#Blank",
+            "#Max complexity",
+            "#Max nesting",
+        ],
+        &rows,
+    )
+}
+
+/// Renders the per-function table, highlighting threshold violations.
+fn function_table(stats: &DirectoryStats, thresholds: &Thresholds) -> String {
+    let mut functions: Vec<FunctionRef> = stats.functions().collect();
+    functions.sort_by(|a, b| {
+        a.path
+            .cmp(b.path)
+            .then_with(|| a.function.start_line.cmp(&b.function.start_line))
+    });
+
+    let rows: Vec<String> = functions
+        .iter()
+        .map(|f| {
+            let over = f.function.complexity > thresholds.complexity
+                || f.function.line_count() > thresholds.function_lines;
+            format!(
+                "<tr{}><td>{}</td><td>{}</td>{}{}{}{}{}{}{}{}</tr>",
+                if over { " class=\"over\"" } else { "" },
+                escape(&f.path.display().to_string()),
+                escape(&f.function.qualified_name),
+                num(f.function.start_line),
+                num(f.function.line_count()),
+                num(f.function.parameters),
+                num(f.function.complexity),
+                num(f.function.max_nesting),
+                num(f.function.cognitive),
+                num(format!("{:.0}", f.function.halstead.volume)),
+                num(format!("{:.1}", f.function.maintainability)),
+            )
+        })
+        .collect();
+
+    table(
+        &[
+            "Path",
+            "Function",
+            "#Line",
+            "#Lines",
+            "#Params",
+            "#Complexity",
+            "#Nesting",
+            "#Cognitive",
+            "#Volume",
+            "#MI",
+        ],
+        &rows,
+    )
+}
+
+/// Formats directory statistics as a standalone HTML document.
+///
+/// Functions above either threshold are highlighted in the function table.
+///
+/// # Arguments
+///
+/// * `stats` - Directory statistics to report
+/// * `thresholds` - Limits used to highlight offending functions
+///
+/// # Returns
+///
+/// A complete HTML document with embedded styles and scripts
+pub(crate) fn format_html(stats: &DirectoryStats, thresholds: &Thresholds) -> String {
+    let totals = &stats.total_stats;
+    let mut output = String::from("<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n");
+    output.push_str("<meta charset=\"utf-8\">\n<title>Code statistics</title>\n");
+    let _ = write!(output, "<style>{STYLE}</style>\n</head>\n<body>\n");
+    let _ = writeln!(
+        output,
+        "<h1>Code statistics</h1>\n<p>Generated by code-stats-rs {}</p>",
+        env!("CARGO_PKG_VERSION")
+    );
+
+    output.push_str("<ul class=\"totals\">\n");
+    let doc_coverage = totals
+        .docs
+        .ratio()
+        .map_or_else(|| "-".to_string(), |ratio| format!("{:.1}%", ratio * 100.0));
+    for (label, value) in [
+        ("Files", stats.code_files().to_string()),
+        ("Functions", totals.function_count.to_string()),
+        ("Structs/Classes", totals.class_struct_count.to_string()),
+        ("Code lines", totals.lines.code.to_string()),
+        ("Max complexity", stats.max_complexity().to_string()),
+        ("Mean complexity", format!("{:.2}", stats.mean_complexity())),
+        ("Doc coverage", doc_coverage),
+    ] {
+        let _ = writeln!(output, "<li><strong>{value}</strong>{label}</li>");
+    }
+    output.push_str("</ul>\n");
+
+    output.push_str("<h2>Languages</h2>\n");
+    output.push_str(&language_table(stats));
+    output.push_str("<h2>Largest files</h2>\n");
+    output.push_str(&largest_files_chart(stats));
+    output.push_str("<h2>Files</h2>\n");
+    output.push_str(&file_table(stats));
+    let _ = writeln!(
+        output,
+        "<h2>Functions</h2>\n<p>Highlighted rows exceed a complexity of {} or {} lines.</p>",
+        thresholds.complexity, thresholds.function_lines
+    );
+    output.push_str(&function_table(stats, thresholds));
+
+    let _ = write!(output, "<script>{SCRIPT}</script>\n</body>\n</html>");
+    output
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::FunctionStats;
+    use crate::stats::test_support::file_with as file;
+
+    fn function(
+        name: &str,
+        start_line: usize,
+        end_line: usize,
+        complexity: usize,
+    ) -> FunctionStats {
+        FunctionStats {
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            start_line,
+            end_line,
+            complexity,
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn test_html_report_sections() {
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file("src/small.rs", 10, vec![function("tidy", 1, 5, 2)]));
+        stats.add_file(file(
+            "src/<big>.rs",
+            40,
+            vec![function("Parser::tangled", 3, 30, 12)],
+        ));
+        let thresholds = Thresholds {
+            complexity: 10,
+            function_lines: 50,
+        };
+
+        let html = format_html(&stats, &thresholds);
+        assert!(html.starts_with("<!DOCTYPE html>"));
+        assert!(html.ends_with("</html>"));
+        assert!(html.contains("<style>") && html.contains("<script>"));
+        assert!(html.contains("<h2>Languages</h2>"));
+        assert!(html.contains("<tr><td>Rust</td><td class=\"num\" data-value=\"2\">2</td>"));
+        // Paths are escaped and the largest file gets the full-width bar
+        assert!(html.contains(
+            "<div class=\"label\" title=\"src/&lt;big&gt;.rs\">src/&lt;big&gt;.rs</div><div class=\"bar\" style=\"width: 100.0%\">40</div>"
+        ));
+        assert!(html.contains("style=\"width: 25.0%\">10</div>"));
+        assert!(
+            html.contains("<tr class=\"over\"><td>src/&lt;big&gt;.rs</td><td>Parser::tangled</td>")
+        );
+        assert!(html.contains("<tr><td>src/small.rs</td><td>tidy</td>"));
+        assert!(!html.contains("<big>"));
+    }
+
+    #[test]
+    fn test_html_report_without_files() {
+        let html = format_html(&DirectoryStats::new(), &Thresholds::default());
+        assert!(html.contains("<strong>0</strong>Files"));
+        assert!(html.contains("<strong>-</strong>Doc coverage"));
+    }
+
+    #[test]
+    fn test_escape() {
+        assert_eq!(escape(r#"a<b>&"c'"#), "a&lt;b&gt;&amp;&quot;c&#39;");
+    }
+}
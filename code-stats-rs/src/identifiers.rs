@@ -0,0 +1,511 @@
+//! Identifier naming statistics for `--identifiers`.
+//!
+//! Only the names a file declares are measured, each once per scope: a
+//! variable used fifty times says no more about naming than one used once.
+//! Declarations are the identifiers named by a declaration, definition, or
+//! assignment (`name`, `pattern`, `declarator`, or the left side of an
+//! assignment) and parameters; uses, member accesses, and keyword arguments
+//! are not. Scopes are functions, the rest of the file being one scope.
+//!
+//! Single-letter names are counted for the variables and parameters of
+//! functions only, and apart when they are bound by a loop header
+//! (`for i := range items`, list comprehensions), where they are idiomatic.
+//! Go method receivers, which are conventionally one letter, and `_` are not
+//! counted at all.
+
+use crate::analyzer::{CodeAnalyzer, DirectoryOptions};
+use crate::complexity::is_function;
+use crate::error::Result;
+use crate::language::SupportedLanguage;
+use crate::origin::{is_generated, is_vendored};
+use serde::Serialize;
+use std::collections::{BTreeMap, HashSet};
+use std::path::{Path, PathBuf};
+use tree_sitter::Node;
+
+/// Number of longest identifiers listed.
+pub(crate) const LONGEST_COUNT: usize = 10;
+
+/// Node kinds of identifiers across the supported grammars.
+const IDENTIFIER_KINDS: [&str; 8] = [
+    "identifier",
+    "simple_identifier",
+    "field_identifier",
+    "property_identifier",
+    "shorthand_property_identifier_pattern",
+    "type_identifier",
+    "constant",
+    "name",
+];
+
+/// Fields of a declaration naming what it declares.
+const BINDING_FIELDS: [&str; 4] = ["name", "pattern", "declarator", "left"];
+
+/// Fields of a parameter or pattern holding something other than a binding.
+const VALUE_FIELDS: [&str; 6] = ["type", "value", "right", "default", "default_value", "body"];
+
+/// Node kinds whose name is a type rather than a variable or function.
+const TYPE_WORDS: [&str; 12] = [
+    "class",
+    "struct",
+    "enum",
+    "interface",
+    "trait",
+    "type",
+    "module",
+    "impl",
+    "union",
+    "protocol",
+    "object",
+    "record",
+];
+
+/// A declared identifier at its first declaration.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct Identifier {
+    /// File declaring the identifier
+    pub path: PathBuf,
+    /// 1-based line of the declaration
+    pub line: usize,
+    pub name: String,
+    /// Length in characters
+    pub length: usize,
+}
+
+/// Naming statistics of the files of one language.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub(crate) struct LanguageIdentifiers {
+    pub language: SupportedLanguage,
+    /// Identifiers declared, once per scope
+    pub declared: usize,
+    /// Mean length of the declared identifiers in characters
+    pub average_length: f64,
+    /// Single-letter variables and parameters outside loop headers
+    pub single_letter: usize,
+    /// Single-letter variables bound by loop headers
+    pub single_letter_in_loops: usize,
+}
+
+/// Naming statistics of an analyzed file or directory.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub(crate) struct IdentifierReport {
+    /// Statistics per language, by language name
+    pub languages: Vec<LanguageIdentifiers>,
+    /// The `LONGEST_COUNT` longest identifiers, longest first
+    pub longest: Vec<Identifier>,
+    /// Single-letter variables and parameters outside loop headers, in file
+    /// and source order
+    pub single_letter: Vec<Identifier>,
+}
+
+/// How a declared identifier is bound.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Binding {
+    /// A function, type, field, or other named declaration
+    Declaration,
+    /// A variable or parameter of a function
+    Variable,
+    /// A variable bound by the header of a loop
+    LoopVariable,
+}
+
+/// Running totals of one language.
+#[derive(Default)]
+struct Totals {
+    declared: usize,
+    length: usize,
+    single_letter: usize,
+    single_letter_in_loops: usize,
+}
+
+/// Collects the naming statistics of a file or of every supported file below
+/// a directory.
+///
+/// Files are read and skipped as described in `CodeAnalyzer::visit_sources`;
+/// configuration files and documents declare no identifiers, and generated
+/// and vendored files are skipped unless `--include-generated` is given.
+///
+/// # Arguments
+///
+/// * `analyzer` - Analyzer providing the parsers
+/// * `path` - File or directory to scan
+/// * `options` - Traversal and exclusion settings for directories
+pub(crate) fn collect_identifiers(
+    analyzer: &mut CodeAnalyzer,
+    path: &Path,
+    options: &DirectoryOptions,
+) -> Result<IdentifierReport> {
+    let mut totals: BTreeMap<String, (SupportedLanguage, Totals)> = BTreeMap::new();
+    let mut longest = Vec::new();
+    let mut single_letter = Vec::new();
+    analyzer.visit_sources(path, options, |analyzer, file, language, source_code| {
+        let relative = match file.strip_prefix(path) {
+            Ok(relative) if !relative.as_os_str().is_empty() => relative,
+            _ => file.file_name().map_or(file, Path::new),
+        };
+        if language.is_configuration()
+            || matches!(
+                language,
+                SupportedLanguage::Markdown
+                    | SupportedLanguage::Sql
+                    | SupportedLanguage::Dockerfile
+                    | SupportedLanguage::Html
+                    | SupportedLanguage::Vue
+                    | SupportedLanguage::Svelte
+                    | SupportedLanguage::Jinja
+                    | SupportedLanguage::GoTemplate
+                    | SupportedLanguage::Erb
+                    | SupportedLanguage::Graphql
+                    | SupportedLanguage::Hcl
+                    | SupportedLanguage::Css
+                    | SupportedLanguage::Scss
+                    | SupportedLanguage::Jupyter
+            )
+            || (!options.include_generated
+                && (is_generated(file, source_code) || is_vendored(relative)))
+        {
+            return Ok(());
+        }
+        let tree = analyzer.parse(file, language, source_code)?;
+        let (_, language_totals) = totals
+            .entry(format!("{language:?}"))
+            .or_insert_with(|| (language, Totals::default()));
+        for (line, name, binding) in declared_identifiers(&tree.root_node(), source_code, &language)
+        {
+            let identifier = Identifier {
+                path: file.to_path_buf(),
+                line,
+                length: name.chars().count(),
+                name,
+            };
+            language_totals.declared += 1;
+            language_totals.length += identifier.length;
+            if identifier.length == 1 && identifier.name != "_" {
+                match binding {
+                    Binding::Variable => {
+                        language_totals.single_letter += 1;
+                        single_letter.push(identifier.clone());
+                    }
+                    Binding::LoopVariable => language_totals.single_letter_in_loops += 1,
+                    Binding::Declaration => {}
+                }
+            }
+            longest.push(identifier);
+            // Keep the list short while scanning large trees
+            if longest.len() > LONGEST_COUNT * 8 {
+                keep_longest(&mut longest);
+            }
+        }
+        Ok(())
+    })?;
+    keep_longest(&mut longest);
+
+    Ok(IdentifierReport {
+        languages: totals
+            .into_values()
+            .filter(|(_, totals)| totals.declared > 0)
+            .map(|(language, totals)| LanguageIdentifiers {
+                language,
+                declared: totals.declared,
+                average_length: totals.length as f64 / totals.declared as f64,
+                single_letter: totals.single_letter,
+                single_letter_in_loops: totals.single_letter_in_loops,
+            })
+            .collect(),
+        longest,
+        single_letter,
+    })
+}
+
+/// Sorts identifiers longest first, then by path and line, and keeps the
+/// first `LONGEST_COUNT`.
+fn keep_longest(identifiers: &mut Vec<Identifier>) {
+    identifiers.sort_by(|a, b| {
+        b.length
+            .cmp(&a.length)
+            .then_with(|| a.path.cmp(&b.path))
+            .then_with(|| a.line.cmp(&b.line))
+    });
+    identifiers.truncate(LONGEST_COUNT);
+}
+
+/// Returns the line, name, and binding of every identifier declared in a
+/// parsed file, once per scope, in source order.
+fn declared_identifiers(
+    root: &Node,
+    source: &str,
+    language: &SupportedLanguage,
+) -> Vec<(usize, String, Binding)> {
+    let mut seen = HashSet::new();
+    let mut identifiers = Vec::new();
+    let mut stack = vec![*root];
+    while let Some(node) = stack.pop() {
+        if IDENTIFIER_KINDS.contains(&node.kind()) {
+            if let Some(binding) = binding(&node, source.as_bytes(), language) {
+                let name = source[node.byte_range()].trim_start_matches('$');
+                let scope = scope_of(&node, source.as_bytes(), language);
+                if !name.is_empty() && seen.insert((scope, name.to_string())) {
+                    identifiers.push((node.start_position().row + 1, name.to_string(), binding));
+                }
+            }
+            continue;
+        }
+        let mut cursor = node.walk();
+        let children: Vec<Node> = node.named_children(&mut cursor).collect();
+        stack.extend(children.into_iter().rev());
+    }
+    identifiers.sort_by_key(|(line, _, _)| *line);
+    identifiers
+}
+
+/// Returns how `identifier` is bound, or `None` if it is not declared where
+/// it appears.
+fn binding(identifier: &Node, source: &[u8], language: &SupportedLanguage) -> Option<Binding> {
+    let mut child = *identifier;
+    while let Some(parent) = child.parent() {
+        let kind = parent.kind();
+        if in_fields(&parent, &child, &VALUE_FIELDS) {
+            return None;
+        }
+        if kind.contains("parameter") && !kind.contains("type_parameter") {
+            return (!is_go_receiver(&parent, language)).then_some(Binding::Variable);
+        }
+        // Kotlin's grammar has no fields: its declarations hold their name
+        // directly, or in a `variable_declaration`
+        let named = in_fields(&parent, &child, &BINDING_FIELDS)
+            || (*language == SupportedLanguage::Kotlin
+                && (child.id() == identifier.id() || child.kind() == "variable_declaration"));
+        if named && is_declaring(kind) {
+            return Some(classify(identifier, &parent, source, language));
+        }
+        // Patterns, lists of names, and C declarators wrap the declared name
+        let wrapper = kind.contains("pattern")
+            || kind.ends_with("_list")
+            || kind.ends_with("declarator")
+            || kind == "variable_name"
+            || kind == "variable_declaration";
+        if !wrapper {
+            return None;
+        }
+        child = parent;
+    }
+    None
+}
+
+/// Returns true for node kinds whose name, pattern, or left side is declared
+/// by them, as opposed to uses such as `a.b`, `f(name=1)`, or `x + y`.
+fn is_declaring(kind: &str) -> bool {
+    [
+        "declaration",
+        "definition",
+        "declarator",
+        "_item",
+        "_spec",
+        "signature",
+    ]
+    .iter()
+    .any(|suffix| kind.ends_with(suffix))
+        || kind.contains("assignment") && !kind.contains("augmented")
+        || is_loop(kind)
+        || matches!(
+            kind,
+            "class"
+                | "module"
+                | "method"
+                | "singleton_method"
+                | "short_var_declaration"
+                | "range_clause"
+                | "let_condition"
+                | "struct_specifier"
+                | "enum_specifier"
+                | "union_specifier"
+        )
+}
+
+/// Classifies an identifier declared by `declaration`.
+fn classify(
+    identifier: &Node,
+    declaration: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> Binding {
+    let kind = declaration.kind();
+    if matches!(identifier.kind(), "type_identifier" | "constant")
+        || is_function(declaration, source, language)
+        || kind.contains("function")
+        || kind.contains("method")
+        || TYPE_WORDS.iter().any(|word| kind.contains(word))
+    {
+        return Binding::Declaration;
+    }
+    // The loop itself, as in Python's `for x in`, or a declaration in its
+    // header rather than its body
+    if is_loop(kind) {
+        return Binding::LoopVariable;
+    }
+    let mut child = *declaration;
+    while let Some(parent) = child.parent() {
+        if is_function(&parent, source, language) {
+            return Binding::Variable;
+        }
+        if is_loop(parent.kind())
+            && !child.kind().contains("body")
+            && !child.kind().contains("block")
+            && !in_fields(&parent, &child, &["body", "alternative"])
+        {
+            return Binding::LoopVariable;
+        }
+        child = parent;
+    }
+    // Top-level variables, constants, and fields
+    Binding::Declaration
+}
+
+/// Returns true for the kinds of loops and comprehension clauses.
+fn is_loop(kind: &str) -> bool {
+    kind == "for"
+        || kind.starts_with("for_")
+        || kind.starts_with("foreach")
+        || kind.contains("_for_")
+        || kind.starts_with("while_")
+}
+
+/// Returns true if `child` is one of the nodes of `parent` in `fields`.
+fn in_fields(parent: &Node, child: &Node, fields: &[&str]) -> bool {
+    fields.iter().any(|field| {
+        let mut cursor = parent.walk();
+        parent
+            .children_by_field_name(field, &mut cursor)
+            .any(|node| node.id() == child.id())
+    })
+}
+
+/// Returns true for the receiver of a Go method, which is conventionally a
+/// single letter.
+fn is_go_receiver(parameter: &Node, language: &SupportedLanguage) -> bool {
+    *language == SupportedLanguage::Go
+        && parameter
+            .parent()
+            .and_then(|list| list.parent().map(|method| (list, method)))
+            .is_some_and(|(list, method)| {
+                method.kind() == "method_declaration" && in_fields(&method, &list, &["receiver"])
+            })
+}
+
+/// Returns the id of the innermost function containing `node`, or 0 for the
+/// top level of the file.
+fn scope_of(node: &Node, source: &[u8], language: &SupportedLanguage) -> usize {
+    let mut ancestor = node.parent();
+    while let Some(current) = ancestor {
+        if is_function(&current, source, language) {
+            return current.id();
+        }
+        ancestor = current.parent();
+    }
+    0
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::create_parser;
+
+    fn declared(source: &str, language: SupportedLanguage) -> Vec<(String, Binding)> {
+        let mut parser = create_parser(&language).unwrap();
+        let tree = parser.parse(source, None).unwrap();
+        declared_identifiers(&tree.root_node(), source, &language)
+            .into_iter()
+            .map(|(_, name, binding)| (name, binding))
+            .collect()
+    }
+
+    #[test]
+    fn test_go_declarations_and_loops() {
+        let source = r#"
+package geo
+
+type Point struct {
+    X, Y float64
+}
+
+func (p Point) Scale(f float64) Point {
+    for i := 0; i < 2; i++ {
+        f *= 2
+    }
+    q := Point{X: p.X * f}
+    return q
+}
+"#;
+        let names = declared(source, SupportedLanguage::Go);
+        assert!(names.contains(&("Point".to_string(), Binding::Declaration)));
+        assert!(names.contains(&("Scale".to_string(), Binding::Declaration)));
+        assert!(names.contains(&("f".to_string(), Binding::Variable)));
+        assert!(names.contains(&("i".to_string(), Binding::LoopVariable)));
+        assert!(names.contains(&("q".to_string(), Binding::Variable)));
+        // The receiver and the uses of p.X are not counted
+        assert!(!names.iter().any(|(name, _)| name == "p"));
+        assert_eq!(names.iter().filter(|(name, _)| name == "X").count(), 1);
+    }
+
+    #[test]
+    fn test_python_scopes_and_comprehensions() {
+        let source = r#"
+def total(items):
+    t = 0
+    t = t + sum(x.price for x in items)
+    return t
+
+def other(t):
+    print(t, end="")
+"#;
+        let names = declared(source, SupportedLanguage::Python);
+        // t is declared once in each function; x is bound by the comprehension
+        assert_eq!(
+            names,
+            [
+                ("total".to_string(), Binding::Declaration),
+                ("items".to_string(), Binding::Variable),
+                ("t".to_string(), Binding::Variable),
+                ("x".to_string(), Binding::LoopVariable),
+                ("other".to_string(), Binding::Declaration),
+                ("t".to_string(), Binding::Variable),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_rust_patterns_and_loops() {
+        let source = r#"
+fn parse(input: &str) -> Vec<u32> {
+    let (a, rest) = input.split_at(1);
+    for c in rest.chars() {
+        let _ = c;
+    }
+    vec![a.len() as u32]
+}
+"#;
+        let names = declared(source, SupportedLanguage::Rust);
+        assert!(names.contains(&("input".to_string(), Binding::Variable)));
+        assert!(names.contains(&("a".to_string(), Binding::Variable)));
+        assert!(names.contains(&("rest".to_string(), Binding::Variable)));
+        assert!(names.contains(&("c".to_string(), Binding::LoopVariable)));
+    }
+
+    #[test]
+    fn test_keep_longest() {
+        let identifier = |name: &str, line| Identifier {
+            path: PathBuf::from("a.rs"),
+            line,
+            name: name.to_string(),
+            length: name.len(),
+        };
+        let mut identifiers: Vec<Identifier> = (0..LONGEST_COUNT + 2)
+            .map(|line| identifier("ab", line))
+            .collect();
+        identifiers.push(identifier("longest_name", 99));
+        keep_longest(&mut identifiers);
+        assert_eq!(identifiers.len(), LONGEST_COUNT);
+        assert_eq!(identifiers[0].name, "longest_name");
+        assert_eq!(identifiers[1].line, 0);
+    }
+}
@@ -0,0 +1,827 @@
+//! Import, require, and use statements, and the module dependency graph that
+//! `--deps` builds from them.
+//!
+//! Each file records the modules it imports as written. The graph resolves
+//! them against the analyzed files: relative imports (`./cart`, `from . import
+//! x`, `#include "cart.h"`, `require_relative`, `super::`) by path, Rust
+//! `crate::` paths from the crate's `src` directory, Go import paths by the
+//! module path in the root's `go.mod`, and Java, Kotlin, PHP, Ruby, and
+//! absolute Python imports by the file their name maps to. Anything else is
+//! an external module, named by its package (`react`, `serde`, `java.util`).
+//!
+//! Go files form one module per directory, their package; every other file
+//! is a module of its own.
+
+use crate::language::SupportedLanguage;
+use crate::stats::DirectoryStats;
+use serde::Serialize;
+use std::collections::{BTreeMap, BTreeSet, HashMap, HashSet};
+use std::path::{Component, Path};
+use tree_sitter::Node;
+
+/// Extensions tried, in order, for a JavaScript or TypeScript import without
+/// one.
+pub(crate) const SCRIPT_EXTENSIONS: [&str; 6] = ["ts", "tsx", "js", "jsx", "mjs", "cjs"];
+
+/// Module dependencies of the analyzed files.
+#[derive(Debug, Default, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct DependencyGraph {
+    /// Every module, the analyzed ones first, each group ordered by name
+    pub modules: Vec<Module>,
+    /// Imports between modules, ordered by importing, then imported module
+    pub dependencies: Vec<Dependency>,
+    /// Groups of analyzed modules that import each other, directly or
+    /// through other modules of the group, each ordered by name
+    pub cycles: Vec<Vec<String>>,
+}
+
+/// A node of the dependency graph.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct Module {
+    /// Path relative to the analyzed root (a directory for Go packages), or
+    /// the package name of an external module
+    pub name: String,
+    /// True for modules among the analyzed files
+    pub internal: bool,
+}
+
+/// An edge of the dependency graph: `from` imports `to`.
+#[derive(Debug, Clone, PartialEq, Eq, PartialOrd, Ord, Serialize)]
+pub(crate) struct Dependency {
+    pub from: String,
+    pub to: String,
+}
+
+impl DependencyGraph {
+    /// Returns true if both modules belong to the same cycle.
+    pub(crate) fn in_cycle(&self, from: &str, to: &str) -> bool {
+        self.cycles.iter().any(|cycle| {
+            cycle.iter().any(|name| name == from) && cycle.iter().any(|name| name == to)
+        })
+    }
+}
+
+/// Lists the modules a file imports, as written, in source order and
+/// without duplicates.
+///
+/// C and C++ includes keep their delimiters (`"cart.h"` or `<stdio.h>`), and
+/// Ruby's `require_relative` paths are prefixed with `./`, so that resolution
+/// can tell local files from libraries.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the tree parsed from `source`
+/// * `source` - The file's contents
+/// * `language` - The file's language; languages without imports yield none
+pub(crate) fn imports(root: &Node, source: &[u8], language: &SupportedLanguage) -> Vec<String> {
+    let mut found = Vec::new();
+    collect(root, source, language, 0, &mut found);
+    let mut seen = HashSet::new();
+    found.retain(|spec| !spec.is_empty() && seen.insert(spec.clone()));
+    found
+}
+
+/// Collects the imports below `node`, which is inside `inline_modules`
+/// Rust `mod name { ... }` blocks of the file.
+fn collect(
+    node: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+    inline_modules: usize,
+    found: &mut Vec<String>,
+) {
+    let mut inline_modules = inline_modules;
+    collect_node(node, source, language, &mut inline_modules, found);
+
+    let mut cursor = node.walk();
+    for child in node.named_children(&mut cursor) {
+        collect(&child, source, language, inline_modules, found);
+    }
+}
+
+/// Adds the modules `node` itself imports to `found`, counting the inline
+/// Rust module it opens in `inline_modules`.
+fn collect_node(
+    node: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+    inline_modules: &mut usize,
+    found: &mut Vec<String>,
+) {
+    language
+        .rules()
+        .collect_imports(node, source, inline_modules, found)
+}
+
+/// Expands the argument of a Rust `use` declaration into one path per
+/// imported item: `use a::{b, c::d}` imports `a::b` and `a::c::d`.
+pub(crate) fn use_paths(node: &Node, source: &[u8], prefix: &str, found: &mut Vec<String>) {
+    let text = |node: &Node| node.utf8_text(source).unwrap_or_default();
+    let join = |path: &str| {
+        let path = path.trim_start_matches("::");
+        match (prefix, path) {
+            ("", _) => path.to_string(),
+            (_, "self") => prefix.to_string(),
+            _ => format!("{prefix}::{path}"),
+        }
+    };
+    match node.kind() {
+        "scoped_use_list" => {
+            let path = node
+                .child_by_field_name("path")
+                .map_or_else(|| prefix.to_string(), |path| join(text(&path)));
+            if let Some(list) = node.child_by_field_name("list") {
+                use_paths(&list, source, &path, found);
+            }
+        }
+        "use_list" => {
+            let mut cursor = node.walk();
+            for child in node.named_children(&mut cursor) {
+                use_paths(&child, source, prefix, found);
+            }
+        }
+        "use_as_clause" => {
+            if let Some(path) = node.child_by_field_name("path") {
+                use_paths(&path, source, prefix, found);
+            }
+        }
+        "use_wildcard" => {
+            let mut cursor = node.walk();
+            if let Some(path) = node.named_children(&mut cursor).next() {
+                use_paths(&path, source, prefix, found);
+            } else if !prefix.is_empty() {
+                found.push(prefix.to_string());
+            }
+        }
+        _ => found.push(join(text(node))),
+    }
+}
+
+/// Returns the first argument of a call if it is a string literal of one of
+/// `kinds`.
+pub(crate) fn string_argument<'a>(call: &Node<'a>, kinds: &[&str]) -> Option<Node<'a>> {
+    let arguments = call.child_by_field_name("arguments")?;
+    let mut cursor = arguments.walk();
+    let first = arguments.named_children(&mut cursor).next()?;
+    kinds.contains(&first.kind()).then_some(first)
+}
+
+/// Strips the quotes around a string literal.
+pub(crate) fn unquote(literal: &str) -> String {
+    literal
+        .trim_matches(|c| matches!(c, '"' | '\'' | '`'))
+        .to_string()
+}
+
+/// Builds the dependency graph of the files counted in the code totals.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics of the files below `root`, with their imports
+/// * `root` - The analyzed directory, which module names are relative to
+pub(crate) fn dependency_graph(stats: &DirectoryStats, root: &Path) -> DependencyGraph {
+    let index = Index::new(stats, root);
+    let mut modules: BTreeMap<String, bool> = BTreeMap::new();
+    let mut edges: BTreeSet<Dependency> = BTreeSet::new();
+    for file in stats.code_file_stats() {
+        let relative = slash_path(file.path.strip_prefix(root).unwrap_or(&file.path));
+        let from = module_of(&relative, file.language);
+        modules.insert(from.clone(), true);
+        for spec in &file.stats.imports {
+            let (to, internal) = index.resolve(&relative, file.language, spec);
+            if to == from {
+                continue;
+            }
+            *modules.entry(to.clone()).or_default() |= internal;
+            edges.insert(Dependency {
+                from: from.clone(),
+                to,
+            });
+        }
+    }
+
+    let internal: Vec<String> = modules
+        .iter()
+        .filter(|(_, internal)| **internal)
+        .map(|(name, _)| name.clone())
+        .collect();
+    let cycles = cycles(&internal, &edges);
+    let mut modules: Vec<Module> = modules
+        .into_iter()
+        .map(|(name, internal)| Module { name, internal })
+        .collect();
+    modules.sort_by(|a, b| {
+        b.internal
+            .cmp(&a.internal)
+            .then_with(|| a.name.cmp(&b.name))
+    });
+    DependencyGraph {
+        modules,
+        dependencies: edges.into_iter().collect(),
+        cycles,
+    }
+}
+
+/// Name of the module a file belongs to: its directory for Go, where a
+/// package spans a directory, and its own path otherwise.
+fn module_of(relative: &str, language: SupportedLanguage) -> String {
+    if language == SupportedLanguage::Go {
+        let directory = parent(relative);
+        return if directory.is_empty() {
+            ".".to_string()
+        } else {
+            directory.to_string()
+        };
+    }
+    relative.to_string()
+}
+
+/// The analyzed files, for resolving imports to them.
+pub(crate) struct Index {
+    /// Paths relative to the root, with `/` separators
+    files: HashSet<String>,
+    /// Paths by file stem, for finding a file by the end of its path
+    by_stem: HashMap<String, Vec<String>>,
+    /// Directories containing Go files
+    pub(crate) go_packages: BTreeSet<String>,
+    /// Module path declared in the root's `go.mod`
+    pub(crate) go_module: Option<String>,
+}
+
+impl Index {
+    fn new(stats: &DirectoryStats, root: &Path) -> Self {
+        let mut index = Index {
+            files: HashSet::new(),
+            by_stem: HashMap::new(),
+            go_packages: BTreeSet::new(),
+            go_module: go_module_path(root),
+        };
+        for file in stats.code_file_stats() {
+            let relative = slash_path(file.path.strip_prefix(root).unwrap_or(&file.path));
+            if file.language == SupportedLanguage::Go {
+                index
+                    .go_packages
+                    .insert(module_of(&relative, file.language));
+            }
+            index
+                .by_stem
+                .entry(file_stem(&relative).to_string())
+                .or_default()
+                .push(relative.clone());
+            index.files.insert(relative);
+        }
+        for paths in index.by_stem.values_mut() {
+            paths.sort_by(|a, b| a.len().cmp(&b.len()).then_with(|| a.cmp(b)));
+        }
+        index
+    }
+
+    /// Resolves an import of the file at `relative` to the imported module
+    /// and whether it is one of the analyzed files.
+    fn resolve(&self, relative: &str, language: SupportedLanguage, spec: &str) -> (String, bool) {
+        language.rules().resolve_import(self, relative, spec)
+    }
+
+    /// Resolves a Python import: relative ones from the file's package,
+    /// absolute ones from the file's directory or any directory above it,
+    /// trying ever shorter prefixes of the dotted name.
+    pub(crate) fn resolve_python(&self, directory: &str, spec: &str) -> (String, bool) {
+        let dots = spec.len() - spec.trim_start_matches('.').len();
+        let segments: Vec<&str> = spec[dots..].split('.').filter(|s| !s.is_empty()).collect();
+        let candidates = |base: &str, segments: &[&str]| {
+            let path = join(base, &segments.join("/"));
+            [format!("{path}.py"), join(&path, "__init__.py")]
+        };
+
+        if dots > 0 {
+            let mut base = directory;
+            for _ in 1..dots {
+                base = parent(base);
+            }
+            if segments.is_empty() {
+                let init = join(base, "__init__.py");
+                return (init, true);
+            }
+            let [module, package] = candidates(base, &segments);
+            return (
+                self.first_file([module.clone(), package]).unwrap_or(module),
+                true,
+            );
+        }
+
+        let mut base = directory;
+        loop {
+            for end in (1..=segments.len()).rev() {
+                if let Some(path) = self.first_file(candidates(base, &segments[..end])) {
+                    return (path, true);
+                }
+            }
+            if base.is_empty() {
+                break;
+            }
+            base = parent(base);
+        }
+        (segments.first().copied().unwrap_or(spec).to_string(), false)
+    }
+
+    /// Resolves a Rust `use` path: `crate::` from the crate's `src`
+    /// directory, `self::` and `super::` from the file's module, and other
+    /// paths as crate-root modules before taking them as external crates.
+    pub(crate) fn resolve_rust(&self, relative: &str, spec: &str) -> (String, bool) {
+        let segments: Vec<&str> = spec.split("::").collect();
+        let crate_dir = rust_crate_dir(relative);
+        let (base, rest, local) = match segments[0] {
+            "crate" => (crate_dir.to_string(), &segments[1..], true),
+            "self" => (rust_module_dir(relative), &segments[1..], true),
+            "super" => {
+                let supers = segments.iter().take_while(|s| **s == "super").count();
+                let mut base = rust_module_dir(relative);
+                for _ in 0..supers {
+                    base = parent(&base).to_string();
+                }
+                (base, &segments[supers..], true)
+            }
+            _ => (crate_dir.to_string(), &segments[..], false),
+        };
+
+        for end in (1..=rest.len()).rev() {
+            let path = join(&base, &rest[..end].join("/"));
+            if let Some(found) = self.first_file([format!("{path}.rs"), join(&path, "mod.rs")]) {
+                return (found, true);
+            }
+        }
+        if !local {
+            return (segments[0].to_string(), false);
+        }
+        // An item of the module at `base` itself
+        let module = if segments[0] == "self" {
+            Some(relative.to_string())
+        } else {
+            self.first_file([
+                format!("{base}.rs"),
+                join(&base, "mod.rs"),
+                join(&base, "lib.rs"),
+                join(&base, "main.rs"),
+            ])
+        };
+        (module.unwrap_or_else(|| relative.to_string()), true)
+    }
+
+    /// Returns the first candidate path that is an analyzed file.
+    pub(crate) fn first_file(
+        &self,
+        candidates: impl IntoIterator<Item = String>,
+    ) -> Option<String> {
+        candidates
+            .into_iter()
+            .find(|candidate| self.files.contains(candidate))
+    }
+
+    /// Returns the shortest analyzed path that ends with `path` and one of
+    /// `extensions`, e.g. `src/main/java/shop/Cart.java` for `shop/Cart`.
+    pub(crate) fn by_suffix(&self, path: &str, extensions: &[&str]) -> Option<String> {
+        let stem = path.rsplit('/').next().unwrap_or(path);
+        self.by_stem.get(stem)?.iter().find_map(|candidate| {
+            let (without, ext) = candidate.rsplit_once('.')?;
+            let matches = extensions.contains(&ext)
+                && (without == path || without.ends_with(&format!("/{path}")));
+            matches.then(|| candidate.clone())
+        })
+    }
+}
+
+/// Reads the module path from the `go.mod` file in `root`, if there is one.
+fn go_module_path(root: &Path) -> Option<String> {
+    let go_mod = std::fs::read_to_string(root.join("go.mod")).ok()?;
+    go_mod.lines().find_map(|line| {
+        line.trim()
+            .strip_prefix("module ")
+            .map(|path| unquote(path.trim()))
+    })
+}
+
+/// The directory holding a Rust crate's modules: the nearest `src`
+/// directory above the file, or the file's own directory.
+fn rust_crate_dir(relative: &str) -> &str {
+    let mut directory = parent(relative);
+    loop {
+        if directory.rsplit('/').next() == Some("src") {
+            return directory;
+        }
+        if directory.is_empty() {
+            return parent(relative);
+        }
+        directory = parent(directory);
+    }
+}
+
+/// The directory holding the submodules of a Rust file's module: its own
+/// directory for `mod.rs`, `lib.rs`, and `main.rs`, and a directory named like
+/// the file otherwise.
+fn rust_module_dir(relative: &str) -> String {
+    let name = relative.rsplit('/').next().unwrap_or(relative);
+    if matches!(name, "mod.rs" | "lib.rs" | "main.rs") {
+        parent(relative).to_string()
+    } else {
+        join(parent(relative), file_stem(relative))
+    }
+}
+
+/// Converts a relative path to `/`-separated form.
+pub(crate) fn slash_path(path: &Path) -> String {
+    path.components()
+        .filter_map(|component| match component {
+            Component::Normal(name) => Some(name.to_string_lossy()),
+            _ => None,
+        })
+        .collect::<Vec<_>>()
+        .join("/")
+}
+
+/// Returns the directory part of a `/`-separated path, empty at the root.
+pub(crate) fn parent(path: &str) -> &str {
+    path.rsplit_once('/').map_or("", |(parent, _)| parent)
+}
+
+/// Returns the file name of a `/`-separated path up to its first dot.
+fn file_stem(path: &str) -> &str {
+    let name = path.rsplit('/').next().unwrap_or(path);
+    match name.rsplit_once('.') {
+        Some((stem, _)) if !stem.is_empty() => stem,
+        _ => name,
+    }
+}
+
+/// Joins two `/`-separated paths, either of which may be empty.
+pub(crate) fn join(base: &str, path: &str) -> String {
+    match (base.is_empty(), path.is_empty()) {
+        (true, _) => path.to_string(),
+        (false, true) => base.to_string(),
+        (false, false) => format!("{base}/{path}"),
+    }
+}
+
+/// Resolves `.` and `..` segments of a `/`-separated path.
+pub(crate) fn normalize(path: &str) -> String {
+    let mut segments: Vec<&str> = Vec::new();
+    for segment in path.split('/') {
+        match segment {
+            "" | "." => {}
+            ".." => {
+                segments.pop();
+            }
+            _ => segments.push(segment),
+        }
+    }
+    segments.join("/")
+}
+
+/// Finds the groups of `modules` that depend on each other in a cycle, the
+/// strongly connected components with more than one module (Tarjan's
+/// algorithm, iterative so that long import chains can't overflow the stack).
+fn cycles(modules: &[String], edges: &BTreeSet<Dependency>) -> Vec<Vec<String>> {
+    let position: HashMap<&str, usize> = modules
+        .iter()
+        .enumerate()
+        .map(|(i, name)| (name.as_str(), i))
+        .collect();
+    let mut adjacency = vec![Vec::new(); modules.len()];
+    for edge in edges {
+        if let (Some(&from), Some(&to)) = (
+            position.get(edge.from.as_str()),
+            position.get(edge.to.as_str()),
+        ) {
+            adjacency[from].push(to);
+        }
+    }
+
+    let unvisited = usize::MAX;
+    let mut index = vec![unvisited; modules.len()];
+    let mut low = vec![0; modules.len()];
+    let mut on_stack = vec![false; modules.len()];
+    let mut stack = Vec::new();
+    let mut next = 0;
+    let mut components = Vec::new();
+    for start in 0..modules.len() {
+        if index[start] != unvisited {
+            continue;
+        }
+        let mut work = vec![(start, 0)];
+        index[start] = next;
+        low[start] = next;
+        next += 1;
+        stack.push(start);
+        on_stack[start] = true;
+        while let Some(&(node, child)) = work.last() {
+            if let Some(&target) = adjacency[node].get(child) {
+                if let Some(top) = work.last_mut() {
+                    top.1 += 1;
+                }
+                if index[target] == unvisited {
+                    index[target] = next;
+                    low[target] = next;
+                    next += 1;
+                    stack.push(target);
+                    on_stack[target] = true;
+                    work.push((target, 0));
+                } else if on_stack[target] {
+                    low[node] = low[node].min(index[target]);
+                }
+                continue;
+            }
+
+            work.pop();
+            if let Some(&(caller, _)) = work.last() {
+                low[caller] = low[caller].min(low[node]);
+            }
+            if low[node] == index[node] {
+                let mut component = Vec::new();
+                while let Some(member) = stack.pop() {
+                    on_stack[member] = false;
+                    component.push(modules[member].clone());
+                    if member == node {
+                        break;
+                    }
+                }
+                if component.len() > 1 {
+                    component.sort();
+                    components.push(component);
+                }
+            }
+        }
+    }
+    components.sort();
+    components
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::{CodeStats, create_parser};
+    use crate::stats::FileStats;
+    use std::path::PathBuf;
+
+    fn parsed_imports(language: SupportedLanguage, source: &str) -> Vec<String> {
+        let tree = create_parser(&language)
+            .unwrap()
+            .parse(source, None)
+            .unwrap();
+        imports(&tree.root_node(), source.as_bytes(), &language)
+    }
+
+    fn directory(files: &[(&str, SupportedLanguage, &[&str])]) -> DirectoryStats {
+        let mut stats = DirectoryStats::new();
+        for (path, language, imports) in files {
+            stats.add_file(FileStats {
+                path: PathBuf::from("proj").join(path),
+                language: *language,
+                stats: CodeStats {
+                    imports: imports.iter().map(|spec| spec.to_string()).collect(),
+                    ..Default::default()
+                },
+            });
+        }
+        stats
+    }
+
+    #[test]
+    fn test_imports_rust_use_trees() {
+        let found = parsed_imports(
+            SupportedLanguage::Rust,
+            "use std::collections::{HashMap, hash_map::Entry};\n\
+             use crate::stats::{self, DirectoryStats as Dir};\n\
+             use super::*;\n\
+             extern crate serde;\n\
+             fn f() { use std::fmt::Write; }\n\
+             mod tests { use super::*; use super::super::cli; }\n",
+        );
+        assert_eq!(
+            found,
+            vec![
+                "std::collections::HashMap",
+                "std::collections::hash_map::Entry",
+                "crate::stats",
+                "crate::stats::DirectoryStats",
+                "super",
+                "serde",
+                "std::fmt::Write",
+                "self",
+                "super::cli",
+            ]
+        );
+    }
+
+    #[test]
+    fn test_imports_scripts_and_includes() {
+        assert_eq!(
+            parsed_imports(
+                SupportedLanguage::JavaScript,
+                "import React from 'react';\nconst cart = require(\"./cart\");\n\
+                 export { x } from '../x';\nimport('./lazy');\n",
+            ),
+            vec!["react", "./cart", "../x", "./lazy"]
+        );
+        assert_eq!(
+            parsed_imports(
+                SupportedLanguage::Python,
+                "import os.path, json as j\nfrom . import views\nfrom ..models import Cart\n",
+            ),
+            vec!["os.path", "json", ".", "..models"]
+        );
+        assert_eq!(
+            parsed_imports(
+                SupportedLanguage::C,
+                "#include <stdio.h>\n#include \"cart.h\"\n"
+            ),
+            vec!["<stdio.h>", "\"cart.h\""]
+        );
+        assert_eq!(
+            parsed_imports(
+                SupportedLanguage::Go,
+                "package main\n\nimport (\n\t\"fmt\"\n\tcart \"example.com/shop/cart\"\n)\n",
+            ),
+            vec!["fmt", "example.com/shop/cart"]
+        );
+    }
+
+    #[test]
+    fn test_dependency_graph_resolves_internal_modules() {
+        let stats = directory(&[
+            (
+                "web/app.ts",
+                SupportedLanguage::TypeScript,
+                &["./cart", "react", "@scope/ui/button"],
+            ),
+            ("web/cart.ts", SupportedLanguage::TypeScript, &["./app.js"]),
+            (
+                "shop/views.py",
+                SupportedLanguage::Python,
+                &[".", ".models", "shop.models", "django.db"],
+            ),
+            ("shop/models.py", SupportedLanguage::Python, &[]),
+            ("shop/__init__.py", SupportedLanguage::Python, &[]),
+            (
+                "src/main.rs",
+                SupportedLanguage::Rust,
+                &["crate::cli::Cli", "clap::Parser", "stats::Total"],
+            ),
+            (
+                "src/cli.rs",
+                SupportedLanguage::Rust,
+                &["super::stats", "self::args::Args"],
+            ),
+            (
+                "src/cli/args.rs",
+                SupportedLanguage::Rust,
+                &["crate::Config"],
+            ),
+            ("src/stats.rs", SupportedLanguage::Rust, &[]),
+            (
+                "java/shop/Cart.java",
+                SupportedLanguage::Java,
+                &["shop.model.Item", "java.util.List"],
+            ),
+            ("java/shop/model/Item.java", SupportedLanguage::Java, &[]),
+            (
+                "native/cart.c",
+                SupportedLanguage::C,
+                &["\"cart.h\"", "<stdio.h>"],
+            ),
+            ("native/cart.h", SupportedLanguage::C, &[]),
+            (
+                "pkg/cart/cart.go",
+                SupportedLanguage::Go,
+                &["example.com/shop/pkg/model", "fmt"],
+            ),
+            ("pkg/model/item.go", SupportedLanguage::Go, &[]),
+        ]);
+        let graph = dependency_graph(&stats, Path::new("proj"));
+        let targets = |from: &str| -> Vec<(&str, bool)> {
+            graph
+                .dependencies
+                .iter()
+                .filter(|edge| edge.from == from)
+                .map(|edge| {
+                    let module = graph.modules.iter().find(|m| m.name == edge.to).unwrap();
+                    (edge.to.as_str(), module.internal)
+                })
+                .collect()
+        };
+
+        assert_eq!(
+            targets("web/app.ts"),
+            vec![
+                ("@scope/ui", false),
+                ("react", false),
+                ("web/cart.ts", true)
+            ]
+        );
+        assert_eq!(targets("web/cart.ts"), vec![("web/app.ts", true)]);
+        assert_eq!(
+            targets("shop/views.py"),
+            vec![
+                ("django", false),
+                ("shop/__init__.py", true),
+                ("shop/models.py", true)
+            ]
+        );
+        assert_eq!(
+            targets("src/main.rs"),
+            vec![
+                ("clap", false),
+                ("src/cli.rs", true),
+                ("src/stats.rs", true)
+            ]
+        );
+        assert_eq!(
+            targets("src/cli.rs"),
+            vec![("src/cli/args.rs", true), ("src/stats.rs", true)]
+        );
+        // `crate::Config` is an item of the crate root
+        assert_eq!(targets("src/cli/args.rs"), vec![("src/main.rs", true)]);
+        assert_eq!(
+            targets("java/shop/Cart.java"),
+            vec![("java.util", false), ("java/shop/model/Item.java", true)]
+        );
+        assert_eq!(
+            targets("native/cart.c"),
+            vec![("native/cart.h", true), ("stdio.h", false)]
+        );
+        // Without a go.mod, Go imports match package directories by suffix
+        assert_eq!(
+            targets("pkg/cart"),
+            vec![("fmt", false), ("pkg/model", true)]
+        );
+
+        // Analyzed modules are listed first
+        assert!(graph.modules[0].internal);
+        assert!(!graph.modules.last().unwrap().internal);
+    }
+
+    #[test]
+    fn test_dependency_graph_cycles() {
+        let stats = directory(&[
+            ("a.js", SupportedLanguage::JavaScript, &["./b"]),
+            ("b.js", SupportedLanguage::JavaScript, &["./c", "lodash"]),
+            ("c.js", SupportedLanguage::JavaScript, &["./a"]),
+            ("d.js", SupportedLanguage::JavaScript, &["./a", "./e"]),
+            ("e.js", SupportedLanguage::JavaScript, &["./d"]),
+            ("f.js", SupportedLanguage::JavaScript, &["./a", "./f"]),
+        ]);
+        let graph = dependency_graph(&stats, Path::new("proj"));
+        assert_eq!(
+            graph.cycles,
+            vec![vec!["a.js", "b.js", "c.js"], vec!["d.js", "e.js"]]
+        );
+        assert!(graph.in_cycle("c.js", "a.js"));
+        assert!(!graph.in_cycle("d.js", "a.js"));
+        // Importing itself is not a dependency
+        assert!(!graph.dependencies.iter().any(|edge| edge.from == edge.to));
+    }
+
+    #[test]
+    fn test_dependency_graph_go_module_path() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        std::fs::write(
+            temp_dir.path().join("go.mod"),
+            "module example.com/shop\n\ngo 1.22\n",
+        )
+        .unwrap();
+        let mut stats = DirectoryStats::new();
+        for (path, imports) in [
+            (
+                "main.go",
+                vec!["example.com/shop/cart", "example.com/other/cart"],
+            ),
+            ("cart/cart.go", vec!["example.com/shop"]),
+        ] {
+            stats.add_file(FileStats {
+                path: temp_dir.path().join(path),
+                language: SupportedLanguage::Go,
+                stats: CodeStats {
+                    imports: imports.into_iter().map(String::from).collect(),
+                    ..Default::default()
+                },
+            });
+        }
+        let graph = dependency_graph(&stats, temp_dir.path());
+        assert_eq!(
+            graph.dependencies,
+            vec![
+                Dependency {
+                    from: ".".to_string(),
+                    to: "cart".to_string()
+                },
+                Dependency {
+                    from: ".".to_string(),
+                    to: "example.com/other/cart".to_string()
+                },
+                Dependency {
+                    from: "cart".to_string(),
+                    to: ".".to_string()
+                },
+            ]
+        );
+        assert_eq!(graph.cycles, vec![vec![".", "cart"]]);
+    }
+}
@@ -0,0 +1,601 @@
+//! Interfaces, traits, and protocols with the types implementing them, for
+//! `--implementations`.
+//!
+//! Implementations are found from explicit clauses: Rust `impl Trait for
+//! Type`, `implements` in Java, TypeScript, and PHP, and the base lists of
+//! C#, Kotlin, and Swift. Those base lists do not tell a superclass from an
+//! interface, so every entry is recorded and only the ones naming a declared
+//! interface are kept. Go has no such clause; a type implements an interface
+//! of its package when its methods cover the interface's method set, which
+//! is checked across the files of one directory. Names are matched without
+//! their qualification and type arguments, so the inventory is best-effort
+//! when two interfaces share a simple name.
+
+use crate::language::SupportedLanguage;
+use crate::signature::{function_name, qualified_type_name};
+use crate::stats::DirectoryStats;
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeSet, HashMap};
+use std::path::{Path, PathBuf};
+use tree_sitter::Node;
+
+/// An interface, trait, or protocol declared in a file.
+#[derive(Default, Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct InterfaceStats {
+    /// Name qualified by enclosing modules, namespaces, and types
+    pub name: String,
+    /// `interface`, `trait`, or `protocol`
+    pub kind: String,
+    /// 1-based line where the declaration starts
+    pub start_line: usize,
+    /// Names of the methods the interface declares, in source order
+    pub methods: Vec<String>,
+}
+
+/// A type declaring that it implements an interface or extends a type.
+#[derive(Default, Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct ImplementsStats {
+    /// Name of the implementing type
+    pub type_name: String,
+    /// Interface or base type, as written in the clause
+    pub interface: String,
+    /// 1-based line of the implementing declaration
+    pub line: usize,
+}
+
+/// Lists the interfaces declared in a file and the implementation clauses
+/// of its types, both in source order.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the tree parsed from `source`
+/// * `source` - The file's contents
+/// * `language` - The programming language of the source code
+pub(crate) fn interfaces(
+    root: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> (Vec<InterfaceStats>, Vec<ImplementsStats>) {
+    let text = |node: Node| node.utf8_text(source).unwrap_or_default().to_string();
+    let mut declared = Vec::new();
+    let mut clauses = Vec::new();
+
+    let mut stack = vec![*root];
+    while let Some(node) = stack.pop() {
+        let line = node.start_position().row + 1;
+        if let Some(kind) = interface_kind(&node, language)
+            && let Some(name) = qualified_type_name(&node, source, language)
+        {
+            declared.push(InterfaceStats {
+                name,
+                kind: kind.to_string(),
+                start_line: line,
+                methods: method_names(&node, source),
+            });
+        }
+
+        if *language == SupportedLanguage::Rust && node.kind() == "impl_item" {
+            if let (Some(interface), Some(type_node)) = (
+                node.child_by_field_name("trait"),
+                node.child_by_field_name("type"),
+            ) {
+                clauses.push(ImplementsStats {
+                    type_name: simple_name(&text(type_node)).to_string(),
+                    interface: text(interface),
+                    line,
+                });
+            }
+        } else {
+            let bases = implemented(&node, language);
+            if !bases.is_empty()
+                && let Some(type_name) = qualified_type_name(&node, source, language)
+            {
+                clauses.extend(bases.into_iter().map(|base| ImplementsStats {
+                    type_name: type_name.clone(),
+                    interface: text(base),
+                    line,
+                }));
+            }
+        }
+
+        let mut cursor = node.walk();
+        let children: Vec<Node> = node.named_children(&mut cursor).collect();
+        stack.extend(children.into_iter().rev());
+    }
+    (declared, clauses)
+}
+
+/// Returns the kind of interface `node` declares, if it declares one.
+fn interface_kind(node: &Node, language: &SupportedLanguage) -> Option<&'static str> {
+    match (language, node.kind()) {
+        (SupportedLanguage::Go, "type_spec")
+            if node
+                .child_by_field_name("type")
+                .is_some_and(|type_node| type_node.kind() == "interface_type") =>
+        {
+            Some("interface")
+        }
+        (SupportedLanguage::Rust, "trait_item") => Some("trait"),
+        (
+            SupportedLanguage::Java
+            | SupportedLanguage::TypeScript
+            | SupportedLanguage::CSharp
+            | SupportedLanguage::Php,
+            "interface_declaration",
+        ) => Some("interface"),
+        (SupportedLanguage::Kotlin, "class_declaration") => {
+            let mut cursor = node.walk();
+            node.children(&mut cursor)
+                .any(|child| child.kind() == "interface")
+                .then_some("interface")
+        }
+        (SupportedLanguage::Swift, "protocol_declaration") => Some("protocol"),
+        _ => None,
+    }
+}
+
+/// Returns the names of the methods declared within an interface.
+fn method_names(node: &Node, source: &[u8]) -> Vec<String> {
+    let mut names = Vec::new();
+    let mut stack = vec![*node];
+    while let Some(current) = stack.pop() {
+        let is_method = matches!(
+            current.kind(),
+            // Go's method_elem was method_spec in older grammars
+            "method_elem"
+                | "method_spec"
+                | "function_signature_item"
+                | "function_item"
+                | "method_signature"
+                | "abstract_method_signature"
+                | "method_declaration"
+                | "function_declaration"
+                | "protocol_function_declaration"
+        );
+        if is_method {
+            names.push(function_name(&current, source));
+            continue;
+        }
+        let mut cursor = current.walk();
+        let children: Vec<Node> = current.named_children(&mut cursor).collect();
+        stack.extend(children.into_iter().rev());
+    }
+    names
+}
+
+/// Returns the nodes naming the interfaces, or in languages whose base lists
+/// mix both, the interfaces and base types, that a type declaration lists.
+fn implemented<'a>(node: &Node<'a>, language: &SupportedLanguage) -> Vec<Node<'a>> {
+    let children = |node: &Node<'a>| -> Vec<Node<'a>> {
+        let mut cursor = node.walk();
+        node.named_children(&mut cursor).collect()
+    };
+    let clauses: &[&str] = match (language, node.kind()) {
+        (
+            SupportedLanguage::Java,
+            "class_declaration" | "enum_declaration" | "record_declaration",
+        ) => &["super_interfaces"],
+        (SupportedLanguage::TypeScript, "class_declaration" | "abstract_class_declaration") => {
+            &["class_heritage"]
+        }
+        (
+            SupportedLanguage::CSharp,
+            "class_declaration"
+            | "struct_declaration"
+            | "record_declaration"
+            | "record_struct_declaration",
+        ) => &["base_list"],
+        (SupportedLanguage::Kotlin, "class_declaration" | "object_declaration") => {
+            &["delegation_specifiers", "delegation_specifier"]
+        }
+        (SupportedLanguage::Swift, "class_declaration") => &["inheritance_specifier"],
+        (SupportedLanguage::Php, "class_declaration" | "enum_declaration") => {
+            &["class_interface_clause"]
+        }
+        _ => return Vec::new(),
+    };
+
+    let mut bases = Vec::new();
+    for clause in children(node)
+        .into_iter()
+        .filter(|child| clauses.contains(&child.kind()))
+    {
+        match clause.kind() {
+            // Java lists the interfaces in a type_list
+            "super_interfaces" => bases.extend(children(&clause).iter().flat_map(children)),
+            // Only the `implements` part of a TypeScript heritage
+            "class_heritage" => bases.extend(
+                children(&clause)
+                    .iter()
+                    .filter(|part| part.kind() == "implements_clause")
+                    .flat_map(children),
+            ),
+            "base_list" | "delegation_specifiers" | "class_interface_clause" => bases.extend(
+                children(&clause)
+                    .into_iter()
+                    .filter(|base| base.kind() != "argument_list"),
+            ),
+            // A single Kotlin delegation specifier or Swift inheritance specifier
+            _ => bases.push(clause),
+        }
+    }
+    bases
+}
+
+/// Strips the qualification and type arguments of a type as written:
+/// `io::Write` and `Comparable<Money>` become `Write` and `Comparable`.
+///
+/// Kotlin constructor calls (`Base()`) and Go and Rust pointer or reference
+/// markers are removed as well.
+pub(crate) fn simple_name(written: &str) -> &str {
+    let end = written.find(['<', '(', '[']).unwrap_or(written.len());
+    let path = written[..end].trim().trim_start_matches(['*', '&']);
+    let start = [
+        path.rfind("::").map(|i| i + 2),
+        path.rfind(['.', '\\']).map(|i| i + 1),
+    ]
+    .into_iter()
+    .flatten()
+    .max()
+    .unwrap_or(0);
+    path[start..].trim()
+}
+
+/// A type implementing an interface.
+#[derive(Debug, Clone, PartialEq, Eq, PartialOrd, Ord, Serialize)]
+pub(crate) struct Implementor {
+    /// Name of the implementing type
+    pub name: String,
+    /// File containing the implementation
+    pub path: PathBuf,
+    /// 1-based line of the implementing declaration or method
+    pub line: usize,
+    /// True if the implementation was inferred from a Go method set rather
+    /// than declared
+    #[serde(skip_serializing_if = "std::ops::Not::not")]
+    pub inferred: bool,
+}
+
+/// An interface with every type found implementing it.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct InterfaceReport {
+    pub name: String,
+    /// `interface`, `trait`, or `protocol`
+    pub kind: String,
+    pub language: SupportedLanguage,
+    /// File declaring the interface
+    pub path: PathBuf,
+    /// 1-based line where the interface is declared
+    pub start_line: usize,
+    /// Number of methods the interface declares
+    pub methods: usize,
+    /// Implementing types, ordered by name and location
+    pub implementors: Vec<Implementor>,
+}
+
+/// Matches the interfaces declared in the analyzed files to the types
+/// implementing them.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics of the analyzed files
+///
+/// # Returns
+///
+/// Every interface, those with the most implementors first, then by name
+pub(crate) fn implementations(stats: &DirectoryStats) -> Vec<InterfaceReport> {
+    let mut reports: Vec<InterfaceReport> = Vec::new();
+    // Indices in `reports` by language and simple name
+    let mut by_name: HashMap<(SupportedLanguage, &str), Vec<usize>> = HashMap::new();
+    for file in &stats.files {
+        for interface in &file.stats.interfaces {
+            by_name
+                .entry((file.language, simple_name(&interface.name)))
+                .or_default()
+                .push(reports.len());
+            reports.push(InterfaceReport {
+                name: interface.name.clone(),
+                kind: interface.kind.clone(),
+                language: file.language,
+                path: file.path.clone(),
+                start_line: interface.start_line,
+                methods: interface.methods.len(),
+                implementors: Vec::new(),
+            });
+        }
+    }
+
+    for file in &stats.files {
+        for clause in &file.stats.implements {
+            let key = (file.language, simple_name(&clause.interface));
+            for &index in by_name.get(&key).into_iter().flatten() {
+                reports[index].implementors.push(Implementor {
+                    name: clause.type_name.clone(),
+                    path: file.path.clone(),
+                    line: clause.line,
+                    inferred: false,
+                });
+            }
+        }
+    }
+    add_go_method_sets(stats, &mut reports);
+
+    for report in &mut reports {
+        report.implementors.sort();
+        report
+            .implementors
+            .dedup_by(|a, b| a.name == b.name && a.path == b.path);
+    }
+    reports.sort_by(|a, b| {
+        b.implementors
+            .len()
+            .cmp(&a.implementors.len())
+            .then_with(|| a.name.cmp(&b.name))
+            .then_with(|| a.path.cmp(&b.path))
+    });
+    reports
+}
+
+/// Adds the Go types whose methods cover the method set of an interface
+/// declared in the same directory.
+///
+/// Empty interfaces are skipped, as every type satisfies them.
+fn add_go_method_sets(stats: &DirectoryStats, reports: &mut [InterfaceReport]) {
+    // Methods by directory and receiver type, with the first method's location
+    let mut method_sets: HashMap<(&Path, &str), (BTreeSet<&str>, &Path, usize)> = HashMap::new();
+    let go_files = || {
+        stats
+            .files
+            .iter()
+            .filter(|file| file.language == SupportedLanguage::Go)
+            .map(|file| (file, file.path.parent().unwrap_or(Path::new(""))))
+    };
+    for (file, directory) in go_files() {
+        for function in &file.stats.functions {
+            let Some((receiver, method)) = function.qualified_name.rsplit_once('.') else {
+                continue;
+            };
+            method_sets
+                .entry((directory, receiver))
+                .or_insert_with(|| (BTreeSet::new(), &file.path, function.start_line))
+                .0
+                .insert(method);
+        }
+    }
+    // A type's own declaration is a better location than its first method
+    for (file, directory) in go_files() {
+        for declaration in &file.stats.types {
+            if let Some(entry) = method_sets.get_mut(&(directory, declaration.name.as_str())) {
+                entry.1 = &file.path;
+                entry.2 = declaration.start_line;
+            }
+        }
+    }
+
+    let interfaces = go_files().flat_map(|(file, directory)| {
+        file.stats
+            .interfaces
+            .iter()
+            .map(move |interface| (file, directory, interface))
+    });
+    for (file, directory, interface) in interfaces {
+        if interface.methods.is_empty() {
+            continue;
+        }
+        let Some(report) = reports.iter_mut().find(|report| {
+            report.path == file.path
+                && report.start_line == interface.start_line
+                && report.name == interface.name
+        }) else {
+            continue;
+        };
+        for (&(type_directory, type_name), (methods, path, line)) in &method_sets {
+            let covers = interface
+                .methods
+                .iter()
+                .all(|method| methods.contains(method.as_str()));
+            if type_directory == directory && covers {
+                report.implementors.push(Implementor {
+                    name: type_name.to_string(),
+                    path: path.to_path_buf(),
+                    line: *line,
+                    inferred: true,
+                });
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::{CodeStats, FunctionStats, TypeStats};
+    use crate::stats::FileStats;
+
+    fn file(path: &str, language: SupportedLanguage, stats: CodeStats) -> FileStats {
+        FileStats {
+            path: PathBuf::from(path),
+            language,
+            stats,
+        }
+    }
+
+    fn interface(name: &str, kind: &str, methods: &[&str]) -> InterfaceStats {
+        InterfaceStats {
+            name: name.to_string(),
+            kind: kind.to_string(),
+            start_line: 1,
+            methods: methods.iter().map(|m| m.to_string()).collect(),
+        }
+    }
+
+    fn method(qualified_name: &str, start_line: usize) -> FunctionStats {
+        FunctionStats {
+            qualified_name: qualified_name.to_string(),
+            start_line,
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn test_simple_name() {
+        assert_eq!(simple_name("io::Write"), "Write");
+        assert_eq!(simple_name("Comparable<Money>"), "Comparable");
+        assert_eq!(simple_name("java.io.Serializable"), "Serializable");
+        assert_eq!(simple_name("\\App\\Contracts\\Repository"), "Repository");
+        assert_eq!(simple_name("Base()"), "Base");
+        assert_eq!(simple_name("*Buffer"), "Buffer");
+    }
+
+    #[test]
+    fn test_explicit_implementations_match_declared_interfaces() {
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file(
+            "src/Shape.cs",
+            SupportedLanguage::CSharp,
+            CodeStats {
+                interfaces: vec![interface("Geo.IShape", "interface", &["Area"])],
+                ..Default::default()
+            },
+        ));
+        stats.add_file(file(
+            "src/Circle.cs",
+            SupportedLanguage::CSharp,
+            CodeStats {
+                implements: ["Figure", "Geo.IShape", "IComparable<Circle>"]
+                    .iter()
+                    .map(|base| ImplementsStats {
+                        type_name: "Geo.Circle".to_string(),
+                        interface: base.to_string(),
+                        line: 3,
+                    })
+                    .collect(),
+                ..Default::default()
+            },
+        ));
+        stats.add_file(file(
+            "src/draw.rs",
+            SupportedLanguage::Rust,
+            CodeStats {
+                interfaces: vec![interface("Draw", "trait", &["draw"])],
+                ..Default::default()
+            },
+        ));
+
+        let report = implementations(&stats);
+        assert_eq!(report.len(), 2);
+        assert_eq!(report[0].name, "Geo.IShape");
+        assert_eq!(report[0].methods, 1);
+        let implementors: Vec<_> = report[0]
+            .implementors
+            .iter()
+            .map(|i| (i.name.as_str(), i.line, i.inferred))
+            .collect();
+        // The base class and the undeclared interface are not listed
+        assert_eq!(implementors, vec![("Geo.Circle", 3, false)]);
+        assert_eq!(report[1].name, "Draw");
+        assert!(report[1].implementors.is_empty());
+    }
+
+    #[test]
+    fn test_go_method_sets_within_a_package() {
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file(
+            "shapes/shape.go",
+            SupportedLanguage::Go,
+            CodeStats {
+                interfaces: vec![
+                    interface("Shape", "interface", &["Area", "Perimeter"]),
+                    interface("Any", "interface", &[]),
+                ],
+                ..Default::default()
+            },
+        ));
+        stats.add_file(file(
+            "shapes/circle.go",
+            SupportedLanguage::Go,
+            CodeStats {
+                types: vec![TypeStats {
+                    name: "Circle".to_string(),
+                    start_line: 5,
+                    end_line: 7,
+                    ..Default::default()
+                }],
+                functions: vec![
+                    method("Circle.Area", 9),
+                    method("Circle.Perimeter", 13),
+                    method("Line.Area", 20),
+                ],
+                ..Default::default()
+            },
+        ));
+        // The same method set in another package does not count
+        stats.add_file(file(
+            "other/square.go",
+            SupportedLanguage::Go,
+            CodeStats {
+                functions: vec![method("Square.Area", 3), method("Square.Perimeter", 6)],
+                ..Default::default()
+            },
+        ));
+
+        let report = implementations(&stats);
+        let shape = report.iter().find(|r| r.name == "Shape").unwrap();
+        assert_eq!(
+            shape.implementors,
+            vec![Implementor {
+                name: "Circle".to_string(),
+                path: PathBuf::from("shapes/circle.go"),
+                line: 5,
+                inferred: true,
+            }]
+        );
+        let any = report.iter().find(|r| r.name == "Any").unwrap();
+        assert!(any.implementors.is_empty());
+    }
+
+    #[test]
+    fn test_interfaces_and_clauses_from_source() {
+        use crate::parser::create_parser;
+
+        let source = r#"
+trait Shape {
+    fn area(&self) -> f64;
+    fn name(&self) -> String { String::new() }
+}
+
+struct Square(f64);
+
+impl Shape for Square {
+    fn area(&self) -> f64 { self.0 * self.0 }
+}
+
+impl Square {
+    fn side(&self) -> f64 { self.0 }
+}
+"#;
+        let language = SupportedLanguage::Rust;
+        let tree = create_parser(&language)
+            .unwrap()
+            .parse(source, None)
+            .unwrap();
+        let (declared, clauses) = interfaces(&tree.root_node(), source.as_bytes(), &language);
+        assert_eq!(
+            declared,
+            vec![InterfaceStats {
+                name: "Shape".to_string(),
+                kind: "trait".to_string(),
+                start_line: 2,
+                methods: vec!["area".to_string(), "name".to_string()],
+            }]
+        );
+        assert_eq!(
+            clauses,
+            vec![ImplementsStats {
+                type_name: "Square".to_string(),
+                interface: "Shape".to_string(),
+                line: 9,
+            }]
+        );
+    }
+}
@@ -1,5 +1,8 @@
 //! Language support definitions and file type detection using Magika.
 
+use crate::detect;
+use crate::grammar::{self, DynamicGrammar};
+use serde::{Deserialize, Deserializer, Serialize, Serializer};
 use std::path::Path;
 use tree_sitter::Language;
 
@@ -14,20 +17,200 @@ use tree_sitter::Language;
 /// - `Rust` - `.rs` files
 /// - `Go` - `.go` files
 /// - `Python` - `.py` files
-/// - `JavaScript` - `.js` files
-/// - `TypeScript` - `.ts` files
+/// - `JavaScript` - `.js`, `.jsx`, `.mjs`, `.cjs` files
+/// - `TypeScript` - `.ts`, `.tsx`, `.mts`, `.cts` files
 /// - `Java` - `.java` files
-#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, serde::Serialize, serde::Deserialize)]
-pub(crate) enum SupportedLanguage {
+/// - `C` - `.c`, `.h` files
+/// - `Cpp` - `.cc`, `.cpp`, `.cxx`, `.c++`, `.hh`, `.hpp`, `.hxx`, `.h++` files
+/// - `Ruby` - `.rb`, `.rake`, `.gemspec`, `.ru` files, `Rakefile`, `Gemfile`
+/// - `Kotlin` - `.kt`, `.kts` files
+/// - `CSharp` - `.cs`, `.csx` files
+/// - `Swift` - `.swift` files
+/// - `Php` - `.php`, `.phtml` files, including HTML around the PHP tags
+/// - `Bash` - `.sh`, `.bash`, `.zsh` files and shell startup files such as `.bashrc`
+/// - `Sql` - `.sql` files
+/// - `Markdown` - `.md`, `.markdown` files, whose fenced code blocks are
+///   analyzed in the language of the fence
+/// - `Yaml` - `.yaml`, `.yml` files
+/// - `Json` - `.json` files
+/// - `Toml` - `.toml` files, `Cargo.lock`, and `Pipfile`
+/// - `Dockerfile` - `Dockerfile`, `Containerfile`, and `.dockerfile` files
+/// - `Make` - `Makefile`, `GNUmakefile`, and `.mk`, `.mak` files
+/// - `Protobuf` - `.proto` files
+/// - `Scala` - `.scala`, `.sc` files
+/// - `Groovy` - `.groovy`, `.gvy`, `.gradle` files and `Jenkinsfile`
+/// - `Elixir` - `.ex`, `.exs` files
+/// - `Erlang` - `.erl`, `.hrl`, `.escript` files and `rebar.config`
+/// - `Haskell` - `.hs` files
+/// - `OCaml` - `.ml`, `.mli` files
+/// - `Zig` - `.zig`, `.zon` files
+/// - `Nim` - `.nim`, `.nims`, `.nimble` files
+/// - `Lua` - `.lua`, `.rockspec` files
+/// - `Html` - `.html`, `.htm` files, whose inline scripts and styles are
+///   analyzed as JavaScript and CSS
+/// - `Css` - `.css` files
+/// - `Scss` - `.scss` files
+/// - `Jupyter` - `.ipynb` notebooks, whose code cells are analyzed in the
+///   language of the notebook's kernel
+/// - `Vue` - `.vue` single-file components
+/// - `Svelte` - `.svelte` components
+/// - `Jinja` - `.j2`, `.jinja`, `.jinja2` Jinja templates
+/// - `GoTemplate` - `.gotmpl`, `.tmpl` Go `text/template` and `html/template`
+///   files
+/// - `Erb` - `.erb`, `.rhtml` Embedded Ruby templates
+/// - `Graphql` - `.graphql`, `.graphqls`, `.gql` schemas and operations
+/// - `Hcl` - `.tf`, `.tfvars`, `.hcl` Terraform and other HCL configurations
+/// - `Dynamic` - a grammar loaded at runtime with `--grammar-dir`, for files
+///   with its name as extension
+///
+/// YAML, JSON, and TOML are configuration formats, see `is_configuration`.
+///
+/// Languages are printed (with `{:?}`) and serialized by name: `Rust`,
+/// `CSharp`, or the name of a dynamic grammar such as `dart`.
+#[derive(Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Hash)]
+pub enum SupportedLanguage {
     Rust,
     Go,
     Python,
     JavaScript,
     TypeScript,
     Java,
+    C,
+    Cpp,
+    Ruby,
+    Kotlin,
+    CSharp,
+    Swift,
+    Php,
+    Bash,
+    Sql,
+    Markdown,
+    Yaml,
+    Json,
+    Toml,
+    Dockerfile,
+    Make,
+    Protobuf,
+    Scala,
+    Groovy,
+    Elixir,
+    Erlang,
+    Haskell,
+    OCaml,
+    Zig,
+    Nim,
+    Lua,
+    Html,
+    Css,
+    Scss,
+    Jupyter,
+    Vue,
+    Svelte,
+    Jinja,
+    GoTemplate,
+    Erb,
+    Graphql,
+    Hcl,
+    Dynamic(&'static DynamicGrammar),
 }
 
 impl SupportedLanguage {
+    /// Every compiled-in language, in declaration order.
+    pub const BUILTIN: [SupportedLanguage; 42] = [
+        Self::Rust,
+        Self::Go,
+        Self::Python,
+        Self::JavaScript,
+        Self::TypeScript,
+        Self::Java,
+        Self::C,
+        Self::Cpp,
+        Self::Ruby,
+        Self::Kotlin,
+        Self::CSharp,
+        Self::Swift,
+        Self::Php,
+        Self::Bash,
+        Self::Sql,
+        Self::Markdown,
+        Self::Yaml,
+        Self::Json,
+        Self::Toml,
+        Self::Dockerfile,
+        Self::Make,
+        Self::Protobuf,
+        Self::Scala,
+        Self::Groovy,
+        Self::Elixir,
+        Self::Erlang,
+        Self::Haskell,
+        Self::OCaml,
+        Self::Zig,
+        Self::Nim,
+        Self::Lua,
+        Self::Html,
+        Self::Css,
+        Self::Scss,
+        Self::Jupyter,
+        Self::Vue,
+        Self::Svelte,
+        Self::Jinja,
+        Self::GoTemplate,
+        Self::Erb,
+        Self::Graphql,
+        Self::Hcl,
+    ];
+
+    /// Returns the name the language is reported under: the variant name,
+    /// or the name of a dynamic grammar.
+    pub fn name(&self) -> &'static str {
+        match self {
+            Self::Rust => "Rust",
+            Self::Go => "Go",
+            Self::Python => "Python",
+            Self::JavaScript => "JavaScript",
+            Self::TypeScript => "TypeScript",
+            Self::Java => "Java",
+            Self::C => "C",
+            Self::Cpp => "Cpp",
+            Self::Ruby => "Ruby",
+            Self::Kotlin => "Kotlin",
+            Self::CSharp => "CSharp",
+            Self::Swift => "Swift",
+            Self::Php => "Php",
+            Self::Bash => "Bash",
+            Self::Sql => "Sql",
+            Self::Markdown => "Markdown",
+            Self::Yaml => "Yaml",
+            Self::Json => "Json",
+            Self::Toml => "Toml",
+            Self::Dockerfile => "Dockerfile",
+            Self::Make => "Make",
+            Self::Protobuf => "Protobuf",
+            Self::Scala => "Scala",
+            Self::Groovy => "Groovy",
+            Self::Elixir => "Elixir",
+            Self::Erlang => "Erlang",
+            Self::Haskell => "Haskell",
+            Self::OCaml => "OCaml",
+            Self::Zig => "Zig",
+            Self::Nim => "Nim",
+            Self::Lua => "Lua",
+            Self::Html => "Html",
+            Self::Css => "Css",
+            Self::Scss => "Scss",
+            Self::Jupyter => "Jupyter",
+            Self::Vue => "Vue",
+            Self::Svelte => "Svelte",
+            Self::Jinja => "Jinja",
+            Self::GoTemplate => "GoTemplate",
+            Self::Erb => "Erb",
+            Self::Graphql => "Graphql",
+            Self::Hcl => "Hcl",
+            Self::Dynamic(grammar) => grammar.name(),
+        }
+    }
+
     /// Maps Magika's content type label to a supported language.
     ///
     /// # Arguments
@@ -46,6 +229,36 @@ impl SupportedLanguage {
             "javascript" => Some(Self::JavaScript),
             "typescript" => Some(Self::TypeScript),
             "java" => Some(Self::Java),
+            "c" => Some(Self::C),
+            "cpp" => Some(Self::Cpp),
+            "ruby" => Some(Self::Ruby),
+            "kotlin" => Some(Self::Kotlin),
+            "cs" | "csharp" => Some(Self::CSharp),
+            "swift" => Some(Self::Swift),
+            "php" => Some(Self::Php),
+            "shell" => Some(Self::Bash),
+            "sql" => Some(Self::Sql),
+            "markdown" => Some(Self::Markdown),
+            "yaml" => Some(Self::Yaml),
+            "json" => Some(Self::Json),
+            "toml" => Some(Self::Toml),
+            "dockerfile" => Some(Self::Dockerfile),
+            "makefile" => Some(Self::Make),
+            "proto" | "protobuf" => Some(Self::Protobuf),
+            "scala" => Some(Self::Scala),
+            "groovy" => Some(Self::Groovy),
+            "elixir" => Some(Self::Elixir),
+            "erlang" => Some(Self::Erlang),
+            "haskell" => Some(Self::Haskell),
+            "ocaml" => Some(Self::OCaml),
+            "zig" => Some(Self::Zig),
+            "nim" => Some(Self::Nim),
+            "lua" => Some(Self::Lua),
+            "html" => Some(Self::Html),
+            "css" => Some(Self::Css),
+            "scss" => Some(Self::Scss),
+            "jupyter" => Some(Self::Jupyter),
+            "vue" => Some(Self::Vue),
             _ => None,
         }
     }
@@ -58,6 +271,12 @@ impl SupportedLanguage {
     /// - Files with incorrect or misleading extensions
     /// - Various extension variations (e.g., .jsx, .tsx, .mjs)
     ///
+    /// Before Magika is consulted, the start of the file is checked for an
+    /// explicit declaration: a Vim or Emacs modeline in the first five lines
+    /// or, for files without a known extension, a `#!` line naming a known
+    /// interpreter (a `.ts` file run by `node` stays TypeScript). `.h` headers,
+    /// which C and C++ share, are routed by a content heuristic instead of Magika.
+    ///
     /// If Magika cannot confidently detect the file type, this function falls back to
     /// extension-based detection for maximum compatibility.
     ///
@@ -73,14 +292,42 @@ impl SupportedLanguage {
     /// # Fallback Behavior
     ///
     /// If Magika fails to analyze the file or returns an unsupported language label,
-    /// this function automatically falls back to extension-based detection.
+    /// this function automatically falls back to extension-based detection. Files
+    /// without an extension then get a conservative content heuristic.
     pub fn from_file_path(file_path: &str) -> Option<Self> {
+        let head = detect::read_head(Path::new(file_path));
+        if let Some(lang) = head.as_deref().and_then(detect::modeline_language) {
+            return Some(lang);
+        }
+        if Self::from_file_extension(file_path).is_none()
+            && let Some(lang) = head.as_deref().and_then(detect::shebang_language)
+        {
+            return Some(lang);
+        }
+
+        let extension = Path::new(file_path)
+            .extension()
+            .and_then(|ext| ext.to_str());
+        if extension.is_some_and(|ext| ext.eq_ignore_ascii_case("h")) {
+            let is_cpp = head.as_deref().is_some_and(detect::looks_like_cpp);
+            return Some(if is_cpp { Self::Cpp } else { Self::C });
+        }
+
+        let fallback = || {
+            Self::from_file_extension(file_path).or_else(|| {
+                extension
+                    .is_none()
+                    .then(|| head.as_deref().and_then(detect::content_language))
+                    .flatten()
+            })
+        };
+
         // Try AI-powered detection first
         let mut magika = match magika::Session::new() {
             Ok(session) => session,
             Err(_) => {
                 // Magika initialization failed, fall back to extension-based detection
-                return Self::from_file_extension(file_path);
+                return fallback();
             }
         };
 
@@ -89,7 +336,7 @@ impl SupportedLanguage {
             Ok(inferred) => inferred,
             Err(_) => {
                 // Magika detection failed, fall back to extension-based detection
-                return Self::from_file_extension(file_path);
+                return fallback();
             }
         };
 
@@ -103,14 +350,78 @@ impl SupportedLanguage {
 
         // Magika detected something else (e.g., 'txt', 'unknown'),
         // fall back to extension-based detection
-        Self::from_file_extension(file_path)
+        fallback()
+    }
+
+    /// Parses a user-supplied language name, case-insensitively.
+    ///
+    /// Accepts the variant names (`rust`, `go`, `python`, `javascript`,
+    /// `typescript`, `java`, `c`, `cpp`, `ruby`, `kotlin`, `csharp`, `swift`,
+    /// `php`, `bash`, `sql`, `markdown`, `yaml`, `json`, `toml`, `dockerfile`,
+    /// `make`, `protobuf`, `scala`, `groovy`, `elixir`, `erlang`, `haskell`,
+    /// `ocaml`, `zig`, `nim`, `lua`, `html`, `css`, `scss`, `jupyter`, `vue`,
+    /// `svelte`, `jinja`, `gotemplate`, `erb`, `graphql`, `hcl`) and `c++`,
+    /// `c#`, `cs`, `sh`, `shell`, `zsh`, `md`, `yml`, `docker`,
+    /// `containerfile`, `makefile`, `mk`, `proto`, `gradle`, `ex`, `erl`,
+    /// `hs`, `ml`, `nims`, `nimble`, `luajit`, `htm`, `ipynb`, `jinja2`, `j2`,
+    /// `gotmpl`, `gql`, `terraform`, and `tf`, as used in configuration
+    /// files, as well as the names of loaded grammars.
+    pub(crate) fn from_name(name: &str) -> Option<Self> {
+        match name.to_ascii_lowercase().as_str() {
+            "rust" => Some(Self::Rust),
+            "go" => Some(Self::Go),
+            "python" => Some(Self::Python),
+            "javascript" => Some(Self::JavaScript),
+            "typescript" => Some(Self::TypeScript),
+            "java" => Some(Self::Java),
+            "c" => Some(Self::C),
+            "cpp" | "c++" => Some(Self::Cpp),
+            "ruby" => Some(Self::Ruby),
+            "kotlin" => Some(Self::Kotlin),
+            "csharp" | "c#" | "cs" => Some(Self::CSharp),
+            "swift" => Some(Self::Swift),
+            "php" => Some(Self::Php),
+            "bash" | "sh" | "shell" | "zsh" => Some(Self::Bash),
+            "sql" => Some(Self::Sql),
+            "markdown" | "md" => Some(Self::Markdown),
+            "yaml" | "yml" => Some(Self::Yaml),
+            "json" => Some(Self::Json),
+            "toml" => Some(Self::Toml),
+            "dockerfile" | "docker" | "containerfile" => Some(Self::Dockerfile),
+            "make" | "makefile" | "mk" => Some(Self::Make),
+            "protobuf" | "proto" => Some(Self::Protobuf),
+            "scala" => Some(Self::Scala),
+            "groovy" | "gradle" => Some(Self::Groovy),
+            "elixir" | "ex" => Some(Self::Elixir),
+            "erlang" | "erl" => Some(Self::Erlang),
+            "haskell" | "hs" => Some(Self::Haskell),
+            "ocaml" | "ml" => Some(Self::OCaml),
+            "zig" => Some(Self::Zig),
+            "nim" | "nims" | "nimble" => Some(Self::Nim),
+            "lua" | "luajit" => Some(Self::Lua),
+            "html" | "htm" => Some(Self::Html),
+            "css" => Some(Self::Css),
+            "scss" => Some(Self::Scss),
+            "jupyter" | "ipynb" => Some(Self::Jupyter),
+            "vue" => Some(Self::Vue),
+            "svelte" => Some(Self::Svelte),
+            "jinja" | "jinja2" | "j2" => Some(Self::Jinja),
+            "gotemplate" | "gotmpl" => Some(Self::GoTemplate),
+            "erb" => Some(Self::Erb),
+            "graphql" | "gql" => Some(Self::Graphql),
+            "hcl" | "terraform" | "tf" => Some(Self::Hcl),
+            _ => grammar::find(name),
+        }
     }
 
     /// Determines the programming language from a file path based on its extension.
     ///
     /// This function performs case-insensitive matching of file extensions.
     /// It extracts the extension from the provided path and maps it to the
-    /// corresponding `SupportedLanguage` variant.
+    /// corresponding `SupportedLanguage` variant. A few well-known file names
+    /// without an extension, such as `Rakefile`, `.bashrc`, `Makefile`,
+    /// `Jenkinsfile`, `rebar.config`, and `Dockerfile` (also `Dockerfile.dev`), are
+    /// recognized as well.
     ///
     /// Used internally as a fallback when Magika cannot detect the file type.
     ///
@@ -120,9 +431,43 @@ impl SupportedLanguage {
     ///
     /// # Returns
     ///
-    /// * `Some(SupportedLanguage)` if the extension matches a supported language
+    /// * `Some(SupportedLanguage)` if the extension matches a supported language,
+    ///   or is the name of a loaded grammar
     /// * `None` if the file has no extension or the extension is not supported
     pub(crate) fn from_file_extension(file_path: &str) -> Option<Self> {
+        let file_name = Path::new(file_path).file_name()?.to_str()?;
+        if matches!(
+            file_name,
+            "Rakefile" | "Gemfile" | "Guardfile" | "Vagrantfile" | "Podfile"
+        ) {
+            return Some(Self::Ruby);
+        }
+        if matches!(
+            file_name,
+            ".bashrc" | ".bash_profile" | ".bash_login" | ".profile" | ".zshrc" | ".zprofile"
+        ) {
+            return Some(Self::Bash);
+        }
+        if matches!(file_name, "Cargo.lock" | "Pipfile") {
+            return Some(Self::Toml);
+        }
+        if matches!(file_name, "Makefile" | "makefile" | "GNUmakefile") {
+            return Some(Self::Make);
+        }
+        if file_name == "Jenkinsfile" {
+            return Some(Self::Groovy);
+        }
+        if file_name == "rebar.config" {
+            return Some(Self::Erlang);
+        }
+        // `Dockerfile.dev` and `api.Dockerfile` name the image they build
+        if ["Dockerfile", "Containerfile"]
+            .iter()
+            .any(|name| file_name == *name || file_name.starts_with(&format!("{name}.")))
+        {
+            return Some(Self::Dockerfile);
+        }
+
         // Extract extension, convert to string, then to lowercase for case-insensitive matching
         let extension = Path::new(file_path).extension()?.to_str()?.to_lowercase();
 
@@ -130,10 +475,63 @@ impl SupportedLanguage {
             "rs" => Some(Self::Rust),
             "go" => Some(Self::Go),
             "py" => Some(Self::Python),
-            "js" => Some(Self::JavaScript),
-            "ts" => Some(Self::TypeScript),
+            "js" | "jsx" | "mjs" | "cjs" => Some(Self::JavaScript),
+            "ts" | "tsx" | "mts" | "cts" => Some(Self::TypeScript),
             "java" => Some(Self::Java),
-            _ => None,
+            // `.h` is shared by C and C++; `from_file_path` looks at the content,
+            // without it C++ headers parsed as C surface as parse errors
+            "c" | "h" => Some(Self::C),
+            "cc" | "cpp" | "cxx" | "c++" | "hh" | "hpp" | "hxx" | "h++" => Some(Self::Cpp),
+            "rb" | "rake" | "gemspec" | "ru" => Some(Self::Ruby),
+            // `.kts` covers Gradle build scripts and other Kotlin scripts
+            "kt" | "kts" => Some(Self::Kotlin),
+            "cs" | "csx" => Some(Self::CSharp),
+            "swift" => Some(Self::Swift),
+            "php" | "phtml" => Some(Self::Php),
+            // zsh shares enough of bash's syntax for functions and control flow
+            "sh" | "bash" | "zsh" => Some(Self::Bash),
+            "sql" => Some(Self::Sql),
+            "md" | "markdown" => Some(Self::Markdown),
+            "yaml" | "yml" => Some(Self::Yaml),
+            "json" => Some(Self::Json),
+            "toml" => Some(Self::Toml),
+            "dockerfile" | "containerfile" => Some(Self::Dockerfile),
+            "mk" | "mak" => Some(Self::Make),
+            "proto" => Some(Self::Protobuf),
+            // `.sc` covers Scala scripts and Ammonite/scala-cli worksheets
+            "scala" | "sc" => Some(Self::Scala),
+            // `.gradle` covers Gradle build scripts in the Groovy DSL
+            "groovy" | "gvy" | "gradle" => Some(Self::Groovy),
+            // `.exs` covers scripts, tests, and `mix.exs`
+            "ex" | "exs" => Some(Self::Elixir),
+            "erl" | "hrl" | "escript" => Some(Self::Erlang),
+            // Literate Haskell (`.lhs`) is left out: its code sits in `> `
+            // lines or `\begin{code}` blocks the grammar doesn't parse
+            "hs" => Some(Self::Haskell),
+            // `.mli` interfaces are parsed with their own grammar, see `Dialect`
+            "ml" | "mli" => Some(Self::OCaml),
+            // `.zon` is the format of `build.zig.zon`, a Zig struct literal
+            "zig" | "zon" => Some(Self::Zig),
+            // `.nims` covers NimScript and `config.nims`, `.nimble` package files
+            "nim" | "nims" | "nimble" => Some(Self::Nim),
+            // LuaRocks package specifications are Lua assignments
+            "lua" | "rockspec" => Some(Self::Lua),
+            "html" | "htm" => Some(Self::Html),
+            "css" => Some(Self::Css),
+            // The indented `.sass` syntax has no braces for the grammar to parse
+            "scss" => Some(Self::Scss),
+            "ipynb" => Some(Self::Jupyter),
+            "vue" => Some(Self::Vue),
+            "svelte" => Some(Self::Svelte),
+            "j2" | "jinja" | "jinja2" => Some(Self::Jinja),
+            // `.tmpl` is also used by other engines, but mostly for Go templates
+            "gotmpl" | "tmpl" => Some(Self::GoTemplate),
+            "erb" | "rhtml" => Some(Self::Erb),
+            // `.graphqls` is the schema file convention of Java and Go servers
+            "graphql" | "graphqls" | "gql" => Some(Self::Graphql),
+            // `.hcl` also covers Packer, Nomad, and Terragrunt files
+            "tf" | "tfvars" | "hcl" => Some(Self::Hcl),
+            _ => grammar::for_extension(&extension),
         }
     }
 
@@ -156,6 +554,199 @@ impl SupportedLanguage {
             Self::JavaScript => tree_sitter_javascript::LANGUAGE.into(),
             Self::TypeScript => tree_sitter_typescript::LANGUAGE_TYPESCRIPT.into(),
             Self::Java => tree_sitter_java::LANGUAGE.into(),
+            Self::C => tree_sitter_c::LANGUAGE.into(),
+            Self::Cpp => tree_sitter_cpp::LANGUAGE.into(),
+            Self::Ruby => tree_sitter_ruby::LANGUAGE.into(),
+            Self::Kotlin => tree_sitter_kotlin_ng::LANGUAGE.into(),
+            Self::CSharp => tree_sitter_c_sharp::LANGUAGE.into(),
+            Self::Swift => tree_sitter_swift::LANGUAGE.into(),
+            // The full grammar, which parses the HTML around `<?php ... ?>` as text
+            Self::Php => tree_sitter_php::LANGUAGE_PHP.into(),
+            Self::Bash => tree_sitter_bash::LANGUAGE.into(),
+            // One grammar covers the common ground of PostgreSQL, MySQL, and SQLite
+            Self::Sql => tree_sitter_sequel::LANGUAGE.into(),
+            // The block grammar; inline markup such as emphasis is not needed
+            Self::Markdown => tree_sitter_md::LANGUAGE.into(),
+            Self::Yaml => tree_sitter_yaml::LANGUAGE.into(),
+            Self::Json => tree_sitter_json::LANGUAGE.into(),
+            Self::Toml => tree_sitter_toml_ng::LANGUAGE.into(),
+            Self::Dockerfile => tree_sitter_containerfile::LANGUAGE.into(),
+            Self::Make => tree_sitter_make::LANGUAGE.into(),
+            Self::Protobuf => tree_sitter_proto::LANGUAGE.into(),
+            Self::Scala => tree_sitter_scala::LANGUAGE.into(),
+            Self::Groovy => tree_sitter_groovy::LANGUAGE.into(),
+            Self::Elixir => tree_sitter_elixir::LANGUAGE.into(),
+            Self::Erlang => tree_sitter_erlang::LANGUAGE.into(),
+            Self::Haskell => tree_sitter_haskell::LANGUAGE.into(),
+            Self::OCaml => tree_sitter_ocaml::LANGUAGE_OCAML.into(),
+            Self::Zig => tree_sitter_zig::LANGUAGE.into(),
+            Self::Nim => tree_sitter_nim::LANGUAGE.into(),
+            Self::Lua => tree_sitter_lua::LANGUAGE.into(),
+            Self::Html => tree_sitter_html::LANGUAGE.into(),
+            Self::Css => tree_sitter_css::LANGUAGE.into(),
+            Self::Scss => tree_sitter_scss::LANGUAGE.into(),
+            // Notebooks are JSON documents, see the `notebook` module
+            Self::Jupyter => tree_sitter_json::LANGUAGE.into(),
+            // Components are split into sections like HTML, see `component`
+            Self::Vue | Self::Svelte => tree_sitter_html::LANGUAGE.into(),
+            // A grammar of text and `<% %>` tags; the tags of Jinja and Go
+            // templates are scanned from the text, see `templates`
+            Self::Jinja | Self::GoTemplate | Self::Erb => {
+                tree_sitter_embedded_template::LANGUAGE.into()
+            }
+            Self::Graphql => tree_sitter_graphql::LANGUAGE.into(),
+            Self::Hcl => tree_sitter_hcl::LANGUAGE.into(),
+            Self::Dynamic(grammar) => grammar.language(),
+        }
+    }
+
+    /// Returns the crate providing the compiled-in grammar of the language,
+    /// or `None` for a grammar loaded at runtime.
+    pub fn grammar_crate(&self) -> Option<&'static str> {
+        let name = match self {
+            Self::Rust => "tree-sitter-rust",
+            Self::Go => "tree-sitter-go",
+            Self::Python => "tree-sitter-python",
+            Self::JavaScript => "tree-sitter-javascript",
+            Self::TypeScript => "tree-sitter-typescript",
+            Self::Java => "tree-sitter-java",
+            Self::C => "tree-sitter-c",
+            Self::Cpp => "tree-sitter-cpp",
+            Self::Ruby => "tree-sitter-ruby",
+            Self::Kotlin => "tree-sitter-kotlin-ng",
+            Self::CSharp => "tree-sitter-c-sharp",
+            Self::Swift => "tree-sitter-swift",
+            Self::Php => "tree-sitter-php",
+            Self::Bash => "tree-sitter-bash",
+            Self::Sql => "tree-sitter-sequel",
+            Self::Markdown => "tree-sitter-md",
+            Self::Yaml => "tree-sitter-yaml",
+            Self::Json | Self::Jupyter => "tree-sitter-json",
+            Self::Toml => "tree-sitter-toml-ng",
+            Self::Dockerfile => "tree-sitter-containerfile",
+            Self::Make => "tree-sitter-make",
+            Self::Protobuf => "tree-sitter-proto",
+            Self::Scala => "tree-sitter-scala",
+            Self::Groovy => "tree-sitter-groovy",
+            Self::Elixir => "tree-sitter-elixir",
+            Self::Erlang => "tree-sitter-erlang",
+            Self::Haskell => "tree-sitter-haskell",
+            Self::OCaml => "tree-sitter-ocaml",
+            Self::Zig => "tree-sitter-zig",
+            Self::Nim => "tree-sitter-nim",
+            Self::Lua => "tree-sitter-lua",
+            Self::Html | Self::Vue | Self::Svelte => "tree-sitter-html",
+            Self::Css => "tree-sitter-css",
+            Self::Scss => "tree-sitter-scss",
+            Self::Jinja | Self::GoTemplate | Self::Erb => "tree-sitter-embedded-template",
+            Self::Graphql => "tree-sitter-graphql",
+            Self::Hcl => "tree-sitter-hcl",
+            Self::Dynamic(_) => return None,
+        };
+        Some(name)
+    }
+
+    /// Returns true for configuration formats (YAML, JSON, TOML).
+    ///
+    /// Their files are reported by key count and nesting depth in a bucket of
+    /// their own, so that they don't count toward the code totals.
+    pub fn is_configuration(&self) -> bool {
+        matches!(self, Self::Yaml | Self::Json | Self::Toml)
+    }
+
+    /// Returns true for single-file components (Vue, Svelte), whose script
+    /// and style sections are analyzed as part of the component, see the
+    /// `component` module.
+    pub fn is_component(&self) -> bool {
+        matches!(self, Self::Vue | Self::Svelte)
+    }
+
+    /// Returns true for template languages (Jinja, Go templates, ERB), which
+    /// are measured by their tags, see the `templates` module.
+    pub fn is_template(&self) -> bool {
+        matches!(self, Self::Jinja | Self::GoTemplate | Self::Erb)
+    }
+
+    /// Returns the tree-sitter `Language` instance for this language and dialect.
+    ///
+    /// TypeScript and OCaml have more than one dialect: `.tsx` files embed
+    /// JSX and must be parsed with `LANGUAGE_TSX`, otherwise every JSX element
+    /// becomes an ERROR node, and OCaml `.mli` interfaces hold signatures
+    /// that only `LANGUAGE_OCAML_INTERFACE` parses. All other combinations
+    /// use `get_language`.
+    pub(crate) fn get_language_with_dialect(&self, dialect: Dialect) -> Language {
+        match (self, dialect) {
+            (Self::TypeScript, Dialect::Tsx) => tree_sitter_typescript::LANGUAGE_TSX.into(),
+            (Self::OCaml, Dialect::Interface) => tree_sitter_ocaml::LANGUAGE_OCAML_INTERFACE.into(),
+            _ => self.get_language(),
+        }
+    }
+}
+
+impl std::fmt::Debug for SupportedLanguage {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str(self.name())
+    }
+}
+
+impl Serialize for SupportedLanguage {
+    fn serialize<S: Serializer>(&self, serializer: S) -> Result<S::Ok, S::Error> {
+        serializer.serialize_str(self.name())
+    }
+}
+
+impl<'de> Deserialize<'de> for SupportedLanguage {
+    /// Accepts the built-in variant names and the names of loaded grammars,
+    /// so results that mention a dynamic grammar can only be read back
+    /// while it is loaded.
+    fn deserialize<D: Deserializer<'de>>(deserializer: D) -> Result<Self, D::Error> {
+        let name = String::deserialize(deserializer)?;
+        Self::BUILTIN
+            .into_iter()
+            .find(|language| language.name() == name)
+            .or_else(|| grammar::find(&name))
+            .ok_or_else(|| serde::de::Error::custom(format!("unknown language '{name}'")))
+    }
+}
+
+/// Grammar dialect used to parse a file of a given language.
+///
+/// Most languages have a single grammar, but some ship several variants
+/// of the same grammar (e.g. TypeScript and TSX). The dialect is chosen from
+/// the file path and does not affect which language the stats are reported as.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, Default)]
+pub(crate) enum Dialect {
+    /// The language's primary grammar
+    #[default]
+    Standard,
+    /// TypeScript with embedded JSX (`.tsx` files)
+    Tsx,
+    /// OCaml module interfaces (`.mli` files)
+    Interface,
+}
+
+impl Dialect {
+    /// Selects the dialect for a file of the given language based on its extension.
+    pub(crate) fn from_file_path(language: SupportedLanguage, file_path: &str) -> Self {
+        let extension = Path::new(file_path)
+            .extension()
+            .and_then(|ext| ext.to_str())
+            .unwrap_or_default();
+
+        match language {
+            SupportedLanguage::TypeScript if extension.eq_ignore_ascii_case("tsx") => Self::Tsx,
+            SupportedLanguage::OCaml if extension.eq_ignore_ascii_case("mli") => Self::Interface,
+            _ => Self::Standard,
+        }
+    }
+
+    /// Returns every dialect of `language`, the grammars its queries must
+    /// compile for.
+    pub(crate) fn all(language: SupportedLanguage) -> &'static [Self] {
+        match language {
+            SupportedLanguage::TypeScript => &[Self::Standard, Self::Tsx],
+            SupportedLanguage::OCaml => &[Self::Standard, Self::Interface],
+            _ => &[Self::Standard],
         }
     }
 }
@@ -190,6 +781,442 @@ mod tests {
             SupportedLanguage::from_file_extension("Main.java"),
             Some(SupportedLanguage::Java)
         ));
+        assert!(matches!(
+            SupportedLanguage::from_file_extension("main.c"),
+            Some(SupportedLanguage::C)
+        ));
+        assert!(matches!(
+            SupportedLanguage::from_file_extension("main.cpp"),
+            Some(SupportedLanguage::Cpp)
+        ));
+    }
+
+    #[test]
+    fn test_from_file_extension_c_family() {
+        for path in ["util.c", "util.h", "UTIL.H"] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(SupportedLanguage::C),
+                "{path}"
+            );
+        }
+        for path in [
+            "a.cc", "a.cpp", "a.cxx", "a.c++", "a.hh", "a.hpp", "a.hxx", "a.h++",
+        ] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(SupportedLanguage::Cpp),
+                "{path}"
+            );
+        }
+        assert_eq!(
+            SupportedLanguage::from_name("C++"),
+            Some(SupportedLanguage::Cpp)
+        );
+        assert_eq!(
+            SupportedLanguage::from_name("c"),
+            Some(SupportedLanguage::C)
+        );
+    }
+
+    #[test]
+    fn test_from_file_extension_ruby() {
+        for path in [
+            "app.rb",
+            "tasks/db.rake",
+            "gem.gemspec",
+            "config.ru",
+            "Rakefile",
+        ] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(SupportedLanguage::Ruby),
+                "{path}"
+            );
+        }
+        assert_eq!(
+            SupportedLanguage::from_file_extension("vendor/Gemfile"),
+            Some(SupportedLanguage::Ruby)
+        );
+        assert_eq!(SupportedLanguage::from_file_extension("Gemfile.lock"), None);
+        assert_eq!(
+            SupportedLanguage::from_magika_label("ruby"),
+            Some(SupportedLanguage::Ruby)
+        );
+    }
+
+    #[test]
+    fn test_from_file_extension_kotlin_and_csharp() {
+        for path in ["Main.kt", "build.gradle.kts", "script.KTS"] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(SupportedLanguage::Kotlin),
+                "{path}"
+            );
+        }
+        assert_eq!(
+            SupportedLanguage::from_magika_label("kotlin"),
+            Some(SupportedLanguage::Kotlin)
+        );
+        assert_eq!(
+            SupportedLanguage::from_file_extension("Program.cs"),
+            Some(SupportedLanguage::CSharp)
+        );
+        assert_eq!(
+            SupportedLanguage::from_name("C#"),
+            Some(SupportedLanguage::CSharp)
+        );
+    }
+
+    #[test]
+    fn test_from_file_extension_swift() {
+        assert_eq!(
+            SupportedLanguage::from_file_extension("App.swift"),
+            Some(SupportedLanguage::Swift)
+        );
+        assert_eq!(
+            SupportedLanguage::from_name("Swift"),
+            Some(SupportedLanguage::Swift)
+        );
+        assert_eq!(
+            SupportedLanguage::from_magika_label("swift"),
+            Some(SupportedLanguage::Swift)
+        );
+    }
+
+    #[test]
+    fn test_from_file_extension_scala_and_groovy() {
+        for path in ["Main.scala", "build.sc"] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(SupportedLanguage::Scala),
+                "{path}"
+            );
+        }
+        for path in ["Pipeline.groovy", "build.gradle", "ci/Jenkinsfile"] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(SupportedLanguage::Groovy),
+                "{path}"
+            );
+        }
+        // The Kotlin DSL of Gradle stays Kotlin
+        assert_eq!(
+            SupportedLanguage::from_file_extension("build.gradle.kts"),
+            Some(SupportedLanguage::Kotlin)
+        );
+        assert_eq!(
+            SupportedLanguage::from_name("Gradle"),
+            Some(SupportedLanguage::Groovy)
+        );
+        assert_eq!(
+            SupportedLanguage::from_magika_label("scala"),
+            Some(SupportedLanguage::Scala)
+        );
+    }
+
+    #[test]
+    fn test_from_file_extension_elixir_and_erlang() {
+        for path in ["lib/shop/cart.ex", "mix.exs", "test/cart_test.exs"] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(SupportedLanguage::Elixir),
+                "{path}"
+            );
+        }
+        for path in ["src/cart.erl", "include/records.hrl", "rebar.config"] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(SupportedLanguage::Erlang),
+                "{path}"
+            );
+        }
+        assert_eq!(
+            SupportedLanguage::from_magika_label("elixir"),
+            Some(SupportedLanguage::Elixir)
+        );
+    }
+
+    #[test]
+    fn test_from_file_extension_haskell_and_ocaml() {
+        assert_eq!(
+            SupportedLanguage::from_file_extension("src/Shop/Cart.hs"),
+            Some(SupportedLanguage::Haskell)
+        );
+        for path in ["lib/cart.ml", "lib/cart.mli"] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(SupportedLanguage::OCaml),
+                "{path}"
+            );
+        }
+        assert_eq!(
+            Dialect::from_file_path(SupportedLanguage::OCaml, "lib/cart.mli"),
+            Dialect::Interface
+        );
+        assert_eq!(
+            Dialect::from_file_path(SupportedLanguage::OCaml, "lib/cart.ml"),
+            Dialect::Standard
+        );
+        assert_eq!(
+            SupportedLanguage::from_name("hs"),
+            Some(SupportedLanguage::Haskell)
+        );
+    }
+
+    #[test]
+    fn test_from_file_extension_zig_and_nim() {
+        for path in ["src/main.zig", "build.zig.zon"] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(SupportedLanguage::Zig),
+                "{path}"
+            );
+        }
+        for path in ["src/cart.nim", "config.nims", "cart.nimble"] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(SupportedLanguage::Nim),
+                "{path}"
+            );
+        }
+    }
+
+    #[test]
+    fn test_from_file_extension_lua() {
+        for path in ["scripts/cart.lua", "cart-1.0-1.rockspec"] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(SupportedLanguage::Lua),
+                "{path}"
+            );
+        }
+    }
+
+    #[test]
+    fn test_from_file_extension_html_and_styles() {
+        for (path, expected) in [
+            ("public/index.html", SupportedLanguage::Html),
+            ("legacy/INDEX.HTM", SupportedLanguage::Html),
+            ("styles/site.css", SupportedLanguage::Css),
+            ("styles/_buttons.scss", SupportedLanguage::Scss),
+        ] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(expected),
+                "{path}"
+            );
+        }
+        assert_eq!(
+            SupportedLanguage::from_file_extension("styles/site.sass"),
+            None
+        );
+    }
+
+    #[test]
+    fn test_from_file_extension_components() {
+        assert_eq!(
+            SupportedLanguage::from_file_extension("src/components/Cart.vue"),
+            Some(SupportedLanguage::Vue)
+        );
+        assert_eq!(
+            SupportedLanguage::from_file_extension("src/routes/+page.svelte"),
+            Some(SupportedLanguage::Svelte)
+        );
+    }
+
+    #[test]
+    fn test_from_file_extension_templates() {
+        for (path, expected) in [
+            ("templates/base.html.j2", SupportedLanguage::Jinja),
+            (
+                "roles/web/templates/nginx.conf.jinja2",
+                SupportedLanguage::Jinja,
+            ),
+            ("web/templates/index.gotmpl", SupportedLanguage::GoTemplate),
+            ("app/views/carts/show.html.erb", SupportedLanguage::Erb),
+        ] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(expected),
+                "{path}"
+            );
+        }
+    }
+
+    #[test]
+    fn test_from_file_extension_notebook() {
+        assert_eq!(
+            SupportedLanguage::from_file_extension("notebooks/Analysis.ipynb"),
+            Some(SupportedLanguage::Jupyter)
+        );
+        assert_eq!(
+            SupportedLanguage::from_name("ipynb"),
+            Some(SupportedLanguage::Jupyter)
+        );
+    }
+
+    #[test]
+    fn test_from_file_extension_php() {
+        for path in ["index.php", "views/cart.phtml"] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(SupportedLanguage::Php),
+                "{path}"
+            );
+        }
+        assert_eq!(
+            SupportedLanguage::from_magika_label("php"),
+            Some(SupportedLanguage::Php)
+        );
+    }
+
+    #[test]
+    fn test_from_file_extension_shell() {
+        for path in [
+            "scripts/deploy.sh",
+            "lib.bash",
+            "prompt.zsh",
+            "/home/me/.bashrc",
+            ".zshrc",
+        ] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(SupportedLanguage::Bash),
+                "{path}"
+            );
+        }
+        assert_eq!(
+            SupportedLanguage::from_name("sh"),
+            Some(SupportedLanguage::Bash)
+        );
+    }
+
+    #[test]
+    fn test_from_file_extension_sql() {
+        assert_eq!(
+            SupportedLanguage::from_file_extension("migrations/0042_add_orders.sql"),
+            Some(SupportedLanguage::Sql)
+        );
+        assert_eq!(
+            SupportedLanguage::from_file_extension("SCHEMA.SQL"),
+            Some(SupportedLanguage::Sql)
+        );
+        assert_eq!(
+            SupportedLanguage::from_magika_label("sql"),
+            Some(SupportedLanguage::Sql)
+        );
+        assert_eq!(
+            SupportedLanguage::from_name("SQL"),
+            Some(SupportedLanguage::Sql)
+        );
+    }
+
+    #[test]
+    fn test_from_file_extension_markdown() {
+        for path in ["README.md", "docs/guide.markdown", "CHANGELOG.MD"] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(SupportedLanguage::Markdown),
+                "{path}"
+            );
+        }
+        assert_eq!(
+            SupportedLanguage::from_magika_label("markdown"),
+            Some(SupportedLanguage::Markdown)
+        );
+        assert_eq!(SupportedLanguage::from_file_extension("notes.txt"), None);
+    }
+
+    #[test]
+    fn test_from_file_extension_configuration() {
+        for (path, expected) in [
+            (".github/workflows/ci.yml", SupportedLanguage::Yaml),
+            ("deploy/values.yaml", SupportedLanguage::Yaml),
+            ("package.json", SupportedLanguage::Json),
+            ("Cargo.toml", SupportedLanguage::Toml),
+            ("Cargo.lock", SupportedLanguage::Toml),
+        ] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(expected),
+                "{path}"
+            );
+            assert!(expected.is_configuration());
+        }
+        assert!(!SupportedLanguage::Rust.is_configuration());
+        assert!(!SupportedLanguage::Markdown.is_configuration());
+    }
+
+    #[test]
+    fn test_from_file_extension_build_and_schema_files() {
+        for (path, expected) in [
+            ("Dockerfile", SupportedLanguage::Dockerfile),
+            ("docker/Dockerfile.dev", SupportedLanguage::Dockerfile),
+            ("Containerfile", SupportedLanguage::Dockerfile),
+            ("api.dockerfile", SupportedLanguage::Dockerfile),
+            ("Makefile", SupportedLanguage::Make),
+            ("GNUmakefile", SupportedLanguage::Make),
+            ("build/rules.mk", SupportedLanguage::Make),
+            ("api/shop/v1/cart.proto", SupportedLanguage::Protobuf),
+            ("schema/cart.graphql", SupportedLanguage::Graphql),
+            (
+                "src/main/resources/schema.graphqls",
+                SupportedLanguage::Graphql,
+            ),
+            ("web/queries/cart.gql", SupportedLanguage::Graphql),
+            ("infra/main.tf", SupportedLanguage::Hcl),
+            ("infra/prod.tfvars", SupportedLanguage::Hcl),
+            ("terragrunt.hcl", SupportedLanguage::Hcl),
+        ] {
+            assert_eq!(
+                SupportedLanguage::from_file_extension(path),
+                Some(expected),
+                "{path}"
+            );
+        }
+        assert_eq!(SupportedLanguage::from_file_extension("Dockerfiles"), None);
+    }
+
+    #[test]
+    fn test_from_file_extension_dialect_variants() {
+        assert_eq!(
+            SupportedLanguage::from_file_extension("App.tsx"),
+            Some(SupportedLanguage::TypeScript)
+        );
+        assert_eq!(
+            SupportedLanguage::from_file_extension("config.mts"),
+            Some(SupportedLanguage::TypeScript)
+        );
+        assert_eq!(
+            SupportedLanguage::from_file_extension("App.jsx"),
+            Some(SupportedLanguage::JavaScript)
+        );
+        assert_eq!(
+            SupportedLanguage::from_file_extension("index.cjs"),
+            Some(SupportedLanguage::JavaScript)
+        );
+    }
+
+    #[test]
+    fn test_dialect_from_file_path() {
+        assert_eq!(
+            Dialect::from_file_path(SupportedLanguage::TypeScript, "src/App.tsx"),
+            Dialect::Tsx
+        );
+        assert_eq!(
+            Dialect::from_file_path(SupportedLanguage::TypeScript, "src/App.TSX"),
+            Dialect::Tsx
+        );
+        assert_eq!(
+            Dialect::from_file_path(SupportedLanguage::TypeScript, "src/app.ts"),
+            Dialect::Standard
+        );
+        // JSX is part of the standard JavaScript grammar
+        assert_eq!(
+            Dialect::from_file_path(SupportedLanguage::JavaScript, "src/App.jsx"),
+            Dialect::Standard
+        );
     }
 
     #[test]
@@ -227,13 +1254,13 @@ mod tests {
     #[test]
     fn test_from_file_extension_unsupported() {
         assert_eq!(SupportedLanguage::from_file_extension("readme.txt"), None);
-        assert_eq!(SupportedLanguage::from_file_extension("document.md"), None);
-        assert_eq!(SupportedLanguage::from_file_extension("style.css"), None);
+        assert_eq!(SupportedLanguage::from_file_extension("data.csv"), None);
+        assert_eq!(SupportedLanguage::from_file_extension("logo.svg"), None);
     }
 
     #[test]
     fn test_from_file_extension_no_extension() {
-        assert_eq!(SupportedLanguage::from_file_extension("Makefile"), None);
+        assert_eq!(SupportedLanguage::from_file_extension("LICENSE"), None);
         assert_eq!(SupportedLanguage::from_file_extension("README"), None);
         assert_eq!(SupportedLanguage::from_file_extension(""), None);
     }
@@ -264,6 +1291,42 @@ mod tests {
             SupportedLanguage::JavaScript,
             SupportedLanguage::TypeScript,
             SupportedLanguage::Java,
+            SupportedLanguage::C,
+            SupportedLanguage::Cpp,
+            SupportedLanguage::Ruby,
+            SupportedLanguage::Kotlin,
+            SupportedLanguage::CSharp,
+            SupportedLanguage::Swift,
+            SupportedLanguage::Php,
+            SupportedLanguage::Bash,
+            SupportedLanguage::Sql,
+            SupportedLanguage::Markdown,
+            SupportedLanguage::Yaml,
+            SupportedLanguage::Json,
+            SupportedLanguage::Toml,
+            SupportedLanguage::Dockerfile,
+            SupportedLanguage::Make,
+            SupportedLanguage::Protobuf,
+            SupportedLanguage::Scala,
+            SupportedLanguage::Groovy,
+            SupportedLanguage::Elixir,
+            SupportedLanguage::Erlang,
+            SupportedLanguage::Haskell,
+            SupportedLanguage::OCaml,
+            SupportedLanguage::Zig,
+            SupportedLanguage::Nim,
+            SupportedLanguage::Lua,
+            SupportedLanguage::Html,
+            SupportedLanguage::Css,
+            SupportedLanguage::Scss,
+            SupportedLanguage::Jupyter,
+            SupportedLanguage::Vue,
+            SupportedLanguage::Svelte,
+            SupportedLanguage::Jinja,
+            SupportedLanguage::GoTemplate,
+            SupportedLanguage::Erb,
+            SupportedLanguage::Graphql,
+            SupportedLanguage::Hcl,
         ];
 
         for lang in languages {
@@ -325,6 +1388,41 @@ mod tests {
         }
     }
 
+    #[test]
+    fn test_from_file_path_sniffs_headers_and_extensionless_files() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let write = |name: &str, content: &str| {
+            let path = temp_dir.path().join(name);
+            std::fs::write(&path, content).unwrap();
+            path.to_str().unwrap().to_string()
+        };
+
+        let c_header = write("point.h", "struct point { int x; int y; };\n");
+        let cpp_header = write(
+            "shape.h",
+            "class Shape {\npublic:\n  virtual ~Shape();\n};\n",
+        );
+        let go_tool = write("tool", "package main\n\nfunc main() {}\n");
+        let modeline = write("build.inc", "// vim: set ft=cpp :\nint x;\n");
+
+        assert_eq!(
+            SupportedLanguage::from_file_path(&c_header),
+            Some(SupportedLanguage::C)
+        );
+        assert_eq!(
+            SupportedLanguage::from_file_path(&cpp_header),
+            Some(SupportedLanguage::Cpp)
+        );
+        assert_eq!(
+            SupportedLanguage::from_file_path(&go_tool),
+            Some(SupportedLanguage::Go)
+        );
+        assert_eq!(
+            SupportedLanguage::from_file_path(&modeline),
+            Some(SupportedLanguage::Cpp)
+        );
+    }
+
     #[test]
     fn test_from_file_path_returns_none_for_unsupported_types() {
         use tempfile::NamedTempFile;
@@ -366,6 +1464,14 @@ mod tests {
             SupportedLanguage::from_magika_label("java"),
             Some(SupportedLanguage::Java)
         );
+        assert_eq!(
+            SupportedLanguage::from_magika_label("c"),
+            Some(SupportedLanguage::C)
+        );
+        assert_eq!(
+            SupportedLanguage::from_magika_label("cpp"),
+            Some(SupportedLanguage::Cpp)
+        );
         assert_eq!(SupportedLanguage::from_magika_label("txt"), None);
         assert_eq!(SupportedLanguage::from_magika_label("unknown"), None);
     }
@@ -4,37 +4,392 @@
 //! and extracting statistics about functions and class/struct definitions
 //! across multiple programming languages.
 //!
+//! # Library usage
+//!
+//! The analysis pipeline is also available to other tools. `analyze_path`
+//! analyzes a file or directory and returns the same structured results the
+//! command-line reports are rendered from:
+//!
+//! ```no_run
+//! use code_stats_rs::{DirectoryOptions, analyze_path};
+//! use std::path::Path;
+//!
+//! let options = DirectoryOptions {
+//!     ignore_patterns: vec!["target".to_string()],
+//!     ..DirectoryOptions::default()
+//! };
+//! let stats = analyze_path(Path::new("src"), &options)?;
+//!
+//! println!(
+//!     "{} files, {} functions",
+//!     stats.total_files(),
+//!     stats.total_stats.function_count
+//! );
+//! for offender in stats.complexity_offenders(10) {
+//!     let function = offender.function;
+//!     println!("{}:{} {}", offender.path.display(), function.start_line, function.name);
+//! }
+//! # Ok::<(), code_stats_rs::CodeStatsError>(())
+//! ```
+//!
+//! Keep a `CodeAnalyzer` to analyze several paths with the same parsers, or
+//! `CodeAnalyzer::analyze_text` for source that is not on disk. All result
+//! types implement `serde::Serialize`.
+//!
 //! # Architecture
 //!
 //! The crate is organized into several modules:
 //!
 //! - `analyzer` - Core analysis engine that orchestrates parsing and statistics collection
+//! - `annotations` - GitHub Actions annotations and GitLab Code Quality reports of threshold violations
+//! - `badge` - shields.io-style SVG badges for the `badge` subcommand
+//! - `baseline` - Metric snapshots and regression checks for CI gates
+//! - `beam` - Elixir and Erlang definitions, arities, and GenServer callbacks
+//! - `cache` - On-disk cache of per-file results keyed by content hash
+//! - `calls` - Call sites and the per-package call graph for `--call-graph` and `--unreached`
 //! - `cli` - Command-line interface and argument parsing
+//! - `closures` - Anonymous functions, closures, and lambdas and their nesting depth
+//! - `columns` - Display columns of locations with tabs expanded to the `.editorconfig` tab width
+//! - `comments` - Code/comment/blank line counts and doc-comment coverage
+//! - `compare` - Comparison of two saved JSON reports for the `compare` subcommand
+//! - `complexity` - Per-function cyclomatic complexity
+//! - `component` - Script, style, and template sections of Vue and Svelte components
+//! - `config` - Project settings from `.codestats.toml`
+//! - `configuration` - Key counts and nesting depth of YAML, JSON, and TOML files
+//! - `csv` - CSV output with one row per file or function
+//! - `detect` - Shebang, modeline, and content sniffing plus `--lang-map` overrides
+//! - `diff` - Statistics for files and functions changed since a git ref
+//! - `distribution` - Percentiles and histograms of file and function sizes
+//! - `duplicates` - Structural clone detection over normalized subtrees
+//! - `embedded` - Lua embedded in nginx, YAML, and TOML files for `--embedded-lua`
+//! - `encoding` - Encoding detection and transcoding of UTF-16 and Latin-1 sources
 //! - `error` - Error types and handling
+//! - `extractor` - The `Extractor` interface and the registry of per-language extractors
+//! - `fences` - Prose line counts and fenced code blocks of Markdown documents
 //! - `formatter` - Output formatting for different display modes
+//! - `functional` - Haskell and OCaml bindings, arities, and module exports
+//! - `generics` - Generic declarations, type parameters, and instantiations
+//! - `golang` - Goroutines, channels, error returns, and the exported API of Go files
+//! - `grammar` - Tree-sitter grammars loaded at runtime from shared libraries
+//! - `graphql` - Types, fields, and operations of GraphQL files and the schema for `--graphql-schema`
+//! - `halstead` - Halstead volume and effort and the maintainability index of functions
+//! - `handling` - Error checks, fallible calls, panics, and assertions per function
+//! - `health` - ERROR and MISSING node locations and parse health
+//! - `history` - Time series of metrics across git revisions for the `history` subcommand
+//! - `hotspots` - Churn from git log times complexity, ranked for the `hotspots` subcommand
+//! - `html` - Self-contained HTML report with sortable tables
+//! - `identifiers` - Identifier lengths and single-letter names for `--identifiers`
+//! - `imports` - Import statements and the module dependency graph for `--deps`
+//! - `interfaces` - Interfaces and traits with their implementing types for `--implementations`
 //! - `language` - Language detection and configuration
+//! - `license` - License headers and the per-license inventory for `--licenses`
+//! - `lint` - User-defined lint rules over the syntax tree for `--lint`
+//! - `logical` - Logical lines of code counted from statements
+//! - `markdown` - Compact Markdown summaries for pull-request comments
+//! - `members` - Field and base type counts of class and struct declarations
+//! - `notebook` - Cells of Jupyter notebooks and the code cells analyzed in the kernel's language
+//! - `origin` - Detection of generated and vendored code
+//! - `outline` - Hierarchical declaration outlines for the `outline` endpoint of `serve`
+//! - `ownership` - Lines, functions, and complexity by author or `CODEOWNERS` owner for `--by-author`
 //! - `parser` - Tree-sitter integration and AST traversal
+//! - `plugin` - Custom metrics from external programs over a line-delimited JSON protocol for `--plugins`
+//! - `profile` - Per-file and per-language parse time, bytes, and peak memory for `--profile`
+//! - `prometheus` - Prometheus gauges for `--format prometheus` and the `serve` subcommand
+//! - `proto` - Services and RPC methods of Protobuf files for `--proto-inventory`
+//! - `query` - User-defined tree-sitter queries reported as named counters
+//! - `remote` - Analysis of `.zip`/`.tar`/`.tar.gz` archives and git URLs without a checkout
+//! - `rollup` - Per-directory and per-type totals for `--group-by`
+//! - `sarif` - SARIF 2.1.0 output for threshold violations
+//! - `server` - HTTP and JSON-RPC server of the `serve` subcommand with metrics and analysis endpoints
+//! - `signature` - Function names, qualified names, and parameter counts
+//! - `sqlite` - Metric snapshots appended to an SQLite database for `--output sqlite:FILE`
 //! - `stats` - Data structures for storing analysis results
+//! - `strings` - User-facing string literals for translation audits with `--strings`
+//! - `switches` - Switch and match statements, their branch counts, and default arms
+//! - `systems` - Zig container names and `pub` declarations, Nim exports and parameters
+//! - `tags` - universal-ctags compatible tags files
+//! - `templates` - Tags, conditionals, and loops of Jinja, Go, and ERB templates
+//! - `terraform` - Resources by provider, modules, variables, and outputs of Terraform files
+//! - `testcode` - Test file detection by language naming conventions
+//! - `todos` - TODO/FIXME marker comments with optional git blame for `--todos`
+//! - `tokens` - Syntax and estimated LLM token counts and context budgets for `--tokens`
+//! - `treemap` - HTML treemap of lines of code colored by complexity for the `treemap` subcommand
+//! - `tui` - Interactive terminal dashboard for the `tui` subcommand
+//! - `watch` - Incremental re-analysis on filesystem changes
+//! - `web` - HTML element and CSS/SCSS rule counts and the inline scripts and styles of HTML
 //!
 //! See the `language` module for supported programming languages.
 
 /// Core analysis engine for processing files and directories.
 mod analyzer;
 
+/// CI annotation output for threshold violations.
+mod annotations;
+
+/// SVG badges for the `badge` subcommand.
+mod badge;
+
+/// Baseline files for the `baseline write` and `check` subcommands.
+mod baseline;
+
+/// Function and module definitions of Elixir and Erlang.
+mod beam;
+
+/// Content-hash keyed cache of per-file analysis results.
+mod cache;
+
+/// Call sites, entry points, and the call graph for `--call-graph`.
+mod calls;
+
 /// Command-line interface definitions and execution logic.
 pub mod cli;
 
+/// Anonymous functions, closures, and lambdas.
+mod closures;
+
+/// Tab-expanded display columns and `.editorconfig` tab widths.
+mod columns;
+
+/// Line classification and doc-comment coverage.
+mod comments;
+
+/// Comparison of saved JSON reports.
+mod compare;
+
+/// Cyclomatic complexity computation for function nodes.
+mod complexity;
+
+/// Sections of single-file components.
+mod component;
+
+/// Project configuration file loading and discovery.
+mod config;
+
+/// Metrics of configuration files analyzed as input.
+mod configuration;
+
+/// CSV output for `--format csv`.
+mod csv;
+
+/// Language sniffing from file content and user overrides.
+mod detect;
+
+/// Git diff mode for `--diff`.
+mod diff;
+
+/// Size distributions for `--distribution`.
+mod distribution;
+
+/// Duplicate code detection for `--duplicates`.
+mod duplicates;
+
+/// Lua blocks of nginx configurations and configuration files.
+mod embedded;
+
+/// Source file encoding detection and transcoding.
+mod encoding;
+
 /// Error types and result definitions.
 mod error;
 
+/// Per-language extractors turning syntax trees into statistics.
+mod extractor;
+
+/// Markdown prose lines and fenced code block extraction.
+mod fences;
+
 /// Output formatting utilities for different display modes.
 mod formatter;
 
+/// Bindings and declarations of Haskell and OCaml.
+mod functional;
+
+/// Generic declarations and instantiations.
+mod generics;
+
+/// Go-specific metrics: goroutines, channels, `defer`, and error returns.
+mod golang;
+
+/// Grammars loaded from shared libraries for `--grammar-dir`.
+mod grammar;
+
+/// Schema types and operations of GraphQL documents.
+mod graphql;
+
+/// Halstead metrics and the maintainability index.
+mod halstead;
+
+/// Error-handling constructs, panics, and assertions.
+mod handling;
+
+/// ERROR and MISSING nodes of syntax trees.
+mod health;
+
+/// Metrics of historical revisions read with git plumbing.
+mod history;
+
+/// Threshold checks of staged changes for pre-commit hooks.
+mod hook;
+
+/// Churn and complexity hotspots.
+mod hotspots;
+
+/// Standalone HTML report output.
+mod html;
+
+/// Identifier naming statistics for `--identifiers`.
+mod identifiers;
+
+/// Import statements and the module dependency graph for `--deps`.
+mod imports;
+
+/// Interface and trait implementation inventory for `--implementations`.
+mod interfaces;
+
 /// Language detection and tree-sitter language configuration.
 mod language;
 
+/// License header detection and inventory.
+mod license;
+
+/// Lint rules defined by tree-sitter queries.
+mod lint;
+
+/// Logical line counting from statement nodes.
+mod logical;
+
+/// Markdown summary output for pull-request comments.
+mod markdown;
+
+/// Fields and base types of type declarations.
+mod members;
+
+/// Cells and code cells of Jupyter notebooks.
+mod notebook;
+
+/// Generated and vendored code detection.
+mod origin;
+
+/// Declaration outlines nested by range.
+mod outline;
+
+/// Attribution of code to authors and code owners.
+mod ownership;
+
 /// Tree-sitter parsing and AST analysis.
 mod parser;
 
+/// Subprocess plugins reporting custom metrics.
+mod plugin;
+
+/// Timing and memory telemetry of a run.
+mod profile;
+
+/// Prometheus metrics output.
+mod prometheus;
+
+/// Protobuf service and RPC method inventory.
+mod proto;
+
+/// Custom query loading and execution.
+mod query;
+
+/// Archive and git URL analysis from memory.
+mod remote;
+
+/// Per-directory and per-type rollups of file statistics.
+mod rollup;
+
+/// SARIF output for code scanning integrations.
+mod sarif;
+
+/// HTTP server answering metrics scrapes and analysis requests.
+mod server;
+
+/// Function signature extraction for per-function reports.
+mod signature;
+
+/// SQLite history of per-file and per-function metrics.
+mod sqlite;
+
 /// Statistics data structures for storing analysis results.
 mod stats;
+
+/// User-facing string literal extraction for `--strings`.
+mod strings;
+
+/// Switch and match statements and their arms.
+mod switches;
+
+/// Declarations of Zig and Nim.
+mod systems;
+
+/// Tags file generation for `--emit-tags`.
+mod tags;
+
+/// Tags and control structures of template languages.
+mod templates;
+
+/// Top-level blocks of Terraform configurations.
+mod terraform;
+
+/// Test file detection by language naming conventions.
+mod testcode;
+
+/// Marker comments and their git blame authors for `--todos`.
+mod todos;
+
+/// Token counts and context budgeting for `--tokens`.
+mod tokens;
+
+/// Squarified treemap page of lines of code and complexity.
+mod treemap;
+
+/// Language, file tree, and function panes of the `tui` dashboard.
+mod tui;
+
+/// Versions of the grammars and their pins.
+mod versions;
+
+/// Watch mode that re-analyzes changed files.
+mod watch;
+
+/// Elements, rules, and inline code of HTML and stylesheets.
+mod web;
+
+/// Per-repository and merged metrics of several roots.
+mod workspace;
+
+pub use analyzer::{CodeAnalyzer, DEFAULT_MAX_PARSE_SIZE, DirectoryOptions, analyze_path};
+pub use closures::ClosureStats;
+pub use comments::{DocCoverage, LineStats};
+pub use component::ComponentStats;
+pub use configuration::ConfigStats;
+pub use detect::LanguageMap;
+pub use encoding::SourceEncoding;
+pub use error::{CodeStatsError, Result};
+pub use extractor::{BuiltinExtractor, Extractor, ExtractorQuery, ExtractorRegistry};
+pub use fences::EmbeddedCode;
+pub use generics::GenericsStats;
+pub use golang::{GoStats, MethodSet};
+pub use grammar::{DynamicGrammar, load_grammar, load_grammar_dir};
+pub use graphql::{GraphqlStats, SchemaField, SchemaType};
+pub use halstead::Halstead;
+pub use handling::{ErrorHandling, ErrorHandlingStats};
+pub use health::{ParseIssue, ParseIssueKind};
+pub use interfaces::{ImplementsStats, InterfaceStats};
+pub use language::SupportedLanguage;
+pub use notebook::NotebookStats;
+pub use origin::CodeOrigin;
+pub use parser::{CodeStats, FunctionStats, StatementStats, TypeStats};
+pub use proto::{RpcStats, ServiceStats};
+pub use stats::{
+    ConfigurationStats, DirectoryStats, FileStats, FunctionRef, GeneratedStats, LanguageStats,
+    SwitchRef, TestStats,
+};
+pub use switches::SwitchStats;
+pub use templates::TemplateStats;
+pub use terraform::TerraformStats;
+pub use todos::TodoComment;
+pub use tokens::TokenStats;
+pub use web::WebStats;
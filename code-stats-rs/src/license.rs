@@ -0,0 +1,252 @@
+//! License headers in the leading comments of source files, for
+//! `--licenses` and `--require-header`.
+//!
+//! The header is the run of comments a file starts with, after a shebang or
+//! PHP's opening tag. An `SPDX-License-Identifier:` line names the license
+//! directly, expressions such as `MIT OR Apache-2.0` included; otherwise the
+//! comments are matched against the wording of the common license notices.
+//! A header with a copyright notice in neither form is reported as
+//! `UNKNOWN_LICENSE`, so that it still counts as a header.
+
+use crate::comments::is_comment;
+use crate::language::SupportedLanguage;
+use crate::stats::DirectoryStats;
+use serde::Serialize;
+use std::collections::BTreeMap;
+use std::path::PathBuf;
+use tree_sitter::Node;
+
+/// License of a header with a copyright notice but no recognized license.
+pub(crate) const UNKNOWN_LICENSE: &str = "Unknown";
+
+/// Marker of an SPDX license identifier line.
+const SPDX_MARKER: &str = "SPDX-License-Identifier:";
+
+/// Phrases of license notices, lower-cased, and the SPDX identifier of the
+/// license they belong to. Earlier entries win, so that the GNU variants are
+/// told apart.
+const NOTICES: [(&str, &str); 10] = [
+    ("gnu affero general public license", "AGPL-3.0"),
+    ("gnu lesser general public license", "LGPL"),
+    ("gnu general public license", "GPL"),
+    ("apache license, version 2.0", "Apache-2.0"),
+    ("apache.org/licenses/license-2.0", "Apache-2.0"),
+    ("mozilla public license", "MPL-2.0"),
+    ("permission is hereby granted, free of charge", "MIT"),
+    ("redistribution and use in source and binary forms", "BSD"),
+    ("permission to use, copy, modify, and/or distribute", "ISC"),
+    ("this is free and unencumbered software", "Unlicense"),
+];
+
+/// Number of files under one license.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct LicenseCount {
+    /// SPDX identifier or expression, or `UNKNOWN_LICENSE`
+    pub license: String,
+    pub files: usize,
+}
+
+/// License headers of an analyzed file or directory.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct LicenseReport {
+    /// Number of files checked for a header
+    pub files: usize,
+    /// Files per license, most files first
+    pub licenses: Vec<LicenseCount>,
+    /// Checked files without a license header, by path
+    pub missing: Vec<PathBuf>,
+}
+
+/// Detects the license header of a parsed file.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the parsed file
+/// * `source` - The source code the tree was parsed from
+///
+/// # Returns
+///
+/// The SPDX identifier or expression of the license, `UNKNOWN_LICENSE` for a
+/// copyright notice without a recognized license, or `None` without a header
+pub(crate) fn license_header(root: &Node, source: &[u8]) -> Option<String> {
+    let mut header = String::new();
+    let mut cursor = root.walk();
+    for child in root.named_children(&mut cursor) {
+        if is_comment(&child) {
+            header.push_str(child.utf8_text(source).unwrap_or_default());
+            header.push('\n');
+        } else if !matches!(child.kind(), "php_tag" | "hash_bang_line" | "shebang") {
+            break;
+        }
+    }
+    detect_license(&header)
+}
+
+/// Returns the license a header comment names, see `license_header`.
+fn detect_license(header: &str) -> Option<String> {
+    if let Some(start) = header.find(SPDX_MARKER) {
+        let rest = &header[start + SPDX_MARKER.len()..];
+        let expression = rest
+            .lines()
+            .next()
+            .unwrap_or_default()
+            .trim()
+            .trim_end_matches("*/")
+            .trim_end_matches("-->")
+            .trim();
+        if !expression.is_empty() {
+            return Some(expression.to_string());
+        }
+    }
+
+    // Comment markers and line breaks do not matter to the wording
+    let text = header
+        .lines()
+        .map(|line| {
+            line.trim()
+                .trim_start_matches(['/', '*', '#', '-', ';', '!', '%'])
+        })
+        .collect::<Vec<_>>()
+        .join(" ")
+        .to_lowercase();
+    let text = text.split_whitespace().collect::<Vec<_>>().join(" ");
+    let license = NOTICES
+        .iter()
+        .find(|(phrase, _)| text.contains(phrase))
+        .map(|(_, license)| match *license {
+            "GPL" | "LGPL" => {
+                let version = if text.contains("version 2.1") {
+                    "2.1"
+                } else if text.contains("version 2") {
+                    "2.0"
+                } else {
+                    "3.0"
+                };
+                format!("{license}-{version}")
+            }
+            "BSD" if text.contains("neither the name") => "BSD-3-Clause".to_string(),
+            "BSD" => "BSD-2-Clause".to_string(),
+            license => license.to_string(),
+        });
+    license.or_else(|| {
+        (text.contains("copyright") || text.contains("(c)")).then(|| UNKNOWN_LICENSE.to_string())
+    })
+}
+
+/// Returns true if files of `language` are expected to carry a license
+/// header. Configuration files, Markdown documents, and notebooks are not.
+pub(crate) fn has_header(language: &SupportedLanguage) -> bool {
+    !language.is_configuration()
+        && !matches!(
+            language,
+            SupportedLanguage::Markdown | SupportedLanguage::Jupyter
+        )
+}
+
+/// Collects the license headers of the code files of `stats`.
+///
+/// Generated and vendored files, configuration files, documents, and files
+/// without code, such as an empty `__init__.py`, are not checked.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics of the analyzed files
+pub(crate) fn license_report(stats: &DirectoryStats) -> LicenseReport {
+    let mut counts: BTreeMap<&str, usize> = BTreeMap::new();
+    let mut missing = Vec::new();
+    let mut files = 0;
+    for file in stats
+        .code_file_stats()
+        .filter(|file| has_header(&file.language) && file.stats.lines.code > 0)
+    {
+        files += 1;
+        match &file.stats.license {
+            Some(license) => *counts.entry(license).or_default() += 1,
+            None => missing.push(file.path.clone()),
+        }
+    }
+
+    let mut licenses: Vec<LicenseCount> = counts
+        .into_iter()
+        .map(|(license, files)| LicenseCount {
+            license: license.to_string(),
+            files,
+        })
+        .collect();
+    licenses.sort_by(|a, b| {
+        b.files
+            .cmp(&a.files)
+            .then_with(|| a.license.cmp(&b.license))
+    });
+    missing.sort();
+    LicenseReport {
+        files,
+        licenses,
+        missing,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::create_parser;
+
+    #[test]
+    fn test_spdx_identifiers() {
+        assert_eq!(
+            detect_license("// SPDX-License-Identifier: MIT OR Apache-2.0\n"),
+            Some("MIT OR Apache-2.0".to_string())
+        );
+        assert_eq!(
+            detect_license("/* SPDX-License-Identifier: GPL-2.0-only */\n"),
+            Some("GPL-2.0-only".to_string())
+        );
+        assert_eq!(
+            detect_license(
+                "# Copyright 2024 Example Corp\n# SPDX-License-Identifier: BSD-3-Clause\n"
+            ),
+            Some("BSD-3-Clause".to_string())
+        );
+    }
+
+    #[test]
+    fn test_license_notices() {
+        let apache = "// Licensed under the Apache License, Version 2.0 (the \"License\");\n\
+                      // you may not use this file except in compliance with the License.\n";
+        assert_eq!(detect_license(apache), Some("Apache-2.0".to_string()));
+
+        let gpl = "# This program is free software: you can redistribute it under the\n\
+                   # terms of the GNU General Public License as published by the Free\n\
+                   # Software Foundation, either version 3 of the License.\n";
+        assert_eq!(detect_license(gpl), Some("GPL-3.0".to_string()));
+
+        let bsd = " * Redistribution and use in source and binary forms, with or without\n\
+                   * modification, are permitted provided that ...\n\
+                   * Neither the name of the copyright holder nor ...\n";
+        assert_eq!(detect_license(bsd), Some("BSD-3-Clause".to_string()));
+
+        assert_eq!(
+            detect_license("// Copyright (c) 2023 Example Corp. All rights reserved.\n"),
+            Some(UNKNOWN_LICENSE.to_string())
+        );
+        assert_eq!(detect_license("// Parses the configuration file.\n"), None);
+        assert_eq!(detect_license(""), None);
+    }
+
+    #[test]
+    fn test_only_leading_comments_are_the_header() {
+        let language = SupportedLanguage::Python;
+        let mut parser = create_parser(&language).unwrap();
+
+        let source = "#!/usr/bin/env python3\n# SPDX-License-Identifier: MIT\nimport os\n";
+        let tree = parser.parse(source, None).unwrap();
+        assert_eq!(
+            license_header(&tree.root_node(), source.as_bytes()),
+            Some("MIT".to_string())
+        );
+
+        let source = "import os\n# SPDX-License-Identifier: MIT\n";
+        let tree = parser.parse(source, None).unwrap();
+        assert_eq!(license_header(&tree.root_node(), source.as_bytes()), None);
+    }
+}
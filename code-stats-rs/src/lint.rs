@@ -0,0 +1,557 @@
+//! User-defined lint rules over the syntax tree for `--lint`.
+//!
+//! Rules are declared in the configuration file, one `[[rule]]` table each:
+//!
+//! ```toml
+//! [[rule]]
+//! id = "no-printf"
+//! language = "go"
+//! severity = "warning"                 # error, warning (default), or note
+//! message = "use the logger instead of fmt.{fn}"
+//! query = '''
+//! (call_expression
+//!   function: (selector_expression
+//!     operand: (identifier) @pkg (#eq? @pkg "fmt")
+//!     field: (field_identifier) @fn (#eq? @fn "Printf"))) @finding
+//! '''
+//! # Skip files matching this query, here those of package main
+//! unless = '(package_clause (package_identifier) @name (#eq? @name "main"))'
+//! ```
+//!
+//! Every match of the query is a finding, located at its `@finding` capture,
+//! or at its first capture if there is no `@finding`. `{name}` in the message
+//! is replaced with the text of the capture `name`. A query can also live in
+//! a `.scm` file named by `path`, relative to the configuration file.
+//!
+//! Instead of a query, a rule can select switch and match statements by their
+//! arms (see the `switches` module):
+//!
+//! ```toml
+//! [[rule]]
+//! id = "exhaustive-switch"
+//! language = "typescript"
+//! message = "{kind} with {branches} branches has no default"
+//! # Statements with more than 8 branches and without a default arm
+//! switch = { max_branches = 8, without_default = true }
+//! ```
+//!
+//! Such a finding is located at the whole statement, and `{kind}` and
+//! `{branches}` in the message are replaced with its keyword and number of
+//! branches.
+
+use crate::analyzer::{CodeAnalyzer, DirectoryOptions};
+use crate::columns::node_columns;
+use crate::error::{CodeStatsError, Result};
+use crate::language::{Dialect, SupportedLanguage};
+use crate::switches::{SwitchStats, has_switches, switches};
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+use tree_sitter::{Node, Query, QueryCursor, QueryMatch, StreamingIterator};
+
+/// Capture that marks the node a finding is reported at.
+const FINDING_CAPTURE: &str = "finding";
+
+/// How serious a finding is.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, PartialOrd, Ord, Deserialize, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub(crate) enum Severity {
+    Error,
+    #[default]
+    Warning,
+    Note,
+}
+
+impl Severity {
+    /// Label of the severity, which is also its SARIF level.
+    pub(crate) fn label(self) -> &'static str {
+        match self {
+            Severity::Error => "error",
+            Severity::Warning => "warning",
+            Severity::Note => "note",
+        }
+    }
+}
+
+/// A rule as written in a `[[rule]]` table of the configuration file.
+#[derive(Debug, Clone, PartialEq, Eq, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub(crate) struct RuleDefinition {
+    /// Identifier shown with each finding, e.g. `no-printf`
+    pub id: String,
+    /// Language the rule applies to (e.g. `go`, `typescript`)
+    pub language: String,
+    #[serde(default)]
+    pub severity: Severity,
+    /// Message of each finding, with `{capture}` placeholders
+    pub message: String,
+    /// Inline query source
+    pub query: Option<String>,
+    /// Path to a `.scm` file, relative to the configuration file, as an
+    /// alternative to `query`
+    pub path: Option<PathBuf>,
+    /// Switch statements to report, as an alternative to `query`
+    pub switch: Option<SwitchCondition>,
+    /// Query that exempts the files it matches
+    pub unless: Option<String>,
+}
+
+/// The `switch` table of a rule: which switch and match statements are
+/// findings.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub(crate) struct SwitchCondition {
+    /// Branches a statement may have without being reported; 0 reports
+    /// every statement
+    #[serde(default)]
+    pub max_branches: usize,
+    /// Only report statements without a default arm
+    #[serde(default)]
+    pub without_default: bool,
+}
+
+impl SwitchCondition {
+    /// Returns true if the statement is a finding.
+    fn matches(&self, switch: &SwitchStats) -> bool {
+        switch.branches > self.max_branches && !(self.without_default && switch.has_default)
+    }
+}
+
+/// What a compiled rule looks for.
+#[derive(Debug)]
+enum Matcher {
+    Query(Query),
+    Switch(SwitchCondition),
+}
+
+/// A rule compiled for one grammar.
+#[derive(Debug)]
+struct CompiledRule {
+    /// Index of the rule in `RuleSet::rules`
+    index: usize,
+    matcher: Matcher,
+    unless: Option<Query>,
+}
+
+/// Compiled lint rules, grouped by the grammar they were compiled for.
+#[derive(Debug, Default)]
+pub(crate) struct RuleSet {
+    /// The definitions, in configuration order
+    rules: Vec<RuleDefinition>,
+    compiled: HashMap<(SupportedLanguage, Dialect), Vec<CompiledRule>>,
+}
+
+impl RuleSet {
+    /// Compiles rule definitions, resolving `.scm` paths against `base_dir`.
+    ///
+    /// TypeScript rules are compiled for both the TypeScript and TSX
+    /// grammars so they apply to `.ts` and `.tsx` files alike.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(RuleSet)` - All rules compiled successfully
+    /// * `Err(ConfigError)` - A rule names an unknown language, has no query
+    ///   or two, reuses an id, a query does not compile, or a `switch` rule
+    ///   is for a language without switch statements
+    pub(crate) fn compile(definitions: &[RuleDefinition], base_dir: &Path) -> Result<Self> {
+        let mut set = Self::default();
+        for (index, definition) in definitions.iter().enumerate() {
+            let invalid = |message: String| {
+                CodeStatsError::ConfigError(format!("rule '{}': {message}", definition.id))
+            };
+            if definitions[..index]
+                .iter()
+                .any(|earlier| earlier.id == definition.id)
+            {
+                return Err(invalid("defined more than once".to_string()));
+            }
+
+            let language = SupportedLanguage::from_name(&definition.language)
+                .ok_or_else(|| invalid(format!("unknown language '{}'", definition.language)))?;
+            let source =
+                match (&definition.path, &definition.query, &definition.switch) {
+                    (Some(path), None, None) => {
+                        let path = base_dir.join(path);
+                        Some(fs::read_to_string(&path).map_err(|e| {
+                            invalid(format!("failed to read {}: {e}", path.display()))
+                        })?)
+                    }
+                    (None, Some(query), None) => Some(query.clone()),
+                    (None, None, Some(_)) if !has_switches(&language) => {
+                        return Err(invalid(format!(
+                            "{} has no switch statements to check",
+                            language.name()
+                        )));
+                    }
+                    (None, None, Some(_)) => None,
+                    _ => {
+                        return Err(invalid(
+                            "exactly one of `path`, `query`, or `switch` is required".to_string(),
+                        ));
+                    }
+                };
+
+            for &dialect in Dialect::all(language) {
+                let grammar = language.get_language_with_dialect(dialect);
+                let compile = |source: &str, field: &str| {
+                    Query::new(&grammar, source)
+                        .map_err(|e| invalid(format!("`{field}`: {e} (line {})", e.row + 1)))
+                };
+                let matcher = match (&source, definition.switch) {
+                    (Some(source), _) => {
+                        let query = compile(source, "query")?;
+                        if query.capture_names().is_empty() {
+                            return Err(invalid(
+                                "the query needs a capture to report findings at".to_string(),
+                            ));
+                        }
+                        Matcher::Query(query)
+                    }
+                    (None, condition) => Matcher::Switch(condition.unwrap_or_default()),
+                };
+                let unless = definition
+                    .unless
+                    .as_deref()
+                    .map(|unless| compile(unless, "unless"))
+                    .transpose()?;
+                set.compiled
+                    .entry((language, dialect))
+                    .or_default()
+                    .push(CompiledRule {
+                        index,
+                        matcher,
+                        unless,
+                    });
+            }
+        }
+        set.rules = definitions.to_vec();
+        Ok(set)
+    }
+
+    /// The rule definitions, in configuration order.
+    pub(crate) fn rules(&self) -> &[RuleDefinition] {
+        &self.rules
+    }
+
+    /// Returns true if no rule is defined.
+    pub(crate) fn is_empty(&self) -> bool {
+        self.rules.is_empty()
+    }
+}
+
+/// A match of a lint rule.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct Finding {
+    /// Id of the rule
+    pub rule: String,
+    pub severity: Severity,
+    pub path: PathBuf,
+    /// 1-based line of the reported node
+    pub line: usize,
+    /// 1-based display column of the reported node, with tabs expanded
+    pub column: usize,
+    pub end_line: usize,
+    /// 1-based display column just past the end of the reported node
+    pub end_column: usize,
+    pub message: String,
+}
+
+/// Applies lint rules to a file or to every supported file below a
+/// directory.
+///
+/// Files are read and skipped as described in `CodeAnalyzer::visit_sources`;
+/// files in languages without rules are not parsed.
+///
+/// # Arguments
+///
+/// * `analyzer` - Analyzer providing the parsers
+/// * `path` - File or directory to check
+/// * `options` - Traversal and exclusion settings for directories
+/// * `rules` - The compiled rules
+///
+/// # Returns
+///
+/// The findings, in file and source order
+pub(crate) fn lint(
+    analyzer: &mut CodeAnalyzer,
+    path: &Path,
+    options: &DirectoryOptions,
+    rules: &RuleSet,
+) -> Result<Vec<Finding>> {
+    let mut findings = Vec::new();
+    analyzer.visit_sources(path, options, |analyzer, file, language, source_code| {
+        let dialect = Dialect::from_file_path(language, &file.to_string_lossy());
+        let Some(compiled) = rules.compiled.get(&(language, dialect)) else {
+            return Ok(());
+        };
+        let tree = analyzer.parse(file, language, source_code)?;
+        let tab_width = analyzer.tab_width(file);
+        let mut file_findings = Vec::new();
+        for rule in compiled {
+            file_findings.extend(check(
+                rule,
+                &rules.rules[rule.index],
+                tree.root_node(),
+                source_code,
+                language,
+                file,
+                tab_width,
+            ));
+        }
+        file_findings.sort_by_key(|finding| (finding.line, finding.column));
+        findings.extend(file_findings);
+        Ok(())
+    })?;
+    Ok(findings)
+}
+
+/// Returns the findings of one rule in a file.
+fn check(
+    rule: &CompiledRule,
+    definition: &RuleDefinition,
+    root: Node,
+    source_code: &str,
+    language: SupportedLanguage,
+    file: &Path,
+    tab_width: usize,
+) -> Vec<Finding> {
+    let source = source_code.as_bytes();
+    let mut cursor = QueryCursor::new();
+    if let Some(unless) = &rule.unless
+        && cursor.matches(unless, root, source).next().is_some()
+    {
+        return Vec::new();
+    }
+
+    let finding = |node: Node, message: String| {
+        let (column, end_column) = node_columns(&node, source, tab_width);
+        Finding {
+            rule: definition.id.clone(),
+            severity: definition.severity,
+            path: file.to_path_buf(),
+            line: node.start_position().row + 1,
+            column,
+            end_line: node.end_position().row + 1,
+            end_column,
+            message,
+        }
+    };
+    let query = match &rule.matcher {
+        Matcher::Query(query) => query,
+        Matcher::Switch(condition) => {
+            return switches(&root, source, &language)
+                .into_iter()
+                .filter(|(_, switch)| condition.matches(switch))
+                .map(|(node, switch)| {
+                    let message = definition
+                        .message
+                        .replace("{kind}", &switch.kind)
+                        .replace("{branches}", &switch.branches.to_string());
+                    finding(node, message)
+                })
+                .collect();
+        }
+    };
+
+    let reported = query.capture_index_for_name(FINDING_CAPTURE).unwrap_or(0);
+    let mut findings = Vec::new();
+    let mut matches = cursor.matches(query, root, source);
+    while let Some(found) = matches.next() {
+        let Some(node) = found
+            .captures
+            .iter()
+            .find(|capture| capture.index == reported)
+            .or_else(|| found.captures.first())
+            .map(|capture| capture.node)
+        else {
+            continue;
+        };
+        findings.push(finding(
+            node,
+            message(&definition.message, query, found, source),
+        ));
+    }
+    findings
+}
+
+/// Fills the `{capture}` placeholders of a message with the text of the
+/// captures of a match; multi-line captures are cut at the first line break.
+fn message(template: &str, query: &Query, found: &QueryMatch, source: &[u8]) -> String {
+    let mut message = template.to_string();
+    for capture in found.captures {
+        let name = query.capture_names()[capture.index as usize];
+        let text = capture.node.utf8_text(source).unwrap_or_default();
+        let text = text.lines().next().unwrap_or_default();
+        message = message.replace(&format!("{{{name}}}"), text);
+    }
+    message
+}
+
+/// Counts the findings of the given severity.
+pub(crate) fn count(findings: &[Finding], severity: Severity) -> usize {
+    findings
+        .iter()
+        .filter(|finding| finding.severity == severity)
+        .count()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    fn rule(id: &str, language: &str, query: &str) -> RuleDefinition {
+        RuleDefinition {
+            id: id.to_string(),
+            language: language.to_string(),
+            severity: Severity::Warning,
+            message: "found {fn}".to_string(),
+            query: Some(query.to_string()),
+            path: None,
+            switch: None,
+            unless: None,
+        }
+    }
+
+    #[test]
+    fn test_rule_definition_defaults() {
+        let table: toml::Table = toml::from_str(
+            r#"
+[[rule]]
+id = "no-unwrap"
+language = "rust"
+message = "avoid unwrap"
+query = "(call_expression) @finding"
+"#,
+        )
+        .unwrap();
+        let definition: RuleDefinition = table["rule"][0].clone().try_into().unwrap();
+        assert_eq!(definition.severity, Severity::Warning);
+        assert_eq!(definition.path, None);
+        assert_eq!(Severity::Error.label(), "error");
+    }
+
+    #[test]
+    fn test_compile_rejects_invalid_rules() {
+        let error = |definitions: &[RuleDefinition]| {
+            RuleSet::compile(definitions, Path::new("."))
+                .unwrap_err()
+                .to_string()
+        };
+        assert!(error(&[rule("a", "cobol", "(x) @x")]).contains("unknown language 'cobol'"));
+
+        let mut both = rule("b", "go", "(x) @x");
+        both.path = Some(PathBuf::from("b.scm"));
+        assert!(error(&[both]).contains("exactly one of `path`, `query`, or `switch`"));
+
+        let mut html = rule("d", "html", "(x) @x");
+        html.query = None;
+        html.switch = Some(SwitchCondition::default());
+        assert!(error(&[html]).contains("Html has no switch statements to check"));
+
+        let twice = rule("c", "go", "(identifier) @fn");
+        assert!(error(&[twice.clone(), twice]).contains("rule 'c': defined more than once"));
+    }
+
+    #[test]
+    fn test_lint_reports_findings() {
+        let temp_dir = TempDir::new().unwrap();
+        fs::write(
+            temp_dir.path().join("util.go"),
+            "package util\n\nfunc a() {\n\tfmt.Printf(\"a\")\n\tfmt.Println(\"b\")\n}\n",
+        )
+        .unwrap();
+        fs::write(
+            temp_dir.path().join("main.go"),
+            "package main\n\nfunc main() { fmt.Printf(\"c\") }\n",
+        )
+        .unwrap();
+        // Columns count the tabs as the editor shows them
+        fs::write(
+            temp_dir.path().join(".editorconfig"),
+            "[*.go]\nindent_style = tab\ntab_width = 4\n",
+        )
+        .unwrap();
+
+        let mut definition = rule(
+            "no-printf",
+            "go",
+            r#"(call_expression
+                 function: (selector_expression
+                   operand: (identifier) @pkg (#eq? @pkg "fmt")
+                   field: (field_identifier) @fn)) @finding"#,
+        );
+        definition.unless =
+            Some(r#"(package_clause (package_identifier) @name (#eq? @name "main"))"#.to_string());
+        let rules = RuleSet::compile(&[definition], Path::new(".")).unwrap();
+
+        let mut analyzer = CodeAnalyzer::new();
+        let findings = lint(
+            &mut analyzer,
+            temp_dir.path(),
+            &DirectoryOptions::default(),
+            &rules,
+        )
+        .unwrap();
+        let found: Vec<(usize, usize, &str)> = findings
+            .iter()
+            .map(|finding| (finding.line, finding.column, finding.message.as_str()))
+            .collect();
+        assert_eq!(found, [(4, 5, "found Printf"), (5, 5, "found Println")]);
+        assert_eq!(count(&findings, Severity::Warning), 2);
+        assert_eq!(count(&findings, Severity::Error), 0);
+    }
+
+    #[test]
+    fn test_switch_rules() {
+        let table: toml::Table = toml::from_str(
+            r#"
+[[rule]]
+id = "exhaustive-switch"
+language = "javascript"
+message = "{kind} with {branches} branches has no default"
+switch = { max_branches = 2, without_default = true }
+"#,
+        )
+        .unwrap();
+        let definition: RuleDefinition = table["rule"][0].clone().try_into().unwrap();
+        assert_eq!(
+            definition.switch,
+            Some(SwitchCondition {
+                max_branches: 2,
+                without_default: true,
+            })
+        );
+
+        let temp_dir = TempDir::new().unwrap();
+        fs::write(
+            temp_dir.path().join("color.js"),
+            "function a(c) {\n  switch (c) {\n    case 1: return 1;\n    case 2: return 2;\n    \
+             case 3: return 3;\n  }\n  switch (c) {\n    case 1: return 1;\n    case 2: return 2;\n    \
+             default: return 0;\n  }\n  switch (c) { case 1: return 1; }\n}\n",
+        )
+        .unwrap();
+        let rules = RuleSet::compile(&[definition], Path::new(".")).unwrap();
+        let mut analyzer = CodeAnalyzer::new();
+        let findings = lint(
+            &mut analyzer,
+            temp_dir.path(),
+            &DirectoryOptions::default(),
+            &rules,
+        )
+        .unwrap();
+        let found: Vec<(usize, usize, usize, &str)> = findings
+            .iter()
+            .map(|finding| {
+                (
+                    finding.line,
+                    finding.column,
+                    finding.end_line,
+                    finding.message.as_str(),
+                )
+            })
+            .collect();
+        assert_eq!(found, [(2, 3, 6, "switch with 3 branches has no default")]);
+    }
+}
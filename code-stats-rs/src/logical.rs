@@ -0,0 +1,158 @@
+//! Logical lines of code counted from statements in the syntax tree.
+//!
+//! Physical line counts depend on formatting: `if (a) { b(); }` is one line
+//! or three depending on the formatter. A logical line is a statement or
+//! declaration instead, so the count stays the same however the code is
+//! wrapped. Blocks and other containers are not lines themselves, while the
+//! statements they hold each are; a compound statement such as an `if`
+//! counts once for its header and once for every statement of its bodies.
+
+use crate::language::SupportedLanguage;
+use tree_sitter::Node;
+
+/// Counts the logical lines of a parsed file.
+///
+/// In C-like languages, Go, Python, and PHP, these are the statement,
+/// declaration, and definition nodes of each grammar (`*_statement`,
+/// `*_declaration`, ...) along with preprocessor directives; Rust adds its
+/// items and the tail expression of each block. Ruby, Kotlin, Swift, Scala,
+/// Groovy, Elixir, Erlang, Haskell, OCaml, Zig, and Nim parse statements as
+/// plain expressions, so every expression directly inside a body counts.
+/// Lua counts the statements of its chunks and blocks, the `elseif` and
+/// `else` parts of an `if` being part of it, and stylesheets each rule,
+/// at-rule, and declaration.
+/// Shell commands count once per pipeline or `&&` chain, Make rules and
+/// recipe lines, Dockerfile instructions, Protobuf definitions, HCL blocks
+/// and arguments, and SQL statements count one each. Configuration files, Markdown prose, and HTML
+/// have no logical lines.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the parsed file
+/// * `language` - The programming language of the source code
+pub(crate) fn logical_lines(root: &Node, language: &SupportedLanguage) -> usize {
+    if language.is_configuration() || *language == SupportedLanguage::Markdown {
+        return 0;
+    }
+    let mut count = 0;
+    let mut stack = vec![(*root, None)];
+    while let Some((node, parent)) = stack.pop() {
+        if !node.kind().contains("comment") && language.rules().is_logical_line(&node, parent) {
+            count += 1;
+        }
+        let mut cursor = node.walk();
+        stack.extend(
+            node.named_children(&mut cursor)
+                .map(|child| (child, Some(node))),
+        );
+    }
+    count
+}
+
+/// Returns true for the statement, declaration, and definition nodes shared
+/// by most grammars.
+///
+/// Blocks that happen to be named like statements, parameters, and nodes
+/// that only wrap another declaration (`export`, decorators, C++ templates)
+/// are left out, so that nothing counts twice. So is a variable declaration
+/// within another declaration or statement, such as the one a C# field
+/// wraps or the initializer of a JavaScript `for`.
+pub(crate) fn is_statement(kind: &str, parent_kind: &str) -> bool {
+    let statement = kind.ends_with("_statement")
+        || kind.ends_with("_declaration")
+        || kind.ends_with("_definition")
+        || kind.ends_with("_directive")
+        || kind.starts_with("preproc_")
+        || matches!(kind, "declaration" | "package_clause" | "elif_clause");
+    if kind == "variable_declaration"
+        && (parent_kind.ends_with("_declaration") || parent_kind.ends_with("_statement"))
+    {
+        return false;
+    }
+    statement
+        && !matches!(
+            kind,
+            "compound_statement"
+                | "empty_statement"
+                | "export_statement"
+                | "decorated_definition"
+                | "template_declaration"
+                | "ambient_declaration"
+                | "friend_declaration"
+                | "parameter_declaration"
+                | "optional_parameter_declaration"
+                | "variadic_parameter_declaration"
+                | "preproc_arg"
+                | "preproc_params"
+                | "preproc_defined"
+                | "preproc_directive"
+        )
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::create_parser;
+
+    fn logical(source: &str, language: SupportedLanguage) -> usize {
+        let mut parser = create_parser(&language).unwrap();
+        let tree = parser.parse(source, None).unwrap();
+        logical_lines(&tree.root_node(), &language)
+    }
+
+    #[test]
+    fn test_formatting_does_not_change_logical_lines() {
+        let compact = "function f(a) { if (a) { log(a); return 1; } return 2; }\n";
+        let expanded = r#"
+// Same code, formatted differently
+function f(a)
+{
+    if (a)
+    {
+        log(a);
+        return 1;
+    }
+
+    return 2;
+}
+"#;
+        // function, if, log, return, return
+        assert_eq!(logical(compact, SupportedLanguage::JavaScript), 5);
+        assert_eq!(logical(expanded, SupportedLanguage::JavaScript), 5);
+    }
+
+    #[test]
+    fn test_rust_logical_lines() {
+        let source = r#"
+use std::fmt;
+
+#[derive(Debug)]
+struct Point {
+    x: i32,
+    y: i32,
+}
+
+fn norm(p: &Point) -> i32 {
+    let sq = p.x * p.x + p.y * p.y;
+    if sq > 0 { sq } else { 0 }
+}
+"#;
+        // use, struct, 2 fields, fn, let, if and its 2 tail expressions
+        assert_eq!(logical(source, SupportedLanguage::Rust), 9);
+    }
+
+    #[test]
+    fn test_python_and_ruby_logical_lines() {
+        let python = "import os\n\ndef f(x):\n    if x: return 1\n    return os.sep\n";
+        assert_eq!(logical(python, SupportedLanguage::Python), 5);
+
+        let ruby = "class Cart\n  def total\n    items.sum(&:price)\n  end\nend\n";
+        assert_eq!(logical(ruby, SupportedLanguage::Ruby), 3);
+    }
+
+    #[test]
+    fn test_shell_pipelines_count_once() {
+        let source = "set -e\nfiles=$(ls | wc -l)\ngrep -q x a && echo found | tee log\n";
+        assert_eq!(logical(source, SupportedLanguage::Bash), 3);
+    }
+}
@@ -0,0 +1,374 @@
+//! Markdown summary for `--format markdown`.
+//!
+//! The output is meant to be posted as a pull-request comment by a bot, so it
+//! stays compact: one table of per-language totals and a complexity line,
+//! with offenders folded into a `<details>` block. Combined with `--diff`, it
+//! lists the functions whose size or complexity changed the most instead.
+
+use crate::diff::{ChangeStatus, DiffReport, FunctionChange, FunctionMetrics};
+use crate::stats::{DirectoryStats, Thresholds};
+use std::fmt::Write;
+use std::path::Path;
+
+/// Number of functions listed in the offender and delta tables.
+const TOP_ROWS: usize = 10;
+
+/// Formats directory statistics as a Markdown summary.
+///
+/// # Arguments
+///
+/// * `stats` - Directory statistics to summarize
+/// * `thresholds` - Limits used to select complexity offenders
+///
+/// # Returns
+///
+/// The Markdown document, without a trailing newline
+///
+/// # Output Format
+///
+/// ```text
+/// ### Code statistics
+///
+/// | Language | Files | Code lines | Functions | Structs/classes |
+/// |:--|--:|--:|--:|--:|
+/// | Go | 2 | 120 | 8 | 1 |
+/// | **Total** | **2** | **120** | **8** | **1** |
+///
+/// Complexity: max 12, mean 3.4, 1 function above 10
+/// ```
+pub(crate) fn format_markdown(stats: &DirectoryStats, thresholds: &Thresholds) -> String {
+    let mut output = String::from("### Code statistics\n\n");
+    output.push_str("| Language | Files | Code lines | Functions | Structs/classes |\n");
+    output.push_str("|:--|--:|--:|--:|--:|\n");
+
+    let mut languages: Vec<_> = stats.total_by_language.iter().collect();
+    languages.sort_by_key(|(lang, _)| format!("{lang:?}"));
+    for (language, lang_stats) in languages {
+        let _ = writeln!(
+            output,
+            "| {language:?} | {} | {} | {} | {} |",
+            lang_stats.file_count,
+            lang_stats.lines.code,
+            lang_stats.function_count,
+            lang_stats.class_struct_count
+        );
+    }
+    let _ = writeln!(
+        output,
+        "| **Total** | **{}** | **{}** | **{}** | **{}** |",
+        stats.code_files(),
+        stats.total_stats.lines.code,
+        stats.total_stats.function_count,
+        stats.total_stats.class_struct_count
+    );
+
+    let offenders = stats.complexity_offenders(thresholds.complexity);
+    let _ = write!(
+        output,
+        "\nComplexity: max {}, mean {:.1}, {} {} above {}",
+        stats.max_complexity(),
+        stats.mean_complexity(),
+        offenders.len(),
+        if offenders.len() == 1 {
+            "function"
+        } else {
+            "functions"
+        },
+        thresholds.complexity
+    );
+
+    if !offenders.is_empty() {
+        output.push_str("\n\n<details><summary>Most complex functions</summary>\n\n");
+        output.push_str("| Function | Location | Lines | Complexity |\n");
+        output.push_str("|:--|:--|--:|--:|\n");
+        for offender in offenders.iter().take(TOP_ROWS) {
+            let function = offender.function;
+            let _ = writeln!(
+                output,
+                "| `{}` | {}:{} | {} | {} |",
+                escape_cell(&function.qualified_name),
+                escape_cell(&offender.path.display().to_string()),
+                function.start_line,
+                function.line_count(),
+                function.complexity
+            );
+        }
+        push_more(&mut output, offenders.len());
+        output.push_str("\n</details>");
+    }
+
+    output
+}
+
+/// Formats a `--diff` report as a Markdown summary of the largest changes.
+///
+/// Touched functions are ranked by how much their complexity changed, then
+/// by how much their length changed; added and removed functions count their
+/// full size as the change.
+///
+/// # Arguments
+///
+/// * `report` - Changed files with their touched functions
+///
+/// # Returns
+///
+/// The Markdown document, without a trailing newline
+///
+/// # Output Format
+///
+/// ```text
+/// ### Changes since main
+///
+/// 2 files changed, 3 functions touched
+///
+/// | Function | File | Change | Lines | Complexity |
+/// |:--|:--|:--|--:|--:|
+/// | `parse` | src/lib.rs | modified | 20 → 25 (+5) | 4 → 6 (+2) |
+/// | `fresh` | src/new.rs | added | 2 (+2) | 1 (+1) |
+/// ```
+pub(crate) fn format_diff_markdown(report: &DiffReport) -> String {
+    let mut output = format!("### Changes since {}\n\n", report.base);
+    if report.files.is_empty() {
+        output.push_str("No changes.");
+        return output;
+    }
+
+    let mut changes: Vec<(&Path, &FunctionChange)> = report
+        .files
+        .iter()
+        .flat_map(|file| {
+            file.functions
+                .iter()
+                .map(|change| (file.path.as_path(), change))
+        })
+        .collect();
+    let _ = write!(
+        output,
+        "{} {} changed, {} {} touched",
+        report.files.len(),
+        if report.files.len() == 1 {
+            "file"
+        } else {
+            "files"
+        },
+        changes.len(),
+        if changes.len() == 1 {
+            "function"
+        } else {
+            "functions"
+        }
+    );
+    if changes.is_empty() {
+        return output;
+    }
+
+    // Largest change first; the sort is stable, so ties keep report order
+    changes.sort_by_key(|(_, change)| {
+        let (lines, complexity) = deltas(change);
+        std::cmp::Reverse((complexity.unsigned_abs(), lines.unsigned_abs()))
+    });
+
+    output.push_str("\n\n| Function | File | Change | Lines | Complexity |\n");
+    output.push_str("|:--|:--|:--|--:|--:|\n");
+    for (path, change) in changes.iter().take(TOP_ROWS) {
+        let label = match change.status {
+            ChangeStatus::Added => "added",
+            ChangeStatus::Modified => "modified",
+            ChangeStatus::Removed => "removed",
+        };
+        let _ = writeln!(
+            output,
+            "| `{}` | {} | {label} | {} | {} |",
+            escape_cell(&change.name),
+            escape_cell(&path.display().to_string()),
+            format_change(
+                change.before.map(|m| m.lines),
+                change.after.map(|m| m.lines)
+            ),
+            format_change(
+                change.before.map(|m| m.complexity),
+                change.after.map(|m| m.complexity)
+            )
+        );
+    }
+    push_more(&mut output, changes.len());
+
+    output.trim_end().to_string()
+}
+
+/// Returns the change in lines and complexity of a touched function.
+fn deltas(change: &FunctionChange) -> (isize, isize) {
+    let metric = |metrics: Option<FunctionMetrics>, value: fn(&FunctionMetrics) -> usize| {
+        metrics.as_ref().map_or(0, value) as isize
+    };
+    (
+        metric(change.after, |m| m.lines) - metric(change.before, |m| m.lines),
+        metric(change.after, |m| m.complexity) - metric(change.before, |m| m.complexity),
+    )
+}
+
+/// Formats `20 → 25 (+5)` for a changed metric, `25` if it is unchanged, and
+/// `2 (+2)` or `2 (-2)` for added and removed functions.
+fn format_change(before: Option<usize>, after: Option<usize>) -> String {
+    match (before, after) {
+        (Some(before), Some(after)) if before == after => after.to_string(),
+        (Some(before), Some(after)) => {
+            format!(
+                "{before} → {after} ({:+})",
+                after as isize - before as isize
+            )
+        }
+        (None, Some(after)) => format!("{after} (+{after})"),
+        (Some(before), None) => format!("{before} (-{before})"),
+        (None, None) => "-".to_string(),
+    }
+}
+
+/// Notes how many rows were left out of a table limited to `TOP_ROWS`.
+fn push_more(output: &mut String, total: usize) {
+    if total > TOP_ROWS {
+        let _ = write!(output, "\n…and {} more\n", total - TOP_ROWS);
+    }
+}
+
+/// Escapes text for use inside a table cell.
+fn escape_cell(text: &str) -> String {
+    text.replace('|', "\\|")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::comments::LineStats;
+    use crate::diff::{FileDiff, FileStatus};
+    use crate::language::SupportedLanguage;
+    use crate::parser::{CodeStats, FunctionStats};
+    use crate::stats::FileStats;
+    use std::path::PathBuf;
+
+    fn metrics(lines: usize, complexity: usize) -> Option<FunctionMetrics> {
+        Some(FunctionMetrics {
+            start_line: 1,
+            end_line: lines,
+            lines,
+            complexity,
+        })
+    }
+
+    fn change(
+        name: &str,
+        status: ChangeStatus,
+        before: Option<FunctionMetrics>,
+        after: Option<FunctionMetrics>,
+    ) -> FunctionChange {
+        FunctionChange {
+            name: name.to_string(),
+            status,
+            before,
+            after,
+        }
+    }
+
+    #[test]
+    fn test_format_markdown_summary() {
+        let mut stats = DirectoryStats::new();
+        for (path, language, code, complexity) in [
+            ("src/a.rs", SupportedLanguage::Rust, 40, 12),
+            ("src/b.rs", SupportedLanguage::Rust, 10, 2),
+            ("main.go", SupportedLanguage::Go, 5, 1),
+        ] {
+            stats.add_file(FileStats {
+                path: PathBuf::from(path),
+                language,
+                stats: CodeStats {
+                    function_count: 1,
+                    functions: vec![FunctionStats {
+                        qualified_name: "Parser::a|b".to_string(),
+                        start_line: 3,
+                        end_line: 7,
+                        complexity,
+                        ..Default::default()
+                    }],
+                    lines: LineStats {
+                        code,
+                        ..Default::default()
+                    },
+                    ..Default::default()
+                },
+            });
+        }
+
+        let output = format_markdown(&stats, &Thresholds::default());
+        assert!(output.starts_with("### Code statistics\n\n| Language |"));
+        assert!(output.contains("| Go | 1 | 5 | 1 | 0 |\n| Rust | 2 | 50 | 2 | 0 |\n"));
+        assert!(output.contains("| **Total** | **3** | **55** | **3** | **0** |"));
+        assert!(output.contains("Complexity: max 12, mean 5.0, 1 function above 10"));
+        assert!(output.contains("| `Parser::a\\|b` | src/a.rs:3 | 5 | 12 |"));
+        assert!(output.ends_with("</details>"));
+
+        let empty = format_markdown(&DirectoryStats::new(), &Thresholds::default());
+        assert!(empty.ends_with("Complexity: max 0, mean 0.0, 0 functions above 10"));
+    }
+
+    #[test]
+    fn test_format_diff_markdown_ranks_deltas() {
+        let report = DiffReport {
+            base: "main".to_string(),
+            files: vec![
+                FileDiff {
+                    path: PathBuf::from("src/lib.rs"),
+                    language: SupportedLanguage::Rust,
+                    status: FileStatus::Modified,
+                    functions: vec![
+                        change(
+                            "tweak",
+                            ChangeStatus::Modified,
+                            metrics(10, 3),
+                            metrics(12, 3),
+                        ),
+                        change(
+                            "parse",
+                            ChangeStatus::Modified,
+                            metrics(20, 4),
+                            metrics(25, 6),
+                        ),
+                        change("legacy", ChangeStatus::Removed, metrics(8, 5), None),
+                    ],
+                },
+                FileDiff {
+                    path: PathBuf::from("src/new.rs"),
+                    language: SupportedLanguage::Rust,
+                    status: FileStatus::Added,
+                    functions: vec![change("fresh", ChangeStatus::Added, None, metrics(2, 1))],
+                },
+            ],
+        };
+
+        let output = format_diff_markdown(&report);
+        assert!(
+            output.starts_with("### Changes since main\n\n2 files changed, 4 functions touched")
+        );
+        let rows: Vec<&str> = output
+            .lines()
+            .filter(|line| line.starts_with("| `"))
+            .collect();
+        assert_eq!(
+            rows,
+            vec![
+                "| `legacy` | src/lib.rs | removed | 8 (-8) | 5 (-5) |",
+                "| `parse` | src/lib.rs | modified | 20 → 25 (+5) | 4 → 6 (+2) |",
+                "| `fresh` | src/new.rs | added | 2 (+2) | 1 (+1) |",
+                "| `tweak` | src/lib.rs | modified | 10 → 12 (+2) | 3 |",
+            ]
+        );
+
+        let empty = DiffReport {
+            base: "HEAD".to_string(),
+            files: Vec::new(),
+        };
+        assert_eq!(
+            format_diff_markdown(&empty),
+            "### Changes since HEAD\n\nNo changes."
+        );
+    }
+}
@@ -0,0 +1,261 @@
+//! Fields and base types of class, struct, and interface declarations.
+//!
+//! Methods are counted by `rollup::type_rollup` from the qualified names of
+//! functions, which also finds Go methods and Rust `impl` blocks declared
+//! outside the type. Fields and bases can only be read from the declaration
+//! itself, so they are counted here, per language, from the syntax tree.
+
+use crate::language::SupportedLanguage;
+use std::collections::HashSet;
+use tree_sitter::Node;
+
+/// The data members and supertypes of a type declaration.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub(crate) struct Members {
+    /// Number of fields, each name of a multi-name declaration counted once
+    pub fields: usize,
+    /// Number of types the declaration extends, implements, embeds, or mixes in
+    pub bases: usize,
+}
+
+/// Counts the fields and base types of a type declaration.
+///
+/// Fields are the declared data members: struct and class fields, C#
+/// properties, Kotlin and Swift properties, the components of records and
+/// Kotlin primary constructor `val`s, and promoted constructor parameters
+/// in PHP and TypeScript. Python, JavaScript, and Ruby have no field
+/// declarations, so the attributes assigned through `self`, `this`, or `@`
+/// in the type's methods count instead, each name once. Bases are
+/// superclasses and implemented interfaces, Go embedded fields, Ruby
+/// `include`s, and PHP `use`d traits. Members of nested types belong to
+/// those types.
+///
+/// # Arguments
+///
+/// * `node` - A node classified as a type declaration
+/// * `source` - The source code the node was parsed from
+/// * `language` - The programming language of the source code
+///
+/// # Returns
+///
+/// The field and base counts; zero for kinds without members, such as enums
+pub(crate) fn type_members(node: &Node, source: &[u8], language: &SupportedLanguage) -> Members {
+    language.rules().type_members(node, source)
+}
+
+/// Returns the named children of `node`.
+pub(crate) fn named<'a>(node: &Node<'a>) -> Vec<Node<'a>> {
+    let mut cursor = node.walk();
+    node.named_children(&mut cursor).collect()
+}
+
+/// Returns the named children of the body in `field`, or nothing if the
+/// declaration has no body.
+pub(crate) fn body_children<'a>(node: &Node<'a>, field: &str) -> Vec<Node<'a>> {
+    node.child_by_field_name(field)
+        .map(|body| named(&body))
+        .unwrap_or_default()
+}
+
+/// Counts the types a JavaScript or TypeScript class extends and implements.
+pub(crate) fn js_heritage_count(heritage: &Node) -> usize {
+    let clauses = named(heritage);
+    // JavaScript's heritage is the superclass expression itself
+    if !clauses
+        .iter()
+        .any(|clause| clause.kind().ends_with("_clause"))
+    {
+        return clauses.len().min(1);
+    }
+    clauses
+        .iter()
+        .flat_map(named)
+        .filter(|base| base.kind() != "type_arguments")
+        .count()
+}
+
+/// Counts the variables of a Java or C# field declaration, `int a, b;`.
+pub(crate) fn declarator_count(declaration: &Node) -> usize {
+    let mut cursor = declaration.walk();
+    declaration
+        .children_by_field_name("declarator", &mut cursor)
+        .count()
+}
+
+/// Collects the names of the attributes assigned on the instance within a
+/// type: `self.name = ...` and class-level assignments in Python, `this.name
+/// = ...` in JavaScript, `@name = ...` in Ruby, and TypeScript constructor
+/// parameters with an accessibility modifier. Nested types are skipped.
+pub(crate) fn assigned_names(
+    node: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> HashSet<String> {
+    let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+    let mut names = HashSet::new();
+
+    // Python class attributes, `count = 0` or `name: str`, directly in the body
+    if *language == SupportedLanguage::Python {
+        let targets = body_children(node, "body")
+            .into_iter()
+            .filter(|statement| statement.kind() == "expression_statement")
+            .flat_map(|statement| named(&statement))
+            .filter(|expression| expression.kind() == "assignment")
+            .filter_map(|assignment| assignment.child_by_field_name("left"))
+            .filter(|left| left.kind() == "identifier");
+        names.extend(targets.filter_map(text));
+    }
+
+    let mut stack = named(node);
+    while let Some(current) = stack.pop() {
+        let kind = current.kind();
+        if matches!(
+            kind,
+            "class_definition" | "class_declaration" | "class" | "module"
+        ) {
+            continue;
+        }
+        let name = match kind {
+            "assignment" | "assignment_expression" | "operator_assignment" => current
+                .child_by_field_name("left")
+                .and_then(|left| instance_attribute(&left, source, language)),
+            // `constructor(private readonly name: string)`
+            "required_parameter" | "optional_parameter"
+                if named(&current)
+                    .iter()
+                    .any(|child| child.kind() == "accessibility_modifier") =>
+            {
+                current.child_by_field_name("pattern").and_then(text)
+            }
+            _ => None,
+        };
+        names.extend(name);
+        stack.extend(named(&current));
+    }
+    names
+}
+
+/// Returns the attribute name if `target` is `self.name`, `this.name`, or
+/// `@name`.
+fn instance_attribute(
+    target: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> Option<String> {
+    let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+    match (language, target.kind()) {
+        (SupportedLanguage::Ruby, "instance_variable") => {
+            text(*target).map(|name| name.trim_start_matches('@').to_string())
+        }
+        (SupportedLanguage::Python, "attribute") => {
+            let object = target.child_by_field_name("object").and_then(text)?;
+            (object == "self")
+                .then(|| target.child_by_field_name("attribute").and_then(text))
+                .flatten()
+        }
+        (SupportedLanguage::JavaScript | SupportedLanguage::TypeScript, "member_expression") => {
+            let object = target.child_by_field_name("object")?;
+            (object.kind() == "this")
+                .then(|| target.child_by_field_name("property").and_then(text))
+                .flatten()
+        }
+        _ => None,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::{Tally, classify, create_parser};
+
+    /// Returns the members of each type declared in `source`, in order.
+    fn members(source: &str, language: SupportedLanguage) -> Vec<(usize, usize)> {
+        let mut parser = create_parser(&language).unwrap();
+        let tree = parser.parse(source, None).unwrap();
+        let mut found = Vec::new();
+        let mut stack = vec![tree.root_node()];
+        while let Some(node) = stack.pop() {
+            if classify(&node, source.as_bytes(), &language).is_some_and(|d| d.tally == Tally::Type)
+            {
+                let counts = type_members(&node, source.as_bytes(), &language);
+                found.push((node.start_byte(), (counts.fields, counts.bases)));
+            }
+            stack.extend(named(&node));
+        }
+        found.sort_unstable();
+        found.into_iter().map(|(_, counts)| counts).collect()
+    }
+
+    #[test]
+    fn test_go_struct_members() {
+        let source = r#"
+package main
+
+type Person struct {
+    Name string
+    Age  int
+}
+
+type Employee struct {
+    Person
+    *Manager
+    Title, Team string
+}
+"#;
+        assert_eq!(members(source, SupportedLanguage::Go), vec![(2, 0), (2, 2)]);
+    }
+
+    #[test]
+    fn test_declared_fields_and_bases() {
+        let java = r#"
+class Account extends Entity implements Auditable, Serializable {
+    private int id, version;
+    private String owner;
+    void close() {}
+}
+record Point(int x, int y) {}
+"#;
+        assert_eq!(members(java, SupportedLanguage::Java), vec![(3, 3), (2, 0)]);
+
+        let cpp = r#"
+class Widget : public Base, private Mixin {
+    int width, height;
+    void draw();
+};
+"#;
+        assert_eq!(members(cpp, SupportedLanguage::Cpp), vec![(2, 2)]);
+
+        let rust = "struct Point { x: i32, y: i32 }\nstruct Meters(f64);\n";
+        assert_eq!(members(rust, SupportedLanguage::Rust), vec![(2, 0), (1, 0)]);
+    }
+
+    #[test]
+    fn test_assigned_attributes_count_once() {
+        let python = r#"
+class Cart(Base, metaclass=Meta):
+    limit = 10
+
+    def __init__(self):
+        self.items = []
+        self.total = 0
+
+    def add(self, item):
+        self.items.append(item)
+        self.total = self.total + item.price
+"#;
+        assert_eq!(members(python, SupportedLanguage::Python), vec![(3, 1)]);
+
+        let ruby = r#"
+class Cart < Base
+  include Enumerable
+  attr_reader :items
+
+  def initialize
+    @items = []
+    @total = 0
+  end
+end
+"#;
+        assert_eq!(members(ruby, SupportedLanguage::Ruby), vec![(2, 2)]);
+    }
+}
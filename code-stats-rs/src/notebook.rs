@@ -0,0 +1,453 @@
+//! Jupyter notebooks: their cells and the code in them.
+//!
+//! A notebook (`.ipynb`) is a JSON document whose `cells` hold code,
+//! Markdown, and raw text. The code cells are extracted like the fenced code
+//! blocks of Markdown documents and analyzed in the language of the
+//! notebook's kernel, named by `metadata.kernelspec.language` or
+//! `metadata.language_info.name` and Python without either, so the functions
+//! of a notebook are reported with those of the Python files. Cell outputs
+//! are not counted.
+//!
+//! The notebook's own line counts cover its cells rather than the JSON
+//! around them: Markdown cells are prose, raw cells markup, and code cells
+//! that are not extracted, as their kernel has no grammar, code. Lines are
+//! numbered as in the notebook file, where Jupyter writes each line of a
+//! cell's source as a string of its own.
+//!
+//! IPython syntax is not Python: lines holding a `%` line magic or a `!`
+//! shell command are blanked before a Python cell is analyzed, and a cell
+//! magic on the first line analyzes the cell in the language it names
+//! (`%%bash`, `%%sql`, `%%javascript`), or not at all when it names none.
+
+use crate::comments::LineStats;
+use crate::detect::language_from_alias;
+use crate::fences::CodeBlock;
+use crate::language::SupportedLanguage;
+use serde::{Deserialize, Serialize};
+use tree_sitter::Node;
+
+/// Cell magics that time, capture, or write out code of the kernel's
+/// language rather than naming another one.
+const KERNEL_CELL_MAGICS: [&str; 6] = ["time", "timeit", "capture", "prun", "writefile", "debug"];
+
+/// Cells of a notebook and the lines in them.
+#[derive(Default, Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct NotebookStats {
+    /// Number of code cells, including empty ones
+    pub code_cells: usize,
+    /// Number of Markdown cells
+    pub markdown_cells: usize,
+    /// Number of raw cells, passed through unrendered by Jupyter
+    pub raw_cells: usize,
+    /// Non-blank lines of the code cells
+    pub code_lines: usize,
+    /// Non-blank lines of the Markdown cells
+    pub markdown_lines: usize,
+}
+
+impl NotebookStats {
+    /// Adds the counts of `other`.
+    pub(crate) fn merge(&mut self, other: &NotebookStats) {
+        self.code_cells += other.code_cells;
+        self.markdown_cells += other.markdown_cells;
+        self.raw_cells += other.raw_cells;
+        self.code_lines += other.code_lines;
+        self.markdown_lines += other.markdown_lines;
+    }
+
+    /// Fraction of the non-blank lines of code and Markdown cells that are
+    /// Markdown, or 0.0 for a notebook without either.
+    pub fn markdown_share(&self) -> f64 {
+        let total = self.code_lines + self.markdown_lines;
+        if total == 0 {
+            0.0
+        } else {
+            self.markdown_lines as f64 / total as f64
+        }
+    }
+}
+
+/// Kinds of notebook cells, from their `cell_type`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum CellKind {
+    Code,
+    Markdown,
+    Raw,
+}
+
+/// A cell of a notebook with its source decoded from JSON.
+struct Cell {
+    kind: CellKind,
+    source: String,
+    /// 0-based line of the notebook file the source starts on
+    first_line: usize,
+}
+
+/// The code of a cell to analyze in its language, see `code_cells`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct CellCode {
+    /// Language of the kernel, or named by the cell magic
+    pub language: SupportedLanguage,
+    /// The cell's source, without its cell magic and with its IPython lines
+    /// blanked
+    pub code: String,
+    /// 0-based line of the notebook file the code starts on
+    pub first_line: usize,
+}
+
+impl CellCode {
+    /// Borrows the cell's code as a block for `CodeAnalyzer::analyze_blocks`.
+    pub(crate) fn as_block(&self) -> CodeBlock<'_> {
+        CodeBlock {
+            language: self.language,
+            code: &self.code,
+            first_line: self.first_line,
+        }
+    }
+}
+
+/// Counts the cells of a notebook and the lines in them.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the JSON tree parsed from the notebook
+/// * `source` - The notebook file
+/// * `language` - Language the file was detected as
+///
+/// # Returns
+///
+/// The notebook's statistics, or `None` for files other than notebooks.
+pub(crate) fn notebook_stats(
+    root: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> Option<NotebookStats> {
+    if *language != SupportedLanguage::Jupyter {
+        return None;
+    }
+    let mut stats = NotebookStats::default();
+    for cell in cells(root, source) {
+        let lines = cell
+            .source
+            .lines()
+            .filter(|line| !line.trim().is_empty())
+            .count();
+        match cell.kind {
+            CellKind::Code => {
+                stats.code_cells += 1;
+                stats.code_lines += lines;
+            }
+            CellKind::Markdown => {
+                stats.markdown_cells += 1;
+                stats.markdown_lines += lines;
+            }
+            CellKind::Raw => stats.raw_cells += 1,
+        }
+    }
+    Some(stats)
+}
+
+/// Classifies the lines of a notebook's cells: Markdown cells are prose, raw
+/// cells markup, and code cells that are not extracted code. The extracted
+/// code cells, and the JSON around the cells, are not counted here at all.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the JSON tree parsed from the notebook
+/// * `source` - The notebook file
+pub(crate) fn count_notebook_lines(root: &Node, source: &[u8]) -> LineStats {
+    let kernel = kernel_language(root, source);
+    let mut stats = LineStats::default();
+    for cell in cells(root, source) {
+        if cell.kind == CellKind::Code && cell_code(&cell, kernel).is_some() {
+            continue;
+        }
+        for line in cell.source.lines() {
+            if line.trim().is_empty() {
+                stats.blank += 1;
+                continue;
+            }
+            match cell.kind {
+                CellKind::Code => stats.code += 1,
+                CellKind::Markdown => stats.prose += 1,
+                CellKind::Raw => stats.markup += 1,
+            }
+        }
+    }
+    stats
+}
+
+/// Lists the code cells of a notebook that are in a supported language, in
+/// notebook order.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the JSON tree parsed from the notebook
+/// * `source` - The notebook file
+pub(crate) fn code_cells(root: &Node, source: &[u8]) -> Vec<CellCode> {
+    let kernel = kernel_language(root, source);
+    cells(root, source)
+        .iter()
+        .filter(|cell| cell.kind == CellKind::Code)
+        .filter_map(|cell| cell_code(cell, kernel))
+        .collect()
+}
+
+/// Returns the code of a code cell to analyze, or `None` for an empty cell
+/// or one in a language without a grammar.
+fn cell_code(cell: &Cell, kernel: Option<SupportedLanguage>) -> Option<CellCode> {
+    if cell.source.trim().is_empty() {
+        return None;
+    }
+    let mut language = kernel;
+    let mut code = cell.source.as_str();
+    let mut first_line = cell.first_line;
+    if let Some(magic) = code.strip_prefix("%%") {
+        let (line, rest) = magic.split_once('\n').unwrap_or((magic, ""));
+        let name = line.split_whitespace().next().unwrap_or_default();
+        if !KERNEL_CELL_MAGICS.contains(&name) {
+            language = language_from_alias(name);
+        }
+        code = rest;
+        first_line += 1;
+    }
+    let language = language?;
+
+    let code = if language == SupportedLanguage::Python {
+        code.split_inclusive('\n')
+            .map(|line| {
+                let statement = line.trim_start();
+                if statement.starts_with('%') || statement.starts_with('!') {
+                    &line[line.trim_end_matches('\n').len()..]
+                } else {
+                    line
+                }
+            })
+            .collect()
+    } else {
+        code.to_string()
+    };
+    Some(CellCode {
+        language,
+        code,
+        first_line,
+    })
+}
+
+/// Returns the language of a notebook's kernel, Python when its metadata
+/// names none, or `None` for a kernel language without a grammar, such as R
+/// or Julia.
+fn kernel_language(root: &Node, source: &[u8]) -> Option<SupportedLanguage> {
+    let metadata = notebook(root).and_then(|notebook| member(&notebook, source, "metadata"));
+    let name = metadata.and_then(|metadata| {
+        member(&metadata, source, "kernelspec")
+            .and_then(|kernelspec| member(&kernelspec, source, "language"))
+            .or_else(|| {
+                member(&metadata, source, "language_info")
+                    .and_then(|info| member(&info, source, "name"))
+            })
+            .and_then(|name| string(&name, source))
+    });
+    match name {
+        Some(name) => language_from_alias(&name),
+        None => Some(SupportedLanguage::Python),
+    }
+}
+
+/// Decodes the cells of a notebook, skipping cells of unknown types.
+fn cells(root: &Node, source: &[u8]) -> Vec<Cell> {
+    let Some(cells) = notebook(root).and_then(|notebook| member(&notebook, source, "cells")) else {
+        return Vec::new();
+    };
+    let mut cursor = cells.walk();
+    cells
+        .named_children(&mut cursor)
+        .filter(|cell| cell.kind() == "object")
+        .filter_map(|cell| {
+            let kind = match string(&member(&cell, source, "cell_type")?, source)?.as_str() {
+                "code" => CellKind::Code,
+                "markdown" => CellKind::Markdown,
+                "raw" => CellKind::Raw,
+                _ => return None,
+            };
+            let value = member(&cell, source, "source")?;
+            // The source is a list of lines, or a single string
+            let (text, first_line) = match value.kind() {
+                "array" => {
+                    let mut cursor = value.walk();
+                    let lines: Vec<Node> = value
+                        .named_children(&mut cursor)
+                        .filter(|line| line.kind() == "string")
+                        .collect();
+                    let first_line = lines.first().unwrap_or(&value).start_position().row;
+                    let text = lines
+                        .iter()
+                        .filter_map(|line| string(line, source))
+                        .collect();
+                    (text, first_line)
+                }
+                _ => (string(&value, source)?, value.start_position().row),
+            };
+            Some(Cell {
+                kind,
+                source: text,
+                first_line,
+            })
+        })
+        .collect()
+}
+
+/// Returns the top-level object of a notebook.
+fn notebook<'tree>(root: &Node<'tree>) -> Option<Node<'tree>> {
+    let mut cursor = root.walk();
+    root.named_children(&mut cursor)
+        .find(|child| child.kind() == "object")
+}
+
+/// Returns the value of the member named `key` of a JSON object.
+fn member<'tree>(object: &Node<'tree>, source: &[u8], key: &str) -> Option<Node<'tree>> {
+    let mut cursor = object.walk();
+    object
+        .named_children(&mut cursor)
+        .filter(|child| child.kind() == "pair")
+        .find(|pair| {
+            pair.child_by_field_name("key")
+                .and_then(|name| string(&name, source))
+                .is_some_and(|name| name == key)
+        })
+        .and_then(|pair| pair.child_by_field_name("value"))
+}
+
+/// Decodes a JSON string node, escapes included.
+fn string(node: &Node, source: &[u8]) -> Option<String> {
+    if node.kind() != "string" {
+        return None;
+    }
+    serde_json::from_str(node.utf8_text(source).ok()?).ok()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::create_parser;
+
+    const NOTEBOOK: &str = r##"{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": [
+    "# Sales\n",
+    "\n",
+    "Monthly totals by region."
+   ]
+  },
+  {
+   "cell_type": "code",
+   "execution_count": 1,
+   "metadata": {},
+   "outputs": [],
+   "source": [
+    "%matplotlib inline\n",
+    "import pandas as pd\n",
+    "\n",
+    "def total(frame):\n",
+    "    return frame[\"amount\"].sum()"
+   ]
+  },
+  {
+   "cell_type": "code",
+   "execution_count": 2,
+   "metadata": {},
+   "outputs": [],
+   "source": [
+    "%%bash\n",
+    "ls data"
+   ]
+  },
+  {
+   "cell_type": "code",
+   "execution_count": null,
+   "metadata": {},
+   "outputs": [],
+   "source": []
+  }
+ ],
+ "metadata": {
+  "kernelspec": {
+   "display_name": "Python 3",
+   "language": "python",
+   "name": "python3"
+  }
+ },
+ "nbformat": 4,
+ "nbformat_minor": 5
+}
+"##;
+
+    fn parse(source: &str) -> tree_sitter::Tree {
+        create_parser(&SupportedLanguage::Jupyter)
+            .unwrap()
+            .parse(source, None)
+            .unwrap()
+    }
+
+    #[test]
+    fn test_notebook_stats() {
+        let tree = parse(NOTEBOOK);
+        let stats = notebook_stats(
+            &tree.root_node(),
+            NOTEBOOK.as_bytes(),
+            &SupportedLanguage::Jupyter,
+        );
+        assert_eq!(
+            stats,
+            Some(NotebookStats {
+                code_cells: 3,
+                markdown_cells: 1,
+                raw_cells: 0,
+                code_lines: 6,
+                markdown_lines: 2,
+            })
+        );
+        assert_eq!(stats.unwrap().markdown_share(), 0.25);
+    }
+
+    #[test]
+    fn test_code_cells_in_kernel_and_magic_languages() {
+        let tree = parse(NOTEBOOK);
+        let cells = code_cells(&tree.root_node(), NOTEBOOK.as_bytes());
+
+        // The empty cell is left out
+        assert_eq!(cells.len(), 2);
+        assert_eq!(cells[0].language, SupportedLanguage::Python);
+        assert_eq!(cells[0].first_line, 17);
+        assert_eq!(
+            cells[0].code,
+            "\nimport pandas as pd\n\ndef total(frame):\n    return frame[\"amount\"].sum()"
+        );
+        assert_eq!(cells[1].language, SupportedLanguage::Bash);
+        assert_eq!(cells[1].first_line, 31);
+        assert_eq!(cells[1].code, "ls data");
+    }
+
+    #[test]
+    fn test_count_notebook_lines() {
+        let tree = parse(NOTEBOOK);
+        let lines = count_notebook_lines(&tree.root_node(), NOTEBOOK.as_bytes());
+        // Only the Markdown cell; the code cells are counted as Python and Bash
+        assert_eq!(lines.prose, 2);
+        assert_eq!(lines.blank, 1);
+        assert_eq!(lines.code, 0);
+    }
+
+    #[test]
+    fn test_kernel_without_grammar() {
+        let source = r#"{"cells": [{"cell_type": "code", "metadata": {}, "source": "x <- c(1, 2)\nmean(x)"}], "metadata": {"kernelspec": {"language": "R", "name": "ir"}}}"#;
+        let tree = parse(source);
+        assert!(code_cells(&tree.root_node(), source.as_bytes()).is_empty());
+        // The R code stays in the notebook's own counts
+        let lines = count_notebook_lines(&tree.root_node(), source.as_bytes());
+        assert_eq!(lines.code, 2);
+    }
+}
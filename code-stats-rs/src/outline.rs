@@ -0,0 +1,151 @@
+//! Hierarchical document outlines for the `outline` endpoint of the `serve`
+//! subcommand.
+//!
+//! The outline has the shape of an LSP `documentSymbol` answer: each named
+//! declaration with its kind and range, and the declarations it encloses as
+//! children. It is built from the same declarations as `--emit-tags`, so
+//! editors without a language server for a file can still show its outline.
+
+use crate::parser::Symbol;
+use serde::Serialize;
+
+/// A position in a source file.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize)]
+pub(crate) struct Position {
+    /// 1-based line
+    pub line: usize,
+    /// 1-based display column, with tabs expanded
+    pub column: usize,
+}
+
+/// A declaration of the outline.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct OutlineSymbol {
+    pub name: String,
+    /// Breakdown label of the declaration (e.g. `function`, `struct`)
+    pub kind: &'static str,
+    pub start: Position,
+    /// Position just past the end of the declaration
+    pub end: Position,
+    /// Declarations within this one, in source order
+    pub children: Vec<OutlineSymbol>,
+}
+
+impl From<Symbol> for OutlineSymbol {
+    fn from(symbol: Symbol) -> Self {
+        Self {
+            name: symbol.name,
+            kind: symbol.kind,
+            start: Position {
+                line: symbol.line,
+                column: symbol.column,
+            },
+            end: Position {
+                line: symbol.end_line,
+                column: symbol.end_column,
+            },
+            children: Vec::new(),
+        }
+    }
+}
+
+impl OutlineSymbol {
+    /// Returns true if `other` lies within this declaration.
+    fn contains(&self, other: &OutlineSymbol) -> bool {
+        self.start <= other.start && other.end <= self.end
+    }
+}
+
+/// Nests declarations by the ranges that enclose them.
+///
+/// # Arguments
+///
+/// * `symbols` - Declarations in source order, as listed by `symbols`
+///
+/// # Returns
+///
+/// The top-level declarations, each with its nested declarations as children
+pub(crate) fn outline(symbols: Vec<Symbol>) -> Vec<OutlineSymbol> {
+    let mut roots = Vec::new();
+    // Declarations still open, outermost first
+    let mut open: Vec<OutlineSymbol> = Vec::new();
+    for symbol in symbols.into_iter().map(OutlineSymbol::from) {
+        while open.last().is_some_and(|parent| !parent.contains(&symbol)) {
+            close(&mut open, &mut roots);
+        }
+        open.push(symbol);
+    }
+    while !open.is_empty() {
+        close(&mut open, &mut roots);
+    }
+    roots
+}
+
+/// Closes the innermost open declaration, adding it to its parent or to the
+/// top level.
+fn close(open: &mut Vec<OutlineSymbol>, roots: &mut Vec<OutlineSymbol>) {
+    if let Some(symbol) = open.pop() {
+        match open.last_mut() {
+            Some(parent) => parent.children.push(symbol),
+            None => roots.push(symbol),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn symbol(name: &str, kind: &'static str, line: usize, end_line: usize) -> Symbol {
+        Symbol {
+            name: name.to_string(),
+            kind,
+            line,
+            column: 1,
+            end_line,
+            end_column: 2,
+        }
+    }
+
+    fn names(symbols: &[OutlineSymbol]) -> Vec<&str> {
+        symbols.iter().map(|symbol| symbol.name.as_str()).collect()
+    }
+
+    #[test]
+    fn test_outline_nests_by_range() {
+        let outline = outline(vec![
+            symbol("Shape", "class", 1, 10),
+            symbol("area", "method", 2, 4),
+            symbol("Corner", "class", 5, 9),
+            symbol("x", "method", 6, 8),
+            symbol("main", "function", 12, 14),
+        ]);
+
+        assert_eq!(names(&outline), ["Shape", "main"]);
+        assert_eq!(names(&outline[0].children), ["area", "Corner"]);
+        assert_eq!(names(&outline[0].children[1].children), ["x"]);
+        assert!(outline[1].children.is_empty());
+        assert_eq!(
+            outline[0].end,
+            Position {
+                line: 10,
+                column: 2
+            }
+        );
+    }
+
+    #[test]
+    fn test_outline_serializes_ranges() {
+        let json = serde_json::to_value(outline(vec![symbol("main", "function", 1, 3)])).unwrap();
+        assert_eq!(
+            json,
+            serde_json::json!([{
+                "name": "main",
+                "kind": "function",
+                "start": { "line": 1, "column": 1 },
+                "end": { "line": 3, "column": 2 },
+                "children": [],
+            }])
+        );
+    }
+}
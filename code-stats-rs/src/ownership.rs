@@ -0,0 +1,447 @@
+//! Attribution of code and complexity to authors or teams for `--by-author`.
+//!
+//! By default every committed line of a code file is attributed to the author
+//! git blame reports for it, and every function to the author of most of its
+//! lines; ties go to the author whose name sorts first. A file counts for the
+//! author of most of its lines. Lines that are not committed yet belong to
+//! nobody.
+//!
+//! With `--codeowners`, files are grouped by the owners a `CODEOWNERS` file
+//! assigns to them instead, the way GitHub and GitLab read it: the last
+//! matching rule wins, and a file with several owners counts fully for each
+//! of them. Files no rule covers are grouped as `(unowned)`.
+
+use crate::diff::repository_root;
+use crate::error::{CodeStatsError, Result};
+use crate::stats::{DirectoryStats, FileStats};
+use crate::todos::blame;
+use globset::{GlobBuilder, GlobSet, GlobSetBuilder};
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap};
+use std::path::{Path, PathBuf};
+
+/// Group of the files no `CODEOWNERS` rule assigns an owner to.
+pub(crate) const UNOWNED: &str = "(unowned)";
+
+/// Where `CODEOWNERS` is looked for below the repository's top level, in the
+/// order GitHub and GitLab look.
+const CODEOWNERS_PATHS: [&str; 4] = [
+    ".github/CODEOWNERS",
+    ".gitlab/CODEOWNERS",
+    "CODEOWNERS",
+    "docs/CODEOWNERS",
+];
+
+/// Code and complexity attributed to one author or owner.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize)]
+pub(crate) struct OwnerStats {
+    /// Author name from git blame, or owner from `CODEOWNERS`
+    pub owner: String,
+    /// Files the owner holds
+    pub files: usize,
+    /// Lines attributed to the owner
+    pub lines: usize,
+    /// Functions attributed to the owner
+    pub functions: usize,
+    /// Sum of the cyclomatic complexity of those functions
+    pub complexity: usize,
+    /// Highest cyclomatic complexity of those functions
+    pub max_complexity: usize,
+}
+
+impl OwnerStats {
+    /// Attributes one function of the given complexity.
+    fn add_function(&mut self, complexity: usize) {
+        self.functions += 1;
+        self.complexity += complexity;
+        self.max_complexity = self.max_complexity.max(complexity);
+    }
+}
+
+/// Code of the analyzed files broken down by owner.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize)]
+pub(crate) struct Ownership {
+    /// `author` for git blame, `codeowners` for `CODEOWNERS`
+    pub grouping: &'static str,
+    /// Owners by total complexity, highest first; ties are ordered by lines,
+    /// then by name
+    pub owners: Vec<OwnerStats>,
+    /// Code files that could not be attributed, e.g. untracked ones
+    pub skipped: Vec<PathBuf>,
+}
+
+/// Attributes the lines and functions of the code files of `stats` to their
+/// authors with git blame. Files git can't blame are listed in `skipped`.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics of the analyzed files
+pub(crate) fn by_author(stats: &DirectoryStats) -> Ownership {
+    let mut owners: BTreeMap<String, OwnerStats> = BTreeMap::new();
+    let mut skipped = Vec::new();
+    for file in stats.code_file_stats() {
+        let Ok(lines) = blame(&file.path) else {
+            skipped.push(file.path.clone());
+            continue;
+        };
+        let mut file_lines: HashMap<&str, usize> = HashMap::new();
+        for line in lines.values() {
+            *file_lines.entry(&line.author).or_insert(0) += 1;
+        }
+        for (author, count) in &file_lines {
+            owner(&mut owners, author).lines += count;
+        }
+        if let Some(author) = majority(&file_lines) {
+            owner(&mut owners, author).files += 1;
+        }
+
+        for function in &file.stats.functions {
+            let mut function_lines: HashMap<&str, usize> = HashMap::new();
+            for number in function.start_line..=function.end_line {
+                if let Some(line) = lines.get(&number) {
+                    *function_lines.entry(&line.author).or_insert(0) += 1;
+                }
+            }
+            if let Some(author) = majority(&function_lines) {
+                owner(&mut owners, author).add_function(function.complexity);
+            }
+        }
+    }
+    Ownership {
+        grouping: "author",
+        owners: ranked(owners),
+        skipped,
+    }
+}
+
+/// Groups the code files of `stats` by the owners the repository's
+/// `CODEOWNERS` file assigns to them.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics of the analyzed files
+/// * `root` - The analyzed file or directory
+///
+/// # Returns
+///
+/// * `Ok(Ownership)` - The files by owner
+/// * `Err(GitError)` - `root` is not in a git repository
+/// * `Err(ConfigError)` - The repository has no `CODEOWNERS` file, or one
+///   with an invalid pattern
+pub(crate) fn by_codeowners(stats: &DirectoryStats, root: &Path) -> Result<Ownership> {
+    let (root_abs, toplevel) = repository_root(root)?;
+    let codeowners = CodeOwners::find(&toplevel)?;
+
+    let mut owners: BTreeMap<String, OwnerStats> = BTreeMap::new();
+    for file in stats.code_file_stats() {
+        let path = repository_path(file, root, &root_abs, &toplevel);
+        let file_owners = match codeowners.owners(&path) {
+            [] => &[UNOWNED.to_string()][..],
+            file_owners => file_owners,
+        };
+        for name in file_owners {
+            let owner = owner(&mut owners, name);
+            owner.files += 1;
+            owner.lines += file.stats.lines.total();
+            for function in &file.stats.functions {
+                owner.add_function(function.complexity);
+            }
+        }
+    }
+    Ok(Ownership {
+        grouping: "codeowners",
+        owners: ranked(owners),
+        skipped: Vec::new(),
+    })
+}
+
+/// Returns the entry of an owner, creating it if needed.
+fn owner<'a>(owners: &'a mut BTreeMap<String, OwnerStats>, name: &str) -> &'a mut OwnerStats {
+    owners
+        .entry(name.to_string())
+        .or_insert_with(|| OwnerStats {
+            owner: name.to_string(),
+            ..Default::default()
+        })
+}
+
+/// Returns the name with the most lines, the first by name on a tie.
+fn majority<'a>(lines: &HashMap<&'a str, usize>) -> Option<&'a str> {
+    lines
+        .iter()
+        .max_by(|a, b| a.1.cmp(b.1).then_with(|| b.0.cmp(a.0)))
+        .map(|(name, _)| *name)
+}
+
+/// Orders owners by complexity, lines, and name.
+fn ranked(owners: BTreeMap<String, OwnerStats>) -> Vec<OwnerStats> {
+    let mut owners: Vec<OwnerStats> = owners.into_values().collect();
+    owners.sort_by(|a, b| {
+        b.complexity
+            .cmp(&a.complexity)
+            .then_with(|| b.lines.cmp(&a.lines))
+            .then_with(|| a.owner.cmp(&b.owner))
+    });
+    owners
+}
+
+/// Returns the path of a file relative to the repository's top level, with
+/// `/` separators, as `CODEOWNERS` patterns match it.
+fn repository_path(file: &FileStats, root: &Path, root_abs: &Path, toplevel: &Path) -> String {
+    let absolute = match file.path.strip_prefix(root) {
+        Ok(relative) if !relative.as_os_str().is_empty() => root_abs.join(relative),
+        _ => root_abs.to_path_buf(),
+    };
+    let relative = absolute.strip_prefix(toplevel).unwrap_or(&absolute);
+    relative
+        .components()
+        .map(|component| component.as_os_str().to_string_lossy())
+        .collect::<Vec<_>>()
+        .join("/")
+}
+
+/// The rules of a `CODEOWNERS` file.
+#[derive(Debug)]
+pub(crate) struct CodeOwners {
+    /// Matcher and owners of each rule, in file order
+    rules: Vec<(GlobSet, Vec<String>)>,
+}
+
+impl CodeOwners {
+    /// Reads the first `CODEOWNERS` file of the repository, see
+    /// `CODEOWNERS_PATHS`.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(CodeOwners)` - The parsed rules
+    /// * `Err(ConfigError)` - There is no `CODEOWNERS` file or it is invalid
+    pub(crate) fn find(toplevel: &Path) -> Result<Self> {
+        for candidate in CODEOWNERS_PATHS {
+            let path = toplevel.join(candidate);
+            if let Ok(text) = std::fs::read_to_string(&path) {
+                return Self::parse(&text).map_err(|e| match e {
+                    CodeStatsError::ConfigError(message) => {
+                        CodeStatsError::ConfigError(format!("{}: {message}", path.display()))
+                    }
+                    e => e,
+                });
+            }
+        }
+        Err(CodeStatsError::ConfigError(format!(
+            "no CODEOWNERS file in {}",
+            toplevel.display()
+        )))
+    }
+
+    /// Parses the rules of a `CODEOWNERS` file. Comments, blank lines, and
+    /// GitLab section headers are skipped.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(CodeOwners)` - The parsed rules
+    /// * `Err(ConfigError)` - A pattern is not a valid glob
+    pub(crate) fn parse(text: &str) -> Result<Self> {
+        let mut rules = Vec::new();
+        for (index, line) in text.lines().enumerate() {
+            let line = line.split(" #").next().unwrap_or_default().trim();
+            if line.is_empty() || line.starts_with('#') || line.starts_with('[') {
+                continue;
+            }
+            let mut words = line.split_whitespace();
+            let Some(pattern) = words.next() else {
+                continue;
+            };
+            let owners = words.map(str::to_string).collect();
+            let matcher = pattern_matcher(pattern).map_err(|e| {
+                CodeStatsError::ConfigError(format!(
+                    "line {}: invalid pattern '{pattern}': {e}",
+                    index + 1
+                ))
+            })?;
+            rules.push((matcher, owners));
+        }
+        Ok(Self { rules })
+    }
+
+    /// Returns the owners of a path relative to the repository's top level.
+    /// The last matching rule decides; a rule without owners leaves the path
+    /// unowned.
+    pub(crate) fn owners(&self, path: &str) -> &[String] {
+        self.rules
+            .iter()
+            .rev()
+            .find(|(matcher, _)| matcher.is_match(path))
+            .map_or(&[], |(_, owners)| owners.as_slice())
+    }
+}
+
+/// Compiles a `CODEOWNERS` pattern, which follows gitignore rules: a pattern
+/// without a `/` except at the end matches at any depth, and a pattern
+/// matching a directory matches everything below it.
+fn pattern_matcher(pattern: &str) -> std::result::Result<GlobSet, globset::Error> {
+    let directory = pattern.ends_with('/');
+    let trimmed = pattern.trim_end_matches('/');
+    let anchored = if let Some(anchored) = trimmed.strip_prefix('/') {
+        anchored.to_string()
+    } else if trimmed.contains('/') {
+        trimmed.to_string()
+    } else {
+        format!("**/{trimmed}")
+    };
+
+    let mut builder = GlobSetBuilder::new();
+    let glob = |pattern: &str| GlobBuilder::new(pattern).literal_separator(true).build();
+    if !directory {
+        builder.add(glob(&anchored)?);
+    }
+    builder.add(glob(&format!("{anchored}/**"))?);
+    builder.build()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::stats::test_support::file;
+
+    #[test]
+    fn test_codeowners_last_match_wins() {
+        let codeowners = CodeOwners::parse(
+            "# Owners\n\
+             *       @org/everyone\n\
+             *.rs    @org/rust  # all Rust\n\
+             /src/parser/  @org/parsing @alice\n\
+             docs    @org/docs\n\
+             [Release]\n\
+             /src/generated.rs\n",
+        )
+        .unwrap();
+        assert_eq!(codeowners.owners("README.md"), ["@org/everyone"]);
+        assert_eq!(codeowners.owners("tools/build.rs"), ["@org/rust"]);
+        assert_eq!(
+            codeowners.owners("src/parser/rust.rs"),
+            ["@org/parsing", "@alice"]
+        );
+        assert_eq!(codeowners.owners("guide/docs/intro.md"), ["@org/docs"]);
+        assert!(codeowners.owners("src/generated.rs").is_empty());
+    }
+
+    #[test]
+    fn test_codeowners_directory_patterns_are_not_files() {
+        let codeowners = CodeOwners::parse("build/ @org/ci\n").unwrap();
+        assert!(codeowners.owners("build").is_empty());
+        assert_eq!(codeowners.owners("build/release.sh"), ["@org/ci"]);
+        assert_eq!(codeowners.owners("tools/build/run.sh"), ["@org/ci"]);
+    }
+
+    #[test]
+    fn test_by_codeowners() {
+        let dir = tempfile::tempdir().unwrap();
+        let root = dir.path();
+        let git = |args: &[&str]| crate::diff::git(root, args).unwrap();
+        git(&["init", "--quiet"]);
+        std::fs::write(
+            root.join("CODEOWNERS"),
+            "/src/ @org/core\n/src/cli.rs @org/ux @org/core\n",
+        )
+        .unwrap();
+
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file(
+            &root.join("src/parser.rs").display().to_string(),
+            100,
+            &[12, 3],
+        ));
+        stats.add_file(file(
+            &root.join("src/cli.rs").display().to_string(),
+            40,
+            &[5],
+        ));
+        stats.add_file(file(&root.join("build.rs").display().to_string(), 10, &[1]));
+
+        let ownership = by_codeowners(&stats, root).unwrap();
+        let owners: Vec<(&str, usize, usize, usize)> = ownership
+            .owners
+            .iter()
+            .map(|o| (o.owner.as_str(), o.files, o.functions, o.complexity))
+            .collect();
+        assert_eq!(
+            owners,
+            [
+                ("@org/core", 2, 3, 20),
+                ("@org/ux", 1, 1, 5),
+                (UNOWNED, 1, 1, 1)
+            ]
+        );
+        assert_eq!(ownership.owners[0].max_complexity, 12);
+    }
+
+    #[test]
+    fn test_by_codeowners_needs_codeowners_file() {
+        let dir = tempfile::tempdir().unwrap();
+        crate::diff::git(dir.path(), &["init", "--quiet"]).unwrap();
+        let err = by_codeowners(&DirectoryStats::new(), dir.path()).unwrap_err();
+        assert!(err.to_string().contains("no CODEOWNERS file"), "{err}");
+    }
+
+    #[test]
+    fn test_by_author_attributes_lines_and_functions() {
+        let dir = tempfile::tempdir().unwrap();
+        let root = dir.path();
+        let git = |args: &[&str]| crate::diff::git(root, args).unwrap();
+        let commit = |author: &str, content: &str| {
+            std::fs::write(root.join("lib.rs"), content).unwrap();
+            git(&["add", "-A"]);
+            let name = format!("user.name={author}");
+            git(&[
+                "-c",
+                &name,
+                "-c",
+                "user.email=dev@example.com",
+                "commit",
+                "-qm",
+                "change",
+            ]);
+        };
+        git(&["init", "--quiet"]);
+        commit("alice", "fn a() {\n}\n\nfn b() {\n}\n");
+        commit(
+            "bob",
+            "fn a() {\n}\n\nfn b() {\n    if x {}\n    if y {}\n    if z {}\n}\n",
+        );
+
+        let mut lib = file(&root.join("lib.rs").display().to_string(), 8, &[1, 4]);
+        for (function, (start_line, end_line)) in
+            lib.stats.functions.iter_mut().zip([(1, 2), (4, 8)])
+        {
+            function.start_line = start_line;
+            function.end_line = end_line;
+        }
+        let mut stats = DirectoryStats::new();
+        stats.add_file(lib);
+        stats.add_file(file("missing.rs", 1, &[1]));
+
+        let ownership = by_author(&stats);
+        let owners: Vec<(&str, usize, usize, usize, usize)> = ownership
+            .owners
+            .iter()
+            .map(|o| {
+                (
+                    o.owner.as_str(),
+                    o.files,
+                    o.lines,
+                    o.functions,
+                    o.complexity,
+                )
+            })
+            .collect();
+        assert_eq!(owners, [("bob", 0, 3, 1, 4), ("alice", 1, 5, 1, 1)]);
+        assert_eq!(ownership.skipped, [PathBuf::from("missing.rs")]);
+    }
+
+    #[test]
+    fn test_majority_breaks_ties_by_name() {
+        let lines = HashMap::from([("bob", 3), ("alice", 3), ("carol", 1)]);
+        assert_eq!(majority(&lines), Some("alice"));
+        assert_eq!(majority(&HashMap::new()), None);
+    }
+}
@@ -1,20 +1,332 @@
 //! Tree-sitter based code parser for extracting function and class statistics.
 
+use crate::calls::{calls, is_entry_point};
+use crate::closures::{ClosureStats, closure_stats, function_closures};
+use crate::columns::node_columns;
+use crate::comments::{DocCoverage, LineStats, count_lines, doc_coverage, is_zero};
+use crate::complexity::{cognitive_complexity, cyclomatic_complexity, is_function, nesting_depth};
+use crate::component::ComponentStats;
+use crate::configuration::{ConfigStats, config_stats};
+use crate::encoding::SourceEncoding;
 use crate::error::{CodeStatsError, Result};
-use crate::language::SupportedLanguage;
+use crate::fences::EmbeddedCode;
+use crate::generics::{GenericsStats, generics_stats};
+use crate::golang::GoStats;
+use crate::graphql::{GraphqlStats, SchemaType};
+use crate::halstead::{Halstead, halstead, maintainability_index};
+use crate::handling::{
+    ErrorHandling, ErrorHandlingStats, error_handling_stats, function_error_handling,
+};
+use crate::health::{ParseIssue, parse_issues};
+use crate::imports::imports;
+use crate::interfaces::{ImplementsStats, InterfaceStats, interfaces};
+use crate::language::{Dialect, SupportedLanguage};
+use crate::license::{has_header, license_header};
+use crate::logical::logical_lines;
+use crate::members::type_members;
+use crate::notebook::{NotebookStats, notebook_stats};
+use crate::origin::CodeOrigin;
+use crate::proto::ServiceStats;
+use crate::query::NamedQuery;
+use crate::signature::{
+    function_name, parameter_count, qualified_name, qualified_type_name, return_count,
+};
+use crate::switches::{SwitchStats, switches};
+use crate::templates::{TemplateStats, template_stats};
+use crate::terraform::TerraformStats;
+use crate::todos::TodoComment;
+use crate::tokens::TokenStats;
+use crate::web::{WebStats, web_stats};
+use std::collections::BTreeMap;
 use tree_sitter::{Node, Parser};
 
 /// Statistics about code structure.
 ///
-/// Holds counts of functions and class/struct definitions found in source code.
+/// Holds counts of functions and class/struct definitions found in source code,
+/// along with a per-kind breakdown of the declarations that were counted.
 #[derive(Default, Debug, Clone, serde::Serialize, serde::Deserialize)]
-pub(crate) struct CodeStats {
+pub struct CodeStats {
     /// Number of function declarations found in the source code.
     /// Includes regular functions, methods, constructors, and arrow functions.
     pub function_count: usize,
     /// Number of class or struct declarations found in the source code.
     /// Includes classes, structs, enums, and interfaces depending on the language.
     pub class_struct_count: usize,
+    /// Number of declarations found per kind label (e.g. `struct`, `trait`, `method`).
+    /// Uses a `BTreeMap` so the breakdown is always reported in a stable order.
+    #[serde(default)]
+    pub kinds: BTreeMap<String, usize>,
+    /// Per-function metrics, in source order. Only populated for individual
+    /// files; aggregated totals leave this empty.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub functions: Vec<FunctionStats>,
+    /// Named type declarations, in source order. Only populated for
+    /// individual files, like `functions`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub types: Vec<TypeStats>,
+    /// Interfaces, traits, and protocols, in source order. Only populated
+    /// for individual files, like `functions`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub interfaces: Vec<InterfaceStats>,
+    /// Switch and match statements, in source order. Only populated for
+    /// individual files, like `functions`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub switches: Vec<SwitchStats>,
+    /// Interfaces and base types named by the implementation clauses of the
+    /// file's types, in source order. Only populated for individual files,
+    /// like `functions`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub implements: Vec<ImplementsStats>,
+    /// SQL statements, in source order. Only populated for individual SQL
+    /// files, like `functions`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub statements: Vec<StatementStats>,
+    /// Services and their RPC methods, in source order. Only populated for
+    /// individual Protobuf files, like `functions`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub services: Vec<ServiceStats>,
+    /// Types defined or extended with their fields, in source order. Only
+    /// populated for individual GraphQL files, like `functions`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub schema: Vec<SchemaType>,
+    /// Modules imported by the file, as written, in source order. Only
+    /// populated for individual files, like `functions`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub imports: Vec<String>,
+    /// Names called by top-level code outside any function, in source
+    /// order. Only populated for individual files, like `functions`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub calls: Vec<String>,
+    /// Comment lines carrying a TODO, FIXME, or other configured marker.
+    /// Only populated for individual files, like `functions`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub todos: Vec<TodoComment>,
+    /// Syntax tree and estimated LLM token counts. The tokens of a Markdown
+    /// document's code blocks count once, in the document's own counts.
+    #[serde(default)]
+    pub tokens: TokenStats,
+    /// Code extracted from a Markdown document's fenced blocks, by the
+    /// language named in the fence, or the Lua of a configuration file.
+    /// Totals fold it into their own counts.
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub embedded: BTreeMap<SupportedLanguage, EmbeddedCode>,
+    /// Match counts of user-defined queries, keyed by counter name.
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub queries: BTreeMap<String, usize>,
+    /// Metrics returned by plugins, keyed `<plugin>.<metric>`.
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub plugins: BTreeMap<String, f64>,
+    /// `<plugin>: <message>` for each plugin that failed on the file. Only
+    /// populated for individual files, like `functions`.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub plugin_errors: Vec<String>,
+    /// Code, comment, and blank line counts.
+    #[serde(default)]
+    pub lines: LineStats,
+    /// Doc-comment coverage of public declarations.
+    #[serde(default)]
+    pub docs: DocCoverage,
+    /// Deepest nesting of type declarations: 1 when no type is declared inside
+    /// another, 0 when there are no types. Only computed for Java.
+    #[serde(default)]
+    pub max_type_depth: usize,
+    /// Cyclomatic complexity of a shell script as a whole: 1 plus every
+    /// decision point in the file, at the top level and in its functions.
+    /// Only computed for shell scripts, 0 otherwise; totals keep the highest.
+    #[serde(default, skip_serializing_if = "is_zero")]
+    pub script_complexity: usize,
+    /// Keys and nesting depth of a YAML, JSON, or TOML file. Only set for
+    /// configuration files; `DirectoryStats` totals them separately.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub config: Option<ConfigStats>,
+    /// Goroutines, channel operations, `defer`, and error returns of a Go
+    /// file. Only set for Go code.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub go: Option<GoStats>,
+    /// Elements of an HTML file, or rules and selectors of a stylesheet.
+    /// Only set for HTML, CSS, and SCSS.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub web: Option<WebStats>,
+    /// Cells of a Jupyter notebook. Only set for notebooks.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub notebook: Option<NotebookStats>,
+    /// Lines of the template, script, and style sections of a component,
+    /// whose statistics include those of its sections. Only set for Vue and
+    /// Svelte.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub component: Option<ComponentStats>,
+    /// Tags and control structures of a template. Only set for Jinja, Go
+    /// templates, and ERB.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub template: Option<TemplateStats>,
+    /// Types, fields, operations, and fragments of a GraphQL file. Only set
+    /// for GraphQL.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub graphql: Option<GraphqlStats>,
+    /// Resources, modules, variables, and outputs of a Terraform file. Only
+    /// set for HCL.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub terraform: Option<TerraformStats>,
+    /// Generic declarations and instantiations. Only set for Go, Rust,
+    /// TypeScript, and Java code.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub generics: Option<GenericsStats>,
+    /// Anonymous functions, closures, and lambdas. Only set for Go,
+    /// JavaScript, TypeScript, Python, and Rust code.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub closures: Option<ClosureStats>,
+    /// Error checks, fallible calls, panics, and assertions. Only set for
+    /// Go, JavaScript, TypeScript, Python, and Rust code.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub error_handling: Option<ErrorHandlingStats>,
+    /// License named by the file's header comment, as an SPDX identifier or
+    /// expression, or `license::UNKNOWN_LICENSE`; `None` without a header.
+    /// Not kept in totals.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub license: Option<String>,
+    /// Number of ERROR regions in the syntax tree. Nonzero means part of the
+    /// file could not be parsed (in C and C++ usually because of macros the
+    /// grammar cannot expand), so the other counts may be incomplete.
+    #[serde(default)]
+    pub error_nodes: usize,
+    /// Number of MISSING nodes, tokens tree-sitter assumed to recover from a
+    /// syntax error (e.g. an unclosed brace)
+    #[serde(default, skip_serializing_if = "is_zero")]
+    pub missing_nodes: usize,
+    /// Locations of the first ERROR and MISSING nodes of the file. Not kept
+    /// in totals.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub parse_issues: Vec<ParseIssue>,
+    /// Encoding the file was read in before it was transcoded to UTF-8 for
+    /// parsing. Not kept in totals.
+    #[serde(default, skip_serializing_if = "SourceEncoding::is_utf8")]
+    pub encoding: SourceEncoding,
+    /// True for files above the parse size limit, which were not parsed:
+    /// only their lines are counted, all non-blank lines as code, and
+    /// everything else is left at zero. Not kept in totals.
+    #[serde(default, skip_serializing_if = "std::ops::Not::not")]
+    pub oversized: bool,
+    /// Set for generated and vendored files, which directory analysis totals
+    /// in `DirectoryStats::generated`. Not kept in totals.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub origin: Option<CodeOrigin>,
+    /// True for test files, which `DirectoryStats::tests` totals in addition
+    /// to the code totals
+    #[serde(default, skip_serializing_if = "std::ops::Not::not")]
+    pub test_file: bool,
+}
+
+/// Metrics for a single function, method, or closure.
+#[derive(Default, Debug, Clone, serde::Serialize, serde::Deserialize)]
+pub struct FunctionStats {
+    /// Declared name, or the name it is assigned to for anonymous functions
+    pub name: String,
+    /// Name qualified by enclosing modules, types, and functions (e.g. `Config::new`)
+    #[serde(default)]
+    pub qualified_name: String,
+    /// 1-based line where the function starts
+    pub start_line: usize,
+    /// 1-based line where the function ends
+    pub end_line: usize,
+    /// Number of declared parameters
+    #[serde(default)]
+    pub parameters: usize,
+    /// Number of values returned (see `return_count`)
+    #[serde(default)]
+    pub returns: usize,
+    /// Cyclomatic complexity (1 + number of decision points)
+    pub complexity: usize,
+    /// Deepest nesting of conditionals, loops, and other control-flow blocks
+    /// (0 for straight-line code)
+    #[serde(default)]
+    pub max_nesting: usize,
+    /// Cognitive complexity: flow breaks weighted by how deeply they are nested
+    #[serde(default)]
+    pub cognitive: usize,
+    /// Operator and operand counts, volume, difficulty, and effort
+    #[serde(default)]
+    pub halstead: Halstead,
+    /// Maintainability index from volume, complexity, and lines (higher is
+    /// better)
+    #[serde(default)]
+    pub maintainability: f64,
+    /// Number of anonymous functions inside it, not counting those of named
+    /// functions declared in it
+    #[serde(default, skip_serializing_if = "is_zero")]
+    pub closures: usize,
+    /// Deepest nesting of those anonymous functions (1 for a closure
+    /// directly in the function)
+    #[serde(default, skip_serializing_if = "is_zero")]
+    pub closure_depth: usize,
+    /// Error checks, fallible calls, panics, and assertions in it, not
+    /// counting those of functions declared in it
+    #[serde(default, skip_serializing_if = "ErrorHandling::is_empty")]
+    pub error_handling: ErrorHandling,
+    /// Names of the functions and methods it calls, in source order
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub calls: Vec<String>,
+    /// True if code outside the file (or Go or Java package) or the runtime
+    /// can call it: non-private functions, `main`, constructors, and tests
+    #[serde(default, skip_serializing_if = "std::ops::Not::not")]
+    pub entry_point: bool,
+}
+
+impl FunctionStats {
+    /// Number of source lines spanned by the function, including both ends.
+    pub fn line_count(&self) -> usize {
+        self.end_line - self.start_line + 1
+    }
+}
+
+/// Location and size of a class, struct, or other type declaration.
+#[derive(Default, Debug, Clone, serde::Serialize, serde::Deserialize)]
+pub struct TypeStats {
+    /// Name qualified by enclosing modules, namespaces, and types (e.g. `Shop.Cart`)
+    pub name: String,
+    /// Breakdown label of the declaration (e.g. `class`, `struct`)
+    pub kind: String,
+    /// 1-based line where the declaration starts
+    pub start_line: usize,
+    /// 1-based line where the declaration ends
+    pub end_line: usize,
+    /// True for one part of a C# `partial` type, which may continue in other files
+    #[serde(default, skip_serializing_if = "std::ops::Not::not")]
+    pub partial: bool,
+    /// Number of fields declared in the type
+    #[serde(default)]
+    pub fields: usize,
+    /// Number of types the declaration extends, implements, or embeds
+    #[serde(default)]
+    pub bases: usize,
+}
+
+impl TypeStats {
+    /// Number of source lines spanned by the declaration, including both ends.
+    pub fn line_count(&self) -> usize {
+        self.end_line - self.start_line + 1
+    }
+}
+
+/// Location and shape of a single SQL statement.
+#[derive(Default, Debug, Clone, serde::Serialize, serde::Deserialize)]
+pub struct StatementStats {
+    /// Breakdown label of the statement (`select`, `insert`, `update`,
+    /// `delete`, `ddl`, or `statement` for anything else)
+    pub kind: String,
+    /// 1-based line where the statement starts
+    pub start_line: usize,
+    /// 1-based line where the statement ends
+    pub end_line: usize,
+    /// Number of common table expressions in its `WITH` clause
+    #[serde(default, skip_serializing_if = "is_zero")]
+    pub ctes: usize,
+}
+
+impl StatementStats {
+    /// Number of source lines spanned by the statement, including both ends.
+    pub fn line_count(&self) -> usize {
+        self.end_line - self.start_line + 1
+    }
 }
 
 impl CodeStats {
@@ -22,6 +334,125 @@ impl CodeStats {
     pub fn new() -> Self {
         Self::default()
     }
+
+    /// Increments the breakdown counter for the given declaration kind.
+    pub(crate) fn record_kind(&mut self, kind: &str) {
+        *self.kinds.entry(kind.to_string()).or_default() += 1;
+    }
+
+    /// Returns true if the syntax tree has no ERROR or MISSING nodes, so
+    /// the counts cover the whole file.
+    pub fn parsed_cleanly(&self) -> bool {
+        self.error_nodes == 0 && self.missing_nodes == 0
+    }
+
+    /// Returns the highest cyclomatic complexity among the recorded functions.
+    pub fn max_complexity(&self) -> usize {
+        self.functions
+            .iter()
+            .map(|f| f.complexity)
+            .max()
+            .unwrap_or(0)
+    }
+
+    /// Returns the deepest control-flow nesting among the recorded functions.
+    pub fn max_nesting(&self) -> usize {
+        self.functions
+            .iter()
+            .map(|f| f.max_nesting)
+            .max()
+            .unwrap_or(0)
+    }
+
+    /// Returns the highest cognitive complexity among the recorded functions.
+    pub fn max_cognitive(&self) -> usize {
+        self.functions
+            .iter()
+            .map(|f| f.cognitive)
+            .max()
+            .unwrap_or(0)
+    }
+
+    /// Returns the lowest maintainability index among the recorded functions,
+    /// or `None` without functions.
+    pub fn min_maintainability(&self) -> Option<f64> {
+        self.functions
+            .iter()
+            .map(|f| f.maintainability)
+            .min_by(f64::total_cmp)
+    }
+
+    /// Returns up to `count` statements spanning the most lines, longest
+    /// first; statements of equal length keep their source order.
+    pub fn longest_statements(&self, count: usize) -> Vec<&StatementStats> {
+        let mut statements: Vec<_> = self.statements.iter().collect();
+        statements.sort_by_key(|statement| std::cmp::Reverse(statement.line_count()));
+        statements.truncate(count);
+        statements
+    }
+
+    /// Adds all counts from `other`, including those of its embedded code,
+    /// into this instance.
+    ///
+    /// Per-function metrics are not copied; they stay with the file they belong to.
+    pub(crate) fn merge(&mut self, other: &CodeStats) {
+        self.function_count += other.function_count;
+        self.class_struct_count += other.class_struct_count;
+        for (kind, count) in &other.kinds {
+            *self.kinds.entry(kind.clone()).or_default() += count;
+        }
+        for (name, count) in &other.queries {
+            *self.queries.entry(name.clone()).or_default() += count;
+        }
+        for (name, value) in &other.plugins {
+            *self.plugins.entry(name.clone()).or_default() += value;
+        }
+        self.lines.merge(&other.lines);
+        self.tokens.merge(&other.tokens);
+        self.docs.merge(&other.docs);
+        self.max_type_depth = self.max_type_depth.max(other.max_type_depth);
+        self.script_complexity = self.script_complexity.max(other.script_complexity);
+        self.error_nodes += other.error_nodes;
+        self.missing_nodes += other.missing_nodes;
+        if let Some(config) = &other.config {
+            self.config.get_or_insert_default().merge(config);
+        }
+        if let Some(go) = &other.go {
+            self.go.get_or_insert_default().merge(go);
+        }
+        if let Some(web) = &other.web {
+            self.web.get_or_insert_default().merge(web);
+        }
+        if let Some(notebook) = &other.notebook {
+            self.notebook.get_or_insert_default().merge(notebook);
+        }
+        if let Some(component) = &other.component {
+            self.component.get_or_insert_default().merge(component);
+        }
+        if let Some(template) = &other.template {
+            self.template.get_or_insert_default().merge(template);
+        }
+        if let Some(graphql) = &other.graphql {
+            self.graphql.get_or_insert_default().merge(graphql);
+        }
+        if let Some(terraform) = &other.terraform {
+            self.terraform.get_or_insert_default().merge(terraform);
+        }
+        if let Some(generics) = &other.generics {
+            self.generics.get_or_insert_default().merge(generics);
+        }
+        if let Some(closures) = &other.closures {
+            self.closures.get_or_insert_default().merge(closures);
+        }
+        if let Some(error_handling) = &other.error_handling {
+            self.error_handling
+                .get_or_insert_default()
+                .merge(error_handling);
+        }
+        for embedded in other.embedded.values() {
+            self.merge(&embedded.stats);
+        }
+    }
 }
 
 /// Creates a new tree-sitter parser configured for the specified language.
@@ -33,10 +464,28 @@ impl CodeStats {
 /// # Returns
 ///
 /// A configured `Parser` instance or an error if language setup fails.
+#[cfg(test)]
 pub(crate) fn create_parser(language: &SupportedLanguage) -> Result<Parser> {
+    create_dialect_parser(language, Dialect::Standard)
+}
+
+/// Creates a new tree-sitter parser configured for a specific dialect of a language.
+///
+/// # Arguments
+///
+/// * `language` - The programming language to configure the parser for
+/// * `dialect` - The grammar variant to use (e.g. TSX for `.tsx` files)
+///
+/// # Returns
+///
+/// A configured `Parser` instance or an error if language setup fails.
+pub(crate) fn create_dialect_parser(
+    language: &SupportedLanguage,
+    dialect: Dialect,
+) -> Result<Parser> {
     let mut parser = Parser::new();
     parser
-        .set_language(&language.get_language())
+        .set_language(&language.get_language_with_dialect(dialect))
         .map_err(|_| CodeStatsError::LanguageSetupError)?;
     Ok(parser)
 }
@@ -56,76 +505,237 @@ pub(crate) fn create_parser(language: &SupportedLanguage) -> Result<Parser> {
 /// # Returns
 ///
 /// A `CodeStats` instance containing the counts or an error if parsing fails.
+#[cfg(test)]
 pub(crate) fn analyze_code(
     parser: &mut Parser,
     source_code: &str,
     file_path: &str,
     language: &SupportedLanguage,
+) -> Result<CodeStats> {
+    analyze_code_with_queries(parser, source_code, file_path, language, &[])
+}
+
+/// Analyzes source code and additionally runs user-defined queries on the tree.
+///
+/// Every query gets an entry in `CodeStats::queries`, including those with
+/// no matches, so reports show which counters were configured.
+///
+/// # Arguments
+///
+/// * `parser` - A mutable reference to the tree-sitter parser
+/// * `source_code` - The source code to analyze
+/// * `file_path` - The path to the file being analyzed (used for error reporting)
+/// * `language` - The programming language of the source code
+/// * `queries` - Queries compiled for the parser's grammar
+///
+/// # Returns
+///
+/// A `CodeStats` instance containing the counts or an error if parsing fails.
+#[cfg(test)]
+pub(crate) fn analyze_code_with_queries(
+    parser: &mut Parser,
+    source_code: &str,
+    file_path: &str,
+    language: &SupportedLanguage,
+    queries: &[NamedQuery],
 ) -> Result<CodeStats> {
     let tree = parser
         .parse(source_code, None)
         .ok_or_else(|| CodeStatsError::ParseError(file_path.to_string()))?;
 
     let root_node = tree.root_node();
+    let mut stats = analyze_tree(&root_node, source_code, language);
+    count_queries(&mut stats, queries, &root_node, source_code);
+    Ok(stats)
+}
+
+/// Computes the built-in statistics of a parsed file: declarations and
+/// per-function metrics, lines, doc coverage, and the extras some languages
+/// add, such as a shell script's complexity or a configuration file's keys.
+///
+/// # Arguments
+///
+/// * `root_node` - Root node of the tree parsed from `source_code`
+/// * `source_code` - The source code the tree was parsed from
+/// * `language` - The programming language of the source code
+pub(crate) fn analyze_tree(
+    root_node: &Node,
+    source_code: &str,
+    language: &SupportedLanguage,
+) -> CodeStats {
+    let root_node = *root_node;
     let mut stats = CodeStats::new();
 
-    count_nodes(&root_node, &mut stats, language);
+    count_nodes(&root_node, source_code.as_bytes(), &mut stats, language);
+    stats.lines = count_lines(&root_node, source_code, language);
+    stats.lines.logical = logical_lines(&root_node, language);
+    stats.docs = doc_coverage(&root_node, source_code.as_bytes(), language);
+    language
+        .rules()
+        .file_stats(&root_node, source_code.as_bytes(), &mut stats);
+    stats.web = web_stats(&root_node, language);
+    stats.notebook = notebook_stats(&root_node, source_code.as_bytes(), language);
+    stats.template = template_stats(source_code, language);
+    stats.generics = generics_stats(&root_node, language);
+    stats.closures = closure_stats(&root_node, language);
+    stats.error_handling = error_handling_stats(
+        &root_node,
+        source_code.as_bytes(),
+        language,
+        &stats.functions,
+    );
+    stats.switches = switches(&root_node, source_code.as_bytes(), language)
+        .into_iter()
+        .map(|(_, switch)| switch)
+        .collect();
+    if has_header(language) {
+        stats.license = license_header(&root_node, source_code.as_bytes());
+    }
+    (stats.interfaces, stats.implements) = interfaces(&root_node, source_code.as_bytes(), language);
+    stats.imports = imports(&root_node, source_code.as_bytes(), language);
+    stats.calls = calls(&root_node, source_code.as_bytes(), language);
+    if language.is_configuration() {
+        stats.config = Some(config_stats(&root_node, source_code.as_bytes(), language));
+    }
+    let issues = parse_issues(&root_node);
+    stats.error_nodes = issues.errors;
+    stats.missing_nodes = issues.missing;
+    stats.parse_issues = issues.first;
+    stats
+}
 
-    Ok(stats)
+/// Adds the match counts of `queries` in the tree rooted at `root_node` to
+/// `stats.queries`, recording queries without matches as well.
+pub(crate) fn count_queries(
+    stats: &mut CodeStats,
+    queries: &[NamedQuery],
+    root_node: &Node,
+    source_code: &str,
+) {
+    for query in queries {
+        let matches = query.count_matches(*root_node, source_code.as_bytes());
+        *stats.queries.entry(query.name.clone()).or_default() += matches;
+    }
+}
+
+/// How a declaration node contributes to the structural totals.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum Tally {
+    /// Counted in `CodeStats::function_count`
+    Function,
+    /// Counted in `CodeStats::class_struct_count`
+    Type,
+    /// Reported in the per-kind breakdown only
+    KindOnly,
+}
+
+/// A node recognized as a declaration, with its breakdown label.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) struct Declaration {
+    pub kind: &'static str,
+    pub tally: Tally,
+}
+
+impl Declaration {
+    pub(crate) fn new(kind: &'static str, tally: Tally) -> Option<Self> {
+        Some(Self { kind, tally })
+    }
+}
+
+/// Classifies a syntax node as one of the declarations counted for `language`.
+///
+/// # Arguments
+///
+/// * `node` - The node to classify
+/// * `source` - The source code the tree was parsed from, for Elixir, whose
+///   declarations are calls told apart by name
+/// * `language` - The programming language of the source code
+///
+/// # Returns
+///
+/// The declaration's kind label and how it is tallied, or `None` if the node
+/// is not a counted declaration.
+pub(crate) fn classify(
+    node: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> Option<Declaration> {
+    language.rules().classify(node, source)
+}
+
+/// Returns true for the built-in Make targets such as `.PHONY` and
+/// `.SUFFIXES`, which configure make rather than build anything.
+pub(crate) fn is_make_special_target(target: &str) -> bool {
+    target.strip_prefix('.').is_some_and(|name| {
+        !name.is_empty() && name.chars().all(|c| c.is_ascii_uppercase() || c == '_')
+    })
 }
 
 /// Recursively traverses the AST and counts function and class/struct nodes.
 ///
 /// Uses depth-first traversal to examine each node and determine if it represents
 /// a function or class/struct declaration based on language-specific node types.
-fn count_nodes(node: &Node, stats: &mut CodeStats, language: &SupportedLanguage) {
-    let node_kind = node.kind();
-
-    match language {
-        SupportedLanguage::Rust => match node_kind {
-            "function_item" => stats.function_count += 1,
-            "struct_item" | "enum_item" => stats.class_struct_count += 1,
-            _ => {}
-        },
-        SupportedLanguage::Go => {
-            match node_kind {
-                "function_declaration" | "method_declaration" => stats.function_count += 1,
-                "type_spec" => {
-                    // Go uses type_spec for type declarations, but we only want to count structs.
-                    // A type_spec node has a "type" field that contains the actual type definition.
-                    // We need to check if this type is specifically a struct_type, not an interface,
-                    // type alias, or other type declaration.
-                    if let Some(type_node) = node.child_by_field_name("type")
-                        && type_node.kind() == "struct_type"
-                    {
-                        stats.class_struct_count += 1;
-                    }
+/// Every function node also gets a `FunctionStats` entry with its signature
+/// details and complexity.
+fn count_nodes(node: &Node, source: &[u8], stats: &mut CodeStats, language: &SupportedLanguage) {
+    if is_function(node, source, language) {
+        let start_line = node.start_position().row + 1;
+        let end_line = node.end_position().row + 1;
+        let complexity = cyclomatic_complexity(node, source, language);
+        let halstead = halstead(node, source);
+        let (closures, closure_depth) = function_closures(node, language);
+        stats.functions.push(FunctionStats {
+            name: function_name(node, source),
+            qualified_name: qualified_name(node, source, language),
+            start_line,
+            end_line,
+            parameters: parameter_count(node, source, language),
+            returns: return_count(node, source, language),
+            complexity,
+            max_nesting: nesting_depth(node, source, language),
+            cognitive: cognitive_complexity(node, source, language),
+            maintainability: maintainability_index(
+                halstead.volume,
+                complexity,
+                end_line - start_line + 1,
+            ),
+            halstead,
+            closures,
+            closure_depth,
+            error_handling: function_error_handling(node, source, language),
+            calls: calls(node, source, language),
+            entry_point: is_entry_point(node, source, language),
+        });
+    }
+
+    let declaration = classify(node, source, language);
+    if let Some(declaration) = declaration {
+        match declaration.tally {
+            Tally::Function => stats.function_count += 1,
+            Tally::Type => {
+                stats.class_struct_count += 1;
+                if let Some(name) = qualified_type_name(node, source, language) {
+                    let members = type_members(node, source, language);
+                    stats.types.push(TypeStats {
+                        name,
+                        kind: declaration.kind.to_string(),
+                        start_line: node.start_position().row + 1,
+                        end_line: node.end_position().row + 1,
+                        partial: language.rules().is_partial(node),
+                        fields: members.fields,
+                        bases: members.bases,
+                    });
                 }
-                _ => {}
             }
+            Tally::KindOnly => {}
         }
-        SupportedLanguage::Python => match node_kind {
-            "function_definition" => stats.function_count += 1,
-            "class_definition" => stats.class_struct_count += 1,
-            _ => {}
-        },
-        SupportedLanguage::JavaScript | SupportedLanguage::TypeScript => match node_kind {
-            "function_declaration"
-            | "function_expression"
-            | "arrow_function"
-            | "method_definition" => {
-                stats.function_count += 1;
-            }
-            "class_declaration" => stats.class_struct_count += 1,
-            _ => {}
-        },
-        SupportedLanguage::Java => match node_kind {
-            "method_declaration" | "constructor_declaration" => stats.function_count += 1,
-            "class_declaration" | "interface_declaration" => stats.class_struct_count += 1,
-            _ => {}
-        },
+        stats.record_kind(declaration.kind);
     }
 
+    language
+        .rules()
+        .node_stats(node, source, declaration, stats);
+
     // Recursively traverse all child nodes to find nested declarations.
     // This ensures we count all functions and classes, including:
     // - Nested functions (e.g., closures, inner functions)
@@ -133,13 +743,153 @@ fn count_nodes(node: &Node, stats: &mut CodeStats, language: &SupportedLanguage)
     // - Methods within classes
     let mut cursor = node.walk();
     for child in node.children(&mut cursor) {
-        count_nodes(&child, stats, language);
+        count_nodes(&child, source, stats, language);
     }
 }
 
+/// A named declaration, as listed in a tags file or an outline.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct Symbol {
+    /// Declared name, without enclosing scopes
+    pub name: String,
+    /// Breakdown label of the declaration (e.g. `function`, `struct`)
+    pub kind: &'static str,
+    /// 1-based line where the declaration starts
+    pub line: usize,
+    /// 1-based display column where the declaration starts
+    pub column: usize,
+    /// 1-based line where the declaration ends
+    pub end_line: usize,
+    /// 1-based display column just past the end of the declaration
+    pub end_column: usize,
+}
+
+/// Parses source code and lists its named declarations in source order.
+///
+/// Declarations without a name of their own (impl blocks, templates,
+/// decorators, unassigned closures) are left out.
+///
+/// # Arguments
+///
+/// * `parser` - A mutable reference to the tree-sitter parser
+/// * `source_code` - The source code to analyze
+/// * `file_path` - The path to the file being analyzed (used for error reporting)
+/// * `language` - The programming language of the source code
+/// * `tab_width` - Tab width for the display columns of the declarations
+///
+/// # Returns
+///
+/// The declarations found or an error if parsing fails.
+pub(crate) fn extract_symbols(
+    parser: &mut Parser,
+    source_code: &str,
+    file_path: &str,
+    language: &SupportedLanguage,
+    tab_width: usize,
+) -> Result<Vec<Symbol>> {
+    let tree = parser
+        .parse(source_code, None)
+        .ok_or_else(|| CodeStatsError::ParseError(file_path.to_string()))?;
+
+    let mut symbols = Vec::new();
+    collect_symbols(
+        &tree.root_node(),
+        source_code.as_bytes(),
+        language,
+        tab_width,
+        &mut symbols,
+    );
+    Ok(symbols)
+}
+
+/// Recursively collects the named declarations below `node`.
+fn collect_symbols(
+    node: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+    tab_width: usize,
+    symbols: &mut Vec<Symbol>,
+) {
+    if let Some(declaration) = classify(node, source, language)
+        && let Some(name) = symbol_name(node, source, declaration)
+    {
+        let (column, end_column) = node_columns(node, source, tab_width);
+        symbols.push(Symbol {
+            name,
+            kind: declaration.kind,
+            line: node.start_position().row + 1,
+            column,
+            end_line: node.end_position().row + 1,
+            end_column,
+        });
+    }
+
+    let mut cursor = node.walk();
+    for child in node.children(&mut cursor) {
+        collect_symbols(&child, source, language, tab_width, symbols);
+    }
+}
+
+/// Returns the name a declaration is tagged with, if it has one.
+fn symbol_name(node: &Node, source: &[u8], declaration: Declaration) -> Option<String> {
+    if matches!(
+        declaration.kind,
+        "impl" | "template" | "decorator" | "annotation"
+    ) {
+        return None;
+    }
+
+    let name = if declaration.tally == Tally::Function {
+        let name = function_name(node, source);
+        // Out-of-line C++ members are named `Widget::draw`
+        let name = name.rsplit("::").next().unwrap_or_default().to_string();
+        (name != "<anonymous>").then_some(name)?
+    } else {
+        node.child_by_field_name("name")?
+            .utf8_text(source)
+            .ok()?
+            .to_string()
+    };
+
+    // Tags files are tab-separated and line-oriented
+    (!name.is_empty() && !name.contains(['\t', '\n', '\r'])).then_some(name)
+}
+
+/// Returns true if a Kotlin declaration's modifier list contains the given
+/// keyword, such as `data`, `enum`, or `suspend`.
+///
+/// Modifiers are grouped by category (`class_modifier`, `function_modifier`,
+/// ...), each wrapping the keyword token.
+pub(crate) fn has_kotlin_modifier(node: &Node, keyword: &str) -> bool {
+    let mut cursor = node.walk();
+    node.children(&mut cursor)
+        .filter(|child| child.kind() == "modifiers")
+        .any(|modifiers| {
+            let mut cursor = modifiers.walk();
+            modifiers
+                .children(&mut cursor)
+                .any(|modifier| has_child_kind(&modifier, keyword))
+        })
+}
+
+/// Returns true if one of `node`'s direct children, named or not, has the given kind.
+pub(crate) fn has_child_kind(node: &Node, kind: &str) -> bool {
+    child_of_kind(node, kind).is_some()
+}
+
+/// Returns the first direct child of `node`, named or not, with the given
+/// kind.
+pub(crate) fn child_of_kind<'tree>(node: &Node<'tree>, kind: &str) -> Option<Node<'tree>> {
+    let mut cursor = node.walk();
+    node.children(&mut cursor)
+        .find(|child| child.kind() == kind)
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
+    use crate::columns::DEFAULT_TAB_WIDTH;
+    use crate::health::ParseIssueKind;
 
     #[test]
     fn test_code_stats_new() {
@@ -164,6 +914,22 @@ mod tests {
             SupportedLanguage::JavaScript,
             SupportedLanguage::TypeScript,
             SupportedLanguage::Java,
+            SupportedLanguage::C,
+            SupportedLanguage::Cpp,
+            SupportedLanguage::Ruby,
+            SupportedLanguage::Kotlin,
+            SupportedLanguage::CSharp,
+            SupportedLanguage::Swift,
+            SupportedLanguage::Php,
+            SupportedLanguage::Bash,
+            SupportedLanguage::Sql,
+            SupportedLanguage::Markdown,
+            SupportedLanguage::Yaml,
+            SupportedLanguage::Json,
+            SupportedLanguage::Toml,
+            SupportedLanguage::Dockerfile,
+            SupportedLanguage::Make,
+            SupportedLanguage::Protobuf,
         ];
 
         for lang in languages {
@@ -201,6 +967,68 @@ enum Status {
         assert_eq!(stats.class_struct_count, 2);
     }
 
+    #[test]
+    fn test_analyze_code_rust_kind_breakdown() {
+        let rust_code = r#"
+trait Shape {
+    fn area(&self) -> f64;
+}
+
+struct Square {
+    side: f64,
+}
+
+enum Unit {
+    Metric,
+}
+
+impl Shape for Square {
+    fn area(&self) -> f64 {
+        self.side * self.side
+    }
+}
+
+impl Square {
+    fn new(side: f64) -> Self {
+        Self { side }
+    }
+}
+"#;
+
+        let language = SupportedLanguage::Rust;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, rust_code, "shapes.rs", &language).unwrap();
+
+        // Trait method signatures without a body are not function items
+        assert_eq!(stats.function_count, 2);
+        assert_eq!(stats.class_struct_count, 2);
+        assert_eq!(stats.kinds["function"], 2);
+        assert_eq!(stats.kinds["struct"], 1);
+        assert_eq!(stats.kinds["enum"], 1);
+        assert_eq!(stats.kinds["trait"], 1);
+        assert_eq!(stats.kinds["impl"], 2);
+    }
+
+    #[test]
+    fn test_code_stats_merge() {
+        let mut total = CodeStats::new();
+        let mut file = CodeStats::new();
+        file.function_count = 2;
+        file.class_struct_count = 1;
+        file.record_kind("function");
+        file.record_kind("function");
+        file.record_kind("struct");
+
+        total.merge(&file);
+        total.merge(&file);
+
+        assert_eq!(total.function_count, 4);
+        assert_eq!(total.class_struct_count, 2);
+        assert_eq!(total.kinds["function"], 4);
+        assert_eq!(total.kinds["struct"], 2);
+        assert_eq!(total.lines.code, 0);
+    }
+
     #[test]
     fn test_analyze_code_python() {
         let python_code = r#"
@@ -227,6 +1055,39 @@ class Animal:
 
         assert_eq!(stats.function_count, 4); // main, helper, __init__, greet
         assert_eq!(stats.class_struct_count, 2); // Person, Animal
+        assert_eq!(stats.kinds["function"], 2); // main, helper
+        assert_eq!(stats.kinds["method"], 2); // __init__, greet
+        assert_eq!(stats.kinds["class"], 2);
+    }
+
+    #[test]
+    fn test_analyze_code_python_decorators_and_async() {
+        let python_code = r#"
+class Service:
+    @staticmethod
+    def create():
+        return Service()
+
+    async def run(self):
+        pass
+
+@cache
+@trace
+async def load():
+    def inner():
+        pass
+    return inner
+"#;
+
+        let language = SupportedLanguage::Python;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, python_code, "service.py", &language).unwrap();
+
+        assert_eq!(stats.function_count, 4); // create, run, load, inner
+        assert_eq!(stats.kinds["method"], 2); // create, run
+        assert_eq!(stats.kinds["function"], 2); // load, inner
+        assert_eq!(stats.kinds["async_function"], 2); // run, load
+        assert_eq!(stats.kinds["decorator"], 3); // staticmethod, cache, trace
     }
 
     #[test]
@@ -291,6 +1152,21 @@ func (p Person) Greet() {
 
         assert_eq!(stats.function_count, 3); // main, helper, Greet
         assert_eq!(stats.class_struct_count, 1); // Person
+        assert_eq!(stats.kinds["function"], 2);
+        assert_eq!(stats.kinds["method"], 1);
+        assert_eq!(stats.kinds["struct"], 1);
+
+        let names: Vec<_> = stats.functions.iter().map(|f| f.name.as_str()).collect();
+        assert_eq!(names, vec!["main", "helper", "Greet"]);
+        assert_eq!(stats.functions[0].start_line, 4);
+        assert_eq!(stats.functions[0].end_line, 6);
+        assert_eq!(stats.max_complexity(), 1);
+
+        // Person and Greet are exported but carry no doc comment
+        assert_eq!(stats.docs.public, 2);
+        assert_eq!(stats.docs.documented, 0);
+        assert_eq!(stats.lines.comment, 1);
+        assert_eq!(stats.lines.blank, 5);
     }
 
     #[test]
@@ -321,6 +1197,533 @@ interface Runnable {
 
         assert_eq!(stats.function_count, 4); // main, helper, constructor, run (interface method)
         assert_eq!(stats.class_struct_count, 2); // Main, Runnable
+        assert_eq!(stats.kinds["method"], 3);
+        assert_eq!(stats.kinds["constructor"], 1);
+        assert_eq!(stats.max_type_depth, 1);
+    }
+
+    #[test]
+    fn test_analyze_code_c() {
+        let c_code = r#"
+#include <stdio.h>
+#define MAX_ITEMS 16
+#define SQUARE(x) ((x) * (x))
+
+struct point {
+    int x;
+    int y;
+};
+
+union value {
+    int i;
+    float f;
+};
+
+enum color { RED, GREEN };
+
+static int area(struct point p) {
+    return p.x * p.y;
+}
+
+int main(void) {
+    struct point origin = {0, 0};
+    return area(origin);
+}
+"#;
+
+        let language = SupportedLanguage::C;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, c_code, "main.c", &language).unwrap();
+
+        assert_eq!(stats.function_count, 2); // area, main
+        // point, value, color; `struct point p` only refers to the type
+        assert_eq!(stats.class_struct_count, 3);
+        assert_eq!(stats.kinds["struct"], 1);
+        assert_eq!(stats.kinds["union"], 1);
+        assert_eq!(stats.kinds["enum"], 1);
+        assert_eq!(stats.kinds["macro"], 2);
+        assert_eq!(stats.error_nodes, 0);
+    }
+
+    #[test]
+    fn test_analyze_code_cpp() {
+        let cpp_code = r#"
+namespace geometry {
+
+template <typename T>
+class Box {
+public:
+    explicit Box(T value) : value_(value) {}
+    T get() const { return value_; }
+
+    template <typename U>
+    U as() const { return static_cast<U>(value_); }
+
+private:
+    T value_;
+};
+
+struct Size {
+    int width;
+    int height;
+};
+
+}
+
+int main() {
+    auto twice = [](int x) { return x * 2; };
+    return twice(geometry::Box<int>(1).get());
+}
+"#;
+
+        let language = SupportedLanguage::Cpp;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, cpp_code, "main.cpp", &language).unwrap();
+
+        // Box, get, as, main, and the lambda
+        assert_eq!(stats.function_count, 5);
+        assert_eq!(stats.class_struct_count, 2); // Box, Size
+        assert_eq!(stats.kinds["class"], 1);
+        assert_eq!(stats.kinds["struct"], 1);
+        assert_eq!(stats.kinds["method"], 3);
+        assert_eq!(stats.kinds["function"], 1);
+        assert_eq!(stats.kinds["lambda"], 1);
+        assert_eq!(stats.kinds["template"], 2);
+        assert_eq!(stats.kinds["namespace"], 1);
+        assert_eq!(stats.error_nodes, 0);
+    }
+
+    #[test]
+    fn test_analyze_code_ruby() {
+        let ruby_code = r#"
+module Shop
+  class Cart
+    attr_reader :items
+
+    def initialize
+      @items = []
+    end
+
+    def add(item, qty = 1)
+      @items << item
+    end
+
+    def self.empty
+      new
+    end
+
+    class << self
+      def build(*items)
+        items.each { |i| puts i }
+      end
+    end
+  end
+end
+
+square = ->(x) { x * x }
+[1, 2].map do |n|
+  n + 1
+end
+"#;
+
+        let language = SupportedLanguage::Ruby;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, ruby_code, "cart.rb", &language).unwrap();
+
+        // initialize, add, empty, build, and the lambda
+        assert_eq!(stats.function_count, 5);
+        assert_eq!(stats.class_struct_count, 1); // Cart
+        assert_eq!(stats.kinds["method"], 2);
+        assert_eq!(stats.kinds["singleton_method"], 2);
+        assert_eq!(stats.kinds["lambda"], 1);
+        assert_eq!(stats.kinds["module"], 1);
+        assert_eq!(stats.kinds["singleton_class"], 1);
+        // The `each` and `map` blocks, but not the lambda's body
+        assert_eq!(stats.kinds["block"], 2);
+        assert_eq!(stats.error_nodes, 0);
+    }
+
+    #[test]
+    fn test_analyze_code_kotlin() {
+        let kotlin_code = r#"
+package shop
+
+data class Item(val name: String, val price: Int)
+
+interface Repository {
+    suspend fun load(id: Int): Item
+}
+
+class Cart(private val repository: Repository) {
+    private val items = mutableListOf<Item>()
+
+    constructor() : this(EmptyRepository)
+
+    suspend fun add(id: Int) {
+        items += repository.load(id)
+    }
+
+    companion object {
+        fun empty() = Cart()
+    }
+}
+
+object EmptyRepository : Repository {
+    override suspend fun load(id: Int) = Item("none", 0)
+}
+
+enum class Size { SMALL, LARGE }
+
+fun String.shout(): String = uppercase()
+
+suspend fun <T> List<T>.firstAsync(): T = first()
+
+val total = { items: List<Item> -> items.sumOf { it.price } }
+"#;
+
+        let language = SupportedLanguage::Kotlin;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, kotlin_code, "Cart.kt", &language).unwrap();
+
+        // load, constructor, add, empty, load, shout, firstAsync, two lambdas
+        assert_eq!(stats.function_count, 9);
+        // Item, Repository, Cart, EmptyRepository, Size
+        assert_eq!(stats.class_struct_count, 5);
+        assert_eq!(stats.kinds["data_class"], 1);
+        assert_eq!(stats.kinds["interface"], 1);
+        assert_eq!(stats.kinds["class"], 1);
+        assert_eq!(stats.kinds["object"], 1);
+        assert_eq!(stats.kinds["enum"], 1);
+        assert_eq!(stats.kinds["companion_object"], 1);
+        assert_eq!(stats.kinds["method"], 4);
+        assert_eq!(stats.kinds["function"], 2);
+        assert_eq!(stats.kinds["constructor"], 1);
+        assert_eq!(stats.kinds["lambda"], 2);
+        assert_eq!(stats.kinds["extension_function"], 2);
+        assert_eq!(stats.kinds["suspend_function"], 4);
+        assert_eq!(stats.error_nodes, 0);
+    }
+
+    #[test]
+    fn test_analyze_code_csharp() {
+        let csharp_code = r#"
+using System;
+
+namespace Shop.Models;
+
+public record Item(string Name, decimal Price);
+
+public readonly struct Money
+{
+    public decimal Amount { get; }
+
+    public Money(decimal amount) => Amount = amount;
+
+    public static Money operator +(Money a, Money b) => new(a.Amount + b.Amount);
+}
+
+public interface ICart
+{
+    void Add(Item item);
+}
+
+public partial class Cart : ICart
+{
+    public void Add(Item item)
+    {
+        int Total(int x) => x * 2;
+        Items.ForEach(i => Console.WriteLine(i));
+    }
+
+    ~Cart() {}
+}
+
+public enum Size { Small, Large }
+
+public delegate void Changed(Cart cart);
+"#;
+
+        let language = SupportedLanguage::CSharp;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, csharp_code, "Cart.cs", &language).unwrap();
+
+        // constructor, operator, the interface's Add, Add, Total, the lambda,
+        // and the destructor
+        assert_eq!(stats.function_count, 7);
+        // Item, Money, ICart, Cart, Size
+        assert_eq!(stats.class_struct_count, 5);
+        assert_eq!(stats.kinds["method"], 2);
+        assert_eq!(stats.kinds["constructor"], 1);
+        assert_eq!(stats.kinds["destructor"], 1);
+        assert_eq!(stats.kinds["operator"], 1);
+        assert_eq!(stats.kinds["local_function"], 1);
+        assert_eq!(stats.kinds["lambda"], 1);
+        assert_eq!(stats.kinds["record"], 1);
+        assert_eq!(stats.kinds["struct"], 1);
+        assert_eq!(stats.kinds["interface"], 1);
+        assert_eq!(stats.kinds["class"], 1);
+        assert_eq!(stats.kinds["enum"], 1);
+        assert_eq!(stats.kinds["namespace"], 1);
+        assert_eq!(stats.kinds["property"], 1);
+        assert_eq!(stats.kinds["delegate"], 1);
+        assert_eq!(stats.error_nodes, 0);
+
+        let types: Vec<_> = stats
+            .types
+            .iter()
+            .map(|t| (t.name.as_str(), t.kind.as_str(), t.partial))
+            .collect();
+        assert_eq!(
+            types,
+            vec![
+                ("Shop.Models.Item", "record", false),
+                ("Shop.Models.Money", "struct", false),
+                ("Shop.Models.ICart", "interface", false),
+                ("Shop.Models.Cart", "class", true),
+                ("Shop.Models.Size", "enum", false),
+            ]
+        );
+        assert_eq!(stats.types[3].line_count(), 10);
+    }
+
+    #[test]
+    fn test_analyze_code_reports_error_nodes() {
+        // The grammar does not expand macros, so `BEGIN`/`END` used as braces
+        // leave part of the file unparsed
+        let c_code = r#"
+#define BEGIN {
+#define END }
+
+void broken(void) BEGIN
+    return;
+END
+
+int fine(void) {
+    return 0;
+}
+"#;
+
+        let language = SupportedLanguage::C;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, c_code, "macros.c", &language).unwrap();
+
+        assert!(stats.error_nodes > 0);
+        assert!(!stats.parsed_cleanly());
+        assert_eq!(stats.parse_issues[0].kind, ParseIssueKind::Error);
+        assert!(stats.functions.iter().any(|f| f.name == "fine"));
+    }
+
+    #[test]
+    fn test_extract_symbols() {
+        let rust_code = r#"
+struct Point { x: i32 }
+impl Point {
+    fn new() -> Self {
+        let make = |x: i32| Point { x };
+        make(0)
+    }
+}
+trait Shape {}
+enum Color { Red }
+fn main() {}
+"#;
+
+        let language = SupportedLanguage::Rust;
+        let mut parser = create_parser(&language).unwrap();
+        let symbols = extract_symbols(
+            &mut parser,
+            rust_code,
+            "test.rs",
+            &language,
+            DEFAULT_TAB_WIDTH,
+        )
+        .unwrap();
+        let found: Vec<_> = symbols
+            .iter()
+            .map(|s| (s.name.as_str(), s.kind, s.line))
+            .collect();
+        let new = &symbols[1];
+        assert_eq!((new.column, new.end_line, new.end_column), (5, 7, 6));
+
+        // The impl block and the closure have no name of their own
+        assert_eq!(
+            found,
+            vec![
+                ("Point", "struct", 2),
+                ("new", "function", 4),
+                ("Shape", "trait", 9),
+                ("Color", "enum", 10),
+                ("main", "function", 11),
+            ]
+        );
+
+        let python_code = "@cached\nclass Worker:\n    async def run(self):\n        pass\n";
+        let language = SupportedLanguage::Python;
+        let mut parser = create_parser(&language).unwrap();
+        let symbols = extract_symbols(
+            &mut parser,
+            python_code,
+            "test.py",
+            &language,
+            DEFAULT_TAB_WIDTH,
+        )
+        .unwrap();
+        let found: Vec<_> = symbols.iter().map(|s| (s.name.as_str(), s.kind)).collect();
+        assert_eq!(found, vec![("Worker", "class"), ("run", "method")]);
+    }
+
+    #[test]
+    fn test_symbol_columns_expand_tabs() {
+        let rust_code = "mod geo {\n\tfn area() {}\n}\n";
+        let language = SupportedLanguage::Rust;
+        let mut parser = create_parser(&language).unwrap();
+        for (tab_width, column) in [(4, 5), (8, 9)] {
+            let symbols =
+                extract_symbols(&mut parser, rust_code, "geo.rs", &language, tab_width).unwrap();
+            let area = symbols.iter().find(|s| s.name == "area").unwrap();
+            assert_eq!((area.column, area.end_column), (column, column + 12));
+        }
+    }
+
+    #[test]
+    fn test_analyze_code_java_nested_types() {
+        let java_code = r#"
+@Retention(RetentionPolicy.RUNTIME)
+@interface Audited {
+    String value() default "";
+}
+
+public class Repository<T extends Comparable<T>> {
+    public record Entry<K, V>(K key, V value) {
+        public Entry {
+            Objects.requireNonNull(key);
+        }
+    }
+
+    enum State { OPEN, CLOSED }
+
+    class Cursor implements Iterator<T> {
+        @Override
+        public boolean hasNext() { return false; }
+
+        @Override
+        public T next() {
+            Runnable hook = new Runnable() {
+                public void run() {}
+            };
+            return null;
+        }
+    }
+
+    @Audited("find")
+    public <R> List<R> map(Function<? super T, R> mapper) {
+        return List.of();
+    }
+}
+"#;
+
+        let language = SupportedLanguage::Java;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, java_code, "Repository.java", &language).unwrap();
+
+        // Entry (compact constructor), hasNext, next, run, map
+        assert_eq!(stats.function_count, 5);
+        // Repository, Entry, State, Cursor; the annotation type is breakdown-only
+        assert_eq!(stats.class_struct_count, 4);
+        assert_eq!(stats.kinds["class"], 2);
+        assert_eq!(stats.kinds["record"], 1);
+        assert_eq!(stats.kinds["enum"], 1);
+        assert_eq!(stats.kinds["constructor"], 1);
+        assert_eq!(stats.kinds["annotation_type"], 1);
+        assert_eq!(stats.kinds["annotation"], 4);
+        // Repository > Cursor > anonymous Runnable
+        assert_eq!(stats.max_type_depth, 3);
+
+        let names: Vec<_> = stats
+            .functions
+            .iter()
+            .map(|f| f.qualified_name.as_str())
+            .collect();
+        assert_eq!(
+            names,
+            [
+                "Repository.Entry.Entry",
+                "Repository.Cursor.hasNext",
+                "Repository.Cursor.next",
+                "Repository.Cursor.next.run",
+                "Repository.map",
+            ]
+        );
+    }
+
+    #[test]
+    fn test_analyze_code_typescript_declarations() {
+        let ts_code = r#"
+interface Shape {
+    area(): number;
+}
+
+type Id = string | number;
+
+enum Color {
+    Red,
+    Green,
+}
+
+abstract class Base {
+    abstract describe(): string;
+}
+
+class Square extends Base implements Shape {
+    constructor(private side: number) {
+        super();
+    }
+
+    area(): number {
+        return this.side * this.side;
+    }
+
+    describe(): string {
+        return "square";
+    }
+}
+
+const double = (n: number): number => n * 2;
+"#;
+
+        let language = SupportedLanguage::TypeScript;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, ts_code, "shapes.ts", &language).unwrap();
+
+        assert_eq!(stats.function_count, 4); // constructor, area, describe, double
+        assert_eq!(stats.class_struct_count, 2); // Base, Square
+        assert_eq!(stats.kinds["interface"], 1);
+        assert_eq!(stats.kinds["type_alias"], 1);
+        assert_eq!(stats.kinds["enum"], 1);
+        assert_eq!(stats.kinds["class"], 2);
+        assert_eq!(stats.kinds["arrow_function"], 1);
+        assert_eq!(stats.kinds["method"], 3);
+    }
+
+    #[test]
+    fn test_analyze_code_tsx_dialect() {
+        let tsx_code = r#"
+interface Props {
+    name: string;
+}
+
+const Greeting = ({ name }: Props) => {
+    return <div className="greeting">Hello {name}</div>;
+};
+"#;
+
+        let language = SupportedLanguage::TypeScript;
+        let mut parser = create_dialect_parser(&language, Dialect::Tsx).unwrap();
+        let stats = analyze_code(&mut parser, tsx_code, "Greeting.tsx", &language).unwrap();
+
+        assert_eq!(stats.function_count, 1);
+        assert_eq!(stats.kinds["interface"], 1);
+        assert_eq!(stats.kinds["arrow_function"], 1);
     }
 
     #[test]
@@ -419,4 +1822,379 @@ type Person struct {
         // Functions: Increment method
         assert_eq!(stats.function_count, 1);
     }
+
+    #[test]
+    fn test_analyze_code_swift() {
+        let swift_code = r#"
+import SwiftUI
+
+@propertyWrapper
+struct Clamped {
+    var wrappedValue: Int
+
+    init(wrappedValue: Int) {
+        self.wrappedValue = wrappedValue
+    }
+}
+
+protocol Shape {
+    func area() -> Double
+}
+
+struct Circle: Shape {
+    @Clamped var radius: Int
+
+    func area() -> Double { Double(radius * radius) * 3.14 }
+}
+
+class Store: ObservableObject {
+    @Published var shapes: [Shape] = []
+    @MainActor var title = "Shapes"
+
+    deinit {}
+}
+
+enum Unit { case cm, inch }
+
+extension Store {
+    func total() -> Double { shapes.reduce(0) { $0 + $1.area() } }
+}
+
+func makeStore() -> Store { Store() }
+
+let double = { (x: Int) -> Int in x * 2 }
+"#;
+
+        let language = SupportedLanguage::Swift;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, swift_code, "Shapes.swift", &language).unwrap();
+
+        // init, two area, deinit, total, makeStore, and two closures
+        assert_eq!(stats.function_count, 8);
+        // Clamped, Circle, Store, Unit
+        assert_eq!(stats.class_struct_count, 4);
+        assert_eq!(stats.kinds["struct"], 2);
+        assert_eq!(stats.kinds["class"], 1);
+        assert_eq!(stats.kinds["enum"], 1);
+        assert_eq!(stats.kinds["protocol"], 1);
+        assert_eq!(stats.kinds["extension"], 1);
+        assert_eq!(stats.kinds["method"], 3);
+        assert_eq!(stats.kinds["function"], 1);
+        assert_eq!(stats.kinds["initializer"], 1);
+        assert_eq!(stats.kinds["deinitializer"], 1);
+        assert_eq!(stats.kinds["closure"], 2);
+        assert_eq!(stats.kinds["property_wrapper"], 1);
+        // radius and shapes; `@MainActor` is not a wrapper
+        assert_eq!(stats.kinds["wrapped_property"], 2);
+        assert_eq!(stats.error_nodes, 0);
+    }
+
+    #[test]
+    fn test_analyze_code_php() {
+        let php_code = r#"<!DOCTYPE html>
+<html>
+<body>
+<?php
+namespace Shop;
+
+interface Priced {
+    public function price(): int;
+}
+
+trait Discount {
+    public function discount(int $percent): int {
+        return intdiv($this->price() * $percent, 100);
+    }
+}
+
+enum Size { case Small; case Large; }
+
+class Cart implements Priced {
+    use Discount;
+
+    public function price(): int {
+        return array_sum(array_map(fn($i) => $i->price, $this->items));
+    }
+}
+
+function render(array $items): string {
+    $format = function ($item) { return "<li>{$item}</li>"; };
+    return implode("", array_map($format, $items));
+}
+?>
+<ul>
+<?php foreach ($items as $item): ?>
+  <li><?= htmlspecialchars($item) ?></li>
+<?php endforeach; ?>
+</ul>
+</body>
+</html>
+"#;
+
+        let language = SupportedLanguage::Php;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, php_code, "cart.php", &language).unwrap();
+
+        // Two price methods, discount, the arrow function, render, and the closure
+        assert_eq!(stats.function_count, 6);
+        // Priced, Discount, Size, Cart
+        assert_eq!(stats.class_struct_count, 4);
+        assert_eq!(stats.kinds["interface"], 1);
+        assert_eq!(stats.kinds["trait"], 1);
+        assert_eq!(stats.kinds["enum"], 1);
+        assert_eq!(stats.kinds["class"], 1);
+        assert_eq!(stats.kinds["namespace"], 1);
+        assert_eq!(stats.kinds["method"], 3);
+        assert_eq!(stats.kinds["function"], 1);
+        assert_eq!(stats.kinds["arrow_function"], 1);
+        assert_eq!(stats.kinds["closure"], 1);
+        // The three lines at each end and `<ul>`; the lines with PHP tags are code
+        assert_eq!(stats.lines.markup, 7);
+        assert_eq!(stats.error_nodes, 0);
+    }
+
+    #[test]
+    fn test_analyze_code_bash() {
+        let bash_code = r#"#!/bin/bash
+source ./lib.sh
+
+log() { echo "$*" >&2; }
+
+retry() {
+    local attempts=$1
+    shift
+    while (( attempts-- > 0 )); do
+        "$@" && return 0
+        sleep 1
+    done
+    return 1
+}
+
+for host in "$@"; do
+    case "$host" in
+        *.internal) retry ssh "$host" true ;;
+        *) log "skipping $host" ;;
+    esac
+done
+"#;
+
+        let language = SupportedLanguage::Bash;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, bash_code, "hosts.sh", &language).unwrap();
+
+        assert_eq!(stats.function_count, 2);
+        assert_eq!(stats.class_struct_count, 0);
+        assert_eq!(stats.kinds["function"], 2);
+        assert_eq!(stats.kinds["loop"], 2);
+        assert_eq!(stats.kinds["case"], 1);
+        assert_eq!(stats.kinds["source"], 1);
+        // retry: while and `&&`; top level: for and one non-default case item
+        let complexities: Vec<_> = stats.functions.iter().map(|f| f.complexity).collect();
+        assert_eq!(complexities, vec![1, 3]);
+        assert_eq!(stats.script_complexity, 5);
+        assert_eq!(stats.error_nodes, 0);
+    }
+
+    #[test]
+    fn test_analyze_code_sql() {
+        let sql_code = r#"-- Create the orders table
+CREATE TABLE orders (
+    id integer PRIMARY KEY,
+    customer_id integer NOT NULL,
+    total numeric
+);
+
+/* Backfill from the legacy table */
+WITH recent AS (
+    SELECT * FROM legacy_orders WHERE created_at > '2024-01-01'
+), big AS (
+    SELECT * FROM recent WHERE total > 100
+)
+INSERT INTO orders (id, customer_id, total)
+SELECT id, customer_id, total FROM big;
+
+UPDATE orders SET total = 0 WHERE total IS NULL;
+SELECT count(*) FROM orders;
+DELETE FROM legacy_orders;
+"#;
+
+        let language = SupportedLanguage::Sql;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, sql_code, "0042_orders.sql", &language).unwrap();
+
+        assert_eq!(stats.function_count, 0);
+        assert_eq!(stats.class_struct_count, 0);
+        assert_eq!(stats.kinds["ddl"], 1);
+        assert_eq!(stats.kinds["insert"], 1);
+        assert_eq!(stats.kinds["update"], 1);
+        assert_eq!(stats.kinds["delete"], 1);
+        // The SELECTs inside the CTEs belong to the INSERT
+        assert_eq!(stats.kinds["select"], 1);
+        assert_eq!(stats.kinds["cte"], 2);
+        assert_eq!(stats.lines.comment, 2);
+
+        let longest: Vec<_> = stats
+            .longest_statements(2)
+            .iter()
+            .map(|s| (s.kind.as_str(), s.start_line, s.line_count(), s.ctes))
+            .collect();
+        assert_eq!(longest, vec![("insert", 9, 7, 2), ("ddl", 2, 5, 0)]);
+        assert_eq!(stats.error_nodes, 0);
+    }
+
+    #[test]
+    fn test_analyze_code_dockerfile() {
+        let dockerfile = r#"# syntax=docker/dockerfile:1
+ARG GO_VERSION=1.22
+FROM golang:${GO_VERSION} AS build
+WORKDIR /src
+COPY go.mod go.sum ./
+RUN go mod download
+COPY . .
+RUN go build -o /out/app ./cmd/app
+
+FROM gcr.io/distroless/static
+COPY --from=build /out/app /app
+ONBUILD RUN echo never
+USER nonroot
+ENTRYPOINT ["/app"]
+"#;
+
+        let language = SupportedLanguage::Dockerfile;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, dockerfile, "Dockerfile", &language).unwrap();
+
+        assert_eq!(stats.function_count, 0);
+        assert_eq!(stats.class_struct_count, 0);
+        // The RUN under ONBUILD is not one of this image's steps
+        let kinds: Vec<_> = stats
+            .kinds
+            .iter()
+            .map(|(kind, count)| (kind.as_str(), *count))
+            .collect();
+        assert_eq!(
+            kinds,
+            vec![
+                ("arg", 1),
+                ("copy", 3),
+                ("entrypoint", 1),
+                ("from", 2),
+                ("onbuild", 1),
+                ("run", 2),
+                ("user", 1),
+                ("workdir", 1),
+            ]
+        );
+        assert_eq!(stats.lines.comment, 1);
+        assert_eq!(stats.error_nodes, 0);
+    }
+
+    #[test]
+    fn test_analyze_code_make() {
+        let makefile = "\
+CC ?= cc
+include config.mk
+
+.PHONY: all clean
+
+all: app
+
+app: main.o util.o
+ifeq ($(DEBUG),1)
+\t$(CC) -g -o $@ $^
+else
+\t$(CC) -O2 -o $@ $^
+endif
+
+%.o: %.c
+\t$(CC) $(if $(DEBUG),-g) -c $<
+
+clean:
+\trm -f app *.o
+";
+
+        let language = SupportedLanguage::Make;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, makefile, "Makefile", &language).unwrap();
+
+        assert_eq!(stats.function_count, 5);
+        assert_eq!(stats.kinds["rule"], 5);
+        assert_eq!(stats.kinds["target"], 4);
+        assert_eq!(stats.kinds["phony"], 2);
+        assert_eq!(stats.kinds["variable"], 1);
+        assert_eq!(stats.kinds["include"], 1);
+        let rules: Vec<_> = stats
+            .functions
+            .iter()
+            .map(|f| (f.name.as_str(), f.complexity))
+            .collect();
+        assert_eq!(
+            rules,
+            vec![
+                (".PHONY", 1),
+                ("all", 1),
+                ("app", 2),
+                ("%.o", 2),
+                ("clean", 1)
+            ]
+        );
+        assert_eq!(stats.error_nodes, 0);
+    }
+
+    #[test]
+    fn test_analyze_code_protobuf() {
+        let proto = r#"syntax = "proto3";
+
+package shop.v1;
+
+message Order {
+  string id = 1;
+  map<string, int32> quantities = 2;
+  oneof payment {
+    string card = 3;
+    string voucher = 4;
+  }
+
+  message Line {
+    string sku = 1;
+  }
+}
+
+enum Status {
+  STATUS_UNSPECIFIED = 0;
+  STATUS_PAID = 1;
+}
+
+service Orders {
+  rpc Place(Order) returns (Order);
+}
+"#;
+
+        let language = SupportedLanguage::Protobuf;
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, proto, "orders.proto", &language).unwrap();
+
+        assert_eq!(stats.function_count, 1);
+        assert_eq!(stats.class_struct_count, 3);
+        assert_eq!(stats.kinds["message"], 2);
+        assert_eq!(stats.kinds["field"], 5);
+        assert_eq!(stats.kinds["oneof"], 1);
+        assert_eq!(stats.kinds["enum_value"], 2);
+        assert_eq!(stats.kinds["service"], 1);
+        let types: Vec<_> = stats.types.iter().map(|t| t.name.as_str()).collect();
+        assert_eq!(types, vec!["Order", "Order.Line", "Status"]);
+        assert_eq!(stats.functions[0].qualified_name, "Orders.Place");
+        assert_eq!(stats.services.len(), 1);
+        assert_eq!(stats.services[0].name, "shop.v1.Orders");
+    }
+
+    #[test]
+    fn test_is_make_special_target() {
+        assert!(is_make_special_target(".PHONY"));
+        assert!(is_make_special_target(".DELETE_ON_ERROR"));
+        assert!(!is_make_special_target(".o"));
+        assert!(!is_make_special_target("."));
+        assert!(!is_make_special_target("build"));
+        assert!(!is_make_special_target("$(BIN)"));
+    }
 }
@@ -0,0 +1,593 @@
+//! Custom metrics computed by external programs for `--plugins`.
+//!
+//! Plugins are declared in the configuration file, one `[[plugin]]` table
+//! each, and only run when `--plugins` is given, so that analyzing a
+//! checked-out repository never runs commands from its configuration on its
+//! own:
+//!
+//! ```toml
+//! [[plugin]]
+//! name = "team"
+//! command = ["python3", "tools/metrics.py"]   # run in the config's directory
+//! languages = ["go", "python"]                # all languages if left out
+//! tree = "sexp"                               # or "none" for the source only
+//! ```
+//!
+//! Each plugin is started once per run and speaks line-delimited JSON: for
+//! every parsed file in one of its languages it is sent one request line
+//!
+//! ```json
+//! {"version":1,"path":"src/store.go","language":"Go","source":"package store\n...","tree":"(source_file ...)"}
+//! ```
+//!
+//! and answers with one line, either `{"metrics": {"name": 1.5, ...}}` or
+//! `{"error": "message"}`. Metrics are reported as `<plugin>.<name>` and
+//! added up over files in the totals, so plugins should return counts rather
+//! than ratios. A plugin that answers with an error, or with a line that is
+//! not such a response, adds the message to the file's `plugin_errors`
+//! instead of metrics; one that exits is not restarted, and the remaining
+//! files record that it exited. A plugin that doesn't answer within the
+//! parse timeout, or while the analysis is interrupted, is killed and
+//! treated as exited.
+//!
+//! Requests of parallel workers are sent to a plugin one at a time. Cached
+//! results depend on the plugins' commands and on the size and modification
+//! time of their program and of the files named in their arguments, so
+//! editing a plugin script invalidates them.
+
+use crate::error::{CodeStatsError, Result};
+use crate::language::SupportedLanguage;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::fs;
+use std::io::{BufRead, BufReader, Write};
+use std::path::{Path, PathBuf};
+use std::process::{Child, ChildStdin, ChildStdout, Command, Stdio};
+use std::sync::Mutex;
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::mpsc::{self, Receiver, RecvTimeoutError};
+use std::thread;
+use std::time::{Duration, Instant, UNIX_EPOCH};
+use tree_sitter::Node;
+
+/// Version of the request format, sent with every request.
+const PROTOCOL_VERSION: u32 = 1;
+
+/// How often a plugin that hasn't answered yet checks for cancellation.
+const POLL_INTERVAL: Duration = Duration::from_millis(50);
+
+/// How the syntax tree is sent to a plugin.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub(crate) enum TreeFormat {
+    /// The tree as an S-expression of named nodes, as `Node::to_sexp` prints it
+    #[default]
+    Sexp,
+    /// No tree, only the source
+    None,
+}
+
+/// A plugin as written in a `[[plugin]]` table of the configuration file.
+#[derive(Debug, Clone, PartialEq, Eq, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub(crate) struct PluginDefinition {
+    /// Prefix of the plugin's metric names
+    pub name: String,
+    /// Program and arguments, run in the configuration file's directory
+    pub command: Vec<String>,
+    /// Languages whose files are sent; every language if empty
+    #[serde(default)]
+    pub languages: Vec<String>,
+    #[serde(default)]
+    pub tree: TreeFormat,
+}
+
+/// One line sent to a plugin.
+#[derive(Serialize)]
+struct Request<'a> {
+    version: u32,
+    path: &'a str,
+    language: &'a str,
+    source: &'a str,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    tree: Option<String>,
+}
+
+/// One line received from a plugin.
+#[derive(Deserialize)]
+#[serde(deny_unknown_fields)]
+struct Response {
+    #[serde(default)]
+    metrics: BTreeMap<String, f64>,
+    error: Option<String>,
+}
+
+/// A running plugin process.
+#[derive(Debug)]
+struct Process {
+    child: Child,
+    stdin: Option<ChildStdin>,
+    /// Lines the plugin writes, read on a thread of their own so that
+    /// waiting for an answer can give up; disconnected once stdout closes
+    answers: Receiver<String>,
+}
+
+impl Process {
+    /// Starts reading the lines of a plugin's stdout.
+    fn new(child: Child, stdin: ChildStdin, stdout: ChildStdout) -> Self {
+        let (sender, answers) = mpsc::channel();
+        thread::spawn(move || {
+            let mut stdout = BufReader::new(stdout);
+            loop {
+                let mut line = String::new();
+                if !matches!(stdout.read_line(&mut line), Ok(1..)) || sender.send(line).is_err() {
+                    break;
+                }
+            }
+        });
+        Self {
+            child,
+            stdin: Some(stdin),
+            answers,
+        }
+    }
+}
+
+impl Drop for Process {
+    fn drop(&mut self) {
+        // Closing stdin tells the plugin there are no more files
+        self.stdin.take();
+        let _ = self.child.wait();
+    }
+}
+
+/// A started plugin.
+#[derive(Debug)]
+struct Plugin {
+    name: String,
+    /// Languages whose files are sent; every language if empty
+    languages: Vec<SupportedLanguage>,
+    tree: TreeFormat,
+    /// `None` once the plugin has exited
+    process: Mutex<Option<Process>>,
+}
+
+impl Plugin {
+    /// Sends one request and waits for the answer.
+    ///
+    /// # Arguments
+    ///
+    /// * `request` - The request to send
+    /// * `timeout` - How long to wait for the answer; no limit if `None`
+    /// * `cancelled` - Stops waiting once set
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(metrics)` - The metrics of the file, by unprefixed name
+    /// * `Err(message)` - The plugin answered with an error or an invalid
+    ///   line, or it exited; or it was killed because it didn't answer in
+    ///   time or the analysis was cancelled
+    fn request(
+        &self,
+        request: &Request,
+        timeout: Option<Duration>,
+        cancelled: Option<&AtomicBool>,
+    ) -> std::result::Result<BTreeMap<String, f64>, String> {
+        let mut process = self.process.lock().unwrap_or_else(|e| e.into_inner());
+        let Some(running) = process.as_mut() else {
+            return Err("exited".to_string());
+        };
+        let mut line = serde_json::to_string(request).map_err(|e| e.to_string())?;
+        line.push('\n');
+        let sent = running.stdin.as_mut().map(|stdin| {
+            stdin
+                .write_all(line.as_bytes())
+                .and_then(|()| stdin.flush())
+        });
+        if !matches!(sent, Some(Ok(()))) {
+            // The process is reaped when it is dropped
+            *process = None;
+            return Err("exited".to_string());
+        }
+
+        let deadline = timeout.map(|timeout| Instant::now() + timeout);
+        let answer = loop {
+            let stopped = if cancelled.is_some_and(|flag| flag.load(Ordering::Relaxed)) {
+                Some("killed: the analysis was cancelled".to_string())
+            } else if deadline.is_some_and(|deadline| Instant::now() >= deadline) {
+                Some(format!(
+                    "killed: no answer within {:?}",
+                    timeout.unwrap_or_default()
+                ))
+            } else {
+                None
+            };
+            if let Some(message) = stopped {
+                let _ = running.child.kill();
+                *process = None;
+                return Err(message);
+            }
+            let wait = deadline.map_or(POLL_INTERVAL, |deadline| {
+                deadline
+                    .saturating_duration_since(Instant::now())
+                    .min(POLL_INTERVAL)
+            });
+            match running.answers.recv_timeout(wait) {
+                Ok(answer) => break answer,
+                Err(RecvTimeoutError::Timeout) => {}
+                Err(RecvTimeoutError::Disconnected) => {
+                    *process = None;
+                    return Err("exited".to_string());
+                }
+            }
+        };
+
+        let response: Response = serde_json::from_str(&answer)
+            .map_err(|e| format!("invalid response: {e}: {}", answer.trim_end()))?;
+        match response.error {
+            Some(error) => Err(error),
+            None => Ok(response.metrics),
+        }
+    }
+}
+
+/// The plugins of a run.
+#[derive(Debug, Default)]
+pub(crate) struct PluginSet {
+    plugins: Vec<Plugin>,
+    /// Names and commands of the plugins and stamps of the files they run,
+    /// part of the cache key
+    fingerprint: String,
+}
+
+impl PluginSet {
+    /// Starts the plugins of a configuration file.
+    ///
+    /// # Arguments
+    ///
+    /// * `definitions` - The `[[plugin]]` tables
+    /// * `base_dir` - Directory the commands are run in
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(PluginSet)` - Every plugin was started
+    /// * `Err(ConfigError)` - A plugin has no command, names an unknown
+    ///   language, or reuses a name
+    /// * `Err(PluginError)` - A command could not be started
+    pub(crate) fn start(definitions: &[PluginDefinition], base_dir: &Path) -> Result<Self> {
+        let mut set = Self::default();
+        for (index, definition) in definitions.iter().enumerate() {
+            let invalid = |message: String| {
+                CodeStatsError::ConfigError(format!("plugin '{}': {message}", definition.name))
+            };
+            if definitions[..index]
+                .iter()
+                .any(|earlier| earlier.name == definition.name)
+            {
+                return Err(invalid("defined more than once".to_string()));
+            }
+            let Some((program, args)) = definition.command.split_first() else {
+                return Err(invalid("`command` is empty".to_string()));
+            };
+            let languages = definition
+                .languages
+                .iter()
+                .map(|name| {
+                    SupportedLanguage::from_name(name)
+                        .ok_or_else(|| invalid(format!("unknown language '{name}'")))
+                })
+                .collect::<Result<Vec<_>>>()?;
+
+            let mut child = Command::new(program)
+                .args(args)
+                .current_dir(base_dir)
+                .stdin(Stdio::piped())
+                .stdout(Stdio::piped())
+                .spawn()
+                .map_err(|e| {
+                    CodeStatsError::PluginError(format!(
+                        "failed to start '{}' ({program}): {e}",
+                        definition.name
+                    ))
+                })?;
+            let (Some(stdin), Some(stdout)) = (child.stdin.take(), child.stdout.take()) else {
+                unreachable!("stdin and stdout are piped");
+            };
+            set.plugins.push(Plugin {
+                name: definition.name.clone(),
+                languages,
+                tree: definition.tree,
+                process: Mutex::new(Some(Process::new(child, stdin, stdout))),
+            });
+            set.fingerprint.push_str(&format!(
+                "{}={}{};",
+                definition.name,
+                definition.command.join(" "),
+                command_stamp(&definition.command, base_dir)
+            ));
+        }
+        Ok(set)
+    }
+
+    /// Names and commands of the plugins and stamps of the files they run,
+    /// which change the results of the files they are run on.
+    pub(crate) fn fingerprint(&self) -> &str {
+        &self.fingerprint
+    }
+
+    /// Returns true if a plugin is run on files in `language`.
+    pub(crate) fn applies_to(&self, language: SupportedLanguage) -> bool {
+        self.plugins
+            .iter()
+            .any(|plugin| plugin.languages.is_empty() || plugin.languages.contains(&language))
+    }
+
+    /// Runs the plugins for a file's language on it.
+    ///
+    /// # Arguments
+    ///
+    /// * `path` - Path of the file, as sent to the plugins
+    /// * `language` - The programming language of the source code
+    /// * `root` - Root node of the tree parsed from `source_code`
+    /// * `source_code` - The source code of the file
+    /// * `timeout` - How long each plugin may take to answer
+    /// * `cancelled` - Kills the plugin being waited for once set
+    ///
+    /// # Returns
+    ///
+    /// The metrics, named `<plugin>.<metric>`, and a `<plugin>: <message>`
+    /// entry for each plugin that failed on the file
+    pub(crate) fn measure(
+        &self,
+        path: &str,
+        language: SupportedLanguage,
+        root: &Node,
+        source_code: &str,
+        timeout: Option<Duration>,
+        cancelled: Option<&AtomicBool>,
+    ) -> (BTreeMap<String, f64>, Vec<String>) {
+        let mut metrics = BTreeMap::new();
+        let mut errors = Vec::new();
+        let mut sexp = None;
+        for plugin in &self.plugins {
+            if !plugin.languages.is_empty() && !plugin.languages.contains(&language) {
+                continue;
+            }
+            let tree = match plugin.tree {
+                TreeFormat::Sexp => Some(sexp.get_or_insert_with(|| root.to_sexp()).clone()),
+                TreeFormat::None => None,
+            };
+            let request = Request {
+                version: PROTOCOL_VERSION,
+                path,
+                language: language.name(),
+                source: source_code,
+                tree,
+            };
+            match plugin.request(&request, timeout, cancelled) {
+                Ok(values) => metrics.extend(
+                    values
+                        .into_iter()
+                        .map(|(name, value)| (format!("{}.{name}", plugin.name), value)),
+                ),
+                Err(message) => errors.push(format!("{}: {message}", plugin.name)),
+            }
+        }
+        (metrics, errors)
+    }
+}
+
+/// Size and modification time of the program of a command and of the files
+/// named in its arguments, each prefixed with its position in the command.
+///
+/// A program without a directory is looked up in `PATH`; other words are
+/// resolved against `base_dir` and skipped unless they name a file.
+fn command_stamp(command: &[String], base_dir: &Path) -> String {
+    let mut stamp = String::new();
+    for (index, word) in command.iter().enumerate() {
+        let path = Path::new(word);
+        let file = if index == 0 && path.components().count() == 1 {
+            find_program(path)
+        } else {
+            Some(base_dir.join(path))
+        };
+        let Some(metadata) = file
+            .and_then(|file| fs::metadata(file).ok())
+            .filter(|metadata| metadata.is_file())
+        else {
+            continue;
+        };
+        let modified = metadata
+            .modified()
+            .ok()
+            .and_then(|modified| modified.duration_since(UNIX_EPOCH).ok())
+            .map_or(0, |elapsed| elapsed.as_nanos());
+        stamp.push_str(&format!(" @{index}:{}:{modified}", metadata.len()));
+    }
+    stamp
+}
+
+/// Finds a program in the directories of `PATH`.
+fn find_program(program: &Path) -> Option<PathBuf> {
+    std::env::split_paths(&std::env::var_os("PATH")?)
+        .map(|dir| dir.join(program))
+        .find(|file| file.is_file())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn shell_plugin(name: &str, script: &str) -> PluginDefinition {
+        PluginDefinition {
+            name: name.to_string(),
+            command: vec!["sh".to_string(), "-c".to_string(), script.to_string()],
+            languages: Vec::new(),
+            tree: TreeFormat::None,
+        }
+    }
+
+    fn request<'a>(path: &'a str, source: &'a str) -> Request<'a> {
+        Request {
+            version: PROTOCOL_VERSION,
+            path,
+            language: "Go",
+            source,
+            tree: None,
+        }
+    }
+
+    #[test]
+    fn test_plugin_definition_defaults() {
+        let table: toml::Table = toml::from_str(
+            r#"
+[[plugin]]
+name = "team"
+command = ["python3", "metrics.py"]
+"#,
+        )
+        .unwrap();
+        let definition: PluginDefinition = table["plugin"][0].clone().try_into().unwrap();
+        assert_eq!(definition.tree, TreeFormat::Sexp);
+        assert!(definition.languages.is_empty());
+    }
+
+    #[test]
+    fn test_start_rejects_invalid_plugins() {
+        let error = |definitions: &[PluginDefinition]| {
+            PluginSet::start(definitions, Path::new("."))
+                .unwrap_err()
+                .to_string()
+        };
+        let mut empty = shell_plugin("a", "cat");
+        empty.command.clear();
+        assert!(error(&[empty]).contains("plugin 'a': `command` is empty"));
+
+        let mut cobol = shell_plugin("b", "cat");
+        cobol.languages = vec!["cobol".to_string()];
+        assert!(error(&[cobol]).contains("unknown language 'cobol'"));
+
+        let twice = shell_plugin("c", "cat");
+        assert!(error(&[twice.clone(), twice]).contains("plugin 'c': defined more than once"));
+
+        let mut missing = shell_plugin("d", "");
+        missing.command = vec!["codestats-no-such-plugin".to_string()];
+        assert!(error(&[missing]).starts_with("Plugin error: failed to start 'd'"));
+    }
+
+    #[test]
+    fn test_plugin_protocol() {
+        // Answers every request with the length of its line, then fails on
+        // the third and exits on the fourth
+        let script = r#"n=0
+while read -r line; do
+  n=$((n + 1))
+  case $n in
+    3) echo '{"error": "unsupported construct"}' ;;
+    4) exit 0 ;;
+    *) echo "{\"metrics\": {\"requests\": $n, \"bytes\": ${#line}}}" ;;
+  esac
+done"#;
+        let set = PluginSet::start(&[shell_plugin("team", script)], Path::new(".")).unwrap();
+        let plugin = &set.plugins[0];
+
+        let first = plugin
+            .request(&request("a.go", "package a\n"), None, None)
+            .unwrap();
+        assert_eq!(first["requests"], 1.0);
+        assert!(first["bytes"] > 0.0);
+        let second = plugin
+            .request(&request("b.go", "package b\n"), None, None)
+            .unwrap();
+        assert_eq!(second["requests"], 2.0);
+        assert_eq!(
+            plugin.request(&request("c.go", ""), None, None),
+            Err("unsupported construct".to_string())
+        );
+        assert_eq!(
+            plugin.request(&request("d.go", ""), None, None),
+            Err("exited".to_string())
+        );
+        assert_eq!(
+            plugin.request(&request("e.go", ""), None, None),
+            Err("exited".to_string())
+        );
+        assert!(set.fingerprint().starts_with("team=sh -c "));
+    }
+
+    #[test]
+    fn test_unanswered_request_kills_plugin() {
+        let silent = "while read -r line; do sleep 5; done";
+        let set = PluginSet::start(&[shell_plugin("slow", silent)], Path::new(".")).unwrap();
+        let plugin = &set.plugins[0];
+        let started = Instant::now();
+        let error = plugin
+            .request(&request("a.go", ""), Some(Duration::from_millis(100)), None)
+            .unwrap_err();
+        assert_eq!(error, "killed: no answer within 100ms");
+        assert!(started.elapsed() < Duration::from_secs(2));
+        assert_eq!(
+            plugin.request(&request("b.go", ""), None, None),
+            Err("exited".to_string())
+        );
+
+        let set = PluginSet::start(&[shell_plugin("slow", silent)], Path::new(".")).unwrap();
+        let cancelled = AtomicBool::new(true);
+        assert_eq!(
+            set.plugins[0].request(&request("a.go", ""), None, Some(&cancelled)),
+            Err("killed: the analysis was cancelled".to_string())
+        );
+    }
+
+    #[test]
+    fn test_fingerprint_stamps_plugin_files() {
+        let dir = tempfile::tempdir().unwrap();
+        fs::write(dir.path().join("metrics.sh"), "cat\n").unwrap();
+        let plugin = PluginDefinition {
+            command: vec!["sh".to_string(), "metrics.sh".to_string()],
+            ..shell_plugin("team", "")
+        };
+        let fingerprint = || {
+            PluginSet::start(std::slice::from_ref(&plugin), dir.path())
+                .unwrap()
+                .fingerprint()
+                .to_string()
+        };
+        let before = fingerprint();
+        assert!(before.starts_with("team=sh metrics.sh @0:"));
+        assert!(before.contains(" @1:4:"));
+
+        fs::write(dir.path().join("metrics.sh"), "cat; cat\n").unwrap();
+        let after = fingerprint();
+        assert_ne!(before, after);
+        assert!(after.contains(" @1:9:"));
+        assert_eq!(command_stamp(&["-c".to_string()], dir.path()), "");
+    }
+
+    #[test]
+    fn test_invalid_response() {
+        let set = PluginSet::start(
+            &[shell_plugin(
+                "echo",
+                "while read -r line; do echo nope; done",
+            )],
+            Path::new("."),
+        )
+        .unwrap();
+        let error = set.plugins[0]
+            .request(&request("a.go", ""), None, None)
+            .unwrap_err();
+        assert!(error.starts_with("invalid response: "));
+        assert!(error.ends_with(": nope"));
+    }
+
+    #[test]
+    fn test_applies_to() {
+        let mut go = shell_plugin("go", "cat");
+        go.languages = vec!["go".to_string()];
+        let set = PluginSet::start(&[go], Path::new(".")).unwrap();
+        assert!(set.applies_to(SupportedLanguage::Go));
+        assert!(!set.applies_to(SupportedLanguage::Rust));
+        assert!(!PluginSet::default().applies_to(SupportedLanguage::Go));
+    }
+}
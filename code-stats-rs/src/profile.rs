@@ -0,0 +1,203 @@
+//! Timing and resource telemetry of a run for `--profile`.
+//!
+//! The analyzer records, for every file it reads from disk, how long parsing,
+//! the custom queries, and the whole analysis took and how many bytes the file
+//! has. Times of files analyzed in parallel add up, so the per-language totals
+//! can exceed the wall-clock time of the run. A cache hit is recorded as well,
+//! with no parse or query time.
+//!
+//! Peak memory is the high-water mark of the process's resident set size as
+//! reported by Linux in `/proc/self/status`; other platforms don't report it.
+
+use crate::language::SupportedLanguage;
+use std::collections::BTreeMap;
+use std::path::PathBuf;
+use std::sync::Mutex;
+use std::time::Duration;
+
+/// Time spent in the phases of analyzing one file.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub(crate) struct Timing {
+    /// Time tree-sitter took to parse the file, code blocks included
+    pub parse: Duration,
+    /// Time the custom and extractor queries took
+    pub queries: Duration,
+    /// Whether the statistics came from the result cache
+    pub cached: bool,
+}
+
+/// Telemetry of a single analyzed file.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct FileProfile {
+    pub path: PathBuf,
+    pub language: SupportedLanguage,
+    /// Size of the file on disk
+    pub bytes: u64,
+    pub timing: Timing,
+    /// Time from reading the file to its finished statistics
+    pub total: Duration,
+}
+
+/// Telemetry of the files of one language.
+#[derive(Debug, Default, Clone, PartialEq, Eq)]
+pub(crate) struct LanguageProfile {
+    pub files: usize,
+    /// Files whose statistics came from the cache
+    pub cached: usize,
+    pub bytes: u64,
+    pub parse: Duration,
+    pub queries: Duration,
+    pub total: Duration,
+}
+
+/// Telemetry of a run, see `Profiler::report`.
+#[derive(Debug, Clone, PartialEq)]
+pub(crate) struct ProfileReport {
+    /// Wall-clock time of the run
+    pub wall: Duration,
+    /// Totals of all languages
+    pub total: LanguageProfile,
+    pub languages: BTreeMap<SupportedLanguage, LanguageProfile>,
+    /// The files that took longest, slowest first
+    pub slowest: Vec<FileProfile>,
+    /// Peak resident memory of the process in bytes, if the platform reports it
+    pub peak_memory: Option<u64>,
+}
+
+/// Collects the telemetry of every analyzed file.
+///
+/// Shared by the workers of a parallel analysis like the result cache, so
+/// records may arrive in any order; `report` sorts them.
+#[derive(Debug, Default)]
+pub(crate) struct Profiler {
+    files: Mutex<Vec<FileProfile>>,
+}
+
+impl Profiler {
+    /// Creates a profiler with no records.
+    pub(crate) fn new() -> Self {
+        Self::default()
+    }
+
+    /// Records the telemetry of an analyzed file.
+    pub(crate) fn record(&self, file: FileProfile) {
+        self.files
+            .lock()
+            .expect("profiler lock poisoned")
+            .push(file);
+    }
+
+    /// Summarizes the records per language.
+    ///
+    /// # Arguments
+    ///
+    /// * `wall` - Wall-clock time of the run
+    /// * `slowest` - Number of files to list as the slowest
+    pub(crate) fn report(&self, wall: Duration, slowest: usize) -> ProfileReport {
+        let mut files = self.files.lock().expect("profiler lock poisoned").clone();
+        let mut total = LanguageProfile::default();
+        let mut languages: BTreeMap<SupportedLanguage, LanguageProfile> = BTreeMap::new();
+        for file in &files {
+            total.add(file);
+            languages.entry(file.language).or_default().add(file);
+        }
+
+        files.sort_by(|a, b| b.total.cmp(&a.total).then_with(|| a.path.cmp(&b.path)));
+        files.truncate(slowest);
+        ProfileReport {
+            wall,
+            total,
+            languages,
+            slowest: files,
+            peak_memory: peak_memory(),
+        }
+    }
+}
+
+impl LanguageProfile {
+    /// Adds the telemetry of a file.
+    fn add(&mut self, file: &FileProfile) {
+        self.files += 1;
+        self.cached += usize::from(file.timing.cached);
+        self.bytes += file.bytes;
+        self.parse += file.timing.parse;
+        self.queries += file.timing.queries;
+        self.total += file.total;
+    }
+}
+
+/// Returns the peak resident memory of the process in bytes, from the
+/// `VmHWM` line of `/proc/self/status`.
+#[cfg(target_os = "linux")]
+fn peak_memory() -> Option<u64> {
+    let status = std::fs::read_to_string("/proc/self/status").ok()?;
+    parse_peak_memory(&status)
+}
+
+/// Returns `None`: peak memory is only read on Linux.
+#[cfg(not(target_os = "linux"))]
+fn peak_memory() -> Option<u64> {
+    None
+}
+
+/// Reads the `VmHWM:   1234 kB` line of a `/proc/<pid>/status` file.
+#[cfg_attr(not(target_os = "linux"), allow(dead_code))]
+fn parse_peak_memory(status: &str) -> Option<u64> {
+    let line = status.lines().find(|line| line.starts_with("VmHWM:"))?;
+    let kilobytes: u64 = line
+        .trim_start_matches("VmHWM:")
+        .trim()
+        .trim_end_matches("kB")
+        .trim()
+        .parse()
+        .ok()?;
+    Some(kilobytes * 1024)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn file(path: &str, language: SupportedLanguage, millis: u64, cached: bool) -> FileProfile {
+        FileProfile {
+            path: PathBuf::from(path),
+            language,
+            bytes: 1000,
+            timing: Timing {
+                parse: Duration::from_millis(millis / 2),
+                queries: Duration::from_millis(millis / 10),
+                cached,
+            },
+            total: Duration::from_millis(millis),
+        }
+    }
+
+    #[test]
+    fn test_report_totals_languages_and_ranks_files() {
+        let profiler = Profiler::new();
+        profiler.record(file("b.rs", SupportedLanguage::Rust, 40, false));
+        profiler.record(file("a.go", SupportedLanguage::Go, 100, false));
+        profiler.record(file("a.rs", SupportedLanguage::Rust, 40, true));
+
+        let report = profiler.report(Duration::from_millis(120), 2);
+        assert_eq!(report.total.files, 3);
+        assert_eq!(report.total.bytes, 3000);
+        assert_eq!(report.total.total, Duration::from_millis(180));
+
+        let rust = &report.languages[&SupportedLanguage::Rust];
+        assert_eq!((rust.files, rust.cached), (2, 1));
+        assert_eq!(rust.parse, Duration::from_millis(40));
+        assert_eq!(rust.queries, Duration::from_millis(8));
+
+        // Slowest first, ties by path
+        let slowest: Vec<_> = report.slowest.iter().map(|f| f.path.clone()).collect();
+        assert_eq!(slowest, [PathBuf::from("a.go"), PathBuf::from("a.rs")]);
+    }
+
+    #[test]
+    fn test_parse_peak_memory() {
+        let status = "Name:\tcode-stats-rs\nVmPeak:\t  200000 kB\nVmHWM:\t   51200 kB\n";
+        assert_eq!(parse_peak_memory(status), Some(51200 * 1024));
+        assert_eq!(parse_peak_memory("Name:\tcode-stats-rs\n"), None);
+    }
+}
@@ -0,0 +1,175 @@
+//! Prometheus metrics for `--format prometheus` and the `serve` subcommand.
+//!
+//! The metrics are gauges in the Prometheus text exposition format (version
+//! 0.0.4), so the output can be written to a node_exporter textfile
+//! collector directory or scraped from `serve` (see `server`). Per-language metrics carry a
+//! `language` label; repository-wide ones have no labels.
+
+use crate::stats::{DirectoryStats, Thresholds};
+
+/// Content type of the text exposition format.
+pub(crate) const CONTENT_TYPE: &str = "text/plain; version=0.0.4; charset=utf-8";
+
+/// Formats directory statistics as Prometheus gauges.
+///
+/// # Arguments
+///
+/// * `stats` - Directory statistics to export
+/// * `thresholds` - Limits used to count complexity offenders
+///
+/// # Returns
+///
+/// The exposition text, ending in a line break
+pub(crate) fn format_prometheus(stats: &DirectoryStats, thresholds: &Thresholds) -> String {
+    let mut languages: Vec<_> = stats.total_by_language.iter().collect();
+    languages.sort_by_key(|(language, _)| language.name());
+
+    let mut output = String::new();
+    let mut per_language = |name: &str, help: &str, value: &dyn Fn(usize) -> usize| {
+        gauge_header(&mut output, name, help);
+        for (index, (language, _)) in languages.iter().enumerate() {
+            output.push_str(&format!(
+                "{name}{{language=\"{}\"}} {}\n",
+                escape_label(language.name()),
+                value(index)
+            ));
+        }
+    };
+    per_language("codestats_files", "Number of analyzed files.", &|i| {
+        languages[i].1.file_count
+    });
+    per_language("codestats_loc", "Lines of code.", &|i| {
+        languages[i].1.lines.code
+    });
+    per_language("codestats_comment_lines", "Lines of comments.", &|i| {
+        languages[i].1.lines.comment
+    });
+    per_language("codestats_blank_lines", "Blank lines.", &|i| {
+        languages[i].1.lines.blank
+    });
+    per_language(
+        "codestats_functions_total",
+        "Number of functions and methods.",
+        &|i| languages[i].1.function_count,
+    );
+    per_language(
+        "codestats_classes_total",
+        "Number of classes, structs, and other types.",
+        &|i| languages[i].1.class_struct_count,
+    );
+
+    let mut gauge = |name: &str, help: &str, value: String| {
+        gauge_header(&mut output, name, help);
+        output.push_str(&format!("{name} {value}\n"));
+    };
+    gauge(
+        "codestats_max_complexity",
+        "Highest cyclomatic complexity of any function.",
+        stats.max_complexity().to_string(),
+    );
+    gauge(
+        "codestats_mean_complexity",
+        "Mean cyclomatic complexity across all functions.",
+        stats.mean_complexity().to_string(),
+    );
+    gauge(
+        "codestats_max_cognitive_complexity",
+        "Highest cognitive complexity of any function.",
+        stats
+            .most_cognitive_function()
+            .map_or(0, |f| f.function.cognitive)
+            .to_string(),
+    );
+    gauge(
+        "codestats_complexity_offenders",
+        "Number of functions above the complexity threshold.",
+        stats
+            .complexity_offenders(thresholds.complexity)
+            .len()
+            .to_string(),
+    );
+    gauge(
+        "codestats_complexity_threshold",
+        "Cyclomatic complexity above which a function is an offender.",
+        thresholds.complexity.to_string(),
+    );
+    gauge(
+        "codestats_generated_files",
+        "Number of generated and vendored files.",
+        stats.generated.files.to_string(),
+    );
+    gauge(
+        "codestats_test_files",
+        "Number of test files.",
+        stats.tests.files.to_string(),
+    );
+    gauge(
+        "codestats_llm_tokens",
+        "Estimated LLM tokens of all analyzed files.",
+        stats.total_stats.tokens.llm.to_string(),
+    );
+    output
+}
+
+/// Appends the `# HELP` and `# TYPE` lines of a gauge.
+fn gauge_header(output: &mut String, name: &str, help: &str) {
+    output.push_str(&format!("# HELP {name} {help}\n# TYPE {name} gauge\n"));
+}
+
+/// Escapes a label value as the exposition format requires.
+fn escape_label(value: &str) -> String {
+    value
+        .replace('\\', "\\\\")
+        .replace('"', "\\\"")
+        .replace('\n', "\\n")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::comments::LineStats;
+    use crate::language::SupportedLanguage;
+    use crate::parser::CodeStats;
+    use crate::stats::FileStats;
+    use std::path::PathBuf;
+
+    #[test]
+    fn test_format_prometheus() {
+        let mut stats = DirectoryStats::new();
+        for (path, language, code) in [
+            ("main.rs", SupportedLanguage::Rust, 40),
+            ("lib.rs", SupportedLanguage::Rust, 60),
+            ("main.go", SupportedLanguage::Go, 25),
+        ] {
+            stats.add_file(FileStats {
+                path: PathBuf::from(path),
+                language,
+                stats: CodeStats {
+                    function_count: 2,
+                    lines: LineStats {
+                        code,
+                        ..Default::default()
+                    },
+                    ..Default::default()
+                },
+            });
+        }
+
+        let output = format_prometheus(&stats, &Thresholds::default());
+        assert!(output.contains(
+            "# HELP codestats_loc Lines of code.\n\
+             # TYPE codestats_loc gauge\n\
+             codestats_loc{language=\"Go\"} 25\n\
+             codestats_loc{language=\"Rust\"} 100\n"
+        ));
+        assert!(output.contains("codestats_functions_total{language=\"Rust\"} 4\n"));
+        assert!(output.contains("\ncodestats_max_complexity 0\n"));
+        assert!(output.ends_with('\n'));
+    }
+
+    #[test]
+    fn test_escape_label() {
+        assert_eq!(escape_label("C#"), "C#");
+        assert_eq!(escape_label("a\"b\\c\nd"), "a\\\"b\\\\c\\nd");
+    }
+}
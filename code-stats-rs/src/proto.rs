@@ -0,0 +1,179 @@
+//! Services and RPC methods declared in Protobuf files.
+//!
+//! The inventory lists every service with the package it is declared in and
+//! the request and response types of each method, which makes it usable as
+//! an overview of a gRPC API without reading the `.proto` files.
+
+use crate::parser::child_of_kind;
+use serde::{Deserialize, Serialize};
+use tree_sitter::Node;
+
+/// A service declared in a `.proto` file.
+#[derive(Default, Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct ServiceStats {
+    /// Name qualified by the file's package (e.g. `shop.v1.CartService`)
+    pub name: String,
+    /// 1-based line where the service starts
+    pub start_line: usize,
+    /// RPC methods, in source order
+    pub methods: Vec<RpcStats>,
+}
+
+/// An RPC method of a service.
+#[derive(Default, Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct RpcStats {
+    /// Method name
+    pub name: String,
+    /// Request message type, as written in the file
+    pub request: String,
+    /// Response message type, as written in the file
+    pub response: String,
+    /// True if the client sends a stream of requests
+    #[serde(default, skip_serializing_if = "std::ops::Not::not")]
+    pub client_streaming: bool,
+    /// True if the server sends a stream of responses
+    #[serde(default, skip_serializing_if = "std::ops::Not::not")]
+    pub server_streaming: bool,
+    /// 1-based line where the method is declared
+    pub line: usize,
+}
+
+/// Lists the services of a Protobuf file, in source order.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the tree parsed from `source`
+/// * `source` - The file's contents
+pub(crate) fn proto_services(root: &Node, source: &[u8]) -> Vec<ServiceStats> {
+    let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+
+    let mut cursor = root.walk();
+    let children: Vec<_> = root.named_children(&mut cursor).collect();
+    let package = children
+        .iter()
+        .find(|child| child.kind() == "package")
+        .and_then(|package| child_of_kind(package, "full_ident"))
+        .map(|name| text(&name));
+
+    children
+        .iter()
+        .filter(|child| child.kind() == "service")
+        .map(|service| {
+            let name = child_of_kind(service, "service_name")
+                .map(|name| text(&name))
+                .unwrap_or_default();
+            let mut inner = service.walk();
+            let methods = service
+                .named_children(&mut inner)
+                .filter(|child| child.kind() == "rpc")
+                .map(|rpc| rpc_stats(&rpc, source))
+                .collect();
+            ServiceStats {
+                name: match &package {
+                    Some(package) => format!("{package}.{name}"),
+                    None => name,
+                },
+                start_line: service.start_position().row + 1,
+                methods,
+            }
+        })
+        .collect()
+}
+
+/// Reads the name, message types, and streaming of an `rpc` node.
+///
+/// The request and response are the first and second message types; a
+/// `stream` keyword before `returns` marks the request as streamed, one
+/// after it the response.
+fn rpc_stats(rpc: &Node, source: &[u8]) -> RpcStats {
+    let text = |node: &Node| node.utf8_text(source).unwrap_or_default().to_string();
+    let mut stats = RpcStats {
+        line: rpc.start_position().row + 1,
+        ..RpcStats::default()
+    };
+
+    let mut returns = false;
+    let mut types = 0;
+    let mut cursor = rpc.walk();
+    for child in rpc.children(&mut cursor) {
+        match child.kind() {
+            "rpc_name" => stats.name = text(&child),
+            "returns" => returns = true,
+            "stream" if returns => stats.server_streaming = true,
+            "stream" => stats.client_streaming = true,
+            "message_or_enum_type" => {
+                if types == 0 {
+                    stats.request = text(&child);
+                } else {
+                    stats.response = text(&child);
+                }
+                types += 1;
+            }
+            _ => {}
+        }
+    }
+    stats
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::language::SupportedLanguage;
+    use crate::parser::create_parser;
+
+    fn services(source: &str) -> Vec<ServiceStats> {
+        let tree = create_parser(&SupportedLanguage::Protobuf)
+            .unwrap()
+            .parse(source, None)
+            .unwrap();
+        proto_services(&tree.root_node(), source.as_bytes())
+    }
+
+    #[test]
+    fn test_proto_services() {
+        let source = r#"syntax = "proto3";
+
+package shop.v1;
+
+service CartService {
+  rpc GetCart(GetCartRequest) returns (Cart);
+  rpc WatchCart(GetCartRequest) returns (stream Cart) {
+    option deprecated = true;
+  }
+  rpc Upload(stream Item) returns (google.protobuf.Empty);
+}
+
+service Health {}
+"#;
+        let found = services(source);
+
+        assert_eq!(found.len(), 2);
+        assert_eq!(found[0].name, "shop.v1.CartService");
+        assert_eq!(found[0].start_line, 5);
+        assert_eq!(
+            found[0].methods[0],
+            RpcStats {
+                name: "GetCart".to_string(),
+                request: "GetCartRequest".to_string(),
+                response: "Cart".to_string(),
+                client_streaming: false,
+                server_streaming: false,
+                line: 6,
+            }
+        );
+        assert!(found[0].methods[1].server_streaming);
+        assert!(!found[0].methods[1].client_streaming);
+        assert!(found[0].methods[2].client_streaming);
+        assert_eq!(found[0].methods[2].response, "google.protobuf.Empty");
+        assert_eq!(found[1].name, "shop.v1.Health");
+        assert!(found[1].methods.is_empty());
+    }
+
+    #[test]
+    fn test_proto_services_without_package() {
+        let found =
+            services("syntax = \"proto3\";\nservice Echo { rpc Say(Msg) returns (Msg); }\n");
+        assert_eq!(found.len(), 1);
+        assert_eq!(found[0].name, "Echo");
+    }
+}
@@ -0,0 +1,303 @@
+//! User-defined tree-sitter queries reported as named counters.
+//!
+//! Queries are declared in a TOML file, one `[[query]]` table per counter:
+//!
+//! ```toml
+//! [[query]]
+//! name = "panic_calls"
+//! language = "go"
+//! path = "queries/panic.scm"   # relative to this file
+//!
+//! [[query]]
+//! name = "unwraps"
+//! language = "rust"
+//! query = '(call_expression function: (field_expression field: (field_identifier) @m (#eq? @m "unwrap")))'
+//! ```
+//!
+//! Each counter is the number of matches of its query in a file. Counters that
+//! share a name across languages are added up in the report.
+
+use crate::error::{CodeStatsError, Result};
+use crate::language::{Dialect, SupportedLanguage};
+use serde::Deserialize;
+use sha2::{Digest, Sha256};
+use std::collections::HashMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+use tree_sitter::{Node, Query, QueryCursor, StreamingIterator};
+
+/// Query definitions as written in the configuration file.
+#[derive(Debug, Default, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub(crate) struct QueryConfig {
+    /// One entry per `[[query]]` table
+    #[serde(default, rename = "query")]
+    pub queries: Vec<QueryDefinition>,
+}
+
+/// A single named counter backed by a tree-sitter query.
+#[derive(Debug, Clone, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub(crate) struct QueryDefinition {
+    /// Counter name shown in reports
+    pub name: String,
+    /// Language the query applies to (e.g. `go`, `typescript`)
+    pub language: String,
+    /// Path to a `.scm` file, relative to the configuration file
+    pub path: Option<PathBuf>,
+    /// Inline query source, as an alternative to `path`
+    pub query: Option<String>,
+}
+
+/// A compiled query together with the counter it feeds.
+#[derive(Debug)]
+pub(crate) struct NamedQuery {
+    /// Counter name shown in reports
+    pub name: String,
+    query: Query,
+}
+
+impl NamedQuery {
+    /// Wraps a compiled query as the counter `name`.
+    pub(crate) fn new(name: String, query: Query) -> Self {
+        Self { name, query }
+    }
+
+    /// Counts the matches of this query in the tree rooted at `root`.
+    pub(crate) fn count_matches(&self, root: Node, source: &[u8]) -> usize {
+        let mut cursor = QueryCursor::new();
+        cursor.matches(&self.query, root, source).count()
+    }
+}
+
+/// Compiled custom queries, grouped by the grammar they were compiled for.
+#[derive(Debug, Default)]
+pub(crate) struct QuerySet {
+    queries: HashMap<(SupportedLanguage, Dialect), Vec<NamedQuery>>,
+    fingerprint: String,
+}
+
+impl QuerySet {
+    /// Loads and compiles the queries declared in the TOML file at `path`.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(QuerySet)` - All queries compiled successfully
+    /// * `Err(ConfigError)` - The file is invalid, a `.scm` file is missing,
+    ///   or a query does not compile for its language
+    pub(crate) fn load(path: &Path) -> Result<Self> {
+        let content = fs::read_to_string(path).map_err(|e| {
+            CodeStatsError::ConfigError(format!("Failed to read {}: {e}", path.display()))
+        })?;
+        let config: QueryConfig = toml::from_str(&content)
+            .map_err(|e| CodeStatsError::ConfigError(format!("{}: {e}", path.display())))?;
+
+        let base_dir = path.parent().unwrap_or(Path::new("."));
+        Self::from_definitions(&config.queries, base_dir)
+    }
+
+    /// Compiles query definitions, resolving `.scm` paths against `base_dir`.
+    ///
+    /// TypeScript queries are compiled for both the TypeScript and TSX
+    /// grammars so they apply to `.ts` and `.tsx` files alike.
+    pub(crate) fn from_definitions(
+        definitions: &[QueryDefinition],
+        base_dir: &Path,
+    ) -> Result<Self> {
+        let mut set = Self::default();
+        let mut hasher = Sha256::new();
+
+        for definition in definitions {
+            let invalid = |message: String| {
+                CodeStatsError::ConfigError(format!("query '{}': {message}", definition.name))
+            };
+
+            let language = SupportedLanguage::from_name(&definition.language)
+                .ok_or_else(|| invalid(format!("unknown language '{}'", definition.language)))?;
+
+            let source = match (&definition.path, &definition.query) {
+                (Some(path), None) => {
+                    let path = base_dir.join(path);
+                    fs::read_to_string(&path)
+                        .map_err(|e| invalid(format!("failed to read {}: {e}", path.display())))?
+                }
+                (None, Some(query)) => query.clone(),
+                _ => {
+                    return Err(invalid(
+                        "exactly one of `path` or `query` is required".to_string(),
+                    ));
+                }
+            };
+
+            for &dialect in Dialect::all(language) {
+                let query = Query::new(&language.get_language_with_dialect(dialect), &source)
+                    .map_err(|e| invalid(format!("{e} (line {})", e.row + 1)))?;
+
+                let queries = set.queries.entry((language, dialect)).or_default();
+                if queries.iter().any(|q| q.name == definition.name) {
+                    return Err(invalid(format!(
+                        "defined more than once for {}",
+                        definition.language
+                    )));
+                }
+                queries.push(NamedQuery {
+                    name: definition.name.clone(),
+                    query,
+                });
+            }
+
+            hasher.update(format!("{}\0{language:?}\0{source}\0", definition.name));
+        }
+
+        set.fingerprint = format!("{:x}", hasher.finalize());
+        Ok(set)
+    }
+
+    /// Returns the queries that apply to files of the given language and dialect.
+    pub(crate) fn for_language(
+        &self,
+        language: SupportedLanguage,
+        dialect: Dialect,
+    ) -> &[NamedQuery] {
+        self.queries
+            .get(&(language, dialect))
+            .map_or(&[], Vec::as_slice)
+    }
+
+    /// Stable digest of all query names, languages, and sources.
+    ///
+    /// Used as part of the result cache key so that editing a query
+    /// invalidates cached counts.
+    pub(crate) fn fingerprint(&self) -> &str {
+        &self.fingerprint
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::{analyze_code_with_queries, create_parser};
+    use tempfile::TempDir;
+
+    fn definition(name: &str, language: &str, query: &str) -> QueryDefinition {
+        QueryDefinition {
+            name: name.to_string(),
+            language: language.to_string(),
+            path: None,
+            query: Some(query.to_string()),
+        }
+    }
+
+    #[test]
+    fn test_counts_matches_per_query() {
+        let set = QuerySet::from_definitions(
+            &[
+                definition(
+                    "panic_calls",
+                    "go",
+                    r#"(call_expression function: (identifier) @f (#eq? @f "panic"))"#,
+                ),
+                definition("string_literals", "go", "(interpreted_string_literal) @s"),
+            ],
+            Path::new("."),
+        )
+        .unwrap();
+
+        let source = r#"
+package main
+
+func main() {
+    if broken() {
+        panic("boom")
+    }
+    panic("again")
+}
+"#;
+        let mut parser = create_parser(&SupportedLanguage::Go).unwrap();
+        let stats = analyze_code_with_queries(
+            &mut parser,
+            source,
+            "main.go",
+            &SupportedLanguage::Go,
+            set.for_language(SupportedLanguage::Go, Dialect::Standard),
+        )
+        .unwrap();
+
+        assert_eq!(stats.queries["panic_calls"], 2);
+        assert_eq!(stats.queries["string_literals"], 2);
+        assert!(
+            set.for_language(SupportedLanguage::Rust, Dialect::Standard)
+                .is_empty()
+        );
+    }
+
+    #[test]
+    fn test_load_resolves_scm_paths_relative_to_config() {
+        let temp_dir = TempDir::new().unwrap();
+        fs::create_dir(temp_dir.path().join("queries")).unwrap();
+        fs::write(
+            temp_dir.path().join("queries/generate.scm"),
+            r#"((comment) @c (#match? @c "^//go:generate"))"#,
+        )
+        .unwrap();
+        let config = temp_dir.path().join("queries.toml");
+        fs::write(
+            &config,
+            r#"
+[[query]]
+name = "go_generate"
+language = "go"
+path = "queries/generate.scm"
+
+[[query]]
+name = "tsx_elements"
+language = "TypeScript"
+query = "(function_declaration) @f"
+"#,
+        )
+        .unwrap();
+
+        let set = QuerySet::load(&config).unwrap();
+        assert_eq!(
+            set.for_language(SupportedLanguage::Go, Dialect::Standard)
+                .len(),
+            1
+        );
+        assert_eq!(
+            set.for_language(SupportedLanguage::TypeScript, Dialect::Tsx)
+                .len(),
+            1
+        );
+        assert_eq!(set.fingerprint().len(), 64);
+    }
+
+    #[test]
+    fn test_invalid_definitions_are_rejected() {
+        let base = Path::new(".");
+        let cases = [
+            (
+                definition("x", "cobol", "(identifier)"),
+                "unknown language 'cobol'",
+            ),
+            (definition("x", "go", "(not_a_node"), "query 'x'"),
+            (
+                QueryDefinition {
+                    query: None,
+                    ..definition("x", "go", "")
+                },
+                "exactly one of `path` or `query`",
+            ),
+        ];
+        for (definition, expected) in cases {
+            let err = QuerySet::from_definitions(&[definition], base).unwrap_err();
+            assert!(err.to_string().contains(expected), "{err}");
+        }
+
+        let duplicate = [
+            definition("x", "go", "(identifier)"),
+            definition("x", "go", "(identifier)"),
+        ];
+        let err = QuerySet::from_definitions(&duplicate, base).unwrap_err();
+        assert!(err.to_string().contains("defined more than once"));
+    }
+}
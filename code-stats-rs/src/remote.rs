@@ -0,0 +1,461 @@
+//! Analysis of archives and remote git repositories without a checkout.
+//!
+//! A `.zip`, `.tar`, or `.tar.gz` path is streamed entry by entry, and each
+//! supported file is read through `CodeAnalyzer::read_limited` and analyzed
+//! from memory; entries that are filtered out are never decompressed and
+//! nothing is extracted. A git URL is
+//! fetched with `--depth 1` into a scratch bare repository, and its files are
+//! read from there with `git cat-file`, so no working tree is written either;
+//! the scratch repository is removed once the analysis is done.
+//!
+//! Files are reported under the archive path or URL they came from, e.g.
+//! `release.tar.gz/src/lib.rs`, so reports of different sources can be told
+//! apart and `--group-by dir` rolls them up below it.
+
+use crate::analyzer::{CodeAnalyzer, DirectoryOptions, LimitedSource, PathFilter, classify_file};
+use crate::cache::CACHE_DIR;
+use crate::diff::git;
+use crate::error::{CodeStatsError, Result};
+use crate::history::{BlobReader, analyze_blob, tree_files};
+use crate::stats::{DirectoryStats, FileStats};
+use flate2::read::GzDecoder;
+use std::fs::File;
+use std::io::{BufReader, Read};
+use std::path::{Component, Path, PathBuf};
+use std::process::{Command, Stdio};
+
+/// Archive formats that are read.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum ArchiveFormat {
+    Zip,
+    Tar,
+    TarGz,
+}
+
+impl ArchiveFormat {
+    /// Determines the format of an archive from its file name, e.g.
+    /// `release.tar.gz` or `src.tgz`.
+    pub(crate) fn from_path(path: &Path) -> Option<Self> {
+        let name = path.file_name()?.to_string_lossy().to_ascii_lowercase();
+        if name.ends_with(".zip") {
+            Some(Self::Zip)
+        } else if name.ends_with(".tar") {
+            Some(Self::Tar)
+        } else if name.ends_with(".tar.gz") || name.ends_with(".tgz") {
+            Some(Self::TarGz)
+        } else {
+            None
+        }
+    }
+}
+
+/// Returns true if `path` is a git URL rather than a local path, e.g.
+/// `https://github.com/org/repo` or `git@github.com:org/repo.git`.
+pub(crate) fn is_git_url(path: &Path) -> bool {
+    let Some(text) = path.to_str() else {
+        return false;
+    };
+    if ["https://", "http://", "ssh://", "git://", "file://"]
+        .iter()
+        .any(|scheme| text.starts_with(scheme))
+    {
+        return true;
+    }
+    // scp-like `user@host:path`, with no slash before the colon
+    match text.split_once(':') {
+        Some((host, _)) => host.contains('@') && !host.contains('/'),
+        None => false,
+    }
+}
+
+/// Returns true if `path` names an archive or a git URL, which are analyzed
+/// like a directory by `analyze_remote`.
+pub(crate) fn is_remote(path: &Path) -> bool {
+    is_git_url(path) || (ArchiveFormat::from_path(path).is_some() && path.is_file())
+}
+
+/// Analyzes the files of an archive or a git repository.
+///
+/// Files are filtered like in a directory: by `max_depth`, the ignore
+/// patterns, and the include/exclude globs, with the archive or URL as the
+/// root. Files that can't be decoded or parsed are skipped.
+///
+/// # Arguments
+///
+/// * `analyzer` - The analyzer to parse with
+/// * `path` - An archive, or a git URL (see `is_git_url`)
+/// * `reference` - Branch, tag, or commit to fetch from a git URL; the
+///   default branch if `None`
+/// * `options` - Exclusion settings
+///
+/// # Returns
+///
+/// * `Ok(DirectoryStats)` - The statistics, with files in path order
+/// * `Err(IoError)` - The archive can't be read
+/// * `Err(GitError)` - The repository or reference can't be fetched
+/// * `Err(ConfigError)` - A reference was given for an archive
+pub(crate) fn analyze_remote(
+    analyzer: &mut CodeAnalyzer,
+    path: &Path,
+    reference: Option<&str>,
+    options: &DirectoryOptions,
+) -> Result<DirectoryStats> {
+    let filter = PathFilter::new(path, options)?;
+    // The reported path and language of a file that is analyzed
+    let select = |analyzer: &CodeAnalyzer, name: &Path| {
+        let file = path.join(name);
+        if name.components().count() > options.max_depth
+            || name
+                .components()
+                .any(|part| part.as_os_str() == ".git" || part.as_os_str() == CACHE_DIR)
+            || !filter.allows(&file)
+        {
+            return None;
+        }
+        analyzer
+            .language_from_name(&name.to_string_lossy())
+            .map(|language| (file, language))
+    };
+
+    let mut files = Vec::new();
+    if is_git_url(path) {
+        visit_repository(path, reference, |name, bytes| {
+            if let Some((file, language)) = select(analyzer, name)
+                && let Some(file_stats) =
+                    analyze_blob(analyzer, &file, language, bytes, path, options)
+            {
+                files.push(file_stats);
+            }
+        })?;
+    } else if let Some(format) = ArchiveFormat::from_path(path) {
+        if reference.is_some() {
+            return Err(CodeStatsError::ConfigError(
+                "--ref only applies to git URLs".to_string(),
+            ));
+        }
+        // Entries are only decompressed once they are known to be analyzed,
+        // and no more than the parse size limit of one is held in memory
+        visit_archive(path, format, |name, size, entry| {
+            let Some((file, language)) = select(analyzer, name) else {
+                return Ok(());
+            };
+            let file_stats = match analyzer.read_limited(&file, language, size, entry)? {
+                LimitedSource::Content(bytes) => {
+                    analyze_blob(analyzer, &file, language, &bytes, path, options)
+                }
+                LimitedSource::Oversized(mut file_stats) => {
+                    classify_file(&mut file_stats, path, options);
+                    Some(*file_stats)
+                }
+            };
+            files.extend(file_stats);
+            Ok(())
+        })?;
+    } else {
+        return Err(CodeStatsError::IoError(format!(
+            "{} is neither an archive nor a git URL",
+            path.display()
+        )));
+    }
+
+    // Sorting makes the order independent of the order of the entries
+    files.sort_by(|a: &FileStats, b| a.path.cmp(&b.path));
+    let mut stats = DirectoryStats::new();
+    for file_stats in files {
+        stats.add_file(file_stats);
+    }
+    Ok(stats)
+}
+
+/// Hands each regular file of an archive to `visit` with its path in the
+/// archive, the size its header declares, and a reader of its content.
+///
+/// The archive is streamed from disk and entries are decompressed only as
+/// far as `visit` reads them, so entries it skips cost nothing; entries
+/// whose path would leave the archive, such as `../etc/passwd`, are skipped.
+fn visit_archive(
+    path: &Path,
+    format: ArchiveFormat,
+    mut visit: impl FnMut(&Path, u64, &mut dyn Read) -> std::io::Result<()>,
+) -> Result<()> {
+    let error = |e: &dyn std::fmt::Display| {
+        CodeStatsError::IoError(format!("Failed to read archive {}: {e}", path.display()))
+    };
+    match format {
+        ArchiveFormat::Zip => {
+            let file = BufReader::new(File::open(path).map_err(|e| error(&e))?);
+            let mut archive = zip::ZipArchive::new(file).map_err(|e| error(&e))?;
+            for index in 0..archive.len() {
+                let mut entry = archive.by_index(index).map_err(|e| error(&e))?;
+                let Some(name) = entry.enclosed_name() else {
+                    continue;
+                };
+                if !entry.is_file() || entry.is_symlink() {
+                    continue;
+                }
+                let size = entry.size();
+                visit(&name, size, &mut entry).map_err(|e| error(&e))?;
+            }
+        }
+        ArchiveFormat::Tar | ArchiveFormat::TarGz => {
+            let file = BufReader::new(File::open(path).map_err(|e| error(&e))?);
+            let reader: Box<dyn Read> = if format == ArchiveFormat::TarGz {
+                Box::new(GzDecoder::new(file))
+            } else {
+                Box::new(file)
+            };
+            let mut archive = tar::Archive::new(reader);
+            for entry in archive.entries().map_err(|e| error(&e))? {
+                let mut entry = entry.map_err(|e| error(&e))?;
+                if !entry.header().entry_type().is_file() {
+                    continue;
+                }
+                let Some(name) = entry.path().ok().and_then(|name| enclosed_name(&name)) else {
+                    continue;
+                };
+                let size = entry.header().size().unwrap_or(0);
+                visit(&name, size, &mut entry).map_err(|e| error(&e))?;
+            }
+        }
+    }
+    Ok(())
+}
+
+/// Normalizes the path of an archive entry, or returns `None` if it is
+/// absolute or leaves the archive.
+fn enclosed_name(name: &Path) -> Option<PathBuf> {
+    let mut enclosed = PathBuf::new();
+    for component in name.components() {
+        match component {
+            Component::Normal(part) => enclosed.push(part),
+            Component::CurDir => {}
+            Component::ParentDir | Component::RootDir | Component::Prefix(_) => return None,
+        }
+    }
+    (!enclosed.as_os_str().is_empty()).then_some(enclosed)
+}
+
+/// Fetches a revision of a git repository into a scratch bare repository and
+/// hands each regular file to `visit` with its path in the repository and
+/// its content.
+fn visit_repository(
+    url: &Path,
+    reference: Option<&str>,
+    mut visit: impl FnMut(&Path, &[u8]),
+) -> Result<()> {
+    let scratch = tempfile::tempdir()
+        .map_err(|e| CodeStatsError::IoError(format!("Failed to create a temp dir: {e}")))?;
+    let dir = scratch.path();
+    git(dir, &["init", "-q", "--bare"])?;
+
+    let output = Command::new("git")
+        .arg("-C")
+        .arg(dir)
+        .args(["fetch", "-q", "--depth", "1", "--no-tags"])
+        .arg(url)
+        .arg(reference.unwrap_or("HEAD"))
+        // Fail instead of waiting for credentials nobody will type
+        .env("GIT_TERMINAL_PROMPT", "0")
+        .stdin(Stdio::null())
+        .output()
+        .map_err(|e| CodeStatsError::GitError(format!("failed to run git: {e}")))?;
+    if !output.status.success() {
+        let stderr = String::from_utf8_lossy(&output.stderr);
+        return Err(CodeStatsError::GitError(format!(
+            "Failed to fetch {}: {}",
+            url.display(),
+            stderr.trim()
+        )));
+    }
+
+    let listing = git(dir, &["ls-tree", "-r", "-z", "FETCH_HEAD"])?;
+    let mut blobs = BlobReader::new(dir)?;
+    for (object, file) in tree_files(&listing) {
+        visit(Path::new(file), &blobs.read(object)?);
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+
+    fn write_tar_gz(path: &Path, entries: &[(&str, &str)]) {
+        let encoder = flate2::write::GzEncoder::new(
+            File::create(path).unwrap(),
+            flate2::Compression::default(),
+        );
+        let mut builder = tar::Builder::new(encoder);
+        for (name, content) in entries {
+            let mut header = tar::Header::new_gnu();
+            header.set_size(content.len() as u64);
+            header.set_mode(0o644);
+            header.set_cksum();
+            builder
+                .append_data(&mut header, name, content.as_bytes())
+                .unwrap();
+        }
+        builder.into_inner().unwrap().finish().unwrap();
+    }
+
+    #[test]
+    fn test_archive_format() {
+        let format = |name: &str| ArchiveFormat::from_path(Path::new(name));
+        assert_eq!(format("dist/Release.ZIP"), Some(ArchiveFormat::Zip));
+        assert_eq!(format("src.tar"), Some(ArchiveFormat::Tar));
+        assert_eq!(format("v1.2.0.tar.gz"), Some(ArchiveFormat::TarGz));
+        assert_eq!(format("v1.2.0.tgz"), Some(ArchiveFormat::TarGz));
+        assert_eq!(format("lib.rs"), None);
+        assert_eq!(format("archive.tar.xz"), None);
+    }
+
+    #[test]
+    fn test_is_git_url() {
+        for url in [
+            "https://github.com/org/repo",
+            "ssh://git@example.com/repo.git",
+            "git@github.com:org/repo.git",
+            "file:///srv/repo",
+        ] {
+            assert!(is_git_url(Path::new(url)), "{url}");
+        }
+        for path in ["src", "./a:b", "src/user@host:x", "C:\\repo"] {
+            assert!(!is_git_url(Path::new(path)), "{path}");
+        }
+    }
+
+    #[test]
+    fn test_enclosed_name() {
+        assert_eq!(
+            enclosed_name(Path::new("./repo-1.0/src/lib.rs")),
+            Some(PathBuf::from("repo-1.0/src/lib.rs"))
+        );
+        assert_eq!(enclosed_name(Path::new("../etc/passwd")), None);
+        assert_eq!(enclosed_name(Path::new("/etc/passwd")), None);
+        assert_eq!(enclosed_name(Path::new("./")), None);
+    }
+
+    #[test]
+    fn test_visit_tar_gz() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("release.tar.gz");
+        write_tar_gz(
+            &path,
+            &[
+                ("repo/src/lib.rs", "fn a() {}\n"),
+                ("repo/README.md", "# Repo\n"),
+            ],
+        );
+
+        let mut entries = Vec::new();
+        visit_archive(&path, ArchiveFormat::TarGz, |name, size, entry| {
+            let mut content = Vec::new();
+            entry.read_to_end(&mut content)?;
+            assert_eq!(content.len() as u64, size);
+            entries.push((name.to_path_buf(), content.len()));
+            Ok(())
+        })
+        .unwrap();
+        assert_eq!(
+            entries,
+            [
+                (PathBuf::from("repo/src/lib.rs"), 10),
+                (PathBuf::from("repo/README.md"), 7)
+            ]
+        );
+        assert!(is_remote(&path));
+        assert!(!is_remote(&dir.path().join("missing.zip")));
+    }
+
+    #[test]
+    fn test_analyze_archive() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("src.tar.gz");
+        write_tar_gz(
+            &path,
+            &[
+                ("b.rs", "fn b() {}\n"),
+                ("a.rs", "fn a() {}\nfn c() {}\n"),
+                ("notes.txt", "not code\n"),
+            ],
+        );
+
+        let mut analyzer = CodeAnalyzer::new();
+        let stats =
+            analyze_remote(&mut analyzer, &path, None, &DirectoryOptions::default()).unwrap();
+        let files: Vec<PathBuf> = stats.files.iter().map(|file| file.path.clone()).collect();
+        assert_eq!(files, [path.join("a.rs"), path.join("b.rs")]);
+        assert_eq!(stats.total_stats.function_count, 3);
+
+        let err = analyze_remote(
+            &mut analyzer,
+            &path,
+            Some("v1"),
+            &DirectoryOptions::default(),
+        )
+        .unwrap_err();
+        assert!(matches!(err, CodeStatsError::ConfigError(_)));
+    }
+
+    #[test]
+    fn test_analyze_archive_above_parse_size() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("src.tar.gz");
+        write_tar_gz(
+            &path,
+            &[("big.rs", "fn a() {}\n\nfn b() {}\n"), ("notes.txt", "x\n")],
+        );
+
+        let mut analyzer = CodeAnalyzer::new().with_max_parse_size(8);
+        let stats =
+            analyze_remote(&mut analyzer, &path, None, &DirectoryOptions::default()).unwrap();
+        assert_eq!(stats.files.len(), 1);
+        let file = &stats.files[0];
+        assert_eq!(file.path, path.join("big.rs"));
+        assert!(file.stats.oversized);
+        assert_eq!((file.stats.lines.code, file.stats.lines.blank), (2, 1));
+        assert_eq!(file.stats.function_count, 0);
+    }
+
+    #[test]
+    fn test_analyze_repository() {
+        let dir = tempfile::tempdir().unwrap();
+        let repo = dir.path();
+        let run = |args: &[&str]| {
+            let status = Command::new("git")
+                .arg("-C")
+                .arg(repo)
+                .args(["-c", "user.name=t", "-c", "user.email=t@example.com"])
+                .args(args)
+                .status()
+                .unwrap();
+            assert!(status.success());
+        };
+        run(&["init", "-q"]);
+        fs::write(repo.join("main.go"), "package main\nfunc main() {}\n").unwrap();
+        run(&["add", "."]);
+        run(&["commit", "-q", "-m", "init"]);
+        run(&["tag", "v1"]);
+
+        let url = PathBuf::from(format!("file://{}", repo.display()));
+        let mut analyzer = CodeAnalyzer::new();
+        let stats = analyze_remote(
+            &mut analyzer,
+            &url,
+            Some("v1"),
+            &DirectoryOptions::default(),
+        )
+        .unwrap();
+        assert_eq!(stats.files[0].path, url.join("main.go"));
+
+        let err = analyze_remote(
+            &mut analyzer,
+            &url,
+            Some("missing"),
+            &DirectoryOptions::default(),
+        )
+        .unwrap_err();
+        assert!(matches!(err, CodeStatsError::GitError(_)));
+    }
+}
@@ -0,0 +1,443 @@
+//! Per-directory and per-type rollups for `--group-by`.
+//!
+//! For `dir`, file statistics are summed into every directory on the path
+//! from the analyzed root down to the file, so each node of the tree carries
+//! the totals of its whole subtree. Children are ordered by lines of code,
+//! largest first, to put the packages that carry the most code at the top.
+//!
+//! For `type`, every named type declaration becomes a row with its fields
+//! and bases and the methods whose qualified name places them in it. Parts
+//! of a C# `partial` type are rows of their own unless they are merged, in
+//! which case one row sums all parts with the same name across files. A type
+//! with more fields and methods than the limit is flagged as a god object.
+
+use crate::language::SupportedLanguage;
+use crate::parser::TypeStats;
+use crate::stats::{DirectoryStats, FileStats, test_ratio};
+use serde::Serialize;
+use std::collections::HashMap;
+use std::path::{Component, Path, PathBuf};
+
+/// Default of `--max-type-members`: the number of fields and methods above
+/// which a type is flagged as a god object.
+pub(crate) const DEFAULT_MAX_TYPE_MEMBERS: usize = 30;
+
+/// Statistics of a directory, including every file below it.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize)]
+pub(crate) struct DirectoryRollup {
+    /// Path of the directory, as reached from the analyzed root
+    pub path: PathBuf,
+    /// Number of files below the directory
+    pub files: usize,
+    /// Lines of code below the directory
+    pub code_lines: usize,
+    /// Number of functions below the directory
+    pub functions: usize,
+    /// Number of classes and structs below the directory
+    pub classes: usize,
+    /// Sum of the cyclomatic complexity of every function below the directory
+    pub complexity: usize,
+    /// Highest cyclomatic complexity of any function below the directory
+    pub max_complexity: usize,
+    /// Lines of code in test files below the directory
+    pub test_code_lines: usize,
+    /// Number of functions in test files below the directory
+    pub test_functions: usize,
+    /// Subdirectories containing analyzed files, largest first
+    pub children: Vec<DirectoryRollup>,
+}
+
+impl DirectoryRollup {
+    /// Name shown for the directory in the tree: the root's path, or the
+    /// last component of a subdirectory's path.
+    pub(crate) fn name(&self, is_root: bool) -> String {
+        match self.path.file_name() {
+            Some(name) if !is_root => name.to_string_lossy().into_owned(),
+            _ => self.path.display().to_string(),
+        }
+    }
+
+    /// Drops subdirectories more than `depth` levels below this one.
+    ///
+    /// Their statistics remain included in the totals of their ancestors.
+    pub(crate) fn truncate(&mut self, depth: usize) {
+        if depth == 0 {
+            self.children.clear();
+        }
+        for child in &mut self.children {
+            child.truncate(depth.saturating_sub(1));
+        }
+    }
+
+    /// Adds a file's statistics to this directory's totals.
+    fn add(&mut self, file: &FileStats) {
+        self.files += 1;
+        self.code_lines += file.stats.lines.code;
+        self.functions += file.stats.function_count;
+        self.classes += file.stats.class_struct_count;
+        self.complexity += file
+            .stats
+            .functions
+            .iter()
+            .map(|f| f.complexity)
+            .sum::<usize>();
+        self.max_complexity = self.max_complexity.max(file.stats.max_complexity());
+        if file.stats.test_file {
+            self.test_code_lines += file.stats.lines.code;
+            self.test_functions += file.stats.function_count;
+        }
+    }
+
+    /// Returns the lines of test code per line of production code below the
+    /// directory, or `None` if there is no production code.
+    pub(crate) fn test_ratio(&self) -> Option<f64> {
+        test_ratio(self.test_code_lines, self.code_lines)
+    }
+
+    /// Orders the children of every directory, largest first.
+    ///
+    /// Ties are broken by path so the result is deterministic.
+    fn sort(&mut self) {
+        self.children.sort_by(|a, b| {
+            b.code_lines
+                .cmp(&a.code_lines)
+                .then_with(|| a.path.cmp(&b.path))
+        });
+        for child in &mut self.children {
+            child.sort();
+        }
+    }
+}
+
+/// Returns the path of the tree node for the directory containing `file`,
+/// as `rollup` builds it below `root`.
+pub(crate) fn directory_path(root: &Path, file: &Path) -> PathBuf {
+    let relative = file.strip_prefix(root).unwrap_or(file);
+    let mut directory = root.to_path_buf();
+    for component in relative.parent().into_iter().flat_map(Path::components) {
+        if let Component::Normal(name) = component {
+            directory.push(name);
+        }
+    }
+    directory
+}
+
+/// Aggregates directory statistics into a tree of directories.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics of the files below `root`
+/// * `root` - The analyzed directory, which becomes the root of the tree
+///
+/// # Returns
+///
+/// The root directory with its subdirectories, each holding subtree totals
+pub(crate) fn rollup(stats: &DirectoryStats, root: &Path) -> DirectoryRollup {
+    let mut tree = DirectoryRollup {
+        path: root.to_path_buf(),
+        ..Default::default()
+    };
+
+    // Configuration files stay out of the code totals here as well
+    for file in stats.code_file_stats() {
+        let relative = file.path.strip_prefix(root).unwrap_or(&file.path);
+        let mut node = &mut tree;
+        node.add(file);
+        let directories = relative.parent().into_iter().flat_map(Path::components);
+        for component in directories {
+            let Component::Normal(name) = component else {
+                continue;
+            };
+            let path = node.path.join(name);
+            let index = match node.children.iter().position(|child| child.path == path) {
+                Some(index) => index,
+                None => {
+                    node.children.push(DirectoryRollup {
+                        path,
+                        ..Default::default()
+                    });
+                    node.children.len() - 1
+                }
+            };
+            node = &mut node.children[index];
+            node.add(file);
+        }
+    }
+
+    tree.sort();
+    tree
+}
+
+/// Where one part of a type is declared.
+#[derive(Debug, Clone, PartialEq, Eq, PartialOrd, Ord, Serialize)]
+pub(crate) struct TypeLocation {
+    /// File containing the declaration
+    pub path: PathBuf,
+    /// 1-based line where the declaration starts
+    pub start_line: usize,
+}
+
+/// Size of a type declaration, or of all parts of a merged partial type.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct TypeRollup {
+    /// Qualified name of the type
+    pub name: String,
+    /// Breakdown label of the declaration (e.g. `class`, `struct`)
+    pub kind: String,
+    /// Language the type is declared in
+    pub language: SupportedLanguage,
+    /// Declarations making up the type: one, or one per merged part
+    pub locations: Vec<TypeLocation>,
+    /// Lines spanned by the declarations
+    pub lines: usize,
+    /// Number of fields declared in the type
+    pub fields: usize,
+    /// Number of functions declared directly in the type
+    pub methods: usize,
+    /// Number of types the type extends, implements, or embeds
+    pub bases: usize,
+    /// Sum of the cyclomatic complexity of those functions
+    pub complexity: usize,
+    /// Highest cyclomatic complexity of those functions
+    pub max_complexity: usize,
+    /// True if the type has more fields and methods than the limit
+    pub god_object: bool,
+}
+
+/// Lists the types declared in the analyzed files, largest first.
+///
+/// A function counts as a method of a type declared in the same file when
+/// its qualified name without the last segment is the type's name, so Rust
+/// `impl` blocks count towards the struct they implement.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics of the analyzed files
+/// * `merge_partial` - Combine the parts of C# `partial` types that share a
+///   name into a single row
+/// * `max_members` - Flag types with more fields and methods than this
+///
+/// # Returns
+///
+/// One entry per type, ordered by lines (largest first), then by name
+pub(crate) fn type_rollup(
+    stats: &DirectoryStats,
+    merge_partial: bool,
+    max_members: usize,
+) -> Vec<TypeRollup> {
+    let mut types: Vec<TypeRollup> = Vec::new();
+    // Index in `types` of the merged row for each partial type
+    let mut partials: HashMap<(SupportedLanguage, &str), usize> = HashMap::new();
+
+    for file in &stats.files {
+        for declaration in &file.stats.types {
+            let part = type_part(file, declaration);
+            if merge_partial && declaration.partial {
+                if let Some(&index) = partials.get(&(file.language, declaration.name.as_str())) {
+                    let merged = &mut types[index];
+                    merged.locations.extend(part.locations);
+                    merged.lines += part.lines;
+                    merged.fields += part.fields;
+                    merged.methods += part.methods;
+                    merged.bases += part.bases;
+                    merged.complexity += part.complexity;
+                    merged.max_complexity = merged.max_complexity.max(part.max_complexity);
+                    continue;
+                }
+                partials.insert((file.language, declaration.name.as_str()), types.len());
+            }
+            types.push(part);
+        }
+    }
+
+    for rollup in &mut types {
+        rollup.god_object = rollup.fields + rollup.methods > max_members;
+    }
+    types.sort_by(|a, b| {
+        b.lines
+            .cmp(&a.lines)
+            .then_with(|| a.name.cmp(&b.name))
+            .then_with(|| a.locations.cmp(&b.locations))
+    });
+    types
+}
+
+/// Builds the row of a single type declaration and the methods in its file.
+fn type_part(file: &FileStats, declaration: &TypeStats) -> TypeRollup {
+    let methods: Vec<usize> = file
+        .stats
+        .functions
+        .iter()
+        .filter(|function| scope_of(&function.qualified_name) == Some(declaration.name.as_str()))
+        .map(|function| function.complexity)
+        .collect();
+    TypeRollup {
+        name: declaration.name.clone(),
+        kind: declaration.kind.clone(),
+        language: file.language,
+        locations: vec![TypeLocation {
+            path: file.path.clone(),
+            start_line: declaration.start_line,
+        }],
+        lines: declaration.line_count(),
+        fields: declaration.fields,
+        methods: methods.len(),
+        bases: declaration.bases,
+        complexity: methods.iter().sum(),
+        max_complexity: methods.iter().copied().max().unwrap_or(0),
+        god_object: false,
+    }
+}
+
+/// Returns a qualified name without its last segment, which follows the
+/// last `::`, `.`, or `#`.
+fn scope_of(qualified_name: &str) -> Option<&str> {
+    let end = ["::", ".", "#"]
+        .iter()
+        .filter_map(|separator| qualified_name.rfind(separator))
+        .max()?;
+    Some(&qualified_name[..end])
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::{CodeStats, FunctionStats};
+    use crate::stats::test_support::{directory, file};
+
+    #[test]
+    fn test_rollup_sums_subtrees() {
+        let stats = directory([
+            file("proj/main.rs", 10, &[1]),
+            file("proj/src/lib.rs", 30, &[2, 3]),
+            file("proj/src/parser/mod.rs", 50, &[7]),
+            file("proj/tests/it.rs", 40, &[1, 1]),
+        ]);
+        let tree = rollup(&stats, Path::new("proj"));
+
+        assert_eq!(tree.name(true), "proj");
+        assert_eq!(
+            (tree.files, tree.code_lines, tree.functions, tree.complexity),
+            (4, 130, 6, 15)
+        );
+        assert_eq!(tree.max_complexity, 7);
+
+        // src (80 lines) sorts before tests (40 lines)
+        let names: Vec<String> = tree.children.iter().map(|c| c.name(false)).collect();
+        assert_eq!(names, vec!["src", "tests"]);
+        let src = &tree.children[0];
+        assert_eq!(src.path, PathBuf::from("proj/src"));
+        assert_eq!((src.files, src.code_lines, src.max_complexity), (2, 80, 7));
+        assert_eq!(src.children[0].path, PathBuf::from("proj/src/parser"));
+        assert!(src.children[0].children.is_empty());
+        assert_eq!(
+            directory_path(Path::new("proj"), Path::new("proj/src/parser/mod.rs")),
+            src.children[0].path
+        );
+        assert_eq!(
+            directory_path(Path::new("proj"), Path::new("proj/main.rs")),
+            tree.path
+        );
+    }
+
+    #[test]
+    fn test_truncate_keeps_totals() {
+        let stats = directory([file("a/b/c/deep.rs", 5, &[4]), file("a/top.rs", 1, &[])]);
+        let mut tree = rollup(&stats, Path::new("a"));
+        tree.truncate(1);
+
+        assert_eq!(tree.children.len(), 1);
+        assert!(tree.children[0].children.is_empty());
+        assert_eq!(tree.children[0].code_lines, 5);
+        assert_eq!(tree.code_lines, 6);
+
+        tree.truncate(0);
+        assert!(tree.children.is_empty());
+    }
+
+    #[test]
+    fn test_type_rollup_merges_partial_types() {
+        let part =
+            |path: &str, name: &str, lines: (usize, usize), methods: &[(&str, usize)]| FileStats {
+                path: PathBuf::from(path),
+                language: SupportedLanguage::CSharp,
+                stats: CodeStats {
+                    types: vec![TypeStats {
+                        name: name.to_string(),
+                        kind: "class".to_string(),
+                        start_line: lines.0,
+                        end_line: lines.1,
+                        partial: name == "Shop.Cart",
+                        fields: 2,
+                        bases: 1,
+                    }],
+                    functions: methods
+                        .iter()
+                        .map(|&(qualified_name, complexity)| FunctionStats {
+                            qualified_name: qualified_name.to_string(),
+                            complexity,
+                            ..Default::default()
+                        })
+                        .collect(),
+                    ..Default::default()
+                },
+            };
+        let stats = directory([
+            part("Cart.cs", "Shop.Cart", (3, 32), &[("Shop.Cart.Add", 4)]),
+            part(
+                "Cart.Generated.cs",
+                "Shop.Cart",
+                (1, 20),
+                &[("Shop.Cart.Load", 2), ("Shop.Cart.Load.parse", 1)],
+            ),
+            part(
+                "Order.cs",
+                "Shop.Order",
+                (1, 40),
+                &[("Shop.Order.Submit", 6)],
+            ),
+        ]);
+
+        let separate = type_rollup(&stats, false, DEFAULT_MAX_TYPE_MEMBERS);
+        let rows: Vec<_> = separate
+            .iter()
+            .map(|t| (t.name.as_str(), t.lines, t.methods))
+            .collect();
+        assert_eq!(
+            rows,
+            vec![
+                ("Shop.Order", 40, 1),
+                ("Shop.Cart", 30, 1),
+                ("Shop.Cart", 20, 1)
+            ]
+        );
+
+        let merged = type_rollup(&stats, true, DEFAULT_MAX_TYPE_MEMBERS);
+        assert_eq!(merged.len(), 2);
+        let cart = &merged[0];
+        assert_eq!(cart.name, "Shop.Cart");
+        assert_eq!(
+            (
+                cart.lines,
+                cart.methods,
+                cart.complexity,
+                cart.max_complexity
+            ),
+            (50, 2, 6, 4)
+        );
+        assert_eq!(cart.locations.len(), 2);
+        assert_eq!(cart.locations[1].path, PathBuf::from("Cart.Generated.cs"));
+        assert_eq!((cart.fields, cart.bases), (4, 2));
+        assert!(!cart.god_object);
+
+        // Each part has 2 fields and 1 method, the merged type 4 and 2
+        let flagged = type_rollup(&stats, true, 5);
+        assert!(flagged[0].god_object);
+        assert!(!flagged[1].god_object);
+        assert!(type_rollup(&stats, false, 5).iter().all(|t| !t.god_object));
+
+        assert_eq!(scope_of("Shop::Cart#add"), Some("Shop::Cart"));
+        assert_eq!(scope_of("shapes::Point::new"), Some("shapes::Point"));
+        assert_eq!(scope_of("main"), None);
+    }
+}
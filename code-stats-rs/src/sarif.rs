@@ -0,0 +1,485 @@
+//! SARIF 2.1.0 output for threshold violations and lint findings.
+//!
+//! Each function that exceeds a threshold, and each finding of a `--lint`
+//! rule, becomes a SARIF result pointing at its source lines, which lets
+//! GitHub code scanning and other SARIF viewers annotate the offending code
+//! directly.
+
+use crate::lint::{Finding, RuleDefinition};
+use crate::stats::{DirectoryStats, FunctionRef, Thresholds};
+use serde::Serialize;
+use std::path::Path;
+
+/// SARIF specification version emitted by this module.
+const SARIF_VERSION: &str = "2.1.0";
+
+/// JSON schema URI for SARIF 2.1.0 documents.
+const SARIF_SCHEMA: &str = "https://json.schemastore.org/sarif-2.1.0.json";
+
+/// Rule id for functions whose cyclomatic complexity exceeds the threshold.
+const COMPLEXITY_RULE: &str = "CS0001";
+
+/// Rule id for functions spanning more lines than allowed.
+const FUNCTION_LENGTH_RULE: &str = "CS0002";
+
+/// Top-level SARIF log.
+#[derive(Serialize)]
+struct SarifLog {
+    #[serde(rename = "$schema")]
+    schema: &'static str,
+    version: &'static str,
+    runs: Vec<Run>,
+}
+
+#[derive(Serialize)]
+struct Run {
+    tool: Tool,
+    results: Vec<SarifResult>,
+}
+
+#[derive(Serialize)]
+struct Tool {
+    driver: Driver,
+}
+
+#[derive(Serialize)]
+struct Driver {
+    name: &'static str,
+    version: &'static str,
+    rules: Vec<Rule>,
+}
+
+#[derive(Serialize)]
+#[serde(rename_all = "camelCase")]
+struct Rule {
+    id: String,
+    name: String,
+    short_description: Message,
+    full_description: Message,
+    default_configuration: Configuration,
+}
+
+#[derive(Serialize)]
+struct Configuration {
+    level: &'static str,
+}
+
+#[derive(Serialize)]
+struct Message {
+    text: String,
+}
+
+#[derive(Serialize)]
+#[serde(rename_all = "camelCase")]
+struct SarifResult {
+    rule_id: String,
+    rule_index: usize,
+    level: &'static str,
+    message: Message,
+    locations: Vec<Location>,
+}
+
+#[derive(Serialize)]
+#[serde(rename_all = "camelCase")]
+struct Location {
+    physical_location: PhysicalLocation,
+}
+
+#[derive(Serialize)]
+#[serde(rename_all = "camelCase")]
+struct PhysicalLocation {
+    artifact_location: ArtifactLocation,
+    region: Region,
+}
+
+#[derive(Serialize)]
+struct ArtifactLocation {
+    uri: String,
+}
+
+#[derive(Serialize)]
+#[serde(rename_all = "camelCase")]
+struct Region {
+    start_line: usize,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    start_column: Option<usize>,
+    end_line: usize,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    end_column: Option<usize>,
+}
+
+/// Builds the rule descriptors, in the order referenced by `rule_index`.
+fn rules(thresholds: &Thresholds) -> Vec<Rule> {
+    vec![
+        Rule {
+            id: COMPLEXITY_RULE.to_string(),
+            name: "FunctionTooComplex".to_string(),
+            short_description: Message {
+                text: "Function cyclomatic complexity is too high".to_string(),
+            },
+            full_description: Message {
+                text: format!(
+                    "Functions should have a cyclomatic complexity of at most {}.",
+                    thresholds.complexity
+                ),
+            },
+            default_configuration: Configuration { level: "warning" },
+        },
+        Rule {
+            id: FUNCTION_LENGTH_RULE.to_string(),
+            name: "FunctionTooLong".to_string(),
+            short_description: Message {
+                text: "Function is too long".to_string(),
+            },
+            full_description: Message {
+                text: format!(
+                    "Functions should span at most {} lines.",
+                    thresholds.function_lines
+                ),
+            },
+            default_configuration: Configuration { level: "warning" },
+        },
+    ]
+}
+
+/// A function exceeding a threshold, with the rule it violates.
+pub(crate) struct Violation<'a> {
+    /// Rule id, as in `CS0001`
+    pub rule_id: &'static str,
+    /// Rule name, as in `FunctionTooComplex`
+    pub rule_name: &'static str,
+    pub function: FunctionRef<'a>,
+    pub message: String,
+}
+
+/// Lists the threshold violations of all functions, ordered by path, line,
+/// and rule; a function can violate both rules.
+///
+/// # Arguments
+///
+/// * `stats` - Directory statistics whose functions are checked
+/// * `thresholds` - Complexity and length limits
+pub(crate) fn violations<'a>(
+    stats: &'a DirectoryStats,
+    thresholds: &Thresholds,
+) -> Vec<Violation<'a>> {
+    let mut functions: Vec<FunctionRef> = stats.functions().collect();
+    functions.sort_by(|a, b| {
+        a.path
+            .cmp(b.path)
+            .then_with(|| a.function.start_line.cmp(&b.function.start_line))
+    });
+
+    let mut violations = Vec::new();
+    for function in functions {
+        let name = &function.function.qualified_name;
+        if function.function.complexity > thresholds.complexity {
+            violations.push(Violation {
+                rule_id: COMPLEXITY_RULE,
+                rule_name: "FunctionTooComplex",
+                function,
+                message: format!(
+                    "Function '{name}' has a cyclomatic complexity of {} (threshold {})",
+                    function.function.complexity, thresholds.complexity
+                ),
+            });
+        }
+        if function.function.line_count() > thresholds.function_lines {
+            violations.push(Violation {
+                rule_id: FUNCTION_LENGTH_RULE,
+                rule_name: "FunctionTooLong",
+                function,
+                message: format!(
+                    "Function '{name}' spans {} lines (threshold {})",
+                    function.function.line_count(),
+                    thresholds.function_lines
+                ),
+            });
+        }
+    }
+    violations
+}
+
+/// Converts a path into a SARIF artifact URI.
+///
+/// Relative paths are kept relative (resolved against the checkout root by
+/// consumers such as GitHub code scanning) and always use forward slashes.
+pub(crate) fn artifact_uri(path: &Path) -> String {
+    let uri = path.to_string_lossy().replace('\\', "/");
+    uri.strip_prefix("./").map(str::to_string).unwrap_or(uri)
+}
+
+/// Creates the result of a violation.
+fn violation(violation: Violation) -> SarifResult {
+    let function = violation.function;
+    SarifResult {
+        rule_id: violation.rule_id.to_string(),
+        // The order of `rules`
+        rule_index: match violation.rule_id {
+            COMPLEXITY_RULE => 0,
+            _ => 1,
+        },
+        level: "warning",
+        message: Message {
+            text: violation.message,
+        },
+        locations: vec![Location {
+            physical_location: PhysicalLocation {
+                artifact_location: ArtifactLocation {
+                    uri: artifact_uri(function.path),
+                },
+                region: Region {
+                    start_line: function.function.start_line,
+                    start_column: None,
+                    end_line: function.function.end_line,
+                    end_column: None,
+                },
+            },
+        }],
+    }
+}
+
+/// Formats threshold violations as a SARIF 2.1.0 log.
+///
+/// A function can produce one result per rule it violates. Results are
+/// ordered by path, line, and rule so the output is deterministic; a clean
+/// run still emits a valid log with an empty result list.
+///
+/// # Arguments
+///
+/// * `stats` - Directory statistics whose functions are checked
+/// * `thresholds` - Complexity and length limits
+///
+/// # Returns
+///
+/// The SARIF log as pretty-printed JSON
+pub(crate) fn format_sarif(stats: &DirectoryStats, thresholds: &Thresholds) -> String {
+    let results = violations(stats, thresholds)
+        .into_iter()
+        .map(violation)
+        .collect();
+    format_log(rules(thresholds), results)
+}
+
+/// Formats the findings of `--lint` as a SARIF 2.1.0 log, with one rule
+/// descriptor per configured rule.
+///
+/// # Arguments
+///
+/// * `findings` - The findings, in the order they are listed
+/// * `rules` - The configured rules, which the findings refer to by id
+///
+/// # Returns
+///
+/// The SARIF log as pretty-printed JSON
+pub(crate) fn format_findings_sarif(findings: &[Finding], rules: &[RuleDefinition]) -> String {
+    let descriptors = rules
+        .iter()
+        .map(|rule| Rule {
+            id: rule.id.clone(),
+            name: rule.id.clone(),
+            short_description: Message {
+                text: rule.message.clone(),
+            },
+            full_description: Message {
+                text: format!(
+                    "{} ({} rule for {})",
+                    rule.message,
+                    rule.severity.label(),
+                    rule.language
+                ),
+            },
+            default_configuration: Configuration {
+                level: rule.severity.label(),
+            },
+        })
+        .collect();
+    let results = findings
+        .iter()
+        .map(|finding| SarifResult {
+            rule_id: finding.rule.clone(),
+            rule_index: rules
+                .iter()
+                .position(|rule| rule.id == finding.rule)
+                .unwrap_or_default(),
+            level: finding.severity.label(),
+            message: Message {
+                text: finding.message.clone(),
+            },
+            locations: vec![Location {
+                physical_location: PhysicalLocation {
+                    artifact_location: ArtifactLocation {
+                        uri: artifact_uri(&finding.path),
+                    },
+                    region: Region {
+                        start_line: finding.line,
+                        start_column: Some(finding.column),
+                        end_line: finding.end_line,
+                        end_column: Some(finding.end_column),
+                    },
+                },
+            }],
+        })
+        .collect();
+    format_log(descriptors, results)
+}
+
+/// Wraps the rules and results of a run in a SARIF log.
+fn format_log(rules: Vec<Rule>, results: Vec<SarifResult>) -> String {
+    let log = SarifLog {
+        schema: SARIF_SCHEMA,
+        version: SARIF_VERSION,
+        runs: vec![Run {
+            tool: Tool {
+                driver: Driver {
+                    name: env!("CARGO_PKG_NAME"),
+                    version: env!("CARGO_PKG_VERSION"),
+                    rules,
+                },
+            },
+            results,
+        }],
+    };
+
+    serde_json::to_string_pretty(&log)
+        .unwrap_or_else(|e| format!("Error serializing to SARIF: {e}"))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::language::SupportedLanguage;
+    use crate::parser::{CodeStats, FunctionStats};
+    use crate::stats::FileStats;
+    use std::path::PathBuf;
+
+    fn stats_with(functions: Vec<FunctionStats>) -> DirectoryStats {
+        let mut stats = DirectoryStats::new();
+        stats.add_file(FileStats {
+            path: PathBuf::from("./src/lib.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                function_count: functions.len(),
+                functions,
+                ..Default::default()
+            },
+        });
+        stats
+    }
+
+    fn function(
+        name: &str,
+        start_line: usize,
+        end_line: usize,
+        complexity: usize,
+    ) -> FunctionStats {
+        FunctionStats {
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            start_line,
+            end_line,
+            complexity,
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn test_sarif_reports_each_violation() {
+        let stats = stats_with(vec![
+            function("tidy", 1, 5, 2),
+            function("tangled", 10, 20, 12),
+            function("sprawling", 30, 90, 15),
+        ]);
+        let thresholds = Thresholds {
+            complexity: 10,
+            function_lines: 50,
+        };
+
+        let sarif: serde_json::Value =
+            serde_json::from_str(&format_sarif(&stats, &thresholds)).unwrap();
+        assert_eq!(sarif["version"], "2.1.0");
+        assert_eq!(sarif["$schema"], SARIF_SCHEMA);
+
+        let run = &sarif["runs"][0];
+        assert_eq!(run["tool"]["driver"]["name"], "code-stats-rs");
+        assert_eq!(run["tool"]["driver"]["rules"][0]["id"], COMPLEXITY_RULE);
+        assert_eq!(
+            run["tool"]["driver"]["rules"][1]["id"],
+            FUNCTION_LENGTH_RULE
+        );
+
+        let results = run["results"].as_array().unwrap();
+        assert_eq!(results.len(), 3);
+        assert_eq!(results[0]["ruleId"], COMPLEXITY_RULE);
+        assert_eq!(results[0]["ruleIndex"], 0);
+        assert_eq!(
+            results[0]["message"]["text"],
+            "Function 'tangled' has a cyclomatic complexity of 12 (threshold 10)"
+        );
+        let location = &results[0]["locations"][0]["physicalLocation"];
+        assert_eq!(location["artifactLocation"]["uri"], "src/lib.rs");
+        assert_eq!(location["region"]["startLine"], 10);
+        assert_eq!(location["region"]["endLine"], 20);
+
+        // One function can violate both rules
+        assert_eq!(results[1]["ruleId"], COMPLEXITY_RULE);
+        assert_eq!(results[2]["ruleId"], FUNCTION_LENGTH_RULE);
+        assert_eq!(
+            results[2]["message"]["text"],
+            "Function 'sprawling' spans 61 lines (threshold 50)"
+        );
+    }
+
+    #[test]
+    fn test_sarif_without_violations_is_valid() {
+        let stats = stats_with(vec![function("tidy", 1, 5, 2)]);
+        let sarif: serde_json::Value =
+            serde_json::from_str(&format_sarif(&stats, &Thresholds::default())).unwrap();
+        assert_eq!(sarif["runs"][0]["results"].as_array().unwrap().len(), 0);
+    }
+
+    #[test]
+    fn test_findings_sarif() {
+        let rules = [RuleDefinition {
+            id: "no-printf".to_string(),
+            language: "go".to_string(),
+            severity: crate::lint::Severity::Error,
+            message: "use the logger".to_string(),
+            query: Some("(call_expression) @finding".to_string()),
+            path: None,
+            switch: None,
+            unless: None,
+        }];
+        let findings = [Finding {
+            rule: "no-printf".to_string(),
+            severity: crate::lint::Severity::Error,
+            path: PathBuf::from("./util.go"),
+            line: 4,
+            column: 2,
+            end_line: 4,
+            end_column: 18,
+            message: "use the logger".to_string(),
+        }];
+
+        let sarif: serde_json::Value =
+            serde_json::from_str(&format_findings_sarif(&findings, &rules)).unwrap();
+        let run = &sarif["runs"][0];
+        let rule = &run["tool"]["driver"]["rules"][0];
+        assert_eq!(rule["id"], "no-printf");
+        assert_eq!(rule["defaultConfiguration"]["level"], "error");
+        let result = &run["results"][0];
+        assert_eq!(result["level"], "error");
+        assert_eq!(result["ruleIndex"], 0);
+        let location = &result["locations"][0]["physicalLocation"];
+        assert_eq!(location["artifactLocation"]["uri"], "util.go");
+        assert_eq!(location["region"]["startColumn"], 2);
+        assert_eq!(location["region"]["endColumn"], 18);
+    }
+
+    #[test]
+    fn test_artifact_uri() {
+        assert_eq!(artifact_uri(Path::new("./src/main.rs")), "src/main.rs");
+        assert_eq!(artifact_uri(Path::new("src/main.rs")), "src/main.rs");
+        assert_eq!(artifact_uri(Path::new("src\\main.rs")), "src/main.rs");
+    }
+}
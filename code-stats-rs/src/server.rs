@@ -0,0 +1,865 @@
+//! HTTP server of the `serve` subcommand.
+//!
+//! Besides the Prometheus metrics, the server exposes the analysis itself, so
+//! editors and bots can ask for the statistics of a file or an unsaved buffer
+//! without paying process startup and grammar loading on every call. The
+//! analyzer, with its parsers and result cache, lives as long as the server.
+//!
+//! | Endpoint | Body | Answer |
+//! |----------|------|--------|
+//! | `GET /metrics` | | Prometheus gauges of the served path |
+//! | `POST /analyze` | `{"path"}` | `--format json` report of a file or directory |
+//! | `POST /analyze/buffer` | `{"language", "source", "path"?}` | `--format json` report of the source |
+//! | `POST /query` | `{"query", "path"}` or `{"query", "language", "source"}` | Captures of a tree-sitter query |
+//! | `POST /outline` | `{"path"}` or `{"language", "source"}` | Declarations nested by range, like an LSP `documentSymbol` answer |
+//! | `POST /rpc` | JSON-RPC 2.0 request | The above as methods `analyze`, `analyzeBuffer`, `query`, and `outline` |
+//!
+//! Paths are relative to the served directory, and paths outside of it are
+//! refused. Up to `WORKERS` connections are answered at the same time, each
+//! on a scoped thread of the server process with its own `CodeAnalyzer::fork`
+//! of the analyzer, so the threads keep their parsers warm and share the
+//! result cache. A connection that is slower
+//! than `IO_TIMEOUT` to send its request or take its response is dropped, and
+//! request headers are limited to `MAX_HEADERS` bytes.
+
+use crate::analyzer::{CodeAnalyzer, DirectoryOptions};
+use crate::cli::OutputFormat;
+use crate::columns::node_columns;
+use crate::error::{CodeStatsError, Result};
+use crate::formatter::format_output;
+use crate::language::{Dialect, SupportedLanguage};
+use crate::outline::outline;
+use crate::prometheus::{CONTENT_TYPE, format_prometheus};
+use crate::stats::{DirectoryStats, Thresholds};
+use serde::Deserialize;
+use serde_json::{Value, json};
+use std::io::{self, BufRead, BufReader, Read, Write};
+use std::net::{TcpListener, TcpStream};
+use std::path::{Component, Path, PathBuf};
+use std::thread;
+use std::time::Duration;
+use tree_sitter::{Query, QueryCursor, StreamingIterator};
+
+/// Path answered with the Prometheus metrics.
+const METRICS_PATH: &str = "/metrics";
+
+/// Number of connections answered at the same time.
+pub(crate) const WORKERS: usize = 4;
+
+/// How long a read from or write to a client may block.
+const IO_TIMEOUT: Duration = Duration::from_secs(30);
+
+/// Largest request line and headers accepted, together.
+const MAX_HEADERS: u64 = 64 * 1024;
+
+/// Largest request body accepted.
+const MAX_BODY: usize = 16 * 1024 * 1024;
+
+/// Path recorded for a buffer analyzed without a `path`.
+const BUFFER_NAME: &str = "<buffer>";
+
+/// A parsed HTTP request.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct Request {
+    /// e.g. `GET`
+    pub method: String,
+    /// Request target without the query string, e.g. `/metrics`
+    pub path: String,
+    pub body: String,
+}
+
+/// An HTTP response.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct Response {
+    /// Status line after the version, e.g. `200 OK`
+    pub status: &'static str,
+    pub content_type: &'static str,
+    pub body: String,
+}
+
+impl Response {
+    fn json(status: &'static str, body: &Value) -> Self {
+        Self {
+            status,
+            content_type: "application/json",
+            body: format!("{body}\n"),
+        }
+    }
+
+    fn text(status: &'static str, body: impl Into<String>) -> Self {
+        Self {
+            status,
+            content_type: "text/plain",
+            body: body.into(),
+        }
+    }
+}
+
+/// Why a request could not be answered.
+#[derive(Debug, Clone, PartialEq, Eq)]
+enum ApiError {
+    /// The request is malformed
+    Invalid(String),
+    /// The path is outside the served directory
+    Forbidden(String),
+    /// The path doesn't exist in the served directory
+    NotFound(String),
+    /// The analysis failed, e.g. because a file doesn't exist
+    Failed(String),
+}
+
+impl ApiError {
+    fn message(&self) -> &str {
+        match self {
+            ApiError::Invalid(message)
+            | ApiError::Forbidden(message)
+            | ApiError::NotFound(message)
+            | ApiError::Failed(message) => message,
+        }
+    }
+
+    /// HTTP status of the error on the plain endpoints.
+    fn status(&self) -> &'static str {
+        match self {
+            ApiError::Invalid(_) => "400 Bad Request",
+            ApiError::Forbidden(_) => "403 Forbidden",
+            ApiError::NotFound(_) => "404 Not Found",
+            ApiError::Failed(_) => "422 Unprocessable Entity",
+        }
+    }
+
+    /// JSON-RPC error code of the error.
+    fn code(&self) -> i64 {
+        match self {
+            ApiError::Invalid(_) => -32602,
+            ApiError::Forbidden(_) => -32001,
+            ApiError::NotFound(_) => -32002,
+            ApiError::Failed(_) => -32000,
+        }
+    }
+}
+
+impl From<CodeStatsError> for ApiError {
+    fn from(error: CodeStatsError) -> Self {
+        ApiError::Failed(error.to_string())
+    }
+}
+
+/// Body of `POST /analyze`.
+#[derive(Debug, Deserialize)]
+#[serde(deny_unknown_fields)]
+struct AnalyzeParams {
+    path: PathBuf,
+}
+
+/// Body of `POST /analyze/buffer`.
+#[derive(Debug, Deserialize)]
+#[serde(deny_unknown_fields)]
+struct BufferParams {
+    language: String,
+    source: String,
+    /// Name recorded for the buffer, which also selects the grammar dialect,
+    /// e.g. `component.tsx`
+    path: Option<PathBuf>,
+}
+
+/// Body of `POST /query`.
+#[derive(Debug, Deserialize)]
+#[serde(deny_unknown_fields)]
+struct QueryParams {
+    query: String,
+    /// File to query; its language is detected unless `language` is given
+    path: Option<PathBuf>,
+    language: Option<String>,
+    /// Source to query instead of a file
+    source: Option<String>,
+}
+
+/// Body of `POST /outline`.
+#[derive(Debug, Deserialize)]
+#[serde(deny_unknown_fields)]
+struct OutlineParams {
+    /// File to outline; its language is detected unless `language` is given
+    path: Option<PathBuf>,
+    language: Option<String>,
+    /// Source to outline instead of a file
+    source: Option<String>,
+}
+
+/// Answers the requests of the `serve` subcommand.
+pub(crate) struct Server<'a> {
+    analyzer: &'a mut CodeAnalyzer,
+    /// The served file or directory
+    root: PathBuf,
+    options: DirectoryOptions,
+    thresholds: Thresholds,
+}
+
+impl<'a> Server<'a> {
+    /// Creates a server for the file or directory `root`.
+    pub(crate) fn new(
+        analyzer: &'a mut CodeAnalyzer,
+        root: &Path,
+        options: DirectoryOptions,
+        thresholds: Thresholds,
+    ) -> Self {
+        Self {
+            analyzer,
+            root: root.to_path_buf(),
+            options,
+            thresholds,
+        }
+    }
+
+    /// Answers one request.
+    ///
+    /// Unknown paths get a 404 listing the endpoints, and known paths with
+    /// the wrong method a 405.
+    pub(crate) fn handle(&mut self, request: &Request) -> Response {
+        match (request.method.as_str(), request.path.as_str()) {
+            ("GET", METRICS_PATH) => self.metrics(),
+            ("POST", "/analyze") => Self::endpoint(request, |params| self.analyze(params)),
+            ("POST", "/analyze/buffer") => {
+                Self::endpoint(request, |params| self.analyze_buffer(params))
+            }
+            ("POST", "/query") => Self::endpoint(request, |params| self.query(params)),
+            ("POST", "/outline") => Self::endpoint(request, |params| self.outline(params)),
+            ("POST", "/rpc") => self.rpc(&request.body),
+            (_, METRICS_PATH) => {
+                Response::text("405 Method Not Allowed", "Only GET is supported\n")
+            }
+            (_, "/analyze" | "/analyze/buffer" | "/query" | "/outline" | "/rpc") => {
+                Response::text("405 Method Not Allowed", "Only POST is supported\n")
+            }
+            _ => Response::text(
+                "404 Not Found",
+                "Endpoints are GET /metrics, POST /analyze, POST /analyze/buffer, POST /query, POST /outline, and POST /rpc\n",
+            ),
+        }
+    }
+
+    /// Parses the JSON body of a request for `answer`.
+    fn endpoint<P: for<'de> Deserialize<'de>>(
+        request: &Request,
+        answer: impl FnOnce(P) -> std::result::Result<Value, ApiError>,
+    ) -> Response {
+        let result = serde_json::from_str(&request.body)
+            .map_err(|e| ApiError::Invalid(format!("Invalid request body: {e}")))
+            .and_then(answer);
+        match result {
+            Ok(value) => Response::json("200 OK", &value),
+            Err(error) => Response::json(error.status(), &json!({ "error": error.message() })),
+        }
+    }
+
+    fn metrics(&mut self) -> Response {
+        match self.analyzer.analyze_path(&self.root, &self.options) {
+            Ok(stats) => Response {
+                status: "200 OK",
+                content_type: CONTENT_TYPE,
+                body: format_prometheus(&stats, &self.thresholds),
+            },
+            Err(e) => Response::text("500 Internal Server Error", format!("{e}\n")),
+        }
+    }
+
+    /// Answers a JSON-RPC 2.0 request; notifications, without an `id`, get an
+    /// empty response.
+    fn rpc(&mut self, body: &str) -> Response {
+        let request: Value = match serde_json::from_str(body) {
+            Ok(request) => request,
+            Err(e) => return rpc_error(Value::Null, -32700, &format!("Parse error: {e}")),
+        };
+        let id = request.get("id").cloned();
+        let method = request.get("method").and_then(Value::as_str);
+        let (Some(method), Some("2.0")) = (method, request.get("jsonrpc").and_then(Value::as_str))
+        else {
+            return rpc_error(id.unwrap_or(Value::Null), -32600, "Invalid Request");
+        };
+        let params = request.get("params").cloned().unwrap_or(Value::Null);
+
+        fn parse<P: for<'de> Deserialize<'de>>(params: Value) -> std::result::Result<P, ApiError> {
+            serde_json::from_value(params)
+                .map_err(|e| ApiError::Invalid(format!("Invalid params: {e}")))
+        }
+        let result = match method {
+            "analyze" => parse(params).and_then(|params| self.analyze(params)),
+            "analyzeBuffer" => parse(params).and_then(|params| self.analyze_buffer(params)),
+            "query" => parse(params).and_then(|params| self.query(params)),
+            "outline" => parse(params).and_then(|params| self.outline(params)),
+            _ => {
+                return rpc_error(
+                    id.unwrap_or(Value::Null),
+                    -32601,
+                    &format!("Method not found: {method}"),
+                );
+            }
+        };
+
+        let Some(id) = id else {
+            return Response::text("204 No Content", "");
+        };
+        match result {
+            Ok(result) => Response::json(
+                "200 OK",
+                &json!({ "jsonrpc": "2.0", "id": id, "result": result }),
+            ),
+            Err(error) => rpc_error(id, error.code(), error.message()),
+        }
+    }
+
+    fn analyze(&mut self, params: AnalyzeParams) -> std::result::Result<Value, ApiError> {
+        let path = self.resolve(&params.path)?;
+        let stats = self.analyzer.analyze_path(&path, &self.options)?;
+        report(&stats, &self.thresholds)
+    }
+
+    fn analyze_buffer(&mut self, params: BufferParams) -> std::result::Result<Value, ApiError> {
+        let language = language(&params.language)?;
+        let path = params.path.unwrap_or_else(|| PathBuf::from(BUFFER_NAME));
+        let file_stats = self
+            .analyzer
+            .analyze_text(&path, language, &params.source)?;
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file_stats);
+        report(&stats, &self.thresholds)
+    }
+
+    fn query(&mut self, params: QueryParams) -> std::result::Result<Value, ApiError> {
+        let (path, source, language) =
+            self.source(params.path, params.language.as_deref(), params.source)?;
+
+        let dialect = Dialect::from_file_path(language, &path.to_string_lossy());
+        let query = Query::new(&language.get_language_with_dialect(dialect), &params.query)
+            .map_err(|e| ApiError::Invalid(format!("Invalid query: {e} (line {})", e.row + 1)))?;
+        let tree = self.analyzer.parse(&path, language, &source)?;
+        let tab_width = self.analyzer.tab_width(&path);
+
+        let mut cursor = QueryCursor::new();
+        let mut matches = cursor.matches(&query, tree.root_node(), source.as_bytes());
+        let mut results = Vec::new();
+        while let Some(found) = matches.next() {
+            let captures: Vec<Value> = found
+                .captures
+                .iter()
+                .map(|capture| {
+                    let node = capture.node;
+                    let (start_column, end_column) =
+                        node_columns(&node, source.as_bytes(), tab_width);
+                    json!({
+                        "name": query.capture_names()[capture.index as usize],
+                        "kind": node.kind(),
+                        "text": node.utf8_text(source.as_bytes()).unwrap_or_default(),
+                        "start_line": node.start_position().row + 1,
+                        "start_column": start_column,
+                        "end_line": node.end_position().row + 1,
+                        "end_column": end_column,
+                    })
+                })
+                .collect();
+            results.push(json!({ "pattern": found.pattern_index, "captures": captures }));
+        }
+        Ok(json!({ "path": path, "language": language.name(), "matches": results }))
+    }
+
+    fn outline(&mut self, params: OutlineParams) -> std::result::Result<Value, ApiError> {
+        let (path, source, language) =
+            self.source(params.path, params.language.as_deref(), params.source)?;
+        let symbols = self.analyzer.symbols(&path, language, &source)?;
+        Ok(json!({ "path": path, "language": language.name(), "symbols": outline(symbols) }))
+    }
+
+    /// Reads the source a request names, either a file of the served
+    /// directory or the source itself.
+    ///
+    /// # Returns
+    ///
+    /// The path of the source, `<buffer>` for inline source, with the
+    /// source and its language
+    fn source(
+        &self,
+        path: Option<PathBuf>,
+        language_name: Option<&str>,
+        source: Option<String>,
+    ) -> std::result::Result<(PathBuf, String, SupportedLanguage), ApiError> {
+        match (path, source) {
+            (Some(path), None) => {
+                let resolved = self.resolve(&path)?;
+                let language = match language_name {
+                    Some(name) => language(name)?,
+                    None => self.analyzer.detect_language(&resolved).ok_or_else(|| {
+                        ApiError::Failed(format!("Unsupported file type: {}", path.display()))
+                    })?,
+                };
+                let source = std::fs::read_to_string(&resolved).map_err(|e| {
+                    ApiError::Failed(format!("Failed to read {}: {e}", path.display()))
+                })?;
+                Ok((path, source, language))
+            }
+            (None, Some(source)) => {
+                let name = language_name.ok_or_else(|| {
+                    ApiError::Invalid("`language` is required with `source`".to_string())
+                })?;
+                Ok((PathBuf::from(BUFFER_NAME), source, language(name)?))
+            }
+            _ => Err(ApiError::Invalid(
+                "exactly one of `path` or `source` is required".to_string(),
+            )),
+        }
+    }
+
+    /// Resolves a request path against the served directory, refusing paths
+    /// outside of it.
+    ///
+    /// Paths that climb out of the directory are refused before the file
+    /// system is touched, so the answer never tells whether a file exists
+    /// outside of it; symlinks leaving the directory are refused after
+    /// resolving them.
+    ///
+    /// # Returns
+    ///
+    /// The canonical path of the file or directory
+    fn resolve(&self, path: &Path) -> std::result::Result<PathBuf, ApiError> {
+        let outside = || {
+            ApiError::Forbidden(format!(
+                "{} is outside the served directory",
+                path.display()
+            ))
+        };
+        if escapes(path) {
+            return Err(outside());
+        }
+        let base = if self.root.is_file() {
+            self.root.parent().unwrap_or(Path::new("."))
+        } else {
+            &self.root
+        };
+        let base = base.canonicalize().map_err(|_| outside())?;
+        let canonical = base.join(path).canonicalize().map_err(|_| {
+            ApiError::NotFound(format!(
+                "{} doesn't exist in the served directory",
+                path.display()
+            ))
+        })?;
+        if !canonical.starts_with(&base) {
+            return Err(outside());
+        }
+        Ok(canonical)
+    }
+}
+
+/// Parses a language name as `--lang` does.
+fn language(name: &str) -> std::result::Result<SupportedLanguage, ApiError> {
+    SupportedLanguage::from_name(name)
+        .ok_or_else(|| ApiError::Invalid(format!("unknown language '{name}'")))
+}
+
+/// Whether a relative path climbs out of the directory it's joined to, going
+/// by its components alone: absolute paths and `..` past the top do.
+fn escapes(path: &Path) -> bool {
+    let mut depth = 0usize;
+    for component in path.components() {
+        match component {
+            Component::Normal(_) => depth += 1,
+            Component::CurDir => {}
+            Component::ParentDir => match depth.checked_sub(1) {
+                Some(parent) => depth = parent,
+                None => return true,
+            },
+            Component::RootDir | Component::Prefix(_) => return true,
+        }
+    }
+    false
+}
+
+/// Renders statistics as the `--format json` report.
+fn report(stats: &DirectoryStats, thresholds: &Thresholds) -> std::result::Result<Value, ApiError> {
+    let json = format_output(stats, OutputFormat::Json, false, thresholds);
+    serde_json::from_str(&json).map_err(|e| ApiError::Failed(e.to_string()))
+}
+
+/// A JSON-RPC error response.
+fn rpc_error(id: Value, code: i64, message: &str) -> Response {
+    Response::json(
+        "200 OK",
+        &json!({ "jsonrpc": "2.0", "id": id, "error": { "code": code, "message": message } }),
+    )
+}
+
+/// Serves HTTP requests until the process is stopped.
+///
+/// Each handler runs on a thread of its own and takes the next connection
+/// once it has answered one, so a slow analysis only holds up its own client.
+///
+/// # Arguments
+///
+/// * `listen` - Address to listen on, e.g. `127.0.0.1:9100`; `:9100` listens
+///   on all interfaces
+/// * `handlers` - Answer requests, one connection at a time each
+///
+/// # Returns
+///
+/// * `Err(IoError)` - The address can't be bound
+pub(crate) fn serve<H>(listen: &str, handlers: Vec<H>) -> Result<()>
+where
+    H: FnMut(&Request) -> Response + Send,
+{
+    let address = match listen.strip_prefix(':') {
+        Some(port) => format!("0.0.0.0:{port}"),
+        None => listen.to_string(),
+    };
+    let listener = TcpListener::bind(&address)
+        .map_err(|e| CodeStatsError::IoError(format!("Failed to listen on {address}: {e}")))?;
+    eprintln!(
+        "Serving metrics on http://{address}{METRICS_PATH} and the API on http://{address}/analyze"
+    );
+    accept(&listener, handlers);
+    Ok(())
+}
+
+/// Answers the connections of a bound listener until the process is stopped,
+/// with one thread per handler as in `serve`.
+fn accept<H>(listener: &TcpListener, handlers: Vec<H>)
+where
+    H: FnMut(&Request) -> Response + Send,
+{
+    thread::scope(|scope| {
+        for mut handle in handlers {
+            scope.spawn(move || {
+                for stream in listener.incoming() {
+                    // A client that hangs up early only costs its own response
+                    let result = stream.and_then(|stream| respond(stream, &mut handle));
+                    if let Err(e) = result {
+                        eprintln!("Warning: {e}");
+                    }
+                }
+            });
+        }
+    });
+}
+
+/// Answers one HTTP request.
+fn respond(mut stream: TcpStream, handle: &mut impl FnMut(&Request) -> Response) -> io::Result<()> {
+    stream.set_read_timeout(Some(IO_TIMEOUT))?;
+    stream.set_write_timeout(Some(IO_TIMEOUT))?;
+    let mut reader = BufReader::new(&stream);
+    let response = match read_request(&mut reader) {
+        Ok(request) => handle(&request),
+        Err(e) if e.kind() == io::ErrorKind::InvalidData => {
+            Response::text("400 Bad Request", format!("{e}\n"))
+        }
+        Err(e) => return Err(e),
+    };
+    write!(
+        stream,
+        "HTTP/1.1 {}\r\nContent-Type: {}\r\nContent-Length: {}\r\nConnection: close\r\n\r\n{}",
+        response.status,
+        response.content_type,
+        response.body.len(),
+        response.body
+    )?;
+    stream.flush()
+}
+
+/// Reads a request line, the headers, and a body of `Content-Length` bytes.
+fn read_request(reader: &mut impl BufRead) -> io::Result<Request> {
+    let invalid = |message: String| io::Error::new(io::ErrorKind::InvalidData, message);
+    // Lines are read through the limit, so an endless header is not buffered
+    let mut head = (&mut *reader).take(MAX_HEADERS);
+    let mut read_line = |line: &mut String| {
+        let read = head.read_line(line)?;
+        if head.limit() == 0 && !line.ends_with('\n') {
+            return Err(invalid(format!(
+                "Request headers are over the limit of {MAX_HEADERS} bytes"
+            )));
+        }
+        Ok(read)
+    };
+    let mut request_line = String::new();
+    read_line(&mut request_line)?;
+
+    let mut content_length = 0;
+    let mut header = String::new();
+    while read_line(&mut header)? > 2 {
+        if let Some((name, value)) = header.split_once(':')
+            && name.trim().eq_ignore_ascii_case("content-length")
+        {
+            content_length = value
+                .trim()
+                .parse()
+                .map_err(|_| invalid(format!("Invalid Content-Length: {}", value.trim())))?;
+        }
+        header.clear();
+    }
+    if content_length > MAX_BODY {
+        return Err(invalid(format!(
+            "Request body of {content_length} bytes is over the limit of {MAX_BODY}"
+        )));
+    }
+    let mut body = vec![0; content_length];
+    reader.read_exact(&mut body)?;
+
+    let mut parts = request_line.split_whitespace();
+    let method = parts.next().unwrap_or_default().to_string();
+    let target = parts.next().unwrap_or_default();
+    let path = target.split('?').next().unwrap_or_default().to_string();
+    let body =
+        String::from_utf8(body).map_err(|_| invalid("Request body is not UTF-8".to_string()))?;
+    Ok(Request { method, path, body })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+
+    fn request(method: &str, path: &str, body: &str) -> Request {
+        Request {
+            method: method.to_string(),
+            path: path.to_string(),
+            body: body.to_string(),
+        }
+    }
+
+    fn body(response: &Response) -> Value {
+        serde_json::from_str(&response.body).unwrap()
+    }
+
+    #[test]
+    fn test_read_request() {
+        let raw =
+            "POST /query?x=1 HTTP/1.1\r\nHost: localhost\r\ncontent-length: 7\r\n\r\n{\"a\":1}";
+        let parsed = read_request(&mut raw.as_bytes()).unwrap();
+        assert_eq!(parsed, request("POST", "/query", "{\"a\":1}"));
+
+        let raw = "GET /metrics HTTP/1.1\r\nContent-Length: 99999999999\r\n\r\n";
+        let err = read_request(&mut raw.as_bytes()).unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::InvalidData);
+
+        let raw = format!("GET /metrics HTTP/1.1\r\nCookie: {}", "a".repeat(1 << 20));
+        let err = read_request(&mut raw.as_bytes()).unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::InvalidData);
+        assert!(
+            err.to_string()
+                .starts_with("Request headers are over the limit")
+        );
+
+        let raw = format!(
+            "GET /metrics HTTP/1.1\r\n{}\r\n",
+            "X-Header: a\r\n".repeat(100)
+        );
+        assert_eq!(
+            read_request(&mut raw.as_bytes()).unwrap(),
+            request("GET", "/metrics", "")
+        );
+    }
+
+    #[test]
+    fn test_escapes() {
+        assert!(!escapes(Path::new("src/lib.rs")));
+        assert!(!escapes(Path::new("./src/../lib.rs")));
+        assert!(!escapes(Path::new("")));
+        assert!(escapes(Path::new("..")));
+        assert!(escapes(Path::new("src/../../etc/passwd")));
+        assert!(escapes(Path::new("/etc/passwd")));
+    }
+
+    #[test]
+    fn test_routes_and_errors() {
+        let dir = tempfile::tempdir().unwrap();
+        let mut analyzer = CodeAnalyzer::new();
+        let mut server = Server::new(
+            &mut analyzer,
+            dir.path(),
+            DirectoryOptions::default(),
+            Thresholds::default(),
+        );
+
+        let response = server.handle(&request("GET", "/", ""));
+        assert_eq!(response.status, "404 Not Found");
+        let response = server.handle(&request("POST", "/metrics", ""));
+        assert_eq!(response.status, "405 Method Not Allowed");
+        let response = server.handle(&request("GET", "/analyze", ""));
+        assert_eq!(response.status, "405 Method Not Allowed");
+
+        let response = server.handle(&request("POST", "/analyze", "{\"file\": 1}"));
+        assert_eq!(response.status, "400 Bad Request");
+        assert!(
+            body(&response)["error"]
+                .as_str()
+                .unwrap()
+                .contains("unknown field")
+        );
+
+        let response = server.handle(&request("POST", "/analyze", "{\"path\": \"..\"}"));
+        assert_eq!(response.status, "403 Forbidden");
+        let response = server.handle(&request("POST", "/analyze", "{\"path\": \"missing.rs\"}"));
+        assert_eq!(response.status, "404 Not Found");
+        let response = server.handle(&request(
+            "POST",
+            "/analyze",
+            "{\"path\": \"../missing.rs\"}",
+        ));
+        assert_eq!(response.status, "403 Forbidden");
+
+        let response = server.handle(&request(
+            "POST",
+            "/analyze/buffer",
+            "{\"language\": \"cobol\", \"source\": \"\"}",
+        ));
+        assert_eq!(body(&response)["error"], "unknown language 'cobol'");
+        let response = server.handle(&request("POST", "/query", "{\"query\": \"(x)\"}"));
+        assert_eq!(
+            body(&response)["error"],
+            "exactly one of `path` or `source` is required"
+        );
+        let response = server.handle(&request("POST", "/outline", "{\"source\": \"\"}"));
+        assert_eq!(
+            body(&response)["error"],
+            "`language` is required with `source`"
+        );
+    }
+
+    #[test]
+    fn test_rpc() {
+        let dir = tempfile::tempdir().unwrap();
+        let mut analyzer = CodeAnalyzer::new();
+        let mut server = Server::new(
+            &mut analyzer,
+            dir.path(),
+            DirectoryOptions::default(),
+            Thresholds::default(),
+        );
+        let mut rpc = |body: &str| server.handle(&request("POST", "/rpc", body));
+
+        let response = body(&rpc("{"));
+        assert_eq!(response["error"]["code"], -32700);
+        let response = body(&rpc(r#"{"jsonrpc": "2.0", "id": 1, "method": "lint"}"#));
+        assert_eq!(response["id"], 1);
+        assert_eq!(response["error"]["code"], -32601);
+        let response = body(&rpc(r#"{"id": 2, "method": "query"}"#));
+        assert_eq!(response["error"]["code"], -32600);
+        let response = body(&rpc(
+            r#"{"jsonrpc": "2.0", "id": "a", "method": "analyze", "params": {"path": "/"}}"#,
+        ));
+        assert_eq!(response["id"], "a");
+        assert_eq!(response["error"]["code"], -32001);
+
+        let response = rpc(r#"{"jsonrpc": "2.0", "method": "analyze", "params": {"path": "."}}"#);
+        assert_eq!(response.status, "204 No Content");
+    }
+
+    #[test]
+    fn test_analyze_and_query() {
+        let dir = tempfile::tempdir().unwrap();
+        fs::write(dir.path().join("lib.rs"), "fn one() {}\nfn two() {}\n").unwrap();
+        let mut analyzer = CodeAnalyzer::new();
+        let mut server = Server::new(
+            &mut analyzer,
+            dir.path(),
+            DirectoryOptions::default(),
+            Thresholds::default(),
+        );
+
+        let response = server.handle(&request("POST", "/analyze", "{\"path\": \"lib.rs\"}"));
+        assert_eq!(response.status, "200 OK", "{}", response.body);
+        assert_eq!(body(&response)["total_stats"]["function_count"], 2);
+
+        let response = server.handle(&request(
+            "POST",
+            "/analyze/buffer",
+            r#"{"language": "go", "source": "package main\nfunc f() {}\n"}"#,
+        ));
+        assert_eq!(body(&response)["files"][0]["path"], "<buffer>");
+
+        let response = server.handle(&request(
+            "POST",
+            "/query",
+            r#"{"path": "lib.rs", "query": "(function_item name: (identifier) @name)"}"#,
+        ));
+        let response = body(&response);
+        assert_eq!(response["language"], "Rust");
+        let names: Vec<&str> = response["matches"]
+            .as_array()
+            .unwrap()
+            .iter()
+            .map(|found| found["captures"][0]["text"].as_str().unwrap())
+            .collect();
+        assert_eq!(names, ["one", "two"]);
+        assert_eq!(response["matches"][1]["captures"][0]["start_line"], 2);
+
+        let response = server.handle(&request(
+            "POST",
+            "/outline",
+            r#"{"language": "rust", "source": "struct S;\nimpl S {\n    fn new() {}\n}\n"}"#,
+        ));
+        let symbols = &body(&response)["symbols"];
+        assert_eq!(symbols[0]["name"], "S");
+        // The impl block has no name, so its methods sit at the top level
+        assert_eq!(symbols[1]["name"], "new");
+        assert_eq!(symbols[1]["start"], json!({ "line": 3, "column": 5 }));
+    }
+
+    #[test]
+    fn test_serve_answers_requests() {
+        let listener = TcpListener::bind("127.0.0.1:0").unwrap();
+        let address = listener.local_addr().unwrap();
+        let server = std::thread::spawn(move || {
+            let (stream, _) = listener.accept().unwrap();
+            respond(stream, &mut |request: &Request| {
+                Response::text("200 OK", format!("{} {}", request.method, request.body))
+            })
+            .unwrap();
+        });
+
+        let mut client = TcpStream::connect(address).unwrap();
+        client
+            .write_all(b"POST /rpc HTTP/1.1\r\nHost: localhost\r\nContent-Length: 2\r\n\r\n{}")
+            .unwrap();
+        let mut response = String::new();
+        client.read_to_string(&mut response).unwrap();
+        server.join().unwrap();
+
+        assert!(response.starts_with("HTTP/1.1 200 OK\r\n"));
+        assert!(response.contains("Content-Length: 7\r\n"));
+        assert!(response.ends_with("\r\n\r\nPOST {}"));
+    }
+
+    #[test]
+    fn test_serve_answers_connections_concurrently() {
+        let listener = TcpListener::bind("127.0.0.1:0").unwrap();
+        let address = listener.local_addr().unwrap();
+        // Each handler waits for the other to take a request too, so both
+        // answer "together" only if two requests are in flight at once
+        let arrived = std::sync::Arc::new((std::sync::Mutex::new(0), std::sync::Condvar::new()));
+        let handlers: Vec<_> = (0..2)
+            .map(|_| {
+                let arrived = arrived.clone();
+                move |_: &Request| {
+                    let (count, changed) = &*arrived;
+                    let mut count = count.lock().unwrap();
+                    *count += 1;
+                    changed.notify_all();
+                    let (count, _) = changed
+                        .wait_timeout_while(count, Duration::from_secs(10), |count| *count < 2)
+                        .unwrap();
+                    let answer = if *count < 2 { "alone" } else { "together" };
+                    Response::text("200 OK", answer.to_string())
+                }
+            })
+            .collect();
+        std::thread::spawn(move || accept(&listener, handlers));
+
+        let send = |path: &str| {
+            let mut client = TcpStream::connect(address).unwrap();
+            write!(client, "GET {path} HTTP/1.1\r\n\r\n").unwrap();
+            client
+        };
+        let clients = [send("/a"), send("/b")];
+        for mut client in clients {
+            let mut response = String::new();
+            client.read_to_string(&mut response).unwrap();
+            assert!(response.ends_with("together"), "{response}");
+        }
+    }
+}
@@ -0,0 +1,1151 @@
+//! Function signature details: display names, qualified names, parameters,
+//! and return values.
+
+use crate::beam::{self, elixir_call_name};
+use crate::complexity::is_function;
+use crate::functional;
+use crate::graphql::graphql_name;
+use crate::language::SupportedLanguage;
+use crate::systems::{self, nim_parameter_weight};
+use tree_sitter::Node;
+
+/// Returns a display name for a function node.
+///
+/// Named declarations use their `name` field, in Groovy their `function`
+/// field, or, in Kotlin, their identifier; Elixir and Erlang functions are
+/// named with their arity, as in `add/2`, and OCaml `let`s by their pattern;
+/// C and C++ functions the name in their function declarator (`Widget::draw`
+/// for out-of-line members), Nim routines their name without the `*` export
+/// marker, Zig `test` blocks their description, Lua functions their name as
+/// declared, as in `Cart:add` or `M.total`, and SCSS mixins and functions
+/// their identifier.
+/// Anonymous functions assigned to a variable or object key take that name;
+/// Kotlin secondary constructors are `constructor` and Swift initializers
+/// `init` and `deinit`; anything else is `<anonymous>`.
+pub(crate) fn function_name(node: &Node, source: &[u8]) -> String {
+    let text = |n: Node| n.utf8_text(source).ok().map(str::to_string);
+
+    if let Some(name) = beam::function_name(node, source) {
+        return name;
+    }
+    if let Some(name) = functional::binding_name(node, source) {
+        return name.to_string();
+    }
+    if let Some(name) = node
+        .child_by_field_name("name")
+        .filter(|name| name.kind() == "exported_symbol")
+        .and_then(|_| systems::nim_name(node))
+        .and_then(text)
+    {
+        return name;
+    }
+    if let Some(name) = node
+        .child_by_field_name("name")
+        .or_else(|| node.child_by_field_name("function"))
+        .and_then(text)
+    {
+        return name;
+    }
+    if let Some(name) = function_declarator(node)
+        .and_then(|declarator| declarator.child_by_field_name("declarator"))
+        .and_then(text)
+    {
+        return name;
+    }
+    if let Some(name) = kotlin_identifier(node).and_then(text) {
+        return name;
+    }
+    if let Some(name) = proto_name(node).and_then(text) {
+        return name;
+    }
+    if let Some(name) = graphql_name(node).and_then(text) {
+        return name;
+    }
+    // Kotlin's `constructor(...)` is named by its keyword
+    if node.kind() == "secondary_constructor" {
+        return "constructor".to_string();
+    }
+    match node.kind() {
+        "init_declaration" => return "init".to_string(),
+        // Zig `test "adds items" { ... }`, or `test add { ... }` for the
+        // doctest of a declaration
+        "test_declaration" => {
+            let mut cursor = node.walk();
+            let description = node
+                .named_children(&mut cursor)
+                .find(|child| matches!(child.kind(), "string" | "identifier"))
+                .and_then(text);
+            return description.map_or_else(
+                || "test".to_string(),
+                |description| description.trim_matches('"').to_string(),
+            );
+        }
+        "deinit_declaration" => return "deinit".to_string(),
+        // A Make rule is named by its targets, as in `build test`
+        "rule" => {
+            let mut cursor = node.walk();
+            let targets = node
+                .named_children(&mut cursor)
+                .find(|child| child.kind() == "targets")
+                .and_then(text);
+            if let Some(targets) = targets {
+                return targets.split_whitespace().collect::<Vec<_>>().join(" ");
+            }
+        }
+        // SCSS `@mixin button($size)` and `@function rem($px)`
+        "mixin_statement" | "function_statement" => {
+            let mut cursor = node.walk();
+            let name = node
+                .named_children(&mut cursor)
+                .find(|child| child.kind() == "identifier")
+                .and_then(text);
+            if let Some(name) = name {
+                return name;
+            }
+        }
+        _ => {}
+    }
+
+    let assigned = node.parent().and_then(|parent| match parent.kind() {
+        "variable_declarator" => parent.child_by_field_name("name"),
+        // C++ `auto f = [](int x) { ... };`
+        "init_declarator" => parent.child_by_field_name("declarator"),
+        // JavaScript `f = function() {}`, Ruby `f = ->(x) { ... }`
+        "assignment_expression" | "assignment" => parent.child_by_field_name("left"),
+        "pair" => parent.child_by_field_name("key"),
+        // Scala `val f = (x: Int) => x * 2`
+        "val_definition" | "var_definition" => parent.child_by_field_name("pattern"),
+        // Elixir `add = fn a, b -> a + b end`
+        "binary_operator"
+            if parent
+                .child_by_field_name("operator")
+                .is_some_and(|operator| operator.kind() == "=") =>
+        {
+            parent.child_by_field_name("left")
+        }
+        // Erlang `Add = fun(A, B) -> A + B end`
+        "match_expr" => parent.child_by_field_name("lhs"),
+        // Haskell `double = \x -> x * 2`
+        "match" => parent
+            .parent()
+            .filter(|bind| bind.kind() == "bind")
+            .and_then(|bind| bind.child_by_field_name("name")),
+        // OCaml `let double = fun x -> x * 2`
+        "let_binding" => parent.child_by_field_name("pattern"),
+        // Lua `local double = function(x) ... end` and `M.double = ...`,
+        // and `{ double = function(x) ... end }`
+        "expression_list" => lua_assigned_variable(node, &parent),
+        "field" => parent.child_by_field_name("name"),
+        // Kotlin `val f = { x: Int -> x }`, Swift `let f = { (x: Int) in x }`
+        "property_declaration" => parent.child_by_field_name("name").or_else(|| {
+            let mut cursor = parent.walk();
+            parent
+                .named_children(&mut cursor)
+                .find(|child| child.kind() == "variable_declaration")
+                .and_then(|declaration| kotlin_identifier(&declaration))
+        }),
+        _ => None,
+    });
+
+    assigned
+        .and_then(text)
+        .unwrap_or_else(|| "<anonymous>".to_string())
+}
+
+/// Returns the function's name qualified by its enclosing scopes.
+///
+/// Scopes are modules, traits and impl blocks in Rust, classes in Python,
+/// JavaScript, TypeScript and Java, namespaces and types in C#, classes and
+/// objects in Kotlin, types, extensions, and protocols in Swift, classes,
+/// objects, traits, and enums in Scala, types in Groovy, the
+/// receiver type of Go methods, and any
+/// named enclosing function. Rust names are joined with `::`, all others
+/// with `.`; for example `Config::new`, `Person.Greet`, or `Outer.inner`.
+/// C++ namespaces, classes, structs, and unions are scopes joined with `::`.
+/// Ruby classes and modules are joined with `::` and followed by `#name` for
+/// instance methods or `.name` for singleton methods, as in `Shop::Cart#add`.
+/// PHP classes, interfaces, traits, and enums are joined with `::` after the
+/// namespace, as in `App\Models\Cart::add`. Elixir functions are qualified
+/// by their modules, as in `Shop.Cart.add/2`, and Erlang functions by the
+/// module of the file, as in `cart:add/2`. Haskell functions are qualified by
+/// the module of their file (`Shop.Cart.total`) and OCaml functions by the
+/// modules they are defined in. Zig functions are qualified by the named
+/// containers around them, as in `Cart.add`.
+pub(crate) fn qualified_name(node: &Node, source: &[u8], language: &SupportedLanguage) -> String {
+    let mut parts = vec![function_name(node, source)];
+
+    if *language == SupportedLanguage::Go
+        && let Some(receiver) = go_receiver_type(node, source)
+    {
+        parts.push(receiver);
+    }
+
+    parts.extend(enclosing_scopes(node, source, language));
+    parts.reverse();
+    if *language == SupportedLanguage::Ruby
+        && let Some((name, scopes)) = parts.split_last()
+        && !scopes.is_empty()
+    {
+        let marker = if is_ruby_singleton_method(node) {
+            "."
+        } else {
+            "#"
+        };
+        return format!("{}{marker}{name}", scopes.join("::"));
+    }
+    if *language == SupportedLanguage::Php {
+        return php_qualified_name(node, source, &parts);
+    }
+    if *language == SupportedLanguage::Erlang
+        && let Some(module) = beam::erlang_module(node, source)
+    {
+        return format!("{module}:{}", parts.join("."));
+    }
+    if *language == SupportedLanguage::Haskell
+        && let Some(module) = functional::haskell_module(node, source)
+    {
+        parts.insert(0, module.to_string());
+    }
+    let separator = if matches!(language, SupportedLanguage::Rust | SupportedLanguage::Cpp) {
+        "::"
+    } else {
+        "."
+    };
+    parts.join(separator)
+}
+
+/// Returns the name of a type declaration qualified by its enclosing scopes.
+///
+/// Names are joined as in `qualified_name`, so a type's name is the prefix of
+/// the qualified names of its methods: `shapes::Point` for `shapes::Point::new`,
+/// `Shop::Cart` for `Shop::Cart#add`, or `Shop.Models.Cart` for
+/// `Shop.Models.Cart.Add`. An Elixir struct is named by the module defining
+/// it, a Zig container by the constant it is assigned to, and a Nim object
+/// by its `type` declaration.
+///
+/// # Returns
+///
+/// The qualified name, or `None` for anonymous types.
+pub(crate) fn qualified_type_name(
+    node: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> Option<String> {
+    if *language == SupportedLanguage::Elixir
+        && matches!(
+            elixir_call_name(node, source),
+            Some("defstruct" | "defexception")
+        )
+    {
+        let mut scopes = enclosing_scopes(node, source, language);
+        scopes.reverse();
+        return (!scopes.is_empty()).then(|| scopes.join("."));
+    }
+    let name = language.rules().type_name(node, source)?;
+    let mut parts = vec![name.to_string()];
+    parts.extend(enclosing_scopes(node, source, language));
+    parts.reverse();
+    if *language == SupportedLanguage::Php {
+        return Some(php_qualified_name(node, source, &parts));
+    }
+
+    let separator = if matches!(
+        language,
+        SupportedLanguage::Rust | SupportedLanguage::Cpp | SupportedLanguage::Ruby
+    ) {
+        "::"
+    } else {
+        "."
+    };
+    Some(parts.join(separator))
+}
+
+/// Returns the names of the scopes enclosing `node`, innermost first.
+///
+/// A C# file-scoped namespace (`namespace Shop;`) precedes the declarations
+/// it applies to rather than containing them, so it is looked up among the
+/// children of the root.
+fn enclosing_scopes(node: &Node, source: &[u8], language: &SupportedLanguage) -> Vec<String> {
+    let mut scopes = Vec::new();
+    let mut in_namespace = false;
+    let mut current = node.parent();
+    while let Some(ancestor) = current {
+        if let Some(scope) = scope_name(&ancestor, source, language) {
+            scopes.push(scope);
+        }
+        in_namespace |= ancestor.kind() == "file_scoped_namespace_declaration";
+        if ancestor.parent().is_none() && *language == SupportedLanguage::CSharp && !in_namespace {
+            let mut cursor = ancestor.walk();
+            let namespace = ancestor
+                .children(&mut cursor)
+                .take_while(|child| child.start_byte() < node.start_byte())
+                .filter(|child| child.kind() == "file_scoped_namespace_declaration")
+                .last();
+            if let Some(name) = namespace
+                .and_then(|namespace| namespace.child_by_field_name("name"))
+                .and_then(|name| name.utf8_text(source).ok())
+            {
+                scopes.push(name.to_string());
+            }
+        }
+        current = ancestor.parent();
+    }
+    scopes
+}
+
+/// Joins PHP scopes with `::` and prefixes the namespace `node` is declared
+/// in, if any.
+///
+/// A namespace either wraps its declarations in braces or, far more often,
+/// is a `namespace App\Models;` statement that applies to the rest of the
+/// file, which is looked up among the children of the root.
+fn php_qualified_name(node: &Node, source: &[u8], parts: &[String]) -> String {
+    let name = parts.join("::");
+    let mut namespace = None;
+    let mut current = node.parent();
+    while let Some(ancestor) = current {
+        if ancestor.kind() == "namespace_definition" {
+            namespace = Some(ancestor);
+            break;
+        }
+        if ancestor.parent().is_none() {
+            let mut cursor = ancestor.walk();
+            namespace = ancestor
+                .children(&mut cursor)
+                .take_while(|child| child.start_byte() < node.start_byte())
+                .filter(|child| {
+                    child.kind() == "namespace_definition"
+                        && child.child_by_field_name("body").is_none()
+                })
+                .last();
+        }
+        current = ancestor.parent();
+    }
+
+    match namespace
+        .and_then(|namespace| namespace.child_by_field_name("name"))
+        .and_then(|name| name.utf8_text(source).ok())
+    {
+        Some(namespace) => format!("{namespace}\\{name}"),
+        None => name,
+    }
+}
+
+/// Returns the name a node contributes to qualified names, if it is a scope.
+fn scope_name(node: &Node, source: &[u8], language: &SupportedLanguage) -> Option<String> {
+    if is_function(node, source, language) {
+        let name = function_name(node, source);
+        return (name != "<anonymous>").then_some(name);
+    }
+
+    language.rules().scope_name(node, source)
+}
+
+/// Returns the variable a Lua assignment assigns `value`, an element of its
+/// `expression_list`, to: the variable at the same position, as in
+/// `local add, remove = function() end, function() end`.
+fn lua_assigned_variable<'tree>(value: &Node, list: &Node<'tree>) -> Option<Node<'tree>> {
+    let mut cursor = list.walk();
+    let position = list
+        .named_children(&mut cursor)
+        .position(|child| child.id() == value.id())?;
+    let assignment = list
+        .parent()
+        .filter(|parent| parent.kind() == "assignment_statement")?;
+    let mut cursor = assignment.walk();
+    let variables = assignment
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "variable_list")?;
+    let mut cursor = variables.walk();
+    variables.named_children(&mut cursor).nth(position)
+}
+
+/// Returns true for Ruby methods defined on an object rather than on its
+/// instances: `def self.name` and any `def` inside `class << self`.
+pub(crate) fn is_ruby_singleton_method(node: &Node) -> bool {
+    node.kind() == "singleton_method"
+        || node
+            .parent()
+            .filter(|body| body.kind() == "body_statement")
+            .and_then(|body| body.parent())
+            .is_some_and(|owner| owner.kind() == "singleton_class")
+}
+
+/// Returns the identifier naming a Kotlin declaration, which the grammar
+/// leaves without a field name.
+pub(crate) fn kotlin_identifier<'a>(node: &Node<'a>) -> Option<Node<'a>> {
+    let mut cursor = node.walk();
+    node.named_children(&mut cursor)
+        .find(|child| matches!(child.kind(), "simple_identifier" | "type_identifier"))
+}
+
+/// Returns the name node of a Protobuf message, enum, service, or RPC
+/// method: the `message_name`, `enum_name`, `service_name`, or `rpc_name`
+/// child, as the grammar has no `name` field.
+pub(crate) fn proto_name<'a>(node: &Node<'a>) -> Option<Node<'a>> {
+    let name_kind = match node.kind() {
+        "message" => "message_name",
+        "enum" => "enum_name",
+        "service" => "service_name",
+        "rpc" => "rpc_name",
+        _ => return None,
+    };
+    let mut cursor = node.walk();
+    node.named_children(&mut cursor)
+        .find(|child| child.kind() == name_kind)
+}
+
+/// Returns the function declarator of a C or C++ function definition or
+/// lambda, looking through pointer, reference, and parenthesized declarators
+/// (`char *name(void)`, `const std::string &name()`).
+fn function_declarator<'a>(node: &Node<'a>) -> Option<Node<'a>> {
+    let mut declarator = node.child_by_field_name("declarator")?;
+    loop {
+        match declarator.kind() {
+            "function_declarator" | "abstract_function_declarator" => return Some(declarator),
+            "pointer_declarator"
+            | "reference_declarator"
+            | "parenthesized_declarator"
+            | "attributed_declarator" => {
+                // Reference and parenthesized declarators wrap an unnamed child
+                let inner = declarator.child_by_field_name("declarator").or_else(|| {
+                    let mut cursor = declarator.walk();
+                    declarator.named_children(&mut cursor).last()
+                });
+                declarator = inner?;
+            }
+            _ => return None,
+        }
+    }
+}
+
+/// Returns the receiver type name of a Go method, without pointer or type parameters.
+pub(crate) fn go_receiver_type(node: &Node, source: &[u8]) -> Option<String> {
+    let receiver = node.child_by_field_name("receiver")?;
+    let mut cursor = receiver.walk();
+    let declaration = receiver
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "parameter_declaration")?;
+    let type_text = declaration
+        .child_by_field_name("type")?
+        .utf8_text(source)
+        .ok()?;
+
+    let name = type_text.trim_start_matches('*');
+    let name = name.split('[').next().unwrap_or(name);
+    Some(name.trim().to_string())
+}
+
+/// Counts the declared parameters of a function node.
+///
+/// `self` counts as a parameter in Rust and Python methods, as it does in
+/// their grammars. Go receivers live in a separate field and Java receiver
+/// parameters are skipped, so neither is counted. Go declarations that share
+/// a type (`a, b int`) count once per name. A C `(void)` parameter list
+/// declares no parameters. A Kotlin lambda using the implicit `it` declares
+/// none either, nor does a Swift closure using `$0`. The parameters of all
+/// lists of a curried Scala `def` count, `using` clauses included. Elixir
+/// and Erlang functions have their arity, and Haskell and OCaml functions one
+/// parameter per pattern they take. SCSS mixins and functions count their
+/// `$` parameters, with or without default values.
+pub(crate) fn parameter_count(node: &Node, source: &[u8], language: &SupportedLanguage) -> usize {
+    if let Some(count) = language.rules().arity(node) {
+        return count;
+    }
+    let parameters = node.child_by_field_name("parameters").or_else(|| {
+        function_declarator(node)
+            .and_then(|declarator| declarator.child_by_field_name("parameters"))
+    });
+    if let Some(parameters) = parameters {
+        // C# lambdas with a single unparenthesized parameter: `x => x`
+        if parameters.kind() == "implicit_parameter" {
+            return 1;
+        }
+        let mut cursor = parameters.walk();
+        parameters
+            .named_children(&mut cursor)
+            .map(|parameter| parameter_weight(&parameter, source, language))
+            .sum()
+    } else {
+        // Arrow functions with a single unparenthesized parameter: `x => x`
+        usize::from(node.child_by_field_name("parameter").is_some())
+    }
+}
+
+/// Counts the parameters of a Zig function or an SCSS mixin or function,
+/// which sit in its `parameters` child; Zig `test` blocks have none.
+pub(crate) fn listed_parameter_count(node: &Node) -> usize {
+    let mut cursor = node.walk();
+    node.named_children(&mut cursor)
+        .find(|child| child.kind() == "parameters")
+        .map_or(0, |parameters| {
+            let mut cursor = parameters.walk();
+            parameters
+                .named_children(&mut cursor)
+                .filter(|parameter| parameter.kind() == "parameter")
+                .count()
+        })
+}
+
+/// Counts the values a function node returns.
+///
+/// Go results and Rust return types are declared, so they are counted from
+/// the signature: `(int, error)` returns two values, a Rust tuple type one
+/// per element, and `()` none. Elsewhere it is the widest explicit `return`
+/// in the function's own body, not counting the functions nested in it: a
+/// Python or Ruby `return a, b` returns two values, a bare `return` none,
+/// and any other `return` one. Arrow functions and lambdas whose body is an
+/// expression return one value. Bash functions and Make rules only have exit
+/// statuses and return none; a Protobuf RPC returns its response message.
+/// A Scala `def` returns its body's value unless it is declared `Unit`, and
+/// every Elixir, Erlang, Haskell, and OCaml function returns the value of
+/// its last expression. A Nim routine, which may set `result` instead of
+/// returning, returns one value if it declares a type other than `void`.
+pub(crate) fn return_count(node: &Node, source: &[u8], language: &SupportedLanguage) -> usize {
+    match language.rules().declared_returns(node, source) {
+        Some(count) => count,
+        None if language.rules().has_expression_body(node) => 1,
+        None => widest_return(node, source, language),
+    }
+}
+
+/// Returns the number of values of the widest `return` under `node`,
+/// skipping nested functions, which return to their own callers.
+fn widest_return(node: &Node, source: &[u8], language: &SupportedLanguage) -> usize {
+    let mut cursor = node.walk();
+    node.named_children(&mut cursor)
+        .filter(|child| !is_function(child, source, language))
+        .map(|child| {
+            let own = if language.rules().is_return(&child) {
+                // `return a, b` lists its values in a single child
+                let mut cursor = child.walk();
+                let values: Vec<Node> = child
+                    .named_children(&mut cursor)
+                    .filter(|value| !value.kind().contains("comment"))
+                    .collect();
+                match values.as_slice() {
+                    [list] if matches!(list.kind(), "expression_list" | "argument_list") => {
+                        value_count(list)
+                    }
+                    values => values.len().min(1),
+                }
+            } else {
+                0
+            };
+            own.max(widest_return(&child, source, language))
+        })
+        .max()
+        .unwrap_or(0)
+}
+
+/// Counts the named children of a tuple type or value list, without comments.
+pub(crate) fn value_count(list: &Node) -> usize {
+    let mut cursor = list.walk();
+    list.named_children(&mut cursor)
+        .filter(|value| !value.kind().contains("comment"))
+        .count()
+}
+
+/// Returns how many parameters a child of a parameter list declares.
+pub(crate) fn parameter_weight(
+    parameter: &Node,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> usize {
+    match parameter.kind() {
+        "comment" | "line_comment" | "block_comment" | "attribute_item" => 0,
+        // Python's bare `*` and `/` markers
+        "keyword_separator" | "positional_separator" => 0,
+        // Java's explicit `Foo this` receiver
+        "receiver_parameter" => 0,
+        "parameter_declaration" if *language == SupportedLanguage::Nim => {
+            nim_parameter_weight(parameter)
+        }
+        "parameter_declaration" | "variadic_parameter_declaration"
+            if *language == SupportedLanguage::Go =>
+        {
+            let mut cursor = parameter.walk();
+            parameter
+                .children_by_field_name("name", &mut cursor)
+                .count()
+                .max(1)
+        }
+        "parameter_declaration"
+            if matches!(language, SupportedLanguage::C | SupportedLanguage::Cpp)
+                && parameter.child_by_field_name("declarator").is_none()
+                && parameter
+                    .utf8_text(source)
+                    .is_ok_and(|text| text.trim() == "void") =>
+        {
+            0
+        }
+        _ => 1,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use crate::language::SupportedLanguage;
+    use crate::parser::{analyze_code, create_parser};
+
+    /// Returns `(qualified_name, parameters)` for each function in `source`.
+    fn signatures(source: &str, language: SupportedLanguage) -> Vec<(String, usize)> {
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, source, "test", &language).unwrap();
+        stats
+            .functions
+            .into_iter()
+            .map(|f| (f.qualified_name, f.parameters))
+            .collect()
+    }
+
+    fn owned(expected: &[(&str, usize)]) -> Vec<(String, usize)> {
+        expected
+            .iter()
+            .map(|(name, params)| (name.to_string(), *params))
+            .collect()
+    }
+
+    #[test]
+    fn test_rust_signatures() {
+        let source = r#"
+mod shapes {
+    struct Point;
+    impl Point {
+        fn new(x: i32, y: i32) -> Self { Point }
+        fn norm(&self) -> i32 { 0 }
+    }
+    impl std::fmt::Display for Point {
+        fn fmt(&self, f: &mut std::fmt::Formatter) -> std::fmt::Result { Ok(()) }
+    }
+}
+fn free() {}
+"#;
+        assert_eq!(
+            signatures(source, SupportedLanguage::Rust),
+            owned(&[
+                ("shapes::Point::new", 2),
+                ("shapes::Point::norm", 1),
+                ("shapes::Point::fmt", 2),
+                ("free", 0),
+            ])
+        );
+    }
+
+    #[test]
+    fn test_go_signatures() {
+        let source = r#"
+package main
+
+func (p *Person) Greet(greeting string) {}
+func (s Stack[T]) Push(v T) {}
+func add(a, b int) int { return a + b }
+func variadic(format string, args ...any) {}
+"#;
+        assert_eq!(
+            signatures(source, SupportedLanguage::Go),
+            owned(&[
+                ("Person.Greet", 1),
+                ("Stack.Push", 1),
+                ("add", 2),
+                ("variadic", 2),
+            ])
+        );
+    }
+
+    #[test]
+    fn test_python_signatures() {
+        let source = r#"
+class Greeter:
+    def greet(self, name, *, loud=False):
+        def shout(text):
+            return text.upper()
+        return shout(name)
+
+def top(*args, **kwargs):
+    pass
+"#;
+        assert_eq!(
+            signatures(source, SupportedLanguage::Python),
+            owned(&[("Greeter.greet", 3), ("Greeter.greet.shout", 1), ("top", 2),])
+        );
+    }
+
+    #[test]
+    fn test_javascript_signatures() {
+        let source = r#"
+class Calculator {
+    add(a, b = 0) { return a + b; }
+}
+const double = x => x * 2;
+const sum = (...values) => values.reduce((a, b) => a + b, 0);
+"#;
+        assert_eq!(
+            signatures(source, SupportedLanguage::JavaScript),
+            owned(&[
+                ("Calculator.add", 2),
+                ("double", 1),
+                ("sum", 1),
+                ("sum.<anonymous>", 2),
+            ])
+        );
+    }
+
+    #[test]
+    fn test_java_signatures() {
+        let source = r#"
+public class Account {
+    public Account(String owner) {}
+    public void deposit(long amount, String memo) {}
+    interface Listener { void changed(); }
+}
+"#;
+        assert_eq!(
+            signatures(source, SupportedLanguage::Java),
+            owned(&[
+                ("Account.Account", 1),
+                ("Account.deposit", 2),
+                ("Account.Listener.changed", 0),
+            ])
+        );
+    }
+
+    #[test]
+    fn test_c_signatures() {
+        let source = r#"
+static int add(int a, int b) { return a + b; }
+char *dup(const char *s, ...) { return 0; }
+void reset(void) {}
+"#;
+        assert_eq!(
+            signatures(source, SupportedLanguage::C),
+            owned(&[("add", 2), ("dup", 2), ("reset", 0)])
+        );
+    }
+
+    #[test]
+    fn test_cpp_signatures() {
+        let source = r#"
+namespace gfx {
+class Widget {
+public:
+    Widget(int w, int h) {}
+    ~Widget() {}
+    const std::string &label() const { return label_; }
+};
+
+void Widget::draw(Canvas &canvas) {
+    auto scale = [](double factor) { return factor; };
+}
+}
+"#;
+        assert_eq!(
+            signatures(source, SupportedLanguage::Cpp),
+            owned(&[
+                ("gfx::Widget::Widget", 2),
+                ("gfx::Widget::~Widget", 0),
+                ("gfx::Widget::label", 0),
+                ("gfx::Widget::draw", 1),
+                ("gfx::Widget::draw::scale", 1),
+            ])
+        );
+    }
+
+    #[test]
+    fn test_ruby_signatures() {
+        let source = r#"
+module Shop
+  class Cart
+    def add(item, qty = 1, *rest, key:, **opts, &block); end
+
+    def self.empty; end
+
+    class << self
+      def build(items); end
+    end
+  end
+end
+
+square = ->(x) { x * x }
+"#;
+        assert_eq!(
+            signatures(source, SupportedLanguage::Ruby),
+            owned(&[
+                ("Shop::Cart#add", 6),
+                ("Shop::Cart.empty", 0),
+                ("Shop::Cart.build", 1),
+                ("square", 1),
+            ])
+        );
+    }
+
+    #[test]
+    fn test_kotlin_signatures() {
+        let source = r#"
+class Cart(val owner: String) {
+    constructor() : this("guest")
+
+    fun add(item: String, quantity: Int = 1, vararg tags: String) {}
+
+    companion object {
+        fun empty(): Cart = Cart()
+    }
+}
+
+object Registry {
+    fun register(cart: Cart) {}
+}
+
+fun String.shout(): String = uppercase()
+
+val pair = { (a, b): Pair<Int, Int>, c: Int -> a + b + c }
+val implicit = listOf(1).map { it * 2 }
+"#;
+        assert_eq!(
+            signatures(source, SupportedLanguage::Kotlin),
+            owned(&[
+                ("Cart.constructor", 0),
+                ("Cart.add", 3),
+                ("Cart.empty", 0),
+                ("Registry.register", 1),
+                ("shout", 0),
+                ("pair", 2),
+                ("<anonymous>", 0),
+            ])
+        );
+    }
+
+    #[test]
+    fn test_scala_signatures() {
+        let source = r#"
+package shop
+
+class Cart(owner: String) {
+  def add(item: String, quantity: Int = 1): Unit = {}
+  def total: Double = 0.0
+}
+
+object Cart {
+  def merge(a: Cart, b: Cart)(using ctx: Context): Cart = a
+}
+
+trait Pricing {
+  def price(item: String): Double
+}
+
+val double = (x: Int) => x * 2
+val sum = (a: Int, b: Int) => a + b
+"#;
+        assert_eq!(
+            signatures(source, SupportedLanguage::Scala),
+            owned(&[
+                ("Cart.add", 2),
+                ("Cart.total", 0),
+                ("Cart.merge", 3),
+                ("Pricing.price", 1),
+                ("double", 1),
+                ("sum", 2),
+            ])
+        );
+    }
+
+    #[test]
+    fn test_elixir_and_erlang_signatures() {
+        let source = r#"
+defmodule Shop do
+  defmodule Cart do
+    def add(cart, item, quantity \\ 1), do: [{item, quantity} | cart]
+
+    def total(cart) do
+      price = fn {_item, quantity} -> quantity * 10 end
+      Enum.sum(Enum.map(cart, price))
+    end
+  end
+end
+"#;
+        assert_eq!(
+            signatures(source, SupportedLanguage::Elixir),
+            owned(&[
+                ("Shop.Cart.add/3", 3),
+                ("Shop.Cart.total/1", 1),
+                ("Shop.Cart.total/1.price", 1),
+            ])
+        );
+
+        let source = "-module(cart).\n\nadd(Cart, Item) -> [Item | Cart].\n\ntotal([]) -> 0;\ntotal([_ | Rest]) -> 1 + total(Rest).\n";
+        assert_eq!(
+            signatures(source, SupportedLanguage::Erlang),
+            owned(&[("cart:add/2", 2), ("cart:total/1", 1)])
+        );
+    }
+
+    #[test]
+    fn test_haskell_and_ocaml_signatures() {
+        let source = "module Shop.Cart where\n\nadd :: Item -> Cart -> Cart\nadd item cart = item : cart\n\ntotal [] = 0\ntotal (_ : rest) = 1 + total rest\n\ndouble = \\x -> x * 2\n";
+        assert_eq!(
+            signatures(source, SupportedLanguage::Haskell),
+            owned(&[
+                ("Shop.Cart.add", 2),
+                ("Shop.Cart.total", 1),
+                ("Shop.Cart.total", 1),
+                ("Shop.Cart.double", 1),
+            ])
+        );
+
+        let source = "module Cart = struct\n  let add item cart = item :: cart\n  let double = fun x -> x * 2\nend\n\nlet total cart = List.length cart\n";
+        assert_eq!(
+            signatures(source, SupportedLanguage::OCaml),
+            owned(&[("Cart.add", 2), ("Cart.double", 1), ("total", 1)])
+        );
+    }
+
+    #[test]
+    fn test_zig_and_nim_signatures() {
+        let source = r#"
+const Cart = struct {
+    items: u32,
+
+    pub fn add(self: *Cart, item: u32) void {
+        self.items += item;
+    }
+};
+
+pub fn total(cart: Cart) u32 {
+    return cart.items;
+}
+
+test "adds items" {}
+"#;
+        assert_eq!(
+            signatures(source, SupportedLanguage::Zig),
+            owned(&[("Cart.add", 2), ("total", 1), ("adds items", 0)])
+        );
+
+        let source = "proc add*(cart: var Cart, item, note: string) =\n  cart.items.add(item)\n\ntemplate check(condition: bool) =\n  doAssert condition\n";
+        assert_eq!(
+            signatures(source, SupportedLanguage::Nim),
+            owned(&[("add", 3), ("check", 1)])
+        );
+    }
+
+    #[test]
+    fn test_lua_signatures() {
+        let source = r#"
+local Cart = {}
+
+function Cart.new(items)
+  return setmetatable({ items = items }, { __index = Cart })
+end
+
+function Cart:add(item, quantity)
+  table.insert(self.items, item)
+end
+
+local function log(...)
+  print(...)
+end
+
+Cart.total = function(self) return #self.items end
+"#;
+        // `self` is implicit in `Cart:add`
+        assert_eq!(
+            signatures(source, SupportedLanguage::Lua),
+            owned(&[
+                ("Cart.new", 1),
+                ("Cart:add", 2),
+                ("log", 1),
+                ("Cart.total", 1)
+            ])
+        );
+    }
+
+    #[test]
+    fn test_csharp_signatures() {
+        let source = r#"
+namespace Shop.Models
+{
+    public class Cart
+    {
+        public Cart(string owner) {}
+
+        public void Add(Item item, int quantity = 1, params string[] tags)
+        {
+            Func<int, int> twice = x => x * 2;
+        }
+
+        public static bool TryParse(string text, out Cart cart) { cart = null; return false; }
+    }
+}
+"#;
+        assert_eq!(
+            signatures(source, SupportedLanguage::CSharp),
+            owned(&[
+                ("Shop.Models.Cart.Cart", 1),
+                ("Shop.Models.Cart.Add", 3),
+                ("Shop.Models.Cart.Add.twice", 1),
+                ("Shop.Models.Cart.TryParse", 2),
+            ])
+        );
+    }
+
+    #[test]
+    fn test_swift_signatures() {
+        let source = r#"
+struct Cart {
+    init(owner: String, items: [String] = []) {}
+
+    func add(_ item: String, quantity: Int) {}
+
+    deinit {}
+}
+
+extension Cart {
+    func clear() {}
+}
+
+protocol Store {
+    func save(_ cart: Cart)
+}
+
+let pair = { (a: Int, b: Int) in a + b }
+let implicit = [1].map { $0 * 2 }
+"#;
+        assert_eq!(
+            signatures(source, SupportedLanguage::Swift),
+            owned(&[
+                ("Cart.init", 2),
+                ("Cart.add", 2),
+                ("Cart.deinit", 0),
+                ("Cart.clear", 0),
+                ("Store.save", 1),
+                ("pair", 2),
+                ("<anonymous>", 0),
+            ])
+        );
+    }
+
+    #[test]
+    fn test_php_signatures() {
+        let source = r#"<?php
+namespace App\Models;
+
+class Cart {
+    public function __construct(private array $items = []) {}
+
+    public function add(string $name, int ...$quantities): void {}
+
+    public static function empty(): self { return new self(); }
+}
+
+trait Totals {
+    public function total(): int { return 0; }
+}
+
+function helper($a, $b) {}
+
+$double = fn($x) => $x * 2;
+$greet = function ($name) use ($prefix) { return $prefix . $name; };
+"#;
+        assert_eq!(
+            signatures(source, SupportedLanguage::Php),
+            owned(&[
+                ("App\\Models\\Cart::__construct", 1),
+                ("App\\Models\\Cart::add", 2),
+                ("App\\Models\\Cart::empty", 0),
+                ("App\\Models\\Totals::total", 0),
+                ("App\\Models\\helper", 2),
+                ("App\\Models\\$double", 1),
+                ("App\\Models\\$greet", 1),
+            ])
+        );
+
+        // Braced namespaces contain their declarations
+        let braced = "<?php\nnamespace Shop {\n    function total() {}\n}\n";
+        assert_eq!(
+            signatures(braced, SupportedLanguage::Php),
+            owned(&[("Shop\\total", 0)])
+        );
+    }
+
+    /// Returns `(qualified_name, returns)` for each function in `source`.
+    fn return_counts(source: &str, language: SupportedLanguage) -> Vec<(String, usize)> {
+        let mut parser = create_parser(&language).unwrap();
+        let stats = analyze_code(&mut parser, source, "test", &language).unwrap();
+        stats
+            .functions
+            .into_iter()
+            .map(|f| (f.qualified_name, f.returns))
+            .collect()
+    }
+
+    #[test]
+    fn test_declared_return_counts() {
+        let go = r#"
+package main
+
+func split(path string) (dir, file string, err error) { return }
+func parse(text string) (int, error) { return 0, nil }
+func length(s string) int { return len(s) }
+func log(msg string) {}
+"#;
+        assert_eq!(
+            return_counts(go, SupportedLanguage::Go),
+            owned(&[("split", 3), ("parse", 2), ("length", 1), ("log", 0)])
+        );
+
+        let rust = r#"
+fn pair() -> (i32, String) { (1, String::new()) }
+fn unit() -> () {}
+fn none() {}
+fn fail() -> ! { panic!() }
+fn one() -> Option<i32> { None }
+"#;
+        assert_eq!(
+            return_counts(rust, SupportedLanguage::Rust),
+            owned(&[
+                ("pair", 2),
+                ("unit", 0),
+                ("none", 0),
+                ("fail", 0),
+                ("one", 1)
+            ])
+        );
+    }
+
+    #[test]
+    fn test_widest_return_counts() {
+        let python = r#"
+def bounds(items):
+    if not items:
+        return
+    def key(item):
+        return item, 0, 0
+    return min(items), max(items)
+
+def log(msg):
+    print(msg)
+"#;
+        assert_eq!(
+            return_counts(python, SupportedLanguage::Python),
+            owned(&[("bounds", 2), ("bounds.key", 3), ("log", 0)])
+        );
+
+        let javascript = r#"
+function find(items) {
+    items.forEach(item => { return item; });
+    return;
+}
+const double = x => x * 2;
+"#;
+        assert_eq!(
+            return_counts(javascript, SupportedLanguage::JavaScript),
+            owned(&[("find", 0), ("find.<anonymous>", 1), ("double", 1)])
+        );
+
+        let ruby = "def bounds(items)\n  return items.min, items.max\nend\n";
+        assert_eq!(
+            return_counts(ruby, SupportedLanguage::Ruby),
+            owned(&[("bounds", 2)])
+        );
+    }
+}
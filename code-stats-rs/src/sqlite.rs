@@ -0,0 +1,284 @@
+//! SQLite history of metrics for `--output sqlite:FILE`.
+//!
+//! Every run appends one snapshot to the database, so the history of a
+//! codebase can be queried with plain SQL. The schema, versioned with
+//! `PRAGMA user_version`, is:
+//!
+//! - `snapshots(id, taken_at, root, git_commit, tool_version)`: one row per
+//!   run; `taken_at` is in seconds since the Unix epoch and `git_commit` is
+//!   the `HEAD` of the analyzed path, or NULL outside a git repository
+//! - `files(snapshot_id, path, language, origin, test, functions, classes,
+//!   code_lines, comment_lines, blank_lines, max_complexity, max_nesting,
+//!   max_cognitive, llm_tokens)`: every analyzed file, as in `--format csv`
+//! - `functions(snapshot_id, path, language, name, qualified_name,
+//!   start_line, end_line, lines, parameters, complexity, nesting, cognitive,
+//!   volume, maintainability)`: every function of the code files, including
+//!   those of Markdown code blocks
+//!
+//! A snapshot is written in one transaction, so queries never see half of
+//! one.
+
+use crate::diff::git;
+use crate::error::{CodeStatsError, Result};
+use crate::stats::DirectoryStats;
+use rusqlite::{Connection, params};
+use std::path::Path;
+use std::time::{SystemTime, UNIX_EPOCH};
+
+/// Version of the schema, stored in `PRAGMA user_version`.
+const SCHEMA_VERSION: i64 = 1;
+
+/// Statements creating the tables and indexes of an empty database.
+const SCHEMA: &str = "
+CREATE TABLE snapshots (
+    id INTEGER PRIMARY KEY,
+    taken_at INTEGER NOT NULL,
+    root TEXT NOT NULL,
+    git_commit TEXT,
+    tool_version TEXT NOT NULL
+);
+CREATE TABLE files (
+    snapshot_id INTEGER NOT NULL REFERENCES snapshots(id),
+    path TEXT NOT NULL,
+    language TEXT NOT NULL,
+    origin TEXT,
+    test INTEGER NOT NULL,
+    functions INTEGER NOT NULL,
+    classes INTEGER NOT NULL,
+    code_lines INTEGER NOT NULL,
+    comment_lines INTEGER NOT NULL,
+    blank_lines INTEGER NOT NULL,
+    max_complexity INTEGER NOT NULL,
+    max_nesting INTEGER NOT NULL,
+    max_cognitive INTEGER NOT NULL,
+    llm_tokens INTEGER NOT NULL,
+    PRIMARY KEY (snapshot_id, path)
+);
+CREATE TABLE functions (
+    snapshot_id INTEGER NOT NULL REFERENCES snapshots(id),
+    path TEXT NOT NULL,
+    language TEXT NOT NULL,
+    name TEXT NOT NULL,
+    qualified_name TEXT NOT NULL,
+    start_line INTEGER NOT NULL,
+    end_line INTEGER NOT NULL,
+    lines INTEGER NOT NULL,
+    parameters INTEGER NOT NULL,
+    complexity INTEGER NOT NULL,
+    nesting INTEGER NOT NULL,
+    cognitive INTEGER NOT NULL,
+    volume REAL NOT NULL,
+    maintainability REAL NOT NULL
+);
+CREATE INDEX functions_by_snapshot ON functions (snapshot_id, path);
+";
+
+/// A snapshot written to the database.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) struct Snapshot {
+    /// The snapshot's `id`
+    pub id: i64,
+    /// Number of rows written to `files`
+    pub files: usize,
+    /// Number of rows written to `functions`
+    pub functions: usize,
+}
+
+/// Appends a snapshot of `stats` to a database, creating the database and
+/// its tables if needed.
+///
+/// # Arguments
+///
+/// * `database` - The SQLite database file
+/// * `stats` - Statistics of the analyzed files
+/// * `root` - The analyzed file or directory, recorded with the snapshot
+///
+/// # Returns
+///
+/// * `Ok(Snapshot)` - The snapshot that was written
+/// * `Err(DatabaseError)` - The database can't be opened or written, or has
+///   a newer schema
+pub(crate) fn append_snapshot(
+    database: &Path,
+    stats: &DirectoryStats,
+    root: &Path,
+) -> Result<Snapshot> {
+    let error =
+        |e: rusqlite::Error| CodeStatsError::DatabaseError(format!("{}: {e}", database.display()));
+    let mut connection = Connection::open(database).map_err(error)?;
+    let version: i64 = connection
+        .query_row("PRAGMA user_version", [], |row| row.get(0))
+        .map_err(error)?;
+    if version > SCHEMA_VERSION {
+        return Err(CodeStatsError::DatabaseError(format!(
+            "{}: schema version {version} is newer than {SCHEMA_VERSION}; upgrade code-stats-rs",
+            database.display()
+        )));
+    }
+    if version == 0 {
+        create_schema(&connection).map_err(error)?;
+    }
+    write_snapshot(&mut connection, stats, root, head_commit(root)).map_err(error)
+}
+
+/// Creates the tables of an empty database.
+fn create_schema(connection: &Connection) -> rusqlite::Result<()> {
+    connection.execute_batch(SCHEMA)?;
+    connection.pragma_update(None, "user_version", SCHEMA_VERSION)
+}
+
+/// Writes the rows of one snapshot in a transaction.
+fn write_snapshot(
+    connection: &mut Connection,
+    stats: &DirectoryStats,
+    root: &Path,
+    commit: Option<String>,
+) -> rusqlite::Result<Snapshot> {
+    let taken_at = SystemTime::now()
+        .duration_since(UNIX_EPOCH)
+        .map_or(0, |elapsed| elapsed.as_secs());
+    let transaction = connection.transaction()?;
+    transaction.execute(
+        "INSERT INTO snapshots (taken_at, root, git_commit, tool_version) VALUES (?1, ?2, ?3, ?4)",
+        params![
+            taken_at as i64,
+            root.display().to_string(),
+            commit,
+            env!("CARGO_PKG_VERSION")
+        ],
+    )?;
+    let id = transaction.last_insert_rowid();
+
+    let mut snapshot = Snapshot {
+        id,
+        files: 0,
+        functions: 0,
+    };
+    {
+        let mut insert = transaction.prepare(
+            "INSERT INTO files VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13, ?14)",
+        )?;
+        for file in &stats.files {
+            let code = &file.stats;
+            insert.execute(params![
+                id,
+                file.path.display().to_string(),
+                file.language.name(),
+                code.origin.map(|origin| origin.to_string()),
+                code.test_file,
+                code.function_count as i64,
+                code.class_struct_count as i64,
+                code.lines.code as i64,
+                code.lines.comment as i64,
+                code.lines.blank as i64,
+                code.max_complexity() as i64,
+                code.max_nesting() as i64,
+                code.max_cognitive() as i64,
+                code.tokens.llm as i64,
+            ])?;
+            snapshot.files += 1;
+        }
+
+        let mut insert = transaction.prepare(
+            "INSERT INTO functions VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13, ?14)",
+        )?;
+        for file in stats.code_file_stats() {
+            let embedded = file.stats.embedded.iter().flat_map(|(language, code)| {
+                code.stats.functions.iter().map(move |f| (*language, f))
+            });
+            let functions = file
+                .stats
+                .functions
+                .iter()
+                .map(|f| (file.language, f))
+                .chain(embedded);
+            for (language, function) in functions {
+                insert.execute(params![
+                    id,
+                    file.path.display().to_string(),
+                    language.name(),
+                    function.name,
+                    function.qualified_name,
+                    function.start_line as i64,
+                    function.end_line as i64,
+                    function.line_count() as i64,
+                    function.parameters as i64,
+                    function.complexity as i64,
+                    function.max_nesting as i64,
+                    function.cognitive as i64,
+                    function.halstead.volume,
+                    function.maintainability,
+                ])?;
+                snapshot.functions += 1;
+            }
+        }
+    }
+    transaction.commit()?;
+    Ok(snapshot)
+}
+
+/// Returns the commit checked out at `root`, if it is in a git repository.
+fn head_commit(root: &Path) -> Option<String> {
+    let dir = if root.is_dir() {
+        root
+    } else {
+        root.parent()
+            .filter(|parent| !parent.as_os_str().is_empty())
+            .unwrap_or(Path::new("."))
+    };
+    git(dir, &["rev-parse", "--verify", "--quiet", "HEAD"])
+        .ok()
+        .map(|output| output.trim_end().to_string())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::stats::test_support::{directory, file_with, function};
+
+    fn stats() -> DirectoryStats {
+        directory([file_with(
+            "src/cart.rs",
+            0,
+            vec![function("total", 3), function("add", 1)],
+        )])
+    }
+
+    #[test]
+    fn test_append_snapshot() {
+        let dir = tempfile::tempdir().unwrap();
+        let database = dir.path().join("stats.db");
+
+        let first = append_snapshot(&database, &stats(), Path::new("src")).unwrap();
+        let second = append_snapshot(&database, &stats(), Path::new("src")).unwrap();
+        assert_eq!((first.files, first.functions), (1, 2));
+        assert_eq!(second.id, first.id + 1);
+
+        let connection = Connection::open(&database).unwrap();
+        let max: i64 = connection
+            .query_row(
+                "SELECT MAX(complexity) FROM functions WHERE snapshot_id = ?1",
+                params![second.id],
+                |row| row.get(0),
+            )
+            .unwrap();
+        assert_eq!(max, 3);
+        let version: i64 = connection
+            .query_row("PRAGMA user_version", [], |row| row.get(0))
+            .unwrap();
+        assert_eq!(version, SCHEMA_VERSION);
+    }
+
+    #[test]
+    fn test_newer_schema_is_rejected() {
+        let dir = tempfile::tempdir().unwrap();
+        let database = dir.path().join("stats.db");
+        Connection::open(&database)
+            .unwrap()
+            .pragma_update(None, "user_version", SCHEMA_VERSION + 1)
+            .unwrap();
+
+        let err = append_snapshot(&database, &stats(), Path::new("src")).unwrap_err();
+        assert!(err.to_string().contains("schema version 2"), "{err}");
+    }
+}
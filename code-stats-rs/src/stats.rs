@@ -1,10 +1,55 @@
 //! Data structures for collecting and aggregating code statistics.
 
+use crate::closures::ClosureStats;
+use crate::comments::{DocCoverage, LineStats, is_zero};
+use crate::configuration::ConfigStats;
+use crate::generics::GenericsStats;
+use crate::handling::ErrorHandlingStats;
 use crate::language::SupportedLanguage;
-use crate::parser::CodeStats;
+use crate::origin::CodeOrigin;
+use crate::parser::{CodeStats, FunctionStats};
+use crate::switches::SwitchStats;
 use serde::{Deserialize, Serialize};
-use std::collections::HashMap;
-use std::path::PathBuf;
+use std::collections::{BTreeMap, HashMap};
+use std::path::{Path, PathBuf};
+
+/// Limits above which functions are flagged as offenders in reports.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) struct Thresholds {
+    /// Maximum acceptable cyclomatic complexity per function
+    pub complexity: usize,
+    /// Maximum acceptable number of lines per function
+    pub function_lines: usize,
+}
+
+impl Default for Thresholds {
+    fn default() -> Self {
+        Self {
+            complexity: 10,
+            function_lines: 100,
+        }
+    }
+}
+
+/// A function together with the file it was found in.
+#[derive(Debug, Clone, Copy, Serialize)]
+pub struct FunctionRef<'a> {
+    /// The file containing the function
+    pub path: &'a Path,
+    /// The function's metrics
+    #[serde(flatten)]
+    pub function: &'a FunctionStats,
+}
+
+/// A switch or match statement together with the file it was found in.
+#[derive(Debug, Clone, Copy, Serialize)]
+pub struct SwitchRef<'a> {
+    /// The file containing the statement
+    pub path: &'a Path,
+    /// The statement's branch counts
+    #[serde(flatten)]
+    pub switch: &'a SwitchStats,
+}
 
 /// Statistics for a single source code file.
 ///
@@ -12,7 +57,7 @@ use std::path::PathBuf;
 /// its path, detected programming language, and the computed code statistics
 /// (function and class/struct counts).
 #[derive(Debug, Clone, Serialize, Deserialize)]
-pub(crate) struct FileStats {
+pub struct FileStats {
     /// The path to the analyzed source file
     pub path: PathBuf,
     /// The detected programming language of the file
@@ -32,15 +77,83 @@ pub(crate) struct FileStats {
 /// - `files`: Individual statistics for each analyzed file
 /// - `total_by_language`: Aggregated statistics grouped by programming language
 /// - `total_stats`: Overall totals across all files and languages
+/// - `configuration`: Totals of the YAML, JSON, and TOML files, which are
+///   kept out of `total_by_language` and `total_stats`
 ///
 #[derive(Debug, Default, Serialize, Deserialize)]
-pub(crate) struct DirectoryStats {
+pub struct DirectoryStats {
     /// Individual statistics for each analyzed file
     pub files: Vec<FileStats>,
     /// Statistics aggregated by programming language
     pub total_by_language: HashMap<SupportedLanguage, LanguageStats>,
     /// Overall totals across all files and languages
     pub total_stats: CodeStats,
+    /// Totals of the configuration files
+    #[serde(default)]
+    pub configuration: ConfigurationStats,
+    /// Totals of the generated and vendored files
+    #[serde(default)]
+    pub generated: GeneratedStats,
+    /// Totals of the test files, which are counted in the code totals too
+    #[serde(default)]
+    pub tests: TestStats,
+    /// Files skipped because their content is not text in a supported
+    /// encoding, in path order
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub undecodable: Vec<PathBuf>,
+    /// Files skipped because parsing them took longer than the parse
+    /// timeout, in path order
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub timed_out: Vec<PathBuf>,
+    /// Number of files left unanalyzed because the analysis was interrupted;
+    /// the statistics are incomplete if it is not zero
+    #[serde(default, skip_serializing_if = "is_zero")]
+    pub interrupted: usize,
+}
+
+/// Statistics aggregated over the configuration files of a directory.
+#[derive(Debug, Default, Clone, Serialize, Deserialize)]
+pub struct ConfigurationStats {
+    /// Number of configuration files
+    pub files: usize,
+    /// Number of files per format
+    pub by_language: BTreeMap<SupportedLanguage, usize>,
+    /// Keys and documents summed, and the deepest nesting of any file
+    pub config: ConfigStats,
+    /// Lines across all configuration files
+    pub lines: LineStats,
+    /// ERROR regions across all configuration files
+    #[serde(default, skip_serializing_if = "is_zero")]
+    pub error_nodes: usize,
+    /// MISSING nodes across all configuration files
+    #[serde(default, skip_serializing_if = "is_zero")]
+    pub missing_nodes: usize,
+}
+
+/// Statistics aggregated over the generated and vendored files of a
+/// directory, which are not part of the code totals.
+#[derive(Debug, Default, Clone, Serialize, Deserialize)]
+pub struct GeneratedStats {
+    /// Number of generated and vendored files
+    pub files: usize,
+    /// Number of files per origin
+    pub by_origin: BTreeMap<CodeOrigin, usize>,
+    /// Functions across all generated and vendored files
+    pub function_count: usize,
+    /// Lines across all generated and vendored files
+    pub lines: LineStats,
+}
+
+/// Statistics aggregated over the test files of a directory, which are
+/// part of the code totals as well.
+#[derive(Debug, Default, Clone, Serialize, Deserialize)]
+pub struct TestStats {
+    /// Number of test files
+    pub files: usize,
+    /// Functions across all test files
+    pub function_count: usize,
+    /// Lines across all test files
+    pub lines: LineStats,
 }
 
 /// Statistics aggregated for a specific programming language.
@@ -53,20 +166,47 @@ pub(crate) struct DirectoryStats {
 /// - `file_count`: Number of files analyzed for this language
 /// - `function_count`: Total number of functions found across all files
 /// - `class_struct_count`: Total number of classes/structs found across all files
+/// - `kinds`: Per-kind breakdown of declarations across all files
+/// - `code_blocks`: Fenced blocks in this language found in Markdown documents
 ///
 #[derive(Debug, Default, Clone, Serialize, Deserialize)]
-pub(crate) struct LanguageStats {
+pub struct LanguageStats {
     /// Number of files analyzed for this programming language
     pub file_count: usize,
+    /// Number of Markdown code blocks and embedded Lua blocks in this
+    /// language, whose statistics are included in the other counts
+    #[serde(default, skip_serializing_if = "is_zero")]
+    pub code_blocks: usize,
     /// Total number of functions found across all files of this language
     pub function_count: usize,
     /// Total number of classes/structs found across all files of this language
     pub class_struct_count: usize,
+    /// Declaration counts per kind label across all files of this language
+    #[serde(default)]
+    pub kinds: BTreeMap<String, usize>,
+    /// Code, comment, and blank lines across all files of this language
+    #[serde(default)]
+    pub lines: LineStats,
+    /// Doc-comment coverage across all files of this language
+    #[serde(default)]
+    pub docs: DocCoverage,
+    /// Generic declarations and instantiations across all files of this
+    /// language, for the languages that have them
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub generics: Option<GenericsStats>,
+    /// Anonymous functions across all files of this language, for the
+    /// languages whose closures are counted
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub closures: Option<ClosureStats>,
+    /// Error-handling counts across all files of this language, for the
+    /// languages whose error handling is counted
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub error_handling: Option<ErrorHandlingStats>,
 }
 
 impl DirectoryStats {
     /// Creates a new empty `DirectoryStats` instance.
-    pub(crate) fn new() -> Self {
+    pub fn new() -> Self {
         Self::default()
     }
 
@@ -74,34 +214,389 @@ impl DirectoryStats {
     ///
     /// This method updates both the overall totals and the language-specific
     /// statistics. It increments file counts, function counts, and class/struct
-    /// counts appropriately.
+    /// counts appropriately. Code embedded in a Markdown document is counted
+    /// toward the language of each code block, not toward Markdown.
+    /// Generated and vendored files are only counted in `generated`, and
+    /// configuration files in `configuration`, so that they don't inflate the
+    /// code totals.
     ///
     /// # Parameters
     ///
     /// * `file_stats` - The statistics for the file to be added to the aggregation
     pub(crate) fn add_file(&mut self, file_stats: FileStats) {
+        if let Some(origin) = file_stats.stats.origin {
+            self.generated.add(origin, &file_stats);
+            self.files.push(file_stats);
+            return;
+        }
+        if file_stats.language.is_configuration() {
+            self.configuration.add(&file_stats);
+            self.files.push(file_stats);
+            return;
+        }
+
         // Update total stats
-        self.total_stats.function_count += file_stats.stats.function_count;
-        self.total_stats.class_struct_count += file_stats.stats.class_struct_count;
+        self.total_stats.merge(&file_stats.stats);
+        if file_stats.stats.test_file {
+            self.tests.add(&file_stats);
+        }
 
         // Update language-specific stats
         let lang_stats = self
             .total_by_language
             .entry(file_stats.language)
             .or_default();
-
         lang_stats.file_count += 1;
-        lang_stats.function_count += file_stats.stats.function_count;
-        lang_stats.class_struct_count += file_stats.stats.class_struct_count;
+        lang_stats.add(&file_stats.stats);
+
+        for (language, embedded) in &file_stats.stats.embedded {
+            let lang_stats = self.total_by_language.entry(*language).or_default();
+            lang_stats.code_blocks += embedded.blocks;
+            lang_stats.add(&embedded.stats);
+        }
 
         // Add file to list
         self.files.push(file_stats);
     }
 
-    /// Returns the total number of files that have been analyzed.
-    pub(crate) fn total_files(&self) -> usize {
+    /// Returns the total number of files that have been analyzed, including
+    /// configuration files.
+    pub fn total_files(&self) -> usize {
         self.files.len()
     }
+
+    /// Returns the number of files counted in the code totals, that is all
+    /// files except configuration, generated, and vendored files.
+    pub fn code_files(&self) -> usize {
+        self.files.len() - self.configuration.files - self.generated.files
+    }
+
+    /// Iterates over the files counted in the code totals.
+    pub fn code_file_stats(&self) -> impl Iterator<Item = &FileStats> {
+        self.files
+            .iter()
+            .filter(|file| file.stats.origin.is_none() && !file.language.is_configuration())
+    }
+
+    /// Returns the lines of test code per line of production code, or `None`
+    /// if there is no production code.
+    pub fn test_ratio(&self) -> Option<f64> {
+        test_ratio(self.tests.lines.code, self.total_stats.lines.code)
+    }
+
+    /// Returns up to `count` configuration files with the most keys, most
+    /// first; ties are ordered by path.
+    pub fn largest_config_files(&self, count: usize) -> Vec<&FileStats> {
+        let mut files: Vec<_> = self
+            .files
+            .iter()
+            .filter(|file| file.stats.config.is_some() && file.stats.origin.is_none())
+            .collect();
+        files.sort_by(|a, b| {
+            config_keys(b)
+                .cmp(&config_keys(a))
+                .then_with(|| a.path.cmp(&b.path))
+        });
+        files.truncate(count);
+        files
+    }
+
+    /// Iterates over every switch and match statement across the files
+    /// counted in the code totals.
+    pub fn switches(&self) -> impl Iterator<Item = SwitchRef<'_>> {
+        self.code_file_stats().flat_map(|file| {
+            file.stats.switches.iter().map(move |switch| SwitchRef {
+                path: &file.path,
+                switch,
+            })
+        })
+    }
+
+    /// Returns up to `count` switch statements with the most branches, most
+    /// first; ties are ordered by path and then by line.
+    pub fn largest_switches(&self, count: usize) -> Vec<SwitchRef<'_>> {
+        let mut switches: Vec<_> = self.switches().collect();
+        switches.sort_by(|a, b| {
+            b.switch
+                .branches
+                .cmp(&a.switch.branches)
+                .then_with(|| a.path.cmp(b.path))
+                .then_with(|| a.switch.start_line.cmp(&b.switch.start_line))
+        });
+        switches.truncate(count);
+        switches
+    }
+
+    /// Iterates over every recorded function across the files counted in the
+    /// code totals, including those in the code blocks of Markdown documents.
+    pub fn functions(&self) -> impl Iterator<Item = FunctionRef<'_>> {
+        self.code_file_stats().flat_map(|file| {
+            let embedded = file
+                .stats
+                .embedded
+                .values()
+                .flat_map(|embedded| &embedded.stats.functions);
+            file.stats
+                .functions
+                .iter()
+                .chain(embedded)
+                .map(move |function| FunctionRef {
+                    path: &file.path,
+                    function,
+                })
+        })
+    }
+
+    /// Returns the highest cyclomatic complexity across all files.
+    pub fn max_complexity(&self) -> usize {
+        self.functions()
+            .map(|f| f.function.complexity)
+            .max()
+            .unwrap_or(0)
+    }
+
+    /// Returns the files, code and configuration, whose syntax tree has
+    /// ERROR or MISSING nodes.
+    pub fn files_with_parse_issues(&self) -> impl Iterator<Item = &FileStats> {
+        self.files
+            .iter()
+            .filter(|file| !file.stats.parsed_cleanly())
+    }
+
+    /// Returns the paths of the files above the parse size limit, which only
+    /// had their lines counted, in path order.
+    pub fn oversized_files(&self) -> Vec<PathBuf> {
+        let mut paths: Vec<PathBuf> = self
+            .files
+            .iter()
+            .filter(|file| file.stats.oversized)
+            .map(|file| file.path.clone())
+            .collect();
+        paths.sort();
+        paths
+    }
+
+    /// Returns the percentage of files that parsed cleanly, 100.0 if there
+    /// are none.
+    pub fn parse_health(&self) -> f64 {
+        if self.files.is_empty() {
+            return 100.0;
+        }
+        let clean = self.files.len() - self.files_with_parse_issues().count();
+        clean as f64 * 100.0 / self.files.len() as f64
+    }
+
+    /// Returns the mean cyclomatic complexity across all functions, or 0.0 if there are none.
+    pub fn mean_complexity(&self) -> f64 {
+        let (sum, count) = self.functions().fold((0, 0), |(sum, count), f| {
+            (sum + f.function.complexity, count + 1)
+        });
+        if count == 0 {
+            0.0
+        } else {
+            sum as f64 / count as f64
+        }
+    }
+
+    /// Returns the function with the deepest control-flow nesting, if any.
+    ///
+    /// Ties go to the first function by path and line.
+    pub fn deepest_function(&self) -> Option<FunctionRef<'_>> {
+        self.functions().min_by(|a, b| {
+            b.function
+                .max_nesting
+                .cmp(&a.function.max_nesting)
+                .then_with(|| a.path.cmp(b.path))
+                .then_with(|| a.function.start_line.cmp(&b.function.start_line))
+        })
+    }
+
+    /// Returns the function with the lowest maintainability index, if any.
+    ///
+    /// Ties go to the first function by path and line.
+    pub fn least_maintainable_function(&self) -> Option<FunctionRef<'_>> {
+        self.functions().min_by(|a, b| {
+            a.function
+                .maintainability
+                .total_cmp(&b.function.maintainability)
+                .then_with(|| a.path.cmp(b.path))
+                .then_with(|| a.function.start_line.cmp(&b.function.start_line))
+        })
+    }
+
+    /// Returns the function with the highest cognitive complexity, if any.
+    ///
+    /// Ties go to the first function by path and line.
+    pub fn most_cognitive_function(&self) -> Option<FunctionRef<'_>> {
+        self.functions().min_by(|a, b| {
+            b.function
+                .cognitive
+                .cmp(&a.function.cognitive)
+                .then_with(|| a.path.cmp(b.path))
+                .then_with(|| a.function.start_line.cmp(&b.function.start_line))
+        })
+    }
+
+    /// Returns the functions with fallible calls and no error checks, most
+    /// fallible calls first; ties are ordered by path and then by line.
+    pub fn unhandled_functions(&self) -> Vec<FunctionRef<'_>> {
+        let mut unhandled: Vec<_> = self
+            .functions()
+            .filter(|f| f.function.error_handling.is_unhandled())
+            .collect();
+        unhandled.sort_by(|a, b| {
+            b.function
+                .error_handling
+                .fallible_calls
+                .cmp(&a.function.error_handling.fallible_calls)
+                .then_with(|| a.path.cmp(b.path))
+                .then_with(|| a.function.start_line.cmp(&b.function.start_line))
+        });
+        unhandled
+    }
+
+    /// Returns functions whose complexity exceeds `threshold`, most complex first.
+    ///
+    /// Ties are ordered by path and then by line so the result is deterministic.
+    pub fn complexity_offenders(&self, threshold: usize) -> Vec<FunctionRef<'_>> {
+        let mut offenders: Vec<_> = self
+            .functions()
+            .filter(|f| f.function.complexity > threshold)
+            .collect();
+        offenders.sort_by(|a, b| {
+            b.function
+                .complexity
+                .cmp(&a.function.complexity)
+                .then_with(|| a.path.cmp(b.path))
+                .then_with(|| a.function.start_line.cmp(&b.function.start_line))
+        });
+        offenders
+    }
+}
+
+/// Returns the lines of test code per line of production code, where
+/// `code_lines` includes the test code, or `None` without production code.
+pub(crate) fn test_ratio(test_lines: usize, code_lines: usize) -> Option<f64> {
+    let production = code_lines.saturating_sub(test_lines);
+    (production > 0).then(|| test_lines as f64 / production as f64)
+}
+
+/// Returns the number of keys of a configuration file, 0 for other files.
+fn config_keys(file: &FileStats) -> usize {
+    file.stats.config.map_or(0, |config| config.keys)
+}
+
+impl ConfigurationStats {
+    /// Adds one configuration file to the totals.
+    fn add(&mut self, file: &FileStats) {
+        self.files += 1;
+        *self.by_language.entry(file.language).or_default() += 1;
+        if let Some(config) = &file.stats.config {
+            self.config.merge(config);
+        }
+        self.lines.merge(&file.stats.lines);
+        self.error_nodes += file.stats.error_nodes;
+        self.missing_nodes += file.stats.missing_nodes;
+    }
+}
+
+impl GeneratedStats {
+    /// Adds one generated or vendored file to the totals.
+    fn add(&mut self, origin: CodeOrigin, file: &FileStats) {
+        self.files += 1;
+        *self.by_origin.entry(origin).or_default() += 1;
+        self.function_count += file.stats.function_count;
+        self.lines.merge(&file.stats.lines);
+    }
+}
+
+impl TestStats {
+    /// Adds one test file to the totals.
+    fn add(&mut self, file: &FileStats) {
+        self.files += 1;
+        self.function_count += file.stats.function_count;
+        self.lines.merge(&file.stats.lines);
+    }
+}
+
+impl LanguageStats {
+    /// Adds the counts of one file, or of the code embedded in one, to this
+    /// language's totals. The file count is left to the caller.
+    fn add(&mut self, stats: &CodeStats) {
+        self.function_count += stats.function_count;
+        self.class_struct_count += stats.class_struct_count;
+        for (kind, count) in &stats.kinds {
+            *self.kinds.entry(kind.clone()).or_default() += count;
+        }
+        self.lines.merge(&stats.lines);
+        self.docs.merge(&stats.docs);
+        if let Some(generics) = &stats.generics {
+            self.generics.get_or_insert_default().merge(generics);
+        }
+        if let Some(closures) = &stats.closures {
+            self.closures.get_or_insert_default().merge(closures);
+        }
+        if let Some(error_handling) = &stats.error_handling {
+            self.error_handling
+                .get_or_insert_default()
+                .merge(error_handling);
+        }
+    }
+}
+
+/// Builders of statistics for the tests of the reports and views.
+#[cfg(test)]
+pub(crate) mod test_support {
+    use super::{DirectoryStats, FileStats};
+    use crate::comments::LineStats;
+    use crate::language::SupportedLanguage;
+    use crate::parser::{CodeStats, FunctionStats};
+    use std::path::PathBuf;
+
+    /// A function with a name and a complexity.
+    pub(crate) fn function(name: &str, complexity: usize) -> FunctionStats {
+        FunctionStats {
+            name: name.to_string(),
+            complexity,
+            ..Default::default()
+        }
+    }
+
+    /// A Rust file with `code` code lines and the given functions.
+    pub(crate) fn file_with(path: &str, code: usize, functions: Vec<FunctionStats>) -> FileStats {
+        FileStats {
+            path: PathBuf::from(path),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                lines: LineStats {
+                    code,
+                    ..Default::default()
+                },
+                function_count: functions.len(),
+                functions,
+                ..Default::default()
+            },
+        }
+    }
+
+    /// A Rust file with `code` code lines and an unnamed function of each
+    /// complexity.
+    pub(crate) fn file(path: &str, code: usize, complexities: &[usize]) -> FileStats {
+        let functions = complexities
+            .iter()
+            .map(|&complexity| function("", complexity))
+            .collect();
+        file_with(path, code, functions)
+    }
+
+    /// Statistics of a directory with the given files.
+    pub(crate) fn directory(files: impl IntoIterator<Item = FileStats>) -> DirectoryStats {
+        let mut stats = DirectoryStats::new();
+        for file in files {
+            stats.add_file(file);
+        }
+        stats
+    }
 }
 
 #[cfg(test)]
@@ -117,6 +612,7 @@ mod tests {
             stats: CodeStats {
                 function_count: 5,
                 class_struct_count: 2,
+                ..Default::default()
             },
         };
 
@@ -147,6 +643,7 @@ mod tests {
             stats: CodeStats {
                 function_count: 3,
                 class_struct_count: 1,
+                ..Default::default()
             },
         };
 
@@ -173,6 +670,7 @@ mod tests {
             stats: CodeStats {
                 function_count: 2,
                 class_struct_count: 1,
+                ..Default::default()
             },
         });
 
@@ -183,6 +681,7 @@ mod tests {
             stats: CodeStats {
                 function_count: 3,
                 class_struct_count: 2,
+                ..Default::default()
             },
         });
 
@@ -207,6 +706,7 @@ mod tests {
             stats: CodeStats {
                 function_count: 4,
                 class_struct_count: 2,
+                ..Default::default()
             },
         });
 
@@ -217,6 +717,7 @@ mod tests {
             stats: CodeStats {
                 function_count: 3,
                 class_struct_count: 1,
+                ..Default::default()
             },
         });
 
@@ -227,6 +728,7 @@ mod tests {
             stats: CodeStats {
                 function_count: 2,
                 class_struct_count: 1,
+                ..Default::default()
             },
         });
 
@@ -256,6 +758,231 @@ mod tests {
         assert_eq!(lang_stats.file_count, 0);
         assert_eq!(lang_stats.function_count, 0);
         assert_eq!(lang_stats.class_struct_count, 0);
+        assert!(lang_stats.kinds.is_empty());
+    }
+
+    #[test]
+    fn test_directory_stats_aggregates_kind_breakdown() {
+        let mut dir_stats = DirectoryStats::new();
+
+        for name in ["a.rs", "b.rs"] {
+            let mut stats = CodeStats {
+                function_count: 1,
+                class_struct_count: 1,
+                ..Default::default()
+            };
+            stats.record_kind("function");
+            stats.record_kind("struct");
+            dir_stats.add_file(FileStats {
+                path: PathBuf::from(name),
+                language: SupportedLanguage::Rust,
+                stats,
+            });
+        }
+
+        assert_eq!(dir_stats.total_stats.kinds["function"], 2);
+        assert_eq!(dir_stats.total_stats.kinds["struct"], 2);
+
+        let rust_stats = &dir_stats.total_by_language[&SupportedLanguage::Rust];
+        assert_eq!(rust_stats.kinds["function"], 2);
+        assert_eq!(rust_stats.kinds["struct"], 2);
+    }
+
+    #[test]
+    fn test_directory_stats_attributes_embedded_code() {
+        let mut dir_stats = DirectoryStats::new();
+        let examples = CodeStats {
+            function_count: 2,
+            functions: vec![function("main", 8, 3), function("handler", 20, 1)],
+            lines: LineStats {
+                code: 12,
+                ..Default::default()
+            },
+            ..Default::default()
+        };
+        let mut document = CodeStats {
+            lines: LineStats {
+                prose: 30,
+                ..Default::default()
+            },
+            ..Default::default()
+        };
+        document.embedded.insert(
+            SupportedLanguage::Go,
+            crate::fences::EmbeddedCode {
+                blocks: 3,
+                stats: examples,
+            },
+        );
+        dir_stats.add_file(FileStats {
+            path: PathBuf::from("docs/guide.md"),
+            language: SupportedLanguage::Markdown,
+            stats: document,
+        });
+
+        let markdown = &dir_stats.total_by_language[&SupportedLanguage::Markdown];
+        assert_eq!(markdown.file_count, 1);
+        assert_eq!(markdown.function_count, 0);
+        assert_eq!(markdown.lines.prose, 30);
+
+        let go = &dir_stats.total_by_language[&SupportedLanguage::Go];
+        assert_eq!(go.file_count, 0);
+        assert_eq!(go.code_blocks, 3);
+        assert_eq!(go.function_count, 2);
+        assert_eq!(go.lines.code, 12);
+
+        assert_eq!(dir_stats.total_stats.function_count, 2);
+        assert_eq!(dir_stats.total_stats.lines.total(), 42);
+        assert_eq!(dir_stats.max_complexity(), 3);
+        assert_eq!(
+            dir_stats.functions().next().unwrap().path,
+            Path::new("docs/guide.md")
+        );
+    }
+
+    fn function(name: &str, start_line: usize, complexity: usize) -> FunctionStats {
+        FunctionStats {
+            name: name.to_string(),
+            start_line,
+            end_line: start_line + 1,
+            complexity,
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn test_directory_stats_complexity_summary() {
+        let mut dir_stats = DirectoryStats::new();
+        assert_eq!(dir_stats.max_complexity(), 0);
+        assert_eq!(dir_stats.mean_complexity(), 0.0);
+
+        dir_stats.add_file(FileStats {
+            path: PathBuf::from("b.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                function_count: 2,
+                functions: vec![function("simple", 1, 1), function("tangled", 5, 12)],
+                ..Default::default()
+            },
+        });
+        dir_stats.add_file(FileStats {
+            path: PathBuf::from("a.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                function_count: 2,
+                functions: vec![function("branchy", 3, 12), function("medium", 9, 3)],
+                ..Default::default()
+            },
+        });
+
+        assert_eq!(dir_stats.functions().count(), 4);
+        assert_eq!(dir_stats.max_complexity(), 12);
+        assert_eq!(dir_stats.mean_complexity(), 7.0);
+        // Aggregated totals don't duplicate per-function entries
+        assert!(dir_stats.total_stats.functions.is_empty());
+
+        let offenders = dir_stats.complexity_offenders(Thresholds::default().complexity);
+        let names: Vec<_> = offenders.iter().map(|f| f.function.name.as_str()).collect();
+        assert_eq!(names, vec!["branchy", "tangled"]);
+    }
+
+    #[test]
+    fn test_directory_stats_keeps_generated_code_separate() {
+        let mut dir_stats = DirectoryStats::new();
+        let file = |path: &str, origin, function_count| FileStats {
+            path: PathBuf::from(path),
+            language: SupportedLanguage::Go,
+            stats: CodeStats {
+                function_count,
+                functions: vec![function("f", 1, 20)],
+                lines: LineStats {
+                    code: 100,
+                    ..Default::default()
+                },
+                origin,
+                ..Default::default()
+            },
+        };
+        dir_stats.add_file(file("main.go", None, 2));
+        dir_stats.add_file(file("api/cart.pb.go", Some(CodeOrigin::Generated), 40));
+        dir_stats.add_file(file("vendor/x/x.go", Some(CodeOrigin::Vendored), 7));
+
+        assert_eq!(dir_stats.total_files(), 3);
+        assert_eq!(dir_stats.code_files(), 1);
+        assert_eq!(dir_stats.total_stats.function_count, 2);
+        assert_eq!(
+            dir_stats.total_by_language[&SupportedLanguage::Go].file_count,
+            1
+        );
+        // Generated functions don't count toward the complexity summary
+        assert_eq!(dir_stats.functions().count(), 1);
+
+        let generated = &dir_stats.generated;
+        assert_eq!(generated.files, 2);
+        assert_eq!(generated.by_origin[&CodeOrigin::Generated], 1);
+        assert_eq!(generated.by_origin[&CodeOrigin::Vendored], 1);
+        assert_eq!(generated.function_count, 47);
+        assert_eq!(generated.lines.code, 200);
+    }
+
+    #[test]
+    fn test_directory_stats_totals_test_files() {
+        let mut dir_stats = DirectoryStats::new();
+        assert_eq!(dir_stats.test_ratio(), None);
+
+        let file = |path: &str, code, test_file| FileStats {
+            path: PathBuf::from(path),
+            language: SupportedLanguage::Go,
+            stats: CodeStats {
+                function_count: 3,
+                lines: LineStats {
+                    code,
+                    ..Default::default()
+                },
+                test_file,
+                ..Default::default()
+            },
+        };
+        dir_stats.add_file(file("cart_test.go", 60, true));
+        assert_eq!(dir_stats.test_ratio(), None);
+        dir_stats.add_file(file("cart.go", 150, false));
+        dir_stats.add_file(file("order.go", 90, false));
+
+        // Test files stay in the code totals
+        assert_eq!(dir_stats.code_files(), 3);
+        assert_eq!(dir_stats.total_stats.lines.code, 300);
+        assert_eq!(dir_stats.tests.files, 1);
+        assert_eq!(dir_stats.tests.function_count, 3);
+        assert_eq!(dir_stats.tests.lines.code, 60);
+        assert_eq!(dir_stats.test_ratio(), Some(0.25));
+    }
+
+    #[test]
+    fn test_directory_stats_parse_health() {
+        let mut dir_stats = DirectoryStats::new();
+        assert_eq!(dir_stats.parse_health(), 100.0);
+
+        let file = |path: &str, error_nodes, missing_nodes| FileStats {
+            path: PathBuf::from(path),
+            language: SupportedLanguage::C,
+            stats: CodeStats {
+                error_nodes,
+                missing_nodes,
+                ..Default::default()
+            },
+        };
+        dir_stats.add_file(file("a.c", 0, 0));
+        dir_stats.add_file(file("b.c", 2, 0));
+        dir_stats.add_file(file("c.c", 0, 1));
+        dir_stats.add_file(file("d.c", 0, 0));
+
+        let broken: Vec<_> = dir_stats
+            .files_with_parse_issues()
+            .map(|file| file.path.to_str().unwrap())
+            .collect();
+        assert_eq!(broken, vec!["b.c", "c.c"]);
+        assert_eq!(dir_stats.parse_health(), 50.0);
+        assert_eq!(dir_stats.total_stats.missing_nodes, 1);
     }
 
     #[test]
@@ -266,6 +993,7 @@ mod tests {
             stats: CodeStats {
                 function_count: 10,
                 class_struct_count: 5,
+                ..Default::default()
             },
         };
 
@@ -286,4 +1014,92 @@ mod tests {
             file_stats.stats.class_struct_count
         );
     }
+
+    #[test]
+    fn test_directory_stats_keeps_configuration_separate() {
+        let mut dir_stats = DirectoryStats::new();
+        let config = |path: &str, language, keys, max_depth| FileStats {
+            path: PathBuf::from(path),
+            language,
+            stats: CodeStats {
+                config: Some(ConfigStats {
+                    keys,
+                    max_depth,
+                    documents: 1,
+                }),
+                lines: LineStats {
+                    code: keys,
+                    ..Default::default()
+                },
+                ..Default::default()
+            },
+        };
+        dir_stats.add_file(config("package.json", SupportedLanguage::Json, 12, 2));
+        dir_stats.add_file(config("Cargo.toml", SupportedLanguage::Toml, 30, 3));
+        dir_stats.add_file(config("ci.yml", SupportedLanguage::Yaml, 12, 5));
+        dir_stats.add_file(FileStats {
+            path: PathBuf::from("main.rs"),
+            language: SupportedLanguage::Rust,
+            stats: CodeStats {
+                function_count: 2,
+                lines: LineStats {
+                    code: 40,
+                    ..Default::default()
+                },
+                ..Default::default()
+            },
+        });
+
+        assert_eq!(dir_stats.total_files(), 4);
+        assert_eq!(dir_stats.code_files(), 1);
+        assert_eq!(dir_stats.total_stats.lines.code, 40);
+        assert_eq!(dir_stats.total_by_language.len(), 1);
+
+        let configuration = &dir_stats.configuration;
+        assert_eq!(configuration.files, 3);
+        assert_eq!(configuration.by_language[&SupportedLanguage::Json], 1);
+        assert_eq!(configuration.config.keys, 54);
+        assert_eq!(configuration.config.max_depth, 5);
+        assert_eq!(configuration.lines.code, 54);
+
+        let largest: Vec<_> = dir_stats
+            .largest_config_files(2)
+            .iter()
+            .map(|file| file.path.to_str().unwrap())
+            .collect();
+        assert_eq!(largest, vec!["Cargo.toml", "ci.yml"]);
+    }
+
+    #[test]
+    fn test_largest_switches() {
+        let switch = |start_line, branches| SwitchStats {
+            kind: "match".to_string(),
+            start_line,
+            end_line: start_line + branches,
+            branches,
+            has_default: false,
+        };
+        let mut dir_stats = DirectoryStats::new();
+        for (path, switches) in [
+            ("b.rs", vec![switch(3, 4), switch(20, 9)]),
+            ("a.rs", vec![switch(12, 4)]),
+        ] {
+            dir_stats.add_file(FileStats {
+                path: PathBuf::from(path),
+                language: SupportedLanguage::Rust,
+                stats: CodeStats {
+                    switches,
+                    ..Default::default()
+                },
+            });
+        }
+
+        assert_eq!(dir_stats.switches().count(), 3);
+        let largest: Vec<(&str, usize)> = dir_stats
+            .largest_switches(3)
+            .iter()
+            .map(|s| (s.path.to_str().unwrap(), s.switch.start_line))
+            .collect();
+        assert_eq!(largest, vec![("b.rs", 20), ("a.rs", 12), ("b.rs", 3)]);
+    }
 }
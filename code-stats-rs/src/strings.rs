@@ -0,0 +1,362 @@
+//! User-facing string literals for `--strings`, to find hard-coded messages
+//! and feed translation tooling.
+//!
+//! Every string literal of the code files is a candidate; the heuristics
+//! keep those that read like text for people. A literal is dropped if it:
+//!
+//! - has no letters once format placeholders (`{}`, `%s`, `${name}`,
+//!   `#{name}`, `\(name)`) and escapes are removed, like `"{}: {}"`
+//! - is a single word that looks like an identifier, key, path, or URL
+//!   (`"user_id"`, `"utf-8"`, `"GET"`, `"src/main.rs"`) rather than a
+//!   capitalized label (`"Cancel"`)
+//! - sits in an attribute, annotation, or import, is a Go struct tag, or is
+//!   a statement of its own such as a Python docstring
+//!
+//! Test files are skipped unless configured otherwise, and generated and
+//! vendored files unless `--include-generated` is given.
+
+use crate::analyzer::{CodeAnalyzer, DirectoryOptions};
+use crate::config::StringsConfig;
+use crate::error::Result;
+use crate::language::SupportedLanguage;
+use crate::origin::{is_generated, is_vendored};
+use crate::testcode::is_test_file;
+use serde::Serialize;
+use std::path::{Path, PathBuf};
+use tree_sitter::Node;
+
+/// Literals shorter than this (in characters) are skipped unless
+/// `min_length` is configured.
+pub(crate) const DEFAULT_MIN_LENGTH: usize = 2;
+
+/// Node kinds of string literals across the supported grammars. Literals
+/// made of several parts, such as C's `"a" "b"`, are reported per part.
+const STRING_KINDS: [&str; 12] = [
+    "string_literal",
+    "raw_string_literal",
+    "interpreted_string_literal",
+    "string",
+    "raw_string",
+    "template_string",
+    "text_block",
+    "verbatim_string_literal",
+    "interpolated_string_expression",
+    "line_string_literal",
+    "multi_line_string_literal",
+    "encapsed_string",
+];
+
+/// Node kinds whose strings are metadata or module names, not messages.
+const SKIPPED_KINDS: [&str; 12] = [
+    "attribute_item",
+    "inner_attribute_item",
+    "attribute_list",
+    "annotation",
+    "marker_annotation",
+    "decorator",
+    "use_declaration",
+    "extern_crate_declaration",
+    "import_declaration",
+    "import_statement",
+    "import_from_statement",
+    "preproc_include",
+];
+
+/// A user-facing string literal.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct StringLiteral {
+    /// File containing the literal
+    pub path: PathBuf,
+    /// 1-based line where the literal starts
+    pub line: usize,
+    /// The literal's content as written, without quotes and prefixes
+    pub text: String,
+}
+
+/// Collects the user-facing string literals of a file or of every supported
+/// file below a directory, in file and source order.
+///
+/// Files are read and skipped as described in `CodeAnalyzer::visit_sources`;
+/// configuration files, documents, and build files have no messages to
+/// report.
+///
+/// # Arguments
+///
+/// * `analyzer` - Analyzer providing the parsers
+/// * `path` - File or directory to scan
+/// * `options` - Traversal and exclusion settings for directories
+/// * `config` - The `[strings]` settings of the configuration file
+pub(crate) fn collect_strings(
+    analyzer: &mut CodeAnalyzer,
+    path: &Path,
+    options: &DirectoryOptions,
+    config: &StringsConfig,
+) -> Result<Vec<StringLiteral>> {
+    let min_length = config.min_length.unwrap_or(DEFAULT_MIN_LENGTH);
+    let mut strings = Vec::new();
+    analyzer.visit_sources(path, options, |analyzer, file, language, source_code| {
+        let relative = match file.strip_prefix(path) {
+            Ok(relative) if !relative.as_os_str().is_empty() => relative,
+            _ => file.file_name().map_or(file, Path::new),
+        };
+        if !has_messages(language)
+            || (!options.include_generated
+                && (is_generated(file, source_code) || is_vendored(relative)))
+            || (!config.include_tests && is_test_file(relative, language))
+        {
+            return Ok(());
+        }
+        let tree = analyzer.parse(file, language, source_code)?;
+        let mut literals = Vec::new();
+        collect_literals(&tree.root_node(), source_code, &mut literals);
+        strings.extend(
+            literals
+                .into_iter()
+                .filter(|(_, text)| {
+                    text.chars().count() >= min_length
+                        && is_user_facing(text)
+                        && !config.ignore.iter().any(|ignored| ignored == text)
+                })
+                .map(|(line, text)| StringLiteral {
+                    path: file.to_path_buf(),
+                    line,
+                    text,
+                }),
+        );
+        Ok(())
+    })?;
+    Ok(strings)
+}
+
+/// Returns true for the programming languages, whose string literals may be
+/// messages.
+fn has_messages(language: SupportedLanguage) -> bool {
+    !language.is_configuration()
+        && !matches!(
+            language,
+            SupportedLanguage::Markdown
+                | SupportedLanguage::Sql
+                | SupportedLanguage::Dockerfile
+                | SupportedLanguage::Make
+                | SupportedLanguage::Protobuf
+                | SupportedLanguage::Html
+                | SupportedLanguage::Vue
+                | SupportedLanguage::Svelte
+                | SupportedLanguage::Jinja
+                | SupportedLanguage::GoTemplate
+                | SupportedLanguage::Erb
+                | SupportedLanguage::Graphql
+                | SupportedLanguage::Hcl
+                | SupportedLanguage::Css
+                | SupportedLanguage::Scss
+                | SupportedLanguage::Jupyter
+        )
+}
+
+/// Collects the line and content of every string literal outside skipped
+/// nodes, not descending into the literals themselves.
+fn collect_literals(node: &Node, source: &str, literals: &mut Vec<(usize, String)>) {
+    let kind = node.kind();
+    if SKIPPED_KINDS.contains(&kind) || is_struct_tag(node) {
+        return;
+    }
+    if STRING_KINDS.contains(&kind) {
+        let standalone = node
+            .parent()
+            .is_some_and(|parent| parent.kind() == "expression_statement")
+            && node.prev_sibling().is_none()
+            && node.next_named_sibling().is_none();
+        if !standalone {
+            literals.push((
+                node.start_position().row + 1,
+                unquote(&source[node.byte_range()]).to_string(),
+            ));
+        }
+        return;
+    }
+    let mut cursor = node.walk();
+    for child in node.children(&mut cursor) {
+        collect_literals(&child, source, literals);
+    }
+}
+
+/// Returns true for the tag of a Go struct field, as in `json:"name"`.
+fn is_struct_tag(node: &Node) -> bool {
+    node.parent().is_some_and(|parent| {
+        parent.kind() == "field_declaration"
+            && parent
+                .child_by_field_name("tag")
+                .is_some_and(|tag| tag.id() == node.id())
+    })
+}
+
+/// Strips the prefix (`r#`, `f`, `@`, `$`), quotes, and raw-string hashes
+/// around a literal's content.
+fn unquote(literal: &str) -> &str {
+    let body = literal.trim_start_matches(|c: char| c.is_ascii_alphabetic() || "@$#".contains(c));
+    let body = body.trim_end_matches('#');
+    for quote in ["\"\"\"", "'''", "\"", "'", "`"] {
+        if let Some(inner) = body
+            .strip_prefix(quote)
+            .and_then(|rest| rest.strip_suffix(quote))
+        {
+            return inner;
+        }
+    }
+    body
+}
+
+/// Returns true if a literal's content reads like text for people rather
+/// than a format string, identifier, key, path, or URL.
+pub(crate) fn is_user_facing(text: &str) -> bool {
+    let words = without_placeholders(text);
+    if !words.chars().any(char::is_alphabetic) {
+        return false;
+    }
+    let trimmed = words.trim();
+    if trimmed.contains(char::is_whitespace) {
+        return !trimmed.contains("://");
+    }
+    // A single word is a label if it is capitalized and not a code name
+    let word = trimmed.trim_end_matches(['.', '!', '?', ':']);
+    word.chars().next().is_some_and(char::is_uppercase)
+        && word.chars().any(char::is_lowercase)
+        && !word.contains(['_', '/', '\\', '.', ':', '=', '<'])
+}
+
+/// Replaces format placeholders and escape sequences with spaces.
+fn without_placeholders(text: &str) -> String {
+    let mut output = String::with_capacity(text.len());
+    let mut chars = text.chars().peekable();
+    while let Some(c) = chars.next() {
+        match c {
+            // `{}`, `{0}`, `{name:>8}`, and the `${...}`, `#{...}` forms
+            '{' | '$' | '#' if c == '{' || chars.peek() == Some(&'{') => {
+                if c != '{' {
+                    chars.next();
+                }
+                for inner in chars.by_ref() {
+                    if inner == '}' {
+                        break;
+                    }
+                }
+                output.push(' ');
+            }
+            // printf conversions such as `%s`, `%-8.2f`, and `%%`
+            '%' => {
+                while chars
+                    .peek()
+                    .is_some_and(|next| "-+ #0123456789.*lhqjzt".contains(*next))
+                {
+                    chars.next();
+                }
+                chars.next();
+                output.push(' ');
+            }
+            // Escapes, including Swift's `\(interpolation)`
+            '\\' => match chars.next() {
+                Some('(') => {
+                    for inner in chars.by_ref() {
+                        if inner == ')' {
+                            break;
+                        }
+                    }
+                    output.push(' ');
+                }
+                Some('u' | 'x') => {
+                    while chars
+                        .peek()
+                        .is_some_and(|next| next.is_ascii_hexdigit() || "{}".contains(*next))
+                    {
+                        chars.next();
+                    }
+                    output.push(' ');
+                }
+                _ => output.push(' '),
+            },
+            _ => output.push(c),
+        }
+    }
+    output
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::create_parser;
+
+    #[test]
+    fn test_is_user_facing() {
+        for text in [
+            "File not found",
+            "Saved {} items",
+            "Hello, %s!",
+            "Cancel",
+            "Deleted.",
+            "Welcome back, ${name}",
+        ] {
+            assert!(is_user_facing(text), "{text}");
+        }
+        for text in [
+            "{}",
+            "{}: {}",
+            "%d\\n",
+            ", ",
+            "user_id",
+            "utf-8",
+            "GET",
+            "application/json",
+            "src/main.rs",
+            "Config.toml",
+            "https://example.com/docs page",
+            "\\u{1F600}",
+        ] {
+            assert!(!is_user_facing(text), "{text}");
+        }
+    }
+
+    #[test]
+    fn test_unquote() {
+        assert_eq!(unquote("\"Hello\""), "Hello");
+        assert_eq!(unquote("r#\"Say \"hi\"\"#"), "Say \"hi\"");
+        assert_eq!(unquote("f'{count} files'"), "{count} files");
+        assert_eq!(unquote("\"\"\"Block text\"\"\""), "Block text");
+        assert_eq!(unquote("@\"C:\\temp\""), "C:\\temp");
+        assert_eq!(unquote("`Hi ${name}`"), "Hi ${name}");
+    }
+
+    #[test]
+    fn test_collect_literals_skips_metadata() {
+        let language = SupportedLanguage::Rust;
+        let source = "use std::fmt;\n\
+                      #[serde(rename = \"Display name\")]\n\
+                      struct Cart;\n\
+                      fn main() {\n\
+                      \x20   println!(\"Cart is empty\");\n\
+                      \x20   let key = \"cart_id\";\n\
+                      }\n";
+        let tree = create_parser(&language)
+            .unwrap()
+            .parse(source, None)
+            .unwrap();
+        let mut literals = Vec::new();
+        collect_literals(&tree.root_node(), source, &mut literals);
+        assert_eq!(
+            literals,
+            [(5, "Cart is empty".to_string()), (6, "cart_id".to_string())]
+        );
+    }
+
+    #[test]
+    fn test_python_docstrings_are_skipped() {
+        let language = SupportedLanguage::Python;
+        let source = "def greet():\n    \"\"\"Say hello.\"\"\"\n    print(\"Hello there\")\n";
+        let tree = create_parser(&language)
+            .unwrap()
+            .parse(source, None)
+            .unwrap();
+        let mut literals = Vec::new();
+        collect_literals(&tree.root_node(), source, &mut literals);
+        assert_eq!(literals, [(3, "Hello there".to_string())]);
+    }
+}
@@ -0,0 +1,232 @@
+//! Switch and match statements, their branch counts, and default arms.
+//!
+//! A switch is a `switch` in C, C++, C#, Go, Java, JavaScript, and
+//! TypeScript, a Go `select`, a `match` in Python and Rust, a Kotlin `when`,
+//! or a Ruby `case`. Each arm is a branch, the default one included, so a
+//! `switch` with three cases and a `default:` has four branches.
+//!
+//! The default arm is the one taken when no other matches: `default:` and
+//! `default ->`, `else` in Kotlin and Ruby, and the wildcard pattern `_`
+//! without a guard in C#, Python, and Rust. A Rust or Python arm binding the
+//! value to a name also matches everything, but the grammars can't tell such
+//! a name from a constant, so it is not taken for a default.
+
+use crate::language::SupportedLanguage;
+use serde::{Deserialize, Serialize};
+use tree_sitter::Node;
+
+/// A switch or match statement of a file.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct SwitchStats {
+    /// Keyword of the statement: `switch`, `select`, `match`, `when`, or
+    /// `case`
+    pub kind: String,
+    /// 1-based line the statement starts at
+    pub start_line: usize,
+    /// 1-based line the statement ends at
+    pub end_line: usize,
+    /// Number of arms, the default arm included
+    pub branches: usize,
+    /// Whether one of the arms is the default
+    pub has_default: bool,
+}
+
+/// Lists the switch and match statements of a parsed file.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the parsed file
+/// * `source` - The source code the tree was parsed from
+/// * `language` - The programming language of the source code
+///
+/// # Returns
+///
+/// Each statement with its node, in source order; nested statements follow
+/// the one they are in. Empty for languages without switch statements.
+pub(crate) fn switches<'tree>(
+    root: &Node<'tree>,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> Vec<(Node<'tree>, SwitchStats)> {
+    let mut found = Vec::new();
+    let mut stack = vec![*root];
+    while let Some(node) = stack.pop() {
+        if let Some(kind) = language.rules().switch_kind(&node) {
+            found.push((node, switch_stats(&node, kind, source, language)));
+        }
+        // Pushed in reverse so they are visited in source order
+        let mut cursor = node.walk();
+        let children: Vec<Node> = node.named_children(&mut cursor).collect();
+        stack.extend(children.into_iter().rev());
+    }
+    found
+}
+
+/// Returns true for the languages whose switch statements are listed.
+pub(crate) fn has_switches(language: &SupportedLanguage) -> bool {
+    language.rules().has_switches()
+}
+
+/// Counts the arms of a switch statement, without those of statements
+/// nested in it.
+fn switch_stats(
+    node: &Node,
+    kind: &str,
+    source: &[u8],
+    language: &SupportedLanguage,
+) -> SwitchStats {
+    let (mut branches, mut has_default) = (0, false);
+    let mut stack = vec![*node];
+    while let Some(current) = stack.pop() {
+        let mut cursor = current.walk();
+        for child in current.named_children(&mut cursor) {
+            if language.rules().is_switch_arm(&child) {
+                branches += 1;
+                has_default |= language.rules().is_default_arm(&child, source);
+            } else if language.rules().switch_kind(&child).is_none() {
+                stack.push(child);
+            }
+        }
+    }
+    SwitchStats {
+        kind: kind.to_string(),
+        start_line: node.start_position().row + 1,
+        end_line: node.end_position().row + 1,
+        branches,
+        has_default,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tree_sitter::Parser;
+
+    fn parse(source: &str, language: SupportedLanguage) -> tree_sitter::Tree {
+        let mut parser = Parser::new();
+        parser.set_language(&language.get_language()).unwrap();
+        parser.parse(source, None).unwrap()
+    }
+
+    fn summary(source: &str, language: SupportedLanguage) -> Vec<(String, usize, usize, bool)> {
+        let tree = parse(source, language);
+        switches(&tree.root_node(), source.as_bytes(), &language)
+            .into_iter()
+            .map(|(_, switch)| {
+                (
+                    switch.kind,
+                    switch.start_line,
+                    switch.branches,
+                    switch.has_default,
+                )
+            })
+            .collect()
+    }
+
+    #[test]
+    fn test_rust_match_arms_and_wildcards() {
+        let source = r#"
+fn describe(n: i32, flag: Option<bool>) -> &'static str {
+    match n {
+        0 => "zero",
+        1 | 2 => match flag {
+            Some(true) => "small",
+            Some(false) => "tiny",
+            None => "unknown",
+        },
+        _ if n < 0 => "negative",
+        _ => "large",
+    }
+}
+"#;
+        assert_eq!(
+            summary(source, SupportedLanguage::Rust),
+            vec![
+                ("match".to_string(), 3, 4, true),
+                ("match".to_string(), 5, 3, false),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_go_switch_and_select() {
+        let source = r#"
+package main
+
+func run(kind string, done chan bool, values chan int) {
+    switch kind {
+    case "a", "b":
+        return
+    case "c":
+        return
+    default:
+        return
+    }
+    select {
+    case <-done:
+        return
+    case v := <-values:
+        _ = v
+    }
+}
+"#;
+        assert_eq!(
+            summary(source, SupportedLanguage::Go),
+            vec![
+                ("switch".to_string(), 5, 3, true),
+                ("select".to_string(), 13, 2, false),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_javascript_switch_without_default() {
+        let source = r#"
+function color(c) {
+    switch (c) {
+        case "red":
+        case "green":
+            return 1;
+        case "blue":
+            return 2;
+    }
+}
+"#;
+        assert_eq!(
+            summary(source, SupportedLanguage::JavaScript),
+            vec![("switch".to_string(), 3, 3, false)]
+        );
+    }
+
+    #[test]
+    fn test_python_match_wildcard_with_guard() {
+        let source = r#"
+match command:
+    case "go":
+        pass
+    case _ if verbose:
+        pass
+"#;
+        assert_eq!(
+            summary(source, SupportedLanguage::Python),
+            vec![("match".to_string(), 2, 2, false)]
+        );
+    }
+
+    #[test]
+    fn test_c_default_case() {
+        let source =
+            "int f(int x) {\n  switch (x) {\n  case 1: return 1;\n  default: return 0;\n  }\n}\n";
+        assert_eq!(
+            summary(source, SupportedLanguage::C),
+            vec![("switch".to_string(), 2, 2, true)]
+        );
+    }
+
+    #[test]
+    fn test_languages_without_switches() {
+        let tree = parse("[package]\nname = \"x\"\n", SupportedLanguage::Toml);
+        assert!(switches(&tree.root_node(), b"", &SupportedLanguage::Toml).is_empty());
+        assert!(!has_switches(&SupportedLanguage::Toml));
+    }
+}
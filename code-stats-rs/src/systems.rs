@@ -0,0 +1,190 @@
+//! Declarations of the systems languages Zig and Nim.
+//!
+//! Zig types are values: `const Cart = struct { ... };` binds an anonymous
+//! `struct` to a constant, which names it, and a generic type is a function
+//! returning one. Declarations are public with a `pub` keyword in front.
+//!
+//! Nim declares types in `type` sections and exports a declaration by
+//! marking its name with `*`, as in `proc add*(cart: Cart)`; the grammar
+//! wraps such a name in an `exported_symbol`.
+
+use tree_sitter::Node;
+
+/// Kinds of the Zig container declarations, which are types named by the
+/// constant they are assigned to.
+const ZIG_CONTAINERS: [&str; 5] = [
+    "struct_declaration",
+    "union_declaration",
+    "enum_declaration",
+    "opaque_declaration",
+    "error_set_declaration",
+];
+
+/// Keywords that may precede a Zig declaration, with the library name of
+/// `extern "c"`.
+pub(crate) const ZIG_MODIFIERS: [&str; 7] = [
+    "pub",
+    "export",
+    "extern",
+    "inline",
+    "noinline",
+    "threadlocal",
+    "string",
+];
+
+/// Returns true if `node` is a Zig struct, union, enum, opaque, or error
+/// set declaration.
+pub(crate) fn is_zig_container(node: &Node) -> bool {
+    ZIG_CONTAINERS.contains(&node.kind())
+}
+
+/// Returns the name of the constant a Zig container is assigned to, as
+/// `Cart` in `const Cart = struct { ... };`, or `None` for an anonymous one
+/// such as the `struct` a generic function returns.
+pub(crate) fn zig_container_name<'a>(node: &Node, source: &'a [u8]) -> Option<&'a str> {
+    let declaration = node
+        .parent()
+        .filter(|parent| parent.kind() == "variable_declaration")?;
+    let mut cursor = declaration.walk();
+    declaration
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "identifier")
+        .and_then(|name| name.utf8_text(source).ok())
+}
+
+/// Returns true if a Zig declaration is `pub`. The keyword precedes the
+/// declaration, possibly with `export`, `extern`, or `inline` in between.
+pub(crate) fn is_zig_pub(node: &Node) -> bool {
+    let mut sibling = node.prev_sibling();
+    while let Some(modifier) = sibling.filter(|s| ZIG_MODIFIERS.contains(&s.kind())) {
+        if modifier.kind() == "pub" {
+            return true;
+        }
+        sibling = modifier.prev_sibling();
+    }
+    let mut cursor = node.walk();
+    node.children(&mut cursor)
+        .next()
+        .is_some_and(|keyword| keyword.kind() == "pub")
+}
+
+/// Returns the identifier a Nim routine or type declaration names, looking
+/// through the `*` export marker. An `object`, `enum`, or `concept` is named
+/// by the `type` declaration it is the value of.
+pub(crate) fn nim_name<'tree>(node: &Node<'tree>) -> Option<Node<'tree>> {
+    let name = match node.kind() {
+        "type_declaration" => {
+            let mut cursor = node.walk();
+            node.named_children(&mut cursor)
+                .find(|child| child.kind() == "type_symbol_declaration")?
+                .child_by_field_name("name")?
+        }
+        "object_declaration" | "enum_declaration" | "concept_declaration" => {
+            // `ref object` and `distinct` wrap the value
+            let mut ancestor = node.parent();
+            while let Some(current) = ancestor {
+                if current.kind() == "type_declaration" {
+                    return nim_name(&current);
+                }
+                ancestor = current.parent();
+            }
+            return None;
+        }
+        _ => node.child_by_field_name("name")?,
+    };
+    if name.kind() == "exported_symbol" {
+        let mut cursor = name.walk();
+        return name.named_children(&mut cursor).next();
+    }
+    Some(name)
+}
+
+/// Returns true if a Nim declaration's name is exported with `*`.
+pub(crate) fn is_nim_exported(node: &Node) -> bool {
+    let name = if node.kind() == "type_declaration" {
+        let mut cursor = node.walk();
+        node.named_children(&mut cursor)
+            .find(|child| child.kind() == "type_symbol_declaration")
+            .and_then(|symbol| symbol.child_by_field_name("name"))
+    } else {
+        node.child_by_field_name("name")
+    };
+    name.is_some_and(|name| name.kind() == "exported_symbol")
+}
+
+/// Counts the parameters a Nim parameter declaration declares: two for
+/// `a, b: int`.
+pub(crate) fn nim_parameter_weight(parameter: &Node) -> usize {
+    let mut cursor = parameter.walk();
+    parameter
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "symbol_declaration_list")
+        .map_or(1, |symbols| {
+            let mut cursor = symbols.walk();
+            symbols
+                .named_children(&mut cursor)
+                .filter(|symbol| symbol.kind() == "symbol_declaration")
+                .count()
+                .max(1)
+        })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::language::SupportedLanguage;
+    use crate::parser::create_parser;
+
+    /// Returns the nodes of the given kinds in `source`, in document order.
+    fn find<'tree>(root: Node<'tree>, kinds: &[&str]) -> Vec<Node<'tree>> {
+        let mut found = Vec::new();
+        let mut stack = vec![root];
+        while let Some(node) = stack.pop() {
+            if kinds.contains(&node.kind()) {
+                found.push(node);
+            }
+            let mut cursor = node.walk();
+            let children: Vec<Node> = node.named_children(&mut cursor).collect();
+            stack.extend(children.into_iter().rev());
+        }
+        found
+    }
+
+    #[test]
+    fn test_zig_container_names_and_pub() {
+        let source = "pub const Cart = struct {\n    items: u32,\n};\n\nconst Kind = enum { book, toy };\n\nfn List(comptime T: type) type {\n    return struct { items: []T };\n}\n";
+        let mut parser = create_parser(&SupportedLanguage::Zig).unwrap();
+        let tree = parser.parse(source, None).unwrap();
+        let containers = find(tree.root_node(), &ZIG_CONTAINERS);
+        let names: Vec<_> = containers
+            .iter()
+            .map(|node| zig_container_name(node, source.as_bytes()))
+            .collect();
+        assert_eq!(names, [Some("Cart"), Some("Kind"), None]);
+
+        let declarations = find(tree.root_node(), &["variable_declaration"]);
+        assert!(is_zig_pub(&declarations[0]));
+        assert!(!is_zig_pub(&declarations[1]));
+    }
+
+    #[test]
+    fn test_nim_names_and_exports() {
+        let source = "type\n  Cart* = ref object\n    items: seq[string]\n\nproc add*(cart: Cart, item, note: string) =\n  cart.items.add(item)\n\nproc helper(cart: Cart) = discard\n";
+        let mut parser = create_parser(&SupportedLanguage::Nim).unwrap();
+        let tree = parser.parse(source, None).unwrap();
+        let source = source.as_bytes();
+        let text = |node: Option<Node>| node.and_then(|node| node.utf8_text(source).ok());
+
+        let object = find(tree.root_node(), &["object_declaration"]);
+        assert_eq!(text(nim_name(&object[0])), Some("Cart"));
+
+        let procs = find(tree.root_node(), &["proc_declaration"]);
+        assert_eq!(text(nim_name(&procs[0])), Some("add"));
+        assert!(is_nim_exported(&procs[0]));
+        assert!(!is_nim_exported(&procs[1]));
+
+        let parameters = find(procs[0], &["parameter_declaration"]);
+        let weights: Vec<_> = parameters.iter().map(nim_parameter_weight).collect();
+        assert_eq!(weights, [1, 2]);
+    }
+}
@@ -0,0 +1,207 @@
+//! Tags file generation for `--emit-tags`.
+//!
+//! Writes the declarations found in the syntax tree in the extended format
+//! read by universal-ctags compatible tools (Vim, Emacs, editor plugins):
+//! one tab-separated line per symbol with its name, file, a search pattern for
+//! the declaration's line, its kind, and its line number. Lines are sorted by
+//! byte value so consumers can binary-search the file.
+
+use crate::analyzer::{CodeAnalyzer, DirectoryOptions};
+use crate::error::Result;
+use crate::language::SupportedLanguage;
+use std::path::Path;
+
+/// Pseudo-tags describing the file, written before the entries.
+const HEADER: &[&str] = &[
+    "!_TAG_FILE_FORMAT\t2\t/extended format; --format=1 will not append ;\" to lines/",
+    "!_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted, 2=foldcase/",
+    concat!("!_TAG_PROGRAM_NAME\t", env!("CARGO_PKG_NAME"), "\t//"),
+    concat!("!_TAG_PROGRAM_VERSION\t", env!("CARGO_PKG_VERSION"), "\t//"),
+];
+
+/// A single entry of a tags file.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct Tag {
+    /// Symbol name
+    pub name: String,
+    /// File the symbol is declared in, as reached from the analyzed path
+    pub file: String,
+    /// Full text of the declaration's first line
+    pub line_text: String,
+    /// Declaration kind (e.g. `function`, `struct`)
+    pub kind: &'static str,
+    /// 1-based line of the declaration
+    pub line: usize,
+}
+
+impl Tag {
+    /// Renders the entry as a tags file line, without the trailing newline.
+    fn to_line(&self) -> String {
+        format!(
+            "{}\t{}\t/^{}$/;\"\t{}\tline:{}",
+            self.name,
+            self.file,
+            escape_pattern(&self.line_text),
+            self.kind,
+            self.line
+        )
+    }
+}
+
+/// Collects tags for a file or every supported file below a directory.
+///
+/// Files are read and skipped as described in `CodeAnalyzer::visit_sources`.
+///
+/// # Arguments
+///
+/// * `analyzer` - Analyzer providing the parsers
+/// * `path` - File or directory to tag
+/// * `options` - Traversal and exclusion settings for directories
+///
+/// # Returns
+///
+/// The tags of all declarations found, in file and source order.
+pub(crate) fn collect_tags(
+    analyzer: &mut CodeAnalyzer,
+    path: &Path,
+    options: &DirectoryOptions,
+) -> Result<Vec<Tag>> {
+    let mut tags = Vec::new();
+    analyzer.visit_sources(path, options, |analyzer, file, language, source_code| {
+        tags.extend(file_tags(analyzer, file, language, source_code)?);
+        Ok(())
+    })?;
+    Ok(tags)
+}
+
+/// Parses one file and returns tags for its declarations.
+fn file_tags(
+    analyzer: &mut CodeAnalyzer,
+    path: &Path,
+    language: SupportedLanguage,
+    source_code: &str,
+) -> Result<Vec<Tag>> {
+    let symbols = analyzer.symbols(path, language, source_code)?;
+
+    let lines: Vec<&str> = source_code.lines().collect();
+    // Tags are usually read relative to the directory they were generated in
+    let file = path.strip_prefix(".").unwrap_or(path).display().to_string();
+    Ok(symbols
+        .into_iter()
+        .map(|symbol| Tag {
+            line_text: lines
+                .get(symbol.line - 1)
+                .map_or("", |line| line.trim_end_matches('\r'))
+                .to_string(),
+            name: symbol.name,
+            file: file.clone(),
+            kind: symbol.kind,
+            line: symbol.line,
+        })
+        .collect())
+}
+
+/// Formats tags as a complete tags file, header included.
+///
+/// # Arguments
+///
+/// * `tags` - The entries to write, in any order
+///
+/// # Returns
+///
+/// The tags file content, with entries sorted by byte value and a trailing newline.
+pub(crate) fn format_tags(tags: &[Tag]) -> String {
+    let mut entries: Vec<String> = tags.iter().map(Tag::to_line).collect();
+    entries.sort_unstable();
+    entries.dedup();
+
+    let mut output = String::new();
+    for line in HEADER
+        .iter()
+        .copied()
+        .chain(entries.iter().map(String::as_str))
+    {
+        output.push_str(line);
+        output.push('\n');
+    }
+    output
+}
+
+/// Escapes a source line for use in a `/^...$/` search pattern.
+///
+/// Backslashes and slashes would otherwise end or alter the pattern.
+fn escape_pattern(line: &str) -> String {
+    line.replace('\\', "\\\\").replace('/', "\\/")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn tag(name: &str, file: &str, line: usize) -> Tag {
+        Tag {
+            name: name.to_string(),
+            file: file.to_string(),
+            line_text: format!("fn {name}() {{"),
+            kind: "function",
+            line,
+        }
+    }
+
+    #[test]
+    fn test_format_tags_header_and_entry() {
+        let output = format_tags(&[tag("parse", "src/lib.rs", 12)]);
+        let lines: Vec<&str> = output.lines().collect();
+
+        assert!(lines[0].starts_with("!_TAG_FILE_FORMAT\t2\t"));
+        assert_eq!(
+            lines[1],
+            "!_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted, 2=foldcase/"
+        );
+        assert_eq!(lines[2], "!_TAG_PROGRAM_NAME\tcode-stats-rs\t//");
+        assert_eq!(
+            lines[4],
+            "parse\tsrc/lib.rs\t/^fn parse() {$/;\"\tfunction\tline:12"
+        );
+        assert_eq!(lines.len(), HEADER.len() + 1);
+        assert!(output.ends_with('\n'));
+    }
+
+    #[test]
+    fn test_format_tags_sorts_entries() {
+        let output = format_tags(&[
+            tag("parse_all", "b.rs", 1),
+            tag("parse", "b.rs", 9),
+            tag("Parser", "a.rs", 3),
+            tag("parse", "a.rs", 5),
+        ]);
+        let names: Vec<(&str, &str)> = output
+            .lines()
+            .skip(HEADER.len())
+            .map(|line| {
+                let mut fields = line.split('\t');
+                (fields.next().unwrap(), fields.next().unwrap())
+            })
+            .collect();
+
+        // Byte order: uppercase first, and a name before its longer variants
+        assert_eq!(
+            names,
+            vec![
+                ("Parser", "a.rs"),
+                ("parse", "a.rs"),
+                ("parse", "b.rs"),
+                ("parse_all", "b.rs"),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_escape_pattern() {
+        assert_eq!(
+            escape_pattern("let re = /a\\/b/;"),
+            "let re = \\/a\\\\\\/b\\/;"
+        );
+        assert_eq!(escape_pattern("fn plain() {"), "fn plain() {");
+    }
+}
@@ -0,0 +1,504 @@
+//! Template languages: Jinja, Go templates, and ERB.
+//!
+//! A template is text with tags the engine replaces or runs. Templates are
+//! measured by their tags: interpolations output a value (`{{ name }}`,
+//! `<%= name %>`), and statement tags hold the control structures, of which
+//! conditionals and loops are counted, as is how deeply their blocks nest.
+//! Tags are found by their delimiters rather than by a grammar:
+//!
+//! - Jinja: `{{ }}`, `{% %}`, and `{# #}` comments. A block opened by a tag
+//!   like `{% for %}` is closed by its `end` tag, `{% endfor %}`, and the
+//!   text of a `{% raw %}` block holds no tags.
+//! - Go templates: `{{ }}` and `{{/* */}}` comments. Actions beginning with
+//!   `if`, `range`, `with`, `define`, or `block` open a block closed by
+//!   `{{ end }}`, other keyword actions and variable assignments are
+//!   statements, and everything else is an interpolation.
+//! - ERB: `<%= %>`, `<% %>`, and `<%# %>` comments, with `<%%` for a literal
+//!   `<%`. Ruby's `if`, `unless`, `case`, `while`, `until`, `for`, and `do`
+//!   blocks are closed by `end`.
+//!
+//! Whitespace control markers (`{%-`, `-}}`, `-%>`) belong to the delimiters.
+//! A line holding only the text around the tags counts as markup, as the
+//! HTML around PHP tags does, and one holding only comment tags as a comment.
+//!
+//! The Ruby of ERB tags can also be analyzed as Ruby, see `ruby_code`. The
+//! expressions of Jinja and Go templates are in the template language itself,
+//! which has no grammar, so they are only counted.
+
+use crate::language::SupportedLanguage;
+use serde::{Deserialize, Serialize};
+use std::ops::Range;
+
+/// Keywords beginning the Go template actions that are not interpolations.
+const GO_KEYWORDS: [&str; 10] = [
+    "if", "else", "range", "with", "define", "block", "end", "template", "break", "continue",
+];
+
+/// Jinja tags opening a block besides `if` and `for`, each closed by its
+/// `end` tag.
+const JINJA_BLOCKS: [&str; 8] = [
+    "macro",
+    "call",
+    "filter",
+    "block",
+    "with",
+    "autoescape",
+    "trans",
+    "raw",
+];
+
+/// Ruby methods whose `do` blocks iterate, `each` covering `each_with_index`
+/// and the like.
+const RUBY_ITERATORS: [&str; 6] = ["each", "times", "map", "select", "upto", "downto"];
+
+/// Tags and control structures of a template.
+#[derive(Default, Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct TemplateStats {
+    /// Number of tags outputting a value
+    pub interpolations: usize,
+    /// Number of `if` tags and their `elif`/`else if`/`elsif` branches, plus
+    /// Go's `with` and ERB's `when`
+    pub conditionals: usize,
+    /// Number of `for` and `range` tags and of ERB's loops and iterator
+    /// blocks
+    pub loops: usize,
+    /// Deepest nesting of blocks, 0 for a template without any
+    pub max_depth: usize,
+}
+
+impl TemplateStats {
+    /// Adds the counts of `other`, keeping the deeper of the two depths.
+    pub(crate) fn merge(&mut self, other: &TemplateStats) {
+        self.interpolations += other.interpolations;
+        self.conditionals += other.conditionals;
+        self.loops += other.loops;
+        self.max_depth = self.max_depth.max(other.max_depth);
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum TagKind {
+    Interpolation,
+    Statement,
+    Comment,
+}
+
+/// A tag of a template, with the byte ranges of the whole tag and of the
+/// code between its delimiters, trimmed.
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct Tag {
+    kind: TagKind,
+    range: Range<usize>,
+    code: Range<usize>,
+}
+
+/// Control structure a statement tag counts as.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Construct {
+    Conditional,
+    Loop,
+}
+
+/// What a statement tag does to the nesting of blocks.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Nesting {
+    Opens,
+    Closes,
+    Stays,
+}
+
+/// Counts the tags and control structures of a template.
+///
+/// # Arguments
+///
+/// * `source` - The template
+/// * `language` - Jinja, Go templates, or ERB
+///
+/// # Returns
+///
+/// The template's statistics, or `None` for other languages.
+pub(crate) fn template_stats(source: &str, language: &SupportedLanguage) -> Option<TemplateStats> {
+    if !language.is_template() {
+        return None;
+    }
+    let mut stats = TemplateStats::default();
+    let mut depth = 0;
+    for tag in tags(source, language) {
+        if tag.kind == TagKind::Interpolation {
+            stats.interpolations += 1;
+        }
+        let code = &source[tag.code];
+        let (construct, nesting) = match (language, tag.kind) {
+            (_, TagKind::Comment) => continue,
+            (SupportedLanguage::Jinja, TagKind::Statement) => jinja_control(code),
+            (SupportedLanguage::GoTemplate, TagKind::Statement) => go_control(code),
+            // `<%= form_with(model: cart) do |form| %>` opens a block too
+            (SupportedLanguage::Erb, _) => ruby_control(code),
+            _ => continue,
+        };
+        match construct {
+            Some(Construct::Conditional) => stats.conditionals += 1,
+            Some(Construct::Loop) => stats.loops += 1,
+            None => {}
+        }
+        match nesting {
+            Nesting::Opens => {
+                depth += 1;
+                stats.max_depth = stats.max_depth.max(depth);
+            }
+            Nesting::Closes => depth = depth.saturating_sub(1),
+            Nesting::Stays => {}
+        }
+    }
+    Some(stats)
+}
+
+/// Returns the byte ranges of the comment tags of a template, in source
+/// order, for `comments::count_lines`.
+pub(crate) fn comment_ranges(source: &str, language: &SupportedLanguage) -> Vec<Range<usize>> {
+    tags(source, language)
+        .into_iter()
+        .filter(|tag| tag.kind == TagKind::Comment)
+        .map(|tag| tag.range)
+        .collect()
+}
+
+/// Returns the byte ranges of the text between the tags of a template, in
+/// source order, for `comments::count_lines`.
+pub(crate) fn text_ranges(source: &str, language: &SupportedLanguage) -> Vec<Range<usize>> {
+    let mut ranges = Vec::new();
+    let mut offset = 0;
+    for tag in tags(source, language) {
+        if offset < tag.range.start {
+            ranges.push(offset..tag.range.start);
+        }
+        offset = tag.range.end;
+    }
+    if offset < source.len() {
+        ranges.push(offset..source.len());
+    }
+    ranges
+}
+
+/// Collects the Ruby of an ERB template's tags as one Ruby program.
+///
+/// The code of each tag stays on its line, and the tags of a line are joined
+/// with `; `, so line numbers of the program are those of the template and
+/// `<% cart.items.each do |item| %>` ... `<% end %>` becomes a block spanning
+/// the same lines. Comment tags are left out.
+///
+/// # Returns
+///
+/// The program, with an empty line for every template line without Ruby.
+pub(crate) fn ruby_code(source: &str) -> String {
+    let mut lines = vec![String::new(); source.lines().count().max(1)];
+    let mut row = 0;
+    let mut offset = 0;
+    for tag in tags(source, &SupportedLanguage::Erb) {
+        if tag.kind == TagKind::Comment {
+            continue;
+        }
+        row += source[offset..tag.code.start].matches('\n').count();
+        offset = tag.code.start;
+        for (index, code) in source[tag.code].lines().enumerate() {
+            let code = code.trim();
+            if code.is_empty() {
+                continue;
+            }
+            let line = &mut lines[row + index];
+            if !line.is_empty() {
+                line.push_str("; ");
+            }
+            line.push_str(code);
+        }
+    }
+    let mut program = lines.join("\n");
+    program.push('\n');
+    program
+}
+
+/// Lists the tags of a template in source order. An unterminated tag ends
+/// the list, as the rest of the template is the engine's syntax error.
+fn tags(source: &str, language: &SupportedLanguage) -> Vec<Tag> {
+    let mut tags = Vec::new();
+    let mut offset = 0;
+    while let Some(tag) = next_tag(source, offset, language) {
+        offset = tag.range.end;
+        if *language == SupportedLanguage::Jinja && first_word(&source[tag.code.clone()]) == "raw" {
+            // The text up to `{% endraw %}` is output as is
+            tags.push(tag);
+            match source[offset..].find("endraw") {
+                Some(position) => offset += position,
+                None => break,
+            }
+            let Some(start) = source[..offset].rfind("{%") else {
+                break;
+            };
+            offset = start;
+            continue;
+        }
+        tags.push(tag);
+    }
+    tags
+}
+
+fn next_tag(source: &str, offset: usize, language: &SupportedLanguage) -> Option<Tag> {
+    let mut offset = offset;
+    loop {
+        let start = offset + find_opener(&source[offset..], language)?;
+        let opener = &source[start..];
+        let (kind, open_len, close) = match language {
+            SupportedLanguage::Erb => {
+                if opener.starts_with("<%%") {
+                    // A literal `<%`
+                    offset = start + 3;
+                    continue;
+                }
+                match opener.as_bytes().get(2) {
+                    Some(b'#') => (TagKind::Comment, 3, "%>"),
+                    Some(b'=') if opener.starts_with("<%==") => (TagKind::Interpolation, 4, "%>"),
+                    Some(b'=') => (TagKind::Interpolation, 3, "%>"),
+                    Some(b'-') => (TagKind::Statement, 3, "%>"),
+                    _ => (TagKind::Statement, 2, "%>"),
+                }
+            }
+            SupportedLanguage::Jinja => match opener.as_bytes()[1] {
+                b'{' => (TagKind::Interpolation, 2, "}}"),
+                b'%' => (TagKind::Statement, 2, "%}"),
+                _ => (TagKind::Comment, 2, "#}"),
+            },
+            // Go's kind depends on the action, see below
+            _ => (TagKind::Interpolation, 2, "}}"),
+        };
+        let inner_start = start + open_len;
+        let inner_end = inner_start + source[inner_start..].find(close)?;
+        let end = inner_end + close.len();
+
+        let code = source[inner_start..inner_end]
+            .trim_start_matches(['-', '+'])
+            .trim_start();
+        let code_start = inner_end - code.len();
+        let code = code.trim_end_matches(['-', '+']).trim_end();
+        let code = code_start..code_start + code.len();
+
+        let kind = if *language == SupportedLanguage::GoTemplate {
+            go_kind(&source[code.clone()])
+        } else {
+            kind
+        };
+        return Some(Tag {
+            kind,
+            range: start..end,
+            code,
+        });
+    }
+}
+
+/// Returns the offset of the next tag opener in `text`.
+fn find_opener(text: &str, language: &SupportedLanguage) -> Option<usize> {
+    match language {
+        SupportedLanguage::Erb => text.find("<%"),
+        SupportedLanguage::Jinja => text
+            .match_indices('{')
+            .map(|(index, _)| index)
+            .find(|&index| matches!(text.as_bytes().get(index + 1), Some(b'{' | b'%' | b'#'))),
+        _ => text.find("{{"),
+    }
+}
+
+fn go_kind(code: &str) -> TagKind {
+    if code.starts_with("/*") {
+        TagKind::Comment
+    } else if GO_KEYWORDS.contains(&first_word(code))
+        || (code.starts_with('$') && code.contains('='))
+    {
+        TagKind::Statement
+    } else {
+        TagKind::Interpolation
+    }
+}
+
+fn jinja_control(code: &str) -> (Option<Construct>, Nesting) {
+    match first_word(code) {
+        "if" => (Some(Construct::Conditional), Nesting::Opens),
+        "elif" => (Some(Construct::Conditional), Nesting::Stays),
+        "for" => (Some(Construct::Loop), Nesting::Opens),
+        // `{% set x %}...{% endset %}` captures a block, `{% set x = 1 %}` does not
+        "set" if !code.contains('=') => (None, Nesting::Opens),
+        word if JINJA_BLOCKS.contains(&word) => (None, Nesting::Opens),
+        word if word.starts_with("end") => (None, Nesting::Closes),
+        _ => (None, Nesting::Stays),
+    }
+}
+
+fn go_control(code: &str) -> (Option<Construct>, Nesting) {
+    match first_word(code) {
+        "if" | "with" => (Some(Construct::Conditional), Nesting::Opens),
+        "else" => {
+            let branch = code["else".len()..].trim_start();
+            let construct = matches!(first_word(branch), "if" | "with");
+            (construct.then_some(Construct::Conditional), Nesting::Stays)
+        }
+        "range" => (Some(Construct::Loop), Nesting::Opens),
+        "define" | "block" => (None, Nesting::Opens),
+        "end" => (None, Nesting::Closes),
+        _ => (None, Nesting::Stays),
+    }
+}
+
+fn ruby_control(code: &str) -> (Option<Construct>, Nesting) {
+    let (construct, nesting) = match first_word(code) {
+        "if" | "unless" => (Some(Construct::Conditional), Nesting::Opens),
+        "elsif" | "when" => (Some(Construct::Conditional), Nesting::Stays),
+        "case" => (None, Nesting::Opens),
+        "while" | "until" | "for" => (Some(Construct::Loop), Nesting::Opens),
+        "end" => (None, Nesting::Closes),
+        word if opens_do_block(code) => {
+            let iterates = word == "loop"
+                || RUBY_ITERATORS
+                    .iter()
+                    .any(|method| code.contains(&format!(".{method}")));
+            (iterates.then_some(Construct::Loop), Nesting::Opens)
+        }
+        _ => (None, Nesting::Stays),
+    };
+    // `<% if admin? then %>...<% end %>` spans tags, `<% if a then b end %>` does not
+    if nesting == Nesting::Opens && code.split_whitespace().next_back() == Some("end") {
+        return (construct, Nesting::Stays);
+    }
+    (construct, nesting)
+}
+
+/// Returns true if Ruby code ends by opening a `do` block, with or without
+/// block parameters.
+fn opens_do_block(code: &str) -> bool {
+    let code = match code.strip_suffix('|') {
+        Some(rest) => rest.rfind('|').map_or(code, |start| &rest[..start]),
+        None => code,
+    };
+    let code = code.trim_end();
+    code.strip_suffix("do")
+        .is_some_and(|rest| rest.is_empty() || rest.ends_with([' ', ')']))
+}
+
+/// Returns the leading identifier of a tag's code.
+fn first_word(code: &str) -> &str {
+    let end = code
+        .find(|c: char| !(c.is_alphanumeric() || c == '_'))
+        .unwrap_or(code.len());
+    &code[..end]
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn stats(
+        interpolations: usize,
+        conditionals: usize,
+        loops: usize,
+        max_depth: usize,
+    ) -> Option<TemplateStats> {
+        Some(TemplateStats {
+            interpolations,
+            conditionals,
+            loops,
+            max_depth,
+        })
+    }
+
+    #[test]
+    fn test_jinja_template_stats() {
+        let source = r#"{# Order summary #}
+{% extends "base.html" %}
+{% block content %}
+  {% for item in order.items %}
+    {% if item.discount %}
+      <s>{{ item.price }}</s> {{ item.discounted_price }}
+    {% elif item.free -%}
+      Free
+    {%- else %}
+      {{ item.price | currency }}
+    {% endif %}
+  {% endfor %}
+  {% raw %}{{ not a tag }}{% endraw %}
+  {% set total = order.total %}
+{% endblock %}
+"#;
+        assert_eq!(
+            template_stats(source, &SupportedLanguage::Jinja),
+            stats(3, 2, 1, 3)
+        );
+    }
+
+    #[test]
+    fn test_go_template_stats() {
+        let source = r#"{{/* Order summary */}}
+{{ define "order" }}
+  {{- $total := 0 -}}
+  {{ range .Items }}
+    {{ if .Discount }}{{ .DiscountedPrice }}{{ else if .Free }}free{{ else }}{{ .Price }}{{ end }}
+  {{ end }}
+  {{ with .Customer }}{{ .Name }}{{ end }}
+  {{ template "footer" . }}
+{{ end }}
+"#;
+        assert_eq!(
+            template_stats(source, &SupportedLanguage::GoTemplate),
+            stats(3, 3, 1, 3)
+        );
+    }
+
+    #[test]
+    fn test_erb_template_stats() {
+        let source = r#"<%# Order summary %>
+<%= form_with(model: @order) do |form| %>
+  <% @order.items.each do |item| %>
+    <% if item.discount? %>
+      <%= item.discounted_price %>
+    <% elsif item.free? %>
+      Free
+    <% end %>
+  <% end %>
+  <% if @order.gift? then %>Gift<% end %>
+  <%= "Paid" if @order.paid? %>
+  <%%= escaped %>
+<% end %>
+"#;
+        assert_eq!(
+            template_stats(source, &SupportedLanguage::Erb),
+            stats(3, 3, 1, 3)
+        );
+    }
+
+    #[test]
+    fn test_template_stats_other_languages() {
+        assert_eq!(template_stats("{{ x }}", &SupportedLanguage::Html), None);
+    }
+
+    #[test]
+    fn test_text_and_comment_ranges() {
+        let source = "<h1>{{ title }}</h1>\n{# note #}{# more #}\n";
+        let language = SupportedLanguage::Jinja;
+        assert_eq!(comment_ranges(source, &language), [21..31, 31..41]);
+        assert_eq!(text_ranges(source, &language), [0..4, 15..21, 41..42]);
+    }
+
+    #[test]
+    fn test_unterminated_tag() {
+        let source = "{{ name }}\n{% if open\n";
+        assert_eq!(
+            template_stats(source, &SupportedLanguage::Jinja),
+            stats(1, 0, 0, 0)
+        );
+    }
+
+    #[test]
+    fn test_ruby_code() {
+        let source = "<ul>\n  <% items.each do |item| %><li><%= item.name %></li>\n  <%# hidden %>\n  <% end %>\n</ul>\n";
+        assert_eq!(
+            ruby_code(source),
+            "\nitems.each do |item|; item.name\n\nend\n\n"
+        );
+    }
+}
@@ -0,0 +1,209 @@
+//! Resources, modules, variables, and outputs of Terraform configurations.
+//!
+//! A Terraform file is a body of top-level blocks, each introduced by its
+//! type and labels, as in `resource "aws_instance" "web" { ... }`. Managed
+//! resources are broken down by the provider they belong to: the one named
+//! by their `provider` argument (`provider = aws.west` is `aws`), or else the
+//! prefix of their type before the first `_`, `aws` for `aws_instance`.
+//! Other HCL files, such as Packer templates and Terragrunt configurations,
+//! are parsed the same way, but only the Terraform block types are counted.
+
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use tree_sitter::Node;
+
+/// Top-level blocks of a Terraform configuration.
+#[derive(Default, Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct TerraformStats {
+    /// Number of `resource` blocks
+    pub resources: usize,
+    /// Number of `data` blocks
+    pub data_sources: usize,
+    /// Number of `module` calls
+    pub modules: usize,
+    /// Number of `variable` declarations
+    pub variables: usize,
+    /// Number of `output` declarations
+    pub outputs: usize,
+    /// Number of `resource` blocks per provider
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub providers: BTreeMap<String, usize>,
+}
+
+impl TerraformStats {
+    /// Adds all counts from `other` into this instance.
+    pub(crate) fn merge(&mut self, other: &TerraformStats) {
+        self.resources += other.resources;
+        self.data_sources += other.data_sources;
+        self.modules += other.modules;
+        self.variables += other.variables;
+        self.outputs += other.outputs;
+        for (provider, count) in &other.providers {
+            *self.providers.entry(provider.clone()).or_default() += count;
+        }
+    }
+}
+
+/// Counts the top-level blocks of a Terraform file by type.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the tree parsed from `source`
+/// * `source` - The file's contents
+pub(crate) fn terraform_stats(root: &Node, source: &[u8]) -> TerraformStats {
+    let mut stats = TerraformStats::default();
+    let mut cursor = root.walk();
+    let bodies: Vec<Node> = root
+        .named_children(&mut cursor)
+        .filter(|child| child.kind() == "body")
+        .collect();
+    for body in bodies {
+        let mut cursor = body.walk();
+        for block in body
+            .named_children(&mut cursor)
+            .filter(|child| child.kind() == "block")
+        {
+            match block_type(&block, source) {
+                Some("resource") => {
+                    stats.resources += 1;
+                    if let Some(provider) = provider(&block, source) {
+                        *stats.providers.entry(provider.to_string()).or_default() += 1;
+                    }
+                }
+                Some("data") => stats.data_sources += 1,
+                Some("module") => stats.modules += 1,
+                Some("variable") => stats.variables += 1,
+                Some("output") => stats.outputs += 1,
+                _ => {}
+            }
+        }
+    }
+    stats
+}
+
+/// Returns the type of a block, the identifier before its labels, or the
+/// name of an attribute.
+pub(crate) fn block_type<'a>(block: &Node, source: &'a [u8]) -> Option<&'a str> {
+    let mut cursor = block.walk();
+    let identifier = block
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "identifier")?;
+    identifier.utf8_text(source).ok()
+}
+
+/// Returns true for a block directly in the file's body, not nested in
+/// another block like `lifecycle` or `ingress`.
+pub(crate) fn is_top_level(block: &Node) -> bool {
+    block
+        .parent()
+        .and_then(|body| body.parent())
+        .is_some_and(|parent| parent.kind() == "config_file")
+}
+
+/// Returns the expression assigned to an argument of a block, as written.
+pub(crate) fn argument<'a>(block: &Node, source: &'a [u8], name: &str) -> Option<&'a str> {
+    let mut cursor = block.walk();
+    let body = block
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "body")?;
+    let mut cursor = body.walk();
+    let attribute = body
+        .named_children(&mut cursor)
+        .filter(|child| child.kind() == "attribute")
+        .find(|attribute| block_type(attribute, source) == Some(name))?;
+    let mut cursor = attribute.walk();
+    let expression = attribute
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "expression")?;
+    expression.utf8_text(source).ok()
+}
+
+/// Returns the provider of a resource block, see the module documentation.
+fn provider<'a>(block: &Node, source: &'a [u8]) -> Option<&'a str> {
+    if let Some(provider) = argument(block, source, "provider") {
+        return provider.split('.').next();
+    }
+    let mut cursor = block.walk();
+    let resource_type = block
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "string_lit")?
+        .utf8_text(source)
+        .ok()?
+        .trim_matches('"');
+    resource_type.split('_').next()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::language::SupportedLanguage;
+    use crate::parser::create_parser;
+
+    #[test]
+    fn test_terraform_stats() {
+        let source = r#"variable "region" {
+  description = "AWS region to deploy to"
+  default     = "eu-west-1"
+}
+
+resource "aws_instance" "web" {
+  ami = data.aws_ami.ubuntu.id
+
+  lifecycle {
+    create_before_destroy = true
+  }
+}
+
+resource "aws_s3_bucket" "logs" {
+  provider = aws.west
+}
+
+resource "random_id" "suffix" {
+  byte_length = 4
+}
+
+data "aws_ami" "ubuntu" {
+  most_recent = true
+}
+
+module "vpc" {
+  source = "./modules/vpc"
+}
+
+output "url" {
+  value = aws_instance.web.public_dns
+}
+"#;
+        let tree = create_parser(&SupportedLanguage::Hcl)
+            .unwrap()
+            .parse(source, None)
+            .unwrap();
+        let stats = terraform_stats(&tree.root_node(), source.as_bytes());
+        assert_eq!(
+            stats,
+            TerraformStats {
+                resources: 3,
+                data_sources: 1,
+                modules: 1,
+                variables: 1,
+                outputs: 1,
+                providers: BTreeMap::from([("aws".to_string(), 2), ("random".to_string(), 1)]),
+            }
+        );
+    }
+
+    #[test]
+    fn test_merge_adds_providers() {
+        let stats = |resources: &[(&str, usize)]| TerraformStats {
+            resources: resources.iter().map(|(_, count)| count).sum(),
+            providers: resources
+                .iter()
+                .map(|(provider, count)| (provider.to_string(), *count))
+                .collect(),
+            ..TerraformStats::default()
+        };
+        let mut total = stats(&[("aws", 2)]);
+        total.merge(&stats(&[("aws", 1), ("google", 3)]));
+        assert_eq!(total, stats(&[("aws", 3), ("google", 3)]));
+    }
+}
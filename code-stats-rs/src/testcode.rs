@@ -0,0 +1,100 @@
+//! Detection of test files by the naming conventions of each language.
+//!
+//! Test files stay part of the code totals; directory analysis additionally
+//! totals them in `DirectoryStats::tests` and reports how much test code
+//! there is per line of production code, overall and per directory.
+
+use crate::language::SupportedLanguage;
+use std::path::Path;
+
+/// Directories whose source files are all tests.
+const TEST_DIRS: [&str; 4] = ["test", "tests", "__tests__", "spec"];
+
+/// Returns true if the file at `relative` (a path below the analyzed root)
+/// is a test, going by its name or a test directory on its path.
+///
+/// Only source code can be a test: documents, configuration, build files,
+/// and schemas in a test directory are not.
+pub(crate) fn is_test_file(relative: &Path, language: SupportedLanguage) -> bool {
+    let name = relative
+        .file_name()
+        .and_then(|name| name.to_str())
+        .unwrap_or_default();
+    let stem = name.split('.').next().unwrap_or_default();
+    let Some(by_name) = language.rules().is_test_name(name, stem) else {
+        return false;
+    };
+    by_name
+        || relative.parent().is_some_and(|parent| {
+            parent
+                .components()
+                .any(|component| TEST_DIRS.iter().any(|dir| component.as_os_str() == *dir))
+        })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_is_test_file_by_name() {
+        let cases = [
+            ("pkg/cart_test.go", SupportedLanguage::Go, true),
+            ("pkg/cart.go", SupportedLanguage::Go, false),
+            ("app/test_views.py", SupportedLanguage::Python, true),
+            ("app/views_test.py", SupportedLanguage::Python, true),
+            ("app/conftest.py", SupportedLanguage::Python, true),
+            ("app/testing.py", SupportedLanguage::Python, false),
+            ("lib/cart_spec.rb", SupportedLanguage::Ruby, true),
+            ("src/cart.test.ts", SupportedLanguage::TypeScript, true),
+            ("src/Cart.spec.jsx", SupportedLanguage::JavaScript, true),
+            ("src/contest.ts", SupportedLanguage::TypeScript, false),
+            ("src/CartTest.java", SupportedLanguage::Java, true),
+            ("Shop/CartTests.cs", SupportedLanguage::CSharp, true),
+            ("src/Contest.java", SupportedLanguage::Java, false),
+            ("net/http_unittest.cc", SupportedLanguage::Cpp, true),
+            ("src/CartSuite.scala", SupportedLanguage::Scala, true),
+            ("src/CartSpec.groovy", SupportedLanguage::Groovy, true),
+            ("apps/shop/cart_test.exs", SupportedLanguage::Elixir, true),
+            ("src/cart_SUITE.erl", SupportedLanguage::Erlang, true),
+            ("src/cart_tests.erl", SupportedLanguage::Erlang, true),
+            ("src/cart.erl", SupportedLanguage::Erlang, false),
+            ("src/Shop/CartSpec.hs", SupportedLanguage::Haskell, true),
+            ("lib/test_cart.ml", SupportedLanguage::OCaml, true),
+            ("src/test_cart.nim", SupportedLanguage::Nim, true),
+            ("src/cart_test.zig", SupportedLanguage::Zig, false),
+            ("lua/cart_spec.lua", SupportedLanguage::Lua, true),
+            ("scripts/cart.lua", SupportedLanguage::Lua, false),
+            ("infra/vpc.tftest.hcl", SupportedLanguage::Hcl, true),
+            ("infra/vpc.tf", SupportedLanguage::Hcl, false),
+            ("src/lib.rs", SupportedLanguage::Rust, false),
+        ];
+        for (path, language, expected) in cases {
+            assert_eq!(is_test_file(Path::new(path), language), expected, "{path}");
+        }
+    }
+
+    #[test]
+    fn test_is_test_file_by_directory() {
+        assert!(is_test_file(
+            Path::new("tests/cli_options.rs"),
+            SupportedLanguage::Rust
+        ));
+        assert!(is_test_file(
+            Path::new("src/test/java/shop/CartIT.java"),
+            SupportedLanguage::Java
+        ));
+        assert!(is_test_file(
+            Path::new("web/__tests__/cart.js"),
+            SupportedLanguage::JavaScript
+        ));
+        assert!(!is_test_file(
+            Path::new("tests/fixtures.json"),
+            SupportedLanguage::Json
+        ));
+        assert!(!is_test_file(
+            Path::new("src/tests.rs"),
+            SupportedLanguage::Rust
+        ));
+    }
+}
@@ -0,0 +1,321 @@
+//! TODO, FIXME, HACK, and XXX comments, and who wrote them when.
+//!
+//! Markers are found in comment nodes only, so a `"TODO"` in a string
+//! literal is not one. A marker must be a whole, upper-case word: `TODO:`,
+//! `TODO(alice)`, and `FIXME -` count, while `todos` and `TODOS` don't.
+//! With `--blame`, git blame supplies the author of each marked line and its
+//! age in days.
+
+use crate::comments::is_comment;
+use crate::diff::git;
+use crate::error::{CodeStatsError, Result};
+use crate::stats::DirectoryStats;
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::path::{Path, PathBuf};
+use std::time::{SystemTime, UNIX_EPOCH};
+use tree_sitter::Node;
+
+/// Markers looked for unless `--todo-markers` or the configuration file
+/// names others.
+pub(crate) const DEFAULT_MARKERS: [&str; 4] = ["TODO", "FIXME", "HACK", "XXX"];
+
+const SECONDS_PER_DAY: u64 = 24 * 60 * 60;
+
+/// A comment line carrying a marker.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct TodoComment {
+    /// The marker found, e.g. `FIXME`
+    pub marker: String,
+    /// 1-based line of the marker
+    pub line: usize,
+    /// The rest of the line after the marker and its punctuation
+    pub text: String,
+}
+
+/// A marked comment of the `--todos` inventory.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct TodoItem {
+    /// Path of the file containing the comment
+    pub path: PathBuf,
+    #[serde(flatten)]
+    pub comment: TodoComment,
+    /// Author of the line according to git blame
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub author: Option<String>,
+    /// Days since the line was committed according to git blame
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub age_days: Option<u64>,
+}
+
+/// Finds the marked lines in the comments of a parsed file.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the tree parsed from `source`
+/// * `source` - The source code the tree was parsed from
+/// * `markers` - The markers to look for, matched case-sensitively
+pub(crate) fn todo_comments(root: &Node, source: &str, markers: &[String]) -> Vec<TodoComment> {
+    let mut todos = Vec::new();
+    let mut stack = vec![*root];
+    while let Some(node) = stack.pop() {
+        if is_comment(&node) {
+            let text = &source[node.byte_range()];
+            for (offset, line) in text.lines().enumerate() {
+                if let Some((marker, rest)) = find_marker(line, markers) {
+                    todos.push(TodoComment {
+                        marker: marker.to_string(),
+                        line: node.start_position().row + offset + 1,
+                        text: rest.to_string(),
+                    });
+                }
+            }
+            continue;
+        }
+        let mut cursor = node.walk();
+        let children: Vec<Node> = node.children(&mut cursor).collect();
+        stack.extend(children.into_iter().rev());
+    }
+    todos
+}
+
+/// Returns the first marker that occurs as a whole word in `line`, with the
+/// text after it.
+fn find_marker<'a>(line: &'a str, markers: &'a [String]) -> Option<(&'a str, &'a str)> {
+    let is_word = |c: char| c.is_alphanumeric() || c == '_';
+    let mut found: Option<(usize, &str)> = None;
+    for marker in markers {
+        let mut from = 0;
+        while let Some(index) = line[from..].find(marker.as_str()).map(|i| i + from) {
+            let end = index + marker.len();
+            let before = line[..index].chars().next_back();
+            let after = line[end..].chars().next();
+            if !before.is_some_and(is_word) && !after.is_some_and(is_word) {
+                if found.is_none_or(|(first, _)| index < first) {
+                    found = Some((index, marker));
+                }
+                break;
+            }
+            from = end;
+        }
+    }
+    let (index, marker) = found?;
+    let rest = line[index + marker.len()..]
+        .trim_start_matches(|c: char| c == ':' || c == '-' || c.is_whitespace())
+        .trim_end()
+        .trim_end_matches("*/")
+        .trim_end_matches("-->")
+        .trim_end();
+    Some((marker, rest))
+}
+
+/// Lists the marked comments of the files counted in the code totals, by
+/// path and line.
+pub(crate) fn todo_items(stats: &DirectoryStats) -> Vec<TodoItem> {
+    let mut items: Vec<TodoItem> = stats
+        .code_file_stats()
+        .flat_map(|file| {
+            file.stats.todos.iter().map(|comment| TodoItem {
+                path: file.path.clone(),
+                comment: comment.clone(),
+                author: None,
+                age_days: None,
+            })
+        })
+        .collect();
+    items.sort_by(|a, b| (&a.path, a.comment.line).cmp(&(&b.path, b.comment.line)));
+    items
+}
+
+/// Fills in the author and age of each item from git blame.
+///
+/// Files git can't blame, such as untracked ones, and lines not committed
+/// yet keep no author.
+///
+/// # Returns
+///
+/// * `Ok(())` - Every file was blamed
+/// * `Err(GitError)` - The first file that could not be blamed
+pub(crate) fn add_blame(items: &mut [TodoItem]) -> Result<()> {
+    let now = SystemTime::now()
+        .duration_since(UNIX_EPOCH)
+        .map_or(0, |elapsed| elapsed.as_secs());
+    let mut first_error = None;
+    let mut blamed: HashMap<PathBuf, HashMap<usize, BlameLine>> = HashMap::new();
+    for item in items.iter_mut() {
+        if !blamed.contains_key(&item.path) {
+            let lines = blame(&item.path).unwrap_or_else(|e| {
+                first_error.get_or_insert(e);
+                HashMap::new()
+            });
+            blamed.insert(item.path.clone(), lines);
+        }
+        if let Some(line) = blamed[&item.path].get(&item.comment.line) {
+            item.author = Some(line.author.clone());
+            item.age_days = Some(now.saturating_sub(line.time) / SECONDS_PER_DAY);
+        }
+    }
+    first_error.map_or(Ok(()), Err)
+}
+
+/// Author and commit time of a line.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct BlameLine {
+    pub author: String,
+    /// Author time in seconds since the Unix epoch
+    pub time: u64,
+}
+
+/// Runs git blame on a file and returns the committed lines by number.
+pub(crate) fn blame(path: &Path) -> Result<HashMap<usize, BlameLine>> {
+    let dir = match path.parent() {
+        Some(parent) if !parent.as_os_str().is_empty() => parent,
+        _ => Path::new("."),
+    };
+    let name = path
+        .file_name()
+        .ok_or_else(|| CodeStatsError::GitError(format!("{} is not a file", path.display())))?;
+    let output = git(
+        dir,
+        &["blame", "--porcelain", "--", &name.to_string_lossy()],
+    )?;
+    Ok(parse_porcelain(&output))
+}
+
+/// Parses `git blame --porcelain` output. Commit details are only given the
+/// first time a commit appears, so they are remembered by hash.
+fn parse_porcelain(output: &str) -> HashMap<usize, BlameLine> {
+    let mut commits: HashMap<&str, BlameLine> = HashMap::new();
+    let mut lines = HashMap::new();
+    let mut current: Option<(&str, usize)> = None;
+    for line in output.lines() {
+        if line.starts_with('\t') {
+            if let Some((hash, number)) = current.take()
+                && let Some(commit) = commits.get(hash)
+                // Lines not committed yet have an all-zero hash
+                && hash.bytes().any(|b| b != b'0')
+            {
+                lines.insert(number, commit.clone());
+            }
+            continue;
+        }
+        let mut words = line.split(' ');
+        let first = words.next().unwrap_or_default();
+        if first.len() == 40 && first.bytes().all(|b| b.is_ascii_hexdigit()) {
+            let number = words.nth(1).and_then(|n| n.parse().ok());
+            current = number.map(|number| (first, number));
+            commits.entry(first).or_insert(BlameLine {
+                author: String::new(),
+                time: 0,
+            });
+            continue;
+        }
+        let Some((hash, _)) = current else {
+            continue;
+        };
+        let Some(commit) = commits.get_mut(hash) else {
+            continue;
+        };
+        if let Some(author) = line.strip_prefix("author ") {
+            commit.author = author.to_string();
+        } else if let Some(time) = line.strip_prefix("author-time ") {
+            commit.time = time.parse().unwrap_or_default();
+        }
+    }
+    lines
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::language::SupportedLanguage;
+    use crate::parser::create_parser;
+
+    fn markers() -> Vec<String> {
+        DEFAULT_MARKERS
+            .iter()
+            .map(|marker| marker.to_string())
+            .collect()
+    }
+
+    #[test]
+    fn test_find_marker() {
+        let markers = markers();
+        assert_eq!(
+            find_marker("// TODO: handle symlinks", &markers),
+            Some(("TODO", "handle symlinks"))
+        );
+        assert_eq!(
+            find_marker("/* FIXME(alice) - off by one */", &markers),
+            Some(("FIXME", "(alice) - off by one"))
+        );
+        // The first marker on the line wins
+        assert_eq!(
+            find_marker("# XXX: TODO later", &markers),
+            Some(("XXX", "TODO later"))
+        );
+        assert_eq!(find_marker("# HACK", &markers), Some(("HACK", "")));
+        assert_eq!(find_marker("// TODOS and todo: no", &markers), None);
+        assert_eq!(find_marker("// see MYTODO", &markers), None);
+    }
+
+    #[test]
+    fn test_todo_comments_in_comments_only() {
+        let language = SupportedLanguage::Rust;
+        let source = "// TODO: split this up\n\
+                      fn main() {\n\
+                      \x20   let s = \"TODO: not a comment\";\n\
+                      \x20   /* first line\n\
+                      \x20      FIXME: second line */\n\
+                      }\n";
+        let tree = create_parser(&language)
+            .unwrap()
+            .parse(source, None)
+            .unwrap();
+        let found = todo_comments(&tree.root_node(), source, &markers());
+        assert_eq!(
+            found,
+            [
+                TodoComment {
+                    marker: "TODO".to_string(),
+                    line: 1,
+                    text: "split this up".to_string(),
+                },
+                TodoComment {
+                    marker: "FIXME".to_string(),
+                    line: 5,
+                    text: "second line".to_string(),
+                },
+            ]
+        );
+    }
+
+    #[test]
+    fn test_parse_porcelain() {
+        let hash = "a".repeat(40);
+        let zero = "0".repeat(40);
+        let output = format!(
+            "{hash} 1 1 2\n\
+             author Alice\n\
+             author-mail <alice@example.com>\n\
+             author-time 1700000000\n\
+             summary Add cart\n\
+             filename cart.rs\n\
+             \t// TODO: tax\n\
+             {hash} 2 2\n\
+             \tfn total() {{}}\n\
+             {zero} 3 3 1\n\
+             author Not Committed Yet\n\
+             author-time 1800000000\n\
+             \t// FIXME: new\n"
+        );
+        let lines = parse_porcelain(&output);
+        let alice = BlameLine {
+            author: "Alice".to_string(),
+            time: 1_700_000_000,
+        };
+        assert_eq!(lines.get(&1), Some(&alice));
+        assert_eq!(lines.get(&2), Some(&alice));
+        assert_eq!(lines.get(&3), None);
+    }
+}
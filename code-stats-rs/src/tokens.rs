@@ -0,0 +1,290 @@
+//! Token counts of files and context budgeting for `--tokens`.
+//!
+//! Two counts are kept per file: the tokens of the syntax tree (its leaves:
+//! identifiers, keywords, punctuation, comments) and an estimate of the
+//! tokens an LLM tokenizer would produce. The estimate follows how BPE
+//! tokenizers split code: every run of letters and digits costs one token per
+//! four characters, started or not; every other visible character costs one;
+//! runs of two or more whitespace characters, such as indentation, cost one,
+//! while single spaces are merged into the next word. It is meant for
+//! planning prompts, not for exact accounting.
+
+use crate::stats::DirectoryStats;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+use tree_sitter::Node;
+
+/// Characters of a word per estimated LLM token.
+const CHARS_PER_TOKEN: usize = 4;
+
+/// Syntax and estimated LLM token counts.
+#[derive(Default, Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct TokenStats {
+    /// Leaves of the syntax tree, excluding zero-width MISSING tokens
+    pub syntax: usize,
+    /// Approximate number of LLM tokenizer tokens
+    pub llm: usize,
+}
+
+impl TokenStats {
+    /// Counts the tokens of a parsed file.
+    ///
+    /// # Arguments
+    ///
+    /// * `root` - Root node of the tree parsed from `source`
+    /// * `source` - The source code the tree was parsed from
+    pub(crate) fn new(root: &Node, source: &str) -> Self {
+        Self {
+            syntax: syntax_tokens(root),
+            llm: estimate_llm_tokens(source),
+        }
+    }
+
+    /// Adds the counts of `other` to this instance.
+    pub(crate) fn merge(&mut self, other: &TokenStats) {
+        self.syntax += other.syntax;
+        self.llm += other.llm;
+    }
+}
+
+/// Counts the non-empty leaves below `root`.
+fn syntax_tokens(root: &Node) -> usize {
+    let mut count = 0;
+    let mut stack = vec![*root];
+    while let Some(node) = stack.pop() {
+        if node.child_count() == 0 {
+            if node.end_byte() > node.start_byte() {
+                count += 1;
+            }
+            continue;
+        }
+        let mut cursor = node.walk();
+        stack.extend(node.children(&mut cursor));
+    }
+    count
+}
+
+/// Estimates the LLM tokens of `source`, see the module documentation.
+pub(crate) fn estimate_llm_tokens(source: &str) -> usize {
+    let mut tokens = 0;
+    let mut word: usize = 0;
+    let mut spaces = 0;
+    for c in source.chars() {
+        if c.is_alphanumeric() || c == '_' {
+            word += 1;
+            if spaces > 1 {
+                tokens += 1;
+            }
+            spaces = 0;
+            continue;
+        }
+        tokens += word.div_ceil(CHARS_PER_TOKEN);
+        word = 0;
+        if c.is_whitespace() {
+            spaces += 1;
+        } else {
+            if spaces > 1 {
+                tokens += 1;
+            }
+            spaces = 0;
+            tokens += 1;
+        }
+    }
+    tokens + word.div_ceil(CHARS_PER_TOKEN) + usize::from(spaces > 1)
+}
+
+/// Token counts of a file or directory.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct TokenRow {
+    pub path: PathBuf,
+    #[serde(flatten)]
+    pub tokens: TokenStats,
+}
+
+/// Token counts of every analyzed file and of the directories containing
+/// them.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct TokenReport {
+    /// Every file by path
+    pub files: Vec<TokenRow>,
+    /// Every directory below and including the root by path, with the
+    /// counts of all files below it
+    pub directories: Vec<TokenRow>,
+    /// Counts of all files
+    pub total: TokenStats,
+    /// The files that fit `--fit-budget`, if given
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub budget: Option<BudgetFit>,
+}
+
+/// The files selected for a context budget.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct BudgetFit {
+    /// The budget in estimated LLM tokens
+    pub budget: usize,
+    /// Estimated LLM tokens of the selected files
+    pub used: usize,
+    /// Files that fit, by path
+    pub fits: Vec<PathBuf>,
+    /// Files left out, by path
+    pub left_out: Vec<PathBuf>,
+}
+
+/// Collects the token counts of every analyzed file, including configuration,
+/// generated, and test files, with per-directory totals.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics of the analyzed files
+/// * `root` - The analyzed directory, the top of the directory totals
+/// * `budget` - Context budget in estimated LLM tokens to select files for
+pub(crate) fn token_report(
+    stats: &DirectoryStats,
+    root: &Path,
+    budget: Option<usize>,
+) -> TokenReport {
+    let mut files: Vec<TokenRow> = stats
+        .files
+        .iter()
+        .map(|file| TokenRow {
+            path: file.path.clone(),
+            tokens: file.stats.tokens,
+        })
+        .collect();
+    files.sort_by(|a, b| a.path.cmp(&b.path));
+
+    let mut total = TokenStats::default();
+    let mut directories: BTreeMap<&Path, TokenStats> = BTreeMap::new();
+    for file in &files {
+        total.merge(&file.tokens);
+        for dir in file.path.ancestors().skip(1) {
+            if !dir.starts_with(root) {
+                break;
+            }
+            directories.entry(dir).or_default().merge(&file.tokens);
+        }
+    }
+    let directories = directories
+        .into_iter()
+        .map(|(path, tokens)| TokenRow {
+            path: path.to_path_buf(),
+            tokens,
+        })
+        .collect();
+
+    TokenReport {
+        budget: budget.map(|budget| fit_budget(&files, budget)),
+        files,
+        directories,
+        total,
+    }
+}
+
+/// Selects files for a budget, smallest first so that as many as possible
+/// fit; files of equal size are taken by path.
+fn fit_budget(files: &[TokenRow], budget: usize) -> BudgetFit {
+    let mut by_size: Vec<&TokenRow> = files.iter().collect();
+    by_size.sort_by(|a, b| {
+        a.tokens
+            .llm
+            .cmp(&b.tokens.llm)
+            .then_with(|| a.path.cmp(&b.path))
+    });
+    let mut used = 0;
+    let mut fits = Vec::new();
+    let mut left_out = Vec::new();
+    for file in by_size {
+        if used + file.tokens.llm <= budget {
+            used += file.tokens.llm;
+            fits.push(file.path.clone());
+        } else {
+            left_out.push(file.path.clone());
+        }
+    }
+    fits.sort();
+    left_out.sort();
+    BudgetFit {
+        budget,
+        used,
+        fits,
+        left_out,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::language::SupportedLanguage;
+    use crate::parser::{CodeStats, create_parser};
+    use crate::stats::FileStats;
+
+    #[test]
+    fn test_estimate_llm_tokens() {
+        assert_eq!(estimate_llm_tokens(""), 0);
+        // `fn`, `main`, `(`, `)`, `{`, `}`
+        assert_eq!(estimate_llm_tokens("fn main() {}"), 6);
+        // `return_value` is 12 characters, 3 tokens; the indentation is 1
+        assert_eq!(estimate_llm_tokens("    return_value;"), 5);
+        assert_eq!(estimate_llm_tokens("a\n\n"), 2);
+    }
+
+    #[test]
+    fn test_syntax_tokens() {
+        let source = "fn main() {\n    let x = 1;\n}\n";
+        let tree = create_parser(&SupportedLanguage::Rust)
+            .unwrap()
+            .parse(source, None)
+            .unwrap();
+        // fn main ( ) { let x = 1 ; }
+        assert_eq!(syntax_tokens(&tree.root_node()), 11);
+    }
+
+    #[test]
+    fn test_token_report_and_budget() {
+        let mut stats = DirectoryStats::new();
+        for (path, llm) in [("src/a.rs", 300), ("src/api/b.rs", 500), ("c.rs", 100)] {
+            stats.add_file(FileStats {
+                path: PathBuf::from("repo").join(path),
+                language: SupportedLanguage::Rust,
+                stats: CodeStats {
+                    tokens: TokenStats { syntax: llm, llm },
+                    ..Default::default()
+                },
+            });
+        }
+
+        let report = token_report(&stats, Path::new("repo"), Some(450));
+        let paths: Vec<_> = report.files.iter().map(|f| f.path.clone()).collect();
+        assert_eq!(
+            paths,
+            [
+                PathBuf::from("repo/c.rs"),
+                PathBuf::from("repo/src/a.rs"),
+                PathBuf::from("repo/src/api/b.rs")
+            ]
+        );
+        let directories: Vec<_> = report
+            .directories
+            .iter()
+            .map(|d| (d.path.to_string_lossy().to_string(), d.tokens.llm))
+            .collect();
+        assert_eq!(
+            directories,
+            [
+                ("repo".to_string(), 900),
+                ("repo/src".to_string(), 800),
+                ("repo/src/api".to_string(), 500)
+            ]
+        );
+        assert_eq!(report.total.llm, 900);
+
+        let budget = report.budget.unwrap();
+        assert_eq!(budget.used, 400);
+        assert_eq!(
+            budget.fits,
+            [PathBuf::from("repo/c.rs"), PathBuf::from("repo/src/a.rs")]
+        );
+        assert_eq!(budget.left_out, [PathBuf::from("repo/src/api/b.rs")]);
+    }
+}
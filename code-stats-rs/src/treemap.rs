@@ -0,0 +1,451 @@
+//! Treemap of lines of code for the `treemap` subcommand.
+//!
+//! The treemap is a self-contained HTML page with an inline SVG: every
+//! directory is a view of its subdirectories and files as rectangles whose
+//! area is their lines of code, laid out with the squarified algorithm of
+//! Bruls, Huizing, and van Wijk so rectangles stay close to squares. The
+//! color is the highest cyclomatic complexity below the rectangle, from green
+//! at 1 to red at the complexity threshold. Clicking a directory opens its
+//! view; the path above the map leads back up.
+//!
+//! All views are laid out here, so the embedded script only switches between
+//! them.
+
+use crate::html::escape;
+use crate::rollup::{DirectoryRollup, directory_path, rollup};
+use crate::stats::{DirectoryStats, FileStats, Thresholds};
+use std::collections::HashMap;
+use std::fmt::Write;
+use std::path::{Path, PathBuf};
+
+/// Size of the map in SVG units; the page scales it to its width.
+const WIDTH: f64 = 1200.0;
+const HEIGHT: f64 = 700.0;
+
+/// Color of files without functions, whose complexity is unknown.
+const NO_FUNCTIONS: &str = "#c8ccd0";
+
+/// Approximate width of a label character at the label font size.
+const CHAR_WIDTH: f64 = 7.0;
+
+/// Stylesheet embedded in the page.
+const STYLE: &str = r#"
+body { font-family: system-ui, sans-serif; margin: 2rem; color: #222; }
+h1 { margin-bottom: 0.25rem; }
+nav { margin: 1rem 0 0.5rem; font-size: 1.1rem; }
+svg { width: 100%; height: auto; display: block; }
+rect { stroke: #fff; stroke-width: 1; }
+text { font-size: 12px; fill: #fff; pointer-events: none; }
+g.dir { cursor: pointer; }
+g.dir rect { stroke-width: 3; }
+g.dir:hover rect { opacity: 0.85; }
+"#;
+
+/// Script that opens the view of a clicked directory and builds the path of
+/// the shown view.
+const SCRIPT: &str = r##"
+var views = document.querySelectorAll("g.view");
+function show(id) {
+  views.forEach(function (view) { view.style.display = view.id === id ? "" : "none"; });
+  var chain = [];
+  for (var view = document.getElementById(id); view; view = document.getElementById(view.getAttribute("data-parent") || "")) {
+    chain.unshift(view);
+  }
+  var nav = document.getElementById("path");
+  nav.textContent = "";
+  chain.forEach(function (view, index) {
+    if (index > 0) { nav.appendChild(document.createTextNode(" / ")); }
+    var last = index === chain.length - 1;
+    var part = document.createElement(last ? "strong" : "a");
+    part.textContent = view.getAttribute("data-name");
+    if (!last) {
+      part.href = "#";
+      part.addEventListener("click", function (event) { event.preventDefault(); show(view.id); });
+    }
+    nav.appendChild(part);
+  });
+}
+document.querySelectorAll("g.dir").forEach(function (dir) {
+  dir.addEventListener("click", function () { show(dir.getAttribute("data-view")); });
+});
+show("v0");
+"##;
+
+/// A rectangle of the map.
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub(crate) struct Rect {
+    pub x: f64,
+    pub y: f64,
+    pub width: f64,
+    pub height: f64,
+}
+
+/// Splits `bounds` into one rectangle per value, with areas proportional to
+/// the values, using the squarified treemap algorithm.
+///
+/// # Arguments
+///
+/// * `values` - Sizes of the rectangles, largest first for the best aspect
+///   ratios
+/// * `bounds` - The rectangle to fill
+///
+/// # Returns
+///
+/// The rectangles in the order of `values`; all are empty when the values
+/// sum to zero
+pub(crate) fn squarify(values: &[f64], bounds: Rect) -> Vec<Rect> {
+    let total: f64 = values.iter().sum();
+    if total <= 0.0 {
+        return vec![
+            Rect {
+                width: 0.0,
+                height: 0.0,
+                ..bounds
+            };
+            values.len()
+        ];
+    }
+
+    let scale = bounds.width * bounds.height / total;
+    let areas: Vec<f64> = values.iter().map(|value| value * scale).collect();
+    let mut rects = Vec::with_capacity(areas.len());
+    let mut free = bounds;
+    let mut start = 0;
+    while start < areas.len() {
+        // Grow the row along the shorter side while that improves its worst
+        // aspect ratio
+        let side = free.width.min(free.height);
+        let mut end = start + 1;
+        while end < areas.len()
+            && worst(&areas[start..=end], side) <= worst(&areas[start..end], side)
+        {
+            end += 1;
+        }
+
+        let row: f64 = areas[start..end].iter().sum();
+        if free.width >= free.height {
+            let width = if free.height > 0.0 {
+                row / free.height
+            } else {
+                0.0
+            };
+            let mut y = free.y;
+            for area in &areas[start..end] {
+                let height = if width > 0.0 { area / width } else { 0.0 };
+                rects.push(Rect {
+                    x: free.x,
+                    y,
+                    width,
+                    height,
+                });
+                y += height;
+            }
+            free.x += width;
+            free.width = (free.width - width).max(0.0);
+        } else {
+            let height = if free.width > 0.0 {
+                row / free.width
+            } else {
+                0.0
+            };
+            let mut x = free.x;
+            for area in &areas[start..end] {
+                let width = if height > 0.0 { area / height } else { 0.0 };
+                rects.push(Rect {
+                    x,
+                    y: free.y,
+                    width,
+                    height,
+                });
+                x += width;
+            }
+            free.y += height;
+            free.height = (free.height - height).max(0.0);
+        }
+        start = end;
+    }
+    rects
+}
+
+/// Returns the worst aspect ratio of a row of areas laid along `side`.
+fn worst(row: &[f64], side: f64) -> f64 {
+    let sum: f64 = row.iter().sum();
+    let max = row.iter().copied().fold(0.0, f64::max);
+    let min = row.iter().copied().fold(f64::INFINITY, f64::min);
+    let side = side * side;
+    let sum = sum * sum;
+    (side * max / sum).max(sum / (side * min))
+}
+
+/// A subdirectory or file shown in a view.
+struct Item {
+    name: String,
+    path: PathBuf,
+    /// Index of the subdirectory's view, `None` for files
+    view: Option<usize>,
+    code_lines: usize,
+    functions: usize,
+    max_complexity: usize,
+}
+
+/// The map of one directory.
+struct View {
+    name: String,
+    parent: Option<usize>,
+    items: Vec<Item>,
+}
+
+/// Builds the views of `directory` and its subdirectories, depth first.
+fn add_views(
+    directory: &DirectoryRollup,
+    parent: Option<usize>,
+    files: &HashMap<PathBuf, Vec<&FileStats>>,
+    views: &mut Vec<View>,
+) -> usize {
+    let index = views.len();
+    views.push(View {
+        name: directory.name(parent.is_none()),
+        parent,
+        items: Vec::new(),
+    });
+
+    let mut items = Vec::new();
+    for child in directory
+        .children
+        .iter()
+        .filter(|child| child.code_lines > 0)
+    {
+        let view = add_views(child, Some(index), files, views);
+        items.push(Item {
+            name: format!("{}/", child.name(false)),
+            path: child.path.clone(),
+            view: Some(view),
+            code_lines: child.code_lines,
+            functions: child.functions,
+            max_complexity: child.max_complexity,
+        });
+    }
+    for file in files.get(&directory.path).into_iter().flatten() {
+        if file.stats.lines.code == 0 {
+            continue;
+        }
+        items.push(Item {
+            name: file.path.file_name().map_or_else(
+                || file.path.display().to_string(),
+                |name| name.to_string_lossy().into_owned(),
+            ),
+            path: file.path.clone(),
+            view: None,
+            code_lines: file.stats.lines.code,
+            functions: file.stats.function_count,
+            max_complexity: file.stats.max_complexity(),
+        });
+    }
+    items.sort_by(|a, b| {
+        b.code_lines
+            .cmp(&a.code_lines)
+            .then_with(|| a.path.cmp(&b.path))
+    });
+    views[index].items = items;
+    index
+}
+
+/// Returns the fill of a rectangle: green at complexity 1, through yellow, to
+/// red at `threshold` and above.
+fn color(max_complexity: usize, threshold: usize) -> String {
+    if max_complexity == 0 {
+        return NO_FUNCTIONS.to_string();
+    }
+    let share = (max_complexity - 1) as f64 / (threshold.max(2) - 1) as f64;
+    let hue = 120.0 * (1.0 - share.min(1.0));
+    format!("hsl({hue:.0}, 60%, 45%)")
+}
+
+/// Renders the treemap page of the files below `root`.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics of the analyzed files
+/// * `root` - The analyzed directory
+/// * `thresholds` - The complexity threshold sets where the color turns red
+///
+/// # Returns
+///
+/// A complete HTML document with embedded styles and scripts
+pub(crate) fn format_treemap(
+    stats: &DirectoryStats,
+    root: &Path,
+    thresholds: &Thresholds,
+) -> String {
+    let mut files: HashMap<PathBuf, Vec<&FileStats>> = HashMap::new();
+    for file in stats.code_file_stats() {
+        files
+            .entry(directory_path(root, &file.path))
+            .or_default()
+            .push(file);
+    }
+    let mut views = Vec::new();
+    add_views(&rollup(stats, root), None, &files, &mut views);
+
+    let title = escape(&root.display().to_string());
+    let mut output = String::from("<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n");
+    let _ = writeln!(
+        output,
+        "<meta charset=\"utf-8\">\n<title>Treemap of {title}</title>"
+    );
+    let _ = write!(output, "<style>{STYLE}</style>\n</head>\n<body>\n");
+    let _ = writeln!(
+        output,
+        "<h1>Treemap of {title}</h1>\n<p>{} files, {} lines of code. Area is lines of code, color the highest cyclomatic complexity, red from {}. Click a directory to open it.</p>",
+        stats.code_files(),
+        stats.total_stats.lines.code,
+        thresholds.complexity
+    );
+    output.push_str("<nav id=\"path\"></nav>\n");
+    let _ = writeln!(
+        output,
+        "<svg xmlns=\"http://www.w3.org/2000/svg\" viewBox=\"0 0 {WIDTH} {HEIGHT}\">"
+    );
+
+    let bounds = Rect {
+        x: 0.0,
+        y: 0.0,
+        width: WIDTH,
+        height: HEIGHT,
+    };
+    for (index, view) in views.iter().enumerate() {
+        let parent = view
+            .parent
+            .map(|parent| format!(" data-parent=\"v{parent}\""))
+            .unwrap_or_default();
+        let _ = writeln!(
+            output,
+            "<g class=\"view\" id=\"v{index}\" data-name=\"{}\"{parent}>",
+            escape(&view.name)
+        );
+        let sizes: Vec<f64> = view
+            .items
+            .iter()
+            .map(|item| item.code_lines as f64)
+            .collect();
+        for (item, rect) in view.items.iter().zip(squarify(&sizes, bounds)) {
+            output.push_str(&render_item(item, rect, thresholds.complexity));
+        }
+        output.push_str("</g>\n");
+    }
+
+    let _ = write!(
+        output,
+        "</svg>\n<script>{SCRIPT}</script>\n</body>\n</html>\n"
+    );
+    output
+}
+
+/// Renders the rectangle of a subdirectory or file with its tooltip and, if
+/// it fits, its name.
+fn render_item(item: &Item, rect: Rect, threshold: usize) -> String {
+    let name = escape(&item.name);
+    let opening = match item.view {
+        Some(view) => format!("<g class=\"dir\" data-view=\"v{view}\">"),
+        None => "<g>".to_string(),
+    };
+    let label = if rect.width >= item.name.chars().count() as f64 * CHAR_WIDTH + 8.0
+        && rect.height >= 18.0
+    {
+        format!(
+            "<text x=\"{:.1}\" y=\"{:.1}\">{name}</text>",
+            rect.x + 4.0,
+            rect.y + 14.0
+        )
+    } else {
+        String::new()
+    };
+    format!(
+        "{opening}<title>{}\n{} lines of code, {} functions, max complexity {}</title><rect x=\"{:.1}\" y=\"{:.1}\" width=\"{:.1}\" height=\"{:.1}\" fill=\"{}\"/>{label}</g>\n",
+        escape(&item.path.display().to_string()),
+        item.code_lines,
+        item.functions,
+        item.max_complexity,
+        rect.x,
+        rect.y,
+        rect.width,
+        rect.height,
+        color(item.max_complexity, threshold)
+    )
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::stats::test_support::file;
+
+    #[test]
+    fn test_squarify() {
+        let bounds = Rect {
+            x: 0.0,
+            y: 0.0,
+            width: 6.0,
+            height: 4.0,
+        };
+        let rects = squarify(&[6.0, 6.0, 4.0, 3.0, 2.0, 2.0, 1.0], bounds);
+        assert_eq!(rects.len(), 7);
+        // The two largest fill the left half as squares-ish halves
+        assert_eq!(
+            rects[0],
+            Rect {
+                x: 0.0,
+                y: 0.0,
+                width: 3.0,
+                height: 2.0
+            }
+        );
+        assert_eq!(
+            rects[1],
+            Rect {
+                x: 0.0,
+                y: 2.0,
+                width: 3.0,
+                height: 2.0
+            }
+        );
+
+        let area: f64 = rects.iter().map(|r| r.width * r.height).sum();
+        assert!((area - 24.0).abs() < 1e-9);
+        for rect in &rects {
+            assert!(rect.x >= 0.0 && rect.x + rect.width <= 6.0 + 1e-9);
+            assert!(rect.y >= 0.0 && rect.y + rect.height <= 4.0 + 1e-9);
+        }
+
+        let empty = squarify(&[0.0, 0.0], bounds);
+        assert!(empty.iter().all(|rect| rect.width == 0.0));
+    }
+
+    #[test]
+    fn test_color() {
+        assert_eq!(color(0, 10), NO_FUNCTIONS);
+        assert_eq!(color(1, 10), "hsl(120, 60%, 45%)");
+        assert_eq!(color(10, 10), "hsl(0, 60%, 45%)");
+        assert_eq!(color(40, 10), "hsl(0, 60%, 45%)");
+    }
+
+    #[test]
+    fn test_format_treemap() {
+        let mut stats = DirectoryStats::new();
+        stats.add_file(file("proj/src/lib.rs", 300, &[2, 12]));
+        stats.add_file(file("proj/src/<gen>.rs", 50, &[1]));
+        stats.add_file(file("proj/build.rs", 20, &[]));
+        stats.add_file(file("proj/empty.rs", 0, &[]));
+        let html = format_treemap(&stats, Path::new("proj"), &Thresholds::default());
+
+        assert!(html.starts_with("<!DOCTYPE html>"));
+        assert!(html.contains("<title>Treemap of proj</title>"));
+        assert!(html.contains("<g class=\"view\" id=\"v0\" data-name=\"proj\">"));
+        assert!(html.contains("<g class=\"view\" id=\"v1\" data-name=\"src\" data-parent=\"v0\">"));
+        assert!(html.contains("<g class=\"dir\" data-view=\"v1\"><title>proj/src\n350 lines"));
+        assert!(html.contains("<title>proj/src/&lt;gen&gt;.rs\n50 lines of code"));
+        assert!(html.contains(&format!("fill=\"{NO_FUNCTIONS}\"")));
+        // Files without code get no rectangle
+        assert!(!html.contains("empty.rs"));
+        assert_eq!(html.matches("<rect ").count(), 4);
+    }
+}
@@ -0,0 +1,876 @@
+//! Interactive terminal dashboard for the `tui` subcommand.
+//!
+//! The dashboard has three panes, switched with Tab or `1`-`3`: the language
+//! breakdown, a file tree whose directories carry the totals of their
+//! subtree, and a function list. Enter on a language or a file, or `f` on a
+//! directory, drills down into the list of its functions, which `/` searches
+//! and `s` sorts by the columns of `--functions --sort`.
+//!
+//! `Dashboard` turns key presses into state changes and its state into lines
+//! of text; only `run` touches the terminal, so the dashboard is tested
+//! without one.
+
+use crate::cli::FunctionSort;
+use crate::error::{CodeStatsError, Result};
+use crate::formatter::sort_functions;
+use crate::language::SupportedLanguage;
+use crate::parser::FunctionStats;
+use crate::rollup::{DirectoryRollup, directory_path, rollup};
+use crate::stats::{DirectoryStats, FileStats, FunctionRef, LanguageStats};
+use clap::ValueEnum;
+use crossterm::cursor::{Hide, MoveTo, Show};
+use crossterm::event::{self, Event, KeyCode, KeyEventKind, KeyModifiers};
+use crossterm::style::{Attribute, Print, SetAttribute};
+use crossterm::terminal::{self, Clear, ClearType, EnterAlternateScreen, LeaveAlternateScreen};
+use crossterm::{execute, queue};
+use std::collections::{HashMap, HashSet};
+use std::io::{IsTerminal, Write};
+use std::path::{Path, PathBuf};
+
+/// Screen lines that are not part of a pane's rows: the tab bar, the column
+/// headers, and the status line.
+const CHROME_LINES: usize = 3;
+
+/// The panes of the dashboard, in tab order.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum Pane {
+    Languages,
+    Files,
+    Functions,
+}
+
+impl Pane {
+    const ALL: [Pane; 3] = [Pane::Languages, Pane::Files, Pane::Functions];
+
+    fn index(self) -> usize {
+        self as usize
+    }
+
+    fn title(self) -> &'static str {
+        match self {
+            Pane::Languages => "Languages",
+            Pane::Files => "Files",
+            Pane::Functions => "Functions",
+        }
+    }
+}
+
+/// A key press the dashboard responds to.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum Key {
+    Up,
+    Down,
+    Left,
+    Right,
+    PageUp,
+    PageDown,
+    Home,
+    End,
+    Enter,
+    Tab,
+    BackTab,
+    Backspace,
+    Esc,
+    Char(char),
+}
+
+/// A line of the screen; the selected row is highlighted.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct Line {
+    pub text: String,
+    pub highlight: bool,
+}
+
+/// Which functions the function pane lists.
+#[derive(Debug, Clone, PartialEq, Eq)]
+enum Scope {
+    All,
+    Language(SupportedLanguage),
+    /// A file, or a directory and everything below it
+    Path(PathBuf),
+}
+
+/// Order of the entries of each directory in the file tree.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum TreeSort {
+    Code,
+    Complexity,
+    Name,
+}
+
+/// A visible row of the file tree.
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct TreeRow {
+    path: PathBuf,
+    name: String,
+    depth: usize,
+    directory: bool,
+    expanded: bool,
+    code: usize,
+    functions: usize,
+    complexity: usize,
+    max_complexity: usize,
+}
+
+/// State of the dashboard.
+pub(crate) struct Dashboard<'a> {
+    stats: &'a DirectoryStats,
+    tree: DirectoryRollup,
+    /// Code files by the tree path of their directory
+    files_by_directory: HashMap<PathBuf, Vec<&'a FileStats>>,
+    expanded: HashSet<PathBuf>,
+    pane: Pane,
+    /// Selected row of each pane
+    cursors: [usize; 3],
+    /// First visible row of each pane
+    offsets: [usize; 3],
+    scope: Scope,
+    tree_sort: TreeSort,
+    sort: FunctionSort,
+    search: String,
+    searching: bool,
+    /// Rows that fit in a pane at the last render, for paging
+    page: usize,
+}
+
+impl<'a> Dashboard<'a> {
+    /// Creates a dashboard over the statistics of `root`, showing the file
+    /// tree with the root expanded.
+    pub(crate) fn new(stats: &'a DirectoryStats, root: &Path) -> Self {
+        let tree = rollup(stats, root);
+        let mut files_by_directory: HashMap<PathBuf, Vec<&FileStats>> = HashMap::new();
+        for file in stats.code_file_stats() {
+            files_by_directory
+                .entry(directory_path(root, &file.path))
+                .or_default()
+                .push(file);
+        }
+        let expanded = HashSet::from([tree.path.clone()]);
+        Self {
+            stats,
+            tree,
+            files_by_directory,
+            expanded,
+            pane: Pane::Files,
+            cursors: [0; 3],
+            offsets: [0; 3],
+            scope: Scope::All,
+            tree_sort: TreeSort::Code,
+            sort: FunctionSort::Complexity,
+            search: String::new(),
+            searching: false,
+            page: 10,
+        }
+    }
+
+    /// Applies a key press.
+    ///
+    /// # Returns
+    ///
+    /// `false` once the dashboard should be closed
+    pub(crate) fn handle(&mut self, key: Key) -> bool {
+        if self.searching {
+            match key {
+                Key::Char(c) => self.search.push(c),
+                Key::Backspace => {
+                    self.search.pop();
+                }
+                Key::Enter => self.searching = false,
+                Key::Esc => {
+                    self.search.clear();
+                    self.searching = false;
+                }
+                _ => return self.navigate(key),
+            }
+            self.cursors[Pane::Functions.index()] = 0;
+            return true;
+        }
+
+        match key {
+            Key::Char('q') => return false,
+            Key::Tab => self.pane = Pane::ALL[(self.pane.index() + 1) % 3],
+            Key::BackTab => self.pane = Pane::ALL[(self.pane.index() + 2) % 3],
+            Key::Char(c @ '1'..='3') => self.pane = Pane::ALL[c as usize - '1' as usize],
+            Key::Char('/') => {
+                self.pane = Pane::Functions;
+                self.searching = true;
+            }
+            Key::Char('s') => self.cycle_sort(),
+            Key::Enter | Key::Char('f') if self.pane == Pane::Languages => {
+                let languages = self.languages();
+                if let Some(&(&language, _)) = languages.get(self.cursor()) {
+                    self.drill_down(Scope::Language(language));
+                }
+            }
+            Key::Enter | Key::Right | Key::Char('l' | 'f') if self.pane == Pane::Files => {
+                self.open_tree_row(key)
+            }
+            Key::Left | Key::Char('h') if self.pane == Pane::Files => self.close_tree_row(),
+            Key::Esc if self.pane == Pane::Functions => {
+                if !self.search.is_empty() {
+                    self.search.clear();
+                } else {
+                    self.scope = Scope::All;
+                }
+                self.cursors[Pane::Functions.index()] = 0;
+            }
+            _ => return self.navigate(key),
+        }
+        true
+    }
+
+    /// Moves the cursor of the current pane.
+    fn navigate(&mut self, key: Key) -> bool {
+        let rows = self.row_count();
+        let cursor = self.cursor();
+        let last = rows.saturating_sub(1);
+        let moved = match key {
+            Key::Up | Key::Char('k') => cursor.saturating_sub(1),
+            Key::Down | Key::Char('j') => (cursor + 1).min(last),
+            Key::PageUp => cursor.saturating_sub(self.page),
+            Key::PageDown => (cursor + self.page).min(last),
+            Key::Home | Key::Char('g') => 0,
+            Key::End | Key::Char('G') => last,
+            _ => cursor,
+        };
+        self.cursors[self.pane.index()] = moved;
+        true
+    }
+
+    fn cursor(&self) -> usize {
+        self.cursors[self.pane.index()]
+    }
+
+    /// Switches the sort order of the current pane to the next one.
+    fn cycle_sort(&mut self) {
+        match self.pane {
+            Pane::Languages => return,
+            Pane::Files => {
+                self.tree_sort = match self.tree_sort {
+                    TreeSort::Code => TreeSort::Complexity,
+                    TreeSort::Complexity => TreeSort::Name,
+                    TreeSort::Name => TreeSort::Code,
+                }
+            }
+            Pane::Functions => {
+                let sorts = FunctionSort::value_variants();
+                let index = sorts.iter().position(|s| *s == self.sort).unwrap_or(0);
+                self.sort = sorts[(index + 1) % sorts.len()];
+            }
+        }
+        self.cursors[self.pane.index()] = 0;
+    }
+
+    /// Shows the functions of `scope`.
+    fn drill_down(&mut self, scope: Scope) {
+        self.scope = scope;
+        self.search.clear();
+        self.pane = Pane::Functions;
+        self.cursors[Pane::Functions.index()] = 0;
+    }
+
+    /// Expands the selected directory, or drills down into the functions of
+    /// the selected file (or directory, with `f`).
+    fn open_tree_row(&mut self, key: Key) {
+        let rows = self.tree_rows();
+        let Some(row) = rows.get(self.cursor()) else {
+            return;
+        };
+        if !row.directory || key == Key::Char('f') {
+            self.drill_down(Scope::Path(row.path.clone()));
+        } else if !row.expanded {
+            self.expanded.insert(row.path.clone());
+        } else if key == Key::Enter {
+            self.expanded.remove(&row.path);
+        } else if rows
+            .get(self.cursor() + 1)
+            .is_some_and(|next| next.depth > row.depth)
+        {
+            self.cursors[Pane::Files.index()] += 1;
+        }
+    }
+
+    /// Collapses the selected directory, or moves to its parent.
+    fn close_tree_row(&mut self) {
+        let rows = self.tree_rows();
+        let cursor = self.cursor();
+        let Some(row) = rows.get(cursor) else {
+            return;
+        };
+        if row.directory && row.expanded && row.depth > 0 {
+            self.expanded.remove(&row.path);
+        } else if let Some(parent) = rows[..cursor].iter().rposition(|r| r.depth < row.depth) {
+            self.cursors[Pane::Files.index()] = parent;
+        }
+    }
+
+    /// Number of rows of the current pane.
+    fn row_count(&self) -> usize {
+        match self.pane {
+            Pane::Languages => self.languages().len(),
+            Pane::Files => self.tree_rows().len(),
+            Pane::Functions => self.functions().len(),
+        }
+    }
+
+    /// Languages by lines of code, largest first.
+    fn languages(&self) -> Vec<(&'a SupportedLanguage, &'a LanguageStats)> {
+        let mut languages: Vec<_> = self.stats.total_by_language.iter().collect();
+        languages.sort_by(|a, b| {
+            b.1.lines
+                .code
+                .cmp(&a.1.lines.code)
+                .then_with(|| a.0.name().cmp(b.0.name()))
+        });
+        languages
+    }
+
+    /// The visible rows of the file tree, depth first.
+    fn tree_rows(&self) -> Vec<TreeRow> {
+        let mut rows = Vec::new();
+        self.push_directory(&self.tree, 0, &mut rows);
+        rows
+    }
+
+    fn push_directory(&self, directory: &DirectoryRollup, depth: usize, rows: &mut Vec<TreeRow>) {
+        let expanded = self.expanded.contains(&directory.path);
+        rows.push(TreeRow {
+            path: directory.path.clone(),
+            name: format!("{}/", directory.name(depth == 0)),
+            depth,
+            directory: true,
+            expanded,
+            code: directory.code_lines,
+            functions: directory.functions,
+            complexity: directory.complexity,
+            max_complexity: directory.max_complexity,
+        });
+        if !expanded {
+            return;
+        }
+
+        let mut children: Vec<&DirectoryRollup> = directory.children.iter().collect();
+        let mut files: Vec<TreeRow> = self
+            .files_by_directory
+            .get(&directory.path)
+            .into_iter()
+            .flatten()
+            .map(|file| TreeRow {
+                path: file.path.clone(),
+                name: file.path.file_name().map_or_else(
+                    || file.path.display().to_string(),
+                    |name| name.to_string_lossy().into_owned(),
+                ),
+                depth: depth + 1,
+                directory: false,
+                expanded: false,
+                code: file.stats.lines.code,
+                functions: file.stats.function_count,
+                complexity: file.stats.functions.iter().map(|f| f.complexity).sum(),
+                max_complexity: file.stats.max_complexity(),
+            })
+            .collect();
+        match self.tree_sort {
+            TreeSort::Code => {
+                children.sort_by(|a, b| b.code_lines.cmp(&a.code_lines).then(a.path.cmp(&b.path)));
+                files.sort_by(|a, b| b.code.cmp(&a.code).then_with(|| a.path.cmp(&b.path)));
+            }
+            TreeSort::Complexity => {
+                children.sort_by(|a, b| b.complexity.cmp(&a.complexity).then(a.path.cmp(&b.path)));
+                files.sort_by(|a, b| {
+                    b.complexity
+                        .cmp(&a.complexity)
+                        .then_with(|| a.path.cmp(&b.path))
+                });
+            }
+            TreeSort::Name => {
+                children.sort_by(|a, b| a.path.cmp(&b.path));
+                files.sort_by(|a, b| a.path.cmp(&b.path));
+            }
+        }
+        for child in children {
+            self.push_directory(child, depth + 1, rows);
+        }
+        rows.extend(files);
+    }
+
+    /// Functions of the current scope matching the search, in the current
+    /// sort order.
+    fn functions(&self) -> Vec<FunctionRef<'a>> {
+        let needle = self.search.to_lowercase();
+        let mut functions: Vec<FunctionRef<'a>> = self
+            .stats
+            .code_file_stats()
+            .flat_map(|file| {
+                let embedded = file.stats.embedded.iter().flat_map(|(language, code)| {
+                    code.stats.functions.iter().map(move |f| (*language, f))
+                });
+                let own = file.stats.functions.iter().map(move |f| (file.language, f));
+                own.chain(embedded)
+                    .map(move |(language, function)| (file, language, function))
+            })
+            .filter(|(file, language, _)| match &self.scope {
+                Scope::All => true,
+                Scope::Language(scope) => language == scope,
+                Scope::Path(path) => file.path.starts_with(path),
+            })
+            .filter(|(_, _, function)| {
+                needle.is_empty() || display_name(function).to_lowercase().contains(&needle)
+            })
+            .map(|(file, _, function)| FunctionRef {
+                path: &file.path,
+                function,
+            })
+            .collect();
+        sort_functions(&mut functions, self.sort);
+        functions
+    }
+
+    /// Renders the dashboard into `height` lines of at most `width`
+    /// characters.
+    pub(crate) fn render(&mut self, width: usize, height: usize) -> Vec<Line> {
+        let (header, rows) = match self.pane {
+            Pane::Languages => self.language_lines(),
+            Pane::Files => self.tree_lines(),
+            Pane::Functions => self.function_lines(),
+        };
+
+        let page = height.saturating_sub(CHROME_LINES).max(1);
+        self.page = page;
+        let index = self.pane.index();
+        let cursor = self.cursors[index].min(rows.len().saturating_sub(1));
+        self.cursors[index] = cursor;
+        let offset = &mut self.offsets[index];
+        if cursor < *offset {
+            *offset = cursor;
+        } else if cursor >= *offset + page {
+            *offset = cursor + 1 - page;
+        }
+        let offset = *offset;
+
+        let mut lines = vec![
+            Line {
+                text: self.tab_bar(),
+                highlight: false,
+            },
+            Line {
+                text: header,
+                highlight: false,
+            },
+        ];
+        lines.extend(
+            rows.into_iter()
+                .enumerate()
+                .skip(offset)
+                .take(page)
+                .map(|(row, text)| Line {
+                    text,
+                    highlight: row == cursor,
+                }),
+        );
+        lines.resize(
+            height.saturating_sub(1),
+            Line {
+                text: String::new(),
+                highlight: false,
+            },
+        );
+        lines.push(Line {
+            text: self.status_line(),
+            highlight: false,
+        });
+        for line in &mut lines {
+            line.text = truncate(&line.text, width);
+        }
+        lines
+    }
+
+    fn tab_bar(&self) -> String {
+        let tabs: Vec<String> = Pane::ALL
+            .iter()
+            .enumerate()
+            .map(|(index, pane)| {
+                if *pane == self.pane {
+                    format!("[{} {}]", index + 1, pane.title())
+                } else {
+                    format!(" {} {} ", index + 1, pane.title())
+                }
+            })
+            .collect();
+        format!(
+            "{}   {}: {} files, {} lines of code",
+            tabs.join(" "),
+            self.tree.path.display(),
+            self.stats.code_files(),
+            self.stats.total_stats.lines.code
+        )
+    }
+
+    fn status_line(&self) -> String {
+        if self.searching {
+            return format!("Search: {}_", self.search);
+        }
+        let keys = match self.pane {
+            Pane::Languages => "Enter functions",
+            Pane::Files => "Enter/Right open  Left close  f functions  s sort",
+            Pane::Functions => "/ search  s sort  Esc clear",
+        };
+        format!("q quit  Tab pane  Up/Down move  {keys}")
+    }
+
+    fn language_lines(&self) -> (String, Vec<String>) {
+        let header = format!(
+            "{:<14} {:>7} {:>9} {:>9} {:>10} {:>8}",
+            "Language", "Files", "Code", "Comments", "Functions", "Classes"
+        );
+        let rows = self
+            .languages()
+            .iter()
+            .map(|(language, stats)| {
+                format!(
+                    "{:<14} {:>7} {:>9} {:>9} {:>10} {:>8}",
+                    language.name(),
+                    stats.file_count,
+                    stats.lines.code,
+                    stats.lines.comment,
+                    stats.function_count,
+                    stats.class_struct_count
+                )
+            })
+            .collect();
+        (header, rows)
+    }
+
+    fn tree_lines(&self) -> (String, Vec<String>) {
+        let sort = match self.tree_sort {
+            TreeSort::Code => "code",
+            TreeSort::Complexity => "complexity",
+            TreeSort::Name => "name",
+        };
+        let header = format!(
+            "{:>8} {:>6} {:>7} {:>6}  Name (by {sort})",
+            "Code", "Funcs", "CC sum", "Max CC"
+        );
+        let rows = self
+            .tree_rows()
+            .iter()
+            .map(|row| {
+                let marker = match (row.directory, row.expanded) {
+                    (false, _) => " ",
+                    (true, true) => "-",
+                    (true, false) => "+",
+                };
+                format!(
+                    "{:>8} {:>6} {:>7} {:>6}  {}{marker} {}",
+                    row.code,
+                    row.functions,
+                    row.complexity,
+                    row.max_complexity,
+                    "  ".repeat(row.depth),
+                    row.name
+                )
+            })
+            .collect();
+        (header, rows)
+    }
+
+    fn function_lines(&self) -> (String, Vec<String>) {
+        let scope = match &self.scope {
+            Scope::All => "all files".to_string(),
+            Scope::Language(language) => language.name().to_string(),
+            Scope::Path(path) => path.display().to_string(),
+        };
+        let sort = self
+            .sort
+            .to_possible_value()
+            .map(|value| value.get_name().to_string())
+            .unwrap_or_default();
+        let search = if self.search.is_empty() {
+            String::new()
+        } else {
+            format!(", matching \"{}\"", self.search)
+        };
+        let header = format!(
+            "{:>4} {:>4} {:>4} {:>6} {:>6} {:>6}  Function in {scope} (by {sort}{search})",
+            "CC", "Cog", "Nest", "Lines", "Params", "MI"
+        );
+        let rows = self
+            .functions()
+            .iter()
+            .map(|f| {
+                let function = f.function;
+                format!(
+                    "{:>4} {:>4} {:>4} {:>6} {:>6} {:>6.1}  {}  {}:{}",
+                    function.complexity,
+                    function.cognitive,
+                    function.max_nesting,
+                    function.line_count(),
+                    function.parameters,
+                    function.maintainability,
+                    display_name(function),
+                    f.path.display(),
+                    function.start_line
+                )
+            })
+            .collect();
+        (header, rows)
+    }
+}
+
+/// Returns the qualified name of a function, or its name if it has none.
+fn display_name(function: &FunctionStats) -> &str {
+    if function.qualified_name.is_empty() {
+        &function.name
+    } else {
+        &function.qualified_name
+    }
+}
+
+/// Cuts a line to at most `width` characters.
+fn truncate(text: &str, width: usize) -> String {
+    text.chars().take(width).collect()
+}
+
+/// Maps a terminal key event to a dashboard key.
+fn key(code: KeyCode, modifiers: KeyModifiers) -> Option<Key> {
+    Some(match code {
+        KeyCode::Char('c') if modifiers.contains(KeyModifiers::CONTROL) => Key::Char('q'),
+        KeyCode::Up => Key::Up,
+        KeyCode::Down => Key::Down,
+        KeyCode::Left => Key::Left,
+        KeyCode::Right => Key::Right,
+        KeyCode::PageUp => Key::PageUp,
+        KeyCode::PageDown => Key::PageDown,
+        KeyCode::Home => Key::Home,
+        KeyCode::End => Key::End,
+        KeyCode::Enter => Key::Enter,
+        KeyCode::Tab => Key::Tab,
+        KeyCode::BackTab => Key::BackTab,
+        KeyCode::Backspace => Key::Backspace,
+        KeyCode::Esc => Key::Esc,
+        KeyCode::Char(c) => Key::Char(c),
+        _ => return None,
+    })
+}
+
+/// Restores the terminal when dropped, also when drawing fails.
+struct TerminalGuard;
+
+impl Drop for TerminalGuard {
+    fn drop(&mut self) {
+        let _ = execute!(std::io::stdout(), Show, LeaveAlternateScreen);
+        let _ = terminal::disable_raw_mode();
+    }
+}
+
+/// Runs the dashboard in the terminal until it is closed.
+///
+/// # Arguments
+///
+/// * `stats` - Statistics of the analyzed files
+/// * `root` - The analyzed directory
+///
+/// # Returns
+///
+/// * `Ok(())` - The dashboard was closed
+/// * `Err(IoError)` - Standard output is not a terminal, or the terminal
+///   failed
+pub(crate) fn run(stats: &DirectoryStats, root: &Path) -> Result<()> {
+    let error = |e: std::io::Error| CodeStatsError::IoError(format!("Terminal error: {e}"));
+    let mut stdout = std::io::stdout();
+    if !stdout.is_terminal() {
+        return Err(CodeStatsError::IoError(
+            "tui requires a terminal".to_string(),
+        ));
+    }
+
+    let mut dashboard = Dashboard::new(stats, root);
+    terminal::enable_raw_mode().map_err(error)?;
+    let _guard = TerminalGuard;
+    execute!(stdout, EnterAlternateScreen, Hide).map_err(error)?;
+    loop {
+        let (width, height) = terminal::size().map_err(error)?;
+        let lines = dashboard.render(width as usize, height as usize);
+        queue!(stdout, Clear(ClearType::All)).map_err(error)?;
+        for (row, line) in lines.iter().enumerate() {
+            queue!(stdout, MoveTo(0, row as u16)).map_err(error)?;
+            if line.highlight {
+                queue!(
+                    stdout,
+                    SetAttribute(Attribute::Reverse),
+                    Print(&line.text),
+                    SetAttribute(Attribute::Reset)
+                )
+                .map_err(error)?;
+            } else {
+                queue!(stdout, Print(&line.text)).map_err(error)?;
+            }
+        }
+        stdout.flush().map_err(error)?;
+
+        // Resizes and other events just redraw
+        if let Event::Key(event) = event::read().map_err(error)?
+            && event.kind != KeyEventKind::Release
+            && let Some(key) = key(event.code, event.modifiers)
+            && !dashboard.handle(key)
+        {
+            return Ok(());
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::stats::test_support::{directory, file_with, function};
+
+    /// A Rust file whose named functions are five lines each, ten apart.
+    fn file(path: &str, code: usize, functions: &[(&str, usize)]) -> FileStats {
+        let functions = functions
+            .iter()
+            .enumerate()
+            .map(|(index, &(name, complexity))| FunctionStats {
+                qualified_name: name.to_string(),
+                start_line: index * 10 + 1,
+                end_line: index * 10 + 5,
+                ..function(name, complexity)
+            })
+            .collect();
+        file_with(path, code, functions)
+    }
+
+    fn stats() -> DirectoryStats {
+        directory([
+            file("repo/src/parser.rs", 300, &[("parse", 12), ("peek", 1)]),
+            file("repo/src/cli/args.rs", 80, &[("parse_args", 4)]),
+            file("repo/build.rs", 20, &[("main", 2)]),
+        ])
+    }
+
+    fn texts(lines: &[Line]) -> Vec<String> {
+        lines
+            .iter()
+            .map(|line| line.text.trim_end().to_string())
+            .collect()
+    }
+
+    fn selected(lines: &[Line]) -> String {
+        lines
+            .iter()
+            .find(|line| line.highlight)
+            .map(|line| line.text.trim().to_string())
+            .unwrap_or_default()
+    }
+
+    #[test]
+    fn test_file_tree_navigation() {
+        let stats = stats();
+        let mut dashboard = Dashboard::new(&stats, Path::new("repo"));
+        let lines = dashboard.render(120, 10);
+        assert_eq!(lines.len(), 10);
+        assert!(
+            lines[0]
+                .text
+                .starts_with(" 1 Languages  [2 Files]  3 Functions ")
+        );
+        assert_eq!(
+            texts(&lines[2..5]),
+            [
+                "     400      4      19     12  - repo/",
+                "     380      3      17     12    + src/",
+                "      20      1       2      2      build.rs",
+            ]
+        );
+
+        dashboard.handle(Key::Down);
+        dashboard.handle(Key::Right);
+        let lines = dashboard.render(120, 10);
+        assert_eq!(
+            texts(&lines[3..7]),
+            [
+                "     380      3      17     12    - src/",
+                "      80      1       4      4      + cli/",
+                "     300      2      13     12        parser.rs",
+                "      20      1       2      2      build.rs",
+            ]
+        );
+
+        // Left on a file moves to its directory, then collapses it
+        dashboard.handle(Key::Down);
+        dashboard.handle(Key::Down);
+        dashboard.handle(Key::Left);
+        assert!(selected(&dashboard.render(120, 10)).ends_with("- src/"));
+        dashboard.handle(Key::Left);
+        assert!(selected(&dashboard.render(120, 10)).ends_with("+ src/"));
+    }
+
+    #[test]
+    fn test_drill_down_search_and_sort() {
+        let stats = stats();
+        let mut dashboard = Dashboard::new(&stats, Path::new("repo"));
+        dashboard.handle(Key::Down);
+        dashboard.handle(Key::Char('f'));
+        let lines = dashboard.render(120, 10);
+        assert!(
+            lines[1]
+                .text
+                .contains("Function in repo/src (by complexity)")
+        );
+        assert_eq!(lines[2..5].iter().filter(|l| !l.text.is_empty()).count(), 3);
+        assert!(selected(&lines).contains("parse  repo/src/parser.rs:1"));
+
+        for key in [
+            Key::Char('/'),
+            Key::Char('A'),
+            Key::Char('r'),
+            Key::Char('g'),
+        ] {
+            dashboard.handle(key);
+        }
+        let lines = dashboard.render(120, 10);
+        assert_eq!(lines[9].text, "Search: Arg_");
+        assert!(selected(&lines).contains("parse_args"));
+        assert!(lines[3].text.is_empty());
+
+        dashboard.handle(Key::Esc);
+        dashboard.handle(Key::Char('s'));
+        let lines = dashboard.render(120, 10);
+        assert!(lines[1].text.contains("(by nesting)"), "{}", lines[1].text);
+
+        dashboard.handle(Key::Esc);
+        assert!(dashboard.render(120, 10)[1].text.contains("in all files"));
+        assert!(!dashboard.handle(Key::Char('q')));
+    }
+
+    #[test]
+    fn test_languages_and_scrolling() {
+        let stats = stats();
+        let mut dashboard = Dashboard::new(&stats, Path::new("repo"));
+        dashboard.handle(Key::Char('1'));
+        let lines = dashboard.render(40, 6);
+        assert!(lines.iter().all(|line| line.text.chars().count() <= 40));
+        assert!(selected(&lines).starts_with("Rust"));
+        dashboard.handle(Key::Enter);
+        let lines = dashboard.render(120, 4);
+        assert!(lines[1].text.contains("Function in Rust"));
+
+        // One row fits: moving down scrolls
+        dashboard.handle(Key::End);
+        let lines = dashboard.render(120, 4);
+        assert!(lines[2].highlight);
+        assert!(lines[2].text.contains("peek"));
+    }
+
+    #[test]
+    fn test_key() {
+        assert_eq!(
+            key(KeyCode::Char('c'), KeyModifiers::CONTROL),
+            Some(Key::Char('q'))
+        );
+        assert_eq!(
+            key(KeyCode::Char('j'), KeyModifiers::NONE),
+            Some(Key::Char('j'))
+        );
+        assert_eq!(key(KeyCode::F(1), KeyModifiers::NONE), None);
+    }
+}
@@ -0,0 +1,162 @@
+//! Versions of the grammars the binary parses with.
+//!
+//! Metrics depend on the grammars: a new release of a grammar may parse a
+//! construct into different nodes and so change the counts. `languages` lists
+//! every grammar with the version of its crate, taken from `Cargo.lock` when
+//! the binary was built (see `build.rs`), and its ABI version. The
+//! `[grammars]` table of `.codestats.toml` pins the versions a project's
+//! metrics were recorded with, so that CI agents running different builds
+//! notice instead of reporting drifting numbers.
+//!
+//! A pin matches a version it is a prefix of at a `.` boundary: `0.24` matches
+//! `0.24.0` and `0.24.2`, but not `0.240.1`.
+
+use crate::grammar;
+use crate::language::SupportedLanguage;
+use serde::Serialize;
+use std::path::{Path, PathBuf};
+
+include!(concat!(env!("OUT_DIR"), "/crate_versions.rs"));
+
+/// A grammar compiled into the binary or loaded with `--grammar-dir`.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub(crate) struct GrammarInfo {
+    pub language: SupportedLanguage,
+    /// Crate of a compiled-in grammar
+    #[serde(rename = "crate", skip_serializing_if = "Option::is_none")]
+    pub crate_name: Option<&'static str>,
+    /// Version of the crate, `None` if it was not recorded at build time or
+    /// the grammar was loaded at runtime
+    pub version: Option<&'static str>,
+    /// ABI version of the generated parser
+    pub abi: usize,
+    /// Shared library of a loaded grammar
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub path: Option<PathBuf>,
+}
+
+impl GrammarInfo {
+    fn new(language: SupportedLanguage) -> Self {
+        let crate_name = language.grammar_crate();
+        Self {
+            language,
+            crate_name,
+            version: crate_name.and_then(crate_version),
+            abi: language.get_language().abi_version(),
+            path: match language {
+                SupportedLanguage::Dynamic(grammar) => grammar.path().map(Path::to_path_buf),
+                _ => None,
+            },
+        }
+    }
+}
+
+/// Lists the compiled-in grammars by language name, followed by the loaded
+/// grammars in loading order.
+pub(crate) fn grammars() -> Vec<GrammarInfo> {
+    let mut builtin = SupportedLanguage::BUILTIN.to_vec();
+    builtin.sort_by(|a, b| a.name().cmp(b.name()));
+    builtin
+        .into_iter()
+        .chain(grammar::loaded())
+        .map(GrammarInfo::new)
+        .collect()
+}
+
+/// Returns the version of a tree-sitter crate the binary was built with.
+pub(crate) fn crate_version(name: &str) -> Option<&'static str> {
+    CRATE_VERSIONS
+        .iter()
+        .find(|(crate_name, _)| *crate_name == name)
+        .map(|(_, version)| *version)
+}
+
+/// Returns true if `version` is `pin` or starts with `pin` followed by a `.`.
+pub(crate) fn version_matches(version: &str, pin: &str) -> bool {
+    version
+        .strip_prefix(pin)
+        .is_some_and(|rest| rest.is_empty() || rest.starts_with('.'))
+}
+
+/// Checks the grammars against pinned versions.
+///
+/// # Arguments
+///
+/// * `pins` - Each pinned language with the version it is pinned to
+///
+/// # Returns
+///
+/// A message for every grammar whose version differs from its pin or is not
+/// known, in the order of `pins`
+pub(crate) fn pin_mismatches(pins: &[(SupportedLanguage, String)]) -> Vec<String> {
+    pins.iter()
+        .filter_map(|(language, pin)| {
+            let info = GrammarInfo::new(*language);
+            match (info.crate_name, info.version) {
+                (_, Some(version)) if version_matches(version, pin) => None,
+                (Some(crate_name), Some(version)) => Some(format!(
+                    "{} grammar is {crate_name} {version}, pinned to {pin}",
+                    language.name()
+                )),
+                _ => Some(format!(
+                    "{} grammar has no known version, pinned to {pin}",
+                    language.name()
+                )),
+            }
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_version_matches() {
+        assert!(version_matches("0.24.2", "0.24.2"));
+        assert!(version_matches("0.24.2", "0.24"));
+        assert!(version_matches("0.24.2", "0"));
+        assert!(!version_matches("0.24.2", "0.24.3"));
+        assert!(!version_matches("0.240.1", "0.24"));
+        assert!(!version_matches("0.24", "0.24.2"));
+    }
+
+    #[test]
+    fn test_grammars_list_every_builtin_language() {
+        let grammars = grammars();
+        let builtin: Vec<_> = grammars
+            .iter()
+            .filter(|info| !matches!(info.language, SupportedLanguage::Dynamic(_)))
+            .collect();
+        assert_eq!(builtin.len(), SupportedLanguage::BUILTIN.len());
+        assert!(
+            builtin
+                .windows(2)
+                .all(|pair| pair[0].language.name() <= pair[1].language.name())
+        );
+        let vue = grammars
+            .iter()
+            .find(|info| info.language == SupportedLanguage::Vue)
+            .unwrap();
+        assert_eq!(vue.crate_name, Some("tree-sitter-html"));
+        assert!(vue.abi >= tree_sitter::MIN_COMPATIBLE_LANGUAGE_VERSION);
+        assert_eq!(vue.path, None);
+    }
+
+    #[test]
+    fn test_pin_mismatches() {
+        let rust = SupportedLanguage::Rust;
+        let Some(version) = crate_version("tree-sitter-rust") else {
+            // Built without a lock file: every pin is reported
+            assert_eq!(pin_mismatches(&[(rust, "0.24".to_string())]).len(), 1);
+            return;
+        };
+        assert!(pin_mismatches(&[(rust, version.to_string())]).is_empty());
+        assert_eq!(
+            pin_mismatches(&[(rust, "999".to_string())]),
+            vec![format!(
+                "Rust grammar is tree-sitter-rust {version}, pinned to 999"
+            )]
+        );
+    }
+}
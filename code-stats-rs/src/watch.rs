@@ -0,0 +1,262 @@
+//! Watch mode: keeps directory statistics up to date as files change.
+
+use crate::analyzer::{CodeAnalyzer, DirectoryOptions, classify_file, collect_candidates};
+use crate::error::{CodeStatsError, Result};
+use crate::stats::{DirectoryStats, FileStats};
+use notify::{Event, RecursiveMode, Watcher};
+use std::collections::{BTreeMap, BTreeSet};
+use std::path::{Path, PathBuf};
+use std::sync::mpsc;
+use std::time::Duration;
+
+/// How long to keep collecting events after the first one before re-analyzing.
+///
+/// Editors typically save through several filesystem operations (write a
+/// temp file, rename, touch metadata); batching them avoids redundant work.
+const DEBOUNCE: Duration = Duration::from_millis(200);
+
+/// Per-file results for a watched directory.
+///
+/// Only files reported as changed are reparsed; totals are re-aggregated
+/// from the stored per-file results on every update.
+pub(crate) struct WatchState {
+    files: BTreeMap<PathBuf, FileStats>,
+}
+
+impl WatchState {
+    /// Performs the initial full analysis of `root`.
+    pub(crate) fn new(
+        analyzer: &mut CodeAnalyzer,
+        root: &Path,
+        options: &DirectoryOptions,
+    ) -> Result<Self> {
+        let stats = analyzer.analyze_directory(root, options)?;
+        let files = stats
+            .files
+            .into_iter()
+            .map(|file| (file.path.clone(), file))
+            .collect();
+        Ok(Self { files })
+    }
+
+    /// Applies a batch of changed paths.
+    ///
+    /// The directory is re-walked (which is cheap compared to parsing) so that
+    /// created, deleted, and newly ignored files are handled the same way as in
+    /// a full run; only candidates that are in `changed` or have no statistics
+    /// yet are reparsed. The second covers files of a created or moved-in
+    /// directory, for which the watcher may report only the directory.
+    ///
+    /// # Returns
+    ///
+    /// The number of files whose statistics were added, updated, or removed.
+    pub(crate) fn update(
+        &mut self,
+        analyzer: &mut CodeAnalyzer,
+        root: &Path,
+        options: &DirectoryOptions,
+        changed: &BTreeSet<PathBuf>,
+    ) -> usize {
+        let mut walk_errors = Vec::new();
+        let candidates: BTreeSet<PathBuf> = collect_candidates(root, options, &mut walk_errors)
+            .into_iter()
+            .collect();
+
+        let before = self.files.len();
+        self.files.retain(|path, _| candidates.contains(path));
+        let mut updated = before - self.files.len();
+
+        let pending: Vec<PathBuf> = candidates
+            .into_iter()
+            .filter(|path| changed.contains(path) || !self.files.contains_key(path))
+            .collect();
+        for path in &pending {
+            match analyzer.analyze_candidate(path) {
+                Ok(Some(mut file_stats)) => {
+                    classify_file(&mut file_stats, root, options);
+                    self.files.insert(path.clone(), file_stats);
+                    updated += 1;
+                }
+                // Unsupported or unreadable (e.g. mid-save); drop stale results
+                Ok(None) | Err(_) => {
+                    if self.files.remove(path).is_some() {
+                        updated += 1;
+                    }
+                }
+            }
+        }
+
+        updated
+    }
+
+    /// Aggregates the current per-file results.
+    pub(crate) fn stats(&self) -> DirectoryStats {
+        let mut stats = DirectoryStats::new();
+        for file in self.files.values() {
+            stats.add_file(file.clone());
+        }
+        stats
+    }
+}
+
+/// Watches `root` and calls `render` after the initial analysis and after
+/// every batch of changes that affected at least one file.
+///
+/// Blocks until the watcher shuts down or fails.
+///
+/// # Arguments
+///
+/// * `analyzer` - Analyzer used for the initial run and for changed files
+/// * `root` - Directory to watch recursively
+/// * `options` - Same traversal settings as a one-off directory analysis
+/// * `render` - Receives the updated statistics and the number of changed files
+pub(crate) fn watch_directory(
+    analyzer: &mut CodeAnalyzer,
+    root: &Path,
+    options: &DirectoryOptions,
+    mut render: impl FnMut(&DirectoryStats, usize),
+) -> Result<()> {
+    let watch_error = |e: notify::Error| {
+        CodeStatsError::IoError(format!("Failed to watch {}: {e}", root.display()))
+    };
+
+    let mut state = WatchState::new(analyzer, root, options)?;
+    render(&state.stats(), 0);
+
+    // Event paths are absolute; candidates are relative to `root` as given
+    let canonical_root = root
+        .canonicalize()
+        .map_err(|e| CodeStatsError::IoError(format!("Failed to watch {}: {e}", root.display())))?;
+
+    let (sender, receiver) = mpsc::channel::<notify::Result<Event>>();
+    let mut watcher = notify::recommended_watcher(sender).map_err(watch_error)?;
+    watcher
+        .watch(root, RecursiveMode::Recursive)
+        .map_err(watch_error)?;
+
+    while let Ok(first) = receiver.recv() {
+        let mut changed = BTreeSet::new();
+        collect_paths(first, root, &canonical_root, &mut changed);
+        while let Ok(event) = receiver.recv_timeout(DEBOUNCE) {
+            collect_paths(event, root, &canonical_root, &mut changed);
+        }
+
+        if changed.is_empty() {
+            continue;
+        }
+
+        let updated = state.update(analyzer, root, options, &changed);
+        if updated > 0 {
+            render(&state.stats(), updated);
+        }
+    }
+
+    Ok(())
+}
+
+/// Adds the paths touched by a non-access event to `changed`, rewritten
+/// relative to `root` so they match the paths produced by the directory walk.
+fn collect_paths(
+    event: notify::Result<Event>,
+    root: &Path,
+    canonical_root: &Path,
+    changed: &mut BTreeSet<PathBuf>,
+) {
+    let Ok(event) = event else {
+        return;
+    };
+    if event.kind.is_access() {
+        return;
+    }
+
+    for path in event.paths {
+        match path.strip_prefix(canonical_root) {
+            Ok(relative) => changed.insert(root.join(relative)),
+            Err(_) => changed.insert(path),
+        };
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use notify::EventKind;
+    use notify::event::{AccessKind, ModifyKind};
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_update_reparses_only_changed_files() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        fs::write(root.join("a.rs"), "fn a() {}").unwrap();
+        fs::write(root.join("b.rs"), "fn b() {}").unwrap();
+
+        let options = DirectoryOptions {
+            jobs: 1,
+            ..Default::default()
+        };
+        let mut analyzer = CodeAnalyzer::new();
+        let mut state = WatchState::new(&mut analyzer, root, &options).unwrap();
+        assert_eq!(state.stats().total_stats.function_count, 2);
+
+        // b.rs changes on disk but isn't reported, so its old result is kept
+        fs::write(root.join("a.rs"), "fn a() {}\nfn a2() {}").unwrap();
+        fs::write(root.join("b.rs"), "fn b() {}\nfn b2() {}").unwrap();
+        let changed = BTreeSet::from([root.join("a.rs")]);
+        assert_eq!(state.update(&mut analyzer, root, &options, &changed), 1);
+        assert_eq!(state.stats().total_stats.function_count, 3);
+
+        // New and deleted files
+        fs::write(root.join("c.rs"), "fn c() {}").unwrap();
+        fs::remove_file(root.join("a.rs")).unwrap();
+        let changed = BTreeSet::from([root.join("a.rs"), root.join("c.rs")]);
+        assert_eq!(state.update(&mut analyzer, root, &options, &changed), 2);
+
+        let stats = state.stats();
+        assert_eq!(stats.total_files(), 2);
+        assert_eq!(stats.total_stats.function_count, 2);
+    }
+
+    #[test]
+    fn test_update_analyzes_files_of_created_directories() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        fs::write(root.join("a.rs"), "fn a() {}").unwrap();
+
+        let options = DirectoryOptions {
+            jobs: 1,
+            ..Default::default()
+        };
+        let mut analyzer = CodeAnalyzer::new();
+        let mut state = WatchState::new(&mut analyzer, root, &options).unwrap();
+
+        // Only the directory is reported, not the file created inside it
+        fs::create_dir(root.join("src")).unwrap();
+        fs::write(root.join("src/b.rs"), "fn b() {}\nfn b2() {}").unwrap();
+        let changed = BTreeSet::from([root.join("src")]);
+        assert_eq!(state.update(&mut analyzer, root, &options, &changed), 1);
+
+        let stats = state.stats();
+        assert_eq!(stats.total_files(), 2);
+        assert_eq!(stats.total_stats.function_count, 3);
+    }
+
+    #[test]
+    fn test_collect_paths_relativizes_and_skips_access() {
+        let temp_dir = TempDir::new().unwrap();
+        let canonical_root = temp_dir.path().canonicalize().unwrap();
+        let root = Path::new("project");
+        let mut changed = BTreeSet::new();
+
+        let modify = Event::new(EventKind::Modify(ModifyKind::Any))
+            .add_path(canonical_root.join("src/main.rs"));
+        collect_paths(Ok(modify), root, &canonical_root, &mut changed);
+
+        let access = Event::new(EventKind::Access(AccessKind::Read))
+            .add_path(canonical_root.join("src/lib.rs"));
+        collect_paths(Ok(access), root, &canonical_root, &mut changed);
+
+        assert_eq!(changed, BTreeSet::from([root.join("src/main.rs")]));
+    }
+}
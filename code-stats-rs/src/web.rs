@@ -0,0 +1,349 @@
+//! Structure of web documents: HTML elements and CSS and SCSS rules.
+//!
+//! HTML files are measured by their elements and how deeply they nest. The
+//! contents of `<script>` and `<style>` elements are extracted like the
+//! fenced code blocks of Markdown documents and analyzed as JavaScript and
+//! CSS, so the functions of an inline script are reported with those of the
+//! JavaScript files.
+//!
+//! Stylesheets are measured by their rule sets and selectors: `h1, h2 { }` is
+//! one rule with two selectors. Nesting depth counts the rule sets and block
+//! at-rules around a rule, so a rule inside `@media` is at depth 2, as is a
+//! rule nested in another in SCSS.
+
+use crate::fences::CodeBlock;
+use crate::language::SupportedLanguage;
+use serde::{Deserialize, Serialize};
+use tree_sitter::Node;
+
+/// Kinds of the HTML element nodes; `<script>` and `<style>` have nodes of
+/// their own, as their content is not HTML.
+const HTML_ELEMENTS: [&str; 3] = ["element", "script_element", "style_element"];
+
+/// Kinds of the CSS and SCSS nodes that nest rules: rule sets and the
+/// at-rules that hold a block of them.
+const STYLE_BLOCKS: [&str; 5] = [
+    "rule_set",
+    "media_statement",
+    "supports_statement",
+    "keyframes_statement",
+    "at_rule",
+];
+
+/// `type` attributes of `<script>` elements holding JavaScript. Scripts of
+/// other types are data (`application/json`, `importmap`) or templates.
+const SCRIPT_TYPES: [&str; 6] = [
+    "text/javascript",
+    "application/javascript",
+    "text/ecmascript",
+    "module",
+    // JSX, which the JavaScript grammar parses
+    "text/babel",
+    "text/jsx",
+];
+
+/// Shape of an HTML document or stylesheet.
+#[derive(Default, Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct WebStats {
+    /// Number of HTML elements, including `<script>` and `<style>`
+    pub elements: usize,
+    /// Number of CSS and SCSS rule sets
+    pub rules: usize,
+    /// Number of selectors of the rule sets, each comma-separated selector
+    /// counting once
+    pub selectors: usize,
+    /// Deepest nesting of elements, or of rule sets and block at-rules (1
+    /// for a flat stylesheet, 0 for an empty file)
+    pub max_depth: usize,
+}
+
+impl WebStats {
+    /// Adds the counts of `other`, keeping the deeper of the two depths.
+    pub(crate) fn merge(&mut self, other: &WebStats) {
+        self.elements += other.elements;
+        self.rules += other.rules;
+        self.selectors += other.selectors;
+        self.max_depth = self.max_depth.max(other.max_depth);
+    }
+}
+
+/// Measures the elements of an HTML file or the rules of a stylesheet.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the tree parsed from the file
+/// * `language` - HTML, CSS, or SCSS
+///
+/// # Returns
+///
+/// The file's statistics, or `None` for other languages.
+pub(crate) fn web_stats(root: &Node, language: &SupportedLanguage) -> Option<WebStats> {
+    let nesting: &[&str] = match language {
+        SupportedLanguage::Html | SupportedLanguage::Vue | SupportedLanguage::Svelte => {
+            &HTML_ELEMENTS
+        }
+        SupportedLanguage::Css | SupportedLanguage::Scss => &STYLE_BLOCKS,
+        _ => return None,
+    };
+    let mut stats = WebStats::default();
+    visit(root, nesting, 0, &mut stats);
+    Some(stats)
+}
+
+fn visit(node: &Node, nesting: &[&str], depth: usize, stats: &mut WebStats) {
+    let mut depth = depth;
+    if nesting.contains(&node.kind()) {
+        depth += 1;
+        stats.max_depth = stats.max_depth.max(depth);
+        match node.kind() {
+            "rule_set" => {
+                stats.rules += 1;
+                stats.selectors += selector_count(node);
+            }
+            kind if HTML_ELEMENTS.contains(&kind) => stats.elements += 1,
+            _ => {}
+        }
+    }
+
+    let mut cursor = node.walk();
+    for child in node.named_children(&mut cursor) {
+        visit(&child, nesting, depth, stats);
+    }
+}
+
+/// Counts the comma-separated selectors of a rule set.
+fn selector_count(rule_set: &Node) -> usize {
+    let mut cursor = rule_set.walk();
+    rule_set
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "selectors")
+        .map_or(0, |selectors| {
+            let mut cursor = selectors.walk();
+            selectors
+                .named_children(&mut cursor)
+                .filter(|selector| !selector.kind().ends_with("comment"))
+                .count()
+        })
+}
+
+/// Lists the `<script>` and `<style>` contents of an HTML document that are
+/// analyzed in another language, with that language, in source order.
+///
+/// Scripts are JavaScript unless their `type` names something else, or
+/// TypeScript with `lang="ts"` as in components, and styles are CSS, or SCSS
+/// with `lang="scss"`. Sections in other languages (`lang="tsx"`,
+/// `lang="less"`) are not extracted, and elements loading their code with
+/// `src` have no content to extract.
+pub(crate) fn inline_code<'tree>(
+    root: &Node<'tree>,
+    source: &[u8],
+) -> Vec<(Node<'tree>, SupportedLanguage)> {
+    let mut found = Vec::new();
+    let mut stack = vec![*root];
+    while let Some(node) = stack.pop() {
+        let language = match node.kind() {
+            "script_element" => script_language(&node, source),
+            "style_element" => style_language(&node, source),
+            _ => {
+                let mut cursor = node.walk();
+                let children: Vec<Node> = node.named_children(&mut cursor).collect();
+                stack.extend(children.into_iter().rev());
+                continue;
+            }
+        };
+        let mut cursor = node.walk();
+        let content = node
+            .named_children(&mut cursor)
+            .find(|child| child.kind() == "raw_text");
+        if let (Some(content), Some(language)) = (content, language) {
+            found.push((content, language));
+        }
+    }
+    found
+}
+
+/// Returns the inline scripts and styles of an HTML document as code blocks,
+/// see `inline_code`. A block starting on the line after its start tag
+/// begins on that line, as the rest of the start tag's line is markup.
+///
+/// # Arguments
+///
+/// * `root` - Root node of the tree parsed from `source`
+/// * `source` - The HTML document
+pub(crate) fn inline_blocks<'a>(root: &Node, source: &'a str) -> Vec<CodeBlock<'a>> {
+    inline_code(root, source.as_bytes())
+        .into_iter()
+        .map(|(content, language)| {
+            let code = &source[content.byte_range()];
+            let mut first_line = content.start_position().row;
+            let code = match code.strip_prefix('\n').or(code.strip_prefix("\r\n")) {
+                Some(rest) => {
+                    first_line += 1;
+                    rest
+                }
+                None => code,
+            };
+            CodeBlock {
+                language,
+                code,
+                first_line,
+            }
+        })
+        .collect()
+}
+
+fn script_language(element: &Node, source: &[u8]) -> Option<SupportedLanguage> {
+    let lang = attribute(element, source, "lang").map(str::to_ascii_lowercase);
+    match lang.as_deref() {
+        None | Some("js" | "javascript" | "jsx") => {}
+        Some("ts" | "typescript") => return Some(SupportedLanguage::TypeScript),
+        Some(_) => return None,
+    }
+    match attribute(element, source, "type") {
+        None => Some(SupportedLanguage::JavaScript),
+        Some(kind) => SCRIPT_TYPES
+            .iter()
+            .any(|script_type| kind.trim().eq_ignore_ascii_case(script_type))
+            .then_some(SupportedLanguage::JavaScript),
+    }
+}
+
+fn style_language(element: &Node, source: &[u8]) -> Option<SupportedLanguage> {
+    let lang = attribute(element, source, "lang").map(str::to_ascii_lowercase);
+    let kind = attribute(element, source, "type");
+    if kind.is_some_and(|kind| kind.eq_ignore_ascii_case("text/scss")) {
+        return Some(SupportedLanguage::Scss);
+    }
+    match lang.as_deref() {
+        None | Some("css" | "postcss") => Some(SupportedLanguage::Css),
+        Some("scss") => Some(SupportedLanguage::Scss),
+        Some(_) => None,
+    }
+}
+
+/// Returns the value of an attribute in the start tag of an element, without
+/// its quotes; an attribute without a value has an empty one.
+pub(crate) fn attribute<'a>(element: &Node, source: &'a [u8], name: &str) -> Option<&'a str> {
+    let mut cursor = element.walk();
+    let start_tag = element
+        .named_children(&mut cursor)
+        .find(|child| child.kind() == "start_tag")?;
+    let mut cursor = start_tag.walk();
+    let attribute = start_tag
+        .named_children(&mut cursor)
+        .filter(|child| child.kind() == "attribute")
+        .find(|attribute| {
+            let mut cursor = attribute.walk();
+            attribute
+                .named_children(&mut cursor)
+                .find(|part| part.kind() == "attribute_name")
+                .and_then(|part| part.utf8_text(source).ok())
+                .is_some_and(|attribute_name| attribute_name.eq_ignore_ascii_case(name))
+        })?;
+
+    let mut cursor = attribute.walk();
+    let value = attribute
+        .named_children(&mut cursor)
+        .find(|part| matches!(part.kind(), "attribute_value" | "quoted_attribute_value"));
+    let Some(value) = value else {
+        return Some("");
+    };
+    let text = value.utf8_text(source).ok()?;
+    Some(text.trim_matches(['"', '\'']))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::create_parser;
+
+    fn measure(language: SupportedLanguage, source: &str) -> WebStats {
+        let mut parser = create_parser(&language).unwrap();
+        let tree = parser.parse(source, None).unwrap();
+        web_stats(&tree.root_node(), &language).unwrap()
+    }
+
+    #[test]
+    fn test_html_elements_and_depth() {
+        let source = "<!DOCTYPE html>\n<html>\n  <body>\n    <ul>\n      <li>One</li>\n      <li>Two</li>\n    </ul>\n    <script>run();</script>\n  </body>\n</html>\n";
+        assert_eq!(
+            measure(SupportedLanguage::Html, source),
+            WebStats {
+                elements: 6,
+                rules: 0,
+                selectors: 0,
+                max_depth: 4,
+            }
+        );
+    }
+
+    #[test]
+    fn test_css_rules_and_selectors() {
+        let source = "h1, h2 { margin: 0; }\n\n@media (max-width: 600px) {\n  .cart .item { display: block; }\n}\n";
+        assert_eq!(
+            measure(SupportedLanguage::Css, source),
+            WebStats {
+                elements: 0,
+                rules: 2,
+                selectors: 3,
+                max_depth: 2,
+            }
+        );
+    }
+
+    #[test]
+    fn test_scss_nested_rules() {
+        let source = ".cart {\n  color: $text;\n  .item {\n    &:hover { color: red; }\n  }\n}\n";
+        let stats = measure(SupportedLanguage::Scss, source);
+        assert_eq!(stats.rules, 3);
+        assert_eq!(stats.max_depth, 3);
+    }
+
+    #[test]
+    fn test_inline_blocks() {
+        let source = r#"<html>
+<head>
+  <style>
+    body { margin: 0; }
+  </style>
+  <script type="application/json">{"items": []}</script>
+  <script src="cart.js"></script>
+</head>
+<body>
+  <script type="module">
+    function total(items) { return items.length; }
+  </script>
+</body>
+</html>
+"#;
+        let mut parser = create_parser(&SupportedLanguage::Html).unwrap();
+        let tree = parser.parse(source, None).unwrap();
+        let blocks = inline_blocks(&tree.root_node(), source);
+        let found: Vec<_> = blocks
+            .iter()
+            .map(|block| (block.language, block.first_line))
+            .collect();
+        // The JSON data and the external script are left out
+        assert_eq!(
+            found,
+            [
+                (SupportedLanguage::Css, 3),
+                (SupportedLanguage::JavaScript, 10),
+            ]
+        );
+        assert!(blocks[1].code.starts_with("    function total"));
+    }
+
+    #[test]
+    fn test_inline_languages_of_components() {
+        let source = "<script setup lang=\"ts\">\nconst count = ref(0);\n</script>\n\n<style lang=\"less\">\n@width: 10px;\n</style>\n";
+        let mut parser = create_parser(&SupportedLanguage::Vue).unwrap();
+        let tree = parser.parse(source, None).unwrap();
+        let blocks = inline_blocks(&tree.root_node(), source);
+        // Less has no grammar
+        assert_eq!(blocks.len(), 1);
+        assert_eq!(blocks[0].language, SupportedLanguage::TypeScript);
+        assert_eq!(blocks[0].first_line, 1);
+        assert_eq!(blocks[0].code, "const count = ref(0);\n");
+    }
+}
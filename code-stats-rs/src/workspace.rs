@@ -0,0 +1,294 @@
+//! Metrics of several repositories for the `workspace` subcommand.
+//!
+//! Each root is analyzed on its own, as a directory, archive, or git URL
+//! would be, and summarized in a row of the comparison table. The files of
+//! all roots are then added to one `DirectoryStats`, so the merged totals are
+//! computed exactly as for a single analysis rather than summed from the
+//! rows: the mean complexity is the mean over all functions, not of the
+//! repositories' means.
+//!
+//! A manifest lists one root per line; blank lines and lines starting with
+//! `#` are skipped, and relative paths are resolved against the manifest's
+//! directory.
+
+use crate::error::{CodeStatsError, Result};
+use crate::remote::is_git_url;
+use crate::stats::DirectoryStats;
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+/// A root of the workspace and the name it is reported under.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct Repository {
+    /// Last component of the path, or of the URL without `.git`; the whole
+    /// path if another root has the same last component
+    pub name: String,
+    pub path: PathBuf,
+}
+
+/// Totals of a repository, or of all of them.
+#[derive(Debug, Clone, Default, PartialEq, Serialize)]
+pub(crate) struct RepositoryTotals {
+    /// Number of files counted in the code totals
+    pub files: usize,
+    /// Lines of code
+    pub code_lines: usize,
+    /// Comment lines
+    pub comment_lines: usize,
+    /// Number of functions
+    pub functions: usize,
+    /// Highest cyclomatic complexity of any function
+    pub max_complexity: usize,
+    /// Mean cyclomatic complexity of the functions, 0 without functions
+    pub mean_complexity: f64,
+    /// Lines of code per language, by language name
+    pub languages: BTreeMap<String, usize>,
+}
+
+impl RepositoryTotals {
+    pub(crate) fn new(stats: &DirectoryStats) -> Self {
+        Self {
+            files: stats.code_files(),
+            code_lines: stats.total_stats.lines.code,
+            comment_lines: stats.total_stats.lines.comment,
+            functions: stats.total_stats.function_count,
+            max_complexity: stats.max_complexity(),
+            mean_complexity: stats.mean_complexity(),
+            languages: stats
+                .total_by_language
+                .iter()
+                .map(|(language, totals)| (language.name().to_string(), totals.lines.code))
+                .collect(),
+        }
+    }
+}
+
+/// A row of the comparison table.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub(crate) struct RepositoryRow {
+    pub name: String,
+    /// The root as given on the command line or in the manifest
+    pub path: PathBuf,
+    #[serde(flatten)]
+    pub totals: RepositoryTotals,
+}
+
+/// Result of a `workspace` run.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub(crate) struct WorkspaceReport {
+    /// One row per repository, in the order given
+    pub repositories: Vec<RepositoryRow>,
+    /// Totals of all repositories together
+    pub total: RepositoryTotals,
+}
+
+impl WorkspaceReport {
+    /// Summarizes each repository and merges their files.
+    ///
+    /// # Arguments
+    ///
+    /// * `analyzed` - Each repository with its statistics
+    ///
+    /// # Returns
+    ///
+    /// The report and the statistics of all files of all repositories, for
+    /// the merged summary
+    pub(crate) fn new(analyzed: Vec<(Repository, DirectoryStats)>) -> (Self, DirectoryStats) {
+        let mut merged = DirectoryStats::new();
+        let mut repositories = Vec::new();
+        for (repository, stats) in analyzed {
+            repositories.push(RepositoryRow {
+                name: repository.name,
+                path: repository.path,
+                totals: RepositoryTotals::new(&stats),
+            });
+            for file in stats.files {
+                merged.add_file(file);
+            }
+        }
+        let total = RepositoryTotals::new(&merged);
+        (
+            Self {
+                repositories,
+                total,
+            },
+            merged,
+        )
+    }
+}
+
+/// Reads the roots listed in a manifest file.
+///
+/// # Arguments
+///
+/// * `manifest` - File with one path or git URL per line
+///
+/// # Returns
+///
+/// * `Ok(Vec<PathBuf>)` - The roots, relative paths joined to the manifest's
+///   directory
+/// * `Err(IoError)` - If the manifest can't be read
+pub(crate) fn read_manifest(manifest: &Path) -> Result<Vec<PathBuf>> {
+    let text = fs::read_to_string(manifest).map_err(|e| {
+        CodeStatsError::IoError(format!(
+            "Failed to read manifest {}: {e}",
+            manifest.display()
+        ))
+    })?;
+    let base = manifest.parent().unwrap_or(Path::new(""));
+    Ok(text
+        .lines()
+        .map(str::trim)
+        .filter(|line| !line.is_empty() && !line.starts_with('#'))
+        .map(|line| {
+            let path = PathBuf::from(line);
+            if path.is_absolute() || is_git_url(&path) {
+                path
+            } else {
+                base.join(path)
+            }
+        })
+        .collect())
+}
+
+/// Names the roots of a workspace, see `Repository::name`.
+pub(crate) fn repositories(paths: Vec<PathBuf>) -> Vec<Repository> {
+    let short_names: Vec<String> = paths.iter().map(|path| short_name(path)).collect();
+    let mut counts: HashMap<&str, usize> = HashMap::new();
+    for name in &short_names {
+        *counts.entry(name).or_default() += 1;
+    }
+    let names: Vec<String> = short_names
+        .iter()
+        .zip(&paths)
+        .map(|(name, path)| match counts[name.as_str()] {
+            1 => name.clone(),
+            _ => path.display().to_string(),
+        })
+        .collect();
+    names
+        .into_iter()
+        .zip(paths)
+        .map(|(name, path)| Repository { name, path })
+        .collect()
+}
+
+/// Returns the last component of a root: the directory's own name for `.`,
+/// and `repo` for `https://github.com/org/repo.git`.
+fn short_name(path: &Path) -> String {
+    let text = path.to_string_lossy();
+    if is_git_url(path) {
+        let last = text.trim_end_matches('/').rsplit(['/', ':']).next();
+        return last.unwrap_or(&text).trim_end_matches(".git").to_string();
+    }
+    let resolved = path.canonicalize().unwrap_or_else(|_| path.to_path_buf());
+    resolved.file_name().map_or_else(
+        || text.into_owned(),
+        |name| name.to_string_lossy().into_owned(),
+    )
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::language::SupportedLanguage;
+    use crate::parser::{CodeStats, FunctionStats};
+    use crate::stats::FileStats;
+    use tempfile::TempDir;
+
+    fn stats_with(path: &str, code: usize, complexities: &[usize]) -> DirectoryStats {
+        let mut stats = CodeStats {
+            function_count: complexities.len(),
+            functions: complexities
+                .iter()
+                .map(|&complexity| FunctionStats {
+                    complexity,
+                    ..FunctionStats::default()
+                })
+                .collect(),
+            ..CodeStats::default()
+        };
+        stats.lines.code = code;
+        let mut directory = DirectoryStats::new();
+        directory.add_file(FileStats {
+            path: PathBuf::from(path),
+            language: SupportedLanguage::Rust,
+            stats,
+        });
+        directory
+    }
+
+    fn repository(name: &str) -> Repository {
+        Repository {
+            name: name.to_string(),
+            path: PathBuf::from(format!("../{name}")),
+        }
+    }
+
+    #[test]
+    fn test_workspace_report_merges_files() {
+        let (report, merged) = WorkspaceReport::new(vec![
+            (
+                repository("billing"),
+                stats_with("../billing/lib.rs", 300, &[2, 4]),
+            ),
+            (
+                repository("search"),
+                stats_with("../search/lib.rs", 100, &[9]),
+            ),
+        ]);
+        assert_eq!(report.repositories[0].name, "billing");
+        assert_eq!(report.repositories[0].totals.mean_complexity, 3.0);
+        assert_eq!(report.repositories[1].totals.code_lines, 100);
+
+        // The merged mean is over all functions, not of the two means
+        assert_eq!(report.total.files, 2);
+        assert_eq!(report.total.code_lines, 400);
+        assert_eq!(report.total.max_complexity, 9);
+        assert_eq!(report.total.mean_complexity, 5.0);
+        assert_eq!(
+            report.total.languages,
+            BTreeMap::from([("Rust".to_string(), 400)])
+        );
+        assert_eq!(merged.total_files(), 2);
+    }
+
+    #[test]
+    fn test_read_manifest() {
+        let temp_dir = TempDir::new().unwrap();
+        let manifest = temp_dir.path().join("repos.txt");
+        fs::write(
+            &manifest,
+            "# Services\nbilling\n\n  ../search  \n/srv/auth\nhttps://github.com/org/web.git\n",
+        )
+        .unwrap();
+        assert_eq!(
+            read_manifest(&manifest).unwrap(),
+            vec![
+                temp_dir.path().join("billing"),
+                temp_dir.path().join("../search"),
+                PathBuf::from("/srv/auth"),
+                PathBuf::from("https://github.com/org/web.git"),
+            ]
+        );
+
+        let missing = read_manifest(&temp_dir.path().join("missing.txt"));
+        assert!(matches!(missing, Err(CodeStatsError::IoError(_))));
+    }
+
+    #[test]
+    fn test_repository_names() {
+        let names: Vec<String> = repositories(vec![
+            PathBuf::from("services/billing"),
+            PathBuf::from("git@github.com:org/web.git"),
+            PathBuf::from("a/api"),
+            PathBuf::from("b/api"),
+        ])
+        .into_iter()
+        .map(|repository| repository.name)
+        .collect();
+        assert_eq!(names, vec!["billing", "web", "a/api", "b/api"]);
+    }
+}
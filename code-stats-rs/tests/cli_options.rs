@@ -1,7 +1,10 @@
 mod common;
 
 use assert_cmd::Command;
-use common::{create_test_file, create_test_project};
+use common::{
+    assert_contains_all, create_controlled_test_project, create_test_file, create_test_project,
+    parse_json_output, run_code_stats,
+};
 use predicates::prelude::*;
 
 #[test]
@@ -17,7 +20,30 @@ fn test_help_message() {
         .stdout(predicate::str::contains("--detail"))
         .stdout(predicate::str::contains("--ignore"))
         .stdout(predicate::str::contains("--follow-links"))
-        .stdout(predicate::str::contains("--max-depth"));
+        .stdout(predicate::str::contains("--max-depth"))
+        .stdout(predicate::str::contains("--no-gitignore"))
+        .stdout(predicate::str::contains("--jobs"))
+        .stdout(predicate::str::contains("--no-cache"))
+        .stdout(predicate::str::contains("--clear-cache"))
+        .stdout(predicate::str::contains("--watch"))
+        .stdout(predicate::str::contains("--functions"))
+        .stdout(predicate::str::contains("--proto-inventory"))
+        .stdout(predicate::str::contains("--api-surface"))
+        .stdout(predicate::str::contains("--deps"))
+        .stdout(predicate::str::contains("--call-graph"))
+        .stdout(predicate::str::contains("--unreached"))
+        .stdout(predicate::str::contains("--todos"))
+        .stdout(predicate::str::contains("--strings"))
+        .stdout(predicate::str::contains("--level"))
+        .stdout(predicate::str::contains("--output"))
+        .stdout(predicate::str::contains("--by-author"))
+        .stdout(predicate::str::contains("--queries"))
+        .stdout(predicate::str::contains("--lang-map"))
+        .stdout(predicate::str::contains("--include-generated"))
+        .stdout(predicate::str::contains("--grammar-dir"))
+        .stdout(predicate::str::contains("Commands:"))
+        .stdout(predicate::str::contains("baseline"))
+        .stdout(predicate::str::contains("check"));
 }
 
 #[test]
@@ -51,6 +77,178 @@ fn test_invalid_format_option() {
         .stderr(predicate::str::contains("possible values"));
 }
 
+#[test]
+fn test_dot_format_requires_deps() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg("tests/fixtures/test.rs")
+        .arg("--format")
+        .arg("dot")
+        .assert()
+        .failure()
+        .stderr(predicate::str::contains(
+            "--format dot requires --deps or --call-graph",
+        ));
+}
+
+#[test]
+fn test_format_prometheus_exports_gauges() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg("tests/fixtures/test.rs")
+        .args(["--no-cache", "--format", "prometheus"])
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("# TYPE codestats_loc gauge"))
+        .stdout(predicate::str::contains(
+            "codestats_loc{language=\"Rust\"} ",
+        ))
+        .stdout(predicate::str::contains("\ncodestats_max_complexity "));
+}
+
+#[test]
+fn test_compare_fails_on_complexity_increase() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let report = |complexity: usize| {
+        format!(
+            r#"{{"schema_version": 1, "files": [{{"path": "src/lib.rs", "language": "Rust",
+                "stats": {{"function_count": 1, "class_struct_count": 0, "functions": [
+                    {{"name": "parse", "start_line": 1, "end_line": 9, "complexity": {complexity}}}
+                ]}}}}]}}"#
+        )
+    };
+    let old = temp_dir.path().join("v1.json");
+    let new = temp_dir.path().join("v2.json");
+    create_test_file(&old, &report(3));
+    create_test_file(&new, &report(5));
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg("compare")
+        .args([&old, &new])
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("complexity 3 -> 5 (+2)"));
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg("compare")
+        .args([&old, &new])
+        .args(["--fail-on-increase", "complexity"])
+        .assert()
+        .failure()
+        .stderr(predicate::str::contains(
+            "src/lib.rs parse: complexity: 3 -> 5",
+        ))
+        .stderr(predicate::str::contains("2 metric(s) increased"));
+}
+
+#[test]
+fn test_badge_writes_svg_to_stdout() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.args([
+        "badge",
+        "tests/fixtures/test.rs",
+        "--metric",
+        "loc",
+        "-o",
+        "-",
+    ])
+    .arg("--no-cache")
+    .assert()
+    .success()
+    .stdout(predicate::str::starts_with("<svg "))
+    .stdout(predicate::str::contains("<title>lines of code: "));
+}
+
+#[test]
+fn test_stdin_requires_lang() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg("-")
+        .write_stdin("fn main() {}\n")
+        .assert()
+        .failure()
+        .stderr(predicate::str::contains(
+            "reading source from stdin (-) requires --lang",
+        ));
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.args(["tests/fixtures/test.rs", "--lang", "rust"])
+        .assert()
+        .failure()
+        .stderr(predicate::str::contains(
+            "--lang only applies to source read from stdin (-)",
+        ));
+}
+
+#[test]
+fn test_snippet_rejects_unknown_language() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.args(["snippet", "PROGRAM-ID. HELLO.", "--lang", "cobol"])
+        .assert()
+        .failure()
+        .stderr(predicate::str::contains(
+            "unknown language 'cobol' for --lang",
+        ));
+}
+
+#[test]
+fn test_ref_requires_git_url() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.args(["tests/fixtures", "--ref", "v1.2.0"])
+        .assert()
+        .failure()
+        .stderr(predicate::str::contains("--ref only applies to git URLs"));
+}
+
+#[test]
+fn test_lint_requires_rules() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.args(["tests/fixtures", "--lint", "--no-config"])
+        .assert()
+        .failure()
+        .stderr(predicate::str::contains(
+            "--lint requires [[rule]] tables in the configuration file",
+        ));
+}
+
+#[test]
+fn test_treemap_writes_html_to_stdout() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.args(["treemap", "tests/fixtures", "-o", "-", "--no-cache"])
+        .assert()
+        .success()
+        .stdout(predicate::str::starts_with("<!DOCTYPE html>"))
+        .stdout(predicate::str::contains("<g class=\"view\" id=\"v0\""));
+}
+
+#[test]
+fn test_tui_requires_terminal() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.args(["tui", "tests/fixtures", "--no-cache"])
+        .assert()
+        .failure()
+        .stderr(predicate::str::contains("tui requires a terminal"));
+}
+
+#[test]
+fn test_level_function_requires_csv() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg("tests/fixtures/test.rs")
+        .args(["--level", "function"])
+        .assert()
+        .failure()
+        .stderr(predicate::str::contains(
+            "--level function requires --format csv",
+        ));
+}
+
+#[test]
+fn test_watch_requires_directory() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg("tests/fixtures/test.rs")
+        .arg("--watch")
+        .assert()
+        .failure()
+        .stderr(predicate::str::contains("--watch requires a directory"));
+}
+
 #[test]
 fn test_multiple_ignore_patterns() {
     let (_temp_dir, project_root) = create_test_project();
@@ -207,3 +405,330 @@ fn test_all_options_combined() {
         .success()
         .stdout(predicate::str::is_match(r#"\{[\s\S]*"files"[\s\S]*\}"#).unwrap());
 }
+
+#[test]
+fn test_baseline_write_and_check() {
+    let (_temp_dir, project_root) = create_controlled_test_project();
+    let baseline = project_root.join("baseline.json");
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.args(["baseline", "write", "--no-cache", "--output"])
+        .arg(&baseline)
+        .arg(&project_root)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains(
+            "Wrote baseline of 3 files and 5 functions",
+        ));
+
+    // The baseline itself is not source code, so checking right away passes
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.args(["check", "--no-cache", "--baseline"])
+        .arg(&baseline)
+        .arg(&project_root)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("No regressions"));
+
+    create_test_file(
+        &project_root.join("file1.rs"),
+        r#"
+fn function_one(x: i32) -> i32 {
+    if x > 0 { 1 } else if x < 0 { -1 } else { 0 }
+}
+fn function_two() {}
+struct StructOne {}
+"#,
+    );
+    create_test_file(&project_root.join("extra.rs"), "fn extra() {}\n");
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.args(["check", "--no-cache", "--baseline"])
+        .arg(&baseline)
+        .arg(&project_root)
+        .assert()
+        .failure()
+        .stdout(predicate::str::contains("file count: 3 -> 4 (tolerance 0)"))
+        .stdout(predicate::str::contains(
+            "file1.rs function_one: complexity: 1 -> 3 (tolerance 0)",
+        ))
+        .stderr(predicate::str::contains("regressed against the baseline"));
+
+    // Within tolerance
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.args(["check", "--no-cache", "--baseline"])
+        .arg(&baseline)
+        .args([
+            "--complexity-tolerance",
+            "2",
+            "--function-lines-tolerance",
+            "2",
+            "--file-count-tolerance",
+            "1",
+        ])
+        .arg(&project_root)
+        .assert()
+        .success();
+}
+
+#[test]
+fn test_check_missing_baseline() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.args(["check", "--baseline", "does-not-exist.json"])
+        .arg(temp_dir.path())
+        .assert()
+        .failure()
+        .stderr(predicate::str::contains("Failed to read baseline"));
+}
+
+#[test]
+fn test_top_ranks_files_and_functions() {
+    let (_temp_dir, project_root) = create_controlled_test_project();
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let output = cmd
+        .args(["top", "--no-cache", "--by", "functions", "--limit", "2"])
+        .arg(&project_root)
+        .output()
+        .unwrap();
+    assert!(output.status.success());
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    // file1.rs and script.py tie with two functions each and sort by path
+    assert_contains_all(
+        &stdout,
+        &[
+            "Rank  File",
+            "Functions",
+            "file1.rs",
+            "script.py",
+            "Top 2 of 3 files by number of functions",
+        ],
+    );
+    assert!(!stdout.contains("file2.rs"));
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let output = cmd
+        .args([
+            "top",
+            "--no-cache",
+            "--by",
+            "complexity",
+            "--format",
+            "json",
+        ])
+        .arg(&project_root)
+        .output()
+        .unwrap();
+    assert!(output.status.success());
+    let json = parse_json_output(&String::from_utf8_lossy(&output.stdout));
+    assert_eq!(json["by"], "complexity");
+    assert_eq!(json["total"], 5);
+    assert_eq!(json["entries"][0]["rank"], 1);
+    assert_eq!(json["entries"][0]["value"], 1);
+}
+
+#[test]
+fn test_config_file_sets_defaults_and_flags_override() {
+    let (_temp_dir, project_root) = create_controlled_test_project();
+    create_test_file(
+        &project_root.join(".codestats.toml"),
+        r#"
+exclude = ["file2.rs"]
+languages = ["rust"]
+format = "json"
+"#,
+    );
+
+    let output = run_code_stats(&[project_root.to_str().unwrap(), "--no-cache"]);
+    assert!(output.status.success());
+    // Only file1.rs is left: file2.rs is excluded and script.py is not Rust
+    let json = parse_json_output(&String::from_utf8_lossy(&output.stdout));
+    assert_eq!(json["total_files"], 1);
+    assert_eq!(json["total_stats"]["function_count"], 2);
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(&project_root)
+        .args(["--no-cache", "--format", "summary"])
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("in 1 files"));
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(&project_root)
+        .args(["--no-cache", "--no-config", "--format", "summary"])
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("in 3 files"));
+
+    create_test_file(
+        &project_root.join(".codestats.toml"),
+        "languages = [\"cobol\"]\n",
+    );
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(&project_root)
+        .arg("--no-cache")
+        .assert()
+        .failure()
+        .stderr(predicate::str::contains("unknown language 'cobol'"));
+}
+
+#[test]
+fn test_todos_custom_markers() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    create_test_file(
+        &temp_dir.path().join("cart.rs"),
+        "// TODO: apply discounts\nfn total() {}\n// SAFETY: checked above\nfn raw() {}\n",
+    );
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(temp_dir.path())
+        .arg("--no-cache")
+        .arg("--todos")
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("cart.rs:1 TODO apply discounts"))
+        .stdout(predicate::str::contains("SAFETY").not())
+        .stdout(predicate::str::contains("1 comment: 1 TODO"));
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(temp_dir.path())
+        .args(["--no-cache", "--todos", "--todo-markers", "SAFETY"])
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("cart.rs:3 SAFETY checked above"))
+        .stdout(predicate::str::contains("1 comment: 1 SAFETY"));
+}
+
+#[test]
+fn test_strings_skips_tests_unless_configured() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    create_test_file(
+        &temp_dir.path().join("app.py"),
+        "def greet():\n    print(\"Welcome back\")\n    return \"user_id\"\n",
+    );
+    create_test_file(
+        &temp_dir.path().join("test_app.py"),
+        "def test_greet():\n    assert greet() == \"Hello there\"\n",
+    );
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(temp_dir.path())
+        .args(["--no-cache", "--strings"])
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("app.py:2 \"Welcome back\""))
+        .stdout(predicate::str::contains("user_id").not())
+        .stdout(predicate::str::contains("Hello there").not())
+        .stdout(predicate::str::contains("1 string in 1 file"));
+
+    create_test_file(
+        &temp_dir.path().join(".codestats.toml"),
+        "[strings]\ninclude_tests = true\n",
+    );
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(temp_dir.path())
+        .args(["--no-cache", "--strings"])
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("test_app.py:2 \"Hello there\""))
+        .stdout(predicate::str::contains("2 strings in 2 files"));
+}
+
+#[test]
+fn test_require_header_fails_for_files_without_license() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    create_test_file(
+        &temp_dir.path().join("lib.rs"),
+        "// SPDX-License-Identifier: Apache-2.0\n\npub fn answer() -> u32 {\n    42\n}\n",
+    );
+    create_test_file(&temp_dir.path().join("build.py"), "print(\"building\")\n");
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(temp_dir.path())
+        .args(["--no-cache", "--licenses"])
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Apache-2.0  1 file"))
+        .stdout(predicate::str::contains("Missing license header:"))
+        .stdout(predicate::str::contains("build.py"))
+        .stdout(predicate::str::contains(
+            "1 of 2 files have a license header (50.0%)",
+        ));
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(temp_dir.path())
+        .args(["--no-cache", "--require-header"])
+        .assert()
+        .failure()
+        .stderr(predicate::str::contains(
+            "1 file(s) without a license header",
+        ));
+}
+
+#[test]
+fn test_identifiers_reports_single_letter_variables() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    create_test_file(
+        &temp_dir.path().join("cart.py"),
+        "def total_price(items):\n    t = 0\n    for i in items:\n        t += i.price\n    return t\n",
+    );
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(temp_dir.path())
+        .args(["--no-cache", "--identifiers"])
+        .assert()
+        .success()
+        // total_price, items, t, and the loop variable i
+        .stdout(predicate::str::is_match(r"Python\s+4\s+4\.5\s+1\s+1").unwrap())
+        .stdout(predicate::str::contains("total_price (11, cart.py:1)"))
+        .stdout(predicate::str::contains(
+            "Single-letter variables outside loops:\n  t (cart.py:2)",
+        ));
+}
+
+#[test]
+fn test_languages_and_grammar_pins() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.current_dir(temp_dir.path())
+        .arg("languages")
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language"))
+        .stdout(predicate::str::contains("tree-sitter-rust"));
+
+    // No release of the grammar is numbered 999
+    create_test_file(
+        &temp_dir.path().join(".codestats.toml"),
+        "[grammars]\nrust = \"999\"\n",
+    );
+    create_test_file(&temp_dir.path().join("main.rs"), "fn main() {}");
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.current_dir(temp_dir.path())
+        .args(["main.rs", "--no-cache"])
+        .assert()
+        .success()
+        .stderr(predicate::str::contains("Warning: Rust grammar"))
+        .stderr(predicate::str::contains("pinned to 999"));
+
+    create_test_file(
+        &temp_dir.path().join(".codestats.toml"),
+        "[grammars]\non_mismatch = \"error\"\nrust = \"999\"\n",
+    );
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.current_dir(temp_dir.path())
+        .args(["main.rs", "--no-cache"])
+        .assert()
+        .failure()
+        .stderr(predicate::str::contains(
+            "grammars differ from the pinned versions",
+        ));
+    // The grammars can still be listed to see what differs
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.current_dir(temp_dir.path())
+        .arg("languages")
+        .assert()
+        .success();
+}
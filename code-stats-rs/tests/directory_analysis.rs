@@ -2,7 +2,7 @@ mod common;
 
 use common::{
     assert_contains_all, create_controlled_test_project, create_symlink, create_test_file,
-    create_test_project, run_code_stats,
+    create_test_project, parse_json_output, run_code_stats,
 };
 use std::fs;
 
@@ -95,6 +95,97 @@ fn test_ignore_patterns() {
     assert!(stdout_multi.contains("Total:"));
 }
 
+#[test]
+fn test_include_and_exclude_patterns() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let root = temp_dir.path();
+    create_test_file(&root.join("src/lib.rs"), "fn lib() {}");
+    create_test_file(&root.join("src/lib_test.rs"), "fn lib_test() {}");
+    create_test_file(&root.join("src/testdata/case.rs"), "fn case() {}");
+    create_test_file(&root.join("tools/gen.rs"), "fn generate() {}");
+    let root = root.to_str().unwrap();
+
+    let output = run_code_stats(&[root, "--exclude", "testdata/", "--exclude", "*_test.rs"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    assert!(output.status.success());
+    assert!(stdout.contains("2 functions"), "{stdout}");
+
+    // A later `!` pattern re-includes what an earlier one excluded
+    let output = run_code_stats(&[
+        root,
+        "--include",
+        "src/",
+        "--exclude",
+        "*.rs",
+        "--exclude",
+        "!lib.rs",
+    ]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    assert!(output.status.success());
+    assert!(stdout.contains("1 functions"), "{stdout}");
+}
+
+#[test]
+fn test_gitignore_is_respected() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let root = temp_dir.path();
+
+    create_test_file(&root.join(".gitignore"), "build/\n");
+    create_test_file(&root.join("main.rs"), "fn main() {}");
+    create_test_file(&root.join("build/out.rs"), "fn generated() {}");
+    create_test_file(&root.join(".git/objects.rs"), "fn internal() {}");
+
+    let output = run_code_stats(&[root.to_str().unwrap(), "--detail"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+
+    assert!(output.status.success());
+    assert!(stdout.contains("main.rs"));
+    assert!(!stdout.contains("out.rs"));
+    assert!(!stdout.contains("objects.rs"));
+    assert!(stdout.contains("in 1 files"));
+
+    // --no-gitignore brings ignored files back, but .git is always skipped
+    let output = run_code_stats(&[root.to_str().unwrap(), "--detail", "--no-gitignore"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+
+    assert!(output.status.success());
+    assert!(stdout.contains("out.rs"));
+    assert!(!stdout.contains("objects.rs"));
+    assert!(stdout.contains("in 2 files"));
+}
+
+#[test]
+fn test_result_cache_tracks_file_changes() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let root = temp_dir.path();
+    let project = root.join("project");
+    create_test_file(&project.join("main.rs"), "fn main() {}");
+
+    let run_in_root = |args: &[&str]| {
+        std::process::Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+            .current_dir(root)
+            .arg("project")
+            .args(args)
+            .output()
+            .expect("Failed to run code-stats-rs")
+    };
+
+    let output = run_in_root(&[]);
+    assert!(output.status.success());
+    assert!(String::from_utf8_lossy(&output.stdout).contains("Total: 1 functions"));
+    assert!(root.join(".codestats-cache").is_dir());
+
+    // An edited file must be reparsed rather than served from the cache
+    create_test_file(&project.join("main.rs"), "fn main() {}\nfn helper() {}");
+    let output = run_in_root(&[]);
+    assert!(String::from_utf8_lossy(&output.stdout).contains("Total: 2 functions"));
+
+    let output = run_in_root(&["--clear-cache", "--no-cache"]);
+    assert!(output.status.success());
+    assert!(String::from_utf8_lossy(&output.stdout).contains("Total: 2 functions"));
+    assert!(!root.join(".codestats-cache").exists());
+}
+
 #[test]
 fn test_max_depth_option() {
     let (_temp_dir, project_root) = create_test_project();
@@ -240,8 +331,17 @@ fn test_follow_links_option() {
     let stdout_follow = String::from_utf8_lossy(&output_follow.stdout);
 
     assert!(output_follow.status.success());
-    // Should count the file twice (once in source, once through link)
-    assert!(stdout_follow.contains("2 functions"));
+    // The file reached through the link is the same file and counts once
+    assert!(stdout_follow.contains("1 functions"));
+
+    // A file outside the analyzed directory is found through the link only
+    let outside = tempfile::TempDir::new().unwrap();
+    create_test_file(&outside.path().join("shared.rs"), "fn shared() {}");
+    create_symlink(outside.path(), &root.join("link_to_outside"));
+    let output_follow = run_code_stats(&[root.to_str().unwrap(), "--follow-links"]);
+    assert!(String::from_utf8_lossy(&output_follow.stdout).contains("2 functions"));
+    let output_skip = run_code_stats(&[root.to_str().unwrap(), "--skip-links"]);
+    assert!(String::from_utf8_lossy(&output_skip.stdout).contains("1 functions"));
 }
 
 #[test]
@@ -264,6 +364,48 @@ fn test_directory_with_errors() {
     assert!(stdout.contains("1 functions"));
 }
 
+#[test]
+fn test_files_above_max_parse_size_only_count_lines() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let root = temp_dir.path();
+    create_test_file(&root.join("small.rs"), "fn small() {}");
+    // 1.5 MiB of functions, above a 1 MiB limit
+    let generated = "fn generated() {}\n".repeat(90_000);
+    create_test_file(&root.join("tables.rs"), &generated);
+
+    let output = run_code_stats(&[root.to_str().unwrap(), "--max-parse-size", "1"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+
+    assert!(output.status.success());
+    assert!(stdout.contains("1 functions"));
+    assert!(stdout.contains("90001 code"));
+    assert!(stdout.contains(&format!(
+        "Not parsed: 1 file above the parse size limit, only lines counted ({})",
+        root.join("tables.rs").display()
+    )));
+}
+
+#[test]
+fn test_profile_reports_to_stderr() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let root = temp_dir.path();
+    create_test_file(&root.join("main.go"), "package main\n\nfunc main() {}\n");
+    create_test_file(&root.join("util.py"), "def helper():\n    pass\n");
+
+    let output = run_code_stats(&[root.to_str().unwrap(), "--no-cache", "--profile", "1"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    let stderr = String::from_utf8_lossy(&output.stderr);
+
+    assert!(output.status.success());
+    assert!(!stdout.contains("Profile:"));
+    assert!(stderr.contains("Profile: 2 files"));
+    assert!(stderr.contains("Slowest files:"));
+    assert_eq!(
+        stderr.matches(" (Go, ").count() + stderr.matches(" (Python, ").count(),
+        1
+    );
+}
+
 #[test]
 fn test_directory_not_found() {
     let output = run_code_stats(&["/nonexistent/directory/path"]);
@@ -276,3 +418,547 @@ fn test_directory_not_found() {
         stderr
     );
 }
+
+#[test]
+fn test_custom_queries_are_counted() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let root = temp_dir.path();
+    let project = root.join("project");
+
+    create_test_file(
+        &project.join("main.go"),
+        r#"package main
+
+//go:generate stringer -type=Color
+func main() {
+    if broken() {
+        panic("boom")
+    }
+    panic("again")
+}
+"#,
+    );
+    create_test_file(
+        &root.join("queries/panic.scm"),
+        r#"(call_expression function: (identifier) @f (#eq? @f "panic"))"#,
+    );
+    let config = root.join("codestats-queries.toml");
+    create_test_file(
+        &config,
+        r#"
+[[query]]
+name = "panic_calls"
+language = "go"
+path = "queries/panic.scm"
+
+[[query]]
+name = "go_generate"
+language = "go"
+query = '((comment) @c (#match? @c "^//go:generate"))'
+"#,
+    );
+
+    let output = run_code_stats(&[
+        project.to_str().unwrap(),
+        "--detail",
+        "--queries",
+        config.to_str().unwrap(),
+    ]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+
+    assert!(output.status.success());
+    assert!(stdout.contains("  Queries: go_generate: 1, panic_calls: 2"));
+    assert!(stdout.contains("\nQueries: go_generate: 1, panic_calls: 2"));
+
+    let output = run_code_stats(&[
+        project.to_str().unwrap(),
+        "--format",
+        "json",
+        "--queries",
+        config.to_str().unwrap(),
+    ]);
+    let json: serde_json::Value = serde_json::from_slice(&output.stdout).unwrap();
+    assert_eq!(json["total_stats"]["queries"]["panic_calls"], 2);
+    assert_eq!(json["files"][0]["stats"]["queries"]["go_generate"], 1);
+}
+
+#[test]
+fn test_invalid_query_config_fails() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let config = temp_dir.path().join("queries.toml");
+    create_test_file(
+        &config,
+        "[[query]]\nname = \"x\"\nlanguage = \"cobol\"\nquery = \"(identifier)\"\n",
+    );
+
+    let output = run_code_stats(&[
+        temp_dir.path().to_str().unwrap(),
+        "--queries",
+        config.to_str().unwrap(),
+    ]);
+    let stderr = String::from_utf8_lossy(&output.stderr);
+
+    assert!(!output.status.success());
+    assert!(stderr.contains("Invalid configuration: query 'x': unknown language 'cobol'"));
+}
+
+/// Runs git in `dir`, panicking on failure.
+fn git(dir: &std::path::Path, args: &[&str]) {
+    let status = std::process::Command::new("git")
+        .arg("-C")
+        .arg(dir)
+        .args(args)
+        .status()
+        .expect("Failed to run git");
+    assert!(status.success(), "git {args:?} failed");
+}
+
+#[test]
+fn test_diff_reports_changed_functions() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let root = temp_dir.path();
+
+    git(root, &["init", "-q"]);
+    git(root, &["config", "user.email", "test@example.com"]);
+    git(root, &["config", "user.name", "Test"]);
+    git(root, &["config", "commit.gpgsign", "false"]);
+    create_test_file(
+        &root.join("src/lib.rs"),
+        "fn keep() {}\n\nfn grow(x: i32) -> i32 {\n    x\n}\n",
+    );
+    create_test_file(&root.join("src/old.rs"), "fn legacy() {}\n");
+    git(root, &["add", "-A"]);
+    git(root, &["commit", "-q", "-m", "base"]);
+
+    create_test_file(
+        &root.join("src/lib.rs"),
+        "fn keep() {}\n\nfn grow(x: i32) -> i32 {\n    if x > 0 {\n        return x;\n    }\n    -x\n}\n",
+    );
+    create_test_file(&root.join("src/new.rs"), "fn fresh() {}\n");
+    std::fs::remove_file(root.join("src/old.rs")).unwrap();
+    // Untracked files are not part of `git diff`
+    git(root, &["add", "src/new.rs"]);
+
+    let output = run_code_stats(&[root.to_str().unwrap(), "--diff", "HEAD", "--no-cache"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+
+    assert!(
+        output.status.success(),
+        "{}",
+        String::from_utf8_lossy(&output.stderr)
+    );
+    assert_contains_all(
+        &stdout,
+        &[
+            "Changes since HEAD: 3 files, 3 functions touched",
+            "lib.rs (modified):",
+            "~ grow    lines 3 -> 6 (+3), complexity 1 -> 2 (+1)",
+            "new.rs (added):",
+            "+ fresh   lines 1, complexity 1",
+            "old.rs (deleted):",
+            "- legacy  lines 1, complexity 1",
+        ],
+    );
+    // Untouched functions are not reported
+    assert!(!stdout.contains("keep"));
+
+    let output = run_code_stats(&[
+        root.to_str().unwrap(),
+        "--diff",
+        "HEAD",
+        "--no-cache",
+        "--format",
+        "json",
+    ]);
+    let json = parse_json_output(&String::from_utf8_lossy(&output.stdout));
+    assert_eq!(json["base"], "HEAD");
+    assert_eq!(json["files"][0]["functions"][0]["after"]["complexity"], 2);
+
+    let output = run_code_stats(&[root.to_str().unwrap(), "--diff", "no-such-ref"]);
+    assert!(!output.status.success());
+    assert!(String::from_utf8_lossy(&output.stderr).contains("unknown revision 'no-such-ref'"));
+}
+
+#[test]
+fn test_hook_checks_staged_content() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let root = temp_dir.path();
+    git(root, &["init", "-q"]);
+    create_test_file(
+        &root.join(".codestats.toml"),
+        "[thresholds]\ncomplexity = 2\n",
+    );
+    let branchy = "fn pick(x: i32) -> i32 {\n    if x > 0 {\n        1\n    } else if x < 0 {\n        2\n    } else {\n        3\n    }\n}\n";
+    create_test_file(&root.join("src/lib.rs"), branchy);
+    create_test_file(&root.join("src/unstaged.rs"), branchy);
+    git(root, &["add", "src/lib.rs"]);
+
+    let run_hook = || {
+        std::process::Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+            .current_dir(root)
+            .args(["hook", "--no-cache"])
+            .output()
+            .expect("Failed to run code-stats-rs")
+    };
+
+    // Simplifying the file without staging it doesn't fix the commit
+    create_test_file(
+        &root.join("src/lib.rs"),
+        "fn pick(x: i32) -> i32 {\n    x\n}\n",
+    );
+    let output = run_hook();
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    assert!(!output.status.success());
+    assert_contains_all(
+        &stdout,
+        &[
+            "Staged functions over the thresholds:",
+            "./src/lib.rs:1: Function 'pick' has a cyclomatic complexity of 3 (threshold 2)",
+        ],
+    );
+    // Files that are not staged are not checked
+    assert!(!stdout.contains("unstaged.rs"));
+    assert!(
+        String::from_utf8_lossy(&output.stderr)
+            .contains("1 threshold violation(s) in staged files")
+    );
+
+    git(root, &["add", "src/lib.rs"]);
+    let output = run_hook();
+    assert!(output.status.success());
+    assert!(
+        String::from_utf8_lossy(&output.stdout)
+            .contains("No threshold violations in 1 staged file(s)")
+    );
+}
+
+#[test]
+fn test_workspace_compares_repositories() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let root = temp_dir.path();
+    create_test_file(&root.join("alpha/src/lib.rs"), "fn one() {}\nfn two() {}\n");
+    create_test_file(
+        &root.join("beta/main.py"),
+        "def f(x):\n    if x:\n        return 1\n    return 0\n",
+    );
+    let manifest = root.join("repos.txt");
+    create_test_file(&manifest, "# Services\nalpha\nbeta\n");
+
+    let output = run_code_stats(&[
+        "workspace",
+        "--manifest",
+        manifest.to_str().unwrap(),
+        "--format",
+        "csv",
+        "--no-cache",
+    ]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    assert!(
+        output.status.success(),
+        "stderr: {}",
+        String::from_utf8_lossy(&output.stderr)
+    );
+    let rows: Vec<&str> = stdout.lines().collect();
+    assert_eq!(rows[1], ",,2,6,0,3,2,1.33");
+    assert!(rows[2].starts_with("alpha,") && rows[2].ends_with(",1,2,0,2,1,1.00"));
+    assert!(rows[3].starts_with("beta,") && rows[3].ends_with(",1,4,0,1,2,2.00"));
+
+    let output = run_code_stats(&[
+        "workspace",
+        root.join("alpha").to_str().unwrap(),
+        root.join("beta").to_str().unwrap(),
+        "--no-cache",
+    ]);
+    assert_contains_all(
+        &String::from_utf8_lossy(&output.stdout),
+        &["Repository", "alpha", "beta", "Total", "All repositories:"],
+    );
+}
+
+#[test]
+fn test_duplicates_reports_renamed_copies() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let root = temp_dir.path();
+    create_test_file(
+        &root.join("a.rs"),
+        r#"
+fn total(items: &[u32]) -> u32 {
+    let mut sum = 0;
+    for item in items {
+        if *item > 10 {
+            sum += item * 2;
+        }
+    }
+    sum
+}
+"#,
+    );
+    create_test_file(
+        &root.join("b.rs"),
+        r#"
+// Copied from a.rs and renamed
+fn weight(values: &[u32]) -> u32 {
+    let mut acc = 0;
+    for v in values {
+        if *v > 99 {
+            acc += v * 7;
+        }
+    }
+    acc
+}
+
+fn unrelated() -> u32 {
+    42
+}
+"#,
+    );
+    let root_str = root.to_str().unwrap();
+
+    let output = run_code_stats(&[root_str, "--duplicates", "--min-clone-tokens", "20"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    assert!(output.status.success());
+    assert_contains_all(
+        &stdout,
+        &[
+            "Duplicates: 1 clone group, 2 copies (at least 20 tokens)",
+            "Clone group 1: 2 copies of ",
+            "a.rs:2-10  total",
+            "b.rs:3-11  weight",
+        ],
+    );
+
+    let output = run_code_stats(&[root_str, "--duplicates", "--format", "json"]);
+    let json = parse_json_output(&String::from_utf8_lossy(&output.stdout));
+    assert_eq!(json["min_tokens"], 50);
+    assert!(json["groups"].as_array().unwrap().is_empty());
+
+    let output = run_code_stats(&[root_str, "--duplicates"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    assert!(stdout.contains("No duplicates of at least 50 tokens found"));
+}
+
+#[test]
+fn test_group_by_dir_renders_tree() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let root = temp_dir.path();
+    fs::create_dir_all(root.join("src/util")).unwrap();
+    fs::create_dir_all(root.join("tests")).unwrap();
+    create_test_file(&root.join("main.rs"), "fn main() {}\n");
+    create_test_file(
+        &root.join("src/lib.rs"),
+        "fn one() {}\nfn two() {}\nstruct Lib {}\n",
+    );
+    create_test_file(&root.join("src/util/helpers.rs"), "fn help() {}\n");
+    create_test_file(&root.join("tests/it.rs"), "fn check() {}\n");
+    let root_str = root.to_str().unwrap();
+
+    let output = run_code_stats(&[root_str, "--group-by", "dir"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    assert!(output.status.success());
+    let lines: Vec<&str> = stdout.lines().collect();
+    assert!(lines[0].starts_with("Directory"));
+    assert!(lines[1].starts_with(root_str));
+    // src carries the most code, so it is listed before tests
+    assert!(lines[2].starts_with("  src "));
+    assert!(lines[3].starts_with("    util "));
+    assert!(lines[4].starts_with("  tests "));
+    assert_eq!(lines.len(), 5);
+
+    let output = run_code_stats(&[root_str, "--group-by", "dir", "--depth", "1"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    assert!(stdout.contains("  src "));
+    assert!(!stdout.contains("util"));
+
+    let output = run_code_stats(&[root_str, "--group-by", "dir", "--format", "json"]);
+    let json = parse_json_output(&String::from_utf8_lossy(&output.stdout));
+    assert_eq!(json["root"]["files"], 4);
+    assert_eq!(json["root"]["functions"], 5);
+    let src = &json["root"]["children"][0];
+    assert!(src["path"].as_str().unwrap().ends_with("src"));
+    assert_eq!(src["files"], 2);
+    assert_eq!(src["classes"], 1);
+
+    let output = run_code_stats(&[&format!("{root_str}/main.rs"), "--group-by", "dir"]);
+    assert!(!output.status.success());
+    assert!(String::from_utf8_lossy(&output.stderr).contains("--group-by requires a directory"));
+}
+
+#[test]
+fn test_group_by_type_merges_partial_classes() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let root = temp_dir.path();
+    create_test_file(
+        &root.join("Cart.cs"),
+        r#"namespace Shop
+{
+    public partial class Cart
+    {
+        public void Add(int id)
+        {
+            if (id > 0) { Count++; }
+        }
+    }
+}
+"#,
+    );
+    create_test_file(
+        &root.join("Cart.Generated.cs"),
+        r#"namespace Shop
+{
+    public partial class Cart
+    {
+        public int Count { get; set; }
+
+        public void Clear() { Count = 0; }
+    }
+
+    public class Order {}
+}
+"#,
+    );
+    let root_str = root.to_str().unwrap();
+
+    let output = run_code_stats(&[root_str, "--group-by", "type"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    assert!(output.status.success());
+    let lines: Vec<&str> = stdout.lines().collect();
+    assert!(lines[0].starts_with("Type"));
+    // One row per part of Cart, plus Order
+    assert_eq!(lines.len(), 4);
+    assert_eq!(
+        lines
+            .iter()
+            .filter(|line| line.starts_with("Shop.Cart "))
+            .count(),
+        2
+    );
+
+    let output = run_code_stats(&[
+        root_str,
+        "--group-by",
+        "type",
+        "--merge-partial",
+        "--format",
+        "json",
+    ]);
+    let json = parse_json_output(&String::from_utf8_lossy(&output.stdout));
+    let cart = &json["types"][0];
+    assert_eq!(cart["name"], "Shop.Cart");
+    assert_eq!(cart["lines"], 13);
+    assert_eq!(cart["methods"], 2);
+    assert_eq!(cart["fields"], 1);
+    assert_eq!(cart["complexity"], 3);
+    assert_eq!(cart["locations"].as_array().unwrap().len(), 2);
+    assert_eq!(json["types"][1]["name"], "Shop.Order");
+}
+
+#[test]
+fn test_group_by_type_counts_members() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let root = temp_dir.path();
+    create_test_file(
+        &root.join("person.go"),
+        r#"package main
+
+type Person struct {
+    Name string
+    Age  int
+}
+
+func (p Person) Greet() {
+    fmt.Printf("Hello, I'm %s\n", p.Name)
+}
+"#,
+    );
+    let root_str = root.to_str().unwrap();
+
+    let output = run_code_stats(&[root_str, "--group-by", "type", "--format", "json"]);
+    let json = parse_json_output(&String::from_utf8_lossy(&output.stdout));
+    let person = &json["types"][0];
+    assert_eq!(person["name"], "Person");
+    assert_eq!(person["fields"], 2);
+    assert_eq!(person["methods"], 1);
+    assert_eq!(person["bases"], 0);
+    assert_eq!(person["god_object"], false);
+
+    let output = run_code_stats(&[root_str, "--group-by", "type", "--max-type-members", "2"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    assert!(output.status.success());
+    assert!(stdout.contains("\n\nGod objects: Person"));
+}
+
+#[test]
+fn test_implementations_lists_interfaces() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let root = temp_dir.path();
+    create_test_file(
+        &root.join("shape.go"),
+        "package shapes\n\ntype Shape interface {\n    Area() float64\n}\n",
+    );
+    create_test_file(
+        &root.join("circle.go"),
+        r#"package shapes
+
+type Circle struct {
+    R float64
+}
+
+func (c Circle) Area() float64 {
+    return 3 * c.R * c.R
+}
+"#,
+    );
+    let root_str = root.to_str().unwrap();
+
+    let output = run_code_stats(&[root_str, "--implementations", "--format", "json"]);
+    assert!(output.status.success());
+    let json = parse_json_output(&String::from_utf8_lossy(&output.stdout));
+    let shape = &json["interfaces"][0];
+    assert_eq!(shape["name"], "Shape");
+    assert_eq!(shape["methods"], 1);
+    assert_eq!(shape["implementors"][0]["name"], "Circle");
+    assert_eq!(shape["implementors"][0]["line"], 3);
+    assert_eq!(shape["implementors"][0]["inferred"], true);
+}
+
+#[test]
+fn test_configuration_files_are_reported_separately() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let root = temp_dir.path();
+    let root_str = root.to_str().unwrap();
+
+    create_test_file(&root.join("main.rs"), "fn main() {}\n");
+    create_test_file(
+        &root.join("package.json"),
+        r#"{"name": "app", "scripts": {"build": "tsc", "test": "jest"}}"#,
+    );
+    create_test_file(
+        &root.join("Cargo.toml"),
+        "[package]\nname = \"app\"\nversion = \"0.1.0\"\n",
+    );
+
+    let output = run_code_stats(&[root_str, "--no-cache"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+
+    assert!(output.status.success());
+    assert!(!stdout.contains("  Json:"));
+    assert_contains_all(
+        &stdout,
+        &[
+            "Total: 1 functions, 0 structs/classes in 1 files",
+            "Lines: 1 code,",
+            "Configuration: 2 files (Json: 1, Toml: 1), 7 keys, max depth 2, 2 documents, 4 code lines",
+            "Largest configuration files:",
+        ],
+    );
+    assert!(
+        stdout.find("package.json (4 keys").unwrap() < stdout.find("Cargo.toml (3 keys").unwrap()
+    );
+
+    let output = run_code_stats(&[root_str, "--no-cache", "--format", "json"]);
+    let json = parse_json_output(&String::from_utf8_lossy(&output.stdout));
+    assert_eq!(json["total_files"], 3);
+    assert_eq!(json["configuration"]["files"], 2);
+    assert_eq!(json["configuration"]["config"]["keys"], 7);
+    assert!(json["total_by_language"].get("Json").is_none());
+}
@@ -16,7 +16,47 @@ fn test_rust_file_analysis() {
         .success()
         .stdout(predicate::str::contains("Language: Rust"))
         .stdout(predicate::str::contains("Functions: 5"))
-        .stdout(predicate::str::contains("Classes/Structs: 2"));
+        .stdout(predicate::str::contains("Classes/Structs: 2"))
+        .stdout(predicate::str::contains(
+            "Breakdown: enum: 1, function: 5, impl: 1, struct: 1",
+        ));
+}
+
+#[test]
+fn test_rust_complexity_threshold() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("test.rs");
+
+    // `calculate` matches on three enum variants: 1 + 3 arms
+    cmd.arg(fixture)
+        .arg("--complexity-threshold")
+        .arg("3")
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Complexity: max 4, mean 1.60"))
+        .stdout(predicate::str::contains(
+            "Nesting depth: max 1 (line 30 calculate)",
+        ))
+        .stdout(predicate::str::contains(
+            "Functions above complexity threshold 3:",
+        ))
+        .stdout(predicate::str::contains("line 30 calculate (complexity 4)"));
+}
+
+#[test]
+fn test_rust_traits_and_impls_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("traits.rs");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Rust"))
+        .stdout(predicate::str::contains("Functions: 4"))
+        .stdout(predicate::str::contains("Classes/Structs: 2"))
+        .stdout(predicate::str::contains(
+            "Breakdown: enum: 1, function: 4, impl: 2, struct: 1, trait: 1",
+        ));
 }
 
 #[test]
@@ -29,7 +69,26 @@ fn test_python_file_analysis() {
         .success()
         .stdout(predicate::str::contains("Language: Python"))
         .stdout(predicate::str::contains("Functions: 4"))
-        .stdout(predicate::str::contains("Classes/Structs: 1"));
+        .stdout(predicate::str::contains("Classes/Structs: 1"))
+        .stdout(predicate::str::contains(
+            "Breakdown: class: 1, function: 2, method: 2",
+        ));
+}
+
+#[test]
+fn test_python_decorators_and_async_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("async_decorators.py");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Python"))
+        .stdout(predicate::str::contains("Functions: 8"))
+        .stdout(predicate::str::contains("Classes/Structs: 1"))
+        .stdout(predicate::str::contains(
+            "Breakdown: async_function: 2, class: 1, decorator: 5, function: 4, method: 4",
+        ));
 }
 
 #[test]
@@ -42,7 +101,48 @@ fn test_go_file_analysis() {
         .success()
         .stdout(predicate::str::contains("Language: Go"))
         .stdout(predicate::str::contains("Functions: 3"))
-        .stdout(predicate::str::contains("Classes/Structs: 1"));
+        .stdout(predicate::str::contains("Classes/Structs: 1"))
+        .stdout(predicate::str::contains(
+            "Breakdown: function: 2, method: 1, struct: 1",
+        ))
+        .stdout(predicate::str::contains(
+            "Lines: 16 code, 0 comments, 5 blank (0.0% comments)",
+        ))
+        // Person and Greet are exported without doc comments
+        .stdout(predicate::str::contains(
+            "Doc coverage: 0/2 public items documented (0.0%)",
+        ));
+}
+
+#[test]
+fn test_go_function_listing() {
+    let fixture = get_fixtures_path().join("test.go");
+
+    // Rows: qualified name, file:start-end, lines, parameters, complexity
+    Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+        .arg(&fixture)
+        .arg("--functions")
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Function"))
+        .stdout(predicate::str::is_match(r"Person\.Greet\s+\S*test\.go:10-12\s+3\s+0\s+1").unwrap())
+        .stdout(predicate::str::is_match(r"main\s+\S*test\.go:14-17\s+4\s+0\s+1").unwrap())
+        .stdout(predicate::str::is_match(r"add\s+\S*test\.go:19-21\s+3\s+2\s+1").unwrap())
+        .stdout(predicate::str::contains("3 functions"));
+
+    // Sorting by parameter count puts add first
+    let output = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+        .arg(&fixture)
+        .args(["--functions", "--sort", "params", "--format", "json"])
+        .output()
+        .unwrap();
+    let json: serde_json::Value = serde_json::from_slice(&output.stdout).unwrap();
+    let functions = json["functions"].as_array().unwrap();
+    assert_eq!(functions.len(), 3);
+    assert_eq!(functions[0]["qualified_name"], "add");
+    assert_eq!(functions[0]["parameters"], 2);
+    assert_eq!(functions[0]["lines"], 3);
+    assert_eq!(functions[1]["qualified_name"], "Person.Greet");
 }
 
 #[test]
@@ -68,7 +168,11 @@ fn test_typescript_file_analysis() {
         .success()
         .stdout(predicate::str::contains("Language: TypeScript"))
         .stdout(predicate::str::contains("Functions: 7"))
-        .stdout(predicate::str::contains("Classes/Structs: 1"));
+        .stdout(predicate::str::contains("Classes/Structs: 1"))
+        .stdout(predicate::str::contains(
+            "Breakdown: arrow_function: 1, class: 1, function: 1, function_expression: 1, \
+             interface: 1, method: 4, type_alias: 1",
+        ));
 }
 
 #[test]
@@ -84,6 +188,936 @@ fn test_java_file_analysis() {
         .stdout(predicate::str::contains("Classes/Structs: 4"));
 }
 
+#[test]
+fn test_java_generics_and_nested_types() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("generics.java");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        // Container, add, map, Pair, reverse, size, iterator, visit
+        .stdout(predicate::str::contains("Functions: 8"))
+        // Container, Pair, Order, View, Window, Visitor
+        .stdout(predicate::str::contains("Classes/Structs: 6"))
+        .stdout(predicate::str::contains(
+            "Breakdown: annotation: 1, annotation_type: 1, class: 3, constructor: 2, enum: 1, \
+             interface: 1, method: 6, record: 1",
+        ))
+        // Container > View > Window
+        .stdout(predicate::str::contains("Type nesting depth: 3"));
+}
+
+#[test]
+fn test_go_closures_are_counted_apart_from_functions() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let file = temp_dir.path().join("serve.go");
+    std::fs::write(
+        &file,
+        "package main\n\nvar onExit = func() {}\n\nfunc serve(jobs []int) {\n\
+         \tfor _, job := range jobs {\n\t\tgo func(j int) {\n\
+         \t\t\tdefer func() { recover() }()\n\t\t}(job)\n\t}\n}\n",
+    )
+    .unwrap();
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(&file)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Functions: 1"))
+        .stdout(predicate::str::contains(
+            "Closures: 3 anonymous functions (1 nested, 1 at top level), max depth 2",
+        ));
+
+    let output = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+        .arg(&file)
+        .args(["--format", "json"])
+        .output()
+        .unwrap();
+    let json: serde_json::Value = serde_json::from_slice(&output.stdout).unwrap();
+    let serve = &json["files"][0]["stats"]["functions"][0];
+    assert_eq!(serve["name"], "serve");
+    assert_eq!(serve["closures"], 2);
+    assert_eq!(serve["closure_depth"], 2);
+    assert_eq!(json["total_by_language"]["Go"]["closures"]["count"], 3);
+}
+
+#[test]
+fn test_go_functions_without_err_checks_are_flagged() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    std::fs::write(
+        temp_dir.path().join("store.go"),
+        "package store\n\nfunc Load(path string) error {\n\tdata, err := os.ReadFile(path)\n\
+         \tif err != nil {\n\t\treturn err\n\t}\n\treturn parse(data)\n}\n\n\
+         func Save(path string) {\n\t_, err := os.Create(path)\n\t_ = err\n}\n",
+    )
+    .unwrap();
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(temp_dir.path())
+        .assert()
+        .success()
+        .stdout(predicate::str::contains(
+            "Error handling: Go 1 check (0.50 per function), 2 fallible calls, 0 panics, \
+             0 assertions, 1 unhandled function",
+        ))
+        .stdout(predicate::str::contains("Unhandled fallible calls:"))
+        .stdout(predicate::str::contains(
+            "store.go:11 Save (1 fallible call, no checks)",
+        ));
+}
+
+#[test]
+fn test_rust_match_statements_are_listed() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let file = temp_dir.path().join("token.rs");
+    std::fs::write(
+        &file,
+        "fn kind(c: char) -> u8 {\n    match c {\n        'a' => 1,\n        'b' => 2,\n\
+         \x20       _ => 0,\n    }\n}\n",
+    )
+    .unwrap();
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(&file)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains(
+            "Switches: 1 switch/match statement, 0 without a default arm, max 3 branches",
+        ));
+
+    let output = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+        .arg(&file)
+        .args(["--format", "json"])
+        .output()
+        .unwrap();
+    let json: serde_json::Value = serde_json::from_slice(&output.stdout).unwrap();
+    let switch = &json["files"][0]["stats"]["switches"][0];
+    assert_eq!(switch["kind"], "match");
+    assert_eq!(switch["start_line"], 2);
+    assert_eq!(switch["branches"], 3);
+    assert_eq!(switch["has_default"], true);
+}
+
+#[test]
+fn test_c_file_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("test.c");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: C)"))
+        .stdout(predicate::str::contains("Functions: 2"))
+        // struct node and the typedef'd enum
+        .stdout(predicate::str::contains("Classes/Structs: 2"))
+        .stdout(predicate::str::contains(
+            "Breakdown: enum: 1, function: 2, macro: 2, struct: 1",
+        ))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_cpp_file_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("test.cpp");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Cpp)"))
+        // ~Shape, Shape::area, Rect, Rect::area, Stack::push, total_area
+        .stdout(predicate::str::contains("Functions: 6"))
+        .stdout(predicate::str::contains("Classes/Structs: 3"))
+        .stdout(predicate::str::contains(
+            "Breakdown: class: 2, function: 1, macro: 1, method: 5, namespace: 1, struct: 1, \
+             template: 1",
+        ));
+}
+
+#[test]
+fn test_cpp_header_detection_and_lang_map() {
+    let fixture = get_fixtures_path().join("shapes.h");
+
+    // `.h` is shared with C; the class and namespace route it to C++
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(&fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Cpp)"))
+        .stdout(predicate::str::contains("Functions: 2"))
+        .stdout(predicate::str::contains("Classes/Structs: 1"));
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(&fixture)
+        .args(["--lang-map", "h=c"])
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: C)"));
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(&fixture)
+        .args(["--lang-map", "h=cobol"])
+        .assert()
+        .failure()
+        .stderr(predicate::str::contains("unknown language 'cobol'"));
+}
+
+#[test]
+fn test_ruby_metaprogramming_degrades_gracefully() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("plugins.rb");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Ruby"))
+        // register, inherited, the lambda, initialize, method_missing,
+        // respond_to_missing?, distance; define_method and class_eval bodies
+        // only exist at runtime
+        .stdout(predicate::str::contains("Functions: 7"))
+        .stdout(predicate::str::contains("Classes/Structs: 1"))
+        .stdout(predicate::str::contains(
+            "Breakdown: block: 3, class: 1, lambda: 1, method: 4, module: 1, \
+             singleton_class: 1, singleton_method: 2",
+        ))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_kotlin_file_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("Shop.kt");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Kotlin"))
+        // refresh, fetch, formatPrice, cheapest, and the minByOrNull lambda
+        .stdout(predicate::str::contains("Functions: 5"))
+        // Product, Result, Success, Loading, ShopViewModel, ShopApi
+        .stdout(predicate::str::contains("Classes/Structs: 6"))
+        .stdout(predicate::str::contains(
+            "Breakdown: class: 2, companion_object: 1, data_class: 2, extension_function: 2, \
+             function: 2, interface: 1, lambda: 1, method: 2, object: 1, suspend_function: 2",
+        ))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_scala_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("Shop.scala");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Scala"))
+        // fetch, add, total, cheapest, the sortBy lambda, empty, and formatPrice
+        .stdout(predicate::str::contains("Functions: 7"))
+        // Product, Result, Loading, Loaded, Catalog, and the Cart class and object
+        .stdout(predicate::str::contains("Classes/Structs: 7"))
+        .stdout(predicate::str::contains(
+            "Breakdown: case_class: 2, case_object: 1, class: 1, function: 1, lambda: 1, \
+             method: 5, object: 1, trait: 2",
+        ))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_gradle_script_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("build.gradle");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Groovy"))
+        // versionName and Report.print
+        .stdout(predicate::str::contains("Functions: 2"))
+        .stdout(predicate::str::contains("Classes/Structs: 1"))
+        // plugins, repositories, dependencies, each, register, and doLast
+        .stdout(predicate::str::contains(
+            "Breakdown: class: 1, closure: 6, function: 1, method: 1",
+        ))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_elixir_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("cart.ex");
+
+    cmd.arg(fixture)
+        .arg("--functions")
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Elixir"))
+        // Six `def`s, the macro, the private valid?, and the reduce lambda
+        .stdout(predicate::str::contains("Functions: 9"))
+        .stdout(predicate::str::contains("Classes/Structs: 1"))
+        .stdout(predicate::str::contains(
+            "Breakdown: function: 6, genserver_callback: 3, lambda: 1, macro: 1, module: 1, \
+             private_function: 1, struct: 1",
+        ))
+        .stdout(predicate::str::contains("Shop.Cart.add/3"))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_erlang_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("cart.erl");
+
+    cmd.arg(fixture)
+        .arg("--functions")
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Erlang"))
+        // Six functions and the two funs
+        .stdout(predicate::str::contains("Functions: 8"))
+        .stdout(predicate::str::contains("Classes/Structs: 1"))
+        .stdout(predicate::str::contains(
+            "Breakdown: function: 6, genserver_callback: 3, lambda: 2, macro: 1, module: 1, \
+             record: 1",
+        ))
+        .stdout(predicate::str::contains("cart:handle_cast/2"))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_haskell_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("Cart.hs");
+
+    cmd.arg(fixture)
+        .arg("--functions")
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Haskell"))
+        // Four equations, `empty`, the instance method, and the lambda
+        .stdout(predicate::str::contains("Functions: 7"))
+        .stdout(predicate::str::contains("Classes/Structs: 2"))
+        .stdout(predicate::str::contains(
+            "Breakdown: binding: 1, class: 1, data: 1, function: 4, instance: 1, lambda: 1, \
+             method: 1, module: 1, newtype: 1, type_synonym: 1",
+        ))
+        .stdout(predicate::str::contains("Shop.Cart.add"))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_ocaml_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("cart.ml");
+
+    cmd.arg(fixture)
+        .arg("--functions")
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: OCaml"))
+        // Three functions, `empty` and `count`, and the two lambdas
+        .stdout(predicate::str::contains("Functions: 7"))
+        .stdout(predicate::str::contains("Classes/Structs: 2"))
+        .stdout(predicate::str::contains(
+            "Breakdown: binding: 2, exception: 1, function: 3, lambda: 2, module: 1, type: 2",
+        ))
+        .stdout(predicate::str::contains("Cart.add"))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_zig_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("cart.zig");
+
+    cmd.arg(fixture)
+        .arg("--functions")
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Zig"))
+        // The three methods of Cart and the test block
+        .stdout(predicate::str::contains("Functions: 4"))
+        .stdout(predicate::str::contains("Classes/Structs: 3"))
+        .stdout(predicate::str::contains(
+            "Breakdown: comptime: 1, enum: 1, error_set: 1, method: 3, struct: 2, test: 1",
+        ))
+        .stdout(predicate::str::contains("Cart.add"))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_nim_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("cart.nim");
+
+    cmd.arg(fixture)
+        .arg("--functions")
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Nim"))
+        // Seven routines and the anonymous proc passed to `map`
+        .stdout(predicate::str::contains("Functions: 8"))
+        .stdout(predicate::str::contains("Classes/Structs: 3"))
+        .stdout(predicate::str::contains(
+            "Breakdown: enum: 1, func: 1, iterator: 1, lambda: 1, macro: 1, method: 1, \
+             object: 2, proc: 2, template: 1",
+        ))
+        .stdout(predicate::str::contains("withCart"))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_lua_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("cart.lua");
+
+    cmd.arg(fixture)
+        .arg("--functions")
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Lua"))
+        .stdout(predicate::str::contains("Functions: 5"))
+        .stdout(predicate::str::contains("Classes/Structs: 0"))
+        .stdout(predicate::str::contains(
+            "Breakdown: function: 2, lambda: 1, method: 2",
+        ))
+        .stdout(predicate::str::contains("Cart:total"))
+        .stdout(predicate::str::contains("Cart.names"))
+        // `log` is local and `Cart:total` has no `---` comment
+        .stdout(predicate::str::contains(
+            "Doc coverage: 2/3 public items documented (66.7%)",
+        ))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_embedded_lua_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("openresty/nginx.conf");
+
+    // The `*_by_lua_block` bodies and the `access_by_lua` string
+    cmd.arg(fixture)
+        .args(["--embedded-lua", "--no-cache"])
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Lua"))
+        .stdout(predicate::str::contains(
+            "Embedded Lua: 3 code blocks, 0 functions, 0 structs/classes, 7 code lines",
+        ));
+
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("openresty/plugins.yaml");
+
+    cmd.arg(&fixture)
+        .args(["--embedded-lua", "--no-cache"])
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Yaml"))
+        .stdout(predicate::str::contains(
+            "Embedded Lua: 1 code block, 1 functions, 0 structs/classes, 4 code lines",
+        ));
+
+    // Without the flag the YAML is configuration only
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(&fixture)
+        .arg("--no-cache")
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Embedded Lua").not());
+}
+
+#[test]
+fn test_html_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("shop.html");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Html"))
+        .stdout(predicate::str::contains("Breakdown: script: 2, style: 1"))
+        .stdout(predicate::str::contains("Web: 11 elements, max depth 4"))
+        // The inline style and script lines are counted in their languages
+        .stdout(predicate::str::contains(
+            "Lines: 18 code, 1 comments, 0 blank (5.3% comments)",
+        ))
+        .stdout(predicate::str::contains(
+            "Embedded Css: 1 code block, 0 functions, 0 structs/classes, 2 code lines",
+        ))
+        // The JSON data script is left out
+        .stdout(predicate::str::contains(
+            "Embedded JavaScript: 1 code block, 2 functions, 0 structs/classes, 3 code lines",
+        ))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_vue_component_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("Cart.vue");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Vue"))
+        // `total` and the two arrow functions of the TypeScript setup script
+        .stdout(predicate::str::contains("Functions: 3"))
+        .stdout(predicate::str::contains(
+            "Breakdown: arrow_function: 2, function: 1, rule: 2, script: 1, style: 1",
+        ))
+        .stdout(predicate::str::contains(
+            "Lines: 23 code, 1 comments, 5 blank (4.2% comments)",
+        ))
+        .stdout(predicate::str::contains(
+            "Sections: template 13, script 6, style 4 code lines",
+        ))
+        .stdout(predicate::str::contains(
+            "Web: 8 elements, 2 rules, 2 selectors, max depth 4",
+        ))
+        // The sections are the component's, not embedded code
+        .stdout(predicate::str::contains("Embedded").not())
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_svelte_component_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("Counter.svelte");
+
+    cmd.arg(fixture)
+        .arg("--functions")
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Svelte"))
+        .stdout(predicate::str::contains("Functions: 1"))
+        .stdout(predicate::str::contains("increment"))
+        .stdout(predicate::str::contains(
+            "Lines: 16 code, 0 comments, 3 blank (0.0% comments)",
+        ))
+        .stdout(predicate::str::contains(
+            "Sections: template 8, script 7, style 1 code lines",
+        ));
+}
+
+#[test]
+fn test_jinja_template_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("order.html.j2");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Jinja"))
+        .stdout(predicate::str::contains(
+            "Template: 4 interpolations, 1 conditional, 1 loop, max depth 3",
+        ))
+        // Lines of only HTML are markup
+        .stdout(predicate::str::contains(
+            "Lines: 11 code, 1 comments, 1 blank (8.3% comments), 4 markup (25.0% of non-blank)",
+        ));
+}
+
+#[test]
+fn test_go_template_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("order.gotmpl");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: GoTemplate"))
+        // `with` is a conditional as well
+        .stdout(predicate::str::contains(
+            "Template: 5 interpolations, 2 conditionals, 1 loop, max depth 3",
+        ))
+        .stdout(predicate::str::contains(
+            "Lines: 7 code, 1 comments, 0 blank (12.5% comments), 4 markup (33.3% of non-blank)",
+        ));
+}
+
+#[test]
+fn test_erb_template_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("show.html.erb");
+
+    cmd.arg(&fixture)
+        .arg("--no-cache")
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Erb"))
+        .stdout(predicate::str::contains(
+            "Template: 5 interpolations, 1 conditional, 1 loop, max depth 2",
+        ))
+        .stdout(predicate::str::contains(
+            "Lines: 9 code, 1 comments, 0 blank (10.0% comments), 4 markup (28.6% of non-blank)",
+        ))
+        .stdout(predicate::str::contains("Embedded Ruby").not());
+
+    // The Ruby of the tags, kept on the lines of the template
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    cmd.arg(&fixture)
+        .args(["--template-code", "--no-cache"])
+        .assert()
+        .success()
+        .stdout(predicate::str::contains(
+            "Embedded Ruby: 1 code block, 0 functions, 0 structs/classes, 9 code lines",
+        ));
+}
+
+#[test]
+fn test_jupyter_notebook_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("sales.ipynb");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Jupyter"))
+        .stdout(predicate::str::contains(
+            "Notebook: 4 code cells, 2 markdown cells, 1 raw cell, 20.0% markdown",
+        ))
+        // The Markdown and raw cells; the JSON and the outputs are not counted
+        .stdout(predicate::str::contains(
+            "Lines: 0 code, 0 comments, 1 blank (0.0% comments), 1 markup (25.0% of non-blank), 3 prose",
+        ))
+        // `%matplotlib` is blanked out, and the `%%bash` cell is shell
+        .stdout(predicate::str::contains(
+            "Embedded Python: 3 code blocks, 2 functions, 0 structs/classes, 9 code lines",
+        ))
+        .stdout(predicate::str::contains(
+            "Embedded Bash: 1 code block, 0 functions, 0 structs/classes, 1 code lines",
+        ));
+}
+
+#[test]
+fn test_scss_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("_buttons.scss");
+
+    cmd.arg(fixture)
+        .arg("--functions")
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Scss"))
+        // The mixin and the `@function`
+        .stdout(predicate::str::contains("Functions: 2"))
+        .stdout(predicate::str::contains(
+            "Breakdown: function: 1, include: 1, media: 1, mixin: 1, rule: 3",
+        ))
+        .stdout(predicate::str::contains(
+            "Web: 3 rules, 3 selectors, max depth 3",
+        ))
+        .stdout(predicate::str::contains("button-size"))
+        .stdout(predicate::str::contains(
+            "Doc coverage: 1/2 public items documented (50.0%)",
+        ))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_php_template_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("cart.php");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Php"))
+        // The constructor, total, and the arrow function
+        .stdout(predicate::str::contains("Functions: 3"))
+        .stdout(predicate::str::contains(
+            "Breakdown: arrow_function: 1, class: 1, function: 1, method: 1, namespace: 1",
+        ))
+        // Lines with a PHP tag count as code, the HTML between them as markup
+        .stdout(predicate::str::contains(
+            "Lines: 16 code, 1 comments, 3 blank (5.9% comments), 10 markup (37.0% of non-blank)",
+        ))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_shell_script_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("deploy.sh");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Bash"))
+        .stdout(predicate::str::contains("Functions: 2"))
+        .stdout(predicate::str::contains(
+            "Breakdown: case: 1, function: 2, if: 2, loop: 1, source: 2",
+        ))
+        // Top level 6 (`||`, two case items, if, elif), upload 5, usage 1
+        .stdout(predicate::str::contains("Script complexity: 10"))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_sql_migration_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("migration.sql");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Sql"))
+        .stdout(predicate::str::contains(
+            "Breakdown: cte: 2, ddl: 4, insert: 1, select: 1, update: 1",
+        ))
+        .stdout(predicate::str::contains(
+            "Longest statements:\n  line 13 insert (11 lines, 2 CTEs)\n  \
+             line 3 ddl (6 lines)\n  line 10 ddl (1 line)",
+        ))
+        .stdout(predicate::str::contains("Parse errors").not());
+}
+
+#[test]
+fn test_markdown_code_blocks_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("guide.md");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Markdown"))
+        .stdout(predicate::str::contains(
+            "Breakdown: code_block: 3, heading: 2",
+        ))
+        // The `text` block stays in the document; the Go blocks are extracted
+        .stdout(predicate::str::contains(
+            "Lines: 3 code, 0 comments, 7 blank (0.0% comments), 4 markup (33.3% of non-blank), 5 prose",
+        ))
+        .stdout(predicate::str::contains(
+            "Embedded Go: 2 code blocks, 2 functions, 1 structs/classes, 12 code lines",
+        ));
+}
+
+#[test]
+fn test_yaml_configuration_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("settings.yaml");
+
+    // Both `---` documents count; list items each define their own keys
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Yaml"))
+        .stdout(predicate::str::contains("Functions: 0"))
+        .stdout(predicate::str::contains(
+            "Configuration: 16 keys, max depth 3, 2 documents",
+        ));
+}
+
+#[test]
+fn test_dockerfile_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("Dockerfile");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Dockerfile"))
+        .stdout(predicate::str::contains("Functions: 0"))
+        .stdout(predicate::str::contains(
+            "Breakdown: copy: 3, entrypoint: 1, expose: 1, from: 2, run: 2, user: 1, workdir: 1",
+        ));
+}
+
+#[test]
+fn test_makefile_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("Makefile");
+
+    // `.PHONY` is a rule too, but not one of the targets
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Make"))
+        .stdout(predicate::str::contains("Functions: 5"))
+        .stdout(predicate::str::contains(
+            "Breakdown: phony: 3, rule: 5, target: 4, variable: 2",
+        ))
+        .stdout(predicate::str::contains("Complexity: max 2, mean 1.40"));
+}
+
+#[test]
+fn test_protobuf_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("cart.proto");
+
+    // Messages and enums are types, RPC methods are functions
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Protobuf"))
+        .stdout(predicate::str::contains("Functions: 4"))
+        .stdout(predicate::str::contains("Classes/Structs: 4"))
+        .stdout(predicate::str::contains(
+            "Breakdown: enum: 1, enum_value: 3, field: 8, message: 3, oneof: 1, rpc: 4, service: 1",
+        ));
+}
+
+#[test]
+fn test_proto_inventory() {
+    let fixture = get_fixtures_path().join("cart.proto");
+
+    Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+        .arg(&fixture)
+        .arg("--proto-inventory")
+        .assert()
+        .success()
+        .stdout(predicate::str::is_match(r"shop\.v1\.CartService \(\S*cart\.proto:34\)").unwrap())
+        .stdout(predicate::str::contains(
+            "  GetCart(GetCartRequest) returns (Cart)\n",
+        ))
+        .stdout(predicate::str::contains(
+            "  WatchCart(GetCartRequest) returns (stream Cart)\n",
+        ))
+        .stdout(predicate::str::contains(
+            "  AddItems(stream Item) returns (Cart)\n",
+        ))
+        .stdout(predicate::str::contains(
+            "  Clear(GetCartRequest) returns (google.protobuf.Empty)\n",
+        ))
+        .stdout(predicate::str::contains("1 services, 4 methods"));
+
+    let output = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+        .arg(&fixture)
+        .args(["--proto-inventory", "--format", "json"])
+        .output()
+        .unwrap();
+    let json: serde_json::Value = serde_json::from_slice(&output.stdout).unwrap();
+    let methods = json["services"][0]["methods"].as_array().unwrap();
+    assert_eq!(methods.len(), 4);
+    assert_eq!(methods[2]["name"], "AddItems");
+    assert_eq!(methods[2]["client_streaming"], true);
+}
+
+#[test]
+fn test_graphql_analysis() {
+    let fixtures = get_fixtures_path().join("graphql");
+
+    // Extensions add fields without defining a type
+    Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+        .arg(fixtures.join("cart.graphql"))
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Graphql"))
+        .stdout(predicate::str::contains("GraphQL: 3 types, 8 fields"));
+
+    Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+        .arg(fixtures.join("queries.graphql"))
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Functions: 3"))
+        .stdout(predicate::str::contains(
+            "GraphQL: 0 types, 0 fields, 1 query, 1 mutation, 1 fragment",
+        ));
+}
+
+#[test]
+fn test_graphql_schema() {
+    let fixtures = get_fixtures_path().join("graphql");
+
+    Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+        .arg(&fixtures)
+        .arg("--graphql-schema")
+        .assert()
+        .success()
+        .stdout(
+            predicate::str::is_match(
+                r"type Query \(\S*schema\.graphql:1, \S*cart\.graphql:13\)\n  viewer: User\n  cart\(id: ID!\): Cart\n",
+            )
+            .unwrap(),
+        )
+        .stdout(predicate::str::contains("type User implements Node ("))
+        .stdout(predicate::str::contains(
+            "  items(first: Int = 10): [Item!]!\n",
+        ))
+        // Mutation is only extended in the analyzed files
+        .stdout(predicate::str::contains("extend type Mutation ("))
+        .stdout(predicate::str::contains("7 types, 12 fields"));
+
+    let output = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+        .arg(&fixtures)
+        .args(["--graphql-schema", "--format", "json"])
+        .output()
+        .unwrap();
+    let json: serde_json::Value = serde_json::from_slice(&output.stdout).unwrap();
+    let types = json["types"].as_array().unwrap();
+    assert_eq!(types.len(), 7);
+    assert_eq!(types[2]["name"], "Mutation");
+    assert_eq!(types[2]["defined"], false);
+}
+
+#[test]
+fn test_terraform_analysis() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("main.tf");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: Hcl"))
+        .stdout(predicate::str::contains(
+            "Terraform: 2 resources (aws 1, random 1), 1 data source, 1 module, 2 variables, 1 output",
+        ))
+        // Nested blocks such as `lifecycle` are not counted
+        .stdout(predicate::str::contains(
+            "Breakdown: data: 1, module: 1, output: 1, provider: 1, resource: 2, variable: 2",
+        ))
+        .stdout(predicate::str::contains(
+            "Lines: 38 code, 1 comments, 9 blank (2.6% comments)",
+        ))
+        // `instance_count` has no description
+        .stdout(predicate::str::contains(
+            "Doc coverage: 2/3 public items documented (66.7%)",
+        ));
+}
+
+#[test]
+fn test_go_api_surface() {
+    let fixture = get_fixtures_path().join("test.go");
+
+    Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+        .arg(&fixture)
+        .arg("--api-surface")
+        .assert()
+        .success()
+        .stdout(predicate::str::is_match(r"^main \(\S*fixtures\)\n").unwrap())
+        .stdout(predicate::str::is_match(r"  type Person \(\S*test\.go:5\)\n").unwrap())
+        .stdout(predicate::str::is_match(r"  method Person\.Greet \(\S*test\.go:10\)\n").unwrap())
+        .stdout(predicate::str::contains("add").not())
+        .stdout(predicate::str::contains(
+            "1 package: 2 exported, 2 unexported (50% exported)",
+        ));
+
+    let output = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+        .arg(&fixture)
+        .args(["--api-surface", "--format", "json"])
+        .output()
+        .unwrap();
+    let json: serde_json::Value = serde_json::from_slice(&output.stdout).unwrap();
+    let symbols = json["packages"][0]["symbols"].as_array().unwrap();
+    assert_eq!(symbols.len(), 2);
+    assert_eq!(symbols[1]["name"], "Person.Greet");
+    assert_eq!(json["unexported"], 2);
+}
+
+#[test]
+fn test_node_script_without_extension() {
+    let mut cmd = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"));
+    let fixture = get_fixtures_path().join("node_script");
+
+    cmd.arg(fixture)
+        .assert()
+        .success()
+        .stdout(predicate::str::contains("Language: JavaScript"))
+        .stdout(predicate::str::contains("Functions: 2"));
+}
+
 #[test]
 fn test_unsupported_file_type() {
     let temp_dir = tempfile::TempDir::new().unwrap();
@@ -229,7 +1263,10 @@ fn test_tsx_file_detection() {
         .success()
         .stdout(predicate::str::contains("Language: TypeScript"))
         .stdout(predicate::str::contains("Functions: 3"))
-        .stdout(predicate::str::contains("Classes/Structs: 1"));
+        .stdout(predicate::str::contains("Classes/Structs: 1"))
+        .stdout(predicate::str::contains(
+            "Breakdown: arrow_function: 1, class: 1, function: 1, interface: 1, method: 1",
+        ));
 }
 
 #[test]
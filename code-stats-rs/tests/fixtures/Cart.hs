@@ -0,0 +1,44 @@
+-- | A shopping cart of items and quantities.
+module Shop.Cart
+  ( Cart(..)
+  , Priced(..)
+  , empty
+  , add
+  , total
+  ) where
+
+import qualified Data.Map as Map
+
+-- | Quantities by item name.
+newtype Cart = Cart (Map.Map String Int)
+
+data Item = Item { name :: String, price :: Int }
+  deriving (Show, Eq)
+
+type Quantity = Int
+
+class Priced a where
+  priceOf :: a -> Int
+
+instance Priced Item where
+  priceOf item = price item
+
+-- | A cart without items.
+empty :: Cart
+empty = Cart Map.empty
+
+-- | Adds a quantity of an item; non-positive quantities are ignored.
+add :: String -> Quantity -> Cart -> Cart
+add item quantity (Cart items)
+  | quantity <= 0 = Cart items
+  | otherwise = Cart (Map.insertWith (+) item quantity items)
+
+total :: (String -> Int) -> Cart -> Int
+total priceOfItem (Cart items) =
+  Map.foldrWithKey (\item quantity sum -> sum + quantity * priceOfItem item) 0 items
+
+describe :: Int -> String
+describe 0 = "empty"
+describe count = case compare count 10 of
+  LT -> "small"
+  _ -> "large"
@@ -0,0 +1,34 @@
+package com.example.shop
+
+import kotlinx.coroutines.delay
+
+/** A product offered in the shop. */
+data class Product(val id: Int, val name: String, val price: Double)
+
+sealed class Result {
+    data class Success(val products: List<Product>) : Result()
+    object Loading : Result()
+}
+
+class ShopViewModel(private val api: ShopApi) {
+    private var cache: List<Product>? = null
+
+    suspend fun refresh(): Result {
+        delay(100)
+        val products = cache ?: api.fetch()
+        cache = products
+        return if (products.isEmpty()) Result.Loading else Result.Success(products)
+    }
+
+    companion object {
+        const val TAG = "ShopViewModel"
+    }
+}
+
+interface ShopApi {
+    suspend fun fetch(): List<Product>
+}
+
+fun Double.formatPrice(): String = "%.2f".format(this)
+
+fun List<Product>.cheapest(): Product? = minByOrNull { it.price }
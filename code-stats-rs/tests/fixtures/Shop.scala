@@ -0,0 +1,30 @@
+package com.example.shop
+
+/** A product offered in the shop. */
+case class Product(id: Int, name: String, price: Double)
+
+sealed trait Result
+case object Loading extends Result
+case class Loaded(products: List[Product]) extends Result
+
+trait Catalog {
+  def fetch(): List[Product]
+}
+
+class Cart(catalog: Catalog) {
+  private var items: List[Product] = Nil
+
+  def add(product: Product): Unit = {
+    items = product :: items
+  }
+
+  def total: Double = items.map(_.price).sum
+
+  def cheapest: Option[Product] = items.sortBy(p => p.price).headOption
+}
+
+object Cart {
+  def empty(catalog: Catalog): Cart = new Cart(catalog)
+}
+
+def formatPrice(price: Double): String = f"$$$price%.2f"
@@ -0,0 +1,40 @@
+import functools
+
+
+def log_calls(func):
+    @functools.wraps(func)
+    def wrapper(*args, **kwargs):
+        return func(*args, **kwargs)
+
+    return wrapper
+
+
+class Greeter:
+    def __init__(self, name):
+        self.name = name
+
+    @property
+    def upper_name(self):
+        return self.name.upper()
+
+    @staticmethod
+    @log_calls
+    def version():
+        return "1.0"
+
+    async def greet_later(self):
+        return f"Hello, {self.name}"
+
+
+@log_calls
+async def fetch(url):
+    return url
+
+
+def main():
+    greeter = Greeter("Alice")
+    print(greeter.upper_name)
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,34 @@
+%% A shopping cart kept in a gen_server.
+-module(cart).
+-behaviour(gen_server).
+
+-export([start_link/1, add/3]).
+-export([init/1, handle_call/3, handle_cast/2]).
+
+-record(cart, {owner, items = #{}}).
+
+-define(TIMEOUT, 5000).
+
+%% @doc Starts a cart for Owner.
+-spec start_link(term()) -> {ok, pid()}.
+start_link(Owner) ->
+    gen_server:start_link(?MODULE, Owner, []).
+
+%% @doc Adds Quantity of Item to the cart.
+add(Cart, Item, Quantity) when Quantity > 0 ->
+    gen_server:cast(Cart, {add, Item, Quantity}).
+
+init(Owner) ->
+    {ok, #cart{owner = Owner}}.
+
+handle_call(count, _From, Cart = #cart{items = Items}) ->
+    Total = maps:fold(fun(_Item, Quantity, Sum) -> Sum + Quantity end, 0, Items),
+    {reply, Total, Cart}.
+
+handle_cast({add, Item, Quantity}, Cart = #cart{items = Items}) ->
+    {noreply, Cart#cart{items = maps:update_with(Item, fun(Q) -> Q + Quantity end, Quantity, Items)}};
+handle_cast(_Other, Cart) ->
+    {noreply, Cart}.
+
+valid(undefined) -> false;
+valid(_) -> true.
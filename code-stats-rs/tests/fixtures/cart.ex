@@ -0,0 +1,49 @@
+defmodule Shop.Cart do
+  @moduledoc """
+  A shopping cart kept in a GenServer.
+  """
+
+  use GenServer
+
+  defstruct items: %{}, owner: nil
+
+  @doc "Starts a cart for `owner`."
+  def start_link(owner) do
+    GenServer.start_link(__MODULE__, owner)
+  end
+
+  @doc "Adds `quantity` of `item` to the cart."
+  def add(cart, item, quantity \\ 1) when quantity > 0 do
+    GenServer.cast(cart, {:add, item, quantity})
+  end
+
+  @doc "Returns the number of items in the cart."
+  def count(cart), do: GenServer.call(cart, :count)
+
+  defmacro debug(expression) do
+    quote do: IO.inspect(unquote(expression))
+  end
+
+  @impl true
+  def init(owner), do: {:ok, %__MODULE__{owner: owner}}
+
+  @impl true
+  def handle_cast({:add, item, quantity}, cart) do
+    items = Map.update(cart.items, item, quantity, &(&1 + quantity))
+    {:noreply, %{cart | items: items}}
+  end
+
+  @impl true
+  def handle_call(:count, _from, cart) do
+    total = Enum.reduce(cart.items, 0, fn {_item, quantity}, sum -> sum + quantity end)
+    {:reply, total, cart}
+  end
+
+  defp valid?(item) do
+    case item do
+      nil -> false
+      "" -> false
+      _ -> true
+    end
+  end
+end
@@ -0,0 +1,47 @@
+--- A shopping cart of items and quantities.
+local Cart = {}
+Cart.__index = Cart
+
+--- Creates an empty cart.
+function Cart.new()
+  return setmetatable({ items = {} }, Cart)
+end
+
+-- Logs through ngx when running in OpenResty
+local function log(message)
+  if ngx then
+    ngx.log(ngx.INFO, message)
+  else
+    print(message)
+  end
+end
+
+--- Adds an item, once per quantity.
+function Cart:add(item, quantity)
+  for _ = 1, quantity or 1 do
+    table.insert(self.items, item)
+  end
+  log("added " .. item.name)
+end
+
+function Cart:total()
+  local sum = 0
+  for _, item in ipairs(self.items) do
+    if item.kind == "book" and item.price > 0 then
+      sum = sum + item.price
+    elseif item.kind == "toy" then
+      sum = sum + item.price * 2
+    end
+  end
+  return sum
+end
+
+Cart.names = function(self)
+  local names = {}
+  for i, item in ipairs(self.items) do
+    names[i] = item.name
+  end
+  return names
+end
+
+return Cart
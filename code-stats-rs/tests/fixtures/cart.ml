@@ -0,0 +1,30 @@
+(** A shopping cart of items and quantities. *)
+
+type item = { name : string; price : int }
+
+exception Empty_cart
+
+module Cart = struct
+  type t = (string * int) list
+
+  let empty = []
+
+  (** Adds [quantity] of [item]; non-positive quantities are ignored. *)
+  let add item quantity cart =
+    if quantity <= 0 then cart else (item, quantity) :: cart
+
+  let count = List.length
+end
+
+let total price_of cart =
+  List.fold_left (fun sum (item, quantity) -> sum + (quantity * price_of item)) 0 cart
+
+let describe = function
+  | [] -> "empty"
+  | [ _ ] -> "single"
+  | _ -> "several"
+
+let first cart =
+  match cart with
+  | [] -> raise Empty_cart
+  | (item, _) :: _ -> item
@@ -0,0 +1,45 @@
+## A shopping cart of items and quantities.
+
+import std/[sequtils, strutils]
+
+type
+  Kind* = enum
+    book, toy
+
+  Item* = object ## An item in the cart.
+    name*: string
+    price*: int
+    kind*: Kind
+
+  Cart* = ref object
+    entries: seq[Item]
+
+proc newCart*(): Cart =
+  ## Creates an empty cart.
+  Cart(entries: @[])
+
+proc add*(cart: Cart, item: Item, quantity = 1) =
+  for _ in 1 .. quantity:
+    cart.entries.add(item)
+
+func total*(cart: Cart): int =
+  for item in cart.entries:
+    case item.kind
+    of book: result += item.price
+    of toy: result += item.price * 2
+
+iterator books*(cart: Cart): Item =
+  for item in cart.entries:
+    if item.kind == book:
+      yield item
+
+template withCart*(body: untyped) =
+  let cart {.inject.} = newCart()
+  body
+
+macro debug*(expression: untyped): untyped =
+  result = newCall("echo", expression)
+
+method describe*(cart: Cart): string {.base.} =
+  let names = cart.entries.map(proc (item: Item): string = item.name)
+  names.join(", ")
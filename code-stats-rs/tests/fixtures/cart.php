@@ -0,0 +1,30 @@
+<?php
+namespace Shop;
+
+/** A cart line. */
+class Item
+{
+    public function __construct(public string $name, public int $price) {}
+}
+
+function total(array $items): int
+{
+    return array_sum(array_map(fn(Item $item) => $item->price, $items));
+}
+
+$items = [new Item("Tea", 300), new Item("Cake", 450)];
+?>
+<!DOCTYPE html>
+<html>
+<head>
+  <title>Cart</title>
+</head>
+<body>
+  <ul>
+  <?php foreach ($items as $item): ?>
+    <li><?= htmlspecialchars($item->name) ?></li>
+  <?php endforeach; ?>
+  </ul>
+  <p>Total: <?= total($items) ?></p>
+</body>
+</html>
@@ -0,0 +1,48 @@
+//! A shopping cart of items and quantities.
+const std = @import("std");
+
+pub const Kind = enum { book, toy };
+
+/// An item in the cart.
+pub const Item = struct {
+    name: []const u8,
+    price: u32,
+    kind: Kind,
+};
+
+pub const CartError = error{ Empty, TooMany };
+
+/// Items and quantities.
+pub const Cart = struct {
+    entries: std.ArrayList(Item),
+
+    pub fn init(allocator: std.mem.Allocator) Cart {
+        return .{ .entries = std.ArrayList(Item).init(allocator) };
+    }
+
+    /// Adds an item; at most 100 fit.
+    pub fn add(self: *Cart, item: Item) !void {
+        if (self.entries.items.len >= 100) return CartError.TooMany;
+        try self.entries.append(item);
+    }
+
+    pub fn total(self: Cart) u32 {
+        var sum: u32 = 0;
+        for (self.entries.items) |item| {
+            sum += switch (item.kind) {
+                .book => item.price,
+                .toy => item.price * 2,
+            };
+        }
+        return sum;
+    }
+};
+
+comptime {
+    std.debug.assert(@sizeOf(Kind) == 1);
+}
+
+test "total of an empty cart" {
+    var cart = Cart.init(std.testing.allocator);
+    try std.testing.expectEqual(@as(u32, 0), cart.total());
+}
@@ -0,0 +1,41 @@
+#!/usr/bin/env bash
+# Deploys the current build to the given environment.
+set -euo pipefail
+
+source "$(dirname "$0")/lib/common.sh"
+. ./config.sh
+
+usage() {
+    echo "usage: deploy.sh <staging|production>" >&2
+    exit 1
+}
+
+upload() {
+    local target=$1
+    for file in dist/*; do
+        if [[ -f "$file" && "$file" != *.map ]]; then
+            scp "$file" "$target:/srv/app/" || return 1
+        fi
+    done
+}
+
+[ $# -eq 1 ] || usage
+
+case "$1" in
+    staging)
+        upload staging.example.com
+        ;;
+    production)
+        read -r -p "Deploy to production? " answer
+        if [ "$answer" = "yes" ]; then
+            upload prod.example.com
+        elif [ "$answer" = "no" ]; then
+            exit 0
+        else
+            usage
+        fi
+        ;;
+    *)
+        usage
+        ;;
+esac
@@ -0,0 +1,62 @@
+import java.util.ArrayList;
+import java.util.List;
+import java.util.function.Function;
+
+// Generic container with nested types of every kind
+public class Container<T extends Comparable<T>> {
+    private final List<T> items = new ArrayList<>();
+
+    public Container() {}
+
+    public void add(T item) {
+        items.add(item);
+    }
+
+    public <R> List<R> map(Function<? super T, ? extends R> mapper) {
+        List<R> result = new ArrayList<>();
+        for (T item : items) {
+            result.add(mapper.apply(item));
+        }
+        return result;
+    }
+
+    // Static nested record with a compact constructor
+    public record Pair<A, B>(A first, B second) {
+        public Pair {
+            if (first == null) {
+                throw new IllegalArgumentException("first");
+            }
+        }
+    }
+
+    public enum Order {
+        ASCENDING,
+        DESCENDING;
+
+        Order reverse() {
+            return this == ASCENDING ? DESCENDING : ASCENDING;
+        }
+    }
+
+    // Inner class with its own inner class
+    public class View implements Iterable<T> {
+        class Window {
+            int size() {
+                return items.size();
+            }
+        }
+
+        @Override
+        public java.util.Iterator<T> iterator() {
+            return items.iterator();
+        }
+    }
+}
+
+interface Visitor<R> {
+    R visit(Container<?> container);
+}
+
+@interface Experimental {
+    String since() default "";
+}
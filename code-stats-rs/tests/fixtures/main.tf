@@ -0,0 +1,48 @@
+# Web tier of the shop
+terraform {
+  required_providers {
+    aws = {
+      source = "hashicorp/aws"
+    }
+  }
+}
+
+provider "aws" {
+  region = var.region
+}
+
+variable "region" {
+  description = "AWS region to deploy to"
+  default     = "eu-west-1"
+}
+
+variable "instance_count" {
+  default = 2
+}
+
+resource "aws_instance" "web" {
+  count         = var.instance_count
+  ami           = data.aws_ami.ubuntu.id
+  instance_type = "t3.micro"
+
+  lifecycle {
+    create_before_destroy = true
+  }
+}
+
+resource "random_id" "suffix" {
+  byte_length = 4
+}
+
+data "aws_ami" "ubuntu" {
+  most_recent = true
+}
+
+module "vpc" {
+  source = "./modules/vpc"
+}
+
+output "url" {
+  description = "Public DNS name of the first instance"
+  value       = aws_instance.web[0].public_dns
+}
@@ -0,0 +1,30 @@
+-- Split customer addresses out of the orders table.
+
+CREATE TABLE addresses (
+    id serial PRIMARY KEY,
+    customer_id integer NOT NULL,
+    street text NOT NULL,
+    city text NOT NULL
+);
+
+CREATE INDEX addresses_customer_idx ON addresses (customer_id);
+
+/* Keep the most recent address of every customer. */
+WITH latest AS (
+    SELECT customer_id, max(created_at) AS created_at
+    FROM orders
+    GROUP BY customer_id
+), chosen AS (
+    SELECT o.customer_id, o.street, o.city
+    FROM orders o
+    JOIN latest l ON l.customer_id = o.customer_id AND l.created_at = o.created_at
+)
+INSERT INTO addresses (customer_id, street, city)
+SELECT customer_id, street, city FROM chosen;
+
+UPDATE orders SET street = NULL, city = NULL;
+
+ALTER TABLE orders DROP COLUMN street;
+ALTER TABLE orders DROP COLUMN city;
+
+SELECT count(*) FROM addresses;
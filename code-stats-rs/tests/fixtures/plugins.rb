@@ -0,0 +1,59 @@
+# frozen_string_literal: true
+
+require "forwardable"
+
+# Metaprogramming-heavy code: most of these methods only exist at runtime,
+# so just the literal `def`s are counted.
+module Plugins
+  REGISTRY = {}
+
+  def self.register(name, &block)
+    REGISTRY[name] = block
+  end
+
+  class Base
+    extend Forwardable
+    def_delegators :@options, :[], :fetch
+
+    %w[start stop restart].each do |action|
+      define_method("#{action}!") do |*args|
+        send(action, *args)
+      end
+    end
+
+    class << self
+      def inherited(subclass)
+        super
+        Plugins.register(subclass.name, -> { subclass.new })
+      end
+    end
+
+    def initialize(options = {})
+      @options = options
+    end
+
+    def method_missing(name, *args, &block)
+      if name.to_s.end_with?("?")
+        @options.key?(name.to_s.chomp("?").to_sym)
+      else
+        super
+      end
+    end
+
+    def respond_to_missing?(name, include_private = false)
+      name.to_s.end_with?("?") || super
+    end
+  end
+
+  Point = Struct.new(:x, :y) do
+    def distance
+      Math.sqrt(x**2 + y**2)
+    end
+  end
+
+  Base.class_eval <<~RUBY, __FILE__, __LINE__ + 1
+    def generated
+      :generated
+    end
+  RUBY
+end
@@ -0,0 +1,14 @@
+#pragma once
+
+namespace geo {
+
+class Circle {
+public:
+    explicit Circle(double r) : r_(r) {}
+    double area() const { return 3.14159 * r_ * r_; }
+
+private:
+    double r_;
+};
+
+}  // namespace geo
@@ -0,0 +1,31 @@
+#include <stdlib.h>
+
+#define BUFFER_SIZE 256
+#define MIN(a, b) ((a) < (b) ? (a) : (b))
+
+// Linked list node
+struct node {
+    int value;
+    struct node *next;
+};
+
+typedef enum { OK, ERR } status;
+
+static struct node *push(struct node *head, int value) {
+    struct node *n = malloc(sizeof *n);
+    if (n == NULL) {
+        return head;
+    }
+    n->value = value;
+    n->next = head;
+    return n;
+}
+
+int length(const struct node *head) {
+    int count = 0;
+    while (head != NULL) {
+        count++;
+        head = head->next;
+    }
+    return count;
+}
@@ -0,0 +1,40 @@
+#include <string>
+#include <vector>
+
+#define LOG(msg) do { } while (0)
+
+namespace shapes {
+
+// Base class for all shapes
+class Shape {
+public:
+    virtual ~Shape() {}
+    virtual double area() const { return 0; }
+};
+
+class Rect : public Shape {
+public:
+    Rect(double w, double h) : w_(w), h_(h) {}
+    double area() const override { return w_ * h_; }
+
+private:
+    double w_;
+    double h_;
+};
+
+template <typename T>
+struct Stack {
+    std::vector<T> items;
+
+    void push(const T &item) { items.push_back(item); }
+};
+
+double total_area(const std::vector<Shape *> &shapes) {
+    double sum = 0;
+    for (const auto *shape : shapes) {
+        sum += shape->area();
+    }
+    return sum;
+}
+
+}
@@ -0,0 +1,33 @@
+trait Shape {
+    fn area(&self) -> f64;
+
+    fn name(&self) -> String {
+        String::from("shape")
+    }
+}
+
+struct Circle {
+    radius: f64,
+}
+
+enum Unit {
+    Metric,
+    Imperial,
+}
+
+impl Shape for Circle {
+    fn area(&self) -> f64 {
+        3.14 * self.radius * self.radius
+    }
+}
+
+impl Circle {
+    fn new(radius: f64) -> Self {
+        Self { radius }
+    }
+}
+
+fn main() {
+    let circle = Circle::new(1.0);
+    println!("{} {}", circle.name(), circle.area());
+}
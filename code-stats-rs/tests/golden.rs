@@ -0,0 +1,50 @@
+//! Golden-file tests: the text report for each file in `tests/golden` must
+//! match the `.golden` file next to it exactly.
+//!
+//! After an intended change to the output, run the tests with
+//! `UPDATE_GOLDEN=1` to rewrite the expected files, and review the diff.
+
+use std::env;
+use std::fs;
+use std::path::PathBuf;
+use std::process::Command;
+
+fn get_golden_path() -> PathBuf {
+    PathBuf::from(env!("CARGO_MANIFEST_DIR")).join("tests/golden")
+}
+
+/// Analyzes `name` from inside the golden directory, so the report shows the
+/// bare file name, and compares it with `<name>.golden`.
+fn assert_golden(name: &str) {
+    let dir = get_golden_path();
+    let output = Command::new(env!("CARGO_BIN_EXE_code-stats-rs"))
+        .current_dir(&dir)
+        .args([name, "--no-cache"])
+        .output()
+        .expect("Failed to run code-stats-rs");
+    assert!(
+        output.status.success(),
+        "code-stats-rs failed on {name}: {}",
+        String::from_utf8_lossy(&output.stderr)
+    );
+    let actual = String::from_utf8(output.stdout).unwrap();
+
+    let golden = dir.join(format!("{name}.golden"));
+    if env::var_os("UPDATE_GOLDEN").is_some() {
+        fs::write(&golden, &actual).unwrap();
+        return;
+    }
+    let expected = fs::read_to_string(&golden)
+        .unwrap_or_else(|e| panic!("Failed to read {}: {e}", golden.display()));
+    assert_eq!(
+        actual,
+        expected,
+        "Output for {name} differs from {}; rerun with UPDATE_GOLDEN=1 to accept it",
+        golden.display()
+    );
+}
+
+#[test]
+fn test_golden_swift() {
+    assert_golden("Shapes.swift");
+}
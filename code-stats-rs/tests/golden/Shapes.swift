@@ -0,0 +1,70 @@
+import SwiftUI
+
+/// Clamps a value to a closed range.
+@propertyWrapper
+public struct Clamped {
+    private var value: Int
+    private let range: ClosedRange<Int>
+
+    public var wrappedValue: Int {
+        get { value }
+        set { value = min(max(newValue, range.lowerBound), range.upperBound) }
+    }
+
+    public init(wrappedValue: Int, _ range: ClosedRange<Int>) {
+        self.range = range
+        self.value = min(max(wrappedValue, range.lowerBound), range.upperBound)
+    }
+}
+
+/// Something with an area.
+public protocol Shape {
+    func area() -> Double
+}
+
+public struct Square: Shape {
+    @Clamped(0...100) var side: Int = 1
+
+    public func area() -> Double {
+        Double(side * side)
+    }
+}
+
+public enum Size {
+    case small, large
+
+    /// Picks a size for an area.
+    public init(area: Double) {
+        self = area > 50 ? .large : .small
+    }
+}
+
+final class Gallery: ObservableObject {
+    @Published var shapes: [Shape] = []
+
+    // Largest first.
+    func sorted() -> [Shape] {
+        shapes.sorted { $0.area() > $1.area() }
+    }
+
+    func describe(limit: Int?) -> String {
+        let max = limit ?? shapes.count
+        guard max > 0 else {
+            return "empty"
+        }
+        for shape in shapes.prefix(max) {
+            if shape.area() > 100 {
+                return "large"
+            } else if shape.area() == 0 {
+                continue
+            }
+        }
+        return "small"
+    }
+}
+
+extension Gallery {
+    func clear() {
+        shapes.removeAll()
+    }
+}
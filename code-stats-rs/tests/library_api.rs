@@ -0,0 +1,84 @@
+mod common;
+
+use code_stats_rs::{
+    CodeAnalyzer, CodeStatsError, DirectoryOptions, SupportedLanguage, analyze_path,
+};
+use common::create_controlled_test_project;
+use std::path::Path;
+
+#[test]
+fn test_analyze_path_directory() {
+    let (_temp_dir, project_root) = create_controlled_test_project();
+
+    let stats = analyze_path(&project_root, &DirectoryOptions::default()).unwrap();
+
+    assert_eq!(stats.total_files(), 3);
+    assert_eq!(stats.total_stats.function_count, 5);
+    assert_eq!(stats.total_stats.class_struct_count, 4);
+    assert_eq!(
+        stats.total_by_language[&SupportedLanguage::Rust].file_count,
+        2
+    );
+    assert_eq!(
+        stats.total_by_language[&SupportedLanguage::Python].file_count,
+        1
+    );
+
+    let mut names: Vec<&str> = stats
+        .functions()
+        .map(|f| f.function.name.as_str())
+        .collect();
+    names.sort_unstable();
+    assert_eq!(
+        names,
+        vec![
+            "function_one",
+            "function_one",
+            "function_three",
+            "function_two",
+            "function_two"
+        ]
+    );
+}
+
+#[test]
+fn test_analyze_path_file_and_ignore_patterns() {
+    let (_temp_dir, project_root) = create_controlled_test_project();
+
+    let stats = analyze_path(&project_root.join("file2.rs"), &DirectoryOptions::default()).unwrap();
+    assert_eq!(stats.total_files(), 1);
+    assert_eq!(stats.files[0].language, SupportedLanguage::Rust);
+    assert_eq!(stats.files[0].stats.kinds["enum"], 1);
+
+    let options = DirectoryOptions {
+        ignore_patterns: vec![".py".to_string()],
+        ..DirectoryOptions::default()
+    };
+    let stats = analyze_path(&project_root, &options).unwrap();
+    assert_eq!(stats.total_files(), 2);
+    assert!(
+        !stats
+            .total_by_language
+            .contains_key(&SupportedLanguage::Python)
+    );
+}
+
+#[test]
+fn test_analyzer_text_and_errors() {
+    let mut analyzer = CodeAnalyzer::new();
+
+    let file = analyzer
+        .analyze_text(
+            Path::new("snippet.go"),
+            SupportedLanguage::Go,
+            "package main\n\nfunc main() {\n\tif true {\n\t}\n}\n",
+        )
+        .unwrap();
+    assert_eq!(file.stats.function_count, 1);
+    assert_eq!(file.stats.functions[0].complexity, 2);
+
+    match analyzer.analyze_path(Path::new("does/not/exist"), &DirectoryOptions::default()) {
+        Err(CodeStatsError::IoError(message)) => assert!(message.contains("neither")),
+        other => panic!("expected an IoError, got {other:?}"),
+    }
+}
@@ -3,6 +3,7 @@ mod common;
 use common::{
     assert_contains_all, create_controlled_test_project, parse_json_output, run_code_stats,
 };
+use std::fs;
 
 #[test]
 fn test_summary_format() {
@@ -88,6 +89,9 @@ fn test_json_format() {
     let json = parse_json_output(&stdout);
 
     // Check top-level structure
+    assert_eq!(json["schema_version"], 1);
+    assert_eq!(json["analyzer_version"], env!("CARGO_PKG_VERSION"));
+    assert_eq!(json["total_files"], 3);
     assert!(json.get("files").is_some());
     assert!(json.get("total_by_language").is_some());
     assert!(json.get("total_stats").is_some());
@@ -111,6 +115,60 @@ fn test_json_format() {
     let total_stats = &json["total_stats"];
     assert_eq!(total_stats["function_count"], 5); // 3 Rust + 2 Python
     assert_eq!(total_stats["class_struct_count"], 4); // 3 Rust + 1 Python
+    assert_eq!(json["parse_health"], 100.0);
+}
+
+#[test]
+fn test_output_does_not_depend_on_job_count() {
+    let (_temp_dir, project_root) = create_controlled_test_project();
+    for i in 0..12 {
+        fs::write(
+            project_root.join(format!("extra{i}.rs")),
+            format!("fn extra{i}() {{}}\n"),
+        )
+        .unwrap();
+    }
+    let root = project_root.to_str().unwrap();
+
+    for format in ["summary", "detail", "json", "csv"] {
+        let run = |jobs: &str| {
+            let output = run_code_stats(&[root, "--format", format, "--jobs", jobs, "--no-cache"]);
+            assert!(output.status.success());
+            output.stdout
+        };
+        assert_eq!(run("1"), run("8"), "--format {format} differs");
+    }
+}
+
+#[test]
+fn test_parse_health_reports_broken_files() {
+    let (_temp_dir, project_root) = create_controlled_test_project();
+    fs::write(
+        project_root.join("broken.go"),
+        "package main\n\nfunc main() {\n\tprintln(\"unclosed\"\n",
+    )
+    .unwrap();
+
+    let output = run_code_stats(&[project_root.to_str().unwrap(), "--format", "json"]);
+    assert!(output.status.success());
+    let json = parse_json_output(&String::from_utf8_lossy(&output.stdout));
+    assert_eq!(json["parse_health"], 75.0);
+    let broken = json["files"]
+        .as_array()
+        .unwrap()
+        .iter()
+        .find(|file| file["path"].as_str().unwrap().ends_with("broken.go"))
+        .unwrap();
+    assert!(
+        !broken["stats"]["parse_issues"]
+            .as_array()
+            .unwrap()
+            .is_empty()
+    );
+
+    let output = run_code_stats(&[project_root.to_str().unwrap()]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    assert!(stdout.contains("Parse health: 75.0% (3 of 4 files parsed cleanly)"));
 }
 
 #[test]
@@ -208,6 +266,34 @@ struct TestStruct {}
     assert!(!stdout.contains("Language Summary:"));
 }
 
+#[test]
+fn test_single_file_json_format_uses_report_schema() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let test_file = temp_dir.path().join("single.rs");
+    common::create_test_file(
+        &test_file,
+        r#"
+fn test_function() {}
+struct TestStruct {}
+"#,
+    );
+
+    let output = run_code_stats(&[test_file.to_str().unwrap(), "--format", "json"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+
+    assert!(output.status.success());
+
+    let json = parse_json_output(&stdout);
+    assert_eq!(json["schema_version"], 1);
+    assert_eq!(json["total_files"], 1);
+    assert_eq!(json["files"].as_array().unwrap().len(), 1);
+    assert_eq!(json["files"][0]["language"], "Rust");
+    assert_eq!(json["files"][0]["stats"]["kinds"]["function"], 1);
+    assert_eq!(json["total_by_language"]["Rust"]["file_count"], 1);
+    assert_eq!(json["total_stats"]["function_count"], 1);
+    assert_eq!(json["total_stats"]["class_struct_count"], 1);
+}
+
 #[test]
 fn test_format_with_special_characters_in_path() {
     let temp_dir = tempfile::TempDir::new().unwrap();
@@ -229,3 +315,209 @@ fn test_format_with_special_characters_in_path() {
     let file_path = files[0]["path"].as_str().unwrap();
     assert!(file_path.contains("file with spaces.rs"));
 }
+
+#[test]
+fn test_sarif_format_reports_threshold_violations() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let project_root = temp_dir.path();
+    let branchy = project_root.join("src/branchy.rs");
+    common::create_test_file(
+        &branchy,
+        r#"
+fn branchy(x: i32) -> i32 {
+    if x > 1 && x < 10 {
+        return 1;
+    }
+    if x > 100 {
+        return 2;
+    }
+    0
+}
+"#,
+    );
+
+    let output = run_code_stats(&[
+        project_root.to_str().unwrap(),
+        "--format",
+        "sarif",
+        "--complexity-threshold",
+        "3",
+        "--max-function-lines",
+        "8",
+    ]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+
+    assert!(output.status.success());
+
+    let sarif = parse_json_output(&stdout);
+    assert_eq!(sarif["version"], "2.1.0");
+    let results = sarif["runs"][0]["results"].as_array().unwrap();
+    assert_eq!(results.len(), 2);
+    for (result, rule) in results.iter().zip(["CS0001", "CS0002"]) {
+        assert_eq!(result["ruleId"], rule);
+        let location = &result["locations"][0]["physicalLocation"];
+        assert!(
+            location["artifactLocation"]["uri"]
+                .as_str()
+                .unwrap()
+                .ends_with("src/branchy.rs")
+        );
+        assert_eq!(location["region"]["startLine"], 2);
+        assert_eq!(location["region"]["endLine"], 10);
+    }
+}
+
+#[test]
+fn test_ci_annotation_formats() {
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let project_root = temp_dir.path();
+    common::create_test_file(
+        &project_root.join("src/branchy.rs"),
+        r#"
+fn branchy(x: i32) -> i32 {
+    if x > 1 && x < 10 {
+        return 1;
+    }
+    0
+}
+"#,
+    );
+    let run = |format: &str| {
+        let output = run_code_stats(&[
+            project_root.to_str().unwrap(),
+            "--format",
+            format,
+            "--complexity-threshold",
+            "2",
+        ]);
+        assert!(output.status.success());
+        String::from_utf8_lossy(&output.stdout).into_owned()
+    };
+
+    let annotations = run("github-annotations");
+    let line = annotations.lines().find(|line| !line.is_empty()).unwrap();
+    assert!(line.starts_with("::warning file="), "{line}");
+    assert_contains_all(
+        line,
+        &[
+            "src/branchy.rs,line=2,endLine=7,title=FunctionTooComplex::",
+            "Function 'branchy' has a cyclomatic complexity of 3 (threshold 2)",
+        ],
+    );
+
+    let issues = parse_json_output(&run("gitlab-codequality"));
+    let issues = issues.as_array().unwrap();
+    assert_eq!(issues.len(), 1);
+    assert_eq!(issues[0]["check_name"], "FunctionTooComplex");
+    assert_eq!(issues[0]["location"]["lines"]["begin"], 2);
+    assert!(
+        issues[0]["location"]["path"]
+            .as_str()
+            .unwrap()
+            .ends_with("src/branchy.rs")
+    );
+}
+
+#[test]
+fn test_html_format() {
+    let (_temp_dir, project_root) = create_controlled_test_project();
+
+    let output = run_code_stats(&[project_root.to_str().unwrap(), "--format", "html"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+
+    assert!(output.status.success());
+    assert!(stdout.starts_with("<!DOCTYPE html>"));
+    assert_contains_all(
+        &stdout,
+        &[
+            "<h2>Languages</h2>",
+            "<h2>Largest files</h2>",
+            "<h2>Files</h2>",
+            "<h2>Functions</h2>",
+            "<table class=\"sortable\">",
+            "<td>Rust</td>",
+            "<td>Python</td>",
+            "<td>function_three</td>",
+            "<script>",
+        ],
+    );
+    // The report is self-contained
+    assert!(!stdout.contains("<link"));
+    assert!(!stdout.contains("src=\""));
+}
+
+#[test]
+fn test_markdown_format() {
+    let (_temp_dir, project_root) = create_controlled_test_project();
+
+    let output = run_code_stats(&[project_root.to_str().unwrap(), "--format", "markdown"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+
+    assert!(output.status.success());
+    assert!(stdout.starts_with("### Code statistics"));
+    assert_contains_all(
+        &stdout,
+        &[
+            "| Language | Files | Code lines | Functions | Structs/classes |",
+            "| Python | 1 | 6 | 2 | 1 |",
+            "| Rust | 2 | 6 | 3 | 3 |",
+            "| **Total** | **3** | **12** | **5** | **4** |",
+            "Complexity: max 1, mean 1.0, 0 functions above 10",
+        ],
+    );
+    assert!(!stdout.contains("<details>"));
+}
+
+#[test]
+fn test_emit_tags() {
+    let (_temp_dir, project_root) = create_controlled_test_project();
+    let tags_path = project_root.join("tags");
+
+    let output = run_code_stats(&[
+        project_root.to_str().unwrap(),
+        "--emit-tags",
+        tags_path.to_str().unwrap(),
+    ]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    assert!(output.status.success());
+    assert!(stdout.contains("Wrote 9 tags to"));
+
+    let tags = fs::read_to_string(&tags_path).unwrap();
+    assert!(tags.starts_with("!_TAG_FILE_FORMAT\t2\t"));
+    let file1 = project_root.join("file1.rs");
+    assert!(tags.contains(&format!(
+        "function_one\t{}\t/^fn function_one() {{}}$/;\"\tfunction\tline:2\n",
+        file1.display()
+    )));
+    assert_contains_all(
+        &tags,
+        &[
+            "EnumOne\t",
+            "\tenum\tline:4",
+            "ClassOne\t",
+            "\tclass\tline:8",
+        ],
+    );
+
+    // Entries are sorted, so both function_one tags are adjacent
+    let names: Vec<&str> = tags
+        .lines()
+        .filter(|line| !line.starts_with("!_TAG_"))
+        .map(|line| line.split('\t').next().unwrap())
+        .collect();
+    let mut sorted = names.clone();
+    sorted.sort_unstable();
+    assert_eq!(names, sorted);
+    assert_eq!(names.len(), 9);
+
+    // "-" writes the tags file to stdout instead
+    let file2 = project_root.join("file2.rs");
+    let output = run_code_stats(&[file2.to_str().unwrap(), "--emit-tags", "-"]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    assert!(output.status.success());
+    assert_contains_all(
+        &stdout,
+        &["!_TAG_PROGRAM_NAME\tcode-stats-rs", "function_three\t"],
+    );
+    assert!(!stdout.contains("function_one"));
+}